@@ -0,0 +1,59 @@
+// Command compressboards converts stored boards to the encoding the backend
+// writes them in now: boards past BOARD_COMPRESSION_MIN_BYTES are stored
+// compressed. With -decompress every board is stored as a document again,
+// for rolling back to a version without compression.
+//
+//	go run ./cmd/compressboards [-decompress] [-dry-run]
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/joho/godotenv"
+	"github.com/sarwanazhar/boardsar/backend/config"
+	"github.com/sarwanazhar/boardsar/backend/database"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"github.com/sarwanazhar/boardsar/backend/repository"
+)
+
+func main() {
+	decompress := flag.Bool("decompress", false, "store every compressed board as a document again")
+	dryRun := flag.Bool("dry-run", false, "report what would change without writing")
+	flag.Parse()
+
+	if os.Getenv("PORT") == "" {
+		godotenv.Load()
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+	if err := libs.Configure(cfg); err != nil {
+		log.Fatalf("❌ invalid configuration: %v", err)
+	}
+	database.ConnectMongo(cfg.MongoURI, cfg.DatabaseName)
+	libs.ConfigureBoardCompression()
+
+	if !*decompress && models.BoardCompressionThreshold.Load() == 0 {
+		log.Fatal("❌ BOARD_COMPRESSION is off; nothing to compress")
+	}
+
+	report, err := libs.RecompressBoards(context.Background(), repository.NewMongoBoards(), *decompress, *dryRun, func(report libs.BoardCompressionReport) {
+		log.Printf("%d boards converted...", report.Converted)
+	})
+	if err != nil {
+		log.Fatalf("❌ Stopped after %d boards: %v", report.Converted, err)
+	}
+
+	verb := "Converted"
+	if *dryRun {
+		verb = "Would convert"
+	}
+	fmt.Printf("%s %d of %d boards (%d skipped, saved meanwhile): %d bytes to %d bytes\n",
+		verb, report.Converted, report.Scanned, report.Skipped, report.Before, report.After)
+}
@@ -0,0 +1,846 @@
+// Package config loads the backend's settings from the environment
+// once, at startup, and checks them, so a misconfigured instance stops
+// before it serves a request instead of failing on the first one that needs
+// the setting. Only the logging and tracing variables, which are needed
+// before the configuration is loaded, are read where they are used.
+package config
+
+import (
+	"crypto/ecdh"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Defaults for settings that may be left unset
+const (
+	DefaultPort            = "8080"
+	DefaultDatabaseName    = "boardsar"
+	DefaultAccessTokenTTL  = 15 * time.Minute
+	DefaultRefreshTokenTTL = 30 * 24 * time.Hour
+	DefaultDBTimeout       = 5 * time.Second
+	DefaultBoardCacheTTL   = 5 * time.Minute
+	DefaultBoardRefTTL     = 24 * time.Hour
+	DefaultBoardMaxSize    = 16 << 20
+	DefaultMaxRequestBody  = 32 << 20
+	DefaultFrontendURL     = "http://localhost:3000"
+	DefaultAPIURL          = "http://localhost:8080"
+
+	DefaultPasswordResetTTL   = time.Hour
+	DefaultEmailChangeTTL     = 24 * time.Hour
+	DefaultMagicLinkTTL       = 15 * time.Minute
+	DefaultGuestTokenTTL      = 15 * time.Minute
+	DefaultDeletionGrace      = 7 * 24 * time.Hour
+	DefaultActivityRetention  = 90 * 24 * time.Hour
+	DefaultJobRetention       = time.Hour
+	DefaultWorkerSyncBudget   = 5 * time.Second
+	DefaultWorkerJobTimeout   = 2 * time.Minute
+	DefaultMaintenanceTimeout = time.Hour
+	DefaultThumbnailDelay     = 5 * time.Second
+	DefaultWebhookRetryDelay  = 30 * time.Second
+	DefaultCORSMaxAge         = 12 * time.Hour
+	DefaultReadTimeout        = 30 * time.Second
+	DefaultWriteTimeout       = 2 * time.Minute
+	DefaultIdleTimeout        = 2 * time.Minute
+	DefaultShutdownTimeout    = 30 * time.Second
+
+	DefaultAssetMaxSize             = 10 << 20
+	DefaultAvatarMaxSize            = 2 << 20
+	DefaultTileCacheBytes           = 64 << 20
+	DefaultShapeIndexThreshold      = 500
+	DefaultBoardVersionRetention    = 50
+	DefaultBoardCompressionMinBytes = 16 << 10
+	DefaultWorkerQueue              = 50
+	DefaultAuthRateLimit            = "20/1m"
+	DefaultBoardRateLimit           = "600/1m"
+	// DefaultCountryHeader is where the edge proxy puts the visitor's
+	// country: Cloudflare's header
+	DefaultCountryHeader = "CF-IPCountry"
+	// DefaultServiceName names the service in authenticator apps and to
+	// passkeys
+	DefaultServiceName = "BoardSar"
+	DefaultSMTPPort    = "587"
+	DefaultMailFrom    = "no-reply@boardsar.app"
+	DefaultS3Region    = "us-east-1"
+
+	// minJWTSecret is the shortest JWT_SECRET accepted
+	minJWTSecret = 16
+	// maxBoardMaxSize is the largest BOARD_MAX_SIZE accepted, as large as a
+	// stored board may expand to
+	maxBoardMaxSize = 64 << 20
+	// minMaxRequestBody and maxMaxRequestBody bound MAX_REQUEST_BODY
+	minMaxRequestBody = 1 << 10
+	maxMaxRequestBody = 1 << 30
+)
+
+// Storage backends, for ASSET_STORAGE and BOARD_ARCHIVE_STORAGE
+const (
+	AssetStorageGridFS  = "gridfs"
+	AssetStorageS3      = "s3"
+	ArchiveStorageMongo = "mongo"
+	ArchiveStorageS3    = "s3"
+)
+
+// Audit event formats, for AUDIT_FORWARD_FORMAT
+const (
+	AuditFormatJSON   = "json"
+	AuditFormatSplunk = "splunk"
+)
+
+// WorkerPools are the worker pools, sized by WORKER_LIMIT_<POOL> and
+// WORKER_QUEUE_<POOL>
+var WorkerPools = []string{"export", "import", "ai", "thumbnail", "maintenance"}
+
+// DefaultIntervals are how often the background workers run unless their
+// variable says otherwise
+var DefaultIntervals = Intervals{
+	Deletion:             time.Minute,
+	Succession:           time.Hour,
+	StorageSnapshot:      6 * time.Hour,
+	BoardArchive:         time.Hour,
+	BoardFreeze:          15 * time.Second,
+	AuditForward:         30 * time.Second,
+	ShapeTypesRefresh:    time.Minute,
+	CORSRefresh:          time.Minute,
+	BoardTokenRevocation: 10 * time.Second,
+}
+
+// DefaultCORSOrigins are the frontend origins allowed to call the API when
+// CORS_ALLOWED_ORIGINS is unset
+var DefaultCORSOrigins = []string{"https://boardsar.vercel.app", "http://localhost:3000"}
+
+// Config is the backend's core configuration
+type Config struct {
+	Port         string // PORT
+	MongoURI     string // MONGODB_URI, required
+	DatabaseName string // MONGODB_DATABASE
+	// DBTimeout bounds each request's database calls
+	DBTimeout time.Duration // DB_TIMEOUT
+
+	JWTSecret       string        // JWT_SECRET, required; signs access, guest and embed tokens
+	AccessTokenTTL  time.Duration // ACCESS_TOKEN_TTL
+	RefreshTokenTTL time.Duration // REFRESH_TOKEN_TTL
+
+	// The refresh token cookie. The frontend is on another site in
+	// production, so release builds default to SameSite=None, which
+	// browsers only accept on secure cookies.
+	CookieSecure   bool          // COOKIE_SECURE
+	CookieSameSite http.SameSite // COOKIE_SAMESITE: lax, strict or none
+
+	CORSOrigins    []string // CORS_ALLOWED_ORIGINS, comma separated
+	TrustedProxies []string // TRUSTED_PROXIES, comma separated IPs or CIDRs
+	FrontendURL    string   // FRONTEND_URL, without a trailing slash
+	APIURL         string   // API_URL, without a trailing slash
+	RedisURL       string   // REDIS_URL, optional
+
+	// How long GetBoard keeps a board in Redis, and remembers which board a
+	// boardId names. Without Redis, or with BOARD_CACHE_TTL=0, boards
+	// aren't cached.
+	BoardCacheTTL time.Duration // BOARD_CACHE_TTL
+	BoardRefTTL   time.Duration // BOARD_CACHE_REF_TTL
+
+	// BoardMaxSize caps a board's contents, in bytes of BSON before
+	// compression, on every write
+	BoardMaxSize int64 // BOARD_MAX_SIZE
+
+	// MaxRequestBody caps every request body in bytes, as sent and, for
+	// gzip-compressed bodies, once decompressed
+	MaxRequestBody int64 // MAX_REQUEST_BODY
+
+	// How long emailed and guest tokens stay valid
+	PasswordResetTTL time.Duration // PASSWORD_RESET_TTL
+	EmailChangeTTL   time.Duration // EMAIL_CHANGE_TTL
+	MagicLinkTTL     time.Duration // MAGIC_LINK_TTL
+	GuestTokenTTL    time.Duration // GUEST_TOKEN_TTL
+	// MagicLinkSignup lets sign-in links create accounts
+	MagicLinkSignup bool // MAGIC_LINK_SIGNUP
+
+	// DeletionGracePeriod is how long deleted boards and accounts are kept;
+	// 0 deletes them at once
+	DeletionGracePeriod time.Duration // DELETION_GRACE_PERIOD, a duration, 0 or off
+	ActivityRetention   time.Duration // ACTIVITY_RETENTION
+	// ThumbnailDelay is how long after the last save a thumbnail is drawn
+	ThumbnailDelay    time.Duration // THUMBNAIL_DELAY
+	WebhookRetryDelay time.Duration // WEBHOOK_RETRY_DELAY
+	CORSMaxAge        time.Duration // CORS_MAX_AGE
+
+	// The HTTP server's timeouts, and how long shutting down waits for
+	// requests in flight
+	ReadTimeout     time.Duration // SERVER_READ_TIMEOUT
+	WriteTimeout    time.Duration // SERVER_WRITE_TIMEOUT
+	IdleTimeout     time.Duration // SERVER_IDLE_TIMEOUT
+	ShutdownTimeout time.Duration // SHUTDOWN_TIMEOUT
+
+	// How often the background workers run
+	Intervals Intervals
+
+	// Rate limits, per client IP for sign-in and per user for the board
+	// API. The zero RateLimit turns one off.
+	AuthRateLimit  RateLimit // RATE_LIMIT_AUTH
+	BoardRateLimit RateLimit // RATE_LIMIT_BOARDS
+
+	// Worker pools. Pools missing from WorkerLimits or WorkerQueues keep
+	// their defaults.
+	WorkerLimits       map[string]int   // WORKER_LIMIT_<POOL>
+	WorkerQueues       map[string]int64 // WORKER_QUEUE_<POOL>
+	WorkerJobTimeout   time.Duration    // WORKER_JOB_TIMEOUT
+	MaintenanceTimeout time.Duration    // WORKER_JOB_TIMEOUT_MAINTENANCE
+	// WorkerSyncBudget is how long a request waits for its job before
+	// answering 202
+	WorkerSyncBudget time.Duration // WORKER_SYNC_BUDGET
+	JobRetention     time.Duration // JOB_RETENTION
+
+	// Quotas per user, and collaborators per board; 0 is unlimited
+	BoardLimit        int64 // BOARD_LIMIT
+	StorageLimitBytes int64 // STORAGE_LIMIT_BYTES
+	CollaboratorLimit int64 // COLLABORATOR_LIMIT
+
+	AssetMaxSize   int64  // ASSET_MAX_SIZE
+	AvatarMaxSize  int64  // AVATAR_MAX_SIZE
+	AssetStorage   string // ASSET_STORAGE: gridfs or s3
+	TileCacheBytes int64  // TILE_CACHE_BYTES
+
+	// ShapeIndexThreshold is how many shapes a board needs to be indexed
+	ShapeIndexThreshold   int   // SHAPE_INDEX_THRESHOLD
+	BoardVersionRetention int64 // BOARD_VERSION_RETENTION
+	// BoardCompressionMinBytes is the size from which board contents are
+	// stored compressed; 0 turns compression off
+	BoardCompressionMinBytes int64 // BOARD_COMPRESSION (zstd or off), BOARD_COMPRESSION_MIN_BYTES
+	// BoardArchiveMonths is how long a board goes untouched before it is
+	// archived; 0 never archives
+	BoardArchiveMonths  int    // BOARD_ARCHIVE_AFTER_MONTHS
+	BoardArchiveStorage string // BOARD_ARCHIVE_STORAGE: mongo or s3
+
+	// Audit events are forwarded to AuditForwardURL, if set, with
+	// AuditForwardHeader, one "Name: value" pair
+	AuditForwardURL    string // AUDIT_FORWARD_URL
+	AuditForwardFormat string // AUDIT_FORWARD_FORMAT: json or splunk
+	AuditForwardHeader string // AUDIT_FORWARD_HEADER
+
+	// Outgoing mail. Without SMTPHost, development builds log emails
+	// instead, and release builds fail to send them.
+	SMTPHost     string // SMTP_HOST
+	SMTPPort     string // SMTP_PORT
+	SMTPUsername string // SMTP_USERNAME
+	SMTPPassword string // SMTP_PASSWORD, required with SMTP_USERNAME
+	MailFrom     string // MAIL_FROM
+
+	// The S3 bucket for ASSET_STORAGE=s3 and BOARD_ARCHIVE_STORAGE=s3,
+	// required by either; S3Endpoint is for S3-compatible stores and
+	// defaults to AWS in S3Region
+	S3Bucket          string // S3_BUCKET
+	S3Region          string // S3_REGION
+	S3Endpoint        string // S3_ENDPOINT, without a trailing slash
+	S3AccessKeyID     string // S3_ACCESS_KEY_ID
+	S3SecretAccessKey string // S3_SECRET_ACCESS_KEY
+
+	// Sign-in providers, each offered once all of its settings are set.
+	// ApplePrivateKey is the .p8 key's PEM, with escaped newlines
+	// accepted so it fits on one line.
+	AppleClientID      string // APPLE_CLIENT_ID
+	AppleTeamID        string // APPLE_TEAM_ID
+	AppleKeyID         string // APPLE_KEY_ID
+	ApplePrivateKey    string // APPLE_PRIVATE_KEY
+	GitHubClientID     string // GITHUB_CLIENT_ID
+	GitHubClientSecret string // GITHUB_CLIENT_SECRET
+
+	// Web push, on when VAPIDPrivateKey, the base64url P-256 private
+	// scalar, is set. VAPIDSubject is the contact push services see, the
+	// frontend by default.
+	VAPIDPrivateKey string // VAPID_PRIVATE_KEY
+	VAPIDSubject    string // VAPID_SUBJECT, a mailto: or https URL
+
+	// The OpenAI-style embeddings API note clustering uses, if set
+	EmbeddingsURL    string // EMBEDDINGS_URL
+	EmbeddingsModel  string // EMBEDDINGS_MODEL
+	EmbeddingsAPIKey string // EMBEDDINGS_API_KEY
+
+	// ReadOnly starts the instance rejecting writes, pointing clients at
+	// StandbyURL; both can be changed through the admin API
+	ReadOnly   bool   // READ_ONLY_MODE
+	StandbyURL string // STANDBY_URL
+	// ChaosMode turns on fault injection, outside release mode, with the
+	// rules in ChaosRules, a JSON array
+	ChaosMode  bool   // CHAOS_MODE
+	ChaosRules string // CHAOS_RULES
+	// PrivateHooks lets webhooks and push endpoints reach private networks,
+	// outside release mode, for receivers on a developer's machine
+	PrivateHooks bool // PRIVATE_HOOKS
+
+	LocalesDir         string // LOCALES_DIR, translations overriding the bundled ones
+	SpellcheckWordList string // SPELLCHECK_WORDLIST, a full dictionary for spellcheck
+
+	// CountryHeader is the header the edge proxy puts a visitor's country
+	// in, for share link analytics
+	CountryHeader string // GEO_COUNTRY_HEADER
+	TOTPIssuer    string // TOTP_ISSUER, the name shown in authenticator apps
+	// The relying party passkeys are scoped to, and the origins their
+	// ceremonies may run on: by default the frontend's host and origin.
+	// Changing the ID orphans every registered passkey.
+	WebAuthnRPID    string   // WEBAUTHN_RP_ID
+	WebAuthnRPName  string   // WEBAUTHN_RP_NAME
+	WebAuthnOrigins []string // WEBAUTHN_ORIGINS, comma separated
+}
+
+// Intervals are how often the background workers run
+type Intervals struct {
+	Deletion             time.Duration // DELETION_INTERVAL
+	Succession           time.Duration // SUCCESSION_INTERVAL
+	StorageSnapshot      time.Duration // STORAGE_SNAPSHOT_INTERVAL
+	BoardArchive         time.Duration // BOARD_ARCHIVE_INTERVAL
+	BoardFreeze          time.Duration // BOARD_FREEZE_INTERVAL
+	AuditForward         time.Duration // AUDIT_FORWARD_INTERVAL
+	ShapeTypesRefresh    time.Duration // SHAPE_TYPES_REFRESH_INTERVAL
+	CORSRefresh          time.Duration // CORS_REFRESH_INTERVAL
+	BoardTokenRevocation time.Duration // BOARD_TOKEN_REVOCATION_REFRESH
+}
+
+// RateLimit is a token bucket: Requests at once, refilled evenly over
+// Period
+type RateLimit struct {
+	Requests int
+	Period   time.Duration
+}
+
+// ParseRateLimit reads a limit written as "<requests>/<period>", such as
+// "20/1m". "0" or "off" turns limiting off (the zero RateLimit).
+func ParseRateLimit(value string) (RateLimit, error) {
+	if value == "0" || value == "off" {
+		return RateLimit{}, nil
+	}
+	requests, period, ok := strings.Cut(value, "/")
+	limit := RateLimit{}
+	var err error
+	if ok {
+		limit.Requests, err = strconv.Atoi(requests)
+		if err == nil {
+			limit.Period, err = time.ParseDuration(period)
+		}
+	}
+	if !ok || err != nil || limit.Requests < 1 || limit.Period < time.Duration(limit.Requests)*time.Millisecond {
+		return RateLimit{}, fmt.Errorf("invalid rate limit %q (expected e.g. 20/1m)", value)
+	}
+	return limit, nil
+}
+
+// Default is the configuration of a local instance: every optional setting
+// at its default, and no database or secret
+func Default() *Config {
+	authRateLimit, _ := ParseRateLimit(DefaultAuthRateLimit)
+	boardRateLimit, _ := ParseRateLimit(DefaultBoardRateLimit)
+	releaseMode := gin.Mode() == gin.ReleaseMode
+	sameSite := http.SameSiteLaxMode
+	if releaseMode {
+		sameSite = http.SameSiteNoneMode
+	}
+	return &Config{
+		Port:            DefaultPort,
+		DatabaseName:    DefaultDatabaseName,
+		DBTimeout:       DefaultDBTimeout,
+		BoardCacheTTL:   DefaultBoardCacheTTL,
+		BoardRefTTL:     DefaultBoardRefTTL,
+		BoardMaxSize:    DefaultBoardMaxSize,
+		MaxRequestBody:  DefaultMaxRequestBody,
+		AccessTokenTTL:  DefaultAccessTokenTTL,
+		RefreshTokenTTL: DefaultRefreshTokenTTL,
+		CookieSecure:    releaseMode,
+		CookieSameSite:  sameSite,
+		CORSOrigins:     DefaultCORSOrigins,
+		FrontendURL:     DefaultFrontendURL,
+		APIURL:          DefaultAPIURL,
+
+		PasswordResetTTL:    DefaultPasswordResetTTL,
+		EmailChangeTTL:      DefaultEmailChangeTTL,
+		MagicLinkTTL:        DefaultMagicLinkTTL,
+		GuestTokenTTL:       DefaultGuestTokenTTL,
+		DeletionGracePeriod: DefaultDeletionGrace,
+		ActivityRetention:   DefaultActivityRetention,
+		ThumbnailDelay:      DefaultThumbnailDelay,
+		WebhookRetryDelay:   DefaultWebhookRetryDelay,
+		CORSMaxAge:          DefaultCORSMaxAge,
+		ReadTimeout:         DefaultReadTimeout,
+		WriteTimeout:        DefaultWriteTimeout,
+		IdleTimeout:         DefaultIdleTimeout,
+		ShutdownTimeout:     DefaultShutdownTimeout,
+		Intervals:           DefaultIntervals,
+
+		AuthRateLimit:      authRateLimit,
+		BoardRateLimit:     boardRateLimit,
+		WorkerLimits:       map[string]int{},
+		WorkerQueues:       map[string]int64{},
+		WorkerJobTimeout:   DefaultWorkerJobTimeout,
+		MaintenanceTimeout: DefaultMaintenanceTimeout,
+		WorkerSyncBudget:   DefaultWorkerSyncBudget,
+		JobRetention:       DefaultJobRetention,
+
+		AssetMaxSize:             DefaultAssetMaxSize,
+		AvatarMaxSize:            DefaultAvatarMaxSize,
+		AssetStorage:             AssetStorageGridFS,
+		TileCacheBytes:           DefaultTileCacheBytes,
+		ShapeIndexThreshold:      DefaultShapeIndexThreshold,
+		BoardVersionRetention:    DefaultBoardVersionRetention,
+		BoardCompressionMinBytes: DefaultBoardCompressionMinBytes,
+		BoardArchiveStorage:      ArchiveStorageMongo,
+		AuditForwardFormat:       AuditFormatJSON,
+		SMTPPort:                 DefaultSMTPPort,
+		MailFrom:                 DefaultMailFrom,
+		S3Region:                 DefaultS3Region,
+
+		CountryHeader:  DefaultCountryHeader,
+		TOTPIssuer:     DefaultServiceName,
+		WebAuthnRPName: DefaultServiceName,
+	}
+}
+
+// Load reads the configuration from the environment, reporting every
+// missing or invalid setting at once
+func Load() (*Config, error) {
+	cfg := Default()
+	var errs []error
+	fail := func(name, format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("%s: "+format, append([]interface{}{name}, args...)...))
+	}
+
+	if value := os.Getenv("PORT"); value != "" {
+		if port, err := strconv.Atoi(value); err != nil || port < 1 || port > 65535 {
+			fail("PORT", "%q is not a port number", value)
+		}
+		cfg.Port = value
+	}
+
+	cfg.MongoURI = os.Getenv("MONGODB_URI")
+	if cfg.MongoURI == "" {
+		fail("MONGODB_URI", "required")
+	} else if !strings.HasPrefix(cfg.MongoURI, "mongodb://") && !strings.HasPrefix(cfg.MongoURI, "mongodb+srv://") {
+		fail("MONGODB_URI", "must be a mongodb:// or mongodb+srv:// URI")
+	}
+	if value := os.Getenv("MONGODB_DATABASE"); value != "" {
+		if strings.ContainsAny(value, `/\. "$`) {
+			fail("MONGODB_DATABASE", "%q is not a valid database name", value)
+		}
+		cfg.DatabaseName = value
+	}
+
+	cfg.JWTSecret = os.Getenv("JWT_SECRET")
+	if cfg.JWTSecret == "" {
+		fail("JWT_SECRET", "required")
+	} else if len(cfg.JWTSecret) < minJWTSecret {
+		fail("JWT_SECRET", "must be at least %d characters", minJWTSecret)
+	}
+	for _, setting := range []struct {
+		name string
+		ttl  *time.Duration
+	}{
+		{"ACCESS_TOKEN_TTL", &cfg.AccessTokenTTL},
+		{"REFRESH_TOKEN_TTL", &cfg.RefreshTokenTTL},
+		{"DB_TIMEOUT", &cfg.DBTimeout},
+		{"PASSWORD_RESET_TTL", &cfg.PasswordResetTTL},
+		{"EMAIL_CHANGE_TTL", &cfg.EmailChangeTTL},
+		{"MAGIC_LINK_TTL", &cfg.MagicLinkTTL},
+		{"GUEST_TOKEN_TTL", &cfg.GuestTokenTTL},
+		{"ACTIVITY_RETENTION", &cfg.ActivityRetention},
+		{"THUMBNAIL_DELAY", &cfg.ThumbnailDelay},
+		{"WEBHOOK_RETRY_DELAY", &cfg.WebhookRetryDelay},
+		{"CORS_MAX_AGE", &cfg.CORSMaxAge},
+		{"SERVER_READ_TIMEOUT", &cfg.ReadTimeout},
+		{"SERVER_WRITE_TIMEOUT", &cfg.WriteTimeout},
+		{"SERVER_IDLE_TIMEOUT", &cfg.IdleTimeout},
+		{"SHUTDOWN_TIMEOUT", &cfg.ShutdownTimeout},
+		{"WORKER_JOB_TIMEOUT", &cfg.WorkerJobTimeout},
+		{"WORKER_JOB_TIMEOUT_MAINTENANCE", &cfg.MaintenanceTimeout},
+		{"WORKER_SYNC_BUDGET", &cfg.WorkerSyncBudget},
+		{"JOB_RETENTION", &cfg.JobRetention},
+		{"DELETION_INTERVAL", &cfg.Intervals.Deletion},
+		{"SUCCESSION_INTERVAL", &cfg.Intervals.Succession},
+		{"STORAGE_SNAPSHOT_INTERVAL", &cfg.Intervals.StorageSnapshot},
+		{"BOARD_ARCHIVE_INTERVAL", &cfg.Intervals.BoardArchive},
+		{"BOARD_FREEZE_INTERVAL", &cfg.Intervals.BoardFreeze},
+		{"AUDIT_FORWARD_INTERVAL", &cfg.Intervals.AuditForward},
+		{"SHAPE_TYPES_REFRESH_INTERVAL", &cfg.Intervals.ShapeTypesRefresh},
+		{"CORS_REFRESH_INTERVAL", &cfg.Intervals.CORSRefresh},
+		{"BOARD_TOKEN_REVOCATION_REFRESH", &cfg.Intervals.BoardTokenRevocation},
+	} {
+		if value := os.Getenv(setting.name); value != "" {
+			parsed, err := time.ParseDuration(value)
+			if err != nil || parsed <= 0 {
+				fail(setting.name, "%q is not a positive duration such as 5s, 15m or 720h", value)
+			}
+			*setting.ttl = parsed
+		}
+	}
+	if value := os.Getenv("BOARD_MAX_SIZE"); value != "" {
+		size, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || size < 1 || size > maxBoardMaxSize {
+			fail("BOARD_MAX_SIZE", "%q is not a number of bytes from 1 to %d", value, maxBoardMaxSize)
+		}
+		cfg.BoardMaxSize = size
+	}
+	if value := os.Getenv("MAX_REQUEST_BODY"); value != "" {
+		size, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || size < minMaxRequestBody || size > maxMaxRequestBody {
+			fail("MAX_REQUEST_BODY", "%q is not a number of bytes from %d to %d", value, minMaxRequestBody, maxMaxRequestBody)
+		}
+		cfg.MaxRequestBody = size
+	}
+	switch value := strings.ToLower(os.Getenv("DELETION_GRACE_PERIOD")); value {
+	case "":
+	case "0", "off":
+		cfg.DeletionGracePeriod = 0
+	default:
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			fail("DELETION_GRACE_PERIOD", "%q is not a duration such as 72h, or 0 or off to delete at once", value)
+		}
+		cfg.DeletionGracePeriod = parsed
+	}
+
+	// Sizes and counts that must be positive
+	for _, setting := range []struct {
+		name  string
+		value *int64
+	}{
+		{"ASSET_MAX_SIZE", &cfg.AssetMaxSize},
+		{"AVATAR_MAX_SIZE", &cfg.AvatarMaxSize},
+		{"TILE_CACHE_BYTES", &cfg.TileCacheBytes},
+		{"BOARD_VERSION_RETENTION", &cfg.BoardVersionRetention},
+		{"BOARD_COMPRESSION_MIN_BYTES", &cfg.BoardCompressionMinBytes},
+	} {
+		if value := os.Getenv(setting.name); value != "" {
+			parsed, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || parsed < 1 {
+				fail(setting.name, "%q is not a positive number", value)
+			}
+			*setting.value = parsed
+		}
+	}
+	// Limits where 0 means none
+	for _, setting := range []struct {
+		name  string
+		value *int64
+	}{{"BOARD_LIMIT", &cfg.BoardLimit}, {"STORAGE_LIMIT_BYTES", &cfg.StorageLimitBytes}, {"COLLABORATOR_LIMIT", &cfg.CollaboratorLimit}} {
+		if value := os.Getenv(setting.name); value != "" {
+			parsed, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || parsed < 0 {
+				fail(setting.name, "%q is not a number, or 0 for no limit", value)
+			}
+			*setting.value = parsed
+		}
+	}
+	if value := os.Getenv("SHAPE_INDEX_THRESHOLD"); value != "" {
+		threshold, err := strconv.Atoi(value)
+		if err != nil || threshold < 1 {
+			fail("SHAPE_INDEX_THRESHOLD", "%q is not a positive number of shapes", value)
+		}
+		cfg.ShapeIndexThreshold = threshold
+	}
+	if value := os.Getenv("BOARD_ARCHIVE_AFTER_MONTHS"); value != "" {
+		months, err := strconv.Atoi(value)
+		if err != nil || months < 0 {
+			fail("BOARD_ARCHIVE_AFTER_MONTHS", "%q is not a number of months, or 0 to never archive", value)
+		}
+		cfg.BoardArchiveMonths = months
+	}
+	switch value := strings.ToLower(os.Getenv("BOARD_COMPRESSION")); value {
+	case "", "zstd":
+	case "off":
+		cfg.BoardCompressionMinBytes = 0
+	default:
+		fail("BOARD_COMPRESSION", "%q is not zstd or off", value)
+	}
+
+	for _, setting := range []struct {
+		name  string
+		limit *RateLimit
+	}{{"RATE_LIMIT_AUTH", &cfg.AuthRateLimit}, {"RATE_LIMIT_BOARDS", &cfg.BoardRateLimit}} {
+		if value := os.Getenv(setting.name); value != "" {
+			limit, err := ParseRateLimit(value)
+			if err != nil {
+				fail(setting.name, "%q is not a limit such as 20/1m, or off", value)
+			}
+			*setting.limit = limit
+		}
+	}
+	for _, pool := range WorkerPools {
+		name := strings.ToUpper(pool)
+		if value := os.Getenv("WORKER_LIMIT_" + name); value != "" {
+			limit, err := strconv.Atoi(value)
+			if err != nil || limit < 1 {
+				fail("WORKER_LIMIT_"+name, "%q is not a positive number of tasks", value)
+			}
+			cfg.WorkerLimits[pool] = limit
+		}
+		if value := os.Getenv("WORKER_QUEUE_" + name); value != "" {
+			queue, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || queue < 0 {
+				fail("WORKER_QUEUE_"+name, "%q is not a number of tasks, or 0 for no queue", value)
+			}
+			cfg.WorkerQueues[pool] = queue
+		}
+	}
+
+	for _, setting := range []struct {
+		name    string
+		value   *string
+		allowed []string
+	}{
+		{"ASSET_STORAGE", &cfg.AssetStorage, []string{AssetStorageGridFS, AssetStorageS3}},
+		{"BOARD_ARCHIVE_STORAGE", &cfg.BoardArchiveStorage, []string{ArchiveStorageMongo, ArchiveStorageS3}},
+		{"AUDIT_FORWARD_FORMAT", &cfg.AuditForwardFormat, []string{AuditFormatJSON, AuditFormatSplunk}},
+	} {
+		if value := strings.ToLower(os.Getenv(setting.name)); value != "" {
+			if !slices.Contains(setting.allowed, value) {
+				fail(setting.name, "%q is not %s", value, strings.Join(setting.allowed, " or "))
+			}
+			*setting.value = value
+		}
+	}
+	for _, setting := range []struct {
+		name  string
+		value *bool
+	}{{"MAGIC_LINK_SIGNUP", &cfg.MagicLinkSignup}, {"READ_ONLY_MODE", &cfg.ReadOnly}, {"CHAOS_MODE", &cfg.ChaosMode}, {"PRIVATE_HOOKS", &cfg.PrivateHooks}} {
+		if value := os.Getenv(setting.name); value != "" {
+			enabled, err := strconv.ParseBool(value)
+			if err != nil {
+				fail(setting.name, "%q is not true or false", value)
+			}
+			*setting.value = enabled
+		}
+	}
+
+	if value := os.Getenv("COOKIE_SECURE"); value != "" {
+		secure, err := strconv.ParseBool(value)
+		if err != nil {
+			fail("COOKIE_SECURE", "%q is not true or false", value)
+		}
+		cfg.CookieSecure = secure
+	}
+	switch value := strings.ToLower(os.Getenv("COOKIE_SAMESITE")); value {
+	case "":
+	case "lax":
+		cfg.CookieSameSite = http.SameSiteLaxMode
+	case "strict":
+		cfg.CookieSameSite = http.SameSiteStrictMode
+	case "none":
+		cfg.CookieSameSite = http.SameSiteNoneMode
+	default:
+		fail("COOKIE_SAMESITE", "%q is not lax, strict or none", value)
+	}
+	if cfg.CookieSameSite == http.SameSiteNoneMode && !cfg.CookieSecure {
+		fail("COOKIE_SAMESITE", "none needs COOKIE_SECURE, or browsers drop the cookie")
+	}
+
+	if value := os.Getenv("CORS_ALLOWED_ORIGINS"); value != "" {
+		cfg.CORSOrigins = splitList(value)
+	}
+	if value := os.Getenv("TRUSTED_PROXIES"); value != "" {
+		cfg.TrustedProxies = splitList(value)
+		for _, proxy := range cfg.TrustedProxies {
+			if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+				fail("TRUSTED_PROXIES", "%q is not an IP address or CIDR range", proxy)
+			}
+		}
+	}
+	for _, setting := range []struct {
+		name string
+		url  *string
+	}{{"FRONTEND_URL", &cfg.FrontendURL}, {"API_URL", &cfg.APIURL}, {"STANDBY_URL", &cfg.StandbyURL}} {
+		if value := os.Getenv(setting.name); value != "" {
+			parsed, err := url.Parse(value)
+			if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+				fail(setting.name, "%q is not an http(s) URL", value)
+			}
+			*setting.url = strings.TrimSuffix(value, "/")
+		}
+	}
+	cfg.ChaosRules = os.Getenv("CHAOS_RULES")
+	for _, setting := range []struct {
+		name  string
+		value *string
+	}{
+		{"GEO_COUNTRY_HEADER", &cfg.CountryHeader},
+		{"TOTP_ISSUER", &cfg.TOTPIssuer},
+		{"WEBAUTHN_RP_NAME", &cfg.WebAuthnRPName},
+		{"LOCALES_DIR", &cfg.LocalesDir},
+		{"SPELLCHECK_WORDLIST", &cfg.SpellcheckWordList},
+	} {
+		if value := strings.TrimSpace(os.Getenv(setting.name)); value != "" {
+			*setting.value = value
+		}
+	}
+	for _, setting := range []struct {
+		name string
+		path string
+	}{{"LOCALES_DIR", cfg.LocalesDir}, {"SPELLCHECK_WORDLIST", cfg.SpellcheckWordList}} {
+		if setting.path != "" {
+			if _, err := os.Stat(setting.path); err != nil {
+				fail(setting.name, "%v", err)
+			}
+		}
+	}
+	if value := os.Getenv("WEBAUTHN_RP_ID"); value != "" {
+		if strings.ContainsAny(value, ":/ ") {
+			fail("WEBAUTHN_RP_ID", "%q is not a domain such as boardsar.app", value)
+		}
+		cfg.WebAuthnRPID = value
+	}
+	for _, origin := range splitList(os.Getenv("WEBAUTHN_ORIGINS")) {
+		parsed, err := url.Parse(origin)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			fail("WEBAUTHN_ORIGINS", "%q is not an http(s) origin", origin)
+		}
+		cfg.WebAuthnOrigins = append(cfg.WebAuthnOrigins, strings.TrimSuffix(origin, "/"))
+	}
+	if cfg.RedisURL = os.Getenv("REDIS_URL"); cfg.RedisURL != "" {
+		parsed, err := url.Parse(cfg.RedisURL)
+		if err != nil || (parsed.Scheme != "redis" && parsed.Scheme != "rediss") || parsed.Host == "" {
+			fail("REDIS_URL", "must be a redis:// or rediss:// URL")
+		}
+	}
+	for _, setting := range []struct {
+		name string
+		ttl  *time.Duration
+	}{{"BOARD_CACHE_TTL", &cfg.BoardCacheTTL}, {"BOARD_CACHE_REF_TTL", &cfg.BoardRefTTL}} {
+		if value := os.Getenv(setting.name); value != "" {
+			parsed, err := time.ParseDuration(value)
+			if err != nil || parsed < 0 || (parsed > 0 && parsed < time.Millisecond) {
+				fail(setting.name, "%q is not a duration such as 30s or 5m, or 0 to turn it off", value)
+			}
+			*setting.ttl = parsed
+		}
+	}
+
+	loadIntegrations(cfg, fail)
+
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("invalid configuration: %w", errors.Join(errs...))
+	}
+	return cfg, nil
+}
+
+// loadIntegrations reads the settings of the optional integrations, failing
+// those turned on without what they need
+func loadIntegrations(cfg *Config, fail func(name, format string, args ...interface{})) {
+	for _, setting := range []struct {
+		name  string
+		value *string
+	}{
+		{"AUDIT_FORWARD_URL", &cfg.AuditForwardURL},
+		{"AUDIT_FORWARD_HEADER", &cfg.AuditForwardHeader},
+		{"SMTP_HOST", &cfg.SMTPHost},
+		{"SMTP_PORT", &cfg.SMTPPort},
+		{"SMTP_USERNAME", &cfg.SMTPUsername},
+		{"SMTP_PASSWORD", &cfg.SMTPPassword},
+		{"MAIL_FROM", &cfg.MailFrom},
+		{"S3_BUCKET", &cfg.S3Bucket},
+		{"S3_REGION", &cfg.S3Region},
+		{"S3_ENDPOINT", &cfg.S3Endpoint},
+		{"S3_ACCESS_KEY_ID", &cfg.S3AccessKeyID},
+		{"S3_SECRET_ACCESS_KEY", &cfg.S3SecretAccessKey},
+		{"APPLE_CLIENT_ID", &cfg.AppleClientID},
+		{"APPLE_TEAM_ID", &cfg.AppleTeamID},
+		{"APPLE_KEY_ID", &cfg.AppleKeyID},
+		{"APPLE_PRIVATE_KEY", &cfg.ApplePrivateKey},
+		{"GITHUB_CLIENT_ID", &cfg.GitHubClientID},
+		{"GITHUB_CLIENT_SECRET", &cfg.GitHubClientSecret},
+		{"VAPID_PRIVATE_KEY", &cfg.VAPIDPrivateKey},
+		{"VAPID_SUBJECT", &cfg.VAPIDSubject},
+		{"EMBEDDINGS_URL", &cfg.EmbeddingsURL},
+		{"EMBEDDINGS_MODEL", &cfg.EmbeddingsModel},
+		{"EMBEDDINGS_API_KEY", &cfg.EmbeddingsAPIKey},
+	} {
+		if value := strings.TrimSpace(os.Getenv(setting.name)); value != "" {
+			*setting.value = value
+		}
+	}
+
+	for _, setting := range []struct {
+		name  string
+		value *string
+	}{{"AUDIT_FORWARD_URL", &cfg.AuditForwardURL}, {"S3_ENDPOINT", &cfg.S3Endpoint}, {"EMBEDDINGS_URL", &cfg.EmbeddingsURL}} {
+		if *setting.value != "" {
+			parsed, err := url.Parse(*setting.value)
+			if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+				fail(setting.name, "%q is not an http(s) URL", *setting.value)
+			}
+			*setting.value = strings.TrimSuffix(*setting.value, "/")
+		}
+	}
+	if header := cfg.AuditForwardHeader; header != "" {
+		if name, _, ok := strings.Cut(header, ":"); !ok || strings.TrimSpace(name) == "" {
+			fail("AUDIT_FORWARD_HEADER", "must look like \"Name: value\"")
+		}
+	}
+
+	if port, err := strconv.Atoi(cfg.SMTPPort); err != nil || port < 1 || port > 65535 {
+		fail("SMTP_PORT", "%q is not a port number", cfg.SMTPPort)
+	}
+	if cfg.SMTPUsername != "" && cfg.SMTPPassword == "" {
+		fail("SMTP_PASSWORD", "required with SMTP_USERNAME")
+	}
+	if !strings.Contains(cfg.MailFrom, "@") {
+		fail("MAIL_FROM", "%q is not an email address", cfg.MailFrom)
+	}
+
+	if cfg.AssetStorage == AssetStorageS3 || cfg.BoardArchiveStorage == ArchiveStorageS3 {
+		for _, setting := range []struct {
+			name  string
+			value string
+		}{{"S3_BUCKET", cfg.S3Bucket}, {"S3_ACCESS_KEY_ID", cfg.S3AccessKeyID}, {"S3_SECRET_ACCESS_KEY", cfg.S3SecretAccessKey}} {
+			if setting.value == "" {
+				fail(setting.name, "required with s3 storage")
+			}
+		}
+	}
+
+	// A provider with some of its settings is one being set up
+	apple := []string{cfg.AppleClientID, cfg.AppleTeamID, cfg.AppleKeyID, cfg.ApplePrivateKey}
+	if slices.ContainsFunc(apple, func(value string) bool { return value != "" }) {
+		if slices.Contains(apple, "") {
+			fail("APPLE_CLIENT_ID", "Sign in with Apple needs APPLE_CLIENT_ID, APPLE_TEAM_ID, APPLE_KEY_ID and APPLE_PRIVATE_KEY")
+		}
+		if cfg.ApplePrivateKey != "" {
+			cfg.ApplePrivateKey = strings.ReplaceAll(cfg.ApplePrivateKey, `\n`, "\n")
+			if _, err := jwt.ParseECPrivateKeyFromPEM([]byte(cfg.ApplePrivateKey)); err != nil {
+				fail("APPLE_PRIVATE_KEY", "is not a .p8 key: %v", err)
+			}
+		}
+	}
+	if (cfg.GitHubClientID == "") != (cfg.GitHubClientSecret == "") {
+		fail("GITHUB_CLIENT_ID", "Sign in with GitHub needs GITHUB_CLIENT_ID and GITHUB_CLIENT_SECRET")
+	}
+
+	if cfg.VAPIDPrivateKey != "" {
+		scalar, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(cfg.VAPIDPrivateKey, "="))
+		if err == nil {
+			_, err = ecdh.P256().NewPrivateKey(scalar)
+		}
+		if err != nil {
+			fail("VAPID_PRIVATE_KEY", "is not a base64url P-256 private key")
+		}
+	}
+	if subject := cfg.VAPIDSubject; subject != "" && !strings.HasPrefix(subject, "mailto:") && !strings.HasPrefix(subject, "https://") {
+		fail("VAPID_SUBJECT", "%q is not a mailto: or https URL", subject)
+	}
+}
+
+// splitList reads a comma separated list, without blanks
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,170 @@
+package controllers
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"github.com/sarwanazhar/boardsar/backend/repository"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// accountTimeout bounds deleting or exporting an account, which touches
+// every board the user owns
+const accountTimeout = 5 * time.Minute
+
+// DeleteAccount deletes the signed-in user for good, with the boards they
+// own and everything kept for them, and takes them off the boards shared
+// with them. They confirm with their email, and their password if they have
+// one. Accounts under legal hold, or owning a board that is, can't be
+// deleted. With a grace period (see libs.DeletionGracePeriod), the deletion
+// is scheduled instead, and they are emailed a link to keep the account.
+func DeleteAccount(c *gin.Context) {
+	type Body struct {
+		Email    string `json:"email" binding:"required"`
+		Password string `json:"password"`
+	}
+
+	var body Body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	user, err := libs.FindUserByID(libs.RequestContext(c), userID.Hex())
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+	if !strings.EqualFold(strings.TrimSpace(body.Email), user.Email) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Confirm with your account's email"})
+		return
+	}
+	if user.Password != "" && !libs.CheckPasswordHash(body.Password, user.Password) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid password"})
+		return
+	}
+
+	ctx, cancel := libs.DBContextWithin(c, accountTimeout)
+	defer cancel()
+
+	boards := libs.BoardRepository(c)
+	onHold, err := libs.IsAccountUnderLegalHold(ctx, boards, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check legal hold"})
+		return
+	}
+	if onHold {
+		c.JSON(http.StatusLocked, gin.H{"error": "Your account or one of your boards is under legal hold and can't be deleted"})
+		return
+	}
+
+	// With a grace period, they are emailed to keep it or delete it now
+	if libs.DeletionGracePeriod() > 0 {
+		deletion, err := scheduleAccountDeletion(ctx, c, user)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to schedule account deletion"})
+			return
+		}
+		c.JSON(http.StatusAccepted, gin.H{
+			"message":  "Account scheduled for deletion",
+			"deletion": deletion,
+		})
+		return
+	}
+
+	deleted, err := deleteAccount(ctx, boards, libs.RequestLogger(c), userID)
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to delete account", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account. Please try again later."})
+		return
+	}
+
+	recordAudit(c, models.AuditAccountDeleted, models.AuditTargetUser, userID.Hex(), map[string]interface{}{
+		"email":         user.Email,
+		"boardsDeleted": len(deleted.Boards),
+		"boardsLeft":    len(deleted.Shared),
+	})
+	clearRefreshCookie(c)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "Account deleted",
+		"boardsDeleted": len(deleted.Boards),
+	})
+}
+
+// deleteAccount deletes the user's account and their boards in boards, then
+// what is stored alongside the boards and their avatar
+func deleteAccount(ctx context.Context, boards repository.BoardRepository, logger *slog.Logger, userID primitive.ObjectID) (*libs.DeletedAccount, error) {
+	deleted, err := libs.DeleteAccount(ctx, boards, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// What lives outside the documents goes once they are gone
+	for i := range deleted.Boards {
+		board := &deleted.Boards[i]
+		boardCtx, boardCancel := context.WithTimeout(context.WithoutCancel(ctx), libs.Settings().DBTimeout)
+		cleanUpBoard(boardCtx, logger, board, userID)
+		if board.Archived != nil {
+			if err := libs.DeleteBoardArchive(boardCtx, board.Archived); err != nil {
+				logger.Warn("Failed to delete archive of board", "board_id", board.ID.Hex(), "error", err)
+			}
+		}
+		boardCancel()
+	}
+	for _, boardID := range deleted.Shared {
+		boardChanged(ctx, boardID)
+	}
+	if err := libs.DeleteUserAvatars(ctx, userID, primitive.NilObjectID); err != nil {
+		logger.Warn("Failed to delete avatars", "error", err)
+	}
+	return deleted, nil
+}
+
+// ExportAccount downloads everything kept for the signed-in user as a zip
+// archive (see libs.WriteAccountExport), for moving it elsewhere. Archived
+// boards are brought back from cold storage first.
+func ExportAccount(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	user, err := libs.FindUserByID(libs.RequestContext(c), userID.Hex())
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+
+	ctx, cancel := libs.DBContextWithin(c, accountTimeout)
+	defer cancel()
+
+	if err := libs.RehydrateBoards(ctx, bson.M{"ownerId": userID}); err != nil {
+		libs.RequestLogger(c).Error("Failed to rehydrate boards for export", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load archived boards. Please try again later."})
+		return
+	}
+
+	recordAudit(c, models.AuditAccountExported, models.AuditTargetUser, userID.Hex(), nil)
+
+	filename := "boardsar-export-" + time.Now().UTC().Format("2006-01-02") + ".zip"
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Header("Content-Type", "application/zip")
+	c.Status(http.StatusOK)
+	if err := libs.WriteAccountExport(ctx, c.Writer, user); err != nil {
+		// Too late for an error response: the archive is cut short
+		libs.RequestLogger(c).Error("Failed to export account", "error", err)
+	}
+}
@@ -0,0 +1,117 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Activity feed page sizes
+const (
+	defaultActivityPageSize = 50
+	maxActivityPageSize     = 200
+)
+
+// GetBoardActivity returns the board's activity feed, most recent first,
+// to anyone who can see the board. Pass the returned nextCursor back as
+// ?cursor for the next page.
+func GetBoardActivity(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	board, ok := findVisibleBoard(ctx, c, libs.BoardRepository(c).WithoutContents(), userID)
+	if !ok {
+		return
+	}
+	listActivity(ctx, c, bson.M{"boardId": board.ID})
+}
+
+// GetMyActivity returns what the user did across boards, most recent first,
+// including on boards since deleted
+func GetMyActivity(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	listActivity(ctx, c, bson.M{"actorId": userID})
+}
+
+// listActivity answers with a page of the activity matching the filter
+func listActivity(ctx context.Context, c *gin.Context, filter bson.M) {
+	limit := defaultActivityPageSize
+	if value := c.Query("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxActivityPageSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and " + strconv.Itoa(maxActivityPageSize)})
+			return
+		}
+	}
+
+	var afterTime time.Time
+	var afterID primitive.ObjectID
+	if value := c.Query("cursor"); value != "" {
+		var err error
+		afterTime, afterID, err = decodeBoardCursor(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+			return
+		}
+	}
+
+	// One extra entry tells whether there is another page
+	activities, err := libs.ListActivity(ctx, filter, afterTime, afterID, int64(limit+1))
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to list activity", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+		return
+	}
+
+	hasMore := len(activities) > limit
+	nextCursor := ""
+	if hasMore {
+		activities = activities[:limit]
+		last := activities[len(activities)-1]
+		nextCursor = encodeBoardCursor(last.UpdatedAt, last.ID)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"activity":   activities,
+		"nextCursor": nextCursor,
+		"hasMore":    hasMore,
+	})
+}
+
+// operationChanges counts the shape changes of a patch
+func operationChanges(operations []models.BoardOperation) models.ActivityChanges {
+	changes := models.ActivityChanges{}
+	for _, op := range operations {
+		switch op.Op {
+		case models.OpAddShape:
+			changes.Added++
+		case models.OpUpdateShape:
+			changes.Changed++
+		case models.OpDeleteShape:
+			changes.Removed++
+		}
+	}
+	return changes
+}
@@ -0,0 +1,115 @@
+package controllers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/models"
+)
+
+// GetReadOnlyMode reports whether this instance is rejecting writes (admin only)
+func GetReadOnlyMode(c *gin.Context) {
+	enabled, standbyURL := libs.GetReadOnlyMode()
+
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":    enabled,
+		"standbyUrl": standbyURL,
+	})
+}
+
+// SetReadOnlyMode switches this instance in or out of read-only mode (admin only)
+func SetReadOnlyMode(c *gin.Context) {
+	type Body struct {
+		Enabled    *bool  `json:"enabled" binding:"required"`
+		StandbyURL string `json:"standbyUrl"`
+	}
+
+	var body Body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+
+	libs.SetReadOnlyMode(*body.Enabled, body.StandbyURL)
+	libs.RequestLogger(c).Info("Read-only mode changed", "enabled", *body.Enabled)
+	recordAudit(c, models.AuditReadOnlyChanged, models.AuditTargetInstance, "", map[string]interface{}{
+		"enabled":    *body.Enabled,
+		"standbyUrl": body.StandbyURL,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":    *body.Enabled,
+		"standbyUrl": body.StandbyURL,
+	})
+}
+
+// GetBoardArchiveStats reports how many boards are in cold storage and how
+// much space archiving them saves (admin only)
+func GetBoardArchiveStats(c *gin.Context) {
+	ctx, cancel := libs.DBContextWithin(c, 10*time.Second)
+	defer cancel()
+
+	stats, err := libs.GetBoardArchiveStats(ctx)
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to total archived boards", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+// GetBoardCacheStats reports how often this instance answered GetBoard
+// from the board cache (admin only)
+func GetBoardCacheStats(c *gin.Context) {
+	c.JSON(http.StatusOK, libs.GetBoardCacheStats())
+}
+
+// GetRequestLogging lists the routes with verbose request logging (admin only)
+func GetRequestLogging(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"routes": libs.GetVerboseLogRoutes(),
+	})
+}
+
+// SetRequestLogging turns verbose request logging on or off for one route,
+// e.g. "PUT /api/boards/:boardId", or "*" for every route (admin only)
+func SetRequestLogging(c *gin.Context) {
+	type Body struct {
+		Route   string `json:"route" binding:"required"`
+		Enabled *bool  `json:"enabled" binding:"required"`
+	}
+
+	var body Body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+
+	libs.SetVerboseLogRoute(body.Route, *body.Enabled)
+	libs.RequestLogger(c).Info("Verbose logging changed", "verbose_route", body.Route, "enabled", *body.Enabled)
+	recordAudit(c, models.AuditRequestLoggingChanged, models.AuditTargetInstance, "", map[string]interface{}{
+		"route":   body.Route,
+		"enabled": *body.Enabled,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"routes": libs.GetVerboseLogRoutes(),
+	})
+}
+
+// GetWorkerPools reports the load on this instance's worker pools (admin
+// only)
+func GetWorkerPools(c *gin.Context) {
+	pools := make([]models.WorkerPoolStats, 0, len(libs.WorkerPools()))
+	for _, pool := range libs.WorkerPools() {
+		pools = append(pools, pool.Stats())
+	}
+	c.JSON(http.StatusOK, gin.H{"pools": pools})
+}
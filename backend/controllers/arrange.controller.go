@@ -0,0 +1,114 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"github.com/sarwanazhar/boardsar/backend/plugins"
+	"github.com/sarwanazhar/boardsar/backend/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ArrangeShapes aligns, distributes or tidies many shapes at once. The
+// moves are checked like PATCH operations and written as one new version,
+// so they are one entry in the board's history and one reload for realtime
+// sessions; the answer has the batch undoing them.
+func ArrangeShapes(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req models.ArrangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+
+	expectedVersion, checkVersion, err := expectedBoardVersion(c, req.ExpectedVersion)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	// Arrange the shapes where realtime sessions left them
+	board, ok := findEditableBoard(ctx, c, userID)
+	if !ok {
+		return
+	}
+
+	if checkVersion && expectedVersion != board.Version {
+		boardConflict(c, board, userID)
+		return
+	}
+
+	// Shapes the user can't see can't be arranged either
+	operations, undo, err := libs.ArrangeShapes(libs.VisibleBoardData(board.BoardData, userID), req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(operations) == 0 {
+		c.Header("ETag", boardETag(board.Version))
+		c.JSON(http.StatusOK, gin.H{
+			"message":    "Shapes are already arranged",
+			"applied":    0,
+			"operations": []models.BoardOperation{},
+			"undo":       []models.BoardOperation{},
+			"version":    board.Version,
+			"updatedAt":  board.UpdatedAt,
+		})
+		return
+	}
+
+	for i := range operations {
+		op := &operations[i]
+		if violation := libs.PrepareOperation(board, op, userID); violation != "" {
+			c.JSON(http.StatusForbidden, gin.H{"error": violation})
+			return
+		}
+		if err := libs.ApplyBoardOperation(board.BoardData, *op); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	// One version for every move, written only over the version they were
+	// worked out from
+	now := time.Now().Truncate(time.Millisecond)
+	err = libs.BoardRepository(c).SaveContents(ctx, board.ID, board.Version, 1, board.BoardData, map[string]interface{}{"updatedAt": now})
+	if errors.Is(err, repository.ErrVersionConflict) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Board changed while arranging shapes; reload it and retry"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update board: " + err.Error()})
+		return
+	}
+	board.Version++
+	board.UpdatedAt = now
+	boardChanged(ctx, board.ID)
+	plugins.Emit(libs.RequestContext(c), board, plugins.EventBoardUpdated, userID)
+	libs.RecordBoardVersion(libs.RequestContext(c), board, userID)
+	libs.RecordBoardUpdate(libs.RequestContext(c), board, userID, operationChanges(operations))
+
+	c.Header("ETag", boardETag(board.Version))
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Shapes arranged successfully",
+		"applied":    len(operations),
+		"operations": operations,
+		"undo":       undo,
+		"version":    board.Version,
+		"updatedAt":  now,
+	})
+}
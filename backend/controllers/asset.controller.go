@@ -0,0 +1,235 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"github.com/sarwanazhar/boardsar/backend/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// assetCacheControl lets browsers keep an asset: its bytes never change
+// under the same ID. Boards are private, so shared caches may not keep it.
+const assetCacheControl = "private, max-age=31536000, immutable"
+
+// UploadAsset stores an image for a board from the "file" field of a
+// multipart form, with the board in the "boardId" field. Owners and
+// editors only; the image counts against the board owner's storage quota.
+func UploadAsset(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	maxSize := libs.MaxAssetSize()
+	tooLarge := fmt.Sprintf("Image is too large (%d bytes max)", maxSize)
+	// Leave room for the rest of the form
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSize+1<<20)
+	header, err := c.FormFile("file")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": tooLarge})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Upload the image as the \"file\" field of a multipart form"})
+		return
+	}
+	if header.Size > maxSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": tooLarge})
+		return
+	}
+	boardIDStr := c.PostForm("boardId")
+	if boardIDStr == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "boardId is required"})
+		return
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid upload: " + err.Error()})
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid upload: " + err.Error()})
+		return
+	}
+
+	ctx, cancel := libs.DBContextWithin(c, 30*time.Second)
+	defer cancel()
+
+	board, ok := findAssetBoard(ctx, c, boardIDStr, userID)
+	if !ok {
+		return
+	}
+	if !requireBoardEditor(c, board, userID) {
+		return
+	}
+
+	usage, err := libs.GetQuotaUsage(ctx, board.OwnerID, primitive.NilObjectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check quota: " + err.Error()})
+		return
+	}
+	warnings, quotaErr := libs.ApplyQuota(c, usage, 0, int64(len(data)))
+	if quotaErr != "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": quotaErr})
+		return
+	}
+
+	asset, err := libs.CreateAsset(ctx, board, userID, header.Filename, data)
+	switch {
+	case err == libs.ErrUnsupportedAsset:
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": err.Error()})
+		return
+	case err == libs.ErrInvalidAsset || err == libs.ErrAssetDimensions:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		libs.RequestLogger(c).Error("Failed to store asset for board", "board_id", board.ID.Hex(), "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+		return
+	}
+
+	response := gin.H{"message": "Asset uploaded", "asset": asset}
+	if len(warnings) > 0 {
+		response["warnings"] = warnings
+	}
+	c.JSON(http.StatusCreated, response)
+}
+
+// GetAsset serves an asset's image to anyone who can see its board
+func GetAsset(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ctx, cancel := libs.DBContextWithin(c, 30*time.Second)
+	defer cancel()
+
+	asset, _, ok := findVisibleAsset(ctx, c, userID)
+	if !ok {
+		return
+	}
+
+	etag := `"` + asset.SHA256 + `"`
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", assetCacheControl)
+	c.Header("Last-Modified", asset.CreatedAt.UTC().Format(http.TimeFormat))
+	if etagMatches(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	data, err := libs.OpenAsset(ctx, asset)
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to open asset", "asset_id", asset.ID.Hex(), "error", err)
+		if err == libs.ErrAssetDataNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Asset not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+		return
+	}
+	defer data.Close()
+
+	c.DataFromReader(http.StatusOK, asset.Size, asset.ContentType, data, map[string]string{
+		"Content-Disposition":     "inline; filename*=UTF-8''" + url.PathEscape(asset.Filename),
+		"X-Content-Type-Options":  "nosniff",
+		"Content-Security-Policy": "default-src 'none'",
+	})
+}
+
+// DeleteAsset removes an asset. The board owner can remove any of the
+// board's assets; editors, the ones they uploaded.
+func DeleteAsset(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ctx, cancel := libs.DBContextWithin(c, 30*time.Second)
+	defer cancel()
+
+	asset, board, ok := findVisibleAsset(ctx, c, userID)
+	if !ok {
+		return
+	}
+	if !requireBoardEditor(c, board, userID) {
+		return
+	}
+	if board.OwnerID != userID && asset.UploadedBy != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the board owner can remove assets other people uploaded"})
+		return
+	}
+
+	if err := libs.DeleteAsset(ctx, asset); err != nil {
+		libs.RequestLogger(c).Error("Failed to delete asset", "asset_id", asset.ID.Hex(), "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Asset deleted"})
+}
+
+// findVisibleAsset loads the asset named by the :assetId route parameter
+// and its board, answering 404 unless the user can see the board
+func findVisibleAsset(ctx context.Context, c *gin.Context, userID primitive.ObjectID) (*models.Asset, *models.Board, bool) {
+	assetID, err := primitive.ObjectIDFromHex(c.Param("assetId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid asset ID"})
+		return nil, nil, false
+	}
+
+	asset, err := libs.FindAsset(ctx, assetID)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Asset not found"})
+		return nil, nil, false
+	}
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to load asset", "asset_id", assetID.Hex(), "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+		return nil, nil, false
+	}
+
+	board, err := libs.BoardRepository(c).FindForUser(ctx, asset.BoardID.Hex(), userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Asset not found"})
+			return nil, nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve board: " + err.Error()})
+		return nil, nil, false
+	}
+	return asset, board, true
+}
+
+// findAssetBoard loads the board an upload is for if the user can see it,
+// answering 404 otherwise
+func findAssetBoard(ctx context.Context, c *gin.Context, boardIDStr string, userID primitive.ObjectID) (*models.Board, bool) {
+	board, err := libs.BoardRepository(c).FindForUser(ctx, boardIDStr, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Board not found or access denied"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve board: " + err.Error()})
+		return nil, false
+	}
+	return board, true
+}
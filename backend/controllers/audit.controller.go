@@ -0,0 +1,98 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Audit export page sizes
+const (
+	defaultAuditPageSize = 500
+	maxAuditPageSize     = 1000
+)
+
+// ExportAuditEvents returns audit events oldest first for SIEM ingestion.
+// Pass the returned nextCursor back as ?cursor to fetch only newer events;
+// ?since (RFC 3339) picks the starting point of the first fetch (admin only).
+func ExportAuditEvents(c *gin.Context) {
+	limit := defaultAuditPageSize
+	if value := c.Query("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxAuditPageSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and " + strconv.Itoa(maxAuditPageSize)})
+			return
+		}
+	}
+
+	var cursor primitive.ObjectID
+	if value := c.Query("cursor"); value != "" {
+		var err error
+		cursor, err = primitive.ObjectIDFromHex(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+			return
+		}
+	}
+
+	var since time.Time
+	if value := c.Query("since"); value != "" {
+		var err error
+		since, err = time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "since must be an RFC 3339 timestamp"})
+			return
+		}
+	}
+
+	ctx, cancel := libs.DBContextWithin(c, 10*time.Second)
+	defer cancel()
+
+	events, err := libs.ListAuditEvents(ctx, cursor, since, int64(limit))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve audit events: " + err.Error()})
+		return
+	}
+
+	// Without new events the client keeps polling from the same place
+	nextCursor := c.Query("cursor")
+	if len(events) > 0 {
+		nextCursor = events[len(events)-1].ID.Hex()
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"schemaVersion": models.AuditSchemaVersion,
+		"events":        events,
+		"nextCursor":    nextCursor,
+		"hasMore":       len(events) == limit,
+	})
+}
+
+// recordAudit stores an audit event for the current request, taking the
+// actor from the JWT user and the client address
+func recordAudit(c *gin.Context, action, targetType, targetID string, details map[string]interface{}) {
+	event := models.AuditEvent{
+		Action:  action,
+		Actor:   auditActor(c, c.GetString("userId")),
+		Details: details,
+	}
+	if targetType != "" {
+		event.Target = &models.AuditTarget{Type: targetType, ID: targetID}
+	}
+	libs.RecordAudit(libs.RequestContext(c), event)
+}
+
+// auditActor describes who is making the request
+func auditActor(c *gin.Context, userID string) models.AuditActor {
+	return models.AuditActor{
+		ID:        userID,
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}
+}
@@ -2,20 +2,25 @@ package controllers
 
 import (
 	"context"
+	"crypto/subtle"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
-	"time"
+	"net/url"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/sarwanazhar/boardsar/backend/libs"
 	"github.com/sarwanazhar/boardsar/backend/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 func RegisterUser(c *gin.Context) {
 	type Body struct {
 		Email    string `json:"email" binding:"required,email"`
 		Password string `json:"password" binding:"required,min=6"`
+		Locale   string `json:"locale"`
 	}
 
 	var body Body
@@ -24,10 +29,19 @@ func RegisterUser(c *gin.Context) {
 		return
 	}
 
-	EmailExists, err := libs.SearchForExistingEmail(body.Email)
+	locale := libs.DefaultLocale
+	if body.Locale != "" {
+		if !libs.IsSupportedLocale(body.Locale) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported locale"})
+			return
+		}
+		locale = libs.NormalizeLocale(body.Locale)
+	}
+
+	EmailExists, err := libs.SearchForExistingEmail(libs.RequestContext(c), body.Email)
 
 	if err != nil {
-		log.Printf("Failed to check email existence for %s: %v", body.Email, err)
+		libs.RequestLogger(c).Error("Failed to check email existence", "email", body.Email, "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
 		return
 	}
@@ -40,26 +54,28 @@ func RegisterUser(c *gin.Context) {
 	hashedPassword, err := libs.HashPassword(body.Password)
 
 	if err != nil {
-		log.Fatal(err)
+		libs.RequestLogger(c).Error("Failed to hash password", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := libs.DBContext(c)
 	defer cancel()
 
 	user := &models.User{
 		Email:    body.Email,
 		Password: hashedPassword,
+		Locale:   locale,
 	}
 
 	newId, err := libs.CreateUser(ctx, user)
 	if err != nil {
-		log.Printf("Failed to create user %s: %v", body.Email, err)
+		libs.RequestLogger(c).Error("Failed to create user", "email", body.Email, "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
 		return
 	}
 
-	fmt.Print("new user created id:")
-	fmt.Println(newId)
+	libs.RequestLogger(c).Info("User created", "new_user_id", newId)
 
 	c.JSON(http.StatusCreated, gin.H{"message": "User created successfully"})
 }
@@ -76,49 +92,861 @@ func LoginUser(c *gin.Context) {
 		return
 	}
 
-	foundUser, err := libs.FindUserByEmail(body.Email)
+	foundUser, err := libs.FindUserByEmail(libs.RequestContext(c), body.Email)
 	if err != nil {
+		libs.RecordAudit(libs.RequestContext(c), models.AuditEvent{
+			Action:  models.AuditLoginFailed,
+			Outcome: models.AuditOutcomeFailure,
+			Actor:   auditActor(c, ""),
+			Details: map[string]interface{}{"email": body.Email, "reason": "unknown_email"},
+		})
 		c.JSON(http.StatusUnauthorized, gin.H{
 			"error": "Invalid email or password",
 		})
 		return
 	}
 
+	// Accounts that went passwordless sign in with a passkey. Everyone
+	// else keeps signing in with their password.
+	if foundUser.Passwordless {
+		libs.RecordAudit(libs.RequestContext(c), models.AuditEvent{
+			Action:  models.AuditLoginFailed,
+			Outcome: models.AuditOutcomeFailure,
+			Actor:   auditActor(c, foundUser.ID.Hex()),
+			Details: map[string]interface{}{"email": foundUser.Email, "reason": "passwordless"},
+		})
+		c.JSON(http.StatusForbidden, gin.H{"error": "This account signs in with a passkey"})
+		return
+	}
+
 	isPasswordCorrect := libs.CheckPasswordHash(body.Password, foundUser.Password)
 
 	if !isPasswordCorrect {
+		libs.RecordAudit(libs.RequestContext(c), models.AuditEvent{
+			Action:  models.AuditLoginFailed,
+			Outcome: models.AuditOutcomeFailure,
+			Actor:   auditActor(c, foundUser.ID.Hex()),
+			Details: map[string]interface{}{"email": foundUser.Email, "reason": "wrong_password"},
+		})
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
 		return
 	}
 
-	token, err := libs.GenerateJWT(foundUser.ID.Hex())
+	signIn(c, foundUser, nil)
+}
+
+// signIn starts a session for a user who got their first factor right,
+// unless they turned on two-factor: then the sign-in is held, and answered
+// with a twoFactorToken to send with a code to POST /auth/2fa/verify
+func signIn(c *gin.Context, user *models.User, details map[string]interface{}) {
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	enabled, err := libs.TwoFactorEnabled(ctx, user.ID)
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to load two-factor", "user_id", user.ID.Hex(), "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+		return
+	}
+	if !enabled {
+		startSession(c, user, details)
+		return
+	}
+
+	token, err := libs.StartTwoFactorChallenge(ctx, user.ID, details)
 	if err != nil {
+		libs.RequestLogger(c).Error("Failed to start two-factor challenge", "user_id", user.ID.Hex(), "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"twoFactorRequired": true,
+		"twoFactorToken":    token,
+		"expiresIn":         int(libs.TwoFactorChallengeTTL().Seconds()),
+	})
+}
+
+// startSession signs the user in: it issues an access token and a refresh
+// token (also set as a cookie) and records the login
+func startSession(c *gin.Context, user *models.User, details map[string]interface{}) {
+	session, ok := issueSession(c, user)
+	if !ok {
+		return
+	}
+
+	libs.RecordAudit(libs.RequestContext(c), models.AuditEvent{
+		Action:  models.AuditLoginSucceeded,
+		Actor:   auditActor(c, user.ID.Hex()),
+		Details: details,
+	})
+
+	c.JSON(http.StatusOK, session)
+}
+
+// issueSession issues an access token and a refresh token (also set as a
+// cookie) for the user, and returns them as the response to a sign-in. It
+// answers the request itself on failure.
+func issueSession(c *gin.Context, user *models.User) (gin.H, bool) {
+	if user.DeactivatedAt != nil {
+		libs.RecordAudit(libs.RequestContext(c), models.AuditEvent{
+			Action:  models.AuditLoginFailed,
+			Outcome: models.AuditOutcomeFailure,
+			Actor:   auditActor(c, user.ID.Hex()),
+			Details: map[string]interface{}{"email": user.Email, "reason": "deactivated"},
+		})
+		c.JSON(http.StatusForbidden, gin.H{"error": libs.ErrAccountDeactivated.Error()})
+		return nil, false
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	session, refreshToken, err := libs.StartSession(ctx, user.ID, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to start session", "user_id", user.ID.Hex(), "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Could not generate token",
 		})
-		return
+		return nil, false
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"token": token,
+	token, err := libs.GenerateJWT(user.ID.Hex(), session.ID.Hex(), user.TokenVersion)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Could not generate token",
+		})
+		return nil, false
+	}
+	setRefreshCookie(c, refreshToken)
+	touchUserActivity(c, user.ID)
+
+	return gin.H{
+		"token":        token,
+		"expiresIn":    int(libs.AccessTokenTTL().Seconds()),
+		"refreshToken": refreshToken,
 		"user": gin.H{
-			"id":    foundUser.ID.Hex(),
-			"email": foundUser.Email,
+			"id":     user.ID.Hex(),
+			"email":  user.Email,
+			"locale": userLocale(user),
 		},
+	}, true
+}
+
+// RefreshToken exchanges a refresh token (from the cookie or the body) for a
+// new access token. The refresh token is rotated on every use.
+func RefreshToken(c *gin.Context) {
+	refreshToken := requestRefreshToken(c)
+	if refreshToken == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token required"})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	// OAuth apps' refresh tokens only work at the token endpoint
+	stored, next, err := libs.RotateRefreshToken(ctx, refreshToken, primitive.NilObjectID)
+	if err == libs.ErrInvalidRefreshToken {
+		clearRefreshCookie(c)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to rotate refresh token", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not refresh token"})
+		return
+	}
+
+	user, err := libs.FindUserByID(ctx, stored.UserID.Hex())
+	if err != nil {
+		clearRefreshCookie(c)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+	if user.DeactivatedAt != nil {
+		clearRefreshCookie(c)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": libs.ErrAccountDeactivated.Error()})
+		return
+	}
+	session, err := libs.TouchSession(ctx, user.ID, stored.FamilyID, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to update session", "user_id", user.ID.Hex(), "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not refresh token"})
+		return
+	}
+	if session.RevokedAt != nil {
+		clearRefreshCookie(c)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": libs.ErrSessionRevoked.Error()})
+		return
+	}
+	token, err := libs.GenerateJWT(user.ID.Hex(), session.ID.Hex(), user.TokenVersion)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
+		return
+	}
+	setRefreshCookie(c, next)
+	touchUserActivity(c, user.ID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":        token,
+		"expiresIn":    int(libs.AccessTokenTTL().Seconds()),
+		"refreshToken": next,
 	})
 }
 
+// touchUserActivity records that the user signed in or refreshed their
+// token. The request goes on if it can't be.
+func touchUserActivity(c *gin.Context, userID primitive.ObjectID) {
+	if err := libs.TouchUserActivity(libs.RequestContext(c), userID); err != nil {
+		libs.RequestLogger(c).Warn("Failed to record user activity", "user_id", userID.Hex(), "error", err)
+	}
+}
+
+// LogoutUser revokes the refresh token and clears its cookie, ending its
+// session: the access tokens issued for it stop working too.
+func LogoutUser(c *gin.Context) {
+	if refreshToken := requestRefreshToken(c); refreshToken != "" {
+		ctx, cancel := libs.DBContext(c)
+		defer cancel()
+
+		userID, err := libs.RevokeRefreshToken(ctx, refreshToken)
+		if err != nil {
+			libs.RequestLogger(c).Error("Failed to revoke refresh token", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not log out"})
+			return
+		}
+		if !userID.IsZero() {
+			libs.RecordAudit(libs.RequestContext(c), models.AuditEvent{
+				Action: models.AuditLogout,
+				Actor:  auditActor(c, userID.Hex()),
+			})
+		}
+	}
+
+	clearRefreshCookie(c)
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
+}
+
+// ForgotPassword emails a password reset link. The response is the same
+// whether or not the email is registered, so it can't be used to probe for
+// accounts.
+func ForgotPassword(c *gin.Context) {
+	type Body struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+
+	var body Body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := gin.H{"message": "If that email is registered, a reset link has been sent"}
+
+	user, err := libs.FindUserByEmail(libs.RequestContext(c), body.Email)
+	if err != nil {
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	token, err := libs.CreatePasswordReset(ctx, user.ID)
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to create password reset", "user_id", user.ID.Hex(), "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+		return
+	}
+
+	locale := userLocale(user)
+	link := libs.FrontendURL() + "/reset-password?token=" + url.QueryEscape(token)
+	message := libs.Translate(locale, "password_reset.body", map[string]string{
+		"link":    link,
+		"minutes": strconv.Itoa(int(libs.PasswordResetTTL().Minutes())),
+	})
+
+	err = libs.SendEmail(user.Email,
+		libs.Translate(locale, "password_reset.subject", nil),
+		libs.LocalizedEmail(locale, user.Email, message),
+	)
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to send password reset email", "user_id", user.ID.Hex(), "error", err)
+	}
+
+	recordAudit(c, models.AuditPasswordResetRequested, models.AuditTargetUser, user.ID.Hex(), nil)
+
+	c.JSON(http.StatusOK, response)
+}
+
+// ResetPassword sets a new password using a reset token, and signs the user
+// out everywhere
+func ResetPassword(c *gin.Context) {
+	type Body struct {
+		Token    string `json:"token" binding:"required"`
+		Password string `json:"password" binding:"required,min=6"`
+	}
+
+	var body Body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	userID, err := libs.ConsumePasswordReset(ctx, body.Token)
+	if err == libs.ErrInvalidResetToken {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to check password reset token", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+		return
+	}
+
+	hashedPassword, err := libs.HashPassword(body.Password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+		return
+	}
+
+	user, err := libs.FindUserByID(ctx, userID.Hex())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": libs.ErrInvalidResetToken.Error()})
+		return
+	}
+	if err := libs.UpdateUserPassword(libs.RequestContext(c), user, hashedPassword); err != nil {
+		libs.RequestLogger(c).Error("Failed to update password", "user_id", userID.Hex(), "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update password"})
+		return
+	}
+
+	if err := libs.RevokeUserRefreshTokens(ctx, userID); err != nil {
+		libs.RequestLogger(c).Error("Failed to revoke sessions", "user_id", userID.Hex(), "error", err)
+	}
+
+	libs.RecordAudit(libs.RequestContext(c), models.AuditEvent{
+		Action: models.AuditPasswordResetCompleted,
+		Actor:  auditActor(c, userID.Hex()),
+		Target: &models.AuditTarget{Type: models.AuditTargetUser, ID: userID.Hex()},
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password updated successfully"})
+}
+
+// ChangePassword replaces the signed-in user's password, given the current
+// one. Every access token and refresh token issued before stops working,
+// on every device, and a new session is returned in their place.
+func ChangePassword(c *gin.Context) {
+	type Body struct {
+		CurrentPassword string `json:"currentPassword" binding:"required"`
+		NewPassword     string `json:"newPassword" binding:"required,min=6"`
+	}
+
+	var body Body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := libs.FindUserByID(libs.RequestContext(c), c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+	if user.Password == "" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Your account has no password; set one through a reset link"})
+		return
+	}
+	if !libs.CheckPasswordHash(body.CurrentPassword, user.Password) {
+		libs.RecordAudit(libs.RequestContext(c), models.AuditEvent{
+			Action:  models.AuditPasswordChanged,
+			Outcome: models.AuditOutcomeFailure,
+			Actor:   auditActor(c, user.ID.Hex()),
+			Target:  &models.AuditTarget{Type: models.AuditTargetUser, ID: user.ID.Hex()},
+			Details: map[string]interface{}{"reason": "wrong_password"},
+		})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Current password is incorrect"})
+		return
+	}
+
+	hashedPassword, err := libs.HashPassword(body.NewPassword)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+		return
+	}
+	if err := libs.UpdateUserPassword(libs.RequestContext(c), user, hashedPassword); err != nil {
+		libs.RequestLogger(c).Error("Failed to update password", "user_id", user.ID.Hex(), "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update password"})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+	if err := libs.RevokeUserRefreshTokens(ctx, user.ID); err != nil {
+		libs.RequestLogger(c).Error("Failed to revoke sessions", "user_id", user.ID.Hex(), "error", err)
+	}
+
+	libs.RecordAudit(libs.RequestContext(c), models.AuditEvent{
+		Action: models.AuditPasswordChanged,
+		Actor:  auditActor(c, user.ID.Hex()),
+		Target: &models.AuditTarget{Type: models.AuditTargetUser, ID: user.ID.Hex()},
+	})
+
+	session, ok := issueSession(c, user)
+	if !ok {
+		return
+	}
+	session["message"] = "Password changed"
+	c.JSON(http.StatusOK, session)
+}
+
+// ChangeEmail emails a confirmation link to the address the signed-in user
+// wants to move their account to, given their password if they have one.
+// The account keeps its current address until the link is used.
+func ChangeEmail(c *gin.Context) {
+	type Body struct {
+		NewEmail        string `json:"newEmail" binding:"required,email"`
+		CurrentPassword string `json:"currentPassword"`
+	}
+
+	var body Body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := libs.FindUserByID(libs.RequestContext(c), c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+	if user.Password != "" && !libs.CheckPasswordHash(body.CurrentPassword, user.Password) {
+		libs.RecordAudit(libs.RequestContext(c), models.AuditEvent{
+			Action:  models.AuditEmailChangeRequested,
+			Outcome: models.AuditOutcomeFailure,
+			Actor:   auditActor(c, user.ID.Hex()),
+			Target:  &models.AuditTarget{Type: models.AuditTargetUser, ID: user.ID.Hex()},
+			Details: map[string]interface{}{"reason": "wrong_password"},
+		})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Current password is incorrect"})
+		return
+	}
+	if body.NewEmail == user.Email {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "That is already your email address"})
+		return
+	}
+
+	exists, err := libs.SearchForExistingEmail(libs.RequestContext(c), body.NewEmail)
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to check email existence", "email", body.NewEmail, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+		return
+	}
+	if exists {
+		c.JSON(http.StatusConflict, gin.H{"error": libs.ErrEmailTaken.Error()})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	token, err := libs.CreateEmailChange(ctx, user.ID, body.NewEmail)
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to create email change", "user_id", user.ID.Hex(), "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+		return
+	}
+
+	locale := userLocale(user)
+	link := libs.FrontendURL() + "/confirm-email?token=" + url.QueryEscape(token)
+	message := libs.Translate(locale, "email_change.body", map[string]string{
+		"link":  link,
+		"hours": strconv.Itoa(int(libs.EmailChangeTTL().Hours())),
+	})
+
+	err = libs.SendEmail(body.NewEmail,
+		libs.Translate(locale, "email_change.subject", nil),
+		libs.LocalizedEmail(locale, body.NewEmail, message),
+	)
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to send email change confirmation", "user_id", user.ID.Hex(), "error", err)
+	}
+
+	libs.RecordAudit(libs.RequestContext(c), models.AuditEvent{
+		Action:  models.AuditEmailChangeRequested,
+		Actor:   auditActor(c, user.ID.Hex()),
+		Target:  &models.AuditTarget{Type: models.AuditTargetUser, ID: user.ID.Hex()},
+		Details: map[string]interface{}{"email": body.NewEmail},
+	})
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "A confirmation link has been sent to " + body.NewEmail})
+}
+
+// ConfirmEmailChange moves the account to the address a confirmation link
+// was sent to, and tells the old address it no longer signs in
+func ConfirmEmailChange(c *gin.Context) {
+	type Body struct {
+		Token string `json:"token" binding:"required"`
+	}
+
+	var body Body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	change, err := libs.ConsumeEmailChange(ctx, body.Token)
+	if err == libs.ErrInvalidEmailChange {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to check email change token", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+		return
+	}
+
+	user, err := libs.FindUserByID(libs.RequestContext(c), change.UserID.Hex())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": libs.ErrInvalidEmailChange.Error()})
+		return
+	}
+	oldEmail := user.Email
+
+	// Someone may have registered the address since the link was sent
+	if err := libs.UpdateUserEmail(libs.RequestContext(c), user, change.Email); err != nil {
+		if err == libs.ErrEmailTaken {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		libs.RequestLogger(c).Error("Failed to update email", "user_id", user.ID.Hex(), "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update email"})
+		return
+	}
+
+	locale := userLocale(user)
+	err = libs.SendEmail(oldEmail,
+		libs.Translate(locale, "email_changed.subject", nil),
+		libs.LocalizedEmail(locale, oldEmail, libs.Translate(locale, "email_changed.body", map[string]string{"email": user.Email})),
+	)
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to send email change notice", "user_id", user.ID.Hex(), "error", err)
+	}
+
+	libs.RecordAudit(libs.RequestContext(c), models.AuditEvent{
+		Action:  models.AuditEmailChanged,
+		Actor:   auditActor(c, user.ID.Hex()),
+		Target:  &models.AuditTarget{Type: models.AuditTargetUser, ID: user.ID.Hex()},
+		Details: map[string]interface{}{"from": oldEmail, "to": user.Email},
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email address updated", "email": user.Email})
+}
+
+// RequestMagicLink emails a single-use sign-in link, as an alternative to a
+// password. Unregistered emails only get one when MAGIC_LINK_SIGNUP allows
+// creating accounts; the response is the same either way, so it can't be
+// used to probe for accounts.
+func RequestMagicLink(c *gin.Context) {
+	type Body struct {
+		Email  string `json:"email" binding:"required,email"`
+		Locale string `json:"locale"`
+	}
+
+	var body Body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if body.Locale != "" && !libs.IsSupportedLocale(body.Locale) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported locale"})
+		return
+	}
+
+	response := gin.H{"message": "If that email can sign in, a sign-in link has been sent"}
+
+	var userID *primitive.ObjectID
+	locale := libs.DefaultLocale
+	if body.Locale != "" {
+		locale = libs.NormalizeLocale(body.Locale)
+	}
+	user, err := libs.FindUserByEmail(libs.RequestContext(c), body.Email)
+	if err == nil {
+		userID = &user.ID
+		locale = userLocale(user)
+	} else if !libs.MagicLinkSignupAllowed() {
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	token, err := libs.CreateMagicLink(ctx, body.Email, userID, locale)
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to create sign-in link", "email", body.Email, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+		return
+	}
+
+	link := libs.APIURL() + "/auth/magic-link/verify?" + url.Values{"locale": {locale}, "token": {token}}.Encode()
+	message := libs.Translate(locale, "magic_link.body", map[string]string{
+		"link":    link,
+		"minutes": strconv.Itoa(int(libs.MagicLinkTTL().Minutes())),
+	})
+
+	err = libs.SendEmail(body.Email,
+		libs.Translate(locale, "magic_link.subject", nil),
+		libs.LocalizedEmail(locale, body.Email, message),
+	)
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to send sign-in link", "email", body.Email, "error", err)
+	}
+
+	event := models.AuditEvent{
+		Action:  models.AuditMagicLinkRequested,
+		Actor:   auditActor(c, ""),
+		Details: map[string]interface{}{"email": body.Email, "newAccount": userID == nil},
+	}
+	if userID != nil {
+		event.Target = &models.AuditTarget{Type: models.AuditTargetUser, ID: userID.Hex()}
+	}
+	libs.RecordAudit(libs.RequestContext(c), event)
+
+	c.JSON(http.StatusOK, response)
+}
+
+// VerifyMagicLink signs the user in with a sign-in link's token, creating
+// their account if the link was sent to an unregistered email. The response
+// is the same as a password login. Form posts come from the page the
+// emailed link opens, and end on the frontend like provider sign-ins.
+func VerifyMagicLink(c *gin.Context) {
+	if c.ContentType() == binding.MIMEPOSTForm {
+		verifyMagicLinkForm(c)
+		return
+	}
+
+	type Body struct {
+		Token string `json:"token" binding:"required"`
+	}
+
+	var body Body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	user, details, err := magicLinkUser(ctx, body.Token)
+	if err == libs.ErrInvalidMagicLink {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to sign in with link", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+		return
+	}
+
+	signIn(c, user, details)
+}
+
+// VerifyMagicLinkFromEmail is the sign-in link sent by email. Opening it
+// doesn't use the link up, since mail scanners and link previews open links
+// before the user does: it answers with a page whose button posts the token
+// back to POST /auth/magic-link/verify.
+func VerifyMagicLinkFromEmail(c *gin.Context) {
+	confirmation, err := libs.NewMagicLinkConfirmation()
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to open sign-in link", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+		return
+	}
+	locale := libs.DefaultLocale
+	if requested := c.Query("locale"); requested != "" && libs.IsSupportedLocale(requested) {
+		locale = libs.NormalizeLocale(requested)
+	}
+
+	writeMagicLinkCookie(c, confirmation, int(libs.MagicLinkTTL().Seconds()))
+	// The form posts to this site, which no-referrer would send as Origin:
+	// null, rejected by CORS
+	c.Header("Cache-Control", "no-store")
+	c.Header("Referrer-Policy", "same-origin")
+	c.Header("Content-Security-Policy", "default-src 'none'; form-action 'self'; frame-ancestors 'none'")
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(libs.MagicLinkPage(locale, c.Query("token"), confirmation)))
+}
+
+// verifyMagicLinkForm signs in with the token posted by the sign-in link's
+// page, which must also send back the confirmation its cookie holds, and
+// sends the user on to the frontend
+func verifyMagicLinkForm(c *gin.Context) {
+	confirmation, err := c.Cookie(magicLinkCookieName)
+	writeMagicLinkCookie(c, "", -1)
+	if err != nil || confirmation == "" || subtle.ConstantTimeCompare([]byte(confirmation), []byte(c.PostForm("confirmation"))) != 1 {
+		redirectToFrontend(c, magicLinkProvider, url.Values{"error": {libs.ErrInvalidMagicLink.Error()}})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	user, details, err := magicLinkUser(ctx, c.PostForm("token"))
+	if err != nil {
+		if err != libs.ErrInvalidMagicLink {
+			libs.RequestLogger(c).Error("Failed to sign in with link", "error", err)
+			err = errors.New("Could not sign in with the link")
+		}
+		redirectToFrontend(c, magicLinkProvider, url.Values{"error": {err.Error()}})
+		return
+	}
+
+	redirectToFrontend(c, magicLinkProvider, redirectSignIn(ctx, c, user, details, "Could not sign in with the link"))
+}
+
+// magicLinkUser uses up a sign-in link's token and returns the account to
+// sign in, with the details for the login's audit event. An unregistered
+// email's link creates the account.
+func magicLinkUser(ctx context.Context, token string) (*models.User, map[string]interface{}, error) {
+	link, err := libs.ConsumeMagicLink(ctx, token)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	details := map[string]interface{}{"method": "magic_link"}
+
+	// The account may have been registered since the link was sent
+	user, err := libs.FindUserByEmail(ctx, link.Email)
+	if err != nil {
+		if link.UserID != nil || !libs.MagicLinkSignupAllowed() {
+			return nil, nil, libs.ErrInvalidMagicLink
+		}
+
+		// No password: the account signs in with links until one is set
+		// through the password reset flow
+		user = &models.User{Email: link.Email, Locale: link.Locale}
+		if _, err := libs.CreateUser(ctx, user); err != nil {
+			return nil, nil, fmt.Errorf("error creating user %s: %w", link.Email, err)
+		}
+		details["newAccount"] = true
+	}
+	return user, details, nil
+}
+
 func GetProfile(c *gin.Context) {
 	userID := c.GetString("userId")
 
-	user, err := libs.FindUserByID(userID)
+	user, err := libs.FindUserByID(libs.RequestContext(c), userID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"id":    user.ID.Hex(),
-		"email": user.Email,
-	})
+	c.JSON(http.StatusOK, profileResponse(user))
+}
+
+// profileResponse is the signed-in user as GET /me describes them
+func profileResponse(user *models.User) gin.H {
+	return gin.H{
+		"id":           user.ID.Hex(),
+		"email":        user.Email,
+		"name":         user.Name,
+		"displayName":  user.DisplayName,
+		"avatarUrl":    user.AvatarURL,
+		"locale":       userLocale(user),
+		"passwordless": user.Passwordless,
+	}
+}
+
+func UpdateLocale(c *gin.Context) {
+	type Body struct {
+		Locale string `json:"locale" binding:"required"`
+	}
+
+	var body Body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !libs.IsSupportedLocale(body.Locale) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported locale"})
+		return
+	}
+
+	locale := libs.NormalizeLocale(body.Locale)
+	if err := libs.UpdateUserLocale(libs.RequestContext(c), c.GetString("userId"), locale); err != nil {
+		libs.RequestLogger(c).Error("Failed to update locale", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update locale"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"locale": locale})
+}
+
+// userLocale returns the user's preferred locale, defaulting accounts created
+// before locales were stored.
+func userLocale(user *models.User) string {
+	if user.Locale == "" {
+		return libs.DefaultLocale
+	}
+	return user.Locale
+}
+
+const refreshCookieName = "refresh_token"
+
+// magicLinkCookieName holds the confirmation the sign-in link's page posts
+// back, and magicLinkProvider names sign-in links on the frontend's
+// callback page
+const (
+	magicLinkCookieName = "magic_link_confirmation"
+	magicLinkProvider   = "magic_link"
+)
+
+// requestRefreshToken reads the refresh token from the cookie, or from a
+// {"refreshToken": "..."} body for clients that don't keep cookies
+func requestRefreshToken(c *gin.Context) string {
+	if token, err := c.Cookie(refreshCookieName); err == nil && token != "" {
+		return token
+	}
+
+	var body struct {
+		RefreshToken string `json:"refreshToken"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		return ""
+	}
+	return body.RefreshToken
+}
+
+// setRefreshCookie stores the refresh token in an HttpOnly cookie scoped to
+// the auth routes, secured as COOKIE_SECURE and COOKIE_SAMESITE say
+func setRefreshCookie(c *gin.Context, token string) {
+	writeRefreshCookie(c, token, int(libs.RefreshTokenTTL().Seconds()))
+}
+
+func clearRefreshCookie(c *gin.Context) {
+	writeRefreshCookie(c, "", -1)
+}
+
+func writeRefreshCookie(c *gin.Context, token string, maxAge int) {
+	settings := libs.Settings()
+	c.SetSameSite(settings.CookieSameSite)
+	c.SetCookie(refreshCookieName, token, maxAge, "/auth", "", settings.CookieSecure, true)
+}
+
+// writeMagicLinkCookie sets the sign-in link page's confirmation. It is
+// only sent back by pages on this site.
+func writeMagicLinkCookie(c *gin.Context, confirmation string, maxAge int) {
+	c.SetSameSite(http.SameSiteStrictMode)
+	c.SetCookie(magicLinkCookieName, confirmation, maxAge, "/auth/magic-link", "", libs.Settings().CookieSecure, true)
 }
@@ -2,32 +2,110 @@ package controllers
 
 import (
 	"context"
-	"log"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
-	"github.com/sarwanazhar/boardsar/backend/database"
+	"github.com/sarwanazhar/boardsar/backend/libs"
 	"github.com/sarwanazhar/boardsar/backend/models"
+	"github.com/sarwanazhar/boardsar/backend/plugins"
+	"github.com/sarwanazhar/boardsar/backend/realtime"
+	"github.com/sarwanazhar/boardsar/backend/repository"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// Board list page sizes
+const (
+	defaultBoardPageSize = 50
+	maxBoardPageSize     = 200
+)
+
 // transformBoardToFrontend converts a backend Board to the frontend format
 func transformBoardToFrontend(board *models.Board) models.FrontendBoard {
-	// Return the board data as-is since it's already in the correct frontend format
-	// The board.BoardData contains the complete frontend board state
+	shapes, _ := libs.ShapeList(board.BoardData)
+	return transformSummaryToFrontend(&models.BoardSummary{
+		ID:                board.ID,
+		BoardID:           board.BoardID,
+		Name:              board.Name,
+		Description:       board.Description,
+		OwnerID:           board.OwnerID,
+		SharedWith:        board.SharedWith,
+		ParentID:          board.ParentID,
+		Tags:              board.Tags,
+		FolderID:          board.FolderID,
+		Freeze:            board.Freeze,
+		Version:           board.Version,
+		CreatedAt:         board.CreatedAt,
+		UpdatedAt:         board.UpdatedAt,
+		ShapeCount:        len(shapes),
+		CollaboratorCount: len(board.SharedWith),
+	})
+}
+
+// boardDisplayName is the name to show for a board. Boards created before
+// they had names show their board ID.
+func boardDisplayName(name, boardID string) string {
+	if name != "" {
+		return name
+	}
+	return boardID
+}
+
+// transformSummaryToFrontend converts a board summary to the frontend
+// format. The board contents are fetched separately with GetBoard.
+func transformSummaryToFrontend(board *models.BoardSummary) models.FrontendBoard {
+	sharedWith := []string{}
+	collaborators := []models.Collaborator{}
+	for _, collaborator := range board.SharedWith {
+		sharedWith = append(sharedWith, collaborator.UserID.Hex())
+		collaborators = append(collaborators, collaborator)
+	}
+
+	parentID := ""
+	if board.ParentID != nil {
+		parentID = board.ParentID.Hex()
+	}
+	folderID := ""
+	if board.FolderID != nil {
+		folderID = board.FolderID.Hex()
+	}
+	tags := board.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	thumbnailVersion := int64(0)
+	if board.Thumbnail != nil {
+		thumbnailVersion = board.Thumbnail.Version
+	}
+
 	return models.FrontendBoard{
-		ID:         board.ID.Hex(),
-		Name:       board.BoardID,
-		OwnerID:    board.OwnerID.Hex(),
-		SharedWith: []string{}, // Backend doesn't store sharedWith in this model
-		CreatedAt:  board.CreatedAt,
-		UpdatedAt:  board.UpdatedAt,
-		Scale:      1.0, // Default scale
+		ID:                board.ID.Hex(),
+		Name:              boardDisplayName(board.Name, board.BoardID),
+		Description:       board.Description,
+		OwnerID:           board.OwnerID.Hex(),
+		SharedWith:        sharedWith,
+		Collaborators:     collaborators,
+		ParentID:          parentID,
+		Tags:              tags,
+		FolderID:          folderID,
+		Freeze:            libs.FreezeStatus(board.Freeze, time.Now()),
+		Version:           board.Version,
+		CreatedAt:         board.CreatedAt,
+		UpdatedAt:         board.UpdatedAt,
+		ShapeCount:        board.ShapeCount,
+		CollaboratorCount: len(board.SharedWith),
+		ThumbnailVersion:  thumbnailVersion,
+		Scale:             1.0, // Default scale
 		Position: map[string]float64{
 			"x": 0,
 			"y": 0,
@@ -36,11 +114,29 @@ func transformBoardToFrontend(board *models.Board) models.FrontendBoard {
 	}
 }
 
-const dbName = "boardsar"
-const boardCollection = "boards"
+// findRehydratedBoard loads the board by its ObjectID, bringing its
+// contents back from cold storage first if it was archived
+func findRehydratedBoard(ctx context.Context, boards repository.BoardRepository, id primitive.ObjectID) (*models.Board, error) {
+	board, err := boards.FindByID(ctx, id)
+	if err != nil || board.Archived == nil {
+		return board, err
+	}
+	if err := libs.RehydrateBoards(ctx, bson.M{"_id": id}); err != nil {
+		return nil, err
+	}
+	return boards.FindByID(ctx, id)
+}
 
-func getBoardCollection() *mongo.Collection {
-	return database.GetCollection(dbName, boardCollection)
+// getBoardSummaryCollection holds what board lists show of each board,
+// kept in step with every board write
+func getBoardSummaryCollection() *mongo.Collection {
+	return libs.GetBoardSummaryCollection()
+}
+
+// boardAccessFilter matches boards the user owns or has been shared. When
+// roles are given, collaborators must hold one of them.
+func boardAccessFilter(userID primitive.ObjectID, roles ...string) bson.M {
+	return repository.BoardAccessFilter(userID, roles...)
 }
 
 // CreateBoard creates a new board for the authenticated user
@@ -53,6 +149,13 @@ func CreateBoard(c *gin.Context) {
 		return
 	}
 
+	// The board must be well formed, and shapes of custom types must match
+	// their schema
+	if err := libs.ValidateBoardData(req.Board); err != nil {
+		invalidBoard(c, err)
+		return
+	}
+
 	// Get user ID from JWT context
 	userIDStr := c.GetString("userId")
 	if userIDStr == "" {
@@ -70,9 +173,30 @@ func CreateBoard(c *gin.Context) {
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := libs.DBContext(c)
 	defer cancel()
 
+	size := libs.BoardDataSize(req.Board)
+	if err := libs.CheckBoardSize(size); err != nil {
+		invalidBoard(c, err)
+		return
+	}
+
+	usage, err := libs.GetQuotaUsage(ctx, userID, primitive.NilObjectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to check quota: " + err.Error(),
+		})
+		return
+	}
+	warnings, quotaErr := libs.ApplyQuota(c, usage, 1, size)
+	if quotaErr != "" {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": quotaErr,
+		})
+		return
+	}
+
 	// Generate board ID if not provided
 	boardID := req.BoardID
 	if boardID == "" {
@@ -85,11 +209,18 @@ func CreateBoard(c *gin.Context) {
 		BoardID:   boardID,
 		OwnerID:   userID,
 		BoardData: req.Board,
+		Version:   1,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	}
+	if req.Name != nil {
+		board.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Description != nil {
+		board.Description = strings.TrimSpace(*req.Description)
+	}
 
-	_, err = getBoardCollection().InsertOne(ctx, board)
+	err = libs.BoardRepository(c).Create(ctx, &board)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to create board: " + err.Error(),
@@ -97,11 +228,21 @@ func CreateBoard(c *gin.Context) {
 		return
 	}
 
+	recordAudit(c, models.AuditBoardCreated, models.AuditTargetBoard, board.ID.Hex(), nil)
+	libs.RecordActivity(libs.RequestContext(c), &board, userID, models.ActivityBoardCreated, nil)
+	plugins.Emit(libs.RequestContext(c), &board, plugins.EventBoardCreated, userID)
+	libs.RecordBoardVersion(libs.RequestContext(c), &board, userID)
+
 	// Return the complete board data including the frontend state
-	c.JSON(http.StatusCreated, gin.H{
+	response := gin.H{
 		"message": "Board created successfully",
 		"board":   board.BoardData,
-	})
+		"version": board.Version,
+	}
+	if len(warnings) > 0 {
+		response["warnings"] = warnings
+	}
+	c.JSON(http.StatusCreated, response)
 }
 
 // UpdateBoard updates the entire board state
@@ -139,32 +280,29 @@ func UpdateBoard(c *gin.Context) {
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	// Try to parse the board ID as an ObjectID first (for MongoDB ObjectID format)
-	boardObjectID, err := primitive.ObjectIDFromHex(boardIDStr)
-	var board models.Board
-	var boardFilter bson.M
+	// The board must be well formed, and shapes of custom types must match
+	// their schema
+	if err := libs.ValidateBoardData(req.Board); err != nil {
+		invalidBoard(c, err)
+		return
+	}
 
-	if err == nil {
-		// Board ID is a valid ObjectID, search by _id
-		boardFilter = bson.M{
-			"_id":     boardObjectID,
-			"ownerId": userID,
-		}
-	} else {
-		// If not a valid ObjectID, try searching by boardId field (for string board IDs)
-		boardFilter = bson.M{
-			"boardId": boardIDStr,
-			"ownerId": userID,
-		}
+	expectedVersion, checkVersion, err := expectedBoardVersion(c, req.ExpectedVersion)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
 	}
 
-	// Find the board and check ownership
-	err = getBoardCollection().FindOne(ctx, boardFilter).Decode(&board)
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	// Find the board and check access: owners and collaborators can see it
+	boards := libs.BoardRepository(c)
+	board, err := boards.FindForUser(ctx, boardIDStr, userID)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
+		if errors.Is(err, repository.ErrNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{
 				"error": "Board not found or access denied",
 			})
@@ -176,25 +314,106 @@ func UpdateBoard(c *gin.Context) {
 		return
 	}
 
-	// Update the board with the entire new state
-	update := bson.M{
-		"$set": bson.M{
-			"board":     req.Board,
-			"updatedAt": time.Now(),
-		},
+	// Only owners and editors can change it
+	role := libs.BoardRole(board, userID)
+	if role != models.BoardRoleOwner && role != models.CollaboratorRoleEditor {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "You have view-only access to this board",
+		})
+		return
+	}
+
+	// Unsaved realtime edits count as someone else's changes
+	if checkVersion && realtime.DefaultHub.FlushBoard(board.ID) {
+		if board, err = boards.FindByID(ctx, board.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to retrieve board: " + err.Error(),
+			})
+			return
+		}
+	}
+
+	// Someone else saved since this client loaded the board
+	if checkVersion && expectedVersion != board.Version {
+		boardConflict(c, board, userID)
+		return
 	}
 
-	_, err = getBoardCollection().UpdateOne(ctx, boardFilter, update)
+	// Keep other people's private notes and stamp new ones
+	libs.ApplyPrivateNotes(board, req.Board, userID)
+
+	// Locked sections can't change, whoever saves
+	if violation := libs.CheckSectionLocks(board.Sections, board.BoardData, req.Board); violation != "" {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": violation,
+		})
+		return
+	}
+
+	// Participants are bound by the facilitated session's restrictions, and
+	// comment-only collaborators to sticky notes
+	if role != models.BoardRoleOwner {
+		if violation := libs.CheckFacilitation(board.Facilitation, board.BoardData, req.Board); violation != "" {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": violation,
+			})
+			return
+		}
+		if violation := libs.CheckCommentOnly(board, userID, board.BoardData, req.Board); violation != "" {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": violation,
+			})
+			return
+		}
+	}
+
+	size := libs.BoardDataSize(req.Board)
+	if err := libs.CheckBoardSize(size); err != nil {
+		invalidBoard(c, err)
+		return
+	}
+
+	usage, err := libs.GetQuotaUsage(ctx, board.OwnerID, board.ID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to update board: " + err.Error(),
+			"error": "Failed to check quota: " + err.Error(),
+		})
+		return
+	}
+	warnings, quotaErr := libs.ApplyQuota(c, usage, 0, size)
+	if quotaErr != "" {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": quotaErr,
+		})
+		return
+	}
+
+	// Update the board with the entire new state. Without an expected
+	// version the last save wins.
+	version := repository.AnyVersion
+	if checkVersion {
+		version = board.Version
+	}
+	fields := map[string]interface{}{"updatedAt": time.Now()}
+	for field, value := range boardMetaUpdate(req.Name, req.Description) {
+		fields[field] = value
+	}
+	saveErr := boards.SaveContents(ctx, board.ID, version, 1, req.Board, fields)
+	if saveErr != nil && !errors.Is(saveErr, repository.ErrVersionConflict) {
+		if errors.Is(saveErr, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Board not found or access denied",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to update board: " + saveErr.Error(),
 		})
 		return
 	}
 
 	// Return updated board
-	var updatedBoard models.Board
-	err = getBoardCollection().FindOne(ctx, boardFilter).Decode(&updatedBoard)
+	updatedBoard, err := boards.FindByID(ctx, board.ID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to retrieve updated board: " + err.Error(),
@@ -202,11 +421,191 @@ func UpdateBoard(c *gin.Context) {
 		return
 	}
 
+	// Lost a race with another save between the read and the write
+	if saveErr != nil {
+		boardConflict(c, updatedBoard, userID)
+		return
+	}
+	boardChanged(ctx, board.ID)
+	plugins.Emit(libs.RequestContext(c), updatedBoard, plugins.EventBoardUpdated, userID)
+	libs.RecordBoardVersion(libs.RequestContext(c), updatedBoard, userID)
+	libs.RecordBoardUpdate(libs.RequestContext(c), updatedBoard, userID, libs.DiffChanges(libs.DiffBoards(board.BoardData, updatedBoard.BoardData)))
+
 	// Return the complete board data including the frontend state
-	c.JSON(http.StatusOK, gin.H{
+	c.Header("ETag", boardETag(updatedBoard.Version))
+	response := gin.H{
 		"message": "Board updated successfully",
-		"board":   updatedBoard.BoardData,
-	})
+		"version": updatedBoard.Version,
+	}
+	// Compact clients already have what they just saved
+	if !compactMode(c) {
+		response["board"] = libs.VisibleBoardData(updatedBoard.BoardData, userID)
+	}
+	if len(warnings) > 0 {
+		response["warnings"] = warnings
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// bulkDeleteBackupThreshold is how many shape deletions in one patch take a
+// pre-operation backup first
+const bulkDeleteBackupThreshold = 10
+
+// countDeletes counts the shape deletions in a patch
+func countDeletes(operations []models.BoardOperation) int {
+	count := 0
+	for _, op := range operations {
+		if op.Op == models.OpDeleteShape {
+			count++
+		}
+	}
+	return count
+}
+
+// PatchBoard applies a list of operations (add/update/delete shape, set
+// scale/position) to a board without sending the whole state. The
+// operations apply all together or, if one can't, not at all.
+func PatchBoard(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req models.PatchBoardRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+
+	expectedVersion, checkVersion, err := expectedBoardVersion(c, req.ExpectedVersion)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	boards := libs.BoardRepository(c)
+	board, err := boards.FindForUser(ctx, c.Param("boardId"), userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Board not found or access denied"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve board: " + err.Error()})
+		return
+	}
+
+	// Only owners and editors can change it
+	role := libs.BoardRole(board, userID)
+	if role != models.BoardRoleOwner && role != models.CollaboratorRoleEditor {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You have view-only access to this board"})
+		return
+	}
+
+	// Apply the operations on top of unsaved realtime edits rather than
+	// discarding them
+	if realtime.DefaultHub.FlushBoard(board.ID) {
+		if board, err = boards.FindByID(ctx, board.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve board: " + err.Error()})
+			return
+		}
+	}
+
+	if checkVersion && expectedVersion != board.Version {
+		boardConflict(c, board, userID)
+		return
+	}
+
+	// Deleting many shapes at once is easy to regret, so keep the state
+	// before the operations are applied to back it up
+	var before *models.Board
+	if countDeletes(req.Operations) >= bulkDeleteBackupThreshold {
+		snapshot := *board
+		snapshot.BoardData = libs.CopyBoardData(board.BoardData)
+		before = &snapshot
+	}
+
+	// Check every operation against the current state before writing any,
+	// so a bad operation leaves the board untouched
+	for i := range req.Operations {
+		op := &req.Operations[i]
+		if violation := libs.PrepareOperation(board, op, userID); violation != "" {
+			c.JSON(http.StatusForbidden, gin.H{"error": violation, "index": i})
+			return
+		}
+		if err := libs.ApplyBoardOperation(board.BoardData, *op); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "index": i})
+			return
+		}
+	}
+
+	size := libs.BoardDataSize(board.BoardData)
+	if err := libs.CheckBoardSize(size); err != nil {
+		invalidBoard(c, err)
+		return
+	}
+
+	usage, err := libs.GetQuotaUsage(ctx, board.OwnerID, board.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check quota: " + err.Error()})
+		return
+	}
+	warnings, quotaErr := libs.ApplyQuota(c, usage, 0, size)
+	if quotaErr != "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": quotaErr})
+		return
+	}
+
+	var backup *models.BoardVersion
+	if before != nil {
+		var ok bool
+		if backup, ok = backupBeforeOperation(ctx, c, before, userID, models.BackupBeforeBulkDelete); !ok {
+			return
+		}
+	}
+
+	// The board with the operations applied is written back whole, moving
+	// the version on by one per operation, only over the version they were
+	// applied to
+	now := time.Now().Truncate(time.Millisecond)
+	err = boards.SaveContents(ctx, board.ID, board.Version, int64(len(req.Operations)), board.BoardData, map[string]interface{}{"updatedAt": now})
+	if errors.Is(err, repository.ErrVersionConflict) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "Board changed while applying operations; reload it and retry",
+			"applied": 0,
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update board: " + err.Error(), "applied": 0})
+		return
+	}
+	board.Version += int64(len(req.Operations))
+	board.UpdatedAt = now
+	boardChanged(ctx, board.ID)
+	plugins.Emit(libs.RequestContext(c), board, plugins.EventBoardUpdated, userID)
+	libs.RecordBoardVersion(libs.RequestContext(c), board, userID)
+	libs.RecordBoardUpdate(libs.RequestContext(c), board, userID, operationChanges(req.Operations))
+
+	c.Header("ETag", boardETag(board.Version))
+	response := gin.H{
+		"message":   "Board updated successfully",
+		"applied":   len(req.Operations),
+		"version":   board.Version,
+		"updatedAt": now,
+	}
+	if backup != nil {
+		response["backup"] = backupResponse(board, backup)
+	}
+	if len(warnings) > 0 {
+		response["warnings"] = warnings
+	}
+	c.JSON(http.StatusOK, response)
 }
 
 // GetBoard retrieves a specific board by ID
@@ -236,52 +635,26 @@ func GetBoard(c *gin.Context) {
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := libs.DBContext(c)
 	defer cancel()
 
-	// Debug: Log the search parameters
-	log.Printf("🔍 Searching for board: %s, owner: %s", boardIDStr, userIDStr)
-
 	// Check if user exists first
-	var user models.User
-	err = database.GetCollection("boardsar", "users").FindOne(ctx, bson.M{"_id": userID}).Decode(&user)
-	if err != nil {
-		log.Printf("❌ User not found: %v", err)
+	if _, err := libs.Users().FindByID(ctx, userID); err != nil {
 		c.JSON(http.StatusNotFound, gin.H{
 			"error": "User not found",
 		})
 		return
 	}
-	log.Printf("✅ User found: %s", user.Email)
 
-	// Try to parse the board ID as an ObjectID first (for MongoDB ObjectID format)
-	boardObjectID, err := primitive.ObjectIDFromHex(boardIDStr)
-	if err == nil {
-		// Board ID is a valid ObjectID, search by _id
-		log.Printf("🔍 Searching by ObjectID: %s", boardObjectID.Hex())
-		var board models.Board
-		err = getBoardCollection().FindOne(ctx, bson.M{
-			"_id":     boardObjectID,
-			"ownerId": userID,
-		}).Decode(&board)
+	// A cached board is only answered to those it is shared with; anyone
+	// else gets the database's answer
+	board, cached := libs.CachedBoard(ctx, boardIDStr)
+	if !cached || libs.BoardRole(board, userID) == "" {
+		board, err = libs.BoardRepository(c).FindForUser(ctx, boardIDStr, userID)
 		if err != nil {
-			if err == mongo.ErrNoDocuments {
-				// Debug: Check what boards this user actually has
-				var userBoards []models.Board
-				cursor, err := getBoardCollection().Find(ctx, bson.M{"ownerId": userID})
-				if err == nil {
-					cursor.All(ctx, &userBoards)
-					log.Printf("📋 User has %d boards: %v", len(userBoards), userBoards)
-				}
-
+			if errors.Is(err, repository.ErrNotFound) {
 				c.JSON(http.StatusNotFound, gin.H{
 					"error": "Board not found or access denied",
-					"debug": gin.H{
-						"requestedBoardId": boardIDStr,
-						"userId":           userIDStr,
-						"userBoardsCount":  len(userBoards),
-						"searchMethod":     "ObjectID",
-					},
 				})
 				return
 			}
@@ -290,55 +663,136 @@ func GetBoard(c *gin.Context) {
 			})
 			return
 		}
+		libs.CacheBoard(ctx, board)
+	}
 
-		// Return the complete board data including the frontend state
-		c.JSON(http.StatusOK, gin.H{
-			"board": board.BoardData,
-		})
+	// Return the complete board data including the frontend state
+	writeBoardState(c, board, userID)
+}
+
+// writeBoardState answers GetBoard: 304 when the client already has this
+// version (If-None-Match), else the board state with the fields asked for
+func writeBoardState(c *gin.Context, board *models.Board, userID primitive.ObjectID) {
+	fields, ok := responseFields(c, boardStateFields, compactBoardStateFields)
+	if !ok {
 		return
 	}
 
-	// If not a valid ObjectID, try searching by boardId field (for string board IDs)
-	log.Printf("🔍 Searching by boardId field: %s", boardIDStr)
-	var board models.Board
-	err = getBoardCollection().FindOne(ctx, bson.M{
-		"boardId": boardIDStr,
-		"ownerId": userID,
-	}).Decode(&board)
-	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			// Debug: Check what boards this user actually has
-			var userBoards []models.Board
-			cursor, err := getBoardCollection().Find(ctx, bson.M{"ownerId": userID})
-			if err == nil {
-				cursor.All(ctx, &userBoards)
-				log.Printf("📋 User has %d boards: %v", len(userBoards), userBoards)
+	etag := boardETag(board.Version)
+	c.Header("ETag", etag)
+	if etagMatches(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	response := boardStateResponse(board, userID)
+	if fields != nil {
+		picked := gin.H{}
+		for _, field := range fields {
+			if value, ok := response[field]; ok {
+				picked[field] = value
 			}
+		}
+		response = picked
+	}
+	c.JSON(http.StatusOK, response)
+}
 
-			c.JSON(http.StatusNotFound, gin.H{
-				"error": "Board not found or access denied",
-				"debug": gin.H{
-					"requestedBoardId": boardIDStr,
-					"userId":           userIDStr,
-					"userBoardsCount":  len(userBoards),
-					"searchMethod":     "boardId",
-				},
-			})
-			return
+// boardStateResponse is the GetBoard payload: the frontend board state as
+// userID may see it, its name, export policy and what userID may do on it,
+// plus the running facilitated session, if any
+func boardStateResponse(board *models.Board, userID primitive.ObjectID) gin.H {
+	response := gin.H{
+		"name":         boardDisplayName(board.Name, board.BoardID),
+		"description":  board.Description,
+		"board":        libs.VisibleBoardData(board.BoardData, userID),
+		"version":      board.Version,
+		"exportPolicy": exportPolicy(board.ExportPolicy),
+		"capabilities": libs.BoardCapabilities(board, userID),
+	}
+	if board.Facilitation != nil {
+		response["facilitation"] = board.Facilitation
+	}
+	if freeze := libs.FreezeStatus(board.Freeze, time.Now()); freeze != nil {
+		response["freeze"] = freeze
+	}
+	return response
+}
+
+// boardETag formats a board version as an ETag
+func boardETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// etagMatches reports whether an If-None-Match header names etag. Weak
+// comparison, as for GET requests.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to retrieve board: " + err.Error(),
-		})
-		return
 	}
+	return false
+}
 
-	// Return the complete board data including the frontend state
-	c.JSON(http.StatusOK, gin.H{
-		"board": board.BoardData,
-	})
+// expectedBoardVersion returns the board version the client last loaded,
+// from the If-Match header or else expectedVersion in the body. ok is false
+// when the client sent neither (or If-Match: *), and the save is last write
+// wins.
+func expectedBoardVersion(c *gin.Context, fromBody *int64) (version int64, ok bool, err error) {
+	if header := strings.TrimSpace(c.GetHeader("If-Match")); header != "" {
+		if header == "*" {
+			return 0, false, nil
+		}
+		value := strings.Trim(strings.TrimPrefix(header, "W/"), `"`)
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed < 0 {
+			return 0, false, fmt.Errorf("If-Match must be a board version")
+		}
+		return parsed, true, nil
+	}
+	if fromBody != nil {
+		if *fromBody < 0 {
+			return 0, false, fmt.Errorf("expectedVersion must not be negative")
+		}
+		return *fromBody, true, nil
+	}
+	return 0, false, nil
 }
 
-// GetBoards retrieves all boards available to the authenticated user
+// invalidBoard answers 422 with what is wrong with a board state
+func invalidBoard(c *gin.Context, err error) {
+	c.JSON(http.StatusUnprocessableEntity, invalidBoardBody(err))
+}
+
+// invalidBoardBody is the body of invalidBoard: the error, and each
+// violation with its path
+func invalidBoardBody(err error) gin.H {
+	body := gin.H{"error": err.Error()}
+	var invalid *libs.InvalidBoardError
+	if errors.As(err, &invalid) {
+		body["violations"] = invalid.Violations
+	}
+	return body
+}
+
+// boardConflict answers a save based on an outdated version with 409 and
+// the current state, so the client can merge and retry
+func boardConflict(c *gin.Context, board *models.Board, userID primitive.ObjectID) {
+	c.Header("ETag", boardETag(board.Version))
+	response := boardStateResponse(board, userID)
+	response["error"] = "Board was changed since you loaded it"
+	response["updatedAt"] = board.UpdatedAt
+	c.JSON(http.StatusConflict, response)
+}
+
+// GetBoards retrieves the boards available to the authenticated user, most
+// recently updated first, a page at a time (?limit, default 50). Pass the
+// returned nextCursor back as ?cursor for the next page. ?tag (repeatable),
+// ?folder (a folder ID, or "none" for unfiled boards) and ?starred=true
+// narrow the list; ?fields= picks the fields of each board. Compact mode
+// has smaller pages and leaves out the heavy fields.
 func GetBoards(c *gin.Context) {
 	// Get user ID from JWT context
 	userIDStr := c.GetString("userId")
@@ -357,15 +811,79 @@ func GetBoards(c *gin.Context) {
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	// Compact mode (mobile) uses smaller pages
+	limit, maxLimit := defaultBoardPageSize, maxBoardPageSize
+	if compactMode(c) {
+		limit, maxLimit = compactBoardPageSize, maxCompactBoardPageSize
+	}
+	if value := c.Query("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and " + strconv.Itoa(maxLimit)})
+			return
+		}
+	}
+	fields, ok := responseFields(c, boardListFields, compactBoardListFields)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
 	defer cancel()
 
-	// Find boards where user is owner
-	filter := bson.M{
-		"ownerId": userID,
+	// Find boards the user owns or has been shared, with every given tag and
+	// in the given folder, after the cursor
+	conditions := bson.A{boardAccessFilter(userID)}
+	if tags := libs.NormalizeTags(c.QueryArray("tag")); len(tags) > 0 {
+		conditions = append(conditions, bson.M{"tags": bson.M{"$all": tags}})
+	}
+	switch folder := c.Query("folder"); folder {
+	case "":
+	case "none":
+		conditions = append(conditions, bson.M{"ownerId": userID, "folderId": bson.M{"$exists": false}})
+	default:
+		found, err := libs.FindFolder(ctx, folder, userID)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Folder not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve folder: " + err.Error()})
+			return
+		}
+		conditions = append(conditions, bson.M{"ownerId": userID, "folderId": found.ID})
+	}
+	starredOnly := c.Query("starred") == "true"
+	if starredOnly {
+		starred, err := libs.StarredBoardIDs(ctx, userID, nil)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve starred boards: " + err.Error()})
+			return
+		}
+		conditions = append(conditions, bson.M{"_id": bson.M{"$in": starred}})
+	}
+	if value := c.Query("cursor"); value != "" {
+		updatedAt, lastID, err := decodeBoardCursor(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+			return
+		}
+		conditions = append(conditions, bson.M{"$or": bson.A{
+			bson.M{"updatedAt": bson.M{"$lt": updatedAt}},
+			bson.M{"updatedAt": updatedAt, "_id": bson.M{"$lt": lastID}},
+		}})
+	}
+	filter := conditions[0].(bson.M)
+	if len(conditions) > 1 {
+		filter = bson.M{"$and": conditions}
 	}
 
-	cursor, err := getBoardCollection().Find(ctx, filter, options.Find().SetSort(bson.M{"updatedAt": -1}))
+	// One extra board tells whether there is another page. Lists read the
+	// summaries, never the boards themselves.
+	opts := options.Find().
+		SetSort(bson.D{{Key: "updatedAt", Value: -1}, {Key: "_id", Value: -1}}).
+		SetLimit(int64(limit + 1))
+	cursor, err := getBoardSummaryCollection().Find(ctx, filter, opts)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to retrieve boards: " + err.Error(),
@@ -374,7 +892,7 @@ func GetBoards(c *gin.Context) {
 	}
 	defer cursor.Close(ctx)
 
-	var boards []models.Board
+	var boards []models.BoardSummary
 	if err = cursor.All(ctx, &boards); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to decode boards: " + err.Error(),
@@ -382,18 +900,91 @@ func GetBoards(c *gin.Context) {
 		return
 	}
 
-	// Convert to frontend format
-	var frontendBoards []models.FrontendBoard
-	for _, board := range boards {
-		frontendBoards = append(frontendBoards, transformBoardToFrontend(&board))
+	hasMore := len(boards) > limit
+	if hasMore {
+		boards = boards[:limit]
+	}
+
+	// Mark the boards on this page the user starred
+	starred := map[primitive.ObjectID]bool{}
+	if len(boards) > 0 {
+		ids := make([]primitive.ObjectID, len(boards))
+		for i, board := range boards {
+			ids[i] = board.ID
+		}
+		starredIDs, err := libs.StarredBoardIDs(ctx, userID, ids)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve starred boards: " + err.Error()})
+			return
+		}
+		for _, id := range starredIDs {
+			starred[id] = true
+		}
+	}
+
+	// Convert to frontend format, with only the fields asked for
+	converted := make([]models.FrontendBoard, len(boards))
+	for i := range boards {
+		converted[i] = transformSummaryToFrontend(&boards[i])
+		converted[i].Starred = starredOnly || starred[boards[i].ID]
+	}
+	withCollaboratorProfiles(ctx, c, converted)
+	frontendBoards := []interface{}{}
+	for _, frontendBoard := range converted {
+		if fields == nil {
+			frontendBoards = append(frontendBoards, frontendBoard)
+			continue
+		}
+		picked, err := pickFields(frontendBoard, fields)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encode boards: " + err.Error()})
+			return
+		}
+		frontendBoards = append(frontendBoards, picked)
+	}
+
+	nextCursor := ""
+	if hasMore {
+		last := boards[len(boards)-1]
+		nextCursor = encodeBoardCursor(last.UpdatedAt, last.ID)
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"boards": frontendBoards,
+		"boards":     frontendBoards,
+		"nextCursor": nextCursor,
+		"hasMore":    hasMore,
 	})
 }
 
-// DeleteBoard deletes a board for the authenticated user
+// encodeBoardCursor makes the opaque cursor for the page after a board, in
+// the board list's updatedAt, _id order
+func encodeBoardCursor(updatedAt time.Time, id primitive.ObjectID) string {
+	raw := strconv.FormatInt(updatedAt.UnixMilli(), 10) + ":" + id.Hex()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeBoardCursor(cursor string) (time.Time, primitive.ObjectID, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, primitive.NilObjectID, err
+	}
+	millis, idHex, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return time.Time{}, primitive.NilObjectID, fmt.Errorf("malformed cursor")
+	}
+	unixMilli, err := strconv.ParseInt(millis, 10, 64)
+	if err != nil {
+		return time.Time{}, primitive.NilObjectID, err
+	}
+	id, err := primitive.ObjectIDFromHex(idHex)
+	if err != nil {
+		return time.Time{}, primitive.NilObjectID, err
+	}
+	return time.UnixMilli(unixMilli).UTC(), id, nil
+}
+
+// DeleteBoard deletes a board for the authenticated user, or schedules its
+// deletion once the grace period is over (see libs.DeletionGracePeriod)
 func DeleteBoard(c *gin.Context) {
 	userIDStr := c.GetString("userId")
 	boardIDStr := c.Param("boardId")
@@ -411,33 +1002,13 @@ func DeleteBoard(c *gin.Context) {
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := libs.DBContext(c)
 	defer cancel()
 
-	// Try to parse the board ID as an ObjectID first (for MongoDB ObjectID format)
-	boardObjectID, err := primitive.ObjectIDFromHex(boardIDStr)
-	var boardFilter bson.M
-
-	if err == nil {
-		// Board ID is a valid ObjectID, search by _id
-		boardFilter = bson.M{
-			"_id":     boardObjectID,
-			"ownerId": userID,
-		}
-	} else {
-		// If not a valid ObjectID, try searching by boardId field (for string board IDs)
-		boardFilter = bson.M{
-			"boardId": boardIDStr,
-			"ownerId": userID,
-		}
-	}
-
 	// Find the board to ensure it exists and belongs to the user
-	var board models.Board
-	err = getBoardCollection().FindOne(ctx, boardFilter).Decode(&board)
-
+	board, err := libs.BoardRepository(c).FindOwned(ctx, boardIDStr, userID)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
+		if errors.Is(err, repository.ErrNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Board not found or access denied"})
 			return
 		}
@@ -445,16 +1016,165 @@ func DeleteBoard(c *gin.Context) {
 		return
 	}
 
-	// Delete the board
-	_, err = getBoardCollection().DeleteOne(ctx, boardFilter)
-
+	// Boards under legal hold cannot be deleted
+	onHold, err := libs.IsBoardUnderLegalHold(ctx, board.ID, board.OwnerID)
 	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check legal hold"})
+		return
+	}
+	if onHold {
+		c.JSON(http.StatusLocked, gin.H{"error": "Board is under legal hold and cannot be deleted"})
+		return
+	}
+
+	// With a grace period, the owner is emailed to cancel it or delete it now
+	if libs.DeletionGracePeriod() > 0 {
+		deletion, err := scheduleBoardDeletion(ctx, c, board, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to schedule board deletion"})
+			return
+		}
+		c.JSON(http.StatusAccepted, gin.H{
+			"message":  "Board scheduled for deletion",
+			"boardId":  boardIDStr,
+			"deletion": deletion,
+		})
+		return
+	}
+
+	// Delete the board
+	if err := libs.BoardRepository(c).Delete(ctx, board.ID); err != nil && !errors.Is(err, repository.ErrNotFound) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete board"})
 		return
 	}
+	boardDeleted(ctx, c, board, userID)
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Board deleted successfully",
 		"boardId": boardIDStr,
 	})
 }
+
+// boardDeleted cleans up after a deleted board and records the deletion
+func boardDeleted(ctx context.Context, c *gin.Context, board *models.Board, userID primitive.ObjectID) {
+	cleanUpBoard(ctx, libs.RequestLogger(c), board, userID)
+
+	recordAudit(c, models.AuditBoardDeleted, models.AuditTargetBoard, board.ID.Hex(), map[string]interface{}{
+		"ownerId": board.OwnerID.Hex(),
+	})
+	libs.RecordActivity(libs.RequestContext(c), board, userID, models.ActivityBoardDeleted, nil)
+}
+
+// cleanUpBoard removes what is stored alongside a deleted board, and its
+// caches and summary. Plugins are told in the background, past ctx.
+func cleanUpBoard(ctx context.Context, logger *slog.Logger, board *models.Board, userID primitive.ObjectID) {
+	boardChanged(ctx, board.ID)
+	plugins.Emit(context.WithoutCancel(ctx), board, plugins.EventBoardDeleted, userID)
+	if err := libs.DeleteBoardVersions(ctx, board.ID); err != nil {
+		logger.Warn("Failed to delete versions of board", "board_id", board.ID.Hex(), "error", err)
+	}
+	if err := libs.DeleteBoardFavorites(ctx, board.ID); err != nil {
+		logger.Warn("Failed to delete stars of board", "board_id", board.ID.Hex(), "error", err)
+	}
+	if err := libs.DeleteBoardSectionStates(ctx, board.ID); err != nil {
+		logger.Warn("Failed to delete section states of board", "board_id", board.ID.Hex(), "error", err)
+	}
+	if err := libs.DeleteBoardThumbnails(ctx, board.ID); err != nil {
+		logger.Warn("Failed to delete thumbnails of board", "board_id", board.ID.Hex(), "error", err)
+	}
+	if err := libs.DeleteBoardAssets(ctx, board.ID); err != nil {
+		logger.Warn("Failed to delete assets of board", "board_id", board.ID.Hex(), "error", err)
+	}
+	if err := libs.DeleteBoardShapeIndex(ctx, board.ID); err != nil {
+		logger.Warn("Failed to delete shape index of board", "board_id", board.ID.Hex(), "error", err)
+	}
+	libs.ForgetShapeTree(board.ID)
+	libs.ForgetBoardTiles(board.ID)
+}
+
+// PatchBoardMeta changes a board's name, description, tags or folder
+// without resending its contents. Owners and editors only; the folder is one
+// of the owner's, so only they can move the board.
+func PatchBoardMeta(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req models.BoardMetaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+	set := boardMetaUpdate(req.Name, req.Description)
+	if req.Tags != nil {
+		set["tags"] = libs.NormalizeTags(*req.Tags)
+	}
+	if len(set) == 0 && req.FolderID == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name, description, tags or folderId is required"})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	board, ok := findVisibleBoard(ctx, c, libs.BoardRepository(c).WithoutContents(), userID)
+	if !ok || !requireBoardEditor(c, board, userID) {
+		return
+	}
+
+	if req.FolderID != nil {
+		if board.OwnerID != userID {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only the board owner can move it to a folder"})
+			return
+		}
+		if *req.FolderID == "" {
+			set["folderId"] = nil
+		} else {
+			folder, err := libs.FindFolder(ctx, *req.FolderID, userID)
+			if err != nil {
+				if err == mongo.ErrNoDocuments {
+					c.JSON(http.StatusNotFound, gin.H{"error": "Folder not found"})
+					return
+				}
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve folder: " + err.Error()})
+				return
+			}
+			set["folderId"] = folder.ID
+		}
+	}
+
+	// Metadata isn't board content, so the version stays the same
+	set["updatedAt"] = time.Now()
+	boards := libs.BoardRepository(c).WithoutContents()
+	err = boards.Update(ctx, board.ID, set)
+	if err == nil {
+		board, err = boards.FindByID(ctx, board.ID)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update board: " + err.Error()})
+		return
+	}
+	libs.InvalidateBoard(ctx, board.ID)
+	libs.RefreshBoardSummary(libs.RequestContext(c), board.ID, nil)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Board updated successfully",
+		"board":   transformBoardToFrontend(board),
+	})
+}
+
+// boardMetaUpdate is the $set for the metadata fields a request gave
+func boardMetaUpdate(name, description *string) bson.M {
+	set := bson.M{}
+	if name != nil {
+		set["name"] = strings.TrimSpace(*name)
+	}
+	if description != nil {
+		set["description"] = strings.TrimSpace(*description)
+	}
+	return set
+}
@@ -0,0 +1,40 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// GetBoardHealth reports the board's size and complexity against the limits
+// it runs into, with warnings once it should be split
+func GetBoardHealth(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	board, ok := findVisibleBoard(ctx, c, libs.BoardRepository(c), userID)
+	if !ok {
+		return
+	}
+
+	usage, err := libs.GetQuotaUsage(ctx, board.OwnerID, primitive.NilObjectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check quota: " + err.Error()})
+		return
+	}
+	versions, err := libs.CountBoardVersions(ctx, board.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count versions: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"health": libs.BoardHealth(board, usage.StorageBytes, versions)})
+}
@@ -0,0 +1,172 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"github.com/sarwanazhar/boardsar/backend/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CreateEmbedToken issues a short-lived token that shows the board, or one
+// frame of it, read-only, on pages of one origin. The token is only
+// returned here. Owner only.
+func CreateEmbedToken(c *gin.Context) {
+	type Body struct {
+		Origin    string `json:"origin" binding:"required"`
+		ExpiresIn int64  `json:"expiresIn" binding:"gte=0"` // Seconds
+		FrameID   string `json:"frameId" binding:"max=200"`
+	}
+
+	var body Body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ttl := libs.DefaultEmbedTokenTTL
+	if body.ExpiresIn > 0 {
+		ttl = time.Duration(body.ExpiresIn) * time.Second
+	}
+	if ttl > libs.MaxEmbedTokenTTL {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expiresIn can be at most 86400 seconds"})
+		return
+	}
+
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	board, ok := findOwnedBoard(ctx, c, userID)
+	if !ok {
+		return
+	}
+	if body.FrameID != "" && libs.FindFrame(board.BoardData, body.FrameID) == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Frame " + body.FrameID + " not found"})
+		return
+	}
+
+	embed, token, err := libs.IssueEmbedToken(ctx, board.ID, userID, body.Origin, body.FrameID, ttl)
+	if err == libs.ErrInvalidEmbedOrigin {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to issue embed token for board", "board_id", board.ID.Hex(), "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+		return
+	}
+
+	details := map[string]interface{}{
+		"tokenId": embed.ID,
+		"origin":  embed.Origin,
+	}
+	if embed.FrameID != "" {
+		details["frameId"] = embed.FrameID
+	}
+	recordAudit(c, models.AuditEmbedTokenCreated, models.AuditTargetBoard, board.ID.Hex(), details)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"embedToken": embed,
+		"token":      token,
+		"url":        libs.APIURL() + "/embed/" + board.ID.Hex() + "?token=" + token,
+	})
+}
+
+// GetEmbedTokens lists the board's embed tokens that still work. Owner
+// only.
+func GetEmbedTokens(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	board, ok := findOwnedBoard(ctx, c, userID)
+	if !ok {
+		return
+	}
+
+	tokens, err := libs.ListEmbedTokens(ctx, board.ID)
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to list embed tokens for board", "board_id", board.ID.Hex(), "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"embedTokens": tokens})
+}
+
+// RevokeEmbedToken stops an embed token from working. Owner only.
+func RevokeEmbedToken(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	board, ok := findOwnedBoard(ctx, c, userID)
+	if !ok {
+		return
+	}
+
+	embed, err := libs.RevokeEmbedToken(ctx, board.ID, c.Param("tokenId"))
+	if err == libs.ErrEmbedTokenNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to revoke embed token", "token_id", c.Param("tokenId"), "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+		return
+	}
+
+	recordAudit(c, models.AuditEmbedTokenRevoked, models.AuditTargetBoard, board.ID.Hex(), map[string]interface{}{
+		"tokenId": embed.ID,
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Embed token revoked", "embedToken": embed})
+}
+
+// GetTokenBoard returns the board a guest or embed token grants, read-only
+// and without anyone's private notes, or just the frame the token is for.
+// BoardTokenMiddleware has checked the token.
+func GetTokenBoard(c *gin.Context) {
+	claims := c.MustGet("boardToken").(*models.BoardTokenClaims)
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	board, err := libs.BoardRepository(c).FindByID(ctx, claims.BoardID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Board not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve board: " + err.Error()})
+		return
+	}
+
+	response := boardStateResponse(board, primitive.NilObjectID)
+	if !scopeToFrame(c, response, claims.FrameID) {
+		return
+	}
+	response["boardId"] = board.ID.Hex()
+	response["role"] = models.CollaboratorRoleViewer
+	response["expiresAt"] = claims.ExpiresAt
+	c.JSON(http.StatusOK, response)
+}
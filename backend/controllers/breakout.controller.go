@@ -0,0 +1,359 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"github.com/sarwanazhar/boardsar/backend/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// breakoutShapeKey marks shapes merged back into the parent with the
+// breakout they came from
+const breakoutShapeKey = "breakoutBoardId"
+
+// CreateBreakouts spawns one linked breakout board per group from a parent
+// board, shared with the group's participants as editors. Owner only.
+func CreateBreakouts(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req models.BreakoutRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	parent, ok := findOwnedBoard(ctx, c, userID)
+	if !ok {
+		return
+	}
+
+	// Resolve every participant before creating anything
+	groups := make([][]models.Collaborator, len(req.Groups))
+	for i, group := range req.Groups {
+		seen := map[primitive.ObjectID]bool{}
+		for _, participant := range group.Participants {
+			user, err := findParticipant(ctx, participant)
+			if err != nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": "User not found: " + participant})
+				return
+			}
+			if user.ID == userID || seen[user.ID] {
+				continue
+			}
+			seen[user.ID] = true
+			groups[i] = append(groups[i], models.Collaborator{
+				UserID: user.ID,
+				Role:   models.CollaboratorRoleEditor,
+			})
+		}
+	}
+
+	seed := breakoutSeed(parent, userID, req)
+
+	usage, err := libs.GetQuotaUsage(ctx, userID, primitive.NilObjectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check quota: " + err.Error()})
+		return
+	}
+	count := int64(len(groups))
+	warnings, quotaErr := libs.ApplyQuota(c, usage, count, count*libs.BoardDataSize(seed))
+	if quotaErr != "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": quotaErr})
+		return
+	}
+
+	now := time.Now()
+	boards := make([]models.Board, 0, len(groups))
+	for i, collaborators := range groups {
+		board := models.Board{
+			ID:         primitive.NewObjectID(),
+			BoardID:    uuid.New().String(),
+			Name:       fmt.Sprintf("%s (breakout %d)", boardDisplayName(parent.Name, parent.BoardID), i+1),
+			OwnerID:    userID,
+			BoardData:  seed,
+			SharedWith: collaborators,
+			ParentID:   &parent.ID,
+			Version:    1,
+			CreatedAt:  now,
+			UpdatedAt:  now,
+		}
+		boards = append(boards, board)
+	}
+
+	if err := libs.BoardRepository(c).CreateMany(ctx, boards); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create breakout boards: " + err.Error()})
+		return
+	}
+
+	breakouts := []models.FrontendBoard{}
+	for i := range boards {
+		libs.RefreshBoardSummary(libs.RequestContext(c), boards[i].ID, boards[i].BoardData)
+		breakouts = append(breakouts, transformBoardToFrontend(&boards[i]))
+	}
+
+	response := gin.H{
+		"message":   "Breakout boards created",
+		"breakouts": breakouts,
+	}
+	if len(warnings) > 0 {
+		response["warnings"] = warnings
+	}
+	c.JSON(http.StatusCreated, response)
+}
+
+// GetBreakouts lists the breakout boards of a parent board. Owners see all
+// of them; participants see the ones they were assigned to.
+func GetBreakouts(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	boards := libs.BoardRepository(c).WithoutContents()
+	parent, ok := findVisibleBoard(ctx, c, boards, userID)
+	if !ok {
+		return
+	}
+
+	found, err := boards.ListBreakouts(ctx, parent.ID, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve breakout boards: " + err.Error()})
+		return
+	}
+
+	breakouts := []models.FrontendBoard{}
+	for i := range found {
+		breakouts = append(breakouts, transformBoardToFrontend(&found[i]))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"breakouts": breakouts,
+		"count":     len(breakouts),
+	})
+}
+
+// MergeBreakouts copies selected shapes from breakout boards into the parent
+// board. Merged shapes get new IDs and remember their breakout. Unrevealed
+// private notes stay behind. Owner only.
+func MergeBreakouts(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req models.MergeBreakoutsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	parent, ok := findOwnedBoard(ctx, c, userID)
+	if !ok {
+		return
+	}
+
+	chosen := map[primitive.ObjectID]bool{}
+	for _, id := range req.BoardIDs {
+		objectID, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid breakout board ID: " + id})
+			return
+		}
+		chosen[objectID] = true
+	}
+
+	boards := libs.BoardRepository(c)
+	found, err := boards.ListBreakouts(ctx, parent.ID, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve breakout boards: " + err.Error()})
+		return
+	}
+	var breakouts []models.Board
+	for _, breakout := range found {
+		if breakout.OwnerID != userID || (len(chosen) > 0 && !chosen[breakout.ID]) {
+			continue
+		}
+		if breakout.Archived != nil {
+			rehydrated, err := findRehydratedBoard(ctx, boards, breakout.ID)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve breakout boards: " + err.Error()})
+				return
+			}
+			breakout = *rehydrated
+		}
+		breakouts = append(breakouts, breakout)
+	}
+	if len(breakouts) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No breakout boards to merge"})
+		return
+	}
+
+	selected := map[string]bool{}
+	for _, id := range req.ShapeIDs {
+		selected[id] = true
+	}
+
+	current, _ := libs.ShapeList(parent.BoardData)
+	shapes := append([]interface{}{}, current...)
+	merged := 0
+	for _, breakout := range breakouts {
+		list, _ := libs.ShapeList(breakout.BoardData)
+		for _, item := range list {
+			shape, ok := item.(map[string]interface{})
+			if !ok || shape[libs.ShapeHiddenKey] == true {
+				continue
+			}
+			if id, _ := shape["id"].(string); len(selected) > 0 && !selected[id] {
+				continue
+			}
+
+			copied := make(map[string]interface{}, len(shape)+1)
+			for key, value := range shape {
+				copied[key] = value
+			}
+			delete(copied, libs.ShapeAuthorKey)
+			copied["id"] = uuid.New().String()
+			copied[breakoutShapeKey] = breakout.ID.Hex()
+			shapes = append(shapes, copied)
+			merged++
+		}
+	}
+
+	if merged == 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Nothing to merge",
+			"merged":  0,
+		})
+		return
+	}
+
+	next := make(map[string]interface{}, len(parent.BoardData)+1)
+	for key, value := range parent.BoardData {
+		next[key] = value
+	}
+	next["shapes"] = shapes
+
+	size := libs.BoardDataSize(next)
+	if err := libs.CheckBoardSize(size); err != nil {
+		invalidBoard(c, err)
+		return
+	}
+
+	usage, err := libs.GetQuotaUsage(ctx, userID, parent.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check quota: " + err.Error()})
+		return
+	}
+	warnings, quotaErr := libs.ApplyQuota(c, usage, 0, size)
+	if quotaErr != "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": quotaErr})
+		return
+	}
+
+	backup, ok := backupBeforeOperation(ctx, c, parent, userID, models.BackupBeforeMerge)
+	if !ok {
+		return
+	}
+
+	err = boards.SaveContents(ctx, parent.ID, repository.AnyVersion, 1, next, map[string]interface{}{"updatedAt": time.Now()})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to merge breakout boards: " + err.Error()})
+		return
+	}
+	boardChanged(ctx, parent.ID)
+	libs.RecordStoredBoardVersion(libs.RequestContext(c), parent.ID, userID)
+	libs.RefreshBoardSummary(libs.RequestContext(c), parent.ID, next)
+
+	response := gin.H{
+		"message": "Breakout boards merged",
+		"merged":  merged,
+		"board":   libs.VisibleBoardData(next, userID),
+		"backup":  backupResponse(parent, backup),
+	}
+	if len(warnings) > 0 {
+		response["warnings"] = warnings
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// findOwnedBoard loads the board in the boardId param if userID owns it,
+// writing the error response otherwise
+func findOwnedBoard(ctx context.Context, c *gin.Context, userID primitive.ObjectID) (*models.Board, bool) {
+	board, err := libs.BoardRepository(c).FindOwned(ctx, c.Param("boardId"), userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Board not found or access denied"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve board: " + err.Error()})
+		return nil, false
+	}
+	return board, true
+}
+
+// findParticipant resolves a participant given by user ID or email
+func findParticipant(ctx context.Context, participant string) (*models.User, error) {
+	participant = strings.TrimSpace(participant)
+	if _, err := primitive.ObjectIDFromHex(participant); err == nil {
+		return libs.FindUserByID(ctx, participant)
+	}
+	return libs.FindUserByEmail(ctx, participant)
+}
+
+// breakoutSeed builds the starting state of a breakout board from the
+// parent's viewport and the selected parent shapes
+func breakoutSeed(parent *models.Board, userID primitive.ObjectID, req models.BreakoutRequest) map[string]interface{} {
+	visible := libs.VisibleBoardData(parent.BoardData, userID)
+
+	seed := make(map[string]interface{}, len(visible))
+	for key, value := range visible {
+		seed[key] = value
+	}
+
+	selected := map[string]bool{}
+	for _, id := range req.ShapeIDs {
+		selected[id] = true
+	}
+
+	list, _ := libs.ShapeList(visible)
+	shapes := []interface{}{}
+	for _, item := range list {
+		shape, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if id, _ := shape["id"].(string); req.CopyAll || selected[id] {
+			shapes = append(shapes, shape)
+		}
+	}
+	seed["shapes"] = shapes
+	return seed
+}
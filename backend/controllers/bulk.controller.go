@@ -0,0 +1,264 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"github.com/sarwanazhar/boardsar/backend/realtime"
+	"github.com/sarwanazhar/boardsar/backend/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// maxBoardTags is as many tags as a board can have, as PATCH /meta allows
+const maxBoardTags = 20
+
+// BulkBoards applies delete, archive, move and tag operations to many
+// boards at once. Each operation is checked as its single-board endpoint
+// checks it and reported on its own, in order; one failing leaves the rest
+// alone. Deletes, moves and tags are written in one bulk write, while
+// archiving moves each board's contents to cold storage in turn. With a
+// deletion grace period, deletes are scheduled instead.
+func BulkBoards(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req models.BulkBoardRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	boards, err := findBulkBoards(ctx, libs.BoardRepository(c), req.Operations, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve boards: " + err.Error()})
+		return
+	}
+
+	results := make([]models.BulkBoardResult, len(req.Operations))
+	targets := make([]*models.Board, len(req.Operations))
+	var writes []repository.BoardWrite
+	var written []int // Operation of each write
+	var archives []int
+	var scheduled []int // Deletes left for the grace period
+	graced := libs.DeletionGracePeriod() > 0
+	seen := map[primitive.ObjectID]bool{}
+	folders := map[string]*models.Folder{}
+	for i := range req.Operations {
+		op := &req.Operations[i]
+		results[i] = models.BulkBoardResult{Index: i, Op: op.Op, BoardID: op.BoardID, Status: http.StatusOK}
+
+		board := boards[op.BoardID]
+		switch {
+		case board == nil:
+			results[i].Status, results[i].Error = http.StatusNotFound, "Board not found or access denied"
+			continue
+		case seen[board.ID]:
+			results[i].Status, results[i].Error = http.StatusBadRequest, "The board has another operation in this request"
+			continue
+		}
+		seen[board.ID] = true
+		targets[i] = board
+
+		write, status, message := prepareBulkOperation(ctx, op, board, userID, folders)
+		if status != 0 {
+			results[i].Status, results[i].Error = status, message
+			continue
+		}
+		if write == nil {
+			archives = append(archives, i)
+			continue
+		}
+		if op.Op == models.BulkBoardDelete && graced {
+			scheduled = append(scheduled, i)
+			continue
+		}
+		writes = append(writes, *write)
+		written = append(written, i)
+	}
+
+	if len(writes) > 0 {
+		errs, err := libs.BoardRepository(c).BulkWrite(ctx, writes)
+		if err != nil {
+			libs.RequestLogger(c).Error("Failed to write bulk board operations", "error", err)
+		}
+		for n, i := range written {
+			if err != nil || errs[n] != nil {
+				results[i].Status, results[i].Error = http.StatusInternalServerError, "Failed to update board"
+			}
+		}
+	}
+
+	for _, i := range written {
+		if results[i].Status != http.StatusOK {
+			continue
+		}
+		board := targets[i]
+		if req.Operations[i].Op == models.BulkBoardDelete {
+			// Each board's cleanup gets its own time
+			boardCtx, cancel := libs.DBContext(c)
+			boardDeleted(boardCtx, c, board, userID)
+			cancel()
+			continue
+		}
+		libs.InvalidateBoard(ctx, board.ID)
+		libs.RefreshBoardSummary(libs.RequestContext(c), board.ID, nil)
+	}
+
+	for _, i := range scheduled {
+		board := targets[i]
+		deletion, err := scheduleBoardDeletion(ctx, c, board, userID)
+		if err != nil {
+			results[i].Status, results[i].Error = http.StatusInternalServerError, "Failed to schedule board deletion"
+			continue
+		}
+		results[i].Status = http.StatusAccepted
+		results[i].DeleteAt = &deletion.DeleteAt
+	}
+
+	for _, i := range archives {
+		board := targets[i]
+		if err := libs.ArchiveBoard(libs.RequestContext(c), board.ID); err != nil {
+			libs.RequestLogger(c).Error("Failed to archive board", "board_id", board.ID.Hex(), "error", err)
+			results[i].Status, results[i].Error = http.StatusInternalServerError, "Failed to archive board"
+		}
+	}
+
+	succeeded := 0
+	for _, result := range results {
+		if result.Status == http.StatusOK || result.Status == http.StatusAccepted {
+			succeeded++
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"results":   results,
+		"succeeded": succeeded,
+		"failed":    len(results) - succeeded,
+	})
+}
+
+// findBulkBoards loads, in one query, the boards of a bulk request the user
+// can see, by the references the operations give
+func findBulkBoards(ctx context.Context, repo repository.BoardRepository, operations []models.BulkBoardOperation, userID primitive.ObjectID) (map[string]*models.Board, error) {
+	refs := make([]string, 0, len(operations))
+	for _, op := range operations {
+		refs = append(refs, op.BoardID)
+	}
+	boards, err := repo.WithoutContents().ListForUser(ctx, refs, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[primitive.ObjectID]*models.Board, len(boards))
+	byBoardID := make(map[string]*models.Board, len(boards))
+	for i := range boards {
+		byID[boards[i].ID] = &boards[i]
+		byBoardID[boards[i].BoardID] = &boards[i]
+	}
+	found := make(map[string]*models.Board, len(operations))
+	for _, op := range operations {
+		if id, err := primitive.ObjectIDFromHex(op.BoardID); err == nil {
+			found[op.BoardID] = byID[id]
+		} else {
+			found[op.BoardID] = byBoardID[op.BoardID]
+		}
+	}
+	return found, nil
+}
+
+// prepareBulkOperation checks one operation of a bulk request against the
+// board and returns its write, or nil for archiving, which isn't part of
+// the bulk write. A status other than 0 is why the operation can't run.
+func prepareBulkOperation(ctx context.Context, op *models.BulkBoardOperation, board *models.Board, userID primitive.ObjectID, folders map[string]*models.Folder) (*repository.BoardWrite, int, string) {
+	owner := board.OwnerID == userID
+
+	switch op.Op {
+	case models.BulkBoardDelete:
+		if !owner {
+			return nil, http.StatusForbidden, "Only the board owner can delete it"
+		}
+		onHold, err := libs.IsBoardUnderLegalHold(ctx, board.ID, board.OwnerID)
+		if err != nil {
+			return nil, http.StatusInternalServerError, "Failed to check legal hold"
+		}
+		if onHold {
+			return nil, http.StatusLocked, "Board is under legal hold and cannot be deleted"
+		}
+		return &repository.BoardWrite{ID: board.ID, Delete: true}, 0, ""
+
+	case models.BulkBoardArchive:
+		if !owner {
+			return nil, http.StatusForbidden, "Only the board owner can archive it"
+		}
+		// A live session would save the contents back over the archive
+		if realtime.DefaultHub.Open(board.ID) {
+			return nil, http.StatusConflict, "The board is open; it can be archived once everyone has left"
+		}
+		return nil, 0, ""
+
+	case models.BulkBoardMove:
+		if op.FolderID == nil {
+			return nil, http.StatusBadRequest, "folderId is required"
+		}
+		if !owner {
+			return nil, http.StatusForbidden, "Only the board owner can move it to a folder"
+		}
+		fields := map[string]interface{}{"updatedAt": time.Now()}
+		if *op.FolderID == "" {
+			fields["folderId"] = nil
+		} else {
+			folder, ok := folders[*op.FolderID]
+			if !ok {
+				var err error
+				folder, err = libs.FindFolder(ctx, *op.FolderID, userID)
+				if err != nil && err != mongo.ErrNoDocuments {
+					return nil, http.StatusInternalServerError, "Failed to retrieve folder"
+				}
+				folders[*op.FolderID] = folder
+			}
+			if folder == nil {
+				return nil, http.StatusNotFound, "Folder not found"
+			}
+			fields["folderId"] = folder.ID
+		}
+		return &repository.BoardWrite{ID: board.ID, Fields: fields}, 0, ""
+
+	case models.BulkBoardTag:
+		if len(op.AddTags) == 0 && len(op.RemoveTags) == 0 {
+			return nil, http.StatusBadRequest, "addTags or removeTags is required"
+		}
+		role := libs.BoardRole(board, userID)
+		if role != models.BoardRoleOwner && role != models.CollaboratorRoleEditor {
+			return nil, http.StatusForbidden, "You have view-only access to this board"
+		}
+		removed := map[string]bool{}
+		for _, tag := range libs.NormalizeTags(op.RemoveTags) {
+			removed[tag] = true
+		}
+		tags := []string{}
+		for _, tag := range libs.NormalizeTags(append(append([]string{}, board.Tags...), op.AddTags...)) {
+			if !removed[tag] {
+				tags = append(tags, tag)
+			}
+		}
+		if len(tags) > maxBoardTags {
+			return nil, http.StatusBadRequest, fmt.Sprintf("Boards can have at most %d tags", maxBoardTags)
+		}
+		fields := map[string]interface{}{"tags": tags, "updatedAt": time.Now()}
+		return &repository.BoardWrite{ID: board.ID, Fields: fields}, 0, ""
+	}
+	return nil, http.StatusBadRequest, "Unknown operation " + op.Op
+}
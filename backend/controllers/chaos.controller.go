@@ -0,0 +1,41 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+)
+
+// GetChaosRules lists the active fault injection rules (dev only)
+func GetChaosRules(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"rules": libs.GetChaosRules(),
+	})
+}
+
+// SetChaosRule adds or replaces the fault injection rule for a route (dev only)
+func SetChaosRule(c *gin.Context) {
+	var rule libs.ChaosRule
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+
+	libs.SetChaosRule(rule)
+
+	c.JSON(http.StatusOK, gin.H{
+		"rule": rule,
+	})
+}
+
+// ClearChaosRules removes all fault injection rules (dev only)
+func ClearChaosRules(c *gin.Context) {
+	libs.ClearChaosRules()
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Chaos rules cleared",
+	})
+}
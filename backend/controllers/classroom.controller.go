@@ -0,0 +1,415 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"github.com/sarwanazhar/boardsar/backend/plugins"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// CreateClassroom starts a classroom from a template and a roster of
+// student emails: every student with an account gets their own board from
+// the template, owned by the teacher and shared with the student alone
+func CreateClassroom(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req models.ClassroomRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+		return
+	}
+	emails, ok := parseRoster(c, req.Emails, req.Roster)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	template, err := libs.FindTemplate(ctx, req.TemplateID, userID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve template: " + err.Error()})
+		return
+	}
+
+	now := time.Now()
+	classroom := models.Classroom{
+		ID:         primitive.NewObjectID(),
+		OwnerID:    userID,
+		Name:       name,
+		TemplateID: template.ID,
+		Students:   []models.ClassroomStudent{},
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	results, students, warnings, ok := createStudentBoards(ctx, c, userID, &classroom, template, emails)
+	if !ok {
+		return
+	}
+	classroom.Students = students
+
+	if _, err := libs.GetClassroomCollection().InsertOne(ctx, classroom); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create classroom: " + err.Error()})
+		return
+	}
+
+	response := gin.H{
+		"message":   "Classroom created",
+		"classroom": classroom,
+		"results":   results,
+	}
+	if len(warnings) > 0 {
+		response["warnings"] = warnings
+	}
+	c.JSON(http.StatusCreated, response)
+}
+
+// GetClassrooms lists the teacher's classrooms
+func GetClassrooms(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	classrooms, err := libs.ListClassrooms(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve classrooms: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"classrooms": classrooms, "count": len(classrooms)})
+}
+
+// AddClassroomStudents adds students to a classroom's roster, each with
+// their own board from the classroom's template. Emails already on the
+// roster are skipped.
+func AddClassroomStudents(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req models.RosterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	classroom, ok := findClassroom(ctx, c, userID)
+	if !ok {
+		return
+	}
+	emails, ok := parseRoster(c, req.Emails, req.Roster)
+	if !ok {
+		return
+	}
+
+	template, err := libs.FindTemplate(ctx, classroom.TemplateID.Hex(), userID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusConflict, gin.H{"error": "The classroom's template no longer exists"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve template: " + err.Error()})
+		return
+	}
+
+	results, students, warnings, ok := createStudentBoards(ctx, c, userID, classroom, template, emails)
+	if !ok {
+		return
+	}
+	if len(students) > 0 {
+		if _, err := libs.GetClassroomCollection().UpdateOne(ctx,
+			bson.M{"_id": classroom.ID},
+			bson.M{
+				"$push": bson.M{"students": bson.M{"$each": students}},
+				"$set":  bson.M{"updatedAt": time.Now()},
+			},
+		); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update classroom: " + err.Error()})
+			return
+		}
+		classroom.Students = append(classroom.Students, students...)
+	}
+
+	response := gin.H{
+		"message":   "Roster updated",
+		"classroom": classroom,
+		"results":   results,
+	}
+	if len(warnings) > 0 {
+		response["warnings"] = warnings
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// GetClassroomDashboard summarizes each student's board for the teacher:
+// the board as it is now, what the student has done on it and where its
+// review stands. Students
+// whose boards were deleted are listed without one.
+func GetClassroomDashboard(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	classroom, ok := findClassroom(ctx, c, userID)
+	if !ok {
+		return
+	}
+
+	boardIDs := make([]primitive.ObjectID, 0, len(classroom.Students))
+	for _, student := range classroom.Students {
+		boardIDs = append(boardIDs, student.BoardID)
+	}
+	summaries := map[primitive.ObjectID]models.BoardSummary{}
+	if len(boardIDs) > 0 {
+		cursor, err := getBoardSummaryCollection().Find(ctx, bson.M{"_id": bson.M{"$in": boardIDs}, "ownerId": userID})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve boards: " + err.Error()})
+			return
+		}
+		var boards []models.BoardSummary
+		if err := cursor.All(ctx, &boards); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode boards: " + err.Error()})
+			return
+		}
+		for _, board := range boards {
+			summaries[board.ID] = board
+		}
+	}
+
+	activities, err := libs.StudentActivities(ctx, classroom.Students)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve activity: " + err.Error()})
+		return
+	}
+
+	students := []gin.H{}
+	started := 0
+	reviews := map[string]int{
+		models.ReviewAssigned:  0,
+		models.ReviewSubmitted: 0,
+		models.ReviewInReview:  0,
+		models.ReviewGraded:    0,
+	}
+	for _, student := range classroom.Students {
+		activity := activities[student.BoardID]
+		if activity.Saves > 0 {
+			started++
+		}
+		status := libs.StudentStatus(&student)
+		reviews[status]++
+		entry := gin.H{
+			"userId":   student.UserID.Hex(),
+			"email":    student.Email,
+			"boardId":  student.BoardID.Hex(),
+			"started":  activity.Saves > 0,
+			"activity": activity,
+			"status":   status,
+			"comments": len(student.Comments),
+		}
+		if student.SubmittedAt != nil {
+			entry["submittedAt"] = student.SubmittedAt
+		}
+		if status == models.ReviewGraded {
+			entry["grade"] = student.Grade
+			entry["gradedAt"] = student.GradedAt
+		}
+		if summary, ok := summaries[student.BoardID]; ok {
+			entry["board"] = transformSummaryToFrontend(&summary)
+		}
+		students = append(students, entry)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"classroom": gin.H{
+			"id":         classroom.ID.Hex(),
+			"name":       classroom.Name,
+			"templateId": classroom.TemplateID.Hex(),
+			"createdAt":  classroom.CreatedAt,
+		},
+		"students": students,
+		"counts": gin.H{
+			"students": len(classroom.Students),
+			"started":  started,
+			"review":   reviews,
+		},
+	})
+}
+
+// findClassroom loads the teacher's classroom in the route, answering 404
+// otherwise
+func findClassroom(ctx context.Context, c *gin.Context, userID primitive.ObjectID) (*models.Classroom, bool) {
+	classroom, err := libs.FindClassroom(ctx, c.Param("classroomId"), userID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Classroom not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve classroom: " + err.Error()})
+		return nil, false
+	}
+	return classroom, true
+}
+
+// parseRoster reads the emails of a roster, answering 400 when there are
+// none
+func parseRoster(c *gin.Context, list []string, text string) ([]string, bool) {
+	emails := libs.ParseRoster(list, text)
+	if len(emails) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The roster has no emails"})
+		return nil, false
+	}
+	return emails, true
+}
+
+// createStudentBoards makes a board from the template for every email of a
+// roster that belongs to a student not yet in the classroom, and shares it
+// with them. Emails without an account are reported rather than failing
+// the roster. It answers the request itself on failure.
+func createStudentBoards(ctx context.Context, c *gin.Context, userID primitive.ObjectID, classroom *models.Classroom, template *models.Template, emails []string) ([]models.RosterResult, []models.ClassroomStudent, []string, bool) {
+	// Shape type schemas may have changed since the template was saved
+	if err := libs.ValidateBoardShapes(template.BoardData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Template no longer validates: " + err.Error()})
+		return nil, nil, nil, false
+	}
+	size := libs.BoardDataSize(template.BoardData)
+	if err := libs.CheckBoardSize(size); err != nil {
+		invalidBoard(c, err)
+		return nil, nil, nil, false
+	}
+
+	enrolled := map[primitive.ObjectID]bool{}
+	for _, student := range classroom.Students {
+		enrolled[student.UserID] = true
+	}
+
+	// Resolve the roster before creating anything
+	results := make([]models.RosterResult, len(emails))
+	students := []models.ClassroomStudent{}
+	for i, email := range emails {
+		results[i] = models.RosterResult{Email: email}
+		user, err := libs.FindUserByEmail(ctx, email)
+		switch {
+		case err != nil:
+			results[i].Status = models.RosterStudentNotFound
+			results[i].Error = "No account has this email"
+			continue
+		case user.ID == userID:
+			results[i].Status = models.RosterStudentSkipped
+			results[i].Error = "You are the teacher"
+			continue
+		case enrolled[user.ID]:
+			results[i].Status = models.RosterStudentSkipped
+			results[i].Error = "Already on the roster"
+			continue
+		}
+		enrolled[user.ID] = true
+		students = append(students, models.ClassroomStudent{
+			UserID:  user.ID,
+			Email:   email,
+			BoardID: primitive.NewObjectID(),
+			Status:  models.ReviewAssigned,
+		})
+		results[i].Status = models.RosterStudentAdded
+		results[i].BoardID = students[len(students)-1].BoardID.Hex()
+	}
+	if len(students) == 0 {
+		return results, students, nil, true
+	}
+	if len(classroom.Students)+len(students) > libs.MaxClassroomStudents {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("A classroom can have at most %d students", libs.MaxClassroomStudents),
+		})
+		return nil, nil, nil, false
+	}
+
+	usage, err := libs.GetQuotaUsage(ctx, userID, primitive.NilObjectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check quota: " + err.Error()})
+		return nil, nil, nil, false
+	}
+	count := int64(len(students))
+	warnings, quotaErr := libs.ApplyQuota(c, usage, count, count*size)
+	if quotaErr != "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": quotaErr})
+		return nil, nil, nil, false
+	}
+
+	now := time.Now()
+	boards := make([]models.Board, 0, len(students))
+	for _, student := range students {
+		board := models.Board{
+			ID:          student.BoardID,
+			BoardID:     uuid.New().String(),
+			Name:        fmt.Sprintf("%s (%s)", classroom.Name, student.Email),
+			Description: template.Description,
+			OwnerID:     userID,
+			BoardData:   template.BoardData,
+			SharedWith: []models.Collaborator{{
+				UserID: student.UserID,
+				Role:   models.CollaboratorRoleEditor,
+			}},
+			Version:   1,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		boards = append(boards, board)
+	}
+	if err := libs.BoardRepository(c).CreateMany(ctx, boards); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create student boards: " + err.Error()})
+		return nil, nil, nil, false
+	}
+
+	for i := range boards {
+		board := &boards[i]
+		libs.RefreshBoardSummary(libs.RequestContext(c), board.ID, board.BoardData)
+		recordAudit(c, models.AuditBoardCreated, models.AuditTargetBoard, board.ID.Hex(), map[string]interface{}{
+			"templateId":  template.ID.Hex(),
+			"classroomId": classroom.ID.Hex(),
+		})
+		plugins.Emit(libs.RequestContext(c), board, plugins.EventBoardCreated, userID)
+		libs.RecordBoardVersion(libs.RequestContext(c), board, userID)
+		notifyBoardShared(ctx, board, students[i].UserID, userID, models.CollaboratorRoleEditor)
+	}
+	return results, students, warnings, true
+}
@@ -0,0 +1,166 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"github.com/sarwanazhar/boardsar/backend/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// clusterFramePadding is the space left around notes in a suggested frame
+const clusterFramePadding = 20.0
+
+// ClusterNotes suggests groups of sticky notes with similar text. Notes are
+// compared with embeddings when a provider is configured, falling back to
+// TF-IDF. Nothing is changed on the board; the frontend applies the
+// suggestions as frames.
+func ClusterNotes(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	// The body is optional
+	var req models.ClusterRequest
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+
+	ctx, cancel := libs.DBContextWithin(c, 15*time.Second)
+	defer cancel()
+
+	board, err := libs.BoardRepository(c).FindForUser(ctx, c.Param("boardId"), userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Board not found or access denied"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve board: " + err.Error()})
+		return
+	}
+
+	selected := map[string]bool{}
+	for _, id := range req.ShapeIDs {
+		selected[id] = true
+	}
+
+	// Only notes the user can see, with some text
+	texts := []libs.ClusterText{}
+	shapes := map[string]map[string]interface{}{}
+	list, _ := libs.ShapeList(libs.VisibleBoardData(board.BoardData, userID))
+	for _, item := range list {
+		shape, ok := item.(map[string]interface{})
+		if !ok || !libs.IsNoteShape(shape) {
+			continue
+		}
+		id, _ := shape["id"].(string)
+		text, _ := shape["text"].(string)
+		if id == "" || strings.TrimSpace(text) == "" || (len(selected) > 0 && !selected[id]) {
+			continue
+		}
+		texts = append(texts, libs.ClusterText{ID: id, Text: text})
+		shapes[id] = shape
+	}
+
+	// Embeddings and clustering run in the AI pool, and go on in the
+	// background if they take too long
+	logger := libs.RequestLogger(c)
+	runJob(c, libs.AIPool, userID, func(ctx context.Context) libs.JobResult {
+		method := req.Method
+		if method == "" {
+			method = libs.ClusterMethodTFIDF
+			if libs.EmbeddingsConfigured() {
+				method = libs.ClusterMethodEmbeddings
+			}
+		}
+
+		var vectors [][]float64
+		var err error
+		if method == libs.ClusterMethodEmbeddings && len(texts) > 1 {
+			raw := make([]string, len(texts))
+			for i, text := range texts {
+				raw[i] = text.Text
+			}
+			vectors, err = libs.EmbedTexts(ctx, raw)
+			if err != nil {
+				logger.Warn("Embeddings unavailable, falling back to TF-IDF", "error", err)
+				method = libs.ClusterMethodTFIDF
+				vectors = nil
+			}
+			libs.ReportJobProgress(ctx, 60)
+		}
+
+		threshold := libs.DefaultTFIDFThreshold
+		if method == libs.ClusterMethodEmbeddings {
+			threshold = libs.DefaultEmbeddingThreshold
+		}
+		if req.Threshold != nil {
+			threshold = *req.Threshold
+		}
+
+		clusters, unclustered := libs.ClusterTexts(texts, vectors, threshold)
+
+		suggestions := []gin.H{}
+		for _, cluster := range clusters {
+			suggestion := gin.H{
+				"label":    cluster.Label,
+				"shapeIds": cluster.IDs,
+			}
+			if frame := clusterFrame(shapes, cluster.IDs); frame != nil {
+				suggestion["frame"] = frame
+			}
+			suggestions = append(suggestions, suggestion)
+		}
+
+		return libs.JSONResult(http.StatusOK, gin.H{
+			"method":      method,
+			"threshold":   threshold,
+			"clusters":    suggestions,
+			"unclustered": unclustered,
+		})
+	})
+}
+
+// clusterFrame returns the padded bounding box of the given shapes, or nil
+// when none of them has a position
+func clusterFrame(shapes map[string]map[string]interface{}, ids []string) gin.H {
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+
+	for _, id := range ids {
+		shape := shapes[id]
+		x, okX := libs.ShapeNumber(shape, "x")
+		y, okY := libs.ShapeNumber(shape, "y")
+		if !okX || !okY {
+			continue
+		}
+		width, _ := libs.ShapeNumber(shape, "width")
+		height, _ := libs.ShapeNumber(shape, "height")
+
+		minX, minY = math.Min(minX, x), math.Min(minY, y)
+		maxX, maxY = math.Max(maxX, x+width), math.Max(maxY, y+height)
+	}
+
+	if math.IsInf(minX, 1) {
+		return nil
+	}
+	return gin.H{
+		"x":      minX - clusterFramePadding,
+		"y":      minY - clusterFramePadding,
+		"width":  maxX - minX + 2*clusterFramePadding,
+		"height": maxY - minY + 2*clusterFramePadding,
+	}
+}
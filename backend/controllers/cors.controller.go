@@ -0,0 +1,105 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// GetCORSConfig returns the allowed origins, from the environment and per
+// tenant, with this instance's CORS metrics (admin only)
+func GetCORSConfig(c *gin.Context) {
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	tenants, err := libs.ListCORSTenants(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to retrieve CORS tenants: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"origins": libs.EnvCORSOrigins(),
+		"tenants": tenants,
+		"metrics": libs.GetCORSMetrics(),
+	})
+}
+
+// PutCORSTenant sets a tenant's allowed origins and vanity domains
+// (admin only). Other instances pick the change up within
+// CORS_REFRESH_INTERVAL.
+func PutCORSTenant(c *gin.Context) {
+	var req models.CORSTenantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+
+	adminID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid user ID",
+		})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	tenant, err := libs.SaveCORSTenant(ctx, c.Param("tenant"), req.Origins, req.VanityDomains, adminID)
+	switch {
+	case errors.Is(err, libs.ErrInvalidTenantName), errors.Is(err, libs.ErrInvalidOrigin), errors.Is(err, libs.ErrInvalidDomain):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to save CORS tenant: " + err.Error(),
+		})
+		return
+	}
+
+	recordAudit(c, models.AuditCORSTenantSaved, models.AuditTargetCORSTenant, tenant.Tenant, map[string]interface{}{
+		"origins":       tenant.Origins,
+		"vanityDomains": tenant.VanityDomains,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "CORS origins saved successfully",
+		"tenant":  tenant,
+	})
+}
+
+// DeleteCORSTenant removes a tenant's allowed origins (admin only)
+func DeleteCORSTenant(c *gin.Context) {
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	name := c.Param("tenant")
+	deleted, err := libs.DeleteCORSTenant(ctx, name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to delete CORS tenant: " + err.Error(),
+		})
+		return
+	}
+	if !deleted {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "CORS tenant not found",
+		})
+		return
+	}
+
+	recordAudit(c, models.AuditCORSTenantRemoved, models.AuditTargetCORSTenant, name, nil)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "CORS origins deleted successfully",
+	})
+}
@@ -0,0 +1,133 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/converter"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxCSVSize caps uploaded CSV files
+const maxCSVSize = 2 << 20
+
+// ImportCSV adds a sticky note per row of a CSV file to the board, in a
+// grid or in kanban columns. The file is the request body or the "file"
+// field of a multipart form; the options are query parameters or form
+// fields (see csvImportOptions).
+func ImportCSV(c *gin.Context) {
+	handleCSV(c, func(ctx context.Context, boards repository.BoardRepository, userID primitive.ObjectID, boardID string, result *converter.CSVResult, x, y *float64) libs.JobResult {
+		return addToBoard(ctx, boards, userID, boardID, result.Result, x, y, csvResponse(result, "CSV imported"))
+	})
+}
+
+// PreviewCSVImport answers with the notes ImportCSV would add and where,
+// and the file's fields to choose from, without changing the board
+func PreviewCSVImport(c *gin.Context) {
+	handleCSV(c, func(ctx context.Context, boards repository.BoardRepository, userID primitive.ObjectID, boardID string, result *converter.CSVResult, x, y *float64) libs.JobResult {
+		return previewImport(ctx, boards, userID, boardID, result.Result, x, y, csvResponse(result, "Preview of the CSV import"))
+	})
+}
+
+// handleCSV reads the upload and its options, converts it and hands the
+// result to finish, in the import pool
+func handleCSV(c *gin.Context, finish func(context.Context, repository.BoardRepository, primitive.ObjectID, string, *converter.CSVResult, *float64, *float64) libs.JobResult) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxCSVSize)
+	data, _, err := readImportFile(c)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "File is too large to import (2 MB max)"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid upload: " + err.Error()})
+		return
+	}
+
+	opts, x, y, err := csvImportOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	boardID := c.Param("boardId")
+	boards := libs.BoardRepository(c)
+	runJob(c, libs.ImportPool, userID, func(ctx context.Context) libs.JobResult {
+		result, err := converter.ConvertCSV(data, opts)
+		if err != nil {
+			return libs.JSONResult(http.StatusBadRequest, gin.H{"error": err.Error()})
+		}
+		libs.ReportJobProgress(ctx, 50)
+		return finish(ctx, boards, userID, boardID, result, x, y)
+	})
+}
+
+// csvImportOptions reads layout (grid or kanban), groupBy (the field whose
+// values become kanban columns), fields (comma separated, shown on the
+// notes), columns (notes per grid row) and x and y (where the top-left
+// corner goes)
+func csvImportOptions(c *gin.Context) (converter.CSVOptions, *float64, *float64, error) {
+	option := func(key string) string {
+		if value := strings.TrimSpace(c.Query(key)); value != "" {
+			return value
+		}
+		return strings.TrimSpace(c.PostForm(key))
+	}
+
+	opts := converter.CSVOptions{
+		Layout:  option("layout"),
+		GroupBy: option("groupBy"),
+	}
+	if fields := option("fields"); fields != "" {
+		for _, field := range strings.Split(fields, ",") {
+			if field = strings.TrimSpace(field); field != "" {
+				opts.Fields = append(opts.Fields, field)
+			}
+		}
+	}
+	if columns := option("columns"); columns != "" {
+		n, err := strconv.Atoi(columns)
+		if err != nil || n < 1 || n > converter.MaxCSVRows {
+			return opts, nil, nil, errors.New("columns must be a number from 1 to " + strconv.Itoa(converter.MaxCSVRows))
+		}
+		opts.Columns = n
+	}
+
+	var at [2]*float64
+	for i, key := range []string{"x", "y"} {
+		if value := option(key); value != "" {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil || math.IsNaN(parsed) || math.IsInf(parsed, 0) {
+				return opts, nil, nil, errors.New(key + " must be a number")
+			}
+			at[i] = &parsed
+		}
+	}
+	if (at[0] == nil) != (at[1] == nil) {
+		return opts, nil, nil, errors.New("Send both x and y, or neither")
+	}
+	return opts, at[0], at[1], nil
+}
+
+// csvResponse starts the response to a CSV import or its preview
+func csvResponse(result *converter.CSVResult, message string) gin.H {
+	return gin.H{
+		"message": message,
+		"fields":  result.Fields,
+		"rows":    result.Rows,
+		"columns": result.Columns,
+	}
+}
@@ -0,0 +1,162 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// dashboardSectionLimit caps how many boards or templates each dashboard
+// section returns
+const dashboardSectionLimit = 10
+
+// GetDashboard composes the dashboard sections for the authenticated user in
+// one response, so the frontend doesn't need a request per section
+func GetDashboard(c *gin.Context) {
+	userIDStr := c.GetString("userId")
+	if userIDStr == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "Authentication required",
+		})
+		return
+	}
+
+	userID, err := primitive.ObjectIDFromHex(userIDStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid user ID",
+		})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	recent, err := findDashboardBoards(ctx, bson.M{"ownerId": userID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to retrieve recent boards: " + err.Error(),
+		})
+		return
+	}
+
+	sharedFilter := bson.M{"sharedWith.userId": userID}
+	sharedWithMe, err := findDashboardBoards(ctx, sharedFilter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to retrieve shared boards: " + err.Error(),
+		})
+		return
+	}
+
+	starredIDs, err := libs.StarredBoardIDs(ctx, userID, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to retrieve starred boards: " + err.Error(),
+		})
+		return
+	}
+	// Stars stay on boards the user has lost access to; those aren't shown
+	starredFilter := bson.M{"$and": bson.A{boardAccessFilter(userID), bson.M{"_id": bson.M{"$in": starredIDs}}}}
+	starred, err := findDashboardBoards(ctx, starredFilter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to retrieve starred boards: " + err.Error(),
+		})
+		return
+	}
+
+	isStarred := map[string]bool{}
+	for _, id := range starredIDs {
+		isStarred[id.Hex()] = true
+	}
+	for _, section := range [][]models.FrontendBoard{recent, sharedWithMe, starred} {
+		for i := range section {
+			section[i].Starred = isStarred[section[i].ID]
+		}
+		withCollaboratorProfiles(ctx, c, section)
+	}
+
+	ownedCount, err := getBoardSummaryCollection().CountDocuments(ctx, bson.M{"ownerId": userID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to count boards: " + err.Error(),
+		})
+		return
+	}
+
+	sharedCount, err := getBoardSummaryCollection().CountDocuments(ctx, sharedFilter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to count boards: " + err.Error(),
+		})
+		return
+	}
+
+	starredCount, err := getBoardSummaryCollection().CountDocuments(ctx, starredFilter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to count boards: " + err.Error(),
+		})
+		return
+	}
+
+	templates, err := libs.ListTemplates(ctx, userID, dashboardSectionLimit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to retrieve templates: " + err.Error(),
+		})
+		return
+	}
+	templateCount, err := libs.CountTemplates(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to count templates: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"recent":       recent,
+		"sharedWithMe": sharedWithMe,
+		"starred":      starred,
+		"templates":    templates,
+		"counts": gin.H{
+			"owned":     ownedCount,
+			"shared":    sharedCount,
+			"starred":   starredCount,
+			"templates": templateCount,
+		},
+	})
+}
+
+// findDashboardBoards returns the most recently updated boards matching
+// filter, from their summaries
+func findDashboardBoards(ctx context.Context, filter bson.M) ([]models.FrontendBoard, error) {
+	opts := options.Find().
+		SetSort(bson.M{"updatedAt": -1}).
+		SetLimit(dashboardSectionLimit)
+
+	cursor, err := getBoardSummaryCollection().Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var boards []models.BoardSummary
+	if err := cursor.All(ctx, &boards); err != nil {
+		return nil, err
+	}
+
+	frontendBoards := []models.FrontendBoard{}
+	for _, board := range boards {
+		frontendBoards = append(frontendBoards, transformSummaryToFrontend(&board))
+	}
+	return frontendBoards, nil
+}
@@ -0,0 +1,392 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"github.com/sarwanazhar/boardsar/backend/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// deletionDateLayout is how the deletion date reads in emails
+const deletionDateLayout = "2006-01-02 15:04 MST"
+
+// scheduleBoardDeletion schedules the board's deletion and emails its owner
+// the link to keep it or delete it now
+func scheduleBoardDeletion(ctx context.Context, c *gin.Context, board *models.Board, userID primitive.ObjectID) (*models.PendingDeletion, error) {
+	deletion, token, err := libs.ScheduleDeletion(ctx, models.DeletionKindBoard, userID, &board.ID)
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to schedule board deletion", "board_id", board.ID.Hex(), "error", err)
+		return nil, err
+	}
+
+	owner, err := libs.FindUserByID(libs.RequestContext(c), userID.Hex())
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to find board owner", "board_id", board.ID.Hex(), "error", err)
+	} else {
+		sendDeletionEmail(libs.RequestLogger(c), owner, deletion, token, "board_deletion", map[string]string{"board": board.Name})
+	}
+
+	recordAudit(c, models.AuditBoardDeletionScheduled, models.AuditTargetBoard, board.ID.Hex(), map[string]interface{}{
+		"ownerId":  board.OwnerID.Hex(),
+		"deleteAt": deletion.DeleteAt,
+	})
+	return deletion, nil
+}
+
+// scheduleAccountDeletion schedules the user's account deletion and emails
+// them the link to keep it or delete it now
+func scheduleAccountDeletion(ctx context.Context, c *gin.Context, user *models.User) (*models.PendingDeletion, error) {
+	deletion, token, err := libs.ScheduleDeletion(ctx, models.DeletionKindAccount, user.ID, nil)
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to schedule account deletion", "error", err)
+		return nil, err
+	}
+
+	sendDeletionEmail(libs.RequestLogger(c), user, deletion, token, "account_deletion", nil)
+
+	recordAudit(c, models.AuditAccountDeletionScheduled, models.AuditTargetUser, user.ID.Hex(), map[string]interface{}{
+		"deleteAt": deletion.DeleteAt,
+	})
+	return deletion, nil
+}
+
+// sendDeletionEmail tells the user when the deletion will be carried out,
+// with the link to cancel it or carry it out now. key names the subject and
+// body strings, which get the date and link on top of vars.
+func sendDeletionEmail(logger *slog.Logger, user *models.User, deletion *models.PendingDeletion, token, key string, vars map[string]string) {
+	if vars == nil {
+		vars = map[string]string{}
+	}
+	vars["date"] = deletion.DeleteAt.UTC().Format(deletionDateLayout)
+	vars["link"] = libs.FrontendURL() + "/deletion?token=" + url.QueryEscape(token)
+
+	locale := userLocale(user)
+	err := libs.SendEmail(user.Email,
+		libs.Translate(locale, key+".subject", vars),
+		libs.LocalizedEmail(locale, user.Email, libs.Translate(locale, key+".body", vars)),
+	)
+	if err != nil {
+		logger.Error("Failed to send deletion email", "user_id", user.ID.Hex(), "kind", deletion.Kind, "error", err)
+	}
+}
+
+// GetBoardDeletion returns the board's pending deletion, for its owner
+func GetBoardDeletion(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	board, ok := findOwnedBoard(ctx, c, userID)
+	if !ok {
+		return
+	}
+	deletion, err := libs.FindPendingDeletion(ctx, models.DeletionKindBoard, userID, &board.ID)
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to find pending board deletion", "board_id", board.ID.Hex(), "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve board deletion"})
+		return
+	}
+	if deletion == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": libs.ErrNoPendingDeletion.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"deletion": deletion})
+}
+
+// CancelBoardDeletion keeps a board whose deletion is scheduled
+func CancelBoardDeletion(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	board, ok := findOwnedBoard(ctx, c, userID)
+	if !ok {
+		return
+	}
+	deletion, err := libs.CancelDeletion(ctx, models.DeletionKindBoard, userID, &board.ID)
+	if !deletionCanceled(c, deletion, err) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Board deletion canceled", "boardId": board.ID.Hex()})
+}
+
+// GetAccountDeletion returns the signed-in user's pending account deletion
+func GetAccountDeletion(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	deletion, err := libs.FindPendingDeletion(ctx, models.DeletionKindAccount, userID, nil)
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to find pending account deletion", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve account deletion"})
+		return
+	}
+	if deletion == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": libs.ErrNoPendingDeletion.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"deletion": deletion})
+}
+
+// CancelAccountDeletion keeps the signed-in user's account, whose deletion
+// is scheduled
+func CancelAccountDeletion(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	deletion, err := libs.CancelDeletion(ctx, models.DeletionKindAccount, userID, nil)
+	if !deletionCanceled(c, deletion, err) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account deletion canceled"})
+}
+
+// CancelDeletionByLink cancels the deletion a deletion email was sent for,
+// without signing in
+func CancelDeletionByLink(c *gin.Context) {
+	type Body struct {
+		Token string `json:"token" binding:"required"`
+	}
+
+	var body Body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	deletion, err := libs.CancelDeletionByToken(ctx, body.Token)
+	if !deletionCanceled(c, deletion, err) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Deletion canceled", "kind": deletion.Kind})
+}
+
+// ConfirmDeletion carries out the deletion a deletion email was sent for
+// now, rather than once the grace period is over
+func ConfirmDeletion(c *gin.Context) {
+	type Body struct {
+		Token string `json:"token" binding:"required"`
+	}
+
+	var body Body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := libs.DBContextWithin(c, accountTimeout)
+	defer cancel()
+
+	deletion, err := libs.ClaimDeletionByToken(ctx, body.Token)
+	if err == libs.ErrInvalidDeletionToken {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to check deletion token", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+		return
+	}
+
+	err = libs.CarryOutDeletion(ctx, deletion, CompletePendingDeletion(libs.BoardRepository(c)))
+	if errors.Is(err, libs.ErrDeletionBlocked) {
+		c.JSON(http.StatusLocked, gin.H{"error": "Under legal hold and can't be deleted"})
+		return
+	}
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to carry out deletion", "kind", deletion.Kind, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete. Please try again later."})
+		return
+	}
+	if deletion.Kind == models.DeletionKindAccount {
+		clearRefreshCookie(c)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Deleted", "kind": deletion.Kind})
+}
+
+// deletionCanceled answers for a canceled deletion, recording it, and
+// reports whether it was
+func deletionCanceled(c *gin.Context, deletion *models.PendingDeletion, err error) bool {
+	if err == libs.ErrNoPendingDeletion {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return false
+	}
+	if err == libs.ErrInvalidDeletionToken {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to cancel deletion", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel deletion"})
+		return false
+	}
+
+	libs.RecordAudit(libs.RequestContext(c), models.AuditEvent{
+		Action:  deletionAuditAction(deletion, models.AuditBoardDeletionCanceled, models.AuditAccountDeletionCanceled),
+		Actor:   auditActor(c, deletion.UserID.Hex()),
+		Target:  deletionAuditTarget(deletion),
+		Details: map[string]interface{}{"deleteAt": deletion.DeleteAt},
+	})
+	return true
+}
+
+// CompletePendingDeletion returns what carries out a deletion whose grace
+// period is over, or that its owner confirmed, as the request deleting the
+// board or account would have, with boards from boards. It returns
+// libs.ErrDeletionBlocked once that is no longer allowed, such as under
+// legal hold, and records why.
+func CompletePendingDeletion(boards repository.BoardRepository) func(context.Context, *models.PendingDeletion) error {
+	return func(ctx context.Context, deletion *models.PendingDeletion) error {
+		// Left to finish when the server shuts down, as a request would be
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), accountTimeout)
+		defer cancel()
+
+		switch deletion.Kind {
+		case models.DeletionKindBoard:
+			if deletion.BoardID == nil {
+				return fmt.Errorf("%w: board deletion without a board", libs.ErrDeletionBlocked)
+			}
+			return completeBoardDeletion(ctx, boards, deletion)
+		case models.DeletionKindAccount:
+			return completeAccountDeletion(ctx, boards, deletion)
+		}
+		return fmt.Errorf("%w: unknown deletion kind %q", libs.ErrDeletionBlocked, deletion.Kind)
+	}
+}
+
+func completeBoardDeletion(ctx context.Context, boards repository.BoardRepository, deletion *models.PendingDeletion) error {
+	board, err := boards.FindByID(ctx, *deletion.BoardID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil // Already gone
+	}
+	if err != nil {
+		return fmt.Errorf("error finding board: %w", err)
+	}
+
+	onHold, err := libs.IsBoardUnderLegalHold(ctx, board.ID, board.OwnerID)
+	if err != nil {
+		return fmt.Errorf("error checking legal hold: %w", err)
+	}
+	if onHold {
+		recordDeletionBlocked(ctx, deletion)
+		return libs.ErrDeletionBlocked
+	}
+
+	if err := boards.Delete(ctx, board.ID); err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return fmt.Errorf("error deleting board: %w", err)
+	}
+	cleanUpBoard(ctx, slog.Default(), board, deletion.UserID)
+
+	libs.RecordAudit(ctx, models.AuditEvent{
+		Action: models.AuditBoardDeleted,
+		Actor:  models.AuditActor{ID: deletion.UserID.Hex()},
+		Target: deletionAuditTarget(deletion),
+		Details: map[string]interface{}{
+			"ownerId":   board.OwnerID.Hex(),
+			"scheduled": true,
+		},
+	})
+	libs.RecordActivity(ctx, board, deletion.UserID, models.ActivityBoardDeleted, nil)
+	return nil
+}
+
+func completeAccountDeletion(ctx context.Context, boards repository.BoardRepository, deletion *models.PendingDeletion) error {
+	user, err := libs.Users().FindByID(ctx, deletion.UserID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil // Already gone
+	}
+	if err != nil {
+		return fmt.Errorf("error finding user: %w", err)
+	}
+
+	onHold, err := libs.IsAccountUnderLegalHold(ctx, boards, user.ID)
+	if err != nil {
+		return fmt.Errorf("error checking legal hold: %w", err)
+	}
+	if onHold {
+		recordDeletionBlocked(ctx, deletion)
+		return libs.ErrDeletionBlocked
+	}
+
+	deleted, err := deleteAccount(ctx, boards, slog.Default(), user.ID)
+	if err != nil {
+		return err
+	}
+
+	libs.RecordAudit(ctx, models.AuditEvent{
+		Action: models.AuditAccountDeleted,
+		Actor:  models.AuditActor{ID: user.ID.Hex()},
+		Target: deletionAuditTarget(deletion),
+		Details: map[string]interface{}{
+			"email":         user.Email,
+			"boardsDeleted": len(deleted.Boards),
+			"boardsLeft":    len(deleted.Shared),
+			"scheduled":     true,
+		},
+	})
+	return nil
+}
+
+// recordDeletionBlocked records a deletion dropped for a legal hold placed
+// during its grace period
+func recordDeletionBlocked(ctx context.Context, deletion *models.PendingDeletion) {
+	libs.RecordAudit(ctx, models.AuditEvent{
+		Action:  deletionAuditAction(deletion, models.AuditBoardDeletionCanceled, models.AuditAccountDeletionCanceled),
+		Actor:   models.AuditActor{ID: deletion.UserID.Hex()},
+		Target:  deletionAuditTarget(deletion),
+		Details: map[string]interface{}{"reason": "legal_hold"},
+	})
+}
+
+func deletionAuditAction(deletion *models.PendingDeletion, board, account string) string {
+	if deletion.Kind == models.DeletionKindBoard {
+		return board
+	}
+	return account
+}
+
+func deletionAuditTarget(deletion *models.PendingDeletion) *models.AuditTarget {
+	if deletion.Kind == models.DeletionKindBoard && deletion.BoardID != nil {
+		return &models.AuditTarget{Type: models.AuditTargetBoard, ID: deletion.BoardID.Hex()}
+	}
+	return &models.AuditTarget{Type: models.AuditTargetUser, ID: deletion.UserID.Hex()}
+}
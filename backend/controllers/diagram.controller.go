@@ -0,0 +1,57 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/converter"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"github.com/sarwanazhar/boardsar/backend/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ImportDiagram lays out a Mermaid or PlantUML diagram and adds its shapes
+// to the board, at the requested point or right of what's there
+func ImportDiagram(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req models.ImportDiagramRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+	if (req.X == nil) != (req.Y == nil) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Send both x and y, or neither"})
+		return
+	}
+
+	// Laying out runs in the import pool, like scene imports
+	boardID := c.Param("boardId")
+	boards := libs.BoardRepository(c)
+	runJob(c, libs.ImportPool, userID, func(ctx context.Context) libs.JobResult {
+		return importDiagram(ctx, boards, userID, boardID, req)
+	})
+}
+
+// importDiagram converts the diagram and adds it to the board, returning
+// the response
+func importDiagram(ctx context.Context, boards repository.BoardRepository, userID primitive.ObjectID, boardID string, req models.ImportDiagramRequest) libs.JobResult {
+	result, err := converter.ConvertDiagram(req.Source, req.Syntax)
+	if err != nil {
+		return libs.JSONResult(http.StatusBadRequest, gin.H{"error": err.Error()})
+	}
+	libs.ReportJobProgress(ctx, 50)
+
+	return addToBoard(ctx, boards, userID, boardID, result, req.X, req.Y, gin.H{
+		"message": "Diagram added",
+		"syntax":  result.Format,
+	})
+}
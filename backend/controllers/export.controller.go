@@ -0,0 +1,272 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"github.com/sarwanazhar/boardsar/backend/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// boardExportHistorySize is how many recent exports board activity shows
+const boardExportHistorySize = 100
+
+// ExportBoard downloads the board as the user sees it, or only the shapes
+// in ?shapeIds (comma separated) or in the section ?sectionId, as JSON, rendered to an SVG, PNG
+// (?scale, default 1) or PDF file, or as the graph its lines draw between
+// shapes in DOT or GraphML. Every export, and every attempt the board's
+// export policy blocks, is recorded in the audit log.
+func ExportBoard(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	format := c.DefaultQuery("format", "json")
+	_, render := libs.RenderContentTypes[format]
+	_, graph := libs.GraphContentTypes[format]
+	if !render && !graph && format != "json" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json, svg, png, pdf, dot or graphml"})
+		return
+	}
+	scale := 1.0
+	if value := c.Query("scale"); value != "" {
+		scale, err = strconv.ParseFloat(value, 64)
+		if err != nil || scale <= 0 || scale > libs.MaxRenderScale {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "scale must be above 0 and at most " + strconv.FormatFloat(libs.MaxRenderScale, 'f', -1, 64)})
+			return
+		}
+	}
+
+	var shapeIDs []string
+	for _, id := range strings.Split(c.Query("shapeIds"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			shapeIDs = append(shapeIDs, id)
+		}
+	}
+	sectionID := c.Query("sectionId")
+	scope := "board"
+	switch {
+	case len(shapeIDs) > 0 && sectionID != "":
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Export shapeIds or a sectionId, not both"})
+		return
+	case len(shapeIDs) > 0:
+		scope = "selection"
+	case sectionID != "":
+		scope = "section"
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	board, err := libs.BoardRepository(c).FindForUser(ctx, c.Param("boardId"), userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Board not found or access denied"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve board: " + err.Error()})
+		return
+	}
+	if sectionID != "" && libs.FindSection(board.Sections, sectionID) == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Section not found"})
+		return
+	}
+
+	// Apps export on the user's behalf; everything else is a download
+	details := map[string]interface{}{
+		"format":      format,
+		"scope":       scope,
+		"destination": "download",
+	}
+	if sectionID != "" {
+		details["sectionId"] = sectionID
+	}
+	if clientID := c.GetString("clientId"); clientID != "" {
+		details["destination"] = "oauth_app"
+		details["clientId"] = clientID
+	}
+
+	if err := libs.CheckExportPolicy(board, userID); err != nil {
+		details["reason"] = board.ExportPolicy
+		libs.RecordAudit(libs.RequestContext(c), models.AuditEvent{
+			Action:  models.AuditBoardExported,
+			Outcome: models.AuditOutcomeFailure,
+			Actor:   auditActor(c, userID.Hex()),
+			Target:  &models.AuditTarget{Type: models.AuditTargetBoard, ID: board.ID.Hex()},
+			Details: details,
+		})
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	visible := libs.VisibleBoardData(board.BoardData, userID)
+	data := libs.SelectShapes(visible, shapeIDs)
+	if sectionID != "" {
+		data = libs.SectionBoardData(visible, sectionID)
+	}
+	shapes, _ := libs.ShapeList(data)
+	details["shapeCount"] = len(shapes)
+	details["version"] = board.Version
+	recordAudit(c, models.AuditBoardExported, models.AuditTargetBoard, board.ID.Hex(), details)
+
+	filename := exportFilename(boardDisplayName(board.Name, board.BoardID)) + "." + format
+
+	if contentType, ok := libs.RenderContentTypes[format]; ok {
+		// Rendering runs in the export pool, and goes on in the background
+		// if it takes too long
+		logger := libs.RequestLogger(c)
+		runJob(c, libs.ExportPool, userID, func(ctx context.Context) libs.JobResult {
+			var file bytes.Buffer
+			if err := libs.RenderBoard(ctx, &file, data, format, scale); err != nil {
+				logger.Error("Failed to render board", "board_id", board.ID.Hex(), "format", format, "error", err)
+				return libs.JSONResult(http.StatusInternalServerError, gin.H{"error": "Failed to render board"})
+			}
+			return libs.JobResult{StatusCode: http.StatusOK, ContentType: contentType, Filename: filename, Body: file.Bytes()}
+		})
+		return
+	}
+
+	if contentType, ok := libs.GraphContentTypes[format]; ok {
+		var file bytes.Buffer
+		if err := libs.WriteGraph(&file, libs.BoardGraph(boardDisplayName(board.Name, board.BoardID), data), format); err != nil {
+			libs.RequestLogger(c).Error("Failed to export board graph", "board_id", board.ID.Hex(), "format", format, "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export board"})
+			return
+		}
+		c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+		c.Data(http.StatusOK, contentType, file.Bytes())
+		return
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.JSON(http.StatusOK, gin.H{
+		"format":      "boardsar",
+		"exportedAt":  time.Now().UTC(),
+		"boardId":     board.BoardID,
+		"name":        boardDisplayName(board.Name, board.BoardID),
+		"description": board.Description,
+		"version":     board.Version,
+		"board":       data,
+	})
+}
+
+// GetBoardExports lists the board's recent exports and blocked export
+// attempts, newest first, for its activity view
+func GetBoardExports(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	board, err := libs.BoardRepository(c).WithoutContents().FindForUser(ctx, c.Param("boardId"), userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Board not found or access denied"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve board: " + err.Error()})
+		return
+	}
+
+	events, err := libs.ListBoardExports(ctx, board.ID, boardExportHistorySize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve exports: " + err.Error()})
+		return
+	}
+
+	// Collaborators see who exported what, but not each other's addresses
+	exports := make([]gin.H, 0, len(events))
+	for _, event := range events {
+		exports = append(exports, gin.H{
+			"id":      event.ID.Hex(),
+			"time":    event.Time,
+			"userId":  event.Actor.ID,
+			"outcome": event.Outcome,
+			"details": event.Details,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"exports": exports})
+}
+
+// SetExportSettings changes who may export the board. Owner only.
+func SetExportSettings(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req models.ExportSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	board, ok := findOwnedBoard(ctx, c, userID)
+	if !ok {
+		return
+	}
+
+	// Anyone is the default, so it is stored as no policy at all
+	var policy interface{} = req.Policy
+	if req.Policy == models.ExportPolicyAnyone {
+		policy = nil
+	}
+	if err := libs.BoardRepository(c).Update(ctx, board.ID, map[string]interface{}{"exportPolicy": policy}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update export settings: " + err.Error()})
+		return
+	}
+	libs.InvalidateBoard(ctx, board.ID)
+
+	recordAudit(c, models.AuditBoardExportSettings, models.AuditTargetBoard, board.ID.Hex(), map[string]interface{}{
+		"previous": exportPolicy(board.ExportPolicy),
+		"policy":   req.Policy,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":      "Export settings updated successfully",
+		"exportPolicy": req.Policy,
+	})
+}
+
+// exportPolicy names a stored policy, which is empty for the default
+func exportPolicy(policy string) string {
+	if policy == "" {
+		return models.ExportPolicyAnyone
+	}
+	return policy
+}
+
+// exportFilename makes a board name safe to use in a download's file name
+func exportFilename(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r == '"' || r == '\\' || r == '/' || r < ' ' {
+			return '_'
+		}
+		return r
+	}, name)
+	if name == "" {
+		return "board"
+	}
+	return name
+}
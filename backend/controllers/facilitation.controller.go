@@ -0,0 +1,148 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"github.com/sarwanazhar/boardsar/backend/realtime"
+	"github.com/sarwanazhar/boardsar/backend/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// StartFacilitation starts a facilitated session on a board, or changes the
+// restrictions of the running one. Owner only.
+func StartFacilitation(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req models.FacilitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	facilitation := models.Facilitation{
+		NoDelete:        req.NoDelete,
+		StickyNotesOnly: req.StickyNotesOnly,
+		HideCursors:     req.HideCursors,
+		PrivateNotes:    req.PrivateNotes,
+		StartedAt:       time.Now(),
+	}
+
+	boards := libs.BoardRepository(c)
+	board, err := boards.FindOwned(ctx, c.Param("boardId"), userID)
+	if err == nil {
+		err = boards.Update(ctx, board.ID, map[string]interface{}{"facilitation": facilitation})
+	}
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Board not found or access denied"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start facilitation: " + err.Error()})
+		return
+	}
+	boardChanged(ctx, board.ID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":      "Facilitation started",
+		"facilitation": facilitation,
+	})
+}
+
+// EndFacilitation ends the facilitated session and lifts all restrictions.
+// Owner only.
+func EndFacilitation(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	boards := libs.BoardRepository(c)
+	board, err := boards.FindOwned(ctx, c.Param("boardId"), userID)
+	if err == nil {
+		err = boards.Update(ctx, board.ID, map[string]interface{}{"facilitation": nil})
+	}
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Board not found or access denied"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to end facilitation: " + err.Error()})
+		return
+	}
+	boardChanged(ctx, board.ID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Facilitation ended",
+	})
+}
+
+// RevealNotes makes every private note on the board visible to everyone in
+// a single update. Owner only.
+func RevealNotes(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	boards := libs.BoardRepository(c)
+	board, err := boards.FindOwned(ctx, c.Param("boardId"), userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Board not found or access denied"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reveal notes: " + err.Error()})
+		return
+	}
+
+	// Unsaved realtime edits may have notes of their own
+	if realtime.DefaultHub.FlushBoard(board.ID) {
+		if board, err = boards.FindByID(ctx, board.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reveal notes: " + err.Error()})
+			return
+		}
+	}
+
+	now := time.Now().Truncate(time.Millisecond)
+	libs.RevealShapes(board.BoardData)
+	err = boards.SaveContents(ctx, board.ID, board.Version, 1, board.BoardData, map[string]interface{}{"updatedAt": now})
+	if errors.Is(err, repository.ErrVersionConflict) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Board changed while revealing notes; retry"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reveal notes: " + err.Error()})
+		return
+	}
+	board.Version++
+	board.UpdatedAt = now
+	boardChanged(ctx, board.ID)
+	libs.RecordBoardVersion(libs.RequestContext(c), board, userID)
+	libs.RefreshBoardSummary(libs.RequestContext(c), board.ID, board.BoardData)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Notes revealed",
+	})
+}
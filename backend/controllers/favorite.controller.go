@@ -0,0 +1,51 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// StarBoard stars a board you can see. Stars are yours alone: they don't
+// change the board, and collaborators star it independently.
+func StarBoard(c *gin.Context) {
+	setBoardStar(c, true)
+}
+
+// UnstarBoard removes your star from a board
+func UnstarBoard(c *gin.Context) {
+	setBoardStar(c, false)
+}
+
+func setBoardStar(c *gin.Context, star bool) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	board, ok := findVisibleBoard(ctx, c, libs.BoardRepository(c).WithoutContents(), userID)
+	if !ok {
+		return
+	}
+
+	if star {
+		err = libs.StarBoard(ctx, userID, board.ID)
+	} else {
+		err = libs.UnstarBoard(ctx, userID, board.ID)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update star: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"boardId": board.ID.Hex(),
+		"starred": star,
+	})
+}
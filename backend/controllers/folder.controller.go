@@ -0,0 +1,146 @@
+package controllers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// GetFolders lists the user's folders by name
+func GetFolders(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	folders, err := libs.ListFolders(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve folders: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"folders": folders})
+}
+
+// CreateFolder adds a folder for the user's boards
+func CreateFolder(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	name, ok := bindFolderName(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	folder, err := libs.CreateFolder(ctx, userID, name)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "You already have a folder with that name"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create folder: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Folder created successfully",
+		"folder":  folder,
+	})
+}
+
+// UpdateFolder renames one of the user's folders
+func UpdateFolder(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	name, ok := bindFolderName(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	folder, err := libs.RenameFolder(ctx, c.Param("folderId"), userID, name)
+	if err != nil {
+		switch {
+		case err == mongo.ErrNoDocuments:
+			c.JSON(http.StatusNotFound, gin.H{"error": "Folder not found"})
+		case mongo.IsDuplicateKeyError(err):
+			c.JSON(http.StatusConflict, gin.H{"error": "You already have a folder with that name"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update folder: " + err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Folder updated successfully",
+		"folder":  folder,
+	})
+}
+
+// DeleteFolder removes one of the user's folders. Its boards are kept, out
+// of any folder.
+func DeleteFolder(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	folderID, err := primitive.ObjectIDFromHex(c.Param("folderId"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Folder not found"})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	deleted, err := libs.DeleteFolder(ctx, folderID, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete folder: " + err.Error()})
+		return
+	}
+	if !deleted {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Folder not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Folder deleted successfully"})
+}
+
+// bindFolderName reads the folder name from the request body
+func bindFolderName(c *gin.Context) (string, bool) {
+	var req models.FolderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body: " + err.Error(),
+		})
+		return "", false
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+		return "", false
+	}
+	return name, true
+}
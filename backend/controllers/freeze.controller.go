@@ -0,0 +1,97 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"github.com/sarwanazhar/boardsar/backend/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ScheduleBoardFreeze sets the time after which the board is read-only for
+// everyone but its owner, replacing any freeze scheduled before. A time
+// already past freezes it at once; a later one lifts a freeze that has
+// come. Owner only.
+func ScheduleBoardFreeze(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req models.BoardFreezeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	now := time.Now()
+	freeze := models.BoardFreeze{At: req.At.UTC(), ScheduledBy: userID}
+	if !freeze.At.After(now) {
+		freeze.FrozenAt = &now
+	}
+
+	boards := libs.BoardRepository(c)
+	board, err := boards.WithoutContents().FindOwned(ctx, c.Param("boardId"), userID)
+	if err == nil {
+		err = boards.Update(ctx, board.ID, map[string]interface{}{"freeze": freeze})
+	}
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Board not found or access denied"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to schedule freeze: " + err.Error()})
+		return
+	}
+	// Live sessions pick up the freeze, and turn read-only if it has come
+	boardChanged(ctx, board.ID)
+	libs.RefreshBoardSummary(libs.RequestContext(c), board.ID, nil)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Freeze scheduled",
+		"freeze":  libs.FreezeStatus(&freeze, now),
+	})
+}
+
+// LiftBoardFreeze cancels a scheduled freeze, or unfreezes the board if it
+// has come. Owner only.
+func LiftBoardFreeze(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	boards := libs.BoardRepository(c)
+	board, err := boards.WithoutContents().FindOwned(ctx, c.Param("boardId"), userID)
+	if err == nil {
+		err = boards.Update(ctx, board.ID, map[string]interface{}{"freeze": nil})
+	}
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Board not found or access denied"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to lift freeze: " + err.Error()})
+		return
+	}
+	boardChanged(ctx, board.ID)
+	libs.RefreshBoardSummary(libs.RequestContext(c), board.ID, nil)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Freeze lifted",
+	})
+}
@@ -0,0 +1,27 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+)
+
+// Liveness reports that the process is up and serving. It checks nothing
+// else, so an orchestrator doesn't restart instances over an outage they
+// can't fix.
+func Liveness(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Readiness reports whether this instance can serve requests: every
+// dependency it needs answers. If one doesn't, it answers 503 so load
+// balancers send traffic elsewhere.
+func Readiness(c *gin.Context) {
+	dependencies, ready := libs.CheckDependencies(libs.RequestContext(c))
+	if !ready {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable", "dependencies": dependencies})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ready", "dependencies": dependencies})
+}
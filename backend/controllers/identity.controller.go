@@ -0,0 +1,311 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// errNoVerifiedEmail is shown when a provider account can't be matched to
+// or create a BoardSar account
+var errNoVerifiedEmail = errors.New("Your account at the provider has no verified email address")
+
+// StartProviderSignIn sends the user to the provider to sign in
+func StartProviderSignIn(c *gin.Context) {
+	startProviderFlow(c, nil)
+}
+
+// ProviderCallback finishes a sign-in or link started with the provider.
+// GitHub calls back with a GET; Apple posts a form (response_mode
+// form_post). Either way the user ends up on the frontend's /oauth/callback
+// page, with a refresh cookie they exchange through POST /auth/refresh
+// after a sign-in, or an error parameter.
+func ProviderCallback(c *gin.Context) {
+	provider := c.Param("provider")
+
+	// Apple and GitHub both report failures, such as the user cancelling,
+	// with an error parameter
+	if providerError := c.Request.FormValue("error"); providerError != "" {
+		redirectToFrontend(c, provider, url.Values{"error": {providerError}})
+		return
+	}
+
+	ctx, cancel := libs.DBContextWithin(c, 10*time.Second)
+	defer cancel()
+
+	state, err := libs.ConsumeOAuthState(ctx, provider, c.Request.FormValue("state"))
+	if err != nil {
+		if err != libs.ErrInvalidOAuthState {
+			libs.RequestLogger(c).Error("Failed to check sign-in state", "provider", provider, "error", err)
+		}
+		redirectToFrontend(c, provider, url.Values{"error": {libs.ErrInvalidOAuthState.Error()}})
+		return
+	}
+
+	profile, err := libs.ExchangeProviderCode(ctx, provider, c.Request.FormValue("code"), state.Nonce)
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to complete sign-in", "provider", provider, "error", err)
+		redirectToFrontend(c, provider, url.Values{"error": {"Could not sign in with " + provider}})
+		return
+	}
+
+	if state.UserID != nil {
+		linkProviderIdentity(ctx, c, *state.UserID, profile)
+		return
+	}
+
+	user, details, err := providerUser(ctx, profile)
+	if err != nil {
+		if err != errNoVerifiedEmail {
+			libs.RequestLogger(c).Error("Failed to sign in", "provider", provider, "subject", profile.Subject, "error", err)
+			err = errors.New("Could not sign in with " + provider)
+		}
+		redirectToFrontend(c, provider, url.Values{"error": {err.Error()}})
+		return
+	}
+
+	redirectToFrontend(c, provider, redirectSignIn(ctx, c, user, details, "Could not sign in with "+provider))
+}
+
+// redirectSignIn signs the user in for a flow that ends with a redirect to
+// the frontend, and returns the parameters for it. A session gets a refresh
+// cookie, which the frontend exchanges through POST /auth/refresh. With
+// two-factor on, it gets a twoFactorToken for POST /auth/2fa/verify
+// instead, and on failure an error, failMessage for unexpected ones.
+func redirectSignIn(ctx context.Context, c *gin.Context, user *models.User, details map[string]interface{}, failMessage string) url.Values {
+	if user.DeactivatedAt != nil {
+		return url.Values{"error": {libs.ErrAccountDeactivated.Error()}}
+	}
+
+	enabled, err := libs.TwoFactorEnabled(ctx, user.ID)
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to load two-factor", "user_id", user.ID.Hex(), "error", err)
+		return url.Values{"error": {failMessage}}
+	}
+	if enabled {
+		token, err := libs.StartTwoFactorChallenge(ctx, user.ID, details)
+		if err != nil {
+			libs.RequestLogger(c).Error("Failed to start two-factor challenge", "user_id", user.ID.Hex(), "error", err)
+			return url.Values{"error": {failMessage}}
+		}
+		return url.Values{"twoFactorToken": {token}}
+	}
+
+	_, refreshToken, err := libs.StartSession(ctx, user.ID, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to start session", "user_id", user.ID.Hex(), "error", err)
+		return url.Values{"error": {"Could not generate token"}}
+	}
+	setRefreshCookie(c, refreshToken)
+	touchUserActivity(c, user.ID)
+
+	libs.RecordAudit(libs.RequestContext(c), models.AuditEvent{
+		Action:  models.AuditLoginSucceeded,
+		Actor:   auditActor(c, user.ID.Hex()),
+		Details: details,
+	})
+	return nil
+}
+
+// providerUser finds the account to sign in for the provider's user. An
+// unlinked provider account is linked to the account with its verified
+// email, or gets a new account.
+func providerUser(ctx context.Context, profile *models.ExternalProfile) (*models.User, map[string]interface{}, error) {
+	details := map[string]interface{}{"method": profile.Provider}
+
+	identity, err := libs.FindIdentity(ctx, profile.Provider, profile.Subject)
+	if err != nil {
+		return nil, nil, err
+	}
+	if identity != nil {
+		user, err := libs.FindUserByID(ctx, identity.UserID.Hex())
+		return user, details, err
+	}
+
+	// Only a verified address proves the user owns the matching account
+	if profile.Email == "" || !profile.EmailVerified {
+		return nil, nil, errNoVerifiedEmail
+	}
+
+	user, err := libs.FindUserByEmail(ctx, profile.Email)
+	if err != nil {
+		// No password: the account signs in through the provider until one
+		// is set through the password reset flow
+		user = &models.User{Email: profile.Email}
+		if _, err := libs.CreateUser(ctx, user); err != nil {
+			return nil, nil, err
+		}
+		details["newAccount"] = true
+	}
+
+	if _, err := libs.LinkIdentity(ctx, user.ID, profile); err != nil {
+		return nil, nil, err
+	}
+	details["linked"] = true
+	return user, details, nil
+}
+
+// linkProviderIdentity finishes linking a provider to a signed-in user's
+// account
+func linkProviderIdentity(ctx context.Context, c *gin.Context, userID primitive.ObjectID, profile *models.ExternalProfile) {
+	_, err := libs.LinkIdentity(ctx, userID, profile)
+	if err == libs.ErrIdentityInUse {
+		redirectToFrontend(c, profile.Provider, url.Values{"error": {err.Error()}})
+		return
+	}
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to link identity", "provider", profile.Provider, "user_id", userID.Hex(), "error", err)
+		redirectToFrontend(c, profile.Provider, url.Values{"error": {"Could not link " + profile.Provider}})
+		return
+	}
+
+	libs.RecordAudit(libs.RequestContext(c), models.AuditEvent{
+		Action:  models.AuditIdentityLinked,
+		Actor:   auditActor(c, userID.Hex()),
+		Target:  &models.AuditTarget{Type: models.AuditTargetUser, ID: userID.Hex()},
+		Details: map[string]interface{}{"provider": profile.Provider},
+	})
+
+	redirectToFrontend(c, profile.Provider, url.Values{"linked": {"true"}})
+}
+
+// redirectToFrontend ends a provider flow on the frontend's callback page.
+// 303 makes the browser follow Apple's form post with a GET.
+func redirectToFrontend(c *gin.Context, provider string, params url.Values) {
+	if params == nil {
+		params = url.Values{}
+	}
+	params.Set("provider", provider)
+	c.Redirect(http.StatusSeeOther, libs.FrontendURL()+"/oauth/callback?"+params.Encode())
+}
+
+// startProviderFlow sends the user to the provider, to sign in or, with a
+// userID, to link the provider to their account. Linking answers with the
+// URL instead of redirecting, since it's called from the app with a bearer
+// token rather than by navigating.
+func startProviderFlow(c *gin.Context, userID *primitive.ObjectID) {
+	provider := c.Param("provider")
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	if !libs.ProviderConfigured(provider) {
+		c.JSON(http.StatusNotFound, gin.H{"error": libs.ErrUnknownProvider.Error()})
+		return
+	}
+
+	state, nonce, err := libs.CreateOAuthState(ctx, provider, userID)
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to start sign-in", "provider", provider, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+		return
+	}
+	authURL, err := libs.ProviderAuthURL(provider, state, nonce)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	if userID != nil {
+		c.JSON(http.StatusOK, gin.H{"url": authURL})
+		return
+	}
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// GetIdentities lists the providers linked to your account, and the ones
+// this server offers
+func GetIdentities(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	identities, err := libs.ListIdentities(ctx, userID)
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to list identities", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"identities": identities,
+		"providers":  libs.ConfiguredProviders(),
+	})
+}
+
+// LinkIdentity starts linking a provider to your account. It answers with
+// the provider URL to send the user to; they come back to the frontend's
+// /oauth/callback page with linked=true or an error.
+func LinkIdentity(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	startProviderFlow(c, &userID)
+}
+
+// UnlinkIdentity removes a provider from your account. The last way to sign
+// in can't be removed: accounts without a password must keep a provider or
+// a passkey.
+func UnlinkIdentity(c *gin.Context) {
+	provider := c.Param("provider")
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	user, err := libs.FindUserByID(libs.RequestContext(c), userID.Hex())
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	identities, err := libs.ListIdentities(ctx, userID)
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to list identities", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+		return
+	}
+	passkeys, err := libs.ListPasskeys(ctx, userID)
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to list passkeys", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+		return
+	}
+	if user.Password == "" && len(passkeys) == 0 && len(identities) == 1 && identities[0].Provider == provider {
+		c.JSON(http.StatusConflict, gin.H{"error": "Set a password, add a passkey or link another provider before unlinking your only way to sign in"})
+		return
+	}
+
+	err = libs.UnlinkIdentity(ctx, userID, provider)
+	if err == libs.ErrIdentityNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to unlink identity", "provider", provider, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+		return
+	}
+
+	recordAudit(c, models.AuditIdentityUnlinked, models.AuditTargetUser, userID.Hex(),
+		map[string]interface{}{"provider": provider})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Provider unlinked", "provider": provider})
+}
@@ -0,0 +1,448 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sarwanazhar/boardsar/backend/converter"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"github.com/sarwanazhar/boardsar/backend/plugins"
+	"github.com/sarwanazhar/boardsar/backend/realtime"
+	"github.com/sarwanazhar/boardsar/backend/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxImportSize caps uploaded scene files
+const maxImportSize = 20 << 20
+
+// importFormatNames name the source apps in default board names
+var importFormatNames = map[string]string{
+	converter.FormatExcalidraw: "Excalidraw",
+	converter.FormatTldraw:     "tldraw",
+	converter.FormatMiro:       "Miro",
+	converter.FormatMural:      "Mural",
+}
+
+// ImportBoard creates a board owned by the user from another app's scene
+// file, sent either as the request body or as the "file" field of a
+// multipart form. The board is named by ?name= (or the form's "name"
+// field), else by the file.
+func ImportBoard(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize)
+	data, fileName, err := readImportFile(c)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "File is too large to import (20 MB max)"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid upload: " + err.Error()})
+		return
+	}
+
+	name := strings.TrimSpace(c.Query("name"))
+	if name == "" {
+		name = strings.TrimSpace(c.PostForm("name"))
+	}
+	actor := auditActor(c, userID.Hex())
+
+	// Converting runs in the import pool, and goes on in the background if
+	// it takes too long
+	boards := libs.BoardRepository(c)
+	runJob(c, libs.ImportPool, userID, func(ctx context.Context) libs.JobResult {
+		return importBoard(ctx, boards, userID, actor, data, name, fileName)
+	})
+}
+
+// importBoard converts a scene file and creates the board, returning the
+// response. name is the requested name, if any.
+func importBoard(ctx context.Context, boards repository.BoardRepository, userID primitive.ObjectID, actor models.AuditActor, data []byte, name, fileName string) libs.JobResult {
+	result, err := converter.Convert(data)
+	if err != nil {
+		return libs.JSONResult(http.StatusBadRequest, gin.H{"error": err.Error()})
+	}
+	libs.ReportJobProgress(ctx, 40)
+	if err := libs.ValidateBoardShapes(result.Board); err != nil {
+		return libs.JSONResult(http.StatusBadRequest, gin.H{"error": err.Error()})
+	}
+	libs.ReportJobProgress(ctx, 60)
+
+	dbCtx, cancel := context.WithTimeout(ctx, libs.Settings().DBTimeout)
+	defer cancel()
+
+	size := libs.BoardDataSize(result.Board)
+	if err := libs.CheckBoardSize(size); err != nil {
+		return libs.JSONResult(http.StatusUnprocessableEntity, invalidBoardBody(err))
+	}
+
+	usage, err := libs.GetQuotaUsage(dbCtx, userID, primitive.NilObjectID)
+	if err != nil {
+		return libs.JSONResult(http.StatusInternalServerError, gin.H{"error": "Failed to check quota: " + err.Error()})
+	}
+	headers := libs.JobHeaders{}
+	warnings, quotaErr := libs.ApplyQuota(headers, usage, 1, size)
+	if quotaErr != "" {
+		return libs.JSONResult(http.StatusForbidden, gin.H{"error": quotaErr})
+	}
+
+	if name == "" {
+		name = result.Name
+	}
+	if name == "" && fileName != "" {
+		name = strings.TrimSuffix(fileName, filepath.Ext(fileName))
+	}
+	if name == "" {
+		name = "Imported from " + importFormatNames[result.Format]
+	}
+
+	board := models.Board{
+		ID:        primitive.NewObjectID(),
+		BoardID:   uuid.New().String(),
+		Name:      name,
+		OwnerID:   userID,
+		BoardData: result.Board,
+		Version:   1,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	importImages(ctx, &board, userID, result)
+	libs.ReportJobProgress(ctx, 70)
+
+	if err := createImportedBoard(ctx, boards, &board, actor, map[string]interface{}{"importedFrom": result.Format}); err != nil {
+		return libs.JSONResult(http.StatusInternalServerError, gin.H{"error": "Failed to create board: " + err.Error()})
+	}
+	libs.ReportJobProgress(ctx, 80)
+
+	shapes, _ := libs.ShapeList(result.Board)
+	body := gin.H{
+		"message":      "Board imported successfully",
+		"board":        transformBoardToFrontend(&board),
+		"version":      board.Version,
+		"importedFrom": result.Format,
+		"shapes":       len(shapes),
+		"skipped":      result.Skipped,
+		"report":       result.Report,
+	}
+	if len(warnings) > 0 {
+		body["warnings"] = warnings
+	}
+	created := libs.JSONResult(http.StatusCreated, body)
+	created.Headers = headers
+	return created
+}
+
+// createImportedBoard stores an imported board in boards and records its
+// creation, with details for the audit event
+func createImportedBoard(ctx context.Context, boards repository.BoardRepository, board *models.Board, actor models.AuditActor, details map[string]interface{}) error {
+	dbCtx, cancel := context.WithTimeout(ctx, libs.Settings().DBTimeout)
+	defer cancel()
+	if err := boards.Create(dbCtx, board); err != nil {
+		return err
+	}
+
+	libs.RecordAudit(ctx, models.AuditEvent{
+		Action:  models.AuditBoardCreated,
+		Actor:   actor,
+		Target:  &models.AuditTarget{Type: models.AuditTargetBoard, ID: board.ID.Hex()},
+		Details: details,
+	})
+	libs.RecordActivity(ctx, board, board.OwnerID, models.ActivityBoardCreated, nil)
+	plugins.Emit(ctx, board, plugins.EventBoardCreated, board.OwnerID)
+	libs.RecordBoardVersion(ctx, board, board.OwnerID)
+	return nil
+}
+
+// importImages copies the pictures of the board's image shapes into its
+// assets and points the shapes at them. Images that can't be fetched or
+// aren't supported are left out, and added to the result's report.
+func importImages(ctx context.Context, board *models.Board, userID primitive.ObjectID, result *converter.Result) {
+	if len(result.Images) == 0 {
+		return
+	}
+
+	failed := map[string]bool{}
+	imported := map[string]*models.Asset{}
+	for i, image := range result.Images {
+		err := error(libs.ErrTooManyImportImages)
+		if i < libs.MaxImportImages {
+			err = importImage(ctx, board, userID, image, imported)
+		}
+		if err != nil {
+			failed[image.ShapeID] = true
+			result.Skipped["image"]++
+			result.Report = append(result.Report, converter.ReportItem{ID: image.ShapeID, Type: "image", Reason: err.Error()})
+		}
+	}
+
+	shapes, _ := libs.ShapeList(board.BoardData)
+	kept := make([]interface{}, 0, len(shapes))
+	for _, item := range shapes {
+		shape, _ := item.(map[string]interface{})
+		id, _ := shape["id"].(string)
+		if failed[id] {
+			continue
+		}
+		if asset, ok := imported[id]; ok {
+			shape["src"] = asset.URL
+			shape["assetId"] = asset.ID.Hex()
+		}
+		kept = append(kept, item)
+	}
+	board.BoardData["shapes"] = kept
+}
+
+// importImage fetches one image and stores it as an asset of the board
+func importImage(ctx context.Context, board *models.Board, userID primitive.ObjectID, image converter.Image, imported map[string]*models.Asset) error {
+	data, filename, err := libs.FetchImportImage(ctx, image.Source)
+	if err != nil {
+		return err
+	}
+
+	assetCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	asset, err := libs.CreateAsset(assetCtx, board, userID, filename, data)
+	if err != nil {
+		return err
+	}
+	imported[image.ShapeID] = asset
+	return nil
+}
+
+// readImportFile returns the uploaded file and its name, which is only
+// known for multipart uploads
+func readImportFile(c *gin.Context) ([]byte, string, error) {
+	if !strings.HasPrefix(c.ContentType(), "multipart/") {
+		data, err := io.ReadAll(c.Request.Body)
+		if err == nil && len(data) == 0 {
+			err = errors.New("no file in the request body")
+		}
+		return data, "", err
+	}
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		return nil, "", err
+	}
+	file, err := header.Open()
+	if err != nil {
+		return nil, "", err
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	return data, filepath.Base(header.Filename), err
+}
+
+// importGap separates shapes imported onto a board from its content
+const importGap = 100
+
+// findImportBoard loads a board the user can see for adding imported
+// shapes to, or, with edit, one they can change. The result is the error
+// response when it can't.
+func findImportBoard(ctx context.Context, boards repository.BoardRepository, userID primitive.ObjectID, boardID string, edit bool) (*models.Board, libs.JobResult, bool) {
+	board, err := boards.FindForUser(ctx, boardID, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, libs.JSONResult(http.StatusNotFound, gin.H{"error": "Board not found or access denied"}), false
+		}
+		return nil, libs.JSONResult(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve board: " + err.Error()}), false
+	}
+	if !edit {
+		return board, libs.JobResult{}, true
+	}
+
+	// Only owners and editors can change it
+	role := libs.BoardRole(board, userID)
+	if role != models.BoardRoleOwner && role != models.CollaboratorRoleEditor {
+		return nil, libs.JSONResult(http.StatusForbidden, gin.H{"error": "You have view-only access to this board"}), false
+	}
+
+	// Add to unsaved realtime edits rather than discarding them
+	if realtime.DefaultHub.FlushBoard(board.ID) {
+		if board, err = boards.FindByID(ctx, board.ID); err != nil {
+			return nil, libs.JSONResult(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve board: " + err.Error()}), false
+		}
+	}
+	return board, libs.JobResult{}, true
+}
+
+// placeImport turns converted shapes into add operations for the board,
+// with their top-left corner at x, y or right of its content
+func placeImport(board *models.Board, userID primitive.ObjectID, result *converter.Result, x, y *float64) []models.BoardOperation {
+	var origin libs.Bounds
+	if x != nil && y != nil {
+		origin.X, origin.Y = *x, *y
+	} else {
+		origin = importOrigin(board, userID)
+	}
+	shapes, _ := libs.ShapeList(result.Board)
+	return importOperations(shapes, origin.X, origin.Y)
+}
+
+// previewImport answers with the shapes an import would add to the board,
+// where they would go, without adding them
+func previewImport(ctx context.Context, boards repository.BoardRepository, userID primitive.ObjectID, boardID string, result *converter.Result, x, y *float64, body gin.H) libs.JobResult {
+	dbCtx, cancel := context.WithTimeout(ctx, libs.Settings().DBTimeout)
+	defer cancel()
+
+	board, failure, ok := findImportBoard(dbCtx, boards, userID, boardID, false)
+	if !ok {
+		return failure
+	}
+	operations := placeImport(board, userID, result, x, y)
+	shapes := make([]interface{}, len(operations))
+	for i, op := range operations {
+		shapes[i] = op.Shape
+	}
+	body["shapes"] = shapes
+	body["skipped"] = result.Skipped
+	body["report"] = result.Report
+	return libs.JSONResult(http.StatusOK, body)
+}
+
+// addToBoard adds converted shapes to the board as one new version, and
+// answers with body plus the shapes added, where they went, and the
+// board's version
+func addToBoard(ctx context.Context, boards repository.BoardRepository, userID primitive.ObjectID, boardID string, result *converter.Result, x, y *float64, body gin.H) libs.JobResult {
+	dbCtx, cancel := context.WithTimeout(ctx, libs.Settings().DBTimeout)
+	defer cancel()
+
+	board, failure, ok := findImportBoard(dbCtx, boards, userID, boardID, true)
+	if !ok {
+		return failure
+	}
+	operations := placeImport(board, userID, result, x, y)
+	for i := range operations {
+		op := &operations[i]
+		if violation := libs.PrepareOperation(board, op, userID); violation != "" {
+			return libs.JSONResult(http.StatusForbidden, gin.H{"error": violation})
+		}
+		if err := libs.ApplyBoardOperation(board.BoardData, *op); err != nil {
+			return libs.JSONResult(http.StatusBadRequest, gin.H{"error": err.Error()})
+		}
+	}
+	libs.ReportJobProgress(ctx, 70)
+
+	size := libs.BoardDataSize(board.BoardData)
+	if err := libs.CheckBoardSize(size); err != nil {
+		return libs.JSONResult(http.StatusUnprocessableEntity, invalidBoardBody(err))
+	}
+
+	usage, err := libs.GetQuotaUsage(dbCtx, board.OwnerID, board.ID)
+	if err != nil {
+		return libs.JSONResult(http.StatusInternalServerError, gin.H{"error": "Failed to check quota: " + err.Error()})
+	}
+	headers := libs.JobHeaders{}
+	warnings, quotaErr := libs.ApplyQuota(headers, usage, 0, size)
+	if quotaErr != "" {
+		return libs.JSONResult(http.StatusForbidden, gin.H{"error": quotaErr})
+	}
+
+	// One version for the whole import, written only over the version it
+	// was added to
+	now := time.Now().Truncate(time.Millisecond)
+	err = boards.SaveContents(dbCtx, board.ID, int64(board.Version), 1, board.BoardData, map[string]interface{}{"updatedAt": now})
+	if errors.Is(err, repository.ErrVersionConflict) {
+		return libs.JSONResult(http.StatusConflict, gin.H{"error": "Board changed while importing; retry"})
+	}
+	if err != nil {
+		return libs.JSONResult(http.StatusInternalServerError, gin.H{"error": "Failed to update board: " + err.Error()})
+	}
+	board.Version++
+	boardChanged(dbCtx, board.ID)
+	plugins.Emit(ctx, board, plugins.EventBoardUpdated, userID)
+	libs.RecordBoardVersion(ctx, board, userID)
+	libs.RecordBoardUpdate(ctx, board, userID, operationChanges(operations))
+
+	added := make([]interface{}, len(operations))
+	for i, op := range operations {
+		added[i] = op.Shape
+	}
+	body["shapes"] = added
+	body["version"] = board.Version
+	body["updatedAt"] = now
+	body["skipped"] = result.Skipped
+	body["report"] = result.Report
+	if len(warnings) > 0 {
+		body["warnings"] = warnings
+	}
+	headers.Header("ETag", boardETag(board.Version))
+	response := libs.JSONResult(http.StatusOK, body)
+	response.Headers = headers
+	return response
+}
+
+// importOrigin is where imported shapes go by default: right of the
+// content the user can see, level with its top, or at the origin of an
+// empty board
+func importOrigin(board *models.Board, userID primitive.ObjectID) libs.Bounds {
+	minY, maxX := math.Inf(1), math.Inf(-1)
+	shapes, _ := libs.ShapeList(board.BoardData)
+	for _, item := range shapes {
+		shape, ok := item.(map[string]interface{})
+		if !ok || libs.IsHiddenFrom(shape, userID) {
+			continue
+		}
+		if bounds, ok := libs.ShapeBounds(shape); ok {
+			minY = math.Min(minY, bounds.Y)
+			maxX = math.Max(maxX, bounds.X+bounds.Width)
+		}
+	}
+	if math.IsInf(maxX, -1) {
+		return libs.Bounds{}
+	}
+	return libs.Bounds{X: maxX + importGap, Y: minY}
+}
+
+// importOperations turns imported shapes into add operations, moved by x,
+// y and given fresh IDs, so the same content can be imported more than
+// once. Shapes sharing a groupId share a new one.
+func importOperations(shapes []interface{}, x, y float64) []models.BoardOperation {
+	groups := map[string]string{}
+	operations := make([]models.BoardOperation, 0, len(shapes))
+	for _, item := range shapes {
+		shape, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		shape["id"] = uuid.New().String()
+		if group, ok := shape[libs.ShapeGroupKey].(string); ok {
+			if _, seen := groups[group]; !seen {
+				groups[group] = uuid.New().String()
+			}
+			shape[libs.ShapeGroupKey] = groups[group]
+		}
+		if points, ok := shape["points"].([]interface{}); ok {
+			for i := range points {
+				if value, ok := points[i].(float64); ok {
+					if i%2 == 0 {
+						points[i] = value + x
+					} else {
+						points[i] = value + y
+					}
+				}
+			}
+		} else {
+			left, _ := shape["x"].(float64)
+			top, _ := shape["y"].(float64)
+			shape["x"], shape["y"] = left+x, top+y
+		}
+		operations = append(operations, models.BoardOperation{Op: models.OpAddShape, ID: shape["id"].(string), Shape: shape})
+	}
+	return operations
+}
@@ -0,0 +1,234 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sarwanazhar/boardsar/backend/converter"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"github.com/sarwanazhar/boardsar/backend/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ImportFromInstance copies the boards the user owns on another BoardSar
+// instance, with their assets, into their account here. The API key is an
+// access token of theirs there; it is checked before starting, and the
+// boards are copied as a background job, answered 202 with the job to
+// follow.
+func ImportFromInstance(c *gin.Context) {
+	type Body struct {
+		URL    string `json:"url" binding:"required"`
+		APIKey string `json:"apiKey" binding:"required"`
+	}
+
+	var body Body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	remote, err := libs.NewRemoteInstance(body.URL, body.APIKey)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(libs.RequestContext(c), 30*time.Second)
+	defer cancel()
+
+	remoteUser, err := remote.Me(ctx)
+	if errors.Is(err, libs.ErrInstanceReachable) {
+		libs.RequestLogger(c).Warn("Failed to reach instance", "instance", remote.Host(), "error", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": libs.ErrInstanceReachable.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	actor := auditActor(c, userID.Hex())
+	logger := slog.With("instance", remote.Host(), "user_id", userID.Hex())
+	repo := libs.BoardRepository(c)
+	_, job, err := libs.RunJob(libs.RequestContext(c), libs.ImportPool, userID, true, func(ctx context.Context) libs.JobResult {
+		return runInstanceImport(ctx, repo, logger, remote, remoteUser.ID, userID, actor)
+	})
+	if err == libs.ErrWorkerPoolFull {
+		respondBusy(c)
+		return
+	}
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to create job", "kind", libs.ImportPool.Name(), "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+		return
+	}
+
+	c.Header("Location", "/api/jobs/"+job.ID.Hex())
+	c.JSON(http.StatusAccepted, jobResponse(job))
+}
+
+// runInstanceImport copies the boards in its job. A board that can't be
+// copied is reported and the rest go on.
+func runInstanceImport(ctx context.Context, repo repository.BoardRepository, logger *slog.Logger, remote *libs.RemoteInstance, remoteUserID string, userID primitive.ObjectID, actor models.AuditActor) libs.JobResult {
+	boards, err := remote.OwnedBoards(ctx, remoteUserID)
+	if err != nil {
+		logger.Warn("Failed to list boards on instance", "error", err)
+		return libs.JSONResult(http.StatusBadGateway, gin.H{"error": "Failed to list your boards on the instance: " + err.Error()})
+	}
+	libs.ReportJobProgress(ctx, 5)
+
+	imported := []gin.H{}
+	failed := []gin.H{}
+	for i, summary := range boards {
+		if ctx.Err() != nil {
+			failed = append(failed, gin.H{"sourceId": summary.ID, "name": summary.Name, "error": "The import ran out of time"})
+			continue
+		}
+		result, err := importInstanceBoard(ctx, repo, remote, summary, userID, actor)
+		if err != nil {
+			failed = append(failed, gin.H{"sourceId": summary.ID, "name": summary.Name, "error": err.Error()})
+		} else {
+			imported = append(imported, result)
+		}
+		libs.ReportJobProgress(ctx, 5+90*(i+1)/len(boards))
+	}
+
+	logger.Info("Imported boards from instance", "imported", len(imported), "failed", len(failed))
+	return libs.JSONResult(http.StatusOK, gin.H{
+		"instance": remote.Host(),
+		"imported": imported,
+		"failed":   failed,
+	})
+}
+
+// importInstanceBoard copies one board and its assets, and returns what
+// was imported
+func importInstanceBoard(ctx context.Context, repo repository.BoardRepository, remote *libs.RemoteInstance, summary libs.RemoteBoardSummary, userID primitive.ObjectID, actor models.AuditActor) (gin.H, error) {
+	exported, err := remote.ExportBoard(ctx, summary.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := libs.ValidateBoardShapes(exported.Board); err != nil {
+		return nil, err
+	}
+
+	size := libs.BoardDataSize(exported.Board)
+	if err := libs.CheckBoardSize(size); err != nil {
+		return nil, err
+	}
+	dbCtx, cancel := context.WithTimeout(ctx, libs.Settings().DBTimeout)
+	usage, err := libs.GetQuotaUsage(dbCtx, userID, primitive.NilObjectID)
+	cancel()
+	if err != nil {
+		return nil, errors.New("Failed to check quota: " + err.Error())
+	}
+	if _, quotaErr := libs.ApplyQuota(libs.JobHeaders{}, usage, 1, size); quotaErr != "" {
+		return nil, errors.New(quotaErr)
+	}
+
+	name := exported.Name
+	if name == "" {
+		name = summary.Name
+	}
+	board := models.Board{
+		ID:          primitive.NewObjectID(),
+		BoardID:     uuid.New().String(),
+		Name:        name,
+		Description: exported.Description,
+		OwnerID:     userID,
+		BoardData:   exported.Board,
+		Tags:        libs.NormalizeTags(summary.Tags),
+		Version:     1,
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+	}
+	assets, report := copyInstanceAssets(ctx, remote, &board, userID)
+
+	details := map[string]interface{}{"importedFrom": "instance", "instance": remote.Host(), "sourceBoardId": summary.ID}
+	if err := createImportedBoard(ctx, repo, &board, actor, details); err != nil {
+		return nil, errors.New("Failed to create board: " + err.Error())
+	}
+
+	shapes, _ := libs.ShapeList(board.BoardData)
+	return gin.H{
+		"sourceId": summary.ID,
+		"board":    transformBoardToFrontend(&board),
+		"shapes":   len(shapes),
+		"assets":   assets,
+		"report":   report,
+	}, nil
+}
+
+// copyInstanceAssets copies the assets of the board's shapes from the
+// instance and points the shapes at the copies, returning how many were
+// copied. Like importImages, shapes whose asset can't be copied are left
+// out and reported.
+func copyInstanceAssets(ctx context.Context, remote *libs.RemoteInstance, board *models.Board, userID primitive.ObjectID) (int, []converter.ReportItem) {
+	report := []converter.ReportItem{}
+	copied := map[string]*models.Asset{}
+	failed := map[string]error{}
+
+	shapes, ok := libs.ShapeList(board.BoardData)
+	if !ok {
+		return 0, report
+	}
+	kept := make([]interface{}, 0, len(shapes))
+	for _, item := range shapes {
+		shape, _ := item.(map[string]interface{})
+		assetID, _ := shape["assetId"].(string)
+		if assetID == "" {
+			kept = append(kept, item)
+			continue
+		}
+
+		asset, done := copied[assetID]
+		err, failedBefore := failed[assetID]
+		if !done && !failedBefore {
+			if len(copied)+len(failed) >= libs.MaxImportImages {
+				err = libs.ErrTooManyImportImages
+			} else {
+				asset, err = copyInstanceAsset(ctx, remote, board, userID, assetID)
+			}
+			if err != nil {
+				failed[assetID] = err
+			} else {
+				copied[assetID] = asset
+			}
+		}
+		if err != nil {
+			id, _ := shape["id"].(string)
+			kind, _ := shape["type"].(string)
+			report = append(report, converter.ReportItem{ID: id, Type: kind, Reason: err.Error()})
+			continue
+		}
+
+		shape["src"] = asset.URL
+		shape["assetId"] = asset.ID.Hex()
+		kept = append(kept, item)
+	}
+	board.BoardData["shapes"] = kept
+	return len(copied), report
+}
+
+// copyInstanceAsset fetches one asset and stores it for the board
+func copyInstanceAsset(ctx context.Context, remote *libs.RemoteInstance, board *models.Board, userID primitive.ObjectID, assetID string) (*models.Asset, error) {
+	data, filename, err := remote.FetchAsset(ctx, assetID)
+	if err != nil {
+		return nil, err
+	}
+
+	assetCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	return libs.CreateAsset(assetCtx, board, userID, filename, data)
+}
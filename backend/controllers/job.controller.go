@@ -0,0 +1,202 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// busyRetryAfter is how many seconds clients are asked to wait when a
+// worker pool is full
+const busyRetryAfter = "5"
+
+// jobEventInterval is how often job event streams check for progress
+const jobEventInterval = 500 * time.Millisecond
+
+// GetJob reports the status of one of your jobs
+func GetJob(c *gin.Context) {
+	job, ok := findJob(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, jobResponse(job))
+}
+
+// GetJobResult sends the response of one of your finished jobs, as the
+// request that started it would have
+func GetJobResult(c *gin.Context) {
+	job, ok := findJob(c)
+	if !ok {
+		return
+	}
+
+	switch {
+	case job.Status == models.JobPending:
+		c.JSON(http.StatusConflict, gin.H{"error": "The job hasn't finished yet"})
+		return
+	case job.Result == nil:
+		c.JSON(http.StatusGone, gin.H{"error": job.Error})
+		return
+	}
+
+	for key, value := range job.Headers {
+		c.Header(key, value)
+	}
+	if job.Filename != "" {
+		c.Header("Content-Disposition", `attachment; filename="`+job.Filename+`"`)
+	}
+	c.Data(job.StatusCode, job.ContentType, job.Result)
+}
+
+// StreamJobEvents follows one of your jobs as server-sent events: a
+// "progress" event with the job's status now and whenever its progress
+// changes, then a "done" event once it has finished. EventSource can't set
+// headers, so the JWT may also be passed as ?token=.
+func StreamJobEvents(c *gin.Context) {
+	tokenString := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if tokenString == "" {
+		tokenString = c.Query("token")
+	}
+	if tokenString == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization token required"})
+		return
+	}
+	claims, err := libs.VerifyJWT(libs.RequestContext(c), tokenString)
+	if err != nil {
+		c.JSON(libs.TokenErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.Set("userId", claims.UserID)
+
+	job, ok := findJob(c)
+	if !ok {
+		return
+	}
+
+	// The stream lasts as long as the job, past the server's write timeout
+	http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+
+	ticker := time.NewTicker(jobEventInterval)
+	defer ticker.Stop()
+
+	sent := -1
+	for {
+		if job.Status != models.JobPending {
+			c.SSEvent("done", jobResponse(job))
+			c.Writer.Flush()
+			return
+		}
+		if job.Progress != sent {
+			c.SSEvent("progress", jobResponse(job))
+			c.Writer.Flush()
+			sent = job.Progress
+		}
+
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := libs.DBContext(c)
+		job, err = libs.FindJob(ctx, job.ID, job.UserID)
+		cancel()
+		if err != nil {
+			// Expired, or the database is unreachable; the client can poll
+			// the job instead
+			c.SSEvent("error", gin.H{"error": "Failed to retrieve job"})
+			c.Writer.Flush()
+			return
+		}
+	}
+}
+
+func findJob(c *gin.Context) (*models.Job, bool) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return nil, false
+	}
+	jobID, err := primitive.ObjectIDFromHex(c.Param("jobId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid job ID"})
+		return nil, false
+	}
+
+	ctx, cancel := libs.DBContextWithin(c, 10*time.Second)
+	defer cancel()
+
+	job, err := libs.FindJob(ctx, jobID, userID)
+	if err == libs.ErrJobNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found or expired"})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve job: " + err.Error()})
+		return nil, false
+	}
+	return job, true
+}
+
+func jobResponse(job *models.Job) gin.H {
+	return gin.H{
+		"jobId":      job.ID.Hex(),
+		"kind":       job.Kind,
+		"status":     job.Status,
+		"progress":   job.Progress,
+		"statusCode": job.StatusCode,
+		"error":      job.Error,
+		"createdAt":  job.CreatedAt,
+		"finishedAt": job.FinishedAt,
+		"expiresAt":  job.ExpiresAt,
+		"statusUrl":  "/api/jobs/" + job.ID.Hex(),
+		"resultUrl":  "/api/jobs/" + job.ID.Hex() + "/result",
+		"eventsUrl":  "/api/jobs/" + job.ID.Hex() + "/events",
+	}
+}
+
+// runJob runs work in the pool and responds with its result, or with 202
+// and the job to follow if it outruns the synchronous budget or the client
+// sent Prefer: respond-async. work must not use c, which is done with once
+// the response is sent.
+func runJob(c *gin.Context, pool *libs.WorkerPool, userID primitive.ObjectID, work func(context.Context) libs.JobResult) {
+	async := strings.Contains(c.GetHeader("Prefer"), "respond-async")
+	result, job, err := libs.RunJob(libs.RequestContext(c), pool, userID, async, work)
+	switch {
+	case err == libs.ErrWorkerPoolFull:
+		respondBusy(c)
+	case err != nil:
+		libs.RequestLogger(c).Error("Failed to create job", "kind", pool.Name(), "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+	case job != nil:
+		if async {
+			c.Header("Preference-Applied", "respond-async")
+		}
+		c.Header("Location", "/api/jobs/"+job.ID.Hex())
+		c.JSON(http.StatusAccepted, jobResponse(job))
+	default:
+		for key, value := range result.Headers {
+			c.Header(key, value)
+		}
+		if result.Filename != "" {
+			c.Header("Content-Disposition", `attachment; filename="`+result.Filename+`"`)
+		}
+		c.Data(result.StatusCode, result.ContentType, result.Body)
+	}
+}
+
+// respondBusy answers a request turned away by a full worker pool
+func respondBusy(c *gin.Context) {
+	c.Header("Retry-After", busyRetryAfter)
+	c.JSON(http.StatusServiceUnavailable, gin.H{"error": libs.ErrWorkerPoolFull.Error()})
+}
@@ -0,0 +1,85 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/converter"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"github.com/sarwanazhar/boardsar/backend/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxLayoutOperations is as many operations as PATCH takes in one batch
+const maxLayoutOperations = 500
+
+// LayoutShapes lays out the selected shapes and connectors of a board with
+// a hierarchical, force-directed or grid layout. Nothing is changed on the
+// board: the answer is the operation batch moving them, to apply with PATCH
+// at the version it was computed for, and the batch undoing it.
+func LayoutShapes(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req models.LayoutRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+
+	// Laying out runs in the import pool, like diagram imports
+	boardID := c.Param("boardId")
+	boards := libs.BoardRepository(c)
+	runJob(c, libs.ImportPool, userID, func(ctx context.Context) libs.JobResult {
+		return layoutShapes(ctx, boards, userID, boardID, req)
+	})
+}
+
+// layoutShapes computes the layout on the board as the user sees it,
+// returning the response
+func layoutShapes(ctx context.Context, boards repository.BoardRepository, userID primitive.ObjectID, boardID string, req models.LayoutRequest) libs.JobResult {
+	dbCtx, cancel := context.WithTimeout(ctx, libs.Settings().DBTimeout)
+	defer cancel()
+
+	board, failure, ok := findImportBoard(dbCtx, boards, userID, boardID, true)
+	if !ok {
+		return failure
+	}
+	libs.ReportJobProgress(ctx, 30)
+
+	operations, undo, err := libs.LayoutShapes(libs.VisibleBoardData(board.BoardData, userID), req.ShapeIDs, converter.LayoutOptions{
+		Algorithm: req.Algorithm,
+		Direction: req.Direction,
+		Columns:   req.Columns,
+	})
+	if errors.Is(err, converter.ErrNothingToLayout) || errors.Is(err, converter.ErrTooManyBoxes) {
+		return libs.JSONResult(http.StatusBadRequest, gin.H{"error": err.Error()})
+	}
+	if err != nil {
+		return libs.JSONResult(http.StatusInternalServerError, gin.H{"error": "Failed to lay out shapes: " + err.Error()})
+	}
+	if len(operations) > maxLayoutOperations {
+		return libs.JSONResult(http.StatusBadRequest, gin.H{"error": "The layout moves too many shapes to apply at once; select fewer"})
+	}
+	if operations == nil {
+		operations, undo = []models.BoardOperation{}, []models.BoardOperation{}
+	}
+
+	response := libs.JSONResult(http.StatusOK, gin.H{
+		"algorithm":       req.Algorithm,
+		"operations":      operations,
+		"undo":            undo,
+		"expectedVersion": board.Version,
+	})
+	response.Headers = libs.JobHeaders{}
+	response.Headers.Header("ETag", boardETag(board.Version))
+	return response
+}
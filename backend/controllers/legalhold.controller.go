@@ -0,0 +1,191 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"github.com/sarwanazhar/boardsar/backend/repository"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// CreateLegalHold places a legal hold on a board or a user (admin only)
+func CreateLegalHold(c *gin.Context) {
+	var req models.LegalHoldRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+
+	adminID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid user ID",
+		})
+		return
+	}
+
+	targetID, err := primitive.ObjectIDFromHex(req.TargetID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid target ID",
+		})
+		return
+	}
+
+	if req.ExpiresAt != nil && req.ExpiresAt.Before(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "expiresAt must be in the future",
+		})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	// Make sure the target actually exists before holding it
+	if req.TargetType == models.LegalHoldTargetBoard {
+		_, err = libs.BoardRepository(c).FindByID(ctx, targetID)
+	} else {
+		_, err = libs.Users().FindByID(ctx, targetID)
+	}
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Target not found",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to look up target: " + err.Error(),
+		})
+		return
+	}
+
+	hold := models.LegalHold{
+		ID:         primitive.NewObjectID(),
+		TargetType: req.TargetType,
+		TargetID:   targetID,
+		Reason:     req.Reason,
+		PlacedBy:   adminID,
+		CreatedAt:  time.Now(),
+		ExpiresAt:  req.ExpiresAt,
+	}
+
+	_, err = libs.GetLegalHoldCollection().InsertOne(ctx, hold)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to create legal hold: " + err.Error(),
+		})
+		return
+	}
+
+	recordAudit(c, models.AuditLegalHoldPlaced, models.AuditTargetLegalHold, hold.ID.Hex(), map[string]interface{}{
+		"targetType": hold.TargetType,
+		"targetId":   hold.TargetID.Hex(),
+		"reason":     hold.Reason,
+	})
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Legal hold placed successfully",
+		"hold":    hold,
+	})
+}
+
+// GetLegalHolds lists legal holds, optionally only the active ones (admin only)
+func GetLegalHolds(c *gin.Context) {
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	filter := bson.M{}
+	if c.Query("active") == "true" {
+		filter = bson.M{
+			"releasedAt": bson.M{"$exists": false},
+			"$or": bson.A{
+				bson.M{"expiresAt": bson.M{"$exists": false}},
+				bson.M{"expiresAt": bson.M{"$gt": time.Now()}},
+			},
+		}
+	}
+
+	cursor, err := libs.GetLegalHoldCollection().Find(ctx, filter, options.Find().SetSort(bson.M{"createdAt": -1}))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to retrieve legal holds: " + err.Error(),
+		})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	holds := []models.LegalHold{}
+	if err = cursor.All(ctx, &holds); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to decode legal holds: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"holds": holds,
+	})
+}
+
+// ReleaseLegalHold lifts a legal hold. The record is kept for auditing.
+func ReleaseLegalHold(c *gin.Context) {
+	holdID, err := primitive.ObjectIDFromHex(c.Param("holdId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid hold ID",
+		})
+		return
+	}
+
+	adminID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid user ID",
+		})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	update := bson.M{
+		"$set": bson.M{
+			"releasedAt": time.Now(),
+			"releasedBy": adminID,
+		},
+	}
+
+	result, err := libs.GetLegalHoldCollection().UpdateOne(ctx, bson.M{
+		"_id":        holdID,
+		"releasedAt": bson.M{"$exists": false},
+	}, update)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to release legal hold: " + err.Error(),
+		})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Active legal hold not found",
+		})
+		return
+	}
+
+	recordAudit(c, models.AuditLegalHoldReleased, models.AuditTargetLegalHold, holdID.Hex(), nil)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Legal hold released successfully",
+		"holdId":  holdID.Hex(),
+	})
+}
@@ -0,0 +1,135 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"github.com/sarwanazhar/boardsar/backend/repository"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// LintBoard runs spellcheck and terminology lint over the text of the
+// board's shapes, using the board owner's dictionary. Nothing is changed on
+// the board.
+func LintBoard(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	board, err := libs.BoardRepository(c).FindForUser(ctx, c.Param("boardId"), userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Board not found or access denied"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve board: " + err.Error()})
+		return
+	}
+
+	dictionary, err := libs.FindLintDictionary(ctx, board.OwnerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load dictionary: " + err.Error()})
+		return
+	}
+
+	issues := []models.LintIssue{}
+	list, _ := libs.ShapeList(libs.VisibleBoardData(board.BoardData, userID))
+	for _, item := range list {
+		shape, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		id, _ := shape["id"].(string)
+		for _, field := range libs.LintTextFields {
+			if text, ok := shape[field].(string); ok && text != "" {
+				issues = append(issues, libs.LintText(id, field, text, dictionary)...)
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"issues": issues,
+		"count":  len(issues),
+	})
+}
+
+// GetLintDictionary returns the authenticated user's lint dictionary
+func GetLintDictionary(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	dictionary, err := libs.FindLintDictionary(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load dictionary: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, dictionary)
+}
+
+// UpdateLintDictionary replaces the authenticated user's accepted words and
+// terminology rules, which apply to lint runs on all their boards
+func UpdateLintDictionary(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req models.LintDictionaryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+
+	words := []string{}
+	for _, word := range req.Words {
+		if word = strings.TrimSpace(word); word != "" {
+			words = append(words, word)
+		}
+	}
+	terms := req.Terms
+	if terms == nil {
+		terms = []models.TermRule{}
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	var dictionary models.LintDictionary
+	err = libs.GetLintDictionaryCollection().FindOneAndUpdate(ctx,
+		bson.M{"ownerId": userID},
+		bson.M{"$set": bson.M{
+			"words":     words,
+			"terms":     terms,
+			"updatedAt": time.Now(),
+		}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&dictionary)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save dictionary: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, dictionary)
+}
@@ -0,0 +1,387 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// CreateOAuthClient registers a third-party app. The client secret is only
+// returned here.
+func CreateOAuthClient(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req models.OAuthClientRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	client, secret, err := libs.CreateOAuthClient(ctx, userID, req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register app: " + err.Error()})
+		return
+	}
+
+	recordAudit(c, models.AuditOAuthClientCreated, models.AuditTargetOAuthClient, client.ID.Hex(), map[string]interface{}{
+		"scopes": client.Scopes,
+	})
+
+	response := gin.H{
+		"message": "App registered successfully",
+		"client":  client,
+	}
+	if secret != "" {
+		response["clientSecret"] = secret
+	}
+	c.JSON(http.StatusCreated, response)
+}
+
+// GetOAuthClients lists the apps the user registered
+func GetOAuthClients(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	cursor, err := libs.GetOAuthClientCollection().Find(ctx,
+		bson.M{"ownerId": userID},
+		options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve apps: " + err.Error()})
+		return
+	}
+	clients := []models.OAuthClient{}
+	if err := cursor.All(ctx, &clients); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode apps: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"clients": clients})
+}
+
+// DeleteOAuthClient removes an app the user registered, signing it out of
+// every account it was connected to
+func DeleteOAuthClient(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	client, err := libs.FindOAuthClient(ctx, c.Param("clientId"))
+	if err == libs.ErrInvalidOAuthClient || (err == nil && client.OwnerID != userID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "App not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve app: " + err.Error()})
+		return
+	}
+
+	if err := libs.DeleteOAuthClient(ctx, client.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete app: " + err.Error()})
+		return
+	}
+
+	recordAudit(c, models.AuditOAuthClientDeleted, models.AuditTargetOAuthClient, client.ID.Hex(), nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "App deleted successfully"})
+}
+
+// GetOAuthAuthorization checks an app's authorization request and describes
+// it for the consent screen. The frontend passes the query string it was
+// opened with.
+func GetOAuthAuthorization(c *gin.Context) {
+	var req models.OAuthAuthorizeRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid authorization request: " + err.Error()})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	client, scopes, ok := validateAuthorizeRequest(ctx, c, req)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"client": gin.H{"clientId": client.ID, "name": client.Name},
+		"scopes": scopes,
+	})
+}
+
+// ApproveOAuthAuthorization records the user's approval and returns the
+// redirect URI, carrying the authorization code and state, to send the
+// browser back to the app. A denial is redirected by the consent screen
+// itself with error=access_denied.
+func ApproveOAuthAuthorization(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req models.OAuthAuthorizeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid authorization request: " + err.Error()})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	client, scopes, ok := validateAuthorizeRequest(ctx, c, req)
+	if !ok {
+		return
+	}
+
+	code, err := libs.CreateOAuthCode(ctx, client, userID, req, scopes)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to authorize app: " + err.Error()})
+		return
+	}
+
+	recordAudit(c, models.AuditOAuthGrantApproved, models.AuditTargetOAuthClient, client.ID.Hex(), map[string]interface{}{
+		"scopes": scopes,
+	})
+
+	redirect, _ := url.Parse(req.RedirectURI)
+	query := redirect.Query()
+	query.Set("code", code)
+	if req.State != "" {
+		query.Set("state", req.State)
+	}
+	redirect.RawQuery = query.Encode()
+
+	c.JSON(http.StatusOK, gin.H{"redirectUri": redirect.String(), "scopes": scopes})
+}
+
+// validateAuthorizeRequest answers 400 for requests that can't be sent back
+// to the app, since their client or redirect URI can't be trusted
+func validateAuthorizeRequest(ctx context.Context, c *gin.Context, req models.OAuthAuthorizeRequest) (*models.OAuthClient, []string, bool) {
+	client, scopes, err := libs.ValidateAuthorizeRequest(ctx, req)
+	switch err {
+	case nil:
+		return client, scopes, true
+	case libs.ErrInvalidOAuthClient, libs.ErrInvalidRedirectURI, libs.ErrInvalidScope, libs.ErrPKCERequired, libs.ErrInvalidPKCEMethod:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate authorization request: " + err.Error()})
+	}
+	return nil, nil, false
+}
+
+// GetOAuthGrants lists the apps connected to the user's account and the
+// scopes they were granted
+func GetOAuthGrants(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	cursor, err := libs.GetOAuthGrantCollection().Find(ctx,
+		bson.M{"userId": userID},
+		options.Find().SetSort(bson.D{{Key: "updatedAt", Value: -1}}),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve connected apps: " + err.Error()})
+		return
+	}
+	grants := []models.OAuthGrant{}
+	if err := cursor.All(ctx, &grants); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode connected apps: " + err.Error()})
+		return
+	}
+
+	clientIDs := make([]primitive.ObjectID, 0, len(grants))
+	for _, grant := range grants {
+		clientIDs = append(clientIDs, grant.ClientID)
+	}
+	names := map[primitive.ObjectID]string{}
+	clientCursor, err := libs.GetOAuthClientCollection().Find(ctx,
+		bson.M{"_id": bson.M{"$in": clientIDs}},
+		options.Find().SetProjection(bson.M{"name": 1}),
+	)
+	if err == nil {
+		var clients []models.OAuthClient
+		if err := clientCursor.All(ctx, &clients); err == nil {
+			for _, client := range clients {
+				names[client.ID] = client.Name
+			}
+		}
+	}
+
+	apps := make([]gin.H, 0, len(grants))
+	for _, grant := range grants {
+		apps = append(apps, gin.H{
+			"clientId":  grant.ClientID,
+			"name":      names[grant.ClientID],
+			"scopes":    grant.Scopes,
+			"createdAt": grant.CreatedAt,
+			"updatedAt": grant.UpdatedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"apps": apps})
+}
+
+// RevokeOAuthGrant disconnects an app from the user's account. Its refresh
+// tokens stop working at once; access tokens already issued expire on
+// their own.
+func RevokeOAuthGrant(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	clientID, err := primitive.ObjectIDFromHex(c.Param("clientId"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "App is not connected"})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	found, err := libs.RevokeOAuthGrant(ctx, userID, clientID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disconnect app: " + err.Error()})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "App is not connected"})
+		return
+	}
+
+	recordAudit(c, models.AuditOAuthGrantRevoked, models.AuditTargetOAuthClient, clientID.Hex(), nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "App disconnected successfully"})
+}
+
+// OAuthToken is the OAuth2 token endpoint (RFC 6749). Apps exchange an
+// authorization code, or rotate a refresh token, for a scoped access token.
+// Parameters are form-encoded; confidential clients authenticate with HTTP
+// Basic or client_id/client_secret. Errors use the OAuth error format.
+func OAuthToken(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+
+	clientID, secret, ok := c.Request.BasicAuth()
+	if !ok {
+		clientID = c.PostForm("client_id")
+		secret = c.PostForm("client_secret")
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	client, err := libs.AuthenticateOAuthClient(ctx, clientID, secret)
+	if err == libs.ErrInvalidOAuthClient {
+		oauthError(c, http.StatusUnauthorized, "invalid_client", err.Error())
+		return
+	}
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to authenticate OAuth client", "error", err)
+		oauthError(c, http.StatusInternalServerError, "server_error", "Could not authenticate client")
+		return
+	}
+
+	var userID primitive.ObjectID
+	var scopes []string
+	var refreshToken string
+
+	switch c.PostForm("grant_type") {
+	case "authorization_code":
+		code, err := libs.RedeemOAuthCode(ctx, c.PostForm("code"), client.ID, c.PostForm("redirect_uri"), c.PostForm("code_verifier"))
+		if err == libs.ErrInvalidOAuthCode {
+			oauthError(c, http.StatusBadRequest, "invalid_grant", err.Error())
+			return
+		}
+		if err != nil {
+			libs.RequestLogger(c).Error("Failed to redeem authorization code", "error", err)
+			oauthError(c, http.StatusInternalServerError, "server_error", "Could not redeem authorization code")
+			return
+		}
+		userID, scopes = code.UserID, code.Scopes
+
+		refreshToken, err = libs.IssueClientRefreshToken(ctx, userID, client.ID, scopes)
+		if err != nil {
+			libs.RequestLogger(c).Error("Failed to issue refresh token", "error", err)
+			oauthError(c, http.StatusInternalServerError, "server_error", "Could not issue refresh token")
+			return
+		}
+
+	case "refresh_token":
+		stored, next, err := libs.RotateRefreshToken(ctx, c.PostForm("refresh_token"), client.ID)
+		if err == libs.ErrInvalidRefreshToken {
+			oauthError(c, http.StatusBadRequest, "invalid_grant", err.Error())
+			return
+		}
+		if err != nil {
+			libs.RequestLogger(c).Error("Failed to rotate refresh token", "error", err)
+			oauthError(c, http.StatusInternalServerError, "server_error", "Could not refresh token")
+			return
+		}
+		userID, scopes, refreshToken = stored.UserID, stored.Scopes, next
+
+	default:
+		oauthError(c, http.StatusBadRequest, "unsupported_grant_type", "grant_type must be authorization_code or refresh_token")
+		return
+	}
+
+	user, err := libs.FindUserByID(ctx, userID.Hex())
+	if err != nil {
+		oauthError(c, http.StatusBadRequest, "invalid_grant", "The user no longer exists")
+		return
+	}
+	token, err := libs.GenerateScopedJWT(userID.Hex(), client.ID.Hex(), scopes, user.TokenVersion)
+	if err != nil {
+		oauthError(c, http.StatusInternalServerError, "server_error", "Could not generate token")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"access_token":  token,
+		"token_type":    "Bearer",
+		"expires_in":    int(libs.AccessTokenTTL().Seconds()),
+		"refresh_token": refreshToken,
+		"scope":         strings.Join(scopes, " "),
+	})
+}
+
+// oauthError answers in the error format OAuth clients expect
+func oauthError(c *gin.Context, status int, code, description string) {
+	c.JSON(status, gin.H{"error": code, "error_description": description})
+}
@@ -0,0 +1,63 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// GetBoardOutline returns a screen-reader friendly outline of the board:
+// frames, then groups, then text, in reading order. JSON by default, with
+// the board's sections as well, or an HTML document with ?format=html.
+func GetBoardOutline(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "html" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json or html"})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	board, err := libs.BoardRepository(c).FindForUser(ctx, c.Param("boardId"), userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Board not found or access denied"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve board: " + err.Error()})
+		return
+	}
+
+	visible := libs.VisibleBoardData(board.BoardData, userID)
+	shapes, _ := libs.ShapeList(visible)
+	outline := libs.BuildOutline(shapes)
+
+	if format == "html" {
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(libs.OutlineHTML(boardDisplayName(board.Name, board.BoardID), outline)))
+		return
+	}
+
+	collapsed, err := libs.CollapsedSections(ctx, userID, board.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve sections: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"title":    boardDisplayName(board.Name, board.BoardID),
+		"items":    outline.Items,
+		"drawings": outline.Drawings,
+		"sections": libs.SummarizeSections(board.Sections, visible, collapsed),
+	})
+}
@@ -0,0 +1,355 @@
+package controllers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxPasskeyNameLength bounds device names
+const maxPasskeyNameLength = 64
+
+// BeginPasskeyRegistration returns the options to create a passkey for the
+// signed-in user with navigator.credentials.create()
+func BeginPasskeyRegistration(c *gin.Context) {
+	user, err := libs.FindUserByID(libs.RequestContext(c), c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	opts, err := libs.BeginPasskeyRegistration(ctx, user)
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to start passkey registration", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"publicKey": opts})
+}
+
+// FinishPasskeyRegistration verifies the new credential and saves it with
+// a device name
+func FinishPasskeyRegistration(c *gin.Context) {
+	type Body struct {
+		Name       string                   `json:"name"`
+		Credential models.PasskeyCredential `json:"credential" binding:"required"`
+	}
+
+	var body Body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	name, ok := passkeyName(c, body.Name)
+	if !ok {
+		return
+	}
+
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	passkey, err := libs.FinishPasskeyRegistration(ctx, userID, name, body.Credential)
+	if err == libs.ErrInvalidWebAuthnChallenge || errors.Is(err, libs.ErrInvalidPasskey) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err == libs.ErrPasskeyInUse {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to register passkey", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+		return
+	}
+
+	recordAudit(c, models.AuditPasskeyRegistered, models.AuditTargetUser, userID.Hex(),
+		map[string]interface{}{"passkeyId": passkey.ID.Hex(), "name": passkey.Name})
+
+	c.JSON(http.StatusCreated, gin.H{"passkey": passkey})
+}
+
+// BeginPasskeyLogin returns the options for navigator.credentials.get().
+// With an email the user's passkeys are listed; unknown emails get the
+// same answer as no email, so accounts can't be probed.
+func BeginPasskeyLogin(c *gin.Context) {
+	type Body struct {
+		Email string `json:"email"`
+	}
+
+	var body Body
+	if err := c.ShouldBindJSON(&body); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user *models.User
+	if body.Email != "" {
+		user, _ = libs.FindUserByEmail(libs.RequestContext(c), body.Email)
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	opts, err := libs.BeginPasskeyLogin(ctx, user)
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to start passkey sign-in", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"publicKey": opts})
+}
+
+// FinishPasskeyLogin verifies the assertion and signs the passkey's owner
+// in; answers like LoginUser
+func FinishPasskeyLogin(c *gin.Context) {
+	type Body struct {
+		Credential models.PasskeyCredential `json:"credential" binding:"required"`
+	}
+
+	var body Body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	passkey, err := libs.FinishPasskeyLogin(ctx, body.Credential)
+	if err == libs.ErrInvalidWebAuthnChallenge || errors.Is(err, libs.ErrInvalidPasskey) {
+		libs.RecordAudit(libs.RequestContext(c), models.AuditEvent{
+			Action:  models.AuditLoginFailed,
+			Outcome: models.AuditOutcomeFailure,
+			Actor:   auditActor(c, ""),
+			Details: map[string]interface{}{"method": "passkey", "reason": err.Error()},
+		})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to verify passkey", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+		return
+	}
+
+	user, err := libs.FindUserByID(libs.RequestContext(c), passkey.UserID.Hex())
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": libs.ErrInvalidPasskey.Error()})
+		return
+	}
+
+	startSession(c, user, map[string]interface{}{"method": "passkey", "passkeyId": passkey.ID.Hex()})
+}
+
+// GetPasskeys lists your passkeys and whether passwordless sign-in is on
+func GetPasskeys(c *gin.Context) {
+	user, err := libs.FindUserByID(libs.RequestContext(c), c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	passkeys, err := libs.ListPasskeys(ctx, user.ID)
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to list passkeys", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"passkeys":     passkeys,
+		"passwordless": user.Passwordless,
+	})
+}
+
+// RenamePasskey changes a passkey's device name
+func RenamePasskey(c *gin.Context) {
+	type Body struct {
+		Name string `json:"name" binding:"required"`
+	}
+
+	var body Body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	name, ok := passkeyName(c, body.Name)
+	if !ok {
+		return
+	}
+
+	userID, passkeyID, ok := passkeyParams(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	err := libs.RenamePasskey(ctx, userID, passkeyID, name)
+	if err == libs.ErrPasskeyNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to rename passkey", "passkey_id", passkeyID.Hex(), "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"id": passkeyID.Hex(), "name": name})
+}
+
+// DeletePasskey removes a passkey. The last one can't be removed while
+// passwordless sign-in is on, or when it's the account's only way to sign
+// in.
+func DeletePasskey(c *gin.Context) {
+	userID, passkeyID, ok := passkeyParams(c)
+	if !ok {
+		return
+	}
+
+	user, err := libs.FindUserByID(libs.RequestContext(c), userID.Hex())
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	passkeys, err := libs.ListPasskeys(ctx, userID)
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to list passkeys", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+		return
+	}
+	if len(passkeys) == 1 && passkeys[0].ID == passkeyID {
+		if user.Passwordless {
+			c.JSON(http.StatusConflict, gin.H{"error": "Turn off passwordless sign-in before removing your last passkey"})
+			return
+		}
+		identities, err := libs.ListIdentities(ctx, userID)
+		if err != nil {
+			libs.RequestLogger(c).Error("Failed to list identities", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+			return
+		}
+		if user.Password == "" && len(identities) == 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "Set a password or link a provider before removing your only passkey"})
+			return
+		}
+	}
+
+	err = libs.DeletePasskey(ctx, userID, passkeyID)
+	if err == libs.ErrPasskeyNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to delete passkey", "passkey_id", passkeyID.Hex(), "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+		return
+	}
+
+	recordAudit(c, models.AuditPasskeyRemoved, models.AuditTargetUser, userID.Hex(),
+		map[string]interface{}{"passkeyId": passkeyID.Hex()})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Passkey removed", "id": passkeyID.Hex()})
+}
+
+// SetPasswordless turns passwordless sign-in on or off. It needs a passkey:
+// with it on, password login is refused.
+func SetPasswordless(c *gin.Context) {
+	type Body struct {
+		Enabled *bool `json:"enabled" binding:"required"`
+	}
+
+	var body Body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	if *body.Enabled {
+		ctx, cancel := libs.DBContext(c)
+		defer cancel()
+
+		passkeys, err := libs.ListPasskeys(ctx, userID)
+		if err != nil {
+			libs.RequestLogger(c).Error("Failed to list passkeys", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+			return
+		}
+		if len(passkeys) == 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "Add a passkey before going passwordless"})
+			return
+		}
+	}
+
+	if err := libs.UpdateUserPasswordless(libs.RequestContext(c), userID, *body.Enabled); err != nil {
+		libs.RequestLogger(c).Error("Failed to update passwordless sign-in", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+		return
+	}
+
+	recordAudit(c, models.AuditPasswordlessChanged, models.AuditTargetUser, userID.Hex(),
+		map[string]interface{}{"enabled": *body.Enabled})
+
+	c.JSON(http.StatusOK, gin.H{"passwordless": *body.Enabled})
+}
+
+// passkeyName trims a device name, defaulting to "Passkey"; it answers 400
+// itself when the name is too long
+func passkeyName(c *gin.Context, name string) (string, bool) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "Passkey", true
+	}
+	if len([]rune(name)) > maxPasskeyNameLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Passkey name is too long"})
+		return "", false
+	}
+	return name, true
+}
+
+func passkeyParams(c *gin.Context) (primitive.ObjectID, primitive.ObjectID, bool) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return primitive.NilObjectID, primitive.NilObjectID, false
+	}
+	passkeyID, err := primitive.ObjectIDFromHex(c.Param("passkeyId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid passkey ID"})
+		return primitive.NilObjectID, primitive.NilObjectID, false
+	}
+	return userID, passkeyID, true
+}
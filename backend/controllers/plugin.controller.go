@@ -0,0 +1,130 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"github.com/sarwanazhar/boardsar/backend/plugins"
+	"github.com/sarwanazhar/boardsar/backend/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// GetPlugins lists the plugins installed on this server and what they add
+func GetPlugins(c *gin.Context) {
+	installed := []gin.H{}
+	for _, plugin := range plugins.All() {
+		installed = append(installed, pluginResponse(plugin, nil))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"plugins": installed})
+}
+
+// GetBoardPlugins lists the installed plugins with whether each is enabled
+// on the board
+func GetBoardPlugins(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	board, err := libs.BoardRepository(c).WithoutContents().FindForUser(ctx, c.Param("boardId"), userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Board not found or access denied"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve board: " + err.Error()})
+		return
+	}
+
+	installed := []gin.H{}
+	for _, plugin := range plugins.All() {
+		installed = append(installed, pluginResponse(plugin, board))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"plugins": installed})
+}
+
+// SetBoardPlugin switches a plugin on or off for a board. Owner only.
+func SetBoardPlugin(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req models.BoardPluginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+
+	plugin, ok := plugins.Lookup(c.Param("plugin"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Plugin not found"})
+		return
+	}
+	name := plugin.Info().Name
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	board, ok := findOwnedBoard(ctx, c, userID)
+	if !ok {
+		return
+	}
+
+	if board.Plugins == nil {
+		board.Plugins = map[string]bool{}
+	}
+	board.Plugins[name] = *req.Enabled
+	if err := libs.BoardRepository(c).Update(ctx, board.ID, map[string]interface{}{"plugins": board.Plugins}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update plugins: " + err.Error()})
+		return
+	}
+
+	// The realtime session delivers events by the board's switches too
+	boardChanged(ctx, board.ID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Plugin settings updated successfully",
+		"plugin":  pluginResponse(plugin, board),
+	})
+}
+
+// pluginResponse describes a plugin, with its state on the board if given
+func pluginResponse(plugin plugins.Plugin, board *models.Board) gin.H {
+	info := plugin.Info()
+
+	shapeTypes := []string{}
+	if provider, ok := plugin.(plugins.ShapeTypeProvider); ok {
+		for _, shapeType := range provider.ShapeTypes() {
+			shapeTypes = append(shapeTypes, shapeType.Name)
+		}
+	}
+	_, events := plugin.(plugins.EventHandler)
+
+	response := gin.H{
+		"name":             info.Name,
+		"description":      info.Description,
+		"enabledByDefault": info.EnabledByDefault,
+		"shapeTypes":       shapeTypes,
+		"events":           events,
+	}
+	if _, ok := plugin.(plugins.RouteProvider); ok {
+		response["endpoint"] = libs.APIURL() + "/api/ext/" + info.Name
+	}
+	if board != nil {
+		response["enabled"] = plugins.EnabledOn(board, plugin)
+	}
+	return response
+}
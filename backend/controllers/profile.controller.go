@@ -0,0 +1,242 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// avatarCacheControl lets anyone keep an avatar: each upload gets a new URL
+const avatarCacheControl = "public, max-age=31536000, immutable"
+
+// UpdateProfile changes the signed-in user's name, display name or avatar
+// URL. Uploaded avatars no longer in use are removed.
+func UpdateProfile(c *gin.Context) {
+	var req models.ProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	fields := map[string]interface{}{}
+	if req.Name != nil {
+		fields["name"] = strings.TrimSpace(*req.Name)
+	}
+	if req.DisplayName != nil {
+		fields["display_name"] = strings.TrimSpace(*req.DisplayName)
+	}
+	if req.AvatarURL != nil {
+		avatarURL := strings.TrimSpace(*req.AvatarURL)
+		if err := libs.CheckAvatarURL(avatarURL); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		fields["avatar_url"] = avatarURL
+	}
+	if len(fields) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name, displayName or avatarUrl is required"})
+		return
+	}
+
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	user, err := libs.FindUserByID(libs.RequestContext(c), userID.Hex())
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if err := libs.UpdateUserProfile(libs.RequestContext(c), userID, fields); err != nil {
+		libs.RequestLogger(c).Error("Failed to update profile", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update profile"})
+		return
+	}
+	if avatarURL, ok := fields["avatar_url"]; ok && avatarURL != user.AvatarURL {
+		ctx, cancel := libs.DBContextWithin(c, 30*time.Second)
+		defer cancel()
+		if err := libs.DeleteUserAvatars(ctx, userID, primitive.NilObjectID); err != nil {
+			libs.RequestLogger(c).Warn("Failed to delete replaced avatars", "error", err)
+		}
+	}
+
+	user, err = libs.FindUserByID(libs.RequestContext(c), userID.Hex())
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	c.JSON(http.StatusOK, profileResponse(user))
+}
+
+// UploadAvatar stores the signed-in user's avatar from the "file" field of
+// a multipart form, in asset storage, and points their avatarUrl at it
+func UploadAvatar(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	maxSize := libs.MaxAvatarSize()
+	tooLarge := fmt.Sprintf("Image is too large (%d bytes max)", maxSize)
+	// Leave room for the rest of the form
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSize+1<<20)
+	header, err := c.FormFile("file")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": tooLarge})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Upload the image as the \"file\" field of a multipart form"})
+		return
+	}
+	if header.Size > maxSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": tooLarge})
+		return
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid upload: " + err.Error()})
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid upload: " + err.Error()})
+		return
+	}
+
+	ctx, cancel := libs.DBContextWithin(c, 30*time.Second)
+	defer cancel()
+
+	avatar, err := libs.CreateAvatar(ctx, userID, data)
+	switch {
+	case err == libs.ErrUnsupportedAsset:
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": err.Error()})
+		return
+	case err == libs.ErrInvalidAsset || err == libs.ErrAssetDimensions:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		libs.RequestLogger(c).Error("Failed to store avatar", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Avatar uploaded", "avatarUrl": libs.AvatarURL(avatar.ID)})
+}
+
+// DeleteAvatar clears the signed-in user's avatar, removing what they
+// uploaded
+func DeleteAvatar(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ctx, cancel := libs.DBContextWithin(c, 30*time.Second)
+	defer cancel()
+
+	if err := libs.UpdateUserProfile(ctx, userID, map[string]interface{}{"avatar_url": ""}); err != nil {
+		libs.RequestLogger(c).Error("Failed to clear avatar", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not remove avatar"})
+		return
+	}
+	if err := libs.DeleteUserAvatars(ctx, userID, primitive.NilObjectID); err != nil {
+		libs.RequestLogger(c).Warn("Failed to delete avatars", "error", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Avatar removed"})
+}
+
+// GetAvatar serves an uploaded avatar. Avatars show next to boards shared
+// with others, in image tags, so they are served without signing in.
+func GetAvatar(c *gin.Context) {
+	avatarID, err := primitive.ObjectIDFromHex(c.Param("avatarId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid avatar ID"})
+		return
+	}
+
+	ctx, cancel := libs.DBContextWithin(c, 30*time.Second)
+	defer cancel()
+
+	avatar, err := libs.FindAvatar(ctx, avatarID)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Avatar not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve avatar"})
+		return
+	}
+
+	etag := `"` + avatar.SHA256 + `"`
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", avatarCacheControl)
+	if etagMatches(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	data, err := libs.OpenAvatar(ctx, avatar)
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to open avatar", "avatar_id", avatar.ID.Hex(), "error", err)
+		if err == libs.ErrAssetDataNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Avatar not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+		return
+	}
+	defer data.Close()
+
+	c.DataFromReader(http.StatusOK, avatar.Size, avatar.ContentType, data, map[string]string{
+		"X-Content-Type-Options":  "nosniff",
+		"Content-Security-Policy": "default-src 'none'",
+	})
+}
+
+// withCollaboratorProfiles fills in the profiles of the boards'
+// collaborators, looked up together. Without them the boards are still
+// worth answering, so a failed lookup is only logged.
+func withCollaboratorProfiles(ctx context.Context, c *gin.Context, boards []models.FrontendBoard) {
+	seen := map[primitive.ObjectID]bool{}
+	ids := []primitive.ObjectID{}
+	for _, board := range boards {
+		for _, collaborator := range board.Collaborators {
+			if !seen[collaborator.UserID] {
+				seen[collaborator.UserID] = true
+				ids = append(ids, collaborator.UserID)
+			}
+		}
+	}
+
+	profiles, err := libs.UserProfiles(ctx, ids)
+	if err != nil {
+		libs.RequestLogger(c).Warn("Failed to look up collaborator profiles", "error", err)
+		return
+	}
+	for i := range boards {
+		for j := range boards[i].Collaborators {
+			if profile, ok := profiles[boards[i].Collaborators[j].UserID]; ok {
+				boards[i].Collaborators[j].Profile = &profile
+			}
+		}
+	}
+}
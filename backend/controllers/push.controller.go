@@ -0,0 +1,296 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxPushNameLength bounds device names
+const maxPushNameLength = 64
+
+// GetPushPublicKey returns the key browsers subscribe with
+// (applicationServerKey) and the notification kinds devices can choose
+func GetPushPublicKey(c *gin.Context) {
+	publicKey, err := libs.VAPIDPublicKey()
+	if err == libs.ErrWebPushNotConfigured {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to read the VAPID key", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"publicKey": publicKey, "kinds": models.NotificationKinds})
+}
+
+// GetPushSubscriptions lists the user's subscribed devices
+func GetPushSubscriptions(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	subscriptions, err := libs.ListPushSubscriptions(ctx, userID)
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to list push subscriptions", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"subscriptions": subscriptions, "kinds": models.NotificationKinds})
+}
+
+// CreatePushSubscription saves the browser's PushSubscription (its toJSON()
+// form), with an optional device name and the kinds it should receive
+// (all when omitted)
+func CreatePushSubscription(c *gin.Context) {
+	type Body struct {
+		Endpoint string                      `json:"endpoint" binding:"required"`
+		Keys     models.PushSubscriptionKeys `json:"keys" binding:"required"`
+		Name     string                      `json:"name"`
+		Kinds    []string                    `json:"kinds"`
+	}
+
+	var body Body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := libs.ValidatePushEndpoint(c.Request.Context(), body.Endpoint); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := libs.ValidatePushKeys(body.Keys); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	name, ok := pushName(c, body.Name)
+	if !ok {
+		return
+	}
+	kinds, ok := notificationKinds(c, body.Kinds)
+	if !ok {
+		return
+	}
+
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	subscription, err := libs.SavePushSubscription(ctx, &models.PushSubscription{
+		UserID:   userID,
+		Endpoint: body.Endpoint,
+		P256dh:   body.Keys.P256dh,
+		Auth:     body.Keys.Auth,
+		Name:     name,
+		Kinds:    kinds,
+	})
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to save push subscription", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"subscription": subscription})
+}
+
+// UpdatePushSubscription renames a device or changes the kinds of
+// notification it receives. Omitted fields are kept; "kinds": [] means all.
+func UpdatePushSubscription(c *gin.Context) {
+	type Body struct {
+		Name  *string   `json:"name"`
+		Kinds *[]string `json:"kinds"`
+	}
+
+	var body Body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	update := bson.M{}
+	if body.Name != nil {
+		name, ok := pushName(c, *body.Name)
+		if !ok {
+			return
+		}
+		update["name"] = name
+	}
+	if body.Kinds != nil {
+		kinds, ok := notificationKinds(c, *body.Kinds)
+		if !ok {
+			return
+		}
+		update["kinds"] = kinds
+	}
+	if len(update) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name or kinds is required"})
+		return
+	}
+
+	userID, subscriptionID, ok := pushSubscriptionParams(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	subscription, err := libs.UpdatePushSubscription(ctx, userID, subscriptionID, update)
+	if err == libs.ErrPushSubscriptionNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to update push subscription", "subscription_id", subscriptionID.Hex(), "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"subscription": subscription})
+}
+
+// DeletePushSubscription unsubscribes a device
+func DeletePushSubscription(c *gin.Context) {
+	userID, subscriptionID, ok := pushSubscriptionParams(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	err := libs.DeletePushSubscription(ctx, userID, subscriptionID)
+	if err == libs.ErrPushSubscriptionNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to delete push subscription", "subscription_id", subscriptionID.Hex(), "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Push subscription removed"})
+}
+
+// TestPushSubscription sends a test notification to a device right away
+// and reports whether its push service took it
+func TestPushSubscription(c *gin.Context) {
+	userID, subscriptionID, ok := pushSubscriptionParams(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := libs.DBContextWithin(c, 15*time.Second)
+	defer cancel()
+
+	subscription, err := libs.FindPushSubscription(ctx, userID, subscriptionID)
+	if err == libs.ErrPushSubscriptionNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to load push subscription", "subscription_id", subscriptionID.Hex(), "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+		return
+	}
+
+	locale := libs.DefaultLocale
+	if user, err := libs.FindUserByID(ctx, userID.Hex()); err == nil {
+		locale = userLocale(user)
+	}
+	err = libs.SendPush(ctx, subscription, models.Notification{
+		Kind:  models.NotificationTest,
+		Title: libs.Translate(locale, "push_test.title", nil),
+		Body:  libs.Translate(locale, "push_test.body", map[string]string{"device": subscription.Name}),
+		URL:   libs.FrontendURL(),
+		Tag:   "test",
+	})
+	switch {
+	case err == libs.ErrWebPushNotConfigured:
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	case err == libs.ErrPushSubscriptionGone:
+		c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		libs.RequestLogger(c).Error("Failed to send test push", "subscription_id", subscriptionID.Hex(), "error", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "The push service did not accept the notification"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Test notification sent", "subscription": subscription})
+}
+
+// pushName trims a device name, defaulting to "Browser"; it answers 400
+// itself when the name is too long
+func pushName(c *gin.Context, name string) (string, bool) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "Browser", true
+	}
+	if len([]rune(name)) > maxPushNameLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Device name is too long"})
+		return "", false
+	}
+	return name, true
+}
+
+// notificationKinds checks the kinds a device asked for, without
+// duplicates; it answers 400 itself for an unknown kind
+func notificationKinds(c *gin.Context, kinds []string) ([]string, bool) {
+	valid := map[string]bool{}
+	for _, kind := range models.NotificationKinds {
+		valid[kind] = true
+	}
+
+	result := []string{}
+	seen := map[string]bool{}
+	for _, kind := range kinds {
+		if !valid[kind] {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("Unknown notification kind %q (expected one of %s)", kind, strings.Join(models.NotificationKinds, ", ")),
+			})
+			return nil, false
+		}
+		if !seen[kind] {
+			seen[kind] = true
+			result = append(result, kind)
+		}
+	}
+	return result, true
+}
+
+func pushSubscriptionParams(c *gin.Context) (primitive.ObjectID, primitive.ObjectID, bool) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return primitive.NilObjectID, primitive.NilObjectID, false
+	}
+	subscriptionID, err := primitive.ObjectIDFromHex(c.Param("subscriptionId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid subscription ID"})
+		return primitive.NilObjectID, primitive.NilObjectID, false
+	}
+	return userID, subscriptionID, true
+}
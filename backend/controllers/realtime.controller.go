@@ -0,0 +1,95 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"github.com/sarwanazhar/boardsar/backend/realtime"
+	"github.com/sarwanazhar/boardsar/backend/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  4096,
+	WriteBufferSize: 4096,
+	CheckOrigin: func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			// Non-browser clients don't send an Origin
+			return true
+		}
+		return libs.AllowOrigin(r, origin)
+	},
+}
+
+// BoardSocket upgrades the request to a WebSocket and joins the board's
+// realtime session. Browsers can't set headers on a WebSocket, so the JWT
+// may also be passed as ?token=. OAuth apps need boards:read, and join as
+// viewers without boards:write.
+func BoardSocket(c *gin.Context) {
+	tokenString := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if tokenString == "" {
+		tokenString = c.Query("token")
+	}
+	if tokenString == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization token required"})
+		return
+	}
+
+	claims, err := libs.VerifyJWT(libs.RequestContext(c), tokenString)
+	if err != nil {
+		c.JSON(libs.TokenErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	readOnly := false
+	if claims.ClientID != "" {
+		if !libs.ScopesAllow(claims.Scopes, models.ScopeBoardsRead) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "This token lacks the " + models.ScopeBoardsRead + " scope", "scope": models.ScopeBoardsRead})
+			return
+		}
+		readOnly = !libs.ScopesAllow(claims.Scopes, models.ScopeBoardsWrite)
+	}
+	userID, err := primitive.ObjectIDFromHex(claims.UserID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	boards := libs.BoardRepository(c)
+	board, err := boards.FindForUser(ctx, c.Param("boardId"), userID)
+	if err == nil && board.Archived != nil {
+		board, err = findRehydratedBoard(ctx, boards, board.ID)
+	}
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Board not found or access denied"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve board: " + err.Error()})
+		return
+	}
+
+	// The upgrader writes its own error response on failure
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		return
+	}
+
+	realtime.DefaultHub.Join(boards, board, conn, userID, libs.BoardRole(board, userID), readOnly)
+}
+
+// boardChanged drops the board from the cache and tells a live realtime
+// session that the stored board changed through the REST API
+func boardChanged(ctx context.Context, boardID primitive.ObjectID) {
+	libs.InvalidateBoard(ctx, boardID)
+	realtime.DefaultHub.Reload(boardID)
+}
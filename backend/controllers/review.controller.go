@@ -0,0 +1,341 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"github.com/sarwanazhar/boardsar/backend/repository"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// GetAssignments lists the student's boards in the classrooms they are on,
+// with where each one's review stands
+func GetAssignments(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	classrooms, err := libs.ListAssignments(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve assignments: " + err.Error()})
+		return
+	}
+
+	assignments := make([]gin.H, 0, len(classrooms))
+	for i := range classrooms {
+		if student, ok := libs.FindStudent(&classrooms[i], userID); ok {
+			assignments = append(assignments, assignmentResponse(&classrooms[i], student))
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"assignments": assignments, "count": len(assignments)})
+}
+
+// SubmitAssignment hands the student's board in for review. From then on
+// they can only view it, until the teacher returns it.
+func SubmitAssignment(c *gin.Context) {
+	moveAssignment(c, models.ReviewSubmitted, "Board submitted")
+}
+
+// WithdrawSubmission takes the student's board back before the teacher
+// starts reviewing it, so they can edit it again
+func WithdrawSubmission(c *gin.Context) {
+	moveAssignment(c, models.ReviewAssigned, "Submission withdrawn")
+}
+
+// moveAssignment moves the signed-in student's board to a review state
+func moveAssignment(c *gin.Context, status, message string) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	classroom, err := libs.FindAssignment(ctx, c.Param("classroomId"), userID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Classroom not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve classroom: " + err.Error()})
+		return
+	}
+
+	fields := bson.M{}
+	if status == models.ReviewSubmitted {
+		fields["submittedAt"] = time.Now()
+	}
+	student, ok := moveStudentReview(ctx, c, classroom, userID, status, fields)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message":    message,
+		"assignment": assignmentResponse(classroom, student),
+	})
+}
+
+// ReviewStudentBoard moves a student's board on for the teacher: into
+// review once submitted, graded (with a grade and optional feedback) once
+// reviewed, or back to the student for more work
+func ReviewStudentBoard(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req models.ReviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+	fields := bson.M{}
+	if req.Status == models.ReviewGraded {
+		grade := strings.TrimSpace(req.Grade)
+		if grade == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "grade is required to grade a board"})
+			return
+		}
+		fields["grade"] = grade
+		fields["feedback"] = strings.TrimSpace(req.Feedback)
+		fields["gradedAt"] = time.Now()
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	classroom, ok := findClassroom(ctx, c, userID)
+	if !ok {
+		return
+	}
+	student, ok := findClassroomStudent(c, classroom)
+	if !ok {
+		return
+	}
+
+	student, ok = moveStudentReview(ctx, c, classroom, student.UserID, req.Status, fields)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Review updated",
+		"student": student,
+	})
+}
+
+// AddGradingComment adds a note for the teacher alone to a student's
+// board, optionally pinned to a shape or a point on it
+func AddGradingComment(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req models.GradingCommentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+	text := strings.TrimSpace(req.Text)
+	if text == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "text is required"})
+		return
+	}
+	if (req.X == nil) != (req.Y == nil) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "x and y go together"})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	classroom, ok := findClassroom(ctx, c, userID)
+	if !ok {
+		return
+	}
+	student, ok := findClassroomStudent(c, classroom)
+	if !ok {
+		return
+	}
+
+	comment := models.GradingComment{
+		ID:        primitive.NewObjectID(),
+		Text:      text,
+		ShapeID:   req.ShapeID,
+		X:         req.X,
+		Y:         req.Y,
+		CreatedAt: time.Now(),
+	}
+	if err := libs.AddGradingComment(ctx, classroom.ID, student.UserID, &comment); err != nil {
+		if errors.Is(err, libs.ErrTooManyComments) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add comment: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"message": "Comment added", "comment": comment})
+}
+
+// DeleteGradingComment removes a grading comment from a student's board
+func DeleteGradingComment(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	commentID, err := primitive.ObjectIDFromHex(c.Param("commentId"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": libs.ErrGradingCommentNotFound.Error()})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	classroom, ok := findClassroom(ctx, c, userID)
+	if !ok {
+		return
+	}
+	student, ok := findClassroomStudent(c, classroom)
+	if !ok {
+		return
+	}
+
+	if err := libs.DeleteGradingComment(ctx, classroom.ID, student.UserID, commentID); err != nil {
+		if errors.Is(err, libs.ErrGradingCommentNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete comment: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Comment deleted"})
+}
+
+// ExportGrades downloads the classroom's grades as CSV, a row per student
+func ExportGrades(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	classroom, ok := findClassroom(ctx, c, userID)
+	if !ok {
+		return
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="grades-`+classroom.ID.Hex()+`.csv"`)
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Status(http.StatusOK)
+	if err := libs.WriteGradesCSV(c.Writer, classroom); err != nil {
+		libs.RequestLogger(c).Error("Failed to export grades", "classroom_id", classroom.ID.Hex(), "error", err)
+	}
+}
+
+// findClassroomStudent finds the student in the route on the classroom's
+// roster, answering 404 otherwise
+func findClassroomStudent(c *gin.Context, classroom *models.Classroom) (*models.ClassroomStudent, bool) {
+	studentID, err := primitive.ObjectIDFromHex(c.Param("userId"))
+	if err == nil {
+		if student, ok := libs.FindStudent(classroom, studentID); ok {
+			return student, true
+		}
+	}
+	c.JSON(http.StatusNotFound, gin.H{"error": "Student not found in this classroom"})
+	return nil, false
+}
+
+// moveStudentReview moves a student's board to a review state and gives the
+// student the access that goes with it: editor while assigned, viewer from
+// submission on. It answers 409 when the board can't move there from where
+// it is, and the request itself on other failures.
+func moveStudentReview(ctx context.Context, c *gin.Context, classroom *models.Classroom, studentID primitive.ObjectID, status string, fields bson.M) (*models.ClassroomStudent, bool) {
+	updated, err := libs.MoveStudentReview(ctx, classroom.ID, studentID, status, fields)
+	if err != nil {
+		if errors.Is(err, libs.ErrReviewState) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update review: " + err.Error()})
+		return nil, false
+	}
+	student, _ := libs.FindStudent(updated, studentID)
+
+	role := models.CollaboratorRoleViewer
+	if status == models.ReviewAssigned {
+		role = models.CollaboratorRoleEditor
+	}
+	// Boards the teacher deleted, or stopped sharing, are left alone
+	boards := libs.BoardRepository(c)
+	board, err := boards.FindByID(ctx, student.BoardID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return student, true
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update the student's access: " + err.Error()})
+		return nil, false
+	}
+	if board.OwnerID != classroom.OwnerID {
+		return student, true
+	}
+	for _, collaborator := range board.SharedWith {
+		if collaborator.UserID != studentID || collaborator.Role == role {
+			continue
+		}
+		collaborator.Role = role
+		if _, err := boards.SetCollaborator(ctx, board.ID, collaborator); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update the student's access: " + err.Error()})
+			return nil, false
+		}
+		boardChanged(ctx, board.ID)
+		libs.RefreshBoardSummary(libs.RequestContext(c), board.ID, nil)
+	}
+	return student, true
+}
+
+// assignmentResponse is a student's view of their board in a classroom.
+// The grade and feedback show once graded; grading comments never do.
+func assignmentResponse(classroom *models.Classroom, student *models.ClassroomStudent) gin.H {
+	status := libs.StudentStatus(student)
+	assignment := gin.H{
+		"classroomId": classroom.ID.Hex(),
+		"name":        classroom.Name,
+		"boardId":     student.BoardID.Hex(),
+		"status":      status,
+	}
+	if student.SubmittedAt != nil {
+		assignment["submittedAt"] = student.SubmittedAt
+	}
+	if status == models.ReviewGraded {
+		assignment["grade"] = student.Grade
+		assignment["feedback"] = student.Feedback
+		assignment["gradedAt"] = student.GradedAt
+	}
+	return assignment
+}
@@ -0,0 +1,436 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"github.com/sarwanazhar/boardsar/backend/plugins"
+	"github.com/sarwanazhar/boardsar/backend/realtime"
+	"github.com/sarwanazhar/boardsar/backend/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// GetBoardSections lists the board's sections with the shapes in each, and
+// whether you collapsed them
+func GetBoardSections(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	board, ok := findVisibleBoard(ctx, c, libs.BoardRepository(c), userID)
+	if !ok {
+		return
+	}
+
+	collapsed, err := libs.CollapsedSections(ctx, userID, board.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve sections: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"sections": libs.SummarizeSections(board.Sections, libs.VisibleBoardData(board.BoardData, userID), collapsed),
+	})
+}
+
+// CreateSection gathers shapes into a new named section, taking them out
+// of the section they were in. The shapes change as one new version.
+func CreateSection(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req models.CreateSectionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+
+	expectedVersion, checkVersion, err := expectedBoardVersion(c, req.ExpectedVersion)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	board, ok := findEditableBoard(ctx, c, userID)
+	if !ok {
+		return
+	}
+	if checkVersion && expectedVersion != board.Version {
+		boardConflict(c, board, userID)
+		return
+	}
+	if len(board.Sections) >= libs.MaxBoardSections {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Boards can have at most %d sections", libs.MaxBoardSections)})
+		return
+	}
+
+	section := models.Section{
+		ID:        primitive.NewObjectID().Hex(),
+		Name:      req.Name,
+		CreatedBy: userID,
+		CreatedAt: time.Now().Truncate(time.Millisecond),
+	}
+
+	// Shapes the user can't see can't be gathered either
+	operations, err := libs.AssignSection(libs.VisibleBoardData(board.BoardData, userID), req.ShapeIDs, section.ID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	board.Sections = append(board.Sections, section)
+	if !applySectionOperations(c, board, operations, userID) {
+		return
+	}
+
+	now, ok := saveSectionChange(ctx, c, board, operations, userID)
+	if !ok {
+		return
+	}
+
+	c.Header("ETag", boardETag(board.Version))
+	c.JSON(http.StatusCreated, gin.H{
+		"message":   "Section created successfully",
+		"section":   libs.SummarizeSections([]models.Section{section}, libs.VisibleBoardData(board.BoardData, userID), nil)[0],
+		"version":   board.Version,
+		"updatedAt": now,
+	})
+}
+
+// UpdateSection renames, locks or unlocks a section. It isn't a change to
+// the board's contents, so it doesn't make a new version.
+func UpdateSection(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req models.UpdateSectionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	board, ok := findEditableBoard(ctx, c, userID)
+	if !ok {
+		return
+	}
+	section := libs.FindSection(board.Sections, c.Param("sectionId"))
+	if section == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Section not found"})
+		return
+	}
+
+	if req.Name != nil {
+		section.Name = *req.Name
+	}
+	if req.Locked != nil {
+		section.Locked = *req.Locked
+	}
+	if (req.Name != nil || req.Locked != nil) && !saveSections(ctx, c, board) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Section updated successfully",
+		"section": section,
+	})
+}
+
+// DeleteSection removes a section. Its shapes stay on the board, out of
+// any section, as one new version. Locked sections have to be unlocked
+// first.
+func DeleteSection(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	expectedVersion, checkVersion, err := expectedBoardVersion(c, nil)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	board, ok := findEditableBoard(ctx, c, userID)
+	if !ok {
+		return
+	}
+	if checkVersion && expectedVersion != board.Version {
+		boardConflict(c, board, userID)
+		return
+	}
+	section := libs.FindSection(board.Sections, c.Param("sectionId"))
+	if section == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Section not found"})
+		return
+	}
+	if section.Locked {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Unlock the section before deleting it"})
+		return
+	}
+
+	// Every shape leaves the section, private notes of others included
+	operations, err := libs.AssignSection(board.BoardData, libs.SectionShapeIDs(board.BoardData, section.ID), "")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete section: " + err.Error()})
+		return
+	}
+	for _, op := range operations {
+		if err := libs.ApplyBoardOperation(board.BoardData, op); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete section: " + err.Error()})
+			return
+		}
+	}
+
+	// The section goes with the shapes' change
+	removed := *section
+	board.Sections = slices.DeleteFunc(board.Sections, func(other models.Section) bool { return other.ID == removed.ID })
+	if len(operations) == 0 {
+		if !saveSections(ctx, c, board) {
+			return
+		}
+	} else if _, ok := saveSectionChange(ctx, c, board, operations, userID); !ok {
+		return
+	}
+	if err := libs.DeleteSectionStates(ctx, board.ID, removed.ID); err != nil {
+		libs.RequestLogger(c).Warn("Failed to delete states of section", "board_id", board.ID.Hex(), "section_id", removed.ID, "error", err)
+	}
+
+	c.Header("ETag", boardETag(board.Version))
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Section deleted successfully",
+		"version": board.Version,
+	})
+}
+
+// MoveSection moves every shape of a section by the same offset, as one
+// new version. Connectors into the section follow it; the answer has the
+// batch undoing the move.
+func MoveSection(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req models.MoveSectionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+
+	expectedVersion, checkVersion, err := expectedBoardVersion(c, req.ExpectedVersion)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	board, ok := findEditableBoard(ctx, c, userID)
+	if !ok {
+		return
+	}
+	if checkVersion && expectedVersion != board.Version {
+		boardConflict(c, board, userID)
+		return
+	}
+	section := libs.FindSection(board.Sections, c.Param("sectionId"))
+	if section == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Section not found"})
+		return
+	}
+
+	operations, undo := libs.MoveSection(libs.VisibleBoardData(board.BoardData, userID), section.ID, req.DX, req.DY)
+	if len(operations) == 0 {
+		c.Header("ETag", boardETag(board.Version))
+		c.JSON(http.StatusOK, gin.H{
+			"message":    "Nothing to move",
+			"applied":    0,
+			"operations": []models.BoardOperation{},
+			"undo":       []models.BoardOperation{},
+			"version":    board.Version,
+			"updatedAt":  board.UpdatedAt,
+		})
+		return
+	}
+	if !applySectionOperations(c, board, operations, userID) {
+		return
+	}
+
+	now, ok := saveSectionChange(ctx, c, board, operations, userID)
+	if !ok {
+		return
+	}
+
+	c.Header("ETag", boardETag(board.Version))
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Section moved successfully",
+		"applied":    len(operations),
+		"operations": operations,
+		"undo":       undo,
+		"version":    board.Version,
+		"updatedAt":  now,
+	})
+}
+
+// SetSectionCollapsed collapses or expands a section for you alone.
+// Viewers can collapse sections too.
+func SetSectionCollapsed(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req models.SectionCollapseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	board, ok := findVisibleBoard(ctx, c, libs.BoardRepository(c).WithoutContents(), userID)
+	if !ok {
+		return
+	}
+	section := libs.FindSection(board.Sections, c.Param("sectionId"))
+	if section == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Section not found"})
+		return
+	}
+
+	if err := libs.SetSectionCollapsed(ctx, userID, board.ID, section.ID, *req.Collapsed); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update section: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"sectionId": section.ID,
+		"collapsed": *req.Collapsed,
+	})
+}
+
+// findEditableBoard loads the board of the request for a change by an
+// owner or editor, with what realtime sessions haven't saved yet
+func findEditableBoard(ctx context.Context, c *gin.Context, userID primitive.ObjectID) (*models.Board, bool) {
+	boards := libs.BoardRepository(c)
+	board, err := boards.FindForUser(ctx, c.Param("boardId"), userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Board not found or access denied"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve board: " + err.Error()})
+		return nil, false
+	}
+
+	role := libs.BoardRole(board, userID)
+	if role != models.BoardRoleOwner && role != models.CollaboratorRoleEditor {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You have view-only access to this board"})
+		return nil, false
+	}
+
+	if realtime.DefaultHub.FlushBoard(board.ID) {
+		if board, err = boards.FindByID(ctx, board.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve board: " + err.Error()})
+			return nil, false
+		}
+	}
+	return board, true
+}
+
+// applySectionOperations checks operations like PATCH operations and
+// applies them to the board
+func applySectionOperations(c *gin.Context, board *models.Board, operations []models.BoardOperation, userID primitive.ObjectID) bool {
+	for i := range operations {
+		op := &operations[i]
+		if violation := libs.PrepareOperation(board, op, userID); violation != "" {
+			c.JSON(http.StatusForbidden, gin.H{"error": violation})
+			return false
+		}
+		if err := libs.ApplyBoardOperation(board.BoardData, *op); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return false
+		}
+	}
+	return true
+}
+
+// saveSections writes the board's changed sections without a new version,
+// only over the version they were changed from
+func saveSections(ctx context.Context, c *gin.Context, board *models.Board) bool {
+	err := libs.BoardRepository(c).UpdateVersion(ctx, board.ID, board.Version, map[string]interface{}{"sections": board.Sections})
+	if errors.Is(err, repository.ErrVersionConflict) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Board changed while updating the section; reload it and retry"})
+		return false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update section: " + err.Error()})
+		return false
+	}
+	boardChanged(ctx, board.ID)
+	return true
+}
+
+// saveSectionChange writes the board's changed contents and sections as one
+// new version, only over the version they were worked out from
+func saveSectionChange(ctx context.Context, c *gin.Context, board *models.Board, operations []models.BoardOperation, userID primitive.ObjectID) (time.Time, bool) {
+	now := time.Now().Truncate(time.Millisecond)
+	err := libs.BoardRepository(c).SaveContents(ctx, board.ID, board.Version, 1, board.BoardData, map[string]interface{}{
+		"updatedAt": now,
+		"sections":  board.Sections,
+	})
+	if errors.Is(err, repository.ErrVersionConflict) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Board changed while updating the section; reload it and retry"})
+		return now, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update board: " + err.Error()})
+		return now, false
+	}
+	board.Version++
+	board.UpdatedAt = now
+	boardChanged(ctx, board.ID)
+	plugins.Emit(libs.RequestContext(c), board, plugins.EventBoardUpdated, userID)
+	libs.RecordBoardVersion(libs.RequestContext(c), board, userID)
+	libs.RecordBoardUpdate(libs.RequestContext(c), board, userID, operationChanges(operations))
+	return now, true
+}
@@ -0,0 +1,69 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ListSessions returns the devices the user is signed in on, the one making
+// the request marked current
+func ListSessions(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	sessions, err := libs.ListSessions(ctx, userID)
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to list sessions", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+		return
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID.Hex() == c.GetString("sessionId")
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": sessions})
+}
+
+// RevokeSession signs the user out on one of their devices. Its refresh
+// token and access tokens stop working.
+func RevokeSession(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	sessionID, err := primitive.ObjectIDFromHex(c.Param("sessionId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	err = libs.RevokeSession(ctx, userID, sessionID)
+	if err == libs.ErrSessionNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to revoke session", "session_id", sessionID.Hex(), "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+		return
+	}
+
+	recordAudit(c, models.AuditSessionRevoked, models.AuditTargetUser, userID.Hex(),
+		map[string]interface{}{"sessionId": sessionID.Hex()})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked", "id": sessionID.Hex()})
+}
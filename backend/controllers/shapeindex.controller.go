@@ -0,0 +1,215 @@
+package controllers
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Hit test and minimap limits
+const (
+	maxHitPoints      = 500
+	maxHitRadius      = 1000
+	defaultMinimapDim = 64
+	maxMinimapDim     = 256
+)
+
+// GetBoardShapes returns the shapes intersecting ?bbox=minX,minY,maxX,maxY
+// in board coordinates, in drawing order, so clients can load a large board
+// as the user pans instead of all at once
+func GetBoardShapes(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	box, ok := parseBBox(c.Query("bbox"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bbox must be minX,minY,maxX,maxY with min no greater than max"})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	source, ok := openShapeSource(ctx, c, userID)
+	if !ok {
+		return
+	}
+	entries, err := source.Search(ctx, box)
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to query shapes of board", "board_id", source.Board.ID.Hex(), "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+		return
+	}
+
+	c.Header("ETag", boardETag(source.Board.Version))
+	c.JSON(http.StatusOK, gin.H{
+		"bbox":    []float64{box.X, box.Y, box.X + box.Width, box.Y + box.Height},
+		"shapes":  visibleShapes(entries, userID),
+		"version": source.Board.Version,
+	})
+}
+
+// HitTestShapes returns the shapes within ?radius (default 0) of any of
+// ?points=x1,y1,x2,y2,..., topmost first: what a click selects, or what an
+// eraser stroke sampled at those points would remove
+func HitTestShapes(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	points, ok := parseNumbers(c.Query("points"))
+	if !ok || len(points) == 0 || len(points)%2 != 0 || len(points) > 2*maxHitPoints {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "points must be x,y pairs, " + strconv.Itoa(maxHitPoints) + " at most"})
+		return
+	}
+	radius := 0.0
+	if value := c.Query("radius"); value != "" {
+		radius, err = strconv.ParseFloat(value, 64)
+		if err != nil || math.IsNaN(radius) || radius < 0 || radius > maxHitRadius {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "radius must be between 0 and " + strconv.Itoa(maxHitRadius)})
+			return
+		}
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	source, ok := openShapeSource(ctx, c, userID)
+	if !ok {
+		return
+	}
+	entries, err := source.HitShapes(ctx, points, radius)
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to hit-test shapes of board", "board_id", source.Board.ID.Hex(), "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+		return
+	}
+
+	c.Header("ETag", boardETag(source.Board.Version))
+	c.JSON(http.StatusOK, gin.H{
+		"shapes":  visibleShapes(entries, userID),
+		"version": source.Board.Version,
+	})
+}
+
+// GetBoardMinimap returns a ?cols by ?rows grid over the board's shapes
+// with how many shapes overlap each cell, for drawing an overview without
+// loading the board
+func GetBoardMinimap(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	dims := [2]int{defaultMinimapDim, defaultMinimapDim}
+	for i, name := range []string{"cols", "rows"} {
+		if value := c.Query(name); value != "" {
+			dims[i], err = strconv.Atoi(value)
+			if err != nil || dims[i] < 1 || dims[i] > maxMinimapDim {
+				c.JSON(http.StatusBadRequest, gin.H{"error": name + " must be between 1 and " + strconv.Itoa(maxMinimapDim)})
+				return
+			}
+		}
+	}
+
+	ctx, cancel := libs.DBContextWithin(c, 10*time.Second)
+	defer cancel()
+
+	source, ok := openShapeSource(ctx, c, userID)
+	if !ok {
+		return
+	}
+	entries, err := source.All(ctx)
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to list shapes of board", "board_id", source.Board.ID.Hex(), "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+		return
+	}
+	visible := make([]libs.ShapeEntry, 0, len(entries))
+	for _, entry := range entries {
+		if !libs.IsHiddenFrom(entry.Shape, userID) {
+			visible = append(visible, entry)
+		}
+	}
+
+	c.Header("ETag", boardETag(source.Board.Version))
+	c.JSON(http.StatusOK, gin.H{
+		"minimap": libs.BuildMinimap(visible, dims[0], dims[1]),
+		"version": source.Board.Version,
+	})
+}
+
+// openShapeSource finds the board named by the :boardId route parameter
+// and where to answer spatial queries about it from, answering 404 unless
+// the user can see it
+func openShapeSource(ctx context.Context, c *gin.Context, userID primitive.ObjectID) (*libs.ShapeSource, bool) {
+	board, ok := findVisibleBoard(ctx, c, libs.BoardRepository(c).WithoutContents(), userID)
+	if !ok {
+		return nil, false
+	}
+	return shapeSourceOf(ctx, c, board)
+}
+
+// shapeSourceOf picks where to answer spatial queries about a board loaded
+// without its contents from, answering 500 if it can't be loaded
+func shapeSourceOf(ctx context.Context, c *gin.Context, board *models.Board) (*libs.ShapeSource, bool) {
+	source, err := libs.OpenShapeSource(board, func() (*models.Board, error) {
+		return libs.BoardRepository(c).FindByID(ctx, board.ID)
+	})
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to load shapes of board", "board_id", board.ID.Hex(), "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+		return nil, false
+	}
+	return source, true
+}
+
+// visibleShapes returns the shapes of the entries the user may see
+func visibleShapes(entries []libs.ShapeEntry, userID primitive.ObjectID) []map[string]interface{} {
+	shapes := make([]map[string]interface{}, 0, len(entries))
+	for _, entry := range entries {
+		if !libs.IsHiddenFrom(entry.Shape, userID) {
+			shapes = append(shapes, entry.Shape)
+		}
+	}
+	return shapes
+}
+
+// parseBBox reads a minX,minY,maxX,maxY box
+func parseBBox(raw string) (libs.Bounds, bool) {
+	values, ok := parseNumbers(raw)
+	if !ok || len(values) != 4 || values[0] > values[2] || values[1] > values[3] {
+		return libs.Bounds{}, false
+	}
+	return libs.Bounds{X: values[0], Y: values[1], Width: values[2] - values[0], Height: values[3] - values[1]}, true
+}
+
+// parseNumbers reads a comma-separated list of finite numbers
+func parseNumbers(raw string) ([]float64, bool) {
+	if raw == "" {
+		return nil, false
+	}
+	values := []float64{}
+	for _, part := range strings.Split(raw, ",") {
+		value, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+			return nil, false
+		}
+		values = append(values, value)
+	}
+	return values, true
+}
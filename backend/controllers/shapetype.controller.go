@@ -0,0 +1,92 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// GetShapeTypes lists the custom shape types boards accept, with the JSON
+// Schema of each where it has one, so clients can build matching widgets
+func GetShapeTypes(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"shapeTypes": libs.ShapeTypes()})
+}
+
+// PutShapeType registers a custom shape type validated by a JSON Schema, or
+// replaces its schema (admin only)
+func PutShapeType(c *gin.Context) {
+	var req models.ShapeTypeSchemaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+
+	adminID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid user ID",
+		})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	shapeType, err := libs.SaveShapeTypeSchema(ctx, c.Param("type"), req.Description, req.Schema, adminID)
+	switch {
+	case errors.Is(err, libs.ErrInvalidShapeTypeName), errors.Is(err, libs.ErrShapeTypeBuiltin), errors.Is(err, libs.ErrInvalidShapeSchema):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, libs.ErrShapeTypeTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to register shape type: " + err.Error(),
+		})
+		return
+	}
+
+	recordAudit(c, models.AuditShapeTypeRegistered, models.AuditTargetShapeType, shapeType.Type, map[string]interface{}{
+		"description": shapeType.Description,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "Shape type registered successfully",
+		"shapeType": shapeType,
+	})
+}
+
+// DeleteShapeType unregisters a schema-registered shape type (admin only).
+// Shapes of the type stay on boards, unvalidated.
+func DeleteShapeType(c *gin.Context) {
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	name := c.Param("type")
+	deleted, err := libs.DeleteShapeTypeSchema(ctx, name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to delete shape type: " + err.Error(),
+		})
+		return
+	}
+	if !deleted {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Shape type not found",
+		})
+		return
+	}
+
+	recordAudit(c, models.AuditShapeTypeRemoved, models.AuditTargetShapeType, name, nil)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Shape type deleted successfully",
+	})
+}
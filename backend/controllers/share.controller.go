@@ -0,0 +1,259 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"github.com/sarwanazhar/boardsar/backend/plugins"
+	"github.com/sarwanazhar/boardsar/backend/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ShareBoard shares a board with another user as editor or viewer, or
+// changes the role and capabilities of an existing collaborator. Owners can
+// do either; collaborators with the share capability can add collaborators
+// with no more access than their own.
+func ShareBoard(c *gin.Context) {
+	boardIDStr := c.Param("boardId")
+
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req models.ShareRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+
+	if req.Email == "" && req.UserID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "email or userId is required"})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	// The board and the caller's right to share it come first, so only
+	// people who may share it learn whether an email is registered
+	boards := libs.BoardRepository(c)
+	board, err := boards.FindForUser(ctx, boardIDStr, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Board not found or access denied"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve board: " + err.Error()})
+		return
+	}
+	if board.OwnerID != userID && !libs.BoardCapabilities(board, userID).Share {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Your access to this board doesn't include " + models.CapabilityShare})
+		return
+	}
+
+	// Resolve the collaborator by email or user ID; unknown ones get the
+	// same answer either way
+	var collaborator *models.User
+	if req.Email != "" {
+		collaborator, err = libs.FindUserByEmail(libs.RequestContext(c), strings.TrimSpace(req.Email))
+	} else {
+		collaborator, err = libs.FindUserByID(libs.RequestContext(c), req.UserID)
+	}
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if collaborator.ID == userID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You already have access to this board"})
+		return
+	}
+	if collaborator.ID == board.OwnerID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "They own this board"})
+		return
+	}
+	if violation := checkSharePermission(board, userID, collaborator.ID, &req); violation != "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": violation})
+		return
+	}
+
+	var newCollaborators int64
+	if libs.BoardRole(board, collaborator.ID) == "" {
+		newCollaborators = 1
+	}
+	warnings, quotaErr := libs.ApplyCollaboratorQuota(c, int64(len(board.SharedWith)), newCollaborators)
+	if quotaErr != "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": quotaErr})
+		return
+	}
+
+	// Update the role if already shared, otherwise add the collaborator
+	added, err := boards.SetCollaborator(ctx, board.ID, models.Collaborator{
+		UserID:       collaborator.ID,
+		Role:         req.Role,
+		Capabilities: req.Capabilities,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to share board: " + err.Error()})
+		return
+	}
+
+	boardChanged(ctx, board.ID)
+	plugins.Emit(libs.RequestContext(c), board, plugins.EventBoardShared, userID)
+	if added {
+		notifyBoardShared(ctx, board, collaborator.ID, userID, req.Role)
+	}
+
+	details := map[string]interface{}{
+		"collaboratorId": collaborator.ID.Hex(),
+		"role":           req.Role,
+	}
+	if req.Capabilities != nil {
+		details["capabilities"] = req.Capabilities
+	}
+	recordAudit(c, models.AuditBoardShared, models.AuditTargetBoard, board.ID.Hex(), details)
+	libs.RecordActivity(libs.RequestContext(c), board, userID, models.ActivityBoardShared, func(activity *models.Activity) {
+		activity.UserID = &collaborator.ID
+		activity.UserEmail = collaborator.Email
+		activity.Role = req.Role
+	})
+
+	if board, err = boards.FindByID(ctx, board.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve board: " + err.Error()})
+		return
+	}
+
+	shared := []models.FrontendBoard{transformBoardToFrontend(board)}
+	withCollaboratorProfiles(ctx, c, shared)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "Board shared successfully",
+		"collaborators": shared[0].Collaborators,
+		"warnings":      warnings,
+	})
+}
+
+// checkSharePermission describes why the user can't share the board with
+// collaboratorID as requested, or returns "". Collaborators sharing further
+// only add people, with no more access than their own; without capabilities
+// requested, the new collaborator gets the defaults within the sharer's.
+func checkSharePermission(board *models.Board, userID, collaboratorID primitive.ObjectID, req *models.ShareRequest) string {
+	if board.OwnerID == userID {
+		return ""
+	}
+	held := libs.BoardCapabilities(board, userID)
+	if !held.Share {
+		return "Your access to this board doesn't include " + models.CapabilityShare
+	}
+	if libs.BoardRole(board, collaboratorID) != "" {
+		return "Only the owner can change a collaborator's access"
+	}
+	if req.Role == models.CollaboratorRoleEditor && libs.BoardRole(board, userID) != models.CollaboratorRoleEditor {
+		return "You can't give more access than you have"
+	}
+	if req.Capabilities == nil {
+		granted := models.DefaultCapabilities
+		granted.Export = granted.Export && held.Export
+		granted.History = granted.History && held.History
+		granted.CommentOnly = held.CommentOnly
+		req.Capabilities = &granted
+	}
+	if !libs.WithinCapabilities(*req.Capabilities, held) {
+		return "You can't give more access than you have"
+	}
+	return ""
+}
+
+// UnshareBoard removes a collaborator from a board. Owners can remove anyone;
+// collaborators can remove themselves to leave a board.
+func UnshareBoard(c *gin.Context) {
+	boardIDStr := c.Param("boardId")
+
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	collaboratorID, err := primitive.ObjectIDFromHex(c.Param("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid collaborator ID"})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	boards := libs.BoardRepository(c)
+	var board *models.Board
+	if collaboratorID == userID {
+		board, err = boards.FindForUser(ctx, boardIDStr, userID)
+	} else {
+		board, err = boards.FindOwned(ctx, boardIDStr, userID)
+	}
+	if err == nil {
+		err = boards.RemoveCollaborator(ctx, board.ID, collaboratorID)
+	}
+	if err == nil {
+		board, err = boards.FindByID(ctx, board.ID)
+	}
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Board or collaborator not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unshare board: " + err.Error()})
+		return
+	}
+	boardChanged(ctx, board.ID)
+	plugins.Emit(libs.RequestContext(c), board, plugins.EventBoardUnshared, userID)
+
+	recordAudit(c, models.AuditBoardUnshared, models.AuditTargetBoard, board.ID.Hex(), map[string]interface{}{
+		"collaboratorId": collaboratorID.Hex(),
+	})
+	libs.RecordActivity(libs.RequestContext(c), board, userID, models.ActivityBoardUnshared, func(activity *models.Activity) {
+		activity.UserID = &collaboratorID
+		if collaborator, err := libs.FindUserByID(libs.RequestContext(c), collaboratorID.Hex()); err == nil {
+			activity.UserEmail = collaborator.Email
+		}
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Collaborator removed successfully",
+		"userId":  collaboratorID.Hex(),
+	})
+}
+
+// notifyBoardShared tells a new collaborator about the board on their
+// devices, in their language
+func notifyBoardShared(ctx context.Context, board *models.Board, collaboratorID, sharedBy primitive.ObjectID, role string) {
+	locale := libs.DefaultLocale
+	if collaborator, err := libs.FindUserByID(ctx, collaboratorID.Hex()); err == nil {
+		locale = userLocale(collaborator)
+	}
+	title := libs.Translate(locale, "share_push.title", nil)
+	if owner, err := libs.FindUserByID(ctx, sharedBy.Hex()); err == nil {
+		title = libs.Translate(locale, "share_push.title_from", map[string]string{"email": owner.Email})
+	}
+	access := "share_push.body.editor"
+	if role == models.CollaboratorRoleViewer {
+		access = "share_push.body.viewer"
+	}
+
+	libs.Notify(collaboratorID, models.Notification{
+		Kind:    models.NotificationShare,
+		Title:   title,
+		Body:    libs.Translate(locale, access, map[string]string{"board": boardDisplayName(board.Name, board.BoardID)}),
+		URL:     libs.FrontendURL() + "/board/" + board.ID.Hex(),
+		BoardID: board.ID.Hex(),
+		Tag:     "share-" + board.ID.Hex(),
+	})
+}
@@ -0,0 +1,370 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"github.com/sarwanazhar/boardsar/backend/repository"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Usage history page sizes for the share link detail endpoint
+const (
+	defaultShareLinkUses = 100
+	maxShareLinkUses     = 1000
+)
+
+// CreateShareLink creates a read-only share link for a board. The token is
+// only returned here. Owner only.
+func CreateShareLink(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	// The body is optional
+	var req models.ShareLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	board, ok := findOwnedBoard(ctx, c, userID)
+	if !ok {
+		return
+	}
+	if req.FrameID != "" && libs.FindFrame(board.BoardData, req.FrameID) == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Frame " + req.FrameID + " not found"})
+		return
+	}
+
+	link, token, err := libs.CreateShareLink(ctx, board, req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create share link: " + err.Error()})
+		return
+	}
+
+	details := map[string]interface{}{"boardId": board.ID.Hex()}
+	if link.FrameID != "" {
+		details["frameId"] = link.FrameID
+	}
+	recordAudit(c, models.AuditShareLinkCreated, models.AuditTargetShareLink, link.ID.Hex(), details)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Share link created successfully",
+		"link":    link,
+		"token":   token,
+	})
+}
+
+// GetShareLinks lists a board's share links, newest first. Owner only.
+func GetShareLinks(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	board, ok := findOwnedBoard(ctx, c, userID)
+	if !ok {
+		return
+	}
+
+	cursor, err := libs.GetShareLinkCollection().Find(ctx,
+		bson.M{"boardId": board.ID},
+		options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve share links: " + err.Error()})
+		return
+	}
+	links := []models.ShareLink{}
+	if err := cursor.All(ctx, &links); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode share links: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"links": links})
+}
+
+// GetShareLink returns a share link with its usage history, newest first
+// (?limit, default 100). Owner only.
+func GetShareLink(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	limit := defaultShareLinkUses
+	if value := c.Query("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxShareLinkUses {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and " + strconv.Itoa(maxShareLinkUses)})
+			return
+		}
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	link, ok := findBoardShareLink(ctx, c, userID)
+	if !ok {
+		return
+	}
+
+	cursor, err := libs.GetShareLinkUseCollection().Find(ctx,
+		bson.M{"linkId": link.ID},
+		options.Find().SetSort(bson.D{{Key: "usedAt", Value: -1}}).SetLimit(int64(limit)),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve share link usage: " + err.Error()})
+		return
+	}
+	uses := []models.ShareLinkUse{}
+	if err := cursor.All(ctx, &uses); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode share link usage: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"link": link,
+		"uses": uses,
+	})
+}
+
+// RevokeShareLink stops a share link from working. Owner only.
+func RevokeShareLink(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	link, ok := findBoardShareLink(ctx, c, userID)
+	if !ok {
+		return
+	}
+
+	link, err = libs.RevokeShareLink(ctx, bson.M{"_id": link.ID})
+	if err == libs.ErrInvalidShareLink {
+		c.JSON(http.StatusConflict, gin.H{"error": "Share link is already revoked"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke share link: " + err.Error()})
+		return
+	}
+
+	recordAudit(c, models.AuditShareLinkRevoked, models.AuditTargetShareLink, link.ID.Hex(), map[string]interface{}{
+		"boardId": link.BoardID.Hex(),
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Share link revoked successfully",
+		"link":    link,
+	})
+}
+
+// RevokeShareLinkFromEmail is the one-click revoke link sent in share link
+// alerts. The revoke token stands in for signing in.
+func RevokeShareLinkFromEmail(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "token is required"})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	link, err := libs.RevokeShareLinkByRevokeToken(ctx, token)
+	if err != nil {
+		if err == libs.ErrInvalidShareLink {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke share link: " + err.Error()})
+		return
+	}
+
+	// The revoke token was only ever emailed to the owner
+	libs.RecordAudit(libs.RequestContext(c), models.AuditEvent{
+		Action:  models.AuditShareLinkRevoked,
+		Actor:   auditActor(c, link.OwnerID.Hex()),
+		Target:  &models.AuditTarget{Type: models.AuditTargetShareLink, ID: link.ID.Hex()},
+		Details: map[string]interface{}{"boardId": link.BoardID.Hex(), "via": "email"},
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Share link revoked successfully"})
+}
+
+// OpenShareLink returns the board behind a share link, read-only and without
+// anyone's private notes, with a guest token to reload it, and records the
+// visit
+func OpenShareLink(c *gin.Context) {
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	link, err := libs.FindShareLink(ctx, c.Param("token"))
+	if err != nil {
+		if err == libs.ErrInvalidShareLink {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve share link: " + err.Error()})
+		return
+	}
+
+	board, err := findRehydratedBoard(ctx, libs.BoardRepository(c), link.BoardID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Board not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve board: " + err.Error()})
+		return
+	}
+
+	// A failure to record the visit shouldn't keep the board from loading
+	use := libs.ShareLinkUseFromRequest(c)
+	alerts, err := libs.RecordShareLinkUse(ctx, link, use)
+	if err != nil {
+		libs.RequestLogger(c).Warn("Failed to record use of share link", "share_link_id", link.ID.Hex(), "error", err)
+	} else if len(alerts) > 0 {
+		notifyShareLinkOwner(ctx, libs.RequestLogger(c), link, board, alerts, use)
+	}
+
+	// Reloads go through /guest/:boardId with a short-lived token, which
+	// only works from this page's origin and dies with the link
+	guestToken, expiresAt, err := libs.IssueGuestToken(link, libs.RequestOrigin(c.Request))
+	if err != nil {
+		libs.RequestLogger(c).Warn("Failed to issue guest token for share link", "share_link_id", link.ID.Hex(), "error", err)
+	}
+
+	response := boardStateResponse(board, primitive.NilObjectID)
+	if !scopeToFrame(c, response, link.FrameID) {
+		return
+	}
+	response["name"] = boardDisplayName(board.Name, board.BoardID)
+	response["role"] = models.CollaboratorRoleViewer
+	if guestToken != "" {
+		response["boardId"] = board.ID.Hex()
+		response["guestToken"] = guestToken
+		response["guestTokenExpiresAt"] = expiresAt
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// scopeToFrame narrows a board state response to the frame a share link or
+// board token is for, if any, and adds the frame. It responds 404 and
+// returns false when the frame has since been deleted.
+func scopeToFrame(c *gin.Context, response gin.H, frameID string) bool {
+	if frameID == "" {
+		return true
+	}
+	data, _ := response["board"].(map[string]interface{})
+	scoped, frame, ok := libs.FrameBoardData(data, frameID)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "The shared frame no longer exists"})
+		return false
+	}
+	response["board"] = scoped
+	response["frame"] = frame
+	return true
+}
+
+// notifyShareLinkOwner emails the board owner about unusual share link use,
+// with a link that revokes it in one click
+func notifyShareLinkOwner(ctx context.Context, logger *slog.Logger, link *models.ShareLink, board *models.Board, alerts []string, use models.ShareLinkUse) {
+	owner, err := libs.FindUserByID(ctx, link.OwnerID.Hex())
+	if err != nil {
+		logger.Warn("Share link owner not found", "share_link_id", link.ID.Hex(), "error", err)
+		return
+	}
+
+	revokeToken, err := libs.IssueShareLinkRevokeToken(ctx, link.ID)
+	if err != nil {
+		logger.Warn("Failed to issue revoke token for share link", "share_link_id", link.ID.Hex(), "error", err)
+		return
+	}
+
+	locale := userLocale(owner)
+	lines := []string{}
+	for _, alert := range alerts {
+		switch alert {
+		case libs.ShareLinkAlertThreshold:
+			lines = append(lines, libs.Translate(locale, "share_link_alert.threshold", map[string]string{
+				"board": boardDisplayName(board.Name, board.BoardID),
+				"count": strconv.FormatInt(link.AlertThreshold+1, 10),
+			}))
+		case libs.ShareLinkAlertNewCountry:
+			lines = append(lines, libs.Translate(locale, "share_link_alert.new_country", map[string]string{
+				"board":   boardDisplayName(board.Name, board.BoardID),
+				"country": use.Country,
+			}))
+		}
+	}
+	lines = append(lines, libs.Translate(locale, "share_link_alert.revoke", map[string]string{
+		"link": libs.APIURL() + "/share-links/revoke?token=" + url.QueryEscape(revokeToken),
+	}))
+
+	err = libs.SendEmail(owner.Email,
+		libs.Translate(locale, "share_link_alert.subject", nil),
+		libs.LocalizedEmail(locale, owner.Email, strings.Join(lines, "\n\n")),
+	)
+	if err != nil {
+		logger.Warn("Failed to send share link alert", "owner_id", owner.ID.Hex(), "error", err)
+	}
+}
+
+// findBoardShareLink loads the linkId share link of the boardId board if
+// userID owns the board, writing the error response otherwise
+func findBoardShareLink(ctx context.Context, c *gin.Context, userID primitive.ObjectID) (*models.ShareLink, bool) {
+	linkID, err := primitive.ObjectIDFromHex(c.Param("linkId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid share link ID"})
+		return nil, false
+	}
+
+	board, ok := findOwnedBoard(ctx, c, userID)
+	if !ok {
+		return nil, false
+	}
+
+	var link models.ShareLink
+	err = libs.GetShareLinkCollection().FindOne(ctx, bson.M{"_id": linkID, "boardId": board.ID}).Decode(&link)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Share link not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve share link: " + err.Error()})
+		return nil, false
+	}
+	return &link, true
+}
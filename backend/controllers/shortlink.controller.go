@@ -0,0 +1,434 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"github.com/sarwanazhar/boardsar/backend/repository"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Click history page sizes for the short link detail endpoint
+const (
+	defaultShortLinkClicks = 100
+	maxShortLinkClicks     = 1000
+)
+
+// CreateShortLink creates a short link to a board: to the board itself, to
+// one of its share links (board owner only) or to an export of it (for
+// those who may export it)
+func CreateShortLink(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req models.ShortLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expiresAt must be in the future"})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	board, err := libs.BoardRepository(c).FindForUser(ctx, c.Param("boardId"), userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Board not found or access denied"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve board: " + err.Error()})
+		return
+	}
+
+	link := &models.ShortLink{
+		BoardID:   board.ID,
+		OwnerID:   userID,
+		Target:    req.Target,
+		ExpiresAt: req.ExpiresAt,
+	}
+	switch req.Target {
+	case models.ShortLinkTargetShare:
+		shareLinkID, err := primitive.ObjectIDFromHex(req.ShareLinkID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "shareLinkId is required for share links"})
+			return
+		}
+		if board.OwnerID != userID {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only the owner can shorten the board's share links"})
+			return
+		}
+		if _, err := findActiveShareLink(ctx, shareLinkID, board.ID); err != nil {
+			if err == libs.ErrInvalidShareLink {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve share link: " + err.Error()})
+			return
+		}
+		link.ShareLinkID = &shareLinkID
+	case models.ShortLinkTargetExport:
+		_, render := libs.RenderContentTypes[req.Format]
+		if !render && req.Format != "json" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json, svg, png or pdf"})
+			return
+		}
+		if message := shortLinkExportDenied(board, userID); message != "" {
+			c.JSON(http.StatusForbidden, gin.H{"error": message})
+			return
+		}
+		link.Format = req.Format
+	}
+
+	if err := libs.CreateShortLink(ctx, link); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create short link: " + err.Error()})
+		return
+	}
+	link.URL = libs.ShortLinkURL(link.Code)
+
+	details := map[string]interface{}{"boardId": board.ID.Hex(), "target": link.Target}
+	if link.Format != "" {
+		details["format"] = link.Format
+	}
+	recordAudit(c, models.AuditShortLinkCreated, models.AuditTargetShortLink, link.ID.Hex(), details)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Short link created successfully",
+		"link":    link,
+	})
+}
+
+// GetShortLinks lists the board's short links, newest first: all of them
+// for its owner, and their own for collaborators
+func GetShortLinks(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	board, err := libs.BoardRepository(c).WithoutContents().FindForUser(ctx, c.Param("boardId"), userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Board not found or access denied"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve board: " + err.Error()})
+		return
+	}
+
+	filter := bson.M{"boardId": board.ID}
+	if board.OwnerID != userID {
+		filter["ownerId"] = userID
+	}
+	cursor, err := libs.GetShortLinkCollection().Find(ctx, filter,
+		options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve short links: " + err.Error()})
+		return
+	}
+	links := []models.ShortLink{}
+	if err := cursor.All(ctx, &links); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode short links: " + err.Error()})
+		return
+	}
+	for i := range links {
+		links[i].URL = libs.ShortLinkURL(links[i].Code)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"links": links})
+}
+
+// GetShortLink returns a short link with its clicks, newest first (?limit,
+// default 100). Its creator and the board's owner only.
+func GetShortLink(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	limit := defaultShortLinkClicks
+	if value := c.Query("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxShortLinkClicks {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and " + strconv.Itoa(maxShortLinkClicks)})
+			return
+		}
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	link, ok := findBoardShortLink(ctx, c, userID)
+	if !ok {
+		return
+	}
+
+	cursor, err := libs.GetShortLinkClickCollection().Find(ctx,
+		bson.M{"linkId": link.ID},
+		options.Find().SetSort(bson.D{{Key: "clickedAt", Value: -1}}).SetLimit(int64(limit)),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve short link clicks: " + err.Error()})
+		return
+	}
+	clicks := []models.ShortLinkClick{}
+	if err := cursor.All(ctx, &clicks); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode short link clicks: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"link":   link,
+		"clicks": clicks,
+	})
+}
+
+// DeleteShortLink removes a short link and its clicks. Its creator and the
+// board's owner only.
+func DeleteShortLink(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	link, ok := findBoardShortLink(ctx, c, userID)
+	if !ok {
+		return
+	}
+
+	if _, err := libs.GetShortLinkCollection().DeleteOne(ctx, bson.M{"_id": link.ID}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete short link: " + err.Error()})
+		return
+	}
+	if _, err := libs.GetShortLinkClickCollection().DeleteMany(ctx, bson.M{"linkId": link.ID}); err != nil {
+		libs.RequestLogger(c).Warn("Failed to delete clicks of short link", "short_link_id", link.ID.Hex(), "error", err)
+	}
+
+	recordAudit(c, models.AuditShortLinkDeleted, models.AuditTargetShortLink, link.ID.Hex(), map[string]interface{}{
+		"boardId": link.BoardID.Hex(),
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Short link deleted successfully"})
+}
+
+// OpenShortLink follows a short link and records the click. Boards redirect
+// to the app, share links to the frontend's guest page with a fresh guest
+// token, and exports are sent as the file, without anyone's private notes.
+// Expired links answer 410.
+func OpenShortLink(c *gin.Context) {
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	link, err := libs.FindShortLink(ctx, c.Param("code"))
+	if err != nil {
+		switch err {
+		case libs.ErrShortLinkNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case libs.ErrShortLinkExpired:
+			c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve short link: " + err.Error()})
+		}
+		return
+	}
+
+	board, err := findRehydratedBoard(ctx, libs.BoardRepository(c), link.BoardID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": libs.ErrShortLinkNotFound.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve board: " + err.Error()})
+		return
+	}
+
+	// Checked before the click is counted, so dead links don't add up
+	var shareLink *models.ShareLink
+	switch link.Target {
+	case models.ShortLinkTargetShare:
+		shareLink, err = findActiveShareLink(ctx, *link.ShareLinkID, board.ID)
+		if err == libs.ErrInvalidShareLink {
+			c.JSON(http.StatusNotFound, gin.H{"error": libs.ErrShortLinkNotFound.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve share link: " + err.Error()})
+			return
+		}
+	case models.ShortLinkTargetExport:
+		if message := shortLinkExportDenied(board, link.OwnerID); message != "" {
+			c.JSON(http.StatusForbidden, gin.H{"error": message})
+			return
+		}
+	}
+
+	// A failure to record the click shouldn't keep the link from opening
+	if err := libs.RecordShortLinkClick(ctx, link, libs.ShortLinkClickFromRequest(c)); err != nil {
+		libs.RequestLogger(c).Warn("Failed to record click of short link", "short_link_id", link.ID.Hex(), "error", err)
+	}
+
+	switch link.Target {
+	case models.ShortLinkTargetBoard:
+		c.Redirect(http.StatusFound, libs.FrontendURL()+"/board/"+board.ID.Hex())
+	case models.ShortLinkTargetShare:
+		use := libs.ShareLinkUseFromRequest(c)
+		alerts, err := libs.RecordShareLinkUse(ctx, shareLink, use)
+		if err != nil {
+			libs.RequestLogger(c).Warn("Failed to record use of share link", "share_link_id", shareLink.ID.Hex(), "error", err)
+		} else if len(alerts) > 0 {
+			notifyShareLinkOwner(ctx, libs.RequestLogger(c), shareLink, board, alerts, use)
+		}
+
+		// Bound to the frontend's origin, which the guest page is on
+		guestToken, _, err := libs.IssueGuestToken(shareLink, "")
+		if err != nil {
+			libs.RequestLogger(c).Error("Failed to issue guest token for short link", "short_link_id", link.ID.Hex(), "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+			return
+		}
+		c.Redirect(http.StatusFound, libs.FrontendURL()+"/guest/"+board.ID.Hex()+"?token="+url.QueryEscape(guestToken))
+	case models.ShortLinkTargetExport:
+		sendShortLinkExport(c, link, board)
+	}
+}
+
+// sendShortLinkExport sends the board exported in the short link's format,
+// as anyone without access sees it, and records the export
+func sendShortLinkExport(c *gin.Context, link *models.ShortLink, board *models.Board) {
+	data := libs.VisibleBoardData(board.BoardData, primitive.NilObjectID)
+	shapes, _ := libs.ShapeList(data)
+	libs.RecordAudit(libs.RequestContext(c), models.AuditEvent{
+		Action: models.AuditBoardExported,
+		Actor:  auditActor(c, ""),
+		Target: &models.AuditTarget{Type: models.AuditTargetBoard, ID: board.ID.Hex()},
+		Details: map[string]interface{}{
+			"format":      link.Format,
+			"scope":       "board",
+			"destination": "short_link",
+			"shortLinkId": link.ID.Hex(),
+			"shapeCount":  len(shapes),
+			"version":     board.Version,
+		},
+	})
+
+	name := boardDisplayName(board.Name, board.BoardID)
+	c.Header("Content-Disposition", `inline; filename="`+exportFilename(name)+"."+link.Format+`"`)
+
+	contentType, ok := libs.RenderContentTypes[link.Format]
+	if !ok {
+		c.JSON(http.StatusOK, gin.H{
+			"format":      "boardsar",
+			"exportedAt":  time.Now().UTC(),
+			"boardId":     board.BoardID,
+			"name":        name,
+			"description": board.Description,
+			"version":     board.Version,
+			"board":       data,
+		})
+		return
+	}
+
+	var file bytes.Buffer
+	err := libs.ExportPool.Do(libs.RequestContext(c), func() error {
+		return libs.RenderBoard(libs.RequestContext(c), &file, data, link.Format, 1)
+	})
+	if err == libs.ErrWorkerPoolFull {
+		respondBusy(c)
+		return
+	}
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to render board", "board_id", board.ID.Hex(), "format", link.Format, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render board"})
+		return
+	}
+	c.Data(http.StatusOK, contentType, file.Bytes())
+}
+
+// shortLinkExportDenied says why userID may not publish an export of the
+// board, or returns ""
+func shortLinkExportDenied(board *models.Board, userID primitive.ObjectID) string {
+	if !libs.HasCapability(libs.BoardCapabilities(board, userID), models.CapabilityExport) {
+		return "Your access to this board doesn't include " + models.CapabilityExport
+	}
+	if err := libs.CheckExportPolicy(board, userID); err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+// findActiveShareLink loads an unrevoked share link of the board
+func findActiveShareLink(ctx context.Context, linkID, boardID primitive.ObjectID) (*models.ShareLink, error) {
+	var link models.ShareLink
+	err := libs.GetShareLinkCollection().FindOne(ctx, bson.M{
+		"_id":       linkID,
+		"boardId":   boardID,
+		"revokedAt": bson.M{"$exists": false},
+	}).Decode(&link)
+	if err == mongo.ErrNoDocuments {
+		return nil, libs.ErrInvalidShareLink
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
+
+// findBoardShortLink loads the linkId short link of the boardId board if
+// userID created it or owns the board, writing the error response otherwise
+func findBoardShortLink(ctx context.Context, c *gin.Context, userID primitive.ObjectID) (*models.ShortLink, bool) {
+	linkID, err := primitive.ObjectIDFromHex(c.Param("linkId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid short link ID"})
+		return nil, false
+	}
+
+	board, err := libs.BoardRepository(c).WithoutContents().FindByRef(ctx, c.Param("boardId"))
+	if errors.Is(err, repository.ErrNotFound) {
+		board = &models.Board{}
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve board: " + err.Error()})
+		return nil, false
+	}
+
+	var link models.ShortLink
+	err = libs.GetShortLinkCollection().FindOne(ctx, bson.M{"_id": linkID, "boardId": board.ID}).Decode(&link)
+	if err == mongo.ErrNoDocuments || (err == nil && link.OwnerID != userID && board.OwnerID != userID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Short link not found"})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve short link: " + err.Error()})
+		return nil, false
+	}
+	link.URL = libs.ShortLinkURL(link.Code)
+	return &link, true
+}
@@ -0,0 +1,145 @@
+package controllers
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	defaultLargestBoards = 10
+	maxLargestBoards     = 100
+)
+
+// GetStorageReport reports what each collection and GridFS bucket takes,
+// the largest boards and how storage grew over the last days (admin only)
+func GetStorageReport(c *gin.Context) {
+	largest := defaultLargestBoards
+	if value := c.Query("largest"); value != "" {
+		var err error
+		largest, err = strconv.Atoi(value)
+		if err != nil || largest < 1 || largest > maxLargestBoards {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "largest must be between 1 and " + strconv.Itoa(maxLargestBoards)})
+			return
+		}
+	}
+
+	ctx, cancel := libs.DBContextWithin(c, 2*time.Minute)
+	defer cancel()
+
+	report, err := libs.GetStorageReport(ctx, largest)
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to read storage stats", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// StartStorageMaintenance starts rebuilding indexes, compacting
+// collections or recalculating usage as a background job, and answers 202
+// with the job to follow (admin only)
+func StartStorageMaintenance(c *gin.Context) {
+	var req models.StorageMaintenanceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+
+	adminID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	collections := req.Collections
+	if req.Operation == models.StorageCompact {
+		ctx, cancel := libs.DBContext(c)
+		existing, err := libs.StorageCollections(ctx)
+		cancel()
+		if err != nil {
+			libs.RequestLogger(c).Error("Failed to list collections", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+			return
+		}
+		for _, name := range collections {
+			if !slices.Contains(existing, name) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown collection: " + name})
+				return
+			}
+		}
+		if len(collections) == 0 {
+			collections = existing
+		}
+	}
+
+	operation := req.Operation
+	logger := slog.With("operation", operation, "user_id", adminID.Hex())
+	_, job, err := libs.RunJob(libs.RequestContext(c), libs.MaintenancePool, adminID, true, func(ctx context.Context) libs.JobResult {
+		return runStorageMaintenance(ctx, logger, operation, collections)
+	})
+	if err == libs.ErrWorkerPoolFull {
+		respondBusy(c)
+		return
+	}
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to create job", "kind", libs.MaintenancePool.Name(), "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+		return
+	}
+
+	details := map[string]interface{}{"operation": operation, "jobId": job.ID.Hex()}
+	if operation == models.StorageCompact {
+		details["collections"] = collections
+	}
+	recordAudit(c, models.AuditStorageMaintenance, models.AuditTargetInstance, "", details)
+
+	c.Header("Location", "/api/jobs/"+job.ID.Hex())
+	c.JSON(http.StatusAccepted, jobResponse(job))
+}
+
+// runStorageMaintenance carries out a maintenance operation in its job
+func runStorageMaintenance(ctx context.Context, logger *slog.Logger, operation string, collections []string) libs.JobResult {
+	started := time.Now()
+	response := gin.H{"operation": operation}
+
+	switch operation {
+	case models.StorageRebuildIndexes:
+		indexes, err := libs.RebuildIndexes(ctx)
+		if err != nil {
+			logger.Error("Failed to rebuild indexes", "error", err)
+			return libs.JSONResult(http.StatusInternalServerError, gin.H{"error": "Failed to rebuild indexes"})
+		}
+		response["indexes"] = indexes
+	case models.StorageCompact:
+		results := libs.CompactCollections(ctx, collections)
+		var freed int64
+		for _, result := range results {
+			freed += result.BytesFreed
+		}
+		response["collections"] = results
+		response["bytesFreed"] = freed
+	case models.StorageRecalculateUsage:
+		boards, err := libs.RecalculateStorageUsage(ctx)
+		if err != nil {
+			logger.Error("Failed to recalculate usage", "boards", boards, "error", err)
+			return libs.JSONResult(http.StatusInternalServerError, gin.H{"error": "Failed to recalculate usage", "boards": boards})
+		}
+		response["boards"] = boards
+	}
+
+	response["durationMs"] = time.Since(started).Milliseconds()
+	logger.Info("Storage maintenance done", "duration_ms", response["durationMs"])
+	return libs.JSONResult(http.StatusOK, response)
+}
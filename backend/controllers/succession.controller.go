@@ -0,0 +1,270 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"github.com/sarwanazhar/boardsar/backend/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// GetSuccessionPolicy returns the policy handing the boards of members who
+// left to an admin (admin only)
+func GetSuccessionPolicy(c *gin.Context) {
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	policy, err := libs.GetSuccessionPolicy(ctx)
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to load succession policy", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve succession policy"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"policy": policy})
+}
+
+// PutSuccessionPolicy sets the succession policy. The successor must be an
+// active admin (admin only).
+func PutSuccessionPolicy(c *gin.Context) {
+	var req models.SuccessionPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+
+	adminID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	policy := models.SuccessionPolicy{
+		Enabled:      *req.Enabled,
+		InactiveDays: req.InactiveDays,
+		UpdatedBy:    adminID,
+		UpdatedAt:    time.Now(),
+	}
+	if req.SuccessorID != "" {
+		if policy.SuccessorID, err = primitive.ObjectIDFromHex(req.SuccessorID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid successor ID"})
+			return
+		}
+	} else if policy.Enabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "successorId is required to enable the policy"})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	if policy.Enabled {
+		if _, err := libs.FindSuccessor(ctx, policy.SuccessorID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if err := libs.SaveSuccessionPolicy(ctx, &policy); err != nil {
+		libs.RequestLogger(c).Error("Failed to save succession policy", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save succession policy"})
+		return
+	}
+	recordAudit(c, models.AuditSuccessionPolicyChanged, models.AuditTargetInstance, "", map[string]interface{}{
+		"enabled":      policy.Enabled,
+		"successorId":  policy.SuccessorID.Hex(),
+		"inactiveDays": policy.InactiveDays,
+	})
+
+	c.JSON(http.StatusOK, gin.H{"policy": policy})
+}
+
+// RunSuccessionPolicy applies the succession policy now rather than at its
+// next scheduled run, and returns what was handed over (admin only)
+func RunSuccessionPolicy(c *gin.Context) {
+	ctx, cancel := libs.DBContextWithin(c, 2*time.Minute)
+	defer cancel()
+
+	policy, err := libs.GetSuccessionPolicy(ctx)
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to load succession policy", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve succession policy"})
+		return
+	}
+	if !policy.Enabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "The succession policy is disabled"})
+		return
+	}
+
+	transfers, err := libs.ApplySuccessionPolicy(ctx, HandOverBoards(libs.BoardRepository(c)))
+	if errors.Is(err, libs.ErrInvalidSuccessor) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to apply succession policy", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to apply succession policy", "transfers": transfers})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"transfers": transfers})
+}
+
+// HandOverBoards returns what tells live sessions of the boards handed to
+// the successor, and the successor what they now own, looking the boards
+// up in repo
+func HandOverBoards(repo repository.BoardRepository) func(context.Context, *models.User, *models.SuccessionTransfer) {
+	return func(ctx context.Context, successor *models.User, transfer *models.SuccessionTransfer) {
+		logger := slog.With("user_id", transfer.FromUserID.Hex(), "successor_id", successor.ID.Hex())
+		for _, boardID := range transfer.BoardIDs {
+			boardChanged(ctx, boardID)
+		}
+		logger.Info("Handed over boards", "reason", transfer.Reason, "boards", len(transfer.BoardIDs))
+
+		member := transfer.FromUserID.Hex()
+		if user, err := libs.Users().FindByID(ctx, transfer.FromUserID); err == nil {
+			member = user.Email
+		}
+		url := libs.FrontendURL()
+		if len(transfer.BoardIDs) == 1 {
+			url += "/board/" + transfer.BoardIDs[0].Hex()
+		}
+		libs.Notify(successor.ID, models.Notification{
+			Kind:  models.NotificationShare,
+			Title: "Boards were transferred to you",
+			Body:  strconv.Itoa(len(transfer.BoardIDs)) + " boards of " + member + " are now yours.",
+			URL:   url,
+			Tag:   "succession-" + transfer.FromUserID.Hex(),
+		})
+
+		boards, err := repo.WithoutContents().ListByIDs(ctx, transfer.BoardIDs)
+		if err != nil {
+			logger.Warn("Failed to look up handed over boards", "error", err)
+		}
+		lines := make([]string, len(boards))
+		for i, board := range boards {
+			lines[i] = "- " + boardDisplayName(board.Name, board.BoardID) + ": " + libs.FrontendURL() + "/board/" + board.ID.Hex()
+		}
+
+		locale := userLocale(successor)
+		vars := map[string]string{
+			"member": member,
+			"count":  strconv.Itoa(len(transfer.BoardIDs)),
+			"reason": libs.Translate(locale, "succession.reason."+transfer.Reason, nil),
+			"boards": strings.Join(lines, "\n"),
+		}
+		err = libs.SendEmail(successor.Email,
+			libs.Translate(locale, "succession.subject", vars),
+			libs.LocalizedEmail(locale, successor.Email, libs.Translate(locale, "succession.body", vars)),
+		)
+		if err != nil {
+			logger.Error("Failed to send succession email", "error", err)
+		}
+	}
+}
+
+// DeactivateUser stops a member from signing in and signs them out
+// everywhere. Their boards stay until the succession policy hands them
+// over (admin only).
+func DeactivateUser(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.Param("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	if userID.Hex() == c.GetString("userId") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You can't deactivate your own account"})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	user, err := libs.Users().FindByID(ctx, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user: " + err.Error()})
+		return
+	}
+	if user.DeactivatedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "This account is already deactivated"})
+		return
+	}
+	policy, err := libs.GetSuccessionPolicy(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve succession policy"})
+		return
+	}
+	if policy.Enabled && policy.SuccessorID == user.ID {
+		c.JSON(http.StatusConflict, gin.H{"error": "They are the successor of the succession policy; choose another first"})
+		return
+	}
+
+	if err := libs.DeactivateUser(ctx, user); err != nil {
+		libs.RequestLogger(c).Error("Failed to deactivate user", "user_id", user.ID.Hex(), "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to deactivate user"})
+		return
+	}
+	if err := libs.RevokeUserRefreshTokens(ctx, user.ID); err != nil {
+		libs.RequestLogger(c).Error("Failed to revoke refresh tokens of deactivated user", "user_id", user.ID.Hex(), "error", err)
+	}
+	recordAudit(c, models.AuditUserDeactivated, models.AuditTargetUser, user.ID.Hex(), map[string]interface{}{
+		"email": user.Email,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "Account deactivated",
+		"userId":        user.ID.Hex(),
+		"deactivatedAt": user.DeactivatedAt,
+	})
+}
+
+// ReactivateUser lets a deactivated member sign in again. Boards already
+// handed over stay with the successor (admin only).
+func ReactivateUser(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.Param("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	user, err := libs.Users().FindByID(ctx, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user: " + err.Error()})
+		return
+	}
+	if user.DeactivatedAt == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "This account isn't deactivated"})
+		return
+	}
+
+	if err := libs.ReactivateUser(ctx, user.ID); err != nil {
+		libs.RequestLogger(c).Error("Failed to reactivate user", "user_id", user.ID.Hex(), "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reactivate user"})
+		return
+	}
+	recordAudit(c, models.AuditUserReactivated, models.AuditTargetUser, user.ID.Hex(), map[string]interface{}{
+		"email": user.Email,
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account reactivated", "userId": user.ID.Hex()})
+}
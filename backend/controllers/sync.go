@@ -0,0 +1,92 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Board list page sizes in compact mode
+const (
+	compactBoardPageSize    = 20
+	maxCompactBoardPageSize = 50
+)
+
+// boardListFields are the fields of each board in GET /api/boards that
+// ?fields= can pick; compact mode leaves out the heavy ones by default
+var (
+	boardListFields = []string{
+		"_id", "name", "description", "ownerId", "sharedWith", "collaborators", "parentBoardId",
+		"tags", "folderId", "starred", "version", "shapeCount", "collaboratorCount", "thumbnailVersion",
+		"createdAt", "updatedAt", "scale", "position", "shapes",
+	}
+	compactBoardListFields = []string{"_id", "name", "ownerId", "parentBoardId", "tags", "folderId", "starred", "version", "updatedAt"}
+)
+
+// boardStateFields are the fields of GET /api/boards/:id, likewise
+var (
+	boardStateFields        = []string{"name", "description", "board", "version", "exportPolicy", "facilitation"}
+	compactBoardStateFields = []string{"name", "board", "version", "exportPolicy", "facilitation"}
+)
+
+// compactMode reports whether the client asked for compact responses, as
+// the mobile app does: ?compact=true or an X-Sync-Mode: compact header
+func compactMode(c *gin.Context) bool {
+	return c.Query("compact") == "true" || strings.EqualFold(c.GetHeader("X-Sync-Mode"), "compact")
+}
+
+// responseFields returns the fields to include in a response: those named
+// in ?fields=, else the compact set in compact mode, else nil for all of
+// them. It answers 400 itself for an unknown field.
+func responseFields(c *gin.Context, all, compact []string) ([]string, bool) {
+	raw := c.Query("fields")
+	if raw == "" {
+		if compactMode(c) {
+			return compact, true
+		}
+		return nil, true
+	}
+
+	known := map[string]bool{}
+	for _, field := range all {
+		known[field] = true
+	}
+	fields := []string{}
+	for _, field := range strings.Split(raw, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if !known[field] {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("Unknown field %q (expected some of %s)", field, strings.Join(all, ", ")),
+			})
+			return nil, false
+		}
+		fields = append(fields, field)
+	}
+	return fields, true
+}
+
+// pickFields returns the JSON form of value with only the given fields
+func pickFields(value interface{}, fields []string) (gin.H, error) {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &all); err != nil {
+		return nil, err
+	}
+
+	picked := gin.H{}
+	for _, field := range fields {
+		if value, ok := all[field]; ok {
+			picked[field] = value
+		}
+	}
+	return picked, nil
+}
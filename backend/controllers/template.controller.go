@@ -0,0 +1,278 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"github.com/sarwanazhar/boardsar/backend/plugins"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// SaveBoardAsTemplate saves the board as the user sees it as a template.
+// Contents leave the board, so the board's export policy applies and the
+// save is audited as an export. Only admins can save global templates.
+func SaveBoardAsTemplate(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req models.SaveTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+		return
+	}
+	if req.Global && !isAdmin(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only admins can save global templates"})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	board, ok := findVisibleBoard(ctx, c, libs.BoardRepository(c), userID)
+	if !ok {
+		return
+	}
+
+	details := map[string]interface{}{
+		"format":      "template",
+		"scope":       "board",
+		"destination": "template",
+	}
+	if err := libs.CheckExportPolicy(board, userID); err != nil {
+		details["reason"] = board.ExportPolicy
+		libs.RecordAudit(libs.RequestContext(c), models.AuditEvent{
+			Action:  models.AuditBoardExported,
+			Outcome: models.AuditOutcomeFailure,
+			Actor:   auditActor(c, userID.Hex()),
+			Target:  &models.AuditTarget{Type: models.AuditTargetBoard, ID: board.ID.Hex()},
+			Details: details,
+		})
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	template := models.Template{
+		ID:            primitive.NewObjectID(),
+		Name:          name,
+		Description:   strings.TrimSpace(req.Description),
+		OwnerID:       userID,
+		Global:        req.Global,
+		BoardData:     libs.TemplateBoardData(board.BoardData, userID),
+		SourceBoardID: &board.ID,
+		CreatedAt:     time.Now(),
+	}
+	if err := libs.SaveTemplate(ctx, &template); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save template: " + err.Error()})
+		return
+	}
+
+	details["templateId"] = template.ID.Hex()
+	details["version"] = board.Version
+	recordAudit(c, models.AuditBoardExported, models.AuditTargetBoard, board.ID.Hex(), details)
+
+	template.BoardData = nil
+	c.JSON(http.StatusCreated, gin.H{
+		"message":  "Template saved successfully",
+		"template": template,
+	})
+}
+
+// GetTemplates lists the user's own templates and the global ones, without
+// their contents
+func GetTemplates(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	templates, err := libs.ListTemplates(ctx, userID, 0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve templates: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"templates": templates})
+}
+
+// GetTemplate returns one template with its contents
+func GetTemplate(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	template, ok := findTemplate(ctx, c, userID)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"template": template})
+}
+
+// DeleteTemplate removes a template. Users delete their own; global
+// templates can only be removed by admins.
+func DeleteTemplate(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	template, ok := findTemplate(ctx, c, userID)
+	if !ok {
+		return
+	}
+	if template.Global && !isAdmin(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only admins can delete global templates"})
+		return
+	}
+	if !template.Global && template.OwnerID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the template's owner can delete it"})
+		return
+	}
+
+	if err := libs.DeleteTemplate(ctx, template.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete template: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Template deleted successfully"})
+}
+
+// CreateBoardFromTemplate creates a new board owned by the user with the
+// template's contents
+func CreateBoardFromTemplate(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req models.CreateFromTemplateRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid request body: " + err.Error(),
+			})
+			return
+		}
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	template, ok := findTemplate(ctx, c, userID)
+	if !ok {
+		return
+	}
+
+	// Shape type schemas may have changed since the template was saved
+	if err := libs.ValidateBoardShapes(template.BoardData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Template no longer validates: " + err.Error()})
+		return
+	}
+
+	size := libs.BoardDataSize(template.BoardData)
+	if err := libs.CheckBoardSize(size); err != nil {
+		invalidBoard(c, err)
+		return
+	}
+
+	usage, err := libs.GetQuotaUsage(ctx, userID, primitive.NilObjectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check quota: " + err.Error()})
+		return
+	}
+	warnings, quotaErr := libs.ApplyQuota(c, usage, 1, size)
+	if quotaErr != "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": quotaErr})
+		return
+	}
+
+	boardID := req.BoardID
+	if boardID == "" {
+		boardID = uuid.New().String()
+	}
+	name := template.Name
+	if req.Name != nil {
+		name = strings.TrimSpace(*req.Name)
+	}
+
+	board := models.Board{
+		ID:          primitive.NewObjectID(),
+		BoardID:     boardID,
+		Name:        name,
+		Description: template.Description,
+		OwnerID:     userID,
+		BoardData:   template.BoardData,
+		Version:     1,
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+	}
+	if err := libs.BoardRepository(c).Create(ctx, &board); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create board: " + err.Error()})
+		return
+	}
+
+	recordAudit(c, models.AuditBoardCreated, models.AuditTargetBoard, board.ID.Hex(), map[string]interface{}{
+		"templateId": template.ID.Hex(),
+	})
+	plugins.Emit(libs.RequestContext(c), &board, plugins.EventBoardCreated, userID)
+	libs.RecordBoardVersion(libs.RequestContext(c), &board, userID)
+
+	response := gin.H{
+		"message": "Board created successfully",
+		"board":   transformBoardToFrontend(&board),
+		"version": board.Version,
+	}
+	if len(warnings) > 0 {
+		response["warnings"] = warnings
+	}
+	c.JSON(http.StatusCreated, response)
+}
+
+// findTemplate loads the template in the route that the user may use,
+// answering 404 otherwise
+func findTemplate(ctx context.Context, c *gin.Context, userID primitive.ObjectID) (*models.Template, bool) {
+	template, err := libs.FindTemplate(ctx, c.Param("templateId"), userID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve template: " + err.Error()})
+		return nil, false
+	}
+	return template, true
+}
+
+// isAdmin reports whether the signed-in user is an admin
+func isAdmin(c *gin.Context) bool {
+	user, err := libs.FindUserByID(libs.RequestContext(c), c.GetString("userId"))
+	return err == nil && user.Role == models.RoleAdmin
+}
@@ -0,0 +1,72 @@
+package controllers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// thumbnailCacheControl lets browsers reuse a thumbnail briefly and then
+// revalidate it with its ETag. Boards are private, so shared caches may not
+// keep it.
+const thumbnailCacheControl = "private, max-age=60"
+
+// GetBoardThumbnail serves a small PNG preview of the board, without
+// private notes. Thumbnails are redrawn in the background after saves, so
+// one may lag the board briefly; its ETag is the board version it shows. A
+// board without one yet is drawn now.
+func GetBoardThumbnail(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ctx, cancel := libs.DBContextWithin(c, 10*time.Second)
+	defer cancel()
+
+	board, ok := findVisibleBoard(ctx, c, libs.BoardRepository(c), userID)
+	if !ok {
+		return
+	}
+
+	thumbnail, err := libs.FindBoardThumbnail(ctx, board.ID)
+	switch {
+	case err == mongo.ErrNoDocuments:
+		thumbnail, err = libs.GenerateBoardThumbnail(ctx, board)
+	case err == nil && thumbnail.Metadata.Version < board.Version && !libs.QueueStaleThumbnail(board.ID):
+		thumbnail, err = libs.GenerateBoardThumbnail(ctx, board)
+	}
+	if err == libs.ErrWorkerPoolFull {
+		respondBusy(c)
+		return
+	}
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to get thumbnail of board", "board_id", board.ID.Hex(), "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+		return
+	}
+
+	etag := boardETag(thumbnail.Metadata.Version)
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", thumbnailCacheControl)
+	c.Header("Last-Modified", thumbnail.UploadDate.UTC().Format(http.TimeFormat))
+	if etagMatches(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	image, err := libs.OpenBoardThumbnail(ctx, thumbnail)
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to open thumbnail of board", "board_id", board.ID.Hex(), "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+		return
+	}
+	defer image.Close()
+
+	c.DataFromReader(http.StatusOK, thumbnail.Length, libs.RenderContentTypes[libs.RenderPNG], image, nil)
+}
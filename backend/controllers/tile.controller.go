@@ -0,0 +1,73 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// GetBoardTile serves one TileSize pixel square PNG tile of the board at
+// zoom level :z, without private notes, for minimaps and zoomed-out
+// overviews. Tiles are drawn from the shapes they cover only and cached
+// until the board changes; the ETag is the board version.
+func GetBoardTile(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var coords [3]int
+	for i, name := range []string{"z", "x", "y"} {
+		coords[i], err = strconv.Atoi(strings.TrimSuffix(c.Param(name), ".png"))
+		if err != nil {
+			break
+		}
+	}
+	z, x, y := coords[0], coords[1], coords[2]
+	if err != nil || !libs.ValidTile(z, x, y) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tile; zoom goes from 0 to " + strconv.Itoa(libs.MaxTileZoom)})
+		return
+	}
+
+	ctx, cancel := libs.DBContextWithin(c, 10*time.Second)
+	defer cancel()
+
+	board, ok := findVisibleBoard(ctx, c, libs.BoardRepository(c).WithoutContents(), userID)
+	if !ok {
+		return
+	}
+
+	etag := boardETag(board.Version)
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", thumbnailCacheControl)
+	if etagMatches(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	tile := libs.CachedBoardTile(board.ID, board.Version, z, x, y)
+	if tile == nil {
+		source, ok := shapeSourceOf(ctx, c, board)
+		if !ok {
+			return
+		}
+		tile, err = libs.RenderBoardTile(ctx, source, z, x, y)
+		if err == libs.ErrWorkerPoolFull {
+			respondBusy(c)
+			return
+		}
+		if err != nil {
+			libs.RequestLogger(c).Error("Failed to draw tile", "board_id", board.ID.Hex(), "z", z, "x", x, "y", y, "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+			return
+		}
+	}
+
+	c.Data(http.StatusOK, libs.RenderContentTypes[libs.RenderPNG], tile)
+}
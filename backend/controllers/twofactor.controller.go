@@ -0,0 +1,247 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// twoFactorCodeBody is a TOTP code, or for the endpoints that take one, a
+// recovery code
+type twoFactorCodeBody struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// GetTwoFactor reports whether two-factor authentication is on, and how
+// many recovery codes are left
+func GetTwoFactor(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	twoFactor, err := libs.FindTwoFactor(ctx, userID)
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to load two-factor", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+		return
+	}
+	if twoFactor == nil || twoFactor.EnabledAt == nil {
+		c.JSON(http.StatusOK, gin.H{"enabled": false})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":           true,
+		"enabledAt":         twoFactor.EnabledAt,
+		"recoveryCodesLeft": twoFactor.RecoveryCodesLeft(),
+	})
+}
+
+// SetUpTwoFactor hands out a new TOTP secret and its otpauth:// URI, to show
+// as a QR code. Two-factor stays off until POST /auth/2fa/enable gets a
+// code from it.
+func SetUpTwoFactor(c *gin.Context) {
+	user, err := libs.FindUserByID(libs.RequestContext(c), c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	secret, uri, err := libs.SetUpTwoFactor(ctx, user)
+	if err == libs.ErrTwoFactorEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to set up two-factor", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"secret": secret, "otpauthUrl": uri})
+}
+
+// EnableTwoFactor turns two-factor on with a code from the secret set up,
+// and returns the recovery codes, shown only this once
+func EnableTwoFactor(c *gin.Context) {
+	var body twoFactorCodeBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	codes, err := libs.EnableTwoFactor(ctx, userID, body.Code)
+	switch err {
+	case nil:
+	case libs.ErrTwoFactorEnabled:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case libs.ErrTwoFactorNotSetUp, libs.ErrInvalidTwoFactorCode:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	default:
+		libs.RequestLogger(c).Error("Failed to enable two-factor", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+		return
+	}
+
+	recordAudit(c, models.AuditTwoFactorEnabled, models.AuditTargetUser, userID.Hex(), nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication is on", "recoveryCodes": codes})
+}
+
+// DisableTwoFactor turns two-factor off, given a TOTP or recovery code
+func DisableTwoFactor(c *gin.Context) {
+	userID, ok := checkTwoFactorCode(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	if err := libs.DisableTwoFactor(ctx, userID); err != nil {
+		libs.RequestLogger(c).Error("Failed to disable two-factor", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+		return
+	}
+
+	recordAudit(c, models.AuditTwoFactorDisabled, models.AuditTargetUser, userID.Hex(), nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication is off"})
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes, given a TOTP or
+// recovery code, and returns the new ones
+func RegenerateRecoveryCodes(c *gin.Context) {
+	userID, ok := checkTwoFactorCode(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	codes, err := libs.RegenerateRecoveryCodes(ctx, userID)
+	if err == libs.ErrTwoFactorNotEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to regenerate recovery codes", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+		return
+	}
+
+	recordAudit(c, models.AuditRecoveryCodesRegenerated, models.AuditTargetUser, userID.Hex(), nil)
+
+	c.JSON(http.StatusOK, gin.H{"recoveryCodes": codes})
+}
+
+// checkTwoFactorCode checks the code in the body against the signed-in
+// user's second factor. It answers the request itself when it doesn't
+// check out.
+func checkTwoFactorCode(c *gin.Context) (primitive.ObjectID, bool) {
+	var body twoFactorCodeBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return primitive.NilObjectID, false
+	}
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return primitive.NilObjectID, false
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	_, err = libs.CheckTwoFactorCode(ctx, userID, body.Code)
+	switch err {
+	case nil:
+		return userID, true
+	case libs.ErrTwoFactorNotEnabled:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case libs.ErrInvalidTwoFactorCode:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		libs.RequestLogger(c).Error("Failed to check two-factor code", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+	}
+	return primitive.NilObjectID, false
+}
+
+// VerifyTwoFactor finishes a sign-in held for its second factor: with the
+// twoFactorToken the sign-in answered with and a TOTP or recovery code, it
+// answers like POST /auth/login
+func VerifyTwoFactor(c *gin.Context) {
+	type Body struct {
+		Token string `json:"token" binding:"required"`
+		Code  string `json:"code" binding:"required"`
+	}
+
+	var body Body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	challenge, recovery, err := libs.CompleteTwoFactorChallenge(ctx, body.Token, body.Code)
+	switch err {
+	case nil:
+	case libs.ErrInvalidTwoFactorChallenge:
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	case libs.ErrInvalidTwoFactorCode:
+		libs.RecordAudit(libs.RequestContext(c), models.AuditEvent{
+			Action:  models.AuditLoginFailed,
+			Outcome: models.AuditOutcomeFailure,
+			Actor:   auditActor(c, challenge.UserID.Hex()),
+			Details: map[string]interface{}{"reason": "wrong_two_factor_code"},
+		})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	default:
+		libs.RequestLogger(c).Error("Failed to check two-factor code", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+		return
+	}
+
+	user, err := libs.FindUserByID(libs.RequestContext(c), challenge.UserID.Hex())
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": libs.ErrInvalidTwoFactorChallenge.Error()})
+		return
+	}
+
+	details := challenge.Details
+	if details == nil {
+		details = map[string]interface{}{}
+	}
+	details["twoFactor"] = "totp"
+	if recovery {
+		details["twoFactor"] = "recovery_code"
+	}
+	startSession(c, user, details)
+}
@@ -0,0 +1,378 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"github.com/sarwanazhar/boardsar/backend/plugins"
+	"github.com/sarwanazhar/boardsar/backend/realtime"
+	"github.com/sarwanazhar/boardsar/backend/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// GetBoardVersions lists the board's saved versions, newest first, without
+// their contents
+func GetBoardVersions(c *gin.Context) {
+	listBoardVersions(c, false)
+}
+
+// GetBoardMilestones lists only the versions labelled as milestones
+func GetBoardMilestones(c *gin.Context) {
+	listBoardVersions(c, true)
+}
+
+func listBoardVersions(c *gin.Context, milestonesOnly bool) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	board, ok := findVisibleBoard(ctx, c, libs.BoardRepository(c).WithoutContents(), userID)
+	if !ok {
+		return
+	}
+
+	versions, err := libs.ListBoardVersions(ctx, board.ID, milestonesOnly)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve versions: " + err.Error()})
+		return
+	}
+
+	key := "versions"
+	if milestonesOnly {
+		key = "milestones"
+	}
+	c.JSON(http.StatusOK, gin.H{key: versions})
+}
+
+// GetBoardVersion returns one saved version with its contents, as the user
+// may see them
+func GetBoardVersion(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	board, ok := findVisibleBoard(ctx, c, libs.BoardRepository(c).WithoutContents(), userID)
+	if !ok {
+		return
+	}
+
+	version, ok := findBoardVersion(ctx, c, board.ID, c.Param("versionId"))
+	if !ok {
+		return
+	}
+	version.BoardData = libs.VisibleBoardData(version.BoardData, userID)
+
+	c.JSON(http.StatusOK, gin.H{"version": version})
+}
+
+// CreateBoardVersion saves the board's current state as a version, labelled
+// as a milestone if a label is given. Owners and editors only.
+func CreateBoardVersion(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req models.CreateBoardVersionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	boards := libs.BoardRepository(c)
+	board, ok := findVisibleBoard(ctx, c, boards, userID)
+	if !ok || !requireBoardEditor(c, board, userID) {
+		return
+	}
+
+	// Include edits still pending in a realtime session
+	if realtime.DefaultHub.FlushBoard(board.ID) {
+		var err error
+		if board, err = boards.FindByID(ctx, board.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve board: " + err.Error()})
+			return
+		}
+	}
+
+	version, err := libs.SaveBoardVersion(ctx, board, userID, req.Label)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save version: " + err.Error()})
+		return
+	}
+	version.BoardData = nil
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Version saved successfully",
+		"version": version,
+	})
+}
+
+// LabelBoardVersion labels a version as a named milestone, which keeps it
+// from being pruned. Owners and editors only.
+func LabelBoardVersion(c *gin.Context) {
+	var req models.BoardVersionLabelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+	setBoardVersionLabel(c, req.Label)
+}
+
+// UnlabelBoardVersion removes a milestone label; the version is pruned like
+// any other from then on. Owners and editors only.
+func UnlabelBoardVersion(c *gin.Context) {
+	setBoardVersionLabel(c, "")
+}
+
+func setBoardVersionLabel(c *gin.Context, label string) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	board, ok := findVisibleBoard(ctx, c, libs.BoardRepository(c).WithoutContents(), userID)
+	if !ok || !requireBoardEditor(c, board, userID) {
+		return
+	}
+
+	version, err := libs.LabelBoardVersion(ctx, board.ID, c.Param("versionId"), label, userID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Version not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to label version: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Version updated successfully",
+		"version": version,
+	})
+}
+
+// DiffBoardVersions compares two versions of the board (?from and ?to), or
+// a version with the current state when ?to is left out
+func DiffBoardVersions(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	if c.Query("from") == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from is required"})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	board, ok := findVisibleBoard(ctx, c, libs.BoardRepository(c), userID)
+	if !ok {
+		return
+	}
+
+	from, ok := findBoardVersion(ctx, c, board.ID, c.Query("from"))
+	if !ok {
+		return
+	}
+	to := &models.BoardVersion{BoardID: board.ID, Version: board.Version, BoardData: board.BoardData}
+	if c.Query("to") != "" {
+		if to, ok = findBoardVersion(ctx, c, board.ID, c.Query("to")); !ok {
+			return
+		}
+	}
+
+	diff := libs.DiffBoards(
+		libs.VisibleBoardData(from.BoardData, userID),
+		libs.VisibleBoardData(to.BoardData, userID),
+	)
+	from.BoardData, to.BoardData = nil, nil
+
+	c.JSON(http.StatusOK, gin.H{
+		"from":    from,
+		"to":      to,
+		"added":   diff.Added,
+		"removed": diff.Removed,
+		"changed": diff.Changed,
+	})
+}
+
+// RestoreBoardVersion replaces the board's contents with a saved version,
+// after backing up the current state so the restore can be undone. Owners
+// and editors only; facilitated session participants can't restore.
+func RestoreBoardVersion(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	board, ok := findVisibleBoard(ctx, c, libs.BoardRepository(c), userID)
+	if !ok || !requireBoardEditor(c, board, userID) {
+		return
+	}
+	if board.Facilitation != nil && board.OwnerID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the facilitator can restore versions during a facilitated session"})
+		return
+	}
+
+	version, ok := findBoardVersion(ctx, c, board.ID, c.Param("versionId"))
+	if !ok {
+		return
+	}
+
+	// Back up what is there now, including unsaved realtime edits
+	boards := libs.BoardRepository(c)
+	if realtime.DefaultHub.FlushBoard(board.ID) {
+		if board, err = boards.FindByID(ctx, board.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve board: " + err.Error()})
+			return
+		}
+	}
+
+	size := libs.BoardDataSize(version.BoardData)
+	if err := libs.CheckBoardSize(size); err != nil {
+		invalidBoard(c, err)
+		return
+	}
+
+	usage, err := libs.GetQuotaUsage(ctx, board.OwnerID, board.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check quota: " + err.Error()})
+		return
+	}
+	warnings, quotaErr := libs.ApplyQuota(c, usage, 0, size)
+	if quotaErr != "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": quotaErr})
+		return
+	}
+
+	backup, ok := backupBeforeOperation(ctx, c, board, userID, models.BackupBeforeRestore)
+	if !ok {
+		return
+	}
+
+	err = boards.SaveContents(ctx, board.ID, board.Version, 1, version.BoardData, map[string]interface{}{"updatedAt": time.Now()})
+	if errors.Is(err, repository.ErrVersionConflict) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Board changed while restoring; reload it and retry"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore version: " + err.Error()})
+		return
+	}
+
+	board.BoardData = version.BoardData
+	board.Version++
+	boardChanged(ctx, board.ID)
+	plugins.Emit(libs.RequestContext(c), board, plugins.EventBoardUpdated, userID)
+	libs.RecordBoardVersion(libs.RequestContext(c), board, userID)
+
+	c.Header("ETag", boardETag(board.Version))
+	response := gin.H{
+		"message":  "Version restored successfully",
+		"restored": version.ID.Hex(),
+		"board":    libs.VisibleBoardData(board.BoardData, userID),
+		"version":  board.Version,
+		"backup":   backupResponse(board, backup),
+	}
+	if len(warnings) > 0 {
+		response["warnings"] = warnings
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// backupBeforeOperation snapshots the board before a destructive operation.
+// If the backup can't be taken it answers 500 and reports false, so the
+// operation doesn't run without one.
+func backupBeforeOperation(ctx context.Context, c *gin.Context, board *models.Board, userID primitive.ObjectID, operation string) (*models.BoardVersion, bool) {
+	backup, err := libs.SaveBackupVersion(ctx, board, userID, operation)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to back up board: " + err.Error()})
+		return nil, false
+	}
+	return backup, true
+}
+
+// backupResponse describes a pre-operation backup and how to undo with it
+func backupResponse(board *models.Board, backup *models.BoardVersion) gin.H {
+	return gin.H{
+		"_id":       backup.ID.Hex(),
+		"version":   backup.Version,
+		"operation": backup.Backup,
+		"tag":       "pre-operation backup",
+		"restore":   "/api/boards/" + board.ID.Hex() + "/versions/" + backup.ID.Hex() + "/restore",
+	}
+}
+
+// findVisibleBoard loads the board named by the :boardId route parameter
+// from boards if the user can see it, answering 404 otherwise
+func findVisibleBoard(ctx context.Context, c *gin.Context, boards repository.BoardRepository, userID primitive.ObjectID) (*models.Board, bool) {
+	board, err := boards.FindForUser(ctx, c.Param("boardId"), userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Board not found or access denied"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve board: " + err.Error()})
+		return nil, false
+	}
+	return board, true
+}
+
+// requireBoardEditor answers 403 unless the user owns or edits the board
+func requireBoardEditor(c *gin.Context, board *models.Board, userID primitive.ObjectID) bool {
+	role := libs.BoardRole(board, userID)
+	if role != models.BoardRoleOwner && role != models.CollaboratorRoleEditor {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You have view-only access to this board"})
+		return false
+	}
+	return true
+}
+
+// findBoardVersion loads a version of the board, answering 404 if it
+// doesn't exist or was pruned
+func findBoardVersion(ctx context.Context, c *gin.Context, boardID primitive.ObjectID, versionID string) (*models.BoardVersion, bool) {
+	version, err := libs.FindBoardVersion(ctx, boardID, versionID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Version not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve version: " + err.Error()})
+		return nil, false
+	}
+	return version, true
+}
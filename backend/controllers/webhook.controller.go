@@ -0,0 +1,332 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Deliveries listed per request
+const (
+	defaultWebhookDeliveries = 50
+	maxWebhookDeliveries     = 200
+)
+
+// GetWebhooks lists the user's webhooks and the events they can choose
+func GetWebhooks(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	webhooks, err := libs.ListWebhooks(ctx, userID)
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to list webhooks", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"webhooks": webhooks, "events": models.WebhookEvents})
+}
+
+// CreateWebhook subscribes a URL to events of the user's boards: the
+// events given (all when omitted), of the boards given (all the user owns
+// when omitted). The signing secret is only returned here.
+func CreateWebhook(c *gin.Context) {
+	type Body struct {
+		URL      string   `json:"url" binding:"required"`
+		Events   []string `json:"events"`
+		BoardIDs []string `json:"boardIds"`
+		Active   *bool    `json:"active"`
+	}
+
+	var body Body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := libs.ValidateWebhookURL(c.Request.Context(), body.URL); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	events, ok := webhookEvents(c, body.Events)
+	if !ok {
+		return
+	}
+
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	boardIDs, ok := webhookBoards(ctx, c, userID, body.BoardIDs)
+	if !ok {
+		return
+	}
+
+	webhook, err := libs.CreateWebhook(ctx, &models.Webhook{
+		UserID:   userID,
+		URL:      body.URL,
+		Events:   events,
+		BoardIDs: boardIDs,
+		Active:   body.Active == nil || *body.Active,
+	})
+	if err == libs.ErrTooManyWebhooks {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to create webhook", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"webhook": webhook})
+}
+
+// GetWebhook returns one of the user's webhooks
+func GetWebhook(c *gin.Context) {
+	userID, webhookID, ok := webhookParams(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	webhook, err := libs.FindWebhook(ctx, userID, webhookID)
+	if err == libs.ErrWebhookNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to load webhook", "webhook_id", webhookID.Hex(), "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"webhook": webhook})
+}
+
+// UpdateWebhook changes a webhook's URL, events or boards, switches it on
+// or off, or with "rotateSecret": true gives it a new secret, returned
+// this once. Omitted fields are kept; empty lists mean all.
+func UpdateWebhook(c *gin.Context) {
+	type Body struct {
+		URL          *string   `json:"url"`
+		Events       *[]string `json:"events"`
+		BoardIDs     *[]string `json:"boardIds"`
+		Active       *bool     `json:"active"`
+		RotateSecret bool      `json:"rotateSecret"`
+	}
+
+	var body Body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, webhookID, ok := webhookParams(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	update := bson.M{}
+	if body.URL != nil {
+		if err := libs.ValidateWebhookURL(ctx, *body.URL); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		update["url"] = *body.URL
+	}
+	if body.Events != nil {
+		events, ok := webhookEvents(c, *body.Events)
+		if !ok {
+			return
+		}
+		update["events"] = events
+	}
+	if body.BoardIDs != nil {
+		boardIDs, ok := webhookBoards(ctx, c, userID, *body.BoardIDs)
+		if !ok {
+			return
+		}
+		update["boardIds"] = boardIDs
+	}
+	if body.Active != nil {
+		update["active"] = *body.Active
+	}
+	if len(update) == 0 && !body.RotateSecret {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "url, events, boardIds, active or rotateSecret is required"})
+		return
+	}
+
+	webhook, err := libs.UpdateWebhook(ctx, userID, webhookID, update, body.RotateSecret)
+	if err == libs.ErrWebhookNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to update webhook", "webhook_id", webhookID.Hex(), "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"webhook": webhook})
+}
+
+// DeleteWebhook removes a webhook; deliveries still pending are dropped
+func DeleteWebhook(c *gin.Context) {
+	userID, webhookID, ok := webhookParams(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	err := libs.DeleteWebhook(ctx, userID, webhookID)
+	if err == libs.ErrWebhookNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to delete webhook", "webhook_id", webhookID.Hex(), "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook deleted"})
+}
+
+// GetWebhookDeliveries lists a webhook's most recent deliveries (?limit,
+// default 50, up to 200) with how each went, for debugging a receiver
+func GetWebhookDeliveries(c *gin.Context) {
+	userID, webhookID, ok := webhookParams(c)
+	if !ok {
+		return
+	}
+	limit := int64(defaultWebhookDeliveries)
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed < 1 || parsed > maxWebhookDeliveries {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", maxWebhookDeliveries)})
+			return
+		}
+		limit = parsed
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	if _, err := libs.FindWebhook(ctx, userID, webhookID); err == libs.ErrWebhookNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		libs.RequestLogger(c).Error("Failed to load webhook", "webhook_id", webhookID.Hex(), "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+		return
+	}
+
+	deliveries, err := libs.ListWebhookDeliveries(ctx, webhookID, limit)
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to list deliveries of webhook", "webhook_id", webhookID.Hex(), "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"deliveries": deliveries})
+}
+
+// webhookEvents checks the events a webhook asked for, without duplicates;
+// it answers 400 itself for an unknown event
+func webhookEvents(c *gin.Context, events []string) ([]string, bool) {
+	result := []string{}
+	seen := map[string]bool{}
+	for _, event := range events {
+		if !slices.Contains(models.WebhookEvents, event) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("Unknown event %q (expected one of %s)", event, strings.Join(models.WebhookEvents, ", ")),
+			})
+			return nil, false
+		}
+		if !seen[event] {
+			seen[event] = true
+			result = append(result, event)
+		}
+	}
+	return result, true
+}
+
+// webhookBoards checks that the boards a webhook is narrowed to are the
+// user's own; it answers 400 itself otherwise
+func webhookBoards(ctx context.Context, c *gin.Context, userID primitive.ObjectID, ids []string) ([]primitive.ObjectID, bool) {
+	boardIDs := []primitive.ObjectID{}
+	seen := map[primitive.ObjectID]bool{}
+	for _, id := range ids {
+		boardID, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid board ID " + strconv.Quote(id)})
+			return nil, false
+		}
+		if !seen[boardID] {
+			seen[boardID] = true
+			boardIDs = append(boardIDs, boardID)
+		}
+	}
+	if len(boardIDs) == 0 {
+		return boardIDs, true
+	}
+
+	found, err := libs.BoardRepository(c).WithoutContents().ListByIDs(ctx, boardIDs)
+	if err != nil {
+		libs.RequestLogger(c).Error("Failed to check boards", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error. Please try again later."})
+		return nil, false
+	}
+	owned := 0
+	for _, board := range found {
+		if board.OwnerID == userID {
+			owned++
+		}
+	}
+	if owned != len(boardIDs) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Webhooks can only follow boards you own"})
+		return nil, false
+	}
+	return boardIDs, true
+}
+
+func webhookParams(c *gin.Context) (primitive.ObjectID, primitive.ObjectID, bool) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return primitive.NilObjectID, primitive.NilObjectID, false
+	}
+	webhookID, err := primitive.ObjectIDFromHex(c.Param("webhookId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook ID"})
+		return primitive.NilObjectID, primitive.NilObjectID, false
+	}
+	return userID, webhookID, true
+}
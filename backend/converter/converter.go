@@ -0,0 +1,361 @@
+// Package converter turns scenes saved by other whiteboard apps into
+// boardsar board state. Each source format lives in its own file; Convert
+// recognises the format and maps its elements onto our shape types (pen,
+// line, rect, circle, text, sticky, frame and image), approximating shapes
+// we have no equivalent for and skipping the rest.
+package converter
+
+import (
+	"encoding/json"
+	"errors"
+	"html"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Formats Convert understands
+const (
+	FormatExcalidraw = "excalidraw"
+	FormatTldraw     = "tldraw"
+	FormatMiro       = "miro"
+	FormatMural      = "mural"
+)
+
+var (
+	ErrUnknownFormat = errors.New("Unrecognised file: expected an Excalidraw, tldraw, Miro or Mural export")
+	ErrInvalidFile   = errors.New("File is not valid JSON")
+)
+
+// Result is a converted scene
+type Result struct {
+	Format string
+	// Name suggested by the file, "" when it has none
+	Name  string
+	Board map[string]interface{}
+	// Source element types with no equivalent here, with how many of each
+	// were left out
+	Skipped map[string]int
+	// Report lists each element left out, and why
+	Report []ReportItem
+	// Images are the image shapes, whose src is still the source's URL
+	Images []Image
+}
+
+// ReportItem is a source element that wasn't converted
+type ReportItem struct {
+	ID     string `json:"id"`
+	Type   string `json:"type"`
+	Reason string `json:"reason"`
+}
+
+// Image is an image shape and where its picture comes from: a URL or a
+// data: URL. Importing copies the picture into the board's assets.
+type Image struct {
+	ShapeID string
+	Source  string
+}
+
+// ellipseSegments is how many straight lines approximate an ellipse that
+// isn't round enough to be a circle
+const ellipseSegments = 32
+
+// arrowHeadLength and arrowHeadAngle shape the lines drawn for arrowheads
+const (
+	arrowHeadLength = 15
+	arrowHeadAngle  = math.Pi / 7
+)
+
+// Convert recognises the scene's format and converts it
+func Convert(data []byte) (*Result, error) {
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, ErrInvalidFile
+	}
+
+	switch {
+	case isExcalidraw(doc):
+		return convertExcalidraw(doc), nil
+	case isTldraw(doc):
+		return convertTldraw(doc), nil
+	case isMural(doc):
+		return convertMural(doc), nil
+	case isMiro(doc):
+		return convertMiro(doc), nil
+	}
+	return nil, ErrUnknownFormat
+}
+
+// point is a position on the board
+type point struct {
+	X, Y float64
+}
+
+// rotate turns p by angle radians around centre
+func (p point) rotate(centre point, angle float64) point {
+	if angle == 0 {
+		return p
+	}
+	sin, cos := math.Sincos(angle)
+	dx, dy := p.X-centre.X, p.Y-centre.Y
+	return point{centre.X + dx*cos - dy*sin, centre.Y + dx*sin + dy*cos}
+}
+
+// style is how a shape is painted. Empty colors and a zero width are left
+// out so the client's defaults apply.
+type style struct {
+	Stroke      string
+	Fill        string
+	StrokeWidth float64
+}
+
+func (s style) apply(shape map[string]interface{}) {
+	if s.Stroke != "" {
+		shape["stroke"] = s.Stroke
+	}
+	if s.Fill != "" {
+		shape["fill"] = s.Fill
+	}
+	if s.StrokeWidth > 0 {
+		shape["strokeWidth"] = round(s.StrokeWidth)
+	}
+}
+
+// builder collects converted shapes
+type builder struct {
+	result *Result
+	shapes []interface{}
+}
+
+func newBuilder(format string) *builder {
+	return &builder{result: &Result{Format: format, Skipped: map[string]int{}, Report: []ReportItem{}}}
+}
+
+// skip notes an element that isn't converted: by default because it has no
+// equivalent
+func (b *builder) skip(id, kind, reason string) {
+	if kind == "" {
+		kind = "unknown"
+	}
+	if reason == "" {
+		reason = "No equivalent shape"
+	}
+	b.result.Skipped[kind]++
+	b.result.Report = append(b.result.Report, ReportItem{ID: id, Type: kind, Reason: reason})
+}
+
+func (b *builder) add(shape map[string]interface{}) {
+	b.shapes = append(b.shapes, shape)
+}
+
+// box adds a rect, frame or sticky whose top-left corner is at origin and
+// which is turned by rotation radians around that corner, as the client
+// draws them
+func (b *builder) box(kind, id string, origin point, width, height, rotation float64, s style) map[string]interface{} {
+	shape := map[string]interface{}{
+		"id":     id,
+		"type":   kind,
+		"x":      round(origin.X),
+		"y":      round(origin.Y),
+		"width":  round(math.Abs(width)),
+		"height": round(math.Abs(height)),
+	}
+	setRotation(shape, rotation)
+	s.apply(shape)
+	b.add(shape)
+	return shape
+}
+
+// text adds a text shape with its top-left corner at origin
+func (b *builder) text(id, text string, origin point, fontSize, rotation float64, color string) {
+	if text == "" {
+		return
+	}
+	shape := map[string]interface{}{
+		"id":   id,
+		"type": "text",
+		"x":    round(origin.X),
+		"y":    round(origin.Y),
+		"text": text,
+	}
+	if fontSize > 0 {
+		shape["fontSize"] = round(fontSize)
+	}
+	if color != "" {
+		shape["fill"] = color
+	}
+	setRotation(shape, rotation)
+	b.add(shape)
+}
+
+// image adds an image shape with its top-left corner at origin, showing the
+// picture at source
+func (b *builder) image(id, source string, origin point, width, height, rotation float64) {
+	shape := map[string]interface{}{
+		"id":     id,
+		"type":   "image",
+		"x":      round(origin.X),
+		"y":      round(origin.Y),
+		"width":  round(math.Abs(width)),
+		"height": round(math.Abs(height)),
+		"src":    source,
+	}
+	setRotation(shape, rotation)
+	b.add(shape)
+	b.result.Images = append(b.result.Images, Image{ShapeID: id, Source: source})
+}
+
+// polyline adds a pen stroke or line through points
+func (b *builder) polyline(kind, id string, points []point, s style) {
+	if len(points) < 2 {
+		return
+	}
+	flat := make([]interface{}, 0, 2*len(points))
+	for _, p := range points {
+		flat = append(flat, round(p.X), round(p.Y))
+	}
+	shape := map[string]interface{}{
+		"id":     id,
+		"type":   kind,
+		"points": flat,
+	}
+	s.Fill = ""
+	s.apply(shape)
+	b.add(shape)
+}
+
+// ellipse adds a circle when the ellipse is round, and a closed line
+// around it otherwise
+func (b *builder) ellipse(id string, centre point, width, height, rotation float64, s style) {
+	width, height = math.Abs(width), math.Abs(height)
+	if width == 0 || height == 0 {
+		return
+	}
+	if math.Abs(width-height) <= 0.05*math.Max(width, height) {
+		shape := map[string]interface{}{
+			"id":     id,
+			"type":   "circle",
+			"x":      round(centre.X),
+			"y":      round(centre.Y),
+			"radius": round((width + height) / 4),
+		}
+		s.apply(shape)
+		b.add(shape)
+		return
+	}
+
+	points := make([]point, 0, ellipseSegments+1)
+	for i := 0; i <= ellipseSegments; i++ {
+		angle := 2 * math.Pi * float64(i) / ellipseSegments
+		p := point{centre.X + width/2*math.Cos(angle), centre.Y + height/2*math.Sin(angle)}
+		points = append(points, p.rotate(centre, rotation))
+	}
+	b.polyline("line", id, points, s)
+}
+
+// arrowHead adds the two strokes of an arrowhead pointing at tip, coming
+// from the direction of from
+func (b *builder) arrowHead(id string, from, tip point, s style) {
+	if from == tip {
+		return
+	}
+	angle := math.Atan2(tip.Y-from.Y, tip.X-from.X)
+	left := point{tip.X - arrowHeadLength*math.Cos(angle-arrowHeadAngle), tip.Y - arrowHeadLength*math.Sin(angle-arrowHeadAngle)}
+	right := point{tip.X - arrowHeadLength*math.Cos(angle+arrowHeadAngle), tip.Y - arrowHeadLength*math.Sin(angle+arrowHeadAngle)}
+	b.polyline("line", id, []point{left, tip, right}, s)
+}
+
+// finish wraps the shapes in a board state with the given viewport
+func (b *builder) finish(scale float64, position point) *Result {
+	if scale <= 0 {
+		scale = 1
+	}
+	shapes := b.shapes
+	if shapes == nil {
+		shapes = []interface{}{}
+	}
+	b.result.Board = map[string]interface{}{
+		"scale":    round(scale),
+		"position": map[string]interface{}{"x": round(position.X), "y": round(position.Y)},
+		"shapes":   shapes,
+	}
+	return b.result
+}
+
+// htmlBlockBreak matches the tags that start a line in rich text
+var htmlBlockBreak = regexp.MustCompile(`(?i)<br\s*/?>|</(p|div|li|h[1-6])>`)
+
+// htmlTag matches any other tag
+var htmlTag = regexp.MustCompile(`<[^>]*>`)
+
+// plainText flattens the HTML text of Miro and Mural widgets, putting
+// paragraphs on their own lines
+func plainText(value string) string {
+	value = htmlBlockBreak.ReplaceAllString(value, "\n")
+	value = htmlTag.ReplaceAllString(value, "")
+	return strings.TrimSpace(html.UnescapeString(value))
+}
+
+// clipToBox moves the end of a line from inside a box centred at centre,
+// of half its width and height, to the box's edge, so connectors between
+// boxes meet their outlines
+func clipToBox(from, centre point, halfWidth, halfHeight float64) point {
+	dx, dy := from.X-centre.X, from.Y-centre.Y
+	if (dx == 0 && dy == 0) || halfWidth <= 0 || halfHeight <= 0 {
+		return centre
+	}
+	t := math.Inf(1)
+	if dx != 0 {
+		t = math.Min(t, halfWidth/math.Abs(dx))
+	}
+	if dy != 0 {
+		t = math.Min(t, halfHeight/math.Abs(dy))
+	}
+	if t >= 1 {
+		// from is inside the box
+		return centre
+	}
+	return point{centre.X + dx*t, centre.Y + dy*t}
+}
+
+func setRotation(shape map[string]interface{}, radians float64) {
+	if degrees := round(radians * 180 / math.Pi); degrees != 0 {
+		shape["rotation"] = degrees
+	}
+}
+
+// round keeps coordinates to two decimals, which is plenty on screen and
+// keeps stored boards small
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+func str(m map[string]interface{}, key string) string {
+	value, _ := m[key].(string)
+	return value
+}
+
+func num(m map[string]interface{}, key string) float64 {
+	value, _ := m[key].(float64)
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0
+	}
+	return value
+}
+
+func obj(m map[string]interface{}, key string) map[string]interface{} {
+	value, _ := m[key].(map[string]interface{})
+	return value
+}
+
+// sortedKeys returns a map's keys in order, so output doesn't depend on
+// map iteration
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,262 @@
+package converter
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// FormatCSV is the format of converted CSV files
+const FormatCSV = "csv"
+
+// Layouts for CSV rows
+const (
+	LayoutGrid   = "grid"
+	LayoutKanban = "kanban"
+)
+
+// MaxCSVRows caps the notes a CSV import adds
+const MaxCSVRows = 500
+
+var (
+	ErrInvalidCSV  = errors.New("File is not valid CSV")
+	ErrEmptyCSV    = errors.New("The CSV has no rows under its header")
+	ErrTooManyRows = fmt.Errorf("The CSV has too many rows to import (%d max)", MaxCSVRows)
+	ErrNoGroupBy   = errors.New("A kanban layout needs the field to make columns of")
+)
+
+// Sticky note size and spacing, in board units
+const (
+	csvNoteSize    = 200
+	csvNoteGap     = 20
+	csvColumnPad   = 20
+	csvColumnTitle = 40
+)
+
+// csvNoteColors color the notes of each kanban column in turn
+var csvNoteColors = []string{"#fff9b1", "#d5f692", "#a6ccf5", "#ffc0cb", "#ffcee0", "#c9df56", "#fdaf83", "#b4a7f5"}
+
+// CSVOptions say how rows become notes. The zero value lays every field
+// of every row out in a grid.
+type CSVOptions struct {
+	Layout  string   // grid or kanban; grid when empty
+	GroupBy string   // Kanban: the field whose values are the columns
+	Fields  []string // Fields shown on the notes, in order; all when empty
+	Columns int      // Grid: notes per row; about square when 0
+}
+
+// CSVResult is a converted CSV file
+type CSVResult struct {
+	*Result
+	// Fields are the file's headers, to choose from
+	Fields []string
+	Rows   int
+	// Columns are the kanban columns, in the order their values first
+	// appear
+	Columns []CSVColumn
+}
+
+// CSVColumn is a kanban column and how many notes it has
+type CSVColumn struct {
+	Title string `json:"title"`
+	Notes int    `json:"notes"`
+}
+
+// ConvertCSV lays a CSV file's rows out as sticky notes, one per row under
+// its header row: in a grid, or in kanban columns with a frame per value of
+// one field
+func ConvertCSV(data []byte, opts CSVOptions) (*CSVResult, error) {
+	fields, rows, err := readCSV(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, ErrEmptyCSV
+	}
+	if len(rows) > MaxCSVRows {
+		return nil, ErrTooManyRows
+	}
+
+	index := make(map[string]int, len(fields))
+	for i, field := range fields {
+		index[field] = i
+	}
+	lookup := func(name string) (int, error) {
+		if i, ok := index[name]; ok {
+			return i, nil
+		}
+		return 0, fmt.Errorf("The CSV has no %q field", name)
+	}
+
+	group := -1
+	switch opts.Layout {
+	case "", LayoutGrid:
+		opts.Layout = LayoutGrid
+	case LayoutKanban:
+		if opts.GroupBy == "" {
+			return nil, ErrNoGroupBy
+		}
+		if group, err = lookup(opts.GroupBy); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("Unknown layout %q: expected grid or kanban", opts.Layout)
+	}
+
+	var shown []int
+	for _, name := range opts.Fields {
+		i, err := lookup(name)
+		if err != nil {
+			return nil, err
+		}
+		shown = append(shown, i)
+	}
+	if len(shown) == 0 {
+		// Every field, except the one the columns already say
+		for i := range fields {
+			if i != group {
+				shown = append(shown, i)
+			}
+		}
+	}
+
+	b := newBuilder(FormatCSV)
+	result := &CSVResult{Result: b.result, Fields: fields, Rows: len(rows), Columns: []CSVColumn{}}
+	if opts.Layout == LayoutKanban {
+		csvKanban(b, result, fields, rows, group, shown)
+	} else {
+		csvGrid(b, fields, rows, shown, opts.Columns)
+	}
+	b.finish(1, point{})
+	return result, nil
+}
+
+// readCSV reads the header row and the rows under it, leaving out blank
+// rows. The delimiter is a comma, semicolon or tab, whichever the header
+// uses most.
+func readCSV(data []byte) ([]string, [][]string, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	firstLine, _, _ := bytes.Cut(data, []byte("\n"))
+	delimiter, most := ',', 0
+	for _, candidate := range []rune{',', ';', '\t'} {
+		if count := bytes.Count(firstLine, []byte(string(candidate))); count > most {
+			delimiter, most = candidate, count
+		}
+	}
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comma = delimiter
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, nil, ErrInvalidCSV
+	}
+	if len(records) == 0 {
+		return nil, nil, ErrEmptyCSV
+	}
+
+	fields := make([]string, len(records[0]))
+	seen := map[string]bool{}
+	for i, field := range records[0] {
+		field = strings.TrimSpace(field)
+		if field == "" || seen[field] {
+			field = fmt.Sprintf("Column %d", i+1)
+		}
+		seen[field] = true
+		fields[i] = field
+	}
+
+	var rows [][]string
+	for _, record := range records[1:] {
+		row := make([]string, len(fields))
+		blank := true
+		for i := range row {
+			if i < len(record) {
+				row[i] = strings.TrimSpace(record[i])
+				blank = blank && row[i] == ""
+			}
+		}
+		if !blank {
+			rows = append(rows, row)
+		}
+	}
+	return fields, rows, nil
+}
+
+// csvNoteText is what a row's note says: the first field shown on its own,
+// then the others that have a value, named
+func csvNoteText(fields, row []string, shown []int) string {
+	var lines []string
+	for n, i := range shown {
+		switch {
+		case row[i] == "":
+		case n == 0:
+			lines = append(lines, row[i])
+		default:
+			lines = append(lines, fields[i]+": "+row[i])
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// csvNote adds the sticky note for a row
+func csvNote(b *builder, id string, origin point, text, color string) {
+	note := b.box("sticky", id, origin, csvNoteSize, csvNoteSize, 0, style{Fill: color})
+	if text != "" {
+		note["text"] = text
+	}
+}
+
+// csvGrid lays the notes out in rows of columns notes, left to right
+func csvGrid(b *builder, fields []string, rows [][]string, shown []int, columns int) {
+	if columns <= 0 {
+		columns = int(math.Ceil(math.Sqrt(float64(len(rows)))))
+	}
+	for n, row := range rows {
+		origin := point{
+			X: float64(n%columns) * (csvNoteSize + csvNoteGap),
+			Y: float64(n/columns) * (csvNoteSize + csvNoteGap),
+		}
+		csvNote(b, fmt.Sprintf("row-%d", n+1), origin, csvNoteText(fields, row, shown), csvNoteColors[0])
+	}
+}
+
+// csvKanban lays the notes out in a titled frame per value of the group
+// field, side by side, with each column's notes stacked top to bottom
+func csvKanban(b *builder, result *CSVResult, fields []string, rows [][]string, group int, shown []int) {
+	var order []string
+	members := map[string][]int{}
+	for n, row := range rows {
+		value := row[group]
+		if _, ok := members[value]; !ok {
+			order = append(order, value)
+		}
+		members[value] = append(members[value], n)
+	}
+
+	width := csvNoteSize + 2*csvColumnPad
+	for c, value := range order {
+		title := value
+		if title == "" {
+			title = "No " + fields[group]
+		}
+		notes := members[value]
+		result.Columns = append(result.Columns, CSVColumn{Title: title, Notes: len(notes)})
+
+		left := float64(c * (width + csvNoteGap))
+		height := csvColumnTitle + len(notes)*(csvNoteSize+csvNoteGap) - csvNoteGap + csvColumnPad
+		frame := b.box("frame", fmt.Sprintf("column-%d", c+1), point{left, 0}, float64(width), float64(height), 0, style{})
+		frame["title"] = title
+
+		color := csvNoteColors[c%len(csvNoteColors)]
+		for i, n := range notes {
+			origin := point{left + csvColumnPad, float64(csvColumnTitle + i*(csvNoteSize+csvNoteGap))}
+			csvNote(b, fmt.Sprintf("row-%d", n+1), origin, csvNoteText(fields, rows[n], shown), color)
+		}
+	}
+}
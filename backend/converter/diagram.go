@@ -0,0 +1,719 @@
+package converter
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Diagram syntaxes ConvertDiagram understands
+const (
+	SyntaxMermaid  = "mermaid"
+	SyntaxPlantUML = "plantuml"
+)
+
+// Diagrams larger than this are refused rather than laid out
+const (
+	MaxDiagramNodes = 500
+	MaxDiagramEdges = 1000
+)
+
+var (
+	ErrUnknownDiagram  = errors.New("Unrecognised diagram: expected a Mermaid flowchart or a PlantUML diagram")
+	ErrEmptyDiagram    = errors.New("The diagram has no nodes")
+	ErrDiagramTooLarge = fmt.Errorf("The diagram is too large to lay out (%d nodes and %d edges max)", MaxDiagramNodes, MaxDiagramEdges)
+)
+
+// Node shapes, as drawn
+const (
+	nodeRect    = "rect"
+	nodeRound   = "round"
+	nodeCircle  = "circle"
+	nodeDiamond = "diamond"
+)
+
+// Layout spacing and node sizing, in board units
+const (
+	diagramNodeSep   = 40
+	diagramRankSep   = 70
+	diagramFontSize  = 16
+	diagramPadding   = 16
+	diagramMinWidth  = 100
+	diagramMinHeight = 48
+	diagramGroupPad  = 24
+)
+
+// graph is a parsed diagram: nodes in the order they were first named, and
+// the edges between them
+type graph struct {
+	direction string // TB, BT, LR or RL
+	nodes     []*graphNode
+	byID      map[string]*graphNode
+	edges     []*graphEdge
+	groups    []*graphGroup
+	// Statements that couldn't be read
+	unreadable []ReportItem
+}
+
+type graphNode struct {
+	id, label, shape string
+	width, height    float64
+
+	// Layout
+	layer, order int
+	x, y         float64 // Centre
+	dummy        bool
+	up, down     []*graphNode
+}
+
+type graphEdge struct {
+	from, to     string
+	label        string
+	thick        bool
+	hidden       bool // Only spaces the nodes out
+	arrowStart   bool
+	arrowEnd     bool
+	reversed     bool         // Turned around to break a cycle
+	chain        []*graphNode // Dummy nodes the edge passes through
+	startAt, end *graphNode
+}
+
+// graphGroup is a Mermaid subgraph or PlantUML package, drawn as a frame
+// around its members
+type graphGroup struct {
+	id, title string
+	members   []string
+	children  []*graphGroup
+
+	// Frame, once drawn
+	bounds *rectangle
+}
+
+type rectangle struct {
+	minX, minY, maxX, maxY float64
+}
+
+func newGraph() *graph {
+	return &graph{direction: "TB", byID: map[string]*graphNode{}}
+}
+
+// node returns the node with the ID, adding it labelled with its ID if it
+// is new
+func (g *graph) node(id string) *graphNode {
+	if node, ok := g.byID[id]; ok {
+		return node
+	}
+	node := &graphNode{id: id, label: id, shape: nodeRect}
+	g.nodes = append(g.nodes, node)
+	g.byID[id] = node
+	return node
+}
+
+// define sets a node's label and shape when the diagram gives them
+func (g *graph) define(id, label, shape string) *graphNode {
+	node := g.node(id)
+	if label != "" {
+		node.label = label
+	}
+	if shape != "" {
+		node.shape = shape
+	}
+	return node
+}
+
+// unread notes a statement that couldn't be read
+func (g *graph) unread(line int, statement string) {
+	if len([]rune(statement)) > 60 {
+		statement = string([]rune(statement)[:60]) + "…"
+	}
+	g.unreadable = append(g.unreadable, ReportItem{
+		ID:     fmt.Sprintf("line %d", line),
+		Type:   "statement",
+		Reason: fmt.Sprintf("Could not read %q", statement),
+	})
+}
+
+func (g *graph) connect(from, to string, edge graphEdge) {
+	g.node(from)
+	g.node(to)
+	edge.from, edge.to = from, to
+	g.edges = append(g.edges, &edge)
+}
+
+// mermaidHeader matches the first line of a Mermaid flowchart
+var mermaidHeader = regexp.MustCompile(`^(graph|flowchart)\b`)
+
+// ConvertDiagram lays out a Mermaid flowchart or PlantUML diagram and draws
+// it as shapes: a box (or circle or diamond) and label per node, and a line
+// with its arrowheads and label per edge, each grouped. syntax is detected
+// when empty.
+func ConvertDiagram(source, syntax string) (*Result, error) {
+	if syntax == "" {
+		syntax = detectDiagram(source)
+	}
+
+	var g *graph
+	var err error
+	switch syntax {
+	case SyntaxMermaid:
+		g, err = parseMermaid(source)
+	case SyntaxPlantUML:
+		g, err = parsePlantUML(source)
+	default:
+		return nil, ErrUnknownDiagram
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(g.nodes) == 0 {
+		return nil, ErrEmptyDiagram
+	}
+	if len(g.nodes) > MaxDiagramNodes || len(g.edges) > MaxDiagramEdges {
+		return nil, ErrDiagramTooLarge
+	}
+
+	for _, node := range g.nodes {
+		sizeNode(node)
+	}
+	layoutGraph(g)
+	return drawGraph(g, syntax), nil
+}
+
+// detectDiagram tells the syntax from the first line that isn't blank or a
+// comment
+func detectDiagram(source string) string {
+	for _, line := range strings.Split(source, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "", strings.HasPrefix(line, "%%"), strings.HasPrefix(line, "'"):
+			continue
+		case strings.HasPrefix(line, "@start"):
+			return SyntaxPlantUML
+		case mermaidHeader.MatchString(line):
+			return SyntaxMermaid
+		}
+		return ""
+	}
+	return ""
+}
+
+// sizeNode fits a node around its label
+func sizeNode(node *graphNode) {
+	if node.label == "" {
+		// The start and end of a state machine
+		node.width, node.height = 24, 24
+		return
+	}
+	lines := strings.Split(node.label, "\n")
+	longest := 0
+	for _, line := range lines {
+		longest = max(longest, len([]rune(line)))
+	}
+	textWidth := float64(longest)*diagramFontSize*0.6 + 2*diagramPadding
+	textHeight := float64(len(lines))*diagramFontSize*1.2 + 2*diagramPadding
+	node.width = math.Max(diagramMinWidth, textWidth)
+	node.height = math.Max(diagramMinHeight, textHeight)
+	switch node.shape {
+	case nodeCircle:
+		side := math.Max(diagramMinHeight, math.Max(textWidth, textHeight))
+		node.width, node.height = side, side
+	case nodeDiamond:
+		// The label has to fit inside the diamond
+		node.width, node.height = node.width*1.5, node.height*1.5
+	}
+}
+
+// layoutGraph places the sized nodes in layers along the diagram's
+// direction, as dagre does: cycles are broken, nodes are layered by longest
+// path, edges spanning several layers get a dummy node per layer, layers
+// are ordered to cut crossings, and nodes are lined up with their
+// neighbours
+func layoutGraph(g *graph) {
+	horizontal := g.direction == "LR" || g.direction == "RL"
+	if horizontal {
+		for _, node := range g.nodes {
+			node.width, node.height = node.height, node.width
+		}
+	}
+
+	breakCycles(g)
+	layers := layerNodes(g)
+	orderLayers(layers)
+	placeNodes(layers)
+
+	for _, node := range allNodes(layers) {
+		switch g.direction {
+		case "BT":
+			node.y = -node.y
+		case "LR":
+			node.x, node.y = node.y, node.x
+		case "RL":
+			node.x, node.y = -node.y, node.x
+		}
+		if horizontal {
+			node.width, node.height = node.height, node.width
+		}
+	}
+}
+
+// breakCycles turns around the edges that close a cycle, found depth first,
+// so the graph can be layered. Self loops are left out of the layout.
+func breakCycles(g *graph) {
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := map[string]int{}
+	outgoing := map[string][]*graphEdge{}
+	for _, edge := range g.edges {
+		outgoing[edge.from] = append(outgoing[edge.from], edge)
+	}
+
+	var visit func(id string)
+	visit = func(id string) {
+		state[id] = visiting
+		for _, edge := range outgoing[id] {
+			switch state[edge.to] {
+			case unvisited:
+				visit(edge.to)
+			case visiting:
+				edge.reversed = true
+			}
+		}
+		state[id] = done
+	}
+	for _, node := range g.nodes {
+		if state[node.id] == unvisited {
+			visit(node.id)
+		}
+	}
+}
+
+// layerNodes puts each node one layer below the lowest node pointing at
+// it, then adds dummy nodes to edges that skip layers
+func layerNodes(g *graph) [][]*graphNode {
+	parents := map[string][]string{}
+	for _, edge := range g.edges {
+		from, to := edge.from, edge.to
+		if from == to {
+			continue
+		}
+		if edge.reversed {
+			from, to = to, from
+		}
+		parents[to] = append(parents[to], from)
+	}
+
+	layer := map[string]int{}
+	var depth func(id string, seen int) int
+	depth = func(id string, seen int) int {
+		if value, ok := layer[id]; ok {
+			return value
+		}
+		value := 0
+		if seen < len(g.nodes) {
+			for _, parent := range parents[id] {
+				value = max(value, depth(parent, seen+1)+1)
+			}
+		}
+		layer[id] = value
+		return value
+	}
+
+	var layers [][]*graphNode
+	add := func(node *graphNode) {
+		for len(layers) <= node.layer {
+			layers = append(layers, nil)
+		}
+		node.order = len(layers[node.layer])
+		layers[node.layer] = append(layers[node.layer], node)
+	}
+	for _, node := range g.nodes {
+		node.layer = depth(node.id, 0)
+		add(node)
+	}
+
+	for i, edge := range g.edges {
+		if edge.from == edge.to {
+			continue
+		}
+		top, bottom := g.byID[edge.from], g.byID[edge.to]
+		if edge.reversed {
+			top, bottom = bottom, top
+		}
+		previous := top
+		for l := top.layer + 1; l < bottom.layer; l++ {
+			dummy := &graphNode{id: fmt.Sprintf("edge-%d-%d", i, l), dummy: true, layer: l}
+			add(dummy)
+			edge.chain = append(edge.chain, dummy)
+			link(previous, dummy)
+			previous = dummy
+		}
+		link(previous, bottom)
+		edge.startAt, edge.end = top, bottom
+	}
+	return layers
+}
+
+func link(upper, lower *graphNode) {
+	upper.down = append(upper.down, lower)
+	lower.up = append(lower.up, upper)
+}
+
+// orderLayers sorts each layer by the average position of its neighbours,
+// sweeping down and up, and keeps the order with the fewest crossings
+func orderLayers(layers [][]*graphNode) {
+	best := snapshotOrder(layers)
+	bestCrossings := countCrossings(layers)
+
+	for sweep := 0; sweep < 8 && bestCrossings > 0; sweep++ {
+		if sweep%2 == 0 {
+			for l := 1; l < len(layers); l++ {
+				sortByBarycenter(layers[l], func(n *graphNode) []*graphNode { return n.up })
+			}
+		} else {
+			for l := len(layers) - 2; l >= 0; l-- {
+				sortByBarycenter(layers[l], func(n *graphNode) []*graphNode { return n.down })
+			}
+		}
+		if crossings := countCrossings(layers); crossings < bestCrossings {
+			best, bestCrossings = snapshotOrder(layers), crossings
+		}
+	}
+
+	for l, layer := range best {
+		copy(layers[l], layer)
+		for i, node := range layers[l] {
+			node.order = i
+		}
+	}
+}
+
+func snapshotOrder(layers [][]*graphNode) [][]*graphNode {
+	snapshot := make([][]*graphNode, len(layers))
+	for l, layer := range layers {
+		snapshot[l] = append([]*graphNode(nil), layer...)
+	}
+	return snapshot
+}
+
+// sortByBarycenter orders a layer by where its neighbours are. Nodes
+// without neighbours keep their place.
+func sortByBarycenter(layer []*graphNode, neighbours func(*graphNode) []*graphNode) {
+	weight := make(map[*graphNode]float64, len(layer))
+	for _, node := range layer {
+		weight[node] = float64(node.order)
+		if adjacent := neighbours(node); len(adjacent) > 0 {
+			sum := 0.0
+			for _, other := range adjacent {
+				sum += float64(other.order)
+			}
+			weight[node] = sum / float64(len(adjacent))
+		}
+	}
+	sort.SliceStable(layer, func(i, j int) bool { return weight[layer[i]] < weight[layer[j]] })
+	for i, node := range layer {
+		node.order = i
+	}
+}
+
+// countCrossings counts the pairs of edges between neighbouring layers
+// that cross
+func countCrossings(layers [][]*graphNode) int {
+	crossings := 0
+	for l := 0; l+1 < len(layers); l++ {
+		var pairs [][2]int
+		for _, node := range layers[l] {
+			for _, lower := range node.down {
+				pairs = append(pairs, [2]int{node.order, lower.order})
+			}
+		}
+		for i := range pairs {
+			for j := i + 1; j < len(pairs); j++ {
+				if (pairs[i][0]-pairs[j][0])*(pairs[i][1]-pairs[j][1]) < 0 {
+					crossings++
+				}
+			}
+		}
+	}
+	return crossings
+}
+
+// placeNodes stacks the layers and spaces each one out, then pulls nodes
+// towards their neighbours while keeping their order and spacing
+func placeNodes(layers [][]*graphNode) {
+	y := 0.0
+	for l, layer := range layers {
+		tallest := 0.0
+		for _, node := range layer {
+			tallest = math.Max(tallest, node.height)
+		}
+		if l > 0 {
+			y += diagramRankSep
+		}
+		x := 0.0
+		for i, node := range layer {
+			if i > 0 {
+				x += gap(layer[i-1], node)
+			}
+			node.x, node.y = x, y+tallest/2
+		}
+		y += tallest
+	}
+
+	for pass := 0; pass < 8; pass++ {
+		if pass%2 == 0 {
+			for l := 1; l < len(layers); l++ {
+				alignLayer(layers[l], func(n *graphNode) []*graphNode { return n.up })
+			}
+		} else {
+			for l := len(layers) - 2; l >= 0; l-- {
+				alignLayer(layers[l], func(n *graphNode) []*graphNode { return n.down })
+			}
+		}
+	}
+
+	minX := math.Inf(1)
+	for _, node := range allNodes(layers) {
+		minX = math.Min(minX, node.x-node.width/2)
+	}
+	for _, node := range allNodes(layers) {
+		node.x -= minX
+	}
+}
+
+// gap is the distance between the centres of neighbours in a layer
+func gap(left, right *graphNode) float64 {
+	sep := float64(diagramNodeSep)
+	if left.dummy || right.dummy {
+		sep /= 2
+	}
+	return left.width/2 + sep + right.width/2
+}
+
+// alignLayer moves each node towards the average position of its
+// neighbours. Packing the layer from the left and from the right both keep
+// the spacing, and so does their average, which is used.
+func alignLayer(layer []*graphNode, neighbours func(*graphNode) []*graphNode) {
+	if len(layer) == 0 {
+		return
+	}
+	wanted := make([]float64, len(layer))
+	for i, node := range layer {
+		wanted[i] = node.x
+		if adjacent := neighbours(node); len(adjacent) > 0 {
+			sum := 0.0
+			for _, other := range adjacent {
+				sum += other.x
+			}
+			wanted[i] = sum / float64(len(adjacent))
+		}
+	}
+
+	fromLeft := make([]float64, len(layer))
+	for i := range layer {
+		fromLeft[i] = wanted[i]
+		if i > 0 {
+			fromLeft[i] = math.Max(wanted[i], fromLeft[i-1]+gap(layer[i-1], layer[i]))
+		}
+	}
+	fromRight := make([]float64, len(layer))
+	for i := len(layer) - 1; i >= 0; i-- {
+		fromRight[i] = wanted[i]
+		if i < len(layer)-1 {
+			fromRight[i] = math.Min(wanted[i], fromRight[i+1]-gap(layer[i], layer[i+1]))
+		}
+	}
+	for i, node := range layer {
+		node.x = (fromLeft[i] + fromRight[i]) / 2
+	}
+}
+
+func allNodes(layers [][]*graphNode) []*graphNode {
+	var nodes []*graphNode
+	for _, layer := range layers {
+		nodes = append(nodes, layer...)
+	}
+	return nodes
+}
+
+// drawGraph turns the laid out graph into shapes, with the top-left corner
+// of the diagram at the origin
+func drawGraph(g *graph, syntax string) *Result {
+	b := newBuilder(syntax)
+	for _, item := range g.unreadable {
+		b.skip(item.ID, item.Type, item.Reason)
+	}
+
+	minX, minY := math.Inf(1), math.Inf(1)
+	for _, node := range g.nodes {
+		minX = math.Min(minX, node.x-node.width/2)
+		minY = math.Min(minY, node.y-node.height/2)
+	}
+	for _, group := range g.groups {
+		if bounds := groupBounds(g, group); bounds != nil {
+			minX, minY = math.Min(minX, bounds.minX), math.Min(minY, bounds.minY)
+		}
+	}
+	shift := func(p point) point { return point{p.X - minX, p.Y - minY} }
+
+	// Frames first, outermost first, so they stay behind what they hold
+	for i, group := range g.groups {
+		if bounds := groupBounds(g, group); bounds != nil {
+			corner := shift(point{bounds.minX, bounds.minY})
+			frame := b.box("frame", fmt.Sprintf("group-%d", i), corner, bounds.maxX-bounds.minX, bounds.maxY-bounds.minY, 0, style{})
+			if group.title != "" {
+				frame["title"] = group.title
+			}
+		}
+	}
+
+	stroke := style{Stroke: "#1e1e1e", Fill: "#ffffff", StrokeWidth: 2}
+	for _, node := range g.nodes {
+		id := "node-" + node.id
+		centre := shift(point{node.x, node.y})
+		start := len(b.shapes)
+		switch node.shape {
+		case nodeCircle:
+			b.ellipse(id, centre, node.width, node.height, 0, stroke)
+		case nodeDiamond:
+			hw, hh := node.width/2, node.height/2
+			b.polyline("line", id, []point{
+				{centre.X, centre.Y - hh}, {centre.X + hw, centre.Y},
+				{centre.X, centre.Y + hh}, {centre.X - hw, centre.Y},
+				{centre.X, centre.Y - hh},
+			}, stroke)
+		default:
+			b.box("rect", id, point{centre.X - node.width/2, centre.Y - node.height/2}, node.width, node.height, 0, stroke)
+		}
+		drawLabel(b, id+"-label", node.label, centre)
+		group(b, start, id)
+	}
+
+	for i, edge := range g.edges {
+		if !edge.hidden {
+			drawEdge(b, g, i, edge, shift)
+		}
+	}
+
+	return b.finish(1, point{})
+}
+
+// drawLabel adds text centred on a point
+func drawLabel(b *builder, id, text string, centre point) {
+	lines := strings.Split(text, "\n")
+	longest := 0
+	for _, line := range lines {
+		longest = max(longest, len([]rune(line)))
+	}
+	width := float64(longest) * diagramFontSize * 0.6
+	height := float64(len(lines)) * diagramFontSize * 1.2
+	b.text(id, text, point{centre.X - width/2, centre.Y - height/2}, diagramFontSize, 0, "")
+}
+
+// group marks the shapes added since start as one element
+func group(b *builder, start int, id string) {
+	for _, item := range b.shapes[start:] {
+		item.(map[string]interface{})["groupId"] = id
+	}
+}
+
+// groupBounds is where a group's frame goes: around its members and the
+// groups inside it, with room for its title. It is nil for a group with
+// nothing in it.
+func groupBounds(g *graph, group *graphGroup) *rectangle {
+	if group.bounds != nil {
+		return group.bounds
+	}
+	inner := rectangle{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+	for _, id := range group.members {
+		if node, ok := g.byID[id]; ok {
+			inner.minX, inner.maxX = math.Min(inner.minX, node.x-node.width/2), math.Max(inner.maxX, node.x+node.width/2)
+			inner.minY, inner.maxY = math.Min(inner.minY, node.y-node.height/2), math.Max(inner.maxY, node.y+node.height/2)
+		}
+	}
+	for _, child := range group.children {
+		if bounds := groupBounds(g, child); bounds != nil {
+			inner.minX, inner.maxX = math.Min(inner.minX, bounds.minX), math.Max(inner.maxX, bounds.maxX)
+			inner.minY, inner.maxY = math.Min(inner.minY, bounds.minY), math.Max(inner.maxY, bounds.maxY)
+		}
+	}
+	if math.IsInf(inner.minX, 1) {
+		return nil
+	}
+	titleSpace := 0.0
+	if group.title != "" {
+		titleSpace = diagramFontSize * 1.5
+	}
+	group.bounds = &rectangle{
+		minX: inner.minX - diagramGroupPad,
+		minY: inner.minY - diagramGroupPad - titleSpace,
+		maxX: inner.maxX + diagramGroupPad,
+		maxY: inner.maxY + diagramGroupPad,
+	}
+	return group.bounds
+}
+
+// drawEdge draws an edge from outline to outline through its dummy nodes,
+// with its arrowheads and label
+func drawEdge(b *builder, g *graph, i int, edge *graphEdge, shift func(point) point) {
+	id := fmt.Sprintf("edge-%d", i)
+	s := style{Stroke: "#1e1e1e", StrokeWidth: 2}
+	if edge.thick {
+		s.StrokeWidth = 4
+	}
+	start := len(b.shapes)
+
+	points := edgeRoute(g, edge)
+	for j := range points {
+		points[j] = shift(points[j])
+	}
+
+	last := len(points) - 1
+	b.polyline("line", id, points, s)
+	if edge.arrowEnd {
+		b.arrowHead(id+"-end", points[last-1], points[last], s)
+	}
+	if edge.arrowStart {
+		b.arrowHead(id+"-start", points[1], points[0], s)
+	}
+	if edge.label != "" {
+		a, c := points[last/2], points[(last+1)/2]
+		if a == c && last > 0 {
+			c = points[last/2+1]
+		}
+		drawLabel(b, id+"-label", edge.label, point{(a.X + c.X) / 2, (a.Y + c.Y) / 2})
+	}
+	group(b, start, id)
+}
+
+// edgeRoute is the path of a laid out edge, from outline to outline
+// through its dummy nodes, or a loop for an edge from a node to itself
+func edgeRoute(g *graph, edge *graphEdge) []point {
+	from, to := g.byID[edge.from], g.byID[edge.to]
+	var points []point
+	if from == to {
+		// A loop off the node's right side
+		right, top := from.x+from.width/2, from.y-from.height/4
+		points = []point{{right, top}, {right + 30, top}, {right + 30, top + from.height/2}, {right, top + from.height/2}}
+	} else {
+		points = append(points, point{edge.startAt.x, edge.startAt.y})
+		for _, dummy := range edge.chain {
+			points = append(points, point{dummy.x, dummy.y})
+		}
+		points = append(points, point{edge.end.x, edge.end.y})
+		if edge.reversed {
+			for l, r := 0, len(points)-1; l < r; l, r = l+1, r-1 {
+				points[l], points[r] = points[r], points[l]
+			}
+		}
+		last := len(points) - 1
+		points[0] = clipToBox(points[1], points[0], from.width/2, from.height/2)
+		points[last] = clipToBox(points[last-1], points[last], to.width/2, to.height/2)
+	}
+	return points
+}
@@ -0,0 +1,150 @@
+package converter
+
+import (
+	"math"
+	"strings"
+)
+
+// isExcalidraw recognises .excalidraw files and Excalidraw clipboard data
+func isExcalidraw(doc map[string]interface{}) bool {
+	if strings.HasPrefix(str(doc, "type"), "excalidraw") {
+		return true
+	}
+	_, ok := doc["elements"].([]interface{})
+	return ok
+}
+
+// convertExcalidraw maps Excalidraw elements onto shapes. Excalidraw turns
+// elements around their centre while the client turns them around their
+// top-left corner, so boxes are moved to where their corner ends up.
+func convertExcalidraw(doc map[string]interface{}) *Result {
+	b := newBuilder(FormatExcalidraw)
+	elements, _ := doc["elements"].([]interface{})
+	for _, item := range elements {
+		element, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if deleted, _ := element["isDeleted"].(bool); deleted {
+			continue
+		}
+		convertExcalidrawElement(b, element)
+	}
+
+	appState := obj(doc, "appState")
+	b.result.Name = strings.TrimSpace(str(appState, "name"))
+	zoom := num(obj(appState, "zoom"), "value")
+	if zoom <= 0 {
+		zoom = 1
+	}
+	return b.finish(zoom, point{num(appState, "scrollX") * zoom, num(appState, "scrollY") * zoom})
+}
+
+func convertExcalidrawElement(b *builder, element map[string]interface{}) {
+	kind := str(element, "type")
+	id := str(element, "id")
+	x, y := num(element, "x"), num(element, "y")
+	width, height := num(element, "width"), num(element, "height")
+	angle := num(element, "angle")
+	centre := point{x + width/2, y + height/2}
+	s := style{
+		Stroke:      excalidrawColor(str(element, "strokeColor")),
+		Fill:        excalidrawColor(str(element, "backgroundColor")),
+		StrokeWidth: num(element, "strokeWidth"),
+	}
+
+	switch kind {
+	case "rectangle":
+		b.box("rect", id, point{x, y}.rotate(centre, angle), width, height, angle, s)
+
+	case "ellipse":
+		b.ellipse(id, centre, width, height, angle, s)
+
+	case "diamond":
+		corners := []point{
+			{centre.X, y}, {x + width, centre.Y}, {centre.X, y + height}, {x, centre.Y}, {centre.X, y},
+		}
+		for i := range corners {
+			corners[i] = corners[i].rotate(centre, angle)
+		}
+		b.polyline("line", id, corners, s)
+
+	case "line", "arrow", "freedraw":
+		points := excalidrawPoints(element)
+		if len(points) < 2 {
+			return
+		}
+		minX, minY := math.Inf(1), math.Inf(1)
+		maxX, maxY := math.Inf(-1), math.Inf(-1)
+		for _, p := range points {
+			minX, maxX = math.Min(minX, p.X), math.Max(maxX, p.X)
+			minY, maxY = math.Min(minY, p.Y), math.Max(maxY, p.Y)
+		}
+		centre = point{(minX + maxX) / 2, (minY + maxY) / 2}
+		for i := range points {
+			points[i] = points[i].rotate(centre, angle)
+		}
+
+		if kind == "freedraw" {
+			b.polyline("pen", id, points, s)
+			return
+		}
+		b.polyline("line", id, points, s)
+		if kind == "arrow" {
+			last := len(points) - 1
+			if head, _ := element["endArrowhead"].(string); head != "" {
+				b.arrowHead(id+"-end", points[last-1], points[last], s)
+			}
+			if head, _ := element["startArrowhead"].(string); head != "" {
+				b.arrowHead(id+"-start", points[1], points[0], s)
+			}
+		}
+
+	case "text":
+		text := str(element, "text")
+		if text == "" {
+			text = str(element, "originalText")
+		}
+		b.text(id, text, point{x, y}.rotate(centre, angle), num(element, "fontSize"), angle, s.Stroke)
+
+	case "frame", "magicframe":
+		s.Stroke, s.Fill = "", ""
+		frame := b.box("frame", id, point{x, y}, width, height, 0, s)
+		if name := strings.TrimSpace(str(element, "name")); name != "" {
+			frame["title"] = name
+		}
+
+	default:
+		// Images, embeds and anything newer
+		b.skip(id, kind, "")
+	}
+}
+
+// excalidrawPoints returns a linear element's points on the board; the file
+// stores them relative to the element's position
+func excalidrawPoints(element map[string]interface{}) []point {
+	x, y := num(element, "x"), num(element, "y")
+	raw, _ := element["points"].([]interface{})
+	points := make([]point, 0, len(raw))
+	for _, item := range raw {
+		pair, ok := item.([]interface{})
+		if !ok || len(pair) < 2 {
+			continue
+		}
+		px, okX := pair[0].(float64)
+		py, okY := pair[1].(float64)
+		if okX && okY {
+			points = append(points, point{x + px, y + py})
+		}
+	}
+	return points
+}
+
+// excalidrawColor drops "transparent", which Excalidraw uses for no fill
+func excalidrawColor(value string) string {
+	value = strings.TrimSpace(value)
+	if strings.EqualFold(value, "transparent") {
+		return ""
+	}
+	return value
+}
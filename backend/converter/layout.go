@@ -0,0 +1,303 @@
+package converter
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Algorithms LayoutBoxes arranges boxes with, besides LayoutGrid
+const (
+	LayoutHierarchical = "hierarchical"
+	LayoutForce        = "force"
+)
+
+// MaxLayoutBoxes caps how many boxes are laid out at once
+const MaxLayoutBoxes = MaxDiagramNodes
+
+var (
+	ErrNothingToLayout = errors.New("The selection has no shapes to lay out")
+	ErrTooManyBoxes    = fmt.Errorf("Select at most %d shapes to lay out", MaxLayoutBoxes)
+)
+
+// Force-directed layout tuning, in iterations and board units
+const (
+	forceIterations = 300
+	layoutGap       = diagramNodeSep
+)
+
+// LayoutPoint is a point on the board
+type LayoutPoint struct {
+	X, Y float64
+}
+
+// LayoutBox is something to place: where its centre is now, and its size
+type LayoutBox struct {
+	ID            string
+	Centre        LayoutPoint
+	Width, Height float64
+}
+
+// LayoutLink connects two boxes, drawn from From to To
+type LayoutLink struct {
+	From, To string
+}
+
+// LayoutOptions choose the algorithm and tune it
+type LayoutOptions struct {
+	Algorithm string
+	Direction string // Hierarchical: TB (the default), BT, LR or RL
+	Columns   int    // Grid: about square by default
+}
+
+// Layout is where LayoutBoxes put things: the new centre of each box, and
+// the route of each link from outline to outline, in the order of the
+// links. Links from a box to itself or to a box that wasn't laid out have
+// no route.
+type Layout struct {
+	Centres map[string]LayoutPoint
+	Routes  [][]LayoutPoint
+}
+
+// LayoutBoxes arranges boxes with an algorithm, keeping the top-left corner
+// of the whole where it was:
+//   - hierarchical puts them in layers along the direction, as imported
+//     diagrams are laid out, with links bending around the layers between
+//     their ends
+//   - force pulls linked boxes together and pushes all of them apart,
+//     starting from where they are, then moves overlapping boxes apart
+//   - grid lines them up in rows, in reading order, in cells fitting the
+//     largest box
+func LayoutBoxes(boxes []LayoutBox, links []LayoutLink, opts LayoutOptions) (*Layout, error) {
+	if len(boxes) == 0 {
+		return nil, ErrNothingToLayout
+	}
+	if len(boxes) > MaxLayoutBoxes || len(links) > MaxDiagramEdges {
+		return nil, ErrTooManyBoxes
+	}
+
+	byID := make(map[string]LayoutBox, len(boxes))
+	for _, box := range boxes {
+		byID[box.ID] = box
+	}
+	connects := func(link LayoutLink) bool {
+		_, from := byID[link.From]
+		_, to := byID[link.To]
+		return from && to && link.From != link.To
+	}
+
+	var centres map[string]point
+	var routes [][]point
+	switch opts.Algorithm {
+	case LayoutHierarchical:
+		centres, routes = layoutHierarchy(boxes, links, connects, opts.Direction)
+	case LayoutForce:
+		centres = layoutForce(boxes, links, connects)
+	case LayoutGrid:
+		centres = layoutGrid(boxes, opts.Columns)
+	default:
+		return nil, fmt.Errorf("unknown layout algorithm %q", opts.Algorithm)
+	}
+	if routes == nil {
+		// Straight across, from outline to outline
+		routes = make([][]point, len(links))
+		for i, link := range links {
+			if !connects(link) {
+				continue
+			}
+			from, to := byID[link.From], byID[link.To]
+			a, b := centres[link.From], centres[link.To]
+			routes[i] = []point{
+				clipToBox(b, a, from.Width/2, from.Height/2),
+				clipToBox(a, b, to.Width/2, to.Height/2),
+			}
+		}
+	}
+
+	// Back to where the boxes were
+	was, now := point{math.Inf(1), math.Inf(1)}, point{math.Inf(1), math.Inf(1)}
+	for _, box := range boxes {
+		was.X = math.Min(was.X, box.Centre.X-box.Width/2)
+		was.Y = math.Min(was.Y, box.Centre.Y-box.Height/2)
+		now.X = math.Min(now.X, centres[box.ID].X-box.Width/2)
+		now.Y = math.Min(now.Y, centres[box.ID].Y-box.Height/2)
+	}
+	shift := func(p point) LayoutPoint {
+		return LayoutPoint{p.X - now.X + was.X, p.Y - now.Y + was.Y}
+	}
+
+	layout := &Layout{Centres: make(map[string]LayoutPoint, len(boxes)), Routes: make([][]LayoutPoint, len(links))}
+	for id, centre := range centres {
+		layout.Centres[id] = shift(centre)
+	}
+	for i, route := range routes {
+		for _, p := range route {
+			layout.Routes[i] = append(layout.Routes[i], shift(p))
+		}
+	}
+	return layout, nil
+}
+
+// layoutHierarchy lays the boxes out as an imported diagram, with the links
+// that connect as its edges
+func layoutHierarchy(boxes []LayoutBox, links []LayoutLink, connects func(LayoutLink) bool, direction string) (map[string]point, [][]point) {
+	g := newGraph()
+	if direction != "" {
+		g.direction = direction
+	}
+	for _, box := range boxes {
+		node := g.node(box.ID)
+		node.width, node.height = box.Width, box.Height
+	}
+	edges := make([]*graphEdge, len(links))
+	for i, link := range links {
+		if connects(link) {
+			edges[i] = &graphEdge{from: link.From, to: link.To}
+			g.edges = append(g.edges, edges[i])
+		}
+	}
+
+	layoutGraph(g)
+
+	centres := make(map[string]point, len(boxes))
+	for _, node := range g.nodes {
+		centres[node.id] = point{node.x, node.y}
+	}
+	routes := make([][]point, len(links))
+	for i, edge := range edges {
+		if edge != nil {
+			routes[i] = edgeRoute(g, edge)
+		}
+	}
+	return centres, routes
+}
+
+// layoutForce is Fruchterman and Reingold's spring embedder: every pair of
+// boxes pushes apart and every link pulls its ends together, by less and
+// less as the layout cools. Boxes left overlapping are then moved apart.
+func layoutForce(boxes []LayoutBox, links []LayoutLink, connects func(LayoutLink) bool) map[string]point {
+	index := make(map[string]int, len(boxes))
+	positions := make([]point, len(boxes))
+	size := 0.0
+	for i, box := range boxes {
+		index[box.ID] = i
+		positions[i] = point{box.Centre.X, box.Centre.Y}
+		size += math.Max(box.Width, box.Height)
+	}
+	// The distance linked boxes settle at
+	k := size/float64(len(boxes)) + layoutGap
+
+	temperature := k * math.Sqrt(float64(len(boxes)))
+	cooling := temperature / forceIterations
+	moves := make([]point, len(boxes))
+	for iteration := 0; iteration < forceIterations; iteration++ {
+		clear(moves)
+		for i := range positions {
+			for j := i + 1; j < len(positions); j++ {
+				dx, dy := positions[i].X-positions[j].X, positions[i].Y-positions[j].Y
+				if dx == 0 && dy == 0 {
+					// Boxes on the same spot part along a direction of their own
+					angle := float64(i*len(positions)+j) * 2.399963
+					dx, dy = math.Cos(angle), math.Sin(angle)
+				}
+				distance := math.Hypot(dx, dy)
+				push := k * k / distance
+				moves[i].X += dx / distance * push
+				moves[i].Y += dy / distance * push
+				moves[j].X -= dx / distance * push
+				moves[j].Y -= dy / distance * push
+			}
+		}
+		for _, link := range links {
+			if !connects(link) {
+				continue
+			}
+			a, b := index[link.From], index[link.To]
+			dx, dy := positions[a].X-positions[b].X, positions[a].Y-positions[b].Y
+			distance := math.Hypot(dx, dy)
+			if distance == 0 {
+				continue
+			}
+			pull := distance * distance / k
+			moves[a].X -= dx / distance * pull
+			moves[a].Y -= dy / distance * pull
+			moves[b].X += dx / distance * pull
+			moves[b].Y += dy / distance * pull
+		}
+		for i, move := range moves {
+			if length := math.Hypot(move.X, move.Y); length > 0 {
+				step := math.Min(length, temperature)
+				positions[i].X += move.X / length * step
+				positions[i].Y += move.Y / length * step
+			}
+		}
+		temperature -= cooling
+	}
+
+	separate(boxes, positions)
+
+	centres := make(map[string]point, len(boxes))
+	for i, box := range boxes {
+		centres[box.ID] = positions[i]
+	}
+	return centres
+}
+
+// separate moves overlapping boxes apart, along the axis they overlap the
+// least on, until none do or it gives up
+func separate(boxes []LayoutBox, positions []point) {
+	for pass := 0; pass < 50; pass++ {
+		moved := false
+		for i := range positions {
+			for j := i + 1; j < len(positions); j++ {
+				dx, dy := positions[j].X-positions[i].X, positions[j].Y-positions[i].Y
+				overlapX := (boxes[i].Width+boxes[j].Width)/2 + layoutGap/2 - math.Abs(dx)
+				overlapY := (boxes[i].Height+boxes[j].Height)/2 + layoutGap/2 - math.Abs(dy)
+				if overlapX <= 0 || overlapY <= 0 {
+					continue
+				}
+				moved = true
+				if overlapX < overlapY {
+					positions[i].X -= math.Copysign(overlapX/2, dx)
+					positions[j].X += math.Copysign(overlapX/2, dx)
+				} else {
+					positions[i].Y -= math.Copysign(overlapY/2, dy)
+					positions[j].Y += math.Copysign(overlapY/2, dy)
+				}
+			}
+		}
+		if !moved {
+			return
+		}
+	}
+}
+
+// layoutGrid puts the boxes in rows of columns cells, in the order they
+// are read in now: top to bottom, then left to right
+func layoutGrid(boxes []LayoutBox, columns int) map[string]point {
+	order := append([]LayoutBox(nil), boxes...)
+	sort.SliceStable(order, func(i, j int) bool {
+		if order[i].Centre.Y != order[j].Centre.Y {
+			return order[i].Centre.Y < order[j].Centre.Y
+		}
+		return order[i].Centre.X < order[j].Centre.X
+	})
+	if columns <= 0 {
+		columns = int(math.Ceil(math.Sqrt(float64(len(order)))))
+	}
+
+	widest, tallest := 0.0, 0.0
+	for _, box := range order {
+		widest, tallest = math.Max(widest, box.Width), math.Max(tallest, box.Height)
+	}
+	centres := make(map[string]point, len(order))
+	for i, box := range order {
+		column, row := i%columns, i/columns
+		centres[box.ID] = point{
+			X: float64(column)*(widest+layoutGap) + widest/2,
+			Y: float64(row)*(tallest+layoutGap) + tallest/2,
+		}
+	}
+	return centres
+}
@@ -0,0 +1,331 @@
+package converter
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// mermaidDirections maps a flowchart's direction onto the layout's
+var mermaidDirections = map[string]string{"TB": "TB", "TD": "TB", "BT": "BT", "LR": "LR", "RL": "RL"}
+
+// mermaidStyling matches statements that only style or annotate the chart
+var mermaidStyling = regexp.MustCompile(`^(classDef|class|style|click|linkStyle|direction|accTitle|accDescr)\b`)
+
+var mermaidSubgraph = regexp.MustCompile(`^subgraph\s+(.+)$`)
+
+// mermaidShapes are the brackets around a node's text and the shape each
+// is drawn as, longest first. Shapes we have no equivalent for become
+// boxes.
+var mermaidShapes = []struct{ open, close, shape string }{
+	{"(((", ")))", nodeCircle},
+	{"((", "))", nodeCircle},
+	{"([", "])", nodeRound},
+	{"[[", "]]", nodeRect},
+	{"[(", ")]", nodeRound},
+	{"[/", "/]", nodeRect},
+	{"[/", `\]`, nodeRect},
+	{`[\`, `\]`, nodeRect},
+	{`[\`, "/]", nodeRect},
+	{"{{", "}}", nodeRect},
+	{"{", "}", nodeDiamond},
+	{"(", ")", nodeRound},
+	{"[", "]", nodeRect},
+	{">", "]", nodeRect},
+}
+
+// mermaidLink matches a link: an optional head at the start, the line
+// (solid, thick, dotted or invisible) and an optional head at the end
+var mermaidLink = regexp.MustCompile(`^([<ox])?(-{2,}|={2,}|-\.+-|~{3,})([>ox])?`)
+
+// mermaidTextLink matches a link with its text inside, as in A -- text --> B
+var mermaidTextLink = regexp.MustCompile(`^([<ox])?(--|==|-\.)\s*([^-=.>\s|].*?)\s*(-{2,}|={2,}|\.+-+)([>ox])?`)
+
+type mermaidNode struct {
+	id, label, shape string
+}
+
+// parseMermaid reads a Mermaid flowchart. Statements it can't read are
+// reported and left out rather than failing the import.
+func parseMermaid(source string) (*graph, error) {
+	g := newGraph()
+	var open []*graphGroup
+	header := false
+
+	for n, line := range strings.Split(source, "\n") {
+		if trimmed := strings.TrimSpace(line); trimmed == "" || strings.HasPrefix(trimmed, "%%") {
+			continue
+		}
+		for _, statement := range splitStatements(line) {
+			statement = strings.TrimSpace(statement)
+			if statement == "" {
+				continue
+			}
+			if !header {
+				if !mermaidHeader.MatchString(statement) {
+					return nil, ErrUnknownDiagram
+				}
+				header = true
+				if fields := strings.Fields(statement); len(fields) > 1 {
+					if direction, ok := mermaidDirections[strings.ToUpper(fields[1])]; ok {
+						g.direction = direction
+					}
+				}
+				continue
+			}
+
+			before := len(g.nodes)
+			switch match := mermaidSubgraph.FindStringSubmatch(statement); {
+			case statement == "end":
+				if len(open) > 0 {
+					open = open[:len(open)-1]
+				}
+			case match != nil:
+				group := mermaidGroup(match[1], len(g.groups))
+				if len(open) > 0 {
+					parent := open[len(open)-1]
+					parent.children = append(parent.children, group)
+				}
+				g.groups = append(g.groups, group)
+				open = append(open, group)
+			case mermaidStyling.MatchString(statement):
+			default:
+				if !parseMermaidChain(g, statement) {
+					g.unread(n+1, statement)
+				}
+			}
+
+			// Nodes belong to the subgraph they are first named in
+			if len(open) > 0 {
+				group := open[len(open)-1]
+				for _, node := range g.nodes[before:] {
+					group.members = append(group.members, node.id)
+				}
+			}
+		}
+	}
+	if !header {
+		return nil, ErrUnknownDiagram
+	}
+	return g, nil
+}
+
+// splitStatements splits a line at the semicolons outside quotes
+func splitStatements(line string) []string {
+	var statements []string
+	quoted := false
+	start := 0
+	for i, r := range line {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == ';' && !quoted:
+			statements = append(statements, line[start:i])
+			start = i + 1
+		}
+	}
+	return append(statements, line[start:])
+}
+
+// mermaidGroup reads a subgraph's header: an ID, a title, or both as in
+// id [title]
+func mermaidGroup(spec string, index int) *graphGroup {
+	spec = strings.TrimSpace(spec)
+	group := &graphGroup{id: spec, title: mermaidLabel(spec)}
+	if open := strings.IndexByte(spec, '['); open > 0 && strings.HasSuffix(spec, "]") {
+		group.id = strings.TrimSpace(spec[:open])
+		group.title = mermaidLabel(spec[open+1 : len(spec)-1])
+	}
+	if strings.HasPrefix(spec, `"`) {
+		group.id = ""
+	}
+	if group.id == "" {
+		group.id = "subgraph-" + strconv.Itoa(index)
+	}
+	return group
+}
+
+// parseMermaidChain reads a chain of links such as A --> B & C -.-> D, and
+// adds it to the graph only when the whole statement could be read
+func parseMermaidChain(g *graph, statement string) bool {
+	sc := &scanner{s: statement}
+	first, ok := sc.mermaidNodes()
+	if !ok {
+		return false
+	}
+	chain := [][]mermaidNode{first}
+	var links []graphEdge
+	for sc.skipSpace(); !sc.done(); sc.skipSpace() {
+		link, ok := sc.mermaidLink()
+		if !ok {
+			return false
+		}
+		next, ok := sc.mermaidNodes()
+		if !ok {
+			return false
+		}
+		links = append(links, link)
+		chain = append(chain, next)
+	}
+
+	for _, nodes := range chain {
+		for _, node := range nodes {
+			g.define(node.id, node.label, node.shape)
+		}
+	}
+	for i, link := range links {
+		for _, from := range chain[i] {
+			for _, to := range chain[i+1] {
+				g.connect(from.id, to.id, link)
+			}
+		}
+	}
+	return true
+}
+
+// scanner walks through a statement
+type scanner struct {
+	s string
+	i int
+}
+
+func (sc *scanner) rest() string { return sc.s[sc.i:] }
+func (sc *scanner) done() bool   { return sc.i >= len(sc.s) }
+
+func (sc *scanner) skipSpace() {
+	for !sc.done() && (sc.s[sc.i] == ' ' || sc.s[sc.i] == '\t') {
+		sc.i++
+	}
+}
+
+// mermaidNodes reads one node, or several joined with &
+func (sc *scanner) mermaidNodes() ([]mermaidNode, bool) {
+	var nodes []mermaidNode
+	for {
+		node, ok := sc.mermaidNode()
+		if !ok {
+			return nil, false
+		}
+		nodes = append(nodes, node)
+		sc.skipSpace()
+		if !strings.HasPrefix(sc.rest(), "&") {
+			return nodes, true
+		}
+		sc.i++
+	}
+}
+
+// mermaidNode reads a node's ID and, when given, its shape and text
+func (sc *scanner) mermaidNode() (mermaidNode, bool) {
+	sc.skipSpace()
+	start := sc.i
+	for !sc.done() {
+		r := rune(sc.s[sc.i])
+		next := byte(0)
+		if sc.i+1 < len(sc.s) {
+			next = sc.s[sc.i+1]
+		}
+		// A hyphen belongs to the ID unless it starts a link
+		if r == '-' && next != '-' && next != '.' && next != '>' {
+			sc.i++
+			continue
+		}
+		if r >= 0x80 {
+			// Non-ASCII IDs
+			sc.i++
+			continue
+		}
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
+			break
+		}
+		sc.i++
+	}
+	node := mermaidNode{id: sc.s[start:sc.i]}
+	if node.id == "" {
+		return node, false
+	}
+
+	for _, bracket := range mermaidShapes {
+		if !strings.HasPrefix(sc.rest(), bracket.open) {
+			continue
+		}
+		body := sc.rest()[len(bracket.open):]
+		end := -1
+		if trimmed := strings.TrimLeft(body, " "); strings.HasPrefix(trimmed, `"`) {
+			// Quoted text may contain the closing bracket
+			skipped := len(body) - len(trimmed)
+			if quote := strings.IndexByte(trimmed[1:], '"'); quote >= 0 {
+				after := skipped + quote + 2
+				if close := strings.Index(body[after:], bracket.close); close >= 0 && strings.TrimSpace(body[after:after+close]) == "" {
+					end = after + close
+				}
+			}
+		} else {
+			end = strings.Index(body, bracket.close)
+		}
+		if end < 0 {
+			continue
+		}
+		node.label = mermaidLabel(body[:end])
+		node.shape = bracket.shape
+		sc.i += len(bracket.open) + end + len(bracket.close)
+		break
+	}
+
+	// A class applied inline, as in A:::warning
+	if strings.HasPrefix(sc.rest(), ":::") {
+		sc.i += 3
+		for !sc.done() && (unicode.IsLetter(rune(sc.s[sc.i])) || unicode.IsDigit(rune(sc.s[sc.i])) || sc.s[sc.i] == '_' || sc.s[sc.i] == '-') {
+			sc.i++
+		}
+	}
+	return node, true
+}
+
+// mermaidLink reads a link and its text, either inside the link or after
+// it between bars
+func (sc *scanner) mermaidLink() (graphEdge, bool) {
+	var start, line, end, text string
+	match := mermaidLink.FindStringSubmatch(sc.rest())
+	if match != nil && (match[3] != "" || (match[2] != "--" && match[2] != "==")) {
+		start, line, end = match[1], match[2], match[3]
+		sc.i += len(match[0])
+	} else if match = mermaidTextLink.FindStringSubmatch(sc.rest()); match != nil {
+		start, line, text, end = match[1], match[2]+match[4], match[3], match[5]
+		sc.i += len(match[0])
+	} else {
+		return graphEdge{}, false
+	}
+
+	sc.skipSpace()
+	if strings.HasPrefix(sc.rest(), "|") {
+		close := strings.IndexByte(sc.rest()[1:], '|')
+		if close < 0 {
+			return graphEdge{}, false
+		}
+		text = sc.rest()[1 : close+1]
+		sc.i += close + 2
+	}
+
+	return graphEdge{
+		label:      mermaidLabel(text),
+		thick:      strings.Contains(line, "="),
+		hidden:     strings.HasPrefix(line, "~"),
+		arrowStart: start != "",
+		arrowEnd:   end != "",
+	}, true
+}
+
+// mermaidLabel reads a node's or link's text: quoted or not, possibly a
+// markdown string, with <br> for line breaks
+func mermaidLabel(text string) string {
+	text = strings.TrimSpace(text)
+	if len(text) >= 2 && text[0] == '"' && text[len(text)-1] == '"' {
+		text = text[1 : len(text)-1]
+	}
+	if len(text) >= 2 && text[0] == '`' && text[len(text)-1] == '`' {
+		text = strings.NewReplacer("**", "", "*", "").Replace(text[1 : len(text)-1])
+	}
+	return plainText(text)
+}
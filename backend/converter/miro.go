@@ -0,0 +1,309 @@
+package converter
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Miro's named sticky note colors
+var miroStickyColors = map[string]string{
+	"gray":         "#f5f6f8",
+	"light_yellow": "#fff9b1",
+	"yellow":       "#f5d128",
+	"orange":       "#ff9d48",
+	"light_green":  "#d5f692",
+	"green":        "#c9df56",
+	"dark_green":   "#93d275",
+	"cyan":         "#67c6c0",
+	"light_pink":   "#ffcee0",
+	"pink":         "#ea94bb",
+	"violet":       "#c6a2d2",
+	"red":          "#f0939d",
+	"light_blue":   "#a6ccf5",
+	"blue":         "#6cd8fa",
+	"dark_blue":    "#9ea9ff",
+	"black":        "#000000",
+}
+
+// miroStickySize is the side of a Miro sticky note that gives no size
+const miroStickySize = 199
+
+// miroItems returns the items of a Miro board export: the items listing of
+// Miro's REST API (v2), as {"data": [...]}, optionally with the board's
+// "connectors" and the "board" itself
+func miroItems(doc map[string]interface{}) ([]map[string]interface{}, bool) {
+	raw, ok := doc["data"].([]interface{})
+	if !ok {
+		raw, ok = doc["items"].([]interface{})
+	}
+	if !ok {
+		return nil, false
+	}
+
+	items := make([]map[string]interface{}, 0, len(raw))
+	for _, entry := range raw {
+		if item, ok := entry.(map[string]interface{}); ok {
+			items = append(items, item)
+		}
+	}
+	return items, true
+}
+
+// isMiro recognises Miro board exports. Their items have a type and a
+// position object.
+func isMiro(doc map[string]interface{}) bool {
+	items, ok := miroItems(doc)
+	if !ok {
+		return false
+	}
+	if len(items) == 0 {
+		return obj(doc, "board") != nil
+	}
+	return str(items[0], "type") != "" && obj(items[0], "position") != nil
+}
+
+// miroBoard places Miro items on the board. Items in a frame are positioned
+// from its top-left corner; the rest from the centre of the canvas.
+type miroBoard struct {
+	byID map[string]map[string]interface{}
+}
+
+// size is an item's width and height. Sticky notes and text may give only
+// their width.
+func (m miroBoard) size(item map[string]interface{}) (float64, float64) {
+	geometry := obj(item, "geometry")
+	width, height := num(geometry, "width"), num(geometry, "height")
+	if str(item, "type") == "sticky_note" {
+		if width <= 0 {
+			width = miroStickySize
+		}
+		if height <= 0 {
+			height = width
+		}
+	}
+	return width, height
+}
+
+// centre is where an item's centre is on the board
+func (m miroBoard) centre(item map[string]interface{}, depth int) point {
+	position := obj(item, "position")
+	at := point{num(position, "x"), num(position, "y")}
+	if str(position, "origin") != "" && str(position, "origin") != "center" {
+		// Only centres are documented; treat anything else as a corner
+		width, height := m.size(item)
+		at = point{at.X + width/2, at.Y + height/2}
+	}
+
+	parent, ok := m.byID[str(obj(item, "parent"), "id")]
+	if !ok || str(position, "relativeTo") != "parent_top_left" || depth > 16 {
+		return at
+	}
+	centre := m.centre(parent, depth+1)
+	width, height := m.size(parent)
+	return point{centre.X - width/2 + at.X, centre.Y - height/2 + at.Y}
+}
+
+// convertMiro maps Miro items onto shapes, frames first so they stay
+// behind their contents, then connectors on top
+func convertMiro(doc map[string]interface{}) *Result {
+	b := newBuilder(FormatMiro)
+	b.result.Name = strings.TrimSpace(str(obj(doc, "board"), "name"))
+
+	items, _ := miroItems(doc)
+	m := miroBoard{byID: map[string]map[string]interface{}{}}
+	var connectors []map[string]interface{}
+	for _, item := range items {
+		m.byID[str(item, "id")] = item
+	}
+	for _, item := range items {
+		if str(item, "type") == "frame" {
+			convertMiroItem(b, m, item)
+		}
+	}
+	for _, item := range items {
+		switch str(item, "type") {
+		case "frame":
+		case "connector":
+			connectors = append(connectors, item)
+		default:
+			convertMiroItem(b, m, item)
+		}
+	}
+
+	if raw, ok := doc["connectors"].([]interface{}); ok {
+		for _, entry := range raw {
+			if connector, ok := entry.(map[string]interface{}); ok {
+				connectors = append(connectors, connector)
+			}
+		}
+	}
+	for _, connector := range connectors {
+		convertMiroConnector(b, m, connector)
+	}
+
+	return b.finish(1, point{})
+}
+
+func convertMiroItem(b *builder, m miroBoard, item map[string]interface{}) {
+	kind := str(item, "type")
+	id := str(item, "id")
+	data, itemStyle := obj(item, "data"), obj(item, "style")
+	width, height := m.size(item)
+	centre := m.centre(item, 0)
+	rotation := num(obj(item, "geometry"), "rotation") * math.Pi / 180
+	corner := point{centre.X - width/2, centre.Y - height/2}.rotate(centre, rotation)
+	fontSize := miroNumber(itemStyle, "fontSize")
+
+	switch kind {
+	case "sticky_note":
+		fill := miroStickyColors[str(itemStyle, "fillColor")]
+		if fill == "" {
+			fill = miroStickyColors["light_yellow"]
+		}
+		note := b.box("sticky", id, corner, width, height, rotation, style{Fill: fill})
+		if text := plainText(str(data, "content")); text != "" {
+			note["text"] = text
+		}
+
+	case "shape":
+		s := style{
+			Stroke:      miroColor(itemStyle, "borderColor", "borderOpacity"),
+			Fill:        miroColor(itemStyle, "fillColor", "fillOpacity"),
+			StrokeWidth: miroNumber(itemStyle, "borderWidth"),
+		}
+		if str(itemStyle, "borderStyle") == "none" {
+			s.Stroke = ""
+		}
+		left, top := centre.X-width/2, centre.Y-height/2
+		turn := func(corners ...point) []point {
+			points := make([]point, 0, len(corners)+1)
+			for _, c := range corners {
+				points = append(points, point{left + c.X, top + c.Y}.rotate(centre, rotation))
+			}
+			return append(points, points[0])
+		}
+		switch str(data, "shape") {
+		case "circle", "ellipse", "oval":
+			b.ellipse(id, centre, width, height, rotation, s)
+		case "rhombus":
+			b.polyline("line", id, turn(point{width / 2, 0}, point{width, height / 2}, point{width / 2, height}, point{0, height / 2}), s)
+		case "triangle":
+			b.polyline("line", id, turn(point{width / 2, 0}, point{width, height}, point{0, height}), s)
+		default:
+			// Rectangles, and the outline of the shapes we can't draw
+			b.box("rect", id, corner, width, height, rotation, s)
+		}
+		miroLabel(b, id, plainText(str(data, "content")), centre, width, fontSize, rotation, miroColor(itemStyle, "color", ""))
+
+	case "text":
+		text := plainText(str(data, "content"))
+		if height <= 0 {
+			height = float64(strings.Count(text, "\n")+1) * math.Max(fontSize, 14) * 1.2
+			corner = point{centre.X - width/2, centre.Y - height/2}.rotate(centre, rotation)
+		}
+		b.text(id, text, corner, fontSize, rotation, miroColor(itemStyle, "color", ""))
+
+	case "card", "app_card":
+		b.box("rect", id, corner, width, height, rotation, style{Stroke: str(itemStyle, "cardTheme"), Fill: "#ffffff"})
+		miroLabel(b, id, plainText(str(data, "title")), centre, width, fontSize, rotation, "")
+
+	case "frame":
+		frame := b.box("frame", id, point{centre.X - width/2, centre.Y - height/2}, width, height, 0, style{})
+		if title := plainText(str(data, "title")); title != "" {
+			frame["title"] = title
+		}
+
+	case "image":
+		source := str(data, "imageUrl")
+		if source == "" {
+			b.skip(id, kind, "The export has no link to the image")
+			return
+		}
+		b.image(id, source, corner, width, height, rotation)
+
+	default:
+		// Embeds, documents, previews and anything newer
+		b.skip(id, kind, "")
+	}
+}
+
+// miroLabel adds the text of a shape or card, starting at its left and
+// centred vertically
+func miroLabel(b *builder, id, text string, centre point, width, fontSize, rotation float64, color string) {
+	if text == "" {
+		return
+	}
+	size := fontSize
+	if size <= 0 {
+		size = 14
+	}
+	lines := float64(strings.Count(text, "\n") + 1)
+	at := point{centre.X - width/2 + 8, centre.Y - lines*size*1.2/2}
+	b.text(id+"-label", text, at.rotate(centre, rotation), fontSize, rotation, color)
+}
+
+// convertMiroConnector draws a connector as a straight line between the
+// outlines of the items it joins, with its arrowheads and caption
+func convertMiroConnector(b *builder, m miroBoard, connector map[string]interface{}) {
+	id := str(connector, "id")
+	start, okStart := m.byID[str(obj(connector, "startItem"), "id")]
+	end, okEnd := m.byID[str(obj(connector, "endItem"), "id")]
+	if !okStart || !okEnd {
+		b.skip(id, "connector", "It doesn't join two items in the export")
+		return
+	}
+
+	connectorStyle := obj(connector, "style")
+	s := style{
+		Stroke:      miroColor(connectorStyle, "strokeColor", ""),
+		StrokeWidth: miroNumber(connectorStyle, "strokeWidth"),
+	}
+	startCentre, endCentre := m.centre(start, 0), m.centre(end, 0)
+	startWidth, startHeight := m.size(start)
+	endWidth, endHeight := m.size(end)
+	from := clipToBox(endCentre, startCentre, startWidth/2, startHeight/2)
+	to := clipToBox(startCentre, endCentre, endWidth/2, endHeight/2)
+	if from == to {
+		b.skip(id, "connector", "The items it joins overlap")
+		return
+	}
+
+	b.polyline("line", id, []point{from, to}, s)
+	if head := str(connectorStyle, "endStrokeCap"); head != "" && head != "none" {
+		b.arrowHead(id+"-end", from, to, s)
+	}
+	if head := str(connectorStyle, "startStrokeCap"); head != "" && head != "none" {
+		b.arrowHead(id+"-start", to, from, s)
+	}
+
+	captions, _ := connector["captions"].([]interface{})
+	for i, entry := range captions {
+		caption, _ := entry.(map[string]interface{})
+		if text := plainText(str(caption, "content")); text != "" {
+			middle := point{(from.X + to.X) / 2, (from.Y + to.Y) / 2}
+			b.text(id+"-caption-"+strconv.Itoa(i), text, middle, 0, 0, "")
+		}
+	}
+}
+
+// miroNumber reads a style value, which Miro sends as a string
+func miroNumber(m map[string]interface{}, key string) float64 {
+	if value, err := strconv.ParseFloat(str(m, key), 64); err == nil && !math.IsNaN(value) && !math.IsInf(value, 0) {
+		return value
+	}
+	return num(m, key)
+}
+
+// miroColor reads a style color, dropping "transparent" and colors whose
+// opacity (from 0 to 1, left out when opaque) is 0
+func miroColor(m map[string]interface{}, key, opacityKey string) string {
+	value := strings.TrimSpace(str(m, key))
+	if strings.EqualFold(value, "transparent") {
+		return ""
+	}
+	if opacity, err := strconv.ParseFloat(str(m, opacityKey), 64); err == nil && opacity == 0 {
+		return ""
+	}
+	return value
+}
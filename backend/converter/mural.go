@@ -0,0 +1,220 @@
+package converter
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// muralWidgets returns the widgets of a Mural export: the widget listing of
+// Mural's public API, as {"value": [...]}, optionally with the "mural"
+// itself
+func muralWidgets(doc map[string]interface{}) ([]map[string]interface{}, bool) {
+	raw, ok := doc["value"].([]interface{})
+	if !ok {
+		raw, ok = doc["widgets"].([]interface{})
+	}
+	if !ok {
+		return nil, false
+	}
+
+	widgets := make([]map[string]interface{}, 0, len(raw))
+	for _, entry := range raw {
+		if widget, ok := entry.(map[string]interface{}); ok {
+			widgets = append(widgets, widget)
+		}
+	}
+	return widgets, true
+}
+
+// isMural recognises Mural exports. Their widgets have a type and a
+// top-left corner.
+func isMural(doc map[string]interface{}) bool {
+	widgets, ok := muralWidgets(doc)
+	if !ok {
+		return false
+	}
+	if len(widgets) == 0 {
+		return obj(doc, "mural") != nil
+	}
+	_, hasX := widgets[0]["x"].(float64)
+	return str(widgets[0], "type") != "" && hasX
+}
+
+// muralCorner is where a widget's top-left corner is on the board. Widgets
+// in an area are positioned from the area's corner.
+func muralCorner(byID map[string]map[string]interface{}, widget map[string]interface{}, depth int) point {
+	at := point{num(widget, "x"), num(widget, "y")}
+	parent, ok := byID[str(widget, "parentId")]
+	if !ok || depth > 16 {
+		return at
+	}
+	origin := muralCorner(byID, parent, depth+1)
+	return point{origin.X + at.X, origin.Y + at.Y}
+}
+
+// convertMural maps Mural widgets onto shapes, areas first so they stay
+// behind their contents
+func convertMural(doc map[string]interface{}) *Result {
+	b := newBuilder(FormatMural)
+	mural := obj(doc, "mural")
+	b.result.Name = strings.TrimSpace(str(mural, "title"))
+
+	widgets, _ := muralWidgets(doc)
+	byID := map[string]map[string]interface{}{}
+	for _, widget := range widgets {
+		byID[str(widget, "id")] = widget
+	}
+	for _, areas := range []bool{true, false} {
+		for _, widget := range widgets {
+			if hidden, _ := widget["hidden"].(bool); hidden {
+				continue
+			}
+			if (str(widget, "type") == "area") == areas {
+				convertMuralWidget(b, byID, widget)
+			}
+		}
+	}
+
+	return b.finish(1, point{})
+}
+
+func convertMuralWidget(b *builder, byID map[string]map[string]interface{}, widget map[string]interface{}) {
+	kind := str(widget, "type")
+	id := str(widget, "id")
+	widgetStyle := obj(widget, "style")
+	width, height := num(widget, "width"), num(widget, "height")
+	origin := muralCorner(byID, widget, 0)
+	centre := point{origin.X + width/2, origin.Y + height/2}
+	rotation := num(widget, "rotation") * math.Pi / 180
+	corner := origin.rotate(centre, rotation)
+	fontSize := num(widgetStyle, "fontSize")
+	text := muralText(widget)
+
+	switch kind {
+	case "sticky note":
+		fill := muralColor(str(widgetStyle, "backgroundColor"))
+		if fill == "" {
+			fill = "#fcfe7d"
+		}
+		note := b.box("sticky", id, corner, width, height, rotation, style{Fill: fill})
+		if text != "" {
+			note["text"] = text
+		}
+		if fontSize > 0 {
+			note["fontSize"] = round(fontSize)
+		}
+
+	case "text":
+		b.text(id, text, corner, fontSize, rotation, muralColor(str(widgetStyle, "color")))
+
+	case "shape":
+		s := style{
+			Stroke:      muralColor(str(widgetStyle, "borderColor")),
+			Fill:        muralColor(str(widgetStyle, "backgroundColor")),
+			StrokeWidth: num(widgetStyle, "borderWidth"),
+		}
+		turn := func(corners ...point) []point {
+			points := make([]point, 0, len(corners)+1)
+			for _, c := range corners {
+				points = append(points, point{origin.X + c.X, origin.Y + c.Y}.rotate(centre, rotation))
+			}
+			return append(points, points[0])
+		}
+		switch str(widget, "shape") {
+		case "circle", "ellipse":
+			b.ellipse(id, centre, width, height, rotation, s)
+		case "diamond", "rhombus":
+			b.polyline("line", id, turn(point{width / 2, 0}, point{width, height / 2}, point{width / 2, height}, point{0, height / 2}), s)
+		case "triangle":
+			b.polyline("line", id, turn(point{width / 2, 0}, point{width, height}, point{0, height}), s)
+		default:
+			// Rectangles, and the outline of the shapes we can't draw
+			b.box("rect", id, corner, width, height, rotation, s)
+		}
+		if text != "" {
+			size := fontSize
+			if size <= 0 {
+				size = 14
+			}
+			lines := float64(strings.Count(text, "\n") + 1)
+			at := point{origin.X + 8, centre.Y - lines*size*1.2/2}
+			b.text(id+"-label", text, at.rotate(centre, rotation), fontSize, rotation, muralColor(str(widgetStyle, "color")))
+		}
+
+	case "area":
+		frame := b.box("frame", id, origin, width, height, 0, style{})
+		if title := plainText(str(widget, "title")); title != "" {
+			frame["title"] = title
+		}
+
+	case "image":
+		source := str(widget, "url")
+		if source == "" {
+			source = str(widget, "thumbnailUrl")
+		}
+		if source == "" {
+			b.skip(id, kind, "The export has no link to the image")
+			return
+		}
+		b.image(id, source, corner, width, height, rotation)
+
+	case "arrow":
+		raw, _ := widget["points"].([]interface{})
+		points := make([]point, 0, len(raw))
+		for _, entry := range raw {
+			if p, ok := entry.(map[string]interface{}); ok {
+				points = append(points, point{origin.X + num(p, "x"), origin.Y + num(p, "y")}.rotate(centre, rotation))
+			}
+		}
+		if len(points) < 2 {
+			b.skip(id, kind, "The export has no points for the arrow")
+			return
+		}
+		s := style{Stroke: muralColor(str(widgetStyle, "strokeColor")), StrokeWidth: num(widgetStyle, "strokeWidth")}
+		b.polyline("line", id, points, s)
+		last := len(points) - 1
+		switch str(widget, "tip") {
+		case "double":
+			b.arrowHead(id+"-start", points[1], points[0], s)
+			fallthrough
+		case "single":
+			b.arrowHead(id+"-end", points[last-1], points[last], s)
+		}
+		if label := plainText(str(widget, "label")); label != "" {
+			middle := points[len(points)/2]
+			b.text(id+"-label", label, middle, 0, 0, "")
+		}
+
+	default:
+		// Comments, files, icons and anything newer
+		b.skip(id, kind, "")
+	}
+}
+
+// muralText reads a widget's text, plain or as HTML
+func muralText(widget map[string]interface{}) string {
+	if text := strings.TrimSpace(str(widget, "text")); text != "" {
+		return text
+	}
+	return plainText(str(widget, "htmlText"))
+}
+
+// muralColor turns Mural's #RRGGBBAA colors into CSS ones, dropping fully
+// transparent colors
+func muralColor(value string) string {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if len(value) != 9 || value[0] != '#' {
+		return value
+	}
+	alpha, err := strconv.ParseUint(value[7:], 16, 8)
+	switch {
+	case err != nil:
+		return value
+	case alpha == 0:
+		return ""
+	case alpha == 255:
+		return value[:7]
+	}
+	return value
+}
@@ -0,0 +1,328 @@
+package converter
+
+import (
+	"regexp"
+	"strings"
+)
+
+// plantUMLShapes are the element keywords PlantUML declares nodes with, and
+// the shape each is drawn as
+var plantUMLShapes = map[string]string{
+	"actor": nodeCircle, "person": nodeCircle, "boundary": nodeCircle, "control": nodeCircle, "circle": nodeCircle,
+	"usecase": nodeRound, "state": nodeRound, "database": nodeRound, "queue": nodeRound, "storage": nodeRound,
+	"agent": nodeRect, "artifact": nodeRect, "card": nodeRect, "class": nodeRect, "cloud": nodeRect,
+	"collections": nodeRect, "component": nodeRect, "entity": nodeRect, "enum": nodeRect, "file": nodeRect,
+	"folder": nodeRect, "frame": nodeRect, "hexagon": nodeRect, "interface": nodeRect, "label": nodeRect,
+	"node": nodeRect, "object": nodeRect, "package": nodeRect, "participant": nodeRect, "rectangle": nodeRect,
+	"stack": nodeRect, "abstract": nodeRect, "annotation": nodeRect, "struct": nodeRect, "protocol": nodeRect,
+	"exception": nodeRect, "map": nodeRect, "json": nodeRect,
+}
+
+// plantUMLBodies are the keywords whose { } holds members rather than
+// other elements
+var plantUMLBodies = map[string]bool{
+	"class": true, "abstract": true, "interface": true, "enum": true, "annotation": true, "entity": true,
+	"object": true, "struct": true, "protocol": true, "exception": true, "map": true, "json": true,
+}
+
+// plantUMLIgnored matches statements that only style or annotate the
+// diagram
+var plantUMLIgnored = regexp.MustCompile(`^(skinparam|hide|show|title|header|footer|caption|scale|!|allowmixing|autonumber|set\s|sprite|legend|endlegend|newpage|skin\b)`)
+
+var (
+	plantUMLDeclaration = regexp.MustCompile(`^(abstract\s+class|[a-z]+)\s+(.+)$`)
+	plantUMLAlias       = regexp.MustCompile(`^(.+?)\s+as\s+(.+)$`)
+	plantUMLStereotype  = regexp.MustCompile(`<<[^>]*>>`)
+	plantUMLColor       = regexp.MustCompile(`\s#\S+`)
+	// plantUMLShorthand matches an element declared by its brackets alone,
+	// as in [Web app] as web
+	plantUMLShorthand = regexp.MustCompile(`^(\[[^\]]+\]|\([^)]+\)|:[^:]+:)(\s+as\s+\S+)?$`)
+
+	// plantUMLRelation matches two elements joined by an arrow, with an
+	// optional label after a colon. Each side is [*], [component],
+	// (use case), :actor:, "quoted" or a plain name; the arrow has heads,
+	// a solid or dotted line, and optionally a style in brackets and a
+	// direction.
+	plantUMLRelation = regexp.MustCompile(`^(\[\*\]|\[[^\]]+\]|\([^)]+\)|:[^:]+:|"[^"]+"|\w+(?:\.\w+)*)\s*(?:"[^"]*")?\s*` +
+		`(<\|?|\*|o|#|x|\}|\+|\^)?([-.]+)(\[[^\]]*\])?(up|down|left|right|u|d|l|r)?(\[[^\]]*\])?([-.]*)(\|?>|\*|o|#|x|\{|\+|\^)?` +
+		`\s*(?:"[^"]*")?\s*(\[\*\]|\[[^\]]+\]|\([^)]+\)|:[^:]+:|"[^"]+"|\w+(?:\.\w+)*)\s*(?::\s*(.*))?$`)
+)
+
+// plantUMLParser reads a PlantUML diagram's statements into a graph
+type plantUMLParser struct {
+	g *graph
+	// Aliases by the names they stand for
+	aliases map[string]string
+	open    []*graphGroup
+	// The class whose body is being read
+	body *graphNode
+	// What is being skipped until its end: a note, a legend or a
+	// skinparam block
+	skipping string
+}
+
+// parsePlantUML reads a PlantUML diagram as a graph of its elements and
+// the relations between them, which suits component, use case, class,
+// state and deployment diagrams. Statements it can't read are reported and
+// left out rather than failing the import.
+func parsePlantUML(source string) (*graph, error) {
+	p := &plantUMLParser{g: newGraph(), aliases: map[string]string{}}
+	// Text before @startuml, when there is one, isn't part of the diagram
+	waiting, comment := false, false
+	lines := strings.Split(source, "\n")
+	for _, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "@start") {
+			waiting = true
+			break
+		}
+	}
+
+	for n, line := range lines {
+		line = strings.TrimSpace(line)
+		if comment {
+			if end := strings.Index(line, "'/"); end >= 0 {
+				comment = false
+				line = strings.TrimSpace(line[end+2:])
+			} else {
+				continue
+			}
+		}
+		if start := strings.Index(line, "/'"); start >= 0 {
+			if end := strings.Index(line[start:], "'/"); end >= 0 {
+				line = strings.TrimSpace(line[:start] + line[start+end+2:])
+			} else {
+				comment = true
+				line = strings.TrimSpace(line[:start])
+			}
+		}
+
+		switch {
+		case strings.HasPrefix(line, "@start"):
+			if !strings.HasPrefix(line, "@startuml") {
+				return nil, ErrUnknownDiagram
+			}
+			waiting = false
+			continue
+		case strings.HasPrefix(line, "@end"):
+			return p.g, nil
+		case waiting:
+			continue
+		case line == "", strings.HasPrefix(line, "'"):
+			continue
+		}
+		p.statement(n+1, line)
+	}
+	return p.g, nil
+}
+
+func (p *plantUMLParser) statement(n int, line string) {
+	lower := strings.ToLower(line)
+
+	if p.skipping != "" {
+		if strings.HasPrefix(lower, p.skipping) {
+			p.skipping = ""
+		}
+		return
+	}
+	if p.body != nil {
+		if line == "}" {
+			p.body = nil
+		} else if member := strings.TrimSpace(line); member != "" && !strings.HasPrefix(member, "--") && !strings.HasPrefix(member, "==") && !strings.HasPrefix(member, "..") {
+			p.body.label += "\n" + member
+		}
+		return
+	}
+
+	switch {
+	case lower == "left to right direction":
+		p.g.direction = "LR"
+		return
+	case lower == "top to bottom direction":
+		p.g.direction = "TB"
+		return
+	case line == "}":
+		if len(p.open) > 0 {
+			p.open = p.open[:len(p.open)-1]
+		}
+		return
+	case strings.HasPrefix(lower, "note ") || lower == "note":
+		// Notes on one line say what they say after a colon or in quotes
+		if !strings.Contains(line, ":") && !strings.Contains(line, `"`) {
+			p.skipping = "end note"
+		}
+		return
+	case strings.HasPrefix(lower, "legend"):
+		p.skipping = "endlegend"
+		return
+	case strings.HasPrefix(lower, "skinparam") && strings.HasSuffix(line, "{"):
+		p.skipping = "}"
+		return
+	case plantUMLIgnored.MatchString(lower):
+		return
+	}
+
+	before := len(p.g.nodes)
+	if !p.relation(line) && !p.declaration(line) {
+		p.g.unread(n, line)
+	}
+	// Elements belong to the package they are first named in
+	if len(p.open) > 0 {
+		group := p.open[len(p.open)-1]
+		for _, node := range p.g.nodes[before:] {
+			group.members = append(group.members, node.id)
+		}
+	}
+}
+
+// declaration reads an element declared with its keyword, such as
+// component "Web app" as web, and opens a package when it is followed by {
+func (p *plantUMLParser) declaration(line string) bool {
+	if plantUMLShorthand.MatchString(line) {
+		id, label := p.name(line)
+		p.g.define(id, label, map[byte]string{'[': nodeRect, '(': nodeRound, ':': nodeCircle}[line[0]])
+		return true
+	}
+
+	match := plantUMLDeclaration.FindStringSubmatch(line)
+	if match == nil {
+		return false
+	}
+	keyword := strings.Fields(match[1])[0]
+	shape, ok := plantUMLShapes[keyword]
+	if !ok && keyword != "together" && keyword != "namespace" {
+		return false
+	}
+
+	spec := strings.TrimSpace(match[2])
+	if strings.Contains(strings.ToLower(spec), "<<choice>>") {
+		shape = nodeDiamond
+	}
+	spec = plantUMLStereotype.ReplaceAllString(spec, "")
+	spec = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(spec), "{}"))
+	opens := strings.HasSuffix(spec, "{")
+	spec = strings.TrimSpace(strings.TrimSuffix(spec, "{"))
+	spec = strings.TrimSpace(plantUMLColor.ReplaceAllString(" "+spec, ""))
+	// Descriptions such as state Idle : waiting for input
+	description := ""
+	if colon := strings.Index(spec, " : "); colon >= 0 {
+		spec, description = strings.TrimSpace(spec[:colon]), strings.TrimSpace(spec[colon+3:])
+	}
+
+	if opens && !plantUMLBodies[keyword] {
+		// A package, or a state holding other states
+		id, title := keyword, ""
+		if spec != "" {
+			id, title = p.name(spec)
+		}
+		group := &graphGroup{id: id, title: title}
+		if len(p.open) > 0 {
+			parent := p.open[len(p.open)-1]
+			parent.children = append(parent.children, group)
+		}
+		p.g.groups = append(p.g.groups, group)
+		p.open = append(p.open, group)
+		return true
+	}
+	if spec == "" {
+		return false
+	}
+
+	id, label := p.name(spec)
+	node := p.g.define(id, label, shape)
+	if description != "" {
+		node.label += "\n" + description
+	}
+	if opens {
+		p.body = node
+	}
+	return true
+}
+
+// relation reads two elements joined by an arrow
+func (p *plantUMLParser) relation(line string) bool {
+	match := plantUMLRelation.FindStringSubmatch(line)
+	if match == nil {
+		return false
+	}
+	head, style, direction, tail := match[2], match[4]+match[6], match[5], match[8]
+	edge := graphEdge{
+		label:      plantUMLText(match[10]),
+		arrowStart: strings.HasPrefix(head, "<"),
+		arrowEnd:   strings.HasSuffix(tail, ">"),
+		thick:      strings.Contains(style, "bold") || strings.Contains(style, "thickness"),
+	}
+	from := p.participant(match[1], "start")
+	to := p.participant(match[9], "end")
+
+	// Arrows pointing up (or left, across) are laid out the other way
+	// round
+	if direction == "up" || direction == "u" || direction == "left" || direction == "l" {
+		from, to = to, from
+		edge.arrowStart, edge.arrowEnd = edge.arrowEnd, edge.arrowStart
+	}
+	p.g.connect(from, to, edge)
+	return true
+}
+
+// participant finds or adds the node an end of a relation names. [*] is
+// the start or end of the state machine, or of the state it's in.
+func (p *plantUMLParser) participant(token, end string) string {
+	if token == "[*]" {
+		id := "[*]" + end
+		if len(p.open) > 0 {
+			id = "[*]" + p.open[len(p.open)-1].id + end
+		}
+		if _, ok := p.g.byID[id]; !ok {
+			node := p.g.define(id, "", nodeCircle)
+			node.label = ""
+		}
+		return id
+	}
+
+	shape := ""
+	switch token[0] {
+	case '[':
+		shape = nodeRect
+	case '(':
+		shape = nodeRound
+	case ':':
+		shape = nodeCircle
+	}
+	label := plantUMLText(strings.Trim(token, `[]():"`))
+	id := label
+	if alias, ok := p.aliases[label]; ok {
+		id = alias
+	}
+	if _, ok := p.g.byID[id]; ok {
+		// Declared already: keep its shape
+		return id
+	}
+	p.g.define(id, label, shape)
+	return id
+}
+
+// name reads an element's name and alias, in either order: "Long name" as
+// alias, or alias as "Long name". The alias is the node's ID.
+func (p *plantUMLParser) name(spec string) (id, label string) {
+	match := plantUMLAlias.FindStringSubmatch(spec)
+	if match == nil {
+		label = plantUMLText(strings.Trim(spec, `[]():"`))
+		if alias, ok := p.aliases[label]; ok {
+			return alias, label
+		}
+		return label, label
+	}
+	left, right := strings.TrimSpace(match[1]), strings.TrimSpace(match[2])
+	if strings.HasPrefix(right, `"`) {
+		left, right = right, left
+	}
+	id, label = strings.Trim(right, `[]():"`), plantUMLText(strings.Trim(left, `[]():"`))
+	p.aliases[label] = id
+	return id, label
+}
+
+// plantUMLText reads a name or label, where \n breaks the line
+func plantUMLText(text string) string {
+	text = strings.ReplaceAll(strings.TrimSpace(text), `\n`, "\n")
+	return plainText(text)
+}
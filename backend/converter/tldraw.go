@@ -0,0 +1,353 @@
+package converter
+
+import (
+	"sort"
+	"strings"
+)
+
+// tldraw's named colors and the light tints it uses for semi fills and notes
+var (
+	tldrawColors = map[string]string{
+		"black":        "#1d1d1d",
+		"grey":         "#9fa8b2",
+		"light-violet": "#e085f4",
+		"violet":       "#ae3ec9",
+		"blue":         "#4465e9",
+		"light-blue":   "#4ba1f1",
+		"yellow":       "#f1ac4b",
+		"orange":       "#e16919",
+		"green":        "#099268",
+		"light-green":  "#4cb05e",
+		"light-red":    "#f87777",
+		"red":          "#e03131",
+		"white":        "#ffffff",
+	}
+	tldrawTints = map[string]string{
+		"black":        "#e8e8e8",
+		"grey":         "#eceef0",
+		"light-violet": "#f5eafa",
+		"violet":       "#ecdcf2",
+		"blue":         "#dce1f8",
+		"light-blue":   "#ddedfa",
+		"yellow":       "#f9f0e6",
+		"orange":       "#f8e2d4",
+		"green":        "#d3e9e3",
+		"light-green":  "#dbf0e0",
+		"light-red":    "#f4dadb",
+		"red":          "#f4dadb",
+		"white":        "#ffffff",
+	}
+)
+
+// tldraw's size styles as stroke widths and font sizes
+var (
+	tldrawStrokeWidths = map[string]float64{"s": 2, "m": 3.5, "l": 5, "xl": 10}
+	tldrawFontSizes    = map[string]float64{"s": 18, "m": 24, "l": 36, "xl": 44}
+)
+
+// tldrawNoteSize is the side of a tldraw sticky note at scale 1
+const tldrawNoteSize = 200
+
+// tldrawRecords returns the records of a .tldr file or a store snapshot
+func tldrawRecords(doc map[string]interface{}) ([]map[string]interface{}, bool) {
+	if document := obj(doc, "document"); document != nil {
+		doc = document
+	}
+
+	var raw []interface{}
+	if list, ok := doc["records"].([]interface{}); ok {
+		raw = list
+	} else if store := obj(doc, "store"); store != nil {
+		for _, key := range sortedKeys(store) {
+			raw = append(raw, store[key])
+		}
+	} else {
+		return nil, false
+	}
+
+	records := make([]map[string]interface{}, 0, len(raw))
+	for _, item := range raw {
+		if record, ok := item.(map[string]interface{}); ok {
+			records = append(records, record)
+		}
+	}
+	return records, true
+}
+
+// isTldraw recognises .tldr files and tldraw store snapshots
+func isTldraw(doc map[string]interface{}) bool {
+	if _, ok := doc["tldrawFileFormatVersion"]; ok {
+		return true
+	}
+	_, ok := tldrawRecords(doc)
+	return ok
+}
+
+// tldrawTransform places a shape's own coordinates on the board. tldraw
+// stores shapes relative to their parent frame or group, turned around the
+// parent's origin.
+type tldrawTransform struct {
+	origin   point
+	rotation float64
+}
+
+func (t tldrawTransform) apply(p point) point {
+	p = p.rotate(point{}, t.rotation)
+	return point{t.origin.X + p.X, t.origin.Y + p.Y}
+}
+
+func (t tldrawTransform) child(shape map[string]interface{}) tldrawTransform {
+	return tldrawTransform{
+		origin:   t.apply(point{num(shape, "x"), num(shape, "y")}),
+		rotation: t.rotation + num(shape, "rotation"),
+	}
+}
+
+// convertTldraw maps the shapes on the file's first page onto shapes,
+// parents before their children and in tldraw's stacking order
+func convertTldraw(doc map[string]interface{}) *Result {
+	b := newBuilder(FormatTldraw)
+	records, _ := tldrawRecords(doc)
+
+	var pages []map[string]interface{}
+	children := map[string][]map[string]interface{}{}
+	cameras := map[string]map[string]interface{}{}
+	for _, record := range records {
+		switch str(record, "typeName") {
+		case "page":
+			pages = append(pages, record)
+		case "shape":
+			parent := str(record, "parentId")
+			children[parent] = append(children[parent], record)
+		case "camera":
+			cameras[str(record, "id")] = record
+		case "document":
+			b.result.Name = strings.TrimSpace(str(record, "name"))
+		}
+	}
+	for _, list := range children {
+		sort.SliceStable(list, func(i, j int) bool { return str(list[i], "index") < str(list[j], "index") })
+	}
+
+	var roots []map[string]interface{}
+	camera := map[string]interface{}{}
+	if len(pages) > 0 {
+		sort.SliceStable(pages, func(i, j int) bool { return str(pages[i], "index") < str(pages[j], "index") })
+		pageID := str(pages[0], "id")
+		roots = children[pageID]
+		if found, ok := cameras["camera:"+pageID]; ok {
+			camera = found
+		}
+		if b.result.Name == "" && len(pages) > 1 {
+			b.result.Name = strings.TrimSpace(str(pages[0], "name"))
+		}
+	} else {
+		for _, parent := range sortedParents(children) {
+			if strings.HasPrefix(parent, "page:") {
+				roots = append(roots, children[parent]...)
+			}
+		}
+	}
+
+	var walk func(shapes []map[string]interface{}, parent tldrawTransform)
+	walk = func(shapes []map[string]interface{}, parent tldrawTransform) {
+		for _, shape := range shapes {
+			transform := parent.child(shape)
+			convertTldrawShape(b, shape, transform)
+			walk(children[str(shape, "id")], transform)
+		}
+	}
+	walk(roots, tldrawTransform{})
+
+	zoom := num(camera, "z")
+	if zoom <= 0 {
+		zoom = 1
+	}
+	return b.finish(zoom, point{num(camera, "x") * zoom, num(camera, "y") * zoom})
+}
+
+func sortedParents(children map[string][]map[string]interface{}) []string {
+	parents := make([]string, 0, len(children))
+	for parent := range children {
+		parents = append(parents, parent)
+	}
+	sort.Strings(parents)
+	return parents
+}
+
+func convertTldrawShape(b *builder, shape map[string]interface{}, t tldrawTransform) {
+	kind := str(shape, "type")
+	id := strings.TrimPrefix(str(shape, "id"), "shape:")
+	props := obj(shape, "props")
+	color := str(props, "color")
+	if color == "" {
+		color = "black"
+	}
+	size := str(props, "size")
+	if size == "" {
+		size = "m"
+	}
+	s := style{Stroke: tldrawColors[color], StrokeWidth: tldrawStrokeWidths[size]}
+	scale := num(props, "scale")
+	if scale <= 0 {
+		scale = 1
+	}
+	fontSize := tldrawFontSizes[size] * scale
+
+	switch kind {
+	case "geo":
+		width, height := num(props, "w"), num(props, "h")
+		switch str(props, "fill") {
+		case "solid", "semi", "pattern":
+			s.Fill = tldrawTints[color]
+		case "fill":
+			s.Fill = tldrawColors[color]
+		}
+		switch str(props, "geo") {
+		case "ellipse", "oval":
+			b.ellipse(id, t.apply(point{width / 2, height / 2}), width, height, t.rotation, s)
+		case "diamond":
+			b.polyline("line", id, tldrawPolygon(t, point{width / 2, 0}, point{width, height / 2}, point{width / 2, height}, point{0, height / 2}), s)
+		case "triangle":
+			b.polyline("line", id, tldrawPolygon(t, point{width / 2, 0}, point{width, height}, point{0, height}), s)
+		default:
+			// Rectangles, and the outline of the shapes we can't draw
+			b.box("rect", id, t.origin, width, height, t.rotation, s)
+		}
+		if text := tldrawText(props); text != "" {
+			lines := float64(strings.Count(text, "\n") + 1)
+			top := height/2 - lines*fontSize*1.2/2
+			b.text(id+"-label", text, t.apply(point{8, top}), fontSize, t.rotation, tldrawColors[color])
+		}
+
+	case "draw", "highlight":
+		var points []point
+		segments, _ := props["segments"].([]interface{})
+		for _, item := range segments {
+			segment, _ := item.(map[string]interface{})
+			raw, _ := segment["points"].([]interface{})
+			for _, p := range raw {
+				if p, ok := p.(map[string]interface{}); ok {
+					points = append(points, t.apply(point{num(p, "x"), num(p, "y")}))
+				}
+			}
+		}
+		if len(points) < 2 {
+			// Newer files pack the points in a form we can't read
+			b.skip(id, kind, "Points are stored in a format that can't be read")
+			return
+		}
+		if kind == "highlight" {
+			s.StrokeWidth *= 4
+		}
+		b.polyline("pen", id, points, s)
+
+	case "line":
+		type handle struct {
+			index string
+			at    point
+		}
+		var handles []handle
+		for _, key := range []string{"points", "handles"} {
+			raw := obj(props, key)
+			for _, name := range sortedKeys(raw) {
+				if p, ok := raw[name].(map[string]interface{}); ok {
+					handles = append(handles, handle{str(p, "index"), point{num(p, "x"), num(p, "y")}})
+				}
+			}
+			if len(handles) > 0 {
+				break
+			}
+		}
+		sort.SliceStable(handles, func(i, j int) bool { return handles[i].index < handles[j].index })
+		points := make([]point, len(handles))
+		for i, h := range handles {
+			points[i] = t.apply(h.at)
+		}
+		b.polyline("line", id, points, s)
+
+	case "arrow":
+		start, end := obj(props, "start"), obj(props, "end")
+		if start == nil || end == nil {
+			b.skip(id, kind, "Arrow ends are stored in a format that can't be read")
+			return
+		}
+		from := t.apply(point{num(start, "x"), num(start, "y")})
+		to := t.apply(point{num(end, "x"), num(end, "y")})
+		b.polyline("line", id, []point{from, to}, s)
+		if head := str(props, "arrowheadEnd"); head != "none" {
+			b.arrowHead(id+"-end", from, to, s)
+		}
+		if head := str(props, "arrowheadStart"); head != "" && head != "none" {
+			b.arrowHead(id+"-start", to, from, s)
+		}
+
+	case "text":
+		b.text(id, tldrawText(props), t.origin, fontSize, t.rotation, tldrawColors[color])
+
+	case "note":
+		note := b.box("sticky", id, t.origin, tldrawNoteSize*scale, tldrawNoteSize*scale, t.rotation, style{Fill: tldrawTints[color]})
+		if text := tldrawText(props); text != "" {
+			note["text"] = text
+		}
+		note["fontSize"] = round(fontSize)
+
+	case "frame":
+		frame := b.box("frame", id, t.origin, num(props, "w"), num(props, "h"), t.rotation, style{})
+		if name := strings.TrimSpace(str(props, "name")); name != "" {
+			frame["title"] = name
+		}
+
+	case "group":
+		// Only its children are drawn
+
+	default:
+		// Images, videos, embeds, bookmarks and custom shapes
+		b.skip(id, kind, "")
+	}
+}
+
+// tldrawPolygon places a closed outline given in the shape's own
+// coordinates
+func tldrawPolygon(t tldrawTransform, corners ...point) []point {
+	points := make([]point, 0, len(corners)+1)
+	for _, corner := range corners {
+		points = append(points, t.apply(corner))
+	}
+	return append(points, points[0])
+}
+
+// tldrawText reads a shape's text: plain in older files, rich text (a
+// ProseMirror document) in newer ones
+func tldrawText(props map[string]interface{}) string {
+	if text := str(props, "text"); text != "" {
+		return text
+	}
+	if rich := obj(props, "richText"); rich != nil {
+		return strings.TrimRight(richText(rich), "\n")
+	}
+	return ""
+}
+
+// richText flattens a ProseMirror node, putting blocks on their own lines
+func richText(node map[string]interface{}) string {
+	switch str(node, "type") {
+	case "text":
+		return str(node, "text")
+	case "hardBreak":
+		return "\n"
+	}
+
+	content, _ := node["content"].([]interface{})
+	parts := make([]string, 0, len(content))
+	for _, item := range content {
+		if child, ok := item.(map[string]interface{}); ok {
+			parts = append(parts, richText(child))
+		}
+	}
+	switch str(node, "type") {
+	case "doc", "bulletList", "orderedList", "listItem", "blockquote":
+		return strings.Join(parts, "\n")
+	}
+	return strings.Join(parts, "")
+}
@@ -2,21 +2,30 @@ package database
 
 import (
 	"context"
+	"errors"
 	"log"
+	"log/slog"
 	"time"
 
+	"github.com/sarwanazhar/boardsar/backend/config"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
 )
 
 var Client *mongo.Client
 
-func ConnectMongo(uri string) {
+// databaseName is the database every collection is in, set by ConnectMongo
+var databaseName = config.DefaultDatabaseName
+
+// ConnectMongo connects to the deployment at uri and creates the indexes of
+// the named database, which the backend then uses
+func ConnectMongo(uri, name string) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri).SetMonitor(tracingMonitor()))
 	if err != nil {
 		log.Fatal("Mongo connect error:", err)
 	}
@@ -26,23 +35,74 @@ func ConnectMongo(uri string) {
 	}
 
 	Client = client
-	log.Println("✅ MongoDB connected")
+	databaseName = name
+	slog.Info("MongoDB connected", "database", name)
 
 	// Create indexes after successful connection
+	CreateIndexes()
+}
+
+// CreateIndexes creates the indexes of every collection the backend uses.
+// Indexes that already exist are left as they are.
+func CreateIndexes() {
 	CreateBoardIndexes()
+	CreateLegalHoldIndexes()
+	CreateRefreshTokenIndexes()
+	CreateSessionIndexes()
+	CreatePasswordResetIndexes()
+	CreateLintDictionaryIndexes()
+	CreateShareLinkIndexes()
+	CreateShortLinkIndexes()
+	CreateOAuthIndexes()
+	CreateAuditIndexes()
+	CreateBoardVersionIndexes()
+	CreateTemplateIndexes()
+	CreateFolderIndexes()
+	CreateClassroomIndexes()
+	CreateMagicLinkIndexes()
+	CreateTwoFactorChallengeIndexes()
+	CreateEmailChangeIndexes()
+	CreatePendingDeletionIndexes()
+	CreateIdentityIndexes()
+	CreateFavoriteIndexes()
+	CreateSectionStateIndexes()
+	CreatePasskeyIndexes()
+	CreateBoardTokenIndexes()
+	CreateThumbnailIndexes()
+	CreatePushSubscriptionIndexes()
+	CreateAssetIndexes()
+	CreateAvatarIndexes()
+	CreateShapeIndexIndexes()
+	CreateActivityIndexes()
+	CreateWebhookIndexes()
+	CreateBoardSummaryIndexes()
+	CreateJobIndexes()
+	CreateStorageSnapshotIndexes()
+}
+
+// DisconnectMongo closes the client's connections once their operations
+// are done, or when ctx is
+func DisconnectMongo(ctx context.Context) error {
+	if Client == nil {
+		return nil
+	}
+	return Client.Disconnect(ctx)
 }
 
-// InitializeMockClient creates a mock client to prevent nil pointer dereference
-func InitializeMockClient() {
-	Client = &mongo.Client{}
+// PingMongo checks that the primary answers
+func PingMongo(ctx context.Context) error {
+	if Client == nil {
+		return errors.New("MongoDB is not connected")
+	}
+	return Client.Ping(ctx, readpref.Primary())
 }
 
-func GetDatabase(dbName string) *mongo.Database {
-	return Client.Database(dbName)
+func GetDatabase() *mongo.Database {
+	return Client.Database(databaseName)
 }
 
-func GetCollection(dbName, collectionName string) *mongo.Collection {
-	return Client.Database(dbName).Collection(collectionName)
+func GetCollection(collectionName string) *mongo.Collection {
+	return Client.Database(databaseName).Collection(collectionName)
 }
 
 // CreateBoardIndexes creates necessary indexes for the boards collection
@@ -51,21 +111,948 @@ func CreateBoardIndexes() {
 	defer cancel()
 
 	// Create indexes on boards collection
-	boardsCollection := Client.Database("boardsar").Collection("boards")
+	boardsCollection := Client.Database(databaseName).Collection("boards")
 
 	indexes := []mongo.IndexModel{
 		{
-			Keys: bson.D{{"ownerId", 1}},
+			Keys: bson.D{{Key: "ownerId", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "updatedAt", Value: -1}},
+		},
+		{
+			Keys: bson.D{{Key: "sharedWith.userId", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "parentBoardId", Value: 1}},
+		},
+		// Board list pages, for each branch of the access filter
+		{
+			Keys: bson.D{{Key: "ownerId", Value: 1}, {Key: "updatedAt", Value: -1}, {Key: "_id", Value: -1}},
+		},
+		{
+			Keys: bson.D{{Key: "sharedWith.userId", Value: 1}, {Key: "updatedAt", Value: -1}, {Key: "_id", Value: -1}},
+		},
+		// Board list pages filtered by folder or tag. Shared boards are
+		// filtered on the sharedWith index, since MongoDB can't index two
+		// arrays together.
+		{
+			Keys: bson.D{{Key: "ownerId", Value: 1}, {Key: "folderId", Value: 1}, {Key: "updatedAt", Value: -1}, {Key: "_id", Value: -1}},
+		},
+		{
+			Keys: bson.D{{Key: "ownerId", Value: 1}, {Key: "tags", Value: 1}, {Key: "updatedAt", Value: -1}, {Key: "_id", Value: -1}},
+		},
+		// Boards with a scheduled freeze, for the scheduler
+		{
+			Keys:    bson.D{{Key: "freeze.at", Value: 1}},
+			Options: options.Index().SetPartialFilterExpression(bson.M{"freeze": bson.M{"$exists": true}}),
 		},
+		// Boards in cold storage, for the savings metrics
 		{
-			Keys: bson.D{{"updatedAt", -1}},
+			Keys:    bson.D{{Key: "archived.storage", Value: 1}},
+			Options: options.Index().SetPartialFilterExpression(bson.M{"archived": bson.M{"$exists": true}}),
 		},
 	}
 
 	_, err := boardsCollection.Indexes().CreateMany(ctx, indexes)
 	if err != nil {
-		log.Printf("⚠️  Failed to create board indexes: %v", err)
+		slog.Warn("Failed to create board indexes", "error", err)
+	} else {
+		slog.Info("Board indexes created successfully")
+	}
+}
+
+// CreateLegalHoldIndexes creates necessary indexes for the legal_holds collection
+func CreateLegalHoldIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	holdsCollection := Client.Database(databaseName).Collection("legal_holds")
+
+	indexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "targetType", Value: 1}, {Key: "targetId", Value: 1}},
+		},
+	}
+
+	_, err := holdsCollection.Indexes().CreateMany(ctx, indexes)
+	if err != nil {
+		slog.Warn("Failed to create legal hold indexes", "error", err)
+	} else {
+		slog.Info("Legal hold indexes created successfully")
+	}
+}
+
+// CreateRefreshTokenIndexes creates necessary indexes for the refresh_tokens
+// collection. Expired tokens are removed by a TTL index.
+func CreateRefreshTokenIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tokensCollection := Client.Database(databaseName).Collection("refresh_tokens")
+
+	indexes := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "tokenHash", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "familyId", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "userId", Value: 1}},
+		},
+		{
+			Keys:    bson.D{{Key: "clientId", Value: 1}},
+			Options: options.Index().SetSparse(true),
+		},
+		{
+			Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	}
+
+	_, err := tokensCollection.Indexes().CreateMany(ctx, indexes)
+	if err != nil {
+		slog.Warn("Failed to create refresh token indexes", "error", err)
+	} else {
+		slog.Info("Refresh token indexes created successfully")
+	}
+}
+
+// CreateSessionIndexes creates necessary indexes for the sessions
+// collection. Sessions whose refresh tokens expired are removed by a TTL
+// index.
+func CreateSessionIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	sessionsCollection := Client.Database(databaseName).Collection("sessions")
+
+	indexes := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "familyId", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "userId", Value: 1}, {Key: "lastSeenAt", Value: -1}},
+		},
+		{
+			Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	}
+
+	_, err := sessionsCollection.Indexes().CreateMany(ctx, indexes)
+	if err != nil {
+		slog.Warn("Failed to create session indexes", "error", err)
+	} else {
+		slog.Info("Session indexes created successfully")
+	}
+}
+
+// CreatePasswordResetIndexes creates necessary indexes for the
+// password_resets collection. Expired tokens are removed by a TTL index.
+func CreatePasswordResetIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	resetsCollection := Client.Database(databaseName).Collection("password_resets")
+
+	indexes := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "tokenHash", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "userId", Value: 1}},
+		},
+		{
+			Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	}
+
+	_, err := resetsCollection.Indexes().CreateMany(ctx, indexes)
+	if err != nil {
+		slog.Warn("Failed to create password reset indexes", "error", err)
+	} else {
+		slog.Info("Password reset indexes created successfully")
+	}
+}
+
+// CreateLintDictionaryIndexes creates necessary indexes for the
+// lint_dictionaries collection (one dictionary per owner)
+func CreateLintDictionaryIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	dictionariesCollection := Client.Database(databaseName).Collection("lint_dictionaries")
+
+	indexes := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "ownerId", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+	}
+
+	_, err := dictionariesCollection.Indexes().CreateMany(ctx, indexes)
+	if err != nil {
+		slog.Warn("Failed to create lint dictionary indexes", "error", err)
+	} else {
+		slog.Info("Lint dictionary indexes created successfully")
+	}
+}
+
+// CreateShareLinkIndexes creates necessary indexes for the share_links and
+// share_link_uses collections
+func CreateShareLinkIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	linksCollection := Client.Database(databaseName).Collection("share_links")
+
+	indexes := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "tokenHash", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "revokeTokenHashes", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "boardId", Value: 1}, {Key: "createdAt", Value: -1}},
+		},
+	}
+
+	_, err := linksCollection.Indexes().CreateMany(ctx, indexes)
+	if err != nil {
+		slog.Warn("Failed to create share link indexes", "error", err)
+		return
+	}
+
+	usesCollection := Client.Database(databaseName).Collection("share_link_uses")
+
+	_, err = usesCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "linkId", Value: 1}, {Key: "usedAt", Value: -1}},
+	})
+	if err != nil {
+		slog.Warn("Failed to create share link use indexes", "error", err)
+	} else {
+		slog.Info("Share link indexes created successfully")
+	}
+}
+
+// CreateShortLinkIndexes creates necessary indexes for the short_links and
+// short_link_clicks collections
+func CreateShortLinkIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	linksCollection := Client.Database(databaseName).Collection("short_links")
+
+	_, err := linksCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "code", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "boardId", Value: 1}, {Key: "createdAt", Value: -1}},
+		},
+		{
+			Keys: bson.D{{Key: "ownerId", Value: 1}},
+		},
+	})
+	if err != nil {
+		slog.Warn("Failed to create short link indexes", "error", err)
+		return
+	}
+
+	clicksCollection := Client.Database(databaseName).Collection("short_link_clicks")
+
+	_, err = clicksCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "linkId", Value: 1}, {Key: "clickedAt", Value: -1}},
+	})
+	if err != nil {
+		slog.Warn("Failed to create short link click indexes", "error", err)
+	} else {
+		slog.Info("Short link indexes created successfully")
+	}
+}
+
+// CreateOAuthIndexes creates necessary indexes for the OAuth app
+// collections. Expired authorization codes are removed by a TTL index.
+func CreateOAuthIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	clientsCollection := Client.Database(databaseName).Collection("oauth_clients")
+
+	_, err := clientsCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "ownerId", Value: 1}, {Key: "createdAt", Value: -1}},
+	})
+	if err != nil {
+		slog.Warn("Failed to create OAuth client indexes", "error", err)
+		return
+	}
+
+	codesCollection := Client.Database(databaseName).Collection("oauth_codes")
+
+	_, err = codesCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "codeHash", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "clientId", Value: 1}},
+		},
+		{
+			Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+	if err != nil {
+		slog.Warn("Failed to create OAuth code indexes", "error", err)
+		return
+	}
+
+	grantsCollection := Client.Database(databaseName).Collection("oauth_grants")
+
+	_, err = grantsCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "clientId", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "clientId", Value: 1}},
+		},
+	})
+	if err != nil {
+		slog.Warn("Failed to create OAuth grant indexes", "error", err)
+	} else {
+		slog.Info("OAuth indexes created successfully")
+	}
+}
+
+// CreateAuditIndexes creates the index used to list a board's audited
+// activity, such as its exports
+func CreateAuditIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	auditCollection := Client.Database(databaseName).Collection("audit_events")
+
+	_, err := auditCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "target.type", Value: 1}, {Key: "target.id", Value: 1}, {Key: "action", Value: 1}, {Key: "_id", Value: -1}},
+	})
+	if err != nil {
+		slog.Warn("Failed to create audit indexes", "error", err)
+	} else {
+		slog.Info("Audit indexes created successfully")
+	}
+}
+
+// CreateBoardVersionIndexes creates necessary indexes for the board_versions
+// collection
+func CreateBoardVersionIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	versionsCollection := Client.Database(databaseName).Collection("board_versions")
+
+	_, err := versionsCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "boardId", Value: 1}, {Key: "_id", Value: -1}},
+		},
+		{
+			Keys: bson.D{{Key: "boardId", Value: 1}, {Key: "label", Value: 1}, {Key: "_id", Value: -1}},
+		},
+	})
+	if err != nil {
+		slog.Warn("Failed to create board version indexes", "error", err)
+	} else {
+		slog.Info("Board version indexes created successfully")
+	}
+}
+
+// CreateTemplateIndexes creates necessary indexes for the templates
+// collection
+func CreateTemplateIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	templatesCollection := Client.Database(databaseName).Collection("templates")
+
+	_, err := templatesCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "ownerId", Value: 1}, {Key: "_id", Value: -1}},
+		},
+		{
+			Keys: bson.D{{Key: "global", Value: 1}, {Key: "_id", Value: -1}},
+		},
+	})
+	if err != nil {
+		slog.Warn("Failed to create template indexes", "error", err)
+	} else {
+		slog.Info("Template indexes created successfully")
+	}
+}
+
+// CreateFolderIndexes creates necessary indexes for the folders collection
+func CreateFolderIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	foldersCollection := Client.Database(databaseName).Collection("folders")
+
+	_, err := foldersCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "ownerId", Value: 1}, {Key: "name", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+	})
+	if err != nil {
+		slog.Warn("Failed to create folder indexes", "error", err)
+	} else {
+		slog.Info("Folder indexes created successfully")
+	}
+}
+
+// CreateClassroomIndexes creates necessary indexes for the classrooms
+// collection
+func CreateClassroomIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	classroomsCollection := Client.Database(databaseName).Collection("classrooms")
+
+	_, err := classroomsCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "ownerId", Value: 1}, {Key: "createdAt", Value: -1}}},
+	})
+	if err != nil {
+		slog.Warn("Failed to create classroom indexes", "error", err)
+	} else {
+		slog.Info("Classroom indexes created successfully")
+	}
+}
+
+// CreateMagicLinkIndexes creates necessary indexes for the magic_links
+// collection. Expired links are removed by a TTL index.
+func CreateMagicLinkIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	linksCollection := Client.Database(databaseName).Collection("magic_links")
+
+	_, err := linksCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "tokenHash", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "email", Value: 1}},
+		},
+		{
+			Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+	if err != nil {
+		slog.Warn("Failed to create magic link indexes", "error", err)
+	} else {
+		slog.Info("Magic link indexes created successfully")
+	}
+}
+
+// CreateTwoFactorChallengeIndexes creates necessary indexes for the
+// two_factor_challenges collection. Expired sign-ins are removed by a TTL
+// index.
+func CreateTwoFactorChallengeIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	challengesCollection := Client.Database(databaseName).Collection("two_factor_challenges")
+
+	_, err := challengesCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "tokenHash", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "userId", Value: 1}},
+		},
+		{
+			Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+	if err != nil {
+		slog.Warn("Failed to create two-factor challenge indexes", "error", err)
+	} else {
+		slog.Info("Two-factor challenge indexes created successfully")
+	}
+}
+
+// CreateEmailChangeIndexes creates necessary indexes for the email_changes
+// collection. Expired confirmations are removed by a TTL index.
+func CreateEmailChangeIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	changesCollection := Client.Database(databaseName).Collection("email_changes")
+
+	_, err := changesCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "tokenHash", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "userId", Value: 1}},
+		},
+		{
+			Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+	if err != nil {
+		slog.Warn("Failed to create email change indexes", "error", err)
+	} else {
+		slog.Info("Email change indexes created successfully")
+	}
+}
+
+// CreatePendingDeletionIndexes creates necessary indexes for the
+// pending_deletions collection. A board or account has at most one pending
+// deletion.
+func CreatePendingDeletionIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	deletionsCollection := Client.Database(databaseName).Collection("pending_deletions")
+
+	_, err := deletionsCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "kind", Value: 1}, {Key: "userId", Value: 1}, {Key: "boardId", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "tokenHash", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "deleteAt", Value: 1}},
+		},
+	})
+	if err != nil {
+		slog.Warn("Failed to create pending deletion indexes", "error", err)
+	} else {
+		slog.Info("Pending deletion indexes created successfully")
+	}
+}
+
+// CreateIdentityIndexes creates necessary indexes for the identities and
+// oauth_states collections. Abandoned sign-ins are removed by a TTL index.
+func CreateIdentityIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	identitiesCollection := Client.Database(databaseName).Collection("identities")
+
+	_, err := identitiesCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "provider", Value: 1}, {Key: "subject", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "provider", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+	})
+	if err != nil {
+		slog.Warn("Failed to create identity indexes", "error", err)
+		return
+	}
+
+	statesCollection := Client.Database(databaseName).Collection("oauth_states")
+
+	_, err = statesCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "stateHash", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+	if err != nil {
+		slog.Warn("Failed to create OAuth state indexes", "error", err)
+	} else {
+		slog.Info("Identity indexes created successfully")
+	}
+}
+
+// CreateFavoriteIndexes creates necessary indexes for the favorites
+// collection (one star per user and board)
+func CreateFavoriteIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	favoritesCollection := Client.Database(databaseName).Collection("favorites")
+
+	_, err := favoritesCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "boardId", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "boardId", Value: 1}},
+		},
+	})
+	if err != nil {
+		slog.Warn("Failed to create favorite indexes", "error", err)
+	} else {
+		slog.Info("Favorite indexes created successfully")
+	}
+}
+
+// CreateSectionStateIndexes creates necessary indexes for the
+// section_states collection (one state per user and section)
+func CreateSectionStateIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	sectionStatesCollection := Client.Database(databaseName).Collection("section_states")
+
+	_, err := sectionStatesCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "boardId", Value: 1}, {Key: "sectionId", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "boardId", Value: 1}, {Key: "sectionId", Value: 1}},
+		},
+	})
+	if err != nil {
+		slog.Warn("Failed to create section state indexes", "error", err)
+	} else {
+		slog.Info("Section state indexes created successfully")
+	}
+}
+
+// CreatePasskeyIndexes creates necessary indexes for the passkeys and
+// webauthn_challenges collections. Abandoned ceremonies are removed by a
+// TTL index.
+func CreatePasskeyIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	passkeysCollection := Client.Database(databaseName).Collection("passkeys")
+
+	_, err := passkeysCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "credentialId", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "userId", Value: 1}},
+		},
+	})
+	if err != nil {
+		slog.Warn("Failed to create passkey indexes", "error", err)
+		return
+	}
+
+	challengesCollection := Client.Database(databaseName).Collection("webauthn_challenges")
+
+	_, err = challengesCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "challengeHash", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+	if err != nil {
+		slog.Warn("Failed to create WebAuthn challenge indexes", "error", err)
+	} else {
+		slog.Info("Passkey indexes created successfully")
+	}
+}
+
+// CreateBoardTokenIndexes creates necessary indexes for the embed_tokens and
+// revoked_board_tokens collections. Both drop entries by TTL once the
+// tokens have expired.
+func CreateBoardTokenIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	embedTokensCollection := Client.Database(databaseName).Collection("embed_tokens")
+
+	_, err := embedTokensCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "boardId", Value: 1}, {Key: "createdAt", Value: -1}},
+		},
+		{
+			Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+	if err != nil {
+		slog.Warn("Failed to create embed token indexes", "error", err)
+		return
+	}
+
+	revokedCollection := Client.Database(databaseName).Collection("revoked_board_tokens")
+
+	_, err = revokedCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		slog.Warn("Failed to create revoked board token indexes", "error", err)
+	} else {
+		slog.Info("Board token indexes created successfully")
+	}
+}
+
+func CreateThumbnailIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Files collection of the thumbnails GridFS bucket
+	thumbnailsCollection := Client.Database(databaseName).Collection("thumbnails.files")
+
+	_, err := thumbnailsCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "metadata.boardId", Value: 1}, {Key: "_id", Value: -1}},
+	})
+	if err != nil {
+		slog.Warn("Failed to create thumbnail indexes", "error", err)
+	} else {
+		slog.Info("Thumbnail indexes created successfully")
+	}
+}
+
+func CreatePushSubscriptionIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	pushCollection := Client.Database(databaseName).Collection("push_subscriptions")
+
+	_, err := pushCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			// A browser subscription belongs to one user
+			Keys:    bson.D{{Key: "endpoint", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "userId", Value: 1}, {Key: "createdAt", Value: 1}},
+		},
+	})
+	if err != nil {
+		slog.Warn("Failed to create push subscription indexes", "error", err)
+	} else {
+		slog.Info("Push subscription indexes created successfully")
+	}
+}
+
+func CreateAssetIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	assetCollection := Client.Database(databaseName).Collection("assets")
+
+	_, err := assetCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "boardId", Value: 1}},
+		},
+		{
+			// Storage quota totals
+			Keys: bson.D{{Key: "ownerId", Value: 1}},
+		},
+	})
+	if err != nil {
+		slog.Warn("Failed to create asset indexes", "error", err)
+	} else {
+		slog.Info("Asset indexes created successfully")
+	}
+}
+
+// CreateAvatarIndexes creates necessary indexes for the avatars collection
+func CreateAvatarIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	avatarCollection := Client.Database(databaseName).Collection("avatars")
+
+	_, err := avatarCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "userId", Value: 1}},
+	})
+	if err != nil {
+		slog.Warn("Failed to create avatar indexes", "error", err)
+	} else {
+		slog.Info("Avatar indexes created successfully")
+	}
+}
+
+func CreateShapeIndexIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	shapesCollection := Client.Database(databaseName).Collection("board_shapes")
+
+	_, err := shapesCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			// Viewport queries; board coordinates go well past the default
+			// longitude/latitude range. Locations are clamped to ±1e9.
+			Keys:    bson.D{{Key: "location", Value: "2d"}, {Key: "boardId", Value: 1}, {Key: "version", Value: 1}},
+			Options: options.Index().SetMin(-2e9).SetMax(2e9),
+		},
+		{
+			// One entry per shape, however many builds of a version race
+			Keys:    bson.D{{Key: "boardId", Value: 1}, {Key: "version", Value: 1}, {Key: "order", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+	})
+	if err != nil {
+		slog.Warn("Failed to create shape index indexes", "error", err)
+	} else {
+		slog.Info("Shape index indexes created successfully")
+	}
+}
+
+func CreateActivityIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	activityCollection := Client.Database(databaseName).Collection("activity")
+
+	_, err := activityCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			// A board's feed
+			Keys: bson.D{{Key: "boardId", Value: 1}, {Key: "updatedAt", Value: -1}, {Key: "_id", Value: -1}},
+		},
+		{
+			// A user's own actions, and folding their saves together
+			Keys: bson.D{{Key: "actorId", Value: 1}, {Key: "updatedAt", Value: -1}, {Key: "_id", Value: -1}},
+		},
+		{
+			// Entries past ACTIVITY_RETENTION
+			Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+	if err != nil {
+		slog.Warn("Failed to create activity indexes", "error", err)
+	} else {
+		slog.Info("Activity indexes created successfully")
+	}
+}
+
+func CreateWebhookIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	webhookCollection := Client.Database(databaseName).Collection("webhooks")
+	_, err := webhookCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "userId", Value: 1}, {Key: "createdAt", Value: 1}},
+	})
+	if err != nil {
+		slog.Warn("Failed to create webhook indexes", "error", err)
+		return
+	}
+
+	deliveryCollection := Client.Database(databaseName).Collection("webhook_deliveries")
+	_, err = deliveryCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			// The queue; sent and failed deliveries drop out of it
+			Keys:    bson.D{{Key: "nextAttemptAt", Value: 1}},
+			Options: options.Index().SetPartialFilterExpression(bson.M{"status": "pending"}),
+		},
+		{
+			// A webhook's recent deliveries
+			Keys: bson.D{{Key: "webhookId", Value: 1}, {Key: "_id", Value: -1}},
+		},
+		{
+			// Deliveries are kept for a week
+			Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+	if err != nil {
+		slog.Warn("Failed to create webhook indexes", "error", err)
+	} else {
+		slog.Info("Webhook indexes created successfully")
+	}
+}
+
+// CreateBoardSummaryIndexes creates the board list indexes, on the
+// board_summaries collection lists read
+func CreateBoardSummaryIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	summariesCollection := Client.Database(databaseName).Collection("board_summaries")
+
+	_, err := summariesCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		// Board list pages, for each branch of the access filter
+		{
+			Keys: bson.D{{Key: "ownerId", Value: 1}, {Key: "updatedAt", Value: -1}, {Key: "_id", Value: -1}},
+		},
+		{
+			Keys: bson.D{{Key: "sharedWith.userId", Value: 1}, {Key: "updatedAt", Value: -1}, {Key: "_id", Value: -1}},
+		},
+		// Filtered by folder or tag
+		{
+			Keys: bson.D{{Key: "ownerId", Value: 1}, {Key: "folderId", Value: 1}, {Key: "updatedAt", Value: -1}, {Key: "_id", Value: -1}},
+		},
+		{
+			Keys: bson.D{{Key: "ownerId", Value: 1}, {Key: "tags", Value: 1}, {Key: "updatedAt", Value: -1}, {Key: "_id", Value: -1}},
+		},
+	})
+	if err != nil {
+		slog.Warn("Failed to create board summary indexes", "error", err)
+	} else {
+		slog.Info("Board summary indexes created successfully")
+	}
+}
+
+// CreateJobIndexes creates the TTL index that drops jobs once their
+// results are no longer kept
+func CreateJobIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	jobsCollection := Client.Database(databaseName).Collection("jobs")
+
+	_, err := jobsCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		slog.Warn("Failed to create job indexes", "error", err)
+	} else {
+		slog.Info("Job indexes created successfully")
+	}
+}
+
+// CreateStorageSnapshotIndexes creates necessary indexes for the
+// storage_snapshots collection. Old snapshots are removed by a TTL index.
+func CreateStorageSnapshotIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	snapshotsCollection := Client.Database(databaseName).Collection("storage_snapshots")
+
+	_, err := snapshotsCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		slog.Warn("Failed to create storage snapshot indexes", "error", err)
 	} else {
-		log.Println("✅ Board indexes created successfully")
+		slog.Info("Storage snapshot indexes created successfully")
 	}
 }
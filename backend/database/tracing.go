@@ -0,0 +1,92 @@
+package database
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/event"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/sarwanazhar/boardsar/backend/database"
+
+// commandSpans holds the span of each Mongo command in flight, by the
+// driver's request ID, until its reply or failure ends it
+type commandSpans struct {
+	spans sync.Map
+}
+
+// tracingMonitor traces every command sent to Mongo as a client span,
+// child of the span in the context the command was run with. Command
+// bodies aren't recorded: they carry board contents and credentials.
+func tracingMonitor() *event.CommandMonitor {
+	tracked := &commandSpans{}
+	return &event.CommandMonitor{
+		Started:   tracked.started,
+		Succeeded: tracked.succeeded,
+		Failed:    tracked.failed,
+	}
+}
+
+func (t *commandSpans) started(ctx context.Context, evt *event.CommandStartedEvent) {
+	collection, _ := evt.Command.Lookup(evt.CommandName).StringValueOK()
+	name := evt.CommandName
+	if collection != "" {
+		name = evt.CommandName + " " + collection
+	}
+
+	attrs := []attribute.KeyValue{
+		semconv.DBSystemMongoDB,
+		semconv.DBNamespace(evt.DatabaseName),
+		semconv.DBOperationName(evt.CommandName),
+	}
+	if collection != "" {
+		attrs = append(attrs, semconv.DBCollectionName(collection))
+	}
+	if host, port, ok := commandServer(evt.ConnectionID); ok {
+		attrs = append(attrs, semconv.ServerAddress(host), semconv.ServerPort(port))
+	}
+
+	_, span := otel.Tracer(tracerName).Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...),
+	)
+	t.spans.Store(evt.RequestID, span)
+}
+
+func (t *commandSpans) succeeded(_ context.Context, evt *event.CommandSucceededEvent) {
+	if span, ok := t.spans.LoadAndDelete(evt.RequestID); ok {
+		span.(trace.Span).End()
+	}
+}
+
+func (t *commandSpans) failed(_ context.Context, evt *event.CommandFailedEvent) {
+	if span, ok := t.spans.LoadAndDelete(evt.RequestID); ok {
+		span.(trace.Span).SetStatus(codes.Error, evt.Failure)
+		span.(trace.Span).End()
+	}
+}
+
+// commandServer reads the server out of a connection ID such as
+// "localhost:27017[-3]"
+func commandServer(connectionID string) (string, int, bool) {
+	if i := strings.IndexByte(connectionID, '['); i >= 0 {
+		connectionID = connectionID[:i]
+	}
+	host, rawPort, err := net.SplitHostPort(connectionID)
+	if err != nil {
+		return "", 0, false
+	}
+	port, err := strconv.Atoi(rawPort)
+	if err != nil {
+		return "", 0, false
+	}
+	return host, port, true
+}
@@ -0,0 +1,105 @@
+//go:build integration
+
+package integration
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAccountExportAndDelete(t *testing.T) {
+	requireHarness(t)
+
+	user, token := seedUser(t, "")
+	friend, friendToken := seedUser(t, "")
+	boardID := seedBoard(t, token)
+	friendBoard := seedBoard(t, friendToken)
+	if status, _ := doJSON(t, http.MethodPost, "/api/boards/"+friendBoard+"/share", friendToken, gin.H{"email": user.Email, "role": "editor"}); status != http.StatusOK {
+		t.Fatalf("share: expected 200, got %d", status)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/auth/export", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/zip" {
+		t.Fatalf("export: expected a zip, got %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	archive, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatalf("export: not a zip: %v", err)
+	}
+	files := map[string]*zip.File{}
+	for _, file := range archive.File {
+		files[file.Name] = file
+	}
+	for _, name := range []string{"account.json", "boards/" + boardID + ".json", "shared-boards.json", "sessions.json"} {
+		if files[name] == nil {
+			t.Fatalf("export: expected %s in the archive", name)
+		}
+	}
+	reader, err := files["shared-boards.json"].Open()
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	var shared []map[string]interface{}
+	err = json.NewDecoder(reader).Decode(&shared)
+	reader.Close()
+	if err != nil || len(shared) != 1 || shared[0]["id"] != friendBoard || shared[0]["role"] != "editor" {
+		t.Fatalf("export: expected the shared board, got %v (%v)", shared, err)
+	}
+
+	if status, _ := doJSON(t, http.MethodDelete, "/auth/account", token, gin.H{"email": friend.Email, "password": "testpassword123"}); status != http.StatusBadRequest {
+		t.Fatalf("delete with another email: expected 400, got %d", status)
+	}
+	if status, _ := doJSON(t, http.MethodDelete, "/auth/account", token, gin.H{"email": user.Email, "password": "wrong"}); status != http.StatusUnauthorized {
+		t.Fatalf("delete with a wrong password: expected 401, got %d", status)
+	}
+	status, response := doJSON(t, http.MethodDelete, "/auth/account", token, gin.H{"email": user.Email, "password": "testpassword123"})
+	if status != http.StatusOK || response["boardsDeleted"] != 1.0 {
+		t.Fatalf("delete: expected 200 with one board deleted, got %d (%v)", status, response)
+	}
+
+	if status, _ := doJSON(t, http.MethodGet, "/me", token, nil); status != http.StatusUnauthorized {
+		t.Fatalf("profile after delete: expected 401, got %d", status)
+	}
+	if status, _ := doJSON(t, http.MethodGet, "/api/boards/"+boardID, friendToken, nil); status != http.StatusNotFound {
+		t.Fatalf("deleted user's board: expected 404, got %d", status)
+	}
+	status, response = doJSON(t, http.MethodGet, "/api/boards", friendToken, nil)
+	if status != http.StatusOK {
+		t.Fatalf("friend's boards: expected 200, got %d", status)
+	}
+	if board := response["boards"].([]interface{})[0].(map[string]interface{}); board["collaboratorCount"] != nil && board["collaboratorCount"] != 0.0 {
+		t.Fatalf("friend's board: expected no collaborators left, got %v", board)
+	}
+}
+
+func TestImportFromInstance(t *testing.T) {
+	requireHarness(t)
+
+	_, token := seedUser(t, "")
+
+	status, body := doJSON(t, http.MethodPost, "/me/import-from-instance", token, gin.H{"url": "ftp://boards.example.com", "apiKey": "key"})
+	if status != http.StatusBadRequest {
+		t.Fatalf("ftp URL: expected 400, got %d (%v)", status, body)
+	}
+	status, _ = doJSON(t, http.MethodPost, "/me/import-from-instance", token, gin.H{"url": "https://boards.example.com"})
+	if status != http.StatusBadRequest {
+		t.Fatalf("no API key: expected 400, got %d", status)
+	}
+
+	// The server doesn't call into its own network, this instance included
+	remote := httptest.NewServer(router)
+	defer remote.Close()
+	status, body = doJSON(t, http.MethodPost, "/me/import-from-instance", token, gin.H{"url": remote.URL, "apiKey": token})
+	if status != http.StatusBadRequest || body["error"] != "The instance is on a private network" {
+		t.Fatalf("private instance: expected 400, got %d (%v)", status, body)
+	}
+}
@@ -0,0 +1,112 @@
+//go:build integration
+
+package integration
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/models"
+)
+
+// activitySummaries lists the summaries of an activity page, newest first
+func activitySummaries(t *testing.T, path, token string) ([]string, map[string]interface{}) {
+	t.Helper()
+	status, body := doJSON(t, http.MethodGet, path, token, nil)
+	if status != http.StatusOK {
+		t.Fatalf("%s: expected 200, got %d: %v", path, status, body)
+	}
+	summaries := []string{}
+	for _, entry := range body["activity"].([]interface{}) {
+		summaries = append(summaries, entry.(map[string]interface{})["summary"].(string))
+	}
+	return summaries, body
+}
+
+func expectSummaries(t *testing.T, got []string, want ...string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("expected activity %q, got %q", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("expected activity %q, got %q", want, got)
+		}
+	}
+}
+
+func TestBoardActivity(t *testing.T) {
+	requireHarness(t)
+
+	owner, ownerToken := seedUser(t, "")
+	editor, editorToken := seedUser(t, "")
+	_, strangerToken := seedUser(t, "")
+	boardID := seedBoard(t, ownerToken)
+
+	// Two quick saves by the owner fold into one entry
+	added := testBoardData()
+	added["shapes"] = append(added["shapes"].([]interface{}), gin.H{"id": "test-shape-2", "type": "rect", "x": 0, "y": 0, "width": 10, "height": 10})
+	doJSON(t, http.MethodPut, "/api/boards/"+boardID, ownerToken, gin.H{"board": added})
+	moved := testBoardData()
+	moved["shapes"] = append(moved["shapes"].([]interface{}), gin.H{"id": "test-shape-2", "type": "rect", "x": 50, "y": 0, "width": 10, "height": 10})
+	doJSON(t, http.MethodPut, "/api/boards/"+boardID, ownerToken, gin.H{"board": moved})
+
+	doJSON(t, http.MethodPost, "/api/boards/"+boardID+"/share", ownerToken, gin.H{"email": editor.Email, "role": models.CollaboratorRoleEditor})
+	doJSON(t, http.MethodPatch, "/api/boards/"+boardID, editorToken, gin.H{
+		"operations": []gin.H{{"op": "delete", "id": "test-shape-2"}},
+	})
+
+	summaries, body := activitySummaries(t, "/api/boards/"+boardID+"/activity", editorToken)
+	expectSummaries(t, summaries,
+		"Removed 1 shape",
+		"Shared the board with "+editor.Email+" as editor",
+		"Added 1 shape and changed 1 shape",
+		"Created the board",
+	)
+	entries := body["activity"].([]interface{})
+	latest := entries[0].(map[string]interface{})
+	if latest["actorId"] != editor.ID.Hex() || latest["actorEmail"] != editor.Email || latest["action"] != models.ActivityBoardUpdated {
+		t.Fatalf("expected the editor's save first, got %v", latest)
+	}
+	if folded := entries[2].(map[string]interface{})["changes"].(map[string]interface{}); folded["saves"] != 2.0 {
+		t.Fatalf("expected the owner's saves folded together, got %v", folded)
+	}
+
+	// Pages follow the cursor
+	_, body = activitySummaries(t, "/api/boards/"+boardID+"/activity?limit=3", ownerToken)
+	if body["hasMore"] != true {
+		t.Fatalf("first page: expected more, got %v", body)
+	}
+	summaries, body = activitySummaries(t, "/api/boards/"+boardID+"/activity?limit=3&cursor="+body["nextCursor"].(string), ownerToken)
+	expectSummaries(t, summaries, "Created the board")
+	if body["hasMore"] != false {
+		t.Fatalf("last page: expected no more, got %v", body)
+	}
+
+	if status, _ := doJSON(t, http.MethodGet, "/api/boards/"+boardID+"/activity", strangerToken, nil); status != http.StatusNotFound {
+		t.Fatalf("stranger: expected 404, got %d", status)
+	}
+	if status, _ := doJSON(t, http.MethodGet, "/api/activity?limit=0", ownerToken, nil); status != http.StatusBadRequest {
+		t.Fatalf("limit 0: expected 400, got %d", status)
+	}
+
+	// Each user's own actions, including on boards since deleted
+	doJSON(t, http.MethodDelete, "/api/boards/"+boardID+"/share/"+editor.ID.Hex(), editorToken, nil)
+	doJSON(t, http.MethodDelete, "/api/boards/"+boardID, ownerToken, nil)
+
+	summaries, _ = activitySummaries(t, "/api/activity", editorToken)
+	expectSummaries(t, summaries, "Left the board", "Removed 1 shape")
+	summaries, body = activitySummaries(t, "/api/activity", ownerToken)
+	expectSummaries(t, summaries,
+		"Deleted the board",
+		"Shared the board with "+editor.Email+" as editor",
+		"Added 1 shape and changed 1 shape",
+		"Created the board",
+	)
+	for _, entry := range body["activity"].([]interface{}) {
+		if entry.(map[string]interface{})["actorId"] != owner.ID.Hex() {
+			t.Fatalf("expected only the owner's actions, got %v", entry)
+		}
+	}
+}
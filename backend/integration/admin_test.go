@@ -0,0 +1,402 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestAdminRoutesRequireAdmin(t *testing.T) {
+	requireHarness(t)
+
+	_, token := seedUser(t, "")
+
+	status, _ := doJSON(t, http.MethodGet, "/api/admin/legal-holds", token, nil)
+	if status != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d", status)
+	}
+}
+
+func TestLegalHoldBlocksBoardDeletion(t *testing.T) {
+	requireHarness(t)
+
+	_, adminToken := seedUser(t, models.RoleAdmin)
+	_, ownerToken := seedUser(t, "")
+	boardID := seedBoard(t, ownerToken)
+
+	status, response := doJSON(t, http.MethodPost, "/api/admin/legal-holds", adminToken, gin.H{
+		"targetType": models.LegalHoldTargetBoard,
+		"targetId":   boardID,
+		"reason":     "litigation",
+	})
+	if status != http.StatusCreated {
+		t.Fatalf("place hold: expected 201, got %d (%v)", status, response)
+	}
+	holdID := response["hold"].(map[string]interface{})["_id"].(string)
+
+	status, _ = doJSON(t, http.MethodDelete, "/api/boards/"+boardID, ownerToken, nil)
+	if status != http.StatusLocked {
+		t.Fatalf("delete under hold: expected 423, got %d", status)
+	}
+
+	status, _ = doJSON(t, http.MethodDelete, "/api/admin/legal-holds/"+holdID, adminToken, nil)
+	if status != http.StatusOK {
+		t.Fatalf("release hold: expected 200, got %d", status)
+	}
+
+	status, _ = doJSON(t, http.MethodDelete, "/api/boards/"+boardID, ownerToken, nil)
+	if status != http.StatusOK {
+		t.Fatalf("delete after release: expected 200, got %d", status)
+	}
+}
+
+func TestLegalHoldOnUser(t *testing.T) {
+	requireHarness(t)
+
+	_, adminToken := seedUser(t, models.RoleAdmin)
+	owner, ownerToken := seedUser(t, "")
+	boardID := seedBoard(t, ownerToken)
+
+	status, response := doJSON(t, http.MethodPost, "/api/admin/legal-holds", adminToken, gin.H{
+		"targetType": models.LegalHoldTargetUser,
+		"targetId":   owner.ID.Hex(),
+		"reason":     "regulator request",
+		"expiresAt":  time.Now().Add(time.Hour),
+	})
+	if status != http.StatusCreated {
+		t.Fatalf("place hold: expected 201, got %d (%v)", status, response)
+	}
+	holdID := response["hold"].(map[string]interface{})["_id"].(string)
+
+	// Neither the account nor the boards it owns can be deleted
+	status, _ = doJSON(t, http.MethodDelete, "/api/boards/"+boardID, ownerToken, nil)
+	if status != http.StatusLocked {
+		t.Fatalf("delete board under user hold: expected 423, got %d", status)
+	}
+	status, _ = doJSON(t, http.MethodDelete, "/auth/account", ownerToken, gin.H{"email": owner.Email, "password": "testpassword123"})
+	if status != http.StatusLocked {
+		t.Fatalf("delete account under hold: expected 423, got %d", status)
+	}
+
+	// Exports stay allowed
+	status, _ = doJSON(t, http.MethodGet, "/api/boards/"+boardID+"/export?format=json", ownerToken, nil)
+	if status != http.StatusOK {
+		t.Fatalf("export under hold: expected 200, got %d", status)
+	}
+
+	_, response = doJSON(t, http.MethodGet, "/api/admin/legal-holds?active=true", adminToken, nil)
+	found := false
+	for _, item := range response["holds"].([]interface{}) {
+		hold := item.(map[string]interface{})
+		if hold["_id"] == holdID {
+			found = hold["reason"] == "regulator request" && hold["expiresAt"] != nil
+		}
+	}
+	if !found {
+		t.Fatalf("expected the hold with its reason and expiry among active holds, got %v", response["holds"])
+	}
+
+	status, _ = doJSON(t, http.MethodDelete, "/api/admin/legal-holds/"+holdID, adminToken, nil)
+	if status != http.StatusOK {
+		t.Fatalf("release hold: expected 200, got %d", status)
+	}
+
+	// A hold that has expired no longer blocks anything
+	expired := time.Now().Add(-time.Minute)
+	boardObjectID, _ := primitive.ObjectIDFromHex(boardID)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := libs.GetLegalHoldCollection().InsertOne(ctx, models.LegalHold{
+		ID:         primitive.NewObjectID(),
+		TargetType: models.LegalHoldTargetBoard,
+		TargetID:   boardObjectID,
+		Reason:     "expired",
+		CreatedAt:  time.Now().Add(-time.Hour),
+		ExpiresAt:  &expired,
+	}); err != nil {
+		t.Fatalf("failed to seed expired hold: %v", err)
+	}
+	status, _ = doJSON(t, http.MethodDelete, "/api/boards/"+boardID, ownerToken, nil)
+	if status != http.StatusOK {
+		t.Fatalf("delete after the holds ended: expected 200, got %d", status)
+	}
+}
+
+func TestReadOnlyModeRejectsWrites(t *testing.T) {
+	requireHarness(t)
+
+	_, adminToken := seedUser(t, models.RoleAdmin)
+	_, token := seedUser(t, "")
+
+	status, _ := doJSON(t, http.MethodPut, "/api/admin/read-only", adminToken, gin.H{
+		"enabled":    true,
+		"standbyUrl": "https://standby.example.com",
+	})
+	if status != http.StatusOK {
+		t.Fatalf("enable: expected 200, got %d", status)
+	}
+	defer doJSON(t, http.MethodPut, "/api/admin/read-only", adminToken, gin.H{"enabled": false})
+
+	status, response := doJSON(t, http.MethodPost, "/api/boards", token, gin.H{"board": testBoardData()})
+	if status != http.StatusServiceUnavailable {
+		t.Fatalf("write: expected 503, got %d", status)
+	}
+	if response["standbyUrl"] != "https://standby.example.com" {
+		t.Fatalf("write: expected standbyUrl in response, got %v", response)
+	}
+
+	status, _ = doJSON(t, http.MethodGet, "/api/boards", token, nil)
+	if status != http.StatusOK {
+		t.Fatalf("read: expected 200, got %d", status)
+	}
+}
+
+func TestReadOnlyModeExemptions(t *testing.T) {
+	requireHarness(t)
+
+	_, adminToken := seedUser(t, models.RoleAdmin)
+	user, token := seedUser(t, "")
+	boardID := seedBoard(t, token)
+
+	doJSON(t, http.MethodPut, "/api/admin/read-only", adminToken, gin.H{"enabled": true})
+	defer libs.SetReadOnlyMode(false, "")
+
+	_, response := doJSON(t, http.MethodGet, "/api/admin/read-only", adminToken, nil)
+	if response["enabled"] != true {
+		t.Fatalf("status: expected enabled, got %v", response)
+	}
+
+	// Every write is refused with the reason, without a standby to point at
+	status, response := doJSON(t, http.MethodPut, "/api/boards/"+boardID, token, gin.H{"board": testBoardData()})
+	if status != http.StatusServiceUnavailable || !strings.Contains(response["error"].(string), "read-only") {
+		t.Fatalf("update: expected 503 with the reason, got %d (%v)", status, response)
+	}
+	if _, ok := response["standbyUrl"]; ok {
+		t.Fatalf("update: expected no standbyUrl, got %v", response)
+	}
+
+	// Users can still sign in, and admins can switch the mode back
+	status, _ = doJSON(t, http.MethodPost, "/auth/login", "", gin.H{"email": user.Email, "password": "testpassword123"})
+	if status != http.StatusOK {
+		t.Fatalf("login: expected 200, got %d", status)
+	}
+	status, _ = doJSON(t, http.MethodPut, "/api/admin/read-only", adminToken, gin.H{"enabled": false})
+	if status != http.StatusOK {
+		t.Fatalf("disable: expected 200, got %d", status)
+	}
+
+	status, _ = doJSON(t, http.MethodPut, "/api/boards/"+boardID, token, gin.H{"board": testBoardData()})
+	if status != http.StatusOK {
+		t.Fatalf("update after disabling: expected 200, got %d", status)
+	}
+}
+
+func TestRequestLoggingToggle(t *testing.T) {
+	requireHarness(t)
+
+	_, adminToken := seedUser(t, models.RoleAdmin)
+
+	status, response := doJSON(t, http.MethodPut, "/api/admin/request-logging", adminToken, gin.H{
+		"route":   "POST /auth/login",
+		"enabled": true,
+	})
+	if status != http.StatusOK {
+		t.Fatalf("enable: expected 200, got %d", status)
+	}
+	if routes := response["routes"].([]interface{}); len(routes) != 1 || routes[0] != "POST /auth/login" {
+		t.Fatalf("enable: unexpected routes %v", routes)
+	}
+
+	doJSON(t, http.MethodPut, "/api/admin/request-logging", adminToken, gin.H{
+		"route":   "POST /auth/login",
+		"enabled": false,
+	})
+	_, response = doJSON(t, http.MethodGet, "/api/admin/request-logging", adminToken, nil)
+	if routes := response["routes"].([]interface{}); len(routes) != 0 {
+		t.Fatalf("disable: expected no routes, got %v", routes)
+	}
+}
+
+func TestAuditEventExport(t *testing.T) {
+	requireHarness(t)
+
+	original := libs.AuditSettleDelay
+	libs.AuditSettleDelay = 0
+	defer func() { libs.AuditSettleDelay = original }()
+
+	since := time.Now().Add(-time.Second).UTC().Format(time.RFC3339)
+	_, adminToken := seedUser(t, models.RoleAdmin)
+	owner, ownerToken := seedUser(t, "")
+	boardID := seedBoard(t, ownerToken)
+	doJSON(t, http.MethodPost, "/auth/login", "", gin.H{"email": owner.Email, "password": "wrong-password"})
+	doJSON(t, http.MethodDelete, "/api/boards/"+boardID, ownerToken, nil)
+
+	status, _ := doJSON(t, http.MethodGet, "/api/admin/audit-events", ownerToken, nil)
+	if status != http.StatusForbidden {
+		t.Fatalf("non-admin export: expected 403, got %d", status)
+	}
+
+	status, response := doJSON(t, http.MethodGet, "/api/admin/audit-events?since="+url.QueryEscape(since), adminToken, nil)
+	if status != http.StatusOK || response["schemaVersion"].(float64) != models.AuditSchemaVersion {
+		t.Fatalf("export: expected 200 with schema version, got %d (%v)", status, response)
+	}
+
+	// Other tests record events too; look for this test's
+	found := map[string]bool{}
+	for _, item := range response["events"].([]interface{}) {
+		event := item.(map[string]interface{})
+		actor := event["actor"].(map[string]interface{})
+		if actor["id"] != owner.ID.Hex() {
+			continue
+		}
+		found[event["action"].(string)] = true
+		if event["action"] == models.AuditLoginFailed && event["outcome"] != models.AuditOutcomeFailure {
+			t.Fatalf("failed login: expected outcome failure, got %v", event)
+		}
+		if event["action"] == models.AuditBoardDeleted && event["target"].(map[string]interface{})["id"] != boardID {
+			t.Fatalf("board deleted: unexpected target %v", event)
+		}
+	}
+	for _, action := range []string{models.AuditBoardCreated, models.AuditLoginFailed, models.AuditBoardDeleted} {
+		if !found[action] {
+			t.Fatalf("export: missing %s event, got %v", action, found)
+		}
+	}
+
+	// Fetching from the cursor only returns newer events
+	cursor := response["nextCursor"].(string)
+	seedBoard(t, ownerToken)
+	_, response = doJSON(t, http.MethodGet, "/api/admin/audit-events?cursor="+cursor, adminToken, nil)
+	for _, item := range response["events"].([]interface{}) {
+		if item.(map[string]interface{})["id"].(string) <= cursor {
+			t.Fatalf("cursor: got an event at or before the cursor: %v", item)
+		}
+	}
+	if len(response["events"].([]interface{})) == 0 {
+		t.Fatalf("cursor: expected the new board.created event")
+	}
+}
+
+func TestBoardArchive(t *testing.T) {
+	requireHarness(t)
+
+	_, adminToken := seedUser(t, models.RoleAdmin)
+	_, token := seedUser(t, "")
+	boardID := seedBoard(t, token)
+	objectID, _ := primitive.ObjectIDFromHex(boardID)
+
+	_, before := doJSON(t, http.MethodGet, "/api/admin/board-archive", adminToken, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := libs.ArchiveBoard(ctx, objectID); err != nil {
+		t.Fatalf("archive: %v", err)
+	}
+
+	status, stats := doJSON(t, http.MethodGet, "/api/admin/board-archive", adminToken, nil)
+	if status != http.StatusOK {
+		t.Fatalf("stats: expected 200, got %d", status)
+	}
+	if stats["boards"].(float64) != before["boards"].(float64)+1 || stats["savedBytes"].(float64) <= before["savedBytes"].(float64) {
+		t.Fatalf("stats: expected one more archived board and savings, got %v (was %v)", stats, before)
+	}
+
+	// Still listed, and brought back on access
+	_, response := doJSON(t, http.MethodGet, "/api/boards", token, nil)
+	if boards := response["boards"].([]interface{}); len(boards) != 1 {
+		t.Fatalf("list: expected the archived board, got %v", boards)
+	}
+	status, response = doJSON(t, http.MethodGet, "/api/boards/"+boardID, token, nil)
+	if status != http.StatusOK {
+		t.Fatalf("get: expected 200, got %d", status)
+	}
+	shapes, _ := response["board"].(map[string]interface{})["shapes"].([]interface{})
+	if len(shapes) != 1 || shapes[0].(map[string]interface{})["id"] != "test-shape-1" {
+		t.Fatalf("get: expected the archived contents back, got %v", response["board"])
+	}
+
+	_, stats = doJSON(t, http.MethodGet, "/api/admin/board-archive", adminToken, nil)
+	if stats["boards"].(float64) != before["boards"].(float64) || stats["rehydratedSinceStart"].(float64) != before["rehydratedSinceStart"].(float64)+1 {
+		t.Fatalf("stats: expected the board rehydrated, got %v (was %v)", stats, before)
+	}
+}
+
+func TestStorageReportAndMaintenance(t *testing.T) {
+	requireHarness(t)
+
+	_, adminToken := seedUser(t, models.RoleAdmin)
+	_, token := seedUser(t, "")
+	boardID := seedBoard(t, token)
+
+	if status, _ := doJSON(t, http.MethodGet, "/api/admin/storage", token, nil); status != http.StatusForbidden {
+		t.Fatalf("member: expected 403, got %d", status)
+	}
+	if status, _ := doJSON(t, http.MethodGet, "/api/admin/storage?largest=0", adminToken, nil); status != http.StatusBadRequest {
+		t.Fatalf("largest=0: expected 400, got %d", status)
+	}
+	status, report := doJSON(t, http.MethodGet, "/api/admin/storage?largest=100", adminToken, nil)
+	if status != http.StatusOK {
+		t.Fatalf("report: expected 200, got %d (%v)", status, report)
+	}
+	found := false
+	for _, collection := range report["collections"].([]interface{}) {
+		if collection.(map[string]interface{})["name"] == "boards" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("report: expected the boards collection, got %v", report["collections"])
+	}
+	found = false
+	for _, board := range report["largestBoards"].([]interface{}) {
+		if board.(map[string]interface{})["id"] == boardID {
+			found = true
+		}
+	}
+	if !found && len(report["largestBoards"].([]interface{})) < 100 {
+		t.Fatalf("report: expected the seeded board among the largest, got %v", report["largestBoards"])
+	}
+
+	if status, _ := doJSON(t, http.MethodPost, "/api/admin/storage/maintenance", adminToken, gin.H{"operation": "defrag"}); status != http.StatusBadRequest {
+		t.Fatalf("unknown operation: expected 400, got %d", status)
+	}
+	if status, _ := doJSON(t, http.MethodPost, "/api/admin/storage/maintenance", adminToken, gin.H{"operation": models.StorageCompact, "collections": []string{"no_such_collection"}}); status != http.StatusBadRequest {
+		t.Fatalf("unknown collection: expected 400, got %d", status)
+	}
+
+	// Maintenance runs as a job the admin follows
+	status, job := doJSON(t, http.MethodPost, "/api/admin/storage/maintenance", adminToken, gin.H{"operation": models.StorageRecalculateUsage})
+	if status != http.StatusAccepted || job["kind"] != models.JobKindMaintenance {
+		t.Fatalf("recalculate: expected 202 with a maintenance job, got %d %v", status, job)
+	}
+	jobID := job["jobId"].(string)
+	deadline := time.Now().Add(30 * time.Second)
+	for job["status"] == models.JobPending && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+		_, job = doJSON(t, http.MethodGet, "/api/jobs/"+jobID, adminToken, nil)
+	}
+	if job["status"] != models.JobSucceeded {
+		t.Fatalf("recalculate job: expected success, got %v", job)
+	}
+	status, result := doJSON(t, http.MethodGet, "/api/jobs/"+jobID+"/result", adminToken, nil)
+	if status != http.StatusOK || result["boards"].(float64) < 1 {
+		t.Fatalf("recalculate result: expected the boards gone through, got %d %v", status, result)
+	}
+
+	// ... which took today's snapshot
+	_, report = doJSON(t, http.MethodGet, "/api/admin/storage", adminToken, nil)
+	history := report["history"].([]interface{})
+	if len(history) == 0 || history[len(history)-1].(map[string]interface{})["day"] != time.Now().UTC().Format(time.DateOnly) {
+		t.Fatalf("history: expected today's snapshot, got %v", history)
+	}
+}
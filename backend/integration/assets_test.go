@@ -0,0 +1,140 @@
+//go:build integration
+
+package integration
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/config"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+)
+
+// uploadAsset posts a file for the board as a multipart form
+func uploadAsset(t *testing.T, token, boardID, filename string, data []byte) (int, map[string]interface{}) {
+	t.Helper()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("boardId", boardID)
+	part, _ := form.CreateFormFile("file", filename)
+	part.Write(data)
+	form.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/assets", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	return w.Code, response
+}
+
+func getAsset(t *testing.T, token, assetID, etag string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/api/assets/"+assetID, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestBoardAssets(t *testing.T) {
+	requireHarness(t)
+
+	_, ownerToken := seedUser(t, "")
+	boardID := seedBoard(t, ownerToken)
+	viewer, viewerToken := seedUser(t, "")
+	_, strangerToken := seedUser(t, "")
+	doJSON(t, http.MethodPost, "/api/boards/"+boardID+"/share", ownerToken, gin.H{"email": viewer.Email, "role": "viewer"})
+
+	var picture bytes.Buffer
+	png.Encode(&picture, image.NewRGBA(image.Rect(0, 0, 40, 30)))
+
+	status, body := uploadAsset(t, ownerToken, boardID, "diagram.png", picture.Bytes())
+	if status != http.StatusCreated {
+		t.Fatalf("upload: expected 201, got %d: %v", status, body)
+	}
+	asset := body["asset"].(map[string]interface{})
+	if asset["contentType"] != "image/png" || asset["width"] != 40.0 || asset["height"] != 30.0 || asset["url"] == "" {
+		t.Fatalf("upload: unexpected asset %v", asset)
+	}
+	assetID := asset["id"].(string)
+
+	// Anyone who can see the board gets the image back
+	w := getAsset(t, viewerToken, assetID, "")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/png" || !bytes.Equal(w.Body.Bytes(), picture.Bytes()) {
+		t.Fatalf("viewer get: expected the PNG, got %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	if w.Header().Get("X-Content-Type-Options") != "nosniff" {
+		t.Fatalf("viewer get: expected nosniff, got %v", w.Header())
+	}
+	if w := getAsset(t, viewerToken, assetID, w.Header().Get("ETag")); w.Code != http.StatusNotModified {
+		t.Fatalf("revalidation: expected 304, got %d", w.Code)
+	}
+	if w := getAsset(t, strangerToken, assetID, ""); w.Code != http.StatusNotFound {
+		t.Fatalf("stranger get: expected 404, got %d", w.Code)
+	}
+
+	// Viewers and strangers can't upload
+	if status, _ := uploadAsset(t, viewerToken, boardID, "x.png", picture.Bytes()); status != http.StatusForbidden {
+		t.Fatalf("viewer upload: expected 403, got %d", status)
+	}
+	if status, _ := uploadAsset(t, strangerToken, boardID, "x.png", picture.Bytes()); status != http.StatusNotFound {
+		t.Fatalf("stranger upload: expected 404, got %d", status)
+	}
+
+	// Only images, checked by content rather than name
+	if status, _ := uploadAsset(t, ownerToken, boardID, "evil.png", []byte("<svg xmlns=\"http://www.w3.org/2000/svg\"><script>alert(1)</script></svg>")); status != http.StatusUnsupportedMediaType {
+		t.Fatalf("svg upload: expected 415, got %d", status)
+	}
+	if status, _ := uploadAsset(t, ownerToken, boardID, "broken.png", picture.Bytes()[:20]); status != http.StatusBadRequest {
+		t.Fatalf("truncated upload: expected 400, got %d", status)
+	}
+	defer func(size int64) { libs.Settings().AssetMaxSize = size }(libs.Settings().AssetMaxSize)
+	libs.Settings().AssetMaxSize = 64
+	if status, _ := uploadAsset(t, ownerToken, boardID, "diagram.png", picture.Bytes()); status != http.StatusRequestEntityTooLarge {
+		t.Fatalf("oversized upload: expected 413, got %d", status)
+	}
+
+	// Assets count against the owner's storage quota
+	libs.Settings().AssetMaxSize = config.DefaultAssetMaxSize
+	libs.Settings().StorageLimitBytes = 1
+	if status, _ := uploadAsset(t, ownerToken, boardID, "diagram.png", picture.Bytes()); status != http.StatusForbidden {
+		t.Fatalf("over quota: expected 403, got %d", status)
+	}
+	libs.Settings().StorageLimitBytes = 0
+
+	if status, _ := doJSON(t, http.MethodDelete, "/api/assets/"+assetID, viewerToken, nil); status != http.StatusForbidden {
+		t.Fatalf("viewer delete: expected 403, got %d", status)
+	}
+	if status, _ := doJSON(t, http.MethodDelete, "/api/assets/"+assetID, ownerToken, nil); status != http.StatusOK {
+		t.Fatalf("delete: expected 200, got %d", status)
+	}
+	if w := getAsset(t, ownerToken, assetID, ""); w.Code != http.StatusNotFound {
+		t.Fatalf("after delete: expected 404, got %d", w.Code)
+	}
+
+	// Deleting the board takes its assets with it
+	status, body = uploadAsset(t, ownerToken, boardID, "diagram.png", picture.Bytes())
+	if status != http.StatusCreated {
+		t.Fatalf("second upload: expected 201, got %d: %v", status, body)
+	}
+	assetID = body["asset"].(map[string]interface{})["id"].(string)
+	doJSON(t, http.MethodDelete, "/api/boards/"+boardID, ownerToken, nil)
+	if w := getAsset(t, ownerToken, assetID, ""); w.Code != http.StatusNotFound {
+		t.Fatalf("after board delete: expected 404, got %d", w.Code)
+	}
+}
@@ -0,0 +1,856 @@
+//go:build integration
+
+package integration
+
+import (
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/config"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/repository"
+	"github.com/sarwanazhar/boardsar/backend/routes"
+)
+
+func TestRegisterAndLogin(t *testing.T) {
+	requireHarness(t)
+
+	email := uniqueEmail(t)
+
+	status, response := doJSON(t, http.MethodPost, "/auth/register", "", gin.H{
+		"email":    email,
+		"password": "testpassword123",
+	})
+	if status != http.StatusCreated {
+		t.Fatalf("register: expected 201, got %d (%v)", status, response)
+	}
+
+	status, _ = doJSON(t, http.MethodPost, "/auth/register", "", gin.H{
+		"email":    email,
+		"password": "testpassword123",
+	})
+	if status != http.StatusConflict {
+		t.Fatalf("duplicate register: expected 409, got %d", status)
+	}
+
+	status, response = doJSON(t, http.MethodPost, "/auth/login", "", gin.H{
+		"email":    email,
+		"password": "testpassword123",
+	})
+	if status != http.StatusOK {
+		t.Fatalf("login: expected 200, got %d (%v)", status, response)
+	}
+	token, _ := response["token"].(string)
+	if token == "" {
+		t.Fatalf("login: response has no token: %v", response)
+	}
+
+	status, response = doJSON(t, http.MethodGet, "/me", token, nil)
+	if status != http.StatusOK {
+		t.Fatalf("profile: expected 200, got %d", status)
+	}
+	if response["email"] != email {
+		t.Fatalf("profile: expected email %s, got %v", email, response["email"])
+	}
+}
+
+func TestRegisterValidation(t *testing.T) {
+	requireHarness(t)
+
+	cases := []struct {
+		name string
+		body gin.H
+	}{
+		{"invalid email", gin.H{"email": "not-an-email", "password": "testpassword123"}},
+		{"weak password", gin.H{"email": uniqueEmail(t), "password": "123"}},
+		{"unsupported locale", gin.H{"email": uniqueEmail(t), "password": "testpassword123", "locale": "xx"}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			status, _ := doJSON(t, http.MethodPost, "/auth/register", "", tc.body)
+			if status != http.StatusBadRequest {
+				t.Fatalf("expected 400, got %d", status)
+			}
+		})
+	}
+}
+
+func TestLoginWrongPassword(t *testing.T) {
+	requireHarness(t)
+
+	user, _ := seedUser(t, "")
+
+	status, _ := doJSON(t, http.MethodPost, "/auth/login", "", gin.H{
+		"email":    user.Email,
+		"password": "wrongpassword",
+	})
+	if status != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %d", status)
+	}
+}
+
+func TestProfileRequiresToken(t *testing.T) {
+	requireHarness(t)
+
+	for _, token := range []string{"", "invalid.token.here"} {
+		status, response := doJSON(t, http.MethodGet, "/me", token, nil)
+		if status != http.StatusUnauthorized {
+			t.Fatalf("token %q: expected 401, got %d", token, status)
+		}
+		if _, ok := response["error"]; !ok {
+			t.Fatalf("token %q: expected error in response", token)
+		}
+	}
+}
+
+func TestUpdateLocale(t *testing.T) {
+	requireHarness(t)
+
+	_, token := seedUser(t, "")
+
+	status, _ := doJSON(t, http.MethodPut, "/me/locale", token, gin.H{"locale": "es-MX"})
+	if status != http.StatusOK {
+		t.Fatalf("expected 200, got %d", status)
+	}
+
+	_, response := doJSON(t, http.MethodGet, "/me", token, nil)
+	if response["locale"] != "es" {
+		t.Fatalf("expected locale es, got %v", response["locale"])
+	}
+}
+
+func TestLocalizedEmails(t *testing.T) {
+	requireHarness(t)
+
+	// A catalog dropped into LOCALES_DIR adds a locale without a rebuild
+	dir := t.TempDir()
+	catalog := `{"password_reset.subject": "Setze dein BoardSar-Passwort zurück"}`
+	if err := os.WriteFile(filepath.Join(dir, "de.json"), []byte(catalog), 0o644); err != nil {
+		t.Fatalf("failed to write catalog: %v", err)
+	}
+	if err := libs.LoadTranslations(dir); err != nil {
+		t.Fatalf("failed to load translations: %v", err)
+	}
+	defer libs.LoadTranslations("")
+
+	var sentSubject, sentBody string
+	original := libs.SendEmail
+	libs.SendEmail = func(to, subject, body string) error {
+		sentSubject, sentBody = subject, body
+		return nil
+	}
+	defer func() { libs.SendEmail = original }()
+
+	for _, test := range []struct {
+		locale, subject, body string
+	}{
+		{"es", "Restablece tu contraseña de BoardSar", "Recibimos una solicitud"},
+		// Keys the catalog doesn't have fall back to English
+		{"de-AT", "Setze dein BoardSar-Passwort zurück", "We received a request"},
+	} {
+		user, token := seedUser(t, "")
+		if status, response := doJSON(t, http.MethodPut, "/me/locale", token, gin.H{"locale": test.locale}); status != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d (%v)", test.locale, status, response)
+		}
+
+		doJSON(t, http.MethodPost, "/auth/forgot-password", "", gin.H{"email": user.Email})
+		if sentSubject != test.subject || !strings.Contains(sentBody, test.body) {
+			t.Fatalf("%s: expected %q with %q, got %q: %s", test.locale, test.subject, test.body, sentSubject, sentBody)
+		}
+	}
+}
+
+func TestRefreshRotationAndLogout(t *testing.T) {
+	requireHarness(t)
+
+	user, _ := seedUser(t, "")
+	_, response := doJSON(t, http.MethodPost, "/auth/login", "", gin.H{
+		"email":    user.Email,
+		"password": "testpassword123",
+	})
+	refreshToken, _ := response["refreshToken"].(string)
+	if refreshToken == "" || response["expiresIn"] == nil {
+		t.Fatalf("login: expected refreshToken and expiresIn, got %v", response)
+	}
+
+	status, response := doJSON(t, http.MethodPost, "/auth/refresh", "", gin.H{"refreshToken": refreshToken})
+	if status != http.StatusOK {
+		t.Fatalf("refresh: expected 200, got %d (%v)", status, response)
+	}
+	rotated := response["refreshToken"].(string)
+	if rotated == refreshToken {
+		t.Fatalf("refresh: expected a rotated refresh token")
+	}
+	if status, _ := doJSON(t, http.MethodGet, "/me", response["token"].(string), nil); status != http.StatusOK {
+		t.Fatalf("refreshed token: expected 200, got %d", status)
+	}
+
+	// Replaying the old token revokes the rotated one too
+	status, _ = doJSON(t, http.MethodPost, "/auth/refresh", "", gin.H{"refreshToken": refreshToken})
+	if status != http.StatusUnauthorized {
+		t.Fatalf("replay: expected 401, got %d", status)
+	}
+	status, _ = doJSON(t, http.MethodPost, "/auth/refresh", "", gin.H{"refreshToken": rotated})
+	if status != http.StatusUnauthorized {
+		t.Fatalf("after replay: expected 401, got %d", status)
+	}
+
+	// Logout revokes the refresh token
+	_, response = doJSON(t, http.MethodPost, "/auth/login", "", gin.H{
+		"email":    user.Email,
+		"password": "testpassword123",
+	})
+	refreshToken = response["refreshToken"].(string)
+	if status, _ := doJSON(t, http.MethodPost, "/auth/logout", "", gin.H{"refreshToken": refreshToken}); status != http.StatusOK {
+		t.Fatalf("logout: expected 200, got %d", status)
+	}
+	status, _ = doJSON(t, http.MethodPost, "/auth/refresh", "", gin.H{"refreshToken": refreshToken})
+	if status != http.StatusUnauthorized {
+		t.Fatalf("refresh after logout: expected 401, got %d", status)
+	}
+}
+
+func TestSessions(t *testing.T) {
+	requireHarness(t)
+
+	user, _ := seedUser(t, "")
+	login := func() (string, string) {
+		_, response := doJSON(t, http.MethodPost, "/auth/login", "", gin.H{
+			"email":    user.Email,
+			"password": "testpassword123",
+		})
+		return response["token"].(string), response["refreshToken"].(string)
+	}
+	token, _ := login()
+	otherToken, otherRefresh := login()
+
+	status, response := doJSON(t, http.MethodGet, "/auth/sessions", token, nil)
+	if status != http.StatusOK {
+		t.Fatalf("list: expected 200, got %d (%v)", status, response)
+	}
+	sessions := response["sessions"].([]interface{})
+	if len(sessions) != 2 {
+		t.Fatalf("list: expected 2 sessions, got %v", sessions)
+	}
+	var otherID string
+	for _, session := range sessions {
+		session := session.(map[string]interface{})
+		if session["current"] != true {
+			otherID = session["id"].(string)
+		}
+	}
+	if otherID == "" {
+		t.Fatalf("list: expected one session marked current, got %v", sessions)
+	}
+
+	// Revoking a session signs that device out at once
+	if status, _ := doJSON(t, http.MethodDelete, "/auth/sessions/"+otherID, token, nil); status != http.StatusOK {
+		t.Fatalf("revoke: expected 200, got %d", status)
+	}
+	if status, _ := doJSON(t, http.MethodGet, "/me", otherToken, nil); status != http.StatusUnauthorized {
+		t.Fatalf("revoked session's token: expected 401, got %d", status)
+	}
+	if status, _ := doJSON(t, http.MethodPost, "/auth/refresh", "", gin.H{"refreshToken": otherRefresh}); status != http.StatusUnauthorized {
+		t.Fatalf("revoked session's refresh: expected 401, got %d", status)
+	}
+	if status, _ := doJSON(t, http.MethodDelete, "/auth/sessions/"+otherID, token, nil); status != http.StatusNotFound {
+		t.Fatalf("revoke again: expected 404, got %d", status)
+	}
+	if status, _ := doJSON(t, http.MethodGet, "/me", token, nil); status != http.StatusOK {
+		t.Fatalf("current session: expected 200, got %d", status)
+	}
+
+	// Logging out ends the session too
+	token, refreshToken := login()
+	doJSON(t, http.MethodPost, "/auth/logout", "", gin.H{"refreshToken": refreshToken})
+	if status, _ := doJSON(t, http.MethodGet, "/me", token, nil); status != http.StatusUnauthorized {
+		t.Fatalf("after logout: expected 401, got %d", status)
+	}
+}
+
+func TestTwoFactor(t *testing.T) {
+	requireHarness(t)
+
+	user, token := seedUser(t, "")
+	login := func() map[string]interface{} {
+		status, response := doJSON(t, http.MethodPost, "/auth/login", "", gin.H{
+			"email":    user.Email,
+			"password": "testpassword123",
+		})
+		if status != http.StatusOK {
+			t.Fatalf("login: expected 200, got %d (%v)", status, response)
+		}
+		return response
+	}
+
+	status, response := doJSON(t, http.MethodPost, "/auth/2fa/setup", token, nil)
+	if status != http.StatusOK {
+		t.Fatalf("setup: expected 200, got %d (%v)", status, response)
+	}
+	secret := response["secret"].(string)
+	if !strings.HasPrefix(response["otpauthUrl"].(string), "otpauth://totp/") {
+		t.Fatalf("setup: unexpected otpauthUrl %v", response["otpauthUrl"])
+	}
+
+	if status, _ := doJSON(t, http.MethodPost, "/auth/2fa/enable", token, gin.H{"code": "not-a-code"}); status != http.StatusBadRequest {
+		t.Fatalf("enable with a wrong code: expected 400, got %d", status)
+	}
+	code, err := libs.TOTPCode(secret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, response = doJSON(t, http.MethodPost, "/auth/2fa/enable", token, gin.H{"code": code})
+	if status != http.StatusOK {
+		t.Fatalf("enable: expected 200, got %d (%v)", status, response)
+	}
+	recoveryCodes := response["recoveryCodes"].([]interface{})
+	if len(recoveryCodes) != 10 {
+		t.Fatalf("enable: expected 10 recovery codes, got %v", recoveryCodes)
+	}
+
+	// The password alone no longer signs in
+	response = login()
+	if response["twoFactorRequired"] != true || response["token"] != nil {
+		t.Fatalf("login: expected a two-factor challenge, got %v", response)
+	}
+	challenge := response["twoFactorToken"].(string)
+	if status, _ := doJSON(t, http.MethodPost, "/auth/2fa/verify", "", gin.H{"token": challenge, "code": "not-a-code"}); status != http.StatusUnauthorized {
+		t.Fatalf("verify with a wrong code: expected 401, got %d", status)
+	}
+	// The code used to enable can't be used again, so take the next one
+	code, _ = libs.TOTPCode(secret, time.Now().Add(30*time.Second))
+	status, response = doJSON(t, http.MethodPost, "/auth/2fa/verify", "", gin.H{"token": challenge, "code": code})
+	if status != http.StatusOK || response["token"] == nil {
+		t.Fatalf("verify: expected 200 with a token, got %d (%v)", status, response)
+	}
+	if status, _ := doJSON(t, http.MethodPost, "/auth/2fa/verify", "", gin.H{"token": challenge, "code": code}); status != http.StatusUnauthorized {
+		t.Fatalf("verify the same challenge again: expected 401, got %d", status)
+	}
+
+	// Recovery codes work once
+	recoveryCode := recoveryCodes[0].(string)
+	challenge = login()["twoFactorToken"].(string)
+	if status, _ := doJSON(t, http.MethodPost, "/auth/2fa/verify", "", gin.H{"token": challenge, "code": recoveryCode}); status != http.StatusOK {
+		t.Fatalf("verify with a recovery code: expected 200, got %d", status)
+	}
+	challenge = login()["twoFactorToken"].(string)
+	if status, _ := doJSON(t, http.MethodPost, "/auth/2fa/verify", "", gin.H{"token": challenge, "code": recoveryCode}); status != http.StatusUnauthorized {
+		t.Fatalf("verify with a used recovery code: expected 401, got %d", status)
+	}
+
+	status, response = doJSON(t, http.MethodGet, "/auth/2fa", token, nil)
+	if status != http.StatusOK || response["enabled"] != true || response["recoveryCodesLeft"] != float64(9) {
+		t.Fatalf("status: expected enabled with 9 recovery codes left, got %d (%v)", status, response)
+	}
+
+	status, response = doJSON(t, http.MethodPost, "/auth/2fa/disable", token, gin.H{"code": recoveryCodes[1]})
+	if status != http.StatusOK {
+		t.Fatalf("disable: expected 200, got %d (%v)", status, response)
+	}
+	if response := login(); response["token"] == nil {
+		t.Fatalf("login after disabling: expected a token, got %v", response)
+	}
+}
+
+func TestPasswordReset(t *testing.T) {
+	requireHarness(t)
+
+	var sentTo, sentBody string
+	original := libs.SendEmail
+	libs.SendEmail = func(to, subject, body string) error {
+		sentTo, sentBody = to, body
+		return nil
+	}
+	defer func() { libs.SendEmail = original }()
+
+	// Unknown emails get the same answer and no email
+	status, _ := doJSON(t, http.MethodPost, "/auth/forgot-password", "", gin.H{"email": uniqueEmail(t)})
+	if status != http.StatusOK || sentTo != "" {
+		t.Fatalf("unknown email: expected 200 and no email, got %d (sent to %q)", status, sentTo)
+	}
+
+	user, _ := seedUser(t, "")
+	status, _ = doJSON(t, http.MethodPost, "/auth/forgot-password", "", gin.H{"email": user.Email})
+	if status != http.StatusOK || sentTo != user.Email {
+		t.Fatalf("forgot: expected 200 and an email to %s, got %d (sent to %q)", user.Email, status, sentTo)
+	}
+
+	_, after, found := strings.Cut(sentBody, "token=")
+	if !found {
+		t.Fatalf("forgot: email has no reset link: %s", sentBody)
+	}
+	token := strings.Fields(after)[0]
+
+	status, _ = doJSON(t, http.MethodPost, "/auth/reset-password", "", gin.H{"token": token, "password": "newpassword456"})
+	if status != http.StatusOK {
+		t.Fatalf("reset: expected 200, got %d", status)
+	}
+
+	status, _ = doJSON(t, http.MethodPost, "/auth/login", "", gin.H{"email": user.Email, "password": "newpassword456"})
+	if status != http.StatusOK {
+		t.Fatalf("login with new password: expected 200, got %d", status)
+	}
+
+	status, _ = doJSON(t, http.MethodPost, "/auth/reset-password", "", gin.H{"token": token, "password": "anotherpassword"})
+	if status != http.StatusBadRequest {
+		t.Fatalf("reused token: expected 400, got %d", status)
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	requireHarness(t)
+
+	user, oldToken := seedUser(t, "")
+	status, response := doJSON(t, http.MethodPost, "/auth/login", "", gin.H{"email": user.Email, "password": "testpassword123"})
+	if status != http.StatusOK {
+		t.Fatalf("login: expected 200, got %d", status)
+	}
+	oldRefresh := response["refreshToken"].(string)
+
+	status, _ = doJSON(t, http.MethodPost, "/auth/change-password", oldToken, gin.H{"currentPassword": "wrong", "newPassword": "newpassword456"})
+	if status != http.StatusUnauthorized {
+		t.Fatalf("wrong current password: expected 401, got %d", status)
+	}
+	status, response = doJSON(t, http.MethodPost, "/auth/change-password", oldToken, gin.H{"currentPassword": "testpassword123", "newPassword": "newpassword456"})
+	if status != http.StatusOK {
+		t.Fatalf("change: expected 200, got %d (%v)", status, response)
+	}
+	newToken := response["token"].(string)
+
+	// Everything issued before is refused; the new session works
+	if status, _ := doJSON(t, http.MethodGet, "/me", oldToken, nil); status != http.StatusUnauthorized {
+		t.Fatalf("old access token: expected 401, got %d", status)
+	}
+	if status, _ := doJSON(t, http.MethodPost, "/auth/refresh", "", gin.H{"refreshToken": oldRefresh}); status != http.StatusUnauthorized {
+		t.Fatalf("old refresh token: expected 401, got %d", status)
+	}
+	if status, _ := doJSON(t, http.MethodGet, "/me", newToken, nil); status != http.StatusOK {
+		t.Fatalf("new access token: expected 200, got %d", status)
+	}
+	if status, _ := doJSON(t, http.MethodPost, "/auth/refresh", "", gin.H{"refreshToken": response["refreshToken"]}); status != http.StatusOK {
+		t.Fatalf("new refresh token: expected 200, got %d", status)
+	}
+
+	if status, _ := doJSON(t, http.MethodPost, "/auth/login", "", gin.H{"email": user.Email, "password": "testpassword123"}); status != http.StatusUnauthorized {
+		t.Fatalf("login with old password: expected 401, got %d", status)
+	}
+	if status, _ := doJSON(t, http.MethodPost, "/auth/login", "", gin.H{"email": user.Email, "password": "newpassword456"}); status != http.StatusOK {
+		t.Fatalf("login with new password: expected 200, got %d", status)
+	}
+}
+
+func TestChangeEmail(t *testing.T) {
+	requireHarness(t)
+
+	sent := map[string]string{}
+	original := libs.SendEmail
+	libs.SendEmail = func(to, subject, body string) error {
+		sent[to] = body
+		return nil
+	}
+	defer func() { libs.SendEmail = original }()
+
+	user, token := seedUser(t, "")
+	other, _ := seedUser(t, "")
+	newEmail := "moved-" + user.ID.Hex() + "@example.com"
+
+	if status, _ := doJSON(t, http.MethodPost, "/auth/change-email", token, gin.H{"newEmail": newEmail, "currentPassword": "wrong"}); status != http.StatusUnauthorized {
+		t.Fatalf("wrong password: expected 401, got %d", status)
+	}
+	if status, _ := doJSON(t, http.MethodPost, "/auth/change-email", token, gin.H{"newEmail": other.Email, "currentPassword": "testpassword123"}); status != http.StatusConflict {
+		t.Fatalf("taken address: expected 409, got %d", status)
+	}
+	status, response := doJSON(t, http.MethodPost, "/auth/change-email", token, gin.H{"newEmail": newEmail, "currentPassword": "testpassword123"})
+	if status != http.StatusAccepted {
+		t.Fatalf("change: expected 202, got %d (%v)", status, response)
+	}
+	_, after, found := strings.Cut(sent[newEmail], "token=")
+	if !found {
+		t.Fatalf("no confirmation link sent to the new address: %v", sent)
+	}
+	confirmation := strings.Fields(after)[0]
+
+	// The old address works until the change is confirmed
+	if status, _ := doJSON(t, http.MethodPost, "/auth/login", "", gin.H{"email": user.Email, "password": "testpassword123"}); status != http.StatusOK {
+		t.Fatalf("login before confirming: expected 200, got %d", status)
+	}
+
+	status, response = doJSON(t, http.MethodPost, "/auth/change-email/confirm", "", gin.H{"token": confirmation})
+	if status != http.StatusOK || response["email"] != newEmail {
+		t.Fatalf("confirm: expected 200 with the new email, got %d (%v)", status, response)
+	}
+	if _, ok := sent[user.Email]; !ok {
+		t.Fatal("confirm: expected a notice to the old address")
+	}
+	if status, _ := doJSON(t, http.MethodPost, "/auth/change-email/confirm", "", gin.H{"token": confirmation}); status != http.StatusBadRequest {
+		t.Fatalf("confirm twice: expected 400, got %d", status)
+	}
+
+	if status, _ := doJSON(t, http.MethodPost, "/auth/login", "", gin.H{"email": user.Email, "password": "testpassword123"}); status != http.StatusUnauthorized {
+		t.Fatalf("login with the old address: expected 401, got %d", status)
+	}
+	if status, _ := doJSON(t, http.MethodPost, "/auth/login", "", gin.H{"email": newEmail, "password": "testpassword123"}); status != http.StatusOK {
+		t.Fatalf("login with the new address: expected 200, got %d", status)
+	}
+}
+
+func TestMagicLinkLogin(t *testing.T) {
+	requireHarness(t)
+
+	var sentTo, sentBody string
+	original := libs.SendEmail
+	libs.SendEmail = func(to, subject, body string) error {
+		sentTo, sentBody = to, body
+		return nil
+	}
+	defer func() { libs.SendEmail = original }()
+
+	linkToken := func(t *testing.T) string {
+		t.Helper()
+		_, after, found := strings.Cut(sentBody, "token=")
+		if !found {
+			t.Fatalf("email has no sign-in link: %s", sentBody)
+		}
+		return strings.Fields(after)[0]
+	}
+
+	user, _ := seedUser(t, "")
+	status, _ := doJSON(t, http.MethodPost, "/auth/magic-link", "", gin.H{"email": user.Email})
+	if status != http.StatusOK || sentTo != user.Email {
+		t.Fatalf("request: expected 200 and an email to %s, got %d (sent to %q)", user.Email, status, sentTo)
+	}
+	token := linkToken(t)
+
+	status, body := doJSON(t, http.MethodPost, "/auth/magic-link/verify", "", gin.H{"token": token})
+	if status != http.StatusOK || body["token"] == nil {
+		t.Fatalf("verify: expected 200 with a token, got %d: %v", status, body)
+	}
+	if got := body["user"].(map[string]interface{})["id"]; got != user.ID.Hex() {
+		t.Fatalf("verify: signed in as %v, expected %s", got, user.ID.Hex())
+	}
+
+	status, _ = doJSON(t, http.MethodPost, "/auth/magic-link/verify", "", gin.H{"token": token})
+	if status != http.StatusBadRequest {
+		t.Fatalf("reused link: expected 400, got %d", status)
+	}
+
+	// Opening the emailed link, as mail scanners do, doesn't use it up: it
+	// answers with a page whose button posts the token
+	doJSON(t, http.MethodPost, "/auth/magic-link", "", gin.H{"email": user.Email})
+	token = linkToken(t)
+	var page magicLinkPage
+	for i := 0; i < 2; i++ {
+		page = openMagicLink(t, router, "/auth/magic-link/verify?token="+url.QueryEscape(token))
+		if page.token != token {
+			t.Fatalf("open link: expected the page to post the token, got %q", page.token)
+		}
+	}
+	location, cookies := postMagicLinkPage(router, page, page.confirmation)
+	if location.Path != "/oauth/callback" || location.Query().Get("provider") != "magic_link" || location.Query().Get("error") != "" {
+		t.Fatalf("confirm: expected the frontend callback, got %s", location)
+	}
+	if !slices.ContainsFunc(cookies, func(cookie *http.Cookie) bool { return cookie.Name == "refresh_token" && cookie.Value != "" }) {
+		t.Fatalf("confirm: expected a refresh cookie, got %v", cookies)
+	}
+	if location, _ := postMagicLinkPage(router, page, page.confirmation); location.Query().Get("error") != libs.ErrInvalidMagicLink.Error() {
+		t.Fatalf("confirm twice: expected an error, got %s", location)
+	}
+
+	// Unregistered emails get nothing unless signup is allowed
+	sentTo = ""
+	email := uniqueEmail(t)
+	status, _ = doJSON(t, http.MethodPost, "/auth/magic-link", "", gin.H{"email": email})
+	if status != http.StatusOK || sentTo != "" {
+		t.Fatalf("unknown email: expected 200 and no email, got %d (sent to %q)", status, sentTo)
+	}
+
+	defer func() { libs.Settings().MagicLinkSignup = false }()
+	libs.Settings().MagicLinkSignup = true
+	status, _ = doJSON(t, http.MethodPost, "/auth/magic-link", "", gin.H{"email": email, "locale": "es"})
+	if status != http.StatusOK || sentTo != email {
+		t.Fatalf("signup: expected 200 and an email to %s, got %d (sent to %q)", email, status, sentTo)
+	}
+
+	status, body = doJSON(t, http.MethodPost, "/auth/magic-link/verify", "", gin.H{"token": linkToken(t)})
+	if status != http.StatusOK {
+		t.Fatalf("signup verify: expected 200, got %d: %v", status, body)
+	}
+	created := body["user"].(map[string]interface{})
+	if created["email"] != email || created["locale"] != "es" {
+		t.Fatalf("signup verify: unexpected user %v", created)
+	}
+}
+
+func TestProviderSignIn(t *testing.T) {
+	requireHarness(t)
+
+	// redirect sends a request and returns where it redirects to
+	redirect := func(t *testing.T, method, path string) *url.URL {
+		t.Helper()
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		location, err := url.Parse(w.Header().Get("Location"))
+		if w.Code < 300 || w.Code >= 400 || err != nil {
+			t.Fatalf("%s %s: expected a redirect, got %d to %q", method, path, w.Code, w.Header().Get("Location"))
+		}
+		return location
+	}
+
+	_, token := seedUser(t, "")
+
+	status, _ := doJSON(t, http.MethodGet, "/auth/oauth/github", "", nil)
+	if status != http.StatusNotFound {
+		t.Fatalf("unconfigured provider: expected 404, got %d", status)
+	}
+
+	defer func(id, secret string) {
+		libs.Settings().GitHubClientID, libs.Settings().GitHubClientSecret = id, secret
+	}(libs.Settings().GitHubClientID, libs.Settings().GitHubClientSecret)
+	libs.Settings().GitHubClientID = "test-client"
+	libs.Settings().GitHubClientSecret = "test-secret"
+
+	status, body := doJSON(t, http.MethodGet, "/me/identities", token, nil)
+	if status != http.StatusOK {
+		t.Fatalf("identities: expected 200, got %d", status)
+	}
+	if identities := body["identities"].([]interface{}); len(identities) != 0 {
+		t.Fatalf("identities: expected none linked, got %v", identities)
+	}
+	if providers := body["providers"].([]interface{}); len(providers) != 1 || providers[0] != "github" {
+		t.Fatalf("identities: expected github to be offered, got %v", providers)
+	}
+
+	location := redirect(t, http.MethodGet, "/auth/oauth/github")
+	state := location.Query().Get("state")
+	if location.Host != "github.com" || state == "" || location.Query().Get("client_id") != "test-client" {
+		t.Fatalf("start: unexpected redirect %s", location)
+	}
+
+	// A forged state is rejected before talking to the provider
+	location = redirect(t, http.MethodPost, "/auth/oauth/github/callback?state=forged&code=abc")
+	if location.Path != "/oauth/callback" || location.Query().Get("error") == "" {
+		t.Fatalf("forged state: expected an error on the frontend, got %s", location)
+	}
+
+	// Each state is used once, even when the sign-in fails
+	location = redirect(t, http.MethodGet, "/auth/oauth/github/callback?state="+url.QueryEscape(state))
+	if location.Query().Get("error") == "" {
+		t.Fatalf("missing code: expected an error, got %s", location)
+	}
+	location = redirect(t, http.MethodGet, "/auth/oauth/github/callback?state="+url.QueryEscape(state)+"&code=abc")
+	if !strings.Contains(location.Query().Get("error"), "expired") {
+		t.Fatalf("reused state: expected an expired error, got %s", location)
+	}
+
+	status, body = doJSON(t, http.MethodPost, "/me/identities/github", token, nil)
+	if status != http.StatusOK || !strings.HasPrefix(body["url"].(string), "https://github.com/") {
+		t.Fatalf("link: expected a GitHub URL, got %d: %v", status, body)
+	}
+
+	status, _ = doJSON(t, http.MethodDelete, "/me/identities/github", token, nil)
+	if status != http.StatusNotFound {
+		t.Fatalf("unlink unlinked provider: expected 404, got %d", status)
+	}
+}
+
+func TestRateLimits(t *testing.T) {
+	requireHarness(t)
+	defer func(auth, boards libs.RateLimit) {
+		libs.Settings().AuthRateLimit, libs.Settings().BoardRateLimit = auth, boards
+	}(libs.Settings().AuthRateLimit, libs.Settings().BoardRateLimit)
+	libs.Settings().AuthRateLimit = libs.RateLimit{Requests: 2, Period: time.Minute}
+	libs.Settings().BoardRateLimit = libs.RateLimit{Requests: 2, Period: time.Minute}
+
+	login := func(ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/auth/login", strings.NewReader(`{"email": "nobody@example.com", "password": "wrongpassword"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.RemoteAddr = ip + ":40000"
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Per IP on sign-in
+	for i := 0; i < 2; i++ {
+		if w := login("198.51.100.7"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("login %d: expected 401, got %d", i+1, w.Code)
+		}
+	}
+	w := login("198.51.100.7")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("third login: expected 429, got %d", w.Code)
+	}
+	if retryAfter := w.Header().Get("Retry-After"); retryAfter == "" || retryAfter == "0" {
+		t.Fatalf("third login: expected Retry-After, got %q", retryAfter)
+	}
+	if w := login("198.51.100.8"); w.Code != http.StatusUnauthorized {
+		t.Fatalf("other IP: expected 401, got %d", w.Code)
+	}
+
+	// Per user on boards
+	_, token := seedUser(t, "")
+	_, otherToken := seedUser(t, "")
+	for i := 0; i < 2; i++ {
+		if status, _ := doJSON(t, http.MethodGet, "/api/boards", token, nil); status != http.StatusOK {
+			t.Fatalf("list %d: expected 200, got %d", i+1, status)
+		}
+	}
+	if status, body := doJSON(t, http.MethodGet, "/api/boards", token, nil); status != http.StatusTooManyRequests || body["retryAfter"] == nil {
+		t.Fatalf("third list: expected 429 with retryAfter, got %d: %v", status, body)
+	}
+	if status, _ := doJSON(t, http.MethodGet, "/api/boards", otherToken, nil); status != http.StatusOK {
+		t.Fatalf("other user: expected 200, got %d", status)
+	}
+}
+
+// TestRateLimitClientIP checks that sign-in limits go by the connecting
+// address, taking X-Forwarded-For only from TRUSTED_PROXIES
+func TestRateLimitClientIP(t *testing.T) {
+	defer func(auth libs.RateLimit) { libs.Settings().AuthRateLimit = auth }(libs.Settings().AuthRateLimit)
+	libs.Settings().AuthRateLimit = libs.RateLimit{Requests: 2, Period: time.Minute}
+
+	// An empty registration is turned down before anything is looked up
+	register := func(router *gin.Engine, remoteIP, forwardedFor string) int {
+		req := httptest.NewRequest(http.MethodPost, "/auth/register", strings.NewReader(`{}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.RemoteAddr = remoteIP + ":40000"
+		if forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// Without trusted proxies, a made-up X-Forwarded-For is no new client
+	direct := routes.NewRouter(&config.Config{}, repository.NewMemoryBoards())
+	for i := 0; i < 2; i++ {
+		if code := register(direct, "203.0.113.10", ""); code != http.StatusBadRequest {
+			t.Fatalf("register %d: expected 400, got %d", i+1, code)
+		}
+	}
+	for _, spoofed := range []string{"", "198.51.100.21", "198.51.100.22, 203.0.113.10"} {
+		if code := register(direct, "203.0.113.10", spoofed); code != http.StatusTooManyRequests {
+			t.Fatalf("forwarded for %q: expected 429, got %d", spoofed, code)
+		}
+	}
+	if code := register(direct, "203.0.113.11", ""); code != http.StatusBadRequest {
+		t.Fatalf("other address: expected 400, got %d", code)
+	}
+
+	// Behind a trusted proxy, each client it forwards is limited on its own
+	proxied := routes.NewRouter(&config.Config{TrustedProxies: []string{"203.0.113.20"}}, repository.NewMemoryBoards())
+	for i := 0; i < 2; i++ {
+		register(proxied, "203.0.113.20", "198.51.100.30")
+	}
+	if code := register(proxied, "203.0.113.20", "198.51.100.30"); code != http.StatusTooManyRequests {
+		t.Fatalf("proxied client: expected 429, got %d", code)
+	}
+	if code := register(proxied, "203.0.113.20", "198.51.100.31"); code != http.StatusBadRequest {
+		t.Fatalf("other proxied client: expected 400, got %d", code)
+	}
+}
+
+// magicLinkPage is what the page an emailed sign-in link opens posts back
+type magicLinkPage struct {
+	body         string
+	token        string
+	confirmation string
+	cookie       *http.Cookie
+}
+
+// openMagicLink opens an emailed sign-in link, checking it answers with the
+// page rather than signing in
+func openMagicLink(t *testing.T, router http.Handler, path string) magicLinkPage {
+	t.Helper()
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("open link: expected a page, got %d (%s)", w.Code, w.Header().Get("Content-Type"))
+	}
+
+	page := magicLinkPage{body: w.Body.String()}
+	for _, cookie := range w.Result().Cookies() {
+		switch cookie.Name {
+		case "magic_link_confirmation":
+			page.cookie = cookie
+		case "refresh_token":
+			t.Fatalf("open link: expected no session, got %v", cookie)
+		}
+	}
+	field := func(name string) string {
+		match := regexp.MustCompile(`name="` + name + `" value="([^"]*)"`).FindStringSubmatch(page.body)
+		if match == nil {
+			t.Fatalf("open link: the page has no %s field: %s", name, page.body)
+		}
+		return html.UnescapeString(match[1])
+	}
+	page.token, page.confirmation = field("token"), field("confirmation")
+	if page.cookie == nil || page.cookie.Value != page.confirmation {
+		t.Fatalf("open link: expected a cookie holding the confirmation, got %v", page.cookie)
+	}
+	return page
+}
+
+// postMagicLinkPage submits the page's form with confirmation, returning
+// where it sends the browser and the cookies it sets
+func postMagicLinkPage(router http.Handler, page magicLinkPage, confirmation string) (*url.URL, []*http.Cookie) {
+	form := url.Values{"token": {page.token}, "confirmation": {confirmation}}
+	req := httptest.NewRequest(http.MethodPost, "/auth/magic-link/verify", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if page.cookie != nil {
+		req.AddCookie(page.cookie)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	location, _ := url.Parse(w.Header().Get("Location"))
+	if w.Code != http.StatusSeeOther {
+		location = &url.URL{}
+	}
+	return location, w.Result().Cookies()
+}
+
+// TestMagicLinkPage checks the page an emailed sign-in link opens, and
+// that only that page can post its token
+func TestMagicLinkPage(t *testing.T) {
+	if err := libs.LoadTranslations(""); err != nil {
+		t.Fatalf("failed to load translations: %v", err)
+	}
+	router := routes.NewRouter(&config.Config{}, repository.NewMemoryBoards())
+
+	page := openMagicLink(t, router, "/auth/magic-link/verify?locale=es&token=a%22b%3Cc")
+	if page.token != `a"b<c` || !strings.Contains(page.body, `lang="es"`) || !strings.Contains(page.body, "Iniciar sesión") {
+		t.Fatalf("page: expected it in Spanish with the token escaped, got %s", page.body)
+	}
+	if other := openMagicLink(t, router, "/auth/magic-link/verify?token=x"); other.confirmation == page.confirmation || !strings.Contains(other.body, "Sign in") {
+		t.Fatalf("page: expected a fresh confirmation in English, got %s", other.body)
+	}
+
+	// Another site's form has neither the cookie nor its value
+	forged := page
+	forged.cookie = nil
+	for name, attempt := range map[string]struct {
+		page         magicLinkPage
+		confirmation string
+	}{
+		"no cookie":          {forged, page.confirmation},
+		"wrong confirmation": {page, "forged"},
+		"no confirmation":    {page, ""},
+	} {
+		location, _ := postMagicLinkPage(router, attempt.page, attempt.confirmation)
+		if location.Path != "/oauth/callback" || location.Query().Get("error") != libs.ErrInvalidMagicLink.Error() {
+			t.Errorf("%s: expected the frontend callback with an error, got %s", name, location)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+//go:build integration
+
+package integration
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/sarwanazhar/boardsar/backend/config"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"github.com/sarwanazhar/boardsar/backend/realtime"
+)
+
+// largeBoardData returns a board with n rectangle shapes, roughly what a busy
+// workshop board looks like.
+func largeBoardData(n int) map[string]interface{} {
+	shapes := make([]interface{}, n)
+	for i := range shapes {
+		shapes[i] = map[string]interface{}{
+			"id":     fmt.Sprintf("shape-%d", i),
+			"type":   "rect",
+			"x":      i * 10,
+			"y":      i * 5,
+			"width":  120,
+			"height": 80,
+			"fill":   "#ffeb3b",
+		}
+	}
+
+	board := testBoardData()
+	board["shapes"] = shapes
+	return board
+}
+
+func BenchmarkUpdateBoard(b *testing.B) {
+	requireHarness(b)
+
+	for _, size := range []int{10, 1000, 10000} {
+		b.Run(fmt.Sprintf("shapes=%d", size), func(b *testing.B) {
+			_, token := seedUser(b, "")
+			boardID := seedBoard(b, token)
+			body := gin.H{"board": largeBoardData(size)}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				status, _ := doJSON(b, http.MethodPut, "/api/boards/"+boardID, token, body)
+				if status != http.StatusOK {
+					b.Fatalf("expected 200, got %d", status)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkGetBoard(b *testing.B) {
+	requireHarness(b)
+
+	_, token := seedUser(b, "")
+	boardID := seedBoard(b, token)
+	doJSON(b, http.MethodPut, "/api/boards/"+boardID, token, gin.H{"board": largeBoardData(1000)})
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		status, _ := doJSON(b, http.MethodGet, "/api/boards/"+boardID, token, nil)
+		if status != http.StatusOK {
+			b.Fatalf("expected 200, got %d", status)
+		}
+	}
+}
+
+func BenchmarkGetBoards(b *testing.B) {
+	requireHarness(b)
+
+	_, token := seedUser(b, "")
+	for i := 0; i < 50; i++ {
+		seedBoard(b, token)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		status, _ := doJSON(b, http.MethodGet, "/api/boards", token, nil)
+		if status != http.StatusOK {
+			b.Fatalf("expected 200, got %d", status)
+		}
+	}
+}
+
+// BenchmarkViewportShapes loads one viewport of a 50k-shape board: the
+// whole board for comparison, then just the shapes in view, scanned from
+// the board, queried from the shape index and searched in the in-memory
+// tree of a hot board
+func BenchmarkViewportShapes(b *testing.B) {
+	requireHarness(b)
+
+	const size = 50000
+	_, token := seedUser(b, "")
+	get := func(b *testing.B, path string) {
+		status, _ := doJSON(b, http.MethodGet, path, token, nil)
+		if status != http.StatusOK {
+			b.Fatalf("expected 200, got %d", status)
+		}
+	}
+	seedLargeBoard := func(b *testing.B) string {
+		boardID := seedBoard(b, token)
+		if status, _ := doJSON(b, http.MethodPut, "/api/boards/"+boardID, token, gin.H{"board": largeBoardData(size)}); status != http.StatusOK {
+			b.Fatalf("save: expected 200, got %d", status)
+		}
+		return boardID
+	}
+
+	b.Run("board", func(b *testing.B) {
+		boardID := seedLargeBoard(b)
+
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			get(b, "/api/boards/"+boardID)
+		}
+	})
+
+	for _, mode := range []struct {
+		name      string
+		threshold int
+		treeCache int
+	}{
+		{"scan", size + 1, 0},
+		{"index", config.DefaultShapeIndexThreshold, 0},
+		{"tree", config.DefaultShapeIndexThreshold, libs.ShapeTreeCacheShapes},
+	} {
+		b.Run(mode.name, func(b *testing.B) {
+			defer func(threshold int) { libs.Settings().ShapeIndexThreshold = threshold }(libs.Settings().ShapeIndexThreshold)
+			libs.Settings().ShapeIndexThreshold = mode.threshold
+			defer func(shapes int) { libs.ShapeTreeCacheShapes = shapes }(libs.ShapeTreeCacheShapes)
+			libs.ShapeTreeCacheShapes = mode.treeCache
+
+			// About 200 shapes in view. A few queries first, for the
+			// board to be indexed or turn hot.
+			viewport := "/api/boards/" + seedLargeBoard(b) + "/shapes?bbox=100000,50000,102000,51000"
+			for i := 0; i < 5; i++ {
+				get(b, viewport)
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				get(b, viewport)
+			}
+		})
+	}
+}
+
+// BenchmarkRealtimeBroadcast sends ops to a live 1000-shape board with more
+// and more clients connected: each op is applied by the hub and has reached
+// every other client before the next is sent
+func BenchmarkRealtimeBroadcast(b *testing.B) {
+	requireHarness(b)
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	for _, clients := range []int{2, 10, 50} {
+		b.Run(fmt.Sprintf("clients=%d", clients), func(b *testing.B) {
+			_, token := seedUser(b, "")
+			boardID := seedBoard(b, token)
+			if status, _ := doJSON(b, http.MethodPut, "/api/boards/"+boardID, token, gin.H{"board": largeBoardData(1000)}); status != http.StatusOK {
+				b.Fatalf("save: expected 200, got %d", status)
+			}
+
+			editor := dialBoard(b, server, boardID, token)
+			watchers := make([]*websocket.Conn, clients-1)
+			for i := range watchers {
+				watchers[i] = dialBoard(b, server, boardID, token)
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				editor.WriteJSON(realtime.Message{Type: realtime.MessageOp, Op: &models.BoardOperation{
+					Op:    models.OpUpdateShape,
+					ID:    "shape-0",
+					Shape: map[string]interface{}{"x": i},
+				}})
+				for _, watcher := range watchers {
+					readUntil(b, watcher, realtime.MessageOp)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,1636 @@
+//go:build integration
+
+package integration
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/converter"
+	"github.com/sarwanazhar/boardsar/backend/database"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"github.com/sarwanazhar/boardsar/backend/repository"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestBoardCRUD(t *testing.T) {
+	requireHarness(t)
+
+	_, token := seedUser(t, "")
+	boardID := seedBoard(t, token)
+
+	status, response := doJSON(t, http.MethodGet, "/api/boards/"+boardID, token, nil)
+	if status != http.StatusOK {
+		t.Fatalf("get: expected 200, got %d (%v)", status, response)
+	}
+
+	updated := testBoardData()
+	updated["scale"] = 2.0
+	status, _ = doJSON(t, http.MethodPut, "/api/boards/"+boardID, token, gin.H{"board": updated})
+	if status != http.StatusOK {
+		t.Fatalf("update: expected 200, got %d", status)
+	}
+
+	_, response = doJSON(t, http.MethodGet, "/api/boards/"+boardID, token, nil)
+	board := response["board"].(map[string]interface{})
+	if board["scale"] != 2.0 {
+		t.Fatalf("update: expected scale 2, got %v", board["scale"])
+	}
+
+	status, _ = doJSON(t, http.MethodDelete, "/api/boards/"+boardID, token, nil)
+	if status != http.StatusOK {
+		t.Fatalf("delete: expected 200, got %d", status)
+	}
+
+	status, _ = doJSON(t, http.MethodGet, "/api/boards/"+boardID, token, nil)
+	if status != http.StatusNotFound {
+		t.Fatalf("get after delete: expected 404, got %d", status)
+	}
+}
+
+func TestBoardCreateValidation(t *testing.T) {
+	requireHarness(t)
+
+	_, token := seedUser(t, "")
+
+	status, _ := doJSON(t, http.MethodPost, "/api/boards", token, gin.H{"invalid": "data"})
+	if status != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", status)
+	}
+
+	// A malformed board is described, violation by violation
+	status, body := doJSON(t, http.MethodPost, "/api/boards", token, gin.H{"board": gin.H{
+		"shapes": []gin.H{{"id": "a", "type": "blob", "x": "left"}, {"id": "a", "type": "rect"}},
+	}})
+	violations, _ := body["violations"].([]interface{})
+	if status != http.StatusUnprocessableEntity || len(violations) != 3 {
+		t.Fatalf("create malformed: expected 422 with 3 violations, got %d: %v", status, body)
+	}
+	if first := violations[0].(map[string]interface{}); first["path"] != "shapes[0].type" {
+		t.Fatalf("create malformed: expected the type first, got %v", first)
+	}
+
+	// Boards over BOARD_MAX_SIZE are turned away on every write
+	boardID := seedBoard(t, token)
+	defer func(limit int64) { libs.Settings().BoardMaxSize = limit }(libs.Settings().BoardMaxSize)
+	libs.Settings().BoardMaxSize = 2 << 10
+	status, body = doJSON(t, http.MethodPut, "/api/boards/"+boardID, token, gin.H{"board": largeBoardData(100)})
+	if status != http.StatusUnprocessableEntity {
+		t.Fatalf("put oversized: expected 422, got %d: %v", status, body)
+	}
+	operations := make([]gin.H, 40)
+	for i := range operations {
+		operations[i] = gin.H{"op": "add", "shape": gin.H{"id": fmt.Sprintf("note-%d", i), "type": "sticky", "text": strings.Repeat("x", 100)}}
+	}
+	status, body = doJSON(t, http.MethodPatch, "/api/boards/"+boardID, token, gin.H{"operations": operations})
+	if status != http.StatusUnprocessableEntity {
+		t.Fatalf("patch oversized: expected 422, got %d: %v", status, body)
+	}
+}
+
+// TestValidateBoardData checks board states against the rules for what
+// clients may store, without a database
+func TestValidateBoardData(t *testing.T) {
+	valid := testBoardData()
+	valid["shapes"] = append(valid["shapes"].([]interface{}), map[string]interface{}{
+		"id": "line-1", "type": "line", "points": []interface{}{0.0, 0.0, 10.0, 20.0}, "rotation": -45.0, "opacity": 0.5,
+	})
+	if err := libs.ValidateBoardData(valid); err != nil {
+		t.Fatalf("valid board: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name  string
+		board map[string]interface{}
+		path  string
+	}{
+		{"shapes not a list", map[string]interface{}{"shapes": "rect"}, "shapes"},
+		{"shape not an object", map[string]interface{}{"shapes": []interface{}{"rect"}}, "shapes[0]"},
+		{"missing id", map[string]interface{}{"shapes": []interface{}{map[string]interface{}{"type": "rect"}}}, "shapes[0].id"},
+		{"unknown type", map[string]interface{}{"shapes": []interface{}{map[string]interface{}{"id": "a", "type": "blob"}}}, "shapes[0].type"},
+		{"negative width", map[string]interface{}{"shapes": []interface{}{map[string]interface{}{"id": "a", "type": "rect", "width": -1.0}}}, "shapes[0].width"},
+		{"huge x", map[string]interface{}{"shapes": []interface{}{map[string]interface{}{"id": "a", "type": "rect", "x": 1e12}}}, "shapes[0].x"},
+		{"odd points", map[string]interface{}{"shapes": []interface{}{map[string]interface{}{"id": "a", "type": "pen", "points": []interface{}{1.0, 2.0, 3.0}}}}, "shapes[0].points"},
+		{"text not a string", map[string]interface{}{"shapes": []interface{}{map[string]interface{}{"id": "a", "type": "text", "text": 5.0}}}, "shapes[0].text"},
+		{"zero scale", map[string]interface{}{"scale": 0.0}, "scale"},
+		{"position not numbers", map[string]interface{}{"position": map[string]interface{}{"x": "0", "y": 0.0}}, "position.x"},
+	} {
+		err := libs.ValidateBoardData(tc.board)
+		var invalid *libs.InvalidBoardError
+		if !errors.As(err, &invalid) || invalid.Violations[0].Path != tc.path {
+			t.Fatalf("%s: expected a violation at %s, got %v", tc.name, tc.path, err)
+		}
+	}
+
+	// Operations are held to the same rules, for the fields they set
+	data := testBoardData()
+	if err := libs.ApplyBoardOperation(data, models.BoardOperation{Op: models.OpAddShape, Shape: map[string]interface{}{"id": "b", "type": "blob"}}); err == nil {
+		t.Fatal("add unknown type: expected an error")
+	}
+	if err := libs.ApplyBoardOperation(data, models.BoardOperation{Op: models.OpUpdateShape, ID: "test-shape-1", Shape: map[string]interface{}{"height": -5.0}}); err == nil {
+		t.Fatal("update to a negative height: expected an error")
+	}
+	if err := libs.ApplyBoardOperation(data, models.BoardOperation{Op: models.OpUpdateShape, ID: "test-shape-1", Shape: map[string]interface{}{"x": 5.0}}); err != nil {
+		t.Fatalf("move: %v", err)
+	}
+}
+
+func TestBoardsRequireAuth(t *testing.T) {
+	requireHarness(t)
+
+	requests := []struct{ method, path string }{
+		{http.MethodGet, "/api/boards"},
+		{http.MethodPost, "/api/boards"},
+		{http.MethodGet, "/api/boards/some-board-id"},
+		{http.MethodPut, "/api/boards/some-board-id"},
+		{http.MethodDelete, "/api/boards/some-board-id"},
+	}
+
+	for _, r := range requests {
+		status, _ := doJSON(t, r.method, r.path, "", gin.H{"board": testBoardData()})
+		if status != http.StatusUnauthorized {
+			t.Fatalf("%s %s: expected 401, got %d", r.method, r.path, status)
+		}
+	}
+}
+
+func TestBoardIsolationBetweenUsers(t *testing.T) {
+	requireHarness(t)
+
+	_, ownerToken := seedUser(t, "")
+	_, otherToken := seedUser(t, "")
+	boardID := seedBoard(t, ownerToken)
+
+	status, response := doJSON(t, http.MethodGet, "/api/boards/"+boardID, otherToken, nil)
+	if status != http.StatusNotFound {
+		t.Fatalf("get: expected 404, got %d", status)
+	}
+	if _, ok := response["debug"]; ok {
+		t.Fatalf("get: 404 should not describe the user's boards, got %v", response)
+	}
+
+	status, _ = doJSON(t, http.MethodPut, "/api/boards/"+boardID, otherToken, gin.H{"board": testBoardData()})
+	if status != http.StatusNotFound {
+		t.Fatalf("update: expected 404, got %d", status)
+	}
+
+	status, _ = doJSON(t, http.MethodDelete, "/api/boards/"+boardID, otherToken, nil)
+	if status != http.StatusNotFound {
+		t.Fatalf("delete: expected 404, got %d", status)
+	}
+
+	_, response = doJSON(t, http.MethodGet, "/api/boards", otherToken, nil)
+	if boards, ok := response["boards"].([]interface{}); ok && len(boards) != 0 {
+		t.Fatalf("list: expected no boards for other user, got %d", len(boards))
+	}
+}
+
+func TestRequestIDs(t *testing.T) {
+	requireHarness(t)
+
+	_, token := seedUser(t, "")
+
+	req := httptest.NewRequest(http.MethodGet, "/api/boards", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Header().Get("X-Request-ID") == "" {
+		t.Fatal("expected a generated X-Request-ID")
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/boards", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("X-Request-ID", "edge-1234")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if got := w.Header().Get("X-Request-ID"); got != "edge-1234" {
+		t.Fatalf("expected the caller's request ID back, got %q", got)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/boards", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("X-Request-ID", "bad id\nwith newline")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if got := w.Header().Get("X-Request-ID"); got == "" || strings.Contains(got, " ") {
+		t.Fatalf("expected an unusable request ID to be replaced, got %q", got)
+	}
+}
+
+func TestBoardListPagination(t *testing.T) {
+	requireHarness(t)
+
+	_, token := seedUser(t, "")
+	created := map[string]bool{}
+	for i := 0; i < 5; i++ {
+		created[seedBoard(t, token)] = true
+	}
+
+	seen := map[string]bool{}
+	path := "/api/boards?limit=2"
+	for pages := 0; ; pages++ {
+		if pages > 3 {
+			t.Fatalf("list: expected 3 pages, still paging after %d", pages)
+		}
+		status, response := doJSON(t, http.MethodGet, path, token, nil)
+		if status != http.StatusOK {
+			t.Fatalf("list: expected 200, got %d (%v)", status, response)
+		}
+		boards := response["boards"].([]interface{})
+		if len(boards) > 2 {
+			t.Fatalf("list: expected at most 2 boards per page, got %d", len(boards))
+		}
+		for _, board := range boards {
+			id := board.(map[string]interface{})["_id"].(string)
+			if seen[id] {
+				t.Fatalf("list: board %s returned twice", id)
+			}
+			seen[id] = true
+		}
+		if response["hasMore"] != true {
+			break
+		}
+		path = "/api/boards?limit=2&cursor=" + response["nextCursor"].(string)
+	}
+	if len(seen) != len(created) {
+		t.Fatalf("list: expected all %d boards across pages, got %d", len(created), len(seen))
+	}
+
+	if status, _ := doJSON(t, http.MethodGet, "/api/boards?cursor=not-a-cursor", token, nil); status != http.StatusBadRequest {
+		t.Fatalf("list with bad cursor: expected 400, got %d", status)
+	}
+}
+
+func TestDashboard(t *testing.T) {
+	requireHarness(t)
+
+	_, token := seedUser(t, "")
+	seedBoard(t, token)
+	seedBoard(t, token)
+
+	status, response := doJSON(t, http.MethodGet, "/api/dashboard", token, nil)
+	if status != http.StatusOK {
+		t.Fatalf("expected 200, got %d", status)
+	}
+
+	recent := response["recent"].([]interface{})
+	if len(recent) != 2 {
+		t.Fatalf("expected 2 recent boards, got %d", len(recent))
+	}
+	counts := response["counts"].(map[string]interface{})
+	if counts["owned"] != 2.0 {
+		t.Fatalf("expected 2 owned boards, got %v", counts["owned"])
+	}
+}
+
+func TestDashboardStarred(t *testing.T) {
+	requireHarness(t)
+
+	user, token := seedUser(t, "")
+	_, ownerToken := seedUser(t, "")
+	starred := seedBoard(t, token)
+	seedBoard(t, token)
+	unshared := seedBoard(t, ownerToken)
+
+	doJSON(t, http.MethodPost, "/api/boards/"+unshared+"/share", ownerToken, gin.H{
+		"userId": user.ID.Hex(),
+		"role":   "viewer",
+	})
+	for _, boardID := range []string{starred, unshared} {
+		if status, _ := doJSON(t, http.MethodPost, "/api/boards/"+boardID+"/star", token, nil); status != http.StatusOK {
+			t.Fatalf("star: expected 200, got %d", status)
+		}
+	}
+	// The star stays, but the board is no longer shared with the user
+	doJSON(t, http.MethodDelete, "/api/boards/"+unshared+"/share/"+user.ID.Hex(), ownerToken, nil)
+
+	status, response := doJSON(t, http.MethodGet, "/api/dashboard", token, nil)
+	if status != http.StatusOK {
+		t.Fatalf("expected 200, got %d", status)
+	}
+
+	section := response["starred"].([]interface{})
+	if len(section) != 1 || section[0].(map[string]interface{})["_id"] != starred {
+		t.Fatalf("starred: expected only %s, got %v", starred, section)
+	}
+	if section[0].(map[string]interface{})["starred"] != true {
+		t.Fatalf("starred: board is not marked starred: %v", section[0])
+	}
+	if counts := response["counts"].(map[string]interface{}); counts["starred"] != 1.0 {
+		t.Fatalf("expected 1 starred board, got %v", counts["starred"])
+	}
+	for _, item := range response["recent"].([]interface{}) {
+		board := item.(map[string]interface{})
+		if (board["_id"] == starred) != (board["starred"] == true) {
+			t.Fatalf("recent: expected only %s marked starred, got %v", starred, board)
+		}
+	}
+}
+
+func TestBoardSummaries(t *testing.T) {
+	requireHarness(t)
+
+	_, token := seedUser(t, "")
+	collaborator, _ := seedUser(t, "")
+	boardID := seedBoard(t, token)
+	objectID, _ := primitive.ObjectIDFromHex(boardID)
+
+	listed := func() map[string]interface{} {
+		t.Helper()
+		_, response := doJSON(t, http.MethodGet, "/api/boards", token, nil)
+		boards := response["boards"].([]interface{})
+		if len(boards) != 1 {
+			t.Fatalf("list: expected 1 board, got %v", boards)
+		}
+		return boards[0].(map[string]interface{})
+	}
+	if board := listed(); board["shapeCount"] != 1.0 || board["collaboratorCount"] != 0.0 {
+		t.Fatalf("create: expected 1 shape and no collaborators, got %v", board)
+	}
+
+	doJSON(t, http.MethodPatch, "/api/boards/"+boardID, token, gin.H{"operations": []gin.H{
+		{"op": models.OpAddShape, "shape": gin.H{"id": "note", "type": "sticky", "x": 10, "y": 10}},
+	}})
+	doJSON(t, http.MethodPatch, "/api/boards/"+boardID+"/meta", token, gin.H{"name": "Planning", "tags": []string{"q3"}})
+	doJSON(t, http.MethodPost, "/api/boards/"+boardID+"/share", token, gin.H{
+		"email": collaborator.Email,
+		"role":  models.CollaboratorRoleViewer,
+	})
+	board := listed()
+	if board["shapeCount"] != 2.0 || board["name"] != "Planning" || board["collaboratorCount"] != 1.0 || board["version"] != 2.0 {
+		t.Fatalf("update: expected the summary to follow the writes, got %v", board)
+	}
+
+	// Backfilled when missing
+	summaries := database.GetCollection("board_summaries")
+	if _, err := summaries.DeleteOne(context.Background(), bson.M{"_id": objectID}); err != nil {
+		t.Fatalf("failed to delete summary: %v", err)
+	}
+	libs.RunBoardSummaryBackfill(context.Background())
+	if board := listed(); board["shapeCount"] != 2.0 || board["name"] != "Planning" {
+		t.Fatalf("backfill: expected the summary back, got %v", board)
+	}
+
+	doJSON(t, http.MethodDelete, "/api/boards/"+boardID, token, nil)
+	if count, _ := summaries.CountDocuments(context.Background(), bson.M{"_id": objectID}); count != 0 {
+		t.Fatalf("delete: expected the summary removed, got %d", count)
+	}
+}
+
+func TestBoardListSkipsContents(t *testing.T) {
+	requireHarness(t)
+
+	_, token := seedUser(t, "")
+	shapes := []interface{}{}
+	for i := 0; i < 500; i++ {
+		shapes = append(shapes, gin.H{"id": fmt.Sprintf("shape-%d", i), "type": "text", "x": i, "y": i, "text": strings.Repeat("x", 100)})
+	}
+	status, _ := doJSON(t, http.MethodPost, "/api/boards", token, gin.H{"board": gin.H{"shapes": shapes}})
+	if status != http.StatusCreated {
+		t.Fatalf("create: expected 201, got %d", status)
+	}
+
+	// Lists count the shapes but never carry them
+	_, response := doJSON(t, http.MethodGet, "/api/boards", token, nil)
+	_, dashboard := doJSON(t, http.MethodGet, "/api/dashboard", token, nil)
+	for name, list := range map[string]interface{}{"board list": response["boards"], "dashboard": dashboard["recent"]} {
+		board := list.([]interface{})[0].(map[string]interface{})
+		if board["shapeCount"] != 500.0 {
+			t.Fatalf("%s: expected 500 shapes counted, got %v", name, board["shapeCount"])
+		}
+		if board["shapes"] != nil || board["board"] != nil {
+			t.Fatalf("%s: expected no board contents, got shapes %v", name, board["shapes"])
+		}
+		if raw, _ := json.Marshal(board); len(raw) > 2048 {
+			t.Fatalf("%s: expected a small summary, got %d bytes", name, len(raw))
+		}
+	}
+}
+
+func TestBoardQuotaWarningsAndLimit(t *testing.T) {
+	requireHarness(t)
+	defer func() { libs.Settings().BoardLimit = 0 }()
+	libs.Settings().BoardLimit = 2
+
+	_, token := seedUser(t, "")
+	seedBoard(t, token)
+
+	status, response := doJSON(t, http.MethodPost, "/api/boards", token, gin.H{"board": testBoardData()})
+	if status != http.StatusCreated {
+		t.Fatalf("create at limit: expected 201, got %d", status)
+	}
+	if warnings, ok := response["warnings"].([]interface{}); !ok || len(warnings) == 0 {
+		t.Fatalf("create at limit: expected warnings, got %v", response)
+	}
+
+	status, _ = doJSON(t, http.MethodPost, "/api/boards", token, gin.H{"board": testBoardData()})
+	if status != http.StatusForbidden {
+		t.Fatalf("create over limit: expected 403, got %d", status)
+	}
+}
+
+func TestBoardPatchOperations(t *testing.T) {
+	requireHarness(t)
+
+	_, ownerToken := seedUser(t, "")
+	viewer, viewerToken := seedUser(t, "")
+	boardID := seedBoard(t, ownerToken)
+	doJSON(t, http.MethodPost, "/api/boards/"+boardID+"/share", ownerToken, gin.H{
+		"email": viewer.Email,
+		"role":  models.CollaboratorRoleViewer,
+	})
+
+	status, response := doJSON(t, http.MethodPatch, "/api/boards/"+boardID, ownerToken, gin.H{"operations": []gin.H{
+		{"op": models.OpAddShape, "shape": gin.H{"id": "note", "type": "sticky", "x": 10, "y": 10, "text": "hi"}},
+		{"op": models.OpUpdateShape, "id": "test-shape-1", "shape": gin.H{"x": 300}},
+		{"op": models.OpUpdateShape, "id": "note", "shape": gin.H{"text": "hello"}},
+		{"op": models.OpSetScale, "scale": 2},
+		{"op": models.OpSetPosition, "position": gin.H{"x": 5, "y": 6}},
+	}})
+	if status != http.StatusOK || response["applied"].(float64) != 5 {
+		t.Fatalf("patch: expected 200 with 5 applied, got %d (%v)", status, response)
+	}
+
+	_, response = doJSON(t, http.MethodGet, "/api/boards/"+boardID, ownerToken, nil)
+	board := response["board"].(map[string]interface{})
+	shapes := board["shapes"].([]interface{})
+	if len(shapes) != 2 || board["scale"].(float64) != 2 || board["position"].(map[string]interface{})["y"].(float64) != 6 {
+		t.Fatalf("patch: unexpected board %v", board)
+	}
+	if shapes[0].(map[string]interface{})["x"].(float64) != 300 || shapes[1].(map[string]interface{})["text"] != "hello" {
+		t.Fatalf("patch: shapes not updated: %v", shapes)
+	}
+
+	// A bad operation leaves the board untouched
+	status, response = doJSON(t, http.MethodPatch, "/api/boards/"+boardID, ownerToken, gin.H{"operations": []gin.H{
+		{"op": models.OpDeleteShape, "id": "note"},
+		{"op": models.OpUpdateShape, "id": "missing", "shape": gin.H{"x": 1}},
+	}})
+	if status != http.StatusBadRequest || response["index"].(float64) != 1 {
+		t.Fatalf("bad patch: expected 400 at index 1, got %d (%v)", status, response)
+	}
+	_, response = doJSON(t, http.MethodGet, "/api/boards/"+boardID, ownerToken, nil)
+	if shapes := response["board"].(map[string]interface{})["shapes"].([]interface{}); len(shapes) != 2 {
+		t.Fatalf("bad patch: expected no changes, got %d shapes", len(shapes))
+	}
+
+	status, _ = doJSON(t, http.MethodPatch, "/api/boards/"+boardID, ownerToken, gin.H{"operations": []gin.H{
+		{"op": models.OpDeleteShape, "id": "note"},
+	}})
+	if status != http.StatusOK {
+		t.Fatalf("delete: expected 200, got %d", status)
+	}
+
+	status, _ = doJSON(t, http.MethodPatch, "/api/boards/"+boardID, viewerToken, gin.H{"operations": []gin.H{
+		{"op": models.OpSetScale, "scale": 3},
+	}})
+	if status != http.StatusForbidden {
+		t.Fatalf("viewer patch: expected 403, got %d", status)
+	}
+}
+
+func TestBoardOptimisticConcurrency(t *testing.T) {
+	requireHarness(t)
+
+	_, token := seedUser(t, "")
+	boardID := seedBoard(t, token)
+
+	status, response := doJSON(t, http.MethodGet, "/api/boards/"+boardID, token, nil)
+	if status != http.StatusOK {
+		t.Fatalf("get: expected 200, got %d", status)
+	}
+	version := int64(response["version"].(float64))
+
+	// First tab saves
+	status, response = doJSON(t, http.MethodPut, "/api/boards/"+boardID, token, gin.H{
+		"board":           testBoardData(),
+		"expectedVersion": version,
+	})
+	if status != http.StatusOK || int64(response["version"].(float64)) != version+1 {
+		t.Fatalf("first save: expected 200 at version %d, got %d (%v)", version+1, status, response)
+	}
+
+	// Second tab saves from the same starting version via If-Match
+	raw, _ := json.Marshal(gin.H{"board": testBoardData()})
+	req := httptest.NewRequest(http.MethodPut, "/api/boards/"+boardID, bytes.NewReader(raw))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("If-Match", `"`+strconv.FormatInt(version, 10)+`"`)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusConflict {
+		t.Fatalf("stale save: expected 409, got %d", w.Code)
+	}
+	var conflict map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &conflict)
+	if int64(conflict["version"].(float64)) != version+1 || conflict["board"] == nil {
+		t.Fatalf("stale save: expected the current state in the conflict, got %v", conflict)
+	}
+	if w.Header().Get("ETag") != `"`+strconv.FormatInt(version+1, 10)+`"` {
+		t.Fatalf("stale save: unexpected ETag %q", w.Header().Get("ETag"))
+	}
+
+	status, _ = doJSON(t, http.MethodPatch, "/api/boards/"+boardID, token, gin.H{
+		"operations":      []gin.H{{"op": models.OpSetScale, "scale": 2}},
+		"expectedVersion": version,
+	})
+	if status != http.StatusConflict {
+		t.Fatalf("stale patch: expected 409, got %d", status)
+	}
+
+	// Saves without a version still go through
+	status, _ = doJSON(t, http.MethodPut, "/api/boards/"+boardID, token, gin.H{"board": testBoardData()})
+	if status != http.StatusOK {
+		t.Fatalf("unversioned save: expected 200, got %d", status)
+	}
+}
+
+func TestBoardNameAndDescription(t *testing.T) {
+	requireHarness(t)
+
+	_, token := seedUser(t, "")
+
+	status, response := doJSON(t, http.MethodPost, "/api/boards", token, gin.H{
+		"boardId":     "retro-board",
+		"name":        "Sprint retro",
+		"description": "What went well",
+		"board":       testBoardData(),
+	})
+	if status != http.StatusCreated {
+		t.Fatalf("create: expected 201, got %d (%v)", status, response)
+	}
+
+	status, response = doJSON(t, http.MethodGet, "/api/boards", token, nil)
+	board := response["boards"].([]interface{})[0].(map[string]interface{})
+	if status != http.StatusOK || board["name"] != "Sprint retro" || board["description"] != "What went well" {
+		t.Fatalf("list: expected the board's name and description, got %d (%v)", status, board)
+	}
+	boardID := board["_id"].(string)
+	version := board["version"]
+
+	// Renaming leaves the contents and version alone
+	status, response = doJSON(t, http.MethodPatch, "/api/boards/"+boardID+"/meta", token, gin.H{"name": "Q3 retro"})
+	renamed := response["board"].(map[string]interface{})
+	if status != http.StatusOK || renamed["name"] != "Q3 retro" || renamed["description"] != "What went well" || renamed["version"] != version {
+		t.Fatalf("rename: expected new name, same description and version, got %d (%v)", status, response)
+	}
+	if status, response := doJSON(t, http.MethodPatch, "/api/boards/"+boardID+"/meta", token, gin.H{}); status != http.StatusBadRequest {
+		t.Fatalf("empty meta: expected 400, got %d (%v)", status, response)
+	}
+
+	// Clearing the name falls back to the board ID
+	doJSON(t, http.MethodPatch, "/api/boards/"+boardID+"/meta", token, gin.H{"name": ""})
+	status, response = doJSON(t, http.MethodGet, "/api/boards/"+boardID, token, nil)
+	if status != http.StatusOK || response["name"] != "retro-board" {
+		t.Fatalf("get: expected the board ID as name, got %d (%v)", status, response)
+	}
+}
+
+func TestBoardHealth(t *testing.T) {
+	requireHarness(t)
+
+	_, token := seedUser(t, "")
+	boardID := seedBoard(t, token)
+
+	data := testBoardData()
+	data["shapes"] = append(data["shapes"].([]interface{}),
+		map[string]interface{}{"id": "note-1", "type": "sticky", "text": "Ship it"},
+		map[string]interface{}{"id": "image-1", "type": "image", "src": "data:image/png;base64,iVBORw0KGgo="},
+	)
+	if status, response := doJSON(t, http.MethodPut, "/api/boards/"+boardID, token, gin.H{"board": data}); status != http.StatusOK {
+		t.Fatalf("update: expected 200, got %d (%v)", status, response)
+	}
+
+	status, response := doJSON(t, http.MethodGet, "/api/boards/"+boardID+"/health", token, nil)
+	if status != http.StatusOK {
+		t.Fatalf("health: expected 200, got %d (%v)", status, response)
+	}
+	health := response["health"].(map[string]interface{})
+	if health["shapes"] != 3.0 || health["texts"] != 1.0 || health["images"] != 1.0 || health["assetBytes"] != 8.0 {
+		t.Fatalf("health: unexpected counts %v", health)
+	}
+	if health["versions"] != 2.0 || health["documentBytes"].(float64) <= 0 || len(health["warnings"].([]interface{})) != 0 {
+		t.Fatalf("health: unexpected sizes or warnings %v", health)
+	}
+
+	_, otherToken := seedUser(t, "")
+	if status, response := doJSON(t, http.MethodGet, "/api/boards/"+boardID+"/health", otherToken, nil); status != http.StatusNotFound {
+		t.Fatalf("health of someone else's board: expected 404, got %d (%v)", status, response)
+	}
+}
+
+func TestStarredBoards(t *testing.T) {
+	requireHarness(t)
+
+	_, ownerToken := seedUser(t, "")
+	collaborator, collaboratorToken := seedUser(t, "")
+	starred := seedBoard(t, ownerToken)
+	seedBoard(t, ownerToken)
+
+	doJSON(t, http.MethodPost, "/api/boards/"+starred+"/share", ownerToken, gin.H{
+		"userId": collaborator.ID.Hex(),
+		"role":   "viewer",
+	})
+
+	status, _ := doJSON(t, http.MethodPost, "/api/boards/"+starred+"/star", ownerToken, nil)
+	if status != http.StatusOK {
+		t.Fatalf("star: expected 200, got %d", status)
+	}
+
+	status, body := doJSON(t, http.MethodGet, "/api/boards?starred=true", ownerToken, nil)
+	boards := body["boards"].([]interface{})
+	if status != http.StatusOK || len(boards) != 1 || boards[0].(map[string]interface{})["_id"] != starred {
+		t.Fatalf("starred list: expected only %s, got %d: %v", starred, status, boards)
+	}
+	if boards[0].(map[string]interface{})["starred"] != true {
+		t.Fatalf("starred list: board is not marked starred: %v", boards[0])
+	}
+
+	// Stars are per user
+	_, body = doJSON(t, http.MethodGet, "/api/boards?starred=true", collaboratorToken, nil)
+	if boards := body["boards"].([]interface{}); len(boards) != 0 {
+		t.Fatalf("collaborator: expected no starred boards, got %v", boards)
+	}
+	status, _ = doJSON(t, http.MethodPost, "/api/boards/"+starred+"/star", collaboratorToken, nil)
+	if status != http.StatusOK {
+		t.Fatalf("collaborator star: expected 200, got %d", status)
+	}
+
+	status, _ = doJSON(t, http.MethodDelete, "/api/boards/"+starred+"/star", ownerToken, nil)
+	if status != http.StatusOK {
+		t.Fatalf("unstar: expected 200, got %d", status)
+	}
+	_, body = doJSON(t, http.MethodGet, "/api/boards?starred=true", ownerToken, nil)
+	if boards := body["boards"].([]interface{}); len(boards) != 0 {
+		t.Fatalf("after unstar: expected no starred boards, got %v", boards)
+	}
+	_, body = doJSON(t, http.MethodGet, "/api/boards?starred=true", collaboratorToken, nil)
+	if boards := body["boards"].([]interface{}); len(boards) != 1 {
+		t.Fatalf("collaborator after owner unstarred: expected 1 starred board, got %v", boards)
+	}
+
+	// Boards you can't see can't be starred
+	_, strangerToken := seedUser(t, "")
+	status, _ = doJSON(t, http.MethodPost, "/api/boards/"+starred+"/star", strangerToken, nil)
+	if status != http.StatusNotFound {
+		t.Fatalf("stranger star: expected 404, got %d", status)
+	}
+}
+
+func TestImportBoard(t *testing.T) {
+	requireHarness(t)
+
+	_, token := seedUser(t, "")
+
+	excalidraw := gin.H{
+		"type":    "excalidraw",
+		"version": 2,
+		"elements": []gin.H{
+			{"id": "box", "type": "rectangle", "x": 10, "y": 20, "width": 100, "height": 50, "strokeColor": "#1e1e1e", "backgroundColor": "transparent"},
+			{"id": "label", "type": "text", "x": 20, "y": 30, "width": 40, "height": 25, "text": "Hello", "fontSize": 20},
+			{"id": "arrow", "type": "arrow", "x": 0, "y": 0, "points": [][]float64{{0, 0}, {100, 0}}, "endArrowhead": "arrow"},
+			{"id": "gone", "type": "rectangle", "x": 0, "y": 0, "width": 1, "height": 1, "isDeleted": true},
+			{"id": "picture", "type": "image", "x": 0, "y": 0, "width": 10, "height": 10},
+		},
+	}
+	status, body := doJSON(t, http.MethodPost, "/api/boards/import?name=Sketch", token, excalidraw)
+	if status != http.StatusCreated {
+		t.Fatalf("import excalidraw: expected 201, got %d: %v", status, body)
+	}
+	if skipped := body["skipped"].(map[string]interface{}); skipped["image"] != 1.0 {
+		t.Fatalf("import excalidraw: expected the image to be skipped, got %v", skipped)
+	}
+	imported := body["board"].(map[string]interface{})
+	if imported["name"] != "Sketch" {
+		t.Fatalf("import excalidraw: expected the name from ?name=, got %v", imported["name"])
+	}
+
+	// The board is the user's to edit straight away
+	boardID := imported["_id"].(string)
+	_, body = doJSON(t, http.MethodGet, "/api/boards/"+boardID, token, nil)
+	shapes := body["board"].(map[string]interface{})["shapes"].([]interface{})
+	if len(shapes) != 4 { // rect, text, arrow line and its head
+		t.Fatalf("import excalidraw: expected 4 shapes, got %v", shapes)
+	}
+	status, _ = doJSON(t, http.MethodPatch, "/api/boards/"+boardID, token, gin.H{
+		"operations": []gin.H{{"op": models.OpUpdateShape, "id": "box", "shape": gin.H{"x": 50}}},
+	})
+	if status != http.StatusOK {
+		t.Fatalf("edit imported board: expected 200, got %d", status)
+	}
+
+	tldraw := gin.H{
+		"tldrawFileFormatVersion": 1,
+		"records": []gin.H{
+			{"typeName": "page", "id": "page:main", "index": "a1", "name": "Page 1"},
+			{"typeName": "shape", "id": "shape:frame", "type": "frame", "parentId": "page:main", "index": "a1", "x": 100, "y": 100, "rotation": 0,
+				"props": gin.H{"w": 400, "h": 300, "name": "Ideas"}},
+			{"typeName": "shape", "id": "shape:note", "type": "note", "parentId": "shape:frame", "index": "a1", "x": 20, "y": 30, "rotation": 0,
+				"props": gin.H{"color": "yellow", "text": "Ship it"}},
+		},
+	}
+	status, body = doJSON(t, http.MethodPost, "/api/boards/import", token, tldraw)
+	if status != http.StatusCreated {
+		t.Fatalf("import tldraw: expected 201, got %d: %v", status, body)
+	}
+	_, body = doJSON(t, http.MethodGet, "/api/boards/"+body["board"].(map[string]interface{})["_id"].(string), token, nil)
+	shapes = body["board"].(map[string]interface{})["shapes"].([]interface{})
+	if len(shapes) != 2 {
+		t.Fatalf("import tldraw: expected 2 shapes, got %v", shapes)
+	}
+	// Shapes inside a frame are placed relative to it
+	note := shapes[1].(map[string]interface{})
+	if note["type"] != "sticky" || note["x"] != 120.0 || note["y"] != 130.0 || note["text"] != "Ship it" {
+		t.Fatalf("import tldraw: unexpected note %v", note)
+	}
+
+	status, _ = doJSON(t, http.MethodPost, "/api/boards/import", token, gin.H{"something": "else"})
+	if status != http.StatusBadRequest {
+		t.Fatalf("import unknown format: expected 400, got %d", status)
+	}
+}
+
+func TestImportMiroAndMural(t *testing.T) {
+	requireHarness(t)
+
+	_, token := seedUser(t, "")
+
+	miro := gin.H{
+		"board": gin.H{"name": "Retro"},
+		"data": []gin.H{
+			{"id": "1", "type": "frame", "data": gin.H{"title": "Went well"},
+				"position": gin.H{"x": 200, "y": 150, "origin": "center"}, "geometry": gin.H{"width": 400, "height": 300}},
+			{"id": "2", "type": "sticky_note", "data": gin.H{"content": "<p>Fast <b>deploys</b></p>"}, "style": gin.H{"fillColor": "yellow"},
+				"position": gin.H{"x": 100, "y": 100, "origin": "center", "relativeTo": "parent_top_left"}, "geometry": gin.H{"width": 100, "height": 100},
+				"parent": gin.H{"id": "1"}},
+			{"id": "3", "type": "embed", "data": gin.H{"url": "https://example.com"},
+				"position": gin.H{"x": 0, "y": 0, "origin": "center"}, "geometry": gin.H{"width": 10, "height": 10}},
+			{"id": "4", "type": "image", "data": gin.H{"imageUrl": "http://127.0.0.1/secret.png"},
+				"position": gin.H{"x": 0, "y": 0, "origin": "center"}, "geometry": gin.H{"width": 10, "height": 10}},
+		},
+	}
+	status, body := doJSON(t, http.MethodPost, "/api/boards/import", token, miro)
+	if status != http.StatusCreated {
+		t.Fatalf("import miro: expected 201, got %d: %v", status, body)
+	}
+	if body["importedFrom"] != "miro" || body["board"].(map[string]interface{})["name"] != "Retro" {
+		t.Fatalf("import miro: unexpected import %v", body)
+	}
+	// The embed has no equivalent, and images on private networks aren't fetched
+	report := body["report"].([]interface{})
+	if len(report) != 2 || report[0].(map[string]interface{})["id"] != "3" || report[1].(map[string]interface{})["id"] != "4" {
+		t.Fatalf("import miro: expected the embed and the image in the report, got %v", report)
+	}
+	_, body = doJSON(t, http.MethodGet, "/api/boards/"+body["board"].(map[string]interface{})["_id"].(string), token, nil)
+	shapes := body["board"].(map[string]interface{})["shapes"].([]interface{})
+	if len(shapes) != 2 {
+		t.Fatalf("import miro: expected the frame and the note, got %v", shapes)
+	}
+	// Items in a frame are placed from its top-left corner
+	note := shapes[1].(map[string]interface{})
+	if note["type"] != "sticky" || note["x"] != 50.0 || note["y"] != 50.0 || note["text"] != "Fast deploys" {
+		t.Fatalf("import miro: unexpected note %v", note)
+	}
+
+	// Images are copied into the board's assets
+	var picture bytes.Buffer
+	png.Encode(&picture, image.NewRGBA(image.Rect(0, 0, 4, 4)))
+	mural := gin.H{
+		"mural": gin.H{"title": "Planning"},
+		"value": []gin.H{
+			{"id": "area", "type": "area", "x": 0, "y": 0, "width": 500, "height": 400, "title": "Sprint"},
+			{"id": "note", "type": "sticky note", "x": 10, "y": 20, "width": 80, "height": 80, "parentId": "area",
+				"text": "Estimate", "style": gin.H{"backgroundColor": "#FCFE7DFF"}},
+			{"id": "logo", "type": "image", "x": 100, "y": 100, "width": 40, "height": 40,
+				"url": "data:image/png;base64," + base64.StdEncoding.EncodeToString(picture.Bytes())},
+			{"id": "chat", "type": "comment", "x": 0, "y": 0, "width": 10, "height": 10},
+		},
+	}
+	status, body = doJSON(t, http.MethodPost, "/api/boards/import", token, mural)
+	if status != http.StatusCreated {
+		t.Fatalf("import mural: expected 201, got %d: %v", status, body)
+	}
+	if skipped := body["skipped"].(map[string]interface{}); len(skipped) != 1 || skipped["comment"] != 1.0 {
+		t.Fatalf("import mural: expected the comment to be skipped, got %v", skipped)
+	}
+	_, body = doJSON(t, http.MethodGet, "/api/boards/"+body["board"].(map[string]interface{})["_id"].(string), token, nil)
+	shapes = body["board"].(map[string]interface{})["shapes"].([]interface{})
+	if len(shapes) != 3 {
+		t.Fatalf("import mural: expected 3 shapes, got %v", shapes)
+	}
+	if frame := shapes[0].(map[string]interface{}); frame["type"] != "frame" || frame["title"] != "Sprint" {
+		t.Fatalf("import mural: unexpected area %v", frame)
+	}
+	if note := shapes[1].(map[string]interface{}); note["x"] != 10.0 || note["y"] != 20.0 || note["fill"] != "#fcfe7d" {
+		t.Fatalf("import mural: unexpected note %v", note)
+	}
+	logo := shapes[2].(map[string]interface{})
+	if logo["type"] != "image" || logo["assetId"] == nil || !strings.HasSuffix(logo["src"].(string), "/api/assets/"+logo["assetId"].(string)) {
+		t.Fatalf("import mural: expected the image to be an asset, got %v", logo)
+	}
+}
+
+func TestImportDiagram(t *testing.T) {
+	requireHarness(t)
+
+	_, token := seedUser(t, "")
+	boardID := seedBoard(t, token)
+	_, body := doJSON(t, http.MethodGet, "/api/boards/"+boardID, token, nil)
+	existing := len(body["board"].(map[string]interface{})["shapes"].([]interface{}))
+
+	mermaid := "flowchart TD\n  A[Start] --> B{Ready?}\n  B -->|yes| C(Ship)\n  B --> D\n  A -->\n  classDef hot fill:#f00"
+	status, body := doJSON(t, http.MethodPost, "/api/boards/"+boardID+"/import-diagram", token, gin.H{"source": mermaid})
+	if status != http.StatusOK {
+		t.Fatalf("import mermaid: expected 200, got %d: %v", status, body)
+	}
+	if body["syntax"] != "mermaid" {
+		t.Fatalf("import mermaid: expected the syntax to be detected, got %v", body["syntax"])
+	}
+	// Four nodes and their labels, three lines with their heads, and one
+	// edge label; the dangling link is reported
+	added := body["shapes"].([]interface{})
+	if len(added) != 15 {
+		t.Fatalf("import mermaid: expected 15 shapes, got %d: %v", len(added), added)
+	}
+	if report := body["report"].([]interface{}); len(report) != 1 || report[0].(map[string]interface{})["id"] != "line 5" {
+		t.Fatalf("import mermaid: expected line 5 to be reported, got %v", report)
+	}
+	// A node's box and label move together
+	box, label := added[0].(map[string]interface{}), added[1].(map[string]interface{})
+	if box["groupId"] == nil || box["groupId"] != label["groupId"] || label["text"] != "Start" {
+		t.Fatalf("import mermaid: expected the box and label grouped, got %v and %v", box, label)
+	}
+
+	_, body = doJSON(t, http.MethodGet, "/api/boards/"+boardID, token, nil)
+	if shapes := body["board"].(map[string]interface{})["shapes"].([]interface{}); len(shapes) != existing+15 {
+		t.Fatalf("import mermaid: expected %d shapes on the board, got %d", existing+15, len(shapes))
+	}
+
+	// Placed where asked, with fresh IDs each time
+	plantUML := "@startuml\n[Web] --> [API] : calls\n@enduml"
+	status, body = doJSON(t, http.MethodPost, "/api/boards/"+boardID+"/import-diagram", token, gin.H{
+		"source": plantUML, "syntax": "plantuml", "x": 5000, "y": 5000,
+	})
+	if status != http.StatusOK {
+		t.Fatalf("import plantuml: expected 200, got %d: %v", status, body)
+	}
+	added = body["shapes"].([]interface{})
+	if len(added) != 7 {
+		t.Fatalf("import plantuml: expected 7 shapes, got %v", added)
+	}
+	if web := added[0].(map[string]interface{}); web["x"] != 5000.0 || web["y"] != 5000.0 {
+		t.Fatalf("import plantuml: expected the diagram at 5000,5000, got %v", web)
+	}
+
+	status, _ = doJSON(t, http.MethodPost, "/api/boards/"+boardID+"/import-diagram", token, gin.H{"source": "sequenceDiagram\nA->>B: hi"})
+	if status != http.StatusBadRequest {
+		t.Fatalf("import sequence diagram: expected 400, got %d", status)
+	}
+}
+
+// postCSV posts a CSV file as the request body
+func postCSV(t *testing.T, token, path, data string) (int, map[string]interface{}) {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(data))
+	req.Header.Set("Content-Type", "text/csv")
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	return w.Code, response
+}
+
+func TestImportCSV(t *testing.T) {
+	requireHarness(t)
+
+	_, token := seedUser(t, "")
+	boardID := seedBoard(t, token)
+	viewer, viewerToken := seedUser(t, "")
+	doJSON(t, http.MethodPost, "/api/boards/"+boardID+"/share", token, gin.H{"email": viewer.Email, "role": "viewer"})
+
+	tasks := "Title;Status;Owner\nLogin page;Todo;Ann\nAPI;Done;\n\n;Todo;Bo\n"
+
+	// The preview proposes a kanban column per status without changing
+	// the board, and viewers may ask for it
+	_, body := doJSON(t, http.MethodGet, "/api/boards/"+boardID, token, nil)
+	version := body["version"]
+	status, body := postCSV(t, viewerToken, "/api/boards/"+boardID+"/import-csv/preview?layout=kanban&groupBy=Status", tasks)
+	if status != http.StatusOK {
+		t.Fatalf("preview: expected 200, got %d: %v", status, body)
+	}
+	if fields := body["fields"].([]interface{}); len(fields) != 3 || fields[1] != "Status" {
+		t.Fatalf("preview: expected the headers as fields, got %v", fields)
+	}
+	columns := body["columns"].([]interface{})
+	if len(columns) != 2 || columns[0].(map[string]interface{})["title"] != "Todo" || columns[0].(map[string]interface{})["notes"] != 2.0 {
+		t.Fatalf("preview: expected Todo and Done columns, got %v", columns)
+	}
+	if shapes := body["shapes"].([]interface{}); len(shapes) != 5 { // Two frames, three notes
+		t.Fatalf("preview: expected 5 shapes, got %v", shapes)
+	}
+	_, body = doJSON(t, http.MethodGet, "/api/boards/"+boardID, token, nil)
+	if body["version"] != version {
+		t.Fatalf("preview: expected the board unchanged, version %v became %v", version, body["version"])
+	}
+
+	// Viewers can't import
+	status, _ = postCSV(t, viewerToken, "/api/boards/"+boardID+"/import-csv", tasks)
+	if status != http.StatusForbidden {
+		t.Fatalf("import as viewer: expected 403, got %d", status)
+	}
+
+	status, body = postCSV(t, token, "/api/boards/"+boardID+"/import-csv?fields=Title&columns=2&x=1000&y=2000", tasks)
+	if status != http.StatusOK {
+		t.Fatalf("import grid: expected 200, got %d: %v", status, body)
+	}
+	added := body["shapes"].([]interface{})
+	if len(added) != 3 {
+		t.Fatalf("import grid: expected 3 notes, got %v", added)
+	}
+	first, third := added[0].(map[string]interface{}), added[2].(map[string]interface{})
+	if first["type"] != "sticky" || first["text"] != "Login page" || first["x"] != 1000.0 || first["y"] != 2000.0 {
+		t.Fatalf("import grid: unexpected first note %v", first)
+	}
+	if third["x"] != 1000.0 || third["y"] != 2220.0 {
+		t.Fatalf("import grid: expected the third note on the second row, got %v", third)
+	}
+
+	status, _ = postCSV(t, token, "/api/boards/"+boardID+"/import-csv?layout=kanban&groupBy=Priority", tasks)
+	if status != http.StatusBadRequest {
+		t.Fatalf("import unknown field: expected 400, got %d", status)
+	}
+}
+
+func TestLayoutShapes(t *testing.T) {
+	requireHarness(t)
+
+	_, token := seedUser(t, "")
+	boardID := seedBoard(t, token)
+	viewer, viewerToken := seedUser(t, "")
+	doJSON(t, http.MethodPost, "/api/boards/"+boardID+"/share", token, gin.H{"email": viewer.Email, "role": "viewer"})
+	status, body := doJSON(t, http.MethodPost, "/api/boards/"+boardID+"/import-diagram", token, gin.H{
+		"source": "flowchart TD\n  A[Start] --> B{Ready?}\n  B -->|yes| C(Ship)\n  B --> D",
+	})
+	if status != http.StatusOK {
+		t.Fatalf("import diagram: expected 200, got %d: %v", status, body)
+	}
+	version := body["version"]
+
+	status, _ = doJSON(t, http.MethodPost, "/api/boards/"+boardID+"/layout", viewerToken, gin.H{"algorithm": "grid"})
+	if status != http.StatusForbidden {
+		t.Fatalf("layout as viewer: expected 403, got %d", status)
+	}
+	status, _ = doJSON(t, http.MethodPost, "/api/boards/"+boardID+"/layout", token, gin.H{"algorithm": "circular"})
+	if status != http.StatusBadRequest {
+		t.Fatalf("layout with an unknown algorithm: expected 400, got %d", status)
+	}
+
+	// Laid out left to right, without changing the board
+	status, body = doJSON(t, http.MethodPost, "/api/boards/"+boardID+"/layout", token, gin.H{
+		"algorithm": "hierarchical", "direction": "LR",
+		"shapeIds": []string{"node-A", "node-B", "node-C", "node-D"},
+	})
+	if status != http.StatusOK {
+		t.Fatalf("layout: expected 200, got %d: %v", status, body)
+	}
+	operations, undo := body["operations"].([]interface{}), body["undo"].([]interface{})
+	if len(operations) == 0 || len(operations) != len(undo) || body["expectedVersion"] != version {
+		t.Fatalf("layout: expected matching batches at version %v, got %v", version, body)
+	}
+	_, board := doJSON(t, http.MethodGet, "/api/boards/"+boardID, token, nil)
+	if board["version"] != version {
+		t.Fatalf("layout: expected the board unchanged, version %v became %v", version, board["version"])
+	}
+
+	// The batch applies, and the undo batch puts the shapes back
+	status, body = doJSON(t, http.MethodPatch, "/api/boards/"+boardID, token, gin.H{"operations": operations, "expectedVersion": version})
+	if status != http.StatusOK {
+		t.Fatalf("apply layout: expected 200, got %d: %v", status, body)
+	}
+	status, body = doJSON(t, http.MethodPatch, "/api/boards/"+boardID, token, gin.H{"operations": undo, "expectedVersion": body["version"]})
+	if status != http.StatusOK {
+		t.Fatalf("undo layout: expected 200, got %d: %v", status, body)
+	}
+	_, after := doJSON(t, http.MethodGet, "/api/boards/"+boardID, token, nil)
+	before, _ := json.Marshal(board["board"].(map[string]interface{})["shapes"])
+	restored, _ := json.Marshal(after["board"].(map[string]interface{})["shapes"])
+	if string(before) != string(restored) {
+		t.Fatalf("undo layout: expected the shapes restored, got %s, had %s", restored, before)
+	}
+
+	status, _ = doJSON(t, http.MethodPost, "/api/boards/"+boardID+"/layout", token, gin.H{"algorithm": "force", "shapeIds": []string{"nothing"}})
+	if status != http.StatusBadRequest {
+		t.Fatalf("layout of nothing: expected 400, got %d", status)
+	}
+}
+
+// TestLayoutOperations lays an imported diagram out with each algorithm,
+// without a database
+func TestLayoutOperations(t *testing.T) {
+	result, err := converter.ConvertDiagram("flowchart TD\n  A[Start] --> B{Ready?}\n  B -->|yes| C(Ship)\n  B --> D\n  C --> A", "")
+	if err != nil {
+		t.Fatalf("convert: %v", err)
+	}
+	original, _ := json.Marshal(result.Board)
+	edges := func(data map[string]interface{}) []string {
+		var found []string
+		for _, edge := range libs.BoardGraph("", data).Edges {
+			found = append(found, edge.Source+">"+edge.Target)
+		}
+		return found
+	}
+	want := edges(result.Board)
+
+	for _, opts := range []converter.LayoutOptions{
+		{Algorithm: converter.LayoutHierarchical, Direction: "LR"},
+		{Algorithm: converter.LayoutForce},
+		{Algorithm: converter.LayoutGrid, Columns: 2},
+	} {
+		var data map[string]interface{}
+		json.Unmarshal(original, &data)
+		operations, undo, err := libs.LayoutShapes(data, nil, opts)
+		if err != nil || len(operations) == 0 || len(undo) != len(operations) {
+			t.Fatalf("%s: got %d operations, %d to undo, %v", opts.Algorithm, len(operations), len(undo), err)
+		}
+		for _, op := range operations {
+			if err := libs.ApplyBoardOperation(data, op); err != nil {
+				t.Fatalf("%s: apply: %v", opts.Algorithm, err)
+			}
+		}
+
+		// Connectors still join the same nodes, which don't overlap
+		if got := edges(data); fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Fatalf("%s: expected edges %v, got %v", opts.Algorithm, want, got)
+		}
+		nodes := libs.BoardGraph("", data).Nodes
+		for i, a := range nodes {
+			for _, b := range nodes[i+1:] {
+				if a.X < b.X+b.Width && b.X < a.X+a.Width && a.Y < b.Y+b.Height && b.Y < a.Y+a.Height {
+					t.Fatalf("%s: %s and %s overlap: %+v, %+v", opts.Algorithm, a.ID, b.ID, a.Bounds, b.Bounds)
+				}
+			}
+		}
+		// Labels stay on their nodes
+		start, label := libs.FindShape(data, "node-A"), libs.FindShape(data, "node-A-label")
+		if label["x"].(float64) < start["x"].(float64) || label["y"].(float64) < start["y"].(float64) {
+			t.Fatalf("%s: expected the label inside its node, got %v in %v", opts.Algorithm, label, start)
+		}
+
+		for _, op := range undo {
+			if err := libs.ApplyBoardOperation(data, op); err != nil {
+				t.Fatalf("%s: undo: %v", opts.Algorithm, err)
+			}
+		}
+		if restored, _ := json.Marshal(data); string(restored) != string(original) {
+			t.Fatalf("%s: expected undo to restore the board, got %s", opts.Algorithm, restored)
+		}
+	}
+}
+
+func TestArrangeShapes(t *testing.T) {
+	requireHarness(t)
+
+	_, token := seedUser(t, "")
+	boardID := seedBoard(t, token)
+	viewer, viewerToken := seedUser(t, "")
+	doJSON(t, http.MethodPost, "/api/boards/"+boardID+"/share", token, gin.H{"email": viewer.Email, "role": "viewer"})
+	status, body := doJSON(t, http.MethodPost, "/api/boards/"+boardID+"/import-diagram", token, gin.H{
+		"source": "flowchart LR\n  A --> B\n  B --> C",
+	})
+	if status != http.StatusOK {
+		t.Fatalf("import diagram: expected 200, got %d: %v", status, body)
+	}
+	version := body["version"].(float64)
+	ids := []string{"node-A", "node-B", "node-C"}
+
+	status, _ = doJSON(t, http.MethodPost, "/api/boards/"+boardID+"/arrange", viewerToken, gin.H{"action": "align", "shapeIds": ids, "to": "top"})
+	if status != http.StatusForbidden {
+		t.Fatalf("arrange as viewer: expected 403, got %d", status)
+	}
+	status, _ = doJSON(t, http.MethodPost, "/api/boards/"+boardID+"/arrange", token, gin.H{"action": "align", "shapeIds": ids})
+	if status != http.StatusBadRequest {
+		t.Fatalf("align to nothing: expected 400, got %d", status)
+	}
+	status, _ = doJSON(t, http.MethodPost, "/api/boards/"+boardID+"/arrange", token, gin.H{"action": "tidy", "shapeIds": []string{"node-A", "missing"}})
+	if status != http.StatusBadRequest {
+		t.Fatalf("tidy a missing shape: expected 400, got %d", status)
+	}
+
+	// Every move is one new version
+	status, body = doJSON(t, http.MethodPost, "/api/boards/"+boardID+"/arrange", token, gin.H{
+		"action": "distribute", "shapeIds": ids, "axis": "vertical", "spacing": 40, "expectedVersion": version,
+	})
+	if status != http.StatusOK {
+		t.Fatalf("distribute: expected 200, got %d: %v", status, body)
+	}
+	if body["version"] != version+1 || body["applied"].(float64) == 0 || len(body["undo"].([]interface{})) == 0 {
+		t.Fatalf("distribute: expected one new version with moves to undo, got %v", body)
+	}
+	status, _ = doJSON(t, http.MethodPost, "/api/boards/"+boardID+"/arrange", token, gin.H{
+		"action": "align", "shapeIds": ids, "to": "left", "expectedVersion": version,
+	})
+	if status != http.StatusConflict {
+		t.Fatalf("align at an old version: expected 409, got %d", status)
+	}
+
+	// The undo batch puts the shapes back
+	status, body = doJSON(t, http.MethodPatch, "/api/boards/"+boardID, token, gin.H{"operations": body["undo"], "expectedVersion": body["version"]})
+	if status != http.StatusOK {
+		t.Fatalf("undo distribute: expected 200, got %d: %v", status, body)
+	}
+}
+
+// TestArrangeOperations aligns, distributes and tidies the nodes of an
+// imported diagram, without a database
+func TestArrangeOperations(t *testing.T) {
+	result, err := converter.ConvertDiagram("flowchart TD\n  A[Start] --> B{Ready?}\n  B -->|yes| C(Ship)\n  B --> D", "")
+	if err != nil {
+		t.Fatalf("convert: %v", err)
+	}
+	original, _ := json.Marshal(result.Board)
+	ids := []string{"node-A", "node-B", "node-C", "node-D"}
+	bounds := func(data map[string]interface{}) []libs.Bounds {
+		var found []libs.Bounds
+		for _, id := range ids {
+			b, _ := libs.ShapeBounds(libs.FindShape(data, id))
+			found = append(found, b)
+		}
+		return found
+	}
+	spacing := 30.0
+
+	for _, req := range []models.ArrangeRequest{
+		{Action: models.ArrangeAlign, To: "left"},
+		{Action: models.ArrangeAlign, To: "middle"},
+		{Action: models.ArrangeDistribute, Axis: "horizontal", Spacing: &spacing},
+		{Action: models.ArrangeTidy},
+	} {
+		name := req.Action + " " + req.To + req.Axis
+		var data map[string]interface{}
+		json.Unmarshal(original, &data)
+		req.ShapeIDs = ids
+		operations, undo, err := libs.ArrangeShapes(data, req)
+		if err != nil || len(operations) == 0 || len(undo) != len(operations) {
+			t.Fatalf("%s: got %d operations, %d to undo, %v", name, len(operations), len(undo), err)
+		}
+		for _, op := range operations {
+			if err := libs.ApplyBoardOperation(data, op); err != nil {
+				t.Fatalf("%s: apply: %v", name, err)
+			}
+		}
+
+		got := bounds(data)
+		for i, b := range got[1:] {
+			switch req.To + req.Axis {
+			case "left":
+				if b.X != got[0].X {
+					t.Fatalf("%s: expected %s at x %v, got %+v", name, ids[i+1], got[0].X, b)
+				}
+			case "middle":
+				if math.Abs(b.Y+b.Height/2-got[0].Y-got[0].Height/2) > 0.01 {
+					t.Fatalf("%s: expected %s centred on %v, got %+v", name, ids[i+1], got[0].Y+got[0].Height/2, b)
+				}
+			}
+		}
+		if req.Action != models.ArrangeAlign {
+			for i, a := range got {
+				for _, b := range got[i+1:] {
+					if a.X < b.X+b.Width && b.X < a.X+a.Width && a.Y < b.Y+b.Height && b.Y < a.Y+a.Height {
+						t.Fatalf("%s: expected no overlaps, got %+v and %+v", name, a, b)
+					}
+				}
+			}
+		}
+		// Labels move with their nodes
+		start, label := libs.FindShape(data, "node-A"), libs.FindShape(data, "node-A-label")
+		if label["x"].(float64) < start["x"].(float64) || label["y"].(float64) < start["y"].(float64) {
+			t.Fatalf("%s: expected the label inside its node, got %v in %v", name, label, start)
+		}
+
+		for _, op := range undo {
+			if err := libs.ApplyBoardOperation(data, op); err != nil {
+				t.Fatalf("%s: undo: %v", name, err)
+			}
+		}
+		if restored, _ := json.Marshal(data); string(restored) != string(original) {
+			t.Fatalf("%s: expected undo to restore the board, got %s", name, restored)
+		}
+	}
+
+	var data map[string]interface{}
+	json.Unmarshal(original, &data)
+	if _, _, err := libs.ArrangeShapes(data, models.ArrangeRequest{Action: models.ArrangeTidy, ShapeIDs: []string{"node-A", "node-A-label"}}); !errors.Is(err, libs.ErrNothingToArrange) {
+		t.Fatalf("tidy one group: expected ErrNothingToArrange, got %v", err)
+	}
+}
+
+func TestBoardThumbnail(t *testing.T) {
+	requireHarness(t)
+
+	_, token := seedUser(t, "")
+	boardID := seedBoard(t, token)
+
+	getThumbnail := func(t *testing.T, token, etag string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/api/boards/"+boardID+"/thumbnail", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Drawn on first request
+	w := getThumbnail(t, token, "")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/png" {
+		t.Fatalf("thumbnail: expected a PNG, got %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	if !bytes.HasPrefix(w.Body.Bytes(), []byte("\x89PNG")) {
+		t.Fatalf("thumbnail: body is not a PNG")
+	}
+	etag := w.Header().Get("ETag")
+	if etag == "" || w.Header().Get("Cache-Control") == "" {
+		t.Fatalf("thumbnail: expected caching headers, got %v", w.Header())
+	}
+
+	if w := getThumbnail(t, token, etag); w.Code != http.StatusNotModified {
+		t.Fatalf("thumbnail revalidation: expected 304, got %d", w.Code)
+	}
+
+	// After a save the thumbnail shows the new version
+	updated := testBoardData()
+	updated["scale"] = 2.0
+	status, _ := doJSON(t, http.MethodPut, "/api/boards/"+boardID, token, gin.H{"board": updated})
+	if status != http.StatusOK {
+		t.Fatalf("update: expected 200, got %d", status)
+	}
+	w = getThumbnail(t, token, etag)
+	if w.Code != http.StatusOK || w.Header().Get("ETag") == etag {
+		t.Fatalf("thumbnail after save: expected a new thumbnail, got %d with ETag %s", w.Code, w.Header().Get("ETag"))
+	}
+
+	_, strangerToken := seedUser(t, "")
+	if w := getThumbnail(t, strangerToken, ""); w.Code != http.StatusNotFound {
+		t.Fatalf("stranger thumbnail: expected 404, got %d", w.Code)
+	}
+}
+
+func TestCompactSync(t *testing.T) {
+	requireHarness(t)
+
+	_, token := seedUser(t, "")
+	boardID := seedBoard(t, token)
+
+	// Compact lists leave out the heavy fields; ?fields= picks them
+	status, body := doJSON(t, http.MethodGet, "/api/boards?compact=true", token, nil)
+	if status != http.StatusOK {
+		t.Fatalf("compact list: expected 200, got %d: %v", status, body)
+	}
+	listed := body["boards"].([]interface{})[0].(map[string]interface{})
+	if listed["_id"] != boardID || listed["version"] == nil || listed["collaborators"] != nil || listed["shapes"] != nil {
+		t.Fatalf("compact list: unexpected fields %v", listed)
+	}
+	_, body = doJSON(t, http.MethodGet, "/api/boards?fields=_id,version", token, nil)
+	if listed := body["boards"].([]interface{})[0].(map[string]interface{}); len(listed) != 2 {
+		t.Fatalf("fields list: expected _id and version only, got %v", listed)
+	}
+	if status, _ := doJSON(t, http.MethodGet, "/api/boards?fields=secrets", token, nil); status != http.StatusBadRequest {
+		t.Fatalf("unknown field: expected 400, got %d", status)
+	}
+	if status, _ := doJSON(t, http.MethodGet, "/api/boards?compact=true&limit=100", token, nil); status != http.StatusBadRequest {
+		t.Fatalf("compact page size: expected 400 above 50, got %d", status)
+	}
+
+	status, body = doJSON(t, http.MethodGet, "/api/boards/"+boardID+"?fields=version", token, nil)
+	if status != http.StatusOK || len(body) != 1 || body["version"] == nil {
+		t.Fatalf("fields get: expected the version only, got %d: %v", status, body)
+	}
+
+	// A client that has the current version gets 304
+	req := httptest.NewRequest(http.MethodGet, "/api/boards/"+boardID, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("If-None-Match", `"1"`)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Fatalf("revalidation: expected an empty 304, got %d", w.Code)
+	}
+
+	// msgpack instead of JSON when asked for
+	req = httptest.NewRequest(http.MethodGet, "/api/boards/"+boardID+"?fields=version", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/msgpack")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	// {"version": 1} as a one-entry fixmap
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/msgpack" || !bytes.Equal(w.Body.Bytes(), append([]byte{0x81, 0xa7}, "version\x01"...)) {
+		t.Fatalf("msgpack: unexpected response %d %q %x", w.Code, w.Header().Get("Content-Type"), w.Body.Bytes())
+	}
+
+	// Compact saves don't echo the board back
+	raw, _ := json.Marshal(gin.H{"board": testBoardData()})
+	req = httptest.NewRequest(http.MethodPut, "/api/boards/"+boardID, bytes.NewReader(raw))
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Sync-Mode", "compact")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	var saved map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &saved)
+	if w.Code != http.StatusOK || saved["version"] != 2.0 || saved["board"] != nil {
+		t.Fatalf("compact save: unexpected response %d: %v", w.Code, saved)
+	}
+}
+
+func TestViewportShapes(t *testing.T) {
+	requireHarness(t)
+
+	_, token := seedUser(t, "")
+	_, strangerToken := seedUser(t, "")
+	boardID := seedBoard(t, token)
+
+	// A 10x10 grid of 50x50 squares, 100 apart
+	shapes := []interface{}{}
+	for row := 0; row < 10; row++ {
+		for col := 0; col < 10; col++ {
+			shapes = append(shapes, gin.H{
+				"id": strconv.Itoa(row*10 + col), "type": "rect",
+				"x": col * 100, "y": row * 100, "width": 50, "height": 50,
+			})
+		}
+	}
+	board := gin.H{"scale": 1.0, "position": gin.H{"x": 0, "y": 0}, "shapes": shapes}
+
+	viewport := func(bbox string) []string {
+		t.Helper()
+		status, body := doJSON(t, http.MethodGet, "/api/boards/"+boardID+"/shapes?bbox="+bbox, token, nil)
+		if status != http.StatusOK {
+			t.Fatalf("viewport %s: expected 200, got %d: %v", bbox, status, body)
+		}
+		ids := []string{}
+		for _, shape := range body["shapes"].([]interface{}) {
+			ids = append(ids, shape.(map[string]interface{})["id"].(string))
+		}
+		return ids
+	}
+	expect := func(bbox string, want ...string) {
+		t.Helper()
+		if got := viewport(bbox); strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Fatalf("viewport %s: expected shapes %v, got %v", bbox, want, got)
+		}
+	}
+
+	// Indexed once the board is big enough, answered from the board before
+	defer func(threshold int) { libs.Settings().ShapeIndexThreshold = threshold }(libs.Settings().ShapeIndexThreshold)
+	for _, threshold := range []int{1000, 50} {
+		libs.Settings().ShapeIndexThreshold = threshold
+		if status, body := doJSON(t, http.MethodPut, "/api/boards/"+boardID, token, gin.H{"board": board}); status != http.StatusOK {
+			t.Fatalf("save: expected 200, got %d: %v", status, body)
+		}
+
+		// Partly covered shapes count; the gaps between them don't
+		expect("25,25,125,125", "0", "1", "10", "11")
+		expect("60,60,90,90")
+		expect("950,950,2000,2000")
+		expect("-500,-500,0,0", "0")
+		if got := viewport("-1e12,-1e12,1e12,1e12"); len(got) != 100 || got[0] != "0" || got[99] != "99" {
+			t.Fatalf("whole board: expected all shapes in order, got %v", got)
+		}
+	}
+
+	for _, bbox := range []string{"", "1,2,3", "10,10,0,0", "a,b,c,d", "0,0,NaN,1"} {
+		if status, _ := doJSON(t, http.MethodGet, "/api/boards/"+boardID+"/shapes?bbox="+bbox, token, nil); status != http.StatusBadRequest {
+			t.Fatalf("bbox %q: expected 400, got %d", bbox, status)
+		}
+	}
+	if status, _ := doJSON(t, http.MethodGet, "/api/boards/"+boardID+"/shapes?bbox=0,0,1,1", strangerToken, nil); status != http.StatusNotFound {
+		t.Fatalf("stranger: expected 404, got %d", status)
+	}
+}
+
+func TestShapeHitTestAndMinimap(t *testing.T) {
+	requireHarness(t)
+
+	_, token := seedUser(t, "")
+	_, strangerToken := seedUser(t, "")
+	boardID := seedBoard(t, token)
+	doJSON(t, http.MethodPut, "/api/boards/"+boardID, token, gin.H{"board": gin.H{
+		"scale": 1.0, "position": gin.H{"x": 0, "y": 0},
+		"shapes": []interface{}{
+			gin.H{"id": "box", "type": "rect", "x": 0, "y": 0, "width": 100, "height": 100},
+			gin.H{"id": "ring", "type": "circle", "x": 50, "y": 50, "radius": 20},
+			gin.H{"id": "stroke", "type": "pen", "points": []float64{200, 0, 300, 100}, "strokeWidth": 4},
+		},
+	}})
+
+	hit := func(query string) []string {
+		t.Helper()
+		status, body := doJSON(t, http.MethodGet, "/api/boards/"+boardID+"/shapes/hit?"+query, token, nil)
+		if status != http.StatusOK {
+			t.Fatalf("hit %s: expected 200, got %d: %v", query, status, body)
+		}
+		ids := []string{}
+		for _, shape := range body["shapes"].([]interface{}) {
+			ids = append(ids, shape.(map[string]interface{})["id"].(string))
+		}
+		return ids
+	}
+
+	// Topmost first; strokes are hit along their path, not their box
+	for query, want := range map[string]string{
+		"points=50,50":                "ring,box",
+		"points=5,5":                  "box",
+		"points=251,49":               "stroke",
+		"points=290,10":               "",
+		"points=290,10&radius=60":     "stroke",
+		"points=5,5,250,50,900,900":   "stroke,box",
+		"points=-10,50&radius=10":     "box",
+		"points=-10,50&radius=9.5":    "",
+		"points=150,50&radius=0":      "",
+		"points=150,50,150,50,150,50": "",
+	} {
+		if got := strings.Join(hit(query), ","); got != want {
+			t.Fatalf("hit %s: expected %q, got %q", query, want, got)
+		}
+	}
+	for _, query := range []string{"", "points=1", "points=1,2&radius=-1", "points=a,b"} {
+		if status, _ := doJSON(t, http.MethodGet, "/api/boards/"+boardID+"/shapes/hit?"+query, token, nil); status != http.StatusBadRequest {
+			t.Fatalf("hit %q: expected 400, got %d", query, status)
+		}
+	}
+
+	// Shapes span 0,0 to 300,100: the box and ring on the left, the stroke
+	// on the right
+	status, body := doJSON(t, http.MethodGet, "/api/boards/"+boardID+"/minimap?cols=3&rows=1", token, nil)
+	if status != http.StatusOK {
+		t.Fatalf("minimap: expected 200, got %d: %v", status, body)
+	}
+	minimap := body["minimap"].(map[string]interface{})
+	if minimap["width"] != 300.0 || minimap["height"] != 100.0 || minimap["shapes"] != 3.0 {
+		t.Fatalf("minimap: unexpected extent %v", minimap)
+	}
+	if cells := fmt.Sprint(minimap["cells"]); cells != "[2 1 1]" {
+		t.Fatalf("minimap: expected cells [2 1 1], got %s", cells)
+	}
+	if status, _ := doJSON(t, http.MethodGet, "/api/boards/"+boardID+"/minimap?cols=1000", token, nil); status != http.StatusBadRequest {
+		t.Fatalf("huge minimap: expected 400, got %d", status)
+	}
+	if status, _ := doJSON(t, http.MethodGet, "/api/boards/"+boardID+"/minimap", strangerToken, nil); status != http.StatusNotFound {
+		t.Fatalf("stranger minimap: expected 404, got %d", status)
+	}
+}
+
+func TestBoardTiles(t *testing.T) {
+	requireHarness(t)
+
+	_, token := seedUser(t, "")
+	_, strangerToken := seedUser(t, "")
+	boardID := seedBoard(t, token)
+	save := func(x int) {
+		t.Helper()
+		status, body := doJSON(t, http.MethodPut, "/api/boards/"+boardID, token, gin.H{"board": gin.H{
+			"scale": 1.0, "position": gin.H{"x": 0, "y": 0},
+			"shapes": []interface{}{
+				gin.H{"id": "box", "type": "rect", "x": x, "y": 10, "width": 100, "height": 100, "fill": "#ff0000"},
+			},
+		}})
+		if status != http.StatusOK {
+			t.Fatalf("save: expected 200, got %d: %v", status, body)
+		}
+	}
+	getTile := func(t *testing.T, token, tile, etag string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/api/boards/"+boardID+"/tiles/"+tile, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	// red reports whether the pixel of the tile is mostly red
+	red := func(tile string, x, y int) bool {
+		t.Helper()
+		w := getTile(t, token, tile, "")
+		if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/png" {
+			t.Fatalf("tile %s: expected a PNG, got %d %q", tile, w.Code, w.Header().Get("Content-Type"))
+		}
+		img, err := png.Decode(w.Body)
+		if err != nil {
+			t.Fatalf("tile %s: %v", tile, err)
+		}
+		if size := img.Bounds().Size(); size.X != 256 || size.Y != 256 {
+			t.Fatalf("tile %s: expected 256x256, got %v", tile, size)
+		}
+		r, g, _, _ := img.At(x, y).RGBA()
+		return r > 0xc000 && g < 0x4000
+	}
+
+	// One board unit per pixel at zoom 8, a quarter at zoom 6
+	save(10)
+	if !red("8/0/0", 50, 50) || red("8/0/0", 200, 50) || red("8/1/0", 50, 50) || red("8/-1/0.png", 250, 50) {
+		t.Fatalf("zoom 8: expected the box in the first tile only")
+	}
+	if !red("6/0/0", 15, 15) || red("6/0/0", 40, 15) {
+		t.Fatalf("zoom 6: expected the box scaled down")
+	}
+
+	w := getTile(t, token, "8/0/0", "")
+	etag := w.Header().Get("ETag")
+	if etag == "" || w.Header().Get("Cache-Control") == "" {
+		t.Fatalf("tile: expected caching headers, got %v", w.Header())
+	}
+	if w := getTile(t, token, "8/0/0", etag); w.Code != http.StatusNotModified {
+		t.Fatalf("tile revalidation: expected 304, got %d", w.Code)
+	}
+
+	// Moving the box redraws its tiles
+	save(300)
+	if w := getTile(t, token, "8/0/0", etag); w.Code != http.StatusOK || w.Header().Get("ETag") == etag {
+		t.Fatalf("tile after save: expected a new tile, got %d with ETag %s", w.Code, w.Header().Get("ETag"))
+	}
+	if red("8/0/0", 50, 50) || !red("8/1/0", 100, 50) {
+		t.Fatalf("tile after save: expected the box in the second tile")
+	}
+
+	for _, tile := range []string{"9/0/0", "-1/0/0", "8/a/0", "0/1000000/0"} {
+		if w := getTile(t, token, tile, ""); w.Code != http.StatusBadRequest {
+			t.Fatalf("tile %s: expected 400, got %d", tile, w.Code)
+		}
+	}
+	if w := getTile(t, strangerToken, "8/0/0", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("stranger tile: expected 404, got %d", w.Code)
+	}
+}
+
+func TestBoardCompression(t *testing.T) {
+	requireHarness(t)
+
+	models.BoardCompressionThreshold.Store(1)
+	t.Cleanup(func() { models.BoardCompressionThreshold.Store(0) })
+
+	_, token := seedUser(t, "")
+	boardID := seedBoard(t, token)
+	objectID, _ := primitive.ObjectIDFromHex(boardID)
+
+	stored := func() bson.M {
+		t.Helper()
+		var doc bson.M
+		err := database.GetCollection("boards").FindOne(context.Background(), bson.M{"_id": objectID}).Decode(&doc)
+		if err != nil {
+			t.Fatalf("failed to read stored board: %v", err)
+		}
+		return doc
+	}
+	if doc := stored(); doc["board"] != nil || doc["boardEncoding"] != models.BoardEncodingZstd {
+		t.Fatalf("create: expected compressed contents, got %v", doc)
+	}
+
+	status, response := doJSON(t, http.MethodPatch, "/api/boards/"+boardID, token, gin.H{"operations": []gin.H{
+		{"op": models.OpAddShape, "shape": gin.H{"id": "note", "type": "sticky", "x": 10, "y": 10, "text": "hi"}},
+		{"op": models.OpSetScale, "scale": 2},
+	}})
+	if status != http.StatusOK || response["version"].(float64) != 3 {
+		t.Fatalf("patch: expected 200 at version 3, got %d (%v)", status, response)
+	}
+
+	_, response = doJSON(t, http.MethodGet, "/api/boards/"+boardID, token, nil)
+	board := response["board"].(map[string]interface{})
+	if shapes := board["shapes"].([]interface{}); len(shapes) != 2 || board["scale"].(float64) != 2 {
+		t.Fatalf("get: expected the patched contents, got %v", board)
+	}
+
+	// Converted back to a document for a rollback
+	models.BoardCompressionThreshold.Store(0)
+	if _, err := libs.RecompressBoards(context.Background(), repository.NewMongoBoards(), true, false, nil); err != nil {
+		t.Fatalf("decompress: %v", err)
+	}
+	if doc := stored(); doc["board"] == nil || doc["boardZstd"] != nil {
+		t.Fatalf("decompress: expected plain contents, got %v", doc)
+	}
+	_, response = doJSON(t, http.MethodGet, "/api/boards/"+boardID, token, nil)
+	if shapes := response["board"].(map[string]interface{})["shapes"].([]interface{}); len(shapes) != 2 {
+		t.Fatalf("get after decompress: expected 2 shapes, got %v", shapes)
+	}
+}
@@ -0,0 +1,71 @@
+//go:build integration
+
+package integration
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestBreakoutLifecycle(t *testing.T) {
+	requireHarness(t)
+
+	_, ownerToken := seedUser(t, "")
+	first, firstToken := seedUser(t, "")
+	second, _ := seedUser(t, "")
+	boardID := seedBoard(t, ownerToken)
+
+	status, response := doJSON(t, http.MethodPost, "/api/boards/"+boardID+"/breakouts", ownerToken, gin.H{
+		"groups": []gin.H{
+			{"participants": []string{first.Email}},
+			{"participants": []string{second.ID.Hex()}},
+		},
+		"shapeIds": []string{"test-shape-1"},
+	})
+	if status != http.StatusCreated {
+		t.Fatalf("create: expected 201, got %d (%v)", status, response)
+	}
+	breakouts := response["breakouts"].([]interface{})
+	if len(breakouts) != 2 {
+		t.Fatalf("create: expected 2 breakouts, got %d", len(breakouts))
+	}
+	firstBreakout := breakouts[0].(map[string]interface{})["_id"].(string)
+
+	// Participants get the breakout, not the parent
+	status, _ = doJSON(t, http.MethodGet, "/api/boards/"+boardID+"/breakouts", firstToken, nil)
+	if status != http.StatusNotFound {
+		t.Fatalf("list: expected 404 without parent access, got %d", status)
+	}
+	_, response = doJSON(t, http.MethodGet, "/api/boards/"+boardID+"/breakouts", ownerToken, nil)
+	if response["count"].(float64) != 2 {
+		t.Fatalf("list: expected 2 breakouts for owner, got %v", response["count"])
+	}
+
+	// A participant adds a note to their breakout
+	_, response = doJSON(t, http.MethodGet, "/api/boards/"+firstBreakout, firstToken, nil)
+	data := response["board"].(map[string]interface{})
+	data["shapes"] = append(data["shapes"].([]interface{}), gin.H{"id": "idea-1", "type": "sticky", "text": "idea"})
+	status, _ = doJSON(t, http.MethodPut, "/api/boards/"+firstBreakout, firstToken, gin.H{"board": data})
+	if status != http.StatusOK {
+		t.Fatalf("participant update: expected 200, got %d", status)
+	}
+
+	// Only the owner can merge
+	status, _ = doJSON(t, http.MethodPost, "/api/boards/"+boardID+"/breakouts/merge", firstToken, gin.H{})
+	if status != http.StatusNotFound {
+		t.Fatalf("participant merge: expected 404, got %d", status)
+	}
+
+	status, response = doJSON(t, http.MethodPost, "/api/boards/"+boardID+"/breakouts/merge", ownerToken, gin.H{
+		"shapeIds": []string{"idea-1"},
+	})
+	if status != http.StatusOK || response["merged"].(float64) != 1 {
+		t.Fatalf("merge: expected 1 merged shape, got %d (%v)", status, response)
+	}
+	shapes := response["board"].(map[string]interface{})["shapes"].([]interface{})
+	if len(shapes) != 2 {
+		t.Fatalf("merge: expected 2 shapes on parent, got %d", len(shapes))
+	}
+}
@@ -0,0 +1,75 @@
+//go:build integration
+
+package integration
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestBulkBoards(t *testing.T) {
+	requireHarness(t)
+
+	_, token := seedUser(t, "")
+	doomed := seedBoard(t, token)
+	filed := seedBoard(t, token)
+	tagged := seedBoard(t, token)
+	_, otherToken := seedUser(t, "")
+	others := seedBoard(t, otherToken)
+
+	_, response := doJSON(t, http.MethodPost, "/api/folders", token, gin.H{"name": "Cleanup"})
+	folderID := response["folder"].(map[string]interface{})["_id"].(string)
+	doJSON(t, http.MethodPatch, "/api/boards/"+tagged+"/meta", token, gin.H{"tags": []string{"draft", "retro"}})
+
+	status, response := doJSON(t, http.MethodPost, "/api/boards/bulk", token, gin.H{"operations": []gin.H{
+		{"op": "delete", "boardId": doomed},
+		{"op": "move", "boardId": filed, "folderId": folderID},
+		{"op": "tag", "boardId": tagged, "addTags": []string{"Q3"}, "removeTags": []string{"draft"}},
+		{"op": "delete", "boardId": others},
+		{"op": "tag", "boardId": filed, "addTags": []string{"q3"}},
+		{"op": "move", "boardId": tagged},
+	}})
+	if status != http.StatusOK {
+		t.Fatalf("bulk: expected 200, got %d (%v)", status, response)
+	}
+	results := response["results"].([]interface{})
+	expected := []float64{http.StatusOK, http.StatusOK, http.StatusOK, http.StatusNotFound, http.StatusBadRequest, http.StatusBadRequest}
+	for i, want := range expected {
+		if got := results[i].(map[string]interface{})["status"]; got != want {
+			t.Errorf("operation %d: expected %v, got %v (%v)", i, want, got, results[i])
+		}
+	}
+	if response["succeeded"] != 3.0 || response["failed"] != 3.0 {
+		t.Fatalf("bulk: expected 3 succeeded and 3 failed, got %v", response)
+	}
+
+	if status, _ := doJSON(t, http.MethodGet, "/api/boards/"+doomed, token, nil); status != http.StatusNotFound {
+		t.Fatalf("deleted board: expected 404, got %d", status)
+	}
+	if status, _ := doJSON(t, http.MethodGet, "/api/boards/"+others, otherToken, nil); status != http.StatusOK {
+		t.Fatalf("someone else's board: expected it kept, got %d", status)
+	}
+	_, response = doJSON(t, http.MethodGet, "/api/boards", token, nil)
+	for _, item := range response["boards"].([]interface{}) {
+		board := item.(map[string]interface{})
+		switch board["_id"] {
+		case doomed:
+			t.Fatal("deleted board: expected it gone from the list")
+		case filed:
+			if board["folderId"] != folderID {
+				t.Fatalf("moved board: expected it in the folder, got %v", board["folderId"])
+			}
+		case tagged:
+			if tags := board["tags"].([]interface{}); len(tags) != 2 || tags[0] != "q3" || tags[1] != "retro" {
+				t.Fatalf("tagged board: expected q3 and retro, got %v", tags)
+			}
+		}
+	}
+
+	status, _ = doJSON(t, http.MethodPost, "/api/boards/bulk", token, gin.H{"operations": []gin.H{{"op": "rename", "boardId": filed}}})
+	if status != http.StatusBadRequest {
+		t.Fatalf("unknown operation: expected 400, got %d", status)
+	}
+}
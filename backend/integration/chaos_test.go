@@ -0,0 +1,92 @@
+//go:build integration
+
+package integration
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/repository"
+	"github.com/sarwanazhar/boardsar/backend/routes"
+)
+
+func TestChaosFaultInjection(t *testing.T) {
+	requireHarness(t)
+
+	_, token := seedUser(t, "")
+
+	// Off by default: the routes don't exist
+	if status, _ := doJSON(t, http.MethodGet, "/debug/chaos", "", nil); status != http.StatusNotFound {
+		t.Fatalf("chaos routes without CHAOS_MODE: expected 404, got %d", status)
+	}
+
+	// and never in release mode
+	defer func(enabled bool) { libs.Settings().ChaosMode = enabled }(libs.Settings().ChaosMode)
+	libs.Settings().ChaosMode = true
+	gin.SetMode(gin.ReleaseMode)
+	enabledInRelease := libs.ChaosEnabled()
+	gin.SetMode(gin.TestMode)
+	if enabledInRelease {
+		t.Fatal("expected chaos mode to stay off in release mode")
+	}
+
+	chaosRouter := routes.NewRouter(cfg, repository.NewMongoBoards())
+	defer libs.ClearChaosRules()
+	send := func(method, path, token string, body interface{}) int {
+		raw, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, path, bytes.NewReader(raw))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		chaosRouter.ServeHTTP(w, req)
+		return w.Code
+	}
+	setRule := func(rule gin.H) {
+		t.Helper()
+		if status := send(http.MethodPut, "/debug/chaos", "", rule); status != http.StatusOK {
+			t.Fatalf("set rule %v: expected 200, got %d", rule, status)
+		}
+	}
+
+	setRule(gin.H{"route": "GET /api/boards", "errorRate": 1})
+	if status := send(http.MethodGet, "/api/boards", token, nil); status != http.StatusInternalServerError {
+		t.Fatalf("errorRate 1: expected 500, got %d", status)
+	}
+	// Other routes are left alone
+	if status := send(http.MethodGet, "/me", token, nil); status != http.StatusOK {
+		t.Fatalf("route without a rule: expected 200, got %d", status)
+	}
+
+	setRule(gin.H{"route": "GET /api/boards", "mongoFailureRate": 1})
+	if status := send(http.MethodGet, "/api/boards", token, nil); status != http.StatusServiceUnavailable {
+		t.Fatalf("mongoFailureRate 1: expected 503, got %d", status)
+	}
+
+	setRule(gin.H{"route": "*", "latencyMs": 100})
+	start := time.Now()
+	if status := send(http.MethodGet, "/me", token, nil); status != http.StatusOK {
+		t.Fatalf("latency rule: expected 200, got %d", status)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Fatalf("latency rule: expected at least 100ms, took %v", elapsed)
+	}
+
+	if status := send(http.MethodPut, "/debug/chaos", "", gin.H{"route": "*", "errorRate": 2}); status != http.StatusBadRequest {
+		t.Fatalf("errorRate above 1: expected 400, got %d", status)
+	}
+
+	if status := send(http.MethodDelete, "/debug/chaos", "", nil); status != http.StatusOK {
+		t.Fatalf("clear: expected 200, got %d", status)
+	}
+	if status := send(http.MethodGet, "/api/boards", token, nil); status != http.StatusOK {
+		t.Fatalf("after clearing: expected 200, got %d", status)
+	}
+}
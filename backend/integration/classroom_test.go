@@ -0,0 +1,192 @@
+//go:build integration
+
+package integration
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestClassrooms(t *testing.T) {
+	requireHarness(t)
+
+	teacher, token := seedUser(t, "")
+	alice, aliceToken := seedUser(t, "")
+	bob, bobToken := seedUser(t, "")
+	boardID := seedBoard(t, token)
+
+	status, response := doJSON(t, http.MethodPost, "/api/boards/"+boardID+"/save-as-template", token, gin.H{"name": "Worksheet"})
+	if status != http.StatusCreated {
+		t.Fatalf("save template: expected 201, got %d (%v)", status, response)
+	}
+	templateID := response["template"].(map[string]interface{})["_id"].(string)
+
+	status, response = doJSON(t, http.MethodPost, "/api/classrooms", token, gin.H{
+		"name":       "Period 3",
+		"templateId": templateID,
+		"roster":     "email\n" + alice.Email + "\nnobody@example.com\n" + teacher.Email,
+	})
+	if status != http.StatusCreated {
+		t.Fatalf("create classroom: expected 201, got %d (%v)", status, response)
+	}
+	classroomID := response["classroom"].(map[string]interface{})["id"].(string)
+	statuses := []string{}
+	for _, result := range response["results"].([]interface{}) {
+		statuses = append(statuses, result.(map[string]interface{})["status"].(string))
+	}
+	if !reflect.DeepEqual(statuses, []string{"added", "not_found", "skipped"}) {
+		t.Fatalf("create classroom: expected added, not_found and skipped, got %v", statuses)
+	}
+	aliceBoard := response["results"].([]interface{})[0].(map[string]interface{})["boardId"].(string)
+
+	// Only the student and the teacher can open the student's board
+	if status, _ := doJSON(t, http.MethodGet, "/api/boards/"+aliceBoard, aliceToken, nil); status != http.StatusOK {
+		t.Fatalf("student opens their board: expected 200, got %d", status)
+	}
+	if status, _ := doJSON(t, http.MethodGet, "/api/boards/"+aliceBoard, bobToken, nil); status != http.StatusNotFound {
+		t.Fatalf("another student opens it: expected 404, got %d", status)
+	}
+
+	status, response = doJSON(t, http.MethodPost, "/api/classrooms/"+classroomID+"/students", token, gin.H{"emails": []string{bob.Email, alice.Email}})
+	if status != http.StatusOK {
+		t.Fatalf("add students: expected 200, got %d (%v)", status, response)
+	}
+	if students := response["classroom"].(map[string]interface{})["students"].([]interface{}); len(students) != 2 {
+		t.Fatalf("add students: expected two students on the roster, got %v", students)
+	}
+
+	status, _ = doJSON(t, http.MethodPut, "/api/boards/"+aliceBoard, aliceToken, gin.H{"board": gin.H{"shapes": []gin.H{
+		{"id": "a", "type": "text", "x": 0, "y": 0, "text": "My answer"},
+	}}})
+	if status != http.StatusOK {
+		t.Fatalf("student saves: expected 200, got %d", status)
+	}
+
+	if status, _ := doJSON(t, http.MethodGet, "/api/classrooms/"+classroomID+"/dashboard", aliceToken, nil); status != http.StatusNotFound {
+		t.Fatalf("dashboard as a student: expected 404, got %d", status)
+	}
+	status, response = doJSON(t, http.MethodGet, "/api/classrooms/"+classroomID+"/dashboard", token, nil)
+	if status != http.StatusOK {
+		t.Fatalf("dashboard: expected 200, got %d (%v)", status, response)
+	}
+	counts := response["counts"].(map[string]interface{})
+	if counts["students"] != 2.0 || counts["started"] != 1.0 {
+		t.Fatalf("dashboard: expected one of two students started, got %v", counts)
+	}
+}
+
+func TestParseRoster(t *testing.T) {
+	emails := libs.ParseRoster(
+		[]string{" a@example.com "},
+		"Email,Name\r\nb@example.com;\"c@example.com\"\tA@EXAMPLE.com\nnot an email\n",
+	)
+	if want := []string{"a@example.com", "b@example.com", "c@example.com"}; !reflect.DeepEqual(emails, want) {
+		t.Fatalf("expected %v, got %v", want, emails)
+	}
+}
+
+func TestClassroomReview(t *testing.T) {
+	requireHarness(t)
+
+	_, token := seedUser(t, "")
+	alice, aliceToken := seedUser(t, "")
+	boardID := seedBoard(t, token)
+
+	status, response := doJSON(t, http.MethodPost, "/api/boards/"+boardID+"/save-as-template", token, gin.H{"name": "Worksheet"})
+	if status != http.StatusCreated {
+		t.Fatalf("save template: expected 201, got %d (%v)", status, response)
+	}
+	templateID := response["template"].(map[string]interface{})["_id"].(string)
+	status, response = doJSON(t, http.MethodPost, "/api/classrooms", token, gin.H{"name": "Period 4", "templateId": templateID, "emails": []string{alice.Email}})
+	if status != http.StatusCreated {
+		t.Fatalf("create classroom: expected 201, got %d (%v)", status, response)
+	}
+	classroomID := response["classroom"].(map[string]interface{})["id"].(string)
+	aliceBoard := response["results"].([]interface{})[0].(map[string]interface{})["boardId"].(string)
+	student := "/api/classrooms/" + classroomID + "/students/" + alice.ID.Hex()
+	save := gin.H{"board": gin.H{"shapes": []gin.H{{"id": "a", "type": "text", "x": 0, "y": 0, "text": "My answer"}}}}
+
+	// Grading before submission is out of order
+	if status, _ := doJSON(t, http.MethodPut, student+"/review", token, gin.H{"status": "in_review"}); status != http.StatusConflict {
+		t.Fatalf("review before submission: expected 409, got %d", status)
+	}
+	if status, _ := doJSON(t, http.MethodPost, "/api/classrooms/"+classroomID+"/submission", aliceToken, nil); status != http.StatusOK {
+		t.Fatalf("submit: expected 200, got %d", status)
+	}
+	if status, _ := doJSON(t, http.MethodPut, "/api/boards/"+aliceBoard, aliceToken, save); status != http.StatusForbidden {
+		t.Fatalf("edit after submission: expected 403, got %d", status)
+	}
+
+	// Students can't review, comment or see the grades
+	if status, _ := doJSON(t, http.MethodPut, student+"/review", aliceToken, gin.H{"status": "graded", "grade": "A"}); status != http.StatusNotFound {
+		t.Fatalf("student grades: expected 404, got %d", status)
+	}
+	if status, _ := doJSON(t, http.MethodPost, student+"/comments", aliceToken, gin.H{"text": "Great"}); status != http.StatusNotFound {
+		t.Fatalf("student comments: expected 404, got %d", status)
+	}
+
+	if status, _ := doJSON(t, http.MethodPut, student+"/review", token, gin.H{"status": "in_review"}); status != http.StatusOK {
+		t.Fatalf("start review: expected 200, got %d", status)
+	}
+	if status, _ := doJSON(t, http.MethodDelete, "/api/classrooms/"+classroomID+"/submission", aliceToken, nil); status != http.StatusConflict {
+		t.Fatalf("withdraw during review: expected 409, got %d", status)
+	}
+	if status, _ := doJSON(t, http.MethodPost, student+"/comments", token, gin.H{"text": "Show your working", "shapeId": "a"}); status != http.StatusCreated {
+		t.Fatalf("comment: expected 201, got %d", status)
+	}
+	if status, _ := doJSON(t, http.MethodPut, student+"/review", token, gin.H{"status": "graded"}); status != http.StatusBadRequest {
+		t.Fatalf("grade without a grade: expected 400, got %d", status)
+	}
+	if status, _ := doJSON(t, http.MethodPut, student+"/review", token, gin.H{"status": "graded", "grade": "B+", "feedback": "Good"}); status != http.StatusOK {
+		t.Fatalf("grade: expected 200, got %d", status)
+	}
+
+	status, response = doJSON(t, http.MethodGet, "/api/classrooms/assignments", aliceToken, nil)
+	if status != http.StatusOK {
+		t.Fatalf("assignments: expected 200, got %d", status)
+	}
+	assignment := response["assignments"].([]interface{})[0].(map[string]interface{})
+	if assignment["status"] != "graded" || assignment["grade"] != "B+" || assignment["comments"] != nil {
+		t.Fatalf("assignments: expected the grade without comments, got %v", assignment)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/classrooms/"+classroomID+"/grades", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), alice.Email+","+alice.ID.Hex()) || !strings.Contains(w.Body.String(), ",graded,") {
+		t.Fatalf("grades: expected alice's grade, got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestWriteGradesCSV(t *testing.T) {
+	gradedAt := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	classroom := &models.Classroom{Students: []models.ClassroomStudent{
+		{UserID: primitive.NilObjectID, BoardID: primitive.NilObjectID, Email: "a@example.com", Status: models.ReviewGraded, Grade: "=1+1", Feedback: "Good, mostly", GradedAt: &gradedAt},
+		{UserID: primitive.NilObjectID, BoardID: primitive.NilObjectID, Email: "b@example.com", Status: models.ReviewInReview, Grade: "C"},
+		{UserID: primitive.NilObjectID, BoardID: primitive.NilObjectID, Email: "c@example.com"},
+	}}
+
+	var out bytes.Buffer
+	if err := libs.WriteGradesCSV(&out, classroom); err != nil {
+		t.Fatal(err)
+	}
+	nilID := primitive.NilObjectID.Hex()
+	want := "email,userId,boardId,status,submittedAt,gradedAt,grade,feedback,comments\n" +
+		"a@example.com," + nilID + "," + nilID + ",graded,,2026-10-01T12:00:00Z,'=1+1,\"Good, mostly\",0\n" +
+		"b@example.com," + nilID + "," + nilID + ",in_review,,,,,0\n" +
+		"c@example.com," + nilID + "," + nilID + ",assigned,,,,,0\n"
+	if out.String() != want {
+		t.Fatalf("expected\n%s\ngot\n%s", want, out.String())
+	}
+}
@@ -0,0 +1,55 @@
+//go:build integration
+
+package integration
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestClusterNotes(t *testing.T) {
+	requireHarness(t)
+
+	_, token := seedUser(t, "")
+	boardID := seedBoard(t, token)
+
+	note := func(id, text string, x float64) gin.H {
+		return gin.H{"id": id, "type": "sticky", "text": text, "x": x, "y": 0, "width": 100, "height": 100}
+	}
+	doJSON(t, http.MethodPut, "/api/boards/"+boardID, token, gin.H{"board": gin.H{
+		"scale":    1.0,
+		"position": gin.H{"x": 0, "y": 0},
+		"shapes": []gin.H{
+			note("a", "Improve onboarding emails", 0),
+			note("b", "Onboarding flow is confusing", 200),
+			note("c", "Pricing page too expensive", 400),
+			note("d", "Reduce pricing for students", 600),
+			note("e", "Coffee machine", 800),
+		},
+	}})
+
+	status, response := doJSON(t, http.MethodPost, "/api/boards/"+boardID+"/cluster", token, nil)
+	if status != http.StatusOK {
+		t.Fatalf("cluster: expected 200, got %d (%v)", status, response)
+	}
+	if response["method"] != "tfidf" {
+		t.Fatalf("cluster: expected tfidf fallback, got %v", response["method"])
+	}
+	clusters := response["clusters"].([]interface{})
+	if len(clusters) != 2 {
+		t.Fatalf("cluster: expected 2 clusters, got %v", clusters)
+	}
+	if frame := clusters[0].(map[string]interface{})["frame"]; frame == nil {
+		t.Fatalf("cluster: expected a frame for positioned notes")
+	}
+	if unclustered := response["unclustered"].([]interface{}); len(unclustered) != 1 || unclustered[0] != "e" {
+		t.Fatalf("cluster: expected e to be unclustered, got %v", unclustered)
+	}
+
+	status, _ = doJSON(t, http.MethodPost, "/api/boards/"+boardID+"/cluster", token, gin.H{"threshold": 2})
+	if status != http.StatusBadRequest {
+		t.Fatalf("cluster: expected 400 for invalid threshold, got %d", status)
+	}
+}
@@ -0,0 +1,152 @@
+//go:build integration
+
+package integration
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+)
+
+func gzipBytes(t testing.TB, data []byte) []byte {
+	t.Helper()
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	if _, err := writer.Write(data); err != nil {
+		t.Fatalf("gzip: %v", err)
+	}
+	writer.Close()
+	return compressed.Bytes()
+}
+
+func TestGzipBoards(t *testing.T) {
+	requireHarness(t)
+
+	_, token := seedUser(t, "")
+	boardID := seedBoard(t, token)
+
+	// A gzipped save is read as the board it expands to
+	raw, _ := json.Marshal(gin.H{"board": largeBoardData(200)})
+	req := httptest.NewRequest(http.MethodPut, "/api/boards/"+boardID, bytes.NewReader(gzipBytes(t, raw)))
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("gzipped put: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// And the board comes back gzipped when the client takes it
+	req = httptest.NewRequest(http.MethodGet, "/api/boards/"+boardID, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("gzipped get: expected a gzipped 200, got %d %q", w.Code, w.Header().Get("Content-Encoding"))
+	}
+	reader, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatalf("gzipped get: %v", err)
+	}
+	var body struct {
+		Board struct {
+			Shapes []interface{} `json:"shapes"`
+		} `json:"board"`
+	}
+	if err := json.NewDecoder(reader).Decode(&body); err != nil || len(body.Board.Shapes) != 200 {
+		t.Fatalf("gzipped get: expected the 200 shapes, got %v", err)
+	}
+
+	// Bodies over MAX_REQUEST_BODY are turned away
+	defer func(limit int64) { libs.Settings().MaxRequestBody = limit }(libs.Settings().MaxRequestBody)
+	libs.Settings().MaxRequestBody = 4 << 10
+	status, _ := doJSON(t, http.MethodPut, "/api/boards/"+boardID, token, gin.H{"board": largeBoardData(200)})
+	if status != http.StatusRequestEntityTooLarge {
+		t.Fatalf("oversized put: expected 413, got %d", status)
+	}
+}
+
+// TestGzipMiddleware checks request decompression, response compression
+// and body limits on a bare router, without a database
+func TestGzipMiddleware(t *testing.T) {
+	defer func(limit int64) { libs.Settings().MaxRequestBody = limit }(libs.Settings().MaxRequestBody)
+	libs.Settings().MaxRequestBody = 64 << 10
+
+	engine := gin.New()
+	engine.Use(libs.BodyLimitMiddleware(), libs.GzipMiddleware())
+	engine.POST("/echo", func(c *gin.Context) {
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.Data(http.StatusOK, "application/json", body)
+	})
+	send := func(body []byte, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/echo", bytes.NewReader(body))
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		return w
+	}
+
+	large := []byte(`{"text":"` + strings.Repeat("sticky note ", 2000) + `"}`)
+	small := []byte(`{"text":"hi"}`)
+
+	w := send(gzipBytes(t, large), map[string]string{"Content-Encoding": "gzip"})
+	if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), large) {
+		t.Fatalf("gzipped request: expected the body decompressed, got %d", w.Code)
+	}
+
+	w = send(large, map[string]string{"Accept-Encoding": "br, gzip"})
+	if w.Header().Get("Content-Encoding") != "gzip" || !strings.Contains(w.Header().Get("Vary"), "Accept-Encoding") {
+		t.Fatalf("large response: expected it gzipped, got %q", w.Header().Get("Content-Encoding"))
+	}
+	reader, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatalf("large response: %v", err)
+	}
+	if unzipped, _ := io.ReadAll(reader); !bytes.Equal(unzipped, large) {
+		t.Fatal("large response: expected it to decompress to the body")
+	}
+
+	for name, headers := range map[string]map[string]string{
+		"small response":  {"Accept-Encoding": "gzip"},
+		"gzip refused":    {"Accept-Encoding": "gzip;q=0"},
+		"no gzip offered": {},
+	} {
+		body := large
+		if name == "small response" {
+			body = small
+		}
+		if w := send(body, headers); w.Header().Get("Content-Encoding") != "" || !bytes.Equal(w.Body.Bytes(), body) {
+			t.Fatalf("%s: expected it sent as is, got %q", name, w.Header().Get("Content-Encoding"))
+		}
+	}
+
+	// Too large as sent, or once expanded
+	if w := send(bytes.Repeat([]byte("x"), 65<<10), nil); w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("oversized request: expected 413, got %d", w.Code)
+	}
+	if w := send(gzipBytes(t, bytes.Repeat([]byte("x"), 1<<20)), map[string]string{"Content-Encoding": "gzip"}); w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("gzip bomb: expected 413, got %d", w.Code)
+	}
+	if w := send([]byte("not gzip"), map[string]string{"Content-Encoding": "gzip"}); w.Code != http.StatusBadRequest {
+		t.Fatalf("invalid gzip: expected 400, got %d", w.Code)
+	}
+	if w := send(small, map[string]string{"Content-Encoding": "deflate"}); w.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf("deflate: expected 415, got %d", w.Code)
+	}
+}
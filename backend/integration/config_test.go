@@ -0,0 +1,131 @@
+//go:build integration
+
+package integration
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sarwanazhar/boardsar/backend/config"
+)
+
+func TestConfigLoad(t *testing.T) {
+	t.Setenv("MONGODB_URI", "mongodb://localhost:27017")
+	t.Setenv("JWT_SECRET", "a-long-enough-test-secret")
+	t.Setenv("ACCESS_TOKEN_TTL", "5m")
+	t.Setenv("DB_TIMEOUT", "10s")
+	t.Setenv("BOARD_CACHE_TTL", "0")
+	t.Setenv("BOARD_MAX_SIZE", "1048576")
+	t.Setenv("MAX_REQUEST_BODY", "8388608")
+	t.Setenv("COOKIE_SECURE", "true")
+	t.Setenv("COOKIE_SAMESITE", "strict")
+	t.Setenv("API_URL", "https://api.example.com/")
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://a.example.com, https://*.example.com")
+	t.Setenv("PASSWORD_RESET_TTL", "30m")
+	t.Setenv("DELETION_GRACE_PERIOD", "off")
+	t.Setenv("DELETION_INTERVAL", "5m")
+	t.Setenv("RATE_LIMIT_AUTH", "5/10s")
+	t.Setenv("RATE_LIMIT_BOARDS", "off")
+	t.Setenv("WORKER_LIMIT_EXPORT", "3")
+	t.Setenv("WORKER_QUEUE_AI", "0")
+	t.Setenv("BOARD_LIMIT", "0")
+	t.Setenv("BOARD_COMPRESSION", "off")
+	t.Setenv("ASSET_STORAGE", "S3")
+	t.Setenv("S3_BUCKET", "boardsar-assets")
+	t.Setenv("S3_ACCESS_KEY_ID", "test-key")
+	t.Setenv("S3_SECRET_ACCESS_KEY", "test-secret")
+	t.Setenv("S3_ENDPOINT", "https://storage.example.com/")
+	t.Setenv("MAGIC_LINK_SIGNUP", "true")
+	t.Setenv("WEBAUTHN_ORIGINS", "https://app.example.com/, https://admin.example.com")
+
+	loaded, err := config.Load()
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if loaded.AccessTokenTTL != 5*time.Minute || loaded.RefreshTokenTTL != config.DefaultRefreshTokenTTL {
+		t.Fatalf("load: unexpected token lifetimes %v and %v", loaded.AccessTokenTTL, loaded.RefreshTokenTTL)
+	}
+	if loaded.DBTimeout != 10*time.Second {
+		t.Fatalf("load: unexpected database timeout %v", loaded.DBTimeout)
+	}
+	if loaded.BoardCacheTTL != 0 || loaded.BoardRefTTL != config.DefaultBoardRefTTL || loaded.BoardMaxSize != 1<<20 {
+		t.Fatalf("load: unexpected board settings %v, %v and %d", loaded.BoardCacheTTL, loaded.BoardRefTTL, loaded.BoardMaxSize)
+	}
+	if loaded.MaxRequestBody != 8<<20 {
+		t.Fatalf("load: unexpected request body limit %d", loaded.MaxRequestBody)
+	}
+	if !loaded.CookieSecure || loaded.CookieSameSite != http.SameSiteStrictMode || loaded.APIURL != "https://api.example.com" {
+		t.Fatalf("load: unexpected cookie or URL settings %+v", loaded)
+	}
+	if len(loaded.CORSOrigins) != 2 || loaded.CORSOrigins[1] != "https://*.example.com" || loaded.DatabaseName != config.DefaultDatabaseName {
+		t.Fatalf("load: unexpected origins or database %+v", loaded)
+	}
+	if loaded.PasswordResetTTL != 30*time.Minute || loaded.EmailChangeTTL != config.DefaultEmailChangeTTL || loaded.DeletionGracePeriod != 0 {
+		t.Fatalf("load: unexpected token lifetimes or grace period %v, %v and %v", loaded.PasswordResetTTL, loaded.EmailChangeTTL, loaded.DeletionGracePeriod)
+	}
+	if loaded.Intervals.Deletion != 5*time.Minute || loaded.Intervals.Succession != config.DefaultIntervals.Succession {
+		t.Fatalf("load: unexpected intervals %+v", loaded.Intervals)
+	}
+	if loaded.AuthRateLimit != (config.RateLimit{Requests: 5, Period: 10 * time.Second}) || loaded.BoardRateLimit != (config.RateLimit{}) {
+		t.Fatalf("load: unexpected rate limits %v and %v", loaded.AuthRateLimit, loaded.BoardRateLimit)
+	}
+	if loaded.WorkerLimits["export"] != 3 || len(loaded.WorkerLimits) != 1 || loaded.WorkerQueues["ai"] != 0 || len(loaded.WorkerQueues) != 1 {
+		t.Fatalf("load: unexpected worker pools %v and %v", loaded.WorkerLimits, loaded.WorkerQueues)
+	}
+	if loaded.BoardLimit != 0 || loaded.BoardCompressionMinBytes != 0 || loaded.AssetStorage != config.AssetStorageS3 || !loaded.MagicLinkSignup {
+		t.Fatalf("load: unexpected storage settings %+v", loaded)
+	}
+	if loaded.S3Bucket != "boardsar-assets" || loaded.S3Region != config.DefaultS3Region || loaded.S3Endpoint != "https://storage.example.com" {
+		t.Fatalf("load: unexpected S3 settings %q, %q and %q", loaded.S3Bucket, loaded.S3Region, loaded.S3Endpoint)
+	}
+	if loaded.SMTPPort != config.DefaultSMTPPort || loaded.MailFrom != config.DefaultMailFrom {
+		t.Fatalf("load: unexpected mail settings %q and %q", loaded.SMTPPort, loaded.MailFrom)
+	}
+	if len(loaded.WebAuthnOrigins) != 2 || loaded.WebAuthnOrigins[0] != "https://app.example.com" || loaded.TOTPIssuer != config.DefaultServiceName {
+		t.Fatalf("load: unexpected passkey settings %v and %q", loaded.WebAuthnOrigins, loaded.TOTPIssuer)
+	}
+
+	// Every problem is reported at once
+	t.Setenv("MONGODB_URI", "")
+	t.Setenv("JWT_SECRET", "short")
+	t.Setenv("ACCESS_TOKEN_TTL", "soon")
+	t.Setenv("DB_TIMEOUT", "0s")
+	t.Setenv("BOARD_CACHE_TTL", "-1s")
+	t.Setenv("BOARD_MAX_SIZE", "16MB")
+	t.Setenv("MAX_REQUEST_BODY", "512")
+	t.Setenv("COOKIE_SECURE", "false")
+	t.Setenv("COOKIE_SAMESITE", "none")
+	t.Setenv("PASSWORD_RESET_TTL", "1 hour")
+	t.Setenv("DELETION_GRACE_PERIOD", "-72h")
+	t.Setenv("DELETION_INTERVAL", "0s")
+	t.Setenv("RATE_LIMIT_AUTH", "20 per minute")
+	t.Setenv("WORKER_LIMIT_EXPORT", "0")
+	t.Setenv("WORKER_QUEUE_AI", "-1")
+	t.Setenv("BOARD_LIMIT", "-1")
+	t.Setenv("ASSET_MAX_SIZE", "10MB")
+	t.Setenv("BOARD_COMPRESSION", "gzip")
+	t.Setenv("ASSET_STORAGE", "disk")
+	t.Setenv("MAGIC_LINK_SIGNUP", "yes")
+	t.Setenv("WEBAUTHN_ORIGINS", "app.example.com")
+	t.Setenv("LOCALES_DIR", t.TempDir()+"/missing")
+	t.Setenv("SMTP_PORT", "smtp")
+	t.Setenv("GITHUB_CLIENT_ID", "test-client")
+	t.Setenv("VAPID_PRIVATE_KEY", "not-a-key")
+	t.Setenv("AUDIT_FORWARD_URL", "siem.example.com")
+	_, err = config.Load()
+	if err == nil {
+		t.Fatal("invalid load: expected an error")
+	}
+	for _, name := range []string{
+		"MONGODB_URI", "JWT_SECRET", "ACCESS_TOKEN_TTL", "DB_TIMEOUT", "BOARD_CACHE_TTL", "BOARD_MAX_SIZE", "MAX_REQUEST_BODY", "COOKIE_SAMESITE",
+		"PASSWORD_RESET_TTL", "DELETION_GRACE_PERIOD", "DELETION_INTERVAL", "RATE_LIMIT_AUTH", "WORKER_LIMIT_EXPORT", "WORKER_QUEUE_AI", "BOARD_LIMIT",
+		"ASSET_MAX_SIZE", "BOARD_COMPRESSION", "ASSET_STORAGE", "MAGIC_LINK_SIGNUP", "WEBAUTHN_ORIGINS", "LOCALES_DIR",
+		"SMTP_PORT", "GITHUB_CLIENT_ID", "VAPID_PRIVATE_KEY", "AUDIT_FORWARD_URL",
+	} {
+		if !strings.Contains(err.Error(), name) {
+			t.Fatalf("invalid load: expected %s in %q", name, err)
+		}
+	}
+}
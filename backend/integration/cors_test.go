@@ -0,0 +1,88 @@
+//go:build integration
+
+package integration
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/models"
+)
+
+func TestTenantCORSOrigins(t *testing.T) {
+	requireHarness(t)
+
+	_, adminToken := seedUser(t, models.RoleAdmin)
+
+	preflight := func(origin string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodOptions, "/api/boards", nil)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	const preview = "https://boardsar-git-feature-team.vercel.app"
+	if w := preflight(preview); w.Code != http.StatusForbidden {
+		t.Fatalf("preview origin before it is allowed: expected 403, got %d", w.Code)
+	}
+
+	status, response := doJSON(t, http.MethodPut, "/api/admin/cors/tenants/acme", adminToken, gin.H{
+		"origins":       []string{"https://*.vercel.app"},
+		"vanityDomains": []string{"whiteboard.acme.example"},
+	})
+	if status != http.StatusOK {
+		t.Fatalf("save tenant: expected 200, got %d (%v)", status, response)
+	}
+
+	for _, origin := range []string{preview, "https://whiteboard.acme.example"} {
+		w := preflight(origin)
+		if w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Allow-Origin") != origin {
+			t.Fatalf("preflight from %s: expected 204 allowing it, got %d (%v)", origin, w.Code, w.Header())
+		}
+	}
+	if w := preflight("https://evil.example"); w.Code != http.StatusForbidden {
+		t.Fatalf("unknown origin: expected 403, got %d", w.Code)
+	}
+
+	status, response = doJSON(t, http.MethodGet, "/api/admin/cors", adminToken, nil)
+	if status != http.StatusOK {
+		t.Fatalf("cors config: expected 200, got %d (%v)", status, response)
+	}
+	rejected := map[string]bool{}
+	for _, item := range response["metrics"].(map[string]interface{})["rejectedOrigins"].([]interface{}) {
+		rejected[item.(map[string]interface{})["origin"].(string)] = true
+	}
+	if !rejected[preview] || !rejected["https://evil.example"] {
+		t.Fatalf("expected both rejected origins in the metrics, got %v", response["metrics"])
+	}
+
+	if status, response := doJSON(t, http.MethodPut, "/api/admin/cors/tenants/acme", adminToken, gin.H{"origins": []string{"not an origin"}}); status != http.StatusBadRequest {
+		t.Fatalf("invalid origin: expected 400, got %d (%v)", status, response)
+	}
+	if status, response := doJSON(t, http.MethodDelete, "/api/admin/cors/tenants/acme", adminToken, nil); status != http.StatusOK {
+		t.Fatalf("delete tenant: expected 200, got %d (%v)", status, response)
+	}
+	if w := preflight(preview); w.Code != http.StatusForbidden {
+		t.Fatalf("preview origin after the tenant is removed: expected 403, got %d", w.Code)
+	}
+}
+
+func TestCORSConditionalRequestHeaders(t *testing.T) {
+	requireHarness(t)
+
+	// Cross-origin 304s and conditional saves need their headers allowed
+	req := httptest.NewRequest(http.MethodOptions, "/api/boards/some-board", nil)
+	req.Header.Set("Origin", "http://localhost:3000")
+	req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+	req.Header.Set("Access-Control-Request-Headers", "authorization,if-none-match,if-match")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("preflight with conditional headers: expected 204, got %d (%v)", w.Code, w.Header())
+	}
+}
@@ -0,0 +1,116 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/controllers"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/repository"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestDeferredDeletion(t *testing.T) {
+	requireHarness(t)
+	defer func(grace time.Duration) { libs.Settings().DeletionGracePeriod = grace }(libs.Settings().DeletionGracePeriod)
+	libs.Settings().DeletionGracePeriod = 72 * time.Hour
+
+	sent := map[string]string{}
+	original := libs.SendEmail
+	libs.SendEmail = func(to, subject, body string) error {
+		sent[to] = body
+		return nil
+	}
+	defer func() { libs.SendEmail = original }()
+
+	user, token := seedUser(t, "")
+	boardID := seedBoard(t, token)
+	deletionToken := func(t *testing.T) string {
+		t.Helper()
+		_, after, found := strings.Cut(sent[user.Email], "token=")
+		if !found {
+			t.Fatalf("no deletion link sent: %v", sent)
+		}
+		delete(sent, user.Email)
+		return strings.Fields(after)[0]
+	}
+
+	// Deleting schedules it; the board stays until then
+	status, response := doJSON(t, http.MethodDelete, "/api/boards/"+boardID, token, nil)
+	if status != http.StatusAccepted || response["deletion"] == nil {
+		t.Fatalf("delete: expected 202 with the deletion, got %d (%v)", status, response)
+	}
+	if status, _ := doJSON(t, http.MethodGet, "/api/boards/"+boardID, token, nil); status != http.StatusOK {
+		t.Fatalf("board during the grace period: expected 200, got %d", status)
+	}
+	if status, _ := doJSON(t, http.MethodGet, "/api/boards/"+boardID+"/deletion", token, nil); status != http.StatusOK {
+		t.Fatalf("scheduled deletion: expected 200, got %d", status)
+	}
+
+	// The emailed link cancels it, once
+	cancelToken := deletionToken(t)
+	if status, _ := doJSON(t, http.MethodPost, "/deletions/cancel", "", gin.H{"token": cancelToken}); status != http.StatusOK {
+		t.Fatalf("cancel by link: expected 200, got %d", status)
+	}
+	if status, _ := doJSON(t, http.MethodPost, "/deletions/cancel", "", gin.H{"token": cancelToken}); status != http.StatusBadRequest {
+		t.Fatalf("cancel twice: expected 400, got %d", status)
+	}
+	if status, _ := doJSON(t, http.MethodGet, "/api/boards/"+boardID+"/deletion", token, nil); status != http.StatusNotFound {
+		t.Fatalf("canceled deletion: expected 404, got %d", status)
+	}
+
+	// ... or carries it out now
+	doJSON(t, http.MethodDelete, "/api/boards/"+boardID, token, nil)
+	if status, response := doJSON(t, http.MethodPost, "/deletions/confirm", "", gin.H{"token": deletionToken(t)}); status != http.StatusOK {
+		t.Fatalf("confirm by link: expected 200, got %d (%v)", status, response)
+	}
+	if status, _ := doJSON(t, http.MethodGet, "/api/boards/"+boardID, token, nil); status != http.StatusNotFound {
+		t.Fatalf("confirmed board: expected 404, got %d", status)
+	}
+
+	// The scheduler carries it out once the grace period is over
+	boardID = seedBoard(t, token)
+	doJSON(t, http.MethodDelete, "/api/boards/"+boardID, token, nil)
+	id, _ := primitive.ObjectIDFromHex(boardID)
+	libs.GetPendingDeletionCollection().UpdateOne(context.Background(),
+		bson.M{"boardId": id},
+		bson.M{"$set": bson.M{"deleteAt": time.Now().Add(-time.Minute)}},
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	go libs.RunPendingDeletions(ctx, controllers.CompletePendingDeletion(repository.NewMongoBoards()))
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if status, _ := doJSON(t, http.MethodGet, "/api/boards/"+boardID, token, nil); status == http.StatusNotFound {
+			break
+		}
+		if time.Now().After(deadline) {
+			cancel()
+			t.Fatal("scheduled board deletion wasn't carried out")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	cancel()
+
+	// Accounts too, and signing in still works until then
+	status, response = doJSON(t, http.MethodDelete, "/auth/account", token, gin.H{"email": user.Email, "password": "testpassword123"})
+	if status != http.StatusAccepted {
+		t.Fatalf("delete account: expected 202, got %d (%v)", status, response)
+	}
+	deletionToken(t)
+	if status, _ := doJSON(t, http.MethodGet, "/me", token, nil); status != http.StatusOK {
+		t.Fatalf("account during the grace period: expected 200, got %d", status)
+	}
+	if status, _ := doJSON(t, http.MethodDelete, "/auth/account/deletion", token, nil); status != http.StatusOK {
+		t.Fatalf("keep account: expected 200, got %d", status)
+	}
+	if status, _ := doJSON(t, http.MethodGet, "/auth/account/deletion", token, nil); status != http.StatusNotFound {
+		t.Fatalf("kept account: expected 404, got %d", status)
+	}
+}
@@ -0,0 +1,252 @@
+//go:build integration
+
+package integration
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/models"
+)
+
+func TestBoardExportPolicyAndActivity(t *testing.T) {
+	requireHarness(t)
+
+	editor, editorToken := seedUser(t, "")
+	_, ownerToken := seedUser(t, "")
+	boardID := seedBoard(t, ownerToken)
+
+	status, response := doJSON(t, http.MethodPost, "/api/boards/"+boardID+"/share", ownerToken, gin.H{
+		"userId": editor.ID.Hex(),
+		"role":   "editor",
+	})
+	if status != http.StatusOK {
+		t.Fatalf("share: expected 200, got %d (%v)", status, response)
+	}
+
+	status, response = doJSON(t, http.MethodGet, "/api/boards/"+boardID+"/export", editorToken, nil)
+	if status != http.StatusOK || response["board"] == nil {
+		t.Fatalf("export as editor: expected 200 with the board, got %d (%v)", status, response)
+	}
+
+	// Owners can restrict exports to themselves, then switch them off
+	if status, response := doJSON(t, http.MethodPut, "/api/boards/"+boardID+"/export-settings", editorToken, gin.H{"policy": "owner"}); status != http.StatusNotFound {
+		t.Fatalf("settings as editor: expected 404, got %d (%v)", status, response)
+	}
+	if status, response := doJSON(t, http.MethodPut, "/api/boards/"+boardID+"/export-settings", ownerToken, gin.H{"policy": "owner"}); status != http.StatusOK {
+		t.Fatalf("restrict to owner: expected 200, got %d (%v)", status, response)
+	}
+	if status, response := doJSON(t, http.MethodGet, "/api/boards/"+boardID+"/export", editorToken, nil); status != http.StatusForbidden {
+		t.Fatalf("export as editor when owner only: expected 403, got %d (%v)", status, response)
+	}
+	if status, response := doJSON(t, http.MethodGet, "/api/boards/"+boardID+"/export?shapeIds=none", ownerToken, nil); status != http.StatusOK {
+		t.Fatalf("export as owner when owner only: expected 200, got %d (%v)", status, response)
+	}
+	if status, response := doJSON(t, http.MethodPut, "/api/boards/"+boardID+"/export-settings", ownerToken, gin.H{"policy": "disabled"}); status != http.StatusOK {
+		t.Fatalf("disable exports: expected 200, got %d (%v)", status, response)
+	}
+	if status, response := doJSON(t, http.MethodGet, "/api/boards/"+boardID+"/export", ownerToken, nil); status != http.StatusForbidden {
+		t.Fatalf("export when disabled: expected 403, got %d (%v)", status, response)
+	}
+
+	// Board activity shows every export and blocked attempt, newest first
+	status, response = doJSON(t, http.MethodGet, "/api/boards/"+boardID+"/exports", editorToken, nil)
+	if status != http.StatusOK {
+		t.Fatalf("exports: expected 200, got %d (%v)", status, response)
+	}
+	exports := response["exports"].([]interface{})
+	outcomes := []string{}
+	for _, item := range exports {
+		outcomes = append(outcomes, item.(map[string]interface{})["outcome"].(string))
+	}
+	if len(outcomes) != 4 || outcomes[0] != "failure" || outcomes[1] != "success" || outcomes[2] != "failure" || outcomes[3] != "success" {
+		t.Fatalf("exports: expected failure, success, failure, success, got %v", outcomes)
+	}
+	selection := exports[1].(map[string]interface{})["details"].(map[string]interface{})
+	if selection["scope"] != "selection" || selection["destination"] != "download" || selection["format"] != "json" {
+		t.Fatalf("exports: unexpected details %v", selection)
+	}
+}
+
+func TestRenderedBoardExport(t *testing.T) {
+	requireHarness(t)
+
+	_, token := seedUser(t, "")
+	boardID := seedBoard(t, token)
+
+	for _, tc := range []struct {
+		format, contentType, magic string
+	}{
+		{"svg", "image/svg+xml", "<?xml"},
+		{"png", "image/png", "\x89PNG"},
+		{"pdf", "application/pdf", "%PDF-"},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/api/boards/"+boardID+"/export?format="+tc.format, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK || w.Header().Get("Content-Type") != tc.contentType {
+			t.Fatalf("%s: expected 200 %s, got %d %q", tc.format, tc.contentType, w.Code, w.Header().Get("Content-Type"))
+		}
+		if !bytes.HasPrefix(w.Body.Bytes(), []byte(tc.magic)) {
+			t.Fatalf("%s: unexpected body %q", tc.format, w.Body.String()[:min(20, w.Body.Len())])
+		}
+		if disposition := w.Header().Get("Content-Disposition"); !strings.HasSuffix(disposition, "."+tc.format+`"`) {
+			t.Fatalf("%s: unexpected Content-Disposition %q", tc.format, disposition)
+		}
+	}
+
+	status, _ := doJSON(t, http.MethodGet, "/api/boards/"+boardID+"/export?format=png&scale=10", token, nil)
+	if status != http.StatusBadRequest {
+		t.Fatalf("scale too large: expected 400, got %d", status)
+	}
+	status, _ = doJSON(t, http.MethodGet, "/api/boards/"+boardID+"/export?format=gif", token, nil)
+	if status != http.StatusBadRequest {
+		t.Fatalf("unknown format: expected 400, got %d", status)
+	}
+}
+
+func TestGraphExport(t *testing.T) {
+	requireHarness(t)
+
+	_, token := seedUser(t, "")
+	boardID := seedBoard(t, token)
+	status, body := doJSON(t, http.MethodPost, "/api/boards/"+boardID+"/import-diagram", token, gin.H{
+		"source": "flowchart TD\n  A[Start] --> B{Ready?}\n  B -->|yes| C(Ship)\n  B --> D",
+	})
+	if status != http.StatusOK {
+		t.Fatalf("import diagram: expected 200, got %d: %v", status, body)
+	}
+
+	export := func(format string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/boards/"+boardID+"/export?format="+format, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// The seeded rectangle and the four diagram nodes, joined by the
+	// diagram's three lines; arrowheads are not edges
+	w := export("dot")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "text/vnd.graphviz" {
+		t.Fatalf("dot: expected 200 text/vnd.graphviz, got %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	dot := w.Body.String()
+	if !strings.HasPrefix(dot, "digraph ") || strings.Count(dot, "shape=") != 5 || strings.Count(dot, " -> ") != 3 {
+		t.Fatalf("dot: unexpected graph %s", dot)
+	}
+	if !strings.Contains(dot, `"test-shape-1" [label="", shape=box]`) || !strings.Contains(dot, `[label="yes"]`) || !strings.Contains(dot, `label="Ready?", shape=polygon`) {
+		t.Fatalf("dot: expected labelled nodes and edges, got %s", dot)
+	}
+	if disposition := w.Header().Get("Content-Disposition"); !strings.HasSuffix(disposition, `.dot"`) {
+		t.Fatalf("dot: unexpected Content-Disposition %q", disposition)
+	}
+
+	w = export("graphml")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/graphml+xml" {
+		t.Fatalf("graphml: expected 200 application/graphml+xml, got %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	graphml := w.Body.String()
+	if !strings.Contains(graphml, `edgedefault="directed"`) || strings.Count(graphml, "<node ") != 5 || strings.Count(graphml, "<edge ") != 3 {
+		t.Fatalf("graphml: unexpected graph %s", graphml)
+	}
+}
+
+func TestSlowExportBecomesJob(t *testing.T) {
+	requireHarness(t)
+	defer func(budget time.Duration) { libs.Settings().WorkerSyncBudget = budget }(libs.Settings().WorkerSyncBudget)
+	libs.Settings().WorkerSyncBudget = time.Nanosecond
+
+	_, adminToken := seedUser(t, models.RoleAdmin)
+	_, otherToken := seedUser(t, "")
+	_, token := seedUser(t, "")
+	boardID := seedBoard(t, token)
+
+	status, job := doJSON(t, http.MethodGet, "/api/boards/"+boardID+"/export?format=svg", token, nil)
+	if status != http.StatusAccepted || job["jobId"] == nil {
+		t.Fatalf("export: expected 202 with a job, got %d %v", status, job)
+	}
+	jobID := job["jobId"].(string)
+
+	status, _ = doJSON(t, http.MethodGet, "/api/jobs/"+jobID, otherToken, nil)
+	if status != http.StatusNotFound {
+		t.Fatalf("other user: expected 404, got %d", status)
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for job["status"] == models.JobPending && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+		_, job = doJSON(t, http.MethodGet, "/api/jobs/"+jobID, token, nil)
+	}
+	if job["status"] != models.JobSucceeded || job["statusCode"] != float64(http.StatusOK) {
+		t.Fatalf("job: expected success, got %v", job)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/jobs/"+jobID+"/result", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/svg+xml" || !bytes.HasPrefix(w.Body.Bytes(), []byte("<?xml")) {
+		t.Fatalf("result: expected the SVG, got %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	if disposition := w.Header().Get("Content-Disposition"); !strings.HasSuffix(disposition, `.svg"`) {
+		t.Fatalf("result: unexpected Content-Disposition %q", disposition)
+	}
+
+	status, response := doJSON(t, http.MethodGet, "/api/admin/worker-pools", adminToken, nil)
+	if status != http.StatusOK {
+		t.Fatalf("pools: expected 200, got %d", status)
+	}
+	for _, item := range response["pools"].([]interface{}) {
+		pool := item.(map[string]interface{})
+		if pool["name"] == models.JobKindExport && pool["deferred"].(float64) < 1 {
+			t.Fatalf("pools: expected a deferred export, got %v", pool)
+		}
+	}
+}
+
+func TestAsyncExportEvents(t *testing.T) {
+	requireHarness(t)
+
+	_, token := seedUser(t, "")
+	boardID := seedBoard(t, token)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/boards/"+boardID+"/export?format=png", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Prefer", "respond-async")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusAccepted || w.Header().Get("Preference-Applied") != "respond-async" {
+		t.Fatalf("export: expected 202 with respond-async applied, got %d", w.Code)
+	}
+	var job map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &job); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+
+	// The stream ends once the job is done
+	req = httptest.NewRequest(http.MethodGet, job["eventsUrl"].(string)+"?token="+token, nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("events: expected an event stream, got %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	events := w.Body.String()
+	if !strings.HasSuffix(events, "\n\n") || !strings.Contains(events, "event:done\n") || !strings.Contains(events, `"progress":100`) {
+		t.Fatalf("events: expected the job done, got %q", events)
+	}
+
+	status, _ := doJSON(t, http.MethodGet, job["eventsUrl"].(string), "", nil)
+	if status != http.StatusUnauthorized {
+		t.Fatalf("events without a token: expected 401, got %d", status)
+	}
+}
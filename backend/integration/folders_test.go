@@ -0,0 +1,76 @@
+//go:build integration
+
+package integration
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestFoldersAndTags(t *testing.T) {
+	requireHarness(t)
+
+	_, token := seedUser(t, "")
+	filed := seedBoard(t, token)
+	tagged := seedBoard(t, token)
+
+	status, response := doJSON(t, http.MethodPost, "/api/folders", token, gin.H{"name": "Q3 planning"})
+	if status != http.StatusCreated {
+		t.Fatalf("create folder: expected 201, got %d (%v)", status, response)
+	}
+	folderID := response["folder"].(map[string]interface{})["_id"].(string)
+
+	if status, response := doJSON(t, http.MethodPost, "/api/folders", token, gin.H{"name": "Q3 planning"}); status != http.StatusConflict {
+		t.Fatalf("duplicate folder name: expected 409, got %d (%v)", status, response)
+	}
+
+	status, response = doJSON(t, http.MethodPatch, "/api/boards/"+filed+"/meta", token, gin.H{"folderId": folderID})
+	if status != http.StatusOK || response["board"].(map[string]interface{})["folderId"] != folderID {
+		t.Fatalf("move to folder: expected 200 with the folder, got %d (%v)", status, response)
+	}
+	status, response = doJSON(t, http.MethodPatch, "/api/boards/"+tagged+"/meta", token, gin.H{"tags": []string{" Retro", "team-a", "retro"}})
+	if status != http.StatusOK {
+		t.Fatalf("tag board: expected 200, got %d (%v)", status, response)
+	}
+	if tags := response["board"].(map[string]interface{})["tags"].([]interface{}); len(tags) != 2 || tags[0] != "retro" || tags[1] != "team-a" {
+		t.Fatalf("tag board: expected normalized tags, got %v", tags)
+	}
+
+	listBoards := func(query string) []string {
+		t.Helper()
+		status, response := doJSON(t, http.MethodGet, "/api/boards"+query, token, nil)
+		if status != http.StatusOK {
+			t.Fatalf("list boards%s: expected 200, got %d (%v)", query, status, response)
+		}
+		ids := []string{}
+		for _, item := range response["boards"].([]interface{}) {
+			ids = append(ids, item.(map[string]interface{})["_id"].(string))
+		}
+		return ids
+	}
+	if ids := listBoards("?folder=" + folderID); len(ids) != 1 || ids[0] != filed {
+		t.Fatalf("?folder: expected only the filed board, got %v", ids)
+	}
+	if ids := listBoards("?folder=none"); len(ids) != 1 || ids[0] != tagged {
+		t.Fatalf("?folder=none: expected only the unfiled board, got %v", ids)
+	}
+	if ids := listBoards("?tag=RETRO&tag=team-a"); len(ids) != 1 || ids[0] != tagged {
+		t.Fatalf("?tag: expected only the tagged board, got %v", ids)
+	}
+	if ids := listBoards("?tag=retro&tag=team-b"); len(ids) != 0 {
+		t.Fatalf("?tag: expected boards to need every tag, got %v", ids)
+	}
+
+	// Deleting the folder keeps its boards
+	if status, response := doJSON(t, http.MethodDelete, "/api/folders/"+folderID, token, nil); status != http.StatusOK {
+		t.Fatalf("delete folder: expected 200, got %d (%v)", status, response)
+	}
+	if ids := listBoards("?folder=none"); len(ids) != 2 {
+		t.Fatalf("after deleting the folder: expected both boards unfiled, got %v", ids)
+	}
+	if status, response := doJSON(t, http.MethodGet, "/api/boards?folder="+folderID, token, nil); status != http.StatusNotFound {
+		t.Fatalf("deleted folder: expected 404, got %d (%v)", status, response)
+	}
+}
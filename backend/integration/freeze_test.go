@@ -0,0 +1,114 @@
+//go:build integration
+
+package integration
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestScheduledFreeze(t *testing.T) {
+	requireHarness(t)
+
+	_, ownerToken := seedUser(t, "")
+	editor, editorToken := seedUser(t, "")
+	boardID := seedBoard(t, ownerToken)
+	doJSON(t, http.MethodPost, "/api/boards/"+boardID+"/share", ownerToken, gin.H{"email": editor.Email, "role": "editor"})
+	patch := gin.H{"operations": []gin.H{{"op": "add", "shape": gin.H{"id": "late", "type": "text", "x": 0, "y": 0, "text": "Late"}}}}
+
+	status, _ := doJSON(t, http.MethodPut, "/api/boards/"+boardID+"/freeze", editorToken, gin.H{"at": time.Now().Add(time.Hour)})
+	if status != http.StatusNotFound {
+		t.Fatalf("schedule as editor: expected 404, got %d", status)
+	}
+	status, response := doJSON(t, http.MethodPut, "/api/boards/"+boardID+"/freeze", ownerToken, gin.H{"at": time.Now().Add(time.Hour)})
+	if status != http.StatusOK {
+		t.Fatalf("schedule: expected 200, got %d (%v)", status, response)
+	}
+
+	// The countdown shows in the board's meta, and editing still works
+	_, response = doJSON(t, http.MethodGet, "/api/boards/"+boardID, editorToken, nil)
+	freeze, _ := response["freeze"].(map[string]interface{})
+	if freeze == nil || freeze["frozen"] != false || freeze["secondsLeft"].(float64) < 3500 {
+		t.Fatalf("before the freeze: expected a countdown, got %v", response["freeze"])
+	}
+	if status, response := doJSON(t, http.MethodPatch, "/api/boards/"+boardID, editorToken, patch); status != http.StatusOK {
+		t.Fatalf("edit before the freeze: expected 200, got %d (%v)", status, response)
+	}
+
+	// Past the deadline only the owner can change the board
+	doJSON(t, http.MethodPut, "/api/boards/"+boardID+"/freeze", ownerToken, gin.H{"at": time.Now().Add(-time.Minute)})
+	_, response = doJSON(t, http.MethodGet, "/api/boards", editorToken, nil)
+	listed := response["boards"].([]interface{})[0].(map[string]interface{})
+	if freeze, _ := listed["freeze"].(map[string]interface{}); freeze == nil || freeze["frozen"] != true {
+		t.Fatalf("list after the freeze: expected it frozen, got %v", listed["freeze"])
+	}
+	patch["operations"].([]gin.H)[0]["shape"].(gin.H)["id"] = "later"
+	if status, _ := doJSON(t, http.MethodPatch, "/api/boards/"+boardID, editorToken, patch); status != http.StatusForbidden {
+		t.Fatalf("edit after the freeze: expected 403, got %d", status)
+	}
+	if status, _ := doJSON(t, http.MethodPatch, "/api/boards/"+boardID+"/meta", editorToken, gin.H{"name": "Mine now"}); status != http.StatusForbidden {
+		t.Fatalf("rename after the freeze: expected 403, got %d", status)
+	}
+	if status, response := doJSON(t, http.MethodPatch, "/api/boards/"+boardID, ownerToken, patch); status != http.StatusOK {
+		t.Fatalf("owner edit after the freeze: expected 200, got %d (%v)", status, response)
+	}
+
+	if status, _ := doJSON(t, http.MethodDelete, "/api/boards/"+boardID+"/freeze", ownerToken, nil); status != http.StatusOK {
+		t.Fatalf("lift: expected 200, got %d", status)
+	}
+	patch["operations"].([]gin.H)[0]["shape"].(gin.H)["id"] = "reopened"
+	if status, _ := doJSON(t, http.MethodPatch, "/api/boards/"+boardID, editorToken, patch); status != http.StatusOK {
+		t.Fatalf("edit after lifting: expected 200, got %d", status)
+	}
+}
+
+// TestBoardFreezeRules checks roles, operations and the countdown around a
+// freeze, without a database
+func TestBoardFreezeRules(t *testing.T) {
+	owner, editor := primitive.NewObjectID(), primitive.NewObjectID()
+	board := &models.Board{
+		OwnerID:    owner,
+		SharedWith: []models.Collaborator{{UserID: editor, Role: models.CollaboratorRoleEditor}},
+		BoardData:  map[string]interface{}{"shapes": []interface{}{}},
+	}
+	op := func() *models.BoardOperation {
+		return &models.BoardOperation{Op: models.OpAddShape, Shape: map[string]interface{}{"id": "a", "type": "rect"}}
+	}
+
+	board.Freeze = &models.BoardFreeze{At: time.Now().Add(90 * time.Second)}
+	if role := libs.BoardRole(board, editor); role != models.CollaboratorRoleEditor {
+		t.Fatalf("before the freeze: expected an editor, got %q", role)
+	}
+	if violation := libs.PrepareOperation(board, op(), editor); violation != "" {
+		t.Fatalf("before the freeze: expected the edit allowed, got %q", violation)
+	}
+	if status := libs.FreezeStatus(board.Freeze, time.Now()); status.Frozen || status.SecondsLeft < 89 || status.SecondsLeft > 90 {
+		t.Fatalf("before the freeze: expected 90 seconds left, got %+v", status)
+	}
+
+	board.Freeze.At = time.Now().Add(-time.Second)
+	if role := libs.BoardRole(board, editor); role != models.CollaboratorRoleViewer {
+		t.Fatalf("after the freeze: expected the editor to view, got %q", role)
+	}
+	if role := libs.BoardRole(board, owner); role != models.BoardRoleOwner {
+		t.Fatalf("after the freeze: expected the owner to stay owner, got %q", role)
+	}
+	if violation := libs.PrepareOperation(board, op(), editor); violation == "" {
+		t.Fatal("after the freeze: expected the editor's edit refused")
+	}
+	if violation := libs.PrepareOperation(board, op(), owner); violation != "" {
+		t.Fatalf("after the freeze: expected the owner's edit allowed, got %q", violation)
+	}
+	if status := libs.FreezeStatus(board.Freeze, time.Now()); !status.Frozen || status.SecondsLeft != 0 {
+		t.Fatalf("after the freeze: expected it frozen, got %+v", status)
+	}
+	if libs.FreezeStatus(nil, time.Now()) != nil {
+		t.Fatal("without a freeze: expected no countdown")
+	}
+}
@@ -0,0 +1,27 @@
+//go:build integration
+
+package integration
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestHealthChecks(t *testing.T) {
+	requireHarness(t)
+
+	for _, path := range []string{"/health", "/health/live"} {
+		if status, body := doJSON(t, http.MethodGet, path, "", nil); status != http.StatusOK || body["status"] != "ok" {
+			t.Fatalf("%s: expected 200 ok, got %d: %v", path, status, body)
+		}
+	}
+
+	status, body := doJSON(t, http.MethodGet, "/health/ready", "", nil)
+	if status != http.StatusOK || body["status"] != "ready" {
+		t.Fatalf("ready: expected 200 ready, got %d: %v", status, body)
+	}
+	mongo := body["dependencies"].([]interface{})[0].(map[string]interface{})
+	if mongo["name"] != "mongodb" || mongo["status"] != "up" || mongo["latencyMs"] == nil {
+		t.Fatalf("ready: unexpected MongoDB check %v", mongo)
+	}
+}
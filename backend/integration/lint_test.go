@@ -0,0 +1,62 @@
+//go:build integration
+
+package integration
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestLintBoard(t *testing.T) {
+	requireHarness(t)
+
+	_, ownerToken := seedUser(t, "")
+	collaborator, collaboratorToken := seedUser(t, "")
+	boardID := seedBoard(t, ownerToken)
+
+	doJSON(t, http.MethodPut, "/api/boards/"+boardID, ownerToken, gin.H{"board": gin.H{
+		"shapes": []gin.H{
+			{"id": "n1", "type": "sticky", "text": "Teh login page is BoardSar"},
+		},
+	}})
+	doJSON(t, http.MethodPost, "/api/boards/"+boardID+"/share", ownerToken, gin.H{
+		"userId": collaborator.ID.Hex(),
+		"role":   "viewer",
+	})
+
+	status, response := doJSON(t, http.MethodPut, "/me/lint-dictionary", ownerToken, gin.H{
+		"words": []string{"BoardSar"},
+		"terms": []gin.H{{"preferred": "sign in", "avoid": []string{"login"}}},
+	})
+	if status != http.StatusOK {
+		t.Fatalf("dictionary: expected 200, got %d (%v)", status, response)
+	}
+
+	// Collaborators lint with the owner's dictionary
+	status, response = doJSON(t, http.MethodPost, "/api/boards/"+boardID+"/lint", collaboratorToken, nil)
+	if status != http.StatusOK {
+		t.Fatalf("lint: expected 200, got %d (%v)", status, response)
+	}
+	issues := response["issues"].([]interface{})
+	if len(issues) != 2 {
+		t.Fatalf("lint: expected 2 issues, got %v", issues)
+	}
+
+	spelling := issues[0].(map[string]interface{})
+	if spelling["kind"] != "spelling" || spelling["offset"].(float64) != 0 || spelling["suggestions"].([]interface{})[0] != "The" {
+		t.Fatalf("lint: unexpected spelling issue %v", spelling)
+	}
+	terminology := issues[1].(map[string]interface{})
+	if terminology["kind"] != "terminology" || terminology["shapeId"] != "n1" || terminology["offset"].(float64) != 4 {
+		t.Fatalf("lint: unexpected terminology issue %v", terminology)
+	}
+
+	status, _ = doJSON(t, http.MethodPut, "/me/lint-dictionary", ownerToken, gin.H{
+		"terms": []gin.H{{"preferred": "sign in"}},
+	})
+	if status != http.StatusBadRequest {
+		t.Fatalf("dictionary: expected 400 for a rule without avoid, got %d", status)
+	}
+}
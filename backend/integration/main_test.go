@@ -0,0 +1,224 @@
+//go:build integration
+
+// Package integration runs the full Gin router against an ephemeral MongoDB
+// started with testcontainers. Run with:
+//
+//	go test -tags integration ./integration/...
+//
+// Docker must be available; otherwise every test is skipped.
+package integration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/config"
+	"github.com/sarwanazhar/boardsar/backend/database"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"github.com/sarwanazhar/boardsar/backend/repository"
+	"github.com/sarwanazhar/boardsar/backend/routes"
+	"github.com/testcontainers/testcontainers-go/modules/mongodb"
+)
+
+var (
+	router     *gin.Engine
+	cfg        *config.Config
+	harnessErr error
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	os.Setenv("JWT_SECRET", "integration-test-secret")
+	// Tests sign in far more often than people do; TestRateLimits turns
+	// limits back on
+	os.Setenv("RATE_LIMIT_AUTH", "off")
+	os.Setenv("RATE_LIMIT_BOARDS", "off")
+	// Most tests delete boards and accounts outright;
+	// TestDeferredDeletion turns the grace period back on
+	os.Setenv("DELETION_GRACE_PERIOD", "off")
+
+	spec, err := loadOpenAPISpec(openAPIPath)
+	if err != nil {
+		log.Fatalf("failed to load the API description: %v", err)
+	}
+	openAPISpec = spec
+
+	ctx := context.Background()
+
+	container, err := startMongo(ctx)
+	if err != nil {
+		harnessErr = err
+		os.Exit(m.Run())
+	}
+
+	uri, err := container.ConnectionString(ctx)
+	if err != nil {
+		harnessErr = fmt.Errorf("could not get MongoDB connection string: %w", err)
+	} else {
+		os.Setenv("MONGODB_URI", uri)
+		if cfg, err = config.Load(); err != nil {
+			log.Fatalf("failed to load configuration: %v", err)
+		}
+		if err := libs.Configure(cfg); err != nil {
+			log.Fatalf("failed to configure: %v", err)
+		}
+		if err := libs.LoadTranslations(""); err != nil {
+			log.Fatalf("failed to load translations: %v", err)
+		}
+		database.ConnectMongo(cfg.MongoURI, cfg.DatabaseName)
+		router = routes.NewRouter(cfg, repository.NewMongoBoards())
+	}
+
+	code := m.Run()
+
+	if database.Client != nil {
+		database.Client.Disconnect(ctx)
+	}
+	if err := container.Terminate(ctx); err != nil {
+		log.Printf("failed to terminate MongoDB container: %v", err)
+	}
+	os.Exit(code)
+}
+
+// startMongo starts the MongoDB container. testcontainers panics when no
+// Docker host can be found, so that is turned into an error as well.
+func startMongo(ctx context.Context) (container *mongodb.MongoDBContainer, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("could not start MongoDB container: %v", r)
+		}
+	}()
+
+	container, err = mongodb.Run(ctx, "mongo:7")
+	if err != nil {
+		return nil, fmt.Errorf("could not start MongoDB container: %w", err)
+	}
+	return container, nil
+}
+
+// requireHarness skips the test when the Mongo container could not start.
+func requireHarness(t testing.TB) {
+	t.Helper()
+	if harnessErr != nil {
+		t.Skipf("integration harness unavailable: %v", harnessErr)
+	}
+}
+
+// doJSON sends a request through the router and decodes the JSON response.
+// Responses to operations in openapi.yaml are checked against it.
+func doJSON(t testing.TB, method, path, token string, body interface{}) (int, map[string]interface{}) {
+	t.Helper()
+
+	var reader *bytes.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("failed to encode request body: %v", err)
+		}
+		reader = bytes.NewReader(raw)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var response map[string]interface{}
+	if w.Body.Len() > 0 {
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("%s %s: response is not JSON: %s", method, path, w.Body.String())
+		}
+	}
+	for _, problem := range openAPISpec.checkResponse(method, path, w.Code, response) {
+		t.Errorf("response doesn't match openapi.yaml: %s", problem)
+	}
+	return w.Code, response
+}
+
+// uniqueEmail returns an email address no other test uses.
+func uniqueEmail(t testing.TB) string {
+	name := strings.NewReplacer("/", "_", " ", "_").Replace(t.Name())
+	return fmt.Sprintf("%s_%d@test.example.com", name, time.Now().UnixNano())
+}
+
+// seedUser inserts a user fixture directly and returns it with a valid token.
+func seedUser(t testing.TB, role string) (*models.User, string) {
+	t.Helper()
+
+	hash, err := libs.HashPassword("testpassword123")
+	if err != nil {
+		t.Fatalf("failed to hash password: %v", err)
+	}
+
+	user := &models.User{
+		Email:    uniqueEmail(t),
+		Password: hash,
+		Role:     role,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := libs.CreateUser(ctx, user); err != nil {
+		t.Fatalf("failed to seed user: %v", err)
+	}
+
+	token, err := libs.GenerateJWT(user.ID.Hex(), "", user.TokenVersion)
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+	return user, token
+}
+
+// seedBoard creates a board through the API and returns its ObjectID hex.
+func seedBoard(t testing.TB, token string) string {
+	t.Helper()
+
+	status, _ := doJSON(t, http.MethodPost, "/api/boards", token, gin.H{
+		"board": testBoardData(),
+	})
+	if status != http.StatusCreated {
+		t.Fatalf("failed to seed board: status %d", status)
+	}
+
+	status, response := doJSON(t, http.MethodGet, "/api/boards", token, nil)
+	if status != http.StatusOK {
+		t.Fatalf("failed to list boards: status %d", status)
+	}
+	boards := response["boards"].([]interface{})
+	return boards[0].(map[string]interface{})["_id"].(string)
+}
+
+func testBoardData() map[string]interface{} {
+	return map[string]interface{}{
+		"scale":    1.0,
+		"position": map[string]interface{}{"x": 0, "y": 0},
+		"shapes": []interface{}{
+			map[string]interface{}{
+				"id":     "test-shape-1",
+				"type":   "rect",
+				"x":      100,
+				"y":      100,
+				"width":  200,
+				"height": 150,
+			},
+		},
+	}
+}
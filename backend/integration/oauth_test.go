@@ -0,0 +1,161 @@
+//go:build integration
+
+package integration
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// postForm sends a form-encoded request, as OAuth clients do at the token
+// endpoint
+func postForm(t *testing.T, path string, form url.Values) (int, map[string]interface{}) {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var response map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("POST %s: response is not JSON: %s", path, w.Body.String())
+	}
+	return w.Code, response
+}
+
+func TestOAuthAuthorizationCodeFlow(t *testing.T) {
+	requireHarness(t)
+
+	_, developerToken := seedUser(t, "")
+	_, token := seedUser(t, "")
+	boardID := seedBoard(t, token)
+
+	status, response := doJSON(t, http.MethodPost, "/api/oauth/clients", developerToken, gin.H{
+		"name":         "Sticky exporter",
+		"redirectUris": []string{"https://exporter.example.com/callback"},
+		"scopes":       []string{"boards:read", "profile"},
+	})
+	if status != http.StatusCreated {
+		t.Fatalf("register client: expected 201, got %d (%v)", status, response)
+	}
+	clientID := response["client"].(map[string]interface{})["clientId"].(string)
+	secret := response["clientSecret"].(string)
+
+	verifier := "a-long-random-code-verifier-for-the-pkce-check-0123456789"
+	sum := sha256.Sum256([]byte(verifier))
+	authorize := gin.H{
+		"client_id":             clientID,
+		"redirect_uri":          "https://exporter.example.com/callback",
+		"response_type":         "code",
+		"scope":                 "boards:read",
+		"state":                 "xyz",
+		"code_challenge":        base64.RawURLEncoding.EncodeToString(sum[:]),
+		"code_challenge_method": "S256",
+	}
+
+	// Scopes beyond what the client registered for are refused
+	authorize["scope"] = "boards:write"
+	if status, response := doJSON(t, http.MethodPost, "/api/oauth/authorize", token, authorize); status != http.StatusBadRequest {
+		t.Fatalf("authorize with extra scope: expected 400, got %d (%v)", status, response)
+	}
+	authorize["scope"] = "boards:read"
+
+	status, response = doJSON(t, http.MethodPost, "/api/oauth/authorize", token, authorize)
+	if status != http.StatusOK {
+		t.Fatalf("authorize: expected 200, got %d (%v)", status, response)
+	}
+	redirect, err := url.Parse(response["redirectUri"].(string))
+	if err != nil || redirect.Host != "exporter.example.com" || redirect.Query().Get("state") != "xyz" {
+		t.Fatalf("authorize: unexpected redirect %v", response["redirectUri"])
+	}
+	code := redirect.Query().Get("code")
+
+	exchange := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {"https://exporter.example.com/callback"},
+		"client_id":     {clientID},
+		"client_secret": {secret},
+		"code_verifier": {verifier},
+	}
+
+	// A wrong secret doesn't authenticate the client
+	exchange.Set("client_secret", "wrong")
+	if status, response := postForm(t, "/oauth/token", exchange); status != http.StatusUnauthorized || response["error"] != "invalid_client" {
+		t.Fatalf("token with wrong secret: expected 401 invalid_client, got %d (%v)", status, response)
+	}
+	exchange.Set("client_secret", secret)
+
+	status, response = postForm(t, "/oauth/token", exchange)
+	if status != http.StatusOK || response["scope"] != "boards:read" {
+		t.Fatalf("token: expected 200 with boards:read, got %d (%v)", status, response)
+	}
+	accessToken := response["access_token"].(string)
+	refreshToken := response["refresh_token"].(string)
+
+	// Codes work once
+	if status, response := postForm(t, "/oauth/token", exchange); status != http.StatusBadRequest || response["error"] != "invalid_grant" {
+		t.Fatalf("reused code: expected 400 invalid_grant, got %d (%v)", status, response)
+	}
+
+	// The token can read boards, but not write them or read the profile
+	if status, response := doJSON(t, http.MethodGet, "/api/boards/"+boardID, accessToken, nil); status != http.StatusOK {
+		t.Fatalf("read with boards:read: expected 200, got %d (%v)", status, response)
+	}
+	if status, response := doJSON(t, http.MethodPut, "/api/boards/"+boardID, accessToken, gin.H{"board": testBoardData()}); status != http.StatusForbidden || response["scope"] != "boards:write" {
+		t.Fatalf("write with boards:read: expected 403 for boards:write, got %d (%v)", status, response)
+	}
+	if status, response := doJSON(t, http.MethodGet, "/me", accessToken, nil); status != http.StatusForbidden {
+		t.Fatalf("profile without scope: expected 403, got %d (%v)", status, response)
+	}
+	if status, response := doJSON(t, http.MethodPost, "/api/oauth/clients", accessToken, gin.H{
+		"name": "Escalation", "redirectUris": []string{"https://evil.example.com"},
+	}); status != http.StatusForbidden {
+		t.Fatalf("app registering apps: expected 403, got %d (%v)", status, response)
+	}
+
+	// The app's refresh token only works at the token endpoint
+	if status, response := doJSON(t, http.MethodPost, "/auth/refresh", "", gin.H{"refreshToken": refreshToken}); status != http.StatusUnauthorized {
+		t.Fatalf("first-party refresh with app token: expected 401, got %d (%v)", status, response)
+	}
+
+	status, response = postForm(t, "/oauth/token", url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refreshToken},
+		"client_id":     {clientID},
+		"client_secret": {secret},
+	})
+	if status != http.StatusOK || response["scope"] != "boards:read" {
+		t.Fatalf("refresh: expected 200 with boards:read, got %d (%v)", status, response)
+	}
+	refreshToken = response["refresh_token"].(string)
+
+	// Disconnecting the app revokes its refresh tokens
+	status, response = doJSON(t, http.MethodGet, "/api/oauth/grants", token, nil)
+	apps := response["apps"].([]interface{})
+	if status != http.StatusOK || len(apps) != 1 || apps[0].(map[string]interface{})["name"] != "Sticky exporter" {
+		t.Fatalf("grants: expected the connected app, got %d (%v)", status, response)
+	}
+	if status, response := doJSON(t, http.MethodDelete, "/api/oauth/grants/"+clientID, token, nil); status != http.StatusOK {
+		t.Fatalf("revoke grant: expected 200, got %d (%v)", status, response)
+	}
+	status, response = postForm(t, "/oauth/token", url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refreshToken},
+		"client_id":     {clientID},
+		"client_secret": {secret},
+	})
+	if status != http.StatusBadRequest || response["error"] != "invalid_grant" {
+		t.Fatalf("refresh after revoke: expected 400 invalid_grant, got %d (%v)", status, response)
+	}
+}
@@ -0,0 +1,394 @@
+//go:build integration
+
+package integration
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// openAPIPath is the API description, relative to this package
+const openAPIPath = "../openapi.yaml"
+
+// openAPISpec is the API description doJSON checks responses against
+var openAPISpec *openAPIDocument
+
+// openAPIDocument is the part of an OpenAPI 3 document the suite checks
+// responses with
+type openAPIDocument struct {
+	Paths      map[string]map[string]openAPIOperation `yaml:"paths"`
+	Components struct {
+		Responses map[string]openAPIResponse `yaml:"responses"`
+		Schemas   map[string]*openAPISchema  `yaml:"schemas"`
+	} `yaml:"components"`
+}
+
+type openAPIOperation struct {
+	Responses map[string]openAPIResponse `yaml:"responses"`
+}
+
+type openAPIResponse struct {
+	Ref     string `yaml:"$ref"`
+	Content map[string]struct {
+		Schema *openAPISchema `yaml:"schema"`
+	} `yaml:"content"`
+}
+
+// openAPISchema is the subset of JSON Schema the document uses. Properties
+// not listed are allowed, as they are in the API.
+type openAPISchema struct {
+	Ref        string                    `yaml:"$ref"`
+	Type       string                    `yaml:"type"`
+	Format     string                    `yaml:"format"`
+	Nullable   bool                      `yaml:"nullable"`
+	Required   []string                  `yaml:"required"`
+	Properties map[string]*openAPISchema `yaml:"properties"`
+	Items      *openAPISchema            `yaml:"items"`
+	Enum       []interface{}             `yaml:"enum"`
+	AnyOf      []*openAPISchema          `yaml:"anyOf"`
+	AllOf      []*openAPISchema          `yaml:"allOf"`
+}
+
+// loadOpenAPISpec reads the API description and checks its references
+func loadOpenAPISpec(path string) (*openAPIDocument, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var spec openAPIDocument
+	if err := yaml.Unmarshal(raw, &spec); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	var problems []string
+	for template, operations := range spec.Paths {
+		for method, operation := range operations {
+			if len(operation.Responses) == 0 {
+				problems = append(problems, fmt.Sprintf("%s %s has no responses", method, template))
+			}
+			for status, response := range operation.Responses {
+				response, err := spec.response(response)
+				if err != nil {
+					problems = append(problems, fmt.Sprintf("%s %s %s: %v", method, template, status, err))
+					continue
+				}
+				for _, content := range response.Content {
+					problems = append(problems, spec.checkRefs(content.Schema)...)
+				}
+			}
+		}
+	}
+	for _, schema := range spec.Components.Schemas {
+		problems = append(problems, spec.checkRefs(schema)...)
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return nil, fmt.Errorf("%s: %s", path, strings.Join(problems, "; "))
+	}
+	return &spec, nil
+}
+
+// response resolves a response that refers to a shared one
+func (s *openAPIDocument) response(response openAPIResponse) (openAPIResponse, error) {
+	if response.Ref == "" {
+		return response, nil
+	}
+	shared, ok := s.Components.Responses[strings.TrimPrefix(response.Ref, "#/components/responses/")]
+	if !ok {
+		return openAPIResponse{}, fmt.Errorf("unknown response %s", response.Ref)
+	}
+	return shared, nil
+}
+
+// schema resolves a schema that refers to a shared one
+func (s *openAPIDocument) schema(schema *openAPISchema) (*openAPISchema, error) {
+	if schema == nil || schema.Ref == "" {
+		return schema, nil
+	}
+	shared, ok := s.Components.Schemas[strings.TrimPrefix(schema.Ref, "#/components/schemas/")]
+	if !ok {
+		return nil, fmt.Errorf("unknown schema %s", schema.Ref)
+	}
+	return shared, nil
+}
+
+// checkRefs reports references in the schema to schemas that don't exist
+func (s *openAPIDocument) checkRefs(schema *openAPISchema) []string {
+	if schema == nil {
+		return nil
+	}
+	if schema.Ref != "" {
+		if _, err := s.schema(schema); err != nil {
+			return []string{err.Error()}
+		}
+		return nil
+	}
+	var problems []string
+	for _, property := range schema.Properties {
+		problems = append(problems, s.checkRefs(property)...)
+	}
+	for _, option := range append(schema.AnyOf, schema.AllOf...) {
+		problems = append(problems, s.checkRefs(option)...)
+	}
+	return append(problems, s.checkRefs(schema.Items)...)
+}
+
+// operation finds the documented operation for a request path, preferring
+// literal segments over parameters. ok is false for undocumented paths.
+func (s *openAPIDocument) operation(method, path string) (operation openAPIOperation, template string, ok bool) {
+	if i := strings.IndexByte(path, '?'); i >= 0 {
+		path = path[:i]
+	}
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+
+	bestParams := -1
+	for candidate, operations := range s.Paths {
+		found, documented := operations[strings.ToLower(method)]
+		if !documented {
+			continue
+		}
+		parts := strings.Split(strings.Trim(candidate, "/"), "/")
+		if len(parts) != len(segments) {
+			continue
+		}
+		params := 0
+		for i, part := range parts {
+			if strings.HasPrefix(part, "{") {
+				params++
+			} else if part != segments[i] {
+				params = -1
+				break
+			}
+		}
+		if params >= 0 && (bestParams < 0 || params < bestParams) {
+			operation, template, ok, bestParams = found, candidate, true, params
+		}
+	}
+	return operation, template, ok
+}
+
+// checkResponse checks a response to a documented operation against the
+// API description: its status must be documented, and its body must match
+// the schema for it.
+func (s *openAPIDocument) checkResponse(method, path string, status int, body map[string]interface{}) []string {
+	operation, template, ok := s.operation(method, path)
+	if !ok {
+		return nil
+	}
+	response, documented := operation.Responses[strconv.Itoa(status)]
+	if !documented {
+		response, documented = operation.Responses["default"]
+	}
+	if !documented {
+		return []string{fmt.Sprintf("%s %s answered %d, which isn't documented", method, template, status)}
+	}
+	response, err := s.response(response)
+	if err != nil {
+		return []string{err.Error()}
+	}
+
+	schema := response.Content["application/json"].Schema
+	switch {
+	case schema == nil && body != nil:
+		return []string{fmt.Sprintf("%s %s answered %d with a body, which isn't documented", method, template, status)}
+	case schema == nil:
+		return nil
+	case body == nil:
+		return []string{fmt.Sprintf("%s %s answered %d without a body", method, template, status)}
+	}
+
+	var problems []string
+	for _, problem := range s.validate(schema, body, "") {
+		problems = append(problems, fmt.Sprintf("%s %s (%d): %s", method, template, status, problem))
+	}
+	return problems
+}
+
+// validate checks a decoded JSON value against a schema, returning what
+// doesn't match with the path to it
+func (s *openAPIDocument) validate(schema *openAPISchema, value interface{}, at string) []string {
+	schema, err := s.schema(schema)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	where := at
+	if where == "" {
+		where = "body"
+	}
+
+	for _, part := range schema.AllOf {
+		if problems := s.validate(part, value, at); len(problems) > 0 {
+			return problems
+		}
+	}
+	if len(schema.AnyOf) > 0 {
+		var problems []string
+		for _, option := range schema.AnyOf {
+			optionProblems := s.validate(option, value, at)
+			if len(optionProblems) == 0 {
+				return nil
+			}
+			problems = append(problems, optionProblems...)
+		}
+		return []string{fmt.Sprintf("%s matches none of its schemas (%s)", where, strings.Join(problems, "; "))}
+	}
+
+	if value == nil {
+		if schema.Nullable || schema.Type == "" {
+			return nil
+		}
+		return []string{where + " is null"}
+	}
+
+	var problems []string
+	switch schema.Type {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s is %T, not an object", where, value)}
+		}
+		for _, name := range schema.Required {
+			if _, ok := object[name]; !ok {
+				problems = append(problems, fmt.Sprintf("%s has no %q", where, name))
+			}
+		}
+		for name, property := range schema.Properties {
+			if item, ok := object[name]; ok {
+				problems = append(problems, s.validate(property, item, joinPath(at, name))...)
+			}
+		}
+	case "array":
+		list, ok := value.([]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s is %T, not an array", where, value)}
+		}
+		if schema.Items != nil {
+			for i, item := range list {
+				problems = append(problems, s.validate(schema.Items, item, fmt.Sprintf("%s[%d]", at, i))...)
+			}
+		}
+	case "string":
+		text, ok := value.(string)
+		if !ok {
+			return []string{fmt.Sprintf("%s is %T, not a string", where, value)}
+		}
+		if schema.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339Nano, text); err != nil {
+				problems = append(problems, fmt.Sprintf("%s is %q, not a date-time", where, text))
+			}
+		}
+	case "integer", "number":
+		number, ok := value.(float64)
+		if !ok {
+			return []string{fmt.Sprintf("%s is %T, not a %s", where, value, schema.Type)}
+		}
+		if schema.Type == "integer" && number != math.Trunc(number) {
+			problems = append(problems, fmt.Sprintf("%s is %v, not an integer", where, number))
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return []string{fmt.Sprintf("%s is %T, not a boolean", where, value)}
+		}
+	}
+
+	if len(schema.Enum) > 0 {
+		allowed := false
+		for _, option := range schema.Enum {
+			if fmt.Sprint(option) == fmt.Sprint(value) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			problems = append(problems, fmt.Sprintf("%s is %v, not one of %v", where, value, schema.Enum))
+		}
+	}
+	return problems
+}
+
+func joinPath(at, name string) string {
+	if at == "" {
+		return name
+	}
+	return at + "." + name
+}
+
+// TestOpenAPISpec checks the checker itself, and under the harness that
+// every documented operation is routed.
+func TestOpenAPISpec(t *testing.T) {
+	spec, err := loadOpenAPISpec(openAPIPath)
+	if err != nil {
+		t.Fatalf("failed to load the API description: %v", err)
+	}
+
+	session := map[string]interface{}{
+		"token":        "access",
+		"expiresIn":    float64(900),
+		"refreshToken": "refresh",
+		"user":         map[string]interface{}{"id": "1", "email": "a@example.com", "locale": "en"},
+	}
+	if problems := spec.checkResponse(http.MethodPost, "/auth/login", http.StatusOK, session); len(problems) > 0 {
+		t.Fatalf("expected a session to match, got %v", problems)
+	}
+	challenge := map[string]interface{}{"twoFactorRequired": true, "twoFactorToken": "challenge", "expiresIn": float64(300)}
+	if problems := spec.checkResponse(http.MethodPost, "/auth/login", http.StatusOK, challenge); len(problems) > 0 {
+		t.Fatalf("expected a two-factor challenge to match, got %v", problems)
+	}
+	if problems := spec.checkResponse(http.MethodPost, "/auth/login", http.StatusOK, map[string]interface{}{"token": "access"}); len(problems) == 0 {
+		t.Fatal("expected an incomplete session to be reported")
+	}
+
+	list := map[string]interface{}{
+		"boards":     []interface{}{map[string]interface{}{"_id": "b1", "version": 1.5, "updatedAt": "yesterday"}},
+		"nextCursor": "",
+		"hasMore":    false,
+	}
+	problems := spec.checkResponse(http.MethodGet, "/api/boards?limit=5", http.StatusOK, list)
+	if len(problems) != 2 {
+		t.Fatalf("expected the version and updatedAt of boards[0] to be reported, got %v", problems)
+	}
+	if problems := spec.checkResponse(http.MethodGet, "/api/boards/b1", http.StatusNotFound, map[string]interface{}{"message": "gone"}); len(problems) == 0 {
+		t.Fatal("expected an error without an error message to be reported")
+	}
+	if problems := spec.checkResponse(http.MethodGet, "/api/boards/b1", http.StatusNotModified, nil); len(problems) > 0 {
+		t.Fatalf("expected an empty 304 to match, got %v", problems)
+	}
+	if problems := spec.checkResponse(http.MethodGet, "/api/boards/b1/versions", http.StatusOK, nil); len(problems) > 0 {
+		t.Fatalf("expected undocumented paths to be left alone, got %v", problems)
+	}
+
+	requireHarness(t)
+
+	routed := map[string]bool{}
+	for _, route := range router.Routes() {
+		routed[route.Method+" "+routeShape(route.Path)] = true
+	}
+	for template, operations := range spec.Paths {
+		for method := range operations {
+			if !routed[strings.ToUpper(method)+" "+routeShape(template)] {
+				t.Errorf("%s %s is documented but not routed", strings.ToUpper(method), template)
+			}
+		}
+	}
+}
+
+// routeShape replaces the parameters of a Gin route or an OpenAPI path
+// template with *, so the two can be compared
+func routeShape(path string) string {
+	parts := strings.Split(path, "/")
+	for i, part := range parts {
+		if strings.HasPrefix(part, ":") || strings.HasPrefix(part, "{") {
+			parts[i] = "*"
+		}
+	}
+	return strings.Join(parts, "/")
+}
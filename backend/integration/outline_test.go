@@ -0,0 +1,57 @@
+//go:build integration
+
+package integration
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestBoardOutline(t *testing.T) {
+	requireHarness(t)
+
+	_, token := seedUser(t, "")
+	boardID := seedBoard(t, token)
+
+	doJSON(t, http.MethodPut, "/api/boards/"+boardID, token, gin.H{"board": gin.H{
+		"shapes": []gin.H{
+			{"id": "frame", "type": "rect", "x": 0, "y": 0, "width": 400, "height": 400, "title": "Ideas"},
+			{"id": "second", "type": "text", "x": 200, "y": 20, "text": "Second"},
+			{"id": "first", "type": "text", "x": 20, "y": 25, "text": "First"},
+			{"id": "outside", "type": "text", "x": 20, "y": 600, "text": "Notes <later>"},
+			{"id": "stroke", "type": "pen", "points": []int{1, 2, 3, 4}},
+		},
+	}})
+
+	status, response := doJSON(t, http.MethodGet, "/api/boards/"+boardID+"/outline", token, nil)
+	if status != http.StatusOK {
+		t.Fatalf("outline: expected 200, got %d (%v)", status, response)
+	}
+	items := response["items"].([]interface{})
+	if len(items) != 2 || response["drawings"].(float64) != 1 {
+		t.Fatalf("outline: expected a frame, a text and 1 drawing, got %v", response)
+	}
+	frame := items[0].(map[string]interface{})
+	children := frame["children"].([]interface{})
+	if frame["kind"] != "frame" || frame["text"] != "Ideas" || len(children) != 2 {
+		t.Fatalf("outline: unexpected frame %v", frame)
+	}
+	if children[0].(map[string]interface{})["text"] != "First" {
+		t.Fatalf("outline: expected reading order First, Second; got %v", children)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/boards/"+boardID+"/outline?format=html", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("html outline: expected 200 text/html, got %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(w.Body.String(), "<h2>Ideas</h2>") || !strings.Contains(w.Body.String(), "Notes &lt;later&gt;") {
+		t.Fatalf("html outline: unexpected body %s", w.Body.String())
+	}
+}
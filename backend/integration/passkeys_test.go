@@ -0,0 +1,238 @@
+//go:build integration
+
+package integration
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+)
+
+// testAuthenticator emulates a platform authenticator holding one ES256
+// passkey
+type testAuthenticator struct {
+	key     *ecdsa.PrivateKey
+	id      []byte
+	counter uint32
+}
+
+func newTestAuthenticator(t *testing.T) *testAuthenticator {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	id := make([]byte, 16)
+	rand.Read(id)
+	return &testAuthenticator{key: key, id: id}
+}
+
+func (a *testAuthenticator) credentialID() string {
+	return base64.RawURLEncoding.EncodeToString(a.id)
+}
+
+// authData builds authenticator data with the user present and verified,
+// attaching the public key when registering
+func (a *testAuthenticator) authData(register bool) []byte {
+	rpIDHash := sha256.Sum256([]byte(libs.WebAuthnRPID()))
+	data := append([]byte(nil), rpIDHash[:]...)
+	flags := byte(0x05)
+	if register {
+		flags |= 0x40
+	}
+	data = append(data, flags)
+	data = binary.BigEndian.AppendUint32(data, a.counter)
+	if register {
+		data = append(data, make([]byte, 16)...) // AAGUID
+		data = binary.BigEndian.AppendUint16(data, uint16(len(a.id)))
+		data = append(data, a.id...)
+		data = append(data, cborMap(
+			cborInt(1), cborInt(2), // kty: EC2
+			cborInt(3), cborInt(-7), // alg: ES256
+			cborInt(-1), cborInt(1), // crv: P-256
+			cborInt(-2), cborBytes(a.key.X.FillBytes(make([]byte, 32))),
+			cborInt(-3), cborBytes(a.key.Y.FillBytes(make([]byte, 32))),
+		)...)
+	}
+	return data
+}
+
+func clientDataJSON(t *testing.T, ceremony, challenge string) []byte {
+	t.Helper()
+	raw, err := json.Marshal(gin.H{"type": ceremony, "challenge": challenge, "origin": libs.FrontendURL()})
+	if err != nil {
+		t.Fatalf("failed to encode client data: %v", err)
+	}
+	return raw
+}
+
+func (a *testAuthenticator) create(t *testing.T, challenge string) gin.H {
+	t.Helper()
+	attestation := cborMap(
+		cborText("fmt"), cborText("none"),
+		cborText("attStmt"), cborMap(),
+		cborText("authData"), cborBytes(a.authData(true)),
+	)
+	return gin.H{
+		"id":    a.credentialID(),
+		"rawId": a.credentialID(),
+		"type":  "public-key",
+		"response": gin.H{
+			"clientDataJSON":    base64.RawURLEncoding.EncodeToString(clientDataJSON(t, "webauthn.create", challenge)),
+			"attestationObject": base64.RawURLEncoding.EncodeToString(attestation),
+			"transports":        []string{"internal"},
+		},
+	}
+}
+
+func (a *testAuthenticator) get(t *testing.T, challenge string) gin.H {
+	t.Helper()
+	authData := a.authData(false)
+	clientData := clientDataJSON(t, "webauthn.get", challenge)
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte(nil), authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatalf("failed to sign assertion: %v", err)
+	}
+	return gin.H{
+		"id":    a.credentialID(),
+		"rawId": a.credentialID(),
+		"type":  "public-key",
+		"response": gin.H{
+			"clientDataJSON":    base64.RawURLEncoding.EncodeToString(clientData),
+			"authenticatorData": base64.RawURLEncoding.EncodeToString(authData),
+			"signature":         base64.RawURLEncoding.EncodeToString(signature),
+		},
+	}
+}
+
+func cborHead(major byte, n int) []byte {
+	switch {
+	case n < 24:
+		return []byte{major<<5 | byte(n)}
+	case n < 256:
+		return []byte{major<<5 | 24, byte(n)}
+	default:
+		return []byte{major<<5 | 25, byte(n >> 8), byte(n)}
+	}
+}
+
+func cborInt(n int) []byte {
+	if n < 0 {
+		return cborHead(1, -1-n)
+	}
+	return cborHead(0, n)
+}
+
+func cborBytes(b []byte) []byte { return append(cborHead(2, len(b)), b...) }
+func cborText(s string) []byte  { return append(cborHead(3, len(s)), s...) }
+
+func cborMap(items ...[]byte) []byte {
+	out := cborHead(5, len(items)/2)
+	for _, item := range items {
+		out = append(out, item...)
+	}
+	return out
+}
+
+func challengeOf(t *testing.T, body map[string]interface{}) string {
+	t.Helper()
+	publicKey, _ := body["publicKey"].(map[string]interface{})
+	challenge, _ := publicKey["challenge"].(string)
+	if challenge == "" {
+		t.Fatalf("no challenge in options: %v", body)
+	}
+	return challenge
+}
+
+func TestPasskeyLogin(t *testing.T) {
+	requireHarness(t)
+
+	user, token := seedUser(t, "")
+	authenticator := newTestAuthenticator(t)
+
+	status, body := doJSON(t, http.MethodPost, "/auth/webauthn/register/begin", token, nil)
+	if status != http.StatusOK {
+		t.Fatalf("register begin: expected 200, got %d: %v", status, body)
+	}
+	status, body = doJSON(t, http.MethodPost, "/auth/webauthn/register/finish", token, gin.H{
+		"name":       "Laptop",
+		"credential": authenticator.create(t, challengeOf(t, body)),
+	})
+	if status != http.StatusCreated {
+		t.Fatalf("register finish: expected 201, got %d: %v", status, body)
+	}
+	passkeyID := body["passkey"].(map[string]interface{})["id"].(string)
+
+	status, body = doJSON(t, http.MethodGet, "/me/passkeys", token, nil)
+	passkeys, _ := body["passkeys"].([]interface{})
+	if status != http.StatusOK || len(passkeys) != 1 || passkeys[0].(map[string]interface{})["name"] != "Laptop" {
+		t.Fatalf("list: expected the Laptop passkey, got %d: %v", status, body)
+	}
+
+	login := func(t *testing.T) (int, map[string]interface{}) {
+		t.Helper()
+		status, body := doJSON(t, http.MethodPost, "/auth/webauthn/login/begin", "", gin.H{"email": user.Email})
+		if status != http.StatusOK {
+			t.Fatalf("login begin: expected 200, got %d: %v", status, body)
+		}
+		return doJSON(t, http.MethodPost, "/auth/webauthn/login/finish", "",
+			gin.H{"credential": authenticator.get(t, challengeOf(t, body))})
+	}
+
+	authenticator.counter = 1
+	status, body = login(t)
+	if status != http.StatusOK || body["token"] == nil {
+		t.Fatalf("login: expected 200 with a token, got %d: %v", status, body)
+	}
+	if got := body["user"].(map[string]interface{})["id"]; got != user.ID.Hex() {
+		t.Fatalf("login: signed in as %v, expected %s", got, user.ID.Hex())
+	}
+
+	// A counter that doesn't go up looks like a cloned passkey
+	status, _ = login(t)
+	if status != http.StatusUnauthorized {
+		t.Fatalf("repeated counter: expected 401, got %d", status)
+	}
+
+	// Going passwordless turns password login off
+	status, _ = doJSON(t, http.MethodPut, "/me/passwordless", token, gin.H{"enabled": true})
+	if status != http.StatusOK {
+		t.Fatalf("passwordless: expected 200, got %d", status)
+	}
+	status, _ = doJSON(t, http.MethodPost, "/auth/login", "", gin.H{"email": user.Email, "password": "testpassword123"})
+	if status != http.StatusForbidden {
+		t.Fatalf("password login while passwordless: expected 403, got %d", status)
+	}
+	status, _ = doJSON(t, http.MethodDelete, "/me/passkeys/"+passkeyID, token, nil)
+	if status != http.StatusConflict {
+		t.Fatalf("removing the last passkey while passwordless: expected 409, got %d", status)
+	}
+
+	status, _ = doJSON(t, http.MethodPut, "/me/passwordless", token, gin.H{"enabled": false})
+	if status != http.StatusOK {
+		t.Fatalf("passwordless off: expected 200, got %d", status)
+	}
+	status, _ = doJSON(t, http.MethodPost, "/auth/login", "", gin.H{"email": user.Email, "password": "testpassword123"})
+	if status != http.StatusOK {
+		t.Fatalf("password login: expected 200, got %d", status)
+	}
+	status, _ = doJSON(t, http.MethodDelete, "/me/passkeys/"+passkeyID, token, nil)
+	if status != http.StatusOK {
+		t.Fatalf("remove passkey: expected 200, got %d", status)
+	}
+	status, _ = doJSON(t, http.MethodPut, "/me/passwordless", token, gin.H{"enabled": true})
+	if status != http.StatusConflict {
+		t.Fatalf("passwordless without a passkey: expected 409, got %d", status)
+	}
+}
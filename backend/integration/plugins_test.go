@@ -0,0 +1,142 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/plugins"
+	"github.com/sarwanazhar/boardsar/backend/repository"
+	"github.com/sarwanazhar/boardsar/backend/routes"
+)
+
+// recorderPlugin records the events it receives, adds a "test-gauge" shape
+// whose value must be 0-100, and serves a per-board ping endpoint
+type recorderPlugin struct {
+	events chan plugins.Event
+}
+
+func (p *recorderPlugin) Info() plugins.Info {
+	return plugins.Info{Name: "test-recorder", Description: "Records board events"}
+}
+
+func (p *recorderPlugin) HandleEvent(ctx context.Context, event plugins.Event) {
+	p.events <- event
+}
+
+func (p *recorderPlugin) ShapeTypes() []libs.ShapeType {
+	return []libs.ShapeType{{
+		Name: "test-gauge",
+		Validate: func(shape map[string]interface{}) error {
+			value, ok := libs.ShapeNumber(shape, "value")
+			if !ok || value < 0 || value > 100 {
+				return fmt.Errorf("value must be a number from 0 to 100")
+			}
+			return nil
+		},
+	}}
+}
+
+func (p *recorderPlugin) RegisterRoutes(group *gin.RouterGroup) {
+	group.GET("/boards/:boardId/ping", func(c *gin.Context) {
+		if _, ok := plugins.LoadBoard(c, p); !ok {
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"pong": true})
+	})
+}
+
+var (
+	recorder     = &recorderPlugin{events: make(chan plugins.Event, 16)}
+	recorderOnce sync.Once
+)
+
+// pluginRouter registers the test plugin and builds a router with its
+// endpoints mounted
+func pluginRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	recorderOnce.Do(func() {
+		if err := plugins.Register(recorder); err != nil {
+			t.Fatalf("failed to register plugin: %v", err)
+		}
+	})
+	return routes.NewRouter(cfg, repository.NewMongoBoards())
+}
+
+func TestPluginEventsShapesAndEndpoints(t *testing.T) {
+	requireHarness(t)
+	extRouter := pluginRouter(t)
+
+	_, token := seedUser(t, "")
+	boardID := seedBoard(t, token)
+
+	ping := func() int {
+		req := httptest.NewRequest(http.MethodGet, "/api/ext/test-recorder/boards/"+boardID+"/ping", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		extRouter.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// Off by default: no endpoint access
+	if status := ping(); status != http.StatusNotFound {
+		t.Fatalf("ping on disabled board: expected 404, got %d", status)
+	}
+
+	status, response := doJSON(t, http.MethodPut, "/api/boards/"+boardID+"/plugins/test-recorder", token, gin.H{"enabled": true})
+	if status != http.StatusOK || response["plugin"].(map[string]interface{})["enabled"] != true {
+		t.Fatalf("enable plugin: expected 200 and enabled, got %d (%v)", status, response)
+	}
+	if status := ping(); status != http.StatusOK {
+		t.Fatalf("ping on enabled board: expected 200, got %d", status)
+	}
+
+	// Custom shapes are validated on every write path
+	status, response = doJSON(t, http.MethodPatch, "/api/boards/"+boardID, token, gin.H{"operations": []gin.H{
+		{"op": "add", "shape": gin.H{"id": "gauge", "type": "test-gauge", "value": 500}},
+	}})
+	if status != http.StatusBadRequest {
+		t.Fatalf("patch with invalid gauge: expected 400, got %d (%v)", status, response)
+	}
+	status, response = doJSON(t, http.MethodPatch, "/api/boards/"+boardID, token, gin.H{"operations": []gin.H{
+		{"op": "add", "shape": gin.H{"id": "gauge", "type": "test-gauge", "value": 50}},
+	}})
+	if status != http.StatusOK {
+		t.Fatalf("patch with valid gauge: expected 200, got %d (%v)", status, response)
+	}
+	status, response = doJSON(t, http.MethodPut, "/api/boards/"+boardID, token, gin.H{"board": gin.H{
+		"shapes": []gin.H{{"id": "gauge", "type": "test-gauge", "value": -1}},
+	}})
+	if status != http.StatusUnprocessableEntity {
+		t.Fatalf("put with invalid gauge: expected 422, got %d (%v)", status, response)
+	}
+
+	select {
+	case event := <-recorder.events:
+		if event.Type != plugins.EventBoardUpdated || event.BoardID.Hex() != boardID {
+			t.Fatalf("expected board.updated for %s, got %+v", boardID, event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("plugin did not receive board.updated")
+	}
+
+	status, response = doJSON(t, http.MethodGet, "/api/boards/"+boardID+"/plugins", token, nil)
+	found := false
+	for _, item := range response["plugins"].([]interface{}) {
+		plugin := item.(map[string]interface{})
+		if plugin["name"] == "test-recorder" {
+			found = plugin["enabled"] == true && len(plugin["shapeTypes"].([]interface{})) == 1
+		}
+	}
+	if status != http.StatusOK || !found {
+		t.Fatalf("board plugins: expected test-recorder enabled with its shape type, got %d (%v)", status, response)
+	}
+}
@@ -0,0 +1,113 @@
+//go:build integration
+
+package integration
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// uploadAvatar posts an avatar as a multipart form
+func uploadAvatar(t *testing.T, token string, data []byte) (int, map[string]interface{}) {
+	t.Helper()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, _ := form.CreateFormFile("file", "me.png")
+	part.Write(data)
+	form.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/me/avatar", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	return w.Code, response
+}
+
+// getAvatar fetches an avatar by its URL, without signing in
+func getAvatar(t *testing.T, avatarURL string) *httptest.ResponseRecorder {
+	t.Helper()
+	path := avatarURL[strings.Index(avatarURL, "/avatars/"):]
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	return w
+}
+
+func TestUserProfile(t *testing.T) {
+	requireHarness(t)
+
+	user, token := seedUser(t, "")
+	_, ownerToken := seedUser(t, "")
+	boardID := seedBoard(t, ownerToken)
+
+	status, response := doJSON(t, http.MethodPatch, "/me", token, gin.H{"name": "Ada Lovelace", "displayName": " Ada "})
+	if status != http.StatusOK || response["name"] != "Ada Lovelace" || response["displayName"] != "Ada" {
+		t.Fatalf("patch: expected the new profile, got %d (%v)", status, response)
+	}
+	if _, response := doJSON(t, http.MethodGet, "/me", token, nil); response["displayName"] != "Ada" || response["email"] != user.Email {
+		t.Fatalf("get: expected the profile, got %v", response)
+	}
+	if status, _ := doJSON(t, http.MethodPatch, "/me", token, gin.H{}); status != http.StatusBadRequest {
+		t.Fatalf("empty patch: expected 400, got %d", status)
+	}
+	for _, avatarURL := range []string{"javascript:alert(1)", "http://example.com/me.png"} {
+		if status, _ := doJSON(t, http.MethodPatch, "/me", token, gin.H{"avatarUrl": avatarURL}); status != http.StatusBadRequest {
+			t.Fatalf("avatarUrl %q: expected 400, got %d", avatarURL, status)
+		}
+	}
+	if status, response := doJSON(t, http.MethodPatch, "/me", token, gin.H{"avatarUrl": "https://example.com/me.png"}); status != http.StatusOK || response["avatarUrl"] != "https://example.com/me.png" {
+		t.Fatalf("https avatarUrl: expected 200, got %d (%v)", status, response)
+	}
+
+	// Uploads replace the avatar, and the one before
+	var picture bytes.Buffer
+	png.Encode(&picture, image.NewRGBA(image.Rect(0, 0, 64, 64)))
+	status, response = uploadAvatar(t, token, picture.Bytes())
+	if status != http.StatusCreated {
+		t.Fatalf("upload: expected 201, got %d (%v)", status, response)
+	}
+	first := response["avatarUrl"].(string)
+	if w := getAvatar(t, first); w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/png" || !bytes.Equal(w.Body.Bytes(), picture.Bytes()) {
+		t.Fatalf("get avatar: expected the PNG, got %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	if status, _ := uploadAvatar(t, token, []byte("not an image")); status != http.StatusUnsupportedMediaType {
+		t.Fatalf("upload text: expected 415, got %d", status)
+	}
+	_, response = uploadAvatar(t, token, picture.Bytes())
+	second := response["avatarUrl"].(string)
+	if w := getAvatar(t, first); w.Code != http.StatusNotFound {
+		t.Fatalf("replaced avatar: expected 404, got %d", w.Code)
+	}
+
+	// Collaborators show with their profile
+	doJSON(t, http.MethodPost, "/api/boards/"+boardID+"/share", ownerToken, gin.H{"email": user.Email, "role": "viewer"})
+	_, response = doJSON(t, http.MethodGet, "/api/boards", ownerToken, nil)
+	board := response["boards"].([]interface{})[0].(map[string]interface{})
+	profile := board["collaborators"].([]interface{})[0].(map[string]interface{})["profile"].(map[string]interface{})
+	if profile["displayName"] != "Ada" || profile["avatarUrl"] != second {
+		t.Fatalf("collaborator profile: expected Ada with the avatar, got %v", profile)
+	}
+
+	if status, _ := doJSON(t, http.MethodDelete, "/me/avatar", token, nil); status != http.StatusOK {
+		t.Fatalf("delete avatar: expected 200, got %d", status)
+	}
+	if w := getAvatar(t, second); w.Code != http.StatusNotFound {
+		t.Fatalf("deleted avatar: expected 404, got %d", w.Code)
+	}
+	if _, response := doJSON(t, http.MethodGet, "/me", token, nil); response["avatarUrl"] != "" {
+		t.Fatalf("after delete: expected no avatarUrl, got %v", response["avatarUrl"])
+	}
+}
@@ -0,0 +1,245 @@
+//go:build integration
+
+package integration
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/models"
+)
+
+// testBrowser emulates a browser's push subscription: its keys, and a push
+// service that hands it what the server sends
+type testBrowser struct {
+	key     *ecdh.PrivateKey
+	auth    []byte
+	service *httptest.Server
+	pushes  chan *http.Request
+	bodies  chan []byte
+}
+
+func newTestBrowser(t *testing.T, status int) *testBrowser {
+	t.Helper()
+	key, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	auth := make([]byte, 16)
+	rand.Read(auth)
+
+	b := &testBrowser{key: key, auth: auth, pushes: make(chan *http.Request, 10), bodies: make(chan []byte, 10)}
+	b.service = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		b.pushes <- r
+		b.bodies <- body
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(b.service.Close)
+	return b
+}
+
+func (b *testBrowser) subscription(kinds ...string) gin.H {
+	return gin.H{
+		"endpoint": b.service.URL + "/push/device",
+		"keys": gin.H{
+			"p256dh": base64.RawURLEncoding.EncodeToString(b.key.PublicKey().Bytes()),
+			"auth":   base64.RawURLEncoding.EncodeToString(b.auth),
+		},
+		"name":  "Laptop",
+		"kinds": kinds,
+	}
+}
+
+// receive waits for a push and decrypts it as a browser would (RFC 8291)
+func (b *testBrowser) receive(t *testing.T) (*http.Request, models.Notification) {
+	t.Helper()
+	var req *http.Request
+	var body []byte
+	select {
+	case req = <-b.pushes:
+		body = <-b.bodies
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no push arrived")
+	}
+
+	if req.Header.Get("Content-Encoding") != "aes128gcm" || len(body) < 21 {
+		t.Fatalf("push is not aes128gcm: %v", req.Header)
+	}
+	salt, idLen := body[:16], int(body[20])
+	serverKeyBytes, ciphertext := body[21:21+idLen], body[21+idLen:]
+	serverKey, err := ecdh.P256().NewPublicKey(serverKeyBytes)
+	if err != nil {
+		t.Fatalf("invalid key ID: %v", err)
+	}
+	shared, _ := b.key.ECDH(serverKey)
+	ikm, _ := hkdf.Key(sha256.New, shared, b.auth, "WebPush: info\x00"+string(b.key.PublicKey().Bytes())+string(serverKeyBytes), 32)
+	prk, _ := hkdf.Extract(sha256.New, ikm, salt)
+	contentKey, _ := hkdf.Expand(sha256.New, prk, "Content-Encoding: aes128gcm\x00", 16)
+	nonce, _ := hkdf.Expand(sha256.New, prk, "Content-Encoding: nonce\x00", 12)
+	block, _ := aes.NewCipher(contentKey)
+	gcm, _ := cipher.NewGCM(block)
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		t.Fatalf("failed to decrypt push: %v", err)
+	}
+	plaintext = bytes.TrimSuffix(bytes.TrimRight(plaintext, "\x00"), []byte{0x02})
+
+	var notification models.Notification
+	if err := json.Unmarshal(plaintext, &notification); err != nil {
+		t.Fatalf("push payload is not a notification: %q", plaintext)
+	}
+	return req, notification
+}
+
+func TestWebPush(t *testing.T) {
+	requireHarness(t)
+	defer func(private bool) { libs.Settings().PrivateHooks = private }(libs.Settings().PrivateHooks)
+
+	vapid, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate VAPID key: %v", err)
+	}
+	defer func(key string) { libs.Settings().VAPIDPrivateKey = key }(libs.Settings().VAPIDPrivateKey)
+	libs.Settings().VAPIDPrivateKey = base64.RawURLEncoding.EncodeToString(vapid.Bytes())
+	publicKey := base64.RawURLEncoding.EncodeToString(vapid.PublicKey().Bytes())
+
+	status, body := doJSON(t, http.MethodGet, "/api/push/public-key", "", nil)
+	if status != http.StatusOK || body["publicKey"] != publicKey {
+		t.Fatalf("public key: expected %s, got %d: %v", publicKey, status, body)
+	}
+
+	owner, ownerToken := seedUser(t, "")
+	boardID := seedBoard(t, ownerToken)
+	collaborator, collaboratorToken := seedUser(t, "")
+	browser := newTestBrowser(t, http.StatusCreated)
+	if status, _ := doJSON(t, http.MethodPut, "/me/locale", collaboratorToken, gin.H{"locale": "es"}); status != http.StatusOK {
+		t.Fatalf("locale: expected 200, got %d", status)
+	}
+
+	// The test push service is on this machine, which takes PRIVATE_HOOKS
+	status, body = doJSON(t, http.MethodPost, "/me/push-subscriptions", collaboratorToken, browser.subscription(models.NotificationShare))
+	if status != http.StatusBadRequest || body["error"] != libs.ErrPushEndpointAddress.Error() {
+		t.Fatalf("private endpoint: expected 400, got %d: %v", status, body)
+	}
+	libs.Settings().PrivateHooks = true
+
+	status, body = doJSON(t, http.MethodPost, "/me/push-subscriptions", collaboratorToken, browser.subscription(models.NotificationShare))
+	if status != http.StatusCreated {
+		t.Fatalf("subscribe: expected 201, got %d: %v", status, body)
+	}
+	subscriptionID := body["subscription"].(map[string]interface{})["id"].(string)
+
+	// Being added to a board arrives on the device, in the user's language
+	status, _ = doJSON(t, http.MethodPost, "/api/boards/"+boardID+"/share", ownerToken, gin.H{"email": collaborator.Email, "role": "editor"})
+	if status != http.StatusOK {
+		t.Fatalf("share: expected 200, got %d", status)
+	}
+	req, notification := browser.receive(t)
+	if notification.Kind != models.NotificationShare || notification.BoardID != boardID {
+		t.Fatalf("share push: unexpected notification %+v", notification)
+	}
+	if notification.Title != owner.Email+" compartió un tablero contigo" || !strings.HasPrefix(notification.Body, "Puedes editar ") {
+		t.Fatalf("share push: expected Spanish text, got %q: %q", notification.Title, notification.Body)
+	}
+	if auth := req.Header.Get("Authorization"); !strings.HasPrefix(auth, "vapid t=") || !strings.HasSuffix(auth, "k="+publicKey) {
+		t.Fatalf("share push: unexpected Authorization %q", auth)
+	}
+
+	// Devices choose their kinds
+	status, body = doJSON(t, http.MethodPatch, "/me/push-subscriptions/"+subscriptionID, collaboratorToken, gin.H{"kinds": []string{"comment", "mention"}})
+	if status != http.StatusOK {
+		t.Fatalf("update kinds: expected 200, got %d: %v", status, body)
+	}
+	status, _ = doJSON(t, http.MethodPatch, "/me/push-subscriptions/"+subscriptionID, collaboratorToken, gin.H{"kinds": []string{"everything"}})
+	if status != http.StatusBadRequest {
+		t.Fatalf("unknown kind: expected 400, got %d", status)
+	}
+
+	status, _ = doJSON(t, http.MethodPost, "/me/push-subscriptions/"+subscriptionID+"/test", collaboratorToken, nil)
+	if status != http.StatusOK {
+		t.Fatalf("test push: expected 200, got %d", status)
+	}
+	if _, notification := browser.receive(t); notification.Kind != models.NotificationTest || notification.Title != "Las notificaciones están activadas" {
+		t.Fatalf("test push: unexpected notification %+v", notification)
+	}
+
+	// Other users can't touch the subscription
+	status, _ = doJSON(t, http.MethodDelete, "/me/push-subscriptions/"+subscriptionID, ownerToken, nil)
+	if status != http.StatusNotFound {
+		t.Fatalf("delete someone else's subscription: expected 404, got %d", status)
+	}
+
+	// Subscriptions the push service has dropped are removed
+	gone := newTestBrowser(t, http.StatusGone)
+	status, body = doJSON(t, http.MethodPost, "/me/push-subscriptions", collaboratorToken, gone.subscription())
+	if status != http.StatusCreated {
+		t.Fatalf("subscribe second device: expected 201, got %d: %v", status, body)
+	}
+	goneID := body["subscription"].(map[string]interface{})["id"].(string)
+	status, _ = doJSON(t, http.MethodPost, "/me/push-subscriptions/"+goneID+"/test", collaboratorToken, nil)
+	if status != http.StatusGone {
+		t.Fatalf("expired subscription: expected 410, got %d", status)
+	}
+	_, body = doJSON(t, http.MethodGet, "/me/push-subscriptions", collaboratorToken, nil)
+	if subscriptions := body["subscriptions"].([]interface{}); len(subscriptions) != 1 {
+		t.Fatalf("after expiry: expected 1 subscription, got %v", subscriptions)
+	}
+
+	status, _ = doJSON(t, http.MethodPost, "/me/push-subscriptions", collaboratorToken, gin.H{
+		"endpoint": "ftp://push.example.com/device",
+		"keys":     gin.H{"p256dh": "x", "auth": "y"},
+	})
+	if status != http.StatusBadRequest {
+		t.Fatalf("invalid endpoint: expected 400, got %d", status)
+	}
+
+	status, _ = doJSON(t, http.MethodDelete, "/me/push-subscriptions/"+subscriptionID, collaboratorToken, nil)
+	if status != http.StatusOK {
+		t.Fatalf("unsubscribe: expected 200, got %d", status)
+	}
+}
+
+// TestPushEndpoints checks that subscriptions can't point at private
+// networks
+func TestPushEndpoints(t *testing.T) {
+	defer func(private bool) { libs.Settings().PrivateHooks = private }(libs.Settings().PrivateHooks)
+	libs.Settings().PrivateHooks = false
+	ctx := context.Background()
+
+	for _, endpoint := range []string{
+		"http://localhost:8080/push/device",
+		"https://127.0.0.1/push/device",
+		"https://172.16.0.9/push/device",
+		"http://169.254.169.254/latest/meta-data",
+		"https://[::1]/push/device",
+	} {
+		if err := libs.ValidatePushEndpoint(ctx, endpoint); err != libs.ErrPushEndpointAddress {
+			t.Errorf("%s: expected %v, got %v", endpoint, libs.ErrPushEndpointAddress, err)
+		}
+	}
+	if err := libs.ValidatePushEndpoint(ctx, "https://203.0.113.5/push/device"); err != nil {
+		t.Errorf("public address: expected no error, got %v", err)
+	}
+
+	libs.Settings().PrivateHooks = true
+	if err := libs.ValidatePushEndpoint(ctx, "http://127.0.0.1/push/device"); err != nil {
+		t.Errorf("PRIVATE_HOOKS: expected no error, got %v", err)
+	}
+}
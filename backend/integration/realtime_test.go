@@ -0,0 +1,205 @@
+//go:build integration
+
+package integration
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"github.com/sarwanazhar/boardsar/backend/realtime"
+)
+
+// dialBoard opens a board socket and returns it after the initial sync.
+func dialBoard(t testing.TB, server *httptest.Server, boardID, token string) *websocket.Conn {
+	t.Helper()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws/boards/" + boardID + "?token=" + token
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	readUntil(t, conn, realtime.MessageSync)
+	return conn
+}
+
+// readUntil reads messages until one of the given type arrives.
+func readUntil(t testing.TB, conn *websocket.Conn, messageType string) realtime.Message {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		var message realtime.Message
+		if err := conn.ReadJSON(&message); err != nil {
+			t.Fatalf("waiting for %q: %v", messageType, err)
+		}
+		if message.Type == messageType {
+			return message
+		}
+	}
+}
+
+func TestRealtimeBroadcastAndPersist(t *testing.T) {
+	requireHarness(t)
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	_, ownerToken := seedUser(t, "")
+	viewer, viewerToken := seedUser(t, "")
+	boardID := seedBoard(t, ownerToken)
+	doJSON(t, http.MethodPost, "/api/boards/"+boardID+"/share", ownerToken, gin.H{
+		"userId": viewer.ID.Hex(),
+		"role":   models.CollaboratorRoleViewer,
+	})
+
+	owner := dialBoard(t, server, boardID, ownerToken)
+	watcher := dialBoard(t, server, boardID, viewerToken)
+
+	// Ops from the owner reach the viewer
+	owner.WriteJSON(realtime.Message{Type: realtime.MessageOp, Op: &models.BoardOperation{
+		Op:    models.OpAddShape,
+		Shape: map[string]interface{}{"id": "live-shape", "type": "rect", "x": 1, "y": 2},
+	}})
+	message := readUntil(t, watcher, realtime.MessageOp)
+	if message.Op == nil || message.Op.Shape["id"] != "live-shape" {
+		t.Fatalf("expected live-shape op, got %+v", message)
+	}
+
+	// Viewers can't edit
+	watcher.WriteJSON(realtime.Message{Type: realtime.MessageOp, Op: &models.BoardOperation{
+		Op: models.OpDeleteShape,
+		ID: "live-shape",
+	}})
+	readUntil(t, watcher, realtime.MessageError)
+
+	// The merged state is persisted
+	realtime.DefaultHub.Flush()
+	_, response := doJSON(t, http.MethodGet, "/api/boards/"+boardID, ownerToken, nil)
+	shapes := response["board"].(map[string]interface{})["shapes"].([]interface{})
+	if len(shapes) != 2 {
+		t.Fatalf("expected 2 shapes after flush, got %d", len(shapes))
+	}
+
+	// REST writes resync connected clients
+	doJSON(t, http.MethodPut, "/api/boards/"+boardID, ownerToken, gin.H{"board": testBoardData()})
+	message = readUntil(t, watcher, realtime.MessageSync)
+	if shapes := message.Board["shapes"].([]interface{}); len(shapes) != 1 {
+		t.Fatalf("expected resync to 1 shape, got %d", len(shapes))
+	}
+}
+
+func TestRealtimeRequiresAccess(t *testing.T) {
+	requireHarness(t)
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	_, ownerToken := seedUser(t, "")
+	_, otherToken := seedUser(t, "")
+	boardID := seedBoard(t, ownerToken)
+
+	base := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws/boards/" + boardID
+
+	_, resp, err := websocket.DefaultDialer.Dial(base, nil)
+	if err == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("no token: expected 401, got %v", resp)
+	}
+
+	_, resp, err = websocket.DefaultDialer.Dial(base+"?token="+otherToken, nil)
+	if err == nil || resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("stranger: expected 404, got %v", resp)
+	}
+}
+
+func TestRealtimeBoardSizeAndQuota(t *testing.T) {
+	requireHarness(t)
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	_, ownerToken := seedUser(t, "")
+	boardID := seedBoard(t, ownerToken)
+	owner := dialBoard(t, server, boardID, ownerToken)
+	watcher := dialBoard(t, server, boardID, ownerToken)
+
+	size := libs.BoardDataSize(testBoardData())
+	bigShape := &models.BoardOperation{
+		Op:    models.OpAddShape,
+		Shape: map[string]interface{}{"id": "big-shape", "type": "text", "x": 1, "y": 2, "text": strings.Repeat("x", 2000)},
+	}
+
+	// An op that takes the board over BOARD_MAX_SIZE is rejected
+	defer func(limit int64) { libs.Settings().BoardMaxSize = limit }(libs.Settings().BoardMaxSize)
+	libs.Settings().BoardMaxSize = size + 1000
+	owner.WriteJSON(realtime.Message{Type: realtime.MessageOp, Op: bigShape})
+	message := readUntil(t, owner, realtime.MessageError)
+	if !strings.Contains(message.Error, "boards can be at most") {
+		t.Fatalf("expected a board size error, got %q", message.Error)
+	}
+	libs.Settings().BoardMaxSize = 0
+
+	// So is one that takes the owner over their storage quota
+	defer func(limit int64) { libs.Settings().StorageLimitBytes = limit }(libs.Settings().StorageLimitBytes)
+	libs.Settings().StorageLimitBytes = size + 1000
+	owner.WriteJSON(realtime.Message{Type: realtime.MessageOp, Op: bigShape})
+	message = readUntil(t, owner, realtime.MessageError)
+	if !strings.Contains(message.Error, "Storage limit reached") {
+		t.Fatalf("expected a storage limit error, got %q", message.Error)
+	}
+
+	// Small ops still go through, and the rejected ones never reach the board
+	owner.WriteJSON(realtime.Message{Type: realtime.MessageOp, Op: &models.BoardOperation{
+		Op:    models.OpAddShape,
+		Shape: map[string]interface{}{"id": "small-shape", "type": "rect", "x": 1, "y": 2},
+	}})
+	if message := readUntil(t, watcher, realtime.MessageOp); message.Op.Shape["id"] != "small-shape" {
+		t.Fatalf("expected only small-shape to reach other clients, got %+v", message.Op)
+	}
+	realtime.DefaultHub.Flush()
+	_, response := doJSON(t, http.MethodGet, "/api/boards/"+boardID, ownerToken, nil)
+	ids := []string{}
+	for _, shape := range response["board"].(map[string]interface{})["shapes"].([]interface{}) {
+		ids = append(ids, shape.(map[string]interface{})["id"].(string))
+	}
+	if strings.Join(ids, ",") != "test-shape-1,small-shape" {
+		t.Fatalf("expected test-shape-1 and small-shape, got %v", ids)
+	}
+}
+
+func TestRealtimeReadOnlyMode(t *testing.T) {
+	requireHarness(t)
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	_, ownerToken := seedUser(t, "")
+	boardID := seedBoard(t, ownerToken)
+	owner := dialBoard(t, server, boardID, ownerToken)
+
+	// Clients stay connected and read, but their ops are refused
+	libs.SetReadOnlyMode(true, "")
+	defer libs.SetReadOnlyMode(false, "")
+	owner.WriteJSON(realtime.Message{Type: realtime.MessageOp, Op: &models.BoardOperation{
+		Op:    models.OpAddShape,
+		Shape: map[string]interface{}{"id": "read-only-shape", "type": "rect", "x": 1, "y": 2},
+	}})
+	message := readUntil(t, owner, realtime.MessageError)
+	if !strings.Contains(message.Error, "read-only") {
+		t.Fatalf("expected a read-only error, got %q", message.Error)
+	}
+
+	realtime.DefaultHub.Flush()
+	_, response := doJSON(t, http.MethodGet, "/api/boards/"+boardID, ownerToken, nil)
+	if shapes := response["board"].(map[string]interface{})["shapes"].([]interface{}); len(shapes) != 1 {
+		t.Fatalf("expected the board unchanged, got %d shapes", len(shapes))
+	}
+}
@@ -0,0 +1,425 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/controllers"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"github.com/sarwanazhar/boardsar/backend/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TestRepositories runs the same checks against every repository: in
+// memory and, when Docker is available, in MongoDB
+func TestRepositories(t *testing.T) {
+	t.Run("memory", func(t *testing.T) {
+		checkRepositories(t, repository.NewMemoryBoards(), repository.NewMemoryUsers())
+	})
+	t.Run("mongo", func(t *testing.T) {
+		requireHarness(t)
+		checkRepositories(t, repository.NewMongoBoards(), repository.NewMongoUsers())
+	})
+}
+
+func checkRepositories(t *testing.T, boards repository.BoardRepository, users repository.UserRepository) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	owner := &models.User{ID: primitive.NewObjectID(), Email: uniqueEmail(t), CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	editor := &models.User{ID: primitive.NewObjectID(), Email: uniqueEmail(t) + ".editor", CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	for _, user := range []*models.User{owner, editor} {
+		if err := users.Create(ctx, user); err != nil {
+			t.Fatalf("create user: %v", err)
+		}
+	}
+	found, err := users.FindByEmail(ctx, owner.Email)
+	if err != nil || found.ID != owner.ID {
+		t.Fatalf("find by email: got %+v, %v", found, err)
+	}
+	if _, err := users.FindByEmail(ctx, "nobody@test.example.com"); !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("find unknown email: expected ErrNotFound, got %v", err)
+	}
+	if err := users.Update(ctx, owner.ID, map[string]interface{}{"locale": "fr"}); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if found, err = users.FindByID(ctx, owner.ID); err != nil || found.Locale != "fr" || found.Email != owner.Email {
+		t.Fatalf("update: got %+v, %v", found, err)
+	}
+	if err := users.Update(ctx, primitive.NewObjectID(), map[string]interface{}{"locale": "fr"}); !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("update unknown user: expected ErrNotFound, got %v", err)
+	}
+	if list, err := users.FindByIDs(ctx, []primitive.ObjectID{owner.ID, editor.ID, primitive.NewObjectID()}); err != nil || len(list) != 2 {
+		t.Fatalf("find by IDs: got %d users, %v", len(list), err)
+	}
+
+	// The owner was deactivated; the editor was last active a year ago
+	longAgo := time.Now().AddDate(-1, 0, 0)
+	users.Update(ctx, owner.ID, map[string]interface{}{"deactivated_at": time.Now()})
+	users.Update(ctx, editor.ID, map[string]interface{}{"last_active_at": longAgo})
+	departed := func(inactiveBefore time.Time) map[primitive.ObjectID]bool {
+		list, err := users.FindDeparted(ctx, inactiveBefore)
+		if err != nil {
+			t.Fatalf("find departed: %v", err)
+		}
+		found := map[primitive.ObjectID]bool{}
+		for _, user := range list {
+			found[user.ID] = true
+		}
+		return found
+	}
+	if found := departed(time.Time{}); !found[owner.ID] || found[editor.ID] {
+		t.Fatalf("find deactivated: got %v", found)
+	}
+	if found := departed(time.Now().AddDate(0, -1, 0)); !found[owner.ID] || !found[editor.ID] {
+		t.Fatalf("find inactive: got %v", found)
+	}
+	users.Update(ctx, owner.ID, map[string]interface{}{"deactivated_at": nil})
+	if found, err = users.FindByID(ctx, owner.ID); err != nil || found.DeactivatedAt != nil {
+		t.Fatalf("reactivate: got %+v, %v", found, err)
+	}
+
+	board := &models.Board{
+		ID:         primitive.NewObjectID(),
+		BoardID:    "repository-" + primitive.NewObjectID().Hex(),
+		Name:       "Roadmap",
+		Tags:       []string{"planning"},
+		OwnerID:    owner.ID,
+		BoardData:  testBoardData(),
+		SharedWith: []models.Collaborator{{UserID: editor.ID, Role: models.CollaboratorRoleEditor}},
+		Version:    1,
+		CreatedAt:  time.Now(),
+		UpdatedAt:  time.Now(),
+	}
+	if err := boards.Create(ctx, board); err != nil {
+		t.Fatalf("create board: %v", err)
+	}
+	for _, ref := range []string{board.ID.Hex(), board.BoardID} {
+		if found, err := boards.FindForUser(ctx, ref, editor.ID); err != nil || found.ID != board.ID {
+			t.Fatalf("find %s for editor: got %v", ref, err)
+		}
+	}
+	if _, err := boards.FindForUser(ctx, board.BoardID, editor.ID, models.CollaboratorRoleViewer); !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("find for editor as viewer: expected ErrNotFound, got %v", err)
+	}
+	if _, err := boards.FindOwned(ctx, board.BoardID, editor.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("find owned by editor: expected ErrNotFound, got %v", err)
+	}
+	if found, err := boards.FindOwned(ctx, board.ID.Hex(), owner.ID); err != nil || found.Version != 1 || found.Name != "Roadmap" ||
+		len(found.Tags) != 1 || found.BoardData["shapes"] == nil || len(found.SharedWith) != 1 {
+		t.Fatalf("find owned: got %+v, %v", found, err)
+	}
+
+	// Writes: fields set to nil are removed, and versioned writes only
+	// land on the version they were read at
+	if err := boards.Update(ctx, board.ID, map[string]interface{}{"name": "Plan", "tags": nil}); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if found, err := boards.FindByID(ctx, board.ID); err != nil || found.Name != "Plan" || len(found.Tags) != 0 || found.Version != 1 {
+		t.Fatalf("update: got %+v, %v", found, err)
+	}
+	if err := boards.Update(ctx, primitive.NewObjectID(), map[string]interface{}{"name": "Plan"}); !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("update unknown board: expected ErrNotFound, got %v", err)
+	}
+	if err := boards.UpdateVersion(ctx, board.ID, 1, map[string]interface{}{"description": "Q3"}); err != nil {
+		t.Fatalf("update version: %v", err)
+	}
+	if err := boards.UpdateVersion(ctx, board.ID, 2, map[string]interface{}{"description": "Q4"}); !errors.Is(err, repository.ErrVersionConflict) {
+		t.Fatalf("update at another version: expected ErrVersionConflict, got %v", err)
+	}
+	data := map[string]interface{}{"shapes": []interface{}{}, "saved": true}
+	if err := boards.SaveContents(ctx, board.ID, 1, 3, data, map[string]interface{}{"updatedAt": time.Now()}); err != nil {
+		t.Fatalf("save contents: %v", err)
+	}
+	if err := boards.SaveContents(ctx, board.ID, 1, 1, data, nil); !errors.Is(err, repository.ErrVersionConflict) {
+		t.Fatalf("save stale contents: expected ErrVersionConflict, got %v", err)
+	}
+	if err := boards.SaveContents(ctx, board.ID, repository.AnyVersion, 1, data, nil); err != nil {
+		t.Fatalf("save contents at any version: %v", err)
+	}
+	if found, err := boards.FindByID(ctx, board.ID); err != nil || found.Version != 5 || found.Description != "Q3" ||
+		found.BoardData["saved"] != true {
+		t.Fatalf("save contents: got %+v, %v", found, err)
+	}
+
+	viewer := models.Collaborator{UserID: editor.ID, Role: models.CollaboratorRoleViewer}
+	if added, err := boards.SetCollaborator(ctx, board.ID, viewer); err != nil || added {
+		t.Fatalf("change collaborator: added %v, %v", added, err)
+	}
+	if added, err := boards.SetCollaborator(ctx, board.ID, models.Collaborator{UserID: owner.ID, Role: models.CollaboratorRoleViewer}); err != nil || !added {
+		t.Fatalf("add collaborator: added %v, %v", added, err)
+	}
+	if found, err := boards.FindByID(ctx, board.ID); err != nil || len(found.SharedWith) != 2 || found.SharedWith[0].Role != models.CollaboratorRoleViewer {
+		t.Fatalf("set collaborators: got %+v, %v", found, err)
+	}
+	if err := boards.RemoveCollaborator(ctx, board.ID, owner.ID); err != nil {
+		t.Fatalf("remove collaborator: %v", err)
+	}
+	if err := boards.RemoveCollaborator(ctx, board.ID, owner.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("remove removed collaborator: expected ErrNotFound, got %v", err)
+	}
+	if _, err := boards.SetCollaborator(ctx, primitive.NewObjectID(), viewer); !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("share unknown board: expected ErrNotFound, got %v", err)
+	}
+
+	if found, err := boards.WithoutContents().FindByRef(ctx, board.BoardID); err != nil || found.BoardData != nil || found.Name != "Plan" {
+		t.Fatalf("find by ref without contents: got %+v, %v", found, err)
+	}
+	if found, err := boards.FindByID(ctx, board.ID); err != nil || found.BoardData == nil {
+		t.Fatalf("find after without contents: got %+v, %v", found, err)
+	}
+
+	// Two breakouts, the second shared with the editor
+	breakouts := make([]models.Board, 2)
+	for i := range breakouts {
+		breakouts[i] = models.Board{ID: primitive.NewObjectID(), BoardID: "breakout-" + primitive.NewObjectID().Hex(),
+			OwnerID: owner.ID, ParentID: &board.ID, BoardData: testBoardData(), Version: 1, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	}
+	breakouts[1].SharedWith = []models.Collaborator{{UserID: editor.ID, Role: models.CollaboratorRoleEditor}}
+	if err := boards.CreateMany(ctx, breakouts); err != nil {
+		t.Fatalf("create many: %v", err)
+	}
+	ids := func(list []models.Board, err error) []primitive.ObjectID {
+		if err != nil {
+			t.Fatalf("list: %v", err)
+		}
+		found := make([]primitive.ObjectID, len(list))
+		for i := range list {
+			found[i] = list[i].ID
+		}
+		return found
+	}
+	if found := ids(boards.ListBreakouts(ctx, board.ID, owner.ID)); len(found) != 2 || found[0] != breakouts[0].ID {
+		t.Fatalf("list breakouts for owner: got %v", found)
+	}
+	if found := ids(boards.ListBreakouts(ctx, board.ID, editor.ID)); len(found) != 1 || found[0] != breakouts[1].ID {
+		t.Fatalf("list breakouts for editor: got %v", found)
+	}
+	refs := []string{board.BoardID, breakouts[0].ID.Hex(), breakouts[1].BoardID, "missing"}
+	if found := ids(boards.ListForUser(ctx, refs, editor.ID)); len(found) != 2 || found[0] != board.ID || found[1] != breakouts[1].ID {
+		t.Fatalf("list for editor: got %v", found)
+	}
+	if found := ids(boards.ListByIDs(ctx, []primitive.ObjectID{breakouts[0].ID, primitive.NewObjectID()})); len(found) != 1 {
+		t.Fatalf("list by IDs: got %v", found)
+	}
+	if list, err := boards.WithoutContents().ListOwned(ctx, owner.ID); len(ids(list, err)) != 3 || list[0].BoardData != nil {
+		t.Fatalf("list owned without contents: got %+v", list)
+	}
+
+	errs, err := boards.BulkWrite(ctx, []repository.BoardWrite{
+		{ID: breakouts[0].ID, Delete: true},
+		{ID: breakouts[1].ID, Fields: map[string]interface{}{"name": "Group 2"}},
+		{ID: primitive.NewObjectID(), Fields: map[string]interface{}{"name": "Gone"}},
+	})
+	if err != nil || len(errs) != 3 || errs[0] != nil || errs[1] != nil || errs[2] != nil {
+		t.Fatalf("bulk write: got %v, %v", errs, err)
+	}
+	if found, err := boards.FindByID(ctx, breakouts[1].ID); err != nil || found.Name != "Group 2" {
+		t.Fatalf("bulk update: got %+v, %v", found, err)
+	}
+	if _, err := boards.FindByID(ctx, breakouts[0].ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("bulk delete: expected ErrNotFound, got %v", err)
+	}
+
+	if found, err := boards.RemoveFromAll(ctx, editor.ID); err != nil || len(found) != 2 {
+		t.Fatalf("remove from all: got %v, %v", found, err)
+	}
+	if _, err := boards.FindForUser(ctx, board.BoardID, editor.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("find after remove from all: expected ErrNotFound, got %v", err)
+	}
+
+	// Compressed, then back to a document; a stale copy is refused
+	models.BoardCompressionThreshold.Store(1)
+	defer models.BoardCompressionThreshold.Store(0)
+	contains := func(list []primitive.ObjectID, err error) bool {
+		if err != nil {
+			t.Fatalf("list to reencode: %v", err)
+		}
+		return slices.Contains(list, board.ID)
+	}
+	if !contains(boards.ListToReencode(ctx, false, 1)) || contains(boards.ListToReencode(ctx, true, 1)) {
+		t.Fatalf("list to compress: expected the board only as uncompressed")
+	}
+	stale, _ := boards.FindByID(ctx, board.ID)
+	if err := boards.Reencode(ctx, stale, false); err != nil {
+		t.Fatalf("compress: %v", err)
+	}
+	if err := boards.Reencode(ctx, stale, false); !errors.Is(err, repository.ErrVersionConflict) {
+		t.Fatalf("compress again: expected ErrVersionConflict, got %v", err)
+	}
+	if contains(boards.ListToReencode(ctx, false, 1)) || !contains(boards.ListToReencode(ctx, true, 1)) {
+		t.Fatalf("list to decompress: expected the board only as compressed")
+	}
+	if err := boards.Reencode(ctx, stale, true); err != nil {
+		t.Fatalf("decompress: %v", err)
+	}
+	if found, err := boards.FindByID(ctx, board.ID); err != nil || found.Version != 5 || found.BoardData["saved"] != true ||
+		!contains(boards.ListToReencode(ctx, false, 1)) {
+		t.Fatalf("decompress: got %+v, %v", found, err)
+	}
+
+	if err := boards.Delete(ctx, board.ID); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, err := boards.FindByID(ctx, board.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("find deleted: expected ErrNotFound, got %v", err)
+	}
+	if err := boards.DeleteOwned(ctx, owner.ID); err != nil {
+		t.Fatalf("delete owned: %v", err)
+	}
+	if list, err := boards.ListOwned(ctx, owner.ID); err != nil || len(list) != 0 {
+		t.Fatalf("delete owned: %d boards left, %v", len(list), err)
+	}
+
+	if err := users.Delete(ctx, editor.ID); err != nil {
+		t.Fatalf("delete user: %v", err)
+	}
+	if _, err := users.FindByID(ctx, editor.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("find deleted user: expected ErrNotFound, got %v", err)
+	}
+	if err := users.Delete(ctx, editor.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("delete deleted user: expected ErrNotFound, got %v", err)
+	}
+}
+
+// TestGetBoardInMemory serves GetBoard from the in-memory repositories,
+// without MongoDB
+func TestGetBoardInMemory(t *testing.T) {
+	boards, users := repository.NewMemoryBoards(), repository.NewMemoryUsers()
+	libs.UseUsers(users)
+	defer libs.UseUsers(repository.NewMongoUsers())
+
+	ctx := context.Background()
+	user := &models.User{Email: uniqueEmail(t)}
+	if _, err := libs.CreateUser(ctx, user); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	board := &models.Board{ID: primitive.NewObjectID(), BoardID: "in-memory", OwnerID: user.ID, BoardData: testBoardData(), Version: 3}
+	if err := boards.Create(ctx, board); err != nil {
+		t.Fatalf("create board: %v", err)
+	}
+
+	get := func(userID, boardID string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/boards/"+boardID, nil)
+		c.Params = gin.Params{{Key: "boardId", Value: boardID}}
+		c.Set("userId", userID)
+		libs.BoardRepositoryMiddleware(boards)(c)
+		controllers.GetBoard(c)
+		return w
+	}
+
+	w := get(user.ID.Hex(), "in-memory")
+	if w.Code != http.StatusOK || w.Header().Get("ETag") != `"3"` {
+		t.Fatalf("get board: status %d, ETag %q: %s", w.Code, w.Header().Get("ETag"), w.Body.String())
+	}
+	var response map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil || response["name"] != "in-memory" {
+		t.Fatalf("get board: unexpected response %s", w.Body.String())
+	}
+
+	stranger := &models.User{Email: uniqueEmail(t) + ".stranger"}
+	if _, err := libs.CreateUser(ctx, stranger); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	if w := get(stranger.ID.Hex(), board.ID.Hex()); w.Code != http.StatusNotFound {
+		t.Fatalf("get board as stranger: expected 404, got %d", w.Code)
+	}
+	if w := get(primitive.NewObjectID().Hex(), board.ID.Hex()); w.Code != http.StatusNotFound {
+		t.Fatalf("get board as unknown user: expected 404, got %d", w.Code)
+	}
+}
+
+// TestBoardHandlersInMemory serves handlers that reach boards through the
+// repository from the in-memory one, without MongoDB
+func TestBoardHandlersInMemory(t *testing.T) {
+	boards := repository.NewMemoryBoards()
+	ctx := context.Background()
+
+	owner, guest, stranger := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	parent := models.Board{ID: primitive.NewObjectID(), BoardID: "in-memory-retro", Name: "Retro", OwnerID: owner, BoardData: testBoardData(),
+		SharedWith: []models.Collaborator{{UserID: guest, Role: models.CollaboratorRoleViewer, Capabilities: &models.Capabilities{Share: true}}}, Version: 1}
+	assigned := models.Board{ID: primitive.NewObjectID(), Name: "Group 1", OwnerID: owner, ParentID: &parent.ID, BoardData: testBoardData(),
+		SharedWith: []models.Collaborator{{UserID: guest, Role: models.CollaboratorRoleEditor}}, Version: 1}
+	other := models.Board{ID: primitive.NewObjectID(), Name: "Group 2", OwnerID: owner, ParentID: &parent.ID, BoardData: testBoardData(), Version: 1}
+	if err := boards.CreateMany(ctx, []models.Board{parent, assigned, other}); err != nil {
+		t.Fatalf("create boards: %v", err)
+	}
+
+	serve := func(userID primitive.ObjectID, path, boardID string, handlers ...gin.HandlerFunc) (*httptest.ResponseRecorder, map[string]interface{}) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, path, nil)
+		c.Params = gin.Params{{Key: "boardId", Value: boardID}}
+		c.Set("userId", userID.Hex())
+		libs.BoardRepositoryMiddleware(boards)(c)
+		for _, handler := range handlers {
+			if handler(c); c.IsAborted() {
+				break
+			}
+		}
+		var response map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w, response
+	}
+
+	t.Run("breakouts", func(t *testing.T) {
+		path := "/api/boards/" + parent.BoardID + "/breakouts"
+		if w, response := serve(owner, path, parent.BoardID, controllers.GetBreakouts); w.Code != http.StatusOK || response["count"] != float64(2) {
+			t.Fatalf("as owner: expected 2 breakouts, got %d: %s", w.Code, w.Body.String())
+		}
+		w, response := serve(guest, path, parent.BoardID, controllers.GetBreakouts)
+		breakouts, _ := response["breakouts"].([]interface{})
+		if w.Code != http.StatusOK || len(breakouts) != 1 || breakouts[0].(map[string]interface{})["_id"] != assigned.ID.Hex() {
+			t.Fatalf("as participant: expected their breakout, got %d: %s", w.Code, w.Body.String())
+		}
+		if w, _ := serve(stranger, path, parent.BoardID, controllers.GetBreakouts); w.Code != http.StatusNotFound {
+			t.Fatalf("as stranger: expected 404, got %d", w.Code)
+		}
+	})
+
+	t.Run("outline", func(t *testing.T) {
+		path := "/api/boards/" + parent.ID.Hex() + "/outline?format=html"
+		w, _ := serve(guest, path, parent.ID.Hex(), controllers.GetBoardOutline)
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Retro") {
+			t.Fatalf("expected the outline page, got %d: %s", w.Code, w.Body.String())
+		}
+		if w, _ := serve(stranger, path, parent.ID.Hex(), controllers.GetBoardOutline); w.Code != http.StatusNotFound {
+			t.Fatalf("as stranger: expected 404, got %d", w.Code)
+		}
+	})
+
+	t.Run("plugins", func(t *testing.T) {
+		path := "/api/boards/" + parent.BoardID + "/plugins"
+		if w, response := serve(guest, path, parent.BoardID, controllers.GetBoardPlugins); w.Code != http.StatusOK || response["plugins"] == nil {
+			t.Fatalf("expected the plugins, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("capability", func(t *testing.T) {
+		exported := func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"exported": true}) }
+		canExport := libs.RequireBoardCapability(models.CapabilityExport)
+		path := "/api/boards/" + parent.BoardID + "/export"
+		if w, response := serve(guest, path, parent.BoardID, canExport, exported); w.Code != http.StatusForbidden || response["capability"] != models.CapabilityExport {
+			t.Fatalf("without export: expected 403, got %d: %s", w.Code, w.Body.String())
+		}
+		if w, response := serve(owner, path, parent.BoardID, canExport, exported); response["exported"] != true {
+			t.Fatalf("as owner: expected to pass, got %d: %s", w.Code, w.Body.String())
+		}
+		if w, response := serve(guest, path, "missing", canExport, exported); response["exported"] != true {
+			t.Fatalf("unknown board: expected to be left to the handler, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+}
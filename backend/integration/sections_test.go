@@ -0,0 +1,167 @@
+//go:build integration
+
+package integration
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestBoardSections(t *testing.T) {
+	requireHarness(t)
+
+	_, token := seedUser(t, "")
+	boardID := seedBoard(t, token)
+	viewer, viewerToken := seedUser(t, "")
+	doJSON(t, http.MethodPost, "/api/boards/"+boardID+"/share", token, gin.H{"email": viewer.Email, "role": "viewer"})
+	status, body := doJSON(t, http.MethodPut, "/api/boards/"+boardID, token, gin.H{"board": gin.H{
+		"shapes": []gin.H{
+			{"id": "a", "type": "rect", "x": 0, "y": 0, "width": 100, "height": 100},
+			{"id": "b", "type": "text", "x": 20, "y": 150, "text": "Inside"},
+			{"id": "c", "type": "text", "x": 500, "y": 500, "text": "Outside"},
+		},
+	}})
+	if status != http.StatusOK {
+		t.Fatalf("seed shapes: expected 200, got %d: %v", status, body)
+	}
+
+	status, _ = doJSON(t, http.MethodPost, "/api/boards/"+boardID+"/sections", viewerToken, gin.H{"name": "Ideas", "shapeIds": []string{"a"}})
+	if status != http.StatusForbidden {
+		t.Fatalf("create as viewer: expected 403, got %d", status)
+	}
+	status, _ = doJSON(t, http.MethodPost, "/api/boards/"+boardID+"/sections", token, gin.H{"name": "Ideas", "shapeIds": []string{"a", "missing"}})
+	if status != http.StatusBadRequest {
+		t.Fatalf("create with a missing shape: expected 400, got %d", status)
+	}
+	status, body = doJSON(t, http.MethodPost, "/api/boards/"+boardID+"/sections", token, gin.H{"name": "Ideas", "shapeIds": []string{"a", "b"}})
+	if status != http.StatusCreated {
+		t.Fatalf("create: expected 201, got %d: %v", status, body)
+	}
+	section := body["section"].(map[string]interface{})
+	sectionID := section["id"].(string)
+	if len(section["shapeIds"].([]interface{})) != 2 {
+		t.Fatalf("create: expected two shapes in the section, got %v", section)
+	}
+	sectionPath := "/api/boards/" + boardID + "/sections/" + sectionID
+
+	// Collapsing is the viewer's own
+	status, _ = doJSON(t, http.MethodPut, sectionPath+"/collapse", viewerToken, gin.H{"collapsed": true})
+	if status != http.StatusOK {
+		t.Fatalf("collapse as viewer: expected 200, got %d", status)
+	}
+	_, body = doJSON(t, http.MethodGet, "/api/boards/"+boardID+"/outline", viewerToken, nil)
+	sections := body["sections"].([]interface{})
+	if len(sections) != 1 || sections[0].(map[string]interface{})["collapsed"] != true {
+		t.Fatalf("viewer's outline: expected the section collapsed, got %v", sections)
+	}
+	_, body = doJSON(t, http.MethodGet, "/api/boards/"+boardID+"/sections", token, nil)
+	if sections := body["sections"].([]interface{}); len(sections) != 1 || sections[0].(map[string]interface{})["collapsed"] != false {
+		t.Fatalf("owner's sections: expected the section expanded, got %v", sections)
+	}
+
+	// A locked section can't change, by PATCH, PUT or moving it
+	status, _ = doJSON(t, http.MethodPatch, sectionPath, token, gin.H{"locked": true})
+	if status != http.StatusOK {
+		t.Fatalf("lock: expected 200, got %d", status)
+	}
+	status, _ = doJSON(t, http.MethodPatch, "/api/boards/"+boardID, token, gin.H{"operations": []gin.H{
+		{"op": "update", "id": "a", "shape": gin.H{"x": 10}},
+	}})
+	if status != http.StatusForbidden {
+		t.Fatalf("patch a locked shape: expected 403, got %d", status)
+	}
+	status, _ = doJSON(t, http.MethodPatch, "/api/boards/"+boardID, token, gin.H{"operations": []gin.H{
+		{"op": "update", "id": "c", "shape": gin.H{"sectionId": sectionID}},
+	}})
+	if status != http.StatusForbidden {
+		t.Fatalf("move a shape into a locked section: expected 403, got %d", status)
+	}
+	status, _ = doJSON(t, http.MethodPut, "/api/boards/"+boardID, token, gin.H{"board": gin.H{"shapes": []gin.H{}}})
+	if status != http.StatusForbidden {
+		t.Fatalf("put without the locked shapes: expected 403, got %d", status)
+	}
+	status, _ = doJSON(t, http.MethodPost, sectionPath+"/move", token, gin.H{"dx": 50, "dy": 0})
+	if status != http.StatusForbidden {
+		t.Fatalf("move a locked section: expected 403, got %d", status)
+	}
+	status, _ = doJSON(t, http.MethodDelete, sectionPath, token, nil)
+	if status != http.StatusForbidden {
+		t.Fatalf("delete a locked section: expected 403, got %d", status)
+	}
+
+	status, _ = doJSON(t, http.MethodPatch, sectionPath, token, gin.H{"locked": false, "name": "Shipped"})
+	if status != http.StatusOK {
+		t.Fatalf("unlock: expected 200, got %d", status)
+	}
+	status, body = doJSON(t, http.MethodPost, sectionPath+"/move", token, gin.H{"dx": 50, "dy": 0})
+	if status != http.StatusOK || body["applied"] != 2.0 {
+		t.Fatalf("move: expected both shapes moved, got %d: %v", status, body)
+	}
+
+	status, body = doJSON(t, http.MethodGet, "/api/boards/"+boardID+"/export?sectionId="+sectionID, token, nil)
+	if status != http.StatusOK {
+		t.Fatalf("export the section: expected 200, got %d: %v", status, body)
+	}
+	if shapes := body["board"].(map[string]interface{})["shapes"].([]interface{}); len(shapes) != 2 {
+		t.Fatalf("export the section: expected its two shapes, got %v", shapes)
+	}
+
+	status, _ = doJSON(t, http.MethodDelete, sectionPath, token, nil)
+	if status != http.StatusOK {
+		t.Fatalf("delete: expected 200, got %d", status)
+	}
+	_, body = doJSON(t, http.MethodGet, "/api/boards/"+boardID+"/sections", token, nil)
+	if sections := body["sections"].([]interface{}); len(sections) != 0 {
+		t.Fatalf("after delete: expected no sections, got %v", sections)
+	}
+}
+
+// TestSectionLocks checks whole-board saves against locked sections, as
+// they are decoded from MongoDB and from JSON, without a database
+func TestSectionLocks(t *testing.T) {
+	sections := []models.Section{{ID: "s1", Name: "Ideas", Locked: true}, {ID: "s2", Name: "Open"}}
+	stored := map[string]interface{}{"shapes": primitive.A{
+		map[string]interface{}{"id": "a", "type": "pen", "sectionId": "s1", "points": primitive.A{int32(1), int32(2), 3.5, 4.0}},
+		map[string]interface{}{"id": "b", "type": "rect", "sectionId": "s2", "x": 0.0, "y": 0.0},
+	}}
+	shapes := func(a, b map[string]interface{}) map[string]interface{} {
+		list := []interface{}{}
+		for _, shape := range []map[string]interface{}{a, b} {
+			if shape != nil {
+				list = append(list, shape)
+			}
+		}
+		return map[string]interface{}{"shapes": list}
+	}
+	a := map[string]interface{}{"id": "a", "type": "pen", "sectionId": "s1", "points": []interface{}{1.0, 2.0, 3.5, 4.0}}
+	b := map[string]interface{}{"id": "b", "type": "rect", "sectionId": "s2", "x": 0.0, "y": 0.0}
+
+	for _, tc := range []struct {
+		name    string
+		next    map[string]interface{}
+		allowed bool
+	}{
+		{"unchanged", shapes(a, b), true},
+		{"unlocked shape moved", shapes(a, map[string]interface{}{"id": "b", "type": "rect", "sectionId": "s2", "x": 10.0, "y": 0.0}), true},
+		{"locked shape changed", shapes(map[string]interface{}{"id": "a", "type": "pen", "sectionId": "s1", "points": []interface{}{0.0, 0.0}}, b), false},
+		{"locked shape deleted", shapes(nil, b), false},
+		{"locked shape taken out", shapes(map[string]interface{}{"id": "a", "type": "pen", "points": []interface{}{1.0, 2.0, 3.5, 4.0}}, b), false},
+		{"shape put in a locked section", shapes(a, map[string]interface{}{"id": "b", "type": "rect", "sectionId": "s1", "x": 0.0, "y": 0.0}), false},
+	} {
+		violation := libs.CheckSectionLocks(sections, stored, tc.next)
+		if (violation == "") != tc.allowed {
+			t.Errorf("%s: allowed %v, got violation %q", tc.name, tc.allowed, violation)
+		}
+	}
+
+	// Moving a section moves only its shapes
+	apply, undo := libs.MoveSection(stored, "s2", 15, -5)
+	if len(apply) != 1 || apply[0].ID != "b" || apply[0].Shape["x"] != 15.0 || apply[0].Shape["y"] != -5.0 || len(undo) != 1 {
+		t.Fatalf("move: expected b moved by (15, -5), got %v", apply)
+	}
+}
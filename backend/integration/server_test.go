@@ -0,0 +1,94 @@
+//go:build integration
+
+package integration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+)
+
+func TestGracefulShutdown(t *testing.T) {
+	requireHarness(t)
+
+	_, token := seedUser(t, "")
+	boardID := seedBoard(t, token)
+
+	// Requests are held until the test lets them through, so one is still
+	// running when the shutdown starts
+	arrived := make(chan struct{})
+	release := make(chan struct{})
+	server := libs.NewServer("", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(arrived)
+		<-release
+		router.ServeHTTP(w, r)
+	}))
+	if server.ReadHeaderTimeout <= 0 || server.ReadTimeout != libs.Settings().ReadTimeout ||
+		server.WriteTimeout != libs.Settings().WriteTimeout || server.IdleTimeout != libs.Settings().IdleTimeout {
+		t.Fatalf("expected the configured timeouts, got read header %v, read %v, write %v, idle %v",
+			server.ReadHeaderTimeout, server.ReadTimeout, server.WriteTimeout, server.IdleTimeout)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error, 1)
+	go func() { served <- server.Serve(listener) }()
+
+	raw, _ := json.Marshal(gin.H{"board": testBoardData()})
+	req, _ := http.NewRequest(http.MethodPut, "http://"+listener.Addr().String()+"/api/boards/"+boardID, bytes.NewReader(raw))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	saved := make(chan int, 1)
+	go func() {
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			saved <- 0
+			return
+		}
+		resp.Body.Close()
+		saved <- resp.StatusCode
+	}()
+	<-arrived
+
+	shutdown := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		shutdown <- server.Shutdown(ctx)
+	}()
+	if err := <-served; err != http.ErrServerClosed {
+		t.Fatalf("expected Serve to stop with ErrServerClosed, got %v", err)
+	}
+
+	// New connections are refused while the save in flight is drained
+	if _, err := net.DialTimeout("tcp", listener.Addr().String(), time.Second); err == nil {
+		t.Fatal("expected new connections to be refused during the shutdown")
+	}
+	close(release)
+	if status := <-saved; status != http.StatusOK {
+		t.Fatalf("in-flight save: expected 200, got %d", status)
+	}
+	if err := <-shutdown; err != nil {
+		t.Fatalf("expected the shutdown to finish cleanly, got %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := libs.DrainJobs(ctx); err != nil {
+		t.Fatalf("drain jobs: %v", err)
+	}
+
+	status, body := doJSON(t, http.MethodGet, "/api/boards/"+boardID, token, nil)
+	if status != http.StatusOK || body["board"] == nil {
+		t.Fatalf("expected the saved board after the shutdown, got %d: %v", status, body)
+	}
+}
@@ -0,0 +1,94 @@
+//go:build integration
+
+package integration
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/models"
+)
+
+func TestShapeTypeSchemaRegistration(t *testing.T) {
+	requireHarness(t)
+
+	_, adminToken := seedUser(t, models.RoleAdmin)
+	_, token := seedUser(t, "")
+	boardID := seedBoard(t, token)
+
+	schema := gin.H{
+		"$schema":  "https://json-schema.org/draft/2020-12/schema",
+		"type":     "object",
+		"required": []string{"id", "type", "rating"},
+		"properties": gin.H{
+			"rating": gin.H{"type": "integer", "minimum": 1, "maximum": 5},
+			"label":  gin.H{"type": "string", "maxLength": 20},
+		},
+	}
+
+	// Only admins register types, and schemas must use supported keywords
+	if status, response := doJSON(t, http.MethodPut, "/api/admin/shape-types/test-rating", token, gin.H{"schema": schema}); status != http.StatusForbidden {
+		t.Fatalf("register as non-admin: expected 403, got %d (%v)", status, response)
+	}
+	if status, response := doJSON(t, http.MethodPut, "/api/admin/shape-types/test-rating", adminToken, gin.H{
+		"schema": gin.H{"oneOf": []gin.H{{"type": "object"}}},
+	}); status != http.StatusBadRequest {
+		t.Fatalf("register unsupported schema: expected 400, got %d (%v)", status, response)
+	}
+	if status, response := doJSON(t, http.MethodPut, "/api/admin/shape-types/rect", adminToken, gin.H{"schema": schema}); status != http.StatusBadRequest {
+		t.Fatalf("register built-in type: expected 400, got %d (%v)", status, response)
+	}
+
+	status, response := doJSON(t, http.MethodPut, "/api/admin/shape-types/test-rating", adminToken, gin.H{
+		"description": "Star rating",
+		"schema":      schema,
+	})
+	if status != http.StatusOK {
+		t.Fatalf("register: expected 200, got %d (%v)", status, response)
+	}
+
+	// Clients can read the schema back
+	status, response = doJSON(t, http.MethodGet, "/api/shape-types", token, nil)
+	found := false
+	for _, item := range response["shapeTypes"].([]interface{}) {
+		shapeType := item.(map[string]interface{})
+		if shapeType["type"] == "test-rating" {
+			found = shapeType["source"] == "schema" && shapeType["schema"].(map[string]interface{})["$schema"] != nil
+		}
+	}
+	if status != http.StatusOK || !found {
+		t.Fatalf("list shape types: expected test-rating with its schema, got %d (%v)", status, response)
+	}
+
+	// Instances are validated on write
+	status, response = doJSON(t, http.MethodPatch, "/api/boards/"+boardID, token, gin.H{"operations": []gin.H{
+		{"op": "add", "shape": gin.H{"id": "stars", "type": "test-rating", "rating": 7}},
+	}})
+	if status != http.StatusBadRequest {
+		t.Fatalf("patch with invalid rating: expected 400, got %d (%v)", status, response)
+	}
+	status, response = doJSON(t, http.MethodPut, "/api/boards/"+boardID, token, gin.H{"board": gin.H{
+		"shapes": []gin.H{{"id": "stars", "type": "test-rating"}},
+	}})
+	if status != http.StatusUnprocessableEntity {
+		t.Fatalf("put without rating: expected 422, got %d (%v)", status, response)
+	}
+	status, response = doJSON(t, http.MethodPatch, "/api/boards/"+boardID, token, gin.H{"operations": []gin.H{
+		{"op": "add", "shape": gin.H{"id": "stars", "type": "test-rating", "rating": 4, "label": "Usefulness"}},
+	}})
+	if status != http.StatusOK {
+		t.Fatalf("patch with valid rating: expected 200, got %d (%v)", status, response)
+	}
+
+	// Once removed, the type is no longer validated
+	if status, response := doJSON(t, http.MethodDelete, "/api/admin/shape-types/test-rating", adminToken, nil); status != http.StatusOK {
+		t.Fatalf("delete: expected 200, got %d (%v)", status, response)
+	}
+	status, response = doJSON(t, http.MethodPatch, "/api/boards/"+boardID, token, gin.H{"operations": []gin.H{
+		{"op": "update", "id": "stars", "shape": gin.H{"rating": 9}},
+	}})
+	if status != http.StatusOK {
+		t.Fatalf("patch after delete: expected 200, got %d (%v)", status, response)
+	}
+}
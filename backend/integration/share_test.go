@@ -0,0 +1,680 @@
+//go:build integration
+
+package integration
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/models"
+)
+
+func TestBoardSharingRoles(t *testing.T) {
+	requireHarness(t)
+
+	_, ownerToken := seedUser(t, "")
+	collaborator, collaboratorToken := seedUser(t, "")
+	boardID := seedBoard(t, ownerToken)
+
+	// Viewers can read but not write
+	status, response := doJSON(t, http.MethodPost, "/api/boards/"+boardID+"/share", ownerToken, gin.H{
+		"email": collaborator.Email,
+		"role":  models.CollaboratorRoleViewer,
+	})
+	if status != http.StatusOK {
+		t.Fatalf("share: expected 200, got %d (%v)", status, response)
+	}
+
+	status, _ = doJSON(t, http.MethodGet, "/api/boards/"+boardID, collaboratorToken, nil)
+	if status != http.StatusOK {
+		t.Fatalf("viewer get: expected 200, got %d", status)
+	}
+	status, _ = doJSON(t, http.MethodPut, "/api/boards/"+boardID, collaboratorToken, gin.H{"board": testBoardData()})
+	if status != http.StatusForbidden {
+		t.Fatalf("viewer update: expected 403, got %d", status)
+	}
+
+	// Promote to editor
+	doJSON(t, http.MethodPost, "/api/boards/"+boardID+"/share", ownerToken, gin.H{
+		"userId": collaborator.ID.Hex(),
+		"role":   models.CollaboratorRoleEditor,
+	})
+	status, _ = doJSON(t, http.MethodPut, "/api/boards/"+boardID, collaboratorToken, gin.H{"board": testBoardData()})
+	if status != http.StatusOK {
+		t.Fatalf("editor update: expected 200, got %d", status)
+	}
+
+	// Collaborators can't delete or reshare
+	status, _ = doJSON(t, http.MethodDelete, "/api/boards/"+boardID, collaboratorToken, nil)
+	if status != http.StatusNotFound {
+		t.Fatalf("editor delete: expected 404, got %d", status)
+	}
+
+	_, response = doJSON(t, http.MethodGet, "/api/boards", collaboratorToken, nil)
+	boards := response["boards"].([]interface{})
+	if len(boards) != 1 {
+		t.Fatalf("list: expected shared board in list, got %d boards", len(boards))
+	}
+	if collaborators := boards[0].(map[string]interface{})["collaborators"].([]interface{}); len(collaborators) != 1 {
+		t.Fatalf("list: expected 1 collaborator, got %d", len(collaborators))
+	}
+
+	// Unshare
+	status, _ = doJSON(t, http.MethodDelete, "/api/boards/"+boardID+"/share/"+collaborator.ID.Hex(), ownerToken, nil)
+	if status != http.StatusOK {
+		t.Fatalf("unshare: expected 200, got %d", status)
+	}
+	status, _ = doJSON(t, http.MethodGet, "/api/boards/"+boardID, collaboratorToken, nil)
+	if status != http.StatusNotFound {
+		t.Fatalf("get after unshare: expected 404, got %d", status)
+	}
+}
+
+func TestShareCollaboratorQuota(t *testing.T) {
+	requireHarness(t)
+	defer func() { libs.Settings().CollaboratorLimit = 0 }()
+	libs.Settings().CollaboratorLimit = 2
+
+	_, ownerToken := seedUser(t, "")
+	boardID := seedBoard(t, ownerToken)
+	share := func(email, role string) *httptest.ResponseRecorder {
+		t.Helper()
+		body, _ := json.Marshal(gin.H{"email": email, "role": role})
+		req := httptest.NewRequest(http.MethodPost, "/api/boards/"+boardID+"/share", strings.NewReader(string(body)))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+ownerToken)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	first, _ := seedUser(t, "")
+	second, _ := seedUser(t, "")
+	third, _ := seedUser(t, "")
+
+	if w := share(first.Email, models.CollaboratorRoleViewer); w.Code != http.StatusOK || w.Header().Get("X-Quota-Remaining-Collaborators") != "1" {
+		t.Fatalf("first share: expected 200 with 1 remaining, got %d (%q)", w.Code, w.Header().Get("X-Quota-Remaining-Collaborators"))
+	}
+	w := share(second.Email, models.CollaboratorRoleViewer)
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if w.Code != http.StatusOK || w.Header().Get("X-Quota-Remaining-Collaborators") != "0" {
+		t.Fatalf("share at limit: expected 200 with none remaining, got %d (%q)", w.Code, w.Header().Get("X-Quota-Remaining-Collaborators"))
+	}
+	if warnings, ok := response["warnings"].([]interface{}); !ok || len(warnings) == 0 {
+		t.Fatalf("share at limit: expected warnings, got %v", response)
+	}
+
+	if w := share(third.Email, models.CollaboratorRoleViewer); w.Code != http.StatusForbidden {
+		t.Fatalf("share over limit: expected 403, got %d", w.Code)
+	}
+	// Collaborators already on the board can still have their role changed
+	if w := share(second.Email, models.CollaboratorRoleEditor); w.Code != http.StatusOK {
+		t.Fatalf("role change at limit: expected 200, got %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestShareRequiresOwner(t *testing.T) {
+	requireHarness(t)
+
+	_, ownerToken := seedUser(t, "")
+	other, otherToken := seedUser(t, "")
+	boardID := seedBoard(t, ownerToken)
+
+	status, _ := doJSON(t, http.MethodPost, "/api/boards/"+boardID+"/share", otherToken, gin.H{
+		"userId": other.ID.Hex(),
+		"role":   models.CollaboratorRoleEditor,
+	})
+	if status != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", status)
+	}
+}
+
+func TestShareDoesNotRevealEmails(t *testing.T) {
+	requireHarness(t)
+
+	_, ownerToken := seedUser(t, "")
+	registered, _ := seedUser(t, "")
+	_, outsiderToken := seedUser(t, "")
+	boardID := seedBoard(t, ownerToken)
+
+	// Someone without access gets the same answer whether or not the email
+	// is registered
+	for _, email := range []string{registered.Email, uniqueEmail(t)} {
+		status, response := doJSON(t, http.MethodPost, "/api/boards/"+boardID+"/share", outsiderToken, gin.H{
+			"email": email,
+			"role":  models.CollaboratorRoleViewer,
+		})
+		if status != http.StatusNotFound || response["error"] != "Board not found or access denied" {
+			t.Fatalf("outsider sharing with %s: expected the board's 404, got %d (%v)", email, status, response)
+		}
+	}
+
+	status, response := doJSON(t, http.MethodPost, "/api/boards/"+boardID+"/share", ownerToken, gin.H{
+		"email": uniqueEmail(t),
+		"role":  models.CollaboratorRoleViewer,
+	})
+	if status != http.StatusNotFound || response["error"] != "User not found" {
+		t.Fatalf("owner sharing with an unknown email: expected 404, got %d (%v)", status, response)
+	}
+}
+
+func TestShareCapabilities(t *testing.T) {
+	requireHarness(t)
+
+	_, ownerToken := seedUser(t, "")
+	editor, editorToken := seedUser(t, "")
+	guest, guestToken := seedUser(t, "")
+	third, _ := seedUser(t, "")
+	boardID := seedBoard(t, ownerToken)
+
+	status, response := doJSON(t, http.MethodPost, "/api/boards/"+boardID+"/share", ownerToken, gin.H{
+		"userId":       editor.ID.Hex(),
+		"role":         models.CollaboratorRoleEditor,
+		"capabilities": gin.H{"share": true, "commentOnly": true},
+	})
+	if status != http.StatusOK {
+		t.Fatalf("share: expected 200, got %d (%v)", status, response)
+	}
+
+	// Without export or history, those endpoints are closed
+	if status, response := doJSON(t, http.MethodGet, "/api/boards/"+boardID+"/export", editorToken, nil); status != http.StatusForbidden || response["capability"] != models.CapabilityExport {
+		t.Fatalf("export: expected 403 for export, got %d (%v)", status, response)
+	}
+	if status, _ := doJSON(t, http.MethodGet, "/api/boards/"+boardID+"/versions", editorToken, nil); status != http.StatusForbidden {
+		t.Fatalf("versions: expected 403, got %d", status)
+	}
+
+	// Comment-only editors change notes and nothing else
+	emptied := testBoardData()
+	emptied["shapes"] = []interface{}{}
+	if status, _ := doJSON(t, http.MethodPut, "/api/boards/"+boardID, editorToken, gin.H{"board": emptied}); status != http.StatusForbidden {
+		t.Fatalf("comment-only delete: expected 403, got %d", status)
+	}
+	withNote := testBoardData()
+	withNote["shapes"] = append(withNote["shapes"].([]interface{}), map[string]interface{}{
+		"id": "note-1", "type": "text", "x": 10, "y": 10, "text": "idea",
+	})
+	if status, _ := doJSON(t, http.MethodPut, "/api/boards/"+boardID, editorToken, gin.H{"board": withNote}); status != http.StatusOK {
+		t.Fatalf("comment-only add note: expected 200, got %d", status)
+	}
+
+	// Sharing further stays within the sharer's own access
+	if status, _ := doJSON(t, http.MethodPost, "/api/boards/"+boardID+"/share", editorToken, gin.H{
+		"userId":       guest.ID.Hex(),
+		"role":         models.CollaboratorRoleViewer,
+		"capabilities": gin.H{"export": true},
+	}); status != http.StatusForbidden {
+		t.Fatalf("share beyond own capabilities: expected 403, got %d", status)
+	}
+	if status, _ := doJSON(t, http.MethodPost, "/api/boards/"+boardID+"/share", editorToken, gin.H{
+		"userId": guest.ID.Hex(),
+		"role":   models.CollaboratorRoleViewer,
+	}); status != http.StatusOK {
+		t.Fatalf("share as a collaborator: expected 200, got %d", status)
+	}
+	status, response = doJSON(t, http.MethodGet, "/api/boards/"+boardID, guestToken, nil)
+	if status != http.StatusOK {
+		t.Fatalf("guest get: expected 200, got %d", status)
+	}
+	if capabilities := response["capabilities"].(map[string]interface{}); capabilities["export"] != false || capabilities["history"] != false || capabilities["commentOnly"] != true {
+		t.Fatalf("guest capabilities: expected comment-only without export or history, got %v", capabilities)
+	}
+
+	// Viewers can't pass on more than they have
+	doJSON(t, http.MethodPost, "/api/boards/"+boardID+"/share", ownerToken, gin.H{
+		"userId":       guest.ID.Hex(),
+		"role":         models.CollaboratorRoleViewer,
+		"capabilities": gin.H{"share": true},
+	})
+	if status, _ := doJSON(t, http.MethodPost, "/api/boards/"+boardID+"/share", guestToken, gin.H{
+		"userId": third.ID.Hex(),
+		"role":   models.CollaboratorRoleEditor,
+	}); status != http.StatusForbidden {
+		t.Fatalf("viewer shares as editor: expected 403, got %d", status)
+	}
+	if status, _ := doJSON(t, http.MethodPost, "/api/boards/"+boardID+"/share", guestToken, gin.H{
+		"userId": editor.ID.Hex(),
+		"role":   models.CollaboratorRoleViewer,
+	}); status != http.StatusForbidden {
+		t.Fatalf("viewer changes another collaborator: expected 403, got %d", status)
+	}
+}
+
+func TestWithinCapabilities(t *testing.T) {
+	sharer := models.Capabilities{Export: true, Share: true}
+	if !libs.WithinCapabilities(models.Capabilities{Export: true}, sharer) {
+		t.Fatal("expected export to be within export and share")
+	}
+	if libs.WithinCapabilities(models.Capabilities{History: true}, sharer) {
+		t.Fatal("expected history to be beyond export and share")
+	}
+	if libs.WithinCapabilities(models.Capabilities{}, models.Capabilities{Export: true, Share: true, History: true, CommentOnly: true}) {
+		t.Fatal("expected a comment-only sharer to pass on comment-only access")
+	}
+}
+
+func TestFacilitationRestrictsParticipants(t *testing.T) {
+	requireHarness(t)
+
+	_, ownerToken := seedUser(t, "")
+	participant, participantToken := seedUser(t, "")
+	boardID := seedBoard(t, ownerToken)
+
+	doJSON(t, http.MethodPost, "/api/boards/"+boardID+"/share", ownerToken, gin.H{
+		"userId": participant.ID.Hex(),
+		"role":   models.CollaboratorRoleEditor,
+	})
+
+	status, _ := doJSON(t, http.MethodPut, "/api/boards/"+boardID+"/facilitation", ownerToken, gin.H{
+		"noDelete":        true,
+		"stickyNotesOnly": true,
+	})
+	if status != http.StatusOK {
+		t.Fatalf("start: expected 200, got %d", status)
+	}
+
+	// Removing the rectangle is blocked
+	emptied := testBoardData()
+	emptied["shapes"] = []interface{}{}
+	status, _ = doJSON(t, http.MethodPut, "/api/boards/"+boardID, participantToken, gin.H{"board": emptied})
+	if status != http.StatusForbidden {
+		t.Fatalf("participant delete: expected 403, got %d", status)
+	}
+
+	// Adding a note is allowed
+	withNote := testBoardData()
+	withNote["shapes"] = append(withNote["shapes"].([]interface{}), map[string]interface{}{
+		"id": "note-1", "type": "text", "x": 10, "y": 10, "text": "idea",
+	})
+	status, _ = doJSON(t, http.MethodPut, "/api/boards/"+boardID, participantToken, gin.H{"board": withNote})
+	if status != http.StatusOK {
+		t.Fatalf("participant add note: expected 200, got %d", status)
+	}
+
+	// The owner is not restricted
+	status, _ = doJSON(t, http.MethodPut, "/api/boards/"+boardID, ownerToken, gin.H{"board": emptied})
+	if status != http.StatusOK {
+		t.Fatalf("owner delete: expected 200, got %d", status)
+	}
+
+	status, _ = doJSON(t, http.MethodDelete, "/api/boards/"+boardID+"/facilitation", ownerToken, nil)
+	if status != http.StatusOK {
+		t.Fatalf("end: expected 200, got %d", status)
+	}
+}
+
+func TestPrivateNotesUntilReveal(t *testing.T) {
+	requireHarness(t)
+
+	_, ownerToken := seedUser(t, "")
+	alice, aliceToken := seedUser(t, "")
+	bob, bobToken := seedUser(t, "")
+	boardID := seedBoard(t, ownerToken)
+
+	for _, user := range []*models.User{alice, bob} {
+		doJSON(t, http.MethodPost, "/api/boards/"+boardID+"/share", ownerToken, gin.H{
+			"userId": user.ID.Hex(),
+			"role":   models.CollaboratorRoleEditor,
+		})
+	}
+	doJSON(t, http.MethodPut, "/api/boards/"+boardID+"/facilitation", ownerToken, gin.H{"privateNotes": true})
+
+	shapeCount := func(token string) int {
+		_, response := doJSON(t, http.MethodGet, "/api/boards/"+boardID, token, nil)
+		return len(response["board"].(map[string]interface{})["shapes"].([]interface{}))
+	}
+
+	// Alice adds a note only she can see
+	withNote := testBoardData()
+	withNote["shapes"] = append(withNote["shapes"].([]interface{}), map[string]interface{}{
+		"id": "alice-note", "type": "text", "text": "secret idea",
+	})
+	status, _ := doJSON(t, http.MethodPut, "/api/boards/"+boardID, aliceToken, gin.H{"board": withNote})
+	if status != http.StatusOK {
+		t.Fatalf("alice update: expected 200, got %d", status)
+	}
+	if got := shapeCount(aliceToken); got != 2 {
+		t.Fatalf("alice: expected 2 shapes, got %d", got)
+	}
+	if got := shapeCount(bobToken); got != 1 {
+		t.Fatalf("bob before reveal: expected 1 shape, got %d", got)
+	}
+
+	// Bob saving his view must not drop Alice's hidden note
+	status, _ = doJSON(t, http.MethodPut, "/api/boards/"+boardID, bobToken, gin.H{"board": testBoardData()})
+	if status != http.StatusOK {
+		t.Fatalf("bob update: expected 200, got %d", status)
+	}
+
+	status, _ = doJSON(t, http.MethodPost, "/api/boards/"+boardID+"/facilitation/reveal", ownerToken, nil)
+	if status != http.StatusOK {
+		t.Fatalf("reveal: expected 200, got %d", status)
+	}
+	if got := shapeCount(bobToken); got != 2 {
+		t.Fatalf("bob after reveal: expected 2 shapes, got %d", got)
+	}
+}
+
+// openShareLink opens a share link anonymously from the given country
+func openShareLink(t *testing.T, token, country, referrer string) (int, map[string]interface{}) {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, "/share/"+token, nil)
+	if country != "" {
+		req.Header.Set("CF-IPCountry", country)
+	}
+	if referrer != "" {
+		req.Header.Set("Referer", referrer)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	return w.Code, response
+}
+
+func TestShareLinkUsageAndAlerts(t *testing.T) {
+	requireHarness(t)
+
+	var alerts []string
+	original := libs.SendEmail
+	libs.SendEmail = func(to, subject, body string) error {
+		alerts = append(alerts, body)
+		return nil
+	}
+	defer func() { libs.SendEmail = original }()
+
+	_, ownerToken := seedUser(t, "")
+	_, otherToken := seedUser(t, "")
+	boardID := seedBoard(t, ownerToken)
+
+	status, _ := doJSON(t, http.MethodPost, "/api/boards/"+boardID+"/share-links", otherToken, gin.H{})
+	if status != http.StatusNotFound {
+		t.Fatalf("non-owner create: expected 404, got %d", status)
+	}
+
+	status, response := doJSON(t, http.MethodPost, "/api/boards/"+boardID+"/share-links", ownerToken, gin.H{
+		"alertThreshold":  2,
+		"alertNewCountry": true,
+	})
+	if status != http.StatusCreated {
+		t.Fatalf("create: expected 201, got %d (%v)", status, response)
+	}
+	token := response["token"].(string)
+	linkID := response["link"].(map[string]interface{})["_id"].(string)
+
+	status, response = openShareLink(t, token, "DE", "https://example.com/page?secret=1")
+	if status != http.StatusOK || response["role"] != models.CollaboratorRoleViewer || response["board"] == nil {
+		t.Fatalf("open: expected the board read-only, got %d (%v)", status, response)
+	}
+	openShareLink(t, token, "de", "")
+	if len(alerts) != 0 {
+		t.Fatalf("expected no alerts yet, got %v", alerts)
+	}
+
+	// Third use passes the threshold and comes from a new country
+	openShareLink(t, token, "FR", "")
+	if len(alerts) != 1 || !strings.Contains(alerts[0], "3 times") || !strings.Contains(alerts[0], "(FR)") {
+		t.Fatalf("expected one alert for threshold and country, got %v", alerts)
+	}
+	openShareLink(t, token, "FR", "")
+	if len(alerts) != 1 {
+		t.Fatalf("expected alerts to fire once, got %d", len(alerts))
+	}
+
+	status, response = doJSON(t, http.MethodGet, "/api/boards/"+boardID+"/share-links/"+linkID+"?limit=10", ownerToken, nil)
+	if status != http.StatusOK {
+		t.Fatalf("detail: expected 200, got %d (%v)", status, response)
+	}
+	link := response["link"].(map[string]interface{})
+	uses := response["uses"].([]interface{})
+	if link["useCount"].(float64) != 4 || len(link["countries"].([]interface{})) != 2 || len(uses) != 4 {
+		t.Fatalf("detail: unexpected usage %v", response)
+	}
+	if first := uses[len(uses)-1].(map[string]interface{}); first["referrer"] != "https://example.com/page" || first["country"] != "DE" {
+		t.Fatalf("detail: unexpected oldest use %v", first)
+	}
+
+	// One-click revoke from the alert email
+	_, after, _ := strings.Cut(alerts[0], "/share-links/revoke?token=")
+	revokeToken := strings.Fields(after)[0]
+	status, _ = doJSON(t, http.MethodGet, "/share-links/revoke?token="+revokeToken, "", nil)
+	if status != http.StatusOK {
+		t.Fatalf("one-click revoke: expected 200, got %d", status)
+	}
+	status, _ = openShareLink(t, token, "DE", "")
+	if status != http.StatusNotFound {
+		t.Fatalf("revoked link: expected 404, got %d", status)
+	}
+	status, _ = doJSON(t, http.MethodDelete, "/api/boards/"+boardID+"/share-links/"+linkID, ownerToken, nil)
+	if status != http.StatusConflict {
+		t.Fatalf("revoke again: expected 409, got %d", status)
+	}
+}
+
+// getWithBoardToken fetches a guest or embed path with the token in the
+// query string, as a page on origin would
+func getWithBoardToken(t *testing.T, path, token, origin string) int {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, path+"?token="+token, nil)
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestGuestAndEmbedTokens(t *testing.T) {
+	requireHarness(t)
+
+	_, ownerToken := seedUser(t, "")
+	boardID := seedBoard(t, ownerToken)
+	_, otherBoardToken := seedUser(t, "")
+	otherBoardID := seedBoard(t, otherBoardToken)
+
+	status, response := doJSON(t, http.MethodPost, "/api/boards/"+boardID+"/share-links", ownerToken, gin.H{})
+	if status != http.StatusCreated {
+		t.Fatalf("create share link: expected 201, got %d (%v)", status, response)
+	}
+	linkToken := response["token"].(string)
+	linkID := response["link"].(map[string]interface{})["_id"].(string)
+
+	status, response = openShareLink(t, linkToken, "", "https://viewer.example.com/board")
+	guestToken, _ := response["guestToken"].(string)
+	if status != http.StatusOK || guestToken == "" || response["boardId"] != boardID {
+		t.Fatalf("open share link: expected a guest token for %s, got %d (%v)", boardID, status, response)
+	}
+
+	if status := getWithBoardToken(t, "/guest/"+boardID, guestToken, "https://viewer.example.com"); status != http.StatusOK {
+		t.Fatalf("guest token: expected 200, got %d", status)
+	}
+	// Bound to the origin, the board and its kind of route
+	if status := getWithBoardToken(t, "/guest/"+boardID, guestToken, "https://evil.example.com"); status != http.StatusForbidden {
+		t.Fatalf("guest token from another origin: expected 403, got %d", status)
+	}
+	if status := getWithBoardToken(t, "/guest/"+otherBoardID, guestToken, "https://viewer.example.com"); status != http.StatusForbidden {
+		t.Fatalf("guest token for another board: expected 403, got %d", status)
+	}
+	if status := getWithBoardToken(t, "/embed/"+boardID, guestToken, "https://viewer.example.com"); status != http.StatusForbidden {
+		t.Fatalf("guest token on the embed route: expected 403, got %d", status)
+	}
+	// Not an access token, and access tokens aren't board tokens
+	if status, _ := doJSON(t, http.MethodGet, "/api/boards/"+boardID, guestToken, nil); status != http.StatusUnauthorized {
+		t.Fatalf("guest token on the API: expected 401, got %d", status)
+	}
+	if status := getWithBoardToken(t, "/guest/"+boardID, ownerToken, "https://viewer.example.com"); status != http.StatusUnauthorized {
+		t.Fatalf("access token on the guest route: expected 401, got %d", status)
+	}
+
+	status, response = doJSON(t, http.MethodPost, "/api/boards/"+boardID+"/embed-tokens", ownerToken, gin.H{
+		"origin":    "https://blog.example.com",
+		"expiresIn": 600,
+	})
+	if status != http.StatusCreated {
+		t.Fatalf("create embed token: expected 201, got %d (%v)", status, response)
+	}
+	embedToken := response["token"].(string)
+	embedID := response["embedToken"].(map[string]interface{})["id"].(string)
+
+	// Iframes send a Referer rather than an Origin
+	req := httptest.NewRequest(http.MethodGet, "/embed/"+boardID+"?token="+embedToken, nil)
+	req.Header.Set("Referer", "https://blog.example.com/posts/retro")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("embed from its origin: expected 200, got %d (%s)", w.Code, w.Body.String())
+	}
+	if status := getWithBoardToken(t, "/embed/"+boardID, embedToken, ""); status != http.StatusForbidden {
+		t.Fatalf("embed without an origin: expected 403, got %d", status)
+	}
+
+	status, response = doJSON(t, http.MethodGet, "/api/boards/"+boardID+"/embed-tokens", ownerToken, nil)
+	if tokens, _ := response["embedTokens"].([]interface{}); status != http.StatusOK || len(tokens) != 1 {
+		t.Fatalf("list embed tokens: expected one, got %d (%v)", status, response)
+	}
+
+	// Revocation applies at once
+	status, _ = doJSON(t, http.MethodDelete, "/api/boards/"+boardID+"/embed-tokens/"+embedID, ownerToken, nil)
+	if status != http.StatusOK {
+		t.Fatalf("revoke embed token: expected 200, got %d", status)
+	}
+	if status := getWithBoardToken(t, "/embed/"+boardID, embedToken, "https://blog.example.com"); status != http.StatusUnauthorized {
+		t.Fatalf("revoked embed token: expected 401, got %d", status)
+	}
+
+	status, _ = doJSON(t, http.MethodDelete, "/api/boards/"+boardID+"/share-links/"+linkID, ownerToken, nil)
+	if status != http.StatusOK {
+		t.Fatalf("revoke share link: expected 200, got %d", status)
+	}
+	if status := getWithBoardToken(t, "/guest/"+boardID, guestToken, "https://viewer.example.com"); status != http.StatusUnauthorized {
+		t.Fatalf("guest token of a revoked link: expected 401, got %d", status)
+	}
+}
+
+func TestFrameShareLinks(t *testing.T) {
+	requireHarness(t)
+
+	_, ownerToken := seedUser(t, "")
+	boardID := seedBoard(t, ownerToken)
+	status, response := doJSON(t, http.MethodPut, "/api/boards/"+boardID, ownerToken, gin.H{"board": gin.H{
+		"shapes": []gin.H{
+			{"id": "f", "type": "frame", "x": 0, "y": 0, "width": 400, "height": 300, "title": "Retro"},
+			{"id": "in", "type": "text", "x": 20, "y": 20, "text": "Inside"},
+			{"id": "out", "type": "text", "x": 900, "y": 900, "text": "Outside"},
+		},
+	}})
+	if status != http.StatusOK {
+		t.Fatalf("seed shapes: expected 200, got %d (%v)", status, response)
+	}
+
+	for _, frameID := range []string{"missing", "in"} {
+		status, _ = doJSON(t, http.MethodPost, "/api/boards/"+boardID+"/share-links", ownerToken, gin.H{"frameId": frameID})
+		if status != http.StatusBadRequest {
+			t.Fatalf("share link for %q: expected 400, got %d", frameID, status)
+		}
+	}
+	status, response = doJSON(t, http.MethodPost, "/api/boards/"+boardID+"/share-links", ownerToken, gin.H{"frameId": "f"})
+	if status != http.StatusCreated {
+		t.Fatalf("create frame share link: expected 201, got %d (%v)", status, response)
+	}
+	linkToken := response["token"].(string)
+
+	shapeIDs := func(response map[string]interface{}) []string {
+		ids := []string{}
+		board, _ := response["board"].(map[string]interface{})
+		shapes, _ := board["shapes"].([]interface{})
+		for _, shape := range shapes {
+			ids = append(ids, shape.(map[string]interface{})["id"].(string))
+		}
+		return ids
+	}
+
+	status, response = openShareLink(t, linkToken, "", "https://viewer.example.com/board")
+	if ids := shapeIDs(response); status != http.StatusOK || strings.Join(ids, ",") != "f,in" || response["frame"] == nil {
+		t.Fatalf("open frame share link: expected the frame and its shape, got %d %v", status, ids)
+	}
+
+	// Reloads through the guest token stay within the frame
+	req := httptest.NewRequest(http.MethodGet, "/guest/"+boardID+"?token="+response["guestToken"].(string), nil)
+	req.Header.Set("Origin", "https://viewer.example.com")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	response = nil
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if ids := shapeIDs(response); w.Code != http.StatusOK || strings.Join(ids, ",") != "f,in" {
+		t.Fatalf("guest reload: expected the frame and its shape, got %d %v", w.Code, ids)
+	}
+
+	status, response = doJSON(t, http.MethodPost, "/api/boards/"+boardID+"/embed-tokens", ownerToken, gin.H{
+		"origin":  "https://blog.example.com",
+		"frameId": "f",
+	})
+	if status != http.StatusCreated {
+		t.Fatalf("create frame embed token: expected 201, got %d (%v)", status, response)
+	}
+	req = httptest.NewRequest(http.MethodGet, "/embed/"+boardID+"?token="+response["token"].(string), nil)
+	req.Header.Set("Origin", "https://blog.example.com")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	response = nil
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if ids := shapeIDs(response); w.Code != http.StatusOK || strings.Join(ids, ",") != "f,in" {
+		t.Fatalf("frame embed: expected the frame and its shape, got %d %v", w.Code, ids)
+	}
+
+	// Once the frame is gone, the link shows nothing
+	doJSON(t, http.MethodPut, "/api/boards/"+boardID, ownerToken, gin.H{"board": gin.H{"shapes": []gin.H{
+		{"id": "out", "type": "text", "x": 900, "y": 900, "text": "Outside"},
+	}}})
+	if status, _ := openShareLink(t, linkToken, "", ""); status != http.StatusNotFound {
+		t.Fatalf("frame deleted: expected 404, got %d", status)
+	}
+}
+
+// TestFrameBoardData checks which shapes a frame-scoped link shows, without
+// a database
+func TestFrameBoardData(t *testing.T) {
+	data := map[string]interface{}{
+		"scale": 1.0,
+		"shapes": []interface{}{
+			map[string]interface{}{"id": "f", "type": "frame", "x": 0.0, "y": 0.0, "width": 400.0, "height": 300.0, "title": "Retro"},
+			map[string]interface{}{"id": "inside", "type": "rect", "x": 10.0, "y": 10.0, "width": 50.0, "height": 50.0},
+			map[string]interface{}{"id": "line", "type": "line", "points": []interface{}{5.0, 5.0, 300.0, 200.0}},
+			map[string]interface{}{"id": "across", "type": "rect", "x": 350.0, "y": 10.0, "width": 100.0, "height": 50.0},
+			map[string]interface{}{"id": "outside", "type": "circle", "x": 900.0, "y": 900.0, "radius": 20.0},
+			map[string]interface{}{"id": "unplaced", "type": "text", "text": "Nowhere"},
+		},
+	}
+
+	scoped, frame, ok := libs.FrameBoardData(data, "f")
+	if !ok {
+		t.Fatal("expected the frame found")
+	}
+	ids := []string{}
+	for _, shape := range scoped["shapes"].([]interface{}) {
+		ids = append(ids, shape.(map[string]interface{})["id"].(string))
+	}
+	if strings.Join(ids, ",") != "f,inside,line" {
+		t.Fatalf("expected the frame, inside and line, got %v", ids)
+	}
+	if scoped["scale"] != 1.0 || frame.Title != "Retro" || frame.Width != 400 || frame.Height != 300 {
+		t.Fatalf("expected the rest of the state and the frame's bounds, got %v %+v", scoped["scale"], frame)
+	}
+	if len(data["shapes"].([]interface{})) != 6 {
+		t.Fatal("expected the board state left alone")
+	}
+
+	for _, id := range []string{"missing", "outside", "unplaced"} {
+		if _, _, ok := libs.FrameBoardData(data, id); ok {
+			t.Errorf("%s: expected no frame", id)
+		}
+	}
+}
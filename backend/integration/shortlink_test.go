@@ -0,0 +1,121 @@
+//go:build integration
+
+package integration
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/models"
+)
+
+func TestShortLinks(t *testing.T) {
+	requireHarness(t)
+
+	_, ownerToken := seedUser(t, "")
+	viewer, viewerToken := seedUser(t, "")
+	boardID := seedBoard(t, ownerToken)
+	doJSON(t, http.MethodPost, "/api/boards/"+boardID+"/share", ownerToken, gin.H{
+		"userId":       viewer.ID.Hex(),
+		"role":         models.CollaboratorRoleViewer,
+		"capabilities": gin.H{"history": true},
+	})
+
+	follow := func(t *testing.T, code string) *httptest.ResponseRecorder {
+		t.Helper()
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/s/"+code, nil))
+		return w
+	}
+	create := func(t *testing.T, token string, body gin.H) (int, map[string]interface{}) {
+		t.Helper()
+		status, response := doJSON(t, http.MethodPost, "/api/boards/"+boardID+"/short-links", token, body)
+		if link, ok := response["link"].(map[string]interface{}); ok {
+			return status, link
+		}
+		return status, response
+	}
+
+	status, link := create(t, ownerToken, gin.H{"target": "board"})
+	if status != http.StatusCreated || !strings.HasSuffix(link["url"].(string), "/s/"+link["code"].(string)) {
+		t.Fatalf("board link: expected 201 with its url, got %d (%v)", status, link)
+	}
+	if w := follow(t, link["code"].(string)); w.Code != http.StatusFound || !strings.HasSuffix(w.Header().Get("Location"), "/board/"+boardID) {
+		t.Fatalf("follow board link: expected a redirect to the board, got %d %s", w.Code, w.Header().Get("Location"))
+	}
+
+	// Exports are published as the file, for those who may export
+	if status, _ := create(t, viewerToken, gin.H{"target": "export", "format": "svg"}); status != http.StatusForbidden {
+		t.Fatalf("export link without export: expected 403, got %d", status)
+	}
+	status, link = create(t, ownerToken, gin.H{"target": "export", "format": "svg"})
+	if status != http.StatusCreated {
+		t.Fatalf("export link: expected 201, got %d (%v)", status, link)
+	}
+	if w := follow(t, link["code"].(string)); w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "image/svg+xml") {
+		t.Fatalf("follow export link: expected the svg, got %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	exportLink := link
+
+	// Share links go to the guest page, until the share link is revoked
+	if status, _ := create(t, ownerToken, gin.H{"target": "share"}); status != http.StatusBadRequest {
+		t.Fatalf("share link without shareLinkId: expected 400, got %d", status)
+	}
+	status, response := doJSON(t, http.MethodPost, "/api/boards/"+boardID+"/share-links", ownerToken, nil)
+	if status != http.StatusCreated {
+		t.Fatalf("create share link: expected 201, got %d", status)
+	}
+	shareLinkID := response["link"].(map[string]interface{})["_id"].(string)
+	status, link = create(t, ownerToken, gin.H{"target": "share", "shareLinkId": shareLinkID})
+	if status != http.StatusCreated {
+		t.Fatalf("share short link: expected 201, got %d (%v)", status, link)
+	}
+	if w := follow(t, link["code"].(string)); w.Code != http.StatusFound || !strings.Contains(w.Header().Get("Location"), "/guest/") {
+		t.Fatalf("follow share link: expected a redirect to the guest page, got %d %s", w.Code, w.Header().Get("Location"))
+	}
+	doJSON(t, http.MethodDelete, "/api/boards/"+boardID+"/share-links/"+shareLinkID, ownerToken, nil)
+	if w := follow(t, link["code"].(string)); w.Code != http.StatusNotFound {
+		t.Fatalf("follow revoked share link: expected 404, got %d", w.Code)
+	}
+
+	// Expiry
+	if status, _ := create(t, ownerToken, gin.H{"target": "board", "expiresAt": time.Now().Add(-time.Hour)}); status != http.StatusBadRequest {
+		t.Fatalf("expiry in the past: expected 400, got %d", status)
+	}
+	status, link = create(t, viewerToken, gin.H{"target": "board", "expiresAt": time.Now().Add(time.Second)})
+	if status != http.StatusCreated {
+		t.Fatalf("expiring link: expected 201, got %d (%v)", status, link)
+	}
+	time.Sleep(1100 * time.Millisecond)
+	if w := follow(t, link["code"].(string)); w.Code != http.StatusGone {
+		t.Fatalf("follow expired link: expected 410, got %d", w.Code)
+	}
+
+	// Analytics, and who sees which links
+	status, response = doJSON(t, http.MethodGet, "/api/boards/"+boardID+"/short-links/"+exportLink["_id"].(string), ownerToken, nil)
+	if status != http.StatusOK || response["link"].(map[string]interface{})["clickCount"] != 1.0 || len(response["clicks"].([]interface{})) != 1 {
+		t.Fatalf("export link clicks: expected one, got %d (%v)", status, response)
+	}
+	if status, _ := doJSON(t, http.MethodGet, "/api/boards/"+boardID+"/short-links/"+exportLink["_id"].(string), viewerToken, nil); status != http.StatusNotFound {
+		t.Fatalf("another's link as a collaborator: expected 404, got %d", status)
+	}
+	_, response = doJSON(t, http.MethodGet, "/api/boards/"+boardID+"/short-links", viewerToken, nil)
+	if links := response["links"].([]interface{}); len(links) != 1 {
+		t.Fatalf("collaborator's links: expected their own, got %v", links)
+	}
+	_, response = doJSON(t, http.MethodGet, "/api/boards/"+boardID+"/short-links", ownerToken, nil)
+	if links := response["links"].([]interface{}); len(links) != 4 {
+		t.Fatalf("owner's links: expected all 4, got %d", len(links))
+	}
+
+	if status, _ := doJSON(t, http.MethodDelete, "/api/boards/"+boardID+"/short-links/"+exportLink["_id"].(string), ownerToken, nil); status != http.StatusOK {
+		t.Fatalf("delete: expected 200, got %d", status)
+	}
+	if w := follow(t, exportLink["code"].(string)); w.Code != http.StatusNotFound {
+		t.Fatalf("follow deleted link: expected 404, got %d", w.Code)
+	}
+}
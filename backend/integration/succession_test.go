@@ -0,0 +1,120 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"github.com/sarwanazhar/boardsar/backend/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// boardOwner reads who owns a board
+func boardOwner(t *testing.T, boardID string) primitive.ObjectID {
+	t.Helper()
+	id, _ := primitive.ObjectIDFromHex(boardID)
+	board, err := repository.NewMongoBoards().FindByID(context.Background(), id)
+	if err != nil {
+		t.Fatalf("find board: %v", err)
+	}
+	return board.OwnerID
+}
+
+func TestBoardSuccession(t *testing.T) {
+	requireHarness(t)
+
+	sent := map[string]string{}
+	original := libs.SendEmail
+	libs.SendEmail = func(to, subject, body string) error {
+		sent[to] = body
+		return nil
+	}
+	defer func() { libs.SendEmail = original }()
+
+	successor, adminToken := seedUser(t, models.RoleAdmin)
+	_, otherAdminToken := seedUser(t, models.RoleAdmin)
+	member, memberToken := seedUser(t, "")
+	idle, idleToken := seedUser(t, "")
+	memberBoard := seedBoard(t, memberToken)
+	idleBoard := seedBoard(t, idleToken)
+	t.Cleanup(func() {
+		doJSON(t, http.MethodPut, "/api/admin/succession", adminToken, gin.H{"enabled": false})
+	})
+
+	if status, _ := doJSON(t, http.MethodPut, "/api/admin/succession", adminToken, gin.H{"enabled": true, "successorId": member.ID.Hex()}); status != http.StatusBadRequest {
+		t.Fatalf("member as successor: expected 400, got %d", status)
+	}
+	if status, _ := doJSON(t, http.MethodPut, "/api/admin/succession", memberToken, gin.H{"enabled": true, "successorId": member.ID.Hex()}); status != http.StatusForbidden {
+		t.Fatalf("member setting the policy: expected 403, got %d", status)
+	}
+	status, response := doJSON(t, http.MethodPut, "/api/admin/succession", adminToken, gin.H{"enabled": true, "successorId": successor.ID.Hex()})
+	if status != http.StatusOK {
+		t.Fatalf("set policy: expected 200, got %d (%v)", status, response)
+	}
+
+	// Deactivated members can't sign in, and their tokens stop working
+	if status, response := doJSON(t, http.MethodPost, "/api/admin/users/"+member.ID.Hex()+"/deactivate", adminToken, nil); status != http.StatusOK {
+		t.Fatalf("deactivate: expected 200, got %d (%v)", status, response)
+	}
+	if status, _ := doJSON(t, http.MethodGet, "/me", memberToken, nil); status != http.StatusUnauthorized {
+		t.Fatalf("deactivated token: expected 401, got %d", status)
+	}
+	if status, _ := doJSON(t, http.MethodPost, "/auth/login", "", gin.H{"email": member.Email, "password": "testpassword123"}); status != http.StatusForbidden {
+		t.Fatalf("deactivated login: expected 403, got %d", status)
+	}
+	if status, _ := doJSON(t, http.MethodPost, "/api/admin/users/"+successor.ID.Hex()+"/deactivate", otherAdminToken, nil); status != http.StatusConflict {
+		t.Fatalf("deactivate successor: expected 409, got %d", status)
+	}
+
+	// Their boards go to the successor, who is told
+	status, response = doJSON(t, http.MethodPost, "/api/admin/succession/run", adminToken, nil)
+	if status != http.StatusOK {
+		t.Fatalf("run: expected 200, got %d (%v)", status, response)
+	}
+	if owner := boardOwner(t, memberBoard); owner != successor.ID {
+		t.Fatalf("handed over board: expected the successor to own it, got %s", owner.Hex())
+	}
+	if !strings.Contains(sent[successor.Email], "/board/"+memberBoard) {
+		t.Fatalf("successor email: expected a link to the board, got %q", sent[successor.Email])
+	}
+	if status, _ := doJSON(t, http.MethodGet, "/api/boards/"+idleBoard, adminToken, nil); status != http.StatusNotFound {
+		t.Fatalf("active member's board: expected 404 for the successor, got %d", status)
+	}
+
+	// ... and so do those of members inactive for inactiveDays
+	doJSON(t, http.MethodPut, "/api/admin/succession", adminToken, gin.H{"enabled": true, "successorId": successor.ID.Hex(), "inactiveDays": 90})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	libs.Users().Update(ctx, idle.ID, map[string]interface{}{"last_active_at": time.Now().AddDate(0, 0, -100)})
+	_, response = doJSON(t, http.MethodPost, "/api/admin/succession/run", adminToken, nil)
+	found := false
+	for _, transfer := range response["transfers"].([]interface{}) {
+		transfer := transfer.(map[string]interface{})
+		if transfer["fromUserId"] == idle.ID.Hex() && transfer["reason"] == models.SuccessionReasonInactive {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("inactive member: expected their boards handed over, got %v", response)
+	}
+	if owner := boardOwner(t, idleBoard); owner != successor.ID {
+		t.Fatalf("inactive member's board: expected the successor to own it, got %s", owner.Hex())
+	}
+	if status, _ := doJSON(t, http.MethodGet, "/api/boards/"+idleBoard, idleToken, nil); status != http.StatusOK {
+		t.Fatalf("former owner: expected to keep access as an editor, got %d", status)
+	}
+
+	if status, _ := doJSON(t, http.MethodPost, "/api/admin/users/"+member.ID.Hex()+"/reactivate", adminToken, nil); status != http.StatusOK {
+		t.Fatalf("reactivate: expected 200, got %d", status)
+	}
+	if status, _ := doJSON(t, http.MethodPost, "/auth/login", "", gin.H{"email": member.Email, "password": "testpassword123"}); status != http.StatusOK {
+		t.Fatalf("reactivated login: expected 200, got %d", status)
+	}
+}
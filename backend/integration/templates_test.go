@@ -0,0 +1,90 @@
+//go:build integration
+
+package integration
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/models"
+)
+
+func TestBoardTemplates(t *testing.T) {
+	requireHarness(t)
+
+	_, token := seedUser(t, "")
+	_, otherToken := seedUser(t, "")
+	_, adminToken := seedUser(t, models.RoleAdmin)
+	boardID := seedBoard(t, token)
+
+	if status, response := doJSON(t, http.MethodPost, "/api/boards/"+boardID+"/save-as-template", token, gin.H{"name": "Retro", "global": true}); status != http.StatusForbidden {
+		t.Fatalf("global template by a non-admin: expected 403, got %d (%v)", status, response)
+	}
+
+	status, response := doJSON(t, http.MethodPost, "/api/boards/"+boardID+"/save-as-template", token, gin.H{"name": "Retro", "description": "Start, stop, continue"})
+	if status != http.StatusCreated {
+		t.Fatalf("save template: expected 201, got %d (%v)", status, response)
+	}
+	personalID := response["template"].(map[string]interface{})["_id"].(string)
+
+	adminBoardID := seedBoard(t, adminToken)
+	status, response = doJSON(t, http.MethodPost, "/api/boards/"+adminBoardID+"/save-as-template", adminToken, gin.H{"name": "Kanban", "global": true})
+	if status != http.StatusCreated {
+		t.Fatalf("save global template: expected 201, got %d (%v)", status, response)
+	}
+	globalID := response["template"].(map[string]interface{})["_id"].(string)
+
+	// Everyone sees the global template; only the owner sees the personal one
+	listTemplates := func(token string) map[string]bool {
+		t.Helper()
+		status, response := doJSON(t, http.MethodGet, "/api/templates", token, nil)
+		if status != http.StatusOK {
+			t.Fatalf("list templates: expected 200, got %d (%v)", status, response)
+		}
+		ids := map[string]bool{}
+		for _, item := range response["templates"].([]interface{}) {
+			ids[item.(map[string]interface{})["_id"].(string)] = true
+		}
+		return ids
+	}
+	if ids := listTemplates(token); !ids[personalID] || !ids[globalID] {
+		t.Fatalf("owner: expected both templates, got %v", ids)
+	}
+	if ids := listTemplates(otherToken); ids[personalID] || !ids[globalID] {
+		t.Fatalf("other user: expected only the global template, got %v", ids)
+	}
+
+	// The dashboard offers the same templates, without their contents
+	_, dashboard := doJSON(t, http.MethodGet, "/api/dashboard", token, nil)
+	_, otherDashboard := doJSON(t, http.MethodGet, "/api/dashboard", otherToken, nil)
+	counts := dashboard["counts"].(map[string]interface{})
+	if otherCounts := otherDashboard["counts"].(map[string]interface{}); counts["templates"] != otherCounts["templates"].(float64)+1 {
+		t.Fatalf("dashboard: expected one more template for the owner, got %v and %v", counts["templates"], otherCounts["templates"])
+	}
+	for _, item := range otherDashboard["templates"].([]interface{}) {
+		template := item.(map[string]interface{})
+		if template["_id"] == personalID || template["board"] != nil {
+			t.Fatalf("dashboard: expected other templates without contents, got %v", template)
+		}
+	}
+
+	status, response = doJSON(t, http.MethodPost, "/api/templates/"+globalID+"/boards", otherToken, gin.H{"name": "Sprint 12"})
+	if status != http.StatusCreated {
+		t.Fatalf("create from template: expected 201, got %d (%v)", status, response)
+	}
+	board := response["board"].(map[string]interface{})
+	if board["name"] != "Sprint 12" || len(board["shapes"].([]interface{})) != 1 {
+		t.Fatalf("create from template: expected a named board with the template's shape, got %v", board)
+	}
+
+	if status, response := doJSON(t, http.MethodPost, "/api/templates/"+personalID+"/boards", otherToken, nil); status != http.StatusNotFound {
+		t.Fatalf("someone else's template: expected 404, got %d (%v)", status, response)
+	}
+	if status, response := doJSON(t, http.MethodDelete, "/api/templates/"+globalID, token, nil); status != http.StatusForbidden {
+		t.Fatalf("delete global template as non-admin: expected 403, got %d (%v)", status, response)
+	}
+	if status, response := doJSON(t, http.MethodDelete, "/api/templates/"+personalID, token, nil); status != http.StatusOK {
+		t.Fatalf("delete own template: expected 200, got %d (%v)", status, response)
+	}
+}
@@ -0,0 +1,78 @@
+//go:build integration
+
+package integration
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sarwanazhar/boardsar/backend/repository"
+	"github.com/sarwanazhar/boardsar/backend/routes"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestTracingAcrossGinAndMongo(t *testing.T) {
+	requireHarness(t)
+
+	spans := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans))
+	propagator := otel.GetTextMapPropagator()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer func() {
+		otel.SetTracerProvider(noop.NewTracerProvider())
+		otel.SetTextMapPropagator(propagator)
+		provider.Shutdown(t.Context())
+	}()
+	tracedRouter := routes.NewRouter(cfg, repository.NewMongoBoards())
+
+	_, token := seedUser(t, "")
+	boardID := seedBoard(t, token)
+
+	// The request continues the caller's trace
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest(http.MethodGet, "/api/boards/"+boardID, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	w := httptest.NewRecorder()
+	tracedRouter.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+
+	var server sdktrace.ReadOnlySpan
+	for _, span := range spans.Ended() {
+		if span.SpanKind() == trace.SpanKindServer && span.SpanContext().TraceID().String() == traceID {
+			server = span
+		}
+	}
+	if server == nil {
+		t.Fatalf("expected a server span in trace %s", traceID)
+	}
+	if server.Parent().SpanID().String() != "00f067aa0ba902b7" {
+		t.Fatalf("expected the server span to continue the caller's span, got parent %s", server.Parent().SpanID())
+	}
+
+	// and the board's Mongo queries are client spans in it
+	queries := 0
+	for _, span := range spans.Ended() {
+		if span.SpanKind() != trace.SpanKindClient || span.SpanContext().TraceID() != server.SpanContext().TraceID() {
+			continue
+		}
+		for _, attr := range span.Attributes() {
+			if attr == semconv.DBSystemMongoDB {
+				queries++
+			}
+		}
+	}
+	if queries == 0 {
+		t.Fatal("expected Mongo command spans under the request's span")
+	}
+}
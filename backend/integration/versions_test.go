@@ -0,0 +1,181 @@
+//go:build integration
+
+package integration
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/models"
+)
+
+func TestBoardMilestones(t *testing.T) {
+	requireHarness(t)
+	defer func(retention int64) { libs.Settings().BoardVersionRetention = retention }(libs.Settings().BoardVersionRetention)
+	libs.Settings().BoardVersionRetention = 2
+
+	_, token := seedUser(t, "")
+	boardID := seedBoard(t, token)
+
+	listVersions := func(path, key string) []interface{} {
+		t.Helper()
+		status, response := doJSON(t, http.MethodGet, "/api/boards/"+boardID+path, token, nil)
+		if status != http.StatusOK {
+			t.Fatalf("GET %s: expected 200, got %d (%v)", path, status, response)
+		}
+		return response[key].([]interface{})
+	}
+
+	// Creating the board recorded its first version; label it
+	versions := listVersions("/versions", "versions")
+	if len(versions) != 1 {
+		t.Fatalf("expected 1 version after create, got %v", versions)
+	}
+	reviewID := versions[0].(map[string]interface{})["_id"].(string)
+
+	status, response := doJSON(t, http.MethodPost, "/api/boards/"+boardID+"/versions/"+reviewID+"/label", token, gin.H{"label": "v1 design review"})
+	if status != http.StatusOK || response["version"].(map[string]interface{})["label"] != "v1 design review" {
+		t.Fatalf("label: expected 200 with the label, got %d (%v)", status, response)
+	}
+
+	// Later saves are recorded, and old unlabelled ones pruned
+	for _, x := range []int{200, 300, 400} {
+		data := testBoardData()
+		data["shapes"].([]interface{})[0].(map[string]interface{})["x"] = x
+		if status, response := doJSON(t, http.MethodPut, "/api/boards/"+boardID, token, gin.H{"board": data}); status != http.StatusOK {
+			t.Fatalf("update: expected 200, got %d (%v)", status, response)
+		}
+	}
+	if versions := listVersions("/versions", "versions"); len(versions) != 3 {
+		t.Fatalf("expected 2 retained versions and the milestone, got %v", versions)
+	}
+	milestones := listVersions("/milestones", "milestones")
+	if len(milestones) != 1 || milestones[0].(map[string]interface{})["_id"] != reviewID {
+		t.Fatalf("expected the labelled version as the only milestone, got %v", milestones)
+	}
+
+	// Save the current state as a second milestone and diff the two
+	status, response = doJSON(t, http.MethodPost, "/api/boards/"+boardID+"/versions", token, gin.H{"label": "v2"})
+	if status != http.StatusCreated {
+		t.Fatalf("save milestone: expected 201, got %d (%v)", status, response)
+	}
+	v2ID := response["version"].(map[string]interface{})["_id"].(string)
+
+	status, response = doJSON(t, http.MethodGet, "/api/boards/"+boardID+"/diff?from="+reviewID+"&to="+v2ID, token, nil)
+	if status != http.StatusOK {
+		t.Fatalf("diff: expected 200, got %d (%v)", status, response)
+	}
+	changed := response["changed"].([]interface{})
+	if len(changed) != 1 || len(response["added"].([]interface{})) != 0 || len(response["removed"].([]interface{})) != 0 {
+		t.Fatalf("diff: expected one changed shape, got %v", response)
+	}
+	change := changed[0].(map[string]interface{})
+	if change["id"] != "test-shape-1" || len(change["fields"].([]interface{})) != 1 || change["fields"].([]interface{})[0] != "x" {
+		t.Fatalf("diff: expected x of test-shape-1 to change, got %v", change)
+	}
+
+	if status, response := doJSON(t, http.MethodGet, "/api/boards/"+boardID+"/diff?from=000000000000000000000000", token, nil); status != http.StatusNotFound {
+		t.Fatalf("diff from unknown version: expected 404, got %d (%v)", status, response)
+	}
+}
+
+func TestRestoreBoardVersionBacksUp(t *testing.T) {
+	requireHarness(t)
+
+	_, token := seedUser(t, "")
+	boardID := seedBoard(t, token)
+
+	status, response := doJSON(t, http.MethodGet, "/api/boards/"+boardID+"/versions", token, nil)
+	if status != http.StatusOK {
+		t.Fatalf("list versions: expected 200, got %d (%v)", status, response)
+	}
+	originalID := response["versions"].([]interface{})[0].(map[string]interface{})["_id"].(string)
+
+	data := testBoardData()
+	data["shapes"] = []interface{}{}
+	if status, response := doJSON(t, http.MethodPut, "/api/boards/"+boardID, token, gin.H{"board": data}); status != http.StatusOK {
+		t.Fatalf("update: expected 200, got %d (%v)", status, response)
+	}
+
+	// Restoring brings the shapes back and backs up the emptied board
+	status, response = doJSON(t, http.MethodPost, "/api/boards/"+boardID+"/versions/"+originalID+"/restore", token, nil)
+	if status != http.StatusOK {
+		t.Fatalf("restore: expected 200, got %d (%v)", status, response)
+	}
+	if shapes := response["board"].(map[string]interface{})["shapes"].([]interface{}); len(shapes) != 1 {
+		t.Fatalf("restore: expected the original shape back, got %v", shapes)
+	}
+	backup := response["backup"].(map[string]interface{})
+	if backup["operation"] != "restore" || backup["restore"] != "/api/boards/"+boardID+"/versions/"+backup["_id"].(string)+"/restore" {
+		t.Fatalf("restore: expected a pre-operation backup, got %v", backup)
+	}
+
+	// Restoring the backup undoes the restore
+	status, response = doJSON(t, http.MethodPost, backup["restore"].(string), token, nil)
+	if status != http.StatusOK {
+		t.Fatalf("undo: expected 200, got %d (%v)", status, response)
+	}
+	if shapes := response["board"].(map[string]interface{})["shapes"].([]interface{}); len(shapes) != 0 {
+		t.Fatalf("undo: expected the emptied board back, got %v", shapes)
+	}
+
+	if status, response := doJSON(t, http.MethodPost, "/api/boards/"+boardID+"/versions/000000000000000000000000/restore", token, nil); status != http.StatusNotFound {
+		t.Fatalf("restore unknown version: expected 404, got %d (%v)", status, response)
+	}
+}
+
+func TestLegalHoldKeepsBoardVersions(t *testing.T) {
+	requireHarness(t)
+	defer func(retention int64) { libs.Settings().BoardVersionRetention = retention }(libs.Settings().BoardVersionRetention)
+	libs.Settings().BoardVersionRetention = 2
+
+	_, adminToken := seedUser(t, models.RoleAdmin)
+	_, token := seedUser(t, "")
+	boardID := seedBoard(t, token)
+
+	save := func(x int) {
+		t.Helper()
+		data := testBoardData()
+		data["shapes"].([]interface{})[0].(map[string]interface{})["x"] = x
+		if status, response := doJSON(t, http.MethodPut, "/api/boards/"+boardID, token, gin.H{"board": data}); status != http.StatusOK {
+			t.Fatalf("update: expected 200, got %d (%v)", status, response)
+		}
+	}
+	countVersions := func() int {
+		t.Helper()
+		status, response := doJSON(t, http.MethodGet, "/api/boards/"+boardID+"/versions", token, nil)
+		if status != http.StatusOK {
+			t.Fatalf("versions: expected 200, got %d (%v)", status, response)
+		}
+		return len(response["versions"].([]interface{}))
+	}
+
+	status, response := doJSON(t, http.MethodPost, "/api/admin/legal-holds", adminToken, gin.H{
+		"targetType": models.LegalHoldTargetBoard,
+		"targetId":   boardID,
+		"reason":     "litigation",
+	})
+	if status != http.StatusCreated {
+		t.Fatalf("place hold: expected 201, got %d (%v)", status, response)
+	}
+	holdID := response["hold"].(map[string]interface{})["_id"].(string)
+
+	// Under hold, every save is kept
+	for _, x := range []int{200, 300, 400} {
+		save(x)
+	}
+	if count := countVersions(); count != 4 {
+		t.Fatalf("under hold: expected all 4 versions, got %d", count)
+	}
+
+	// Once released, the next save prunes down to the retention again
+	if status, _ := doJSON(t, http.MethodDelete, "/api/admin/legal-holds/"+holdID, adminToken, nil); status != http.StatusOK {
+		t.Fatalf("release hold: expected 200, got %d", status)
+	}
+	save(500)
+	if count := countVersions(); count != 2 {
+		t.Fatalf("after release: expected 2 versions, got %d", count)
+	}
+}
@@ -0,0 +1,228 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+)
+
+// webhookRequest is what a test receiver got
+type webhookRequest struct {
+	header http.Header
+	body   []byte
+}
+
+func TestWebhooks(t *testing.T) {
+	requireHarness(t)
+	defer func(delay time.Duration) { libs.Settings().WebhookRetryDelay = delay }(libs.Settings().WebhookRetryDelay)
+	defer func(private bool) { libs.Settings().PrivateHooks = private }(libs.Settings().PrivateHooks)
+	libs.Settings().WebhookRetryDelay = 100 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go libs.RunWebhookWorker(ctx)
+
+	// The receiver turns the first delivery away
+	requests := make(chan webhookRequest, 10)
+	var calls atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- webhookRequest{header: r.Header, body: body}
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer receiver.Close()
+
+	receive := func() webhookRequest {
+		t.Helper()
+		select {
+		case req := <-requests:
+			return req
+		case <-time.After(10 * time.Second):
+			t.Fatalf("no webhook arrived")
+		}
+		return webhookRequest{}
+	}
+
+	_, token := seedUser(t, "")
+	_, strangerToken := seedUser(t, "")
+	boardID := seedBoard(t, token)
+	strangerBoardID := seedBoard(t, strangerToken)
+
+	for _, body := range []gin.H{
+		{"url": "ftp://example.com/hook"},
+		{"url": receiver.URL, "events": []string{"board.exploded"}},
+		{"url": receiver.URL, "boardIds": []string{strangerBoardID}},
+	} {
+		if status, _ := doJSON(t, http.MethodPost, "/api/webhooks", token, body); status != http.StatusBadRequest {
+			t.Fatalf("create %v: expected 400, got %d", body, status)
+		}
+	}
+	// The receiver is on this machine, which takes PRIVATE_HOOKS
+	status, body := doJSON(t, http.MethodPost, "/api/webhooks", token, gin.H{"url": receiver.URL})
+	if status != http.StatusBadRequest || body["error"] != libs.ErrWebhookAddress.Error() {
+		t.Fatalf("private receiver: expected 400, got %d: %v", status, body)
+	}
+	libs.Settings().PrivateHooks = true
+
+	status, body = doJSON(t, http.MethodPost, "/api/webhooks", token, gin.H{
+		"url": receiver.URL, "events": []string{"board.updated"}, "boardIds": []string{boardID},
+	})
+	if status != http.StatusCreated {
+		t.Fatalf("create: expected 201, got %d: %v", status, body)
+	}
+	webhook := body["webhook"].(map[string]interface{})
+	webhookID := webhook["id"].(string)
+	secret, _ := webhook["secret"].(string)
+	if !strings.HasPrefix(secret, "whsec_") {
+		t.Fatalf("create: expected a secret, got %v", webhook)
+	}
+
+	_, body = doJSON(t, http.MethodGet, "/api/webhooks", token, nil)
+	if listed := body["webhooks"].([]interface{}); len(listed) != 1 || listed[0].(map[string]interface{})["secret"] != nil {
+		t.Fatalf("list: expected the webhook without its secret, got %v", listed)
+	}
+	if status, _ := doJSON(t, http.MethodGet, "/api/webhooks/"+webhookID, strangerToken, nil); status != http.StatusNotFound {
+		t.Fatalf("stranger: expected 404, got %d", status)
+	}
+
+	// A save is delivered, signed, and retried after the failure
+	if status, _ := doJSON(t, http.MethodPut, "/api/boards/"+boardID, token, gin.H{"board": testBoardData()}); status != http.StatusOK {
+		t.Fatalf("save: expected 200, got %d", status)
+	}
+	first, retry := receive(), receive()
+	if first.header.Get("X-BoardSar-Delivery") == "" || first.header.Get("X-BoardSar-Delivery") != retry.header.Get("X-BoardSar-Delivery") {
+		t.Fatalf("retry: expected the same delivery ID, got %q and %q", first.header.Get("X-BoardSar-Delivery"), retry.header.Get("X-BoardSar-Delivery"))
+	}
+	if retry.header.Get("X-BoardSar-Event") != "board.updated" {
+		t.Fatalf("delivery: expected board.updated, got %q", retry.header.Get("X-BoardSar-Event"))
+	}
+	var timestamp, signature string
+	for _, part := range strings.Split(retry.header.Get("X-BoardSar-Signature"), ",") {
+		key, value, _ := strings.Cut(part, "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signature = value
+		}
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(retry.body)
+	if want := hex.EncodeToString(mac.Sum(nil)); signature != want {
+		t.Fatalf("delivery: signature %q does not match %q", signature, want)
+	}
+	var payload map[string]interface{}
+	if err := json.Unmarshal(retry.body, &payload); err != nil || payload["type"] != "board.updated" || payload["boardId"] != boardID {
+		t.Fatalf("delivery: unexpected payload %s", retry.body)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		_, body = doJSON(t, http.MethodGet, "/api/webhooks/"+webhookID+"/deliveries", token, nil)
+		deliveries := body["deliveries"].([]interface{})
+		if len(deliveries) == 1 {
+			delivery := deliveries[0].(map[string]interface{})
+			if delivery["status"] == "delivered" && delivery["attempts"] == 2.0 && delivery["lastStatus"] == 200.0 {
+				break
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("deliveries: expected one delivered in 2 attempts, got %v", deliveries)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	// Only the events asked for are sent
+	status, body = doJSON(t, http.MethodPatch, "/api/webhooks/"+webhookID, token, gin.H{"events": []string{"board.deleted"}, "rotateSecret": true})
+	if status != http.StatusOK {
+		t.Fatalf("update: expected 200, got %d: %v", status, body)
+	}
+	if rotated, _ := body["webhook"].(map[string]interface{})["secret"].(string); rotated == "" || rotated == secret {
+		t.Fatalf("update: expected a new secret, got %q", rotated)
+	}
+	doJSON(t, http.MethodPut, "/api/boards/"+boardID, token, gin.H{"board": testBoardData()})
+	doJSON(t, http.MethodDelete, "/api/boards/"+boardID, token, nil)
+	if event := receive().header.Get("X-BoardSar-Event"); event != "board.deleted" {
+		t.Fatalf("filtered delivery: expected board.deleted, got %q", event)
+	}
+
+	if status, _ := doJSON(t, http.MethodDelete, "/api/webhooks/"+webhookID, token, nil); status != http.StatusOK {
+		t.Fatalf("delete: expected 200, got %d", status)
+	}
+	if status, _ := doJSON(t, http.MethodGet, "/api/webhooks/"+webhookID+"/deliveries", token, nil); status != http.StatusNotFound {
+		t.Fatalf("deleted webhook: expected 404, got %d", status)
+	}
+
+	// A webhook saved with PRIVATE_HOOKS isn't delivered to without it
+	otherBoardID := seedBoard(t, token)
+	_, body = doJSON(t, http.MethodPost, "/api/webhooks", token, gin.H{"url": receiver.URL, "boardIds": []string{otherBoardID}})
+	webhookID = body["webhook"].(map[string]interface{})["id"].(string)
+	defer doJSON(t, http.MethodDelete, "/api/webhooks/"+webhookID, token, nil)
+	libs.Settings().PrivateHooks = false
+	doJSON(t, http.MethodPut, "/api/boards/"+otherBoardID, token, gin.H{"board": testBoardData()})
+	deadline = time.Now().Add(5 * time.Second)
+	for {
+		_, body = doJSON(t, http.MethodGet, "/api/webhooks/"+webhookID+"/deliveries", token, nil)
+		deliveries := body["deliveries"].([]interface{})
+		if len(deliveries) > 0 {
+			if lastError, _ := deliveries[0].(map[string]interface{})["lastError"].(string); strings.Contains(lastError, libs.ErrWebhookAddress.Error()) {
+				break
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("private delivery: expected it refused, got %v", deliveries)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	select {
+	case req := <-requests:
+		t.Fatalf("private delivery: the receiver got %s", req.body)
+	default:
+	}
+}
+
+// TestWebhookURLs checks that webhooks can't point at private networks
+func TestWebhookURLs(t *testing.T) {
+	defer func(private bool) { libs.Settings().PrivateHooks = private }(libs.Settings().PrivateHooks)
+	libs.Settings().PrivateHooks = false
+	ctx := context.Background()
+
+	for _, url := range []string{
+		"http://localhost:8080/hook",
+		"http://127.0.0.1/hook",
+		"https://10.0.0.5/hook",
+		"https://192.168.1.20/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://[::1]/hook",
+		"https://[fe80::1]/hook",
+	} {
+		if err := libs.ValidateWebhookURL(ctx, url); err != libs.ErrWebhookAddress {
+			t.Errorf("%s: expected %v, got %v", url, libs.ErrWebhookAddress, err)
+		}
+	}
+	if err := libs.ValidateWebhookURL(ctx, "https://203.0.113.5/hook"); err != nil {
+		t.Errorf("public address: expected no error, got %v", err)
+	}
+
+	libs.Settings().PrivateHooks = true
+	if err := libs.ValidateWebhookURL(ctx, "http://127.0.0.1/hook"); err != nil {
+		t.Errorf("PRIVATE_HOOKS: expected no error, got %v", err)
+	}
+}
@@ -0,0 +1,187 @@
+package libs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/sarwanazhar/boardsar/backend/database"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"github.com/sarwanazhar/boardsar/backend/repository"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// accountCollections get the collection holding a user's own records and
+// the field naming the user. They go with the account.
+var accountCollections = []struct {
+	collection func() *mongo.Collection
+	field      string
+}{
+	{GetRefreshTokenCollection, "userId"},
+	{GetSessionCollection, "userId"},
+	{GetPasswordResetCollection, "userId"},
+	{GetMagicLinkCollection, "userId"},
+	{GetTwoFactorCollection, "_id"},
+	{GetTwoFactorChallengeCollection, "userId"},
+	{GetEmailChangeCollection, "userId"},
+	{GetPendingDeletionCollection, "userId"},
+	{GetIdentityCollection, "userId"},
+	{GetOAuthStateCollection, "userId"},
+	{GetPasskeyCollection, "userId"},
+	{GetWebAuthnChallengeCollection, "userId"},
+	{GetPushSubscriptionCollection, "userId"},
+	{GetFavoriteCollection, "userId"},
+	{GetSectionStateCollection, "userId"},
+	{GetLintDictionaryCollection, "ownerId"},
+	{GetFolderCollection, "ownerId"},
+	{GetTemplateCollection, "ownerId"},
+	{GetClassroomCollection, "ownerId"},
+	{GetOAuthCodeCollection, "userId"},
+	{GetOAuthGrantCollection, "userId"},
+	{GetJobCollection, "userId"},
+	{GetActivityCollection, "actorId"},
+	{GetEmbedTokenCollection, "createdBy"},
+}
+
+// DeletedAccount is what DeleteAccount removed, for the caller to clean up
+// after: the boards the user owned, without their contents, and the boards
+// they were taken off
+type DeletedAccount struct {
+	Boards []models.Board
+	Shared []primitive.ObjectID
+}
+
+// IsAccountUnderLegalHold reports whether the user, or a board they own in
+// boards, has an active legal hold
+func IsAccountUnderLegalHold(ctx context.Context, boards repository.BoardRepository, userID primitive.ObjectID) (bool, error) {
+	found, err := boards.WithoutContents().ListOwned(ctx, userID)
+	if err != nil {
+		return false, fmt.Errorf("error listing boards: %w", err)
+	}
+	owned := make([]primitive.ObjectID, len(found))
+	for i := range found {
+		owned[i] = found[i].ID
+	}
+
+	count, err := GetLegalHoldCollection().CountDocuments(ctx, activeHoldFilter(bson.A{
+		bson.M{"targetType": models.LegalHoldTargetUser, "targetId": userID},
+		bson.M{"targetType": models.LegalHoldTargetBoard, "targetId": bson.M{"$in": owned}},
+	}))
+	if err != nil {
+		return false, fmt.Errorf("error checking legal holds: %w", err)
+	}
+	return count > 0, nil
+}
+
+// DeleteAccount removes a user with the boards they own in boards and
+// everything kept for them, and takes them off the boards and classrooms of others. Their
+// OAuth apps go with the grants and tokens issued to them, their webhooks
+// with their deliveries, their share links with their uses and their short
+// links with their clicks. Audit
+// events are kept.
+//
+// The MongoDB writes and the user's removal run in one transaction where
+// the deployment supports them (replica sets and sharded clusters), and
+// one after another on a standalone server. What is stored outside
+// MongoDB's documents, such as assets, thumbnails and archived contents,
+// is left to the caller, per board.
+func DeleteAccount(ctx context.Context, boards repository.BoardRepository, userID primitive.ObjectID) (*DeletedAccount, error) {
+	session, err := database.Client.StartSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.EndSession(ctx)
+
+	var deleted *DeletedAccount
+	_, err = session.WithTransaction(ctx, func(ctx mongo.SessionContext) (interface{}, error) {
+		var err error
+		deleted, err = deleteAccount(ctx, boards, userID)
+		return nil, err
+	})
+	if transactionsUnsupported(err) {
+		return deleteAccount(ctx, boards, userID)
+	}
+	return deleted, err
+}
+
+func deleteAccount(ctx context.Context, boards repository.BoardRepository, userID primitive.ObjectID) (*DeletedAccount, error) {
+	deleted := &DeletedAccount{}
+
+	var err error
+	if deleted.Boards, err = boards.WithoutContents().ListOwned(ctx, userID); err != nil {
+		return nil, fmt.Errorf("error listing boards: %w", err)
+	}
+	if err := boards.DeleteOwned(ctx, userID); err != nil {
+		return nil, fmt.Errorf("error deleting boards: %w", err)
+	}
+	if _, err := GetBoardSummaryCollection().DeleteMany(ctx, bson.M{"ownerId": userID}); err != nil {
+		return nil, fmt.Errorf("error deleting board summaries: %w", err)
+	}
+	if deleted.Shared, err = boards.RemoveFromAll(ctx, userID); err != nil {
+		return nil, fmt.Errorf("error removing shares: %w", err)
+	}
+	unshare := bson.M{
+		"$pull": bson.M{"sharedWith": bson.M{"userId": userID}},
+		"$inc":  bson.M{"collaboratorCount": -1},
+	}
+	if _, err := GetBoardSummaryCollection().UpdateMany(ctx, bson.M{"sharedWith.userId": userID}, unshare); err != nil {
+		return nil, fmt.Errorf("error removing shares: %w", err)
+	}
+	if _, err := GetClassroomCollection().UpdateMany(ctx,
+		bson.M{"students.userId": userID},
+		bson.M{"$pull": bson.M{"students": bson.M{"userId": userID}}},
+	); err != nil {
+		return nil, fmt.Errorf("error removing from classrooms: %w", err)
+	}
+
+	// What hangs off the user's apps, webhooks, share links and short links
+	for _, owned := range []struct {
+		collection *mongo.Collection
+		field      string
+		dependents []*mongo.Collection
+		key        string
+	}{
+		{GetOAuthClientCollection(), "ownerId", []*mongo.Collection{GetOAuthGrantCollection(), GetOAuthCodeCollection(), GetRefreshTokenCollection()}, "clientId"},
+		{GetWebhookCollection(), "userId", []*mongo.Collection{GetWebhookDeliveryCollection()}, "webhookId"},
+		{GetShareLinkCollection(), "ownerId", []*mongo.Collection{GetShareLinkUseCollection()}, "linkId"},
+		{GetShortLinkCollection(), "ownerId", []*mongo.Collection{GetShortLinkClickCollection()}, "linkId"},
+	} {
+		ids, err := owned.collection.Distinct(ctx, "_id", bson.M{owned.field: userID})
+		if err != nil {
+			return nil, fmt.Errorf("error listing %s: %w", owned.collection.Name(), err)
+		}
+		if len(ids) == 0 {
+			continue
+		}
+		for _, dependent := range owned.dependents {
+			if _, err := dependent.DeleteMany(ctx, bson.M{owned.key: bson.M{"$in": ids}}); err != nil {
+				return nil, fmt.Errorf("error deleting %s: %w", dependent.Name(), err)
+			}
+		}
+		if _, err := owned.collection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}}); err != nil {
+			return nil, fmt.Errorf("error deleting %s: %w", owned.collection.Name(), err)
+		}
+	}
+
+	for _, owned := range accountCollections {
+		collection := owned.collection()
+		if _, err := collection.DeleteMany(ctx, bson.M{owned.field: userID}); err != nil {
+			return nil, fmt.Errorf("error deleting %s: %w", collection.Name(), err)
+		}
+	}
+
+	// Last, so a failure to remove the user rolls back the rest
+	if err := users.Delete(ctx, userID); err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return nil, fmt.Errorf("error deleting user: %w", err)
+	}
+	return deleted, nil
+}
+
+// transactionsUnsupported reports whether a transaction failed because the
+// server is a standalone one, which has none
+func transactionsUnsupported(err error) bool {
+	var command mongo.CommandError
+	return errors.As(err, &command) && command.Code == 20 // IllegalOperation
+}
@@ -0,0 +1,270 @@
+package libs
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"time"
+
+	"github.com/sarwanazhar/boardsar/backend/database"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AccountExportFormat is the version of the account archive layout
+// documented in the README. Bump it on breaking changes.
+const AccountExportFormat = 1
+
+// WriteAccountExport writes everything kept for a user to w as a zip
+// archive: their account, each board they own in the format of the board
+// JSON export, the boards shared with them, the files uploaded to their
+// boards and their other records, one JSON file each. Secrets (password
+// and token hashes, keys) are left out, as are other people's private
+// notes. Archived boards must be rehydrated first.
+//
+// The archive is written as it is read, so an error leaves it cut short.
+func WriteAccountExport(ctx context.Context, w io.Writer, user *models.User) error {
+	archive := zip.NewWriter(w)
+	now := time.Now().UTC()
+
+	if err := writeExportJSON(archive, "account.json", map[string]interface{}{
+		"format":       AccountExportFormat,
+		"exportedAt":   now,
+		"id":           user.ID.Hex(),
+		"email":        user.Email,
+		"name":         user.Name,
+		"displayName":  user.DisplayName,
+		"avatarUrl":    user.AvatarURL,
+		"locale":       user.Locale,
+		"role":         user.Role,
+		"hasPassword":  user.Password != "",
+		"passwordless": user.Passwordless,
+		"createdAt":    user.CreatedAt,
+		"updatedAt":    user.UpdatedAt,
+	}); err != nil {
+		return err
+	}
+
+	// Owned boards one at a time, as they can be large
+	cursor, err := database.GetCollection("boards").Find(ctx, bson.M{"ownerId": user.ID}, options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		return fmt.Errorf("error listing boards: %w", err)
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		var board models.Board
+		if err := cursor.Decode(&board); err != nil {
+			return fmt.Errorf("error decoding board: %w", err)
+		}
+		if err := writeExportJSON(archive, "boards/"+board.ID.Hex()+".json", map[string]interface{}{
+			"format":      "boardsar",
+			"exportedAt":  now,
+			"boardId":     board.BoardID,
+			"name":        displayBoardName(&board),
+			"description": board.Description,
+			"tags":        board.Tags,
+			"version":     board.Version,
+			"createdAt":   board.CreatedAt,
+			"updatedAt":   board.UpdatedAt,
+			"sharedWith":  board.SharedWith,
+			"board":       VisibleBoardData(board.BoardData, user.ID),
+		}); err != nil {
+			return err
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return fmt.Errorf("error listing boards: %w", err)
+	}
+
+	if err := exportRecords(ctx, archive, "shared-boards.json", GetBoardSummaryCollection(),
+		bson.M{"sharedWith.userId": user.ID}, func(summary *models.BoardSummary) interface{} {
+			role := ""
+			for _, collaborator := range summary.SharedWith {
+				if collaborator.UserID == user.ID {
+					role = collaborator.Role
+				}
+			}
+			return map[string]interface{}{
+				"id":      summary.ID.Hex(),
+				"boardId": summary.BoardID,
+				"name":    summary.Name,
+				"ownerId": summary.OwnerID.Hex(),
+				"role":    role,
+			}
+		}); err != nil {
+		return err
+	}
+
+	if err := exportAssets(ctx, archive, user); err != nil {
+		return err
+	}
+
+	byUser := bson.M{"userId": user.ID}
+	byOwner := bson.M{"ownerId": user.ID}
+	for _, export := range []func() error{
+		func() error {
+			return exportRecords(ctx, archive, "templates.json", GetTemplateCollection(), byOwner, same[models.Template])
+		},
+		func() error {
+			return exportRecords(ctx, archive, "folders.json", GetFolderCollection(), byOwner, same[models.Folder])
+		},
+		func() error {
+			return exportRecords(ctx, archive, "favorites.json", GetFavoriteCollection(), byUser, same[models.Favorite])
+		},
+		func() error {
+			return exportRecords(ctx, archive, "classrooms.json", GetClassroomCollection(), byOwner, same[models.Classroom])
+		},
+		func() error {
+			return exportRecords(ctx, archive, "lint-dictionary.json", GetLintDictionaryCollection(), byOwner, same[models.LintDictionary])
+		},
+		func() error {
+			return exportRecords(ctx, archive, "activity.json", GetActivityCollection(), bson.M{"actorId": user.ID}, func(activity *models.Activity) interface{} {
+				activity.ActorEmail = user.Email
+				activity.Summary = activitySummary(activity)
+				return activity
+			})
+		},
+		func() error {
+			return exportRecords(ctx, archive, "share-links.json", GetShareLinkCollection(), byOwner, same[models.ShareLink])
+		},
+		func() error {
+			return exportRecords(ctx, archive, "short-links.json", GetShortLinkCollection(), byOwner, func(link *models.ShortLink) interface{} {
+				link.URL = ShortLinkURL(link.Code)
+				return link
+			})
+		},
+		func() error {
+			return exportRecords(ctx, archive, "embed-tokens.json", GetEmbedTokenCollection(), bson.M{"createdBy": user.ID}, same[models.EmbedToken])
+		},
+		func() error {
+			return exportRecords(ctx, archive, "webhooks.json", GetWebhookCollection(), byUser, func(webhook *models.Webhook) interface{} {
+				webhook.Secret = ""
+				return webhook
+			})
+		},
+		func() error {
+			return exportRecords(ctx, archive, "oauth-apps.json", GetOAuthClientCollection(), byOwner, same[models.OAuthClient])
+		},
+		func() error {
+			return exportRecords(ctx, archive, "oauth-grants.json", GetOAuthGrantCollection(), byUser, same[models.OAuthGrant])
+		},
+		func() error {
+			return exportRecords(ctx, archive, "identities.json", GetIdentityCollection(), byUser, same[models.Identity])
+		},
+		func() error {
+			return exportRecords(ctx, archive, "passkeys.json", GetPasskeyCollection(), byUser, same[models.Passkey])
+		},
+		func() error {
+			return exportRecords(ctx, archive, "push-subscriptions.json", GetPushSubscriptionCollection(), byUser, same[models.PushSubscription])
+		},
+		func() error {
+			return exportRecords(ctx, archive, "sessions.json", GetSessionCollection(), byUser, same[models.Session])
+		},
+		func() error {
+			return exportRecords(ctx, archive, "security-events.json", GetAuditCollection(), bson.M{"actor.id": user.ID.Hex()}, same[models.AuditEvent])
+		},
+	} {
+		if err := export(); err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+// exportAssets writes the files uploaded to the user's boards under
+// assets/, named by asset ID, and assets.json describing them
+func exportAssets(ctx context.Context, archive *zip.Writer, user *models.User) error {
+	cursor, err := GetAssetCollection().Find(ctx, bson.M{"ownerId": user.ID}, options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		return fmt.Errorf("error listing assets: %w", err)
+	}
+	assets := []models.Asset{}
+	if err := cursor.All(ctx, &assets); err != nil {
+		return fmt.Errorf("error listing assets: %w", err)
+	}
+
+	for i := range assets {
+		asset := &assets[i]
+		asset.URL = "assets/" + asset.ID.Hex() + path.Ext(assetFilename(asset.Filename))
+		reader, err := OpenAsset(ctx, asset)
+		if err == ErrAssetDataNotFound {
+			asset.URL = ""
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("error opening asset %s: %w", asset.ID.Hex(), err)
+		}
+		file, err := archive.CreateHeader(&zip.FileHeader{Name: asset.URL, Method: zip.Store, Modified: asset.CreatedAt})
+		if err == nil {
+			_, err = io.Copy(file, reader)
+		}
+		reader.Close()
+		if err != nil {
+			return fmt.Errorf("error exporting asset %s: %w", asset.ID.Hex(), err)
+		}
+	}
+	return writeExportJSON(archive, "assets.json", assets)
+}
+
+// exportRecords writes the records of a collection matching filter as a
+// JSON list, each as view makes it
+func exportRecords[T any](ctx context.Context, archive *zip.Writer, name string, collection *mongo.Collection, filter bson.M, view func(*T) interface{}) error {
+	cursor, err := collection.Find(ctx, filter, options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		return fmt.Errorf("error exporting %s: %w", name, err)
+	}
+	defer cursor.Close(ctx)
+
+	file, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	separator := "[\n"
+	for cursor.Next(ctx) {
+		var record T
+		if err := cursor.Decode(&record); err != nil {
+			return fmt.Errorf("error exporting %s: %w", name, err)
+		}
+		encoded, err := json.MarshalIndent(view(&record), "  ", "  ")
+		if err != nil {
+			return fmt.Errorf("error exporting %s: %w", name, err)
+		}
+		if _, err := io.WriteString(file, separator+"  "); err != nil {
+			return err
+		}
+		if _, err := file.Write(encoded); err != nil {
+			return err
+		}
+		separator = ",\n"
+	}
+	if err := cursor.Err(); err != nil {
+		return fmt.Errorf("error exporting %s: %w", name, err)
+	}
+	if separator == "[\n" {
+		_, err = io.WriteString(file, "[]\n")
+	} else {
+		_, err = io.WriteString(file, "\n]\n")
+	}
+	return err
+}
+
+// same is the view of a record as its JSON form has it
+func same[T any](record *T) interface{} {
+	return record
+}
+
+func writeExportJSON(archive *zip.Writer, name string, value interface{}) error {
+	file, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
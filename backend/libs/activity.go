@@ -0,0 +1,208 @@
+package libs
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/sarwanazhar/boardsar/backend/database"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const activityCollection = "activity"
+
+const (
+	// activityFoldWindow is how long after someone's last save their next
+	// one is folded into the same entry, so autosaves don't flood the feed
+	activityFoldWindow = 10 * time.Minute
+)
+
+func GetActivityCollection() *mongo.Collection {
+	return database.GetCollection(activityCollection)
+}
+
+func activityExpiry(now time.Time) time.Time {
+	return now.Add(settings.ActivityRetention)
+}
+
+// RecordActivity adds an entry to the board's activity feed. Failures are
+// logged rather than returned: a lost feed entry must not fail the action.
+func RecordActivity(ctx context.Context, board *models.Board, actorID primitive.ObjectID, action string, fill func(*models.Activity)) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+
+	now := time.Now().UTC()
+	activity := models.Activity{
+		ID:        primitive.NewObjectID(),
+		BoardID:   board.ID,
+		BoardName: displayBoardName(board),
+		ActorID:   actorID,
+		Action:    action,
+		CreatedAt: now,
+		UpdatedAt: now,
+		ExpiresAt: activityExpiry(now),
+	}
+	if fill != nil {
+		fill(&activity)
+	}
+
+	if _, err := GetActivityCollection().InsertOne(ctx, activity); err != nil {
+		slog.Warn("Failed to record activity", "action", action, "board_id", board.ID.Hex(), "error", err)
+	}
+}
+
+// RecordBoardUpdate adds a save to the board's activity feed, folding it
+// into the actor's previous save if that was recent
+func RecordBoardUpdate(ctx context.Context, board *models.Board, actorID primitive.ObjectID, changes models.ActivityChanges) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+
+	now := time.Now().UTC()
+	result, err := GetActivityCollection().UpdateOne(ctx,
+		bson.M{
+			"boardId":   board.ID,
+			"actorId":   actorID,
+			"action":    models.ActivityBoardUpdated,
+			"updatedAt": bson.M{"$gte": now.Add(-activityFoldWindow)},
+		},
+		bson.M{
+			"$inc": bson.M{
+				"changes.added":   changes.Added,
+				"changes.changed": changes.Changed,
+				"changes.removed": changes.Removed,
+				"changes.saves":   1,
+			},
+			"$set": bson.M{
+				"boardName": displayBoardName(board),
+				"updatedAt": now,
+				"expiresAt": activityExpiry(now),
+			},
+		},
+	)
+	if err != nil {
+		slog.Warn("Failed to record update activity on board", "board_id", board.ID.Hex(), "error", err)
+		return
+	}
+	if result.MatchedCount > 0 {
+		return
+	}
+
+	changes.Saves = 1
+	RecordActivity(ctx, board, actorID, models.ActivityBoardUpdated, func(activity *models.Activity) {
+		activity.Changes = &changes
+	})
+}
+
+// ListActivity returns up to limit entries matching the filter, most
+// recently active first, after the entry last seen (zero for the first
+// page). Entries come with their actor's email and a summary.
+func ListActivity(ctx context.Context, filter bson.M, afterTime time.Time, afterID primitive.ObjectID, limit int64) ([]models.Activity, error) {
+	if !afterID.IsZero() {
+		filter = bson.M{"$and": bson.A{filter, bson.M{"$or": bson.A{
+			bson.M{"updatedAt": bson.M{"$lt": afterTime}},
+			bson.M{"updatedAt": afterTime, "_id": bson.M{"$lt": afterID}},
+		}}}}
+	}
+
+	cursor, err := GetActivityCollection().Find(ctx, filter, options.Find().
+		SetSort(bson.D{{Key: "updatedAt", Value: -1}, {Key: "_id", Value: -1}}).
+		SetLimit(limit))
+	if err != nil {
+		return nil, err
+	}
+	activities := []models.Activity{}
+	if err := cursor.All(ctx, &activities); err != nil {
+		return nil, err
+	}
+
+	// Emails are looked up rather than stored, so they follow changes
+	actorIDs := []primitive.ObjectID{}
+	for _, activity := range activities {
+		actorIDs = append(actorIDs, activity.ActorID)
+	}
+	emails := map[primitive.ObjectID]string{}
+	if len(actorIDs) > 0 {
+		found, err := users.FindByIDs(ctx, actorIDs)
+		if err != nil {
+			return nil, err
+		}
+		for _, user := range found {
+			emails[user.ID] = user.Email
+		}
+	}
+
+	for i := range activities {
+		activities[i].ActorEmail = emails[activities[i].ActorID]
+		activities[i].Summary = activitySummary(&activities[i])
+	}
+	return activities, nil
+}
+
+// DiffChanges counts the shape changes of a save
+func DiffChanges(diff models.BoardDiff) models.ActivityChanges {
+	return models.ActivityChanges{Added: len(diff.Added), Changed: len(diff.Changed), Removed: len(diff.Removed)}
+}
+
+// activitySummary describes an entry in a sentence
+func activitySummary(activity *models.Activity) string {
+	switch activity.Action {
+	case models.ActivityBoardCreated:
+		return "Created the board"
+	case models.ActivityBoardDeleted:
+		return "Deleted the board"
+	case models.ActivityBoardShared:
+		return fmt.Sprintf("Shared the board with %s as %s", activity.UserEmail, activity.Role)
+	case models.ActivityBoardUnshared:
+		if activity.UserID != nil && *activity.UserID == activity.ActorID {
+			return "Left the board"
+		}
+		return fmt.Sprintf("Removed %s from the board", activity.UserEmail)
+	case models.ActivityBoardUpdated:
+		if activity.Changes == nil {
+			return "Edited the board"
+		}
+		parts := []string{}
+		for _, count := range []struct {
+			verb string
+			n    int
+		}{
+			{"added", activity.Changes.Added},
+			{"changed", activity.Changes.Changed},
+			{"removed", activity.Changes.Removed},
+		} {
+			if count.n > 0 {
+				parts = append(parts, fmt.Sprintf("%s %s", count.verb, pluralShapes(count.n)))
+			}
+		}
+		if len(parts) == 0 {
+			return "Edited the board"
+		}
+		summary := parts[len(parts)-1]
+		if len(parts) > 1 {
+			summary = strings.Join(parts[:len(parts)-1], ", ") + " and " + summary
+		}
+		return strings.ToUpper(summary[:1]) + summary[1:]
+	}
+	return activity.Action
+}
+
+func pluralShapes(n int) string {
+	if n == 1 {
+		return "1 shape"
+	}
+	return fmt.Sprintf("%d shapes", n)
+}
+
+// displayBoardName is the board's name, or its board ID without one
+func displayBoardName(board *models.Board) string {
+	if board.Name != "" {
+		return board.Name
+	}
+	return board.BoardID
+}
@@ -0,0 +1,241 @@
+package libs
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/sarwanazhar/boardsar/backend/converter"
+	"github.com/sarwanazhar/boardsar/backend/models"
+)
+
+// ErrNothingToArrange is returned when fewer than two of the selected
+// shapes, once grouped, have a position to move
+var ErrNothingToArrange = errors.New("Select at least two shapes to arrange")
+
+// defaultTidySpacing is the gap tidying leaves between shapes
+const defaultTidySpacing = 20
+
+// arrangeUnit is what arranging moves as one: a selected shape, or the
+// group it is in
+type arrangeUnit struct {
+	ids    []string
+	bounds Bounds
+}
+
+// ArrangeShapes aligns, distributes or tidies the selected shapes of a
+// board state. A shape in a group moves with the whole group, and
+// connectors with one end on a moved shape follow it, as with LayoutShapes.
+// It returns the operations making those changes and the operations
+// undoing them.
+func ArrangeShapes(data map[string]interface{}, req models.ArrangeRequest) (apply, undo []models.BoardOperation, err error) {
+	graph := BoardGraph("", data)
+	plan := newLayoutPlan(data, graph)
+
+	var units []*arrangeUnit
+	seenShapes, seenGroups := map[string]bool{}, map[string]bool{}
+	for _, id := range req.ShapeIDs {
+		shape := plan.shapes[id]
+		if shape == nil {
+			return nil, nil, fmt.Errorf("Shape %s not found", id)
+		}
+		members := []string{id}
+		if group, _ := shape[ShapeGroupKey].(string); group != "" {
+			if seenGroups[group] {
+				continue
+			}
+			seenGroups[group] = true
+			members = plan.groups[group]
+		} else if seenShapes[id] {
+			continue
+		}
+		seenShapes[id] = true
+
+		unit := &arrangeUnit{ids: members}
+		found := false
+		for _, member := range members {
+			bounds, ok := ShapeBounds(plan.shapes[member])
+			if !ok {
+				continue
+			}
+			if found {
+				unit.bounds = unit.bounds.union(bounds)
+			} else {
+				unit.bounds, found = bounds, true
+			}
+		}
+		if found {
+			units = append(units, unit)
+		}
+	}
+	if len(units) < 2 {
+		return nil, nil, ErrNothingToArrange
+	}
+
+	var moves []converter.LayoutPoint
+	switch req.Action {
+	case models.ArrangeAlign:
+		moves, err = alignUnits(units, req.To)
+	case models.ArrangeDistribute:
+		moves, err = distributeUnits(units, req.Axis, req.Spacing)
+	case models.ArrangeTidy:
+		spacing := float64(defaultTidySpacing)
+		if req.Spacing != nil {
+			spacing = *req.Spacing
+		}
+		moves = tidyUnits(units, spacing)
+	default:
+		err = fmt.Errorf("unknown arrange action %q", req.Action)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	moved := map[string]converter.LayoutPoint{}
+	for i, unit := range units {
+		by := converter.LayoutPoint{X: roundLayout(moves[i].X), Y: roundLayout(moves[i].Y)}
+		if by == (converter.LayoutPoint{}) {
+			continue
+		}
+		move := func(p converter.LayoutPoint) converter.LayoutPoint {
+			return offsetBy(p, converter.LayoutPoint{}, by)
+		}
+		for _, id := range unit.ids {
+			plan.move(id, move)
+			moved[id] = by
+		}
+	}
+	plan.follow(graph.Edges, moved)
+
+	apply, undo = plan.operations(data)
+	return apply, undo, nil
+}
+
+// alignUnits lines the units up on an edge or centre line of the selection
+func alignUnits(units []*arrangeUnit, to string) ([]converter.LayoutPoint, error) {
+	selection := units[0].bounds
+	for _, unit := range units[1:] {
+		selection = selection.union(unit.bounds)
+	}
+
+	moves := make([]converter.LayoutPoint, len(units))
+	for i, unit := range units {
+		b := unit.bounds
+		switch to {
+		case "left":
+			moves[i].X = selection.X - b.X
+		case "center":
+			moves[i].X = selection.X + selection.Width/2 - (b.X + b.Width/2)
+		case "right":
+			moves[i].X = selection.X + selection.Width - (b.X + b.Width)
+		case "top":
+			moves[i].Y = selection.Y - b.Y
+		case "middle":
+			moves[i].Y = selection.Y + selection.Height/2 - (b.Y + b.Height/2)
+		case "bottom":
+			moves[i].Y = selection.Y + selection.Height - (b.Y + b.Height)
+		default:
+			return nil, errors.New("Say what to align to: left, center, right, top, middle or bottom")
+		}
+	}
+	return moves, nil
+}
+
+// distributeUnits spaces the units out along an axis, from the first one,
+// which stays put. Without a spacing, the last one stays put too and the
+// gaps between them are made even.
+func distributeUnits(units []*arrangeUnit, axis string, spacing *float64) ([]converter.LayoutPoint, error) {
+	span := func(b Bounds) (start, size float64) { return b.X, b.Width }
+	switch axis {
+	case "horizontal":
+	case "vertical":
+		span = func(b Bounds) (start, size float64) { return b.Y, b.Height }
+	default:
+		return nil, errors.New("Say which axis to distribute along: horizontal or vertical")
+	}
+
+	order := make([]int, len(units))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		a, sizeA := span(units[order[i]].bounds)
+		b, sizeB := span(units[order[j]].bounds)
+		return a+sizeA/2 < b+sizeB/2
+	})
+
+	first, _ := span(units[order[0]].bounds)
+	gap := 0.0
+	if spacing != nil {
+		gap = *spacing
+	} else {
+		end, total := first, 0.0
+		for _, i := range order {
+			start, size := span(units[i].bounds)
+			end = math.Max(end, start+size)
+			total += size
+		}
+		gap = (end - first - total) / float64(len(units)-1)
+	}
+
+	moves := make([]converter.LayoutPoint, len(units))
+	at := first
+	for _, i := range order {
+		start, size := span(units[i].bounds)
+		if axis == "horizontal" {
+			moves[i].X = at - start
+		} else {
+			moves[i].Y = at - start
+		}
+		at += size + gap
+	}
+	return moves, nil
+}
+
+// tidyUnits puts the units in rows, spacing apart, from the top-left corner
+// of the selection. A unit joins a row when its centre is above the bottom
+// of the row's first unit; rows keep their order left to right.
+func tidyUnits(units []*arrangeUnit, spacing float64) []converter.LayoutPoint {
+	order := make([]int, len(units))
+	for i := range order {
+		order[i] = i
+	}
+	centreY := func(i int) float64 { return units[i].bounds.Y + units[i].bounds.Height/2 }
+	sort.SliceStable(order, func(i, j int) bool {
+		return centreY(order[i]) < centreY(order[j])
+	})
+
+	var rows [][]int
+	for _, i := range order {
+		if n := len(rows); n > 0 {
+			first := units[rows[n-1][0]].bounds
+			if centreY(i) < first.Y+first.Height {
+				rows[n-1] = append(rows[n-1], i)
+				continue
+			}
+		}
+		rows = append(rows, []int{i})
+	}
+
+	selection := units[0].bounds
+	for _, unit := range units[1:] {
+		selection = selection.union(unit.bounds)
+	}
+	moves := make([]converter.LayoutPoint, len(units))
+	y := selection.Y
+	for _, row := range rows {
+		sort.SliceStable(row, func(a, b int) bool {
+			return units[row[a]].bounds.X < units[row[b]].bounds.X
+		})
+		x, height := selection.X, 0.0
+		for _, i := range row {
+			b := units[i].bounds
+			moves[i] = converter.LayoutPoint{X: x - b.X, Y: y - b.Y}
+			x += b.Width + spacing
+			height = math.Max(height, b.Height)
+		}
+		y += height + spacing
+	}
+	return moves
+}
@@ -0,0 +1,262 @@
+package libs
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sarwanazhar/boardsar/backend/database"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const assetCollection = "assets"
+
+const (
+	// maxAssetPixels refuses images that are small files but huge once
+	// decoded
+	maxAssetPixels   = 50_000_000
+	maxAssetFilename = 255
+)
+
+// AssetContentTypes are the image types that can be uploaded. SVG is left
+// out: it can carry scripts.
+var AssetContentTypes = []string{"image/png", "image/jpeg", "image/gif", "image/webp"}
+
+var (
+	ErrUnsupportedAsset = errors.New("Only PNG, JPEG, GIF and WebP images can be uploaded")
+	ErrInvalidAsset     = errors.New("The file is not a valid image")
+	ErrAssetDimensions  = errors.New("The image is too large (50 megapixels max)")
+)
+
+func GetAssetCollection() *mongo.Collection {
+	return database.GetCollection(assetCollection)
+}
+
+// MaxAssetSize is the largest upload in bytes, from ASSET_MAX_SIZE
+func MaxAssetSize() int64 {
+	return settings.AssetMaxSize
+}
+
+// AssetURL is where an asset is served from
+func AssetURL(assetID primitive.ObjectID) string {
+	return APIURL() + "/api/assets/" + assetID.Hex()
+}
+
+// CreateAsset checks that data is a supported image and stores it for the
+// board. The type is sniffed from the bytes; what the client declared is
+// ignored.
+func CreateAsset(ctx context.Context, board *models.Board, uploadedBy primitive.ObjectID, filename string, data []byte) (*models.Asset, error) {
+	contentType, width, height, err := inspectImage(data)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(data)
+	asset := &models.Asset{
+		ID:          primitive.NewObjectID(),
+		BoardID:     board.ID,
+		OwnerID:     board.OwnerID,
+		UploadedBy:  uploadedBy,
+		Filename:    assetFilename(filename),
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		Width:       width,
+		Height:      height,
+		SHA256:      hex.EncodeToString(sum[:]),
+		Storage:     DefaultAssetStorage(),
+		CreatedAt:   time.Now(),
+	}
+	asset.Key = "boards/" + board.ID.Hex() + "/" + asset.ID.Hex()
+
+	storage, err := GetAssetStorage(asset.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if err := storage.Put(ctx, asset.Key, data, contentType); err != nil {
+		return nil, fmt.Errorf("error storing asset: %w", err)
+	}
+	if _, err := GetAssetCollection().InsertOne(ctx, asset); err != nil {
+		if deleteErr := storage.Delete(ctx, asset.Key); deleteErr != nil {
+			slog.Warn("Failed to delete data of unsaved asset", "asset_id", asset.ID.Hex(), "error", deleteErr)
+		}
+		return nil, fmt.Errorf("error saving asset: %w", err)
+	}
+
+	asset.URL = AssetURL(asset.ID)
+	return asset, nil
+}
+
+// FindAsset loads an asset record, or returns mongo.ErrNoDocuments
+func FindAsset(ctx context.Context, assetID primitive.ObjectID) (*models.Asset, error) {
+	var asset models.Asset
+	if err := GetAssetCollection().FindOne(ctx, bson.M{"_id": assetID}).Decode(&asset); err != nil {
+		return nil, err
+	}
+	asset.URL = AssetURL(asset.ID)
+	return &asset, nil
+}
+
+// OpenAsset streams an asset's bytes from the storage it was saved to
+func OpenAsset(ctx context.Context, asset *models.Asset) (io.ReadCloser, error) {
+	storage, err := GetAssetStorage(asset.Storage)
+	if err != nil {
+		return nil, err
+	}
+	return storage.Open(ctx, asset.Key)
+}
+
+// DeleteAsset removes an asset and its stored bytes
+func DeleteAsset(ctx context.Context, asset *models.Asset) error {
+	storage, err := GetAssetStorage(asset.Storage)
+	if err != nil {
+		return err
+	}
+	if err := storage.Delete(ctx, asset.Key); err != nil {
+		return fmt.Errorf("error deleting asset data: %w", err)
+	}
+	if _, err := GetAssetCollection().DeleteOne(ctx, bson.M{"_id": asset.ID}); err != nil {
+		return fmt.Errorf("error deleting asset: %w", err)
+	}
+	return nil
+}
+
+// DeleteBoardAssets removes the assets of a deleted board
+func DeleteBoardAssets(ctx context.Context, boardID primitive.ObjectID) error {
+	cursor, err := GetAssetCollection().Find(ctx, bson.M{"boardId": boardID})
+	if err != nil {
+		return err
+	}
+	var assets []models.Asset
+	if err := cursor.All(ctx, &assets); err != nil {
+		return err
+	}
+	for i := range assets {
+		if err := DeleteAsset(ctx, &assets[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AssetStorageUsage is the total size of the assets on the user's boards,
+// which counts against their storage quota
+func AssetStorageUsage(ctx context.Context, ownerID primitive.ObjectID) (int64, error) {
+	cursor, err := GetAssetCollection().Aggregate(ctx, bson.A{
+		bson.M{"$match": bson.M{"ownerId": ownerID}},
+		bson.M{"$group": bson.M{"_id": nil, "size": bson.M{"$sum": "$size"}}},
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var results []struct {
+		Size int64 `bson:"size"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return 0, err
+	}
+	if len(results) == 0 {
+		return 0, nil
+	}
+	return results[0].Size, nil
+}
+
+// inspectImage returns the type and dimensions of an uploaded image
+func inspectImage(data []byte) (string, int, int, error) {
+	contentType := http.DetectContentType(data)
+	supported := false
+	for _, allowed := range AssetContentTypes {
+		supported = supported || contentType == allowed
+	}
+	if !supported {
+		return "", 0, 0, ErrUnsupportedAsset
+	}
+
+	var width, height int
+	if contentType == "image/webp" {
+		var ok bool
+		if width, height, ok = webpSize(data); !ok {
+			return "", 0, 0, ErrInvalidAsset
+		}
+	} else {
+		config, _, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			return "", 0, 0, ErrInvalidAsset
+		}
+		width, height = config.Width, config.Height
+	}
+
+	if width <= 0 || height <= 0 {
+		return "", 0, 0, ErrInvalidAsset
+	}
+	if int64(width)*int64(height) > maxAssetPixels {
+		return "", 0, 0, ErrAssetDimensions
+	}
+	return contentType, width, height, nil
+}
+
+// webpSize reads a WebP's dimensions from its first chunk: lossy (VP8),
+// lossless (VP8L) or extended (VP8X)
+func webpSize(data []byte) (int, int, bool) {
+	if len(data) < 30 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return 0, 0, false
+	}
+	chunk := data[20:]
+	switch string(data[12:16]) {
+	case "VP8 ":
+		// Frame tag (3 bytes), start code (3 bytes), then 14-bit sizes
+		if chunk[3] != 0x9d || chunk[4] != 0x01 || chunk[5] != 0x2a {
+			return 0, 0, false
+		}
+		return int(binary.LittleEndian.Uint16(chunk[6:8]) & 0x3fff), int(binary.LittleEndian.Uint16(chunk[8:10]) & 0x3fff), true
+	case "VP8L":
+		// Signature byte, then 14-bit width-1 and height-1
+		if chunk[0] != 0x2f {
+			return 0, 0, false
+		}
+		bits := binary.LittleEndian.Uint32(chunk[1:5])
+		return int(bits&0x3fff) + 1, int((bits>>14)&0x3fff) + 1, true
+	case "VP8X":
+		// Flags (4 bytes), then 24-bit width-1 and height-1
+		width := int(chunk[4]) | int(chunk[5])<<8 | int(chunk[6])<<16
+		height := int(chunk[7]) | int(chunk[8])<<8 | int(chunk[9])<<16
+		return width + 1, height + 1, true
+	}
+	return 0, 0, false
+}
+
+// assetFilename keeps the base name of an uploaded file, without control
+// characters or quotes that would break a Content-Disposition header
+func assetFilename(filename string) string {
+	filename = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || r == '"' || r == '\\' {
+			return -1
+		}
+		return r
+	}, filepath.Base(strings.ReplaceAll(filename, "\\", "/")))
+	if filename == "." || filename == "/" || filename == "" {
+		return "image"
+	}
+	if runes := []rune(filename); len(runes) > maxAssetFilename {
+		filename = string(runes[:maxAssetFilename])
+	}
+	return filename
+}
@@ -0,0 +1,295 @@
+package libs
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sarwanazhar/boardsar/backend/config"
+	"github.com/sarwanazhar/boardsar/backend/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Asset storage backends, chosen with ASSET_STORAGE. Each asset records
+// the backend it was stored in, so switching keeps older assets readable.
+const (
+	AssetStorageGridFS = config.AssetStorageGridFS
+	AssetStorageS3     = config.AssetStorageS3
+)
+
+// assetBucket is the GridFS bucket assets are stored in
+const assetBucket = "asset_data"
+
+// AssetStorage keeps the bytes of uploaded assets under a key
+type AssetStorage interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// ErrAssetDataNotFound is returned by AssetStorage.Open for a missing key
+var ErrAssetDataNotFound = errors.New("asset data not found")
+
+// DefaultAssetStorage names the backend new assets go to: ASSET_STORAGE,
+// GridFS by default
+func DefaultAssetStorage() string {
+	return settings.AssetStorage
+}
+
+// GetAssetStorage returns the named backend
+func GetAssetStorage(name string) (AssetStorage, error) {
+	switch name {
+	case AssetStorageGridFS:
+		return gridFSAssetStorage{}, nil
+	case AssetStorageS3:
+		return newS3AssetStorage()
+	}
+	return nil, fmt.Errorf("unknown asset storage %q", name)
+}
+
+// gridFSAssetStorage keeps assets in MongoDB, with the key as file name
+type gridFSAssetStorage struct{}
+
+func (gridFSAssetStorage) bucket(ctx context.Context) (*gridfs.Bucket, error) {
+	bucket, err := gridfs.NewBucket(database.GetDatabase(), options.GridFSBucket().SetName(assetBucket))
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		bucket.SetReadDeadline(deadline)
+		bucket.SetWriteDeadline(deadline)
+	}
+	return bucket, nil
+}
+
+func (s gridFSAssetStorage) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	bucket, err := s.bucket(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = bucket.UploadFromStream(key, bytes.NewReader(data),
+		options.GridFSUpload().SetMetadata(bson.M{"contentType": contentType}))
+	return err
+}
+
+func (s gridFSAssetStorage) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	bucket, err := s.bucket(ctx)
+	if err != nil {
+		return nil, err
+	}
+	stream, err := bucket.OpenDownloadStreamByName(key)
+	if err == gridfs.ErrFileNotFound {
+		return nil, ErrAssetDataNotFound
+	}
+	return stream, err
+}
+
+func (s gridFSAssetStorage) Delete(ctx context.Context, key string) error {
+	bucket, err := s.bucket(ctx)
+	if err != nil {
+		return err
+	}
+	cursor, err := bucket.GetFilesCollection().Find(ctx, bson.M{"filename": key}, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return err
+	}
+	var files []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &files); err != nil {
+		return err
+	}
+	for _, file := range files {
+		if err := bucket.DeleteContext(ctx, file.ID); err != nil && err != gridfs.ErrFileNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+// s3AssetStorage keeps assets in an S3 bucket, or any S3-compatible store
+// (MinIO, R2) through S3_ENDPOINT. Requests use path-style URLs signed
+// with AWS Signature Version 4.
+type s3AssetStorage struct {
+	endpoint  *url.URL
+	bucket    string
+	region    string
+	accessKey string
+	secretKey string
+}
+
+var s3Client = &http.Client{Timeout: 30 * time.Second}
+
+// emptyPayloadHash is the SHA-256 of an empty body
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// newS3AssetStorage connects to the configured bucket, at S3_ENDPOINT or
+// AWS in S3_REGION
+func newS3AssetStorage() (*s3AssetStorage, error) {
+	storage := &s3AssetStorage{
+		bucket:    settings.S3Bucket,
+		region:    cmp.Or(settings.S3Region, config.DefaultS3Region),
+		accessKey: settings.S3AccessKeyID,
+		secretKey: settings.S3SecretAccessKey,
+	}
+	if storage.bucket == "" || storage.accessKey == "" || storage.secretKey == "" {
+		return nil, fmt.Errorf("S3 asset storage needs S3_BUCKET, S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY")
+	}
+	endpoint := cmp.Or(settings.S3Endpoint, "https://s3."+storage.region+".amazonaws.com")
+	parsed, err := url.Parse(strings.TrimSuffix(endpoint, "/"))
+	if err != nil || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid S3_ENDPOINT %q", endpoint)
+	}
+	storage.endpoint = parsed
+	return storage, nil
+}
+
+func (s *s3AssetStorage) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	req, err := s.request(ctx, http.MethodPut, key, data)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	body, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	return body.Close()
+}
+
+func (s *s3AssetStorage) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	req, err := s.request(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	return s.do(req)
+}
+
+func (s *s3AssetStorage) Delete(ctx context.Context, key string) error {
+	req, err := s.request(ctx, http.MethodDelete, key, nil)
+	if err != nil {
+		return err
+	}
+	body, err := s.do(req)
+	if err == ErrAssetDataNotFound {
+		return nil
+	}
+	if err == nil {
+		body.Close()
+	}
+	return err
+}
+
+// request builds a signed request for the object at key
+func (s *s3AssetStorage) request(ctx context.Context, method, key string, data []byte) (*http.Request, error) {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	target := *s.endpoint
+	target.RawPath = s.endpoint.Path + "/" + url.PathEscape(s.bucket) + "/" + strings.Join(segments, "/")
+	target.Path, _ = url.PathUnescape(target.RawPath)
+
+	var body io.Reader
+	if data != nil {
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target.String(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	payloadHash := emptyPayloadHash
+	if data != nil {
+		sum := sha256.Sum256(data)
+		payloadHash = hex.EncodeToString(sum[:])
+	}
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	signAWSRequest(req, s.accessKey, s.secretKey, s.region, "s3", payloadHash, time.Now())
+	return req, nil
+}
+
+// do sends a request, returning the body of a successful one
+func (s *s3AssetStorage) do(req *http.Request) (io.ReadCloser, error) {
+	resp, err := s3Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error calling S3: %w", err)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrAssetDataNotFound
+	}
+	if resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return nil, fmt.Errorf("S3 answered %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	return resp.Body, nil
+}
+
+// signAWSRequest adds an AWS Signature Version 4 Authorization header,
+// signing the host, the x-amz-* headers and the payload hash
+func signAWSRequest(req *http.Request, accessKey, secretKey, region, service, payloadHash string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "x-amz-") || lower == "range" {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		strings.ReplaceAll(req.URL.Query().Encode(), "+", "%20"),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + secretKey)
+	for _, part := range []string{date, region, service, "aws4_request", stringToSign} {
+		key = hmacSHA256(key, part)
+	}
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+accessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+hex.EncodeToString(key))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
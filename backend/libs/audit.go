@@ -0,0 +1,79 @@
+package libs
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/sarwanazhar/boardsar/backend/database"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const auditCollection = "audit_events"
+
+// AuditSettleDelay holds back the newest events from listings. Event IDs
+// are generated by each server, so an event can be stored slightly after
+// one with a later ID; waiting keeps cursors from skipping past it. It is a
+// variable so tests can shorten it.
+var AuditSettleDelay = 5 * time.Second
+
+func GetAuditCollection() *mongo.Collection {
+	return database.GetCollection(auditCollection)
+}
+
+// RecordAudit stores an audit event. Failures are logged rather than
+// returned: a failed audit write must not fail the request it describes.
+func RecordAudit(ctx context.Context, event models.AuditEvent) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+
+	event.ID = primitive.NewObjectID()
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	if event.Outcome == "" {
+		event.Outcome = models.AuditOutcomeSuccess
+	}
+
+	if _, err := GetAuditCollection().InsertOne(ctx, event); err != nil {
+		slog.Warn("Failed to record audit event", "action", event.Action, "error", err)
+	}
+}
+
+// ListAuditEvents returns up to limit events recorded after the cursor (the
+// ID of the last event already fetched), oldest first. With no cursor it
+// starts at since, or at the beginning of the log. Events from the last few
+// seconds are left for the next call.
+func ListAuditEvents(ctx context.Context, cursor primitive.ObjectID, since time.Time, limit int64) ([]models.AuditEvent, error) {
+	idRange := bson.M{}
+	if AuditSettleDelay > 0 {
+		idRange["$lt"] = primitive.NewObjectIDFromTimestamp(time.Now().Add(-AuditSettleDelay))
+	}
+	switch {
+	case !cursor.IsZero():
+		idRange["$gt"] = cursor
+	case !since.IsZero():
+		idRange["$gte"] = primitive.NewObjectIDFromTimestamp(since)
+	}
+	filter := bson.M{}
+	if len(idRange) > 0 {
+		filter["_id"] = idRange
+	}
+
+	found, err := GetAuditCollection().Find(ctx, filter, options.Find().
+		SetSort(bson.D{{Key: "_id", Value: 1}}).
+		SetLimit(limit))
+	if err != nil {
+		return nil, err
+	}
+
+	events := []models.AuditEvent{}
+	if err := found.All(ctx, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
@@ -0,0 +1,164 @@
+package libs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sarwanazhar/boardsar/backend/config"
+	"github.com/sarwanazhar/boardsar/backend/database"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const auditForwarderCollection = "audit_forwarder"
+
+// Audit forwarding formats
+const (
+	AuditFormatJSON   = config.AuditFormatJSON   // One JSON array per batch (Datadog logs intake, generic webhooks)
+	AuditFormatSplunk = config.AuditFormatSplunk // Splunk HTTP Event Collector envelopes
+)
+
+const auditForwardBatchSize = 500
+
+// auditForwarderState is the stored cursor of the forwarder, shared by
+// every instance so a restart resumes where the last batch ended
+type auditForwarderState struct {
+	ID     string             `bson:"_id"`
+	Cursor primitive.ObjectID `bson:"cursor"`
+}
+
+// AuditForwardingConfigured reports whether AUDIT_FORWARD_URL is set
+func AuditForwardingConfigured() bool {
+	return settings.AuditForwardURL != ""
+}
+
+// RunAuditForwarder posts new audit events in batches to AUDIT_FORWARD_URL
+// every AUDIT_FORWARD_INTERVAL until ctx is done. Delivery is at least once:
+// a batch is resent if storing the cursor fails or another instance
+// forwarded the same events, so receivers should dedupe on the event id.
+func RunAuditForwarder(ctx context.Context) {
+	interval := settings.Intervals.AuditForward
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	slog.Info("Forwarding audit events", "interval", interval)
+	for {
+		// Drain the backlog one batch at a time
+		for {
+			sent, err := forwardAuditBatch(ctx)
+			if err != nil {
+				slog.Warn("Audit forwarding failed", "error", err)
+				break
+			}
+			if sent < auditForwardBatchSize {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// forwardAuditBatch sends the next batch of events and advances the stored
+// cursor. It returns how many events were sent.
+func forwardAuditBatch(ctx context.Context) (int, error) {
+	requestCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	states := database.GetCollection(auditForwarderCollection)
+	var state auditForwarderState
+	err := states.FindOne(requestCtx, bson.M{"_id": "default"}).Decode(&state)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return 0, fmt.Errorf("error loading cursor: %w", err)
+	}
+
+	events, err := ListAuditEvents(requestCtx, state.Cursor, time.Time{}, auditForwardBatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("error listing events: %w", err)
+	}
+	if len(events) == 0 {
+		return 0, nil
+	}
+
+	if err := postAuditEvents(requestCtx, events); err != nil {
+		return 0, err
+	}
+
+	// Never move the cursor back if another instance got further; the
+	// upsert then fails on the duplicate _id, which is fine
+	next := events[len(events)-1].ID
+	_, err = states.UpdateOne(requestCtx,
+		bson.M{"_id": "default", "cursor": bson.M{"$lt": next}},
+		bson.M{"$set": bson.M{"cursor": next}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		return 0, fmt.Errorf("error storing cursor: %w", err)
+	}
+	return len(events), nil
+}
+
+// postAuditEvents delivers one batch in AUDIT_FORWARD_FORMAT, adding the
+// AUDIT_FORWARD_HEADER ("Name: value", e.g. "Authorization: Splunk <token>"
+// or "DD-API-KEY: <key>") when set
+func postAuditEvents(ctx context.Context, events []models.AuditEvent) error {
+	var body bytes.Buffer
+	switch format := settings.AuditForwardFormat; format {
+	case AuditFormatSplunk:
+		encoder := json.NewEncoder(&body)
+		for _, event := range events {
+			err := encoder.Encode(map[string]interface{}{
+				"time":       float64(event.Time.UnixMilli()) / 1000,
+				"source":     "boardsar",
+				"sourcetype": "boardsar:audit",
+				"event":      event,
+			})
+			if err != nil {
+				return fmt.Errorf("error encoding events: %w", err)
+			}
+		}
+	case "", AuditFormatJSON:
+		if err := json.NewEncoder(&body).Encode(events); err != nil {
+			return fmt.Errorf("error encoding events: %w", err)
+		}
+	default:
+		return fmt.Errorf("unknown AUDIT_FORWARD_FORMAT %q", format)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, settings.AuditForwardURL, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if header := settings.AuditForwardHeader; header != "" {
+		name, value, ok := strings.Cut(header, ":")
+		if !ok {
+			return fmt.Errorf("AUDIT_FORWARD_HEADER must look like \"Name: value\"")
+		}
+		req.Header.Set(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error posting events: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("receiver returned %s", resp.Status)
+	}
+	return nil
+}
@@ -2,51 +2,41 @@ package libs
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"os"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
-	"github.com/sarwanazhar/boardsar/backend/database"
 	"github.com/sarwanazhar/boardsar/backend/models"
-	"go.mongodb.org/mongo-driver/bson"
+	"github.com/sarwanazhar/boardsar/backend/repository"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 	"golang.org/x/crypto/bcrypt"
 )
 
-const dbName = "boardsar"
-const userCollection = "users"
-
-func getUserCollection() *mongo.Collection {
-	return database.GetCollection(dbName, userCollection)
-}
-
+// CreateUser stores a new user, giving it an ID and timestamps
 func CreateUser(ctx context.Context, user *models.User) (primitive.ObjectID, error) {
 	user.ID = primitive.NewObjectID()
 	user.CreatedAt = time.Now()
 	user.UpdatedAt = time.Now()
 
-	_, err := getUserCollection().InsertOne(ctx, user)
+	err := users.Create(ctx, user)
 	return user.ID, err
 }
 
-func SearchForExistingEmail(email string) (bool, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func SearchForExistingEmail(ctx context.Context, email string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, Settings().DBTimeout)
 	defer cancel()
 
-	filter := bson.D{
-		bson.E{Key: "email", Value: email},
-	}
-
-	var user models.User
-
-	err := database.GetCollection(dbName, userCollection).FindOne(ctx, filter).Decode(&user)
+	_, err := users.FindByEmail(ctx, email)
 
-	switch err {
-	case nil:
+	switch {
+	case err == nil:
 		return true, nil
-	case mongo.ErrNoDocuments:
+	case errors.Is(err, repository.ErrNotFound):
 		return false, nil
 	default:
 		return false, fmt.Errorf("database error during email search: %w", err)
@@ -63,38 +53,37 @@ func CheckPasswordHash(password, hash string) bool {
 	return err == nil
 }
 
-func FindUserByEmail(email string) (*models.User, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func FindUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	ctx, cancel := context.WithTimeout(ctx, Settings().DBTimeout)
 	defer cancel()
 
-	filter := bson.M{"email": email}
-
-	var user models.User
-
-	result := database.GetCollection(dbName, userCollection).FindOne(ctx, filter)
-
-	if result.Err() != nil {
-		if result.Err() == mongo.ErrNoDocuments {
+	user, err := users.FindByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
 			return nil, fmt.Errorf("user with email '%s' not found", email)
 		}
-		return nil, fmt.Errorf("error finding user: %w", result.Err())
+		return nil, fmt.Errorf("error finding user: %w", err)
 	}
-
-	err := result.Decode(&user)
-	if err != nil {
-		return nil, fmt.Errorf("error decoding user document: %w", err)
-	}
-
-	return &user, nil
+	return user, nil
 }
 
 func GetJWTSecret() []byte {
-	return []byte(os.Getenv("JWT_SECRET"))
+	return []byte(settings.JWTSecret)
 }
 
-func GenerateJWT(userID string) (string, error) {
+// GenerateJWT issues a short-lived access token for the user, at their
+// current token version and for the session it was signed in with, if any.
+// Clients renew it with a refresh token.
+func GenerateJWT(userID, sessionID string, tokenVersion int64) (string, error) {
+	now := time.Now()
 	claims := jwt.MapClaims{
 		"userId": userID,
+		"ver":    tokenVersion,
+		"iat":    now.Unix(),
+		"exp":    now.Add(AccessTokenTTL()).Unix(),
+	}
+	if sessionID != "" {
+		claims["sid"] = sessionID
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
@@ -102,8 +91,193 @@ func GenerateJWT(userID string) (string, error) {
 	return token.SignedString(GetJWTSecret())
 }
 
-func FindUserByID(id string) (*models.User, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+// GenerateScopedJWT issues an access token for an OAuth app acting for the
+// user. It carries the app's client ID and the granted scopes, which limit
+// what it can do.
+func GenerateScopedJWT(userID, clientID string, scopes []string, tokenVersion int64) (string, error) {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"userId":    userID,
+		"client_id": clientID,
+		"scope":     strings.Join(scopes, " "),
+		"ver":       tokenVersion,
+		"iat":       now.Unix(),
+		"exp":       now.Add(AccessTokenTTL()).Unix(),
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+
+	return token.SignedString(GetJWTSecret())
+}
+
+// AccessClaims is what an access token says about its bearer. ClientID is
+// empty for the first-party app, whose tokens are not limited by scopes.
+type AccessClaims struct {
+	UserID       string
+	ClientID     string
+	Scopes       []string
+	TokenVersion int64  // 0 for tokens issued before versions were
+	SessionID    string // Empty for tokens issued before sessions were
+}
+
+// ParseJWT verifies a token and returns the user ID it was issued for. The
+// error text is safe to return to clients.
+func ParseJWT(tokenString string) (string, error) {
+	claims, err := ParseJWTClaims(tokenString)
+	if err != nil {
+		return "", err
+	}
+	return claims.UserID, nil
+}
+
+// ParseJWTClaims verifies a token and returns its claims. The error text is
+// safe to return to clients.
+func ParseJWTClaims(tokenString string) (*AccessClaims, error) {
+	token, err := jwt.Parse(tokenString, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, jwt.ErrTokenSignatureInvalid
+		}
+		return GetJWTSecret(), nil
+	}, jwt.WithExpirationRequired())
+	if err != nil || !token.Valid {
+		return nil, errors.New("Invalid token")
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["userId"] == nil {
+		return nil, errors.New("Invalid token claims")
+	}
+
+	userID, ok := claims["userId"].(string)
+	if !ok {
+		return nil, errors.New("Invalid token userId")
+	}
+
+	access := &AccessClaims{UserID: userID}
+	if version, ok := claims["ver"].(float64); ok {
+		access.TokenVersion = int64(version)
+	}
+	if sessionID, ok := claims["sid"].(string); ok {
+		access.SessionID = sessionID
+	}
+	if clientID, ok := claims["client_id"].(string); ok && clientID != "" {
+		access.ClientID = clientID
+		scope, _ := claims["scope"].(string)
+		access.Scopes = strings.Fields(scope)
+	}
+
+	return access, nil
+}
+
+var (
+	// ErrTokenRevoked is returned for access tokens issued before the
+	// user's password changed, or to a user that no longer exists
+	ErrTokenRevoked = errors.New("Token has been revoked")
+	// ErrTokenUnchecked is returned when the user's token version can't be
+	// read
+	ErrTokenUnchecked = errors.New("Could not check token")
+)
+
+// tokenVersionTTL is how long an instance trusts the token version it read
+// for a user. A password changed through another instance revokes the
+// user's tokens here once it runs out.
+const tokenVersionTTL = 10 * time.Second
+
+// tokenVersions are the token versions this instance read, by user ID
+var tokenVersions = struct {
+	sync.Mutex
+	users map[string]cachedTokenVersion
+}{users: map[string]cachedTokenVersion{}}
+
+type cachedTokenVersion struct {
+	version int64
+	readAt  time.Time
+}
+
+// VerifyJWT verifies an access token as ParseJWTClaims does, that it was
+// issued at the user's current token version and that its session hasn't
+// been revoked. The error text is safe to return to clients;
+// TokenErrorStatus gives the status to answer with.
+func VerifyJWT(ctx context.Context, tokenString string) (*AccessClaims, error) {
+	claims, err := ParseJWTClaims(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	version, err := currentTokenVersion(ctx, claims.UserID, false)
+	if err == nil && claims.TokenVersion > version {
+		// Issued since this instance read the version
+		version, err = currentTokenVersion(ctx, claims.UserID, true)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if claims.TokenVersion != version {
+		return nil, ErrTokenRevoked
+	}
+	if claims.SessionID != "" {
+		if err := checkSession(ctx, claims.SessionID, claims.UserID); err != nil {
+			return nil, err
+		}
+	}
+	return claims, nil
+}
+
+// TokenErrorStatus is the status to answer a VerifyJWT error with: 401, or
+// 503 when the token couldn't be checked
+func TokenErrorStatus(err error) int {
+	if errors.Is(err, ErrTokenUnchecked) {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusUnauthorized
+}
+
+// currentTokenVersion reads the user's token version, or takes the one
+// read in the last tokenVersionTTL unless fresh
+func currentTokenVersion(ctx context.Context, userID string, fresh bool) (int64, error) {
+	now := time.Now()
+	if !fresh {
+		tokenVersions.Lock()
+		cached, ok := tokenVersions.users[userID]
+		tokenVersions.Unlock()
+		if ok && now.Sub(cached.readAt) < tokenVersionTTL {
+			return cached.version, nil
+		}
+	}
+
+	id, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return 0, errors.New("Invalid token userId")
+	}
+	findCtx, cancel := context.WithTimeout(ctx, Settings().DBTimeout)
+	defer cancel()
+	user, err := users.FindByID(findCtx, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return 0, ErrTokenRevoked
+	}
+	if err != nil {
+		slog.Warn("Failed to read token version", "user_id", userID, "error", err)
+		return 0, ErrTokenUnchecked
+	}
+
+	tokenVersions.Lock()
+	defer tokenVersions.Unlock()
+	if len(tokenVersions.users) >= maxCachedTokenVersions {
+		for id, entry := range tokenVersions.users {
+			if now.Sub(entry.readAt) >= tokenVersionTTL {
+				delete(tokenVersions.users, id)
+			}
+		}
+	}
+	tokenVersions.users[userID] = cachedTokenVersion{version: user.TokenVersion, readAt: now}
+	return user.TokenVersion, nil
+}
+
+// maxCachedTokenVersions is how many users' token versions are kept before
+// the stale ones are dropped
+const maxCachedTokenVersions = 10000
+
+func FindUserByID(ctx context.Context, id string) (*models.User, error) {
+	ctx, cancel := context.WithTimeout(ctx, Settings().DBTimeout)
 	defer cancel()
 
 	objID, err := primitive.ObjectIDFromHex(id)
@@ -111,20 +285,140 @@ func FindUserByID(id string) (*models.User, error) {
 		return nil, fmt.Errorf("invalid user id format")
 	}
 
-	filter := bson.M{"_id": objID}
-
-	var user models.User
-	result := getUserCollection().FindOne(ctx, filter)
-	if result.Err() != nil {
-		if result.Err() == mongo.ErrNoDocuments {
+	user, err := users.FindByID(ctx, objID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
 			return nil, fmt.Errorf("user with id '%s' not found", id)
 		}
-		return nil, fmt.Errorf("error finding user: %w", result.Err())
+		return nil, fmt.Errorf("error finding user: %w", err)
+	}
+	return user, nil
+}
+
+func UpdateUserLocale(ctx context.Context, id string, locale string) error {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return fmt.Errorf("invalid user id format")
+	}
+	return updateUser(ctx, objID, "locale", locale)
+}
+
+// UpdateUserPassword replaces the user's bcrypt password hash and bumps
+// their token version, so the access tokens issued before stop working.
+// user.TokenVersion is the new version on return. Refresh tokens are left
+// to RevokeUserRefreshTokens.
+func UpdateUserPassword(ctx context.Context, user *models.User, passwordHash string) error {
+	ctx, cancel := context.WithTimeout(ctx, Settings().DBTimeout)
+	defer cancel()
+
+	version := user.TokenVersion + 1
+	err := users.Update(ctx, user.ID, map[string]interface{}{"password": passwordHash, "token_version": version})
+	if errors.Is(err, repository.ErrNotFound) {
+		return fmt.Errorf("user with id '%s' not found", user.ID.Hex())
+	}
+	if err != nil {
+		return fmt.Errorf("error updating user password: %w", err)
 	}
+	user.Password = passwordHash
+	user.TokenVersion = version
 
-	if err := result.Decode(&user); err != nil {
-		return nil, fmt.Errorf("error decoding user document: %w", err)
+	tokenVersions.Lock()
+	delete(tokenVersions.users, user.ID.Hex())
+	tokenVersions.Unlock()
+	return nil
+}
+
+// ErrEmailTaken is returned when moving a user to an address another
+// account has. The text is safe to return to clients.
+var ErrEmailTaken = errors.New("This email address is already registered.")
+
+// emailChanges serializes the check and the write of UpdateUserEmail on
+// this instance, so two users confirming the same address at once can't
+// both get it
+var emailChanges sync.Mutex
+
+// UpdateUserEmail moves the user to a new email address, as one write,
+// unless another account has it (checked as SearchForExistingEmail does),
+// in which case it returns ErrEmailTaken. user.Email is the new address on
+// return.
+func UpdateUserEmail(ctx context.Context, user *models.User, email string) error {
+	emailChanges.Lock()
+	defer emailChanges.Unlock()
+
+	exists, err := SearchForExistingEmail(ctx, email)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return ErrEmailTaken
+	}
+	if err := updateUser(ctx, user.ID, "email", email); err != nil {
+		return err
+	}
+	user.Email = email
+	return nil
+}
+
+// UpdateUserPasswordless turns passwordless sign-in on or off for the user
+func UpdateUserPasswordless(ctx context.Context, id primitive.ObjectID, passwordless bool) error {
+	return updateUser(ctx, id, "passwordless", passwordless)
+}
+
+// ErrAccountDeactivated is returned when a deactivated account signs in.
+// The text is safe to return to clients.
+var ErrAccountDeactivated = errors.New("This account is deactivated")
+
+// TouchUserActivity records that the user is active now, for the
+// succession policy
+func TouchUserActivity(ctx context.Context, id primitive.ObjectID) error {
+	return updateUser(ctx, id, "last_active_at", time.Now())
+}
+
+// DeactivateUser stops the user from signing in and bumps their token
+// version, so the access tokens issued before stop working. Refresh tokens
+// are left to RevokeUserRefreshTokens.
+func DeactivateUser(ctx context.Context, user *models.User) error {
+	ctx, cancel := context.WithTimeout(ctx, Settings().DBTimeout)
+	defer cancel()
+
+	now := time.Now()
+	version := user.TokenVersion + 1
+	if err := users.Update(ctx, user.ID, map[string]interface{}{"deactivated_at": now, "token_version": version}); err != nil {
+		return fmt.Errorf("error deactivating user: %w", err)
 	}
+	user.DeactivatedAt = &now
+	user.TokenVersion = version
+
+	tokenVersions.Lock()
+	delete(tokenVersions.users, user.ID.Hex())
+	tokenVersions.Unlock()
+	return nil
+}
+
+// ReactivateUser lets a deactivated user sign in again. They count as
+// active from now, so the succession policy doesn't take their boards at
+// once.
+func ReactivateUser(ctx context.Context, id primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(ctx, Settings().DBTimeout)
+	defer cancel()
 
-	return &user, nil
+	if err := users.Update(ctx, id, map[string]interface{}{"deactivated_at": nil, "last_active_at": time.Now()}); err != nil {
+		return fmt.Errorf("error reactivating user: %w", err)
+	}
+	return nil
+}
+
+// updateUser sets one of the user's fields
+func updateUser(ctx context.Context, id primitive.ObjectID, field string, value interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, Settings().DBTimeout)
+	defer cancel()
+
+	err := users.Update(ctx, id, map[string]interface{}{field: value})
+	if errors.Is(err, repository.ErrNotFound) {
+		return fmt.Errorf("user with id '%s' not found", id.Hex())
+	}
+	if err != nil {
+		return fmt.Errorf("error updating user %s: %w", field, err)
+	}
+	return nil
 }
@@ -0,0 +1,179 @@
+package libs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/sarwanazhar/boardsar/backend/database"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const avatarCollection = "avatars"
+
+// ErrInvalidAvatarURL is returned for avatar URLs that are neither https
+// nor an uploaded avatar. The text is safe to return to clients.
+var ErrInvalidAvatarURL = errors.New("avatarUrl must be an https URL")
+
+func GetAvatarCollection() *mongo.Collection {
+	return database.GetCollection(avatarCollection)
+}
+
+// MaxAvatarSize is the largest avatar upload in bytes, from AVATAR_MAX_SIZE
+func MaxAvatarSize() int64 {
+	return settings.AvatarMaxSize
+}
+
+// AvatarURL is where an uploaded avatar is served from
+func AvatarURL(avatarID primitive.ObjectID) string {
+	return APIURL() + "/avatars/" + avatarID.Hex()
+}
+
+// CheckAvatarURL checks an avatar URL set directly: an https URL, or an
+// avatar uploaded before. "" is fine, and clears the avatar.
+func CheckAvatarURL(avatarURL string) error {
+	if avatarURL == "" || strings.HasPrefix(avatarURL, APIURL()+"/avatars/") {
+		return nil
+	}
+	parsed, err := url.Parse(avatarURL)
+	if err != nil || parsed.Scheme != "https" || parsed.Host == "" {
+		return ErrInvalidAvatarURL
+	}
+	return nil
+}
+
+// CreateAvatar checks that data is a supported image, stores it as the
+// user's avatar and points their avatarUrl at it. Their earlier uploads are
+// removed. The type is sniffed from the bytes.
+func CreateAvatar(ctx context.Context, userID primitive.ObjectID, data []byte) (*models.Avatar, error) {
+	contentType, _, _, err := inspectImage(data)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(data)
+	avatar := &models.Avatar{
+		ID:          primitive.NewObjectID(),
+		UserID:      userID,
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		SHA256:      hex.EncodeToString(sum[:]),
+		Storage:     DefaultAssetStorage(),
+		CreatedAt:   time.Now(),
+	}
+	avatar.Key = "avatars/" + userID.Hex() + "/" + avatar.ID.Hex()
+
+	storage, err := GetAssetStorage(avatar.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if err := storage.Put(ctx, avatar.Key, data, contentType); err != nil {
+		return nil, fmt.Errorf("error storing avatar: %w", err)
+	}
+	if _, err := GetAvatarCollection().InsertOne(ctx, avatar); err != nil {
+		if deleteErr := storage.Delete(ctx, avatar.Key); deleteErr != nil {
+			slog.Warn("Failed to delete data of unsaved avatar", "avatar_id", avatar.ID.Hex(), "error", deleteErr)
+		}
+		return nil, fmt.Errorf("error saving avatar: %w", err)
+	}
+
+	if err := updateUser(ctx, userID, "avatar_url", AvatarURL(avatar.ID)); err != nil {
+		return nil, err
+	}
+	if err := DeleteUserAvatars(ctx, userID, avatar.ID); err != nil {
+		slog.Warn("Failed to delete earlier avatars", "user_id", userID.Hex(), "error", err)
+	}
+	return avatar, nil
+}
+
+// FindAvatar loads an avatar record, or returns mongo.ErrNoDocuments
+func FindAvatar(ctx context.Context, avatarID primitive.ObjectID) (*models.Avatar, error) {
+	var avatar models.Avatar
+	if err := GetAvatarCollection().FindOne(ctx, bson.M{"_id": avatarID}).Decode(&avatar); err != nil {
+		return nil, err
+	}
+	return &avatar, nil
+}
+
+// OpenAvatar streams an avatar's bytes from the storage it was saved to
+func OpenAvatar(ctx context.Context, avatar *models.Avatar) (io.ReadCloser, error) {
+	storage, err := GetAssetStorage(avatar.Storage)
+	if err != nil {
+		return nil, err
+	}
+	return storage.Open(ctx, avatar.Key)
+}
+
+// DeleteUserAvatars removes the avatars the user uploaded and their stored
+// bytes, but for keep
+func DeleteUserAvatars(ctx context.Context, userID primitive.ObjectID, keep primitive.ObjectID) error {
+	cursor, err := GetAvatarCollection().Find(ctx, bson.M{"userId": userID, "_id": bson.M{"$ne": keep}})
+	if err != nil {
+		return err
+	}
+	var avatars []models.Avatar
+	if err := cursor.All(ctx, &avatars); err != nil {
+		return err
+	}
+	for _, avatar := range avatars {
+		storage, err := GetAssetStorage(avatar.Storage)
+		if err != nil {
+			return err
+		}
+		if err := storage.Delete(ctx, avatar.Key); err != nil {
+			return fmt.Errorf("error deleting avatar data: %w", err)
+		}
+		if _, err := GetAvatarCollection().DeleteOne(ctx, bson.M{"_id": avatar.ID}); err != nil {
+			return fmt.Errorf("error deleting avatar: %w", err)
+		}
+	}
+	return nil
+}
+
+// UpdateUserProfile sets the user's profile fields, by their BSON names
+func UpdateUserProfile(ctx context.Context, userID primitive.ObjectID, fields map[string]interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, Settings().DBTimeout)
+	defer cancel()
+
+	if err := users.Update(ctx, userID, fields); err != nil {
+		return fmt.Errorf("error updating profile: %w", err)
+	}
+	return nil
+}
+
+// UserProfile is what others sharing a board see of the user. The display
+// name falls back to the name.
+func UserProfile(user *models.User) models.Profile {
+	displayName := user.DisplayName
+	if displayName == "" {
+		displayName = user.Name
+	}
+	return models.Profile{Name: user.Name, DisplayName: displayName, AvatarURL: user.AvatarURL}
+}
+
+// UserProfiles looks up the profiles of the users with these IDs. Users
+// that no longer exist are left out.
+func UserProfiles(ctx context.Context, ids []primitive.ObjectID) (map[primitive.ObjectID]models.Profile, error) {
+	profiles := map[primitive.ObjectID]models.Profile{}
+	if len(ids) == 0 {
+		return profiles, nil
+	}
+	found, err := users.FindByIDs(ctx, ids)
+	if err != nil {
+		return nil, fmt.Errorf("error finding users: %w", err)
+	}
+	for i := range found {
+		profiles[found[i].ID] = UserProfile(&found[i])
+	}
+	return profiles, nil
+}
@@ -0,0 +1,321 @@
+package libs
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Shape fields used to keep private notes hidden until they are revealed
+const (
+	ShapeHiddenKey = "hidden"
+	ShapeAuthorKey = "authorId"
+)
+
+// BoardRole returns the user's role on the board: owner, a collaborator
+// role, or "" when the user has no access.
+func BoardRole(board *models.Board, userID primitive.ObjectID) string {
+	if board.OwnerID == userID {
+		return models.BoardRoleOwner
+	}
+	for _, collaborator := range board.SharedWith {
+		if collaborator.UserID == userID {
+			// Past a scheduled freeze, editors can only view
+			if collaborator.Role == models.CollaboratorRoleEditor && BoardFrozen(board, time.Now()) {
+				return models.CollaboratorRoleViewer
+			}
+			return collaborator.Role
+		}
+	}
+	return ""
+}
+
+// BoardCapabilities returns what the user may do on the board besides
+// viewing or editing it: everything for the owner, the collaborator's
+// capabilities, or nothing without access
+func BoardCapabilities(board *models.Board, userID primitive.ObjectID) models.Capabilities {
+	if board.OwnerID == userID {
+		return models.Capabilities{Export: true, Share: true, History: true}
+	}
+	for _, collaborator := range board.SharedWith {
+		if collaborator.UserID == userID {
+			if collaborator.Capabilities == nil {
+				return models.DefaultCapabilities
+			}
+			return *collaborator.Capabilities
+		}
+	}
+	return models.Capabilities{}
+}
+
+// HasCapability reports whether capabilities include the named one
+func HasCapability(capabilities models.Capabilities, capability string) bool {
+	switch capability {
+	case models.CapabilityExport:
+		return capabilities.Export
+	case models.CapabilityShare:
+		return capabilities.Share
+	case models.CapabilityHistory:
+		return capabilities.History
+	}
+	return false
+}
+
+// WithinCapabilities reports whether granted gives no more than held: no
+// capability held doesn't have, and comment-only if held is
+func WithinCapabilities(granted, held models.Capabilities) bool {
+	return (!granted.Export || held.Export) &&
+		(!granted.Share || held.Share) &&
+		(!granted.History || held.History) &&
+		(granted.CommentOnly || !held.CommentOnly)
+}
+
+// IsHiddenFrom reports whether a private note must not be shown to userID
+func IsHiddenFrom(shape map[string]interface{}, userID primitive.ObjectID) bool {
+	hidden, _ := shape[ShapeHiddenKey].(bool)
+	author, _ := shape[ShapeAuthorKey].(string)
+	return hidden && author != userID.Hex()
+}
+
+// VisibleBoardData returns the board state as userID may see it, without
+// other people's unrevealed notes
+func VisibleBoardData(data map[string]interface{}, userID primitive.ObjectID) map[string]interface{} {
+	list, ok := ShapeList(data)
+	if !ok {
+		return data
+	}
+
+	visible := make(map[string]interface{}, len(data))
+	for key, value := range data {
+		visible[key] = value
+	}
+
+	shapes := []interface{}{}
+	for _, item := range list {
+		if shape, ok := item.(map[string]interface{}); ok && IsHiddenFrom(shape, userID) {
+			continue
+		}
+		shapes = append(shapes, item)
+	}
+	visible["shapes"] = shapes
+	return visible
+}
+
+// ApplyPrivateNotes prepares a full-board save by userID. Notes hidden from
+// the user were never sent to them, so the stored copies are carried over
+// untouched. When the session has private notes on, notes a participant adds
+// are stamped hidden and attributed to them.
+func ApplyPrivateNotes(board *models.Board, next map[string]interface{}, userID primitive.ObjectID) {
+	list, ok := ShapeList(next)
+	if !ok {
+		return
+	}
+	current := BoardShapes(board.BoardData)
+	stamp := board.Facilitation != nil && board.Facilitation.PrivateNotes && board.OwnerID != userID
+
+	shapes := []interface{}{}
+	seen := map[string]bool{}
+	for _, item := range list {
+		shape, ok := item.(map[string]interface{})
+		if !ok {
+			shapes = append(shapes, item)
+			continue
+		}
+		id, _ := shape["id"].(string)
+		seen[id] = true
+
+		old, existed := current[id]
+		switch {
+		case existed && IsHiddenFrom(old, userID):
+			// Can't edit a note you can't see
+			shapes = append(shapes, old)
+			continue
+		case existed && old[ShapeHiddenKey] == true:
+			// The author's own note keeps its privacy flags
+			shape[ShapeHiddenKey] = true
+			shape[ShapeAuthorKey] = old[ShapeAuthorKey]
+		case !existed && stamp && IsNoteShape(shape):
+			shape[ShapeHiddenKey] = true
+			shape[ShapeAuthorKey] = userID.Hex()
+		default:
+			// Clients can't hide shapes themselves
+			delete(shape, ShapeHiddenKey)
+		}
+		shapes = append(shapes, shape)
+	}
+
+	for id, old := range current {
+		if !seen[id] && IsHiddenFrom(old, userID) {
+			shapes = append(shapes, old)
+		}
+	}
+
+	next["shapes"] = shapes
+}
+
+// RevealShapes makes every private note in a board state visible
+func RevealShapes(data map[string]interface{}) {
+	list, _ := ShapeList(data)
+	for _, item := range list {
+		if shape, ok := item.(map[string]interface{}); ok {
+			delete(shape, ShapeHiddenKey)
+		}
+	}
+}
+
+// ShapeList returns the shapes array of a board state. Boards decoded from
+// MongoDB hold it as a primitive.A rather than a plain slice.
+func ShapeList(data map[string]interface{}) ([]interface{}, bool) {
+	return toList(data["shapes"])
+}
+
+func toList(value interface{}) ([]interface{}, bool) {
+	switch list := value.(type) {
+	case []interface{}:
+		return list, true
+	case primitive.A:
+		return list, true
+	}
+	return nil, false
+}
+
+// CopyBoardData deep-copies a board state, so it can be changed while the
+// original is kept
+func CopyBoardData(data map[string]interface{}) map[string]interface{} {
+	if data == nil {
+		return nil
+	}
+	return copyValue(data).(map[string]interface{})
+}
+
+func copyValue(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(value))
+		for key, item := range value {
+			copied[key] = copyValue(item)
+		}
+		return copied
+	case primitive.M:
+		return copyValue(map[string]interface{}(value))
+	case []interface{}:
+		copied := make([]interface{}, len(value))
+		for i, item := range value {
+			copied[i] = copyValue(item)
+		}
+		return copied
+	case primitive.A:
+		return copyValue([]interface{}(value))
+	}
+	return value
+}
+
+// BoardShapes indexes the shapes of a board state by shape ID
+func BoardShapes(data map[string]interface{}) map[string]map[string]interface{} {
+	shapes := map[string]map[string]interface{}{}
+
+	list, _ := ShapeList(data)
+	for _, item := range list {
+		shape, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if id, ok := shape["id"].(string); ok {
+			shapes[id] = shape
+		}
+	}
+	return shapes
+}
+
+// ShapeNumber reads a numeric shape field, whichever numeric type it was
+// decoded as
+func ShapeNumber(shape map[string]interface{}, key string) (float64, bool) {
+	return toNumber(shape[key])
+}
+
+func toNumber(value interface{}) (float64, bool) {
+	switch value := value.(type) {
+	case float64:
+		return value, true
+	case int32:
+		return float64(value), true
+	case int64:
+		return float64(value), true
+	case int:
+		return float64(value), true
+	}
+	return 0, false
+}
+
+// IsNoteShape reports whether a shape counts as a sticky note
+func IsNoteShape(shape map[string]interface{}) bool {
+	shapeType, _ := shape["type"].(string)
+	return models.NoteShapeTypes[shapeType]
+}
+
+// CheckFacilitation compares a participant's new board state against the
+// current one and describes the first change the session doesn't allow,
+// or returns "" when every change is permitted
+func CheckFacilitation(facilitation *models.Facilitation, current, next map[string]interface{}) string {
+	if facilitation == nil {
+		return ""
+	}
+
+	before := BoardShapes(current)
+	after := BoardShapes(next)
+
+	for id, shape := range before {
+		if _, ok := after[id]; !ok {
+			if facilitation.NoDelete {
+				return fmt.Sprintf("Deleting shapes is disabled during this session (shape %s)", id)
+			}
+			if facilitation.StickyNotesOnly && !IsNoteShape(shape) {
+				return fmt.Sprintf("Only sticky notes can be changed during this session (shape %s)", id)
+			}
+		}
+	}
+
+	if facilitation.StickyNotesOnly {
+		return notesOnlyViolation(before, after, "during this session")
+	}
+
+	return ""
+}
+
+// CheckCommentOnly compares a collaborator's new board state against the
+// current one and, when they may only comment, describes the first change
+// to something other than a sticky note, or returns ""
+func CheckCommentOnly(board *models.Board, userID primitive.ObjectID, current, next map[string]interface{}) string {
+	if !BoardCapabilities(board, userID).CommentOnly {
+		return ""
+	}
+	before := BoardShapes(current)
+	after := BoardShapes(next)
+	for id, shape := range before {
+		if _, ok := after[id]; !ok && !IsNoteShape(shape) {
+			return fmt.Sprintf("Only sticky notes can be changed %s (shape %s)", commentOnlyReason, id)
+		}
+	}
+	return notesOnlyViolation(before, after, commentOnlyReason)
+}
+
+// commentOnlyReason ends the messages refusing a comment-only collaborator
+const commentOnlyReason = "with comment-only access"
+
+// notesOnlyViolation describes the first shape added or changed that isn't,
+// or wasn't, a sticky note, or returns ""
+func notesOnlyViolation(before, after map[string]map[string]interface{}, reason string) string {
+	for id, shape := range after {
+		old, existed := before[id]
+		if existed && reflect.DeepEqual(old, shape) {
+			continue
+		}
+		if !IsNoteShape(shape) || (existed && !IsNoteShape(old)) {
+			return fmt.Sprintf("Only sticky notes can be changed %s (shape %s)", reason, id)
+		}
+	}
+	return ""
+}
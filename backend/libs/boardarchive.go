@@ -0,0 +1,515 @@
+package libs
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/config"
+	"github.com/sarwanazhar/boardsar/backend/database"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Cold storage backends for archived boards, chosen with
+// BOARD_ARCHIVE_STORAGE. Each archived board records the backend it went
+// to, so switching keeps older archives readable.
+const (
+	BoardArchiveMongo = config.ArchiveStorageMongo
+	BoardArchiveS3    = config.ArchiveStorageS3
+)
+
+// boardArchiveCollection holds archived contents in the mongo backend
+const boardArchiveCollection = "board_archive"
+
+// boardArchivePrefix is where archived contents go in the S3 bucket, next
+// to assets
+const boardArchivePrefix = "board-archive/"
+
+const (
+	// boardArchiveBatch is how many boards the archiver looks at per query
+	boardArchiveBatch   = 100
+	boardArchiveTimeout = 30 * time.Second
+)
+
+// Counted since the process started, for the storage metrics
+var boardArchiveCounters struct {
+	archived        atomic.Int64
+	rehydrated      atomic.Int64
+	rehydrateMillis atomic.Int64
+}
+
+// boardArchiveMonths is how many months a board must go unsaved and
+// unopened before it is archived: BOARD_ARCHIVE_AFTER_MONTHS, 0 (never)
+// by default
+func boardArchiveMonths() int {
+	return settings.BoardArchiveMonths
+}
+
+// BoardArchivingConfigured reports whether idle boards are moved to cold
+// storage
+func BoardArchivingConfigured() bool {
+	return boardArchiveMonths() > 0
+}
+
+// DefaultBoardArchiveStorage names the backend boards are archived to:
+// BOARD_ARCHIVE_STORAGE, MongoDB by default
+func DefaultBoardArchiveStorage() string {
+	return settings.BoardArchiveStorage
+}
+
+// getBoardArchiveStorage returns the named cold storage backend. S3 shares
+// the asset bucket and credentials.
+func getBoardArchiveStorage(name string) (AssetStorage, error) {
+	switch name {
+	case BoardArchiveMongo:
+		return mongoBoardArchive{}, nil
+	case BoardArchiveS3:
+		storage, err := newS3AssetStorage()
+		if err != nil {
+			return nil, err
+		}
+		return prefixedStorage{storage, boardArchivePrefix}, nil
+	}
+	return nil, fmt.Errorf("unknown board archive storage %q", name)
+}
+
+// mongoBoardArchive keeps archived contents in their own collection, out
+// of the working set of the boards collection
+type mongoBoardArchive struct{}
+
+func (mongoBoardArchive) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	_, err := database.GetCollection(boardArchiveCollection).InsertOne(ctx, bson.M{
+		"_id":       key,
+		"data":      data,
+		"createdAt": time.Now(),
+	})
+	return err
+}
+
+func (mongoBoardArchive) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	var doc struct {
+		Data []byte `bson:"data"`
+	}
+	err := database.GetCollection(boardArchiveCollection).FindOne(ctx, bson.M{"_id": key}).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrAssetDataNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(doc.Data)), nil
+}
+
+func (mongoBoardArchive) Delete(ctx context.Context, key string) error {
+	_, err := database.GetCollection(boardArchiveCollection).DeleteOne(ctx, bson.M{"_id": key})
+	return err
+}
+
+// prefixedStorage keeps its keys under a prefix of another storage
+type prefixedStorage struct {
+	storage AssetStorage
+	prefix  string
+}
+
+func (s prefixedStorage) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	return s.storage.Put(ctx, s.prefix+key, data, contentType)
+}
+
+func (s prefixedStorage) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	return s.storage.Open(ctx, s.prefix+key)
+}
+
+func (s prefixedStorage) Delete(ctx context.Context, key string) error {
+	return s.storage.Delete(ctx, s.prefix+key)
+}
+
+// RunBoardArchiver archives boards nobody has saved or opened for
+// BOARD_ARCHIVE_AFTER_MONTHS, every BOARD_ARCHIVE_INTERVAL until ctx is
+// done
+func RunBoardArchiver(ctx context.Context) {
+	ticker := time.NewTicker(settings.Intervals.BoardArchive)
+	defer ticker.Stop()
+
+	for {
+		if err := archiveIdleBoards(ctx); err != nil && ctx.Err() == nil {
+			slog.Warn("Failed to archive idle boards", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// archiveIdleBoards archives idle boards, oldest first, until none are left
+// or one fails
+func archiveIdleBoards(ctx context.Context) error {
+	cutoff := time.Now().AddDate(0, -boardArchiveMonths(), 0)
+	filter := bson.M{
+		"archived":  bson.M{"$exists": false},
+		"updatedAt": bson.M{"$lt": cutoff},
+		"$and": bson.A{
+			bson.M{"$or": bson.A{
+				bson.M{"board": bson.M{"$exists": true}},
+				bson.M{"boardZstd": bson.M{"$exists": true}},
+			}},
+			bson.M{"$or": bson.A{
+				bson.M{"lastOpenedAt": bson.M{"$exists": false}},
+				bson.M{"lastOpenedAt": bson.M{"$lt": cutoff}},
+			}},
+		},
+	}
+	opts := options.Find().
+		SetProjection(bson.M{"_id": 1}).
+		SetSort(bson.D{{Key: "updatedAt", Value: 1}}).
+		SetLimit(boardArchiveBatch)
+
+	for ctx.Err() == nil {
+		cursor, err := database.GetCollection("boards").Find(ctx, filter, opts)
+		if err != nil {
+			return err
+		}
+		var boards []models.Board
+		if err := cursor.All(ctx, &boards); err != nil {
+			return err
+		}
+
+		for _, board := range boards {
+			if err := ArchiveBoard(ctx, board.ID); err != nil {
+				return fmt.Errorf("board %s: %w", board.ID.Hex(), err)
+			}
+		}
+		if len(boards) < boardArchiveBatch {
+			return nil
+		}
+	}
+	return ctx.Err()
+}
+
+// ArchiveBoard compresses a board's contents into cold storage and drops
+// them, and its shape index, from the database. A board saved meanwhile is
+// left as it is.
+func ArchiveBoard(ctx context.Context, boardID primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(ctx, boardArchiveTimeout)
+	defer cancel()
+
+	boards := database.GetCollection("boards")
+	var board struct {
+		Version   int64     `bson:"version"`
+		UpdatedAt time.Time `bson:"updatedAt"`
+		BoardSize int64     `bson:"boardSize"`
+	}
+	opts := options.FindOne().SetProjection(bson.M{
+		"version": 1, "updatedAt": 1, "board": 1, "boardZstd": 1, "boardEncoding": 1, "boardSize": 1,
+	})
+	raw, err := boards.FindOne(ctx, bson.M{"_id": boardID, "archived": bson.M{"$exists": false}}, opts).Raw()
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err == nil {
+		err = bson.Unmarshal(raw, &board)
+	}
+	if err != nil {
+		return err
+	}
+
+	// The contents are kept as BSON, in whichever encoding they were stored,
+	// so they come back exactly as they were
+	elements, err := raw.Elements()
+	if err != nil {
+		return err
+	}
+	stored := bson.D{}
+	for _, element := range elements {
+		switch element.Key() {
+		case "board", "boardZstd", "boardEncoding", "boardSize":
+			stored = append(stored, bson.E{Key: element.Key(), Value: element.Value()})
+		}
+	}
+	if len(stored) == 0 {
+		return nil
+	}
+	contents, err := bson.Marshal(stored)
+	if err != nil {
+		return err
+	}
+	size := int64(len(contents))
+	if board.BoardSize > 0 {
+		size = board.BoardSize
+	}
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	if _, err := writer.Write(contents); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	archive := models.BoardArchive{
+		Storage: DefaultBoardArchiveStorage(),
+		// Unique per attempt, so a racing archiver can't clean up ours
+		Key:            boardID.Hex() + "/" + primitive.NewObjectID().Hex(),
+		Size:           size,
+		CompressedSize: int64(compressed.Len()),
+		ArchivedAt:     time.Now(),
+	}
+	storage, err := getBoardArchiveStorage(archive.Storage)
+	if err != nil {
+		return err
+	}
+	if err := storage.Put(ctx, archive.Key, compressed.Bytes(), "application/gzip"); err != nil {
+		return fmt.Errorf("error storing contents: %w", err)
+	}
+
+	result, err := boards.UpdateOne(ctx,
+		bson.M{
+			"_id":       boardID,
+			"version":   board.Version,
+			"updatedAt": board.UpdatedAt,
+			"archived":  bson.M{"$exists": false},
+		},
+		bson.M{
+			"$set":   bson.M{"archived": archive},
+			"$unset": bson.M{"board": "", "boardZstd": "", "boardEncoding": "", "boardSize": "", "shapeIndex": ""},
+		},
+	)
+	if err != nil || result.MatchedCount == 0 {
+		if deleteErr := storage.Delete(ctx, archive.Key); deleteErr != nil {
+			slog.Warn("Failed to remove unused archive of board", "board_id", boardID.Hex(), "error", deleteErr)
+		}
+		return err
+	}
+	InvalidateBoard(ctx, boardID)
+
+	if _, err := GetShapeIndexCollection().DeleteMany(ctx, bson.M{"boardId": boardID}); err != nil {
+		slog.Warn("Failed to remove shape index of archived board", "board_id", boardID.Hex(), "error", err)
+	}
+	ForgetShapeTree(boardID)
+	boardArchiveCounters.archived.Add(1)
+	slog.Info("Archived board", "board_id", boardID.Hex(), "storage", archive.Storage, "size", archive.Size, "compressed_size", archive.CompressedSize)
+	return nil
+}
+
+// RehydrateBoards brings the contents of the archived boards matching
+// filter back from cold storage. Boards that aren't archived cost one
+// indexed lookup.
+func RehydrateBoards(ctx context.Context, filter bson.M) error {
+	query := bson.M{"archived": bson.M{"$exists": true}}
+	for key, value := range filter {
+		query[key] = value
+	}
+
+	cursor, err := database.GetCollection("boards").Find(ctx, query,
+		options.Find().SetProjection(bson.M{"archived": 1}))
+	if err != nil {
+		return err
+	}
+	var boards []models.Board
+	if err := cursor.All(ctx, &boards); err != nil {
+		return err
+	}
+
+	for _, board := range boards {
+		if err := rehydrateBoard(ctx, board.ID, board.Archived); err != nil {
+			return fmt.Errorf("error rehydrating board %s: %w", board.ID.Hex(), err)
+		}
+	}
+	return nil
+}
+
+func rehydrateBoard(ctx context.Context, boardID primitive.ObjectID, archive *models.BoardArchive) error {
+	start := time.Now()
+	boards := database.GetCollection("boards")
+	archived := bson.M{"_id": boardID, "archived.key": archive.Key}
+
+	storage, err := getBoardArchiveStorage(archive.Storage)
+	if err != nil {
+		return err
+	}
+	reader, err := storage.Open(ctx, archive.Key)
+	if err == ErrAssetDataNotFound {
+		// Rehydrated by another request in the meantime
+		if count, err := boards.CountDocuments(ctx, archived); err != nil || count > 0 {
+			return fmt.Errorf("archived contents are missing")
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	unzipped, err := gzip.NewReader(reader)
+	if err != nil {
+		return err
+	}
+	contents, err := io.ReadAll(unzipped)
+	if err != nil {
+		return err
+	}
+	elements, err := bson.Raw(contents).Elements()
+	if err != nil {
+		return fmt.Errorf("invalid archive: %w", err)
+	}
+	if len(elements) == 0 {
+		return fmt.Errorf("invalid archive: no contents")
+	}
+	set := bson.M{"lastOpenedAt": time.Now()}
+	for _, element := range elements {
+		set[element.Key()] = element.Value()
+	}
+
+	// Contents written since (say, by a realtime session that outlived the
+	// archiving) win over the archived ones
+	result, err := boards.UpdateOne(ctx,
+		bson.M{
+			"_id":          boardID,
+			"archived.key": archive.Key,
+			"board":        bson.M{"$exists": false},
+			"boardZstd":    bson.M{"$exists": false},
+		},
+		bson.M{
+			"$set":   set,
+			"$unset": bson.M{"archived": ""},
+		},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		result, err = boards.UpdateOne(ctx, archived, bson.M{"$unset": bson.M{"archived": ""}})
+		if err != nil {
+			return err
+		}
+	}
+	if result.MatchedCount == 0 {
+		return nil
+	}
+	InvalidateBoard(ctx, boardID)
+
+	if err := storage.Delete(ctx, archive.Key); err != nil {
+		slog.Warn("Failed to remove archive of rehydrated board", "board_id", boardID.Hex(), "error", err)
+	}
+	elapsed := time.Since(start)
+	boardArchiveCounters.rehydrated.Add(1)
+	boardArchiveCounters.rehydrateMillis.Add(elapsed.Milliseconds())
+	slog.Info("Rehydrated board", "board_id", boardID.Hex(), "storage", archive.Storage, "elapsed", elapsed)
+	return nil
+}
+
+// DeleteBoardArchive removes the archived contents of a deleted board from
+// cold storage
+func DeleteBoardArchive(ctx context.Context, archive *models.BoardArchive) error {
+	storage, err := getBoardArchiveStorage(archive.Storage)
+	if err != nil {
+		return err
+	}
+	return storage.Delete(ctx, archive.Key)
+}
+
+// RehydrateBoardMiddleware brings the route's :boardId back from cold
+// storage, if it was archived, before the handler loads it
+func RehydrateBoardMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		boardID := c.Param("boardId")
+		if boardID == "" {
+			c.Next()
+			return
+		}
+
+		filter := bson.M{"boardId": boardID}
+		if objectID, err := primitive.ObjectIDFromHex(boardID); err == nil {
+			filter = bson.M{"_id": objectID}
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), boardArchiveTimeout)
+		err := RehydrateBoards(ctx, filter)
+		cancel()
+		if err != nil {
+			RequestLogger(c).Error("Failed to rehydrate board", "board_id", boardID, "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load archived board. Please try again later."})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// BoardArchiveUsage is what the boards archived to one backend take
+type BoardArchiveUsage struct {
+	Storage        string `json:"storage" bson:"_id"`
+	Boards         int64  `json:"boards" bson:"boards"`
+	Size           int64  `json:"size" bson:"size"`                     // Contents before compression
+	CompressedSize int64  `json:"compressedSize" bson:"compressedSize"` // Contents as stored
+}
+
+// BoardArchiveStats reports how much archiving saves
+type BoardArchiveStats struct {
+	Enabled     bool                `json:"enabled"`
+	AfterMonths int                 `json:"afterMonths"`
+	Storage     string              `json:"storage"` // Where boards are archived to now
+	Backends    []BoardArchiveUsage `json:"backends"`
+	Boards      int64               `json:"boards"`
+	// Bytes taken out of the boards collection, and how much less they
+	// take in cold storage
+	Size           int64 `json:"size"`
+	CompressedSize int64 `json:"compressedSize"`
+	SavedBytes     int64 `json:"savedBytes"`
+	// Since this instance started
+	ArchivedSinceStart   int64   `json:"archivedSinceStart"`
+	RehydratedSinceStart int64   `json:"rehydratedSinceStart"`
+	AverageRehydrateMs   float64 `json:"averageRehydrateMs"`
+}
+
+// GetBoardArchiveStats totals the archived boards by backend
+func GetBoardArchiveStats(ctx context.Context) (*BoardArchiveStats, error) {
+	cursor, err := database.GetCollection("boards").Aggregate(ctx, bson.A{
+		bson.M{"$match": bson.M{"archived": bson.M{"$exists": true}}},
+		bson.M{"$group": bson.M{
+			"_id":            "$archived.storage",
+			"boards":         bson.M{"$sum": 1},
+			"size":           bson.M{"$sum": "$archived.size"},
+			"compressedSize": bson.M{"$sum": "$archived.compressedSize"},
+		}},
+		bson.M{"$sort": bson.M{"_id": 1}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &BoardArchiveStats{
+		Enabled:              BoardArchivingConfigured(),
+		AfterMonths:          boardArchiveMonths(),
+		Storage:              DefaultBoardArchiveStorage(),
+		Backends:             []BoardArchiveUsage{},
+		ArchivedSinceStart:   boardArchiveCounters.archived.Load(),
+		RehydratedSinceStart: boardArchiveCounters.rehydrated.Load(),
+	}
+	if err := cursor.All(ctx, &stats.Backends); err != nil {
+		return nil, err
+	}
+	for _, usage := range stats.Backends {
+		stats.Boards += usage.Boards
+		stats.Size += usage.Size
+		stats.CompressedSize += usage.CompressedSize
+	}
+	stats.SavedBytes = stats.Size - stats.CompressedSize
+	if stats.RehydratedSinceStart > 0 {
+		stats.AverageRehydrateMs = float64(boardArchiveCounters.rehydrateMillis.Load()) / float64(stats.RehydratedSinceStart)
+	}
+	return stats, nil
+}
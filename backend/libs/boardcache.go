@@ -0,0 +1,205 @@
+package libs
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// GetBoard reads boards through a cache in Redis, shared by every instance,
+// when REDIS_URL is set and BOARD_CACHE_TTL isn't 0. Boards are kept as
+// stored in MongoDB (large ones compressed), and a boardId is remembered as
+// the _id it names. Every write to a board invalidates its entry by
+// leaving a short-lived tombstone in its place, so a read that started
+// before the write can't put the old board back.
+
+// boardCacheTimeout bounds a Redis round trip; on failure the board is read
+// from the database
+const boardCacheTimeout = 250 * time.Millisecond
+
+// maxCachedBoard is the largest stored board worth caching
+const maxCachedBoard = 8 << 20
+
+var (
+	boardCacheOnce   sync.Once
+	boardCacheClient *redisClient
+
+	boardCacheHits          atomic.Int64
+	boardCacheMisses        atomic.Int64
+	boardCacheErrors        atomic.Int64
+	boardCacheInvalidations atomic.Int64
+)
+
+// BoardCacheStats counts what the board cache did on this instance since it
+// started
+type BoardCacheStats struct {
+	Enabled       bool   `json:"enabled"`
+	TTL           string `json:"ttl"`
+	RefTTL        string `json:"refTtl"`
+	Hits          int64  `json:"hits"`
+	Misses        int64  `json:"misses"`
+	Errors        int64  `json:"errors"` // Redis failures, answered from the database
+	Invalidations int64  `json:"invalidations"`
+}
+
+// GetBoardCacheStats reports the board cache's hits, misses and failures
+func GetBoardCacheStats() BoardCacheStats {
+	return BoardCacheStats{
+		Enabled:       getBoardCache() != nil,
+		TTL:           settings.BoardCacheTTL.String(),
+		RefTTL:        settings.BoardRefTTL.String(),
+		Hits:          boardCacheHits.Load(),
+		Misses:        boardCacheMisses.Load(),
+		Errors:        boardCacheErrors.Load(),
+		Invalidations: boardCacheInvalidations.Load(),
+	}
+}
+
+// getBoardCache returns the Redis client boards are cached in, or nil when
+// the cache is off
+func getBoardCache() *redisClient {
+	boardCacheOnce.Do(func() {
+		if settings.RedisURL == "" || settings.BoardCacheTTL == 0 {
+			return
+		}
+		client, err := newRedisClient(settings.RedisURL)
+		if err != nil {
+			slog.Warn("Boards are not cached", "error", err)
+			return
+		}
+		boardCacheClient = client
+	})
+	return boardCacheClient
+}
+
+func boardCacheKey(id primitive.ObjectID) string {
+	return "board:" + id.Hex()
+}
+
+func boardRefCacheKey(ref string) string {
+	return "board-ref:" + ref
+}
+
+// CachedBoard returns the board ref names from the cache, whoever may see
+// it. ok is false on a miss, and whenever the cache can't answer.
+func CachedBoard(ctx context.Context, ref string) (board *models.Board, ok bool) {
+	client := getBoardCache()
+	if client == nil {
+		return nil, false
+	}
+	ctx, cancel := context.WithTimeout(ctx, boardCacheTimeout)
+	defer cancel()
+
+	id, err := primitive.ObjectIDFromHex(ref)
+	if err != nil {
+		reply, err := client.do(ctx, "GET", boardRefCacheKey(ref))
+		hex, _ := reply.(string)
+		if err == nil {
+			id, err = primitive.ObjectIDFromHex(hex)
+		}
+		if err != nil || reply == nil {
+			boardCacheMiss(err, reply == nil)
+			return nil, false
+		}
+	}
+
+	reply, err := client.do(ctx, "GET", boardCacheKey(id))
+	raw, _ := reply.(string)
+	if err != nil || raw == "" {
+		// An empty entry is a tombstone left by a write
+		boardCacheMiss(err, true)
+		return nil, false
+	}
+	board = &models.Board{}
+	if err := bson.Unmarshal([]byte(raw), board); err != nil {
+		boardCacheMiss(err, false)
+		return nil, false
+	}
+	boardCacheHits.Add(1)
+	return board, true
+}
+
+// boardCacheMiss counts a miss, and a failure when the cache didn't answer
+func boardCacheMiss(err error, missing bool) {
+	boardCacheMisses.Add(1)
+	if err != nil || !missing {
+		boardCacheErrors.Add(1)
+		if err == nil {
+			err = errors.New("unexpected cache entry")
+		}
+		logBoardCacheError(err)
+	}
+}
+
+// CacheBoard keeps a board read from the database, unless a write since
+// left a tombstone in its place
+func CacheBoard(ctx context.Context, board *models.Board) {
+	client := getBoardCache()
+	if client == nil {
+		return
+	}
+	raw, err := bson.Marshal(board)
+	if err != nil || len(raw) > maxCachedBoard {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, boardCacheTimeout)
+	defer cancel()
+
+	ttl := strconv.FormatInt(settings.BoardCacheTTL.Milliseconds(), 10)
+	if _, err := client.do(ctx, "SET", boardCacheKey(board.ID), string(raw), "PX", ttl, "NX"); err != nil {
+		boardCacheErrors.Add(1)
+		logBoardCacheError(err)
+		return
+	}
+	if board.BoardID != "" && settings.BoardRefTTL > 0 {
+		refTTL := strconv.FormatInt(settings.BoardRefTTL.Milliseconds(), 10)
+		if _, err := client.do(ctx, "SET", boardRefCacheKey(board.BoardID), board.ID.Hex(), "PX", refTTL); err != nil {
+			boardCacheErrors.Add(1)
+			logBoardCacheError(err)
+		}
+	}
+}
+
+// InvalidateBoard drops a board from the cache after a write. The tombstone
+// left in its place outlives any database read started before the write,
+// which could otherwise cache the board as it was.
+func InvalidateBoard(ctx context.Context, id primitive.ObjectID) {
+	client := getBoardCache()
+	if client == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), boardCacheTimeout)
+	defer cancel()
+
+	ttl := strconv.FormatInt(max(settings.DBTimeout, time.Second).Milliseconds(), 10)
+	if _, err := client.do(ctx, "SET", boardCacheKey(id), "", "PX", ttl); err != nil {
+		boardCacheErrors.Add(1)
+		logBoardCacheError(err)
+		return
+	}
+	boardCacheInvalidations.Add(1)
+}
+
+// boardCacheErrorLog keeps a failing Redis from flooding the log
+var boardCacheErrorLog = struct {
+	sync.Mutex
+	last time.Time
+}{}
+
+func logBoardCacheError(err error) {
+	boardCacheErrorLog.Lock()
+	defer boardCacheErrorLog.Unlock()
+	if time.Since(boardCacheErrorLog.last) < time.Minute {
+		return
+	}
+	boardCacheErrorLog.last = time.Now()
+	slog.Warn("Board cache", "error", err)
+}
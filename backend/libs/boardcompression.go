@@ -0,0 +1,90 @@
+package libs
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"github.com/sarwanazhar/boardsar/backend/repository"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// BoardContentsProjection leaves a board's contents out of a query, in
+// either encoding
+var BoardContentsProjection = bson.M{"board": 0, "boardZstd": 0}
+
+// ConfigureBoardCompression sets the BSON size from which board contents
+// are compressed, from BOARD_COMPRESSION and BOARD_COMPRESSION_MIN_BYTES.
+// Smaller boards gain little, and stay editable in place. Boards are only
+// compressed as they are written; existing ones are converted with
+// cmd/compressboards.
+func ConfigureBoardCompression() {
+	models.BoardCompressionThreshold.Store(settings.BoardCompressionMinBytes)
+}
+
+// BoardCompressionReport sums up a run of RecompressBoards
+type BoardCompressionReport struct {
+	Scanned   int   // Boards looked at
+	Converted int   // Boards rewritten in the other encoding
+	Skipped   int   // Boards saved while being converted, left as they were
+	Before    int64 // Stored size of the converted boards' contents before
+	After     int64 // and after
+}
+
+// RecompressBoards rewrites the boards in boards in the encoding they'd be
+// written in now: boards past the compression threshold are compressed,
+// and with decompress every compressed board is stored as a document
+// again. Boards saved meanwhile are skipped; their save already used the
+// current encoding. With dryRun nothing is written.
+func RecompressBoards(ctx context.Context, boards repository.BoardRepository, decompress, dryRun bool, progress func(BoardCompressionReport)) (BoardCompressionReport, error) {
+	var report BoardCompressionReport
+	threshold := models.BoardCompressionThreshold.Load()
+	if !decompress && threshold == 0 {
+		return report, nil
+	}
+
+	ids, err := boards.ListToReencode(ctx, decompress, threshold)
+	if err != nil {
+		return report, err
+	}
+
+	for _, id := range ids {
+		report.Scanned++
+
+		board, err := boards.FindByID(ctx, id)
+		if errors.Is(err, repository.ErrNotFound) {
+			continue
+		} else if err != nil {
+			return report, err
+		}
+		before, after, err := models.CompressedBoardSizes(board.BoardData)
+		if err != nil {
+			return report, err
+		}
+		if decompress {
+			before, after = after, before
+		}
+
+		if !dryRun {
+			ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+			err := boards.Reencode(ctx, board, decompress)
+			cancel()
+			if errors.Is(err, repository.ErrVersionConflict) {
+				report.Skipped++
+				continue
+			}
+			if err != nil {
+				return report, err
+			}
+		}
+
+		report.Converted++
+		report.Before += before
+		report.After += after
+		if progress != nil && report.Converted%100 == 0 {
+			progress(report)
+		}
+	}
+	return report, nil
+}
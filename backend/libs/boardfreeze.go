@@ -0,0 +1,98 @@
+package libs
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/sarwanazhar/boardsar/backend/database"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const boardFreezeBatch = 100
+
+// BoardFrozen reports whether the board's scheduled freeze has come. The
+// write paths check the time themselves rather than wait for the scheduler.
+func BoardFrozen(board *models.Board, now time.Time) bool {
+	return board.Freeze != nil && !now.Before(board.Freeze.At)
+}
+
+// FreezeStatus is the countdown to a scheduled freeze, or nil without one
+func FreezeStatus(freeze *models.BoardFreeze, now time.Time) *models.BoardFreezeStatus {
+	if freeze == nil {
+		return nil
+	}
+	status := &models.BoardFreezeStatus{At: freeze.At, Frozen: !now.Before(freeze.At)}
+	if !status.Frozen {
+		// Rounded up, so the countdown only reads 0 once frozen
+		status.SecondsLeft = int64((freeze.At.Sub(now) + time.Second - 1) / time.Second)
+	}
+	return status
+}
+
+// RunBoardFreezer freezes boards as their scheduled time comes, every
+// BOARD_FREEZE_INTERVAL until ctx is done, and calls frozen with each so
+// live sessions turn read-only
+func RunBoardFreezer(ctx context.Context, frozen func(boardID primitive.ObjectID)) {
+	ticker := time.NewTicker(settings.Intervals.BoardFreeze)
+	defer ticker.Stop()
+
+	for {
+		if err := freezeDueBoards(ctx, frozen); err != nil && ctx.Err() == nil {
+			slog.Warn("Failed to freeze boards", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// freezeDueBoards marks the boards whose freeze has come as frozen. Only
+// the instance that marks a board reports it.
+func freezeDueBoards(ctx context.Context, frozen func(boardID primitive.ObjectID)) error {
+	boards := database.GetCollection("boards")
+	filter := bson.M{
+		"freeze.at":       bson.M{"$lte": time.Now()},
+		"freeze.frozenAt": bson.M{"$exists": false},
+	}
+	opts := options.Find().SetProjection(bson.M{"freeze": 1}).SetLimit(boardFreezeBatch)
+
+	for ctx.Err() == nil {
+		cursor, err := boards.Find(ctx, filter, opts)
+		if err != nil {
+			return err
+		}
+		var due []models.Board
+		if err := cursor.All(ctx, &due); err != nil {
+			return err
+		}
+
+		for _, board := range due {
+			result, err := boards.UpdateOne(ctx,
+				bson.M{"_id": board.ID, "freeze.at": board.Freeze.At, "freeze.frozenAt": bson.M{"$exists": false}},
+				bson.M{"$set": bson.M{"freeze.frozenAt": time.Now()}},
+			)
+			if err != nil {
+				return err
+			}
+			if result.ModifiedCount == 0 {
+				// Rescheduled, lifted or frozen by another instance
+				continue
+			}
+			InvalidateBoard(ctx, board.ID)
+			RefreshBoardSummary(ctx, board.ID, nil)
+			frozen(board.ID)
+			slog.Info("Froze board", "board_id", board.ID.Hex(), "scheduled_for", board.Freeze.At)
+		}
+		if len(due) < boardFreezeBatch {
+			return nil
+		}
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,118 @@
+package libs
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// MaxDocumentBytes is MongoDB's limit on the size of one document, and
+	// so on one board
+	MaxDocumentBytes = 16 * 1024 * 1024
+
+	// highResImageBytes is the embedded image size counted as high-res
+	highResImageBytes = 1024 * 1024
+
+	// maxHighResImages is how many high-res images a board can hold before
+	// it is warned about
+	maxHighResImages = 10
+
+	// maxHealthyShapes is the shape count past which editing a board slows
+	// down noticeably
+	maxHealthyShapes = 5000
+)
+
+// BoardHealth measures a stored board. Storage usage and the version count
+// come from the caller, which has them from their own queries.
+func BoardHealth(board *models.Board, storage int64, versions int64) models.BoardHealth {
+	health := models.BoardHealth{
+		ShapeTypes:    map[string]int{},
+		DocumentLimit: MaxDocumentBytes,
+		StorageBytes:  storage,
+		StorageLimit:  GetQuotaLimits().StorageBytes,
+		Versions:      versions,
+		VersionLimit:  boardVersionRetention(),
+		Warnings:      []string{},
+	}
+	if raw, err := bson.Marshal(board); err == nil {
+		health.DocumentBytes = int64(len(raw))
+	}
+
+	list, _ := ShapeList(board.BoardData)
+	for _, item := range list {
+		shape, ok := toMap(item)
+		if !ok {
+			continue
+		}
+		health.Shapes++
+		shapeType, _ := shape["type"].(string)
+		health.ShapeTypes[shapeType]++
+		if hasText(shape) {
+			health.Texts++
+		}
+		for _, value := range shape {
+			size, ok := embeddedImageBytes(value)
+			if !ok {
+				continue
+			}
+			health.Images++
+			health.AssetBytes += size
+			if size >= highResImageBytes {
+				health.HighResImages++
+			}
+		}
+	}
+
+	if float64(health.DocumentBytes) >= float64(MaxDocumentBytes)*QuotaWarningThreshold {
+		health.Warnings = append(health.Warnings, fmt.Sprintf("The board uses %d%% of the largest size it can be saved at; split it before it fills up", health.DocumentBytes*100/MaxDocumentBytes))
+	}
+	if health.StorageLimit > 0 && float64(storage) >= float64(health.StorageLimit)*QuotaWarningThreshold {
+		health.Warnings = append(health.Warnings, fmt.Sprintf("The owner is using %d%% of their storage", storage*100/health.StorageLimit))
+	}
+	if health.HighResImages >= maxHighResImages {
+		health.Warnings = append(health.Warnings, fmt.Sprintf("The board embeds %d high-resolution images; shrinking them would keep it fast", health.HighResImages))
+	}
+	if health.Shapes > maxHealthyShapes {
+		health.Warnings = append(health.Warnings, fmt.Sprintf("The board has %d shapes; boards over %d get slow to edit", health.Shapes, maxHealthyShapes))
+	}
+	return health
+}
+
+// CountBoardVersions counts the versions in a board's history
+func CountBoardVersions(ctx context.Context, boardID primitive.ObjectID) (int64, error) {
+	return GetBoardVersionCollection().CountDocuments(ctx, bson.M{"boardId": boardID})
+}
+
+func hasText(shape map[string]interface{}) bool {
+	for _, field := range LintTextFields {
+		if text, _ := shape[field].(string); strings.TrimSpace(text) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// embeddedImageBytes reports the decoded size of an image embedded as a
+// data URL
+func embeddedImageBytes(value interface{}) (int64, bool) {
+	url, ok := value.(string)
+	if !ok || !strings.HasPrefix(url, "data:image/") {
+		return 0, false
+	}
+	comma := strings.IndexByte(url, ',')
+	if comma < 0 {
+		return 0, false
+	}
+	payload := url[comma+1:]
+	if strings.HasSuffix(url[:comma], ";base64") {
+		padding := len(payload) - len(strings.TrimRight(payload, "="))
+		return int64(base64.StdEncoding.DecodedLen(len(payload)) - padding), true
+	}
+	return int64(len(payload)), true
+}
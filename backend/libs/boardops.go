@@ -0,0 +1,186 @@
+package libs
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ApplyBoardOperation applies op to a board state in place. The shape fields
+// it sets are checked as ValidateBoardData checks them, and shapes of custom
+// types must stay valid; a rejected operation leaves the state untouched.
+func ApplyBoardOperation(data map[string]interface{}, op models.BoardOperation) error {
+	shapes, _ := ShapeList(data)
+
+	switch op.Op {
+	case models.OpAddShape:
+		id, _ := op.Shape["id"].(string)
+		if id == "" {
+			return fmt.Errorf("shape id is required")
+		}
+		if findShape(shapes, id) >= 0 {
+			return fmt.Errorf("shape %s already exists", id)
+		}
+		if err := checkShapeFields(op.Shape, false, id); err != nil {
+			return err
+		}
+		if err := ValidateShape(op.Shape); err != nil {
+			return err
+		}
+		data["shapes"] = append(shapes, op.Shape)
+
+	case models.OpUpdateShape:
+		i := findShape(shapes, op.ID)
+		if i < 0 {
+			return fmt.Errorf("shape %s not found", op.ID)
+		}
+		if err := checkShapeFields(op.Shape, true, op.ID); err != nil {
+			return err
+		}
+		shape := shapes[i].(map[string]interface{})
+		merged := make(map[string]interface{}, len(shape)+len(op.Shape))
+		for key, value := range shape {
+			merged[key] = value
+		}
+		for key, value := range op.Shape {
+			if key != "id" {
+				merged[key] = value
+			}
+		}
+		// Custom shape types are checked as they'd be stored
+		if err := ValidateShape(merged); err != nil {
+			return err
+		}
+		for key, value := range merged {
+			shape[key] = value
+		}
+
+	case models.OpDeleteShape:
+		i := findShape(shapes, op.ID)
+		if i < 0 {
+			return fmt.Errorf("shape %s not found", op.ID)
+		}
+		data["shapes"] = append(shapes[:i:i], shapes[i+1:]...)
+
+	case models.OpSetScale:
+		if op.Scale == nil || *op.Scale <= 0 {
+			return fmt.Errorf("scale must be positive")
+		}
+		data["scale"] = *op.Scale
+
+	case models.OpSetPosition:
+		if op.Position == nil {
+			return fmt.Errorf("position is required")
+		}
+		data["position"] = map[string]interface{}{
+			"x": op.Position["x"],
+			"y": op.Position["y"],
+		}
+
+	default:
+		return fmt.Errorf("unknown operation %q", op.Op)
+	}
+
+	return nil
+}
+
+func findShape(shapes []interface{}, id string) int {
+	for i, item := range shapes {
+		if shape, ok := item.(map[string]interface{}); ok && shape["id"] == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// FindShape returns the shape with the given ID, or nil.
+func FindShape(data map[string]interface{}, id string) map[string]interface{} {
+	shapes, _ := ShapeList(data)
+	if i := findShape(shapes, id); i >= 0 {
+		return shapes[i].(map[string]interface{})
+	}
+	return nil
+}
+
+// PrepareOperation checks an operation by userID against the board's
+// freeze, locked sections, facilitated session and private notes, and
+// stamps new private notes. It returns a description of why the operation
+// is not allowed, or "".
+func PrepareOperation(board *models.Board, op *models.BoardOperation, userID primitive.ObjectID) string {
+	// Privacy markers are managed by the server only
+	delete(op.Shape, ShapeHiddenKey)
+	delete(op.Shape, ShapeAuthorKey)
+
+	isOwner := board.OwnerID == userID
+	facilitation := board.Facilitation
+
+	// Realtime clients keep the role they joined with, so the freeze is
+	// checked here too
+	if !isOwner && BoardFrozen(board, time.Now()) {
+		return "The board is frozen; only its owner can change it"
+	}
+
+	var target map[string]interface{}
+	if op.Op == models.OpUpdateShape || op.Op == models.OpDeleteShape {
+		target = FindShape(board.BoardData, op.ID)
+		if target != nil && IsHiddenFrom(target, userID) {
+			return fmt.Sprintf("shape %s not found", op.ID)
+		}
+	}
+
+	if violation := sectionLockViolation(board.Sections, op, target); violation != "" {
+		return violation
+	}
+
+	if !isOwner && BoardCapabilities(board, userID).CommentOnly {
+		if violation := noteOperationViolation(op, target, commentOnlyReason); violation != "" {
+			return violation
+		}
+	}
+
+	if facilitation == nil {
+		return ""
+	}
+
+	if !isOwner {
+		if op.Op == models.OpDeleteShape && facilitation.NoDelete {
+			return fmt.Sprintf("Deleting shapes is disabled during this session (shape %s)", op.ID)
+		}
+		if facilitation.StickyNotesOnly {
+			if violation := noteOperationViolation(op, target, "during this session"); violation != "" {
+				return violation
+			}
+		}
+	}
+
+	if op.Op == models.OpAddShape && facilitation.PrivateNotes && !isOwner && IsNoteShape(op.Shape) {
+		op.Shape[ShapeHiddenKey] = true
+		op.Shape[ShapeAuthorKey] = userID.Hex()
+	}
+
+	return ""
+}
+
+// noteOperationViolation describes why an operation touches something other
+// than a sticky note, or returns "". target is the shape it updates or
+// deletes.
+func noteOperationViolation(op *models.BoardOperation, target map[string]interface{}, reason string) string {
+	switch op.Op {
+	case models.OpDeleteShape:
+		if target != nil && !IsNoteShape(target) {
+			return fmt.Sprintf("Only sticky notes can be changed %s (shape %s)", reason, op.ID)
+		}
+	case models.OpUpdateShape:
+		changesType := op.Shape["type"] != nil && !IsNoteShape(op.Shape)
+		if (target != nil && !IsNoteShape(target)) || changesType {
+			return fmt.Sprintf("Only sticky notes can be changed %s (shape %s)", reason, op.ID)
+		}
+	case models.OpAddShape:
+		if !IsNoteShape(op.Shape) {
+			return "Only sticky notes can be added " + reason
+		}
+	}
+	return ""
+}
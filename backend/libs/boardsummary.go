@@ -0,0 +1,207 @@
+package libs
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/sarwanazhar/boardsar/backend/database"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const boardSummaryCollection = "board_summaries"
+
+// boardSummaryTimeout bounds keeping one summary in step with its board
+const boardSummaryTimeout = 5 * time.Second
+
+// boardSummaryFields are the board fields copied into its summary
+var boardSummaryFields = bson.M{
+	"boardId": 1, "name": 1, "description": 1, "ownerId": 1, "sharedWith": 1, "parentBoardId": 1,
+	"tags": 1, "folderId": 1, "freeze": 1, "version": 1, "createdAt": 1, "updatedAt": 1,
+}
+
+// optionalSummaryFields are left out of a summary when the board doesn't
+// have them, so they are unset when the board loses them
+var optionalSummaryFields = []string{"name", "description", "sharedWith", "parentBoardId", "tags", "folderId", "freeze"}
+
+func GetBoardSummaryCollection() *mongo.Collection {
+	return database.GetCollection(boardSummaryCollection)
+}
+
+// RefreshBoardSummary copies the board's list fields into its summary after
+// a write. data is the board contents as written, to count the shapes; nil
+// keeps the count from before. Failures are logged: the summary catches up
+// on the board's next write, or at the next start.
+func RefreshBoardSummary(ctx context.Context, boardID primitive.ObjectID, data map[string]interface{}) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), boardSummaryTimeout)
+	defer cancel()
+	if err := refreshBoardSummary(ctx, boardID, data); err != nil {
+		slog.Warn("Failed to update summary of board", "board_id", boardID.Hex(), "error", err)
+	}
+}
+
+func refreshBoardSummary(ctx context.Context, boardID primitive.ObjectID, data map[string]interface{}) error {
+	var summary models.BoardSummary
+	err := database.GetCollection("boards").FindOne(ctx, bson.M{"_id": boardID},
+		options.FindOne().SetProjection(boardSummaryFields)).Decode(&summary)
+	if err == mongo.ErrNoDocuments {
+		// Deleted meanwhile
+		return removeBoardSummary(ctx, boardID)
+	}
+	if err != nil {
+		return err
+	}
+	raw, err := bson.Marshal(summary)
+	if err != nil {
+		return err
+	}
+	set := bson.M{}
+	if err := bson.Unmarshal(raw, &set); err != nil {
+		return err
+	}
+	delete(set, "_id")
+	set["collaboratorCount"] = len(summary.SharedWith)
+	if data != nil {
+		shapes, _ := ShapeList(data)
+		set["shapeCount"] = len(shapes)
+	}
+	unset := bson.M{}
+	for _, field := range optionalSummaryFields {
+		if _, ok := set[field]; !ok {
+			unset[field] = ""
+		}
+	}
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	// A refresh that read the board before a later write lost the race:
+	// the summary is newer, so the filter misses and the upsert collides
+	_, err = GetBoardSummaryCollection().UpdateOne(ctx,
+		bson.M{"_id": boardID, "updatedAt": bson.M{"$lte": summary.UpdatedAt}},
+		update,
+		options.Update().SetUpsert(true),
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil
+	}
+	return err
+}
+
+// RemoveBoardSummary drops a deleted board from the lists
+func RemoveBoardSummary(ctx context.Context, boardID primitive.ObjectID) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), boardSummaryTimeout)
+	defer cancel()
+	if err := removeBoardSummary(ctx, boardID); err != nil {
+		slog.Warn("Failed to remove summary of board", "board_id", boardID.Hex(), "error", err)
+	}
+}
+
+func removeBoardSummary(ctx context.Context, boardID primitive.ObjectID) error {
+	_, err := GetBoardSummaryCollection().DeleteOne(ctx, bson.M{"_id": boardID})
+	return err
+}
+
+// setBoardSummaryThumbnail points the board's summary at a newly drawn
+// thumbnail, unless a newer one was drawn meanwhile
+func setBoardSummaryThumbnail(ctx context.Context, thumbnail *models.BoardThumbnail) error {
+	_, err := GetBoardSummaryCollection().UpdateOne(ctx,
+		bson.M{
+			"_id": thumbnail.Metadata.BoardID,
+			"$or": bson.A{
+				bson.M{"thumbnail": bson.M{"$exists": false}},
+				bson.M{"thumbnail.id": bson.M{"$lt": thumbnail.ID}},
+			},
+		},
+		bson.M{"$set": bson.M{"thumbnail": models.ThumbnailRef{
+			ID:      thumbnail.ID,
+			Version: thumbnail.Metadata.Version,
+		}}},
+	)
+	return err
+}
+
+// RunBoardSummaryBackfill writes the summaries of boards that don't have
+// an up-to-date one: every board, the first time, and any whose refresh
+// failed. Run it in the background at startup.
+func RunBoardSummaryBackfill(ctx context.Context) {
+	count, err := backfillBoardSummaries(ctx)
+	if err != nil {
+		slog.Warn("Failed to backfill board summaries", "count", count, "error", err)
+		return
+	}
+	if count > 0 {
+		slog.Info("Backfilled board summaries", "count", count)
+	}
+}
+
+func backfillBoardSummaries(ctx context.Context) (int, error) {
+	pipeline := bson.A{
+		bson.M{"$project": bson.M{"version": 1, "updatedAt": 1}},
+		bson.M{"$lookup": bson.M{
+			"from":         boardSummaryCollection,
+			"localField":   "_id",
+			"foreignField": "_id",
+			"pipeline":     bson.A{bson.M{"$project": bson.M{"version": 1, "updatedAt": 1}}},
+			"as":           "summary",
+		}},
+		bson.M{"$match": bson.M{"$expr": bson.M{"$or": bson.A{
+			bson.M{"$eq": bson.A{bson.M{"$size": "$summary"}, 0}},
+			bson.M{"$ne": bson.A{bson.M{"$first": "$summary.version"}, "$version"}},
+			bson.M{"$ne": bson.A{bson.M{"$first": "$summary.updatedAt"}, "$updatedAt"}},
+		}}}},
+		bson.M{"$project": bson.M{"_id": 1}},
+	}
+	boards := database.GetCollection("boards")
+	cursor, err := boards.Aggregate(ctx, pipeline)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	count := 0
+	for cursor.Next(ctx) {
+		var stale struct {
+			ID primitive.ObjectID `bson:"_id"`
+		}
+		if err := cursor.Decode(&stale); err != nil {
+			return count, err
+		}
+		if err := backfillBoardSummary(ctx, stale.ID); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, cursor.Err()
+}
+
+func backfillBoardSummary(ctx context.Context, boardID primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(ctx, boardSummaryTimeout)
+	defer cancel()
+
+	// Archived boards have no contents to count until they are opened
+	var board models.Board
+	if err := database.GetCollection("boards").FindOne(ctx, bson.M{"_id": boardID}).Decode(&board); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil
+		}
+		return err
+	}
+	if err := refreshBoardSummary(ctx, boardID, board.BoardData); err != nil {
+		return err
+	}
+
+	thumbnail, err := FindBoardThumbnail(ctx, boardID)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return setBoardSummaryThumbnail(ctx, thumbnail)
+}
@@ -0,0 +1,373 @@
+package libs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sarwanazhar/boardsar/backend/database"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	embedTokenCollection        = "embed_tokens"
+	revokedBoardTokenCollection = "revoked_board_tokens"
+
+	// boardTokenAudience keeps board tokens and access tokens, signed with
+	// the same secret, from standing in for each other
+	boardTokenAudience = "boardsar:board"
+)
+
+// Embed token lifetimes: the default, and the longest an owner may ask for
+const (
+	DefaultEmbedTokenTTL = time.Hour
+	MaxEmbedTokenTTL     = 24 * time.Hour
+)
+
+// Board token errors. The text is safe to return to clients.
+var (
+	ErrInvalidBoardToken   = errors.New("Invalid or expired board token")
+	ErrRevokedBoardToken   = errors.New("Board token has been revoked")
+	ErrEmbedTokenNotFound  = errors.New("Embed token not found")
+	ErrInvalidEmbedOrigin  = errors.New("origin must be scheme://host[:port], like https://example.com")
+	ErrBoardTokenWrongSite = errors.New("Board token is not valid for this board or site")
+)
+
+func GetEmbedTokenCollection() *mongo.Collection {
+	return database.GetCollection(embedTokenCollection)
+}
+
+func GetRevokedBoardTokenCollection() *mongo.Collection {
+	return database.GetCollection(revokedBoardTokenCollection)
+}
+
+// GuestTokenTTL is how long a guest token stays valid
+func GuestTokenTTL() time.Duration {
+	return settings.GuestTokenTTL
+}
+
+// NormalizeOrigin returns an origin as browsers send it (lowercase
+// scheme://host[:port]), or false if it isn't one
+func NormalizeOrigin(origin string) (string, bool) {
+	parsed, err := url.Parse(strings.TrimSuffix(strings.TrimSpace(origin), "/"))
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" ||
+		parsed.Path != "" || parsed.RawQuery != "" || parsed.User != nil {
+		return "", false
+	}
+	return strings.ToLower(parsed.Scheme + "://" + parsed.Host), true
+}
+
+// RequestOrigin is the origin of the page that made the request: the Origin
+// header, or else the Referer's origin (sent for iframes and images)
+func RequestOrigin(r *http.Request) string {
+	if origin, ok := NormalizeOrigin(r.Header.Get("Origin")); ok {
+		return origin
+	}
+	if referrer, err := url.Parse(r.Referer()); err == nil && referrer.Host != "" {
+		if origin, ok := NormalizeOrigin(referrer.Scheme + "://" + referrer.Host); ok {
+			return origin
+		}
+	}
+	return ""
+}
+
+// IssueGuestToken returns a short-lived token for the board behind a share
+// link, bound to the origin it was opened from (the frontend's when the
+// request had none). Revoking the link revokes its guest tokens.
+func IssueGuestToken(link *models.ShareLink, origin string) (string, time.Time, error) {
+	if origin == "" {
+		origin, _ = NormalizeOrigin(FrontendURL())
+	}
+	now := time.Now()
+	claims := models.BoardTokenClaims{
+		Kind:        models.BoardTokenGuest,
+		BoardID:     link.BoardID,
+		Origin:      origin,
+		ShareLinkID: link.ID,
+		FrameID:     link.FrameID,
+		IssuedAt:    now,
+		ExpiresAt:   now.Add(GuestTokenTTL()),
+	}
+	token, err := signBoardToken(&claims)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return token, claims.ExpiresAt, nil
+}
+
+// IssueEmbedToken creates an embed token for the board, or for one frame of
+// it when frameID is set, that only works on pages of origin, and records
+// it so it can be listed and revoked
+func IssueEmbedToken(ctx context.Context, boardID, userID primitive.ObjectID, origin, frameID string, ttl time.Duration) (*models.EmbedToken, string, error) {
+	origin, ok := NormalizeOrigin(origin)
+	if !ok {
+		return nil, "", ErrInvalidEmbedOrigin
+	}
+
+	now := time.Now()
+	claims := models.BoardTokenClaims{
+		Kind:      models.BoardTokenEmbed,
+		BoardID:   boardID,
+		Origin:    origin,
+		FrameID:   frameID,
+		IssuedAt:  now,
+		ExpiresAt: now.Add(ttl),
+	}
+	token, err := signBoardToken(&claims)
+	if err != nil {
+		return nil, "", err
+	}
+
+	embed := &models.EmbedToken{
+		ID:        claims.ID,
+		BoardID:   boardID,
+		Origin:    origin,
+		FrameID:   frameID,
+		CreatedBy: userID,
+		CreatedAt: now,
+		ExpiresAt: claims.ExpiresAt,
+	}
+	if _, err := GetEmbedTokenCollection().InsertOne(ctx, embed); err != nil {
+		return nil, "", fmt.Errorf("error storing embed token: %w", err)
+	}
+	return embed, token, nil
+}
+
+// ListEmbedTokens returns the board's embed tokens that still work, newest
+// first
+func ListEmbedTokens(ctx context.Context, boardID primitive.ObjectID) ([]models.EmbedToken, error) {
+	cursor, err := GetEmbedTokenCollection().Find(ctx,
+		bson.M{
+			"boardId":   boardID,
+			"expiresAt": bson.M{"$gt": time.Now()},
+			"revokedAt": bson.M{"$exists": false},
+		},
+		options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error listing embed tokens: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	tokens := []models.EmbedToken{}
+	if err := cursor.All(ctx, &tokens); err != nil {
+		return nil, fmt.Errorf("error decoding embed tokens: %w", err)
+	}
+	return tokens, nil
+}
+
+// RevokeEmbedToken stops one of the board's embed tokens from working, on
+// this instance at once
+func RevokeEmbedToken(ctx context.Context, boardID primitive.ObjectID, tokenID string) (*models.EmbedToken, error) {
+	now := time.Now()
+	var embed models.EmbedToken
+	err := GetEmbedTokenCollection().FindOneAndUpdate(ctx,
+		bson.M{"_id": tokenID, "boardId": boardID, "revokedAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revokedAt": now}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&embed)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrEmbedTokenNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error revoking embed token: %w", err)
+	}
+
+	if err := revokeBoardTokens(ctx, embed.ID, embed.ExpiresAt); err != nil {
+		return nil, err
+	}
+	return &embed, nil
+}
+
+// revokeShareLinkGuestTokens revokes every guest token issued for the share
+// link; none outlives GuestTokenTTL
+func revokeShareLinkGuestTokens(ctx context.Context, linkID primitive.ObjectID) error {
+	return revokeBoardTokens(ctx, shareLinkRevocation(linkID), time.Now().Add(GuestTokenTTL()))
+}
+
+func shareLinkRevocation(linkID primitive.ObjectID) string {
+	return "link:" + linkID.Hex()
+}
+
+// ParseBoardToken verifies a guest or embed token and checks the
+// revocation list. The error text is safe to return to clients.
+func ParseBoardToken(tokenString string) (*models.BoardTokenClaims, error) {
+	token, err := jwt.Parse(tokenString, func(t *jwt.Token) (interface{}, error) {
+		return GetJWTSecret(), nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithAudience(boardTokenAudience),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidBoardToken
+	}
+	mapClaims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, ErrInvalidBoardToken
+	}
+
+	claims := &models.BoardTokenClaims{}
+	claims.ID, _ = mapClaims["jti"].(string)
+	claims.Kind, _ = mapClaims["typ"].(string)
+	claims.Origin, _ = mapClaims["origin"].(string)
+	claims.FrameID, _ = mapClaims["frame"].(string)
+	board, _ := mapClaims["board"].(string)
+	if claims.BoardID, err = primitive.ObjectIDFromHex(board); err != nil || claims.ID == "" || claims.Origin == "" {
+		return nil, ErrInvalidBoardToken
+	}
+	if link, ok := mapClaims["lnk"].(string); ok {
+		if claims.ShareLinkID, err = primitive.ObjectIDFromHex(link); err != nil {
+			return nil, ErrInvalidBoardToken
+		}
+	}
+	if iat, err := mapClaims.GetIssuedAt(); err == nil && iat != nil {
+		claims.IssuedAt = iat.Time
+	}
+	if exp, err := mapClaims.GetExpirationTime(); err == nil && exp != nil {
+		claims.ExpiresAt = exp.Time
+	}
+
+	switch claims.Kind {
+	case models.BoardTokenGuest:
+		if claims.ShareLinkID.IsZero() {
+			return nil, ErrInvalidBoardToken
+		}
+	case models.BoardTokenEmbed:
+	default:
+		return nil, ErrInvalidBoardToken
+	}
+
+	if boardTokenRevoked(claims) {
+		return nil, ErrRevokedBoardToken
+	}
+	return claims, nil
+}
+
+// signBoardToken fills in the token ID and signs the claims
+func signBoardToken(claims *models.BoardTokenClaims) (string, error) {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("error generating token ID: %w", err)
+	}
+	claims.ID = base64.RawURLEncoding.EncodeToString(raw)
+
+	mapClaims := jwt.MapClaims{
+		"typ":    claims.Kind,
+		"aud":    boardTokenAudience,
+		"jti":    claims.ID,
+		"board":  claims.BoardID.Hex(),
+		"origin": claims.Origin,
+		"iat":    claims.IssuedAt.Unix(),
+		"exp":    claims.ExpiresAt.Unix(),
+	}
+	if !claims.ShareLinkID.IsZero() {
+		mapClaims["lnk"] = claims.ShareLinkID.Hex()
+	}
+	if claims.FrameID != "" {
+		mapClaims["frame"] = claims.FrameID
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, mapClaims).SignedString(GetJWTSecret())
+}
+
+// boardTokenRevocations is this instance's copy of the revocation list,
+// subject to when the entry may be forgotten. Checking it doesn't touch the
+// database.
+var boardTokenRevocations = struct {
+	sync.RWMutex
+	subjects map[string]time.Time
+}{subjects: map[string]time.Time{}}
+
+func boardTokenRevoked(claims *models.BoardTokenClaims) bool {
+	boardTokenRevocations.RLock()
+	defer boardTokenRevocations.RUnlock()
+
+	if _, ok := boardTokenRevocations.subjects[claims.ID]; ok {
+		return true
+	}
+	if !claims.ShareLinkID.IsZero() {
+		if _, ok := boardTokenRevocations.subjects[shareLinkRevocation(claims.ShareLinkID)]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// revokeBoardTokens adds an entry to the revocation list. It applies on
+// this instance at once and on the others at their next refresh.
+func revokeBoardTokens(ctx context.Context, subject string, expiresAt time.Time) error {
+	_, err := GetRevokedBoardTokenCollection().UpdateOne(ctx,
+		bson.M{"_id": subject},
+		bson.M{"$set": bson.M{"revokedAt": time.Now(), "expiresAt": expiresAt}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return fmt.Errorf("error revoking board tokens: %w", err)
+	}
+
+	boardTokenRevocations.Lock()
+	boardTokenRevocations.subjects[subject] = expiresAt
+	boardTokenRevocations.Unlock()
+	return nil
+}
+
+// LoadBoardTokenRevocations replaces this instance's revocation list with
+// the stored one
+func LoadBoardTokenRevocations(ctx context.Context) error {
+	cursor, err := GetRevokedBoardTokenCollection().Find(ctx, bson.M{"expiresAt": bson.M{"$gt": time.Now()}})
+	if err != nil {
+		return fmt.Errorf("error loading revoked board tokens: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var entries []models.RevokedBoardToken
+	if err := cursor.All(ctx, &entries); err != nil {
+		return fmt.Errorf("error decoding revoked board tokens: %w", err)
+	}
+
+	subjects := make(map[string]time.Time, len(entries))
+	for _, entry := range entries {
+		subjects[entry.Subject] = entry.ExpiresAt
+	}
+
+	boardTokenRevocations.Lock()
+	boardTokenRevocations.subjects = subjects
+	boardTokenRevocations.Unlock()
+	return nil
+}
+
+// RunBoardTokenRevocationRefresh reloads the revocation list periodically,
+// so tokens revoked through another instance stop working here too. It
+// blocks until ctx is cancelled.
+func RunBoardTokenRevocationRefresh(ctx context.Context) {
+	interval := settings.Intervals.BoardTokenRevocation
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		loadCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		if err := LoadBoardTokenRevocations(loadCtx); err != nil {
+			slog.Warn("Board token revocation refresh failed", "error", err)
+		}
+		cancel()
+	}
+}
@@ -0,0 +1,259 @@
+package libs
+
+import (
+	"fmt"
+	"math"
+	"unicode/utf8"
+
+	"github.com/sarwanazhar/boardsar/backend/models"
+)
+
+// Limits on what a shape may hold; the board as a whole is capped by
+// BOARD_MAX_SIZE
+const (
+	maxShapeIDLength = 200
+	maxShapeText     = 100_000 // Characters
+	maxShapePoints   = 100_000 // Coordinates, two per point
+	maxCoordinate    = 1e9     // On either side of the origin
+	// maxBoardViolations is as many violations as one error lists
+	maxBoardViolations = 20
+)
+
+// shapeNumberFields are the numeric shape fields checked on write, in the
+// order they are reported, and whether each may be negative
+var shapeNumberFields = []struct {
+	name     string
+	negative bool
+}{
+	{"x", true}, {"y", true}, {"width", false}, {"height", false}, {"radius", false},
+	{"rotation", true}, {"scaleX", true}, {"scaleY", true},
+	{"fontSize", false}, {"strokeWidth", false}, {"opacity", false},
+}
+
+// BoardViolation is one way a board state breaks the rules
+type BoardViolation struct {
+	Path    string `json:"path,omitempty"` // Such as shapes[3].x; empty for the whole board
+	Message string `json:"message"`
+}
+
+func (v BoardViolation) String() string {
+	if v.Path == "" {
+		return v.Message
+	}
+	return v.Path + ": " + v.Message
+}
+
+// InvalidBoardError lists what is wrong with a board state, the first
+// maxBoardViolations problems of it
+type InvalidBoardError struct {
+	Violations []BoardViolation
+}
+
+func (e *InvalidBoardError) Error() string {
+	message := "Invalid board: " + e.Violations[0].String()
+	if more := len(e.Violations) - 1; more > 0 {
+		message += fmt.Sprintf(" (and %d more)", more)
+	}
+	return message
+}
+
+// ValidateBoardData checks the structure of a board state sent by a client:
+// shapes is a list of shapes with unique ids and known types, their
+// positions, sizes and points are finite numbers within bounds, shapes of
+// custom types match their schema, and the scale and position are numbers.
+// Fields it doesn't know are left to the client. It returns an
+// *InvalidBoardError.
+func ValidateBoardData(data map[string]interface{}) error {
+	var violations []BoardViolation
+	add := func(path, format string, args ...interface{}) bool {
+		violations = append(violations, BoardViolation{Path: path, Message: fmt.Sprintf(format, args...)})
+		return len(violations) < maxBoardViolations
+	}
+
+	if scale, ok := data["scale"]; ok && scale != nil {
+		if number, ok := toNumber(scale); !ok || !(number > 0) || number > maxCoordinate {
+			add("scale", "must be a positive number")
+		}
+	}
+	if position, ok := data["position"]; ok && position != nil {
+		fields, ok := position.(map[string]interface{})
+		if !ok {
+			add("position", "must be an object with x and y")
+		} else {
+			for _, axis := range []string{"x", "y"} {
+				if message := checkNumber(fields[axis], true); message != "" {
+					add("position."+axis, "%s", message)
+				}
+			}
+		}
+	}
+
+	shapes, ok := ShapeList(data)
+	if !ok {
+		if data["shapes"] != nil {
+			add("shapes", "must be a list")
+		}
+		return boardViolations(violations)
+	}
+	seen := make(map[string]int, len(shapes))
+	for i, item := range shapes {
+		path := fmt.Sprintf("shapes[%d]", i)
+		shape, ok := item.(map[string]interface{})
+		if !ok {
+			if !add(path, "must be an object") {
+				break
+			}
+			continue
+		}
+		problems := shapeViolations(shape, false)
+		if id, _ := shape["id"].(string); id != "" {
+			if first, ok := seen[id]; ok {
+				problems = append(problems, BoardViolation{Path: "id", Message: fmt.Sprintf("%q is the id of shapes[%d] too", id, first)})
+			} else {
+				seen[id] = i
+			}
+		}
+		if len(problems) == 0 {
+			if err := ValidateShape(shape); err != nil {
+				problems = append(problems, BoardViolation{Message: err.Error()})
+			}
+		}
+
+		full := false
+		for _, problem := range problems {
+			if problem.Path != "" {
+				problem.Path = "." + problem.Path
+			}
+			if full = !add(path+problem.Path, "%s", problem.Message); full {
+				break
+			}
+		}
+		if full {
+			break
+		}
+	}
+	return boardViolations(violations)
+}
+
+func boardViolations(violations []BoardViolation) error {
+	if len(violations) == 0 {
+		return nil
+	}
+	return &InvalidBoardError{Violations: violations}
+}
+
+// CheckBoardSize rejects a board state of size bytes of BSON over
+// BOARD_MAX_SIZE, with an *InvalidBoardError
+func CheckBoardSize(size int64) error {
+	if limit := settings.BoardMaxSize; limit > 0 && size > limit {
+		return &InvalidBoardError{Violations: []BoardViolation{{
+			Message: fmt.Sprintf("the board is %.1f MB; boards can be at most %.1f MB", float64(size)/(1<<20), float64(limit)/(1<<20)),
+		}}}
+	}
+	return nil
+}
+
+// shapeViolations checks the fields of a shape the server knows about.
+// With partial, the shape is only the fields an update changes, and the id
+// and type needn't be there.
+func shapeViolations(shape map[string]interface{}, partial bool) []BoardViolation {
+	var violations []BoardViolation
+	add := func(path, message string) {
+		violations = append(violations, BoardViolation{Path: path, Message: message})
+	}
+
+	if !partial {
+		id, isString := shape["id"].(string)
+		switch {
+		case !isString || id == "":
+			add("id", "is required")
+		case len(id) > maxShapeIDLength:
+			add("id", fmt.Sprintf("must be at most %d characters", maxShapeIDLength))
+		}
+	}
+	if value, ok := shape["type"]; ok || !partial {
+		name, _ := value.(string)
+		switch {
+		case name == "":
+			add("type", "is required")
+		case !knownShapeType(name):
+			add("type", fmt.Sprintf("%q is not a known shape type", name))
+		}
+	}
+
+	for _, field := range shapeNumberFields {
+		if message := checkNumber(shape[field.name], field.negative); message != "" {
+			add(field.name, message)
+		}
+	}
+	if opacity, ok := toNumber(shape["opacity"]); ok && opacity > 1 {
+		add("opacity", "must be from 0 to 1")
+	}
+
+	if value, ok := shape["points"]; ok && value != nil {
+		points, isList := toList(value)
+		switch {
+		case !isList:
+			add("points", "must be a list of numbers")
+		case len(points) > maxShapePoints:
+			add("points", fmt.Sprintf("must have at most %d coordinates", maxShapePoints))
+		case len(points)%2 != 0:
+			add("points", "must have an x and a y for every point")
+		default:
+			for i, point := range points {
+				if message := checkNumber(point, true); message != "" {
+					add(fmt.Sprintf("points[%d]", i), message)
+					break
+				}
+			}
+		}
+	}
+	if value, ok := shape["text"]; ok && value != nil {
+		text, isString := value.(string)
+		if !isString {
+			add("text", "must be a string")
+		} else if utf8.RuneCountInString(text) > maxShapeText {
+			add("text", fmt.Sprintf("must be at most %d characters", maxShapeText))
+		}
+	}
+	return violations
+}
+
+// checkShapeFields is shapeViolations for one shape of an operation,
+// reporting the first problem
+func checkShapeFields(shape map[string]interface{}, partial bool, id string) error {
+	if violations := shapeViolations(shape, partial); len(violations) > 0 {
+		return fmt.Errorf("invalid shape %s: %s", id, violations[0])
+	}
+	return nil
+}
+
+// checkNumber describes what is wrong with a numeric field, if anything.
+// Fields that aren't set are fine.
+func checkNumber(value interface{}, negative bool) string {
+	if value == nil {
+		return ""
+	}
+	number, ok := toNumber(value)
+	switch {
+	case !ok || math.IsNaN(number) || math.IsInf(number, 0):
+		return "must be a number"
+	case !negative && number < 0:
+		return "can't be negative"
+	case math.Abs(number) > maxCoordinate:
+		return fmt.Sprintf("must be within %g of 0", maxCoordinate)
+	}
+	return ""
+}
+
+// knownShapeType reports whether the editor draws shapes of a type, or it
+// is a registered custom type
+func knownShapeType(name string) bool {
+	if models.BuiltinShapeTypes[name] {
+		return true
+	}
+	shapeTypes.RLock()
+	defer shapeTypes.RUnlock()
+	_, ok := shapeTypes.byName[name]
+	return ok
+}
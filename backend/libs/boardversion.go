@@ -0,0 +1,292 @@
+package libs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/sarwanazhar/boardsar/backend/database"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	boardVersionCollection = "board_versions"
+
+	// boardBackupRetention is how many pre-operation backups are kept per
+	// board, apart from the version retention so saves don't push them out
+	boardBackupRetention = 20
+)
+
+func GetBoardVersionCollection() *mongo.Collection {
+	return database.GetCollection(boardVersionCollection)
+}
+
+// boardVersionRetention is how many unlabelled versions are kept per
+// board, BOARD_VERSION_RETENTION
+func boardVersionRetention() int64 {
+	return settings.BoardVersionRetention
+}
+
+// SaveBoardVersion stores a snapshot of the board as it is now and prunes
+// the board's oldest unlabelled versions beyond the retention limit
+func SaveBoardVersion(ctx context.Context, board *models.Board, authorID primitive.ObjectID, label string) (*models.BoardVersion, error) {
+	return saveBoardVersion(ctx, board, authorID, label, "")
+}
+
+// SaveBackupVersion snapshots the board before a destructive operation, so
+// the operation can be undone by restoring the backup
+func SaveBackupVersion(ctx context.Context, board *models.Board, authorID primitive.ObjectID, operation string) (*models.BoardVersion, error) {
+	return saveBoardVersion(ctx, board, authorID, "", operation)
+}
+
+func saveBoardVersion(ctx context.Context, board *models.Board, authorID primitive.ObjectID, label, backup string) (*models.BoardVersion, error) {
+	version := models.BoardVersion{
+		ID:        primitive.NewObjectID(),
+		BoardID:   board.ID,
+		Version:   board.Version,
+		BoardData: board.BoardData,
+		Backup:    backup,
+		CreatedAt: time.Now(),
+	}
+	if !authorID.IsZero() {
+		version.AuthorID = &authorID
+	}
+	if label != "" {
+		version.Label = label
+		version.LabeledBy = version.AuthorID
+		version.LabeledAt = &version.CreatedAt
+	}
+
+	if _, err := GetBoardVersionCollection().InsertOne(ctx, version); err != nil {
+		return nil, fmt.Errorf("error saving board version: %w", err)
+	}
+	if err := pruneBoardVersions(ctx, board); err != nil {
+		slog.Warn("Failed to prune versions of board", "board_id", board.ID.Hex(), "error", err)
+	}
+	return &version, nil
+}
+
+// RecordBoardVersion snapshots a board after a save, queues a new
+// thumbnail, drops its cached tiles and updates the shape index. Failures
+// are logged rather than returned: losing a history entry must not fail the
+// save.
+func RecordBoardVersion(ctx context.Context, board *models.Board, authorID primitive.ObjectID) {
+	EnqueueThumbnail(board.ID)
+	ForgetBoardTiles(board.ID)
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+
+	if _, err := SaveBoardVersion(ctx, board, authorID, ""); err != nil {
+		slog.Warn("Failed to record board version", "version", board.Version, "board_id", board.ID.Hex(), "error", err)
+	}
+	// Viewport queries fall back to the board itself until it's rebuilt
+	if err := IndexBoardShapes(ctx, board); err != nil {
+		slog.Warn("Failed to index shapes of board", "board_id", board.ID.Hex(), "error", err)
+	}
+}
+
+// RecordStoredBoardVersion snapshots a board by reloading it, for saves
+// made with update operators whose result the caller doesn't hold
+func RecordStoredBoardVersion(ctx context.Context, boardID, authorID primitive.ObjectID) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+
+	var board models.Board
+	err := database.GetCollection("boards").FindOne(ctx, bson.M{"_id": boardID}).Decode(&board)
+	if err != nil {
+		slog.Warn("Failed to load board to record its version", "board_id", boardID.Hex(), "error", err)
+		return
+	}
+	RecordBoardVersion(ctx, &board, authorID)
+}
+
+// pruneBoardVersions deletes unlabelled versions older than the newest
+// BOARD_VERSION_RETENTION of them, and backups beyond the backup retention.
+// Milestones are never pruned, and nothing is while the board is under
+// legal hold.
+func pruneBoardVersions(ctx context.Context, board *models.Board) error {
+	onHold, err := IsBoardUnderLegalHold(ctx, board.ID, board.OwnerID)
+	if err != nil || onHold {
+		return err
+	}
+
+	err = pruneOldest(ctx, bson.M{
+		"boardId": board.ID,
+		"label":   bson.M{"$exists": false},
+		"backup":  bson.M{"$exists": false},
+	}, boardVersionRetention())
+	if err != nil {
+		return err
+	}
+	return pruneOldest(ctx, bson.M{
+		"boardId": board.ID,
+		"label":   bson.M{"$exists": false},
+		"backup":  bson.M{"$exists": true},
+	}, boardBackupRetention)
+}
+
+// pruneOldest deletes the versions matching filter beyond the newest keep
+func pruneOldest(ctx context.Context, filter bson.M, keep int64) error {
+	var oldestKept models.BoardVersion
+	err := GetBoardVersionCollection().FindOne(ctx, filter, options.FindOne().
+		SetSort(bson.D{{Key: "_id", Value: -1}}).
+		SetSkip(keep-1).
+		SetProjection(bson.M{"_id": 1}),
+	).Decode(&oldestKept)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	filter["_id"] = bson.M{"$lt": oldestKept.ID}
+	_, err = GetBoardVersionCollection().DeleteMany(ctx, filter)
+	return err
+}
+
+// ListBoardVersions returns a board's versions without their contents,
+// newest first. With milestonesOnly, only labelled versions are returned.
+func ListBoardVersions(ctx context.Context, boardID primitive.ObjectID, milestonesOnly bool) ([]models.BoardVersion, error) {
+	filter := bson.M{"boardId": boardID}
+	if milestonesOnly {
+		filter["label"] = bson.M{"$exists": true}
+	}
+
+	cursor, err := GetBoardVersionCollection().Find(ctx, filter, options.Find().
+		SetSort(bson.D{{Key: "_id", Value: -1}}).
+		SetProjection(BoardContentsProjection))
+	if err != nil {
+		return nil, err
+	}
+
+	versions := []models.BoardVersion{}
+	if err := cursor.All(ctx, &versions); err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+// FindBoardVersion loads one version of a board, with its contents
+func FindBoardVersion(ctx context.Context, boardID primitive.ObjectID, versionID string) (*models.BoardVersion, error) {
+	id, err := primitive.ObjectIDFromHex(versionID)
+	if err != nil {
+		return nil, mongo.ErrNoDocuments
+	}
+
+	var version models.BoardVersion
+	err = GetBoardVersionCollection().FindOne(ctx, bson.M{"_id": id, "boardId": boardID}).Decode(&version)
+	if err != nil {
+		return nil, err
+	}
+	return &version, nil
+}
+
+// LabelBoardVersion sets or, with an empty label, clears a version's
+// milestone label. It returns the updated version without its contents.
+func LabelBoardVersion(ctx context.Context, boardID primitive.ObjectID, versionID string, label string, userID primitive.ObjectID) (*models.BoardVersion, error) {
+	id, err := primitive.ObjectIDFromHex(versionID)
+	if err != nil {
+		return nil, mongo.ErrNoDocuments
+	}
+
+	now := time.Now()
+	update := bson.M{"$set": bson.M{"label": label, "labeledBy": userID, "labeledAt": now}}
+	if label == "" {
+		update = bson.M{"$unset": bson.M{"label": "", "labeledBy": "", "labeledAt": ""}}
+	}
+
+	var version models.BoardVersion
+	err = GetBoardVersionCollection().FindOneAndUpdate(ctx,
+		bson.M{"_id": id, "boardId": boardID},
+		update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After).SetProjection(BoardContentsProjection),
+	).Decode(&version)
+	if err != nil {
+		return nil, err
+	}
+	return &version, nil
+}
+
+// DeleteBoardVersions removes the history of a deleted board
+func DeleteBoardVersions(ctx context.Context, boardID primitive.ObjectID) error {
+	_, err := GetBoardVersionCollection().DeleteMany(ctx, bson.M{"boardId": boardID})
+	return err
+}
+
+// DiffBoards compares the shapes of two board states by shape ID
+func DiffBoards(from, to map[string]interface{}) models.BoardDiff {
+	diff := models.BoardDiff{
+		Added:   []map[string]interface{}{},
+		Removed: []map[string]interface{}{},
+		Changed: []models.ShapeChange{},
+	}
+	before := BoardShapes(from)
+	after := BoardShapes(to)
+
+	for _, id := range sortedShapeIDs(after) {
+		shape := after[id]
+		previous, ok := before[id]
+		if !ok {
+			diff.Added = append(diff.Added, shape)
+			continue
+		}
+		if fields := changedFields(previous, shape); len(fields) > 0 {
+			diff.Changed = append(diff.Changed, models.ShapeChange{ID: id, Fields: fields, Before: previous, After: shape})
+		}
+	}
+	for _, id := range sortedShapeIDs(before) {
+		if _, ok := after[id]; !ok {
+			diff.Removed = append(diff.Removed, before[id])
+		}
+	}
+	return diff
+}
+
+// changedFields lists the fields that differ between two versions of a
+// shape. Values are compared by their JSON form, so numbers stored as
+// different Go types still compare equal.
+func changedFields(before, after map[string]interface{}) []string {
+	fields := []string{}
+	for key, value := range after {
+		if previous, ok := before[key]; !ok || !sameJSON(previous, value) {
+			fields = append(fields, key)
+		}
+	}
+	for key := range before {
+		if _, ok := after[key]; !ok {
+			fields = append(fields, key)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+func sameJSON(a, b interface{}) bool {
+	first, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	second, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+	return string(first) == string(second)
+}
+
+func sortedShapeIDs(shapes map[string]map[string]interface{}) []string {
+	ids := make([]string, 0, len(shapes))
+	for id := range shapes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
@@ -0,0 +1,162 @@
+package libs
+
+import (
+	"errors"
+	"math"
+)
+
+// maxCBORDepth bounds nesting so a hostile attestation can't exhaust the
+// stack; WebAuthn structures nest three levels at most
+const maxCBORDepth = 16
+
+var (
+	errCBORTruncated   = errors.New("cbor: unexpected end of data")
+	errCBORUnsupported = errors.New("cbor: unsupported item")
+)
+
+// cborDecode decodes the CBOR item at the start of data and returns it with
+// the bytes after it. Integers decode as int64, byte strings as []byte, text
+// as string, arrays as []interface{} and maps as map[interface{}]interface{}
+// keyed by int64 or string. Tags are dropped. Indefinite lengths aren't
+// supported: authenticators encode canonically (CTAP2).
+func cborDecode(data []byte) (interface{}, []byte, error) {
+	return cborItem(data, 0)
+}
+
+func cborItem(data []byte, depth int) (interface{}, []byte, error) {
+	if depth > maxCBORDepth {
+		return nil, nil, errCBORUnsupported
+	}
+	if len(data) == 0 {
+		return nil, nil, errCBORTruncated
+	}
+	major, info := data[0]>>5, data[0]&0x1f
+
+	if major == 7 {
+		switch info {
+		case 20:
+			return false, data[1:], nil
+		case 21:
+			return true, data[1:], nil
+		case 22, 23:
+			return nil, data[1:], nil
+		}
+	}
+
+	arg, rest, err := cborArgument(info, data[1:])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch major {
+	case 0:
+		if arg > math.MaxInt64 {
+			return nil, nil, errCBORUnsupported
+		}
+		return int64(arg), rest, nil
+	case 1:
+		if arg > math.MaxInt64 {
+			return nil, nil, errCBORUnsupported
+		}
+		return -1 - int64(arg), rest, nil
+	case 2, 3:
+		if arg > uint64(len(rest)) {
+			return nil, nil, errCBORTruncated
+		}
+		if major == 3 {
+			return string(rest[:arg]), rest[arg:], nil
+		}
+		return append([]byte(nil), rest[:arg]...), rest[arg:], nil
+	case 4:
+		// Every item takes at least a byte, which bounds the allocation
+		if arg > uint64(len(rest)) {
+			return nil, nil, errCBORTruncated
+		}
+		items := make([]interface{}, 0, arg)
+		for i := uint64(0); i < arg; i++ {
+			var item interface{}
+			item, rest, err = cborItem(rest, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			items = append(items, item)
+		}
+		return items, rest, nil
+	case 5:
+		if arg > uint64(len(rest))/2 {
+			return nil, nil, errCBORTruncated
+		}
+		entries := make(map[interface{}]interface{}, arg)
+		for i := uint64(0); i < arg; i++ {
+			var key, value interface{}
+			key, rest, err = cborItem(rest, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, nil, errCBORUnsupported
+			}
+			value, rest, err = cborItem(rest, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			entries[key] = value
+		}
+		return entries, rest, nil
+	case 6:
+		return cborItem(rest, depth+1)
+	default:
+		switch info {
+		case 25:
+			return cborHalfFloat(uint16(arg)), rest, nil
+		case 26:
+			return float64(math.Float32frombits(uint32(arg))), rest, nil
+		case 27:
+			return math.Float64frombits(arg), rest, nil
+		}
+		return nil, nil, errCBORUnsupported
+	}
+}
+
+// cborArgument reads the length or value that follows an initial byte
+func cborArgument(info byte, data []byte) (uint64, []byte, error) {
+	if info < 24 {
+		return uint64(info), data, nil
+	}
+	if info > 27 {
+		return 0, nil, errCBORUnsupported
+	}
+	size := 1 << (info - 24)
+	if len(data) < size {
+		return 0, nil, errCBORTruncated
+	}
+	var value uint64
+	for _, b := range data[:size] {
+		value = value<<8 | uint64(b)
+	}
+	return value, data[size:], nil
+}
+
+func cborHalfFloat(bits uint16) float64 {
+	exponent := int(bits>>10) & 0x1f
+	mantissa := float64(bits & 0x3ff)
+	var value float64
+	switch exponent {
+	case 0:
+		value = math.Ldexp(mantissa, -24)
+	case 0x1f:
+		if mantissa == 0 {
+			value = math.Inf(1)
+		} else {
+			value = math.NaN()
+		}
+	default:
+		value = math.Ldexp(mantissa+1024, exponent-25)
+	}
+	if bits&0x8000 != 0 {
+		return -value
+	}
+	return value
+}
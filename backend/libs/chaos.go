@@ -0,0 +1,125 @@
+package libs
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ChaosRule describes the faults injected into one route. Route is the
+// method plus the Gin route pattern, e.g. "PUT /api/boards/:boardId", or "*"
+// to match every route without a rule of its own.
+type ChaosRule struct {
+	Route            string  `json:"route" binding:"required"`
+	LatencyMs        int     `json:"latencyMs" binding:"min=0"`
+	ErrorRate        float64 `json:"errorRate" binding:"min=0,max=1"`
+	MongoFailureRate float64 `json:"mongoFailureRate" binding:"min=0,max=1"`
+}
+
+var chaosRules = struct {
+	sync.RWMutex
+	byRoute map[string]ChaosRule
+}{byRoute: map[string]ChaosRule{}}
+
+// ChaosEnabled reports whether fault injection is turned on. It is meant for
+// local development only and is always off in release mode.
+func ChaosEnabled() bool {
+	return settings.ChaosMode && gin.Mode() != gin.ReleaseMode
+}
+
+// LoadChaosRules seeds the rule set from a JSON array (the CHAOS_RULES env).
+func LoadChaosRules(raw string) error {
+	if raw == "" {
+		return nil
+	}
+
+	var rules []ChaosRule
+	if err := json.Unmarshal([]byte(raw), &rules); err != nil {
+		return fmt.Errorf("error parsing chaos rules: %w", err)
+	}
+	for _, rule := range rules {
+		SetChaosRule(rule)
+	}
+	return nil
+}
+
+// GetChaosRules returns all configured rules.
+func GetChaosRules() []ChaosRule {
+	chaosRules.RLock()
+	defer chaosRules.RUnlock()
+
+	rules := make([]ChaosRule, 0, len(chaosRules.byRoute))
+	for _, rule := range chaosRules.byRoute {
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// SetChaosRule adds or replaces the rule for rule.Route.
+func SetChaosRule(rule ChaosRule) {
+	chaosRules.Lock()
+	defer chaosRules.Unlock()
+	chaosRules.byRoute[rule.Route] = rule
+}
+
+// ClearChaosRules removes every rule.
+func ClearChaosRules() {
+	chaosRules.Lock()
+	defer chaosRules.Unlock()
+	chaosRules.byRoute = map[string]ChaosRule{}
+}
+
+func findChaosRule(route string) (ChaosRule, bool) {
+	chaosRules.RLock()
+	defer chaosRules.RUnlock()
+
+	if rule, ok := chaosRules.byRoute[route]; ok {
+		return rule, true
+	}
+	rule, ok := chaosRules.byRoute["*"]
+	return rule, ok
+}
+
+// ChaosMiddleware injects latency, random 500s and simulated Mongo outages
+// according to the configured rules.
+func ChaosMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.Request.Method + " " + c.FullPath()
+		if c.FullPath() == "" || c.FullPath() == "/debug/chaos" {
+			c.Next()
+			return
+		}
+
+		rule, ok := findChaosRule(route)
+		if !ok {
+			c.Next()
+			return
+		}
+
+		if rule.LatencyMs > 0 {
+			time.Sleep(time.Duration(rule.LatencyMs) * time.Millisecond)
+		}
+
+		if rule.ErrorRate > 0 && rand.Float64() < rule.ErrorRate {
+			slog.Warn("Chaos: injected 500", "route", route)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error (injected fault)"})
+			c.Abort()
+			return
+		}
+
+		if rule.MongoFailureRate > 0 && rand.Float64() < rule.MongoFailureRate {
+			slog.Warn("Chaos: injected Mongo failure", "route", route)
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database unavailable (injected fault)"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,322 @@
+package libs
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/sarwanazhar/boardsar/backend/database"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const classroomCollection = "classrooms"
+
+// MaxClassroomStudents is as many students as a classroom can have
+const MaxClassroomStudents = 200
+
+var (
+	ErrReviewState            = errors.New("The board isn't in a review state it can move on from")
+	ErrTooManyComments        = fmt.Errorf("A student's board can have at most %d grading comments", models.MaxGradingComments)
+	ErrGradingCommentNotFound = errors.New("Grading comment not found")
+)
+
+// reviewFrom are the review states a student's board can be moved to each
+// state from. Regrading a graded board is allowed.
+var reviewFrom = map[string][]string{
+	models.ReviewSubmitted: {models.ReviewAssigned},
+	models.ReviewAssigned:  {models.ReviewSubmitted, models.ReviewInReview},
+	models.ReviewInReview:  {models.ReviewSubmitted, models.ReviewGraded},
+	models.ReviewGraded:    {models.ReviewInReview, models.ReviewGraded},
+}
+
+func GetClassroomCollection() *mongo.Collection {
+	return database.GetCollection(classroomCollection)
+}
+
+// ParseRoster gathers the emails of a roster, from a list and from the text
+// of a roster file with one email per line or separated by commas,
+// semicolons or tabs. A header line such as "email" is dropped, as are
+// repeats, compared without case, in the order first seen.
+func ParseRoster(emails []string, roster string) []string {
+	fields := append([]string{}, emails...)
+	fields = append(fields, strings.FieldsFunc(roster, func(r rune) bool {
+		return r == '\n' || r == '\r' || r == ',' || r == ';' || r == '\t'
+	})...)
+
+	parsed := []string{}
+	seen := map[string]bool{}
+	for _, field := range fields {
+		email := strings.Trim(strings.TrimSpace(field), `"'`)
+		key := strings.ToLower(email)
+		if !strings.Contains(email, "@") || seen[key] {
+			continue
+		}
+		seen[key] = true
+		parsed = append(parsed, email)
+	}
+	return parsed
+}
+
+// ListClassrooms returns the teacher's classrooms, newest first
+func ListClassrooms(ctx context.Context, ownerID primitive.ObjectID) ([]models.Classroom, error) {
+	cursor, err := GetClassroomCollection().Find(ctx, bson.M{"ownerId": ownerID}, options.Find().SetSort(bson.M{"createdAt": -1}))
+	if err != nil {
+		return nil, err
+	}
+
+	classrooms := []models.Classroom{}
+	if err := cursor.All(ctx, &classrooms); err != nil {
+		return nil, err
+	}
+	return classrooms, nil
+}
+
+// FindClassroom loads one of the teacher's classrooms
+func FindClassroom(ctx context.Context, classroomID string, ownerID primitive.ObjectID) (*models.Classroom, error) {
+	id, err := primitive.ObjectIDFromHex(classroomID)
+	if err != nil {
+		return nil, mongo.ErrNoDocuments
+	}
+
+	var classroom models.Classroom
+	if err := GetClassroomCollection().FindOne(ctx, bson.M{"_id": id, "ownerId": ownerID}).Decode(&classroom); err != nil {
+		return nil, err
+	}
+	return &classroom, nil
+}
+
+// assignmentProjection leaves a student only their own roster entry, which
+// the query matched
+var assignmentProjection = bson.M{"students.$": 1, "ownerId": 1, "name": 1, "templateId": 1, "createdAt": 1, "updatedAt": 1}
+
+// ListAssignments returns the classrooms the student is on, newest first,
+// each with only the student's own entry
+func ListAssignments(ctx context.Context, studentID primitive.ObjectID) ([]models.Classroom, error) {
+	cursor, err := GetClassroomCollection().Find(ctx, bson.M{"students.userId": studentID}, options.Find().
+		SetSort(bson.M{"createdAt": -1}).
+		SetProjection(assignmentProjection))
+	if err != nil {
+		return nil, err
+	}
+
+	classrooms := []models.Classroom{}
+	if err := cursor.All(ctx, &classrooms); err != nil {
+		return nil, err
+	}
+	return classrooms, nil
+}
+
+// FindAssignment loads a classroom the student is on, with only the
+// student's own entry
+func FindAssignment(ctx context.Context, classroomID string, studentID primitive.ObjectID) (*models.Classroom, error) {
+	id, err := primitive.ObjectIDFromHex(classroomID)
+	if err != nil {
+		return nil, mongo.ErrNoDocuments
+	}
+
+	var classroom models.Classroom
+	if err := GetClassroomCollection().FindOne(ctx,
+		bson.M{"_id": id, "students.userId": studentID},
+		options.FindOne().SetProjection(assignmentProjection),
+	).Decode(&classroom); err != nil {
+		return nil, err
+	}
+	return &classroom, nil
+}
+
+// FindStudent returns the classroom's entry for a student
+func FindStudent(classroom *models.Classroom, studentID primitive.ObjectID) (*models.ClassroomStudent, bool) {
+	for i := range classroom.Students {
+		if classroom.Students[i].UserID == studentID {
+			return &classroom.Students[i], true
+		}
+	}
+	return nil, false
+}
+
+// StudentStatus is the review state of a student's board
+func StudentStatus(student *models.ClassroomStudent) string {
+	if student.Status == "" {
+		return models.ReviewAssigned
+	}
+	return student.Status
+}
+
+// MoveStudentReview moves a student's board to another review state,
+// setting fields of the student's entry on the way, and returns the
+// classroom as updated. ErrReviewState means the board was in a state it
+// can't be moved there from.
+func MoveStudentReview(ctx context.Context, classroomID, studentID primitive.ObjectID, status string, fields bson.M) (*models.Classroom, error) {
+	from := bson.A{}
+	for _, state := range reviewFrom[status] {
+		from = append(from, state)
+		if state == models.ReviewAssigned {
+			from = append(from, nil)
+		}
+	}
+	if len(from) == 0 {
+		return nil, ErrReviewState
+	}
+
+	set := bson.M{"students.$.status": status, "updatedAt": time.Now()}
+	for field, value := range fields {
+		set["students.$."+field] = value
+	}
+
+	var classroom models.Classroom
+	err := GetClassroomCollection().FindOneAndUpdate(ctx,
+		bson.M{"_id": classroomID, "students": bson.M{"$elemMatch": bson.M{"userId": studentID, "status": bson.M{"$in": from}}}},
+		bson.M{"$set": set},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&classroom)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrReviewState
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &classroom, nil
+}
+
+// AddGradingComment adds a grading comment to a student's board, up to
+// MaxGradingComments
+func AddGradingComment(ctx context.Context, classroomID, studentID primitive.ObjectID, comment *models.GradingComment) error {
+	result, err := GetClassroomCollection().UpdateOne(ctx,
+		bson.M{"_id": classroomID, "students": bson.M{"$elemMatch": bson.M{
+			"userId": studentID,
+			fmt.Sprintf("comments.%d", models.MaxGradingComments-1): bson.M{"$exists": false},
+		}}},
+		bson.M{
+			"$push": bson.M{"students.$.comments": comment},
+			"$set":  bson.M{"updatedAt": time.Now()},
+		},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrTooManyComments
+	}
+	return nil
+}
+
+// DeleteGradingComment removes a grading comment from a student's board
+func DeleteGradingComment(ctx context.Context, classroomID, studentID, commentID primitive.ObjectID) error {
+	result, err := GetClassroomCollection().UpdateOne(ctx,
+		bson.M{"_id": classroomID, "students": bson.M{"$elemMatch": bson.M{"userId": studentID, "comments._id": commentID}}},
+		bson.M{
+			"$pull": bson.M{"students.$.comments": bson.M{"_id": commentID}},
+			"$set":  bson.M{"updatedAt": time.Now()},
+		},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrGradingCommentNotFound
+	}
+	return nil
+}
+
+// WriteGradesCSV writes the classroom's grades as CSV, a row per student in
+// roster order. Students whose boards aren't graded yet have no grade.
+func WriteGradesCSV(w io.Writer, classroom *models.Classroom) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"email", "userId", "boardId", "status", "submittedAt", "gradedAt", "grade", "feedback", "comments"})
+	for i := range classroom.Students {
+		student := &classroom.Students[i]
+		status := StudentStatus(student)
+		grade, feedback, gradedAt := "", "", ""
+		if status == models.ReviewGraded {
+			grade, feedback, gradedAt = student.Grade, student.Feedback, csvTime(student.GradedAt)
+		}
+		writer.Write([]string{
+			csvCell(student.Email),
+			student.UserID.Hex(),
+			student.BoardID.Hex(),
+			status,
+			csvTime(student.SubmittedAt),
+			gradedAt,
+			csvCell(grade),
+			csvCell(feedback),
+			fmt.Sprint(len(student.Comments)),
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func csvTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// csvCell keeps spreadsheets from reading a cell as a formula
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// StudentActivities sums up each student's activity on their own board,
+// keyed by board ID, from the activity feed. Edits by the teacher don't
+// count, and feed entries older than ACTIVITY_RETENTION are gone.
+func StudentActivities(ctx context.Context, students []models.ClassroomStudent) (map[primitive.ObjectID]models.StudentActivity, error) {
+	activities := make(map[primitive.ObjectID]models.StudentActivity, len(students))
+	if len(students) == 0 {
+		return activities, nil
+	}
+
+	boardIDs := make([]primitive.ObjectID, 0, len(students))
+	studentIDs := make([]primitive.ObjectID, 0, len(students))
+	studentOf := make(map[primitive.ObjectID]primitive.ObjectID, len(students))
+	for _, student := range students {
+		boardIDs = append(boardIDs, student.BoardID)
+		studentIDs = append(studentIDs, student.UserID)
+		studentOf[student.BoardID] = student.UserID
+	}
+
+	cursor, err := GetActivityCollection().Aggregate(ctx, bson.A{
+		bson.M{"$match": bson.M{"boardId": bson.M{"$in": boardIDs}, "actorId": bson.M{"$in": studentIDs}}},
+		bson.M{"$group": bson.M{
+			"_id":          bson.M{"boardId": "$boardId", "actorId": "$actorId"},
+			"saves":        bson.M{"$sum": bson.M{"$ifNull": bson.A{"$changes.saves", 0}}},
+			"added":        bson.M{"$sum": bson.M{"$ifNull": bson.A{"$changes.added", 0}}},
+			"changed":      bson.M{"$sum": bson.M{"$ifNull": bson.A{"$changes.changed", 0}}},
+			"removed":      bson.M{"$sum": bson.M{"$ifNull": bson.A{"$changes.removed", 0}}},
+			"lastActiveAt": bson.M{"$max": "$updatedAt"},
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var groups []struct {
+		ID struct {
+			BoardID primitive.ObjectID `bson:"boardId"`
+			ActorID primitive.ObjectID `bson:"actorId"`
+		} `bson:"_id"`
+		models.StudentActivity `bson:",inline"`
+	}
+	if err := cursor.All(ctx, &groups); err != nil {
+		return nil, err
+	}
+	for _, group := range groups {
+		// Only the student the board was made for counts
+		if studentOf[group.ID.BoardID] == group.ID.ActorID {
+			activities[group.ID.BoardID] = group.StudentActivity
+		}
+	}
+	return activities, nil
+}
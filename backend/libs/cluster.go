@@ -0,0 +1,244 @@
+package libs
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Clustering methods
+const (
+	ClusterMethodTFIDF      = "tfidf"
+	ClusterMethodEmbeddings = "embeddings"
+)
+
+// Default similarity needed to join a cluster. Embeddings score related
+// texts much higher than bag-of-words vectors do.
+const (
+	DefaultTFIDFThreshold     = 0.2
+	DefaultEmbeddingThreshold = 0.8
+)
+
+// clusterLabelTerms is how many top terms make up a cluster label
+const clusterLabelTerms = 3
+
+// stopWords are left out of TF-IDF vectors and labels
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true,
+	"be": true, "but": true, "by": true, "can": true, "do": true, "for": true,
+	"from": true, "has": true, "have": true, "how": true, "if": true, "in": true,
+	"is": true, "it": true, "its": true, "more": true, "not": true, "of": true,
+	"on": true, "or": true, "our": true, "should": true, "so": true, "that": true,
+	"the": true, "their": true, "them": true, "there": true, "this": true,
+	"to": true, "too": true, "us": true, "was": true, "we": true, "what": true,
+	"when": true, "which": true, "who": true, "why": true, "will": true,
+	"with": true, "would": true, "you": true, "your": true,
+}
+
+// ClusterText is one piece of text to cluster
+type ClusterText struct {
+	ID   string
+	Text string
+}
+
+// Cluster is a suggested group of texts with a short label
+type Cluster struct {
+	Label string   `json:"label"`
+	IDs   []string `json:"shapeIds"`
+}
+
+// ClusterTexts groups texts by similarity. When vectors is nil the texts are
+// compared as TF-IDF vectors; otherwise vectors[i] is the embedding of
+// texts[i]. Each text joins the most similar existing cluster if it reaches
+// threshold, or starts a new one. Clusters are returned largest first,
+// together with the IDs that ended up alone.
+func ClusterTexts(texts []ClusterText, vectors [][]float64, threshold float64) ([]Cluster, []string) {
+	tokens := make([][]string, len(texts))
+	for i, text := range texts {
+		tokens[i] = tokenize(text.Text)
+	}
+	weights := tfidf(tokens)
+
+	if vectors == nil {
+		vectors = denseVectors(weights)
+	}
+	for i := range vectors {
+		normalize(vectors[i])
+	}
+
+	type group struct {
+		members  []int
+		centroid []float64
+	}
+	var groups []*group
+
+	for i, vector := range vectors {
+		var best *group
+		bestScore := threshold
+		for _, g := range groups {
+			if score := cosine(vector, g.centroid); score >= bestScore {
+				best, bestScore = g, score
+			}
+		}
+
+		if best == nil {
+			groups = append(groups, &group{
+				members:  []int{i},
+				centroid: append([]float64{}, vector...),
+			})
+			continue
+		}
+
+		best.members = append(best.members, i)
+		n := float64(len(best.members))
+		for d := range best.centroid {
+			best.centroid[d] += (vector[d] - best.centroid[d]) / n
+		}
+	}
+
+	sort.SliceStable(groups, func(a, b int) bool {
+		return len(groups[a].members) > len(groups[b].members)
+	})
+
+	clusters := []Cluster{}
+	unclustered := []string{}
+	for _, g := range groups {
+		if len(g.members) < 2 {
+			unclustered = append(unclustered, texts[g.members[0]].ID)
+			continue
+		}
+
+		ids := make([]string, 0, len(g.members))
+		memberWeights := make([]map[string]float64, 0, len(g.members))
+		for _, i := range g.members {
+			ids = append(ids, texts[i].ID)
+			memberWeights = append(memberWeights, weights[i])
+		}
+		clusters = append(clusters, Cluster{Label: clusterLabel(memberWeights), IDs: ids})
+	}
+
+	return clusters, unclustered
+}
+
+// tokenize lowercases text and splits it into words, dropping stop words
+// and single characters
+func tokenize(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+
+	tokens := words[:0]
+	for _, word := range words {
+		if len([]rune(word)) > 1 && !stopWords[word] {
+			tokens = append(tokens, word)
+		}
+	}
+	return tokens
+}
+
+// tfidf weights each document's terms by term frequency times smoothed
+// inverse document frequency
+func tfidf(documents [][]string) []map[string]float64 {
+	documentFrequency := map[string]int{}
+	for _, tokens := range documents {
+		seen := map[string]bool{}
+		for _, token := range tokens {
+			if !seen[token] {
+				seen[token] = true
+				documentFrequency[token]++
+			}
+		}
+	}
+
+	n := float64(len(documents))
+	weights := make([]map[string]float64, len(documents))
+	for i, tokens := range documents {
+		weights[i] = map[string]float64{}
+		for _, token := range tokens {
+			weights[i][token]++
+		}
+		for token, count := range weights[i] {
+			idf := math.Log((1+n)/(1+float64(documentFrequency[token]))) + 1
+			weights[i][token] = count / float64(len(tokens)) * idf
+		}
+	}
+	return weights
+}
+
+// denseVectors lays sparse term weights out over a shared vocabulary
+func denseVectors(weights []map[string]float64) [][]float64 {
+	vocabulary := map[string]int{}
+	for _, terms := range weights {
+		for term := range terms {
+			if _, ok := vocabulary[term]; !ok {
+				vocabulary[term] = len(vocabulary)
+			}
+		}
+	}
+
+	vectors := make([][]float64, len(weights))
+	for i, terms := range weights {
+		vectors[i] = make([]float64, len(vocabulary))
+		for term, weight := range terms {
+			vectors[i][vocabulary[term]] = weight
+		}
+	}
+	return vectors
+}
+
+func normalize(vector []float64) {
+	var sum float64
+	for _, value := range vector {
+		sum += value * value
+	}
+	if sum == 0 {
+		return
+	}
+	norm := math.Sqrt(sum)
+	for i := range vector {
+		vector[i] /= norm
+	}
+}
+
+func cosine(a, b []float64) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(normA*normB)
+}
+
+// clusterLabel names a cluster after its highest-weighted terms
+func clusterLabel(weights []map[string]float64) string {
+	totals := map[string]float64{}
+	for _, terms := range weights {
+		for term, weight := range terms {
+			totals[term] += weight
+		}
+	}
+
+	terms := make([]string, 0, len(totals))
+	for term := range totals {
+		terms = append(terms, term)
+	}
+	sort.Slice(terms, func(a, b int) bool {
+		if totals[terms[a]] != totals[terms[b]] {
+			return totals[terms[a]] > totals[terms[b]]
+		}
+		return terms[a] < terms[b]
+	})
+
+	if len(terms) > clusterLabelTerms {
+		terms = terms[:clusterLabelTerms]
+	}
+	return strings.Join(terms, ", ")
+}
@@ -0,0 +1,30 @@
+package libs
+
+import (
+	"fmt"
+
+	"github.com/sarwanazhar/boardsar/backend/config"
+)
+
+// settings is the configuration the backend was started with. Until
+// Configure is called it holds the defaults, with no JWT secret.
+var settings = config.Default()
+
+// Configure hands the loaded configuration to the libs that use it, checking
+// what only they can: the CORS origins' patterns
+func Configure(cfg *config.Config) error {
+	var matcher originMatcher
+	for _, entry := range cfg.CORSOrigins {
+		if err := matcher.add(entry); err != nil {
+			return fmt.Errorf("CORS_ALLOWED_ORIGINS: %w", err)
+		}
+	}
+	settings = cfg
+	SetReadOnlyMode(cfg.ReadOnly, cfg.StandbyURL)
+	return nil
+}
+
+// Settings is the configuration the backend was started with
+func Settings() *config.Config {
+	return settings
+}
@@ -0,0 +1,354 @@
+package libs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sarwanazhar/boardsar/backend/database"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	corsTenantCollection = "cors_tenants"
+
+	// maxRejectedOrigins caps the distinct rejected origins tracked, so
+	// random Origin headers can't grow the metrics without bound
+	maxRejectedOrigins = 100
+)
+
+// CORS configuration errors
+var (
+	ErrInvalidTenantName = errors.New("tenant names are 1-40 lowercase letters, digits and dashes")
+	ErrInvalidOrigin     = errors.New("origins are scheme://host[:port], with * for one subdomain label, or a /regex/")
+	ErrInvalidDomain     = errors.New("vanity domains are host names like whiteboard.example.com")
+)
+
+var (
+	validTenantName = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,39}$`)
+	validDomain     = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]*[a-z0-9])?\.)+[a-z]{2,}$`)
+)
+
+// originMatcher matches request origins against exact origins and patterns
+type originMatcher struct {
+	exact    map[string]bool
+	patterns []*regexp.Regexp
+}
+
+func (m originMatcher) match(origin string) bool {
+	if m.exact[origin] {
+		return true
+	}
+	for _, pattern := range m.patterns {
+		if pattern.MatchString(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *originMatcher) add(entry string) error {
+	exact, pattern, err := compileOrigin(entry)
+	if err != nil {
+		return err
+	}
+	if pattern != nil {
+		m.patterns = append(m.patterns, pattern)
+		return nil
+	}
+	if m.exact == nil {
+		m.exact = map[string]bool{}
+	}
+	m.exact[exact] = true
+	return nil
+}
+
+// compileOrigin parses one allowed origin: exact, with * standing for one
+// subdomain label, or a /regex/ (as gin-contrib/cors writes them), which is
+// anchored to the whole origin
+func compileOrigin(entry string) (string, *regexp.Regexp, error) {
+	entry = strings.TrimSpace(entry)
+	if len(entry) > 2 && strings.HasPrefix(entry, "/") && strings.HasSuffix(entry, "/") {
+		pattern, err := regexp.Compile(`^(?:` + entry[1:len(entry)-1] + `)$`)
+		if err != nil {
+			return "", nil, fmt.Errorf("%w: %v", ErrInvalidOrigin, err)
+		}
+		return "", pattern, nil
+	}
+
+	entry = strings.ToLower(strings.TrimSuffix(entry, "/"))
+	parsed, err := url.Parse(strings.ReplaceAll(entry, "*", "wildcard"))
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" || parsed.Path != "" || parsed.RawQuery != "" {
+		return "", nil, fmt.Errorf("%w: %q", ErrInvalidOrigin, entry)
+	}
+	if !strings.Contains(entry, "*") {
+		return entry, nil, nil
+	}
+
+	parts := strings.Split(entry, "*")
+	for i := range parts {
+		parts[i] = regexp.QuoteMeta(parts[i])
+	}
+	return "", regexp.MustCompile(`^` + strings.Join(parts, `[a-z0-9-]+`) + `$`), nil
+}
+
+var corsOrigins = struct {
+	sync.RWMutex
+	env     originMatcher
+	tenants originMatcher
+}{}
+
+// LoadEnvCORSOrigins takes the origins allowed for every tenant from the
+// configuration's CORS_ALLOWED_ORIGINS. Invalid entries are logged and
+// skipped; Configure refuses them at startup.
+func LoadEnvCORSOrigins() {
+	var matcher originMatcher
+	for _, entry := range settings.CORSOrigins {
+		if err := matcher.add(entry); err != nil {
+			slog.Warn("Skipping CORS origin", "error", err)
+		}
+	}
+
+	corsOrigins.Lock()
+	corsOrigins.env = matcher
+	corsOrigins.Unlock()
+}
+
+// EnvCORSOrigins lists the origins configured through the environment
+func EnvCORSOrigins() []string {
+	return settings.CORSOrigins
+}
+
+// CORSMaxAge is how long browsers may cache preflight responses, from
+// CORS_MAX_AGE
+func CORSMaxAge() time.Duration {
+	return settings.CORSMaxAge
+}
+
+// AllowOrigin reports whether a browser on origin may call the API, and
+// records the outcome in the CORS metrics. Used for CORS and for WebSocket
+// origin checks.
+func AllowOrigin(r *http.Request, origin string) bool {
+	corsOrigins.RLock()
+	allowed := corsOrigins.env.match(origin) || corsOrigins.tenants.match(origin)
+	corsOrigins.RUnlock()
+
+	preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+	if allowed {
+		recordAllowedOrigin(preflight)
+	} else {
+		recordRejectedOrigin(r, origin, preflight)
+	}
+	return allowed
+}
+
+func GetCORSTenantCollection() *mongo.Collection {
+	return database.GetCollection(corsTenantCollection)
+}
+
+// SaveCORSTenant sets a tenant's allowed origins and vanity domains, and
+// applies them on this instance right away
+func SaveCORSTenant(ctx context.Context, tenant string, origins, domains []string, userID primitive.ObjectID) (*models.CORSTenant, error) {
+	if !validTenantName.MatchString(tenant) {
+		return nil, ErrInvalidTenantName
+	}
+	for _, origin := range origins {
+		if _, _, err := compileOrigin(origin); err != nil {
+			return nil, err
+		}
+	}
+	normalized := make([]string, 0, len(domains))
+	for _, domain := range domains {
+		domain = strings.ToLower(strings.TrimSpace(domain))
+		if !validDomain.MatchString(domain) {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidDomain, domain)
+		}
+		normalized = append(normalized, domain)
+	}
+	if origins == nil {
+		origins = []string{}
+	}
+
+	now := time.Now()
+	var doc models.CORSTenant
+	err := GetCORSTenantCollection().FindOneAndUpdate(ctx,
+		bson.M{"_id": tenant},
+		bson.M{
+			"$set": bson.M{
+				"origins":       origins,
+				"vanityDomains": normalized,
+				"updatedBy":     userID,
+				"updatedAt":     now,
+			},
+			"$setOnInsert": bson.M{"createdAt": now},
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&doc)
+	if err != nil {
+		return nil, fmt.Errorf("error saving CORS tenant: %w", err)
+	}
+
+	if err := LoadCORSTenants(ctx); err != nil {
+		slog.Warn("Failed to reload CORS origins", "error", err)
+	}
+	return &doc, nil
+}
+
+// DeleteCORSTenant removes a tenant's origins
+func DeleteCORSTenant(ctx context.Context, tenant string) (bool, error) {
+	result, err := GetCORSTenantCollection().DeleteOne(ctx, bson.M{"_id": tenant})
+	if err != nil {
+		return false, fmt.Errorf("error deleting CORS tenant: %w", err)
+	}
+	if err := LoadCORSTenants(ctx); err != nil {
+		slog.Warn("Failed to reload CORS origins", "error", err)
+	}
+	return result.DeletedCount > 0, nil
+}
+
+// ListCORSTenants returns every tenant's origins
+func ListCORSTenants(ctx context.Context) ([]models.CORSTenant, error) {
+	cursor, err := GetCORSTenantCollection().Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+
+	tenants := []models.CORSTenant{}
+	if err := cursor.All(ctx, &tenants); err != nil {
+		return nil, err
+	}
+	return tenants, nil
+}
+
+// LoadCORSTenants replaces this instance's tenant origins with the stored
+// ones. An origin that no longer parses is logged and skipped.
+func LoadCORSTenants(ctx context.Context) error {
+	tenants, err := ListCORSTenants(ctx)
+	if err != nil {
+		return fmt.Errorf("error loading CORS tenants: %w", err)
+	}
+
+	var matcher originMatcher
+	for _, tenant := range tenants {
+		for _, origin := range tenant.Origins {
+			if err := matcher.add(origin); err != nil {
+				slog.Warn("Skipping CORS origin of tenant", "tenant", tenant.Tenant, "error", err)
+			}
+		}
+		for _, domain := range tenant.VanityDomains {
+			if err := matcher.add("https://" + domain); err != nil {
+				slog.Warn("Skipping vanity domain of tenant", "tenant", tenant.Tenant, "error", err)
+			}
+		}
+	}
+
+	corsOrigins.Lock()
+	corsOrigins.tenants = matcher
+	corsOrigins.Unlock()
+	return nil
+}
+
+// RunCORSTenantRefresh reloads the stored tenant origins periodically, so
+// changes made through another instance apply here too. It blocks until ctx
+// is cancelled.
+func RunCORSTenantRefresh(ctx context.Context) {
+	interval := settings.Intervals.CORSRefresh
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		loadCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		if err := LoadCORSTenants(loadCtx); err != nil {
+			slog.Warn("CORS origin refresh failed", "error", err)
+		}
+		cancel()
+	}
+}
+
+var corsMetrics = struct {
+	sync.Mutex
+	allowed            int64
+	allowedPreflights  int64
+	rejected           int64
+	rejectedPreflights int64
+	origins            map[string]*models.RejectedOrigin
+}{origins: map[string]*models.RejectedOrigin{}}
+
+func recordAllowedOrigin(preflight bool) {
+	corsMetrics.Lock()
+	defer corsMetrics.Unlock()
+	corsMetrics.allowed++
+	if preflight {
+		corsMetrics.allowedPreflights++
+	}
+}
+
+func recordRejectedOrigin(r *http.Request, origin string, preflight bool) {
+	corsMetrics.Lock()
+	defer corsMetrics.Unlock()
+	corsMetrics.rejected++
+	if preflight {
+		corsMetrics.rejectedPreflights++
+	}
+
+	rejected, ok := corsMetrics.origins[origin]
+	if !ok {
+		if len(corsMetrics.origins) >= maxRejectedOrigins {
+			return
+		}
+		slog.Warn("CORS: rejected origin", "origin", origin, "method", r.Method, "path", r.URL.Path)
+		rejected = &models.RejectedOrigin{Origin: origin}
+		corsMetrics.origins[origin] = rejected
+	}
+	rejected.Count++
+	rejected.LastMethod = r.Method
+	if preflight {
+		rejected.Preflights++
+		rejected.LastMethod = r.Header.Get("Access-Control-Request-Method")
+	}
+	rejected.LastPath = r.URL.Path
+	rejected.LastSeen = time.Now()
+}
+
+// GetCORSMetrics returns the CORS counters of this instance
+func GetCORSMetrics() models.CORSMetrics {
+	corsMetrics.Lock()
+	defer corsMetrics.Unlock()
+
+	metrics := models.CORSMetrics{
+		Allowed:            corsMetrics.allowed,
+		AllowedPreflights:  corsMetrics.allowedPreflights,
+		Rejected:           corsMetrics.rejected,
+		RejectedPreflights: corsMetrics.rejectedPreflights,
+		MaxAgeSeconds:      int64(CORSMaxAge().Seconds()),
+		RejectedOrigins:    make([]models.RejectedOrigin, 0, len(corsMetrics.origins)),
+	}
+	for _, rejected := range corsMetrics.origins {
+		metrics.RejectedOrigins = append(metrics.RejectedOrigins, *rejected)
+	}
+	sort.Slice(metrics.RejectedOrigins, func(i, j int) bool {
+		if metrics.RejectedOrigins[i].Count != metrics.RejectedOrigins[j].Count {
+			return metrics.RejectedOrigins[i].Count > metrics.RejectedOrigins[j].Count
+		}
+		return metrics.RejectedOrigins[i].Origin < metrics.RejectedOrigins[j].Origin
+	})
+	return metrics
+}
@@ -0,0 +1,230 @@
+package libs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/sarwanazhar/boardsar/backend/database"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const pendingDeletionCollection = "pending_deletions"
+
+const (
+	// deletionClaimLease is how long a claimed deletion is left to the
+	// instance carrying it out before another may take it over
+	deletionClaimLease = 15 * time.Minute
+)
+
+// ErrInvalidDeletionToken is returned for unknown deletion tokens, and those
+// whose deletion was canceled or carried out. The text is safe to return to
+// clients.
+var ErrInvalidDeletionToken = errors.New("Invalid or expired deletion link")
+
+// ErrNoPendingDeletion is returned when there is no pending deletion to
+// cancel, or it is being carried out. The text is safe to return to
+// clients.
+var ErrNoPendingDeletion = errors.New("No deletion is scheduled")
+
+// ErrDeletionBlocked is returned by the callback carrying out a deletion
+// when it no longer may be, such as once a legal hold is placed. The
+// deletion is dropped rather than retried.
+var ErrDeletionBlocked = errors.New("deletion is blocked")
+
+func GetPendingDeletionCollection() *mongo.Collection {
+	return database.GetCollection(pendingDeletionCollection)
+}
+
+// DeletionGracePeriod is how long a deleted board or account is kept before
+// it is removed for good. DELETION_GRACE_PERIOD is a duration such as
+// "72h"; "0" or "off" deletes at once.
+func DeletionGracePeriod() time.Duration {
+	return settings.DeletionGracePeriod
+}
+
+// ScheduleDeletion schedules the account's deletion, or that of the board
+// when boardID is set, once the grace period is over, and returns it with a
+// new token for the owner. Scheduling it again keeps the time it was first
+// scheduled for; only the newest token works.
+func ScheduleDeletion(ctx context.Context, kind string, userID primitive.ObjectID, boardID *primitive.ObjectID) (*models.PendingDeletion, string, error) {
+	token, tokenHash, err := newSecretToken()
+	if err != nil {
+		return nil, "", fmt.Errorf("error generating deletion token: %w", err)
+	}
+
+	now := time.Now()
+	update := bson.M{
+		"$set": bson.M{"tokenHash": tokenHash},
+		"$setOnInsert": bson.M{
+			"deleteAt":  now.Add(DeletionGracePeriod()),
+			"createdAt": now,
+		},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var deletion models.PendingDeletion
+	err = GetPendingDeletionCollection().FindOneAndUpdate(ctx, deletionFilter(kind, userID, boardID), update, opts).Decode(&deletion)
+	if err != nil {
+		return nil, "", fmt.Errorf("error scheduling deletion: %w", err)
+	}
+	return &deletion, token, nil
+}
+
+// FindPendingDeletion returns the account's pending deletion, or that of
+// the board when boardID is set, or nil without one
+func FindPendingDeletion(ctx context.Context, kind string, userID primitive.ObjectID, boardID *primitive.ObjectID) (*models.PendingDeletion, error) {
+	var deletion models.PendingDeletion
+	err := GetPendingDeletionCollection().FindOne(ctx, deletionFilter(kind, userID, boardID)).Decode(&deletion)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error finding pending deletion: %w", err)
+	}
+	return &deletion, nil
+}
+
+// CancelDeletion cancels the account's pending deletion, or that of the
+// board when boardID is set
+func CancelDeletion(ctx context.Context, kind string, userID primitive.ObjectID, boardID *primitive.ObjectID) (*models.PendingDeletion, error) {
+	deletion, err := cancelDeletion(ctx, deletionFilter(kind, userID, boardID))
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNoPendingDeletion
+	}
+	return deletion, err
+}
+
+// CancelDeletionByToken cancels the pending deletion a token was sent for
+func CancelDeletionByToken(ctx context.Context, token string) (*models.PendingDeletion, error) {
+	deletion, err := cancelDeletion(ctx, bson.M{"tokenHash": hashToken(token)})
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrInvalidDeletionToken
+	}
+	return deletion, err
+}
+
+// ClaimDeletionByToken takes the pending deletion a token was sent for, to
+// carry it out before its grace period is over
+func ClaimDeletionByToken(ctx context.Context, token string) (*models.PendingDeletion, error) {
+	deletion, err := claimDeletion(ctx, bson.M{"tokenHash": hashToken(token)})
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrInvalidDeletionToken
+	}
+	return deletion, err
+}
+
+// CarryOutDeletion calls complete with a claimed deletion and drops it once
+// done, or once complete returns ErrDeletionBlocked. On other errors the
+// claim is released, so it is tried again.
+func CarryOutDeletion(ctx context.Context, deletion *models.PendingDeletion, complete func(ctx context.Context, deletion *models.PendingDeletion) error) error {
+	err := complete(ctx, deletion)
+	if err != nil && !errors.Is(err, ErrDeletionBlocked) {
+		if _, releaseErr := GetPendingDeletionCollection().UpdateOne(context.WithoutCancel(ctx),
+			bson.M{"_id": deletion.ID},
+			bson.M{"$unset": bson.M{"claimedAt": ""}},
+		); releaseErr != nil {
+			slog.Warn("Failed to release pending deletion", "deletion_id", deletion.ID.Hex(), "error", releaseErr)
+		}
+		return err
+	}
+
+	if _, dropErr := GetPendingDeletionCollection().DeleteOne(context.WithoutCancel(ctx), bson.M{"_id": deletion.ID}); dropErr != nil {
+		return fmt.Errorf("error dropping pending deletion: %w", dropErr)
+	}
+	return err
+}
+
+// RunPendingDeletions carries out deletions as their grace period ends,
+// every DELETION_INTERVAL until ctx is done, calling complete with each
+func RunPendingDeletions(ctx context.Context, complete func(ctx context.Context, deletion *models.PendingDeletion) error) {
+	ticker := time.NewTicker(settings.Intervals.Deletion)
+	defer ticker.Stop()
+
+	for {
+		carryOutDueDeletions(ctx, complete)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// carryOutDueDeletions carries out the deletions whose grace period is over,
+// one claim at a time so other instances share the work
+func carryOutDueDeletions(ctx context.Context, complete func(ctx context.Context, deletion *models.PendingDeletion) error) {
+	for ctx.Err() == nil {
+		deletion, err := claimDeletion(ctx, bson.M{"deleteAt": bson.M{"$lte": time.Now()}})
+		if err == mongo.ErrNoDocuments {
+			return
+		}
+		if err != nil {
+			if ctx.Err() == nil {
+				slog.Warn("Failed to claim pending deletion", "error", err)
+			}
+			return
+		}
+
+		err = CarryOutDeletion(ctx, deletion, complete)
+		switch {
+		case errors.Is(err, ErrDeletionBlocked):
+			slog.Info("Dropped blocked deletion", "kind", deletion.Kind, "user_id", deletion.UserID.Hex(), "deletion_id", deletion.ID.Hex())
+		case err != nil:
+			// Left for the next run
+			slog.Warn("Failed to carry out deletion", "kind", deletion.Kind, "deletion_id", deletion.ID.Hex(), "error", err)
+			return
+		}
+	}
+}
+
+// claimDeletion marks a pending deletion matching filter as being carried
+// out, unless another instance is carrying it out
+func claimDeletion(ctx context.Context, filter bson.M) (*models.PendingDeletion, error) {
+	now := time.Now()
+	filter["$or"] = bson.A{
+		bson.M{"claimedAt": bson.M{"$exists": false}},
+		bson.M{"claimedAt": bson.M{"$lt": now.Add(-deletionClaimLease)}},
+	}
+
+	var deletion models.PendingDeletion
+	err := GetPendingDeletionCollection().FindOneAndUpdate(ctx, filter,
+		bson.M{"$set": bson.M{"claimedAt": now}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&deletion)
+	if err != nil {
+		return nil, err
+	}
+	return &deletion, nil
+}
+
+// cancelDeletion removes a pending deletion matching filter, unless it is
+// being carried out
+func cancelDeletion(ctx context.Context, filter bson.M) (*models.PendingDeletion, error) {
+	filter["claimedAt"] = bson.M{"$exists": false}
+
+	var deletion models.PendingDeletion
+	err := GetPendingDeletionCollection().FindOneAndDelete(ctx, filter).Decode(&deletion)
+	if err == mongo.ErrNoDocuments {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error canceling deletion: %w", err)
+	}
+	return &deletion, nil
+}
+
+func deletionFilter(kind string, userID primitive.ObjectID, boardID *primitive.ObjectID) bson.M {
+	filter := bson.M{"kind": kind, "userId": userID}
+	if boardID != nil {
+		filter["boardId"] = *boardID
+	}
+	return filter
+}
@@ -0,0 +1,82 @@
+package libs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sarwanazhar/boardsar/backend/database"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const emailChangeCollection = "email_changes"
+
+// ErrInvalidEmailChange is returned for unknown, expired or used email
+// change tokens. The text is safe to return to clients.
+var ErrInvalidEmailChange = errors.New("Invalid or expired confirmation link")
+
+func GetEmailChangeCollection() *mongo.Collection {
+	return database.GetCollection(emailChangeCollection)
+}
+
+// EmailChangeTTL is how long an email change confirmation stays valid
+func EmailChangeTTL() time.Duration {
+	return settings.EmailChangeTTL
+}
+
+// CreateEmailChange stores a new confirmation token for moving the user to
+// email and returns it. Links sent for earlier requests stop working.
+func CreateEmailChange(ctx context.Context, userID primitive.ObjectID, email string) (string, error) {
+	token, tokenHash, err := newSecretToken()
+	if err != nil {
+		return "", fmt.Errorf("error generating confirmation token: %w", err)
+	}
+
+	now := time.Now()
+	_, err = GetEmailChangeCollection().UpdateMany(ctx,
+		bson.M{"userId": userID, "usedAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"usedAt": now}},
+	)
+	if err != nil {
+		return "", fmt.Errorf("error invalidating confirmation tokens: %w", err)
+	}
+
+	_, err = GetEmailChangeCollection().InsertOne(ctx, models.EmailChange{
+		ID:        primitive.NewObjectID(),
+		UserID:    userID,
+		Email:     email,
+		TokenHash: tokenHash,
+		CreatedAt: now,
+		ExpiresAt: now.Add(EmailChangeTTL()),
+	})
+	if err != nil {
+		return "", fmt.Errorf("error storing confirmation token: %w", err)
+	}
+	return token, nil
+}
+
+// ConsumeEmailChange marks a confirmation token used and returns it
+func ConsumeEmailChange(ctx context.Context, token string) (*models.EmailChange, error) {
+	now := time.Now()
+
+	var change models.EmailChange
+	err := GetEmailChangeCollection().FindOneAndUpdate(ctx,
+		bson.M{
+			"tokenHash": hashToken(token),
+			"usedAt":    bson.M{"$exists": false},
+			"expiresAt": bson.M{"$gt": now},
+		},
+		bson.M{"$set": bson.M{"usedAt": now}},
+	).Decode(&change)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrInvalidEmailChange
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error checking confirmation token: %w", err)
+	}
+	return &change, nil
+}
@@ -0,0 +1,78 @@
+package libs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ErrNoEmbeddingProvider is returned when EMBEDDINGS_URL is not set
+var ErrNoEmbeddingProvider = errors.New("no embedding provider configured")
+
+// EmbeddingsConfigured reports whether an embedding provider is set up
+func EmbeddingsConfigured() bool {
+	return settings.EmbeddingsURL != ""
+}
+
+// EmbedTexts turns texts into embedding vectors using the provider at
+// EMBEDDINGS_URL. The provider must speak the OpenAI-style embeddings API:
+// {"model", "input": [...]} in, {"data": [{"index", "embedding"}]} out.
+// EMBEDDINGS_API_KEY and EMBEDDINGS_MODEL are optional.
+func EmbedTexts(ctx context.Context, texts []string) ([][]float64, error) {
+	url := settings.EmbeddingsURL
+	if url == "" {
+		return nil, ErrNoEmbeddingProvider
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"model": settings.EmbeddingsModel,
+		"input": texts,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if key := settings.EmbeddingsAPIKey; key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error calling embedding provider: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("embedding provider returned %s", resp.Status)
+	}
+
+	var result struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float64 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("error decoding embeddings: %w", err)
+	}
+	if len(result.Data) != len(texts) {
+		return nil, fmt.Errorf("embedding provider returned %d vectors for %d texts", len(result.Data), len(texts))
+	}
+
+	vectors := make([][]float64, len(texts))
+	for _, item := range result.Data {
+		if item.Index < 0 || item.Index >= len(texts) {
+			return nil, fmt.Errorf("embedding provider returned index %d out of range", item.Index)
+		}
+		vectors[item.Index] = item.Embedding
+	}
+	return vectors, nil
+}
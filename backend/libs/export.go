@@ -0,0 +1,83 @@
+package libs
+
+import (
+	"context"
+	"errors"
+
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Export policy errors
+var (
+	ErrExportsDisabled  = errors.New("exports are disabled on this board")
+	ErrExportsOwnerOnly = errors.New("only the owner can export this board")
+)
+
+// CheckExportPolicy reports whether userID may export the board under the
+// owner's export policy. Access to the board itself is checked separately.
+func CheckExportPolicy(board *models.Board, userID primitive.ObjectID) error {
+	switch board.ExportPolicy {
+	case models.ExportPolicyDisabled:
+		return ErrExportsDisabled
+	case models.ExportPolicyOwner:
+		if board.OwnerID != userID {
+			return ErrExportsOwnerOnly
+		}
+	}
+	return nil
+}
+
+// SelectShapes narrows a board state to the shapes with the given IDs. With
+// no IDs the state is returned as is.
+func SelectShapes(data map[string]interface{}, shapeIDs []string) map[string]interface{} {
+	list, ok := ShapeList(data)
+	if !ok || len(shapeIDs) == 0 {
+		return data
+	}
+
+	wanted := make(map[string]bool, len(shapeIDs))
+	for _, id := range shapeIDs {
+		wanted[id] = true
+	}
+
+	selected := make(map[string]interface{}, len(data))
+	for key, value := range data {
+		selected[key] = value
+	}
+	shapes := []interface{}{}
+	for _, item := range list {
+		if shape, ok := item.(map[string]interface{}); ok {
+			if id, _ := shape["id"].(string); wanted[id] {
+				shapes = append(shapes, item)
+			}
+		}
+	}
+	selected["shapes"] = shapes
+	return selected
+}
+
+// ListBoardExports returns the most recent exports of a board from the
+// audit log, newest first
+func ListBoardExports(ctx context.Context, boardID primitive.ObjectID, limit int64) ([]models.AuditEvent, error) {
+	filter := bson.M{
+		"action":      models.AuditBoardExported,
+		"target.type": models.AuditTargetBoard,
+		"target.id":   boardID.Hex(),
+	}
+
+	found, err := GetAuditCollection().Find(ctx, filter, options.Find().
+		SetSort(bson.D{{Key: "_id", Value: -1}}).
+		SetLimit(limit))
+	if err != nil {
+		return nil, err
+	}
+
+	events := []models.AuditEvent{}
+	if err := found.All(ctx, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
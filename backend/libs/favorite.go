@@ -0,0 +1,66 @@
+package libs
+
+import (
+	"context"
+	"time"
+
+	"github.com/sarwanazhar/boardsar/backend/database"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const favoriteCollection = "favorites"
+
+func GetFavoriteCollection() *mongo.Collection {
+	return database.GetCollection(favoriteCollection)
+}
+
+// StarBoard stars the board for the user. Starring it again keeps the
+// original star.
+func StarBoard(ctx context.Context, userID, boardID primitive.ObjectID) error {
+	_, err := GetFavoriteCollection().UpdateOne(ctx,
+		bson.M{"userId": userID, "boardId": boardID},
+		bson.M{"$setOnInsert": bson.M{"createdAt": time.Now()}},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+// UnstarBoard removes the user's star from the board
+func UnstarBoard(ctx context.Context, userID, boardID primitive.ObjectID) error {
+	_, err := GetFavoriteCollection().DeleteOne(ctx, bson.M{"userId": userID, "boardId": boardID})
+	return err
+}
+
+// StarredBoardIDs returns the IDs of the boards the user starred. Pass
+// boardIDs to only check those boards.
+func StarredBoardIDs(ctx context.Context, userID primitive.ObjectID, boardIDs []primitive.ObjectID) ([]primitive.ObjectID, error) {
+	filter := bson.M{"userId": userID}
+	if boardIDs != nil {
+		filter["boardId"] = bson.M{"$in": boardIDs}
+	}
+
+	cursor, err := GetFavoriteCollection().Find(ctx, filter, options.Find().SetProjection(bson.M{"boardId": 1}))
+	if err != nil {
+		return nil, err
+	}
+
+	var favorites []models.Favorite
+	if err := cursor.All(ctx, &favorites); err != nil {
+		return nil, err
+	}
+	ids := make([]primitive.ObjectID, 0, len(favorites))
+	for _, favorite := range favorites {
+		ids = append(ids, favorite.BoardID)
+	}
+	return ids, nil
+}
+
+// DeleteBoardFavorites removes every star of a deleted board
+func DeleteBoardFavorites(ctx context.Context, boardID primitive.ObjectID) error {
+	_, err := GetFavoriteCollection().DeleteMany(ctx, bson.M{"boardId": boardID})
+	return err
+}
@@ -0,0 +1,131 @@
+package libs
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sarwanazhar/boardsar/backend/database"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const folderCollection = "folders"
+
+func GetFolderCollection() *mongo.Collection {
+	return database.GetCollection(folderCollection)
+}
+
+// CreateFolder adds a folder for the user. Folder names are unique per user,
+// so a taken name fails with a duplicate key error.
+func CreateFolder(ctx context.Context, ownerID primitive.ObjectID, name string) (*models.Folder, error) {
+	now := time.Now()
+	folder := models.Folder{
+		ID:        primitive.NewObjectID(),
+		OwnerID:   ownerID,
+		Name:      name,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if _, err := GetFolderCollection().InsertOne(ctx, folder); err != nil {
+		return nil, err
+	}
+	return &folder, nil
+}
+
+// ListFolders returns the user's folders by name
+func ListFolders(ctx context.Context, ownerID primitive.ObjectID) ([]models.Folder, error) {
+	cursor, err := GetFolderCollection().Find(ctx, bson.M{"ownerId": ownerID}, options.Find().SetSort(bson.M{"name": 1}))
+	if err != nil {
+		return nil, err
+	}
+
+	folders := []models.Folder{}
+	if err := cursor.All(ctx, &folders); err != nil {
+		return nil, err
+	}
+	return folders, nil
+}
+
+// FindFolder loads one of the user's folders
+func FindFolder(ctx context.Context, folderID string, ownerID primitive.ObjectID) (*models.Folder, error) {
+	id, err := primitive.ObjectIDFromHex(folderID)
+	if err != nil {
+		return nil, mongo.ErrNoDocuments
+	}
+
+	var folder models.Folder
+	if err := GetFolderCollection().FindOne(ctx, bson.M{"_id": id, "ownerId": ownerID}).Decode(&folder); err != nil {
+		return nil, err
+	}
+	return &folder, nil
+}
+
+// RenameFolder renames one of the user's folders
+func RenameFolder(ctx context.Context, folderID string, ownerID primitive.ObjectID, name string) (*models.Folder, error) {
+	id, err := primitive.ObjectIDFromHex(folderID)
+	if err != nil {
+		return nil, mongo.ErrNoDocuments
+	}
+
+	var folder models.Folder
+	err = GetFolderCollection().FindOneAndUpdate(ctx,
+		bson.M{"_id": id, "ownerId": ownerID},
+		bson.M{"$set": bson.M{"name": name, "updatedAt": time.Now()}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&folder)
+	if err != nil {
+		return nil, err
+	}
+	return &folder, nil
+}
+
+// DeleteFolder removes one of the user's folders. Its boards are kept and
+// taken out of the folder.
+func DeleteFolder(ctx context.Context, folderID primitive.ObjectID, ownerID primitive.ObjectID) (bool, error) {
+	result, err := GetFolderCollection().DeleteOne(ctx, bson.M{"_id": folderID, "ownerId": ownerID})
+	if err != nil {
+		return false, fmt.Errorf("error deleting folder: %w", err)
+	}
+	if result.DeletedCount == 0 {
+		return false, nil
+	}
+
+	_, err = database.GetCollection("boards").UpdateMany(ctx,
+		bson.M{"ownerId": ownerID, "folderId": folderID},
+		bson.M{"$unset": bson.M{"folderId": ""}},
+	)
+	if err != nil {
+		return true, fmt.Errorf("error emptying folder: %w", err)
+	}
+	_, err = GetBoardSummaryCollection().UpdateMany(ctx,
+		bson.M{"ownerId": ownerID, "folderId": folderID},
+		bson.M{"$unset": bson.M{"folderId": ""}},
+	)
+	if err != nil {
+		return true, fmt.Errorf("error emptying folder: %w", err)
+	}
+	return true, nil
+}
+
+// NormalizeTags trims and lowercases tags, dropping empty ones and
+// duplicates, so filtering by tag doesn't depend on how it was typed
+func NormalizeTags(tags []string) []string {
+	seen := map[string]bool{}
+	normalized := []string{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	sort.Strings(normalized)
+	return normalized
+}
@@ -0,0 +1,66 @@
+package libs
+
+// SharedFrame is the frame a frame-scoped share link or embed token shows,
+// so the viewer can fit it to the screen
+type SharedFrame struct {
+	ID     string  `json:"id"`
+	Title  string  `json:"title,omitempty"`
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+// FindFrame returns the shape of a board state with the given ID if it is a
+// frame (or a rectangle, which can hold others), or nil
+func FindFrame(data map[string]interface{}, id string) map[string]interface{} {
+	shape := FindShape(data, id)
+	if shape == nil || !isFrameShape(shape) {
+		return nil
+	}
+	if _, ok := ShapeBounds(shape); !ok {
+		return nil
+	}
+	return shape
+}
+
+// FrameBoardData narrows a board state to a frame and the shapes that lie
+// wholly inside it, for links scoped to the frame. Shapes with no position
+// to place them by are left out. It returns false when the frame is gone.
+func FrameBoardData(data map[string]interface{}, frameID string) (map[string]interface{}, *SharedFrame, bool) {
+	frame := FindFrame(data, frameID)
+	if frame == nil {
+		return nil, nil, false
+	}
+	bounds, _ := ShapeBounds(frame)
+
+	scoped := make(map[string]interface{}, len(data))
+	for key, value := range data {
+		scoped[key] = value
+	}
+	shapes := []interface{}{}
+	list, _ := ShapeList(data)
+	for _, item := range list {
+		shape, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if id, _ := shape["id"].(string); id == frameID {
+			shapes = append(shapes, item)
+			continue
+		}
+		if inner, ok := ShapeBounds(shape); ok && bounds.contains(inner) {
+			shapes = append(shapes, item)
+		}
+	}
+	scoped["shapes"] = shapes
+
+	return scoped, &SharedFrame{
+		ID:     frameID,
+		Title:  ShapeText(frame),
+		X:      bounds.X,
+		Y:      bounds.Y,
+		Width:  bounds.Width,
+		Height: bounds.Height,
+	}, true
+}
@@ -0,0 +1,293 @@
+package libs
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Formats a board's diagram can be exported to as a graph
+const (
+	GraphDOT     = "dot"
+	GraphGraphML = "graphml"
+)
+
+// GraphContentTypes maps each graph format to its MIME type
+var GraphContentTypes = map[string]string{
+	GraphDOT:     "text/vnd.graphviz",
+	GraphGraphML: "application/graphml+xml",
+}
+
+// connectorSnap is how far (in board units) the end of a line can be from a
+// shape and still connect to it
+const connectorSnap = 8.0
+
+// graphShapes are the Graphviz node shapes of board shape types; other
+// types are boxes
+var graphShapes = map[string]string{
+	"rect":    "box",
+	"circle":  "ellipse",
+	"sticky":  "note",
+	"polygon": "polygon",
+}
+
+// GraphNode is a shape that lines can connect
+type GraphNode struct {
+	ID    string
+	Type  string
+	Label string
+	Bounds
+}
+
+// GraphEdge is a line from one node to another, in the direction it was
+// drawn
+type GraphEdge struct {
+	ID     string
+	Source string
+	Target string
+	Label  string
+}
+
+// Graph is a board read as a diagram
+type Graph struct {
+	Name  string
+	Nodes []GraphNode
+	Edges []GraphEdge
+}
+
+// BoardGraph reads the diagram on a board state. Every shape with an area
+// is a node, except frames and text, and so is a closed line, as a polygon;
+// an open line is an edge when its two ends are on two different nodes,
+// the smallest under each end. Text grouped
+// with a single node, or with a line and no node, is its label.
+func BoardGraph(name string, data map[string]interface{}) Graph {
+	graph := Graph{Name: name, Nodes: []GraphNode{}, Edges: []GraphEdge{}}
+	entries := ShapeEntries(data)
+
+	groupText := map[string][]string{}
+	groupNodes := map[string]int{}
+	for _, entry := range entries {
+		group, _ := entry.Shape[ShapeGroupKey].(string)
+		switch graphRole(entry.Shape) {
+		case "text":
+			if text := ShapeText(entry.Shape); group != "" && text != "" {
+				groupText[group] = append(groupText[group], text)
+			}
+		case "node":
+			if group != "" {
+				groupNodes[group]++
+			}
+		}
+	}
+	label := func(shape map[string]interface{}, wantNodes int) string {
+		if text := ShapeText(shape); text != "" {
+			return text
+		}
+		group, _ := shape[ShapeGroupKey].(string)
+		if group == "" || groupNodes[group] != wantNodes {
+			return ""
+		}
+		return strings.Join(groupText[group], "\n")
+	}
+
+	for _, entry := range entries {
+		id, _ := entry.Shape["id"].(string)
+		if graphRole(entry.Shape) != "node" || id == "" {
+			continue
+		}
+		shapeType, _ := entry.Shape["type"].(string)
+		if shapeType == "line" {
+			shapeType = "polygon"
+		}
+		graph.Nodes = append(graph.Nodes, GraphNode{ID: id, Type: shapeType, Label: label(entry.Shape, 1), Bounds: entry.Bounds})
+	}
+
+	for _, entry := range entries {
+		if graphRole(entry.Shape) != "edge" {
+			continue
+		}
+		points, _ := shapePoints(entry.Shape)
+		if len(points) < 4 {
+			continue
+		}
+		source := graph.nodeAt(points[0], points[1])
+		target := graph.nodeAt(points[len(points)-2], points[len(points)-1])
+		if source == "" || target == "" || source == target {
+			continue
+		}
+		id, _ := entry.Shape["id"].(string)
+		graph.Edges = append(graph.Edges, GraphEdge{ID: id, Source: source, Target: target, Label: label(entry.Shape, 0)})
+	}
+	return graph
+}
+
+// graphRole is what a shape is in the diagram: a node, an edge, text, or
+// nothing
+func graphRole(shape map[string]interface{}) string {
+	shapeType, _ := shape["type"].(string)
+	switch shapeType {
+	case "line":
+		if points, ok := shapePoints(shape); ok && len(points) >= 8 &&
+			points[0] == points[len(points)-2] && points[1] == points[len(points)-1] {
+			return "node"
+		}
+		return "edge"
+	case "text":
+		return "text"
+	case "pen", "frame":
+		return ""
+	}
+	if _, ok := shape["points"]; ok {
+		return ""
+	}
+	return "node"
+}
+
+// nodeAt returns the ID of the smallest node within connectorSnap of the
+// point, or "" if there is none
+func (g Graph) nodeAt(x, y float64) string {
+	found, smallest := "", 0.0
+	for _, node := range g.Nodes {
+		if x < node.X-connectorSnap || x > node.X+node.Width+connectorSnap ||
+			y < node.Y-connectorSnap || y > node.Y+node.Height+connectorSnap {
+			continue
+		}
+		if area := node.area(); found == "" || area < smallest {
+			found, smallest = node.ID, area
+		}
+	}
+	return found
+}
+
+// WriteGraph writes the graph as a Graphviz DOT digraph or as GraphML
+func WriteGraph(w io.Writer, graph Graph, format string) error {
+	switch format {
+	case GraphDOT:
+		return writeDOT(w, graph)
+	case GraphGraphML:
+		return writeGraphML(w, graph)
+	}
+	return fmt.Errorf("unknown graph format %q", format)
+}
+
+func writeDOT(w io.Writer, graph Graph) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "digraph %s {\n", dotQuote(graph.Name))
+	for _, node := range graph.Nodes {
+		shape, ok := graphShapes[node.Type]
+		if !ok {
+			shape = "box"
+		}
+		fmt.Fprintf(&b, "  %s [label=%s, shape=%s];\n", dotQuote(node.ID), dotQuote(node.Label), shape)
+	}
+	for _, edge := range graph.Edges {
+		fmt.Fprintf(&b, "  %s -> %s", dotQuote(edge.Source), dotQuote(edge.Target))
+		if edge.Label != "" {
+			fmt.Fprintf(&b, " [label=%s]", dotQuote(edge.Label))
+		}
+		b.WriteString(";\n")
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// dotQuote makes a DOT string ID, with line breaks as \n
+func dotQuote(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`).Replace(s)
+	return `"` + s + `"`
+}
+
+// GraphML documents, as encoding/xml writes them
+type (
+	graphMLDocument struct {
+		XMLName xml.Name     `xml:"graphml"`
+		XMLNS   string       `xml:"xmlns,attr"`
+		Keys    []graphMLKey `xml:"key"`
+		Graph   graphMLGraph `xml:"graph"`
+	}
+	graphMLKey struct {
+		ID   string `xml:"id,attr"`
+		For  string `xml:"for,attr"`
+		Name string `xml:"attr.name,attr"`
+		Type string `xml:"attr.type,attr"`
+	}
+	graphMLGraph struct {
+		ID          string        `xml:"id,attr"`
+		EdgeDefault string        `xml:"edgedefault,attr"`
+		Data        []graphMLData `xml:"data"`
+		Nodes       []graphMLNode `xml:"node"`
+		Edges       []graphMLEdge `xml:"edge"`
+	}
+	graphMLNode struct {
+		ID   string        `xml:"id,attr"`
+		Data []graphMLData `xml:"data"`
+	}
+	graphMLEdge struct {
+		ID     string        `xml:"id,attr"`
+		Source string        `xml:"source,attr"`
+		Target string        `xml:"target,attr"`
+		Data   []graphMLData `xml:"data"`
+	}
+	graphMLData struct {
+		Key   string `xml:"key,attr"`
+		Value string `xml:",chardata"`
+	}
+)
+
+// graphMLKeys declare the attributes nodes and edges carry
+var graphMLKeys = []graphMLKey{
+	{ID: "name", For: "graph", Name: "name", Type: "string"},
+	{ID: "label", For: "node", Name: "label", Type: "string"},
+	{ID: "type", For: "node", Name: "type", Type: "string"},
+	{ID: "x", For: "node", Name: "x", Type: "double"},
+	{ID: "y", For: "node", Name: "y", Type: "double"},
+	{ID: "width", For: "node", Name: "width", Type: "double"},
+	{ID: "height", For: "node", Name: "height", Type: "double"},
+	{ID: "edgeLabel", For: "edge", Name: "label", Type: "string"},
+}
+
+func writeGraphML(w io.Writer, graph Graph) error {
+	number := func(value float64) string {
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+	doc := graphMLDocument{
+		XMLNS: "http://graphml.graphdrawing.org/xmlns",
+		Keys:  graphMLKeys,
+		Graph: graphMLGraph{
+			ID:          "board",
+			EdgeDefault: "directed",
+			Data:        []graphMLData{{Key: "name", Value: graph.Name}},
+		},
+	}
+	for _, node := range graph.Nodes {
+		doc.Graph.Nodes = append(doc.Graph.Nodes, graphMLNode{ID: node.ID, Data: []graphMLData{
+			{Key: "label", Value: node.Label},
+			{Key: "type", Value: node.Type},
+			{Key: "x", Value: number(node.X)},
+			{Key: "y", Value: number(node.Y)},
+			{Key: "width", Value: number(node.Width)},
+			{Key: "height", Value: number(node.Height)},
+		}})
+	}
+	for _, edge := range graph.Edges {
+		element := graphMLEdge{ID: edge.ID, Source: edge.Source, Target: edge.Target}
+		if edge.Label != "" {
+			element.Data = []graphMLData{{Key: "edgeLabel", Value: edge.Label}}
+		}
+		doc.Graph.Edges = append(doc.Graph.Edges, element)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
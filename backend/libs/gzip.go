@@ -0,0 +1,189 @@
+package libs
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// minGzipSize is the smallest response worth compressing; below it the
+// gzip framing costs about what it saves
+const minGzipSize = 1 << 10
+
+var gzipWriters = sync.Pool{
+	New: func() interface{} {
+		writer, _ := gzip.NewWriterLevel(nil, gzip.DefaultCompression)
+		return writer
+	},
+}
+
+// acceptsGzip reports whether an Accept-Encoding header takes gzip
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(coding), "gzip") && strings.TrimSpace(coding) != "*" {
+			continue
+		}
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				q = parsed
+			}
+		}
+		return q > 0
+	}
+	return false
+}
+
+// compressible reports whether a response of a content type shrinks when
+// gzipped. Images other than SVG, PDFs and archives are compressed already.
+func compressible(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	return strings.HasPrefix(mediaType, "text/") ||
+		strings.HasSuffix(mediaType, "json") || strings.HasSuffix(mediaType, "xml") ||
+		isMsgpack(mediaType) || mediaType == "image/svg+xml"
+}
+
+// gzipWriter compresses a response as it is written, once the first write
+// shows it is worth it
+type gzipWriter struct {
+	gin.ResponseWriter
+	gzip    *gzip.Writer
+	decided bool
+}
+
+// decide picks whether the response is compressed, from its headers and
+// its first write
+func (w *gzipWriter) decide(first int) {
+	if w.decided {
+		return
+	}
+	w.decided = true
+	header := w.ResponseWriter.Header()
+	if w.ResponseWriter.Written() || first < minGzipSize || header.Get("Content-Encoding") != "" || !compressible(header.Get("Content-Type")) {
+		return
+	}
+	header.Set("Content-Encoding", "gzip")
+	header.Del("Content-Length")
+	w.gzip = gzipWriters.Get().(*gzip.Writer)
+	w.gzip.Reset(w.ResponseWriter)
+}
+
+func (w *gzipWriter) Write(data []byte) (int, error) {
+	w.decide(len(data))
+	if w.gzip == nil {
+		return w.ResponseWriter.Write(data)
+	}
+	return w.gzip.Write(data)
+}
+
+func (w *gzipWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *gzipWriter) Flush() {
+	if w.gzip != nil {
+		w.gzip.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// close ends the compressed stream, if the response was compressed
+func (w *gzipWriter) close() {
+	if w.gzip == nil {
+		return
+	}
+	w.gzip.Close()
+	w.gzip.Reset(io.Discard)
+	gzipWriters.Put(w.gzip)
+	w.gzip = nil
+}
+
+// GzipMiddleware lets clients save data on large boards: request bodies
+// sent with Content-Encoding: gzip reach handlers decompressed, up to
+// MAX_REQUEST_BODY, and text, JSON, msgpack and SVG responses of 1 KB or
+// more are gzipped when the Accept-Encoding header takes gzip. Other
+// content encodings of requests are refused with 415.
+func GzipMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch encoding := strings.ToLower(strings.TrimSpace(c.GetHeader("Content-Encoding"))); encoding {
+		case "", "identity":
+		case "gzip":
+			if !decompressRequest(c) {
+				return
+			}
+		default:
+			c.AbortWithStatusJSON(http.StatusUnsupportedMediaType, gin.H{"error": "Request bodies can only be gzip-compressed"})
+			return
+		}
+
+		c.Writer.Header().Add("Vary", "Accept-Encoding")
+		if c.Request.Method == http.MethodHead || !acceptsGzip(c.GetHeader("Accept-Encoding")) {
+			c.Next()
+			return
+		}
+
+		writer := &gzipWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		defer func() {
+			writer.close()
+			c.Writer = writer.ResponseWriter
+		}()
+		c.Next()
+	}
+}
+
+// decompressRequest replaces a gzipped request body with what it expands
+// to, answering the request itself when it can't
+func decompressRequest(c *gin.Context) bool {
+	if c.Request.Body == nil || c.Request.Body == http.NoBody {
+		return true
+	}
+	reader, err := gzip.NewReader(c.Request.Body)
+	if err != nil {
+		if isBodyTooLarge(err) {
+			requestBodyTooLarge(c)
+		} else {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid gzip body: " + err.Error()})
+		}
+		return false
+	}
+	defer reader.Close()
+
+	// Stop one byte past the limit, to tell a body at the limit from one
+	// over it without expanding the rest
+	limit := settings.MaxRequestBody
+	var body bytes.Buffer
+	if _, err := io.Copy(&body, io.LimitReader(reader, limit+1)); err != nil {
+		if isBodyTooLarge(err) {
+			requestBodyTooLarge(c)
+		} else {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid gzip body: " + err.Error()})
+		}
+		return false
+	}
+	if int64(body.Len()) > limit {
+		requestBodyTooLarge(c)
+		return false
+	}
+
+	c.Request.Body = io.NopCloser(bytes.NewReader(body.Bytes()))
+	c.Request.ContentLength = int64(body.Len())
+	c.Request.Header.Del("Content-Encoding")
+	c.Request.Header.Set("Content-Length", strconv.Itoa(body.Len()))
+	return true
+}
+
+// isBodyTooLarge reports whether reading a body failed at MAX_REQUEST_BODY
+func isBodyTooLarge(err error) bool {
+	var tooLarge *http.MaxBytesError
+	return errors.As(err, &tooLarge)
+}
@@ -0,0 +1,82 @@
+package libs
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/sarwanazhar/boardsar/backend/database"
+	"github.com/sarwanazhar/boardsar/backend/models"
+)
+
+// readinessTimeout bounds each dependency's check
+const readinessTimeout = 2 * time.Second
+
+// dependencyCheck pings one dependency
+type dependencyCheck struct {
+	name  string
+	check func(context.Context) error
+}
+
+// dependencyChecks are the services this instance can't serve without:
+// MongoDB, and Redis when REDIS_URL is set
+func dependencyChecks() []dependencyCheck {
+	checks := []dependencyCheck{{name: "mongodb", check: database.PingMongo}}
+	if settings.RedisURL != "" {
+		checks = append(checks, dependencyCheck{name: "redis", check: pingRedis})
+	}
+	return checks
+}
+
+// CheckDependencies checks every dependency at once and reports how each
+// answered, and whether all are up
+func CheckDependencies(ctx context.Context) ([]models.DependencyHealth, bool) {
+	checks := dependencyChecks()
+	results := make([]models.DependencyHealth, len(checks))
+
+	var wg sync.WaitGroup
+	for i, dependency := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			checkCtx, cancel := context.WithTimeout(ctx, readinessTimeout)
+			defer cancel()
+
+			start := time.Now()
+			err := dependency.check(checkCtx)
+			results[i] = models.DependencyHealth{
+				Name:      dependency.name,
+				Status:    models.DependencyUp,
+				LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+			}
+			if err != nil {
+				results[i].Status = models.DependencyDown
+				results[i].Error = err.Error()
+			}
+		}()
+	}
+	wg.Wait()
+
+	ready := true
+	for _, result := range results {
+		ready = ready && result.Status == models.DependencyUp
+	}
+	return results, ready
+}
+
+// pingRedis checks the Redis server rate limits are shared through
+func pingRedis(ctx context.Context) error {
+	limiter, ok := getRateLimiter().(*redisRateLimiter)
+	if !ok {
+		return errors.New("invalid REDIS_URL")
+	}
+	reply, err := limiter.client.do(ctx, "PING")
+	if err != nil {
+		return err
+	}
+	if reply != "PONG" {
+		return errors.New("unexpected reply to PING")
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package libs
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// DefaultLocale is used when a user has no preference or asks for a locale
+// that has no catalog.
+const DefaultLocale = "en"
+
+//go:embed locales/*.json
+var bundledLocales embed.FS
+
+var (
+	catalogsMu sync.RWMutex
+	catalogs   = map[string]map[string]string{}
+)
+
+// LoadTranslations loads the bundled catalogs and then any *.json files in
+// dir (if set), so new locales can be dropped in without a rebuild. Files are
+// named after the locale they contain, e.g. "de.json".
+func LoadTranslations(dir string) error {
+	loaded := map[string]map[string]string{}
+
+	entries, err := bundledLocales.ReadDir("locales")
+	if err != nil {
+		return fmt.Errorf("error reading bundled locales: %w", err)
+	}
+	for _, entry := range entries {
+		data, err := bundledLocales.ReadFile("locales/" + entry.Name())
+		if err != nil {
+			return fmt.Errorf("error reading bundled locale %s: %w", entry.Name(), err)
+		}
+		if err := mergeCatalog(loaded, entry.Name(), data); err != nil {
+			return err
+		}
+	}
+
+	if dir != "" {
+		files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+		if err != nil {
+			return fmt.Errorf("error listing locales in %s: %w", dir, err)
+		}
+		for _, file := range files {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return fmt.Errorf("error reading locale file %s: %w", file, err)
+			}
+			if err := mergeCatalog(loaded, filepath.Base(file), data); err != nil {
+				return err
+			}
+		}
+	}
+
+	catalogsMu.Lock()
+	catalogs = loaded
+	catalogsMu.Unlock()
+
+	slog.Info("Loaded translation catalogs", "catalogs", len(loaded))
+	return nil
+}
+
+func mergeCatalog(into map[string]map[string]string, fileName string, data []byte) error {
+	var messages map[string]string
+	if err := json.Unmarshal(data, &messages); err != nil {
+		return fmt.Errorf("error parsing locale file %s: %w", fileName, err)
+	}
+
+	locale := NormalizeLocale(strings.TrimSuffix(fileName, filepath.Ext(fileName)))
+	if into[locale] == nil {
+		into[locale] = map[string]string{}
+	}
+	for key, message := range messages {
+		into[locale][key] = message
+	}
+	return nil
+}
+
+// NormalizeLocale lowercases a locale tag and reduces it to its language
+// part, so "pt-BR" and "pt_br" both resolve to the "pt" catalog.
+func NormalizeLocale(locale string) string {
+	locale = strings.ToLower(strings.TrimSpace(locale))
+	if i := strings.IndexAny(locale, "-_"); i > 0 {
+		locale = locale[:i]
+	}
+	return locale
+}
+
+// IsSupportedLocale reports whether a catalog is loaded for locale.
+func IsSupportedLocale(locale string) bool {
+	catalogsMu.RLock()
+	defer catalogsMu.RUnlock()
+
+	_, ok := catalogs[NormalizeLocale(locale)]
+	return ok
+}
+
+// Translate looks up key in the catalog for locale, falling back to the
+// default locale and finally to the key itself. Placeholders written as
+// {name} are replaced with the matching entry from vars.
+func Translate(locale, key string, vars map[string]string) string {
+	catalogsMu.RLock()
+	message, ok := catalogs[NormalizeLocale(locale)][key]
+	if !ok {
+		message, ok = catalogs[DefaultLocale][key]
+	}
+	catalogsMu.RUnlock()
+
+	if !ok {
+		message = key
+	}
+
+	for name, value := range vars {
+		message = strings.ReplaceAll(message, "{"+name+"}", value)
+	}
+	return message
+}
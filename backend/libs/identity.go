@@ -0,0 +1,165 @@
+package libs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sarwanazhar/boardsar/backend/database"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	identityCollection   = "identities"
+	oauthStateCollection = "oauth_states"
+)
+
+// oauthStateTTL is how long a user has to finish signing in at a provider
+const oauthStateTTL = 10 * time.Minute
+
+// Identity errors. The text is safe to return to clients.
+var (
+	ErrInvalidOAuthState = errors.New("Sign-in expired or was already used, please try again")
+	ErrIdentityInUse     = errors.New("That account is already linked to another user")
+	ErrIdentityNotFound  = errors.New("Provider is not linked to your account")
+)
+
+func GetIdentityCollection() *mongo.Collection {
+	return database.GetCollection(identityCollection)
+}
+
+func GetOAuthStateCollection() *mongo.Collection {
+	return database.GetCollection(oauthStateCollection)
+}
+
+// CreateOAuthState starts a sign-in with the provider and returns the state
+// and nonce to send it. Pass the signed-in user's ID to link the provider
+// to their account instead of signing in.
+func CreateOAuthState(ctx context.Context, provider string, userID *primitive.ObjectID) (string, string, error) {
+	state, stateHash, err := newSecretToken()
+	if err != nil {
+		return "", "", fmt.Errorf("error generating state: %w", err)
+	}
+	nonce, _, err := newSecretToken()
+	if err != nil {
+		return "", "", fmt.Errorf("error generating nonce: %w", err)
+	}
+
+	_, err = GetOAuthStateCollection().InsertOne(ctx, models.OAuthState{
+		ID:        primitive.NewObjectID(),
+		StateHash: stateHash,
+		Provider:  provider,
+		Nonce:     nonce,
+		UserID:    userID,
+		ExpiresAt: time.Now().Add(oauthStateTTL),
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("error storing state: %w", err)
+	}
+	return state, nonce, nil
+}
+
+// ConsumeOAuthState checks the state a provider called back with and
+// removes it, so each sign-in completes once
+func ConsumeOAuthState(ctx context.Context, provider, state string) (*models.OAuthState, error) {
+	if state == "" {
+		return nil, ErrInvalidOAuthState
+	}
+
+	var stored models.OAuthState
+	err := GetOAuthStateCollection().FindOneAndDelete(ctx, bson.M{
+		"stateHash": hashToken(state),
+		"provider":  provider,
+		"expiresAt": bson.M{"$gt": time.Now()},
+	}).Decode(&stored)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrInvalidOAuthState
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error checking state: %w", err)
+	}
+	return &stored, nil
+}
+
+// FindIdentity returns the identity for the provider's user, or nil if no
+// account is linked to it
+func FindIdentity(ctx context.Context, provider, subject string) (*models.Identity, error) {
+	var identity models.Identity
+	err := GetIdentityCollection().FindOne(ctx, bson.M{"provider": provider, "subject": subject}).Decode(&identity)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error finding identity: %w", err)
+	}
+	return &identity, nil
+}
+
+// ListIdentities returns the providers linked to the user
+func ListIdentities(ctx context.Context, userID primitive.ObjectID) ([]models.Identity, error) {
+	cursor, err := GetIdentityCollection().Find(ctx, bson.M{"userId": userID},
+		options.Find().SetSort(bson.D{{Key: "provider", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("error listing identities: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	identities := []models.Identity{}
+	if err := cursor.All(ctx, &identities); err != nil {
+		return nil, fmt.Errorf("error decoding identities: %w", err)
+	}
+	return identities, nil
+}
+
+// LinkIdentity links the provider account to the user, replacing any other
+// account of the same provider they had linked. It fails with
+// ErrIdentityInUse if the provider account belongs to someone else.
+func LinkIdentity(ctx context.Context, userID primitive.ObjectID, profile *models.ExternalProfile) (*models.Identity, error) {
+	existing, err := FindIdentity(ctx, profile.Provider, profile.Subject)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil && existing.UserID != userID {
+		return nil, ErrIdentityInUse
+	}
+
+	identity := models.Identity{
+		UserID:    userID,
+		Provider:  profile.Provider,
+		Subject:   profile.Subject,
+		Email:     profile.Email,
+		CreatedAt: time.Now(),
+	}
+	filter := bson.M{"userId": userID, "provider": profile.Provider}
+	update := bson.M{"$set": bson.M{
+		"subject":   identity.Subject,
+		"email":     identity.Email,
+		"createdAt": identity.CreatedAt,
+	}}
+	_, err = GetIdentityCollection().UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		// Linked to someone else between the check and the write
+		return nil, ErrIdentityInUse
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error linking identity: %w", err)
+	}
+	return &identity, nil
+}
+
+// UnlinkIdentity removes the user's link to the provider
+func UnlinkIdentity(ctx context.Context, userID primitive.ObjectID, provider string) error {
+	result, err := GetIdentityCollection().DeleteOne(ctx, bson.M{"userId": userID, "provider": provider})
+	if err != nil {
+		return fmt.Errorf("error unlinking identity: %w", err)
+	}
+	if result.DeletedCount == 0 {
+		return ErrIdentityNotFound
+	}
+	return nil
+}
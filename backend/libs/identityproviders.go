@@ -0,0 +1,382 @@
+package libs
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sarwanazhar/boardsar/backend/models"
+)
+
+// Provider endpoints
+const (
+	appleIssuer       = "https://appleid.apple.com"
+	appleAuthorizeURL = "https://appleid.apple.com/auth/authorize"
+	appleTokenURL     = "https://appleid.apple.com/auth/token"
+	appleKeysURL      = "https://appleid.apple.com/auth/keys"
+
+	githubAuthorizeURL = "https://github.com/login/oauth/authorize"
+	githubTokenURL     = "https://github.com/login/oauth/access_token"
+	githubUserURL      = "https://api.github.com/user"
+	githubEmailsURL    = "https://api.github.com/user/emails"
+)
+
+// appleClientSecretTTL is how long each generated Apple client secret is
+// valid; Apple accepts up to six months, but one is made per sign-in
+const appleClientSecretTTL = 5 * time.Minute
+
+// appleKeysTTL is how long Apple's signing keys are cached
+const appleKeysTTL = time.Hour
+
+// ErrUnknownProvider is returned for providers that don't exist or aren't
+// configured on this server
+var ErrUnknownProvider = errors.New("Unknown sign-in provider")
+
+// identityProvider signs users in with an external account
+type identityProvider interface {
+	// configured reports whether the server has credentials for it
+	configured() bool
+	// authURL is where the user is sent to sign in
+	authURL(state, nonce string) string
+	// exchange trades the authorization code for the user's profile
+	exchange(ctx context.Context, code, nonce string) (*models.ExternalProfile, error)
+}
+
+var identityProviders = map[string]identityProvider{
+	models.ProviderApple:  appleProvider{},
+	models.ProviderGitHub: githubProvider{},
+}
+
+// ConfiguredProviders lists the sign-in providers this server offers
+func ConfiguredProviders() []string {
+	providers := []string{}
+	for _, name := range []string{models.ProviderApple, models.ProviderGitHub} {
+		if identityProviders[name].configured() {
+			providers = append(providers, name)
+		}
+	}
+	return providers
+}
+
+// ProviderConfigured reports whether the server offers the provider
+func ProviderConfigured(provider string) bool {
+	_, err := findProvider(provider)
+	return err == nil
+}
+
+// ProviderCallbackURL is where the provider sends the user back to
+func ProviderCallbackURL(provider string) string {
+	return APIURL() + "/auth/oauth/" + provider + "/callback"
+}
+
+// ProviderAuthURL returns the URL that starts a sign-in with the provider
+func ProviderAuthURL(provider, state, nonce string) (string, error) {
+	p, err := findProvider(provider)
+	if err != nil {
+		return "", err
+	}
+	return p.authURL(state, nonce), nil
+}
+
+// ExchangeProviderCode completes a sign-in with the provider
+func ExchangeProviderCode(ctx context.Context, provider, code, nonce string) (*models.ExternalProfile, error) {
+	p, err := findProvider(provider)
+	if err != nil {
+		return nil, err
+	}
+	if code == "" {
+		return nil, errors.New("missing authorization code")
+	}
+	return p.exchange(ctx, code, nonce)
+}
+
+func findProvider(name string) (identityProvider, error) {
+	p, ok := identityProviders[name]
+	if !ok || !p.configured() {
+		return nil, ErrUnknownProvider
+	}
+	return p, nil
+}
+
+// postProviderForm posts a form to a provider's token endpoint and decodes
+// the JSON answer into out
+func postProviderForm(ctx context.Context, endpoint string, form url.Values, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	return doProviderRequest(req, out)
+}
+
+func doProviderRequest(req *http.Request, out interface{}) error {
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s answered %s", req.URL.Host, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// appleProvider is Sign in with Apple. Apple posts the result back to the
+// callback (response_mode=form_post), and the client secret is a JWT signed
+// with the team's private key.
+type appleProvider struct{}
+
+func (appleProvider) configured() bool {
+	return settings.AppleClientID != "" && settings.AppleTeamID != "" &&
+		settings.AppleKeyID != "" && settings.ApplePrivateKey != ""
+}
+
+func (appleProvider) authURL(state, nonce string) string {
+	query := url.Values{
+		"response_type": {"code"},
+		"response_mode": {"form_post"},
+		"client_id":     {settings.AppleClientID},
+		"redirect_uri":  {ProviderCallbackURL(models.ProviderApple)},
+		"scope":         {"email"},
+		"state":         {state},
+		"nonce":         {nonce},
+	}
+	return appleAuthorizeURL + "?" + query.Encode()
+}
+
+func (appleProvider) exchange(ctx context.Context, code, nonce string) (*models.ExternalProfile, error) {
+	secret, err := appleClientSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	var token struct {
+		IDToken string `json:"id_token"`
+	}
+	err = postProviderForm(ctx, appleTokenURL, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {ProviderCallbackURL(models.ProviderApple)},
+		"client_id":     {settings.AppleClientID},
+		"client_secret": {secret},
+	}, &token)
+	if err != nil {
+		return nil, fmt.Errorf("error exchanging Apple code: %w", err)
+	}
+
+	return verifyAppleIDToken(ctx, token.IDToken, nonce)
+}
+
+// appleClientSecret signs the client secret Apple expects in place of a
+// static one. APPLE_PRIVATE_KEY is the .p8 key's PEM; escaped newlines are
+// accepted so it fits on one line in an env file.
+func appleClientSecret() (string, error) {
+	pem := strings.ReplaceAll(settings.ApplePrivateKey, `\n`, "\n")
+	key, err := jwt.ParseECPrivateKeyFromPEM([]byte(pem))
+	if err != nil {
+		return "", fmt.Errorf("invalid APPLE_PRIVATE_KEY: %w", err)
+	}
+
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"iss": settings.AppleTeamID,
+		"iat": now.Unix(),
+		"exp": now.Add(appleClientSecretTTL).Unix(),
+		"aud": appleIssuer,
+		"sub": settings.AppleClientID,
+	})
+	token.Header["kid"] = settings.AppleKeyID
+	return token.SignedString(key)
+}
+
+// verifyAppleIDToken checks the ID token's signature against Apple's
+// published keys, and that it was issued for this sign-in
+func verifyAppleIDToken(ctx context.Context, idToken, nonce string) (*models.ExternalProfile, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(idToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return appleKeys.find(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256"}),
+		jwt.WithIssuer(appleIssuer),
+		jwt.WithAudience(settings.AppleClientID),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Apple ID token: %w", err)
+	}
+	if claims["nonce"] != nonce {
+		return nil, errors.New("invalid Apple ID token: nonce mismatch")
+	}
+
+	subject, _ := claims["sub"].(string)
+	if subject == "" {
+		return nil, errors.New("invalid Apple ID token: no subject")
+	}
+	email, _ := claims["email"].(string)
+
+	// Apple sends email_verified as a string or a boolean
+	verified := false
+	switch v := claims["email_verified"].(type) {
+	case bool:
+		verified = v
+	case string:
+		verified = v == "true"
+	}
+
+	return &models.ExternalProfile{
+		Provider:      models.ProviderApple,
+		Subject:       subject,
+		Email:         email,
+		EmailVerified: verified,
+	}, nil
+}
+
+// appleKeySet caches Apple's ID token signing keys, refetching them when
+// they are stale or a token names a key we haven't seen
+type appleKeySet struct {
+	mu        sync.Mutex
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+}
+
+var appleKeys = &appleKeySet{}
+
+func (s *appleKeySet) find(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if key, ok := s.keys[kid]; ok && time.Since(s.fetchedAt) < appleKeysTTL {
+		return key, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, appleKeysURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := doProviderRequest(req, &set); err != nil {
+		return nil, fmt.Errorf("error fetching Apple keys: %w", err)
+	}
+
+	keys := map[string]*rsa.PublicKey{}
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(k.N)
+		e, errE := base64.RawURLEncoding.DecodeString(k.E)
+		if errN != nil || errE != nil {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	s.keys, s.fetchedAt = keys, time.Now()
+
+	key, ok := keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown Apple key %q", kid)
+	}
+	return key, nil
+}
+
+// githubProvider is Sign in with GitHub, using a GitHub OAuth app
+type githubProvider struct{}
+
+func (githubProvider) configured() bool {
+	return settings.GitHubClientID != "" && settings.GitHubClientSecret != ""
+}
+
+func (githubProvider) authURL(state, _ string) string {
+	query := url.Values{
+		"client_id":    {settings.GitHubClientID},
+		"redirect_uri": {ProviderCallbackURL(models.ProviderGitHub)},
+		"scope":        {"read:user user:email"},
+		"state":        {state},
+		"allow_signup": {"true"},
+	}
+	return githubAuthorizeURL + "?" + query.Encode()
+}
+
+func (githubProvider) exchange(ctx context.Context, code, _ string) (*models.ExternalProfile, error) {
+	var token struct {
+		AccessToken string `json:"access_token"`
+		Error       string `json:"error"`
+	}
+	err := postProviderForm(ctx, githubTokenURL, url.Values{
+		"client_id":     {settings.GitHubClientID},
+		"client_secret": {settings.GitHubClientSecret},
+		"code":          {code},
+		"redirect_uri":  {ProviderCallbackURL(models.ProviderGitHub)},
+	}, &token)
+	if err != nil {
+		return nil, fmt.Errorf("error exchanging GitHub code: %w", err)
+	}
+	// GitHub reports a bad code with a 200 and an error field
+	if token.AccessToken == "" {
+		return nil, fmt.Errorf("error exchanging GitHub code: %s", token.Error)
+	}
+
+	var user struct {
+		ID int64 `json:"id"`
+	}
+	if err := githubGet(ctx, githubUserURL, token.AccessToken, &user); err != nil {
+		return nil, fmt.Errorf("error fetching GitHub user: %w", err)
+	}
+
+	// The profile email is optional and may be unverified, so use the
+	// primary verified address instead
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := githubGet(ctx, githubEmailsURL, token.AccessToken, &emails); err != nil {
+		return nil, fmt.Errorf("error fetching GitHub emails: %w", err)
+	}
+
+	profile := &models.ExternalProfile{
+		Provider: models.ProviderGitHub,
+		Subject:  strconv.FormatInt(user.ID, 10),
+	}
+	for _, e := range emails {
+		if e.Primary {
+			profile.Email = e.Email
+			profile.EmailVerified = e.Verified
+		}
+	}
+	return profile, nil
+}
+
+func githubGet(ctx context.Context, endpoint, accessToken string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	return doProviderRequest(req, out)
+}
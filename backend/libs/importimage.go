@@ -0,0 +1,150 @@
+package libs
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// importImageTimeout bounds fetching one image of an imported board
+	importImageTimeout = 10 * time.Second
+	// MaxImportImages caps how many images one import fetches
+	MaxImportImages = 100
+)
+
+var (
+	ErrImportImageURL      = errors.New("The image's link isn't an http(s) or data URL")
+	ErrImportImageAddress  = errors.New("The image is on a private network")
+	ErrImportImageSize     = errors.New("The image is too large")
+	ErrTooManyImportImages = fmt.Errorf("Only the first %d images of a board are imported", MaxImportImages)
+)
+
+// importImageClient fetches the images of imported boards. It only dials
+// public addresses, after DNS resolution, so an import file can't make the
+// server reach into its own network.
+var importImageClient = &http.Client{
+	Timeout:   importImageTimeout,
+	Transport: publicTransport(importImageTimeout, ErrImportImageAddress, nil),
+}
+
+// publicTransport only dials public addresses, checked after DNS
+// resolution, failing with refused for others unless allowPrivate, if
+// given, says otherwise
+func publicTransport(timeout time.Duration, refused error, allowPrivate func() bool) *http.Transport {
+	return &http.Transport{
+		Proxy: nil,
+		DialContext: (&net.Dialer{
+			Timeout: timeout,
+			Control: func(network, address string, _ syscall.RawConn) error {
+				if allowPrivate != nil && allowPrivate() {
+					return nil
+				}
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				ip := net.ParseIP(host)
+				if ip == nil || !publicIP(ip) {
+					return refused
+				}
+				return nil
+			},
+		}).DialContext,
+		TLSHandshakeTimeout:   timeout,
+		ResponseHeaderTimeout: timeout,
+	}
+}
+
+// publicIP reports whether ip is routable on the internet
+func publicIP(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsUnspecified() &&
+		!ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() && !ip.IsMulticast()
+}
+
+// checkPublicHost returns private unless every address host resolves to is
+// public, or unknown if it doesn't resolve. Clients dial through
+// publicTransport anyway; this turns private hosts away up front.
+func checkPublicHost(ctx context.Context, host string, private, unknown error) error {
+	if ip := net.ParseIP(host); ip != nil {
+		if !publicIP(ip) {
+			return private
+		}
+		return nil
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil || len(addrs) == 0 {
+		return unknown
+	}
+	for _, addr := range addrs {
+		if !publicIP(addr.IP) {
+			return private
+		}
+	}
+	return nil
+}
+
+// FetchImportImage downloads an image linked from an imported board, up to
+// MaxAssetSize, returning it and a file name for it. Sources may be http(s)
+// URLs or base64 data URLs. The image is checked when it is stored as an
+// asset.
+func FetchImportImage(ctx context.Context, source string) ([]byte, string, error) {
+	if strings.HasPrefix(source, "data:") {
+		return decodeImageDataURL(source)
+	}
+
+	parsed, err := url.Parse(source)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, "", ErrImportImageURL
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, parsed.String(), nil)
+	if err != nil {
+		return nil, "", ErrImportImageURL
+	}
+	resp, err := importImageClient.Do(req)
+	if err != nil {
+		if errors.Is(err, ErrImportImageAddress) {
+			return nil, "", ErrImportImageAddress
+		}
+		return nil, "", fmt.Errorf("error fetching image: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("error fetching image: %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, MaxAssetSize()+1))
+	if err != nil {
+		return nil, "", fmt.Errorf("error fetching image: %w", err)
+	}
+	if int64(len(data)) > MaxAssetSize() {
+		return nil, "", ErrImportImageSize
+	}
+	return data, path.Base(parsed.Path), nil
+}
+
+// decodeImageDataURL reads a base64 data URL
+func decodeImageDataURL(source string) ([]byte, string, error) {
+	header, encoded, ok := strings.Cut(strings.TrimPrefix(source, "data:"), ",")
+	if !ok || !strings.HasSuffix(header, ";base64") {
+		return nil, "", ErrImportImageURL
+	}
+	if int64(base64.StdEncoding.DecodedLen(len(encoded))) > MaxAssetSize()+2 {
+		return nil, "", ErrImportImageSize
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, "", ErrImportImageURL
+	}
+	return data, "image", nil
+}
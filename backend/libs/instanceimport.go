@@ -0,0 +1,231 @@
+package libs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+const (
+	// instanceTimeout bounds one request to another instance
+	instanceTimeout = time.Minute
+	// maxInstanceResponseSize caps the JSON read from another instance,
+	// such as one board's export
+	maxInstanceResponseSize = 50 << 20
+	// instanceBoardPageSize is how many boards are listed per request
+	instanceBoardPageSize = 200
+)
+
+var (
+	ErrInstanceURL       = errors.New("The instance URL must be an http(s) URL")
+	ErrInstanceAddress   = errors.New("The instance is on a private network")
+	ErrInstanceKey       = errors.New("The instance refused the API key")
+	ErrInstanceReachable = errors.New("Could not reach the instance")
+)
+
+// instanceClient talks to other instances. Like importImageClient it only
+// dials public addresses, so a user can't make the server reach into its
+// own network.
+var instanceClient = &http.Client{
+	Timeout:   instanceTimeout,
+	Transport: importImageClient.Transport,
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		// The API key is only for the instance it was given for
+		if len(via) > 0 && req.URL.Host != via[0].URL.Host {
+			return http.ErrUseLastResponse
+		}
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		return nil
+	},
+}
+
+// RemoteInstance is another BoardSar instance, called with an access token
+// of the user there (a sign-in token, or an OAuth app's with boards:read)
+type RemoteInstance struct {
+	baseURL string
+	apiKey  string
+}
+
+// RemoteUser is the user an API key belongs to on another instance
+type RemoteUser struct {
+	ID    string `json:"id"`
+	Email string `json:"email"`
+}
+
+// RemoteBoardSummary is a board in another instance's board list
+type RemoteBoardSummary struct {
+	ID      string   `json:"_id"`
+	Name    string   `json:"name"`
+	OwnerID string   `json:"ownerId"`
+	Tags    []string `json:"tags"`
+}
+
+// RemoteBoard is a board exported from another instance in the JSON
+// format of GET /api/boards/:id/export
+type RemoteBoard struct {
+	Format      string                 `json:"format"`
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	Board       map[string]interface{} `json:"board"`
+}
+
+// NewRemoteInstance checks the URL of another instance's API and returns a
+// client for it
+func NewRemoteInstance(rawURL, apiKey string) (*RemoteInstance, error) {
+	parsed, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" || parsed.User != nil {
+		return nil, ErrInstanceURL
+	}
+	parsed.RawQuery, parsed.Fragment = "", ""
+	return &RemoteInstance{
+		baseURL: strings.TrimSuffix(parsed.String(), "/"),
+		apiKey:  strings.TrimSpace(apiKey),
+	}, nil
+}
+
+// Host is the instance's host, for audit events and reports
+func (r *RemoteInstance) Host() string {
+	parsed, _ := url.Parse(r.baseURL)
+	return parsed.Host
+}
+
+// Me returns the user the API key belongs to
+func (r *RemoteInstance) Me(ctx context.Context) (*RemoteUser, error) {
+	var user RemoteUser
+	if err := r.getJSON(ctx, "/me", &user); err != nil {
+		return nil, err
+	}
+	if user.ID == "" {
+		return nil, fmt.Errorf("%w: no user in the response to /me", ErrInstanceReachable)
+	}
+	return &user, nil
+}
+
+// OwnedBoards lists the boards the user owns on the instance, leaving out
+// those shared with them
+func (r *RemoteInstance) OwnedBoards(ctx context.Context, userID string) ([]RemoteBoardSummary, error) {
+	var owned []RemoteBoardSummary
+	cursor := ""
+	for {
+		query := url.Values{"limit": {fmt.Sprint(instanceBoardPageSize)}, "fields": {"_id,name,ownerId,tags"}}
+		if cursor != "" {
+			query.Set("cursor", cursor)
+		}
+		var page struct {
+			Boards     []RemoteBoardSummary `json:"boards"`
+			NextCursor string               `json:"nextCursor"`
+			HasMore    bool                 `json:"hasMore"`
+		}
+		if err := r.getJSON(ctx, "/api/boards?"+query.Encode(), &page); err != nil {
+			return nil, err
+		}
+		for _, board := range page.Boards {
+			if board.OwnerID == userID {
+				owned = append(owned, board)
+			}
+		}
+		if !page.HasMore || page.NextCursor == "" || page.NextCursor == cursor {
+			return owned, nil
+		}
+		cursor = page.NextCursor
+	}
+}
+
+// ExportBoard fetches a board in the instance's JSON export format
+func (r *RemoteInstance) ExportBoard(ctx context.Context, boardID string) (*RemoteBoard, error) {
+	var board RemoteBoard
+	if err := r.getJSON(ctx, "/api/boards/"+url.PathEscape(boardID)+"/export?format=json", &board); err != nil {
+		return nil, err
+	}
+	if board.Format != "boardsar" || board.Board == nil {
+		return nil, errors.New("The instance didn't send a BoardSar board")
+	}
+	return &board, nil
+}
+
+// FetchAsset downloads one of the user's assets from the instance, up to
+// MaxAssetSize, returning it and its file name. It is checked again when
+// stored here.
+func (r *RemoteInstance) FetchAsset(ctx context.Context, assetID string) ([]byte, string, error) {
+	resp, err := r.get(ctx, "/api/assets/"+url.PathEscape(assetID))
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, MaxAssetSize()+1))
+	if err != nil {
+		return nil, "", fmt.Errorf("error fetching asset: %w", err)
+	}
+	if int64(len(data)) > MaxAssetSize() {
+		return nil, "", ErrImportImageSize
+	}
+
+	filename := assetID
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil {
+		if name := params["filename"]; name != "" {
+			filename = path.Base(name)
+		}
+	}
+	return data, filename, nil
+}
+
+// getJSON decodes the response to a GET request into target
+func (r *RemoteInstance) getJSON(ctx context.Context, endpoint string, target interface{}) error {
+	resp, err := r.get(ctx, endpoint)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxInstanceResponseSize)).Decode(target); err != nil {
+		return fmt.Errorf("%w: invalid response to %s: %v", ErrInstanceReachable, endpoint, err)
+	}
+	return nil
+}
+
+// get sends an authenticated GET request, returning the response when it
+// is a 200. Other statuses are turned into errors, with the instance's
+// message when it sent one.
+func (r *RemoteInstance) get(ctx context.Context, endpoint string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.baseURL+endpoint, nil)
+	if err != nil {
+		return nil, ErrInstanceURL
+	}
+	req.Header.Set("Authorization", "Bearer "+r.apiKey)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := instanceClient.Do(req)
+	if err != nil {
+		if errors.Is(err, ErrImportImageAddress) {
+			return nil, ErrInstanceAddress
+		}
+		return nil, fmt.Errorf("%w: %v", ErrInstanceReachable, err)
+	}
+	if resp.StatusCode == http.StatusOK {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return nil, ErrInstanceKey
+	}
+	var body struct {
+		Error string `json:"error"`
+	}
+	json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&body)
+	if body.Error != "" {
+		return nil, errors.New(body.Error)
+	}
+	return nil, fmt.Errorf("%w: %s answered %s", ErrInstanceReachable, endpoint, resp.Status)
+}
@@ -0,0 +1,261 @@
+package libs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sarwanazhar/boardsar/backend/database"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const jobCollection = "jobs"
+
+const (
+	// maxJobResult keeps a result inside MongoDB's document limit
+	maxJobResult = 15 << 20
+	// jobProgressInterval is how often a background job's progress is
+	// stored, and how often event streams check for it
+	jobProgressInterval = 500 * time.Millisecond
+)
+
+// runningJobs tracks job work in progress, for DrainJobs
+var runningJobs sync.WaitGroup
+
+// ErrJobNotFound is returned for jobs that don't exist, have expired or
+// belong to someone else
+var ErrJobNotFound = errors.New("job not found")
+
+// JobResult is the response of a request run in a worker pool
+type JobResult struct {
+	StatusCode  int
+	ContentType string
+	Filename    string // Sent as an attachment when set
+	Headers     JobHeaders
+	Body        []byte
+}
+
+// JobHeaders are extra response headers of a job's result
+type JobHeaders map[string]string
+
+// Header sets a header, as gin.Context.Header does
+func (h JobHeaders) Header(key, value string) {
+	h[key] = value
+}
+
+// JSONResult is a JSON response, as gin would write it
+func JSONResult(status int, body interface{}) JobResult {
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		return JobResult{StatusCode: 500, ContentType: "application/json; charset=utf-8",
+			Body: []byte(`{"error":"Failed to encode response"}`)}
+	}
+	return JobResult{StatusCode: status, ContentType: "application/json; charset=utf-8", Body: encoded}
+}
+
+func GetJobCollection() *mongo.Collection {
+	return database.GetCollection(jobCollection)
+}
+
+type jobProgressKey struct{}
+
+// jobProgress is the percentage of its work a job has done
+type jobProgress struct {
+	percent atomic.Int32
+}
+
+// ReportJobProgress records how much of a job's work, from 0 to 100, is
+// done. It does nothing when ctx isn't a job's.
+func ReportJobProgress(ctx context.Context, percent int) {
+	if progress, ok := ctx.Value(jobProgressKey{}).(*jobProgress); ok {
+		progress.percent.Store(int32(min(max(percent, 0), 100)))
+	}
+}
+
+// RunJob runs work for the user in the pool and waits up to
+// WORKER_SYNC_BUDGET for it, or not at all when async is set. Work done by
+// then returns its result, to be sent as the response; otherwise it goes on
+// in the background and RunJob returns the job to follow it and fetch the
+// result from later. A full pool returns ErrWorkerPoolFull. ctx should carry
+// no deadline the work must outlive; each run gets the pool's JobTimeout.
+func RunJob(ctx context.Context, pool *WorkerPool, userID primitive.ObjectID, async bool, work func(context.Context) JobResult) (*JobResult, *models.Job, error) {
+	if err := pool.enqueue(); err != nil {
+		return nil, nil, err
+	}
+
+	progress := &jobProgress{}
+	done := make(chan JobResult)
+	deferred := make(chan *models.Job)
+	finished := make(chan struct{})
+	runningJobs.Add(1)
+	go func() {
+		defer runningJobs.Done()
+		defer close(finished)
+
+		workCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), pool.JobTimeout())
+		defer cancel()
+		workCtx = context.WithValue(workCtx, jobProgressKey{}, progress)
+
+		var result JobResult
+		err := pool.run(workCtx, func() error {
+			result = work(workCtx)
+			return nil
+		})
+		if err != nil {
+			result = JSONResult(503, map[string]string{"error": ErrWorkerPoolFull.Error()})
+		}
+
+		// The request takes the result if it is still waiting; otherwise
+		// it has handed out a job to keep it in
+		select {
+		case done <- result:
+		case job := <-deferred:
+			if job != nil {
+				finishJob(job, result)
+			}
+		}
+	}()
+
+	if !async {
+		timer := time.NewTimer(settings.WorkerSyncBudget)
+		defer timer.Stop()
+		select {
+		case result := <-done:
+			return &result, nil, nil
+		case <-timer.C:
+		}
+	}
+
+	job, err := createJob(ctx, pool, userID)
+	if err != nil {
+		// Nobody can fetch it, but the work still finishes
+		deferred <- nil
+		return nil, nil, err
+	}
+	pool.deferred.Add(1)
+	deferred <- job
+	go storeJobProgress(job, progress, finished)
+	return nil, job, nil
+}
+
+// DrainJobs waits for running jobs to finish and store their results, or
+// for ctx to be done
+func DrainJobs(ctx context.Context) error {
+	drained := make(chan struct{})
+	go func() {
+		runningJobs.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// storeJobProgress keeps a background job's progress up to date until its
+// work is finished
+func storeJobProgress(job *models.Job, progress *jobProgress, finished <-chan struct{}) {
+	ticker := time.NewTicker(jobProgressInterval)
+	defer ticker.Stop()
+
+	stored := int32(0)
+	for {
+		select {
+		case <-finished:
+			return
+		case <-ticker.C:
+		}
+		percent := progress.percent.Load()
+		if percent == stored {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), Settings().DBTimeout)
+		// Only while pending, so a late update can't undo the finished job's
+		_, err := GetJobCollection().UpdateOne(ctx,
+			bson.M{"_id": job.ID, "status": models.JobPending},
+			bson.M{"$set": bson.M{"progress": percent}},
+		)
+		cancel()
+		if err != nil {
+			slog.Warn("Failed to store job progress", "job_id", job.ID.Hex(), "kind", job.Kind, "error", err)
+			continue
+		}
+		stored = percent
+	}
+}
+
+func createJob(ctx context.Context, pool *WorkerPool, userID primitive.ObjectID) (*models.Job, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+
+	now := time.Now().UTC()
+	job := &models.Job{
+		ID:        primitive.NewObjectID(),
+		UserID:    userID,
+		Kind:      pool.Name(),
+		Status:    models.JobPending,
+		CreatedAt: now,
+		ExpiresAt: now.Add(pool.JobTimeout() + settings.JobRetention),
+	}
+	if _, err := GetJobCollection().InsertOne(ctx, job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// finishJob stores the result of a job's work. Results too large to store
+// fail the job.
+func finishJob(job *models.Job, result JobResult) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now().UTC()
+	set := bson.M{
+		"status":     models.JobSucceeded,
+		"statusCode": result.StatusCode,
+		"progress":   100,
+		"finishedAt": now,
+		"expiresAt":  now.Add(settings.JobRetention),
+	}
+	switch {
+	case len(result.Body) > maxJobResult:
+		set["status"] = models.JobFailed
+		set["error"] = "The result is too large to keep; try a smaller export"
+	case result.StatusCode >= 400:
+		// The error response is the result, as it would have been sent
+		set["status"] = models.JobFailed
+		fallthrough
+	default:
+		set["contentType"] = result.ContentType
+		set["filename"] = result.Filename
+		set["headers"] = result.Headers
+		set["result"] = result.Body
+	}
+
+	if _, err := GetJobCollection().UpdateOne(ctx, bson.M{"_id": job.ID}, bson.M{"$set": set}); err != nil {
+		slog.Warn("Failed to store job result", "job_id", job.ID.Hex(), "kind", job.Kind, "error", err)
+	}
+}
+
+// FindJob loads one of the user's jobs
+func FindJob(ctx context.Context, jobID, userID primitive.ObjectID) (*models.Job, error) {
+	var job models.Job
+	err := GetJobCollection().FindOne(ctx, bson.M{"_id": jobID, "userId": userID}).Decode(&job)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrJobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
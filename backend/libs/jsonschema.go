@@ -0,0 +1,355 @@
+package libs
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// jsonSchema is a compiled JSON Schema. Only the keywords custom shape
+// types need are supported (type, enum, const, properties, required,
+// additionalProperties, items, and the numeric, string and array bounds);
+// schemas using anything else are rejected when compiled rather than
+// silently validating less than they say.
+type jsonSchema struct {
+	types                []string
+	enum                 []interface{}
+	constValue           interface{}
+	hasConst             bool
+	properties           map[string]*jsonSchema
+	required             []string
+	additionalProperties *bool
+	items                *jsonSchema
+	minimum              *float64
+	maximum              *float64
+	exclusiveMinimum     *float64
+	exclusiveMaximum     *float64
+	minLength            *int
+	maxLength            *int
+	pattern              *regexp.Regexp
+	minItems             *int
+	maxItems             *int
+}
+
+// annotationKeywords describe a schema without constraining values
+var annotationKeywords = map[string]bool{
+	"$schema": true, "$id": true, "$comment": true,
+	"title": true, "description": true, "default": true, "examples": true,
+}
+
+var jsonSchemaTypes = map[string]bool{
+	"object": true, "array": true, "string": true, "number": true,
+	"integer": true, "boolean": true, "null": true,
+}
+
+// CompileJSONSchema checks a JSON Schema and returns a validator for it
+func CompileJSONSchema(schema map[string]interface{}) (func(value interface{}) error, error) {
+	compiled, err := compileJSONSchema(schema, "")
+	if err != nil {
+		return nil, err
+	}
+	return func(value interface{}) error {
+		return compiled.validate(value, "")
+	}, nil
+}
+
+func compileJSONSchema(schema map[string]interface{}, path string) (*jsonSchema, error) {
+	compiled := &jsonSchema{}
+
+	keys := make([]string, 0, len(schema))
+	for key := range schema {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := schema[key]
+		where := path + "/" + key
+		var err error
+
+		switch key {
+		case "type":
+			compiled.types, err = schemaTypes(value)
+		case "enum":
+			list, ok := toList(value)
+			if !ok || len(list) == 0 {
+				err = fmt.Errorf("must be a non-empty array")
+			}
+			compiled.enum = list
+		case "const":
+			compiled.constValue, compiled.hasConst = value, true
+		case "properties":
+			properties, ok := toMap(value)
+			if !ok {
+				err = fmt.Errorf("must be an object")
+				break
+			}
+			compiled.properties = map[string]*jsonSchema{}
+			for name, property := range properties {
+				propertySchema, ok := toMap(property)
+				if !ok {
+					return nil, fmt.Errorf("%s/%s: must be a schema object", where, name)
+				}
+				if compiled.properties[name], err = compileJSONSchema(propertySchema, where+"/"+name); err != nil {
+					return nil, err
+				}
+			}
+		case "required":
+			list, ok := toList(value)
+			if !ok {
+				err = fmt.Errorf("must be an array of strings")
+			}
+			for _, item := range list {
+				name, isString := item.(string)
+				if !isString {
+					err = fmt.Errorf("must be an array of strings")
+					break
+				}
+				compiled.required = append(compiled.required, name)
+			}
+		case "additionalProperties":
+			allowed, ok := value.(bool)
+			if !ok {
+				err = fmt.Errorf("only true or false is supported")
+			}
+			compiled.additionalProperties = &allowed
+		case "items":
+			itemSchema, ok := toMap(value)
+			if !ok {
+				err = fmt.Errorf("must be a schema object")
+				break
+			}
+			compiled.items, err = compileJSONSchema(itemSchema, where)
+			if err != nil {
+				return nil, err
+			}
+		case "minimum":
+			compiled.minimum, err = schemaNumber(value)
+		case "maximum":
+			compiled.maximum, err = schemaNumber(value)
+		case "exclusiveMinimum":
+			compiled.exclusiveMinimum, err = schemaNumber(value)
+		case "exclusiveMaximum":
+			compiled.exclusiveMaximum, err = schemaNumber(value)
+		case "minLength":
+			compiled.minLength, err = schemaCount(value)
+		case "maxLength":
+			compiled.maxLength, err = schemaCount(value)
+		case "minItems":
+			compiled.minItems, err = schemaCount(value)
+		case "maxItems":
+			compiled.maxItems, err = schemaCount(value)
+		case "pattern":
+			source, ok := value.(string)
+			if !ok {
+				err = fmt.Errorf("must be a string")
+				break
+			}
+			compiled.pattern, err = regexp.Compile(source)
+		default:
+			if !annotationKeywords[key] {
+				err = fmt.Errorf("unsupported keyword")
+			}
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", where, err)
+		}
+	}
+	return compiled, nil
+}
+
+func (s *jsonSchema) validate(value interface{}, path string) error {
+	where := path
+	if where == "" {
+		where = "/"
+	}
+
+	if len(s.types) > 0 && !matchesAnyType(value, s.types) {
+		return fmt.Errorf("%s: must be of type %s", where, strings.Join(s.types, " or "))
+	}
+	if s.hasConst && !schemaEqual(value, s.constValue) {
+		return fmt.Errorf("%s: must be %v", where, s.constValue)
+	}
+	if s.enum != nil {
+		found := false
+		for _, allowed := range s.enum {
+			if schemaEqual(value, allowed) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s: must be one of %v", where, s.enum)
+		}
+	}
+
+	if number, ok := toNumber(value); ok {
+		switch {
+		case s.minimum != nil && number < *s.minimum:
+			return fmt.Errorf("%s: must be at least %v", where, *s.minimum)
+		case s.maximum != nil && number > *s.maximum:
+			return fmt.Errorf("%s: must be at most %v", where, *s.maximum)
+		case s.exclusiveMinimum != nil && number <= *s.exclusiveMinimum:
+			return fmt.Errorf("%s: must be greater than %v", where, *s.exclusiveMinimum)
+		case s.exclusiveMaximum != nil && number >= *s.exclusiveMaximum:
+			return fmt.Errorf("%s: must be less than %v", where, *s.exclusiveMaximum)
+		}
+	}
+
+	if text, ok := value.(string); ok {
+		length := utf8.RuneCountInString(text)
+		switch {
+		case s.minLength != nil && length < *s.minLength:
+			return fmt.Errorf("%s: must be at least %d characters", where, *s.minLength)
+		case s.maxLength != nil && length > *s.maxLength:
+			return fmt.Errorf("%s: must be at most %d characters", where, *s.maxLength)
+		case s.pattern != nil && !s.pattern.MatchString(text):
+			return fmt.Errorf("%s: must match %s", where, s.pattern)
+		}
+	}
+
+	if list, ok := toList(value); ok {
+		switch {
+		case s.minItems != nil && len(list) < *s.minItems:
+			return fmt.Errorf("%s: must have at least %d items", where, *s.minItems)
+		case s.maxItems != nil && len(list) > *s.maxItems:
+			return fmt.Errorf("%s: must have at most %d items", where, *s.maxItems)
+		}
+		if s.items != nil {
+			for i, item := range list {
+				if err := s.items.validate(item, fmt.Sprintf("%s/%d", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	if object, ok := toMap(value); ok {
+		for _, name := range s.required {
+			if _, present := object[name]; !present {
+				return fmt.Errorf("%s: %s is required", where, name)
+			}
+		}
+		names := make([]string, 0, len(object))
+		for name := range object {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			property, known := s.properties[name]
+			if !known {
+				if s.additionalProperties != nil && !*s.additionalProperties {
+					return fmt.Errorf("%s: %s is not allowed", where, name)
+				}
+				continue
+			}
+			if err := property.validate(object[name], path+"/"+name); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func matchesAnyType(value interface{}, types []string) bool {
+	for _, name := range types {
+		if matchesType(value, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesType(value interface{}, name string) bool {
+	switch name {
+	case "null":
+		return value == nil
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "number":
+		_, ok := toNumber(value)
+		return ok
+	case "integer":
+		number, ok := toNumber(value)
+		return ok && number == float64(int64(number))
+	case "array":
+		_, ok := toList(value)
+		return ok
+	case "object":
+		_, ok := toMap(value)
+		return ok
+	}
+	return false
+}
+
+// schemaEqual compares JSON values, whichever Go types they were decoded as
+func schemaEqual(a, b interface{}) bool {
+	if x, ok := toNumber(a); ok {
+		y, ok := toNumber(b)
+		return ok && x == y
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// toMap reads an object decoded from JSON or from MongoDB
+func toMap(value interface{}) (map[string]interface{}, bool) {
+	switch object := value.(type) {
+	case map[string]interface{}:
+		return object, true
+	case primitive.M:
+		return object, true
+	}
+	return nil, false
+}
+
+func schemaTypes(value interface{}) ([]string, error) {
+	var names []string
+	if name, ok := value.(string); ok {
+		names = []string{name}
+	} else if list, ok := toList(value); ok {
+		for _, item := range list {
+			name, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("must be a type name or an array of them")
+			}
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("must be a type name or an array of them")
+	}
+	for _, name := range names {
+		if !jsonSchemaTypes[name] {
+			return nil, fmt.Errorf("unknown type %q", name)
+		}
+	}
+	return names, nil
+}
+
+func schemaNumber(value interface{}) (*float64, error) {
+	number, ok := toNumber(value)
+	if !ok {
+		return nil, fmt.Errorf("must be a number")
+	}
+	return &number, nil
+}
+
+func schemaCount(value interface{}) (*int, error) {
+	number, ok := toNumber(value)
+	if !ok || number < 0 || number != float64(int(number)) {
+		return nil, fmt.Errorf("must be a non-negative integer")
+	}
+	count := int(number)
+	return &count, nil
+}
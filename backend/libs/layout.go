@@ -0,0 +1,316 @@
+package libs
+
+import (
+	"math"
+
+	"github.com/sarwanazhar/boardsar/backend/converter"
+	"github.com/sarwanazhar/boardsar/backend/models"
+)
+
+// LayoutShapes lays out the diagram among the selected shapes of a board
+// state, or among all of them when ids is empty. Its nodes (as BoardGraph
+// reads them) move where the algorithm puts them, with whatever is grouped
+// with each; connectors between two moved nodes are redrawn along their
+// new routes, with their arrowheads and labels, and connectors with one
+// end on a moved node follow that end. It returns the operations making
+// those changes and the operations undoing them.
+func LayoutShapes(data map[string]interface{}, ids []string, opts converter.LayoutOptions) (apply, undo []models.BoardOperation, err error) {
+	graph := BoardGraph("", data)
+	selected := map[string]bool{}
+	for _, id := range ids {
+		selected[id] = true
+	}
+
+	var boxes []converter.LayoutBox
+	laid := map[string]GraphNode{}
+	for _, node := range graph.Nodes {
+		if len(selected) == 0 || selected[node.ID] {
+			boxes = append(boxes, converter.LayoutBox{ID: node.ID, Centre: node.centre(), Width: node.Width, Height: node.Height})
+			laid[node.ID] = node
+		}
+	}
+	var links []converter.LayoutLink
+	var linked []GraphEdge
+	for _, edge := range graph.Edges {
+		_, from := laid[edge.Source]
+		_, to := laid[edge.Target]
+		if from && to {
+			links = append(links, converter.LayoutLink{From: edge.Source, To: edge.Target})
+			linked = append(linked, edge)
+		}
+	}
+
+	layout, err := converter.LayoutBoxes(boxes, links, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	plan := newLayoutPlan(data, graph)
+
+	// Nodes, and what is grouped with a single node
+	for id, node := range laid {
+		move := func(p converter.LayoutPoint) converter.LayoutPoint {
+			return offsetBy(p, node.centre(), layout.Centres[id])
+		}
+		plan.move(id, move)
+		members := plan.members(id)
+		if countIn(members, plan.nodes) != 1 {
+			continue
+		}
+		for _, member := range members {
+			if !plan.edges[member] {
+				plan.move(member, move)
+			}
+		}
+	}
+
+	// Connectors between laid out nodes take their route, and those with
+	// one end on a moved node follow it
+	for i, edge := range linked {
+		plan.redraw(edge.ID, layout.Routes[i])
+	}
+	moves := make(map[string]converter.LayoutPoint, len(laid))
+	for id, node := range laid {
+		moves[id] = offsetBy(layout.Centres[id], node.centre(), converter.LayoutPoint{})
+	}
+	plan.follow(graph.Edges, moves)
+
+	apply, undo = plan.operations(data)
+	return apply, undo, nil
+}
+
+// layoutPlan collects the changes a layout makes to the shapes of a board
+// state. Each shape changes once, from where it is stored.
+type layoutPlan struct {
+	shapes       map[string]map[string]interface{}
+	groups       map[string][]string
+	nodes, edges map[string]bool
+	changes      map[string]map[string]interface{} // New fields, by shape
+}
+
+func newLayoutPlan(data map[string]interface{}, graph Graph) *layoutPlan {
+	plan := &layoutPlan{
+		shapes:  map[string]map[string]interface{}{},
+		groups:  map[string][]string{},
+		nodes:   map[string]bool{},
+		edges:   map[string]bool{},
+		changes: map[string]map[string]interface{}{},
+	}
+	list, _ := ShapeList(data)
+	for _, item := range list {
+		shape, _ := item.(map[string]interface{})
+		id, _ := shape["id"].(string)
+		if id == "" {
+			continue
+		}
+		plan.shapes[id] = shape
+		if group, _ := shape[ShapeGroupKey].(string); group != "" {
+			plan.groups[group] = append(plan.groups[group], id)
+		}
+	}
+	for _, node := range graph.Nodes {
+		plan.nodes[node.ID] = true
+	}
+	for _, edge := range graph.Edges {
+		plan.edges[edge.ID] = true
+	}
+	return plan
+}
+
+// operations are the plan's changes as update operations, and the updates
+// undoing them, in the board's order so the batches read like the board
+func (p *layoutPlan) operations(data map[string]interface{}) (apply, undo []models.BoardOperation) {
+	list, _ := ShapeList(data)
+	for _, item := range list {
+		shape, _ := item.(map[string]interface{})
+		id, _ := shape["id"].(string)
+		fields, ok := p.changes[id]
+		if !ok {
+			continue
+		}
+		previous := map[string]interface{}{}
+		for key := range fields {
+			previous[key] = shape[key]
+		}
+		apply = append(apply, models.BoardOperation{Op: models.OpUpdateShape, ID: id, Shape: fields})
+		undo = append(undo, models.BoardOperation{Op: models.OpUpdateShape, ID: id, Shape: previous})
+	}
+	return apply, undo
+}
+
+// follow redraws the connectors not changed yet with an end on a moved
+// node, moving that end as far as the node moved
+func (p *layoutPlan) follow(edges []GraphEdge, moves map[string]converter.LayoutPoint) {
+	for _, edge := range edges {
+		from, fromMoved := moves[edge.Source]
+		to, toMoved := moves[edge.Target]
+		if (!fromMoved && !toMoved) || p.changes[edge.ID] != nil {
+			continue
+		}
+		route := layoutPoints(p.shapes[edge.ID])
+		if len(route) < 2 {
+			continue
+		}
+		if fromMoved {
+			route[0] = offsetBy(route[0], converter.LayoutPoint{}, from)
+		}
+		if toMoved {
+			last := len(route) - 1
+			route[last] = offsetBy(route[last], converter.LayoutPoint{}, to)
+		}
+		p.redraw(edge.ID, route)
+	}
+}
+
+// members lists the shapes grouped with a shape, itself included
+func (p *layoutPlan) members(id string) []string {
+	group, _ := p.shapes[id][ShapeGroupKey].(string)
+	if group == "" {
+		return nil
+	}
+	return p.groups[group]
+}
+
+// move changes a shape's points, or its position, as f moves them; a shape
+// with a position moves as its centre does
+func (p *layoutPlan) move(id string, f func(converter.LayoutPoint) converter.LayoutPoint) {
+	shape := p.shapes[id]
+	if shape == nil || p.changes[id] != nil {
+		return
+	}
+	if points, ok := shapePoints(shape); ok {
+		moved, changed := make([]converter.LayoutPoint, 0, len(points)/2), false
+		for _, point := range layoutPoints(shape) {
+			moved = append(moved, f(point))
+			changed = changed || moved[len(moved)-1] != point
+		}
+		if changed {
+			p.changes[id] = map[string]interface{}{"points": flattenLayout(moved)}
+		}
+		return
+	}
+
+	bounds, ok := ShapeBounds(shape)
+	if !ok {
+		return
+	}
+	x, _ := ShapeNumber(shape, "x")
+	y, _ := ShapeNumber(shape, "y")
+	centre := converter.LayoutPoint{X: bounds.X + bounds.Width/2, Y: bounds.Y + bounds.Height/2}
+	moved := f(centre)
+	if moved == centre {
+		return
+	}
+	p.changes[id] = map[string]interface{}{
+		"x": roundLayout(x + moved.X - centre.X),
+		"y": roundLayout(y + moved.Y - centre.Y),
+	}
+}
+
+// redraw gives a connector a new route. When it is the only connector in a
+// group without nodes, what is grouped with it follows: arrowheads turn
+// with the end they sit on, and labels move with its middle.
+func (p *layoutPlan) redraw(id string, route []converter.LayoutPoint) {
+	old := layoutPoints(p.shapes[id])
+	if len(old) < 2 || len(route) < 2 || p.changes[id] != nil {
+		return
+	}
+	p.changes[id] = map[string]interface{}{"points": flattenLayout(route)}
+
+	members := p.members(id)
+	if countIn(members, p.nodes) != 0 || countIn(members, p.edges) != 1 {
+		return
+	}
+	type anchor struct {
+		was  converter.LayoutPoint
+		move func(converter.LayoutPoint) converter.LayoutPoint
+	}
+	last, newLast := len(old)-1, len(route)-1
+	wasMiddle, nowMiddle := pathMiddle(old), pathMiddle(route)
+	anchors := []anchor{
+		{old[0], turnWith(old[0], old[1], route[0], route[1])},
+		{old[last], turnWith(old[last], old[last-1], route[newLast], route[newLast-1])},
+		{wasMiddle, func(point converter.LayoutPoint) converter.LayoutPoint {
+			return offsetBy(point, wasMiddle, nowMiddle)
+		}},
+	}
+	for _, member := range members {
+		bounds, ok := ShapeBounds(p.shapes[member])
+		if member == id || !ok {
+			continue
+		}
+		centre := converter.LayoutPoint{X: bounds.X + bounds.Width/2, Y: bounds.Y + bounds.Height/2}
+		closest := anchors[0]
+		for _, a := range anchors[1:] {
+			if math.Hypot(centre.X-a.was.X, centre.Y-a.was.Y) < math.Hypot(centre.X-closest.was.X, centre.Y-closest.was.Y) {
+				closest = a
+			}
+		}
+		p.move(member, closest.move)
+	}
+}
+
+func (n GraphNode) centre() converter.LayoutPoint {
+	return converter.LayoutPoint{X: n.X + n.Width/2, Y: n.Y + n.Height/2}
+}
+
+// turnWith moves points as the end of a path moves from was to now, and
+// its first segment turns from towards wasNext to towards nowNext
+func turnWith(was, wasNext, now, nowNext converter.LayoutPoint) func(converter.LayoutPoint) converter.LayoutPoint {
+	angle := math.Atan2(nowNext.Y-now.Y, nowNext.X-now.X) - math.Atan2(wasNext.Y-was.Y, wasNext.X-was.X)
+	sin, cos := math.Sincos(angle)
+	return func(p converter.LayoutPoint) converter.LayoutPoint {
+		dx, dy := p.X-was.X, p.Y-was.Y
+		return converter.LayoutPoint{X: now.X + dx*cos - dy*sin, Y: now.Y + dx*sin + dy*cos}
+	}
+}
+
+// pathMiddle is the middle point of a path, or the middle of its middle
+// segment, where an imported diagram puts an edge's label
+func pathMiddle(points []converter.LayoutPoint) converter.LayoutPoint {
+	last := len(points) - 1
+	a, b := points[last/2], points[(last+1)/2]
+	if a == b && last > 0 {
+		b = points[last/2+1]
+	}
+	return converter.LayoutPoint{X: (a.X + b.X) / 2, Y: (a.Y + b.Y) / 2}
+}
+
+func offsetBy(p, was, now converter.LayoutPoint) converter.LayoutPoint {
+	return converter.LayoutPoint{X: p.X + now.X - was.X, Y: p.Y + now.Y - was.Y}
+}
+
+// layoutPoints reads a shape's points as pairs
+func layoutPoints(shape map[string]interface{}) []converter.LayoutPoint {
+	points, _ := shapePoints(shape)
+	pairs := make([]converter.LayoutPoint, 0, len(points)/2)
+	for i := 0; i+1 < len(points); i += 2 {
+		pairs = append(pairs, converter.LayoutPoint{X: points[i], Y: points[i+1]})
+	}
+	return pairs
+}
+
+// flattenLayout writes points as a shape's flat list of coordinates
+func flattenLayout(points []converter.LayoutPoint) []interface{} {
+	flat := make([]interface{}, 0, 2*len(points))
+	for _, p := range points {
+		flat = append(flat, roundLayout(p.X), roundLayout(p.Y))
+	}
+	return flat
+}
+
+// roundLayout keeps laid out coordinates to hundredths
+func roundLayout(value float64) float64 {
+	return math.Round(value*100) / 100
+}
+
+// countIn counts the ids in set
+func countIn(ids []string, set map[string]bool) int {
+	count := 0
+	for _, id := range ids {
+		if set[id] {
+			count++
+		}
+	}
+	return count
+}
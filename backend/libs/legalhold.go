@@ -0,0 +1,48 @@
+package libs
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sarwanazhar/boardsar/backend/database"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const legalHoldCollection = "legal_holds"
+
+func GetLegalHoldCollection() *mongo.Collection {
+	return database.GetCollection(legalHoldCollection)
+}
+
+// activeHoldFilter matches unreleased, unexpired holds on any of the targets.
+func activeHoldFilter(targets bson.A) bson.M {
+	return bson.M{
+		"releasedAt": bson.M{"$exists": false},
+		"$and": bson.A{
+			bson.M{"$or": targets},
+			bson.M{"$or": bson.A{
+				bson.M{"expiresAt": bson.M{"$exists": false}},
+				bson.M{"expiresAt": bson.M{"$gt": time.Now()}},
+			}},
+		},
+	}
+}
+
+// IsBoardUnderLegalHold reports whether the board, or the user who owns it,
+// has an active legal hold.
+func IsBoardUnderLegalHold(ctx context.Context, boardID, ownerID primitive.ObjectID) (bool, error) {
+	filter := activeHoldFilter(bson.A{
+		bson.M{"targetType": models.LegalHoldTargetBoard, "targetId": boardID},
+		bson.M{"targetType": models.LegalHoldTargetUser, "targetId": ownerID},
+	})
+
+	count, err := GetLegalHoldCollection().CountDocuments(ctx, filter)
+	if err != nil {
+		return false, fmt.Errorf("error checking legal holds: %w", err)
+	}
+	return count > 0, nil
+}
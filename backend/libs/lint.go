@@ -0,0 +1,241 @@
+package libs
+
+import (
+	"bufio"
+	"context"
+	"embed"
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/sarwanazhar/boardsar/backend/database"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const lintDictionaryCollection = "lint_dictionaries"
+
+// LintTextFields are the shape fields that hold user-visible text
+var LintTextFields = []string{"text", "label", "title"}
+
+// maxSpellingSuggestions caps the suggestions for an unknown word
+const maxSpellingSuggestions = 3
+
+//go:embed lint/misspellings.txt
+var bundledLint embed.FS
+
+var wordPattern = regexp.MustCompile(`[\p{L}]+(?:'[\p{L}]+)*`)
+
+var (
+	lintMu       sync.RWMutex
+	misspellings = loadMisspellings()
+	wordList     map[string]bool // Optional full dictionary
+)
+
+func GetLintDictionaryCollection() *mongo.Collection {
+	return database.GetCollection(lintDictionaryCollection)
+}
+
+// FindLintDictionary returns the owner's lint dictionary, or an empty one if
+// they haven't set one up
+func FindLintDictionary(ctx context.Context, ownerID primitive.ObjectID) (*models.LintDictionary, error) {
+	dictionary := models.LintDictionary{
+		OwnerID: ownerID,
+		Words:   []string{},
+		Terms:   []models.TermRule{},
+	}
+
+	err := GetLintDictionaryCollection().FindOne(ctx, bson.M{"ownerId": ownerID}).Decode(&dictionary)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("error finding lint dictionary: %w", err)
+	}
+	return &dictionary, nil
+}
+
+func loadMisspellings() map[string]string {
+	data, err := bundledLint.ReadFile("lint/misspellings.txt")
+	if err != nil {
+		slog.Warn("Failed to read bundled misspellings", "error", err)
+		return map[string]string{}
+	}
+
+	pairs := map[string]string{}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if wrong, right, ok := strings.Cut(line, " "); ok {
+			pairs[wrong] = right
+		}
+	}
+	return pairs
+}
+
+// LoadWordList loads a full dictionary (one word per line, such as
+// /usr/share/dict/words). With it, every unknown word is flagged; without
+// it only known misspellings are.
+func LoadWordList(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("error opening word list: %w", err)
+	}
+	defer file.Close()
+
+	words := map[string]bool{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if word := strings.ToLower(strings.TrimSpace(scanner.Text())); word != "" {
+			words[word] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading word list: %w", err)
+	}
+
+	lintMu.Lock()
+	wordList = words
+	lintMu.Unlock()
+
+	slog.Info("Loaded spellcheck word list", "words", len(words))
+	return nil
+}
+
+// LintText checks one text field of a shape against the bundled
+// misspellings, the optional word list and the owner's dictionary
+func LintText(shapeID, field, text string, dictionary *models.LintDictionary) []models.LintIssue {
+	accepted := map[string]bool{}
+	var terms []models.TermRule
+	if dictionary != nil {
+		for _, word := range dictionary.Words {
+			accepted[strings.ToLower(word)] = true
+		}
+		terms = dictionary.Terms
+	}
+
+	issues := []models.LintIssue{}
+
+	lintMu.RLock()
+	for _, match := range wordPattern.FindAllStringIndex(text, -1) {
+		word := text[match[0]:match[1]]
+		lower := strings.ToLower(word)
+		if accepted[lower] {
+			continue
+		}
+
+		var suggestions []string
+		if right, ok := misspellings[lower]; ok {
+			suggestions = []string{matchCase(word, right)}
+		} else if wordList != nil && utf8.RuneCountInString(word) > 1 && !wordList[lower] && !isAcronym(word) {
+			suggestions = spellingSuggestions(lower, word)
+		} else {
+			continue
+		}
+
+		issues = append(issues, models.LintIssue{
+			ShapeID:     shapeID,
+			Field:       field,
+			Offset:      utf8.RuneCountInString(text[:match[0]]),
+			Length:      utf8.RuneCountInString(word),
+			Text:        word,
+			Kind:        models.LintKindSpelling,
+			Message:     fmt.Sprintf("Possible misspelling: %q", word),
+			Suggestions: suggestions,
+		})
+	}
+	lintMu.RUnlock()
+
+	for _, rule := range terms {
+		for _, avoid := range rule.Avoid {
+			pattern, err := regexp.Compile(`(?i)\b` + regexp.QuoteMeta(avoid) + `\b`)
+			if err != nil {
+				continue
+			}
+			for _, match := range pattern.FindAllStringIndex(text, -1) {
+				found := text[match[0]:match[1]]
+				issues = append(issues, models.LintIssue{
+					ShapeID:     shapeID,
+					Field:       field,
+					Offset:      utf8.RuneCountInString(text[:match[0]]),
+					Length:      utf8.RuneCountInString(found),
+					Text:        found,
+					Kind:        models.LintKindTerminology,
+					Message:     fmt.Sprintf("Use %q instead of %q", rule.Preferred, found),
+					Suggestions: []string{rule.Preferred},
+				})
+			}
+		}
+	}
+
+	sort.SliceStable(issues, func(a, b int) bool {
+		return issues[a].Offset < issues[b].Offset
+	})
+	return issues
+}
+
+// spellingSuggestions returns dictionary words one edit away from lower.
+// The caller holds lintMu.
+func spellingSuggestions(lower, original string) []string {
+	seen := map[string]bool{}
+	suggestions := []string{}
+	for _, candidate := range singleEdits(lower) {
+		if wordList[candidate] && !seen[candidate] {
+			seen[candidate] = true
+			suggestions = append(suggestions, matchCase(original, candidate))
+		}
+	}
+	sort.Strings(suggestions)
+	if len(suggestions) > maxSpellingSuggestions {
+		suggestions = suggestions[:maxSpellingSuggestions]
+	}
+	return suggestions
+}
+
+// singleEdits lists every string one deletion, transposition, replacement
+// or insertion away from word
+func singleEdits(word string) []string {
+	const letters = "abcdefghijklmnopqrstuvwxyz"
+	runes := []rune(word)
+	edits := []string{}
+
+	for i := 0; i <= len(runes); i++ {
+		left, right := string(runes[:i]), runes[i:]
+		if len(right) > 0 {
+			edits = append(edits, left+string(right[1:]))
+		}
+		if len(right) > 1 {
+			edits = append(edits, left+string(right[1])+string(right[0])+string(right[2:]))
+		}
+		for _, letter := range letters {
+			if len(right) > 0 {
+				edits = append(edits, left+string(letter)+string(right[1:]))
+			}
+			edits = append(edits, left+string(letter)+string(right))
+		}
+	}
+	return edits
+}
+
+// matchCase gives a suggestion the capitalization of the word it replaces
+func matchCase(original, suggestion string) string {
+	if utf8.RuneCountInString(original) > 1 && original == strings.ToUpper(original) {
+		return strings.ToUpper(suggestion)
+	}
+	if first, _ := utf8.DecodeRuneInString(original); unicode.IsUpper(first) {
+		next, size := utf8.DecodeRuneInString(suggestion)
+		return string(unicode.ToUpper(next)) + suggestion[size:]
+	}
+	return suggestion
+}
+
+func isAcronym(word string) bool {
+	return utf8.RuneCountInString(word) <= 5 && word == strings.ToUpper(word)
+}
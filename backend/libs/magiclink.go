@@ -0,0 +1,125 @@
+package libs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+
+	"github.com/sarwanazhar/boardsar/backend/database"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const magicLinkCollection = "magic_links"
+
+// ErrInvalidMagicLink is returned for unknown, expired or used sign-in
+// links. The text is safe to return to clients.
+var ErrInvalidMagicLink = errors.New("Invalid or expired sign-in link")
+
+func GetMagicLinkCollection() *mongo.Collection {
+	return database.GetCollection(magicLinkCollection)
+}
+
+// MagicLinkTTL is how long a sign-in link stays valid
+func MagicLinkTTL() time.Duration {
+	return settings.MagicLinkTTL
+}
+
+// MagicLinkSignupAllowed reports whether sign-in links may be sent to
+// unregistered emails, creating the account on first use
+// (MAGIC_LINK_SIGNUP=true)
+func MagicLinkSignupAllowed() bool {
+	return settings.MagicLinkSignup
+}
+
+// CreateMagicLink stores a new sign-in token for the email and returns it.
+// Pass a nil userID for an email that isn't registered yet.
+func CreateMagicLink(ctx context.Context, email string, userID *primitive.ObjectID, locale string) (string, error) {
+	token, tokenHash, err := newSecretToken()
+	if err != nil {
+		return "", fmt.Errorf("error generating sign-in token: %w", err)
+	}
+
+	now := time.Now()
+	_, err = GetMagicLinkCollection().InsertOne(ctx, models.MagicLink{
+		ID:        primitive.NewObjectID(),
+		Email:     email,
+		UserID:    userID,
+		Locale:    locale,
+		TokenHash: tokenHash,
+		CreatedAt: now,
+		ExpiresAt: now.Add(MagicLinkTTL()),
+	})
+	if err != nil {
+		return "", fmt.Errorf("error storing sign-in token: %w", err)
+	}
+	return token, nil
+}
+
+// ConsumeMagicLink marks a sign-in token used and returns it. Any other
+// outstanding links for the email stop working too.
+func ConsumeMagicLink(ctx context.Context, token string) (*models.MagicLink, error) {
+	now := time.Now()
+
+	var link models.MagicLink
+	err := GetMagicLinkCollection().FindOneAndUpdate(ctx,
+		bson.M{
+			"tokenHash": hashToken(token),
+			"usedAt":    bson.M{"$exists": false},
+			"expiresAt": bson.M{"$gt": now},
+		},
+		bson.M{"$set": bson.M{"usedAt": now}},
+	).Decode(&link)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrInvalidMagicLink
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error checking sign-in token: %w", err)
+	}
+
+	_, err = GetMagicLinkCollection().UpdateMany(ctx,
+		bson.M{"email": link.Email, "usedAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"usedAt": now}},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error invalidating sign-in tokens: %w", err)
+	}
+	return &link, nil
+}
+
+// NewMagicLinkConfirmation returns a random value for the page an emailed
+// sign-in link opens to post back, alongside a cookie holding the same
+// value, so that no other site can sign the browser in with a link of its
+// own
+func NewMagicLinkConfirmation() (string, error) {
+	confirmation, _, err := newSecretToken()
+	if err != nil {
+		return "", fmt.Errorf("error generating sign-in confirmation: %w", err)
+	}
+	return confirmation, nil
+}
+
+// MagicLinkPage is the page an emailed sign-in link opens: a button that
+// posts the token, so that mail scanners and link previews, which only
+// open links, don't use it up
+func MagicLinkPage(locale, token, confirmation string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "<!DOCTYPE html>\n<html lang=\"%s\">\n<head><meta charset=\"utf-8\">", html.EscapeString(NormalizeLocale(locale)))
+	b.WriteString("<meta name=\"viewport\" content=\"width=device-width, initial-scale=1\"><meta name=\"robots\" content=\"noindex\"><title>")
+	b.WriteString(html.EscapeString(Translate(locale, "magic_link_page.title", nil)))
+	b.WriteString("</title></head>\n<body>\n<main>\n<h1>")
+	b.WriteString(html.EscapeString(Translate(locale, "magic_link_page.title", nil)))
+	b.WriteString("</h1>\n<p>")
+	b.WriteString(html.EscapeString(Translate(locale, "magic_link_page.prompt", nil)))
+	b.WriteString("</p>\n<form method=\"post\" action=\"verify\">\n")
+	fmt.Fprintf(&b, "<input type=\"hidden\" name=\"token\" value=\"%s\">\n", html.EscapeString(token))
+	fmt.Fprintf(&b, "<input type=\"hidden\" name=\"confirmation\" value=\"%s\">\n", html.EscapeString(confirmation))
+	fmt.Fprintf(&b, "<button type=\"submit\">%s</button>\n", html.EscapeString(Translate(locale, "magic_link_page.button", nil)))
+	b.WriteString("</form>\n</main>\n</body>\n</html>\n")
+	return b.String()
+}
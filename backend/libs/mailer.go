@@ -0,0 +1,61 @@
+package libs
+
+import (
+	"cmp"
+	"fmt"
+	"log/slog"
+	"net/smtp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/config"
+)
+
+// SendEmail sends a plain-text email. It is a variable so tests can capture
+// outgoing mail.
+var SendEmail = sendSMTPEmail
+
+// sendSMTPEmail delivers mail through the configured SMTP server,
+// authenticating when a username is set. Without SMTP_HOST, development
+// builds log the email instead of sending it.
+func sendSMTPEmail(to, subject, body string) error {
+	host := settings.SMTPHost
+	if host == "" {
+		if gin.Mode() == gin.ReleaseMode {
+			return fmt.Errorf("SMTP_HOST is not configured")
+		}
+		slog.Info("SMTP_HOST not set; email not sent", "to", to, "subject", subject, "body", body)
+		return nil
+	}
+
+	port := cmp.Or(settings.SMTPPort, config.DefaultSMTPPort)
+	from := cmp.Or(settings.MailFrom, config.DefaultMailFrom)
+
+	var auth smtp.Auth
+	if username := settings.SMTPUsername; username != "" {
+		auth = smtp.PlainAuth("", username, settings.SMTPPassword, host)
+	}
+
+	message := strings.Join([]string{
+		"From: " + from,
+		"To: " + to,
+		"Subject: " + subject,
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+		"",
+		body,
+	}, "\r\n")
+
+	if err := smtp.SendMail(host+":"+port, auth, from, []string{to}, []byte(message)); err != nil {
+		return fmt.Errorf("error sending email: %w", err)
+	}
+	return nil
+}
+
+// LocalizedEmail wraps a message in the greeting and sign-off of the
+// recipient's locale
+func LocalizedEmail(locale, email, body string) string {
+	return Translate(locale, "email.greeting", map[string]string{"email": email}) +
+		"\n\n" + body + "\n\n" +
+		Translate(locale, "email.signoff", nil)
+}
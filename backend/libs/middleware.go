@@ -1,11 +1,15 @@
 package libs
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"github.com/sarwanazhar/boardsar/backend/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 func JWTMiddleware() gin.HandlerFunc {
@@ -27,34 +31,165 @@ func JWTMiddleware() gin.HandlerFunc {
 		}
 
 		// Parse and verify token
-		token, err := jwt.Parse(tokenString, func(t *jwt.Token) (interface{}, error) {
-			if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, jwt.ErrTokenSignatureInvalid
-			}
-			return GetJWTSecret(), nil
-		})
-		if err != nil || !token.Valid {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		claims, err := VerifyJWT(RequestContext(c), tokenString)
+		if err != nil {
+			c.JSON(TokenErrorStatus(err), gin.H{"error": err.Error()})
 			c.Abort()
 			return
 		}
 
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok || claims["userId"] == nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+		// Save userId in context for handlers like GetProfile
+		c.Set("userId", claims.UserID)
+		if claims.SessionID != "" {
+			c.Set("sessionId", claims.SessionID)
+		}
+		if claims.ClientID != "" {
+			// An OAuth app: RequireScope decides what it may do
+			c.Set("clientId", claims.ClientID)
+			c.Set("scopes", claims.Scopes)
+		}
+		c.Next()
+	}
+}
+
+// AdminMiddleware restricts a route to admin users. It must run after
+// JWTMiddleware so the userId is already in the context.
+func AdminMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, err := FindUserByID(RequestContext(c), c.GetString("userId"))
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
 			c.Abort()
 			return
 		}
 
-		userID, ok := claims["userId"].(string)
-		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token userId"})
+		if user.Role != models.RoleAdmin {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
 			c.Abort()
 			return
 		}
 
-		// Save userId in context for handlers like GetProfile
-		c.Set("userId", userID)
+		c.Next()
+	}
+}
+
+// HasScope reports whether the request's token grants the scope. Tokens of
+// the first-party app have every scope, and boards:write implies
+// boards:read. Use after JWTMiddleware.
+func HasScope(c *gin.Context, scope string) bool {
+	if c.GetString("clientId") == "" {
+		return true
+	}
+	return ScopesAllow(c.GetStringSlice("scopes"), scope)
+}
+
+// ScopesAllow reports whether a set of granted scopes covers the scope
+func ScopesAllow(granted []string, scope string) bool {
+	for _, g := range granted {
+		if g == scope || (g == models.ScopeBoardsWrite && scope == models.ScopeBoardsRead) {
+			return true
+		}
+	}
+	return false
+}
+
+// RequireScope rejects OAuth app tokens that weren't granted the scope. Use
+// after JWTMiddleware.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !HasScope(c, scope) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "This token lacks the " + scope + " scope",
+				"scope": scope,
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// FirstPartyMiddleware keeps OAuth apps away from routes no scope covers,
+// such as account security, sharing and administration. Use after
+// JWTMiddleware.
+func FirstPartyMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("clientId") != "" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "This endpoint is not available to OAuth apps"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// BoardTokenMiddleware guards a public board route with a guest or embed
+// token of one of the given kinds, from the Authorization header or
+// ?token= (iframes and images can't send headers). The token must be for
+// the route's :boardId and used from the origin it was issued to. It
+// doesn't touch the database, so it is cheap enough for every request.
+func BoardTokenMiddleware(kinds ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenString := c.Query("token")
+		if authHeader := c.GetHeader("Authorization"); strings.HasPrefix(authHeader, "Bearer ") {
+			tokenString = strings.TrimSpace(strings.TrimPrefix(authHeader, "Bearer "))
+		}
+		if tokenString == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token missing"})
+			c.Abort()
+			return
+		}
+
+		claims, err := ParseBoardToken(tokenString)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			c.Abort()
+			return
+		}
+
+		allowed := false
+		for _, kind := range kinds {
+			allowed = allowed || claims.Kind == kind
+		}
+		if !allowed || claims.BoardID.Hex() != c.Param("boardId") || RequestOrigin(c.Request) != claims.Origin {
+			c.JSON(http.StatusForbidden, gin.H{"error": ErrBoardTokenWrongSite.Error()})
+			c.Abort()
+			return
+		}
+
+		c.Set("boardToken", claims)
+		c.Next()
+	}
+}
+
+// RequireBoardCapability refuses collaborators on the route's :boardId
+// whose capabilities lack capability, with 403. Owners pass, and users
+// without access are left to the handler. It must run after JWTMiddleware.
+func RequireBoardCapability(capability string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+		if err != nil {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(RequestContext(c), Settings().DBTimeout)
+		defer cancel()
+
+		board, err := BoardRepository(c).WithoutContents().FindByRef(ctx, c.Param("boardId"))
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve board: " + err.Error()})
+			c.Abort()
+			return
+		}
+		if err == nil && BoardRole(board, userID) != "" && !HasCapability(BoardCapabilities(board, userID), capability) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":      "Your access to this board doesn't include " + capability,
+				"capability": capability,
+			})
+			c.Abort()
+			return
+		}
 		c.Next()
 	}
 }
@@ -0,0 +1,403 @@
+package libs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MsgpackContentType is the binary alternative to JSON mobile clients can
+// send and ask for. application/x-msgpack is accepted too.
+const MsgpackContentType = "application/msgpack"
+
+const (
+	// maxMsgpackDepth bounds nesting in request bodies; boards nest a few
+	// levels
+	maxMsgpackDepth = 64
+	// maxMsgpackBody caps msgpack request bodies, which are decoded whole
+	maxMsgpackBody = 32 << 20
+)
+
+var (
+	errMsgpackTruncated   = errors.New("msgpack: unexpected end of data")
+	errMsgpackUnsupported = errors.New("msgpack: unsupported item")
+)
+
+// isMsgpack reports whether a media type is msgpack
+func isMsgpack(mediaType string) bool {
+	return mediaType == MsgpackContentType || mediaType == "application/x-msgpack"
+}
+
+// prefersMsgpack reports whether an Accept header asks for msgpack at
+// least as much as for JSON
+func prefersMsgpack(accept string) bool {
+	msgpackQ, jsonQ := 0.0, 0.0
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(value, 64); err != nil {
+				continue
+			}
+		}
+		switch {
+		case isMsgpack(mediaType):
+			msgpackQ = math.Max(msgpackQ, q)
+		case mediaType == "application/json":
+			jsonQ = math.Max(jsonQ, q)
+		}
+	}
+	return msgpackQ > 0 && msgpackQ >= jsonQ
+}
+
+// msgpackWriter holds back a response so a JSON body can be re-encoded as
+// msgpack once the handler is done
+type msgpackWriter struct {
+	gin.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *msgpackWriter) WriteHeader(code int)              { w.status = code }
+func (w *msgpackWriter) WriteHeaderNow()                   {}
+func (w *msgpackWriter) Write(data []byte) (int, error)    { return w.body.Write(data) }
+func (w *msgpackWriter) WriteString(s string) (int, error) { return w.body.WriteString(s) }
+func (w *msgpackWriter) Status() int                       { return w.status }
+func (w *msgpackWriter) Size() int                         { return w.body.Len() }
+func (w *msgpackWriter) Written() bool                     { return false }
+
+// flush sends the held response, as msgpack if the handler wrote JSON
+func (w *msgpackWriter) flush() {
+	body := w.body.Bytes()
+	header := w.ResponseWriter.Header()
+	if len(body) > 0 && strings.HasPrefix(header.Get("Content-Type"), "application/json") {
+		encoded, err := jsonToMsgpack(body)
+		if err != nil {
+			slog.Warn("Failed to encode response as msgpack", "error", err)
+		} else {
+			body = encoded
+			header.Set("Content-Type", MsgpackContentType)
+			header.Del("Content-Length")
+		}
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	if len(body) > 0 {
+		w.ResponseWriter.Write(body)
+	} else {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+// MsgpackMiddleware lets clients use msgpack instead of JSON: request
+// bodies sent as application/msgpack reach handlers as JSON, and JSON
+// responses are re-encoded when the Accept header prefers msgpack. Other
+// responses pass through unchanged.
+func MsgpackMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if isMsgpack(c.ContentType()) && c.Request.Body != nil {
+			raw, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxMsgpackBody))
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Request body is too large"})
+				return
+			}
+			body, err := msgpackToJSON(raw)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid msgpack body: " + err.Error()})
+				return
+			}
+			c.Request.Body = io.NopCloser(bytes.NewReader(body))
+			c.Request.ContentLength = int64(len(body))
+			c.Request.Header.Set("Content-Type", "application/json")
+		}
+
+		c.Writer.Header().Add("Vary", "Accept")
+		if !prefersMsgpack(c.GetHeader("Accept")) {
+			c.Next()
+			return
+		}
+
+		writer := &msgpackWriter{ResponseWriter: c.Writer, status: http.StatusOK}
+		c.Writer = writer
+		c.Next()
+		c.Writer = writer.ResponseWriter
+		writer.flush()
+	}
+}
+
+// jsonToMsgpack re-encodes a JSON document as msgpack. Integers stay
+// integers; object keys are sorted.
+func jsonToMsgpack(data []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return msgpackEncode(nil, value)
+}
+
+// msgpackToJSON decodes a single msgpack item into JSON
+func msgpackToJSON(data []byte) ([]byte, error) {
+	value, rest, err := msgpackItem(data, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, errors.New("msgpack: trailing data")
+	}
+	return json.Marshal(value)
+}
+
+func msgpackEncode(out []byte, value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case nil:
+		return append(out, 0xc0), nil
+	case bool:
+		if v {
+			return append(out, 0xc3), nil
+		}
+		return append(out, 0xc2), nil
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return msgpackInt(out, n), nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return nil, err
+		}
+		return binary.BigEndian.AppendUint64(append(out, 0xcb), math.Float64bits(f)), nil
+	case string:
+		return append(msgpackHead(out, len(v), 0xa0, 32, 0xd9), v...), nil
+	case []interface{}:
+		out = msgpackHead(out, len(v), 0x90, 16, 0xdc)
+		for _, item := range v {
+			var err error
+			if out, err = msgpackEncode(out, item); err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		out = msgpackHead(out, len(v), 0x80, 16, 0xde)
+		for _, key := range keys {
+			var err error
+			out = append(msgpackHead(out, len(key), 0xa0, 32, 0xd9), key...)
+			if out, err = msgpackEncode(out, v[key]); err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("msgpack: can't encode %T", value)
+}
+
+// msgpackHead writes the type and length of a string, array or map: the
+// fix form below fixLimit, else the 8-bit (strings only), 16-bit or 32-bit
+// form starting at the given code
+func msgpackHead(out []byte, n int, fix byte, fixLimit int, code byte) []byte {
+	switch {
+	case n < fixLimit:
+		return append(out, fix|byte(n))
+	case code == 0xd9 && n <= math.MaxUint8:
+		return append(out, code, byte(n))
+	case n <= math.MaxUint16:
+		if code == 0xd9 {
+			code++
+		}
+		return binary.BigEndian.AppendUint16(append(out, code), uint16(n))
+	default:
+		if code == 0xd9 {
+			code++
+		}
+		return binary.BigEndian.AppendUint32(append(out, code+1), uint32(n))
+	}
+}
+
+func msgpackInt(out []byte, n int64) []byte {
+	switch {
+	case n >= 0 && n < 128:
+		return append(out, byte(n))
+	case n < 0 && n >= -32:
+		return append(out, byte(n))
+	case n >= 0 && n <= math.MaxUint8:
+		return append(out, 0xcc, byte(n))
+	case n >= 0 && n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(out, 0xcd), uint16(n))
+	case n >= 0 && n <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(out, 0xce), uint32(n))
+	case n >= 0:
+		return binary.BigEndian.AppendUint64(append(out, 0xcf), uint64(n))
+	case n >= math.MinInt8:
+		return append(out, 0xd0, byte(n))
+	case n >= math.MinInt16:
+		return binary.BigEndian.AppendUint16(append(out, 0xd1), uint16(n))
+	case n >= math.MinInt32:
+		return binary.BigEndian.AppendUint32(append(out, 0xd2), uint32(n))
+	}
+	return binary.BigEndian.AppendUint64(append(out, 0xd3), uint64(n))
+}
+
+// msgpackItem decodes the item at the start of data and returns it with
+// the bytes after it. Binary data decodes as []byte (base64 in JSON); map
+// keys must be strings or integers. Extension types aren't supported.
+func msgpackItem(data []byte, depth int) (interface{}, []byte, error) {
+	if depth > maxMsgpackDepth {
+		return nil, nil, errMsgpackUnsupported
+	}
+	if len(data) == 0 {
+		return nil, nil, errMsgpackTruncated
+	}
+	code, rest := data[0], data[1:]
+
+	switch {
+	case code <= 0x7f:
+		return int64(code), rest, nil
+	case code >= 0xe0:
+		return int64(int8(code)), rest, nil
+	case code&0xe0 == 0xa0:
+		return msgpackString(rest, uint64(code&0x1f))
+	case code&0xf0 == 0x90:
+		return msgpackArray(rest, uint64(code&0x0f), depth)
+	case code&0xf0 == 0x80:
+		return msgpackMap(rest, uint64(code&0x0f), depth)
+	}
+
+	switch code {
+	case 0xc0:
+		return nil, rest, nil
+	case 0xc2:
+		return false, rest, nil
+	case 0xc3:
+		return true, rest, nil
+	case 0xca:
+		bits, rest, err := msgpackUint(rest, 4)
+		return float64(math.Float32frombits(uint32(bits))), rest, err
+	case 0xcb:
+		bits, rest, err := msgpackUint(rest, 8)
+		return math.Float64frombits(bits), rest, err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		n, rest, err := msgpackUint(rest, 1<<(code-0xcc))
+		if err == nil && n > math.MaxInt64 {
+			return float64(n), rest, nil
+		}
+		return int64(n), rest, err
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (code - 0xd0)
+		n, rest, err := msgpackUint(rest, size)
+		shift := 64 - 8*size
+		return int64(n<<shift) >> shift, rest, err
+	case 0xd9, 0xda, 0xdb, 0xc4, 0xc5, 0xc6:
+		first := byte(0xd9)
+		if code <= 0xc6 {
+			first = 0xc4
+		}
+		n, rest, err := msgpackUint(rest, 1<<(code-first))
+		if err != nil {
+			return nil, nil, err
+		}
+		if code <= 0xc6 {
+			if n > uint64(len(rest)) {
+				return nil, nil, errMsgpackTruncated
+			}
+			return append([]byte(nil), rest[:n]...), rest[n:], nil
+		}
+		return msgpackString(rest, n)
+	case 0xdc, 0xdd:
+		n, rest, err := msgpackUint(rest, 2<<(code-0xdc))
+		if err != nil {
+			return nil, nil, err
+		}
+		return msgpackArray(rest, n, depth)
+	case 0xde, 0xdf:
+		n, rest, err := msgpackUint(rest, 2<<(code-0xde))
+		if err != nil {
+			return nil, nil, err
+		}
+		return msgpackMap(rest, n, depth)
+	}
+	return nil, nil, errMsgpackUnsupported
+}
+
+func msgpackUint(data []byte, size int) (uint64, []byte, error) {
+	if len(data) < size {
+		return 0, nil, errMsgpackTruncated
+	}
+	var value uint64
+	for _, b := range data[:size] {
+		value = value<<8 | uint64(b)
+	}
+	return value, data[size:], nil
+}
+
+func msgpackString(data []byte, n uint64) (interface{}, []byte, error) {
+	if n > uint64(len(data)) {
+		return nil, nil, errMsgpackTruncated
+	}
+	return string(data[:n]), data[n:], nil
+}
+
+func msgpackArray(data []byte, n uint64, depth int) (interface{}, []byte, error) {
+	// Every item takes at least a byte, which bounds the allocation
+	if n > uint64(len(data)) {
+		return nil, nil, errMsgpackTruncated
+	}
+	items := make([]interface{}, 0, n)
+	for i := uint64(0); i < n; i++ {
+		item, rest, err := msgpackItem(data, depth+1)
+		if err != nil {
+			return nil, nil, err
+		}
+		items = append(items, item)
+		data = rest
+	}
+	return items, data, nil
+}
+
+func msgpackMap(data []byte, n uint64, depth int) (interface{}, []byte, error) {
+	if n > uint64(len(data))/2 {
+		return nil, nil, errMsgpackTruncated
+	}
+	entries := make(map[string]interface{}, n)
+	for i := uint64(0); i < n; i++ {
+		key, rest, err := msgpackItem(data, depth+1)
+		if err != nil {
+			return nil, nil, err
+		}
+		var name string
+		switch k := key.(type) {
+		case string:
+			name = k
+		case int64:
+			name = strconv.FormatInt(k, 10)
+		default:
+			return nil, nil, errMsgpackUnsupported
+		}
+		value, rest, err := msgpackItem(rest, depth+1)
+		if err != nil {
+			return nil, nil, err
+		}
+		entries[name] = value
+		data = rest
+	}
+	return entries, data, nil
+}
@@ -0,0 +1,274 @@
+package libs
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/sarwanazhar/boardsar/backend/database"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	oauthClientCollection = "oauth_clients"
+	oauthCodeCollection   = "oauth_codes"
+	oauthGrantCollection  = "oauth_grants"
+)
+
+// oauthCodeTTL is how long an app has to exchange an authorization code
+const oauthCodeTTL = 10 * time.Minute
+
+// pkceMethodS256 is the only PKCE method accepted; "plain" offers no
+// protection against an intercepted code
+const pkceMethodS256 = "S256"
+
+// OAuth errors. The text is safe to return to clients.
+var (
+	ErrInvalidOAuthClient = errors.New("Unknown OAuth client")
+	ErrInvalidRedirectURI = errors.New("redirect_uri is not registered for this client")
+	ErrInvalidScope       = errors.New("Requested scope is unknown or not allowed for this client")
+	ErrPKCERequired       = errors.New("Public clients must use PKCE with code_challenge_method S256")
+	ErrInvalidPKCEMethod  = errors.New("code_challenge_method must be S256")
+	ErrInvalidOAuthCode   = errors.New("Invalid or expired authorization code")
+)
+
+func GetOAuthClientCollection() *mongo.Collection {
+	return database.GetCollection(oauthClientCollection)
+}
+
+func GetOAuthCodeCollection() *mongo.Collection {
+	return database.GetCollection(oauthCodeCollection)
+}
+
+func GetOAuthGrantCollection() *mongo.Collection {
+	return database.GetCollection(oauthGrantCollection)
+}
+
+// CreateOAuthClient registers an app for the user and returns it together
+// with its secret, which is only available now (empty for public clients)
+func CreateOAuthClient(ctx context.Context, ownerID primitive.ObjectID, req models.OAuthClientRequest) (*models.OAuthClient, string, error) {
+	scopes := normalizeScopes(req.Scopes)
+	if len(scopes) == 0 {
+		scopes = slices.Clone(models.OAuthScopes)
+	}
+
+	client := &models.OAuthClient{
+		ID:           primitive.NewObjectID(),
+		OwnerID:      ownerID,
+		Name:         strings.TrimSpace(req.Name),
+		RedirectURIs: req.RedirectURIs,
+		Scopes:       scopes,
+		Public:       req.Public,
+		CreatedAt:    time.Now(),
+	}
+
+	secret := ""
+	if !client.Public {
+		var err error
+		secret, client.SecretHash, err = newSecretToken()
+		if err != nil {
+			return nil, "", fmt.Errorf("error generating client secret: %w", err)
+		}
+	}
+
+	if _, err := GetOAuthClientCollection().InsertOne(ctx, client); err != nil {
+		return nil, "", fmt.Errorf("error storing OAuth client: %w", err)
+	}
+	return client, secret, nil
+}
+
+// FindOAuthClient returns the app with the given client_id
+func FindOAuthClient(ctx context.Context, clientID string) (*models.OAuthClient, error) {
+	id, err := primitive.ObjectIDFromHex(clientID)
+	if err != nil {
+		return nil, ErrInvalidOAuthClient
+	}
+
+	var client models.OAuthClient
+	err = GetOAuthClientCollection().FindOne(ctx, bson.M{"_id": id}).Decode(&client)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrInvalidOAuthClient
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error finding OAuth client: %w", err)
+	}
+	return &client, nil
+}
+
+// AuthenticateOAuthClient checks an app's credentials at the token
+// endpoint. Public clients have no secret; their codes are bound by PKCE.
+func AuthenticateOAuthClient(ctx context.Context, clientID, secret string) (*models.OAuthClient, error) {
+	client, err := FindOAuthClient(ctx, clientID)
+	if err != nil {
+		return nil, err
+	}
+	if client.Public {
+		return client, nil
+	}
+	if secret == "" || subtle.ConstantTimeCompare([]byte(hashToken(secret)), []byte(client.SecretHash)) != 1 {
+		return nil, ErrInvalidOAuthClient
+	}
+	return client, nil
+}
+
+// DeleteOAuthClient removes an app along with its grants and pending codes,
+// and revokes every refresh token issued to it
+func DeleteOAuthClient(ctx context.Context, clientID primitive.ObjectID) error {
+	if _, err := GetOAuthClientCollection().DeleteOne(ctx, bson.M{"_id": clientID}); err != nil {
+		return fmt.Errorf("error deleting OAuth client: %w", err)
+	}
+	if _, err := GetOAuthGrantCollection().DeleteMany(ctx, bson.M{"clientId": clientID}); err != nil {
+		return fmt.Errorf("error deleting OAuth grants: %w", err)
+	}
+	if _, err := GetOAuthCodeCollection().DeleteMany(ctx, bson.M{"clientId": clientID}); err != nil {
+		return fmt.Errorf("error deleting OAuth codes: %w", err)
+	}
+	return RevokeClientRefreshTokens(ctx, clientID, primitive.NilObjectID)
+}
+
+// ValidateAuthorizeRequest checks an app's authorization request and
+// returns the app and the scopes it asks for. An empty scope asks for
+// everything the app is allowed.
+func ValidateAuthorizeRequest(ctx context.Context, req models.OAuthAuthorizeRequest) (*models.OAuthClient, []string, error) {
+	client, err := FindOAuthClient(ctx, req.ClientID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !slices.Contains(client.RedirectURIs, req.RedirectURI) {
+		return nil, nil, ErrInvalidRedirectURI
+	}
+
+	scopes := client.Scopes
+	if requested := strings.Fields(req.Scope); len(requested) > 0 {
+		for _, scope := range requested {
+			if !slices.Contains(client.Scopes, scope) {
+				return nil, nil, ErrInvalidScope
+			}
+		}
+		scopes = normalizeScopes(requested)
+	}
+
+	if req.CodeChallenge == "" {
+		if client.Public {
+			return nil, nil, ErrPKCERequired
+		}
+	} else if req.CodeChallengeMethod != pkceMethodS256 {
+		return nil, nil, ErrInvalidPKCEMethod
+	}
+
+	return client, scopes, nil
+}
+
+// CreateOAuthCode records the user's approval of a validated request and
+// returns the one-time code to hand to the app
+func CreateOAuthCode(ctx context.Context, client *models.OAuthClient, userID primitive.ObjectID, req models.OAuthAuthorizeRequest, scopes []string) (string, error) {
+	code, codeHash, err := newSecretToken()
+	if err != nil {
+		return "", fmt.Errorf("error generating authorization code: %w", err)
+	}
+
+	_, err = GetOAuthCodeCollection().InsertOne(ctx, models.OAuthCode{
+		ID:                  primitive.NewObjectID(),
+		CodeHash:            codeHash,
+		ClientID:            client.ID,
+		UserID:              userID,
+		RedirectURI:         req.RedirectURI,
+		Scopes:              scopes,
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: req.CodeChallengeMethod,
+		ExpiresAt:           time.Now().Add(oauthCodeTTL),
+	})
+	if err != nil {
+		return "", fmt.Errorf("error storing authorization code: %w", err)
+	}
+
+	now := time.Now()
+	_, err = GetOAuthGrantCollection().UpdateOne(ctx,
+		bson.M{"userId": userID, "clientId": client.ID},
+		bson.M{
+			"$set":         bson.M{"scopes": scopes, "updatedAt": now},
+			"$setOnInsert": bson.M{"createdAt": now},
+		},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return "", fmt.Errorf("error storing OAuth grant: %w", err)
+	}
+	return code, nil
+}
+
+// RedeemOAuthCode exchanges an authorization code for the approval it
+// stands for. A code works once, for the app and redirect URI it was issued
+// to, and only with the PKCE verifier matching its challenge.
+func RedeemOAuthCode(ctx context.Context, code string, clientID primitive.ObjectID, redirectURI, verifier string) (*models.OAuthCode, error) {
+	now := time.Now()
+
+	var stored models.OAuthCode
+	err := GetOAuthCodeCollection().FindOneAndUpdate(ctx,
+		bson.M{
+			"codeHash":  hashToken(code),
+			"usedAt":    bson.M{"$exists": false},
+			"expiresAt": bson.M{"$gt": now},
+		},
+		bson.M{"$set": bson.M{"usedAt": now}},
+	).Decode(&stored)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrInvalidOAuthCode
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error redeeming authorization code: %w", err)
+	}
+
+	if stored.ClientID != clientID || stored.RedirectURI != redirectURI {
+		return nil, ErrInvalidOAuthCode
+	}
+	if stored.CodeChallenge != "" && !verifyPKCE(stored.CodeChallenge, verifier) {
+		return nil, ErrInvalidOAuthCode
+	}
+	return &stored, nil
+}
+
+// RevokeOAuthGrant disconnects an app from the user's account. It reports
+// whether the app was connected.
+func RevokeOAuthGrant(ctx context.Context, userID, clientID primitive.ObjectID) (bool, error) {
+	result, err := GetOAuthGrantCollection().DeleteOne(ctx, bson.M{"userId": userID, "clientId": clientID})
+	if err != nil {
+		return false, fmt.Errorf("error deleting OAuth grant: %w", err)
+	}
+	if err := RevokeClientRefreshTokens(ctx, clientID, userID); err != nil {
+		return false, err
+	}
+	return result.DeletedCount > 0, nil
+}
+
+// verifyPKCE checks a code verifier against its S256 challenge
+func verifyPKCE(challenge, verifier string) bool {
+	if verifier == "" {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+// normalizeScopes drops duplicates and orders scopes as in
+// models.OAuthScopes. Unknown scopes are dropped.
+func normalizeScopes(scopes []string) []string {
+	normalized := []string{}
+	for _, scope := range models.OAuthScopes {
+		if slices.Contains(scopes, scope) {
+			normalized = append(normalized, scope)
+		}
+	}
+	return normalized
+}
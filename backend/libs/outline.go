@@ -0,0 +1,383 @@
+package libs
+
+import (
+	"fmt"
+	"html"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Outline node kinds
+const (
+	OutlineFrame = "frame"
+	OutlineGroup = "group"
+	OutlineText  = "text"
+	OutlineShape = "shape"
+)
+
+// ShapeGroupKey holds the ID of the group a shape belongs to
+const ShapeGroupKey = "groupId"
+
+// outlineRowTolerance is how far apart (in board units) the tops of two
+// items can be while still being read as one row
+const outlineRowTolerance = 20.0
+
+// Approximate text metrics for text shapes, which carry no size
+const (
+	defaultFontSize = 16.0
+	charWidthRatio  = 0.6
+	lineHeightRatio = 1.2
+)
+
+// shapeDescriptions are the spoken names of shapes without text
+var shapeDescriptions = map[string]string{
+	"rect":   "Rectangle",
+	"circle": "Circle",
+	"sticky": "Sticky note",
+}
+
+// OutlineNode is one entry of a board outline
+type OutlineNode struct {
+	ID       string         `json:"id,omitempty"`
+	Kind     string         `json:"kind"`
+	Text     string         `json:"text"`
+	Children []*OutlineNode `json:"children,omitempty"`
+
+	bounds Bounds
+	group  string
+}
+
+// Outline is a screen-reader friendly view of a board: frames, then groups,
+// then text, each level in reading order
+type Outline struct {
+	Items    []*OutlineNode `json:"items"`
+	Drawings int            `json:"drawings"` // Freehand strokes and lines left out
+}
+
+// Bounds is an axis-aligned box on the board
+type Bounds struct {
+	X, Y, Width, Height float64
+}
+
+func (b Bounds) contains(other Bounds) bool {
+	return other.X >= b.X && other.Y >= b.Y &&
+		other.X+other.Width <= b.X+b.Width &&
+		other.Y+other.Height <= b.Y+b.Height
+}
+
+func (b Bounds) area() float64 {
+	return b.Width * b.Height
+}
+
+func (b Bounds) union(other Bounds) Bounds {
+	x, y := math.Min(b.X, other.X), math.Min(b.Y, other.Y)
+	return Bounds{
+		X:      x,
+		Y:      y,
+		Width:  math.Max(b.X+b.Width, other.X+other.Width) - x,
+		Height: math.Max(b.Y+b.Height, other.Y+other.Height) - y,
+	}
+}
+
+// ShapeBounds estimates the bounding box of a shape. Text shapes are sized
+// from their font size and length.
+func ShapeBounds(shape map[string]interface{}) (Bounds, bool) {
+	if points, ok := shapePoints(shape); ok {
+		minX, minY := math.Inf(1), math.Inf(1)
+		maxX, maxY := math.Inf(-1), math.Inf(-1)
+		for i := 0; i+1 < len(points); i += 2 {
+			minX, maxX = math.Min(minX, points[i]), math.Max(maxX, points[i])
+			minY, maxY = math.Min(minY, points[i+1]), math.Max(maxY, points[i+1])
+		}
+		if math.IsInf(minX, 1) {
+			return Bounds{}, false
+		}
+		return Bounds{X: minX, Y: minY, Width: maxX - minX, Height: maxY - minY}, true
+	}
+
+	x, okX := ShapeNumber(shape, "x")
+	y, okY := ShapeNumber(shape, "y")
+	if !okX || !okY {
+		return Bounds{}, false
+	}
+
+	if radius, ok := ShapeNumber(shape, "radius"); ok {
+		return Bounds{X: x - radius, Y: y - radius, Width: 2 * radius, Height: 2 * radius}, true
+	}
+
+	width, okW := ShapeNumber(shape, "width")
+	height, okH := ShapeNumber(shape, "height")
+	if !okW || !okH {
+		fontSize, ok := ShapeNumber(shape, "fontSize")
+		if !ok {
+			fontSize = defaultFontSize
+		}
+		lines := strings.Split(ShapeText(shape), "\n")
+		longest := 0
+		for _, line := range lines {
+			if n := len([]rune(line)); n > longest {
+				longest = n
+			}
+		}
+		width = float64(longest) * fontSize * charWidthRatio
+		height = float64(len(lines)) * fontSize * lineHeightRatio
+	}
+	return Bounds{X: x, Y: y, Width: width, Height: height}, true
+}
+
+func shapePoints(shape map[string]interface{}) ([]float64, bool) {
+	raw, ok := toList(shape["points"])
+	if !ok {
+		return nil, false
+	}
+
+	points := make([]float64, 0, len(raw))
+	for _, value := range raw {
+		number, ok := toNumber(value)
+		if !ok {
+			return nil, false
+		}
+		points = append(points, number)
+	}
+	return points, true
+}
+
+// ShapeText returns the user-visible text of a shape, if any
+func ShapeText(shape map[string]interface{}) string {
+	for _, field := range LintTextFields {
+		if text, ok := shape[field].(string); ok && strings.TrimSpace(text) != "" {
+			return strings.TrimSpace(text)
+		}
+	}
+	return ""
+}
+
+// isFrameShape reports whether a shape can hold others: frames always,
+// rectangles when something sits inside them
+func isFrameShape(shape map[string]interface{}) bool {
+	shapeType, _ := shape["type"].(string)
+	return shapeType == "frame" || shapeType == "rect"
+}
+
+// BuildOutline turns the shapes of a board into a nested outline. Frames
+// hold the shapes that fit inside them, shapes sharing a groupId are
+// gathered under a group, and freehand drawings are only counted.
+func BuildOutline(shapes []interface{}) Outline {
+	outline := Outline{Items: []*OutlineNode{}}
+
+	type entry struct {
+		shape map[string]interface{}
+		node  *OutlineNode
+		frame bool
+	}
+	var entries []*entry
+
+	for _, item := range shapes {
+		shape, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		shapeType, _ := shape["type"].(string)
+		if shapeType == "pen" || shapeType == "line" {
+			outline.Drawings++
+			continue
+		}
+		bounds, ok := ShapeBounds(shape)
+		if !ok {
+			continue
+		}
+
+		id, _ := shape["id"].(string)
+		group, _ := shape[ShapeGroupKey].(string)
+		node := &OutlineNode{ID: id, Kind: OutlineShape, Text: ShapeText(shape), bounds: bounds, group: group}
+		if node.Text != "" {
+			node.Kind = OutlineText
+		} else if description, ok := shapeDescriptions[shapeType]; ok {
+			node.Text = description
+		} else {
+			node.Text = "Shape"
+		}
+		entries = append(entries, &entry{shape: shape, node: node, frame: isFrameShape(shape)})
+	}
+
+	// Each shape belongs to the smallest frame that contains it
+	parents := map[*entry]*entry{}
+	for _, child := range entries {
+		var best *entry
+		for _, frame := range entries {
+			if frame == child || !frame.frame || !frame.node.bounds.contains(child.node.bounds) {
+				continue
+			}
+			// Identical boxes: the earlier shape is the container
+			if child.frame && frame.node.bounds == child.node.bounds && indexOf(entries, frame) > indexOf(entries, child) {
+				continue
+			}
+			if best == nil || frame.node.bounds.area() < best.node.bounds.area() {
+				best = frame
+			}
+		}
+		if best != nil {
+			parents[child] = best
+		}
+	}
+
+	children := map[*entry][]*OutlineNode{}
+	var roots []*OutlineNode
+	for _, e := range entries {
+		if parent, ok := parents[e]; ok {
+			children[parent] = append(children[parent], e.node)
+		} else {
+			roots = append(roots, e.node)
+		}
+	}
+
+	// Entries with children become frames. Frames nest, so mark them all
+	// before ordering anything.
+	for _, e := range entries {
+		if len(children[e]) > 0 {
+			e.node.Kind = OutlineFrame
+			if title, ok := e.shape["title"].(string); ok && strings.TrimSpace(title) != "" {
+				e.node.Text = strings.TrimSpace(title)
+			} else if ShapeText(e.shape) == "" {
+				// Named "Frame N" once the reading order is known
+				e.node.Text = ""
+			}
+		}
+	}
+	for _, e := range entries {
+		if kids := children[e]; len(kids) > 0 {
+			e.node.Children = groupAndOrder(kids)
+		}
+	}
+	outline.Items = groupAndOrder(roots)
+
+	numberContainers(outline.Items, new(int), new(int))
+	return outline
+}
+
+func indexOf[T comparable](list []T, item T) int {
+	for i, candidate := range list {
+		if candidate == item {
+			return i
+		}
+	}
+	return -1
+}
+
+// groupAndOrder gathers siblings that share a groupId under a group node and
+// sorts everything into reading order
+func groupAndOrder(nodes []*OutlineNode) []*OutlineNode {
+	groups := map[string]*OutlineNode{}
+	var items []*OutlineNode
+
+	for _, node := range nodes {
+		if node.group == "" || node.Kind == OutlineFrame {
+			items = append(items, node)
+			continue
+		}
+		group, ok := groups[node.group]
+		if !ok {
+			group = &OutlineNode{Kind: OutlineGroup, bounds: node.bounds}
+			groups[node.group] = group
+			items = append(items, group)
+		}
+		group.Children = append(group.Children, node)
+		group.bounds = group.bounds.union(node.bounds)
+	}
+
+	for i, item := range items {
+		if item.Kind != OutlineGroup {
+			continue
+		}
+		if len(item.Children) == 1 {
+			// A group of one reads better as the shape itself
+			items[i] = item.Children[0]
+			continue
+		}
+		item.Children = readingOrder(item.Children)
+	}
+	return readingOrder(items)
+}
+
+// numberContainers names untitled frames and groups in reading order
+func numberContainers(nodes []*OutlineNode, frames, groups *int) {
+	for _, node := range nodes {
+		switch node.Kind {
+		case OutlineFrame:
+			*frames++
+			if node.Text == "" {
+				node.Text = fmt.Sprintf("Frame %d", *frames)
+			}
+		case OutlineGroup:
+			*groups++
+			node.Text = fmt.Sprintf("Group %d", *groups)
+		}
+		numberContainers(node.Children, frames, groups)
+	}
+}
+
+// readingOrder sorts nodes top to bottom in rows, and left to right within
+// a row
+func readingOrder(nodes []*OutlineNode) []*OutlineNode {
+	sorted := append([]*OutlineNode{}, nodes...)
+	sort.SliceStable(sorted, func(a, b int) bool {
+		return sorted[a].bounds.Y < sorted[b].bounds.Y
+	})
+
+	ordered := make([]*OutlineNode, 0, len(sorted))
+	for start := 0; start < len(sorted); {
+		end := start + 1
+		for end < len(sorted) && sorted[end].bounds.Y-sorted[start].bounds.Y <= outlineRowTolerance {
+			end++
+		}
+		row := sorted[start:end]
+		sort.SliceStable(row, func(a, b int) bool {
+			return row[a].bounds.X < row[b].bounds.X
+		})
+		ordered = append(ordered, row...)
+		start = end
+	}
+	return ordered
+}
+
+// OutlineHTML renders an outline as nested, labelled HTML sections and
+// lists that screen readers can navigate by heading
+func OutlineHTML(title string, outline Outline) string {
+	var b strings.Builder
+	b.WriteString("<!DOCTYPE html>\n<html>\n<head><meta charset=\"utf-8\"><title>")
+	b.WriteString(html.EscapeString(title))
+	b.WriteString("</title></head>\n<body>\n<main>\n<h1>")
+	b.WriteString(html.EscapeString(title))
+	b.WriteString("</h1>\n")
+	writeOutlineNodes(&b, outline.Items, 2)
+	if outline.Drawings > 0 {
+		fmt.Fprintf(&b, "<p>The board also has %d freehand drawings.</p>\n", outline.Drawings)
+	}
+	b.WriteString("</main>\n</body>\n</html>\n")
+	return b.String()
+}
+
+func writeOutlineNodes(b *strings.Builder, nodes []*OutlineNode, level int) {
+	if len(nodes) == 0 {
+		return
+	}
+	heading := level
+	if heading > 6 {
+		heading = 6
+	}
+
+	b.WriteString("<ul>\n")
+	for _, node := range nodes {
+		text := html.EscapeString(node.Text)
+		switch node.Kind {
+		case OutlineFrame, OutlineGroup:
+			fmt.Fprintf(b, "<li><section aria-label=\"%s\"><h%d>%s</h%d>\n", text, heading, text, heading)
+			writeOutlineNodes(b, node.Children, level+1)
+			b.WriteString("</section></li>\n")
+		default:
+			fmt.Fprintf(b, "<li>%s</li>\n", strings.ReplaceAll(text, "\n", "<br>"))
+		}
+	}
+	b.WriteString("</ul>\n")
+}
@@ -0,0 +1,575 @@
+package libs
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/sarwanazhar/boardsar/backend/database"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	passkeyCollection           = "passkeys"
+	webAuthnChallengeCollection = "webauthn_challenges"
+)
+
+// webAuthnTimeout is how long a user has to finish a ceremony with their
+// authenticator
+const webAuthnTimeout = 5 * time.Minute
+
+// COSE algorithms passkeys may use, in order of preference
+const (
+	coseES256 int64 = -7
+	coseEdDSA int64 = -8
+	coseRS256 int64 = -257
+)
+
+// Authenticator data flags
+const (
+	authFlagUserPresent   = 0x01
+	authFlagUserVerified  = 0x04
+	authFlagBackedUp      = 0x10
+	authFlagAttestedData  = 0x40
+	authFlagExtensionData = 0x80
+)
+
+// Passkey errors. The text is safe to return to clients.
+var (
+	ErrInvalidWebAuthnChallenge = errors.New("Passkey request expired or was already used, please try again")
+	ErrInvalidPasskey           = errors.New("Passkey could not be verified")
+	ErrPasskeyInUse             = errors.New("That passkey is already registered")
+	ErrPasskeyNotFound          = errors.New("Passkey not found")
+)
+
+func GetPasskeyCollection() *mongo.Collection {
+	return database.GetCollection(passkeyCollection)
+}
+
+func GetWebAuthnChallengeCollection() *mongo.Collection {
+	return database.GetCollection(webAuthnChallengeCollection)
+}
+
+// WebAuthnRPID is the relying party ID passkeys are scoped to: the
+// frontend's host unless WEBAUTHN_RP_ID says otherwise. Changing it
+// orphans every registered passkey.
+func WebAuthnRPID() string {
+	if id := settings.WebAuthnRPID; id != "" {
+		return id
+	}
+	if u, err := url.Parse(FrontendURL()); err == nil && u.Hostname() != "" {
+		return u.Hostname()
+	}
+	return "localhost"
+}
+
+// WebAuthnRPName is the name authenticators show when saving a passkey,
+// WEBAUTHN_RP_NAME
+func WebAuthnRPName() string {
+	return settings.WebAuthnRPName
+}
+
+// WebAuthnOrigins are the origins ceremonies may run on: WEBAUTHN_ORIGINS
+// (comma-separated), or the frontend's origin
+func WebAuthnOrigins() []string {
+	if len(settings.WebAuthnOrigins) > 0 {
+		return settings.WebAuthnOrigins
+	}
+	return []string{FrontendURL()}
+}
+
+// createWebAuthnChallenge stores a new challenge for the ceremony and
+// returns it base64url encoded
+func createWebAuthnChallenge(ctx context.Context, ceremony string, userID *primitive.ObjectID) (string, error) {
+	challenge, challengeHash, err := newSecretToken()
+	if err != nil {
+		return "", fmt.Errorf("error generating challenge: %w", err)
+	}
+
+	_, err = GetWebAuthnChallengeCollection().InsertOne(ctx, models.WebAuthnChallenge{
+		ID:            primitive.NewObjectID(),
+		ChallengeHash: challengeHash,
+		Ceremony:      ceremony,
+		UserID:        userID,
+		ExpiresAt:     time.Now().Add(webAuthnTimeout),
+	})
+	if err != nil {
+		return "", fmt.Errorf("error storing challenge: %w", err)
+	}
+	return challenge, nil
+}
+
+// consumeWebAuthnChallenge checks a challenge the browser signed and
+// removes it, so each ceremony completes once
+func consumeWebAuthnChallenge(ctx context.Context, ceremony, challenge string) (*models.WebAuthnChallenge, error) {
+	if challenge == "" {
+		return nil, ErrInvalidWebAuthnChallenge
+	}
+
+	var stored models.WebAuthnChallenge
+	err := GetWebAuthnChallengeCollection().FindOneAndDelete(ctx, bson.M{
+		"challengeHash": hashToken(challenge),
+		"ceremony":      ceremony,
+		"expiresAt":     bson.M{"$gt": time.Now()},
+	}).Decode(&stored)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrInvalidWebAuthnChallenge
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error checking challenge: %w", err)
+	}
+	return &stored, nil
+}
+
+// BeginPasskeyRegistration starts adding a passkey to the user's account.
+// Passkeys they already have are excluded so an authenticator isn't
+// registered twice.
+func BeginPasskeyRegistration(ctx context.Context, user *models.User) (*models.PasskeyCreationOptions, error) {
+	challenge, err := createWebAuthnChallenge(ctx, models.WebAuthnRegistration, &user.ID)
+	if err != nil {
+		return nil, err
+	}
+	passkeys, err := ListPasskeys(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &models.PasskeyCreationOptions{
+		Challenge:          challenge,
+		Timeout:            webAuthnTimeout.Milliseconds(),
+		Attestation:        "none",
+		ExcludeCredentials: passkeyDescriptors(passkeys),
+	}
+	opts.RP.ID = WebAuthnRPID()
+	opts.RP.Name = WebAuthnRPName()
+	opts.User.ID = base64.RawURLEncoding.EncodeToString(user.ID[:])
+	opts.User.Name = user.Email
+	opts.User.DisplayName = user.Email
+	for _, alg := range []int64{coseES256, coseEdDSA, coseRS256} {
+		opts.PubKeyCredParams = append(opts.PubKeyCredParams, models.PasskeyAlgorithm{Type: "public-key", Alg: alg})
+	}
+	opts.AuthenticatorSelection.ResidentKey = "required"
+	opts.AuthenticatorSelection.UserVerification = "required"
+	return opts, nil
+}
+
+// FinishPasskeyRegistration verifies the authenticator's attestation and
+// stores the new passkey under the given name. Attestation statements
+// aren't checked: registration asks for "none", as passkeys that sync
+// between devices don't attest.
+func FinishPasskeyRegistration(ctx context.Context, userID primitive.ObjectID, name string, credential models.PasskeyCredential) (*models.Passkey, error) {
+	clientData, err := verifyClientData(ctx, credential, models.WebAuthnRegistration)
+	if err != nil {
+		return nil, err
+	}
+	if clientData.challenge.UserID == nil || *clientData.challenge.UserID != userID {
+		return nil, ErrInvalidWebAuthnChallenge
+	}
+
+	rawAttestation, err := decodeBase64URL(credential.Response.AttestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed attestation", ErrInvalidPasskey)
+	}
+	attestation, _, err := cborDecode(rawAttestation)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed attestation", ErrInvalidPasskey)
+	}
+	attestationMap, _ := attestation.(map[interface{}]interface{})
+	rawAuthData, _ := attestationMap["authData"].([]byte)
+
+	authData, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if authData.flags&authFlagAttestedData == 0 {
+		return nil, fmt.Errorf("%w: no credential in attestation", ErrInvalidPasskey)
+	}
+	alg, _, err := parseCOSEKey(authData.publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	passkey := &models.Passkey{
+		ID:           primitive.NewObjectID(),
+		UserID:       userID,
+		CredentialID: base64.RawURLEncoding.EncodeToString(authData.credentialID),
+		PublicKey:    authData.publicKey,
+		Algorithm:    alg,
+		SignCount:    authData.signCount,
+		Name:         name,
+		Transports:   credential.Response.Transports,
+		Synced:       authData.flags&authFlagBackedUp != 0,
+		CreatedAt:    time.Now(),
+	}
+	_, err = GetPasskeyCollection().InsertOne(ctx, passkey)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, ErrPasskeyInUse
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error storing passkey: %w", err)
+	}
+	return passkey, nil
+}
+
+// BeginPasskeyLogin starts a passkey sign-in. With a user it lists their
+// passkeys; without one the browser offers whichever passkeys it holds
+// for the site.
+func BeginPasskeyLogin(ctx context.Context, user *models.User) (*models.PasskeyRequestOptions, error) {
+	var userID *primitive.ObjectID
+	opts := &models.PasskeyRequestOptions{
+		RPID:             WebAuthnRPID(),
+		Timeout:          webAuthnTimeout.Milliseconds(),
+		UserVerification: "required",
+	}
+	if user != nil {
+		userID = &user.ID
+		passkeys, err := ListPasskeys(ctx, user.ID)
+		if err != nil {
+			return nil, err
+		}
+		opts.AllowCredentials = passkeyDescriptors(passkeys)
+	}
+
+	challenge, err := createWebAuthnChallenge(ctx, models.WebAuthnAuthentication, userID)
+	if err != nil {
+		return nil, err
+	}
+	opts.Challenge = challenge
+	return opts, nil
+}
+
+// FinishPasskeyLogin verifies the authenticator's assertion and returns the
+// passkey it signed with. A signature counter that didn't go up means the
+// passkey may have been cloned, and the sign-in is refused.
+func FinishPasskeyLogin(ctx context.Context, credential models.PasskeyCredential) (*models.Passkey, error) {
+	clientData, err := verifyClientData(ctx, credential, models.WebAuthnAuthentication)
+	if err != nil {
+		return nil, err
+	}
+
+	credentialID := credential.RawID
+	if credentialID == "" {
+		credentialID = credential.ID
+	}
+	rawID, err := decodeBase64URL(credentialID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed credential ID", ErrInvalidPasskey)
+	}
+
+	var passkey models.Passkey
+	err = GetPasskeyCollection().FindOne(ctx, bson.M{
+		"credentialId": base64.RawURLEncoding.EncodeToString(rawID),
+	}).Decode(&passkey)
+	if err == mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("%w: unknown passkey", ErrInvalidPasskey)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error finding passkey: %w", err)
+	}
+	if clientData.challenge.UserID != nil && *clientData.challenge.UserID != passkey.UserID {
+		return nil, fmt.Errorf("%w: passkey belongs to another account", ErrInvalidPasskey)
+	}
+	if credential.Response.UserHandle != "" {
+		handle, err := decodeBase64URL(credential.Response.UserHandle)
+		if err != nil || !bytes.Equal(handle, passkey.UserID[:]) {
+			return nil, fmt.Errorf("%w: passkey belongs to another account", ErrInvalidPasskey)
+		}
+	}
+
+	rawAuthData, err := decodeBase64URL(credential.Response.AuthenticatorData)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed authenticator data", ErrInvalidPasskey)
+	}
+	authData, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := decodeBase64URL(credential.Response.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed signature", ErrInvalidPasskey)
+	}
+
+	clientDataHash := sha256.Sum256(clientData.raw)
+	signed := append(append([]byte(nil), rawAuthData...), clientDataHash[:]...)
+	if err := verifyPasskeySignature(passkey.PublicKey, signed, signature); err != nil {
+		return nil, err
+	}
+
+	if (authData.signCount != 0 || passkey.SignCount != 0) && authData.signCount <= passkey.SignCount {
+		return nil, fmt.Errorf("%w: signature counter went backwards, the passkey may have been cloned", ErrInvalidPasskey)
+	}
+
+	now := time.Now()
+	passkey.SignCount = authData.signCount
+	passkey.Synced = authData.flags&authFlagBackedUp != 0
+	passkey.LastUsedAt = &now
+	_, err = GetPasskeyCollection().UpdateOne(ctx, bson.M{"_id": passkey.ID}, bson.M{"$set": bson.M{
+		"signCount":  passkey.SignCount,
+		"synced":     passkey.Synced,
+		"lastUsedAt": now,
+	}})
+	if err != nil {
+		return nil, fmt.Errorf("error updating passkey: %w", err)
+	}
+	return &passkey, nil
+}
+
+// ListPasskeys returns the user's passkeys, oldest first
+func ListPasskeys(ctx context.Context, userID primitive.ObjectID) ([]models.Passkey, error) {
+	cursor, err := GetPasskeyCollection().Find(ctx, bson.M{"userId": userID},
+		options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("error listing passkeys: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	passkeys := []models.Passkey{}
+	if err := cursor.All(ctx, &passkeys); err != nil {
+		return nil, fmt.Errorf("error decoding passkeys: %w", err)
+	}
+	return passkeys, nil
+}
+
+// RenamePasskey changes the device name of one of the user's passkeys
+func RenamePasskey(ctx context.Context, userID, passkeyID primitive.ObjectID, name string) error {
+	result, err := GetPasskeyCollection().UpdateOne(ctx,
+		bson.M{"_id": passkeyID, "userId": userID},
+		bson.M{"$set": bson.M{"name": name}},
+	)
+	if err != nil {
+		return fmt.Errorf("error renaming passkey: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrPasskeyNotFound
+	}
+	return nil
+}
+
+// DeletePasskey removes one of the user's passkeys
+func DeletePasskey(ctx context.Context, userID, passkeyID primitive.ObjectID) error {
+	result, err := GetPasskeyCollection().DeleteOne(ctx, bson.M{"_id": passkeyID, "userId": userID})
+	if err != nil {
+		return fmt.Errorf("error deleting passkey: %w", err)
+	}
+	if result.DeletedCount == 0 {
+		return ErrPasskeyNotFound
+	}
+	return nil
+}
+
+func passkeyDescriptors(passkeys []models.Passkey) []models.PasskeyDescriptor {
+	descriptors := []models.PasskeyDescriptor{}
+	for _, passkey := range passkeys {
+		descriptors = append(descriptors, models.PasskeyDescriptor{
+			Type:       "public-key",
+			ID:         passkey.CredentialID,
+			Transports: passkey.Transports,
+		})
+	}
+	return descriptors
+}
+
+// clientData is the verified clientDataJSON of a ceremony, with the
+// challenge it answered
+type clientData struct {
+	raw       []byte
+	challenge *models.WebAuthnChallenge
+}
+
+// verifyClientData checks what the browser says it signed: the ceremony,
+// our challenge and an allowed origin. The challenge is used up even if
+// later checks fail.
+func verifyClientData(ctx context.Context, credential models.PasskeyCredential, ceremony string) (*clientData, error) {
+	if credential.Type != "public-key" {
+		return nil, fmt.Errorf("%w: not a public key credential", ErrInvalidPasskey)
+	}
+	raw, err := decodeBase64URL(credential.Response.ClientDataJSON)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed client data", ErrInvalidPasskey)
+	}
+	var parsed struct {
+		Type        string `json:"type"`
+		Challenge   string `json:"challenge"`
+		Origin      string `json:"origin"`
+		CrossOrigin bool   `json:"crossOrigin"`
+	}
+	if err := json.Unmarshal(raw, &parsed); err != nil {
+		return nil, fmt.Errorf("%w: malformed client data", ErrInvalidPasskey)
+	}
+
+	wantType := "webauthn.get"
+	if ceremony == models.WebAuthnRegistration {
+		wantType = "webauthn.create"
+	}
+	if parsed.Type != wantType {
+		return nil, fmt.Errorf("%w: wrong ceremony", ErrInvalidPasskey)
+	}
+
+	challenge, err := consumeWebAuthnChallenge(ctx, ceremony, parsed.Challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	allowed := false
+	for _, origin := range WebAuthnOrigins() {
+		if parsed.Origin == origin {
+			allowed = true
+			break
+		}
+	}
+	if !allowed || parsed.CrossOrigin {
+		return nil, fmt.Errorf("%w: origin not allowed", ErrInvalidPasskey)
+	}
+	return &clientData{raw: raw, challenge: challenge}, nil
+}
+
+// authenticatorData is the parsed authData an authenticator signs
+type authenticatorData struct {
+	flags        byte
+	signCount    uint32
+	credentialID []byte
+	publicKey    []byte // COSE_Key, only when registering
+}
+
+// parseAuthenticatorData parses authData and checks it is for our relying
+// party, with the user present and verified
+func parseAuthenticatorData(raw []byte) (*authenticatorData, error) {
+	malformed := fmt.Errorf("%w: malformed authenticator data", ErrInvalidPasskey)
+	if len(raw) < 37 {
+		return nil, malformed
+	}
+	rpIDHash := sha256.Sum256([]byte(WebAuthnRPID()))
+	if !bytes.Equal(raw[:32], rpIDHash[:]) {
+		return nil, fmt.Errorf("%w: passkey is for another site", ErrInvalidPasskey)
+	}
+
+	data := &authenticatorData{flags: raw[32], signCount: binary.BigEndian.Uint32(raw[33:37])}
+	if data.flags&authFlagUserPresent == 0 || data.flags&authFlagUserVerified == 0 {
+		return nil, fmt.Errorf("%w: user wasn't verified", ErrInvalidPasskey)
+	}
+
+	rest := raw[37:]
+	if data.flags&authFlagAttestedData != 0 {
+		// AAGUID, credential ID length and ID, then the public key
+		if len(rest) < 18 {
+			return nil, malformed
+		}
+		idLength := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if len(rest) < idLength || idLength == 0 {
+			return nil, malformed
+		}
+		data.credentialID = append([]byte(nil), rest[:idLength]...)
+		rest = rest[idLength:]
+
+		_, after, err := cborDecode(rest)
+		if err != nil {
+			return nil, malformed
+		}
+		data.publicKey = append([]byte(nil), rest[:len(rest)-len(after)]...)
+		rest = after
+	}
+	if data.flags&authFlagExtensionData == 0 && len(rest) > 0 {
+		return nil, malformed
+	}
+	return data, nil
+}
+
+// parseCOSEKey reads a passkey's public key and its algorithm
+func parseCOSEKey(raw []byte) (int64, crypto.PublicKey, error) {
+	unsupported := fmt.Errorf("%w: unsupported public key", ErrInvalidPasskey)
+	decoded, _, err := cborDecode(raw)
+	if err != nil {
+		return 0, nil, unsupported
+	}
+	key, ok := decoded.(map[interface{}]interface{})
+	if !ok {
+		return 0, nil, unsupported
+	}
+	keyType, _ := key[int64(1)].(int64)
+	alg, _ := key[int64(3)].(int64)
+	curve, _ := key[int64(-1)].(int64)
+
+	switch {
+	case keyType == 2 && alg == coseES256 && curve == 1:
+		x, _ := key[int64(-2)].([]byte)
+		y, _ := key[int64(-3)].([]byte)
+		if len(x) != 32 || len(y) != 32 {
+			return 0, nil, unsupported
+		}
+		// ecdh rejects points that aren't on the curve
+		if _, err := ecdh.P256().NewPublicKey(append(append([]byte{4}, x...), y...)); err != nil {
+			return 0, nil, unsupported
+		}
+		return alg, &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	case keyType == 1 && alg == coseEdDSA && curve == 6:
+		x, _ := key[int64(-2)].([]byte)
+		if len(x) != ed25519.PublicKeySize {
+			return 0, nil, unsupported
+		}
+		return alg, ed25519.PublicKey(x), nil
+	case keyType == 3 && alg == coseRS256:
+		n, _ := key[int64(-1)].([]byte)
+		e, _ := key[int64(-2)].([]byte)
+		if len(e) == 0 || len(e) > 4 {
+			return 0, nil, unsupported
+		}
+		pub := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		if pub.N.BitLen() < 2048 || pub.E < 3 {
+			return 0, nil, unsupported
+		}
+		return alg, pub, nil
+	}
+	return 0, nil, unsupported
+}
+
+// verifyPasskeySignature checks an assertion signature with the stored
+// COSE public key
+func verifyPasskeySignature(publicKey, signed, signature []byte) error {
+	_, key, err := parseCOSEKey(publicKey)
+	if err != nil {
+		return err
+	}
+	digest := sha256.Sum256(signed)
+
+	valid := false
+	switch pub := key.(type) {
+	case *ecdsa.PublicKey:
+		valid = ecdsa.VerifyASN1(pub, digest[:], signature)
+	case ed25519.PublicKey:
+		valid = ed25519.Verify(pub, signed, signature)
+	case *rsa.PublicKey:
+		valid = rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], signature) == nil
+	}
+	if !valid {
+		return fmt.Errorf("%w: bad signature", ErrInvalidPasskey)
+	}
+	return nil
+}
+
+// decodeBase64URL decodes WebAuthn's base64url, with or without padding
+func decodeBase64URL(s string) ([]byte, error) {
+	if s == "" {
+		return nil, errors.New("empty value")
+	}
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
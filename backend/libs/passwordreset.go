@@ -0,0 +1,87 @@
+package libs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sarwanazhar/boardsar/backend/database"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const passwordResetCollection = "password_resets"
+
+// ErrInvalidResetToken is returned for unknown, expired or used reset
+// tokens. The text is safe to return to clients.
+var ErrInvalidResetToken = errors.New("Invalid or expired reset token")
+
+func GetPasswordResetCollection() *mongo.Collection {
+	return database.GetCollection(passwordResetCollection)
+}
+
+// PasswordResetTTL is how long a reset token stays valid
+func PasswordResetTTL() time.Duration {
+	return settings.PasswordResetTTL
+}
+
+// FrontendURL is the base URL used in links sent to users, from
+// FRONTEND_URL
+func FrontendURL() string {
+	return settings.FrontendURL
+}
+
+// CreatePasswordReset stores a new reset token for the user and returns it
+func CreatePasswordReset(ctx context.Context, userID primitive.ObjectID) (string, error) {
+	token, tokenHash, err := newSecretToken()
+	if err != nil {
+		return "", fmt.Errorf("error generating reset token: %w", err)
+	}
+
+	now := time.Now()
+	_, err = GetPasswordResetCollection().InsertOne(ctx, models.PasswordReset{
+		ID:        primitive.NewObjectID(),
+		UserID:    userID,
+		TokenHash: tokenHash,
+		CreatedAt: now,
+		ExpiresAt: now.Add(PasswordResetTTL()),
+	})
+	if err != nil {
+		return "", fmt.Errorf("error storing reset token: %w", err)
+	}
+	return token, nil
+}
+
+// ConsumePasswordReset marks a reset token used and returns the user it
+// belongs to. Any other outstanding tokens of the user stop working too.
+func ConsumePasswordReset(ctx context.Context, token string) (primitive.ObjectID, error) {
+	now := time.Now()
+
+	var reset models.PasswordReset
+	err := GetPasswordResetCollection().FindOneAndUpdate(ctx,
+		bson.M{
+			"tokenHash": hashToken(token),
+			"usedAt":    bson.M{"$exists": false},
+			"expiresAt": bson.M{"$gt": now},
+		},
+		bson.M{"$set": bson.M{"usedAt": now}},
+	).Decode(&reset)
+	if err == mongo.ErrNoDocuments {
+		return primitive.NilObjectID, ErrInvalidResetToken
+	}
+	if err != nil {
+		return primitive.NilObjectID, fmt.Errorf("error checking reset token: %w", err)
+	}
+
+	_, err = GetPasswordResetCollection().UpdateMany(ctx,
+		bson.M{"userId": reset.UserID, "usedAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"usedAt": now}},
+	)
+	if err != nil {
+		return primitive.NilObjectID, fmt.Errorf("error invalidating reset tokens: %w", err)
+	}
+	return reset.UserID, nil
+}
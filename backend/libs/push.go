@@ -0,0 +1,218 @@
+package libs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/sarwanazhar/boardsar/backend/database"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const pushSubscriptionCollection = "push_subscriptions"
+
+// MaxPushSubscriptions is how many devices a user can subscribe; adding
+// one more drops the oldest
+const MaxPushSubscriptions = 20
+
+// notifyTimeout bounds delivering one notification to all of a user's
+// devices
+const notifyTimeout = 30 * time.Second
+
+var ErrPushSubscriptionNotFound = errors.New("Push subscription not found")
+
+func GetPushSubscriptionCollection() *mongo.Collection {
+	return database.GetCollection(pushSubscriptionCollection)
+}
+
+// SavePushSubscription stores a browser's subscription for the user. A
+// browser that subscribes again (same endpoint) gets its keys, name and
+// kinds updated, and moves to the user if someone else had it.
+func SavePushSubscription(ctx context.Context, subscription *models.PushSubscription) (*models.PushSubscription, error) {
+	var saved models.PushSubscription
+	err := GetPushSubscriptionCollection().FindOneAndUpdate(ctx,
+		bson.M{"endpoint": subscription.Endpoint},
+		bson.M{
+			"$set": bson.M{
+				"userId": subscription.UserID,
+				"p256dh": subscription.P256dh,
+				"auth":   subscription.Auth,
+				"name":   subscription.Name,
+				"kinds":  subscription.Kinds,
+			},
+			"$setOnInsert": bson.M{"createdAt": time.Now()},
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&saved)
+	if err != nil {
+		return nil, fmt.Errorf("error saving push subscription: %w", err)
+	}
+
+	if err := prunePushSubscriptions(ctx, subscription.UserID); err != nil {
+		slog.Warn("Failed to prune push subscriptions", "user_id", subscription.UserID.Hex(), "error", err)
+	}
+	return &saved, nil
+}
+
+// prunePushSubscriptions drops the user's oldest subscriptions beyond
+// MaxPushSubscriptions
+func prunePushSubscriptions(ctx context.Context, userID primitive.ObjectID) error {
+	var oldestKept models.PushSubscription
+	err := GetPushSubscriptionCollection().FindOne(ctx, bson.M{"userId": userID}, options.FindOne().
+		SetSort(bson.D{{Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(MaxPushSubscriptions-1).
+		SetProjection(bson.M{"_id": 1, "createdAt": 1}),
+	).Decode(&oldestKept)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	_, err = GetPushSubscriptionCollection().DeleteMany(ctx, bson.M{
+		"userId": userID,
+		"$or": bson.A{
+			bson.M{"createdAt": bson.M{"$lt": oldestKept.CreatedAt}},
+			bson.M{"createdAt": oldestKept.CreatedAt, "_id": bson.M{"$lt": oldestKept.ID}},
+		},
+	})
+	return err
+}
+
+// ListPushSubscriptions returns the user's subscribed devices, oldest first
+func ListPushSubscriptions(ctx context.Context, userID primitive.ObjectID) ([]models.PushSubscription, error) {
+	cursor, err := GetPushSubscriptionCollection().Find(ctx, bson.M{"userId": userID},
+		options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("error listing push subscriptions: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	subscriptions := []models.PushSubscription{}
+	if err := cursor.All(ctx, &subscriptions); err != nil {
+		return nil, fmt.Errorf("error decoding push subscriptions: %w", err)
+	}
+	return subscriptions, nil
+}
+
+// FindPushSubscription loads one of the user's subscriptions
+func FindPushSubscription(ctx context.Context, userID, subscriptionID primitive.ObjectID) (*models.PushSubscription, error) {
+	var subscription models.PushSubscription
+	err := GetPushSubscriptionCollection().FindOne(ctx, bson.M{"_id": subscriptionID, "userId": userID}).Decode(&subscription)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrPushSubscriptionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error loading push subscription: %w", err)
+	}
+	return &subscription, nil
+}
+
+// UpdatePushSubscription changes a device's name and the kinds it receives
+func UpdatePushSubscription(ctx context.Context, userID, subscriptionID primitive.ObjectID, update bson.M) (*models.PushSubscription, error) {
+	var subscription models.PushSubscription
+	err := GetPushSubscriptionCollection().FindOneAndUpdate(ctx,
+		bson.M{"_id": subscriptionID, "userId": userID},
+		bson.M{"$set": update},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&subscription)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrPushSubscriptionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error updating push subscription: %w", err)
+	}
+	return &subscription, nil
+}
+
+// DeletePushSubscription unsubscribes one of the user's devices
+func DeletePushSubscription(ctx context.Context, userID, subscriptionID primitive.ObjectID) error {
+	result, err := GetPushSubscriptionCollection().DeleteOne(ctx, bson.M{"_id": subscriptionID, "userId": userID})
+	if err != nil {
+		return fmt.Errorf("error deleting push subscription: %w", err)
+	}
+	if result.DeletedCount == 0 {
+		return ErrPushSubscriptionNotFound
+	}
+	return nil
+}
+
+// Notify delivers a notification to the user's devices that take its kind.
+// It returns at once; delivery happens in the background and failures are
+// logged. Subscriptions the push service has dropped are removed.
+func Notify(userID primitive.ObjectID, notification models.Notification) {
+	if !WebPushConfigured() {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+		defer cancel()
+
+		subscriptions, err := ListPushSubscriptions(ctx, userID)
+		if err != nil {
+			slog.Warn("Failed to load push subscriptions", "user_id", userID.Hex(), "error", err)
+			return
+		}
+		for i := range subscriptions {
+			subscription := &subscriptions[i]
+			if !wantsNotification(subscription, notification.Kind) {
+				continue
+			}
+			if err := SendPush(ctx, subscription, notification); err != nil {
+				slog.Warn("Failed to send push notification", "kind", notification.Kind, "subscription_id", subscription.ID.Hex(), "error", err)
+			}
+		}
+	}()
+}
+
+// SendPush delivers a notification to one device and records when it last
+// got one. A subscription the push service has dropped is removed and
+// ErrPushSubscriptionGone returned.
+func SendPush(ctx context.Context, subscription *models.PushSubscription, notification models.Notification) error {
+	payload, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+
+	err = sendWebPush(ctx, subscription, payload)
+	if err == ErrPushSubscriptionGone {
+		if _, deleteErr := GetPushSubscriptionCollection().DeleteOne(ctx, bson.M{"_id": subscription.ID}); deleteErr != nil {
+			slog.Warn("Failed to delete expired push subscription", "subscription_id", subscription.ID.Hex(), "error", deleteErr)
+		}
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	subscription.LastSentAt = &now
+	if _, err := GetPushSubscriptionCollection().UpdateOne(ctx,
+		bson.M{"_id": subscription.ID},
+		bson.M{"$set": bson.M{"lastSentAt": now}},
+	); err != nil {
+		slog.Warn("Failed to record push", "subscription_id", subscription.ID.Hex(), "error", err)
+	}
+	return nil
+}
+
+// wantsNotification reports whether a device takes notifications of kind
+func wantsNotification(subscription *models.PushSubscription, kind string) bool {
+	if kind == models.NotificationTest || len(subscription.Kinds) == 0 {
+		return true
+	}
+	for _, wanted := range subscription.Kinds {
+		if wanted == kind {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,151 @@
+package libs
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/sarwanazhar/boardsar/backend/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// QuotaWarningThreshold is the fraction of a limit after which responses
+// start carrying warnings.
+const QuotaWarningThreshold = 0.8
+
+// QuotaLimits are the plan limits: boards and storage per user, and
+// collaborators per board. Zero means unlimited.
+type QuotaLimits struct {
+	Boards        int64
+	StorageBytes  int64
+	Collaborators int64
+}
+
+// GetQuotaLimits returns the limits from BOARD_LIMIT, STORAGE_LIMIT_BYTES
+// and COLLABORATOR_LIMIT.
+func GetQuotaLimits() QuotaLimits {
+	return QuotaLimits{
+		Boards:        settings.BoardLimit,
+		StorageBytes:  settings.StorageLimitBytes,
+		Collaborators: settings.CollaboratorLimit,
+	}
+}
+
+// QuotaUsage is what a user currently consumes against their limits
+type QuotaUsage struct {
+	Boards       int64
+	StorageBytes int64
+}
+
+// GetQuotaUsage counts the user's boards and the stored size of their board
+// contents and assets. The contents of replacingBoardID (a board being
+// overwritten) are left out of the storage total.
+func GetQuotaUsage(ctx context.Context, userID primitive.ObjectID, replacingBoardID primitive.ObjectID) (QuotaUsage, error) {
+	pipeline := bson.A{
+		bson.M{"$match": bson.M{"ownerId": userID}},
+		bson.M{"$group": bson.M{
+			"_id":    nil,
+			"boards": bson.M{"$sum": 1},
+			"storage": bson.M{"$sum": bson.M{"$cond": bson.A{
+				bson.M{"$eq": bson.A{"$_id", replacingBoardID}},
+				0,
+				// Compressed and archived boards count as their size before
+				// compression
+				bson.M{"$ifNull": bson.A{bson.M{"$bsonSize": "$board"}, "$boardSize", "$archived.size"}},
+			}}},
+		}},
+	}
+
+	cursor, err := database.GetCollection("boards").Aggregate(ctx, pipeline)
+	if err != nil {
+		return QuotaUsage{}, err
+	}
+	defer cursor.Close(ctx)
+
+	var results []struct {
+		Boards  int64 `bson:"boards"`
+		Storage int64 `bson:"storage"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return QuotaUsage{}, err
+	}
+	assets, err := AssetStorageUsage(ctx, userID)
+	if err != nil {
+		return QuotaUsage{}, err
+	}
+	if len(results) == 0 {
+		return QuotaUsage{StorageBytes: assets}, nil
+	}
+	return QuotaUsage{Boards: results[0].Boards, StorageBytes: results[0].Storage + assets}, nil
+}
+
+// HeaderWriter is where ApplyQuota reports the remaining quota: the
+// request's context, or the headers of a job's result
+type HeaderWriter interface {
+	Header(key, value string)
+}
+
+// ApplyQuota checks a write that would add newBoards boards and newBytes of
+// board contents. Existing boards over a lowered limit can still be
+// edited. It sets X-Quota-Remaining-* headers and returns soft-limit
+// warnings, or an error message when the write would exceed a hard limit.
+func ApplyQuota(c HeaderWriter, usage QuotaUsage, newBoards int64, newBytes int64) ([]string, string) {
+	limits := GetQuotaLimits()
+	warnings := []string{}
+
+	if limits.Boards > 0 {
+		total := usage.Boards + newBoards
+		if newBoards > 0 && total > limits.Boards {
+			return nil, fmt.Sprintf("Board limit reached (%d boards)", limits.Boards)
+		}
+		c.Header("X-Quota-Remaining-Boards", strconv.FormatInt(limits.Boards-total, 10))
+		if float64(total) >= float64(limits.Boards)*QuotaWarningThreshold {
+			warnings = append(warnings, fmt.Sprintf("You are using %d of %d boards", total, limits.Boards))
+		}
+	}
+
+	if limits.StorageBytes > 0 {
+		total := usage.StorageBytes + newBytes
+		if total > limits.StorageBytes {
+			return nil, fmt.Sprintf("Storage limit reached (%d bytes)", limits.StorageBytes)
+		}
+		c.Header("X-Quota-Remaining-Storage", strconv.FormatInt(limits.StorageBytes-total, 10))
+		if float64(total) >= float64(limits.StorageBytes)*QuotaWarningThreshold {
+			warnings = append(warnings, fmt.Sprintf("You are using %d%% of your storage", total*100/limits.StorageBytes))
+		}
+	}
+
+	return warnings, ""
+}
+
+// ApplyCollaboratorQuota checks sharing a board that has collaborators with
+// newCollaborators more. Like ApplyQuota, boards over a lowered limit keep
+// their collaborators, it sets X-Quota-Remaining-Collaborators, and it
+// returns soft-limit warnings, or an error message past the limit.
+func ApplyCollaboratorQuota(c HeaderWriter, collaborators, newCollaborators int64) ([]string, string) {
+	limit := GetQuotaLimits().Collaborators
+	warnings := []string{}
+	if limit <= 0 {
+		return warnings, ""
+	}
+
+	total := collaborators + newCollaborators
+	if newCollaborators > 0 && total > limit {
+		return nil, fmt.Sprintf("Collaborator limit reached (%d per board)", limit)
+	}
+	c.Header("X-Quota-Remaining-Collaborators", strconv.FormatInt(limit-total, 10))
+	if float64(total) >= float64(limit)*QuotaWarningThreshold {
+		warnings = append(warnings, fmt.Sprintf("This board has %d of %d collaborators", total, limit))
+	}
+	return warnings, ""
+}
+
+// BoardDataSize is the stored (BSON) size of board contents
+func BoardDataSize(data map[string]interface{}) int64 {
+	raw, err := bson.Marshal(data)
+	if err != nil {
+		return 0
+	}
+	return int64(len(raw))
+}
@@ -0,0 +1,234 @@
+package libs
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/config"
+)
+
+// RateLimit is a token bucket: Requests at once, refilled evenly over
+// Period
+type RateLimit = config.RateLimit
+
+// rateLimitTimeout bounds a Redis round trip; on failure the instance's own
+// buckets are used instead
+const rateLimitTimeout = 250 * time.Millisecond
+
+// rateLimiter takes a token from a bucket, reporting whether there was one,
+// how many are left and, when there wasn't, how long until there is
+type rateLimiter interface {
+	Take(ctx context.Context, key string, limit RateLimit) (allowed bool, remaining int, retryAfter time.Duration, err error)
+}
+
+var (
+	localRateLimiter = &memoryRateLimiter{buckets: map[string]*tokenBucket{}}
+
+	sharedRateLimiterOnce sync.Once
+	sharedRateLimiter     rateLimiter
+)
+
+// getRateLimiter returns the Redis limiter when REDIS_URL is set, so
+// instances share their buckets, or this instance's own
+func getRateLimiter() rateLimiter {
+	sharedRateLimiterOnce.Do(func() {
+		rawURL := settings.RedisURL
+		if rawURL == "" {
+			return
+		}
+		client, err := newRedisClient(rawURL)
+		if err != nil {
+			slog.Warn("Rate limits are per instance", "error", err)
+			return
+		}
+		sharedRateLimiter = &redisRateLimiter{client: client}
+	})
+	if sharedRateLimiter != nil {
+		return sharedRateLimiter
+	}
+	return localRateLimiter
+}
+
+// AuthRateLimitMiddleware limits sign-in and account recovery requests per
+// client IP, to slow down password guessing, to RATE_LIMIT_AUTH
+func AuthRateLimitMiddleware() gin.HandlerFunc {
+	return rateLimitMiddleware("auth", func() RateLimit { return settings.AuthRateLimit }, func(c *gin.Context) string {
+		return c.ClientIP()
+	})
+}
+
+// BoardRateLimitMiddleware limits board API requests per user, to
+// RATE_LIMIT_BOARDS. Use after JWTMiddleware.
+func BoardRateLimitMiddleware() gin.HandlerFunc {
+	return rateLimitMiddleware("boards", func() RateLimit { return settings.BoardRateLimit }, func(c *gin.Context) string {
+		if userID := c.GetString("userId"); userID != "" {
+			return "user:" + userID
+		}
+		return "ip:" + c.ClientIP()
+	})
+}
+
+// rateLimitMiddleware answers 429 with Retry-After once a client has used
+// up its bucket, and tells every client what it has left
+func rateLimitMiddleware(name string, configured func() RateLimit, client func(*gin.Context) string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit := configured()
+		if limit.Requests == 0 {
+			c.Next()
+			return
+		}
+
+		key := name + ":" + client(c)
+		ctx, cancel := context.WithTimeout(c.Request.Context(), rateLimitTimeout)
+		allowed, remaining, retryAfter, err := getRateLimiter().Take(ctx, key, limit)
+		cancel()
+		if err != nil {
+			logRateLimitError(err)
+			allowed, remaining, retryAfter, _ = localRateLimiter.Take(c.Request.Context(), key, limit)
+		}
+
+		c.Header("X-RateLimit-Limit", strconv.Itoa(limit.Requests))
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		if !allowed {
+			seconds := int(math.Ceil(retryAfter.Seconds()))
+			c.Header("Retry-After", strconv.Itoa(seconds))
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"error":      "Too many requests. Please try again later.",
+				"retryAfter": seconds,
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// rateLimitErrors keeps a failing Redis from flooding the log
+var rateLimitErrors = struct {
+	sync.Mutex
+	last time.Time
+}{}
+
+func logRateLimitError(err error) {
+	rateLimitErrors.Lock()
+	defer rateLimitErrors.Unlock()
+	if time.Since(rateLimitErrors.last) < time.Minute {
+		return
+	}
+	rateLimitErrors.last = time.Now()
+	slog.Warn("Rate limiting", "error", err)
+}
+
+// memoryRateLimiter keeps buckets in this instance's memory. Buckets that
+// have filled up again are swept away once a minute.
+type memoryRateLimiter struct {
+	sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	at     time.Time
+	full   time.Time // When the bucket is full again if left alone
+}
+
+func (m *memoryRateLimiter) Take(ctx context.Context, key string, limit RateLimit) (bool, int, time.Duration, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	now := time.Now()
+	if now.Sub(m.lastSweep) > time.Minute {
+		for id, bucket := range m.buckets {
+			if !now.Before(bucket.full) {
+				delete(m.buckets, id)
+			}
+		}
+		m.lastSweep = now
+	}
+
+	capacity := float64(limit.Requests)
+	perToken := limit.Period / time.Duration(limit.Requests)
+	bucket, ok := m.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: capacity, at: now}
+		m.buckets[key] = bucket
+	}
+	bucket.tokens = math.Min(capacity, bucket.tokens+float64(now.Sub(bucket.at))/float64(perToken))
+	bucket.at = now
+
+	allowed := bucket.tokens >= 1
+	var retryAfter time.Duration
+	if allowed {
+		bucket.tokens--
+	} else {
+		retryAfter = time.Duration((1 - bucket.tokens) * float64(perToken))
+	}
+	bucket.full = now.Add(time.Duration((capacity - bucket.tokens) * float64(perToken)))
+	return allowed, int(bucket.tokens), retryAfter, nil
+}
+
+// rateLimitScript takes a token from the bucket in KEYS[1], by the Redis
+// server's clock so instances agree. ARGV holds the capacity and period in
+// milliseconds; it returns whether a token was taken, the tokens left and
+// the milliseconds until the next one.
+const rateLimitScript = `
+local capacity = tonumber(ARGV[1])
+local period = tonumber(ARGV[2])
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'at')
+local tokens = tonumber(bucket[1]) or capacity
+local at = tonumber(bucket[2]) or now
+tokens = math.min(capacity, tokens + math.max(0, now - at) * capacity / period)
+local allowed, wait = 0, 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+else
+  wait = math.ceil((1 - tokens) * period / capacity)
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'at', tostring(now))
+redis.call('PEXPIRE', KEYS[1], period)
+return {allowed, math.floor(tokens), wait}
+`
+
+var rateLimitScriptSHA = func() string {
+	sum := sha1.Sum([]byte(rateLimitScript))
+	return hex.EncodeToString(sum[:])
+}()
+
+// redisRateLimiter keeps buckets in Redis, shared by every instance
+type redisRateLimiter struct {
+	client *redisClient
+}
+
+func (r *redisRateLimiter) Take(ctx context.Context, key string, limit RateLimit) (bool, int, time.Duration, error) {
+	args := []string{"ratelimit:" + key, strconv.Itoa(limit.Requests), strconv.FormatInt(limit.Period.Milliseconds(), 10)}
+	reply, err := r.client.do(ctx, append([]string{"EVALSHA", rateLimitScriptSHA, "1"}, args...)...)
+	if err != nil && strings.HasPrefix(err.Error(), "redis: NOSCRIPT") {
+		reply, err = r.client.do(ctx, append([]string{"EVAL", rateLimitScript, "1"}, args...)...)
+	}
+	if err != nil {
+		return false, 0, 0, err
+	}
+
+	values, ok := reply.([]interface{})
+	if !ok || len(values) != 3 {
+		return false, 0, 0, fmt.Errorf("unexpected rate limit reply %v", reply)
+	}
+	allowed, _ := values[0].(int64)
+	remaining, _ := values[1].(int64)
+	wait, _ := values[2].(int64)
+	return allowed == 1, int(remaining), time.Duration(wait) * time.Millisecond, nil
+}
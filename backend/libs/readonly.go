@@ -0,0 +1,92 @@
+package libs
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// readOnlyState holds the instance's read-only (failover/maintenance) mode.
+// Configure sets it from READ_ONLY_MODE/STANDBY_URL, and it can be flipped
+// at runtime through the admin API.
+var readOnlyState = struct {
+	sync.RWMutex
+	enabled    bool
+	standbyURL string
+}{}
+
+// GetReadOnlyMode returns whether writes are currently rejected and the
+// standby URL clients are pointed at.
+func GetReadOnlyMode() (bool, string) {
+	readOnlyState.RLock()
+	defer readOnlyState.RUnlock()
+	return readOnlyState.enabled, readOnlyState.standbyURL
+}
+
+// SetReadOnlyMode switches read-only mode on or off for this instance.
+func SetReadOnlyMode(enabled bool, standbyURL string) {
+	readOnlyState.Lock()
+	defer readOnlyState.Unlock()
+	readOnlyState.enabled = enabled
+	readOnlyState.standbyURL = standbyURL
+}
+
+// ReadOnlyMiddleware rejects write requests with 503 while read-only mode is
+// on. Login (which does not write) and the admin API (so the mode can be
+// switched back) stay available.
+func ReadOnlyMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		enabled, standbyURL := GetReadOnlyMode()
+		if !enabled {
+			c.Next()
+			return
+		}
+
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+			return
+		}
+
+		if isReadOnlyExempt(c.Request.URL.Path) {
+			c.Next()
+			return
+		}
+
+		response := gin.H{"error": "Server is in read-only mode; changes cannot be saved right now"}
+		if standbyURL != "" {
+			response["standbyUrl"] = standbyURL
+		}
+		c.JSON(http.StatusServiceUnavailable, response)
+		c.Abort()
+	}
+}
+
+// readOnlyExemptPaths keep working in read-only mode so users can still sign
+// in and keep their sessions alive
+var readOnlyExemptPaths = map[string]bool{
+	"/auth/login":   true,
+	"/auth/refresh": true,
+	"/auth/logout":  true,
+}
+
+// readOnlyBoardActions are /api/boards/:boardId/<action> POSTs that don't
+// write
+var readOnlyBoardActions = map[string]bool{
+	"cluster": true,
+	"lint":    true,
+}
+
+func isReadOnlyExempt(path string) bool {
+	if readOnlyExemptPaths[path] || strings.HasPrefix(path, "/api/admin/") {
+		return true
+	}
+	// Board analysis endpoints are POSTs but only read the board
+	if strings.HasPrefix(path, "/api/boards/") {
+		action := path[strings.LastIndex(path, "/")+1:]
+		return readOnlyBoardActions[action]
+	}
+	return false
+}
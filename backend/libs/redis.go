@@ -0,0 +1,222 @@
+package libs
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A minimal Redis client speaking RESP2, for the little the backend keeps
+// in Redis. Connections are pooled and dropped on any error.
+
+const (
+	redisTimeout   = time.Second
+	maxIdleRedis   = 8
+	maxRedisBulk   = 64 << 20
+	maxRedisArray  = 1 << 16
+	redisKeepAlive = 30 * time.Second
+)
+
+// redisError is an error reply from the server
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+type redisClient struct {
+	addr     string
+	username string
+	password string
+	db       int
+	tls      bool
+
+	mu   sync.Mutex
+	idle []*redisConn
+}
+
+type redisConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+// newRedisClient parses a redis:// or rediss:// (TLS) URL, with an
+// optional user and password and a database number as the path
+func newRedisClient(rawURL string) (*redisClient, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "redis" && parsed.Scheme != "rediss") || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid Redis URL %q", rawURL)
+	}
+
+	client := &redisClient{addr: parsed.Host, tls: parsed.Scheme == "rediss"}
+	if parsed.Port() == "" {
+		client.addr = net.JoinHostPort(parsed.Hostname(), "6379")
+	}
+	if parsed.User != nil {
+		client.username = parsed.User.Username()
+		client.password, _ = parsed.User.Password()
+	}
+	if db := strings.Trim(parsed.Path, "/"); db != "" {
+		if client.db, err = strconv.Atoi(db); err != nil {
+			return nil, fmt.Errorf("invalid Redis database %q", db)
+		}
+	}
+	return client, nil
+}
+
+// do sends one command and returns its reply: a string, an int64, nil, a
+// []interface{} of those, or a redisError
+func (r *redisClient) do(ctx context.Context, args ...string) (interface{}, error) {
+	conn, err := r.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(redisTimeout)
+	}
+	conn.SetDeadline(deadline)
+
+	reply, err := conn.command(args)
+	if err != nil {
+		if _, ok := err.(redisError); !ok {
+			conn.Close()
+			return nil, err
+		}
+	}
+	r.release(conn)
+	return reply, err
+}
+
+func (r *redisClient) conn(ctx context.Context) (*redisConn, error) {
+	r.mu.Lock()
+	if n := len(r.idle); n > 0 {
+		conn := r.idle[n-1]
+		r.idle = r.idle[:n-1]
+		r.mu.Unlock()
+		return conn, nil
+	}
+	r.mu.Unlock()
+
+	dialer := &net.Dialer{Timeout: redisTimeout, KeepAlive: redisKeepAlive}
+	var raw net.Conn
+	var err error
+	if r.tls {
+		host, _, _ := net.SplitHostPort(r.addr)
+		raw, err = (&tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: host}}).DialContext(ctx, "tcp", r.addr)
+	} else {
+		raw, err = dialer.DialContext(ctx, "tcp", r.addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	conn := &redisConn{Conn: raw, reader: bufio.NewReader(raw)}
+	conn.SetDeadline(time.Now().Add(redisTimeout))
+	if r.password != "" {
+		args := []string{"AUTH", r.password}
+		if r.username != "" {
+			args = []string{"AUTH", r.username, r.password}
+		}
+		if _, err := conn.command(args); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if r.db != 0 {
+		if _, err := conn.command([]string{"SELECT", strconv.Itoa(r.db)}); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+func (r *redisClient) release(conn *redisConn) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.idle) >= maxIdleRedis {
+		conn.Close()
+		return
+	}
+	r.idle = append(r.idle, conn)
+}
+
+func (c *redisConn) command(args []string) (interface{}, error) {
+	var request strings.Builder
+	fmt.Fprintf(&request, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&request, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(c.Conn, request.String()); err != nil {
+		return nil, err
+	}
+	return c.readReply()
+}
+
+func (c *redisConn) readReply() (interface{}, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || !strings.HasSuffix(line, "\r\n") {
+		return nil, errors.New("redis: malformed reply")
+	}
+	kind, value := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return value, nil
+	case '-':
+		return nil, redisError(value)
+	case ':':
+		return strconv.ParseInt(value, 10, 64)
+	case '$':
+		size, err := strconv.Atoi(value)
+		if err != nil || size > maxRedisBulk {
+			return nil, errors.New("redis: malformed bulk reply")
+		}
+		if size < 0 {
+			return nil, nil
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(c.reader, data); err != nil {
+			return nil, err
+		}
+		return string(data[:size]), nil
+	case '*':
+		count, err := strconv.Atoi(value)
+		if err != nil || count > maxRedisArray {
+			return nil, errors.New("redis: malformed array reply")
+		}
+		if count < 0 {
+			return nil, nil
+		}
+		// An error inside an array (from a script) fails the whole reply,
+		// once the rest of it is read
+		var replyErr error
+		items := make([]interface{}, count)
+		for i := range items {
+			items[i], err = c.readReply()
+			if _, ok := err.(redisError); err != nil && !ok {
+				return nil, err
+			}
+			if replyErr == nil {
+				replyErr = err
+			}
+		}
+		if replyErr != nil {
+			return nil, replyErr
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("redis: unexpected reply type %q", kind)
+}
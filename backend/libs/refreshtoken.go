@@ -0,0 +1,209 @@
+package libs
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sarwanazhar/boardsar/backend/database"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const refreshTokenCollection = "refresh_tokens"
+
+// ErrInvalidRefreshToken is returned for unknown, expired or revoked tokens.
+// The text is safe to return to clients.
+var ErrInvalidRefreshToken = errors.New("Invalid refresh token")
+
+func GetRefreshTokenCollection() *mongo.Collection {
+	return database.GetCollection(refreshTokenCollection)
+}
+
+// AccessTokenTTL is how long an access token stays valid, from
+// ACCESS_TOKEN_TTL
+func AccessTokenTTL() time.Duration {
+	return settings.AccessTokenTTL
+}
+
+// RefreshTokenTTL is how long a refresh token stays valid, from
+// REFRESH_TOKEN_TTL
+func RefreshTokenTTL() time.Duration {
+	return settings.RefreshTokenTTL
+}
+
+// newSecretToken returns a random URL-safe token and the hash to store
+func newSecretToken() (string, string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+	return token, hashToken(token), nil
+}
+
+// hashToken is how secret tokens are stored, so a database leak doesn't
+// hand out working tokens
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// IssueRefreshToken creates and stores a refresh token for the user. An
+// empty familyID starts a new family (a new login).
+func IssueRefreshToken(ctx context.Context, userID primitive.ObjectID, familyID string) (string, error) {
+	return storeRefreshToken(ctx, models.RefreshToken{UserID: userID, FamilyID: familyID})
+}
+
+// IssueClientRefreshToken starts a new refresh token family for an OAuth
+// app the user granted scopes to
+func IssueClientRefreshToken(ctx context.Context, userID, clientID primitive.ObjectID, scopes []string) (string, error) {
+	return storeRefreshToken(ctx, models.RefreshToken{UserID: userID, ClientID: clientID, Scopes: scopes})
+}
+
+func storeRefreshToken(ctx context.Context, stored models.RefreshToken) (string, error) {
+	token, tokenHash, err := newSecretToken()
+	if err != nil {
+		return "", fmt.Errorf("error generating refresh token: %w", err)
+	}
+
+	if stored.FamilyID == "" {
+		stored.FamilyID = uuid.New().String()
+	}
+
+	now := time.Now()
+	stored.ID = primitive.NewObjectID()
+	stored.TokenHash = tokenHash
+	stored.CreatedAt = now
+	stored.ExpiresAt = now.Add(RefreshTokenTTL())
+	stored.RevokedAt = nil
+	if _, err := GetRefreshTokenCollection().InsertOne(ctx, stored); err != nil {
+		return "", fmt.Errorf("error storing refresh token: %w", err)
+	}
+	return token, nil
+}
+
+// RotateRefreshToken revokes a refresh token and issues its replacement,
+// returning the rotated token's record. Tokens only rotate for the client
+// they were issued to; a zero clientID means the first-party app. A token
+// that was already rotated is being replayed, so its whole family is
+// revoked and the caller has to log in again.
+func RotateRefreshToken(ctx context.Context, token string, clientID primitive.ObjectID) (*models.RefreshToken, string, error) {
+	now := time.Now()
+
+	filter := bson.M{
+		"tokenHash": hashToken(token),
+		"revokedAt": bson.M{"$exists": false},
+		"expiresAt": bson.M{"$gt": now},
+	}
+	if clientID.IsZero() {
+		filter["clientId"] = bson.M{"$exists": false}
+	} else {
+		filter["clientId"] = clientID
+	}
+
+	var stored models.RefreshToken
+	err := GetRefreshTokenCollection().FindOneAndUpdate(ctx, filter,
+		bson.M{"$set": bson.M{"revokedAt": now}},
+	).Decode(&stored)
+
+	if err == mongo.ErrNoDocuments {
+		revokeReusedFamily(ctx, token)
+		return nil, "", ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("error rotating refresh token: %w", err)
+	}
+
+	next, err := storeRefreshToken(ctx, stored)
+	if err != nil {
+		return nil, "", err
+	}
+	return &stored, next, nil
+}
+
+// revokeReusedFamily revokes every token in the family of a revoked token
+// that was presented again
+func revokeReusedFamily(ctx context.Context, token string) {
+	var stored models.RefreshToken
+	err := GetRefreshTokenCollection().FindOne(ctx, bson.M{
+		"tokenHash": hashToken(token),
+		"revokedAt": bson.M{"$exists": true},
+	}).Decode(&stored)
+	if err != nil {
+		return
+	}
+
+	slog.Warn("Refresh token reuse detected; revoking its sessions", "user_id", stored.UserID.Hex())
+	_, err = GetRefreshTokenCollection().UpdateMany(ctx,
+		bson.M{"familyId": stored.FamilyID, "revokedAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revokedAt": time.Now()}},
+	)
+	if err != nil {
+		slog.Warn("Failed to revoke refresh token family", "error", err)
+	}
+	if err := endFamilySession(ctx, stored.FamilyID); err != nil {
+		slog.Warn("Failed to revoke session of refresh token family", "error", err)
+	}
+}
+
+// RevokeUserRefreshTokens revokes every refresh token and session of a
+// user, signing them out everywhere
+func RevokeUserRefreshTokens(ctx context.Context, userID primitive.ObjectID) error {
+	_, err := GetRefreshTokenCollection().UpdateMany(ctx,
+		bson.M{"userId": userID, "revokedAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revokedAt": time.Now()}},
+	)
+	if err != nil {
+		return fmt.Errorf("error revoking refresh tokens: %w", err)
+	}
+	if err := revokeUserSessions(ctx, userID); err != nil {
+		return fmt.Errorf("error revoking sessions: %w", err)
+	}
+	return nil
+}
+
+// RevokeClientRefreshTokens revokes an OAuth app's refresh tokens, for one
+// user or, with a zero userID, for everyone
+func RevokeClientRefreshTokens(ctx context.Context, clientID, userID primitive.ObjectID) error {
+	filter := bson.M{"clientId": clientID, "revokedAt": bson.M{"$exists": false}}
+	if !userID.IsZero() {
+		filter["userId"] = userID
+	}
+	_, err := GetRefreshTokenCollection().UpdateMany(ctx, filter,
+		bson.M{"$set": bson.M{"revokedAt": time.Now()}},
+	)
+	if err != nil {
+		return fmt.Errorf("error revoking refresh tokens: %w", err)
+	}
+	return nil
+}
+
+// RevokeRefreshToken revokes a refresh token and ends its session, e.g. on
+// logout, and returns the user it belonged to. Unknown tokens are ignored.
+func RevokeRefreshToken(ctx context.Context, token string) (primitive.ObjectID, error) {
+	var revoked models.RefreshToken
+	err := GetRefreshTokenCollection().FindOneAndUpdate(ctx,
+		bson.M{"tokenHash": hashToken(token), "revokedAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revokedAt": time.Now()}},
+	).Decode(&revoked)
+	if err == mongo.ErrNoDocuments {
+		return primitive.NilObjectID, nil
+	}
+	if err != nil {
+		return primitive.NilObjectID, fmt.Errorf("error revoking refresh token: %w", err)
+	}
+	if err := endFamilySession(ctx, revoked.FamilyID); err != nil {
+		return primitive.NilObjectID, fmt.Errorf("error ending session: %w", err)
+	}
+	return revoked.UserID, nil
+}
@@ -0,0 +1,488 @@
+package libs
+
+import (
+	"context"
+	"fmt"
+	"image/color"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Formats a board can be rendered to
+const (
+	RenderSVG = "svg"
+	RenderPNG = "png"
+	RenderPDF = "pdf"
+)
+
+// RenderContentTypes maps each render format to its MIME type
+var RenderContentTypes = map[string]string{
+	RenderSVG: "image/svg+xml",
+	RenderPNG: "image/png",
+	RenderPDF: "application/pdf",
+}
+
+// Drawing defaults, matching how the editor draws shapes
+const (
+	renderMargin       = 20.0
+	renderStrokeWidth  = 3.0
+	renderCornerRadius = 8.0
+	renderStickyPad    = 10.0
+	renderFrameTitle   = 14.0
+	renderFontFamily   = "Spline Sans, sans-serif"
+)
+
+// Largest PNG rendered, in pixels and per side; bigger boards are scaled
+// down to fit
+const (
+	MaxRenderScale  = 4.0
+	maxRenderPixels = 50_000_000
+	maxRenderSide   = 16384
+)
+
+var (
+	renderBlack      = color.NRGBA{0, 0, 0, 255}
+	renderWhite      = color.NRGBA{255, 255, 255, 255}
+	renderFrameColor = color.NRGBA{156, 163, 175, 255}
+	renderStickyFill = color.NRGBA{253, 230, 138, 255}
+	renderStickyText = color.NRGBA{31, 41, 55, 255}
+)
+
+// RenderBoard draws the shapes of a board state, in order, to w. scale
+// multiplies the size of PNGs (1 is one pixel per board unit) and is
+// ignored for the vector formats. Run as a job, it reports its progress.
+func RenderBoard(ctx context.Context, w io.Writer, data map[string]interface{}, format string, scale float64) error {
+	scene := buildScene(data)
+	scene.progress = func(drawn, total int) {
+		// Encoding the drawn file takes the rest
+		ReportJobProgress(ctx, drawn*90/total)
+	}
+
+	switch format {
+	case RenderSVG:
+		return renderSVG(w, scene)
+	case RenderPNG:
+		return renderPNG(w, scene, scale)
+	case RenderPDF:
+		return renderPDF(w, scene)
+	}
+	return fmt.Errorf("unknown render format %q", format)
+}
+
+// renderPoint is a point in board coordinates
+type renderPoint struct {
+	X, Y float64
+}
+
+// pathCmd is one path command: M and L take one point, C takes two
+// control points and the end point, Z closes the subpath
+type pathCmd struct {
+	op  byte
+	pts [3]renderPoint
+}
+
+// renderPath is an outline made of lines and cubic curves
+type renderPath struct {
+	cmds []pathCmd
+}
+
+func (p *renderPath) moveTo(x, y float64) {
+	p.cmds = append(p.cmds, pathCmd{op: 'M', pts: [3]renderPoint{{x, y}}})
+}
+
+func (p *renderPath) lineTo(x, y float64) {
+	p.cmds = append(p.cmds, pathCmd{op: 'L', pts: [3]renderPoint{{x, y}}})
+}
+
+func (p *renderPath) cubicTo(x1, y1, x2, y2, x, y float64) {
+	p.cmds = append(p.cmds, pathCmd{op: 'C', pts: [3]renderPoint{{x1, y1}, {x2, y2}, {x, y}}})
+}
+
+func (p *renderPath) close() {
+	p.cmds = append(p.cmds, pathCmd{op: 'Z'})
+}
+
+// rotate turns the path by degrees around the origin point, the way the
+// editor rotates shapes around their x, y
+func (p *renderPath) rotate(degrees float64, origin renderPoint) {
+	if degrees == 0 {
+		return
+	}
+	sin, cos := math.Sincos(degrees * math.Pi / 180)
+	for i := range p.cmds {
+		for j := range p.cmds[i].pts {
+			pt := &p.cmds[i].pts[j]
+			dx, dy := pt.X-origin.X, pt.Y-origin.Y
+			pt.X = origin.X + dx*cos - dy*sin
+			pt.Y = origin.Y + dx*sin + dy*cos
+		}
+	}
+}
+
+// kappa places cubic control points to approximate a quarter circle
+const kappa = 0.5522847498
+
+func ellipsePath(cx, cy, rx, ry float64) *renderPath {
+	p := &renderPath{}
+	ox, oy := rx*kappa, ry*kappa
+	p.moveTo(cx+rx, cy)
+	p.cubicTo(cx+rx, cy+oy, cx+ox, cy+ry, cx, cy+ry)
+	p.cubicTo(cx-ox, cy+ry, cx-rx, cy+oy, cx-rx, cy)
+	p.cubicTo(cx-rx, cy-oy, cx-ox, cy-ry, cx, cy-ry)
+	p.cubicTo(cx+ox, cy-ry, cx+rx, cy-oy, cx+rx, cy)
+	p.close()
+	return p
+}
+
+// rectPath outlines a rectangle with corners rounded by radius. Negative
+// sizes, from shapes drawn up or left, are normalized.
+func rectPath(x, y, width, height, radius float64) *renderPath {
+	if width < 0 {
+		x, width = x+width, -width
+	}
+	if height < 0 {
+		y, height = y+height, -height
+	}
+	radius = math.Max(0, math.Min(radius, math.Min(width, height)/2))
+
+	p := &renderPath{}
+	if radius == 0 {
+		p.moveTo(x, y)
+		p.lineTo(x+width, y)
+		p.lineTo(x+width, y+height)
+		p.lineTo(x, y+height)
+		p.close()
+		return p
+	}
+
+	o := radius * (1 - kappa)
+	p.moveTo(x+radius, y)
+	p.lineTo(x+width-radius, y)
+	p.cubicTo(x+width-o, y, x+width, y+o, x+width, y+radius)
+	p.lineTo(x+width, y+height-radius)
+	p.cubicTo(x+width, y+height-o, x+width-o, y+height, x+width-radius, y+height)
+	p.lineTo(x+radius, y+height)
+	p.cubicTo(x+o, y+height, x, y+height-o, x, y+height-radius)
+	p.lineTo(x, y+radius)
+	p.cubicTo(x, y+o, x+o, y, x+radius, y)
+	p.close()
+	return p
+}
+
+func polylinePath(points []float64) *renderPath {
+	p := &renderPath{}
+	for i := 0; i+1 < len(points); i += 2 {
+		if i == 0 {
+			p.moveTo(points[i], points[i+1])
+		} else {
+			p.lineTo(points[i], points[i+1])
+		}
+	}
+	return p
+}
+
+// drawOp is one step of drawing a board: filling or stroking a path, or a
+// line of text with its baseline at x, y
+type drawOp struct {
+	path   *renderPath
+	fill   bool
+	color  color.NRGBA
+	width  float64
+	text   string
+	x, y   float64
+	size   float64
+	isText bool
+}
+
+// renderScene is a board ready to draw: its operations in paint order and
+// the area they cover, margin included
+type renderScene struct {
+	ops    []drawOp
+	bounds Bounds
+	// progress, when set, is told how many ops have been drawn
+	progress func(drawn, total int)
+}
+
+// drew reports that the first n ops have been drawn
+func (s renderScene) drew(n int) {
+	if s.progress != nil {
+		s.progress(n, len(s.ops))
+	}
+}
+
+// canvasTransform maps board coordinates to output coordinates
+type canvasTransform struct {
+	minX, minY, scale float64
+}
+
+func (t canvasTransform) apply(pt renderPoint) renderPoint {
+	return renderPoint{(pt.X - t.minX) * t.scale, (pt.Y - t.minY) * t.scale}
+}
+
+// buildScene turns the shapes of a board state into drawing operations.
+// Custom shape types are drawn as a box with their text.
+func buildScene(data map[string]interface{}) renderScene {
+	scene := renderScene{}
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	grow := func(b Bounds, pad float64) {
+		minX, minY = math.Min(minX, b.X-pad), math.Min(minY, b.Y-pad)
+		maxX, maxY = math.Max(maxX, b.X+b.Width+pad), math.Max(maxY, b.Y+b.Height+pad)
+	}
+
+	shapes, _ := ShapeList(data)
+	for _, item := range shapes {
+		shape, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		bounds, ok := ShapeBounds(shape)
+		if !ok {
+			continue
+		}
+		ops := shapeOps(shape, bounds)
+		if len(ops) == 0 {
+			continue
+		}
+		scene.ops = append(scene.ops, ops...)
+
+		// Rotated shapes may reach past their unrotated box
+		pad := renderStrokeWidth
+		if rotation, _ := ShapeNumber(shape, "rotation"); rotation != 0 {
+			pad += math.Hypot(bounds.Width, bounds.Height)
+		}
+		grow(bounds, pad)
+		if shapeType, _ := shape["type"].(string); shapeType == "frame" {
+			grow(Bounds{X: bounds.X, Y: bounds.Y - renderFrameTitle*lineHeightRatio, Width: bounds.Width}, 0)
+		}
+	}
+
+	if math.IsInf(minX, 1) {
+		minX, minY, maxX, maxY = 0, 0, 200, 100
+	}
+	scene.bounds = Bounds{
+		X:      minX - renderMargin,
+		Y:      minY - renderMargin,
+		Width:  maxX - minX + 2*renderMargin,
+		Height: maxY - minY + 2*renderMargin,
+	}
+	return scene
+}
+
+// shapeOps draws one shape
+func shapeOps(shape map[string]interface{}, bounds Bounds) []drawOp {
+	shapeType, _ := shape["type"].(string)
+	fill, hasFill := shapeColor(shape, "fill")
+	stroke, hasStroke := shapeColor(shape, "stroke")
+	strokeWidth, ok := ShapeNumber(shape, "strokeWidth")
+	if !ok || strokeWidth < 0 {
+		strokeWidth = renderStrokeWidth
+	}
+	rotation, _ := ShapeNumber(shape, "rotation")
+	origin := renderPoint{bounds.X, bounds.Y}
+
+	var ops []drawOp
+	addPath := func(p *renderPath, fillColor color.NRGBA, doFill bool, strokeColor color.NRGBA, doStroke bool) {
+		p.rotate(rotation, origin)
+		if doFill && fillColor.A > 0 {
+			ops = append(ops, drawOp{path: p, fill: true, color: fillColor})
+		}
+		if doStroke && strokeColor.A > 0 && strokeWidth > 0 {
+			ops = append(ops, drawOp{path: p, color: strokeColor, width: strokeWidth})
+		}
+	}
+
+	switch shapeType {
+	case "pen", "line":
+		points, _ := shapePoints(shape)
+		if !hasStroke {
+			stroke = renderBlack
+		}
+		addPath(polylinePath(points), color.NRGBA{}, false, stroke, true)
+
+	case "circle":
+		x, _ := ShapeNumber(shape, "x")
+		y, _ := ShapeNumber(shape, "y")
+		radius := bounds.Width / 2
+		if !hasStroke {
+			stroke = renderBlack
+		}
+		addPath(ellipsePath(x, y, radius, radius), fill, hasFill, stroke, true)
+
+	case "rect":
+		addPath(rectPath(bounds.X, bounds.Y, bounds.Width, bounds.Height, renderCornerRadius), fill, hasFill, stroke, hasStroke)
+
+	case "frame":
+		if !hasStroke {
+			stroke = renderFrameColor
+		}
+		addPath(rectPath(bounds.X, bounds.Y, bounds.Width, bounds.Height, 0), fill, hasFill, stroke, true)
+		if title := ShapeText(shape); title != "" {
+			ops = append(ops, textOps(strings.Split(title, "\n")[:1], bounds.X, bounds.Y-renderFrameTitle*lineHeightRatio, renderFrameTitle, renderFrameColor)...)
+		}
+
+	case "text":
+		if !hasFill {
+			fill = renderBlack
+		}
+		fontSize := shapeFontSize(shape)
+		ops = append(ops, textOps(strings.Split(ShapeText(shape), "\n"), bounds.X, bounds.Y, fontSize, fill)...)
+
+	case "sticky":
+		if !hasFill {
+			fill = renderStickyFill
+		}
+		addPath(rectPath(bounds.X, bounds.Y, bounds.Width, bounds.Height, renderCornerRadius/2), fill, true, stroke, hasStroke)
+		textColor, ok := shapeColor(shape, "textColor")
+		if !ok {
+			textColor = renderStickyText
+		}
+		fontSize := shapeFontSize(shape)
+		lines := wrapText(ShapeText(shape), bounds.Width-2*renderStickyPad, fontSize)
+		ops = append(ops, textOps(lines, bounds.X+renderStickyPad, bounds.Y+renderStickyPad, fontSize, textColor)...)
+
+	default:
+		if !hasStroke {
+			stroke = renderFrameColor
+		}
+		addPath(rectPath(bounds.X, bounds.Y, bounds.Width, bounds.Height, renderCornerRadius), fill, hasFill, stroke, true)
+		if text := ShapeText(shape); text != "" {
+			fontSize := shapeFontSize(shape)
+			lines := wrapText(text, bounds.Width-2*renderStickyPad, fontSize)
+			ops = append(ops, textOps(lines, bounds.X+renderStickyPad, bounds.Y+renderStickyPad, fontSize, renderBlack)...)
+		}
+	}
+	return ops
+}
+
+// textOps lays out lines of text from the top-left corner
+func textOps(lines []string, x, top, size float64, c color.NRGBA) []drawOp {
+	var ops []drawOp
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		baseline := top + float64(i)*size*lineHeightRatio + size*0.8
+		ops = append(ops, drawOp{isText: true, text: line, x: x, y: baseline, size: size, color: c})
+	}
+	return ops
+}
+
+// wrapText breaks text into lines that fit width, using the same character
+// width estimate as ShapeBounds
+func wrapText(text string, width, size float64) []string {
+	perLine := int(width / (size * charWidthRatio))
+	if perLine < 1 {
+		perLine = 1
+	}
+
+	var lines []string
+	for _, paragraph := range strings.Split(text, "\n") {
+		line := ""
+		for _, word := range strings.Fields(paragraph) {
+			for len([]rune(word)) > perLine {
+				if line != "" {
+					lines = append(lines, line)
+					line = ""
+				}
+				runes := []rune(word)
+				lines = append(lines, string(runes[:perLine]))
+				word = string(runes[perLine:])
+			}
+			switch {
+			case line == "":
+				line = word
+			case len([]rune(line))+1+len([]rune(word)) <= perLine:
+				line += " " + word
+			default:
+				lines = append(lines, line)
+				line = word
+			}
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func shapeFontSize(shape map[string]interface{}) float64 {
+	if size, ok := ShapeNumber(shape, "fontSize"); ok && size > 0 {
+		return size
+	}
+	return defaultFontSize
+}
+
+// shapeColor reads a CSS color from a shape field
+func shapeColor(shape map[string]interface{}, key string) (color.NRGBA, bool) {
+	value, _ := shape[key].(string)
+	return parseCSSColor(value)
+}
+
+var namedColors = map[string]color.NRGBA{
+	"black":       {0, 0, 0, 255},
+	"white":       {255, 255, 255, 255},
+	"red":         {255, 0, 0, 255},
+	"green":       {0, 128, 0, 255},
+	"blue":        {0, 0, 255, 255},
+	"yellow":      {255, 255, 0, 255},
+	"orange":      {255, 165, 0, 255},
+	"purple":      {128, 0, 128, 255},
+	"pink":        {255, 192, 203, 255},
+	"gray":        {128, 128, 128, 255},
+	"grey":        {128, 128, 128, 255},
+	"transparent": {0, 0, 0, 0},
+}
+
+// parseCSSColor understands the colors the editor stores: hex (#rgb,
+// #rrggbb, #rrggbbaa), rgb()/rgba() and common names
+func parseCSSColor(value string) (color.NRGBA, bool) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "" {
+		return color.NRGBA{}, false
+	}
+	if c, ok := namedColors[value]; ok {
+		return c, true
+	}
+
+	if hex, ok := strings.CutPrefix(value, "#"); ok {
+		if len(hex) == 3 || len(hex) == 4 {
+			expanded := ""
+			for _, r := range hex {
+				expanded += string(r) + string(r)
+			}
+			hex = expanded
+		}
+		if len(hex) == 6 {
+			hex += "ff"
+		}
+		n, err := strconv.ParseUint(hex, 16, 32)
+		if len(hex) != 8 || err != nil {
+			return color.NRGBA{}, false
+		}
+		return color.NRGBA{uint8(n >> 24), uint8(n >> 16), uint8(n >> 8), uint8(n)}, true
+	}
+
+	for _, prefix := range []string{"rgba(", "rgb("} {
+		args, ok := strings.CutPrefix(value, prefix)
+		if !ok {
+			continue
+		}
+		parts := strings.Split(strings.TrimSuffix(args, ")"), ",")
+		if len(parts) != 3 && len(parts) != 4 {
+			return color.NRGBA{}, false
+		}
+		var channels [4]float64
+		channels[3] = 1
+		for i, part := range parts {
+			n, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+			if err != nil {
+				return color.NRGBA{}, false
+			}
+			channels[i] = n
+		}
+		clamp := func(n float64) uint8 { return uint8(math.Max(0, math.Min(255, math.Round(n)))) }
+		return color.NRGBA{clamp(channels[0]), clamp(channels[1]), clamp(channels[2]), clamp(channels[3] * 255)}, true
+	}
+	return color.NRGBA{}, false
+}
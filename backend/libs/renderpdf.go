@@ -0,0 +1,161 @@
+package libs
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image/color"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// pdfPointsPerUnit sizes PDF pages like a 96 dpi screen; pages are scaled
+// down further to stay within the largest page PDF readers accept
+const (
+	pdfPointsPerUnit = 0.75
+	maxPDFPageSide   = 14400.0
+)
+
+// renderPDF writes the scene as a single-page PDF. Text uses the standard
+// Helvetica font, so nothing is embedded; characters outside Latin-1 are
+// replaced.
+func renderPDF(w io.Writer, scene renderScene) error {
+	b := scene.bounds
+	scale := math.Min(pdfPointsPerUnit, maxPDFPageSide/math.Max(b.Width, b.Height))
+	pageWidth, pageHeight := b.Width*scale, b.Height*scale
+
+	// Alpha needs a graphics state per opacity
+	alphas := map[uint8]string{}
+	gs := func(c color.NRGBA) string {
+		if c.A == 255 {
+			return ""
+		}
+		name, ok := alphas[c.A]
+		if !ok {
+			name = "GA" + strconv.Itoa(len(alphas))
+			alphas[c.A] = name
+		}
+		return "/" + name + " gs\n"
+	}
+
+	var content bytes.Buffer
+	// Flip to board orientation: y grows down from the top-left of the
+	// scene's bounds
+	fmt.Fprintf(&content, "%s 0 0 %s %s %s cm\n",
+		pdfNumber(scale), pdfNumber(-scale), pdfNumber(-b.X*scale), pdfNumber(pageHeight+b.Y*scale))
+	fmt.Fprintf(&content, "1 1 1 rg %s %s %s %s re f\n", pdfNumber(b.X), pdfNumber(b.Y), pdfNumber(b.Width), pdfNumber(b.Height))
+
+	for i, op := range scene.ops {
+		content.WriteString("q\n")
+		content.WriteString(gs(op.color))
+		switch {
+		case op.isText:
+			// Text is flipped back upright
+			fmt.Fprintf(&content, "%s rg BT /F1 %s Tf 1 0 0 -1 %s %s Tm (%s) Tj ET\n",
+				pdfColor(op.color), pdfNumber(op.size), pdfNumber(op.x), pdfNumber(op.y), pdfString(op.text))
+		case op.fill:
+			fmt.Fprintf(&content, "%s rg\n%sf\n", pdfColor(op.color), pdfPathData(op.path))
+		default:
+			fmt.Fprintf(&content, "%s RG %s w 1 J 1 j\n%sS\n", pdfColor(op.color), pdfNumber(op.width), pdfPathData(op.path))
+		}
+		content.WriteString("Q\n")
+		scene.drew(i + 1)
+	}
+
+	var stream bytes.Buffer
+	zw := zlib.NewWriter(&stream)
+	zw.Write(content.Bytes())
+	zw.Close()
+
+	names := make([]uint8, 0, len(alphas))
+	for alpha := range alphas {
+		names = append(names, alpha)
+	}
+	sort.Slice(names, func(i, j int) bool { return alphas[names[i]] < alphas[names[j]] })
+	var extGState strings.Builder
+	for _, alpha := range names {
+		a := pdfNumber(float64(alpha) / 255)
+		fmt.Fprintf(&extGState, "/%s << /Type /ExtGState /ca %s /CA %s >> ", alphas[alpha], a, a)
+	}
+
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %s %s] /Resources << /Font << /F1 5 0 R >> /ExtGState << %s>> >> /Contents 4 0 R >>",
+			pdfNumber(pageWidth), pdfNumber(pageHeight), extGState.String()),
+		fmt.Sprintf("<< /Length %d /Filter /FlateDecode >>\nstream\n%s\nendstream", stream.Len(), stream.String()),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+	}
+
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+
+	_, err := out.WriteTo(w)
+	return err
+}
+
+func pdfPathData(p *renderPath) string {
+	var d strings.Builder
+	for _, cmd := range p.cmds {
+		switch cmd.op {
+		case 'M':
+			fmt.Fprintf(&d, "%s %s m\n", pdfNumber(cmd.pts[0].X), pdfNumber(cmd.pts[0].Y))
+		case 'L':
+			fmt.Fprintf(&d, "%s %s l\n", pdfNumber(cmd.pts[0].X), pdfNumber(cmd.pts[0].Y))
+		case 'C':
+			fmt.Fprintf(&d, "%s %s %s %s %s %s c\n",
+				pdfNumber(cmd.pts[0].X), pdfNumber(cmd.pts[0].Y),
+				pdfNumber(cmd.pts[1].X), pdfNumber(cmd.pts[1].Y),
+				pdfNumber(cmd.pts[2].X), pdfNumber(cmd.pts[2].Y))
+		case 'Z':
+			d.WriteString("h\n")
+		}
+	}
+	return d.String()
+}
+
+func pdfColor(c color.NRGBA) string {
+	return pdfNumber(float64(c.R)/255) + " " + pdfNumber(float64(c.G)/255) + " " + pdfNumber(float64(c.B)/255)
+}
+
+// pdfNumber formats a number the way PDF expects: no exponent
+func pdfNumber(n float64) string {
+	n = math.Round(n*1000) / 1000
+	if n == 0 {
+		n = 0
+	}
+	return strconv.FormatFloat(n, 'f', -1, 64)
+}
+
+// pdfString escapes text for a PDF literal string in WinAnsi encoding
+func pdfString(text string) string {
+	var s strings.Builder
+	for _, r := range text {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			s.WriteByte('\\')
+			s.WriteRune(r)
+		case r < ' ' || r > 0xff || (r >= 0x7f && r < 0xa0):
+			s.WriteByte('?')
+		case r < 0x80:
+			s.WriteRune(r)
+		default:
+			fmt.Fprintf(&s, "\\%03o", r)
+		}
+	}
+	return s.String()
+}
@@ -0,0 +1,313 @@
+package libs
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"sort"
+)
+
+// rasterSubsamples is how many rows are sampled per pixel for
+// anti-aliasing; coverage along a row is exact
+const rasterSubsamples = 4
+
+// renderPNG rasterizes the scene. Scale is clamped so the image stays
+// within maxRenderPixels and maxRenderSide.
+func renderPNG(w io.Writer, scene renderScene, scale float64) error {
+	b := scene.bounds
+	if scale <= 0 {
+		scale = 1
+	}
+	scale = math.Min(scale, MaxRenderScale)
+	scale = math.Min(scale, maxRenderSide/math.Max(b.Width, b.Height))
+	if pixels := b.Width * b.Height * scale * scale; pixels > maxRenderPixels {
+		scale *= math.Sqrt(maxRenderPixels / pixels)
+	}
+
+	width := int(math.Ceil(b.Width * scale))
+	height := int(math.Ceil(b.Height * scale))
+	img := image.NewNRGBA(image.Rect(0, 0, max(width, 1), max(height, 1)))
+	for i := 0; i < len(img.Pix); i += 4 {
+		copy(img.Pix[i:i+4], []uint8{255, 255, 255, 255})
+	}
+
+	t := canvasTransform{minX: b.X, minY: b.Y, scale: scale}
+	for i, op := range scene.ops {
+		switch {
+		case op.isText:
+			origin := t.apply(renderPoint{op.x, op.y})
+			fillPolygons(img, glyphPolygons(op.text, origin.X, origin.Y, op.size*scale), op.color)
+		case op.fill:
+			fillPolygons(img, flattenPath(op.path, t), op.color)
+		default:
+			fillPolygons(img, strokePolygons(flattenPath(op.path, t), op.width*scale), op.color)
+		}
+		scene.drew(i + 1)
+	}
+
+	return png.Encode(w, img)
+}
+
+// polygon is a flattened subpath in pixel coordinates; closed subpaths
+// repeat nothing, the last point joins the first when filling
+type polygon struct {
+	points []renderPoint
+	closed bool
+}
+
+// flattenPath converts a path to pixel coordinates, replacing curves with
+// short lines
+func flattenPath(p *renderPath, t canvasTransform) []polygon {
+	var polygons []polygon
+	var current *polygon
+	var last renderPoint
+
+	for _, cmd := range p.cmds {
+		switch cmd.op {
+		case 'M':
+			polygons = append(polygons, polygon{})
+			current = &polygons[len(polygons)-1]
+			last = t.apply(cmd.pts[0])
+			current.points = append(current.points, last)
+		case 'L':
+			if current == nil {
+				continue
+			}
+			last = t.apply(cmd.pts[0])
+			current.points = append(current.points, last)
+		case 'C':
+			if current == nil {
+				continue
+			}
+			p1, p2, p3 := t.apply(cmd.pts[0]), t.apply(cmd.pts[1]), t.apply(cmd.pts[2])
+			length := math.Hypot(p1.X-last.X, p1.Y-last.Y) + math.Hypot(p2.X-p1.X, p2.Y-p1.Y) + math.Hypot(p3.X-p2.X, p3.Y-p2.Y)
+			steps := int(math.Max(4, math.Min(64, math.Ceil(length/3))))
+			for i := 1; i <= steps; i++ {
+				s := float64(i) / float64(steps)
+				u := 1 - s
+				current.points = append(current.points, renderPoint{
+					X: u*u*u*last.X + 3*u*u*s*p1.X + 3*u*s*s*p2.X + s*s*s*p3.X,
+					Y: u*u*u*last.Y + 3*u*u*s*p1.Y + 3*u*s*s*p2.Y + s*s*s*p3.Y,
+				})
+			}
+			last = p3
+		case 'Z':
+			if current != nil {
+				current.closed = true
+			}
+		}
+	}
+	return polygons
+}
+
+// strokePolygons outlines lines of the given width with round joins and
+// caps: a quad per segment and a disc per point. They are all wound the
+// same way, so filling them with the non-zero rule unites them.
+func strokePolygons(lines []polygon, width float64) []polygon {
+	half := width / 2
+	var outline []polygon
+	for _, line := range lines {
+		points := line.points
+		if line.closed && len(points) > 1 {
+			points = append(points, points[0])
+		}
+		for i, p := range points {
+			outline = append(outline, discPolygon(p, half))
+			if i == 0 {
+				continue
+			}
+			q := points[i-1]
+			dx, dy := p.X-q.X, p.Y-q.Y
+			length := math.Hypot(dx, dy)
+			if length == 0 {
+				continue
+			}
+			nx, ny := -dy/length*half, dx/length*half
+			outline = append(outline, counterClockwise(polygon{points: []renderPoint{
+				{q.X + nx, q.Y + ny}, {p.X + nx, p.Y + ny}, {p.X - nx, p.Y - ny}, {q.X - nx, q.Y - ny},
+			}, closed: true}))
+		}
+	}
+	return outline
+}
+
+func discPolygon(center renderPoint, radius float64) polygon {
+	steps := int(math.Max(8, math.Min(64, math.Ceil(2*math.Pi*radius/2))))
+	points := make([]renderPoint, steps)
+	for i := range points {
+		angle := 2 * math.Pi * float64(i) / float64(steps)
+		points[i] = renderPoint{center.X + radius*math.Cos(angle), center.Y + radius*math.Sin(angle)}
+	}
+	return counterClockwise(polygon{points: points, closed: true})
+}
+
+// counterClockwise orders a polygon's points so its signed area is
+// positive
+func counterClockwise(p polygon) polygon {
+	area := 0.0
+	for i, a := range p.points {
+		b := p.points[(i+1)%len(p.points)]
+		area += a.X*b.Y - b.X*a.Y
+	}
+	if area < 0 {
+		for i, j := 0, len(p.points)-1; i < j; i, j = i+1, j-1 {
+			p.points[i], p.points[j] = p.points[j], p.points[i]
+		}
+	}
+	return p
+}
+
+// rasterEdge is a polygon edge, stored top to bottom with the direction
+// it was drawn in
+type rasterEdge struct {
+	x0, y0, x1, y1 float64
+	dir            int
+}
+
+// fillPolygons paints the polygons with the non-zero winding rule,
+// anti-aliased, blending the color over the image
+func fillPolygons(img *image.NRGBA, polygons []polygon, c color.NRGBA) {
+	if c.A == 0 {
+		return
+	}
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	var edges []rasterEdge
+	minY, maxY := math.Inf(1), math.Inf(-1)
+	for _, p := range polygons {
+		n := len(p.points)
+		for i := 0; i < n; i++ {
+			a, b := p.points[i], p.points[(i+1)%n]
+			if a.Y == b.Y {
+				continue
+			}
+			edge := rasterEdge{a.X, a.Y, b.X, b.Y, 1}
+			if a.Y > b.Y {
+				edge = rasterEdge{b.X, b.Y, a.X, a.Y, -1}
+			}
+			edges = append(edges, edge)
+			minY, maxY = math.Min(minY, edge.y0), math.Max(maxY, edge.y1)
+		}
+	}
+	if len(edges) == 0 {
+		return
+	}
+	sort.Slice(edges, func(i, j int) bool { return edges[i].y0 < edges[j].y0 })
+
+	firstRow := max(0, int(math.Floor(minY)))
+	lastRow := min(height-1, int(math.Ceil(maxY)))
+	coverage := make([]float64, width)
+	type crossing struct {
+		x   float64
+		dir int
+	}
+	var crossings []crossing
+
+	for row := firstRow; row <= lastRow; row++ {
+		for i := range coverage {
+			coverage[i] = 0
+		}
+		touched := false
+
+		for sub := 0; sub < rasterSubsamples; sub++ {
+			y := float64(row) + (float64(sub)+0.5)/rasterSubsamples
+			crossings = crossings[:0]
+			for _, e := range edges {
+				if e.y0 > y {
+					break
+				}
+				if y >= e.y1 {
+					continue
+				}
+				x := e.x0 + (y-e.y0)/(e.y1-e.y0)*(e.x1-e.x0)
+				crossings = append(crossings, crossing{x, e.dir})
+			}
+			if len(crossings) < 2 {
+				continue
+			}
+			sort.Slice(crossings, func(i, j int) bool { return crossings[i].x < crossings[j].x })
+
+			winding := 0
+			for i := 0; i < len(crossings)-1; i++ {
+				winding += crossings[i].dir
+				if winding != 0 {
+					addCoverage(coverage, crossings[i].x, crossings[i+1].x, 1.0/rasterSubsamples)
+					touched = true
+				}
+			}
+		}
+		if !touched {
+			continue
+		}
+
+		for x, cover := range coverage {
+			if cover <= 0 {
+				continue
+			}
+			alpha := math.Min(1, cover) * float64(c.A) / 255
+			i := img.PixOffset(x, row)
+			pix := img.Pix[i : i+4]
+			pix[0] = uint8(float64(c.R)*alpha + float64(pix[0])*(1-alpha) + 0.5)
+			pix[1] = uint8(float64(c.G)*alpha + float64(pix[1])*(1-alpha) + 0.5)
+			pix[2] = uint8(float64(c.B)*alpha + float64(pix[2])*(1-alpha) + 0.5)
+		}
+	}
+}
+
+// addCoverage adds weight to the pixels a span covers, in proportion to
+// how much of each it covers
+func addCoverage(coverage []float64, x0, x1, weight float64) {
+	x0 = math.Max(0, x0)
+	x1 = math.Min(float64(len(coverage)), x1)
+	if x1 <= x0 {
+		return
+	}
+	first, last := int(x0), int(x1)
+	if first == last {
+		coverage[first] += (x1 - x0) * weight
+		return
+	}
+	coverage[first] += (float64(first+1) - x0) * weight
+	for x := first + 1; x < last; x++ {
+		coverage[x] += weight
+	}
+	if last < len(coverage) {
+		coverage[last] += (x1 - float64(last)) * weight
+	}
+}
+
+// glyphPolygons lays out text in the built-in bitmap font with its
+// baseline at x, y. Each dot is a tenth of the font size, so characters
+// advance by charWidthRatio of it like ShapeBounds estimates.
+func glyphPolygons(text string, x, baseline, size float64) []polygon {
+	dot := size / 10
+	top := baseline - glyphRows*dot
+	var polygons []polygon
+	for _, r := range text {
+		rows, ok := bitmapFont[r]
+		if !ok {
+			rows = bitmapFont['?']
+		}
+		for row, bits := range rows {
+			// Runs of dots in a row become one rectangle
+			for col := 0; col < glyphColumns; col++ {
+				if bits&(1<<(glyphColumns-1-col)) == 0 {
+					continue
+				}
+				end := col
+				for end+1 < glyphColumns && bits&(1<<(glyphColumns-2-end)) != 0 {
+					end++
+				}
+				x0, y0 := x+float64(col)*dot, top+float64(row)*dot
+				x1, y1 := x+float64(end+1)*dot, y0+dot
+				polygons = append(polygons, polygon{points: []renderPoint{{x0, y0}, {x1, y0}, {x1, y1}, {x0, y1}}, closed: true})
+				col = end
+			}
+		}
+		x += (glyphColumns + 1) * dot
+	}
+	return polygons
+}
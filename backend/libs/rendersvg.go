@@ -0,0 +1,83 @@
+package libs
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"image/color"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// renderSVG writes the scene as an SVG document in board coordinates
+func renderSVG(w io.Writer, scene renderScene) error {
+	out := bufio.NewWriter(w)
+	b := scene.bounds
+
+	fmt.Fprintf(out, `<?xml version="1.0" encoding="UTF-8"?>`+"\n")
+	fmt.Fprintf(out, `<svg xmlns="http://www.w3.org/2000/svg" width="%s" height="%s" viewBox="%s %s %s %s">`+"\n",
+		svgNumber(b.Width), svgNumber(b.Height), svgNumber(b.X), svgNumber(b.Y), svgNumber(b.Width), svgNumber(b.Height))
+	fmt.Fprintf(out, `<rect x="%s" y="%s" width="%s" height="%s" fill="#ffffff"/>`+"\n",
+		svgNumber(b.X), svgNumber(b.Y), svgNumber(b.Width), svgNumber(b.Height))
+
+	for i, op := range scene.ops {
+		switch {
+		case op.isText:
+			fmt.Fprintf(out, `<text x="%s" y="%s" font-family="%s" font-size="%s"%s xml:space="preserve">`,
+				svgNumber(op.x), svgNumber(op.y), renderFontFamily, svgNumber(op.size), svgPaint("fill", op.color))
+			xml.EscapeText(out, []byte(op.text))
+			fmt.Fprintf(out, "</text>\n")
+		case op.fill:
+			fmt.Fprintf(out, `<path d="%s"%s/>`+"\n", svgPathData(op.path), svgPaint("fill", op.color))
+		default:
+			fmt.Fprintf(out, `<path d="%s" fill="none"%s stroke-width="%s" stroke-linecap="round" stroke-linejoin="round"/>`+"\n",
+				svgPathData(op.path), svgPaint("stroke", op.color), svgNumber(op.width))
+		}
+		scene.drew(i + 1)
+	}
+
+	fmt.Fprintf(out, "</svg>\n")
+	return out.Flush()
+}
+
+// svgPaint sets a fill or stroke color, with its opacity when it isn't
+// opaque
+func svgPaint(attr string, c color.NRGBA) string {
+	paint := fmt.Sprintf(` %s="#%02x%02x%02x"`, attr, c.R, c.G, c.B)
+	if c.A < 255 {
+		paint += fmt.Sprintf(` %s-opacity="%s"`, attr, svgNumber(float64(c.A)/255))
+	}
+	return paint
+}
+
+func svgPathData(p *renderPath) string {
+	var d strings.Builder
+	for _, cmd := range p.cmds {
+		if d.Len() > 0 {
+			d.WriteByte(' ')
+		}
+		d.WriteByte(cmd.op)
+		points := 0
+		switch cmd.op {
+		case 'M', 'L':
+			points = 1
+		case 'C':
+			points = 3
+		}
+		for _, pt := range cmd.pts[:points] {
+			d.WriteString(" " + svgNumber(pt.X) + " " + svgNumber(pt.Y))
+		}
+	}
+	return d.String()
+}
+
+// svgNumber formats a coordinate compactly, to a hundredth
+func svgNumber(n float64) string {
+	n = math.Round(n*100) / 100
+	if n == 0 {
+		n = 0 // No "-0"
+	}
+	return strconv.FormatFloat(n, 'f', -1, 64)
+}
@@ -0,0 +1,41 @@
+package libs
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/repository"
+)
+
+// users is where accounts are kept: MongoDB, unless UseUsers says
+// otherwise
+var users repository.UserRepository = repository.NewMongoUsers()
+
+// UseUsers swaps where users are kept, such as for the in-memory
+// repository in tests. Call it before serving requests.
+func UseUsers(userRepository repository.UserRepository) {
+	users = userRepository
+}
+
+// Users is the user repository in use
+func Users() repository.UserRepository {
+	return users
+}
+
+// boardRepositoryKey is where BoardRepositoryMiddleware puts the board
+// repository in the request's context
+const boardRepositoryKey = "boards"
+
+// BoardRepositoryMiddleware hands boards to the handlers of every request,
+// which find it with BoardRepository. The router is built with the
+// repository for the configured storage.
+func BoardRepositoryMiddleware(boards repository.BoardRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(boardRepositoryKey, boards)
+		c.Next()
+	}
+}
+
+// BoardRepository is the board repository the request's router was built
+// with
+func BoardRepository(c *gin.Context) repository.BoardRepository {
+	return c.MustGet(boardRepositoryKey).(repository.BoardRepository)
+}
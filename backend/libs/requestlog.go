@@ -0,0 +1,208 @@
+package libs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxLoggedBody caps how much of a body ends up in the log.
+const maxLoggedBody = 4096
+
+const redacted = "[REDACTED]"
+
+// sensitiveFields are JSON keys whose values are never logged. Keys are
+// compared case-insensitively.
+var sensitiveFields = map[string]bool{
+	"password":        true,
+	"currentpassword": true,
+	"newpassword":     true,
+	"token":           true,
+	"accesstoken":     true,
+	"refreshtoken":    true,
+	"secret":          true,
+	"clientsecret":    true,
+	"code":            true,
+	"access_token":    true,
+	"refresh_token":   true,
+	"client_secret":   true,
+	"code_verifier":   true,
+	"redirecturi":     true, // Carries the OAuth authorization code
+	"authorization":   true,
+	"cookie":          true,
+}
+
+// payloadFields hold board contents; they are replaced by a size summary.
+var payloadFields = map[string]bool{
+	"board": true,
+}
+
+var sensitiveHeaders = []string{"Authorization", "Cookie", "Set-Cookie"}
+
+// verboseRoutes holds the routes ("METHOD /pattern", or "*" for all) whose
+// requests and responses are logged. Seeded from VERBOSE_LOG_ROUTES.
+var verboseRoutes = struct {
+	sync.RWMutex
+	routes map[string]bool
+}{routes: parseVerboseRoutes(os.Getenv("VERBOSE_LOG_ROUTES"))}
+
+func parseVerboseRoutes(raw string) map[string]bool {
+	routes := map[string]bool{}
+	for _, route := range strings.Split(raw, ",") {
+		if route = strings.TrimSpace(route); route != "" {
+			routes[route] = true
+		}
+	}
+	return routes
+}
+
+// GetVerboseLogRoutes returns the routes with verbose logging enabled.
+func GetVerboseLogRoutes() []string {
+	verboseRoutes.RLock()
+	defer verboseRoutes.RUnlock()
+
+	routes := make([]string, 0, len(verboseRoutes.routes))
+	for route := range verboseRoutes.routes {
+		routes = append(routes, route)
+	}
+	sort.Strings(routes)
+	return routes
+}
+
+// SetVerboseLogRoute turns verbose logging on or off for a route.
+func SetVerboseLogRoute(route string, enabled bool) {
+	verboseRoutes.Lock()
+	defer verboseRoutes.Unlock()
+
+	if enabled {
+		verboseRoutes.routes[route] = true
+	} else {
+		delete(verboseRoutes.routes, route)
+	}
+}
+
+func isVerboseLogRoute(route string) bool {
+	verboseRoutes.RLock()
+	defer verboseRoutes.RUnlock()
+	return verboseRoutes.routes[route] || verboseRoutes.routes["*"]
+}
+
+// bodyCaptureWriter keeps a copy of the response body as it is written.
+type bodyCaptureWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *bodyCaptureWriter) Write(data []byte) (int, error) {
+	if w.body.Len() < maxLoggedBody {
+		w.body.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// RequestLogMiddleware logs request and response bodies for routes with
+// verbose logging enabled. Credentials are redacted and board payloads are
+// reduced to a size summary.
+func RequestLogMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.Request.Method + " " + c.FullPath()
+		if c.FullPath() == "" || !isVerboseLogRoute(route) {
+			c.Next()
+			return
+		}
+
+		var requestBody []byte
+		if c.Request.Body != nil {
+			requestBody, _ = io.ReadAll(c.Request.Body)
+			c.Request.Body = io.NopCloser(bytes.NewReader(requestBody))
+		}
+
+		writer := &bodyCaptureWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+
+		start := time.Now()
+		c.Next()
+
+		RequestLogger(c).Info("verbose request",
+			"route", route,
+			"status", c.Writer.Status(),
+			"latency_ms", time.Since(start).Milliseconds(),
+			"headers", redactHeaders(c),
+			"request", RedactBody(requestBody),
+			"response", RedactBody(writer.body.Bytes()),
+		)
+	}
+}
+
+func redactHeaders(c *gin.Context) string {
+	headers := map[string]string{}
+	for name := range c.Request.Header {
+		headers[name] = c.Request.Header.Get(name)
+	}
+	for _, name := range sensitiveHeaders {
+		if _, ok := headers[name]; ok {
+			headers[name] = redacted
+		}
+	}
+
+	encoded, _ := json.Marshal(headers)
+	return string(encoded)
+}
+
+// RedactBody returns a loggable form of a JSON body with sensitive fields
+// masked. Non-JSON bodies are only described by their size.
+func RedactBody(body []byte) string {
+	if len(body) == 0 {
+		return "-"
+	}
+
+	var parsed interface{}
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return fmt.Sprintf("[non-JSON body, %d bytes]", len(body))
+	}
+
+	encoded, err := json.Marshal(redactValue(parsed))
+	if err != nil {
+		return fmt.Sprintf("[unloggable body, %d bytes]", len(body))
+	}
+	if len(encoded) > maxLoggedBody {
+		return string(encoded[:maxLoggedBody]) + "...(truncated)"
+	}
+	return string(encoded)
+}
+
+func redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, inner := range v {
+			lower := strings.ToLower(key)
+			switch {
+			case sensitiveFields[lower]:
+				out[key] = redacted
+			case payloadFields[lower]:
+				raw, _ := json.Marshal(inner)
+				out[key] = fmt.Sprintf("[board payload, %d bytes]", len(raw))
+			default:
+				out[key] = redactValue(inner)
+			}
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, inner := range v {
+			out[i] = redactValue(inner)
+		}
+		return out
+	default:
+		return v
+	}
+}
@@ -0,0 +1,293 @@
+package libs
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/sarwanazhar/boardsar/backend/converter"
+	"github.com/sarwanazhar/boardsar/backend/database"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const sectionStateCollection = "section_states"
+
+// ShapeSectionKey holds the ID of the section a shape is in
+const ShapeSectionKey = "sectionId"
+
+// MaxBoardSections is as many sections as a board can have
+const MaxBoardSections = 200
+
+func GetSectionStateCollection() *mongo.Collection {
+	return database.GetCollection(sectionStateCollection)
+}
+
+// SectionSummary is a section as lists and the outline show it
+type SectionSummary struct {
+	models.Section
+	Collapsed bool     `json:"collapsed"` // For the requesting user
+	ShapeIDs  []string `json:"shapeIds"`
+}
+
+// FindSection returns the section with the given ID, or nil
+func FindSection(sections []models.Section, id string) *models.Section {
+	for i := range sections {
+		if sections[i].ID == id {
+			return &sections[i]
+		}
+	}
+	return nil
+}
+
+// ShapeSection returns the ID of the section a shape is in, or ""
+func ShapeSection(shape map[string]interface{}) string {
+	id, _ := shape[ShapeSectionKey].(string)
+	return id
+}
+
+// SectionShapeIDs lists the shapes of a board state in a section, in the
+// board's order
+func SectionShapeIDs(data map[string]interface{}, sectionID string) []string {
+	ids := []string{}
+	list, _ := ShapeList(data)
+	for _, item := range list {
+		shape, _ := item.(map[string]interface{})
+		if id, _ := shape["id"].(string); id != "" && ShapeSection(shape) == sectionID {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// SectionBoardData narrows a board state to the shapes in a section, which
+// may be none
+func SectionBoardData(data map[string]interface{}, sectionID string) map[string]interface{} {
+	selected := make(map[string]interface{}, len(data))
+	for key, value := range data {
+		selected[key] = value
+	}
+	shapes := []interface{}{}
+	list, _ := ShapeList(data)
+	for _, item := range list {
+		if shape, ok := item.(map[string]interface{}); ok && ShapeSection(shape) == sectionID {
+			shapes = append(shapes, item)
+		}
+	}
+	selected["shapes"] = shapes
+	return selected
+}
+
+// SummarizeSections pairs each section with the shapes of a board state in
+// it and whether the user collapsed it
+func SummarizeSections(sections []models.Section, data map[string]interface{}, collapsed map[string]bool) []SectionSummary {
+	summaries := make([]SectionSummary, 0, len(sections))
+	for _, section := range sections {
+		summaries = append(summaries, SectionSummary{
+			Section:   section,
+			Collapsed: collapsed[section.ID],
+			ShapeIDs:  SectionShapeIDs(data, section.ID),
+		})
+	}
+	return summaries
+}
+
+// AssignSection returns the operations putting shapes in a section, or
+// taking them out of theirs when sectionID is "". Shapes already where
+// they should be are left alone.
+func AssignSection(data map[string]interface{}, ids []string, sectionID string) ([]models.BoardOperation, error) {
+	var value interface{}
+	if sectionID != "" {
+		value = sectionID
+	}
+
+	operations := []models.BoardOperation{}
+	seen := map[string]bool{}
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		shape := FindShape(data, id)
+		if shape == nil {
+			return nil, fmt.Errorf("Shape %s not found", id)
+		}
+		if ShapeSection(shape) == sectionID {
+			continue
+		}
+		operations = append(operations, models.BoardOperation{
+			Op:    models.OpUpdateShape,
+			ID:    id,
+			Shape: map[string]interface{}{ShapeSectionKey: value},
+		})
+	}
+	return operations, nil
+}
+
+// MoveSection moves every shape of a section in a board state by the same
+// offset. Connectors with one end in the section follow it, as with
+// LayoutShapes. It returns the operations making those changes and the
+// operations undoing them.
+func MoveSection(data map[string]interface{}, sectionID string, dx, dy float64) (apply, undo []models.BoardOperation) {
+	by := converter.LayoutPoint{X: roundLayout(dx), Y: roundLayout(dy)}
+	if by == (converter.LayoutPoint{}) {
+		return nil, nil
+	}
+
+	graph := BoardGraph("", data)
+	plan := newLayoutPlan(data, graph)
+	move := func(p converter.LayoutPoint) converter.LayoutPoint {
+		return offsetBy(p, converter.LayoutPoint{}, by)
+	}
+	moved := map[string]converter.LayoutPoint{}
+	for _, id := range SectionShapeIDs(data, sectionID) {
+		plan.move(id, move)
+		moved[id] = by
+	}
+	plan.follow(graph.Edges, moved)
+	return plan.operations(data)
+}
+
+// sectionLockViolation describes how an operation changes a locked section,
+// if it does: it changes or deletes target, a shape in one, or puts a shape
+// in one
+func sectionLockViolation(sections []models.Section, op *models.BoardOperation, target map[string]interface{}) string {
+	if len(sections) == 0 {
+		return ""
+	}
+	if target != nil {
+		if section := FindSection(sections, ShapeSection(target)); section != nil && section.Locked {
+			return fmt.Sprintf("Shape %s is in the locked section %q", op.ID, section.Name)
+		}
+	}
+	if op.Op == models.OpAddShape || op.Op == models.OpUpdateShape {
+		if id, ok := op.Shape[ShapeSectionKey].(string); ok {
+			if section := FindSection(sections, id); section != nil && section.Locked {
+				return fmt.Sprintf("The section %q is locked", section.Name)
+			}
+		}
+	}
+	return ""
+}
+
+// CheckSectionLocks compares a new board state against the current one and
+// describes the first change to a locked section, or returns "" when there
+// is none. Locks bind the owner too.
+func CheckSectionLocks(sections []models.Section, current, next map[string]interface{}) string {
+	locked := map[string]*models.Section{}
+	for i := range sections {
+		if sections[i].Locked {
+			locked[sections[i].ID] = &sections[i]
+		}
+	}
+	if len(locked) == 0 {
+		return ""
+	}
+
+	before := BoardShapes(current)
+	after := BoardShapes(next)
+
+	for id, shape := range before {
+		section := locked[ShapeSection(shape)]
+		if section == nil {
+			continue
+		}
+		if changed, ok := after[id]; !ok || !sameValue(shape, changed) {
+			return fmt.Sprintf("Shape %s is in the locked section %q", id, section.Name)
+		}
+	}
+	for id, shape := range after {
+		section := locked[ShapeSection(shape)]
+		if section == nil {
+			continue
+		}
+		if old, ok := before[id]; !ok || ShapeSection(old) != section.ID {
+			return fmt.Sprintf("The section %q is locked", section.Name)
+		}
+	}
+	return ""
+}
+
+// sameValue compares shape fields as decoded from JSON or from MongoDB,
+// which differ in their number and list types
+func sameValue(a, b interface{}) bool {
+	if x, ok := toNumber(a); ok {
+		y, ok := toNumber(b)
+		return ok && x == y
+	}
+	if x, ok := toList(a); ok {
+		y, ok := toList(b)
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !sameValue(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	if x, ok := a.(map[string]interface{}); ok {
+		y, ok := b.(map[string]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for key, value := range x {
+			other, ok := y[key]
+			if !ok || !sameValue(value, other) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// SetSectionCollapsed records whether the user collapsed a section
+func SetSectionCollapsed(ctx context.Context, userID, boardID primitive.ObjectID, sectionID string, collapsed bool) error {
+	_, err := GetSectionStateCollection().UpdateOne(ctx,
+		bson.M{"userId": userID, "boardId": boardID, "sectionId": sectionID},
+		bson.M{"$set": bson.M{"collapsed": collapsed, "updatedAt": time.Now()}},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+// CollapsedSections returns the IDs of the sections of a board the user
+// collapsed
+func CollapsedSections(ctx context.Context, userID, boardID primitive.ObjectID) (map[string]bool, error) {
+	cursor, err := GetSectionStateCollection().Find(ctx,
+		bson.M{"userId": userID, "boardId": boardID, "collapsed": true},
+		options.Find().SetProjection(bson.M{"sectionId": 1}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var states []models.SectionState
+	if err := cursor.All(ctx, &states); err != nil {
+		return nil, err
+	}
+	collapsed := make(map[string]bool, len(states))
+	for _, state := range states {
+		collapsed[state.SectionID] = true
+	}
+	return collapsed, nil
+}
+
+// DeleteSectionStates forgets how everyone left a deleted section
+func DeleteSectionStates(ctx context.Context, boardID primitive.ObjectID, sectionID string) error {
+	_, err := GetSectionStateCollection().DeleteMany(ctx, bson.M{"boardId": boardID, "sectionId": sectionID})
+	return err
+}
+
+// DeleteBoardSectionStates forgets how everyone left the sections of a
+// deleted board
+func DeleteBoardSectionStates(ctx context.Context, boardID primitive.ObjectID) error {
+	_, err := GetSectionStateCollection().DeleteMany(ctx, bson.M{"boardId": boardID})
+	return err
+}
@@ -0,0 +1,44 @@
+package libs
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+)
+
+// readHeaderTimeout bounds reading a request's headers. The other server
+// timeouts are configured (SERVER_READ_TIMEOUT, SERVER_WRITE_TIMEOUT,
+// SERVER_IDLE_TIMEOUT); writes get long enough for a large export, and
+// WebSockets and event streams lift the deadline for themselves.
+const readHeaderTimeout = 10 * time.Second
+
+// requests is what every request's context starts from. Cancelling it, once
+// a shutdown has waited long enough, stops the reads still running.
+var requests, cancelRequests = context.WithCancel(context.Background())
+
+// NewServer returns the HTTP server for handler, with timeouts so slow
+// clients can't hold connections open indefinitely
+func NewServer(address string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              address,
+		Handler:           handler,
+		ReadHeaderTimeout: readHeaderTimeout,
+		ReadTimeout:       settings.ReadTimeout,
+		WriteTimeout:      settings.WriteTimeout,
+		IdleTimeout:       settings.IdleTimeout,
+		BaseContext:       func(net.Listener) context.Context { return requests },
+	}
+}
+
+// CancelRequests cancels the contexts of the requests still running, so
+// their database reads stop
+func CancelRequests() {
+	cancelRequests()
+}
+
+// ShutdownTimeout is how long a shutdown waits for in-flight requests and
+// background jobs before giving up on them
+func ShutdownTimeout() time.Duration {
+	return settings.ShutdownTimeout
+}
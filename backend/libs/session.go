@@ -0,0 +1,290 @@
+package libs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sarwanazhar/boardsar/backend/database"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const sessionCollection = "sessions"
+
+// maxSessionUserAgent is as much of a User-Agent as a session keeps
+const maxSessionUserAgent = 512
+
+var (
+	// ErrSessionNotFound is returned when revoking a session the user
+	// doesn't have, or that already ended. The text is safe to return to
+	// clients.
+	ErrSessionNotFound = errors.New("Session not found")
+	// ErrSessionRevoked is returned for access tokens of a session that
+	// was revoked or signed out
+	ErrSessionRevoked = errors.New("Session has been revoked")
+)
+
+func GetSessionCollection() *mongo.Collection {
+	return database.GetCollection(sessionCollection)
+}
+
+// StartSession records a new session for the user on the device with this
+// IP and User-Agent, and issues its first refresh token
+func StartSession(ctx context.Context, userID primitive.ObjectID, ip, userAgent string) (*models.Session, string, error) {
+	now := time.Now()
+	session := &models.Session{
+		ID:         primitive.NewObjectID(),
+		UserID:     userID,
+		Device:     DeviceName(userAgent),
+		UserAgent:  truncateUserAgent(userAgent),
+		IP:         ip,
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(RefreshTokenTTL()),
+	}
+	session.FamilyID = session.ID.Hex()
+	if _, err := GetSessionCollection().InsertOne(ctx, session); err != nil {
+		return nil, "", fmt.Errorf("error storing session: %w", err)
+	}
+
+	token, err := IssueRefreshToken(ctx, userID, session.FamilyID)
+	if err != nil {
+		return nil, "", err
+	}
+	return session, token, nil
+}
+
+// TouchSession records that the session of a refresh token family was just
+// used from this IP and User-Agent, and returns it. Families started before
+// sessions were recorded get one.
+func TouchSession(ctx context.Context, userID primitive.ObjectID, familyID, ip, userAgent string) (*models.Session, error) {
+	now := time.Now()
+	var session models.Session
+	err := GetSessionCollection().FindOneAndUpdate(ctx,
+		bson.M{"familyId": familyID, "userId": userID},
+		bson.M{
+			"$set": bson.M{
+				"device":     DeviceName(userAgent),
+				"userAgent":  truncateUserAgent(userAgent),
+				"ip":         ip,
+				"lastSeenAt": now,
+				"expiresAt":  now.Add(RefreshTokenTTL()),
+			},
+			"$setOnInsert": bson.M{"createdAt": now},
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&session)
+	if err != nil {
+		return nil, fmt.Errorf("error updating session: %w", err)
+	}
+	return &session, nil
+}
+
+// ListSessions returns the user's sessions that can still be used, the
+// most recently seen first
+func ListSessions(ctx context.Context, userID primitive.ObjectID) ([]models.Session, error) {
+	cursor, err := GetSessionCollection().Find(ctx,
+		bson.M{
+			"userId":    userID,
+			"revokedAt": bson.M{"$exists": false},
+			"expiresAt": bson.M{"$gt": time.Now()},
+		},
+		options.Find().SetSort(bson.D{{Key: "lastSeenAt", Value: -1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	sessions := []models.Session{}
+	if err := cursor.All(ctx, &sessions); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// RevokeSession signs one of the user's devices out: its refresh tokens and
+// access tokens stop working
+func RevokeSession(ctx context.Context, userID, sessionID primitive.ObjectID) error {
+	var session models.Session
+	err := GetSessionCollection().FindOneAndUpdate(ctx,
+		bson.M{"_id": sessionID, "userId": userID, "revokedAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revokedAt": time.Now()}},
+	).Decode(&session)
+	if err == mongo.ErrNoDocuments {
+		return ErrSessionNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("error revoking session: %w", err)
+	}
+	forgetSession(session.ID.Hex())
+
+	_, err = GetRefreshTokenCollection().UpdateMany(ctx,
+		bson.M{"familyId": session.FamilyID, "revokedAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revokedAt": time.Now()}},
+	)
+	if err != nil {
+		return fmt.Errorf("error revoking refresh tokens: %w", err)
+	}
+	return nil
+}
+
+// endFamilySession revokes the session of a refresh token family, once its
+// tokens were revoked
+func endFamilySession(ctx context.Context, familyID string) error {
+	var session models.Session
+	err := GetSessionCollection().FindOneAndUpdate(ctx,
+		bson.M{"familyId": familyID, "revokedAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revokedAt": time.Now()}},
+	).Decode(&session)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	forgetSession(session.ID.Hex())
+	return nil
+}
+
+// revokeUserSessions revokes every session of the user, once their
+// refresh tokens were revoked
+func revokeUserSessions(ctx context.Context, userID primitive.ObjectID) error {
+	_, err := GetSessionCollection().UpdateMany(ctx,
+		bson.M{"userId": userID, "revokedAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revokedAt": time.Now()}},
+	)
+	if err != nil {
+		return err
+	}
+
+	sessionStates.Lock()
+	defer sessionStates.Unlock()
+	for id, state := range sessionStates.sessions {
+		if state.userID == userID.Hex() {
+			delete(sessionStates.sessions, id)
+		}
+	}
+	return nil
+}
+
+// sessionStates are the sessions this instance looked up for access
+// tokens, by session ID. Like token versions, they are trusted for
+// tokenVersionTTL, so a session revoked through another instance is
+// refused here once that runs out.
+var sessionStates = struct {
+	sync.Mutex
+	sessions map[string]cachedSession
+}{sessions: map[string]cachedSession{}}
+
+type cachedSession struct {
+	userID string
+	active bool
+	readAt time.Time
+}
+
+// checkSession returns ErrSessionRevoked unless the session is the user's
+// and hasn't been revoked
+func checkSession(ctx context.Context, sessionID, userID string) error {
+	now := time.Now()
+	sessionStates.Lock()
+	cached, ok := sessionStates.sessions[sessionID]
+	sessionStates.Unlock()
+	if !ok || now.Sub(cached.readAt) >= tokenVersionTTL {
+		id, err := primitive.ObjectIDFromHex(sessionID)
+		if err != nil {
+			return ErrSessionRevoked
+		}
+		findCtx, cancel := context.WithTimeout(ctx, Settings().DBTimeout)
+		defer cancel()
+		var session models.Session
+		err = GetSessionCollection().FindOne(findCtx, bson.M{"_id": id},
+			options.FindOne().SetProjection(bson.M{"userId": 1, "revokedAt": 1})).Decode(&session)
+		if err != nil && err != mongo.ErrNoDocuments {
+			slog.Warn("Failed to read session", "session_id", sessionID, "error", err)
+			return ErrTokenUnchecked
+		}
+		cached = cachedSession{userID: session.UserID.Hex(), active: err == nil && session.RevokedAt == nil, readAt: now}
+
+		sessionStates.Lock()
+		if len(sessionStates.sessions) >= maxCachedTokenVersions {
+			for id, entry := range sessionStates.sessions {
+				if now.Sub(entry.readAt) >= tokenVersionTTL {
+					delete(sessionStates.sessions, id)
+				}
+			}
+		}
+		sessionStates.sessions[sessionID] = cached
+		sessionStates.Unlock()
+	}
+
+	if !cached.active || cached.userID != userID {
+		return ErrSessionRevoked
+	}
+	return nil
+}
+
+// forgetSession drops what this instance knows of a session, once it is
+// revoked
+func forgetSession(sessionID string) {
+	sessionStates.Lock()
+	defer sessionStates.Unlock()
+	delete(sessionStates.sessions, sessionID)
+}
+
+// DeviceName describes the browser and OS a User-Agent names, such as
+// "Firefox on Windows"
+func DeviceName(userAgent string) string {
+	var browser string
+	switch {
+	case strings.Contains(userAgent, "Edg/"):
+		browser = "Edge"
+	case strings.Contains(userAgent, "OPR/"):
+		browser = "Opera"
+	case strings.Contains(userAgent, "Firefox/"), strings.Contains(userAgent, "FxiOS/"):
+		browser = "Firefox"
+	case strings.Contains(userAgent, "Chrome/"), strings.Contains(userAgent, "CriOS/"):
+		browser = "Chrome"
+	case strings.Contains(userAgent, "Safari/"):
+		browser = "Safari"
+	}
+
+	var os string
+	switch {
+	case strings.Contains(userAgent, "iPhone"), strings.Contains(userAgent, "iPad"):
+		os = "iOS"
+	case strings.Contains(userAgent, "Android"):
+		os = "Android"
+	case strings.Contains(userAgent, "Windows"):
+		os = "Windows"
+	case strings.Contains(userAgent, "CrOS"):
+		os = "ChromeOS"
+	case strings.Contains(userAgent, "Macintosh"):
+		os = "macOS"
+	case strings.Contains(userAgent, "Linux"):
+		os = "Linux"
+	}
+
+	switch {
+	case browser != "" && os != "":
+		return browser + " on " + os
+	case browser != "":
+		return browser
+	case os != "":
+		return os
+	}
+	return "Unknown device"
+}
+
+func truncateUserAgent(userAgent string) string {
+	if len(userAgent) > maxSessionUserAgent {
+		return userAgent[:maxSessionUserAgent]
+	}
+	return userAgent
+}
@@ -0,0 +1,198 @@
+package libs
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/sarwanazhar/boardsar/backend/database"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const shapeIndexCollection = "board_shapes"
+
+const (
+	// ShapeIndexBound is how far out shape corners are indexed on either
+	// axis. Corners further out are clamped to it; the exact bounds decide
+	// the match. The 2d index itself covers twice this, as its upper bound
+	// is exclusive.
+	ShapeIndexBound = 1e9
+)
+
+func GetShapeIndexCollection() *mongo.Collection {
+	return database.GetCollection(shapeIndexCollection)
+}
+
+// shapeIndexThreshold is the shape count from which boards are indexed,
+// SHAPE_INDEX_THRESHOLD. Smaller boards are cheap enough to filter in
+// memory.
+func shapeIndexThreshold() int {
+	return settings.ShapeIndexThreshold
+}
+
+// intersects reports whether two boxes overlap, edges included
+func (b Bounds) intersects(other Bounds) bool {
+	return b.X <= other.X+other.Width && other.X <= b.X+b.Width &&
+		b.Y <= other.Y+other.Height && other.Y <= b.Y+b.Height
+}
+
+// ShapesInBounds returns the shapes of the board state that intersect the
+// box, in drawing order. Shapes without a position are left out.
+func ShapesInBounds(data map[string]interface{}, box Bounds) []ShapeEntry {
+	found := []ShapeEntry{}
+	for _, entry := range ShapeEntries(data) {
+		if entry.Bounds.intersects(box) {
+			found = append(found, entry)
+		}
+	}
+	return found
+}
+
+// IndexBoardShapes brings the shape index up to date with a saved board.
+// Boards below the threshold aren't indexed, and lose any index they had.
+// Concurrent builds are safe: each writes its own version's entries, and
+// only entries of older versions are removed.
+func IndexBoardShapes(ctx context.Context, board *models.Board) error {
+	list, _ := ShapeList(board.BoardData)
+	if len(list) < shapeIndexThreshold() {
+		if board.ShapeIndex == 0 {
+			return nil
+		}
+		return DeleteBoardShapeIndex(ctx, board.ID)
+	}
+
+	entries := []interface{}{}
+	for _, entry := range ShapeEntries(board.BoardData) {
+		bounds := entry.Bounds
+		entries = append(entries, models.IndexedShape{
+			BoardID:  board.ID,
+			Version:  board.Version,
+			Order:    entry.Order,
+			Location: [2]float64{clampShapeIndex(bounds.X), clampShapeIndex(bounds.Y)},
+			MinX:     bounds.X,
+			MinY:     bounds.Y,
+			MaxX:     bounds.X + bounds.Width,
+			MaxY:     bounds.Y + bounds.Height,
+			Shape:    entry.Shape,
+		})
+	}
+
+	collection := GetShapeIndexCollection()
+	if len(entries) > 0 {
+		// Another build of the same version may have got there first
+		_, err := collection.InsertMany(ctx, entries, options.InsertMany().SetOrdered(false))
+		if err != nil && !mongo.IsDuplicateKeyError(err) {
+			return fmt.Errorf("error indexing shapes: %w", err)
+		}
+	}
+
+	_, err := database.GetCollection("boards").UpdateOne(ctx,
+		bson.M{"_id": board.ID},
+		bson.M{"$max": bson.M{"shapeIndex": board.Version}},
+	)
+	if err != nil {
+		return fmt.Errorf("error marking board as indexed: %w", err)
+	}
+	if _, err := collection.DeleteMany(ctx, bson.M{"boardId": board.ID, "version": bson.M{"$lt": board.Version}}); err != nil {
+		return fmt.Errorf("error removing stale shape index entries: %w", err)
+	}
+	return nil
+}
+
+// WarmShapeIndex builds the shape index of a large board that doesn't have
+// an up-to-date one, such as a board last saved before it was big enough or
+// before indexing existed. It returns at once; the build happens in the
+// background, so the caller must not change the board afterwards.
+func WarmShapeIndex(board *models.Board) {
+	if list, _ := ShapeList(board.BoardData); len(list) < shapeIndexThreshold() {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		if err := IndexBoardShapes(ctx, board); err != nil {
+			slog.Warn("Failed to index shapes of board", "board_id", board.ID.Hex(), "error", err)
+		}
+	}()
+}
+
+// QueryShapeIndex returns the shapes of the indexed board version that
+// intersect the box, in drawing order
+func QueryShapeIndex(ctx context.Context, boardID primitive.ObjectID, version int64, box Bounds) ([]ShapeEntry, error) {
+	// The index finds the shapes whose top-left corner is above and to the
+	// left of the box's bottom-right corner; the exact bounds do the rest
+	return findIndexedShapes(ctx, bson.M{
+		"location": bson.M{"$geoWithin": bson.M{"$box": bson.A{
+			bson.A{-ShapeIndexBound, -ShapeIndexBound},
+			bson.A{clampShapeIndex(box.X + box.Width), clampShapeIndex(box.Y + box.Height)},
+		}}},
+		"boardId": boardID,
+		"version": version,
+		"minX":    bson.M{"$lte": box.X + box.Width},
+		"minY":    bson.M{"$lte": box.Y + box.Height},
+		"maxX":    bson.M{"$gte": box.X},
+		"maxY":    bson.M{"$gte": box.Y},
+	}, nil)
+}
+
+// ShapeIndexBounds returns the bounds of every shape of the indexed board
+// version, in drawing order. The shapes only carry the fields that decide
+// whether they're hidden from someone.
+func ShapeIndexBounds(ctx context.Context, boardID primitive.ObjectID, version int64) ([]ShapeEntry, error) {
+	return findIndexedShapes(ctx, bson.M{"boardId": boardID, "version": version}, bson.M{
+		"order": 1, "minX": 1, "minY": 1, "maxX": 1, "maxY": 1,
+		"shape." + ShapeHiddenKey: 1, "shape." + ShapeAuthorKey: 1,
+	})
+}
+
+func findIndexedShapes(ctx context.Context, filter, projection bson.M) ([]ShapeEntry, error) {
+	opts := options.Find()
+	if projection != nil {
+		opts.SetProjection(projection)
+	}
+	cursor, err := GetShapeIndexCollection().Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	var indexed []models.IndexedShape
+	if err := cursor.All(ctx, &indexed); err != nil {
+		return nil, err
+	}
+
+	// $geoWithin can't be sorted on by the index, so order here
+	sort.Slice(indexed, func(i, j int) bool { return indexed[i].Order < indexed[j].Order })
+	entries := make([]ShapeEntry, 0, len(indexed))
+	for _, shape := range indexed {
+		entries = append(entries, ShapeEntry{
+			Order:  shape.Order,
+			Bounds: Bounds{X: shape.MinX, Y: shape.MinY, Width: shape.MaxX - shape.MinX, Height: shape.MaxY - shape.MinY},
+			Shape:  shape.Shape,
+		})
+	}
+	return entries, nil
+}
+
+// DeleteBoardShapeIndex removes a board's shape index entries
+func DeleteBoardShapeIndex(ctx context.Context, boardID primitive.ObjectID) error {
+	if _, err := GetShapeIndexCollection().DeleteMany(ctx, bson.M{"boardId": boardID}); err != nil {
+		return err
+	}
+	_, err := database.GetCollection("boards").UpdateOne(ctx,
+		bson.M{"_id": boardID},
+		bson.M{"$unset": bson.M{"shapeIndex": ""}},
+	)
+	return err
+}
+
+func clampShapeIndex(value float64) float64 {
+	return math.Max(-ShapeIndexBound, math.Min(ShapeIndexBound, value))
+}
@@ -0,0 +1,215 @@
+package libs
+
+import (
+	"context"
+	"math"
+
+	"github.com/sarwanazhar/boardsar/backend/models"
+)
+
+// hitStrokePad widens hit-test searches past shapes' bounding boxes, which
+// leave out the stroke
+const hitStrokePad = 32
+
+// ShapeSource answers spatial queries about one version of a board from the
+// fastest place available: the in-memory tree of a hot board, the shape
+// index, or the board itself
+type ShapeSource struct {
+	Board   *models.Board // Contents only loaded when the index can't be used
+	tree    *ShapeTree
+	indexed bool
+	entries []ShapeEntry // Small boards are scanned
+}
+
+// OpenShapeSource picks where to answer queries about the board from.
+// board is loaded without its contents; load fetches them if needed.
+func OpenShapeSource(board *models.Board, load func() (*models.Board, error)) (*ShapeSource, error) {
+	hot := NoteShapeQuery(board.ID)
+	if tree := CachedShapeTree(board.ID, board.Version); tree != nil {
+		return &ShapeSource{Board: board, tree: tree}, nil
+	}
+	if board.ShapeIndex > 0 && board.ShapeIndex == board.Version && !hot {
+		return &ShapeSource{Board: board, indexed: true}, nil
+	}
+
+	full, err := load()
+	if err != nil {
+		return nil, err
+	}
+	if list, _ := ShapeList(full.BoardData); len(list) < shapeIndexThreshold() {
+		return &ShapeSource{Board: full, entries: ShapeEntries(full.BoardData)}, nil
+	}
+
+	// A large board is worth a tree now that its contents are loaded
+	tree := BuildShapeTree(full.BoardData)
+	CacheShapeTree(full.ID, full.Version, tree)
+	if full.ShapeIndex != full.Version {
+		WarmShapeIndex(full)
+	}
+	return &ShapeSource{Board: full, tree: tree}, nil
+}
+
+// Search returns the shapes intersecting the box, in drawing order
+func (s *ShapeSource) Search(ctx context.Context, box Bounds) ([]ShapeEntry, error) {
+	switch {
+	case s.tree != nil:
+		return s.tree.Search(box), nil
+	case s.indexed:
+		return QueryShapeIndex(ctx, s.Board.ID, s.Board.Version, box)
+	}
+	found := []ShapeEntry{}
+	for _, entry := range s.entries {
+		if entry.Bounds.intersects(box) {
+			found = append(found, entry)
+		}
+	}
+	return found, nil
+}
+
+// All returns every shape with a position, in drawing order. From the
+// shape index, shapes only carry the fields that decide whether they're
+// hidden from someone.
+func (s *ShapeSource) All(ctx context.Context) ([]ShapeEntry, error) {
+	switch {
+	case s.tree != nil:
+		extent, ok := s.tree.Extent()
+		if !ok {
+			return []ShapeEntry{}, nil
+		}
+		return s.tree.Search(extent), nil
+	case s.indexed:
+		return ShapeIndexBounds(ctx, s.Board.ID, s.Board.Version)
+	}
+	return s.entries, nil
+}
+
+// HitShapes returns the shapes within radius of any of the points (x, y
+// pairs, such as the samples of an eraser stroke), topmost first. Lines and
+// freehand strokes are hit along their path, circles within their radius,
+// and everything else within its bounding box.
+func (s *ShapeSource) HitShapes(ctx context.Context, points []float64, radius float64) ([]ShapeEntry, error) {
+	area := Bounds{X: points[0], Y: points[1]}
+	for i := 2; i+1 < len(points); i += 2 {
+		area = area.union(Bounds{X: points[i], Y: points[i+1]})
+	}
+	pad := radius + hitStrokePad
+	candidates, err := s.Search(ctx, Bounds{X: area.X - pad, Y: area.Y - pad, Width: area.Width + 2*pad, Height: area.Height + 2*pad})
+	if err != nil {
+		return nil, err
+	}
+
+	hits := []ShapeEntry{}
+	for i := len(candidates) - 1; i >= 0; i-- {
+		for j := 0; j+1 < len(points); j += 2 {
+			if shapeHit(candidates[i], points[j], points[j+1], radius) {
+				hits = append(hits, candidates[i])
+				break
+			}
+		}
+	}
+	return hits, nil
+}
+
+func shapeHit(entry ShapeEntry, x, y, radius float64) bool {
+	shape := entry.Shape
+	if points, ok := shapePoints(shape); ok {
+		reach := radius
+		if strokeWidth, ok := ShapeNumber(shape, "strokeWidth"); ok && strokeWidth > 0 {
+			reach += strokeWidth / 2
+		}
+		if len(points) == 2 {
+			return math.Hypot(points[0]-x, points[1]-y) <= reach
+		}
+		for i := 0; i+3 < len(points); i += 2 {
+			if segmentDistance(x, y, points[i], points[i+1], points[i+2], points[i+3]) <= reach {
+				return true
+			}
+		}
+		return false
+	}
+
+	if circleRadius, ok := ShapeNumber(shape, "radius"); ok {
+		centerX, _ := ShapeNumber(shape, "x")
+		centerY, _ := ShapeNumber(shape, "y")
+		return math.Hypot(centerX-x, centerY-y) <= circleRadius+radius
+	}
+
+	b := entry.Bounds
+	return x >= b.X-radius && x <= b.X+b.Width+radius && y >= b.Y-radius && y <= b.Y+b.Height+radius
+}
+
+// segmentDistance is the distance from (px, py) to the segment from
+// (ax, ay) to (bx, by)
+func segmentDistance(px, py, ax, ay, bx, by float64) float64 {
+	dx, dy := bx-ax, by-ay
+	lengthSquared := dx*dx + dy*dy
+	if lengthSquared == 0 {
+		return math.Hypot(px-ax, py-ay)
+	}
+	t := math.Max(0, math.Min(1, ((px-ax)*dx+(py-ay)*dy)/lengthSquared))
+	return math.Hypot(px-(ax+t*dx), py-(ay+t*dy))
+}
+
+// Minimap is a coarse overview of where a board's shapes are: the box
+// around them, split into a grid of cells, each with the number of shapes
+// overlapping it
+type Minimap struct {
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+	Cols   int     `json:"cols"`
+	Rows   int     `json:"rows"`
+	Cells  []int   `json:"cells"` // Row by row from the top left
+	Shapes int     `json:"shapes"`
+}
+
+// BuildMinimap lays the shapes over a cols by rows grid spanning them
+func BuildMinimap(entries []ShapeEntry, cols, rows int) Minimap {
+	minimap := Minimap{Cols: cols, Rows: rows, Cells: make([]int, cols*rows), Shapes: len(entries)}
+	if len(entries) == 0 {
+		return minimap
+	}
+
+	extent := entries[0].Bounds
+	for _, entry := range entries[1:] {
+		extent = extent.union(entry.Bounds)
+	}
+	minimap.X, minimap.Y, minimap.Width, minimap.Height = extent.X, extent.Y, extent.Width, extent.Height
+
+	cell := func(value, origin, size float64, cells int) int {
+		if size <= 0 {
+			return 0
+		}
+		return max(0, min(cells-1, int((value-origin)/size*float64(cells))))
+	}
+
+	// Mark each shape's corners in a difference grid, then add it up, so
+	// big shapes cost no more than small ones
+	diff := make([]int, (cols+1)*(rows+1))
+	for _, entry := range entries {
+		b := entry.Bounds
+		left, right := cell(b.X, extent.X, extent.Width, cols), cell(b.X+b.Width, extent.X, extent.Width, cols)+1
+		top, bottom := cell(b.Y, extent.Y, extent.Height, rows), cell(b.Y+b.Height, extent.Y, extent.Height, rows)+1
+		diff[top*(cols+1)+left]++
+		diff[top*(cols+1)+right]--
+		diff[bottom*(cols+1)+left]--
+		diff[bottom*(cols+1)+right]++
+	}
+	for row := 0; row < rows; row++ {
+		for col := 0; col < cols; col++ {
+			sum := diff[row*(cols+1)+col]
+			if row > 0 {
+				sum += minimap.Cells[(row-1)*cols+col]
+			}
+			if col > 0 {
+				sum += minimap.Cells[row*cols+col-1]
+			}
+			if row > 0 && col > 0 {
+				sum -= minimap.Cells[(row-1)*cols+col-1]
+			}
+			minimap.Cells[row*cols+col] = sum
+		}
+	}
+	return minimap
+}
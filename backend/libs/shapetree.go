@@ -0,0 +1,269 @@
+package libs
+
+import (
+	"container/list"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// shapeTreeFanout is how many children an R-tree node has at most
+const shapeTreeFanout = 16
+
+// ShapeTreeCacheShapes caps how many shapes the trees of hot boards hold in
+// memory altogether; the least recently used trees are dropped past it. It
+// is a variable so tests and benchmarks can turn the cache off.
+var ShapeTreeCacheShapes = 1_000_000
+
+// A board becomes hot, and worth a tree in memory, once its shapes are
+// queried hotShapeQueries times within hotShapeWindow
+const (
+	hotShapeQueries        = 3
+	hotShapeWindow         = time.Minute
+	maxTrackedShapeQueries = 1000
+)
+
+// ShapeEntry is a shape with its bounding box and position in the board's
+// shape list
+type ShapeEntry struct {
+	Order  int
+	Bounds Bounds
+	Shape  map[string]interface{}
+}
+
+// ShapeEntries lists the shapes of a board state that have a position
+func ShapeEntries(data map[string]interface{}) []ShapeEntry {
+	list, _ := ShapeList(data)
+	entries := make([]ShapeEntry, 0, len(list))
+	for order, item := range list {
+		shape, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if bounds, ok := ShapeBounds(shape); ok {
+			entries = append(entries, ShapeEntry{Order: order, Bounds: bounds, Shape: shape})
+		}
+	}
+	return entries
+}
+
+// ShapeTree is a read-only R-tree over the shapes of one board version,
+// packed with sort-tile-recursive so it needs no rebalancing
+type ShapeTree struct {
+	root *shapeTreeNode
+	size int
+}
+
+type shapeTreeNode struct {
+	bounds   Bounds
+	children []*shapeTreeNode
+	entries  []ShapeEntry // Leaves only
+}
+
+// BuildShapeTree packs the shapes of a board state into an R-tree
+func BuildShapeTree(data map[string]interface{}) *ShapeTree {
+	entries := ShapeEntries(data)
+	tree := &ShapeTree{size: len(entries)}
+	if len(entries) == 0 {
+		return tree
+	}
+
+	// Leaves: tile the shapes by center into slices of x, then y
+	leaves := []*shapeTreeNode{}
+	tile(entries, func(entry ShapeEntry) Bounds { return entry.Bounds }, func(group []ShapeEntry) {
+		leaf := &shapeTreeNode{bounds: group[0].Bounds, entries: group}
+		for _, entry := range group[1:] {
+			leaf.bounds = leaf.bounds.union(entry.Bounds)
+		}
+		leaves = append(leaves, leaf)
+	})
+
+	// Then the same for each level of nodes until one is left
+	level := leaves
+	for len(level) > 1 {
+		next := []*shapeTreeNode{}
+		tile(level, func(node *shapeTreeNode) Bounds { return node.bounds }, func(group []*shapeTreeNode) {
+			node := &shapeTreeNode{bounds: group[0].bounds, children: group}
+			for _, child := range group[1:] {
+				node.bounds = node.bounds.union(child.bounds)
+			}
+			next = append(next, node)
+		})
+		level = next
+	}
+	tree.root = level[0]
+	return tree
+}
+
+// Len is the number of shapes in the tree
+func (t *ShapeTree) Len() int {
+	return t.size
+}
+
+// Extent is the box around every shape, if there are any
+func (t *ShapeTree) Extent() (Bounds, bool) {
+	if t.root == nil {
+		return Bounds{}, false
+	}
+	return t.root.bounds, true
+}
+
+// Search returns the shapes intersecting the box, in drawing order
+func (t *ShapeTree) Search(box Bounds) []ShapeEntry {
+	found := []ShapeEntry{}
+	if t.root == nil {
+		return found
+	}
+
+	stack := []*shapeTreeNode{t.root}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if !node.bounds.intersects(box) {
+			continue
+		}
+		for _, entry := range node.entries {
+			if entry.Bounds.intersects(box) {
+				found = append(found, entry)
+			}
+		}
+		stack = append(stack, node.children...)
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].Order < found[j].Order })
+	return found
+}
+
+// tile splits items into runs of shapeTreeFanout that are close together:
+// sorted into vertical slices by center x, each slice sorted by center y
+func tile[T any](items []T, bounds func(T) Bounds, group func([]T)) {
+	centerX := func(item T) float64 { b := bounds(item); return b.X + b.Width/2 }
+	centerY := func(item T) float64 { b := bounds(item); return b.Y + b.Height/2 }
+
+	sort.Slice(items, func(i, j int) bool { return centerX(items[i]) < centerX(items[j]) })
+	sliceSize := tileSliceSize(len(items))
+	for start := 0; start < len(items); start += sliceSize {
+		slice := items[start:min(start+sliceSize, len(items))]
+		sort.Slice(slice, func(i, j int) bool { return centerY(slice[i]) < centerY(slice[j]) })
+		for from := 0; from < len(slice); from += shapeTreeFanout {
+			group(slice[from:min(from+shapeTreeFanout, len(slice))])
+		}
+	}
+}
+
+// tileSliceSize is how many items go in each vertical slice so that the
+// groups come out roughly square
+func tileSliceSize(n int) int {
+	groups := math.Ceil(float64(n) / shapeTreeFanout)
+	slices := math.Ceil(math.Sqrt(groups))
+	return int(math.Ceil(groups/slices)) * shapeTreeFanout
+}
+
+// shapeTreeCache keeps the trees of hot boards, least recently used first
+// out, and counts recent queries to tell which boards are hot
+var shapeTreeCache = struct {
+	sync.Mutex
+	order   *list.List
+	trees   map[primitive.ObjectID]*list.Element
+	shapes  int
+	queries map[primitive.ObjectID][]time.Time
+}{
+	order:   list.New(),
+	trees:   map[primitive.ObjectID]*list.Element{},
+	queries: map[primitive.ObjectID][]time.Time{},
+}
+
+type cachedShapeTree struct {
+	boardID primitive.ObjectID
+	version int64
+	tree    *ShapeTree
+}
+
+// CachedShapeTree returns the tree of the board version if it is in memory
+func CachedShapeTree(boardID primitive.ObjectID, version int64) *ShapeTree {
+	shapeTreeCache.Lock()
+	defer shapeTreeCache.Unlock()
+
+	element, ok := shapeTreeCache.trees[boardID]
+	if !ok {
+		return nil
+	}
+	cached := element.Value.(*cachedShapeTree)
+	if cached.version != version {
+		return nil
+	}
+	shapeTreeCache.order.MoveToFront(element)
+	return cached.tree
+}
+
+// CacheShapeTree keeps the tree of a board version in memory, in place of
+// the board's previous one
+func CacheShapeTree(boardID primitive.ObjectID, version int64, tree *ShapeTree) {
+	shapeTreeCache.Lock()
+	defer shapeTreeCache.Unlock()
+
+	if tree.Len() > ShapeTreeCacheShapes {
+		return
+	}
+	if element, ok := shapeTreeCache.trees[boardID]; ok {
+		removeCachedShapeTree(element)
+	}
+	shapeTreeCache.trees[boardID] = shapeTreeCache.order.PushFront(&cachedShapeTree{boardID: boardID, version: version, tree: tree})
+	shapeTreeCache.shapes += tree.Len()
+	for shapeTreeCache.shapes > ShapeTreeCacheShapes {
+		removeCachedShapeTree(shapeTreeCache.order.Back())
+	}
+}
+
+// NoteShapeQuery counts a query of the board's shapes and reports whether
+// the board is now hot enough to keep a tree of in memory
+func NoteShapeQuery(boardID primitive.ObjectID) bool {
+	shapeTreeCache.Lock()
+	defer shapeTreeCache.Unlock()
+
+	if ShapeTreeCacheShapes <= 0 {
+		return false
+	}
+
+	now := time.Now()
+	recent := []time.Time{}
+	for _, at := range shapeTreeCache.queries[boardID] {
+		if now.Sub(at) < hotShapeWindow {
+			recent = append(recent, at)
+		}
+	}
+	recent = append(recent, now)
+	if len(recent) > hotShapeQueries {
+		recent = recent[len(recent)-hotShapeQueries:]
+	}
+	shapeTreeCache.queries[boardID] = recent
+
+	// Now and then, forget boards nobody has queried lately
+	if len(shapeTreeCache.queries) > maxTrackedShapeQueries {
+		for id, times := range shapeTreeCache.queries {
+			if now.Sub(times[len(times)-1]) >= hotShapeWindow {
+				delete(shapeTreeCache.queries, id)
+			}
+		}
+	}
+	return len(recent) >= hotShapeQueries
+}
+
+// ForgetShapeTree drops a board's tree, such as when the board is deleted
+func ForgetShapeTree(boardID primitive.ObjectID) {
+	shapeTreeCache.Lock()
+	defer shapeTreeCache.Unlock()
+
+	if element, ok := shapeTreeCache.trees[boardID]; ok {
+		removeCachedShapeTree(element)
+	}
+	delete(shapeTreeCache.queries, boardID)
+}
+
+func removeCachedShapeTree(element *list.Element) {
+	cached := shapeTreeCache.order.Remove(element).(*cachedShapeTree)
+	delete(shapeTreeCache.trees, cached.boardID)
+	shapeTreeCache.shapes -= cached.tree.Len()
+}
@@ -0,0 +1,134 @@
+package libs
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+
+	"github.com/sarwanazhar/boardsar/backend/models"
+)
+
+// ShapeType is a custom shape type with server-side validation. Shapes whose
+// "type" names it are checked on every write.
+type ShapeType struct {
+	Name        string                                   `json:"type"`
+	Source      string                                   `json:"source"` // What registered it: a plugin name, or "schema"
+	Description string                                   `json:"description,omitempty"`
+	Schema      map[string]interface{}                   `json:"schema,omitempty"` // Description of the fields for clients
+	Validate    func(shape map[string]interface{}) error `json:"-"`
+}
+
+// ShapeTypeSourceSchema marks shape types registered at runtime with a JSON
+// Schema, as opposed to ones compiled in by plugins
+const ShapeTypeSourceSchema = "schema"
+
+var shapeTypes = struct {
+	sync.RWMutex
+	byName map[string]ShapeType
+}{byName: map[string]ShapeType{}}
+
+// RegisterShapeType adds a custom shape type. Names must be unique and can't
+// shadow a built-in type.
+func RegisterShapeType(shapeType ShapeType) error {
+	if shapeType.Name == "" || shapeType.Validate == nil {
+		return fmt.Errorf("shape type needs a name and a validator")
+	}
+	if models.BuiltinShapeTypes[shapeType.Name] {
+		return fmt.Errorf("shape type %q is built in", shapeType.Name)
+	}
+
+	shapeTypes.Lock()
+	defer shapeTypes.Unlock()
+	if existing, ok := shapeTypes.byName[shapeType.Name]; ok {
+		return fmt.Errorf("shape type %q is already registered by %s", shapeType.Name, existing.Source)
+	}
+	shapeTypes.byName[shapeType.Name] = shapeType
+	return nil
+}
+
+// setSchemaShapeTypes replaces the schema-registered shape types. A schema
+// type clashing with a plugin's is skipped, since plugins register first.
+func setSchemaShapeTypes(types []ShapeType) {
+	shapeTypes.Lock()
+	defer shapeTypes.Unlock()
+
+	for name, shapeType := range shapeTypes.byName {
+		if shapeType.Source == ShapeTypeSourceSchema {
+			delete(shapeTypes.byName, name)
+		}
+	}
+	for _, shapeType := range types {
+		if existing, ok := shapeTypes.byName[shapeType.Name]; ok {
+			slog.Warn("Shape type is already registered; ignoring its schema", "shape_type", shapeType.Name, "source", existing.Source)
+			continue
+		}
+		shapeTypes.byName[shapeType.Name] = shapeType
+	}
+}
+
+// putSchemaShapeType adds or replaces one schema-registered shape type
+func putSchemaShapeType(shapeType ShapeType) error {
+	shapeTypes.Lock()
+	defer shapeTypes.Unlock()
+	if existing, ok := shapeTypes.byName[shapeType.Name]; ok && existing.Source != ShapeTypeSourceSchema {
+		return fmt.Errorf("%w: registered by %s", ErrShapeTypeTaken, existing.Source)
+	}
+	shapeTypes.byName[shapeType.Name] = shapeType
+	return nil
+}
+
+// removeSchemaShapeType drops a schema-registered shape type
+func removeSchemaShapeType(name string) {
+	shapeTypes.Lock()
+	defer shapeTypes.Unlock()
+	if existing, ok := shapeTypes.byName[name]; ok && existing.Source == ShapeTypeSourceSchema {
+		delete(shapeTypes.byName, name)
+	}
+}
+
+// ShapeTypes lists the registered custom shape types by name
+func ShapeTypes() []ShapeType {
+	shapeTypes.RLock()
+	defer shapeTypes.RUnlock()
+
+	types := make([]ShapeType, 0, len(shapeTypes.byName))
+	for _, shapeType := range shapeTypes.byName {
+		types = append(types, shapeType)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i].Name < types[j].Name })
+	return types
+}
+
+// ValidateShape checks a shape of a custom type against its validator.
+// Shapes of other types pass.
+func ValidateShape(shape map[string]interface{}) error {
+	name, _ := shape["type"].(string)
+
+	shapeTypes.RLock()
+	shapeType, ok := shapeTypes.byName[name]
+	shapeTypes.RUnlock()
+	if !ok {
+		return nil
+	}
+
+	if err := shapeType.Validate(shape); err != nil {
+		id, _ := shape["id"].(string)
+		return fmt.Errorf("invalid %s shape %s: %v", name, id, err)
+	}
+	return nil
+}
+
+// ValidateBoardShapes checks every shape of a board state, reporting the
+// first invalid one
+func ValidateBoardShapes(data map[string]interface{}) error {
+	shapes, _ := ShapeList(data)
+	for _, item := range shapes {
+		if shape, ok := item.(map[string]interface{}); ok {
+			if err := ValidateShape(shape); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
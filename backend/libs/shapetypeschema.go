@@ -0,0 +1,180 @@
+package libs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"time"
+
+	"github.com/sarwanazhar/boardsar/backend/database"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const shapeTypeSchemaCollection = "shape_types"
+
+// Shape type registration errors
+var (
+	ErrInvalidShapeTypeName = errors.New("shape type names are 1-40 lowercase letters, digits and dashes")
+	ErrShapeTypeBuiltin     = errors.New("shape type is built in")
+	ErrShapeTypeTaken       = errors.New("shape type is provided by a plugin")
+	ErrInvalidShapeSchema   = errors.New("invalid schema")
+)
+
+// validShapeTypeName keeps type names usable as URL segments
+var validShapeTypeName = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,39}$`)
+
+func GetShapeTypeSchemaCollection() *mongo.Collection {
+	return database.GetCollection(shapeTypeSchemaCollection)
+}
+
+// SaveShapeTypeSchema registers a custom shape type validated by a JSON
+// Schema, replacing the type's previous schema if it has one. The schema
+// applies to the whole shape object, including its id and type.
+func SaveShapeTypeSchema(ctx context.Context, name, description string, schema map[string]interface{}, userID primitive.ObjectID) (*models.ShapeTypeSchema, error) {
+	if !validShapeTypeName.MatchString(name) {
+		return nil, ErrInvalidShapeTypeName
+	}
+	if models.BuiltinShapeTypes[name] {
+		return nil, ErrShapeTypeBuiltin
+	}
+
+	encoded, err := json.Marshal(schema)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidShapeSchema, err)
+	}
+	now := time.Now()
+	doc := models.ShapeTypeSchema{
+		Type:        name,
+		Description: description,
+		Schema:      schema,
+		SchemaJSON:  string(encoded),
+		UpdatedBy:   userID,
+		UpdatedAt:   now,
+	}
+	shapeType, err := schemaShapeType(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	// Refuse up front rather than storing a schema no instance would load
+	shapeTypes.RLock()
+	existing, taken := shapeTypes.byName[name]
+	shapeTypes.RUnlock()
+	if taken && existing.Source != ShapeTypeSourceSchema {
+		return nil, fmt.Errorf("%w: registered by %s", ErrShapeTypeTaken, existing.Source)
+	}
+
+	err = GetShapeTypeSchemaCollection().FindOneAndUpdate(ctx,
+		bson.M{"_id": name},
+		bson.M{
+			"$set": bson.M{
+				"description": description,
+				"schema":      doc.SchemaJSON,
+				"updatedBy":   userID,
+				"updatedAt":   now,
+			},
+			"$setOnInsert": bson.M{"createdAt": now},
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&doc)
+	if err != nil {
+		return nil, fmt.Errorf("error saving shape type: %w", err)
+	}
+	doc.Schema = schema
+
+	if err := putSchemaShapeType(shapeType); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// DeleteShapeTypeSchema unregisters a schema-registered shape type. Existing
+// shapes of the type are kept and no longer validated.
+func DeleteShapeTypeSchema(ctx context.Context, name string) (bool, error) {
+	result, err := GetShapeTypeSchemaCollection().DeleteOne(ctx, bson.M{"_id": name})
+	if err != nil {
+		return false, fmt.Errorf("error deleting shape type: %w", err)
+	}
+	removeSchemaShapeType(name)
+	return result.DeletedCount > 0, nil
+}
+
+// LoadShapeTypeSchemas replaces this instance's schema-registered shape types
+// with the stored ones. A stored schema that no longer compiles is logged
+// and skipped rather than blocking the rest.
+func LoadShapeTypeSchemas(ctx context.Context) error {
+	cursor, err := GetShapeTypeSchemaCollection().Find(ctx, bson.M{})
+	if err != nil {
+		return fmt.Errorf("error loading shape types: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var docs []models.ShapeTypeSchema
+	if err := cursor.All(ctx, &docs); err != nil {
+		return fmt.Errorf("error loading shape types: %w", err)
+	}
+
+	types := make([]ShapeType, 0, len(docs))
+	for _, doc := range docs {
+		if err := json.Unmarshal([]byte(doc.SchemaJSON), &doc.Schema); err != nil {
+			slog.Warn("Skipping shape type", "shape_type", doc.Type, "error", err)
+			continue
+		}
+		shapeType, err := schemaShapeType(doc)
+		if err != nil {
+			slog.Warn("Skipping shape type", "shape_type", doc.Type, "error", err)
+			continue
+		}
+		types = append(types, shapeType)
+	}
+	setSchemaShapeTypes(types)
+	return nil
+}
+
+// RunShapeTypeSchemaRefresh reloads the stored shape types periodically, so
+// schemas registered through another instance are enforced here too. It
+// blocks until ctx is cancelled.
+func RunShapeTypeSchemaRefresh(ctx context.Context) {
+	interval := settings.Intervals.ShapeTypesRefresh
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		loadCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		if err := LoadShapeTypeSchemas(loadCtx); err != nil {
+			slog.Warn("Shape type refresh failed", "error", err)
+		}
+		cancel()
+	}
+}
+
+// schemaShapeType compiles a stored schema into a registry entry
+func schemaShapeType(doc models.ShapeTypeSchema) (ShapeType, error) {
+	validate, err := CompileJSONSchema(doc.Schema)
+	if err != nil {
+		return ShapeType{}, fmt.Errorf("%w: %v", ErrInvalidShapeSchema, err)
+	}
+
+	return ShapeType{
+		Name:        doc.Type,
+		Source:      ShapeTypeSourceSchema,
+		Description: doc.Description,
+		Schema:      doc.Schema,
+		Validate: func(shape map[string]interface{}) error {
+			return validate(shape)
+		},
+	}, nil
+}
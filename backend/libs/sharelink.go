@@ -0,0 +1,224 @@
+package libs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/database"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	shareLinkCollection    = "share_links"
+	shareLinkUseCollection = "share_link_uses"
+)
+
+// maxReferrerLength caps stored referrers
+const maxReferrerLength = 512
+
+// ErrInvalidShareLink is returned for unknown or revoked share links. The
+// text is safe to return to clients.
+var ErrInvalidShareLink = errors.New("Share link not found or revoked")
+
+// Reasons a share link use alerts the owner
+const (
+	ShareLinkAlertThreshold  = "threshold"
+	ShareLinkAlertNewCountry = "newCountry"
+)
+
+func GetShareLinkCollection() *mongo.Collection {
+	return database.GetCollection(shareLinkCollection)
+}
+
+func GetShareLinkUseCollection() *mongo.Collection {
+	return database.GetCollection(shareLinkUseCollection)
+}
+
+// APIURL is the public base URL of this API, from API_URL. It is used for
+// links that act without the frontend, such as one-click revoke.
+func APIURL() string {
+	return settings.APIURL
+}
+
+// CreateShareLink stores a new share link for the board and returns it
+// together with its token, which is only available now
+func CreateShareLink(ctx context.Context, board *models.Board, req models.ShareLinkRequest) (*models.ShareLink, string, error) {
+	token, tokenHash, err := newSecretToken()
+	if err != nil {
+		return nil, "", fmt.Errorf("error generating share link: %w", err)
+	}
+
+	link := &models.ShareLink{
+		ID:              primitive.NewObjectID(),
+		BoardID:         board.ID,
+		OwnerID:         board.OwnerID,
+		TokenHash:       tokenHash,
+		AlertThreshold:  req.AlertThreshold,
+		AlertNewCountry: req.AlertNewCountry,
+		FrameID:         req.FrameID,
+		Countries:       []string{},
+		CreatedAt:       time.Now(),
+	}
+	if _, err := GetShareLinkCollection().InsertOne(ctx, link); err != nil {
+		return nil, "", fmt.Errorf("error storing share link: %w", err)
+	}
+	return link, token, nil
+}
+
+// FindShareLink returns the active share link with the given token
+func FindShareLink(ctx context.Context, token string) (*models.ShareLink, error) {
+	var link models.ShareLink
+	err := GetShareLinkCollection().FindOne(ctx, bson.M{
+		"tokenHash": hashToken(token),
+		"revokedAt": bson.M{"$exists": false},
+	}).Decode(&link)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrInvalidShareLink
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error finding share link: %w", err)
+	}
+	return &link, nil
+}
+
+// RecordShareLinkUse stores one use of the link and returns the alerts it
+// triggers. Each alert fires once: the threshold alert on the first use past
+// the threshold, the country alert on the first use from each new country
+// (the first country seen is the baseline).
+func RecordShareLinkUse(ctx context.Context, link *models.ShareLink, use models.ShareLinkUse) ([]string, error) {
+	use.ID = primitive.NewObjectID()
+	use.LinkID = link.ID
+	if _, err := GetShareLinkUseCollection().InsertOne(ctx, use); err != nil {
+		return nil, fmt.Errorf("error storing share link use: %w", err)
+	}
+
+	update := bson.M{
+		"$inc": bson.M{"useCount": 1},
+		"$set": bson.M{"lastUsedAt": use.UsedAt},
+	}
+	if use.Country != "" {
+		update["$addToSet"] = bson.M{"countries": use.Country}
+	}
+
+	// The document as it was before this use tells which alerts are new
+	var before models.ShareLink
+	err := GetShareLinkCollection().FindOneAndUpdate(ctx,
+		bson.M{"_id": link.ID, "revokedAt": bson.M{"$exists": false}},
+		update,
+		options.FindOneAndUpdate().SetReturnDocument(options.Before),
+	).Decode(&before)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrInvalidShareLink
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error updating share link: %w", err)
+	}
+
+	alerts := []string{}
+	if before.AlertThreshold > 0 && before.UseCount == before.AlertThreshold {
+		alerts = append(alerts, ShareLinkAlertThreshold)
+	}
+	if before.AlertNewCountry && use.Country != "" && len(before.Countries) > 0 && !slices.Contains(before.Countries, use.Country) {
+		alerts = append(alerts, ShareLinkAlertNewCountry)
+	}
+	return alerts, nil
+}
+
+// IssueShareLinkRevokeToken returns a token that revokes the link without
+// signing in, for the one-click revoke link in alert emails
+func IssueShareLinkRevokeToken(ctx context.Context, linkID primitive.ObjectID) (string, error) {
+	token, tokenHash, err := newSecretToken()
+	if err != nil {
+		return "", fmt.Errorf("error generating revoke token: %w", err)
+	}
+	_, err = GetShareLinkCollection().UpdateOne(ctx,
+		bson.M{"_id": linkID},
+		bson.M{"$push": bson.M{"revokeTokenHashes": tokenHash}},
+	)
+	if err != nil {
+		return "", fmt.Errorf("error storing revoke token: %w", err)
+	}
+	return token, nil
+}
+
+// RevokeShareLink revokes the active share link matching filter, and the
+// guest tokens issued through it
+func RevokeShareLink(ctx context.Context, filter bson.M) (*models.ShareLink, error) {
+	filter["revokedAt"] = bson.M{"$exists": false}
+
+	var link models.ShareLink
+	err := GetShareLinkCollection().FindOneAndUpdate(ctx, filter,
+		bson.M{"$set": bson.M{"revokedAt": time.Now()}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&link)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrInvalidShareLink
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error revoking share link: %w", err)
+	}
+	// Guest tokens expire soon anyway, so the link stays revoked either way
+	if err := revokeShareLinkGuestTokens(ctx, link.ID); err != nil {
+		slog.Warn("Failed to revoke guest tokens of share link", "share_link_id", link.ID.Hex(), "error", err)
+	}
+	return &link, nil
+}
+
+// RevokeShareLinkByRevokeToken revokes the link a one-click revoke token
+// was issued for
+func RevokeShareLinkByRevokeToken(ctx context.Context, token string) (*models.ShareLink, error) {
+	return RevokeShareLink(ctx, bson.M{"revokeTokenHashes": hashToken(token)})
+}
+
+// ShareLinkUseFromRequest describes a request opening a share link. The
+// country comes from the header set by the edge proxy (GEO_COUNTRY_HEADER),
+// so it is only as trustworthy as the proxy in front of the API.
+func ShareLinkUseFromRequest(c *gin.Context) models.ShareLinkUse {
+	return models.ShareLinkUse{
+		UsedAt:   time.Now(),
+		Country:  countryCode(c.GetHeader(settings.CountryHeader)),
+		Referrer: coarseReferrer(c.Request.Referer()),
+	}
+}
+
+// countryCode returns an upper-case ISO 3166 alpha-2 code, or "" for
+// missing values and the placeholders proxies use for unknown or Tor
+// traffic (XX, T1)
+func countryCode(value string) string {
+	code := strings.ToUpper(strings.TrimSpace(value))
+	if len(code) != 2 || code == "XX" || code == "T1" {
+		return ""
+	}
+	for _, r := range code {
+		if r < 'A' || r > 'Z' {
+			return ""
+		}
+	}
+	return code
+}
+
+// coarseReferrer drops the query string and fragment, which often carry
+// tokens or personal data
+func coarseReferrer(referrer string) string {
+	parsed, err := url.Parse(referrer)
+	if err != nil || parsed.Host == "" {
+		return ""
+	}
+	parsed.RawQuery, parsed.Fragment, parsed.User = "", "", nil
+	result := parsed.String()
+	if len(result) > maxReferrerLength {
+		result = result[:maxReferrerLength]
+	}
+	return result
+}
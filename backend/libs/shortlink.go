@@ -0,0 +1,136 @@
+package libs
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/database"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	shortLinkCollection      = "short_links"
+	shortLinkClickCollection = "short_link_clicks"
+)
+
+// Short codes are shortCodeLength characters of shortCodeAlphabet, which
+// leaves out characters easily misread on paper (0/O, 1/l/I)
+const (
+	shortCodeAlphabet = "23456789abcdefghijkmnopqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ"
+	shortCodeLength   = 8
+)
+
+// ErrShortLinkNotFound is returned for unknown short links, and those whose
+// board, share link or export is gone. The text is safe to return to
+// clients.
+var ErrShortLinkNotFound = errors.New("Short link not found")
+
+// ErrShortLinkExpired is returned for short links past their expiry. The
+// text is safe to return to clients.
+var ErrShortLinkExpired = errors.New("Short link has expired")
+
+func GetShortLinkCollection() *mongo.Collection {
+	return database.GetCollection(shortLinkCollection)
+}
+
+func GetShortLinkClickCollection() *mongo.Collection {
+	return database.GetCollection(shortLinkClickCollection)
+}
+
+// ShortLinkURL is where a short link is opened
+func ShortLinkURL(code string) string {
+	return APIURL() + "/s/" + code
+}
+
+// CreateShortLink stores the short link under a new random code
+func CreateShortLink(ctx context.Context, link *models.ShortLink) error {
+	link.ID = primitive.NewObjectID()
+	link.Countries = []string{}
+	link.CreatedAt = time.Now()
+
+	// A clash is unlikely, but the code is all there is to tell links apart
+	for attempt := 0; ; attempt++ {
+		code, err := newShortCode()
+		if err != nil {
+			return fmt.Errorf("error generating short code: %w", err)
+		}
+		link.Code = code
+		_, err = GetShortLinkCollection().InsertOne(ctx, link)
+		if err == nil {
+			return nil
+		}
+		if !mongo.IsDuplicateKeyError(err) || attempt == 2 {
+			return fmt.Errorf("error storing short link: %w", err)
+		}
+	}
+}
+
+// FindShortLink returns the short link with the given code, or
+// ErrShortLinkExpired once it has expired
+func FindShortLink(ctx context.Context, code string) (*models.ShortLink, error) {
+	var link models.ShortLink
+	err := GetShortLinkCollection().FindOne(ctx, bson.M{"code": code}).Decode(&link)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrShortLinkNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error finding short link: %w", err)
+	}
+	if link.ExpiresAt != nil && !link.ExpiresAt.After(time.Now()) {
+		return &link, ErrShortLinkExpired
+	}
+	return &link, nil
+}
+
+// RecordShortLinkClick stores one click of the link and counts it
+func RecordShortLinkClick(ctx context.Context, link *models.ShortLink, click models.ShortLinkClick) error {
+	click.ID = primitive.NewObjectID()
+	click.LinkID = link.ID
+	if _, err := GetShortLinkClickCollection().InsertOne(ctx, click); err != nil {
+		return fmt.Errorf("error storing short link click: %w", err)
+	}
+
+	update := bson.M{
+		"$inc": bson.M{"clickCount": 1},
+		"$set": bson.M{"lastClickedAt": click.ClickedAt},
+	}
+	if click.Country != "" {
+		update["$addToSet"] = bson.M{"countries": click.Country}
+	}
+	if _, err := GetShortLinkCollection().UpdateOne(ctx, bson.M{"_id": link.ID}, update); err != nil {
+		return fmt.Errorf("error updating short link: %w", err)
+	}
+	return nil
+}
+
+// ShortLinkClickFromRequest describes a request opening a short link, with
+// the country and referrer taken as for share links
+func ShortLinkClickFromRequest(c *gin.Context) models.ShortLinkClick {
+	use := ShareLinkUseFromRequest(c)
+	return models.ShortLinkClick{
+		ClickedAt: use.UsedAt,
+		Country:   use.Country,
+		Referrer:  use.Referrer,
+	}
+}
+
+func newShortCode() (string, error) {
+	code := make([]byte, shortCodeLength)
+	max := big.NewInt(int64(len(shortCodeAlphabet)))
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code[i] = shortCodeAlphabet[n.Int64()]
+	}
+	return string(code), nil
+}
@@ -0,0 +1,454 @@
+package libs
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sarwanazhar/boardsar/backend/database"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const storageSnapshotCollection = "storage_snapshots"
+
+const (
+	// storageHistoryDays is how far back the storage report looks
+	storageHistoryDays = 30
+)
+
+// storageGrowthWindows are the periods, in days, storage growth is
+// reported over
+var storageGrowthWindows = []int{7, 30}
+
+func GetStorageSnapshotCollection() *mongo.Collection {
+	return database.GetCollection(storageSnapshotCollection)
+}
+
+// CollectionStorage is what one collection takes
+type CollectionStorage struct {
+	Name        string           `json:"name"`
+	Documents   int64            `json:"documents"`
+	DataSize    int64            `json:"dataSize"`    // Documents, uncompressed
+	StorageSize int64            `json:"storageSize"` // Documents on disk
+	IndexSize   int64            `json:"indexSize"`
+	Indexes     map[string]int64 `json:"indexes"` // Size of each index
+}
+
+// GridFSUsage is what the files of one GridFS bucket take
+type GridFSUsage struct {
+	Bucket      string `json:"bucket"`
+	Files       int64  `json:"files"`
+	Size        int64  `json:"size"`        // The files' contents
+	StorageSize int64  `json:"storageSize"` // Its collections on disk, with their indexes
+}
+
+// LargestBoard is one of the largest board documents
+type LargestBoard struct {
+	ID           primitive.ObjectID `json:"id" bson:"_id"`
+	BoardID      string             `json:"boardId" bson:"boardId"`
+	Name         string             `json:"name,omitempty" bson:"name"`
+	OwnerID      primitive.ObjectID `json:"ownerId" bson:"ownerId"`
+	Archived     bool               `json:"archived" bson:"archived"`
+	DocumentSize int64              `json:"documentSize" bson:"documentSize"` // As stored
+	ContentSize  int64              `json:"contentSize" bson:"contentSize"`   // Contents before compression
+}
+
+// StorageGrowth is how much storage grew since the snapshot of Since
+type StorageGrowth struct {
+	Days        int    `json:"days"`
+	Since       string `json:"since"`
+	DataSize    int64  `json:"dataSize"`
+	StorageSize int64  `json:"storageSize"`
+	IndexSize   int64  `json:"indexSize"`
+	GridFSSize  int64  `json:"gridfsSize"`
+	Boards      int64  `json:"boards"`
+}
+
+// StorageReport is what the database takes and how fast it grows
+type StorageReport struct {
+	Documents     int64                    `json:"documents"`
+	DataSize      int64                    `json:"dataSize"`
+	StorageSize   int64                    `json:"storageSize"`
+	IndexSize     int64                    `json:"indexSize"`
+	Collections   []CollectionStorage      `json:"collections"` // Largest on disk first
+	GridFS        []GridFSUsage            `json:"gridfs"`
+	LargestBoards []LargestBoard           `json:"largestBoards"`
+	History       []models.StorageSnapshot `json:"history"` // Daily, oldest first
+	Growth        []StorageGrowth          `json:"growth"`
+}
+
+// StorageCollections lists the database's collections, without views and
+// system collections
+func StorageCollections(ctx context.Context) ([]string, error) {
+	names, err := database.GetDatabase().ListCollectionNames(ctx, bson.M{"type": "collection"})
+	if err != nil {
+		return nil, err
+	}
+	collections := make([]string, 0, len(names))
+	for _, name := range names {
+		if !strings.HasPrefix(name, "system.") {
+			collections = append(collections, name)
+		}
+	}
+	sort.Strings(collections)
+	return collections, nil
+}
+
+// collectionStorage reads a collection's storage stats, added up across
+// shards
+func collectionStorage(ctx context.Context, name string) (CollectionStorage, error) {
+	usage := CollectionStorage{Name: name, Indexes: map[string]int64{}}
+	cursor, err := database.GetCollection(name).Aggregate(ctx, bson.A{
+		bson.M{"$collStats": bson.M{"storageStats": bson.M{}}},
+	})
+	if err != nil {
+		return usage, err
+	}
+	var shards []struct {
+		StorageStats struct {
+			Count          int64            `bson:"count"`
+			Size           int64            `bson:"size"`
+			StorageSize    int64            `bson:"storageSize"`
+			TotalIndexSize int64            `bson:"totalIndexSize"`
+			IndexSizes     map[string]int64 `bson:"indexSizes"`
+		} `bson:"storageStats"`
+	}
+	if err := cursor.All(ctx, &shards); err != nil {
+		return usage, err
+	}
+	for _, shard := range shards {
+		stats := shard.StorageStats
+		usage.Documents += stats.Count
+		usage.DataSize += stats.Size
+		usage.StorageSize += stats.StorageSize
+		usage.IndexSize += stats.TotalIndexSize
+		for index, size := range stats.IndexSizes {
+			usage.Indexes[index] += size
+		}
+	}
+	return usage, nil
+}
+
+// ListCollectionStorage reads what each collection takes, largest on disk
+// first
+func ListCollectionStorage(ctx context.Context) ([]CollectionStorage, error) {
+	names, err := StorageCollections(ctx)
+	if err != nil {
+		return nil, err
+	}
+	collections := make([]CollectionStorage, 0, len(names))
+	for _, name := range names {
+		usage, err := collectionStorage(ctx, name)
+		if err != nil {
+			return nil, fmt.Errorf("error reading stats of %s: %w", name, err)
+		}
+		collections = append(collections, usage)
+	}
+	sort.SliceStable(collections, func(i, j int) bool {
+		return collections[i].StorageSize+collections[i].IndexSize > collections[j].StorageSize+collections[j].IndexSize
+	})
+	return collections, nil
+}
+
+// gridFSUsage totals the files of each GridFS bucket among collections
+func gridFSUsage(ctx context.Context, collections []CollectionStorage) ([]GridFSUsage, error) {
+	byName := map[string]CollectionStorage{}
+	for _, collection := range collections {
+		byName[collection.Name] = collection
+	}
+
+	buckets := []GridFSUsage{}
+	for _, collection := range collections {
+		bucket, ok := strings.CutSuffix(collection.Name, ".files")
+		if !ok {
+			continue
+		}
+		chunks := byName[bucket+".chunks"]
+		usage := GridFSUsage{
+			Bucket:      bucket,
+			StorageSize: collection.StorageSize + collection.IndexSize + chunks.StorageSize + chunks.IndexSize,
+		}
+
+		cursor, err := database.GetCollection(collection.Name).Aggregate(ctx, bson.A{
+			bson.M{"$group": bson.M{"_id": nil, "files": bson.M{"$sum": 1}, "size": bson.M{"$sum": "$length"}}},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error totaling GridFS bucket %s: %w", bucket, err)
+		}
+		var totals []struct {
+			Files int64 `bson:"files"`
+			Size  int64 `bson:"size"`
+		}
+		if err := cursor.All(ctx, &totals); err != nil {
+			return nil, fmt.Errorf("error totaling GridFS bucket %s: %w", bucket, err)
+		}
+		if len(totals) > 0 {
+			usage.Files = totals[0].Files
+			usage.Size = totals[0].Size
+		}
+		buckets = append(buckets, usage)
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].Bucket < buckets[j].Bucket })
+	return buckets, nil
+}
+
+// ListLargestBoards returns the limit largest board documents, largest
+// first
+func ListLargestBoards(ctx context.Context, limit int) ([]LargestBoard, error) {
+	cursor, err := database.GetCollection("boards").Aggregate(ctx, bson.A{
+		bson.M{"$project": bson.M{
+			"boardId":      1,
+			"name":         1,
+			"ownerId":      1,
+			"archived":     bson.M{"$ne": bson.A{bson.M{"$type": "$archived"}, "missing"}},
+			"documentSize": bson.M{"$bsonSize": "$$ROOT"},
+			// Compressed and archived boards, as in quotas
+			"contentSize": bson.M{"$ifNull": bson.A{bson.M{"$bsonSize": "$board"}, "$boardSize", "$archived.size", 0}},
+		}},
+		bson.M{"$sort": bson.D{{Key: "documentSize", Value: -1}, {Key: "_id", Value: 1}}},
+		bson.M{"$limit": limit},
+	})
+	if err != nil {
+		return nil, err
+	}
+	boards := []LargestBoard{}
+	if err := cursor.All(ctx, &boards); err != nil {
+		return nil, err
+	}
+	return boards, nil
+}
+
+// GetStorageReport reads what each collection, GridFS bucket and the
+// largest boards take, with the daily snapshots of the last 30 days and
+// the growth since
+func GetStorageReport(ctx context.Context, largest int) (*StorageReport, error) {
+	collections, err := ListCollectionStorage(ctx)
+	if err != nil {
+		return nil, err
+	}
+	gridFS, err := gridFSUsage(ctx, collections)
+	if err != nil {
+		return nil, err
+	}
+	boards, err := ListLargestBoards(ctx, largest)
+	if err != nil {
+		return nil, fmt.Errorf("error listing largest boards: %w", err)
+	}
+
+	now := time.Now().UTC()
+	cursor, err := GetStorageSnapshotCollection().Find(ctx,
+		bson.M{"_id": bson.M{"$gte": storageDay(now.AddDate(0, 0, -storageHistoryDays))}},
+		options.Find().SetSort(bson.M{"_id": 1}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error reading storage snapshots: %w", err)
+	}
+	history := []models.StorageSnapshot{}
+	if err := cursor.All(ctx, &history); err != nil {
+		return nil, fmt.Errorf("error reading storage snapshots: %w", err)
+	}
+
+	report := &StorageReport{
+		Collections:   collections,
+		GridFS:        gridFS,
+		LargestBoards: boards,
+		History:       history,
+		Growth:        []StorageGrowth{},
+	}
+	current := storageSnapshot(now, collections, gridFS)
+	report.Documents = current.Documents
+	report.DataSize = current.DataSize
+	report.StorageSize = current.StorageSize
+	report.IndexSize = current.IndexSize
+
+	for _, window := range storageGrowthWindows {
+		from := storageDay(now.AddDate(0, 0, -window))
+		for _, snapshot := range history {
+			if snapshot.Day < from {
+				continue
+			}
+			if snapshot.Day == current.Day {
+				break
+			}
+			day, _ := time.Parse(time.DateOnly, snapshot.Day)
+			report.Growth = append(report.Growth, StorageGrowth{
+				Days:        int(now.Sub(day).Hours() / 24),
+				Since:       snapshot.Day,
+				DataSize:    current.DataSize - snapshot.DataSize,
+				StorageSize: current.StorageSize - snapshot.StorageSize,
+				IndexSize:   current.IndexSize - snapshot.IndexSize,
+				GridFSSize:  current.GridFSSize - snapshot.GridFSSize,
+				Boards:      current.Boards - snapshot.Boards,
+			})
+			break
+		}
+	}
+	return report, nil
+}
+
+// storageDay is the _id of the day's snapshot
+func storageDay(t time.Time) string {
+	return t.UTC().Format(time.DateOnly)
+}
+
+// storageSnapshot totals collections and GridFS buckets as the snapshot of
+// now's day
+func storageSnapshot(now time.Time, collections []CollectionStorage, gridFS []GridFSUsage) models.StorageSnapshot {
+	snapshot := models.StorageSnapshot{
+		Day:       storageDay(now),
+		TakenAt:   now,
+		ExpiresAt: now.AddDate(1, 0, 0),
+	}
+	for _, collection := range collections {
+		snapshot.Documents += collection.Documents
+		snapshot.DataSize += collection.DataSize
+		snapshot.StorageSize += collection.StorageSize
+		snapshot.IndexSize += collection.IndexSize
+		if collection.Name == "boards" {
+			snapshot.Boards = collection.Documents
+		}
+	}
+	for _, bucket := range gridFS {
+		snapshot.GridFSSize += bucket.Size
+	}
+	return snapshot
+}
+
+// TakeStorageSnapshot records what the database takes today, replacing any
+// snapshot taken earlier in the day
+func TakeStorageSnapshot(ctx context.Context) error {
+	collections, err := ListCollectionStorage(ctx)
+	if err != nil {
+		return err
+	}
+	gridFS, err := gridFSUsage(ctx, collections)
+	if err != nil {
+		return err
+	}
+	snapshot := storageSnapshot(time.Now().UTC(), collections, gridFS)
+	_, err = GetStorageSnapshotCollection().ReplaceOne(ctx,
+		bson.M{"_id": snapshot.Day}, snapshot, options.Replace().SetUpsert(true))
+	return err
+}
+
+// RunStorageSnapshots takes the day's storage snapshot now and every
+// STORAGE_SNAPSHOT_INTERVAL until ctx is done. Snapshots are kept for a
+// year.
+func RunStorageSnapshots(ctx context.Context) {
+	ticker := time.NewTicker(settings.Intervals.StorageSnapshot)
+	defer ticker.Stop()
+
+	for {
+		snapshotCtx, cancel := context.WithTimeout(ctx, time.Minute)
+		if err := TakeStorageSnapshot(snapshotCtx); err != nil && ctx.Err() == nil {
+			slog.Warn("Failed to take storage snapshot", "error", err)
+		}
+		cancel()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// CompactResult is what compacting one collection did
+type CompactResult struct {
+	Collection string `json:"collection"`
+	BytesFreed int64  `json:"bytesFreed"`
+	Error      string `json:"error,omitempty"`
+}
+
+// CompactCollections compacts each collection in turn, releasing the disk
+// space of deleted documents to the operating system. A collection that
+// can't be compacted is reported and the others go on.
+func CompactCollections(ctx context.Context, collections []string) []CompactResult {
+	results := make([]CompactResult, 0, len(collections))
+	for i, name := range collections {
+		result := CompactResult{Collection: name}
+		var response struct {
+			BytesFreed int64 `bson:"bytesFreed"`
+		}
+		err := database.GetDatabase().RunCommand(ctx, bson.D{{Key: "compact", Value: name}}).Decode(&response)
+		if err != nil {
+			slog.Warn("Failed to compact collection", "collection", name, "error", err)
+			result.Error = err.Error()
+		}
+		result.BytesFreed = response.BytesFreed
+		results = append(results, result)
+		ReportJobProgress(ctx, (i+1)*100/len(collections))
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return results
+}
+
+// RebuildIndexes creates every index the backend expects that is missing,
+// such as after a restore or one dropped by hand, and returns the indexes
+// each collection has then
+func RebuildIndexes(ctx context.Context) (map[string][]string, error) {
+	database.CreateIndexes()
+	ReportJobProgress(ctx, 50)
+
+	names, err := StorageCollections(ctx)
+	if err != nil {
+		return nil, err
+	}
+	indexes := map[string][]string{}
+	for _, name := range names {
+		specs, err := database.GetCollection(name).Indexes().ListSpecifications(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error listing indexes of %s: %w", name, err)
+		}
+		for _, spec := range specs {
+			indexes[name] = append(indexes[name], spec.Name)
+		}
+	}
+	return indexes, nil
+}
+
+// RecalculateStorageUsage rewrites the summary of every board, with its
+// shape and collaborator counts, from the board itself, then takes the
+// day's storage snapshot. It returns how many boards it went through.
+func RecalculateStorageUsage(ctx context.Context) (int, error) {
+	boards := database.GetCollection("boards")
+	total, err := boards.EstimatedDocumentCount(ctx)
+	if err != nil {
+		return 0, err
+	}
+	cursor, err := boards.Find(ctx, bson.M{}, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	count := 0
+	for cursor.Next(ctx) {
+		var board struct {
+			ID primitive.ObjectID `bson:"_id"`
+		}
+		if err := cursor.Decode(&board); err != nil {
+			return count, err
+		}
+		if err := backfillBoardSummary(ctx, board.ID); err != nil {
+			return count, fmt.Errorf("error recalculating summary of board %s: %w", board.ID.Hex(), err)
+		}
+		count++
+		if total > 0 {
+			ReportJobProgress(ctx, int(min(int64(count)*100/total, 99)))
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return count, err
+	}
+	return count, TakeStorageSnapshot(ctx)
+}
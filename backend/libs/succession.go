@@ -0,0 +1,216 @@
+package libs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/sarwanazhar/boardsar/backend/database"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const successionPolicyCollection = "succession_policy"
+
+// successionPolicyID is the _id of the instance's one policy document
+const successionPolicyID = "instance"
+
+// ErrInvalidSuccessor is returned when the successor isn't an active admin.
+// The text is safe to return to clients.
+var ErrInvalidSuccessor = errors.New("successorId must be an active admin")
+
+func GetSuccessionPolicyCollection() *mongo.Collection {
+	return database.GetCollection(successionPolicyCollection)
+}
+
+// GetSuccessionPolicy loads the instance's succession policy; it is
+// disabled until an admin sets one
+func GetSuccessionPolicy(ctx context.Context) (*models.SuccessionPolicy, error) {
+	var policy models.SuccessionPolicy
+	err := GetSuccessionPolicyCollection().FindOne(ctx, bson.M{"_id": successionPolicyID}).Decode(&policy)
+	if err == mongo.ErrNoDocuments {
+		return &policy, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// SaveSuccessionPolicy replaces the instance's succession policy
+func SaveSuccessionPolicy(ctx context.Context, policy *models.SuccessionPolicy) error {
+	_, err := GetSuccessionPolicyCollection().UpdateOne(ctx,
+		bson.M{"_id": successionPolicyID},
+		bson.M{"$set": policy},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+// FindSuccessor loads the user boards are handed to, or returns
+// ErrInvalidSuccessor unless they are an active admin
+func FindSuccessor(ctx context.Context, id primitive.ObjectID) (*models.User, error) {
+	user, err := FindUserByID(ctx, id.Hex())
+	if err != nil {
+		return nil, ErrInvalidSuccessor
+	}
+	if user.Role != models.RoleAdmin || user.DeactivatedAt != nil {
+		return nil, ErrInvalidSuccessor
+	}
+	return user, nil
+}
+
+// RunOwnershipSuccession applies the succession policy every
+// SUCCESSION_INTERVAL until ctx is done. handedOver is called for each
+// member whose boards were transferred, such as to tell the successor.
+func RunOwnershipSuccession(ctx context.Context, handedOver func(ctx context.Context, successor *models.User, transfer *models.SuccessionTransfer)) {
+	ticker := time.NewTicker(settings.Intervals.Succession)
+	defer ticker.Stop()
+
+	for {
+		if _, err := ApplySuccessionPolicy(ctx, handedOver); err != nil && ctx.Err() == nil {
+			slog.Warn("Failed to apply succession policy", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ApplySuccessionPolicy transfers the boards of deactivated members, and of
+// those inactive for the policy's InactiveDays, to the successor, and
+// returns what was handed over. Accounts count as inactive from their last
+// sign-in or token refresh; those with none recorded are left alone.
+// Boards whose owner scheduled their deletion are left to it.
+func ApplySuccessionPolicy(ctx context.Context, handedOver func(ctx context.Context, successor *models.User, transfer *models.SuccessionTransfer)) ([]models.SuccessionTransfer, error) {
+	policy, err := GetSuccessionPolicy(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !policy.Enabled {
+		return nil, nil
+	}
+	successor, err := FindSuccessor(ctx, policy.SuccessorID)
+	if err != nil {
+		return nil, fmt.Errorf("successor %s: %w", policy.SuccessorID.Hex(), err)
+	}
+
+	var inactiveBefore time.Time
+	if policy.InactiveDays > 0 {
+		inactiveBefore = time.Now().AddDate(0, 0, -policy.InactiveDays)
+	}
+	findCtx, cancel := context.WithTimeout(ctx, Settings().DBTimeout)
+	departed, err := users.FindDeparted(findCtx, inactiveBefore)
+	cancel()
+	if err != nil {
+		return nil, fmt.Errorf("error finding departed members: %w", err)
+	}
+
+	transfers := []models.SuccessionTransfer{}
+	for i := range departed {
+		member := &departed[i]
+		if member.ID == successor.ID {
+			continue
+		}
+		transfer := models.SuccessionTransfer{FromUserID: member.ID, Reason: models.SuccessionReasonInactive}
+		if member.DeactivatedAt != nil {
+			transfer.Reason = models.SuccessionReasonDeactivated
+		}
+		transfer.BoardIDs, err = transferOwnedBoards(ctx, member.ID, successor.ID, transfer.Reason)
+		if err != nil {
+			return transfers, fmt.Errorf("member %s: %w", member.ID.Hex(), err)
+		}
+		if len(transfer.BoardIDs) == 0 {
+			continue
+		}
+		transfers = append(transfers, transfer)
+		if handedOver != nil {
+			handedOver(ctx, successor, &transfer)
+		}
+	}
+	return transfers, nil
+}
+
+// transferOwnedBoards hands the boards from owns to to, and returns those
+// this call moved
+func transferOwnedBoards(ctx context.Context, from, to primitive.ObjectID, reason string) ([]primitive.ObjectID, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	cursor, err := database.GetCollection("boards").Find(ctx, bson.M{"ownerId": from},
+		options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var owned []models.Board
+	if err := cursor.All(ctx, &owned); err != nil {
+		return nil, err
+	}
+
+	moved := []primitive.ObjectID{}
+	for _, board := range owned {
+		deletion, err := FindPendingDeletion(ctx, models.DeletionKindBoard, from, &board.ID)
+		if err != nil {
+			return moved, err
+		}
+		if deletion != nil {
+			continue
+		}
+		ok, err := TransferBoardOwnership(ctx, board.ID, from, to)
+		if err != nil {
+			return moved, fmt.Errorf("board %s: %w", board.ID.Hex(), err)
+		}
+		if !ok {
+			// Moved by another instance, or deleted meanwhile
+			continue
+		}
+		moved = append(moved, board.ID)
+		RecordAudit(ctx, models.AuditEvent{
+			Action: models.AuditBoardOwnershipTransferred,
+			Target: &models.AuditTarget{Type: models.AuditTargetBoard, ID: board.ID.Hex()},
+			Details: map[string]interface{}{
+				"fromUserId": from.Hex(),
+				"toUserId":   to.Hex(),
+				"reason":     reason,
+			},
+		})
+	}
+	return moved, nil
+}
+
+// TransferBoardOwnership makes to the owner of a board from owns, and
+// reports whether it did. The former owner stays on as an editor, should
+// they come back; the board leaves their folders.
+func TransferBoardOwnership(ctx context.Context, boardID, from, to primitive.ObjectID) (bool, error) {
+	boards := database.GetCollection("boards")
+	result, err := boards.UpdateOne(ctx,
+		bson.M{"_id": boardID, "ownerId": from},
+		bson.M{
+			"$set":   bson.M{"ownerId": to},
+			"$unset": bson.M{"folderId": ""},
+			"$pull":  bson.M{"sharedWith": bson.M{"userId": to}},
+		},
+	)
+	if err != nil || result.MatchedCount == 0 {
+		return false, err
+	}
+	_, err = boards.UpdateOne(ctx,
+		bson.M{"_id": boardID, "sharedWith.userId": bson.M{"$ne": from}},
+		bson.M{"$push": bson.M{"sharedWith": models.Collaborator{UserID: from, Role: models.CollaboratorRoleEditor}}},
+	)
+	if err != nil {
+		return true, err
+	}
+
+	InvalidateBoard(ctx, boardID)
+	RefreshBoardSummary(ctx, boardID, nil)
+	return true, nil
+}
@@ -0,0 +1,102 @@
+package libs
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sarwanazhar/boardsar/backend/database"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const templateCollection = "templates"
+
+func GetTemplateCollection() *mongo.Collection {
+	return database.GetCollection(templateCollection)
+}
+
+// templateAccessFilter matches the templates offered to userID: their own
+// and the global ones
+func templateAccessFilter(userID primitive.ObjectID) bson.M {
+	return bson.M{"$or": bson.A{
+		bson.M{"ownerId": userID},
+		bson.M{"global": true},
+	}}
+}
+
+// TemplateBoardData prepares board contents for a template, as userID sees
+// them. Private notes are dropped or, for the user's own, made ordinary
+// notes, since boards made from the template belong to someone else.
+func TemplateBoardData(data map[string]interface{}, userID primitive.ObjectID) map[string]interface{} {
+	template := CopyBoardData(VisibleBoardData(data, userID))
+
+	list, ok := ShapeList(template)
+	if !ok {
+		return template
+	}
+	for _, item := range list {
+		if shape, ok := item.(map[string]interface{}); ok {
+			delete(shape, ShapeHiddenKey)
+			delete(shape, ShapeAuthorKey)
+		}
+	}
+	return template
+}
+
+// SaveTemplate stores a new template
+func SaveTemplate(ctx context.Context, template *models.Template) error {
+	if _, err := GetTemplateCollection().InsertOne(ctx, template); err != nil {
+		return fmt.Errorf("error saving template: %w", err)
+	}
+	return nil
+}
+
+// ListTemplates returns the templates offered to userID without their
+// contents, global ones first, then newest first. A limit of 0 returns all
+// of them.
+func ListTemplates(ctx context.Context, userID primitive.ObjectID, limit int64) ([]models.Template, error) {
+	cursor, err := GetTemplateCollection().Find(ctx, templateAccessFilter(userID), options.Find().
+		SetSort(bson.D{{Key: "global", Value: -1}, {Key: "_id", Value: -1}}).
+		SetProjection(BoardContentsProjection).
+		SetLimit(limit))
+	if err != nil {
+		return nil, err
+	}
+
+	templates := []models.Template{}
+	if err := cursor.All(ctx, &templates); err != nil {
+		return nil, err
+	}
+	return templates, nil
+}
+
+// CountTemplates counts the templates offered to userID
+func CountTemplates(ctx context.Context, userID primitive.ObjectID) (int64, error) {
+	return GetTemplateCollection().CountDocuments(ctx, templateAccessFilter(userID))
+}
+
+// FindTemplate loads a template offered to userID, with its contents
+func FindTemplate(ctx context.Context, templateID string, userID primitive.ObjectID) (*models.Template, error) {
+	id, err := primitive.ObjectIDFromHex(templateID)
+	if err != nil {
+		return nil, mongo.ErrNoDocuments
+	}
+
+	filter := templateAccessFilter(userID)
+	filter["_id"] = id
+
+	var template models.Template
+	if err := GetTemplateCollection().FindOne(ctx, filter).Decode(&template); err != nil {
+		return nil, err
+	}
+	return &template, nil
+}
+
+// DeleteTemplate removes a template
+func DeleteTemplate(ctx context.Context, templateID primitive.ObjectID) error {
+	_, err := GetTemplateCollection().DeleteOne(ctx, bson.M{"_id": templateID})
+	return err
+}
@@ -0,0 +1,245 @@
+package libs
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sarwanazhar/boardsar/backend/database"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// thumbnailBucket is the GridFS bucket thumbnails are stored in
+const thumbnailBucket = "thumbnails"
+
+// Largest thumbnail, in pixels; boards are scaled down to fit and never up
+const (
+	ThumbnailWidth  = 320
+	ThumbnailHeight = 200
+)
+
+const (
+	thumbnailTimeout = 10 * time.Second
+	// maxQueuedThumbnails bounds the queue if the worker falls behind
+	maxQueuedThumbnails = 10000
+)
+
+// thumbnailQueue holds boards waiting for a new thumbnail and when each is
+// due. A save pushes its board's time back, so a burst of saves (say, a
+// realtime session) renders once it settles.
+var thumbnailQueue = struct {
+	sync.Mutex
+	due map[primitive.ObjectID]time.Time
+}{due: map[primitive.ObjectID]time.Time{}}
+
+// thumbnailWorkerRunning is set once RunThumbnailWorker has started.
+// Without a worker nothing is queued, and thumbnails are drawn when first
+// requested.
+var thumbnailWorkerRunning atomic.Bool
+
+func thumbnailFS() (*gridfs.Bucket, error) {
+	return gridfs.NewBucket(database.GetDatabase(), options.GridFSBucket().SetName(thumbnailBucket))
+}
+
+// EnqueueThumbnail schedules a new thumbnail of the board THUMBNAIL_DELAY
+// after its latest save
+func EnqueueThumbnail(boardID primitive.ObjectID) {
+	if !thumbnailWorkerRunning.Load() {
+		return
+	}
+
+	thumbnailQueue.Lock()
+	defer thumbnailQueue.Unlock()
+	if _, queued := thumbnailQueue.due[boardID]; !queued && len(thumbnailQueue.due) >= maxQueuedThumbnails {
+		slog.Warn("Thumbnail queue is full, skipping board", "board_id", boardID.Hex())
+		return
+	}
+	thumbnailQueue.due[boardID] = time.Now().Add(settings.ThumbnailDelay)
+}
+
+// QueueStaleThumbnail makes sure an out-of-date thumbnail is queued, for
+// saves that were queued on an instance that has since restarted. It
+// doesn't delay one that is already due, and reports false when there is
+// no worker to draw it.
+func QueueStaleThumbnail(boardID primitive.ObjectID) bool {
+	if !thumbnailWorkerRunning.Load() {
+		return false
+	}
+
+	thumbnailQueue.Lock()
+	defer thumbnailQueue.Unlock()
+	if _, queued := thumbnailQueue.due[boardID]; !queued && len(thumbnailQueue.due) < maxQueuedThumbnails {
+		thumbnailQueue.due[boardID] = time.Now()
+	}
+	return true
+}
+
+// RunThumbnailWorker draws queued thumbnails as they fall due until ctx is
+// done
+func RunThumbnailWorker(ctx context.Context) {
+	thumbnailWorkerRunning.Store(true)
+	defer thumbnailWorkerRunning.Store(false)
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for _, boardID := range dueThumbnails(time.Now()) {
+			if err := refreshThumbnail(ctx, boardID); err != nil {
+				slog.Warn("Failed to draw thumbnail of board", "board_id", boardID.Hex(), "error", err)
+			}
+		}
+	}
+}
+
+// dueThumbnails takes the boards whose thumbnails are due off the queue
+func dueThumbnails(now time.Time) []primitive.ObjectID {
+	thumbnailQueue.Lock()
+	defer thumbnailQueue.Unlock()
+
+	var due []primitive.ObjectID
+	for boardID, at := range thumbnailQueue.due {
+		if !at.After(now) {
+			due = append(due, boardID)
+			delete(thumbnailQueue.due, boardID)
+		}
+	}
+	return due
+}
+
+// refreshThumbnail reloads a queued board and draws it. Boards deleted in
+// the meantime are skipped.
+func refreshThumbnail(ctx context.Context, boardID primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(ctx, thumbnailTimeout)
+	defer cancel()
+
+	var board models.Board
+	err := database.GetCollection("boards").FindOne(ctx, bson.M{"_id": boardID}).Decode(&board)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil
+		}
+		return err
+	}
+	if board.Archived != nil {
+		return nil
+	}
+	_, err = GenerateBoardThumbnail(ctx, &board)
+	return err
+}
+
+// GenerateBoardThumbnail draws the board, without private notes, as a PNG
+// of at most ThumbnailWidth by ThumbnailHeight and stores it in place of
+// the previous one
+func GenerateBoardThumbnail(ctx context.Context, board *models.Board) (*models.BoardThumbnail, error) {
+	scene := buildScene(VisibleBoardData(board.BoardData, primitive.NilObjectID))
+	scale := math.Min(1, math.Min(ThumbnailWidth/scene.bounds.Width, ThumbnailHeight/scene.bounds.Height))
+
+	var image bytes.Buffer
+	err := ThumbnailPool.Do(ctx, func() error {
+		return renderPNG(&image, scene, scale)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	bucket, err := thumbnailFS()
+	if err != nil {
+		return nil, err
+	}
+	thumbnail := models.BoardThumbnail{
+		ID:         primitive.NewObjectID(),
+		Length:     int64(image.Len()),
+		UploadDate: time.Now(),
+		Metadata:   models.ThumbnailMetadata{BoardID: board.ID, Version: board.Version},
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		bucket.SetWriteDeadline(deadline)
+	}
+	err = bucket.UploadFromStreamWithID(thumbnail.ID, board.ID.Hex()+".png", &image,
+		options.GridFSUpload().SetMetadata(thumbnail.Metadata))
+	if err != nil {
+		return nil, err
+	}
+
+	// Older thumbnails go; going by _id keeps the newest when two saves
+	// are drawn at once
+	if err := deleteThumbnails(ctx, bucket, bson.M{"metadata.boardId": board.ID, "_id": bson.M{"$lt": thumbnail.ID}}); err != nil {
+		slog.Warn("Failed to delete old thumbnails of board", "board_id", board.ID.Hex(), "error", err)
+	}
+	if err := setBoardSummaryThumbnail(ctx, &thumbnail); err != nil {
+		slog.Warn("Failed to update summary of board", "board_id", board.ID.Hex(), "error", err)
+	}
+	return &thumbnail, nil
+}
+
+// FindBoardThumbnail returns the board's newest thumbnail, or
+// mongo.ErrNoDocuments if none has been drawn
+func FindBoardThumbnail(ctx context.Context, boardID primitive.ObjectID) (*models.BoardThumbnail, error) {
+	bucket, err := thumbnailFS()
+	if err != nil {
+		return nil, err
+	}
+	var thumbnail models.BoardThumbnail
+	err = bucket.GetFilesCollection().FindOne(ctx, bson.M{"metadata.boardId": boardID},
+		options.FindOne().SetSort(bson.D{{Key: "_id", Value: -1}}),
+	).Decode(&thumbnail)
+	if err != nil {
+		return nil, err
+	}
+	return &thumbnail, nil
+}
+
+// OpenBoardThumbnail streams a stored thumbnail's PNG
+func OpenBoardThumbnail(ctx context.Context, thumbnail *models.BoardThumbnail) (io.ReadCloser, error) {
+	bucket, err := thumbnailFS()
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		bucket.SetReadDeadline(deadline)
+	}
+	return bucket.OpenDownloadStream(thumbnail.ID)
+}
+
+// DeleteBoardThumbnails removes the thumbnails of a deleted board
+func DeleteBoardThumbnails(ctx context.Context, boardID primitive.ObjectID) error {
+	bucket, err := thumbnailFS()
+	if err != nil {
+		return err
+	}
+	return deleteThumbnails(ctx, bucket, bson.M{"metadata.boardId": boardID})
+}
+
+func deleteThumbnails(ctx context.Context, bucket *gridfs.Bucket, filter bson.M) error {
+	cursor, err := bucket.GetFilesCollection().Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return err
+	}
+	var files []models.BoardThumbnail
+	if err := cursor.All(ctx, &files); err != nil {
+		return err
+	}
+	for _, file := range files {
+		if err := bucket.DeleteContext(ctx, file.ID); err != nil && err != gridfs.ErrFileNotFound {
+			return err
+		}
+	}
+	return nil
+}
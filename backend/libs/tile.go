@@ -0,0 +1,195 @@
+package libs
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"math"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Tiles are TileSize pixels square. At MaxTileZoom a pixel is one board
+// unit, and each zoom level below it halves the resolution, so a tile at
+// zoom z covers TileSize << (MaxTileZoom - z) units. The grid is anchored
+// at the board origin, so tiles keep their place as the board changes.
+const (
+	TileSize    = 256
+	MaxTileZoom = 8
+)
+
+// tileReach pads a tile's region when looking for shapes to draw, for
+// strokes and frame titles drawn past the shapes' bounding boxes
+const tileReach = renderStrokeWidth + renderFrameTitle*lineHeightRatio
+
+// tileCacheBytes is how much memory rendered tiles may take altogether,
+// TILE_CACHE_BYTES
+func tileCacheBytes() int {
+	return int(settings.TileCacheBytes)
+}
+
+// TileSpan is how many board units a tile at the zoom level covers
+func TileSpan(z int) float64 {
+	return math.Ldexp(TileSize, MaxTileZoom-z)
+}
+
+// ValidTile reports whether z, x, y names a tile: a zoom level up to
+// MaxTileZoom and a position within the reach of the shape index
+func ValidTile(z, x, y int) bool {
+	if z < 0 || z > MaxTileZoom {
+		return false
+	}
+	limit := ShapeIndexBound / TileSpan(z)
+	return math.Abs(float64(x)) <= limit && math.Abs(float64(y)) <= limit
+}
+
+// RenderBoardTile draws one tile of the source's board as a PNG, without
+// private notes, or returns it from the cache if it's been drawn since the
+// board last changed
+func RenderBoardTile(ctx context.Context, source *ShapeSource, z, x, y int) ([]byte, error) {
+	board := source.Board
+	if tile := CachedBoardTile(board.ID, board.Version, z, x, y); tile != nil {
+		return tile, nil
+	}
+
+	span := TileSpan(z)
+	region := Bounds{X: float64(x) * span, Y: float64(y) * span, Width: span, Height: span}
+	entries, err := source.Search(ctx, Bounds{
+		X:      region.X - tileReach,
+		Y:      region.Y - tileReach,
+		Width:  region.Width + 2*tileReach,
+		Height: region.Height + 2*tileReach,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	scene := renderScene{bounds: region}
+	for _, entry := range entries {
+		if !IsHiddenFrom(entry.Shape, primitive.NilObjectID) {
+			scene.ops = append(scene.ops, shapeOps(entry.Shape, entry.Bounds)...)
+		}
+	}
+	var image bytes.Buffer
+	err = ThumbnailPool.Do(ctx, func() error {
+		return renderPNG(&image, scene, TileSize/span)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	tile := image.Bytes()
+	CacheBoardTile(board.ID, board.Version, z, x, y, tile)
+	return tile, nil
+}
+
+// tileCache keeps rendered tiles, least recently used first out. Each
+// board only has tiles of one version cached; tiles of a newer version
+// replace them.
+var tileCache = struct {
+	sync.Mutex
+	order  *list.List
+	boards map[primitive.ObjectID]*cachedBoardTiles
+	bytes  int
+}{
+	order:  list.New(),
+	boards: map[primitive.ObjectID]*cachedBoardTiles{},
+}
+
+type tileKey struct {
+	z, x, y int
+}
+
+type cachedBoardTiles struct {
+	version int64
+	tiles   map[tileKey]*list.Element
+}
+
+type cachedTile struct {
+	boardID primitive.ObjectID
+	key     tileKey
+	png     []byte
+}
+
+// CachedBoardTile returns the PNG of a tile of the board version if it is
+// in memory
+func CachedBoardTile(boardID primitive.ObjectID, version int64, z, x, y int) []byte {
+	tileCache.Lock()
+	defer tileCache.Unlock()
+
+	board, ok := tileCache.boards[boardID]
+	if !ok || board.version != version {
+		return nil
+	}
+	element, ok := board.tiles[tileKey{z, x, y}]
+	if !ok {
+		return nil
+	}
+	tileCache.order.MoveToFront(element)
+	return element.Value.(*cachedTile).png
+}
+
+// CacheBoardTile keeps the PNG of a tile of the board version in memory.
+// Tiles of older versions of the board are dropped; tiles of a version
+// older than the cached one aren't kept.
+func CacheBoardTile(boardID primitive.ObjectID, version int64, z, x, y int, png []byte) {
+	tileCache.Lock()
+	defer tileCache.Unlock()
+
+	limit := tileCacheBytes()
+	if len(png) > limit {
+		return
+	}
+	board, ok := tileCache.boards[boardID]
+	if ok && board.version > version {
+		return
+	}
+	if !ok || board.version < version {
+		forgetBoardTiles(boardID)
+		board = &cachedBoardTiles{version: version, tiles: map[tileKey]*list.Element{}}
+		tileCache.boards[boardID] = board
+	}
+
+	// Drawn twice at once; either will do
+	key := tileKey{z, x, y}
+	if _, ok := board.tiles[key]; ok {
+		return
+	}
+	board.tiles[key] = tileCache.order.PushFront(&cachedTile{boardID: boardID, key: key, png: png})
+	tileCache.bytes += len(png)
+	for tileCache.bytes > limit {
+		removeCachedTile(tileCache.order.Back())
+	}
+}
+
+// ForgetBoardTiles drops a board's cached tiles, such as when it is saved
+// or deleted
+func ForgetBoardTiles(boardID primitive.ObjectID) {
+	tileCache.Lock()
+	defer tileCache.Unlock()
+
+	forgetBoardTiles(boardID)
+}
+
+func forgetBoardTiles(boardID primitive.ObjectID) {
+	board, ok := tileCache.boards[boardID]
+	if !ok {
+		return
+	}
+	for _, element := range board.tiles {
+		removeCachedTile(element)
+	}
+	delete(tileCache.boards, boardID)
+}
+
+func removeCachedTile(element *list.Element) {
+	tile := tileCache.order.Remove(element).(*cachedTile)
+	tileCache.bytes -= len(tile.png)
+	if board, ok := tileCache.boards[tile.boardID]; ok {
+		delete(board.tiles, tile.key)
+		if len(board.tiles) == 0 {
+			delete(tileCache.boards, tile.boardID)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package libs
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// defaultServiceName names the backend in traces unless OTEL_SERVICE_NAME
+// says otherwise
+const defaultServiceName = "boardsar-backend"
+
+// TracingConfigured reports whether traces are exported: when an OTLP
+// endpoint is set and the SDK isn't switched off
+func TracingConfigured() bool {
+	if os.Getenv("OTEL_SDK_DISABLED") == "true" {
+		return false
+	}
+	return os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != ""
+}
+
+// ConfigureTracing exports traces over OTLP/HTTP. The exporter and sampler
+// are set up from the standard OTEL_* variables (endpoint, headers,
+// OTEL_TRACES_SAMPLER...). W3C trace context is read from incoming requests
+// either way, so IDs pass through an untraced instance. Call the returned
+// function on shutdown to flush spans still buffered.
+func ConfigureTracing(ctx context.Context) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+	if !TracingConfigured() {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+	service, err := resource.New(ctx,
+		resource.WithSchemaURL(semconv.SchemaURL),
+		resource.WithAttributes(semconv.ServiceName(defaultServiceName)),
+		resource.WithTelemetrySDK(),
+		resource.WithHost(),
+		// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES win
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(service),
+	)
+	otel.SetTracerProvider(provider)
+	slog.Info("Exporting traces over OTLP")
+	return provider.Shutdown, nil
+}
+
+// TracingMiddleware starts a server span for each request, continuing the
+// caller's trace when it sent one
+func TracingMiddleware() gin.HandlerFunc {
+	service := os.Getenv("OTEL_SERVICE_NAME")
+	if service == "" {
+		service = defaultServiceName
+	}
+	return otelgin.Middleware(service)
+}
+
+// RequestContext is the context to run a request's queries with: it
+// carries the request's span, so they show up in its trace, but not its
+// cancellation, so work started for a client that goes away still finishes
+func RequestContext(c *gin.Context) context.Context {
+	return context.WithoutCancel(c.Request.Context())
+}
+
+// DBContext is the context for a request's database calls, ending after
+// DB_TIMEOUT. Like RequestContext it carries the request's span. Reads (GET
+// and HEAD requests) also stop when the client goes away or the server
+// gives up on the request at shutdown; writes run to the end, so a save the
+// client stopped waiting for isn't left half done.
+func DBContext(c *gin.Context) (context.Context, context.CancelFunc) {
+	return DBContextWithin(c, 0)
+}
+
+// DBContextWithin is DBContext for work that needs longer than DB_TIMEOUT,
+// such as storing an upload: it ends after timeout or DB_TIMEOUT, whichever
+// is longer
+func DBContextWithin(c *gin.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	parent := c.Request.Context()
+	if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+		parent = context.WithoutCancel(parent)
+	}
+	return context.WithTimeout(parent, max(timeout, Settings().DBTimeout))
+}
+
+// traceID returns the ID of the trace ctx is part of, or ""
+func traceID(ctx context.Context) string {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if !spanContext.HasTraceID() {
+		return ""
+	}
+	return spanContext.TraceID().String()
+}
@@ -0,0 +1,377 @@
+package libs
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sarwanazhar/boardsar/backend/database"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	twoFactorCollection          = "two_factor"
+	twoFactorChallengeCollection = "two_factor_challenges"
+)
+
+const (
+	// TOTP as authenticator apps expect it: 6 digits every 30 seconds,
+	// HMAC-SHA1 (RFC 6238). Codes of the step before and after are
+	// accepted too, for clocks that drift.
+	totpPeriod = 30
+	totpDigits = 6
+	totpSkew   = 1
+	// twoFactorChallengeTTL is how long a sign-in waits for its code
+	twoFactorChallengeTTL = 5 * time.Minute
+	// maxTwoFactorAttempts is how many codes a sign-in may try
+	maxTwoFactorAttempts = 5
+	// recoveryCodeCount is how many recovery codes each set has
+	recoveryCodeCount = 10
+)
+
+// Two-factor errors. The text is safe to return to clients.
+var (
+	ErrTwoFactorEnabled          = errors.New("Two-factor authentication is already on")
+	ErrTwoFactorNotEnabled       = errors.New("Two-factor authentication is off")
+	ErrTwoFactorNotSetUp         = errors.New("Set up two-factor authentication first")
+	ErrInvalidTwoFactorCode      = errors.New("Invalid code")
+	ErrInvalidTwoFactorChallenge = errors.New("Sign-in expired or had too many attempts, please sign in again")
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func GetTwoFactorCollection() *mongo.Collection {
+	return database.GetCollection(twoFactorCollection)
+}
+
+func GetTwoFactorChallengeCollection() *mongo.Collection {
+	return database.GetCollection(twoFactorChallengeCollection)
+}
+
+// TOTPIssuer names the service in authenticator apps, TOTP_ISSUER
+func TOTPIssuer() string {
+	return settings.TOTPIssuer
+}
+
+// TwoFactorChallengeTTL is how long a sign-in waits for its code
+func TwoFactorChallengeTTL() time.Duration {
+	return twoFactorChallengeTTL
+}
+
+// FindTwoFactor loads the user's second factor, or nil when they never set
+// one up
+func FindTwoFactor(ctx context.Context, userID primitive.ObjectID) (*models.TwoFactor, error) {
+	var twoFactor models.TwoFactor
+	err := GetTwoFactorCollection().FindOne(ctx, bson.M{"_id": userID}).Decode(&twoFactor)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &twoFactor, nil
+}
+
+// TwoFactorEnabled reports whether signing in as the user takes a TOTP
+// code
+func TwoFactorEnabled(ctx context.Context, userID primitive.ObjectID) (bool, error) {
+	twoFactor, err := FindTwoFactor(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return twoFactor != nil && twoFactor.EnabledAt != nil, nil
+}
+
+// SetUpTwoFactor hands out a new TOTP secret for the user, and the
+// otpauth:// URI authenticator apps read from a QR code. Two-factor stays
+// off until EnableTwoFactor gets a code from it; setting up again replaces
+// the secret.
+func SetUpTwoFactor(ctx context.Context, user *models.User) (string, string, error) {
+	raw := make([]byte, 20)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", fmt.Errorf("error generating TOTP secret: %w", err)
+	}
+	secret := totpEncoding.EncodeToString(raw)
+
+	result, err := GetTwoFactorCollection().UpdateOne(ctx,
+		bson.M{"_id": user.ID, "enabledAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"pendingSecret": secret}},
+		options.Update().SetUpsert(true),
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		// Its document exists, so it didn't match: two-factor is on
+		return "", "", ErrTwoFactorEnabled
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("error storing TOTP secret: %w", err)
+	}
+	if result.MatchedCount == 0 && result.UpsertedCount == 0 {
+		return "", "", ErrTwoFactorEnabled
+	}
+	return secret, totpURI(secret, user.Email), nil
+}
+
+// totpURI is the provisioning URI of the secret for the account
+func totpURI(secret, account string) string {
+	issuer := TOTPIssuer()
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", strconv.Itoa(totpDigits))
+	query.Set("period", strconv.Itoa(totpPeriod))
+	return "otpauth://totp/" + url.PathEscape(issuer+":"+account) + "?" + query.Encode()
+}
+
+// EnableTwoFactor turns two-factor on once code checks out against the
+// secret handed out by setup, and returns the recovery codes to show the
+// user once
+func EnableTwoFactor(ctx context.Context, userID primitive.ObjectID, code string) ([]string, error) {
+	twoFactor, err := FindTwoFactor(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if twoFactor != nil && twoFactor.EnabledAt != nil {
+		return nil, ErrTwoFactorEnabled
+	}
+	if twoFactor == nil || twoFactor.PendingSecret == "" {
+		return nil, ErrTwoFactorNotSetUp
+	}
+	step, ok := checkTOTP(twoFactor.PendingSecret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	codes, hashed, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	result, err := GetTwoFactorCollection().UpdateOne(ctx,
+		bson.M{"_id": userID, "pendingSecret": twoFactor.PendingSecret, "enabledAt": bson.M{"$exists": false}},
+		bson.M{
+			"$set": bson.M{
+				"secret":        twoFactor.PendingSecret,
+				"enabledAt":     time.Now(),
+				"lastStep":      step,
+				"recoveryCodes": hashed,
+			},
+			"$unset": bson.M{"pendingSecret": ""},
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error enabling two-factor: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		// Set up again, or enabled, meanwhile
+		return nil, ErrInvalidTwoFactorCode
+	}
+	return codes, nil
+}
+
+// DisableTwoFactor turns the user's two-factor off, dropping its secret and
+// recovery codes
+func DisableTwoFactor(ctx context.Context, userID primitive.ObjectID) error {
+	_, err := GetTwoFactorCollection().DeleteOne(ctx, bson.M{"_id": userID})
+	return err
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes, used or not,
+// and returns the new ones
+func RegenerateRecoveryCodes(ctx context.Context, userID primitive.ObjectID) ([]string, error) {
+	codes, hashed, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	result, err := GetTwoFactorCollection().UpdateOne(ctx,
+		bson.M{"_id": userID, "enabledAt": bson.M{"$exists": true}},
+		bson.M{"$set": bson.M{"recoveryCodes": hashed}},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error storing recovery codes: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return nil, ErrTwoFactorNotEnabled
+	}
+	return codes, nil
+}
+
+// CheckTwoFactorCode checks a TOTP code, or one of the recovery codes,
+// against the user's second factor, and reports whether it was a recovery
+// code. Each code works once: TOTP codes up to the step of the last one
+// accepted, and recovery codes once used, are refused.
+func CheckTwoFactorCode(ctx context.Context, userID primitive.ObjectID, code string) (bool, error) {
+	twoFactor, err := FindTwoFactor(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	if twoFactor == nil || twoFactor.EnabledAt == nil {
+		return false, ErrTwoFactorNotEnabled
+	}
+
+	if step, ok := checkTOTP(twoFactor.Secret, code, time.Now()); ok {
+		result, err := GetTwoFactorCollection().UpdateOne(ctx,
+			bson.M{"_id": userID, "lastStep": bson.M{"$lt": step}},
+			bson.M{"$set": bson.M{"lastStep": step}},
+		)
+		if err != nil {
+			return false, fmt.Errorf("error recording TOTP code: %w", err)
+		}
+		if result.MatchedCount == 0 {
+			return false, ErrInvalidTwoFactorCode
+		}
+		return false, nil
+	}
+
+	hash := hashToken(normalizeRecoveryCode(code))
+	result, err := GetTwoFactorCollection().UpdateOne(ctx,
+		bson.M{"_id": userID, "recoveryCodes": bson.M{"$elemMatch": bson.M{"hash": hash, "usedAt": bson.M{"$exists": false}}}},
+		bson.M{"$set": bson.M{"recoveryCodes.$.usedAt": time.Now()}},
+	)
+	if err != nil {
+		return false, fmt.Errorf("error using recovery code: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return false, ErrInvalidTwoFactorCode
+	}
+	return true, nil
+}
+
+// StartTwoFactorChallenge holds a sign-in that checked out until its TOTP
+// code comes, and returns the token to send it with
+func StartTwoFactorChallenge(ctx context.Context, userID primitive.ObjectID, details map[string]interface{}) (string, error) {
+	token, tokenHash, err := newSecretToken()
+	if err != nil {
+		return "", fmt.Errorf("error generating two-factor token: %w", err)
+	}
+
+	now := time.Now()
+	_, err = GetTwoFactorChallengeCollection().InsertOne(ctx, models.TwoFactorChallenge{
+		ID:        primitive.NewObjectID(),
+		UserID:    userID,
+		TokenHash: tokenHash,
+		Details:   details,
+		CreatedAt: now,
+		ExpiresAt: now.Add(twoFactorChallengeTTL),
+	})
+	if err != nil {
+		return "", fmt.Errorf("error storing two-factor token: %w", err)
+	}
+	return token, nil
+}
+
+// CompleteTwoFactorChallenge checks the code sent for a held sign-in and,
+// once it checks out, ends the challenge and returns it with whether the
+// code was a recovery code. Wrong codes count against the challenge's
+// attempts; it stops working after maxTwoFactorAttempts.
+func CompleteTwoFactorChallenge(ctx context.Context, token, code string) (*models.TwoFactorChallenge, bool, error) {
+	var challenge models.TwoFactorChallenge
+	err := GetTwoFactorChallengeCollection().FindOneAndUpdate(ctx,
+		bson.M{
+			"tokenHash": hashToken(token),
+			"attempts":  bson.M{"$lt": maxTwoFactorAttempts},
+			"expiresAt": bson.M{"$gt": time.Now()},
+		},
+		bson.M{"$inc": bson.M{"attempts": 1}},
+	).Decode(&challenge)
+	if err == mongo.ErrNoDocuments {
+		return nil, false, ErrInvalidTwoFactorChallenge
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("error checking two-factor token: %w", err)
+	}
+
+	recovery, err := CheckTwoFactorCode(ctx, challenge.UserID, code)
+	if err == ErrTwoFactorNotEnabled {
+		// Turned off meanwhile: the password was enough
+		err = nil
+	}
+	if err != nil {
+		return &challenge, false, err
+	}
+
+	if _, err := GetTwoFactorChallengeCollection().DeleteOne(ctx, bson.M{"_id": challenge.ID}); err != nil {
+		return nil, false, fmt.Errorf("error ending two-factor challenge: %w", err)
+	}
+	return &challenge, recovery, nil
+}
+
+// checkTOTP checks a code against the secret at now, allowing totpSkew
+// steps either way, and returns the step it was for
+func checkTOTP(secret, code string, now time.Time) (int64, bool) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return 0, false
+	}
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if len(code) != totpDigits {
+		return 0, false
+	}
+
+	current := now.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// TOTPCode is the code an authenticator app shows for the secret at a time
+func TOTPCode(secret string, at time.Time) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+	return totpCode(key, at.Unix()/totpPeriod), nil
+}
+
+// totpCode is the code of a time step (RFC 4226 dynamic truncation)
+func totpCode(key []byte, step int64) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
+
+// newRecoveryCodes returns a set of recovery codes, as shown to the user
+// (xxxx-xxxx-xxxx-xxxx) and as stored
+func newRecoveryCodes() ([]string, []models.RecoveryCode, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashed := make([]models.RecoveryCode, recoveryCodeCount)
+	for i := range codes {
+		raw := make([]byte, 10)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, nil, fmt.Errorf("error generating recovery codes: %w", err)
+		}
+		code := strings.ToLower(totpEncoding.EncodeToString(raw))
+		codes[i] = code[0:4] + "-" + code[4:8] + "-" + code[8:12] + "-" + code[12:16]
+		hashed[i] = models.RecoveryCode{Hash: hashToken(code)}
+	}
+	return codes, hashed, nil
+}
+
+// normalizeRecoveryCode lets recovery codes be typed in any case, with or
+// without their dashes
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
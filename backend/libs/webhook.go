@@ -0,0 +1,457 @@
+package libs
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/database"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	webhookCollection         = "webhooks"
+	webhookDeliveryCollection = "webhook_deliveries"
+)
+
+// MaxWebhooks is how many webhooks a user can have
+const MaxWebhooks = 20
+
+const (
+	// webhookTimeout bounds one delivery attempt
+	webhookTimeout = 10 * time.Second
+	// webhookLease is how long a claimed delivery is left to the instance
+	// sending it before another may retry it
+	webhookLease = 3 * webhookTimeout
+	// Failed attempts are retried WEBHOOK_RETRY_DELAY after the first,
+	// doubling each time up to maxWebhookRetryDelay, until
+	// maxWebhookAttempts have been made
+	maxWebhookRetryDelay = time.Hour
+	maxWebhookAttempts   = 8
+	// webhookRetention is how long deliveries are kept for inspection
+	webhookRetention = 7 * 24 * time.Hour
+	// webhookSenders is how many deliveries an instance sends at once
+	webhookSenders = 4
+)
+
+var (
+	ErrWebhookNotFound   = errors.New("Webhook not found")
+	ErrInvalidWebhookURL = errors.New("Webhook URL must be an https URL")
+	ErrWebhookAddress    = errors.New("Webhook URL must not point to a private network")
+	ErrWebhookHost       = errors.New("Webhook URL's host could not be found")
+	ErrTooManyWebhooks   = fmt.Errorf("You can have at most %d webhooks", MaxWebhooks)
+)
+
+// webhookClient sends deliveries. Like importImageClient it only dials
+// public addresses, so a webhook can't make the server reach into its own
+// network. Redirects aren't followed, so a receiver can't bounce signed
+// events elsewhere.
+var webhookClient = &http.Client{
+	Timeout:   webhookTimeout,
+	Transport: publicTransport(webhookTimeout, ErrWebhookAddress, PrivateHooksAllowed),
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+func GetWebhookCollection() *mongo.Collection {
+	return database.GetCollection(webhookCollection)
+}
+
+func GetWebhookDeliveryCollection() *mongo.Collection {
+	return database.GetCollection(webhookDeliveryCollection)
+}
+
+// ValidateWebhookURL checks a webhook's URL. Plain http is only allowed
+// outside release mode, for local receivers, and hosts on private networks
+// only with PRIVATE_HOOKS.
+func ValidateWebhookURL(ctx context.Context, raw string) error {
+	parsed, err := url.Parse(raw)
+	if err != nil || parsed.Host == "" || parsed.User != nil {
+		return ErrInvalidWebhookURL
+	}
+	if parsed.Scheme != "https" && (parsed.Scheme != "http" || gin.Mode() == gin.ReleaseMode) {
+		return ErrInvalidWebhookURL
+	}
+	if PrivateHooksAllowed() {
+		return nil
+	}
+	return checkPublicHost(ctx, parsed.Hostname(), ErrWebhookAddress, ErrWebhookHost)
+}
+
+// PrivateHooksAllowed reports whether webhooks and push endpoints may be on
+// private networks. It is meant for local development only and is always
+// off in release mode.
+func PrivateHooksAllowed() bool {
+	return settings.PrivateHooks && gin.Mode() != gin.ReleaseMode
+}
+
+// newWebhookSecret returns a random signing secret
+func newWebhookSecret() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("error generating webhook secret: %w", err)
+	}
+	return "whsec_" + base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// CreateWebhook stores a new webhook for the user with a fresh secret,
+// which is returned this once
+func CreateWebhook(ctx context.Context, webhook *models.Webhook) (*models.Webhook, error) {
+	count, err := GetWebhookCollection().CountDocuments(ctx, bson.M{"userId": webhook.UserID})
+	if err != nil {
+		return nil, fmt.Errorf("error counting webhooks: %w", err)
+	}
+	if count >= MaxWebhooks {
+		return nil, ErrTooManyWebhooks
+	}
+
+	webhook.Secret, err = newWebhookSecret()
+	if err != nil {
+		return nil, err
+	}
+	webhook.ID = primitive.NewObjectID()
+	webhook.CreatedAt = time.Now()
+	webhook.UpdatedAt = webhook.CreatedAt
+	if _, err := GetWebhookCollection().InsertOne(ctx, webhook); err != nil {
+		return nil, fmt.Errorf("error saving webhook: %w", err)
+	}
+	return webhook, nil
+}
+
+// ListWebhooks returns the user's webhooks, oldest first, without their
+// secrets
+func ListWebhooks(ctx context.Context, userID primitive.ObjectID) ([]models.Webhook, error) {
+	cursor, err := GetWebhookCollection().Find(ctx, bson.M{"userId": userID}, options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: 1}}).
+		SetProjection(bson.M{"secret": 0}))
+	if err != nil {
+		return nil, fmt.Errorf("error listing webhooks: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	webhooks := []models.Webhook{}
+	if err := cursor.All(ctx, &webhooks); err != nil {
+		return nil, fmt.Errorf("error decoding webhooks: %w", err)
+	}
+	return webhooks, nil
+}
+
+// FindWebhook loads one of the user's webhooks, without its secret
+func FindWebhook(ctx context.Context, userID, webhookID primitive.ObjectID) (*models.Webhook, error) {
+	var webhook models.Webhook
+	err := GetWebhookCollection().FindOne(ctx, bson.M{"_id": webhookID, "userId": userID},
+		options.FindOne().SetProjection(bson.M{"secret": 0}),
+	).Decode(&webhook)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrWebhookNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error loading webhook: %w", err)
+	}
+	return &webhook, nil
+}
+
+// UpdateWebhook changes one of the user's webhooks. With rotateSecret it
+// also gets a new secret, which is returned this once; the old one stops
+// signing at once.
+func UpdateWebhook(ctx context.Context, userID, webhookID primitive.ObjectID, update bson.M, rotateSecret bool) (*models.Webhook, error) {
+	if rotateSecret {
+		secret, err := newWebhookSecret()
+		if err != nil {
+			return nil, err
+		}
+		update["secret"] = secret
+	}
+	update["updatedAt"] = time.Now()
+
+	var webhook models.Webhook
+	err := GetWebhookCollection().FindOneAndUpdate(ctx,
+		bson.M{"_id": webhookID, "userId": userID},
+		bson.M{"$set": update},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&webhook)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrWebhookNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error updating webhook: %w", err)
+	}
+	if !rotateSecret {
+		webhook.Secret = ""
+	}
+	return &webhook, nil
+}
+
+// DeleteWebhook removes one of the user's webhooks and its deliveries,
+// including any still pending
+func DeleteWebhook(ctx context.Context, userID, webhookID primitive.ObjectID) error {
+	result, err := GetWebhookCollection().DeleteOne(ctx, bson.M{"_id": webhookID, "userId": userID})
+	if err != nil {
+		return fmt.Errorf("error deleting webhook: %w", err)
+	}
+	if result.DeletedCount == 0 {
+		return ErrWebhookNotFound
+	}
+	if _, err := GetWebhookDeliveryCollection().DeleteMany(ctx, bson.M{"webhookId": webhookID}); err != nil {
+		slog.Warn("Failed to delete deliveries of webhook", "webhook_id", webhookID.Hex(), "error", err)
+	}
+	return nil
+}
+
+// ListWebhookDeliveries returns a webhook's most recent deliveries, newest
+// first
+func ListWebhookDeliveries(ctx context.Context, webhookID primitive.ObjectID, limit int64) ([]models.WebhookDelivery, error) {
+	cursor, err := GetWebhookDeliveryCollection().Find(ctx, bson.M{"webhookId": webhookID}, options.Find().
+		SetSort(bson.D{{Key: "_id", Value: -1}}).
+		SetLimit(limit))
+	if err != nil {
+		return nil, fmt.Errorf("error listing webhook deliveries: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	deliveries := []models.WebhookDelivery{}
+	if err := cursor.All(ctx, &deliveries); err != nil {
+		return nil, fmt.Errorf("error decoding webhook deliveries: %w", err)
+	}
+	return deliveries, nil
+}
+
+// QueueWebhookEvent queues a delivery of the event to each active webhook
+// of the board's owner that takes it. It returns at once; queueing happens
+// in the background and failures are logged.
+func QueueWebhookEvent(board *models.Board, eventType string, userID primitive.ObjectID, at time.Time) {
+	ownerID := board.OwnerID
+	payload := models.WebhookPayload{
+		Type:      eventType,
+		BoardID:   board.ID,
+		BoardName: board.Name,
+		UserID:    userID,
+		Version:   board.Version,
+		Time:      at,
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), Settings().DBTimeout)
+		defer cancel()
+
+		webhooks, err := ListWebhooks(ctx, ownerID)
+		if err != nil {
+			slog.Warn("Failed to load webhooks", "owner_id", ownerID.Hex(), "error", err)
+			return
+		}
+
+		now := time.Now()
+		deliveries := []interface{}{}
+		for i := range webhooks {
+			if !wantsWebhookEvent(&webhooks[i], payload) {
+				continue
+			}
+			delivery := models.WebhookDelivery{
+				ID:            primitive.NewObjectID(),
+				WebhookID:     webhooks[i].ID,
+				Payload:       payload,
+				Status:        models.WebhookDeliveryPending,
+				NextAttemptAt: &now,
+				CreatedAt:     now,
+				ExpiresAt:     now.Add(webhookRetention),
+			}
+			delivery.Payload.ID = delivery.ID.Hex()
+			deliveries = append(deliveries, delivery)
+		}
+		if len(deliveries) == 0 {
+			return
+		}
+		if _, err := GetWebhookDeliveryCollection().InsertMany(ctx, deliveries); err != nil {
+			slog.Warn("Failed to queue webhooks of board", "event", eventType, "board_id", payload.BoardID.Hex(), "error", err)
+		}
+	}()
+}
+
+// wantsWebhookEvent reports whether a webhook takes an event
+func wantsWebhookEvent(webhook *models.Webhook, payload models.WebhookPayload) bool {
+	if !webhook.Active {
+		return false
+	}
+	if len(webhook.Events) > 0 && !slices.Contains(webhook.Events, payload.Type) {
+		return false
+	}
+	return len(webhook.BoardIDs) == 0 || slices.Contains(webhook.BoardIDs, payload.BoardID)
+}
+
+// RunWebhookWorker sends queued deliveries as they fall due until ctx is
+// done. Instances share the queue: each claims a delivery before sending
+// it, so every attempt is made once.
+func RunWebhookWorker(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		var senders sync.WaitGroup
+		for i := 0; i < webhookSenders; i++ {
+			senders.Add(1)
+			go func() {
+				defer senders.Done()
+				for ctx.Err() == nil {
+					delivery, err := claimWebhookDelivery(ctx)
+					if err != nil {
+						if err != mongo.ErrNoDocuments {
+							slog.Warn("Failed to claim a webhook delivery", "error", err)
+						}
+						return
+					}
+					sendWebhookDelivery(ctx, delivery)
+				}
+			}()
+		}
+		senders.Wait()
+	}
+}
+
+// claimWebhookDelivery takes the next due delivery, leaving it to this
+// instance for webhookLease
+func claimWebhookDelivery(ctx context.Context) (*models.WebhookDelivery, error) {
+	now := time.Now()
+	var delivery models.WebhookDelivery
+	err := GetWebhookDeliveryCollection().FindOneAndUpdate(ctx,
+		bson.M{"status": models.WebhookDeliveryPending, "nextAttemptAt": bson.M{"$lte": now}},
+		bson.M{"$set": bson.M{"nextAttemptAt": now.Add(webhookLease)}},
+		options.FindOneAndUpdate().SetSort(bson.D{{Key: "nextAttemptAt", Value: 1}}).SetReturnDocument(options.After),
+	).Decode(&delivery)
+	if err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+// sendWebhookDelivery makes one attempt at a claimed delivery and records
+// how it went: delivered, retried later with backoff, or failed for good
+func sendWebhookDelivery(ctx context.Context, delivery *models.WebhookDelivery) {
+	ctx, cancel := context.WithTimeout(ctx, webhookLease)
+	defer cancel()
+
+	var webhook models.Webhook
+	err := GetWebhookCollection().FindOne(ctx, bson.M{"_id": delivery.WebhookID}).Decode(&webhook)
+	if err == mongo.ErrNoDocuments {
+		// Deleted since; its deliveries are going too
+		GetWebhookDeliveryCollection().DeleteOne(ctx, bson.M{"_id": delivery.ID})
+		return
+	}
+	if err != nil {
+		slog.Warn("Failed to load webhook", "webhook_id", delivery.WebhookID.Hex(), "error", err)
+		return
+	}
+
+	attempts := delivery.Attempts + 1
+	update := bson.M{"attempts": attempts}
+	unset := bson.M{}
+	if !webhook.Active {
+		update["status"] = models.WebhookDeliveryFailed
+		update["lastError"] = "Webhook is disabled"
+		unset["nextAttemptAt"] = ""
+	} else {
+		status, err := postWebhook(ctx, &webhook, delivery)
+		if status != 0 {
+			update["lastStatus"] = status
+		}
+		switch {
+		case err == nil:
+			update["status"] = models.WebhookDeliveryDelivered
+			update["deliveredAt"] = time.Now()
+			unset["nextAttemptAt"] = ""
+			unset["lastError"] = ""
+		case attempts >= maxWebhookAttempts:
+			update["status"] = models.WebhookDeliveryFailed
+			update["lastError"] = err.Error()
+			unset["nextAttemptAt"] = ""
+		default:
+			update["lastError"] = err.Error()
+			update["nextAttemptAt"] = time.Now().Add(webhookRetryDelay(attempts))
+		}
+	}
+
+	changes := bson.M{"$set": update}
+	if len(unset) > 0 {
+		changes["$unset"] = unset
+	}
+	if _, err := GetWebhookDeliveryCollection().UpdateOne(ctx, bson.M{"_id": delivery.ID}, changes); err != nil {
+		slog.Warn("Failed to record webhook delivery", "delivery_id", delivery.ID.Hex(), "error", err)
+	}
+}
+
+// postWebhook posts a delivery's payload signed with the webhook's secret.
+// It returns the receiver's status, if it answered, and an error unless
+// that was a 2xx.
+func postWebhook(ctx context.Context, webhook *models.Webhook, delivery *models.WebhookDelivery) (int, error) {
+	body, err := json.Marshal(delivery.Payload)
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "BoardSar-Webhooks/1.0")
+	req.Header.Set("X-BoardSar-Event", delivery.Payload.Type)
+	req.Header.Set("X-BoardSar-Delivery", delivery.Payload.ID)
+	req.Header.Set("X-BoardSar-Signature", "t="+timestamp+",v1="+signWebhook(webhook.Secret, timestamp, body))
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("error posting event: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("receiver returned %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// signWebhook is the hex HMAC-SHA256, keyed with the secret, of the
+// timestamp and body joined by a dot. Signing the timestamp lets receivers
+// turn away replays of old deliveries.
+func signWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookRetryDelay is how long to wait after a delivery's nth failed
+// attempt
+func webhookRetryDelay(attempts int) time.Duration {
+	delay := settings.WebhookRetryDelay
+	for i := 1; i < attempts && delay < maxWebhookRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxWebhookRetryDelay)
+}
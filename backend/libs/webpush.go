@@ -0,0 +1,281 @@
+package libs
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sarwanazhar/boardsar/backend/models"
+)
+
+// Web Push (RFC 8030) with VAPID (RFC 8292) and aes128gcm payload
+// encryption (RFC 8188, RFC 8291)
+
+const (
+	// webPushRecordSize is the single record a payload is encrypted into
+	webPushRecordSize = 4096
+	// MaxWebPushPayload is the largest payload that fits in that record
+	// with its tag and padding delimiter
+	MaxWebPushPayload = webPushRecordSize - 16 - 1
+	webPushTTL        = 24 * time.Hour
+	webPushTimeout    = 10 * time.Second
+	vapidTokenTTL     = 12 * time.Hour
+)
+
+var (
+	ErrWebPushNotConfigured = errors.New("Web push is not configured")
+	ErrPushSubscriptionGone = errors.New("Push subscription has expired")
+	ErrInvalidPushEndpoint  = errors.New("endpoint must be an https URL")
+	ErrPushEndpointAddress  = errors.New("endpoint must not point to a private network")
+	ErrPushEndpointHost     = errors.New("endpoint's host could not be found")
+	ErrInvalidPushKeys      = errors.New("keys must hold the browser's p256dh public key and 16-byte auth secret")
+)
+
+// webPushClient posts to push services. Like importImageClient it only
+// dials public addresses, so a subscription can't make the server reach
+// into its own network.
+var webPushClient = &http.Client{
+	Timeout:   webPushTimeout,
+	Transport: publicTransport(webPushTimeout, ErrPushEndpointAddress, PrivateHooksAllowed),
+}
+
+// vapidKey returns the server's VAPID signing key from VAPID_PRIVATE_KEY
+// (the base64url P-256 private scalar, as web-push tools generate it)
+func vapidKey() (*ecdsa.PrivateKey, error) {
+	raw := settings.VAPIDPrivateKey
+	if raw == "" {
+		return nil, ErrWebPushNotConfigured
+	}
+	scalar, err := decodeBase64URL(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAPID_PRIVATE_KEY: %w", err)
+	}
+	key, err := ecdh.P256().NewPrivateKey(scalar)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAPID_PRIVATE_KEY: %w", err)
+	}
+	point := key.PublicKey().Bytes()
+	return &ecdsa.PrivateKey{
+		PublicKey: ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(point[1:33]),
+			Y:     new(big.Int).SetBytes(point[33:]),
+		},
+		D: new(big.Int).SetBytes(scalar),
+	}, nil
+}
+
+// VAPIDPublicKey returns the base64url public key browsers subscribe with
+// (the applicationServerKey), or ErrWebPushNotConfigured
+func VAPIDPublicKey() (string, error) {
+	key, err := vapidKey()
+	if err != nil {
+		return "", err
+	}
+	public, err := key.PublicKey.ECDH()
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(public.Bytes()), nil
+}
+
+// WebPushConfigured reports whether VAPID_PRIVATE_KEY is set
+func WebPushConfigured() bool {
+	return settings.VAPIDPrivateKey != ""
+}
+
+// vapidSubject is the contact push services use for the sender
+func vapidSubject() string {
+	return cmp.Or(settings.VAPIDSubject, FrontendURL())
+}
+
+// ValidatePushEndpoint checks a subscription endpoint. Push services are
+// always https and public; plain http is allowed outside release mode for
+// local testing, and private hosts only with PRIVATE_HOOKS.
+func ValidatePushEndpoint(ctx context.Context, endpoint string) error {
+	parsed, err := url.Parse(endpoint)
+	if err != nil || parsed.Host == "" || parsed.User != nil {
+		return ErrInvalidPushEndpoint
+	}
+	if parsed.Scheme != "https" && (parsed.Scheme != "http" || gin.Mode() == gin.ReleaseMode) {
+		return ErrInvalidPushEndpoint
+	}
+	if PrivateHooksAllowed() {
+		return nil
+	}
+	return checkPublicHost(ctx, parsed.Hostname(), ErrPushEndpointAddress, ErrPushEndpointHost)
+}
+
+// ValidatePushKeys checks a subscription's keys
+func ValidatePushKeys(keys models.PushSubscriptionKeys) error {
+	public, err := decodeBase64URL(keys.P256dh)
+	if err != nil {
+		return ErrInvalidPushKeys
+	}
+	if _, err := ecdh.P256().NewPublicKey(public); err != nil {
+		return ErrInvalidPushKeys
+	}
+	if secret, err := decodeBase64URL(keys.Auth); err != nil || len(secret) != 16 {
+		return ErrInvalidPushKeys
+	}
+	return nil
+}
+
+// sendWebPush encrypts payload for the subscription and posts it to its
+// push service. It returns ErrPushSubscriptionGone when the service says
+// the subscription no longer exists.
+func sendWebPush(ctx context.Context, subscription *models.PushSubscription, payload []byte) error {
+	key, err := vapidKey()
+	if err != nil {
+		return err
+	}
+	if len(payload) > MaxWebPushPayload {
+		return fmt.Errorf("push payload is %d bytes, more than %d", len(payload), MaxWebPushPayload)
+	}
+	if err := ValidatePushEndpoint(ctx, subscription.Endpoint); err != nil {
+		return err
+	}
+
+	body, err := encryptWebPush(subscription, payload)
+	if err != nil {
+		return err
+	}
+	authorization, err := vapidAuthorization(key, subscription.Endpoint)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", authorization)
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("TTL", strconv.Itoa(int(webPushTTL.Seconds())))
+	req.Header.Set("Urgency", "normal")
+
+	resp, err := webPushClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending push: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return ErrPushSubscriptionGone
+	case resp.StatusCode >= 300:
+		return fmt.Errorf("push service answered %s", resp.Status)
+	}
+	return nil
+}
+
+// vapidAuthorization signs a VAPID token for the endpoint's push service
+func vapidAuthorization(key *ecdsa.PrivateKey, endpoint string) (string, error) {
+	parsed, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"aud": parsed.Scheme + "://" + parsed.Host,
+		"exp": time.Now().Add(vapidTokenTTL).Unix(),
+		"sub": vapidSubject(),
+	}).SignedString(key)
+	if err != nil {
+		return "", err
+	}
+	public, err := key.PublicKey.ECDH()
+	if err != nil {
+		return "", err
+	}
+	return "vapid t=" + token + ", k=" + base64.RawURLEncoding.EncodeToString(public.Bytes()), nil
+}
+
+// encryptWebPush encrypts payload for the browser as one aes128gcm record,
+// keyed by ECDH between a fresh key and the browser's key, mixed with its
+// auth secret
+func encryptWebPush(subscription *models.PushSubscription, payload []byte) ([]byte, error) {
+	userPublicBytes, err := decodeBase64URL(subscription.P256dh)
+	if err != nil {
+		return nil, ErrInvalidPushKeys
+	}
+	userPublic, err := ecdh.P256().NewPublicKey(userPublicBytes)
+	if err != nil {
+		return nil, ErrInvalidPushKeys
+	}
+	authSecret, err := decodeBase64URL(subscription.Auth)
+	if err != nil {
+		return nil, ErrInvalidPushKeys
+	}
+
+	serverKey, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	sharedSecret, err := serverKey.ECDH(userPublic)
+	if err != nil {
+		return nil, err
+	}
+	serverPublicBytes := serverKey.PublicKey().Bytes()
+
+	// RFC 8291 section 3.4
+	keyInfo := "WebPush: info\x00" + string(userPublicBytes) + string(serverPublicBytes)
+	ikm, err := hkdf.Key(sha256.New, sharedSecret, authSecret, keyInfo, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	prk, err := hkdf.Extract(sha256.New, ikm, salt)
+	if err != nil {
+		return nil, err
+	}
+	contentKey, err := hkdf.Expand(sha256.New, prk, "Content-Encoding: aes128gcm\x00", 16)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := hkdf.Expand(sha256.New, prk, "Content-Encoding: nonce\x00", 12)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(contentKey)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	// 0x02 marks the last (and only) record
+	plaintext := append(append([]byte(nil), payload...), 0x02)
+
+	// Header: salt, record size, key ID length, key ID (our public key)
+	body := append([]byte(nil), salt...)
+	body = binary.BigEndian.AppendUint32(body, webPushRecordSize)
+	body = append(body, byte(len(serverPublicBytes)))
+	body = append(body, serverPublicBytes...)
+	return gcm.Seal(body, nonce, plaintext, nil), nil
+}
@@ -0,0 +1,139 @@
+package libs
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sarwanazhar/boardsar/backend/config"
+	"github.com/sarwanazhar/boardsar/backend/models"
+)
+
+// ErrWorkerPoolFull is returned when a pool's queue is full; the request
+// should be retried later
+var ErrWorkerPoolFull = errors.New("the server is busy; please try again shortly")
+
+// WorkerPool runs expensive work, such as rendering or converting boards,
+// at most Limit tasks at a time so it can't starve the rest of the API.
+// Tasks beyond that wait in a bounded queue.
+type WorkerPool struct {
+	name         string
+	defaultLimit int
+	ownTimeout   bool // Has its own job timeout rather than WORKER_JOB_TIMEOUT
+
+	// Sized from the configuration on first use
+	sizeOnce  sync.Once
+	slots     chan struct{}
+	maxQueued int64
+
+	running   atomic.Int64
+	queued    atomic.Int64
+	completed atomic.Int64
+	rejected  atomic.Int64
+	deferred  atomic.Int64
+}
+
+// Pools of the expensive endpoints. WORKER_LIMIT_<POOL> and
+// WORKER_QUEUE_<POOL> (EXPORT, IMPORT, AI, THUMBNAIL, MAINTENANCE) size
+// them.
+var (
+	ExportPool    = newWorkerPool(models.JobKindExport, runtime.GOMAXPROCS(0))
+	ImportPool    = newWorkerPool(models.JobKindImport, runtime.GOMAXPROCS(0))
+	AIPool        = newWorkerPool(models.JobKindAI, 4) // Waits on the provider, not the CPU
+	ThumbnailPool = newWorkerPool(models.JobKindThumbnail, runtime.GOMAXPROCS(0))
+	// Database maintenance, one operation at a time
+	MaintenancePool = &WorkerPool{name: models.JobKindMaintenance, defaultLimit: 1, ownTimeout: true}
+)
+
+func newWorkerPool(name string, defaultLimit int) *WorkerPool {
+	return &WorkerPool{name: name, defaultLimit: defaultLimit}
+}
+
+func (p *WorkerPool) size() {
+	p.sizeOnce.Do(func() {
+		limit, ok := settings.WorkerLimits[p.name]
+		if !ok {
+			limit = p.defaultLimit
+		}
+		p.slots = make(chan struct{}, limit)
+		p.maxQueued, ok = settings.WorkerQueues[p.name]
+		if !ok {
+			p.maxQueued = config.DefaultWorkerQueue
+		}
+	})
+}
+
+// WorkerPools lists the pools, for metrics
+func WorkerPools() []*WorkerPool {
+	return []*WorkerPool{ExportPool, ImportPool, AIPool, ThumbnailPool, MaintenancePool}
+}
+
+// JobTimeout bounds each run of the pool's work: WORKER_JOB_TIMEOUT, or
+// WORKER_JOB_TIMEOUT_MAINTENANCE for the maintenance pool
+func (p *WorkerPool) JobTimeout() time.Duration {
+	if p.ownTimeout {
+		return settings.MaintenanceTimeout
+	}
+	return settings.WorkerJobTimeout
+}
+
+// Name is the pool's name, which is also the kind of its jobs
+func (p *WorkerPool) Name() string {
+	return p.name
+}
+
+// Stats returns the pool's current load and its counts since start
+func (p *WorkerPool) Stats() models.WorkerPoolStats {
+	p.size()
+	return models.WorkerPoolStats{
+		Name:      p.name,
+		Limit:     cap(p.slots),
+		MaxQueued: int(p.maxQueued),
+		Running:   p.running.Load(),
+		Queued:    p.queued.Load(),
+		Completed: p.completed.Load(),
+		Rejected:  p.rejected.Load(),
+		Deferred:  p.deferred.Load(),
+	}
+}
+
+// Do runs task once a slot is free. It returns ErrWorkerPoolFull at once
+// when the queue is full, and ctx's error if ctx is done before a slot is.
+func (p *WorkerPool) Do(ctx context.Context, task func() error) error {
+	if err := p.enqueue(); err != nil {
+		return err
+	}
+	return p.run(ctx, task)
+}
+
+// enqueue takes a place in the queue, if there is one
+func (p *WorkerPool) enqueue() error {
+	p.size()
+	if p.queued.Add(1) > p.maxQueued && len(p.slots) == cap(p.slots) {
+		p.queued.Add(-1)
+		p.rejected.Add(1)
+		return ErrWorkerPoolFull
+	}
+	return nil
+}
+
+// run waits for a slot for a task that holds a place in the queue
+func (p *WorkerPool) run(ctx context.Context, task func() error) error {
+	select {
+	case p.slots <- struct{}{}:
+		p.queued.Add(-1)
+	case <-ctx.Done():
+		p.queued.Add(-1)
+		return ctx.Err()
+	}
+	p.running.Add(1)
+	defer func() {
+		p.running.Add(-1)
+		p.completed.Add(1)
+		<-p.slots
+	}()
+	return task()
+}
@@ -0,0 +1,41 @@
+// Login burst profile: many clients logging in at once (e.g. a workshop
+// starting). bcrypt dominates here, so this tracks CPU cost per login.
+//
+//   k6 run -e BASE_URL=http://localhost:8080 loadtest/k6/auth.js
+import http from "k6/http";
+import { check } from "k6";
+
+const BASE_URL = __ENV.BASE_URL || "http://localhost:8080";
+const PASSWORD = "testpassword123";
+
+export const options = {
+  scenarios: {
+    logins: {
+      executor: "constant-arrival-rate",
+      rate: 20,
+      timeUnit: "1s",
+      duration: "1m",
+      preAllocatedVUs: 50,
+    },
+  },
+  thresholds: {
+    http_req_failed: ["rate<0.01"],
+    "http_req_duration{name:login}": ["p(95)<500"],
+  },
+};
+
+export function setup() {
+  const email = `k6_login_${Date.now()}@test.example.com`;
+  http.post(`${BASE_URL}/auth/register`, JSON.stringify({ email, password: PASSWORD }), {
+    headers: { "Content-Type": "application/json" },
+  });
+  return { email };
+}
+
+export default function (data) {
+  const res = http.post(`${BASE_URL}/auth/login`, JSON.stringify({ email: data.email, password: PASSWORD }), {
+    headers: { "Content-Type": "application/json" },
+    tags: { name: "login" },
+  });
+  check(res, { "login 200": (r) => r.status === 200 });
+}
@@ -0,0 +1,86 @@
+// Board editing load profile: each virtual user registers once, creates a
+// board, then loops over list/get/update like an active editor would.
+//
+//   k6 run -e BASE_URL=http://localhost:8080 loadtest/k6/boards.js
+import http from "k6/http";
+import { check, sleep } from "k6";
+
+const BASE_URL = __ENV.BASE_URL || "http://localhost:8080";
+const SHAPES = parseInt(__ENV.SHAPES || "500", 10);
+
+export const options = {
+  scenarios: {
+    editors: {
+      executor: "ramping-vus",
+      startVUs: 0,
+      stages: [
+        { duration: "30s", target: 50 },
+        { duration: "2m", target: 50 },
+        { duration: "30s", target: 0 },
+      ],
+    },
+  },
+  // Release targets: a regression past these fails the run
+  thresholds: {
+    http_req_failed: ["rate<0.01"],
+    "http_req_duration{name:list}": ["p(95)<200"],
+    "http_req_duration{name:get}": ["p(95)<250"],
+    "http_req_duration{name:update}": ["p(95)<400"],
+  },
+};
+
+function boardData(shapes) {
+  const items = [];
+  for (let i = 0; i < shapes; i++) {
+    items.push({ id: `shape-${i}`, type: "rectangle", x: i * 10, y: i * 5, width: 120, height: 80 });
+  }
+  return { scale: 1, position: { x: 0, y: 0 }, shapes: items };
+}
+
+export function setup() {
+  return { board: boardData(SHAPES) };
+}
+
+let session = null;
+
+function login() {
+  const email = `k6_${__VU}_${Date.now()}@test.example.com`;
+  const credentials = JSON.stringify({ email, password: "testpassword123" });
+  const params = { headers: { "Content-Type": "application/json" } };
+
+  http.post(`${BASE_URL}/auth/register`, credentials, params);
+  const res = http.post(`${BASE_URL}/auth/login`, credentials, params);
+  check(res, { "logged in": (r) => r.status === 200 });
+
+  const headers = {
+    "Content-Type": "application/json",
+    Authorization: `Bearer ${res.json("token")}`,
+  };
+  return { headers };
+}
+
+export default function (data) {
+  if (session === null) {
+    session = login();
+    http.post(`${BASE_URL}/api/boards`, JSON.stringify({ board: data.board }), { headers: session.headers });
+    const list = http.get(`${BASE_URL}/api/boards`, { headers: session.headers });
+    session.boardId = list.json("boards.0._id");
+  }
+
+  const params = { headers: session.headers };
+
+  const list = http.get(`${BASE_URL}/api/boards`, Object.assign({ tags: { name: "list" } }, params));
+  check(list, { "list 200": (r) => r.status === 200 });
+
+  const get = http.get(`${BASE_URL}/api/boards/${session.boardId}`, Object.assign({ tags: { name: "get" } }, params));
+  check(get, { "get 200": (r) => r.status === 200 });
+
+  const update = http.put(
+    `${BASE_URL}/api/boards/${session.boardId}`,
+    JSON.stringify({ board: data.board }),
+    Object.assign({ tags: { name: "update" } }, params)
+  );
+  check(update, { "update 200": (r) => r.status === 200 });
+
+  sleep(1);
+}
@@ -1,62 +1,188 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"log/slog"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
-	"github.com/gin-contrib/cors"
-	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
+	"github.com/sarwanazhar/boardsar/backend/config"
+	"github.com/sarwanazhar/boardsar/backend/controllers"
 	"github.com/sarwanazhar/boardsar/backend/database"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/realtime"
+	"github.com/sarwanazhar/boardsar/backend/repository"
 	"github.com/sarwanazhar/boardsar/backend/routes"
 )
 
 func init() {
 	// Load .env only if running locally (PORT not set)
-	if os.Getenv("PORT") == "" {
-		err := godotenv.Load()
-		if err != nil {
-			log.Println("⚠️  No .env file found, continuing...")
+	var envErr error
+	local := os.Getenv("PORT") == ""
+	if local {
+		envErr = godotenv.Load()
+	}
+
+	// Structured logs, formatted as LOG_FORMAT and LOG_LEVEL say
+	libs.ConfigureLogging()
+
+	if local {
+		if envErr != nil {
+			slog.Info("No .env file found, continuing")
 		} else {
-			log.Println("✅ .env loaded")
+			slog.Info(".env loaded")
 		}
 	}
 }
 
 func main() {
-	port := os.Getenv("PORT")
-	backendUri := os.Getenv("MONGODB_URI")
+	// Stop on SIGINT/SIGTERM, finishing in-flight work first
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	if port == "" {
-		port = "8080"
+	// Core settings, checked before anything starts
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := libs.Configure(cfg); err != nil {
+		log.Fatalf("invalid configuration: %v", err)
+	}
+
+	// Load translation catalogs (bundled + optional LOCALES_DIR overrides)
+	if err := libs.LoadTranslations(cfg.LocalesDir); err != nil {
+		log.Fatalf("Failed to load translations: %v", err)
+	}
+
+	// Optional full spellcheck dictionary
+	if path := cfg.SpellcheckWordList; path != "" {
+		if err := libs.LoadWordList(path); err != nil {
+			log.Fatalf("Failed to load SPELLCHECK_WORDLIST: %v", err)
+		}
 	}
-	if backendUri == "" {
-		log.Fatal("❌ MONGODB_URI is empty")
+
+	// Traces of requests and their queries, exported over OTLP if configured
+	shutdownTracing, err := libs.ConfigureTracing(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to set up tracing: %v", err)
 	}
 
 	// Connect to MongoDB
-	database.ConnectMongo(backendUri)
+	database.ConnectMongo(cfg.MongoURI, cfg.DatabaseName)
+
+	// Handlers reach boards through the repository
+	boards := repository.NewMongoBoards()
+
+	// Large boards are stored zstd-compressed
+	libs.ConfigureBoardCompression()
+
+	// Custom shape types registered through the admin API
+	loadCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	if err := libs.LoadShapeTypeSchemas(loadCtx); err != nil {
+		log.Fatalf("Failed to load shape types: %v", err)
+	}
+	cancel()
+	go libs.RunShapeTypeSchemaRefresh(ctx)
+
+	// Per-tenant CORS origins set through the admin API
+	loadCtx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	if err := libs.LoadCORSTenants(loadCtx); err != nil {
+		log.Fatalf("Failed to load CORS origins: %v", err)
+	}
+	cancel()
+	go libs.RunCORSTenantRefresh(ctx)
+
+	// Revoked guest and embed tokens
+	loadCtx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	if err := libs.LoadBoardTokenRevocations(loadCtx); err != nil {
+		log.Fatalf("Failed to load revoked board tokens: %v", err)
+	}
+	cancel()
+	go libs.RunBoardTokenRevocationRefresh(ctx)
 
-	r := gin.Default()
+	// Board previews, drawn in the background after saves
+	go libs.RunThumbnailWorker(ctx)
 
-	// Configure CORS
-	r.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"https://boardsar.vercel.app", "http://localhost:3000"},
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "Accept"},
-		ExposeHeaders:    []string{"Content-Length"},
-		AllowCredentials: true,
-		MaxAge:           12 * 3600,
-	}))
+	// Outgoing webhooks, sent and retried in the background
+	go libs.RunWebhookWorker(ctx)
 
-	// Register routes
-	routes.InitRoutes(r)
+	// Board lists read board_summaries; write those missing or out of date
+	go libs.RunBoardSummaryBackfill(ctx)
 
-	address := fmt.Sprintf(":%s", port)
-	fmt.Printf("✅ Starting server on %s\n", address)
+	// Boards turn read-only at their scheduled freeze; live sessions are
+	// told at once
+	go libs.RunBoardFreezer(ctx, realtime.DefaultHub.Reload)
 
-	if err := r.Run(address); err != nil {
-		log.Fatalf("❌ Server failed to run: %v", err)
+	// Deleted boards and accounts go for good once their grace period is
+	// over
+	go libs.RunPendingDeletions(ctx, controllers.CompletePendingDeletion(boards))
+
+	// Boards of deactivated and long-inactive members go to the successor
+	// named by the succession policy
+	go libs.RunOwnershipSuccession(ctx, controllers.HandOverBoards(boards))
+
+	// Daily storage snapshots, for the growth in /api/admin/storage
+	go libs.RunStorageSnapshots(ctx)
+
+	// Boards left untouched for months move to cold storage
+	if libs.BoardArchivingConfigured() {
+		go libs.RunBoardArchiver(ctx)
+	}
+
+	// Dev-only fault injection
+	if libs.ChaosEnabled() {
+		if err := libs.LoadChaosRules(cfg.ChaosRules); err != nil {
+			log.Fatalf("Invalid CHAOS_RULES: %v", err)
+		}
+		slog.Warn("Chaos mode enabled: faults will be injected")
+	}
+
+	// Optional push of audit events to a SIEM
+	if libs.AuditForwardingConfigured() {
+		go libs.RunAuditForwarder(ctx)
+	}
+
+	server := libs.NewServer(fmt.Sprintf(":%s", cfg.Port), routes.NewRouter(cfg, boards))
+	serveErr := make(chan error, 1)
+	go func() {
+		slog.Info("Starting server", "address", server.Addr)
+		serveErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		shutdownTracing(context.Background())
+		log.Fatalf("Server failed to run: %v", err)
+	case <-ctx.Done():
+	}
+	stop()
+	slog.Info("Shutting down; a second signal stops at once", "timeout", libs.ShutdownTimeout())
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), libs.ShutdownTimeout())
+	defer cancel()
+
+	// Stop accepting connections and let in-flight requests finish
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("Requests were still running at shutdown", "error", err)
+		// Stop their reads; writes still finish
+		libs.CancelRequests()
+	}
+	// Jobs that went to the background, and edits of live sessions
+	if err := libs.DrainJobs(shutdownCtx); err != nil {
+		slog.Warn("Jobs were still running at shutdown", "error", err)
+	}
+	realtime.DefaultHub.Flush()
+
+	if err := database.DisconnectMongo(shutdownCtx); err != nil {
+		slog.Warn("Failed to disconnect from MongoDB", "error", err)
+	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		slog.Warn("Failed to flush traces", "error", err)
 	}
+	slog.Info("Server stopped")
 }
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Activity actions
+const (
+	ActivityBoardCreated  = "board.created"
+	ActivityBoardUpdated  = "board.updated"
+	ActivityBoardDeleted  = "board.deleted"
+	ActivityBoardShared   = "board.shared"
+	ActivityBoardUnshared = "board.unshared"
+)
+
+// ActivityChanges counts the shape changes of a run of saves
+type ActivityChanges struct {
+	Added   int `json:"added" bson:"added"`
+	Changed int `json:"changed" bson:"changed"`
+	Removed int `json:"removed" bson:"removed"`
+	Saves   int `json:"saves" bson:"saves"`
+}
+
+// Activity is one entry of a board's activity feed. Saves by the same
+// person in quick succession are folded into one entry.
+type Activity struct {
+	ID        primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	BoardID   primitive.ObjectID  `json:"boardId" bson:"boardId"`
+	BoardName string              `json:"boardName" bson:"boardName"` // As of the action, so deleted boards keep theirs
+	ActorID   primitive.ObjectID  `json:"actorId" bson:"actorId"`
+	Action    string              `json:"action" bson:"action"`
+	Changes   *ActivityChanges    `json:"changes,omitempty" bson:"changes,omitempty"`
+	UserID    *primitive.ObjectID `json:"userId,omitempty" bson:"userId,omitempty"`       // Collaborator added or removed
+	UserEmail string              `json:"userEmail,omitempty" bson:"userEmail,omitempty"` // Their email at the time
+	Role      string              `json:"role,omitempty" bson:"role,omitempty"`
+	CreatedAt time.Time           `json:"createdAt" bson:"createdAt"`
+	UpdatedAt time.Time           `json:"updatedAt" bson:"updatedAt"` // Last save folded in
+	ExpiresAt time.Time           `json:"-" bson:"expiresAt"`
+
+	// Filled in when listing
+	ActorEmail string `json:"actorEmail,omitempty" bson:"-"`
+	Summary    string `json:"summary" bson:"-"`
+}
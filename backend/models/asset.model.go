@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Asset is an image uploaded for a board. Shapes refer to it by URL
+// instead of carrying the image inline; the bytes live in asset storage
+// (GridFS or S3) under Key.
+type Asset struct {
+	ID      primitive.ObjectID `bson:"_id" json:"id"`
+	BoardID primitive.ObjectID `bson:"boardId" json:"boardId"`
+	// OwnerID is the board owner, whose storage quota the asset counts
+	// against
+	OwnerID     primitive.ObjectID `bson:"ownerId" json:"-"`
+	UploadedBy  primitive.ObjectID `bson:"uploadedBy" json:"uploadedBy"`
+	Filename    string             `bson:"filename" json:"filename"`
+	ContentType string             `bson:"contentType" json:"contentType"`
+	Size        int64              `bson:"size" json:"size"`
+	Width       int                `bson:"width" json:"width"`
+	Height      int                `bson:"height" json:"height"`
+	SHA256      string             `bson:"sha256" json:"sha256"`
+	Storage     string             `bson:"storage" json:"-"`
+	Key         string             `bson:"key" json:"-"`
+	CreatedAt   time.Time          `bson:"createdAt" json:"createdAt"`
+	URL         string             `bson:"-" json:"url"`
+}
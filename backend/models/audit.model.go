@@ -0,0 +1,113 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AuditSchemaVersion is the version of the exported audit event format
+// documented in the README. Bump it on breaking changes.
+const AuditSchemaVersion = 1
+
+// Audit outcomes
+const (
+	AuditOutcomeSuccess = "success"
+	AuditOutcomeFailure = "failure"
+)
+
+// Audit actions
+const (
+	AuditLoginSucceeded            = "auth.login.succeeded"
+	AuditLoginFailed               = "auth.login.failed"
+	AuditLogout                    = "auth.logout"
+	AuditPasswordResetRequested    = "auth.password_reset.requested"
+	AuditPasswordResetCompleted    = "auth.password_reset.completed"
+	AuditPasswordChanged           = "auth.password.changed"
+	AuditEmailChangeRequested      = "auth.email_change.requested"
+	AuditEmailChanged              = "auth.email.changed"
+	AuditMagicLinkRequested        = "auth.magic_link.requested"
+	AuditIdentityLinked            = "auth.identity.linked"
+	AuditIdentityUnlinked          = "auth.identity.unlinked"
+	AuditPasskeyRegistered         = "auth.passkey.registered"
+	AuditPasskeyRemoved            = "auth.passkey.removed"
+	AuditPasswordlessChanged       = "auth.passwordless.changed"
+	AuditAccountDeleted            = "auth.account.deleted"
+	AuditAccountDeletionScheduled  = "auth.account_deletion.scheduled"
+	AuditAccountDeletionCanceled   = "auth.account_deletion.canceled"
+	AuditAccountExported           = "auth.account.exported"
+	AuditSessionRevoked            = "auth.session.revoked"
+	AuditTwoFactorEnabled          = "auth.two_factor.enabled"
+	AuditTwoFactorDisabled         = "auth.two_factor.disabled"
+	AuditRecoveryCodesRegenerated  = "auth.two_factor.recovery_codes.regenerated"
+	AuditBoardCreated              = "board.created"
+	AuditBoardDeleted              = "board.deleted"
+	AuditBoardDeletionScheduled    = "board.deletion.scheduled"
+	AuditBoardDeletionCanceled     = "board.deletion.canceled"
+	AuditBoardShared               = "board.shared"
+	AuditBoardUnshared             = "board.unshared"
+	AuditBoardOwnershipTransferred = "board.ownership.transferred"
+	AuditBoardExported             = "board.exported"
+	AuditBoardExportSettings       = "board.export_settings.changed"
+	AuditShareLinkCreated          = "share_link.created"
+	AuditShareLinkRevoked          = "share_link.revoked"
+	AuditShortLinkCreated          = "short_link.created"
+	AuditShortLinkDeleted          = "short_link.deleted"
+	AuditEmbedTokenCreated         = "embed_token.created"
+	AuditEmbedTokenRevoked         = "embed_token.revoked"
+	AuditOAuthClientCreated        = "oauth_client.created"
+	AuditOAuthClientDeleted        = "oauth_client.deleted"
+	AuditOAuthGrantApproved        = "oauth_grant.approved"
+	AuditOAuthGrantRevoked         = "oauth_grant.revoked"
+	AuditLegalHoldPlaced           = "legal_hold.placed"
+	AuditLegalHoldReleased         = "legal_hold.released"
+	AuditShapeTypeRegistered       = "shape_type.registered"
+	AuditShapeTypeRemoved          = "shape_type.removed"
+	AuditCORSTenantSaved           = "cors_tenant.saved"
+	AuditCORSTenantRemoved         = "cors_tenant.removed"
+	AuditReadOnlyChanged           = "admin.read_only.changed"
+	AuditRequestLoggingChanged     = "admin.request_logging.changed"
+	AuditUserDeactivated           = "admin.user.deactivated"
+	AuditUserReactivated           = "admin.user.reactivated"
+	AuditSuccessionPolicyChanged   = "admin.succession_policy.changed"
+	AuditStorageMaintenance        = "admin.storage.maintenance"
+)
+
+// Audit target types
+const (
+	AuditTargetUser        = "user"
+	AuditTargetBoard       = "board"
+	AuditTargetShareLink   = "share_link"
+	AuditTargetShortLink   = "short_link"
+	AuditTargetOAuthClient = "oauth_client"
+	AuditTargetLegalHold   = "legal_hold"
+	AuditTargetShapeType   = "shape_type"
+	AuditTargetCORSTenant  = "cors_tenant"
+	AuditTargetInstance    = "instance"
+)
+
+// AuditActor is who performed an audited action. ID is empty for
+// anonymous actions such as failed logins.
+type AuditActor struct {
+	ID        string `json:"id,omitempty" bson:"id,omitempty"`
+	IP        string `json:"ip,omitempty" bson:"ip,omitempty"`
+	UserAgent string `json:"userAgent,omitempty" bson:"userAgent,omitempty"`
+}
+
+// AuditTarget is what an audited action was performed on
+type AuditTarget struct {
+	Type string `json:"type" bson:"type"`
+	ID   string `json:"id,omitempty" bson:"id,omitempty"`
+}
+
+// AuditEvent is one entry of the audit log. Its JSON form is the export
+// schema, so fields are only ever added.
+type AuditEvent struct {
+	ID      primitive.ObjectID     `json:"id" bson:"_id,omitempty"`
+	Time    time.Time              `json:"time" bson:"time"`
+	Action  string                 `json:"action" bson:"action"`
+	Outcome string                 `json:"outcome" bson:"outcome"`
+	Actor   AuditActor             `json:"actor" bson:"actor"`
+	Target  *AuditTarget           `json:"target,omitempty" bson:"target,omitempty"`
+	Details map[string]interface{} `json:"details,omitempty" bson:"details,omitempty"`
+}
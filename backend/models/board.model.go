@@ -6,34 +6,371 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// Collaborator roles. BoardRoleOwner is the role reported for the owner.
+const (
+	BoardRoleOwner         = "owner"
+	CollaboratorRoleEditor = "editor"
+	CollaboratorRoleViewer = "viewer"
+)
+
+// Collaborator is a user a board has been shared with. Capabilities are
+// set by whoever shared the board; without them, DefaultCapabilities
+// apply.
+type Collaborator struct {
+	UserID       primitive.ObjectID `json:"userId" bson:"userId"`
+	Role         string             `json:"role" bson:"role"`
+	Capabilities *Capabilities      `json:"capabilities,omitempty" bson:"capabilities,omitempty"`
+	Profile      *Profile           `json:"profile,omitempty" bson:"-"` // Looked up for board lists, never stored
+}
+
+// Capabilities that routes can require of collaborators
+const (
+	CapabilityExport  = "export"
+	CapabilityShare   = "share"
+	CapabilityHistory = "history"
+)
+
+// Capabilities are what a collaborator may do besides viewing or editing
+// the board as their role allows
+type Capabilities struct {
+	Export      bool `json:"export" bson:"export"`           // Download the board or save it as a template, as far as the export policy allows
+	Share       bool `json:"share" bson:"share"`             // Share it with others, with no more access than their own
+	History     bool `json:"history" bson:"history"`         // See its versions, diffs and activity
+	CommentOnly bool `json:"commentOnly" bson:"commentOnly"` // Editors change sticky notes only
+}
+
+// DefaultCapabilities are those of collaborators shared with before
+// capabilities existed, or without any given
+var DefaultCapabilities = Capabilities{Export: true, History: true}
+
+// NoteShapeTypes are the shape types that count as sticky notes in a
+// facilitated session
+var NoteShapeTypes = map[string]bool{
+	"sticky": true,
+	"text":   true,
+}
+
+// BuiltinShapeTypes are the shape types the editor draws itself. Custom
+// shape types can't reuse these names.
+var BuiltinShapeTypes = map[string]bool{
+	"rect":   true,
+	"circle": true,
+	"line":   true,
+	"text":   true,
+	"pen":    true,
+	"sticky": true,
+	"frame":  true,
+	"image":  true,
+}
+
+// Facilitation restricts what collaborators can do while the owner runs a
+// facilitated session on the board
+type Facilitation struct {
+	NoDelete        bool      `json:"noDelete" bson:"noDelete"`               // Participants can't remove shapes
+	StickyNotesOnly bool      `json:"stickyNotesOnly" bson:"stickyNotesOnly"` // Participants can only touch notes
+	HideCursors     bool      `json:"hideCursors" bson:"hideCursors"`         // Don't show participants each other's cursors
+	PrivateNotes    bool      `json:"privateNotes" bson:"privateNotes"`       // New notes stay hidden until revealed
+	StartedAt       time.Time `json:"startedAt" bson:"startedAt"`
+}
+
 // Board represents the complete board state as stored in MongoDB
 // This matches the frontend Board interface exactly
 type Board struct {
-	ID        primitive.ObjectID     `json:"_id" bson:"_id,omitempty"`
-	BoardID   string                 `json:"boardId" bson:"boardId"` // Unique board identifier
-	OwnerID   primitive.ObjectID     `json:"ownerId" bson:"ownerId"` // User who owns this board
-	BoardData map[string]interface{} `json:"board" bson:"board"`     // Raw frontend board state
-	CreatedAt time.Time              `json:"createdAt" bson:"createdAt"`
-	UpdatedAt time.Time              `json:"updatedAt" bson:"updatedAt"`
+	ID            primitive.ObjectID     `json:"_id" bson:"_id,omitempty"`
+	BoardID       string                 `json:"boardId" bson:"boardId"`               // Unique board identifier
+	Name          string                 `json:"name,omitempty" bson:"name,omitempty"` // Display name; boards without one show their BoardID
+	Description   string                 `json:"description,omitempty" bson:"description,omitempty"`
+	OwnerID       primitive.ObjectID     `json:"ownerId" bson:"ownerId"`                 // User who owns this board
+	BoardData     map[string]interface{} `json:"board" bson:"board"`                     // Raw frontend board state
+	BoardZstd     []byte                 `json:"-" bson:"boardZstd,omitempty"`           // BoardData compressed, for large boards; only set while stored
+	BoardEncoding string                 `json:"-" bson:"boardEncoding,omitempty"`       // BoardEncodingZstd when stored compressed
+	BoardSize     int64                  `json:"-" bson:"boardSize,omitempty"`           // BSON size of BoardData when stored compressed
+	SharedWith    []Collaborator         `json:"sharedWith" bson:"sharedWith,omitempty"` // Users the board is shared with
+	Facilitation  *Facilitation          `json:"facilitation,omitempty" bson:"facilitation,omitempty"`
+	Sections      []Section              `json:"sections,omitempty" bson:"sections,omitempty"`           // Named sections; shapes join one by sectionId
+	Freeze        *BoardFreeze           `json:"freeze,omitempty" bson:"freeze,omitempty"`               // Scheduled freeze, if any
+	ParentID      *primitive.ObjectID    `json:"parentBoardId,omitempty" bson:"parentBoardId,omitempty"` // Set on breakout boards
+	Version       int64                  `json:"version" bson:"version"`                                 // Bumped on every content change; 0 for boards saved before versioning
+	Plugins       map[string]bool        `json:"plugins,omitempty" bson:"plugins,omitempty"`             // Per-board plugin switches; unset plugins use their default
+	ExportPolicy  string                 `json:"exportPolicy,omitempty" bson:"exportPolicy,omitempty"`   // Who may export; empty means anyone with access
+	Tags          []string               `json:"tags,omitempty" bson:"tags,omitempty"`
+	FolderID      *primitive.ObjectID    `json:"folderId,omitempty" bson:"folderId,omitempty"` // One of the owner's folders
+	ShapeIndex    int64                  `json:"-" bson:"shapeIndex,omitempty"`                // Version the shape index was built from, if the board is indexed
+	Archived      *BoardArchive          `json:"-" bson:"archived,omitempty"`                  // Set while the contents are in cold storage
+	LastOpenedAt  *time.Time             `json:"-" bson:"lastOpenedAt,omitempty"`              // When the board was last brought back from cold storage
+	CreatedAt     time.Time              `json:"createdAt" bson:"createdAt"`
+	UpdatedAt     time.Time              `json:"updatedAt" bson:"updatedAt"`
+}
+
+// BoardArchive records where the contents of a board untouched for a
+// while were moved. The board document keeps everything but its contents,
+// which are put back the next time the board is opened.
+type BoardArchive struct {
+	Storage        string    `bson:"storage"`        // Cold storage backend
+	Key            string    `bson:"key"`            // Where the contents are in it
+	Size           int64     `bson:"size"`           // BSON size of the contents
+	CompressedSize int64     `bson:"compressedSize"` // Size in cold storage
+	ArchivedAt     time.Time `bson:"archivedAt"`
+}
+
+// BoardFreeze makes a board read-only for everyone but its owner from At,
+// such as at a submission deadline
+type BoardFreeze struct {
+	At          time.Time          `json:"at" bson:"at"`
+	ScheduledBy primitive.ObjectID `json:"scheduledBy" bson:"scheduledBy"`
+	FrozenAt    *time.Time         `json:"frozenAt,omitempty" bson:"frozenAt,omitempty"` // When the scheduler froze it
+}
+
+// BoardFreezeStatus is a scheduled freeze as board meta shows it
+type BoardFreezeStatus struct {
+	At          time.Time `json:"at"`
+	Frozen      bool      `json:"frozen"`
+	SecondsLeft int64     `json:"secondsLeft"` // Until the freeze; 0 once frozen
+}
+
+// BoardFreezeRequest represents the request structure for scheduling a
+// board freeze. A time already past freezes the board at once.
+type BoardFreezeRequest struct {
+	At time.Time `json:"at" binding:"required"`
+}
+
+// BoardSummary is what board lists need of a board. Lists read it from the
+// board_summaries collection, kept in step with every board write, so they
+// never load boards however big they get. The counts and thumbnail are only
+// kept there.
+type BoardSummary struct {
+	ID                primitive.ObjectID  `bson:"_id"`
+	BoardID           string              `bson:"boardId"`
+	Name              string              `bson:"name,omitempty"`
+	Description       string              `bson:"description,omitempty"`
+	OwnerID           primitive.ObjectID  `bson:"ownerId"`
+	SharedWith        []Collaborator      `bson:"sharedWith,omitempty"`
+	ParentID          *primitive.ObjectID `bson:"parentBoardId,omitempty"`
+	Tags              []string            `bson:"tags,omitempty"`
+	FolderID          *primitive.ObjectID `bson:"folderId,omitempty"`
+	Freeze            *BoardFreeze        `bson:"freeze,omitempty"`
+	Version           int64               `bson:"version"`
+	CreatedAt         time.Time           `bson:"createdAt"`
+	UpdatedAt         time.Time           `bson:"updatedAt"`
+	ShapeCount        int                 `bson:"shapeCount,omitempty"`
+	CollaboratorCount int                 `bson:"collaboratorCount,omitempty"`
+	Thumbnail         *ThumbnailRef       `bson:"thumbnail,omitempty"`
+}
+
+// ThumbnailRef points a board summary at the board's newest thumbnail
+type ThumbnailRef struct {
+	ID      primitive.ObjectID `bson:"id"`
+	Version int64              `bson:"version"` // Board version it shows
 }
 
 // FrontendBoard represents the board structure expected by the frontend
 type FrontendBoard struct {
-	ID         string                   `json:"_id"`
-	Name       string                   `json:"name"`
-	OwnerID    string                   `json:"ownerId"`
-	SharedWith []string                 `json:"sharedWith"`
-	CreatedAt  time.Time                `json:"createdAt"`
-	UpdatedAt  time.Time                `json:"updatedAt"`
-	Scale      float64                  `json:"scale"`
-	Position   map[string]float64       `json:"position"`
-	Shapes     []map[string]interface{} `json:"shapes"`
+	ID                string                   `json:"_id"`
+	Name              string                   `json:"name"`
+	Description       string                   `json:"description"`
+	OwnerID           string                   `json:"ownerId"`
+	SharedWith        []string                 `json:"sharedWith"`
+	Collaborators     []Collaborator           `json:"collaborators"`
+	ParentID          string                   `json:"parentBoardId,omitempty"`
+	Tags              []string                 `json:"tags"`
+	FolderID          string                   `json:"folderId,omitempty"`
+	Freeze            *BoardFreezeStatus       `json:"freeze,omitempty"`  // Countdown to a scheduled freeze
+	Starred           bool                     `json:"starred,omitempty"` // Set in board lists, for the requesting user
+	Version           int64                    `json:"version"`
+	ShapeCount        int                      `json:"shapeCount"`
+	CollaboratorCount int                      `json:"collaboratorCount"`
+	ThumbnailVersion  int64                    `json:"thumbnailVersion,omitempty"` // Board version GET /api/boards/:id/thumbnail shows, once drawn
+	CreatedAt         time.Time                `json:"createdAt"`
+	UpdatedAt         time.Time                `json:"updatedAt"`
+	Scale             float64                  `json:"scale"`
+	Position          map[string]float64       `json:"position"`
+	Shapes            []map[string]interface{} `json:"shapes"`
 }
 
 // BoardRequest represents the request structure for creating/updating boards
 type BoardRequest struct {
-	BoardID string                 `json:"boardId" bson:"boardId"`
-	Board   map[string]interface{} `json:"board" binding:"required"`
+	BoardID         string                 `json:"boardId" bson:"boardId"`
+	Name            *string                `json:"name" binding:"omitempty,max=200"`         // Left unchanged on update when omitted
+	Description     *string                `json:"description" binding:"omitempty,max=2000"` // Left unchanged on update when omitted
+	Board           map[string]interface{} `json:"board" binding:"required"`
+	ExpectedVersion *int64                 `json:"expectedVersion"` // Version the client last loaded; If-Match also works
+}
+
+// BoardMetaRequest represents the request structure for changing a board's
+// name, description, tags or folder without sending its contents. Omitted
+// fields are left unchanged; an empty name falls back to the board ID, and
+// an empty folderId takes the board out of its folder.
+type BoardMetaRequest struct {
+	Name        *string   `json:"name" binding:"omitempty,max=200"`
+	Description *string   `json:"description" binding:"omitempty,max=2000"`
+	Tags        *[]string `json:"tags" binding:"omitempty,max=20,dive,max=50"`
+	FolderID    *string   `json:"folderId"` // Owner only
+}
+
+// Operations of a bulk board request
+const (
+	BulkBoardDelete  = "delete"
+	BulkBoardArchive = "archive" // Move the contents to cold storage now
+	BulkBoardMove    = "move"
+	BulkBoardTag     = "tag"
+)
+
+// BulkBoardRequest represents the request structure for applying
+// operations to many boards at once, at most one per board
+type BulkBoardRequest struct {
+	Operations []BulkBoardOperation `json:"operations" binding:"required,min=1,max=100,dive"`
+}
+
+// BulkBoardOperation is one operation of a bulk request. Moves take
+// folderId, empty to take the board out of its folder; tagging takes
+// addTags and removeTags.
+type BulkBoardOperation struct {
+	Op         string   `json:"op" binding:"required,oneof=delete archive move tag"`
+	BoardID    string   `json:"boardId" binding:"required"`
+	FolderID   *string  `json:"folderId"`
+	AddTags    []string `json:"addTags" binding:"omitempty,max=20,dive,max=50"`
+	RemoveTags []string `json:"removeTags" binding:"omitempty,max=20,dive,max=50"`
+}
+
+// BulkBoardResult is how one operation of a bulk request went. Status is
+// what the single-board endpoint would have answered.
+type BulkBoardResult struct {
+	Index    int        `json:"index"`
+	Op       string     `json:"op"`
+	BoardID  string     `json:"boardId"`
+	Status   int        `json:"status"`
+	Error    string     `json:"error,omitempty"`
+	DeleteAt *time.Time `json:"deleteAt,omitempty"` // Of deletes scheduled for the grace period
+}
+
+// ShareRequest represents the request structure for sharing a board.
+// The collaborator is identified by email or user ID.
+type ShareRequest struct {
+	Email  string `json:"email"`
+	UserID string `json:"userId"`
+	Role   string `json:"role" binding:"required,oneof=editor viewer"`
+	// Capabilities replace the collaborator's; omitted, they keep theirs,
+	// or get DefaultCapabilities when new
+	Capabilities *Capabilities `json:"capabilities"`
+}
+
+// FacilitationRequest represents the request structure for starting or
+// changing a facilitated session
+type FacilitationRequest struct {
+	NoDelete        bool `json:"noDelete"`
+	StickyNotesOnly bool `json:"stickyNotesOnly"`
+	HideCursors     bool `json:"hideCursors"`
+	PrivateNotes    bool `json:"privateNotes"`
+}
+
+// BoardPluginRequest represents the request structure for switching a
+// plugin on or off for a board
+type BoardPluginRequest struct {
+	Enabled *bool `json:"enabled" binding:"required"`
+}
+
+// Board export policies
+const (
+	ExportPolicyAnyone   = "anyone"   // Anyone who can see the board (the default)
+	ExportPolicyOwner    = "owner"    // Only the owner
+	ExportPolicyDisabled = "disabled" // Nobody, until the owner re-enables it
+)
+
+// ExportSettingsRequest represents the request structure for changing who
+// may export a board
+type ExportSettingsRequest struct {
+	Policy string `json:"policy" binding:"required,oneof=anyone owner disabled"`
+}
+
+// BreakoutGroup is the set of participants working on one breakout board.
+// Participants are given by user ID or email.
+type BreakoutGroup struct {
+	Participants []string `json:"participants" binding:"required,min=1"`
+}
+
+// BreakoutRequest represents the request structure for spawning breakout
+// boards from a parent board, one per group
+type BreakoutRequest struct {
+	Groups   []BreakoutGroup `json:"groups" binding:"required,min=1,max=50,dive"`
+	ShapeIDs []string        `json:"shapeIds"` // Parent shapes to seed each breakout with
+	CopyAll  bool            `json:"copyAll"`  // Seed with every parent shape instead
+}
+
+// MergeBreakoutsRequest represents the request structure for gathering
+// breakout content back into the parent board
+type MergeBreakoutsRequest struct {
+	BoardIDs []string `json:"boardIds"` // Breakouts to gather from; all when empty
+	ShapeIDs []string `json:"shapeIds"` // Shapes to gather; all when empty
+}
+
+// ClusterRequest represents the request structure for clustering sticky
+// notes. All fields are optional.
+type ClusterRequest struct {
+	ShapeIDs  []string `json:"shapeIds"`                                          // Notes to cluster; all when empty
+	Threshold *float64 `json:"threshold" binding:"omitempty,gt=0,lte=1"`          // Similarity needed to join a cluster
+	Method    string   `json:"method" binding:"omitempty,oneof=tfidf embeddings"` // Force a method
+}
+
+// ImportDiagramRequest represents the request structure for adding a
+// Mermaid or PlantUML diagram to a board
+type ImportDiagramRequest struct {
+	Source string   `json:"source" binding:"required,max=200000"`
+	Syntax string   `json:"syntax" binding:"omitempty,oneof=mermaid plantuml"` // Detected when empty
+	X      *float64 `json:"x"`                                                 // Top-left corner of the diagram;
+	Y      *float64 `json:"y"`                                                 // right of the content by default
+}
+
+// LayoutRequest represents the request structure for laying out shapes.
+// The result is an operation batch for PATCH, with the batch undoing it.
+type LayoutRequest struct {
+	Algorithm string   `json:"algorithm" binding:"required,oneof=hierarchical force grid"`
+	ShapeIDs  []string `json:"shapeIds"`                                        // Shapes and connectors to lay out; all when empty
+	Direction string   `json:"direction" binding:"omitempty,oneof=TB BT LR RL"` // hierarchical; TB by default
+	Columns   int      `json:"columns" binding:"omitempty,min=1,max=500"`       // grid; about square by default
+}
+
+// Ways ArrangeRequest moves shapes
+const (
+	ArrangeAlign      = "align"
+	ArrangeDistribute = "distribute"
+	ArrangeTidy       = "tidy"
+)
+
+// ArrangeRequest represents the request structure for aligning,
+// distributing or tidying shapes, applied as one new version
+type ArrangeRequest struct {
+	Action          string   `json:"action" binding:"required,oneof=align distribute tidy"`
+	ShapeIDs        []string `json:"shapeIds" binding:"required,min=2,max=500"`
+	To              string   `json:"to" binding:"omitempty,oneof=left center right top middle bottom"` // align: the edge or centre line
+	Axis            string   `json:"axis" binding:"omitempty,oneof=horizontal vertical"`               // distribute
+	Spacing         *float64 `json:"spacing" binding:"omitempty,min=0,max=10000"`                      // distribute: the gap, even by default; tidy: 20 by default
+	ExpectedVersion *int64   `json:"expectedVersion"`                                                  // If-Match also works
+}
+
+// Board operation types
+const (
+	OpAddShape    = "add"
+	OpUpdateShape = "update"
+	OpDeleteShape = "delete"
+	OpSetScale    = "setScale"
+	OpSetPosition = "setPosition"
+)
+
+// BoardOperation is one incremental change to a board's state. Update
+// merges the given shape fields into the existing shape.
+type BoardOperation struct {
+	Op       string                 `json:"op" binding:"required,oneof=add update delete setScale setPosition"`
+	ID       string                 `json:"id,omitempty"`       // Target shape for update/delete
+	Shape    map[string]interface{} `json:"shape,omitempty"`    // New shape (add) or changed fields (update)
+	Scale    *float64               `json:"scale,omitempty"`    // setScale
+	Position map[string]float64     `json:"position,omitempty"` // setPosition
+}
+
+// PatchBoardRequest represents the request structure for incremental board
+// updates. Operations are applied in order.
+type PatchBoardRequest struct {
+	Operations      []BoardOperation `json:"operations" binding:"required,min=1,max=500,dive"`
+	ExpectedVersion *int64           `json:"expectedVersion"` // Version the client last loaded; If-Match also works
 }
 
 // BoardResponse represents the response structure for board operations
@@ -0,0 +1,125 @@
+package models
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/klauspost/compress/zstd"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
+)
+
+// BoardEncodingZstd marks a board whose contents are stored zstd-compressed
+// in boardZstd instead of as a document in board
+const BoardEncodingZstd = "zstd"
+
+// maxBoardDataSize bounds what a compressed board may expand to, well past
+// MongoDB's 16 MB document limit
+const maxBoardDataSize = 64 << 20
+
+// BoardCompressionThreshold is the BSON size from which board contents are
+// stored compressed; 0 stores them all as documents. Set at startup.
+var BoardCompressionThreshold atomic.Int64
+
+var (
+	boardEncoder, _ = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedDefault))
+	boardDecoder, _ = zstd.NewReader(nil, zstd.WithDecoderMaxMemory(maxBoardDataSize), zstd.WithDecoderConcurrency(0))
+)
+
+// storedBoardData wraps board contents, so they decode exactly as the board
+// field of a stored board does
+type storedBoardData struct {
+	BoardData map[string]interface{} `bson:"board"`
+}
+
+// EncodeBoardData compresses board contents as they are stored. It returns
+// nil when they are smaller than BoardCompressionThreshold, and should be
+// stored as a document. size is their BSON size either way.
+func EncodeBoardData(data map[string]interface{}) (packed []byte, size int64, err error) {
+	raw, err := bson.Marshal(storedBoardData{BoardData: data})
+	if err != nil {
+		return nil, 0, err
+	}
+	threshold := BoardCompressionThreshold.Load()
+	if threshold == 0 || int64(len(raw)) < threshold {
+		return nil, int64(len(raw)), nil
+	}
+	return boardEncoder.EncodeAll(raw, nil), int64(len(raw)), nil
+}
+
+// CompressedBoardSizes returns the BSON size of board contents and their
+// size compressed, whatever BoardCompressionThreshold is
+func CompressedBoardSizes(data map[string]interface{}) (size, compressed int64, err error) {
+	raw, err := bson.Marshal(storedBoardData{BoardData: data})
+	if err != nil {
+		return 0, 0, err
+	}
+	return int64(len(raw)), int64(len(boardEncoder.EncodeAll(raw, nil))), nil
+}
+
+// DecodeBoardData expands contents compressed by EncodeBoardData
+func DecodeBoardData(packed []byte) (map[string]interface{}, error) {
+	raw, err := boardDecoder.DecodeAll(packed, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error decompressing board: %w", err)
+	}
+	var stored storedBoardData
+	if err := bson.Unmarshal(raw, &stored); err != nil {
+		return nil, fmt.Errorf("error decoding board: %w", err)
+	}
+	return stored.BoardData, nil
+}
+
+// MarshalBSON stores the contents compressed once they pass
+// BoardCompressionThreshold
+func (b Board) MarshalBSON() ([]byte, error) {
+	type plain Board
+	stored := plain(b)
+	stored.BoardZstd, stored.BoardEncoding, stored.BoardSize = nil, "", 0
+
+	packed, size, err := EncodeBoardData(b.BoardData)
+	if err != nil {
+		return nil, err
+	}
+	if packed == nil {
+		return bson.Marshal(stored)
+	}
+
+	stored.BoardData = nil
+	stored.BoardZstd, stored.BoardEncoding, stored.BoardSize = packed, BoardEncodingZstd, size
+	raw, err := bson.Marshal(stored)
+	if err != nil {
+		return nil, err
+	}
+
+	// Leave out the board field rather than storing it as null
+	elements, err := bson.Raw(raw).Elements()
+	if err != nil {
+		return nil, err
+	}
+	index, doc := bsoncore.AppendDocumentStart(nil)
+	for _, element := range elements {
+		if element.Key() != "board" {
+			doc = append(doc, element...)
+		}
+	}
+	return bsoncore.AppendDocumentEnd(doc, index)
+}
+
+// UnmarshalBSON expands compressed contents into BoardData
+func (b *Board) UnmarshalBSON(data []byte) error {
+	type plain Board
+	if err := bson.Unmarshal(data, (*plain)(b)); err != nil {
+		return err
+	}
+	if b.BoardEncoding != BoardEncodingZstd || len(b.BoardZstd) == 0 {
+		return nil
+	}
+
+	boardData, err := DecodeBoardData(b.BoardZstd)
+	if err != nil {
+		return err
+	}
+	b.BoardData, b.BoardZstd = boardData, nil
+	return nil
+}
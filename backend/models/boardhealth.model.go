@@ -0,0 +1,19 @@
+package models
+
+// BoardHealth describes how big and complex a board has grown, so users can
+// tell when to split it
+type BoardHealth struct {
+	Shapes        int            `json:"shapes"`
+	ShapeTypes    map[string]int `json:"shapeTypes"` // Shape count by type
+	Texts         int            `json:"texts"`      // Shapes carrying text
+	Images        int            `json:"images"`     // Embedded images
+	HighResImages int            `json:"highResImages"`
+	AssetBytes    int64          `json:"assetBytes"`    // Decoded size of embedded images
+	DocumentBytes int64          `json:"documentBytes"` // Stored size of the board document
+	DocumentLimit int64          `json:"documentLimit"` // Largest document MongoDB will store
+	StorageBytes  int64          `json:"storageBytes"`  // Owner's storage in use across boards
+	StorageLimit  int64          `json:"storageLimit"`  // Owner's plan storage; 0 means unlimited
+	Versions      int64          `json:"versions"`      // Saved versions in the board's history
+	VersionLimit  int64          `json:"versionLimit"`  // Unlabelled versions kept
+	Warnings      []string       `json:"warnings"`
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Kinds of board tokens. Guest tokens come from opening a share link, embed
+// tokens are issued by the board owner for a site that embeds the board.
+const (
+	BoardTokenGuest = "guest"
+	BoardTokenEmbed = "embed"
+)
+
+// BoardTokenClaims is what a guest or embed token grants: read-only access
+// to one board, from one origin, until it expires. ShareLinkID is set on
+// guest tokens.
+type BoardTokenClaims struct {
+	ID          string
+	Kind        string
+	BoardID     primitive.ObjectID
+	Origin      string
+	ShareLinkID primitive.ObjectID
+	FrameID     string // Only this frame is shown, when set
+	IssuedAt    time.Time
+	ExpiresAt   time.Time
+}
+
+// EmbedToken records an embed token so the owner can list and revoke it.
+// The token itself is only returned when it is issued.
+type EmbedToken struct {
+	ID        string             `json:"id" bson:"_id"` // The token's jti
+	BoardID   primitive.ObjectID `json:"boardId" bson:"boardId"`
+	Origin    string             `json:"origin" bson:"origin"`
+	FrameID   string             `json:"frameId,omitempty" bson:"frameId,omitempty"`
+	CreatedBy primitive.ObjectID `json:"createdBy" bson:"createdBy"`
+	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
+	ExpiresAt time.Time          `json:"expiresAt" bson:"expiresAt"`
+	RevokedAt *time.Time         `json:"revokedAt,omitempty" bson:"revokedAt,omitempty"`
+}
+
+// RevokedBoardToken is an entry in the revocation list: a token ID, or
+// "link:<id>" for every guest token of a revoked share link. Entries are
+// dropped once the tokens they cover have expired.
+type RevokedBoardToken struct {
+	Subject   string    `bson:"_id"`
+	RevokedAt time.Time `bson:"revokedAt"`
+	ExpiresAt time.Time `bson:"expiresAt"`
+}
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// BoardVersion is a snapshot of a board's contents as saved at one version.
+// Old snapshots are pruned, unless they are labelled as milestones.
+type BoardVersion struct {
+	ID        primitive.ObjectID     `json:"_id" bson:"_id,omitempty"`
+	BoardID   primitive.ObjectID     `json:"boardId" bson:"boardId"`
+	Version   int64                  `json:"version" bson:"version"`
+	BoardData map[string]interface{} `json:"board,omitempty" bson:"board"`
+	AuthorID  *primitive.ObjectID    `json:"authorId,omitempty" bson:"authorId,omitempty"` // Unset for changes merged from a realtime session
+	Label     string                 `json:"label,omitempty" bson:"label,omitempty"`       // Set on milestones
+	Backup    string                 `json:"backup,omitempty" bson:"backup,omitempty"`     // Set on pre-operation backups: the operation that followed
+	LabeledBy *primitive.ObjectID    `json:"labeledBy,omitempty" bson:"labeledBy,omitempty"`
+	LabeledAt *time.Time             `json:"labeledAt,omitempty" bson:"labeledAt,omitempty"`
+	CreatedAt time.Time              `json:"createdAt" bson:"createdAt"`
+}
+
+// Operations a pre-operation backup is taken before
+const (
+	BackupBeforeRestore    = "restore"
+	BackupBeforeMerge      = "merge"
+	BackupBeforeBulkDelete = "bulk_delete"
+	BackupBeforeImport     = "import"
+)
+
+// BoardVersionLabelRequest represents the request structure for labelling a
+// version as a milestone
+type BoardVersionLabelRequest struct {
+	Label string `json:"label" binding:"required,max=100"`
+}
+
+// CreateBoardVersionRequest represents the request structure for saving
+// the current state as a version, optionally labelled
+type CreateBoardVersionRequest struct {
+	Label string `json:"label" binding:"max=100"`
+}
+
+// ShapeChange is a shape that differs between two versions
+type ShapeChange struct {
+	ID     string                 `json:"id"`
+	Fields []string               `json:"fields"` // Fields added, removed or changed
+	Before map[string]interface{} `json:"before"`
+	After  map[string]interface{} `json:"after"`
+}
+
+// BoardDiff describes how a board changed between two versions
+type BoardDiff struct {
+	Added   []map[string]interface{} `json:"added"`
+	Removed []map[string]interface{} `json:"removed"`
+	Changed []ShapeChange            `json:"changed"`
+}
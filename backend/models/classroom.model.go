@@ -0,0 +1,119 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Roster results
+const (
+	RosterStudentAdded    = "added"
+	RosterStudentNotFound = "not_found" // No account has the email
+	RosterStudentSkipped  = "skipped"   // Already on the roster, or the teacher
+)
+
+// Review states of a student's board. The student submits it, the teacher
+// reviews and grades it, or returns it for more work. Students edit their
+// board only while it is assigned; from submission on they can only view
+// it.
+const (
+	ReviewAssigned  = "assigned"
+	ReviewSubmitted = "submitted"
+	ReviewInReview  = "in_review"
+	ReviewGraded    = "graded"
+)
+
+// MaxGradingComments is as many grading comments as one student's board
+// can have
+const MaxGradingComments = 50
+
+// Classroom is a teacher's roster of students, each with their own board
+// started from the same template. The teacher owns every student board;
+// each is shared with its student alone, as an editor.
+type Classroom struct {
+	ID         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	OwnerID    primitive.ObjectID `json:"ownerId" bson:"ownerId"`
+	Name       string             `json:"name" bson:"name"`
+	TemplateID primitive.ObjectID `json:"templateId" bson:"templateId"`
+	Students   []ClassroomStudent `json:"students" bson:"students"`
+	CreatedAt  time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedAt  time.Time          `json:"updatedAt" bson:"updatedAt"`
+}
+
+// ClassroomStudent is a student on a roster, the board made for them and
+// where its review stands. Grading comments are for the teacher alone; the
+// student sees the grade and feedback once graded.
+type ClassroomStudent struct {
+	UserID      primitive.ObjectID `json:"userId" bson:"userId"`
+	Email       string             `json:"email" bson:"email"` // As on the roster
+	BoardID     primitive.ObjectID `json:"boardId" bson:"boardId"`
+	Status      string             `json:"status" bson:"status,omitempty"` // ReviewAssigned when empty
+	SubmittedAt *time.Time         `json:"submittedAt,omitempty" bson:"submittedAt,omitempty"`
+	GradedAt    *time.Time         `json:"gradedAt,omitempty" bson:"gradedAt,omitempty"`
+	Grade       string             `json:"grade,omitempty" bson:"grade,omitempty"`
+	Feedback    string             `json:"feedback,omitempty" bson:"feedback,omitempty"`
+	Comments    []GradingComment   `json:"comments,omitempty" bson:"comments,omitempty"`
+}
+
+// GradingComment is a teacher's note on a student's board, optionally
+// pinned to a shape or a point on it
+type GradingComment struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id"`
+	Text      string             `json:"text" bson:"text"`
+	ShapeID   string             `json:"shapeId,omitempty" bson:"shapeId,omitempty"`
+	X         *float64           `json:"x,omitempty" bson:"x,omitempty"`
+	Y         *float64           `json:"y,omitempty" bson:"y,omitempty"`
+	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
+}
+
+// ReviewRequest represents the request structure for moving a student's
+// board on: into review, graded (with a grade) or back to the student
+type ReviewRequest struct {
+	Status   string `json:"status" binding:"required,oneof=in_review graded assigned"`
+	Grade    string `json:"grade" binding:"max=50"`
+	Feedback string `json:"feedback" binding:"max=5000"`
+}
+
+// GradingCommentRequest represents the request structure for adding a
+// grading comment
+type GradingCommentRequest struct {
+	Text    string   `json:"text" binding:"required,max=1000"`
+	ShapeID string   `json:"shapeId" binding:"max=100"`
+	X       *float64 `json:"x"`
+	Y       *float64 `json:"y"`
+}
+
+// ClassroomRequest represents the request structure for creating a
+// classroom. The roster is emails, roster (the text of a roster file: one
+// email per line or separated by commas), or both.
+type ClassroomRequest struct {
+	Name       string   `json:"name" binding:"required,max=200"`
+	TemplateID string   `json:"templateId" binding:"required"`
+	Emails     []string `json:"emails" binding:"max=500"`
+	Roster     string   `json:"roster" binding:"max=100000"`
+}
+
+// RosterRequest represents the request structure for adding students to a
+// classroom, as in ClassroomRequest
+type RosterRequest struct {
+	Emails []string `json:"emails" binding:"max=500"`
+	Roster string   `json:"roster" binding:"max=100000"`
+}
+
+// RosterResult is what became of one email of a roster
+type RosterResult struct {
+	Email   string `json:"email"`
+	Status  string `json:"status"`
+	BoardID string `json:"boardId,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// StudentActivity sums up a student's own activity on their board
+type StudentActivity struct {
+	Saves        int        `json:"saves" bson:"saves"`
+	Added        int        `json:"added" bson:"added"`
+	Changed      int        `json:"changed" bson:"changed"`
+	Removed      int        `json:"removed" bson:"removed"`
+	LastActiveAt *time.Time `json:"lastActiveAt,omitempty" bson:"lastActiveAt,omitempty"`
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CORSTenant is a tenant's list of frontend origins allowed to call the API,
+// kept in MongoDB so it can change without a deploy. Each vanity domain is
+// allowed as https://<domain>.
+type CORSTenant struct {
+	Tenant        string             `json:"tenant" bson:"_id"`
+	Origins       []string           `json:"origins" bson:"origins"`
+	VanityDomains []string           `json:"vanityDomains" bson:"vanityDomains"`
+	UpdatedBy     primitive.ObjectID `json:"updatedBy" bson:"updatedBy"`
+	CreatedAt     time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedAt     time.Time          `json:"updatedAt" bson:"updatedAt"`
+}
+
+// CORSTenantRequest represents the request structure for setting a tenant's
+// allowed origins. Origins are exact (https://app.example.com), with a *
+// standing for one subdomain label (https://*.vercel.app), or a /regex/.
+type CORSTenantRequest struct {
+	Origins       []string `json:"origins" binding:"max=100"`
+	VanityDomains []string `json:"vanityDomains" binding:"max=100"`
+}
+
+// RejectedOrigin counts the requests refused from one origin, to debug
+// frontend CORS failures
+type RejectedOrigin struct {
+	Origin     string    `json:"origin"`
+	Count      int64     `json:"count"`
+	Preflights int64     `json:"preflights"` // Of Count, preflight requests
+	LastMethod string    `json:"lastMethod"` // Requested method, for preflights
+	LastPath   string    `json:"lastPath"`
+	LastSeen   time.Time `json:"lastSeen"`
+}
+
+// CORSMetrics counts cross-origin requests since the instance started.
+// Allowed preflights carry Access-Control-Max-Age, so browsers cache them
+// for MaxAgeSeconds; a high preflight count means that cache isn't used.
+type CORSMetrics struct {
+	Allowed            int64            `json:"allowed"`
+	AllowedPreflights  int64            `json:"allowedPreflights"`
+	Rejected           int64            `json:"rejected"`
+	RejectedPreflights int64            `json:"rejectedPreflights"`
+	MaxAgeSeconds      int64            `json:"maxAgeSeconds"`
+	RejectedOrigins    []RejectedOrigin `json:"rejectedOrigins"` // Most rejected first
+}
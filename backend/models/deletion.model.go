@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// What a pending deletion removes
+const (
+	DeletionKindAccount = "account"
+	DeletionKindBoard   = "board"
+)
+
+// PendingDeletion is an account or board deletion waiting out its grace
+// period. The owner is emailed a single-use token that cancels it, or
+// carries it out at once; only a hash of the token is stored. The document
+// goes once the deletion is carried out or canceled.
+type PendingDeletion struct {
+	ID        primitive.ObjectID  `json:"_id" bson:"_id,omitempty"`
+	Kind      string              `json:"kind" bson:"kind"`
+	UserID    primitive.ObjectID  `json:"userId" bson:"userId"` // The account, or the board's owner
+	BoardID   *primitive.ObjectID `json:"boardId,omitempty" bson:"boardId,omitempty"`
+	TokenHash string              `json:"-" bson:"tokenHash"`
+	DeleteAt  time.Time           `json:"deleteAt" bson:"deleteAt"`
+	CreatedAt time.Time           `json:"createdAt" bson:"createdAt"`
+	ClaimedAt *time.Time          `json:"-" bson:"claimedAt,omitempty"` // By the instance carrying it out
+}
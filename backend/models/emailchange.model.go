@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// EmailChange is a single-use, time-limited token confirming that a user
+// owns the address they asked to move their account to. Only a hash of the
+// token is stored; the account keeps its old address until it is used.
+type EmailChange struct {
+	ID        primitive.ObjectID `json:"_id" bson:"_id,omitempty"`
+	UserID    primitive.ObjectID `json:"userId" bson:"userId"`
+	Email     string             `json:"email" bson:"email"` // The new address
+	TokenHash string             `json:"-" bson:"tokenHash"`
+	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
+	ExpiresAt time.Time          `json:"expiresAt" bson:"expiresAt"`
+	UsedAt    *time.Time         `json:"usedAt,omitempty" bson:"usedAt,omitempty"`
+}
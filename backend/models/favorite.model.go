@@ -0,0 +1,16 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Favorite is a board a user starred. Stars are per user, so everyone a
+// board is shared with stars it independently.
+type Favorite struct {
+	ID        primitive.ObjectID `json:"-" bson:"_id,omitempty"`
+	UserID    primitive.ObjectID `json:"-" bson:"userId"`
+	BoardID   primitive.ObjectID `json:"boardId" bson:"boardId"`
+	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
+}
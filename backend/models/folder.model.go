@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Folder groups a user's own boards on their dashboard. A board is in at
+// most one folder.
+type Folder struct {
+	ID        primitive.ObjectID `json:"_id" bson:"_id,omitempty"`
+	OwnerID   primitive.ObjectID `json:"ownerId" bson:"ownerId"`
+	Name      string             `json:"name" bson:"name"`
+	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedAt time.Time          `json:"updatedAt" bson:"updatedAt"`
+}
+
+// FolderRequest represents the request structure for creating or renaming
+// a folder
+type FolderRequest struct {
+	Name string `json:"name" binding:"required,max=100"`
+}
@@ -0,0 +1,16 @@
+package models
+
+// Dependency statuses reported by the readiness check
+const (
+	DependencyUp   = "up"
+	DependencyDown = "down"
+)
+
+// DependencyHealth is how a service the API relies on answered the
+// readiness check
+type DependencyHealth struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latencyMs"`       // Round trip of the check
+	Error     string  `json:"error,omitempty"` // Why it is down
+}
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Sign-in providers an account can be linked to
+const (
+	ProviderApple  = "apple"
+	ProviderGitHub = "github"
+)
+
+// Identity links a user to their account at a sign-in provider. A user has
+// at most one identity per provider.
+type Identity struct {
+	ID        primitive.ObjectID `json:"-" bson:"_id,omitempty"`
+	UserID    primitive.ObjectID `json:"-" bson:"userId"`
+	Provider  string             `json:"provider" bson:"provider"`
+	Subject   string             `json:"-" bson:"subject"` // The provider's stable user ID
+	Email     string             `json:"email,omitempty" bson:"email,omitempty"`
+	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
+}
+
+// ExternalProfile is what a provider tells us about the user who signed in
+type ExternalProfile struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+}
+
+// OAuthState tracks a sign-in started with a provider until it calls back.
+// Only a hash of the state parameter is stored. UserID is set when a
+// signed-in user is linking the provider rather than signing in.
+type OAuthState struct {
+	ID        primitive.ObjectID  `bson:"_id,omitempty"`
+	StateHash string              `bson:"stateHash"`
+	Provider  string              `bson:"provider"`
+	Nonce     string              `bson:"nonce"`
+	UserID    *primitive.ObjectID `bson:"userId,omitempty"`
+	ExpiresAt time.Time           `bson:"expiresAt"`
+}
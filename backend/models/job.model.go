@@ -0,0 +1,54 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Kinds of work run in worker pools, which are also the pools' names
+const (
+	JobKindExport      = "export"
+	JobKindImport      = "import"
+	JobKindAI          = "ai"
+	JobKindThumbnail   = "thumbnail"
+	JobKindMaintenance = "maintenance"
+)
+
+// Job statuses
+const (
+	JobPending   = "pending" // Queued or running
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+)
+
+// Job is a request that outran its synchronous budget and finishes in the
+// background. Its result is the response the request would have had.
+type Job struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID      primitive.ObjectID `json:"-" bson:"userId"`
+	Kind        string             `json:"kind" bson:"kind"`
+	Status      string             `json:"status" bson:"status"`
+	Progress    int                `json:"progress" bson:"progress"`                         // Percent done
+	StatusCode  int                `json:"statusCode,omitempty" bson:"statusCode,omitempty"` // Of the result
+	ContentType string             `json:"-" bson:"contentType,omitempty"`
+	Filename    string             `json:"-" bson:"filename,omitempty"`
+	Headers     map[string]string  `json:"-" bson:"headers,omitempty"`
+	Result      []byte             `json:"-" bson:"result,omitempty"`
+	Error       string             `json:"error,omitempty" bson:"error,omitempty"`
+	CreatedAt   time.Time          `json:"createdAt" bson:"createdAt"`
+	FinishedAt  *time.Time         `json:"finishedAt,omitempty" bson:"finishedAt,omitempty"`
+	ExpiresAt   time.Time          `json:"expiresAt" bson:"expiresAt"`
+}
+
+// WorkerPoolStats is a worker pool's load on this instance
+type WorkerPoolStats struct {
+	Name      string `json:"name"`
+	Limit     int    `json:"limit"`     // Tasks run at once
+	MaxQueued int    `json:"maxQueued"` // Tasks that may wait for a slot
+	Running   int64  `json:"running"`
+	Queued    int64  `json:"queued"`
+	Completed int64  `json:"completed"` // Since start
+	Rejected  int64  `json:"rejected"`  // Turned away with a full queue
+	Deferred  int64  `json:"deferred"`  // Answered with a job ID
+}
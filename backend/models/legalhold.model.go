@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Legal hold target types
+const (
+	LegalHoldTargetBoard = "board"
+	LegalHoldTargetUser  = "user"
+)
+
+// LegalHold blocks deletion of a board, or of everything a user owns, while
+// it is active. Released holds are kept so the collection doubles as the
+// audit trail of who placed and lifted each hold and why.
+type LegalHold struct {
+	ID         primitive.ObjectID  `json:"_id" bson:"_id,omitempty"`
+	TargetType string              `json:"targetType" bson:"targetType"`
+	TargetID   primitive.ObjectID  `json:"targetId" bson:"targetId"`
+	Reason     string              `json:"reason" bson:"reason"`
+	PlacedBy   primitive.ObjectID  `json:"placedBy" bson:"placedBy"`
+	CreatedAt  time.Time           `json:"createdAt" bson:"createdAt"`
+	ExpiresAt  *time.Time          `json:"expiresAt,omitempty" bson:"expiresAt,omitempty"`
+	ReleasedAt *time.Time          `json:"releasedAt,omitempty" bson:"releasedAt,omitempty"`
+	ReleasedBy *primitive.ObjectID `json:"releasedBy,omitempty" bson:"releasedBy,omitempty"`
+}
+
+// LegalHoldRequest represents the request structure for placing a hold
+type LegalHoldRequest struct {
+	TargetType string     `json:"targetType" binding:"required,oneof=board user"`
+	TargetID   string     `json:"targetId" binding:"required"`
+	Reason     string     `json:"reason" binding:"required"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+}
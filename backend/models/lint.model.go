@@ -0,0 +1,50 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Lint issue kinds
+const (
+	LintKindSpelling    = "spelling"
+	LintKindTerminology = "terminology"
+)
+
+// TermRule asks for Preferred to be used instead of any of the Avoid
+// phrases
+type TermRule struct {
+	Preferred string   `json:"preferred" bson:"preferred" binding:"required"`
+	Avoid     []string `json:"avoid" bson:"avoid" binding:"required,min=1,dive,required"`
+}
+
+// LintDictionary holds a board owner's accepted words and terminology
+// rules. Everyone linting the owner's boards uses it.
+type LintDictionary struct {
+	ID        primitive.ObjectID `json:"_id" bson:"_id,omitempty"`
+	OwnerID   primitive.ObjectID `json:"ownerId" bson:"ownerId"`
+	Words     []string           `json:"words" bson:"words"`
+	Terms     []TermRule         `json:"terms" bson:"terms"`
+	UpdatedAt time.Time          `json:"updatedAt" bson:"updatedAt"`
+}
+
+// LintDictionaryRequest represents the request structure for replacing a
+// lint dictionary
+type LintDictionaryRequest struct {
+	Words []string   `json:"words" binding:"max=5000"`
+	Terms []TermRule `json:"terms" binding:"max=500,dive"`
+}
+
+// LintIssue is one suggestion anchored to a piece of a shape's text.
+// Offset and Length count characters (runes).
+type LintIssue struct {
+	ShapeID     string   `json:"shapeId"`
+	Field       string   `json:"field"`
+	Offset      int      `json:"offset"`
+	Length      int      `json:"length"`
+	Text        string   `json:"text"`
+	Kind        string   `json:"kind"`
+	Message     string   `json:"message"`
+	Suggestions []string `json:"suggestions"`
+}
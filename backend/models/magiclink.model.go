@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MagicLink is a single-use, time-limited sign-in token sent by email. Only
+// a hash of the token is stored. UserID is unset when the link will create
+// the account on first use.
+type MagicLink struct {
+	ID        primitive.ObjectID  `json:"_id" bson:"_id,omitempty"`
+	Email     string              `json:"email" bson:"email"`
+	UserID    *primitive.ObjectID `json:"userId,omitempty" bson:"userId,omitempty"`
+	Locale    string              `json:"locale,omitempty" bson:"locale,omitempty"` // For the account created on first use
+	TokenHash string              `json:"-" bson:"tokenHash"`
+	CreatedAt time.Time           `json:"createdAt" bson:"createdAt"`
+	ExpiresAt time.Time           `json:"expiresAt" bson:"expiresAt"`
+	UsedAt    *time.Time          `json:"usedAt,omitempty" bson:"usedAt,omitempty"`
+}
@@ -0,0 +1,79 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// OAuth scopes a third-party app can be granted. boards:write implies
+// boards:read.
+const (
+	ScopeBoardsRead  = "boards:read"
+	ScopeBoardsWrite = "boards:write"
+	ScopeProfile     = "profile"
+)
+
+// OAuthScopes lists every scope, in the order they are shown to users
+var OAuthScopes = []string{ScopeBoardsRead, ScopeBoardsWrite, ScopeProfile}
+
+// OAuthClient is a third-party app registered by a user. Its ID is the
+// OAuth client_id. Public clients (mobile and single-page apps) have no
+// secret and must use PKCE.
+type OAuthClient struct {
+	ID           primitive.ObjectID `json:"clientId" bson:"_id,omitempty"`
+	OwnerID      primitive.ObjectID `json:"ownerId" bson:"ownerId"`
+	Name         string             `json:"name" bson:"name"`
+	RedirectURIs []string           `json:"redirectUris" bson:"redirectUris"`
+	Scopes       []string           `json:"scopes" bson:"scopes"` // The most the app may ask for
+	Public       bool               `json:"public" bson:"public"`
+	SecretHash   string             `json:"-" bson:"secretHash,omitempty"`
+	CreatedAt    time.Time          `json:"createdAt" bson:"createdAt"`
+}
+
+// OAuthCode is a one-time authorization code handed to an app after the
+// user approved it. Only a hash of the code is stored.
+type OAuthCode struct {
+	ID                  primitive.ObjectID `bson:"_id,omitempty"`
+	CodeHash            string             `bson:"codeHash"`
+	ClientID            primitive.ObjectID `bson:"clientId"`
+	UserID              primitive.ObjectID `bson:"userId"`
+	RedirectURI         string             `bson:"redirectUri"`
+	Scopes              []string           `bson:"scopes"`
+	CodeChallenge       string             `bson:"codeChallenge,omitempty"`
+	CodeChallengeMethod string             `bson:"codeChallengeMethod,omitempty"`
+	ExpiresAt           time.Time          `bson:"expiresAt"`
+	UsedAt              *time.Time         `bson:"usedAt,omitempty"`
+}
+
+// OAuthGrant records the scopes a user approved for an app, so they can see
+// and revoke the apps connected to their account
+type OAuthGrant struct {
+	ID        primitive.ObjectID `json:"-" bson:"_id,omitempty"`
+	UserID    primitive.ObjectID `json:"-" bson:"userId"`
+	ClientID  primitive.ObjectID `json:"clientId" bson:"clientId"`
+	Scopes    []string           `json:"scopes" bson:"scopes"`
+	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedAt time.Time          `json:"updatedAt" bson:"updatedAt"`
+}
+
+// OAuthClientRequest represents the request structure for registering an
+// app. Scopes defaults to every scope.
+type OAuthClientRequest struct {
+	Name         string   `json:"name" binding:"required,max=100"`
+	RedirectURIs []string `json:"redirectUris" binding:"required,min=1,max=10,dive,url"`
+	Scopes       []string `json:"scopes" binding:"omitempty,dive,oneof=boards:read boards:write profile"`
+	Public       bool     `json:"public"`
+}
+
+// OAuthAuthorizeRequest is the user's approval of an app's authorization
+// request, sent by the consent screen with the parameters the app passed
+type OAuthAuthorizeRequest struct {
+	ClientID            string `json:"client_id" form:"client_id" binding:"required"`
+	RedirectURI         string `json:"redirect_uri" form:"redirect_uri" binding:"required"`
+	ResponseType        string `json:"response_type" form:"response_type" binding:"required,eq=code"`
+	Scope               string `json:"scope" form:"scope"`
+	State               string `json:"state" form:"state"`
+	CodeChallenge       string `json:"code_challenge" form:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method" form:"code_challenge_method"`
+}
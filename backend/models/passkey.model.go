@@ -0,0 +1,108 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// WebAuthn ceremonies a challenge is issued for
+const (
+	WebAuthnRegistration   = "registration"
+	WebAuthnAuthentication = "authentication"
+)
+
+// Passkey is a WebAuthn credential a user registered to sign in with. Only
+// its public key is stored.
+type Passkey struct {
+	ID           primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID       primitive.ObjectID `json:"-" bson:"userId"`
+	CredentialID string             `json:"-" bson:"credentialId"` // base64url, as the browser reports it
+	PublicKey    []byte             `json:"-" bson:"publicKey"`    // COSE_Key from the authenticator
+	Algorithm    int64              `json:"algorithm" bson:"algorithm"`
+	SignCount    uint32             `json:"-" bson:"signCount"`
+	Name         string             `json:"name" bson:"name"`
+	Transports   []string           `json:"transports,omitempty" bson:"transports,omitempty"`
+	Synced       bool               `json:"synced" bson:"synced"` // Backed up to the user's cloud keychain
+	CreatedAt    time.Time          `json:"createdAt" bson:"createdAt"`
+	LastUsedAt   *time.Time         `json:"lastUsedAt,omitempty" bson:"lastUsedAt,omitempty"`
+}
+
+// WebAuthnChallenge is an outstanding registration or sign-in ceremony.
+// Only a hash of the challenge is stored. UserID is set for registrations
+// and for sign-ins started with an email.
+type WebAuthnChallenge struct {
+	ID            primitive.ObjectID  `bson:"_id,omitempty"`
+	ChallengeHash string              `bson:"challengeHash"`
+	Ceremony      string              `bson:"ceremony"`
+	UserID        *primitive.ObjectID `bson:"userId,omitempty"`
+	ExpiresAt     time.Time           `bson:"expiresAt"`
+}
+
+// PasskeyCredential is the browser's PublicKeyCredential as JSON
+// (PublicKeyCredential.toJSON()), with binary fields base64url encoded
+type PasskeyCredential struct {
+	ID       string                    `json:"id" binding:"required"`
+	RawID    string                    `json:"rawId"`
+	Type     string                    `json:"type" binding:"required"`
+	Response PasskeyCredentialResponse `json:"response"`
+}
+
+// PasskeyCredentialResponse holds the authenticator's response: an
+// attestation when registering, an assertion when signing in
+type PasskeyCredentialResponse struct {
+	ClientDataJSON    string   `json:"clientDataJSON" binding:"required"`
+	AttestationObject string   `json:"attestationObject,omitempty"`
+	Transports        []string `json:"transports,omitempty"`
+	AuthenticatorData string   `json:"authenticatorData,omitempty"`
+	Signature         string   `json:"signature,omitempty"`
+	UserHandle        string   `json:"userHandle,omitempty"`
+}
+
+// PasskeyDescriptor identifies a credential in ceremony options
+type PasskeyDescriptor struct {
+	Type       string   `json:"type"`
+	ID         string   `json:"id"`
+	Transports []string `json:"transports,omitempty"`
+}
+
+// PasskeyAlgorithm is a signature algorithm (COSE identifier) the server
+// accepts for new passkeys
+type PasskeyAlgorithm struct {
+	Type string `json:"type"`
+	Alg  int64  `json:"alg"`
+}
+
+// PasskeyCreationOptions are the publicKey options for
+// navigator.credentials.create(), binary fields base64url encoded
+type PasskeyCreationOptions struct {
+	Challenge string `json:"challenge"`
+	RP        struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"rp"`
+	User struct {
+		ID          string `json:"id"`
+		Name        string `json:"name"`
+		DisplayName string `json:"displayName"`
+	} `json:"user"`
+	PubKeyCredParams       []PasskeyAlgorithm  `json:"pubKeyCredParams"`
+	Timeout                int64               `json:"timeout"`
+	Attestation            string              `json:"attestation"`
+	ExcludeCredentials     []PasskeyDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection struct {
+		ResidentKey      string `json:"residentKey"`
+		UserVerification string `json:"userVerification"`
+	} `json:"authenticatorSelection"`
+}
+
+// PasskeyRequestOptions are the publicKey options for
+// navigator.credentials.get(). Without allowCredentials the browser offers
+// the passkeys it has for the site.
+type PasskeyRequestOptions struct {
+	Challenge        string              `json:"challenge"`
+	RPID             string              `json:"rpId"`
+	Timeout          int64               `json:"timeout"`
+	UserVerification string              `json:"userVerification"`
+	AllowCredentials []PasskeyDescriptor `json:"allowCredentials,omitempty"`
+}
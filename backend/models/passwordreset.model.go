@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// PasswordReset is a single-use, time-limited password reset token. Only a
+// hash of the token is stored.
+type PasswordReset struct {
+	ID        primitive.ObjectID `json:"_id" bson:"_id,omitempty"`
+	UserID    primitive.ObjectID `json:"userId" bson:"userId"`
+	TokenHash string             `json:"-" bson:"tokenHash"`
+	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
+	ExpiresAt time.Time          `json:"expiresAt" bson:"expiresAt"`
+	UsedAt    *time.Time         `json:"usedAt,omitempty" bson:"usedAt,omitempty"`
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Kinds of notifications. Each push subscription can pick the kinds it
+// receives; test pushes always go through.
+const (
+	NotificationShare   = "share"
+	NotificationComment = "comment"
+	NotificationMention = "mention"
+	NotificationTest    = "test"
+)
+
+// NotificationKinds are the kinds a subscription can choose from
+var NotificationKinds = []string{NotificationShare, NotificationComment, NotificationMention}
+
+// Notification is what the pipeline delivers: the JSON payload of a web
+// push, which the app's service worker shows
+type Notification struct {
+	Kind    string `json:"kind"`
+	Title   string `json:"title"`
+	Body    string `json:"body,omitempty"`
+	URL     string `json:"url,omitempty"`
+	BoardID string `json:"boardId,omitempty"`
+	Tag     string `json:"tag,omitempty"` // Replaces an earlier notification with the same tag
+}
+
+// PushSubscription is one browser's Web Push subscription. Endpoints are
+// unique: subscribing again from the same browser updates its keys.
+type PushSubscription struct {
+	ID         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID     primitive.ObjectID `json:"-" bson:"userId"`
+	Endpoint   string             `json:"endpoint" bson:"endpoint"`
+	P256dh     string             `json:"-" bson:"p256dh"` // base64url, the browser's ECDH public key
+	Auth       string             `json:"-" bson:"auth"`   // base64url, the browser's auth secret
+	Name       string             `json:"name" bson:"name"`
+	Kinds      []string           `json:"kinds" bson:"kinds"` // Empty for every kind
+	CreatedAt  time.Time          `json:"createdAt" bson:"createdAt"`
+	LastSentAt *time.Time         `json:"lastSentAt,omitempty" bson:"lastSentAt,omitempty"`
+}
+
+// PushSubscriptionKeys are the keys of a browser's PushSubscription.toJSON()
+type PushSubscriptionKeys struct {
+	P256dh string `json:"p256dh" binding:"required"`
+	Auth   string `json:"auth" binding:"required"`
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// RefreshToken is a long-lived credential that can be exchanged for a new
+// access token. Only a hash of the token is stored. Tokens issued by
+// rotating one another share a FamilyID, so reuse of a rotated token can
+// revoke the whole chain. Tokens issued to an OAuth app carry its client
+// and the granted scopes.
+type RefreshToken struct {
+	ID        primitive.ObjectID `json:"_id" bson:"_id,omitempty"`
+	UserID    primitive.ObjectID `json:"userId" bson:"userId"`
+	TokenHash string             `json:"-" bson:"tokenHash"`
+	FamilyID  string             `json:"familyId" bson:"familyId"`
+	ClientID  primitive.ObjectID `json:"-" bson:"clientId,omitempty"`
+	Scopes    []string           `json:"-" bson:"scopes,omitempty"`
+	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
+	ExpiresAt time.Time          `json:"expiresAt" bson:"expiresAt"`
+	RevokedAt *time.Time         `json:"revokedAt,omitempty" bson:"revokedAt,omitempty"`
+}
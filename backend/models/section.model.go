@@ -0,0 +1,61 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Section is a named part of a board. Shapes join it by their sectionId
+// field, as they join groups by groupId; the board keeps the section's
+// name and whether it is locked. Nobody can change the shapes of a locked
+// section, the owner included, until it is unlocked.
+type Section struct {
+	ID        string             `json:"id" bson:"id"`
+	Name      string             `json:"name" bson:"name"`
+	Locked    bool               `json:"locked" bson:"locked"`
+	CreatedBy primitive.ObjectID `json:"createdBy" bson:"createdBy"`
+	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
+}
+
+// SectionState is how one user left a section. It is kept apart from the
+// board, so everyone collapses sections independently and collapsing one
+// isn't a change to the board.
+type SectionState struct {
+	ID        primitive.ObjectID `json:"-" bson:"_id,omitempty"`
+	UserID    primitive.ObjectID `json:"-" bson:"userId"`
+	BoardID   primitive.ObjectID `json:"boardId" bson:"boardId"`
+	SectionID string             `json:"sectionId" bson:"sectionId"`
+	Collapsed bool               `json:"collapsed" bson:"collapsed"`
+	UpdatedAt time.Time          `json:"updatedAt" bson:"updatedAt"`
+}
+
+// CreateSectionRequest represents the request structure for gathering
+// shapes into a new section, applied as one new version. Shapes leave the
+// section they were in.
+type CreateSectionRequest struct {
+	Name            string   `json:"name" binding:"required,max=200"`
+	ShapeIDs        []string `json:"shapeIds" binding:"required,min=1,max=5000"`
+	ExpectedVersion *int64   `json:"expectedVersion"` // If-Match also works
+}
+
+// UpdateSectionRequest represents the request structure for renaming,
+// locking or unlocking a section. Fields left out are kept.
+type UpdateSectionRequest struct {
+	Name   *string `json:"name" binding:"omitempty,min=1,max=200"`
+	Locked *bool   `json:"locked"`
+}
+
+// MoveSectionRequest represents the request structure for moving every
+// shape of a section by the same offset, applied as one new version
+type MoveSectionRequest struct {
+	DX              float64 `json:"dx" binding:"min=-1000000,max=1000000"`
+	DY              float64 `json:"dy" binding:"min=-1000000,max=1000000"`
+	ExpectedVersion *int64  `json:"expectedVersion"` // If-Match also works
+}
+
+// SectionCollapseRequest represents the request structure for collapsing
+// or expanding a section for yourself
+type SectionCollapseRequest struct {
+	Collapsed *bool `json:"collapsed" binding:"required"`
+}
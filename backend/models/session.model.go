@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Session is one sign-in of the first-party app, on one device. Its
+// refresh tokens form the family FamilyID, and the access tokens issued
+// for it carry its ID, so revoking it signs that device out at once.
+// LastSeenAt and IP follow the device each time it refreshes its token.
+type Session struct {
+	ID         primitive.ObjectID `json:"id" bson:"_id"`
+	UserID     primitive.ObjectID `json:"-" bson:"userId"`
+	FamilyID   string             `json:"-" bson:"familyId"`
+	Device     string             `json:"device" bson:"device"` // Browser and OS, from the User-Agent
+	UserAgent  string             `json:"userAgent" bson:"userAgent"`
+	IP         string             `json:"ip" bson:"ip"`
+	CreatedAt  time.Time          `json:"createdAt" bson:"createdAt"`
+	LastSeenAt time.Time          `json:"lastSeenAt" bson:"lastSeenAt"`
+	ExpiresAt  time.Time          `json:"expiresAt" bson:"expiresAt"` // With its newest refresh token
+	RevokedAt  *time.Time         `json:"revokedAt,omitempty" bson:"revokedAt,omitempty"`
+	Current    bool               `json:"current,omitempty" bson:"-"` // The session of the request listing it
+}
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// IndexedShape is one shape of a large board in the shape index, with its
+// bounding box, so viewport queries don't have to load the whole board
+type IndexedShape struct {
+	ID       primitive.ObjectID     `bson:"_id,omitempty"`
+	BoardID  primitive.ObjectID     `bson:"boardId"`
+	Version  int64                  `bson:"version"`  // Board version the entry was built from
+	Order    int                    `bson:"order"`    // Position in the board's shape list, for drawing order
+	Location [2]float64             `bson:"location"` // Top-left corner, clamped to the 2d index range
+	MinX     float64                `bson:"minX"`
+	MinY     float64                `bson:"minY"`
+	MaxX     float64                `bson:"maxX"`
+	MaxY     float64                `bson:"maxY"`
+	Shape    map[string]interface{} `bson:"shape"`
+}
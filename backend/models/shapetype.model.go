@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ShapeTypeSchema is a custom shape type registered by an admin, whose shapes
+// are validated against a JSON Schema. The schema is stored as JSON text,
+// since keywords like "$schema" aren't valid MongoDB field names.
+type ShapeTypeSchema struct {
+	Type        string                 `json:"type" bson:"_id"`
+	Description string                 `json:"description,omitempty" bson:"description,omitempty"`
+	Schema      map[string]interface{} `json:"schema" bson:"-"`
+	SchemaJSON  string                 `json:"-" bson:"schema"`
+	UpdatedBy   primitive.ObjectID     `json:"updatedBy" bson:"updatedBy"`
+	CreatedAt   time.Time              `json:"createdAt" bson:"createdAt"`
+	UpdatedAt   time.Time              `json:"updatedAt" bson:"updatedAt"`
+}
+
+// ShapeTypeSchemaRequest represents the request structure for registering
+// or replacing a custom shape type
+type ShapeTypeSchemaRequest struct {
+	Description string                 `json:"description" binding:"max=500"`
+	Schema      map[string]interface{} `json:"schema" binding:"required"`
+}
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ShareLink gives anyone holding its token read-only access to a board
+// without an account. Only hashes of the link and revoke tokens are stored.
+type ShareLink struct {
+	ID                primitive.ObjectID `json:"_id" bson:"_id,omitempty"`
+	BoardID           primitive.ObjectID `json:"boardId" bson:"boardId"`
+	OwnerID           primitive.ObjectID `json:"ownerId" bson:"ownerId"`
+	TokenHash         string             `json:"-" bson:"tokenHash"`
+	RevokeTokenHashes []string           `json:"-" bson:"revokeTokenHashes,omitempty"`       // One-click revoke links sent in alerts
+	AlertThreshold    int64              `json:"alertThreshold" bson:"alertThreshold"`       // Alert once uses exceed this; 0 = off
+	AlertNewCountry   bool               `json:"alertNewCountry" bson:"alertNewCountry"`     // Alert on uses from a country not seen before
+	FrameID           string             `json:"frameId,omitempty" bson:"frameId,omitempty"` // Only this frame is shown, when set
+	UseCount          int64              `json:"useCount" bson:"useCount"`
+	Countries         []string           `json:"countries" bson:"countries"`
+	LastUsedAt        *time.Time         `json:"lastUsedAt,omitempty" bson:"lastUsedAt,omitempty"`
+	CreatedAt         time.Time          `json:"createdAt" bson:"createdAt"`
+	RevokedAt         *time.Time         `json:"revokedAt,omitempty" bson:"revokedAt,omitempty"`
+}
+
+// ShareLinkUse records one time a share link was opened
+type ShareLinkUse struct {
+	ID       primitive.ObjectID `json:"-" bson:"_id,omitempty"`
+	LinkID   primitive.ObjectID `json:"-" bson:"linkId"`
+	UsedAt   time.Time          `json:"usedAt" bson:"usedAt"`
+	Country  string             `json:"country,omitempty" bson:"country,omitempty"`   // ISO country code, when known
+	Referrer string             `json:"referrer,omitempty" bson:"referrer,omitempty"` // Referring page, without query string
+}
+
+// ShareLinkRequest represents the request structure for creating a share
+// link. All fields are optional.
+type ShareLinkRequest struct {
+	AlertThreshold  int64 `json:"alertThreshold" binding:"gte=0"`
+	AlertNewCountry bool  `json:"alertNewCountry"`
+	// FrameID scopes the link to one frame of the board: viewers see only
+	// the frame and what lies inside it
+	FrameID string `json:"frameId" binding:"max=200"`
+}
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// What a short link opens
+const (
+	ShortLinkTargetBoard  = "board"  // The board in the app, for those who can open it
+	ShortLinkTargetShare  = "share"  // The board through one of its share links
+	ShortLinkTargetExport = "export" // The board exported, for anyone holding the link
+)
+
+// ShortLink is a compact /s/:code URL to a board, a share link or an
+// export of a board. Codes are short enough to type from a printout, so
+// those opening one without an account only get what its creator could
+// already publish: a share link of theirs, or an export they may make.
+type ShortLink struct {
+	ID            primitive.ObjectID  `json:"_id" bson:"_id,omitempty"`
+	Code          string              `json:"code" bson:"code"`
+	URL           string              `json:"url" bson:"-"`
+	BoardID       primitive.ObjectID  `json:"boardId" bson:"boardId"`
+	OwnerID       primitive.ObjectID  `json:"ownerId" bson:"ownerId"` // Who created it; exports stop once they may no longer export
+	Target        string              `json:"target" bson:"target"`
+	ShareLinkID   *primitive.ObjectID `json:"shareLinkId,omitempty" bson:"shareLinkId,omitempty"`
+	Format        string              `json:"format,omitempty" bson:"format,omitempty"` // Of exports
+	ClickCount    int64               `json:"clickCount" bson:"clickCount"`
+	Countries     []string            `json:"countries" bson:"countries"`
+	LastClickedAt *time.Time          `json:"lastClickedAt,omitempty" bson:"lastClickedAt,omitempty"`
+	ExpiresAt     *time.Time          `json:"expiresAt,omitempty" bson:"expiresAt,omitempty"`
+	CreatedAt     time.Time           `json:"createdAt" bson:"createdAt"`
+}
+
+// ShortLinkClick records one time a short link was opened
+type ShortLinkClick struct {
+	ID        primitive.ObjectID `json:"-" bson:"_id,omitempty"`
+	LinkID    primitive.ObjectID `json:"-" bson:"linkId"`
+	ClickedAt time.Time          `json:"clickedAt" bson:"clickedAt"`
+	Country   string             `json:"country,omitempty" bson:"country,omitempty"`   // ISO country code, when known
+	Referrer  string             `json:"referrer,omitempty" bson:"referrer,omitempty"` // Referring page, without query string
+}
+
+// ShortLinkRequest represents the request structure for creating a short
+// link
+type ShortLinkRequest struct {
+	Target      string     `json:"target" binding:"required,oneof=board share export"`
+	ShareLinkID string     `json:"shareLinkId"` // For share targets
+	Format      string     `json:"format"`      // For export targets: json, svg, png or pdf
+	ExpiresAt   *time.Time `json:"expiresAt"`
+}
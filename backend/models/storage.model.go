@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// Storage maintenance operations
+const (
+	StorageRebuildIndexes   = "rebuild-indexes"
+	StorageCompact          = "compact"
+	StorageRecalculateUsage = "recalculate-usage"
+)
+
+// StorageSnapshot is how much the database held on one day, kept to show
+// how fast it grows. Every instance writes the day's snapshot, so the last
+// one taken that day wins.
+type StorageSnapshot struct {
+	Day         string    `json:"day" bson:"_id"` // YYYY-MM-DD, in UTC
+	TakenAt     time.Time `json:"takenAt" bson:"takenAt"`
+	Documents   int64     `json:"documents" bson:"documents"`
+	DataSize    int64     `json:"dataSize" bson:"dataSize"`       // Documents, uncompressed
+	StorageSize int64     `json:"storageSize" bson:"storageSize"` // Documents on disk
+	IndexSize   int64     `json:"indexSize" bson:"indexSize"`
+	GridFSSize  int64     `json:"gridfsSize" bson:"gridfsSize"` // Files stored in GridFS
+	Boards      int64     `json:"boards" bson:"boards"`
+	ExpiresAt   time.Time `json:"-" bson:"expiresAt"`
+}
+
+// StorageMaintenanceRequest starts a maintenance operation. Collections
+// limits compaction to some collections; it is ignored by the others.
+type StorageMaintenanceRequest struct {
+	Operation   string   `json:"operation" binding:"required,oneof=rebuild-indexes compact recalculate-usage"`
+	Collections []string `json:"collections"`
+}
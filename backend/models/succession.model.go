@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Why a member's boards were handed to the successor
+const (
+	SuccessionReasonDeactivated = "deactivated"
+	SuccessionReasonInactive    = "inactive"
+)
+
+// SuccessionPolicy hands the boards of members who left to an admin, so
+// what they made isn't stranded. Boards of deactivated accounts move, and
+// with InactiveDays set, those of accounts that haven't signed in for that
+// long. There is one policy for the instance.
+type SuccessionPolicy struct {
+	Enabled      bool               `json:"enabled" bson:"enabled"`
+	SuccessorID  primitive.ObjectID `json:"successorId" bson:"successorId"`   // An admin
+	InactiveDays int                `json:"inactiveDays" bson:"inactiveDays"` // 0 for deactivated accounts only
+	UpdatedBy    primitive.ObjectID `json:"updatedBy" bson:"updatedBy"`
+	UpdatedAt    time.Time          `json:"updatedAt" bson:"updatedAt"`
+}
+
+// SuccessionPolicyRequest represents the request structure for setting the
+// succession policy
+type SuccessionPolicyRequest struct {
+	Enabled      *bool  `json:"enabled" binding:"required"`
+	SuccessorID  string `json:"successorId"`
+	InactiveDays int    `json:"inactiveDays" binding:"min=0,max=3650"`
+}
+
+// SuccessionTransfer is what one run of the policy handed over from one
+// member
+type SuccessionTransfer struct {
+	FromUserID primitive.ObjectID   `json:"fromUserId"`
+	Reason     string               `json:"reason"`
+	BoardIDs   []primitive.ObjectID `json:"boardIds"`
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Template is board contents saved to start new boards from. Personal
+// templates are only offered to the user who saved them; global ones are
+// curated by admins and offered to everyone.
+type Template struct {
+	ID            primitive.ObjectID     `json:"_id" bson:"_id,omitempty"`
+	Name          string                 `json:"name" bson:"name"`
+	Description   string                 `json:"description,omitempty" bson:"description,omitempty"`
+	OwnerID       primitive.ObjectID     `json:"ownerId" bson:"ownerId"` // Who saved it
+	Global        bool                   `json:"global" bson:"global"`
+	BoardData     map[string]interface{} `json:"board,omitempty" bson:"board"`
+	SourceBoardID *primitive.ObjectID    `json:"sourceBoardId,omitempty" bson:"sourceBoardId,omitempty"` // Board it was saved from
+	CreatedAt     time.Time              `json:"createdAt" bson:"createdAt"`
+}
+
+// SaveTemplateRequest represents the request structure for saving a board
+// as a template
+type SaveTemplateRequest struct {
+	Name        string `json:"name" binding:"required,max=200"`
+	Description string `json:"description" binding:"max=2000"`
+	Global      bool   `json:"global"` // Offer it to everyone (admins only)
+}
+
+// CreateFromTemplateRequest represents the request structure for creating
+// a board from a template. All fields are optional.
+type CreateFromTemplateRequest struct {
+	BoardID string  `json:"boardId"`
+	Name    *string `json:"name" binding:"omitempty,max=200"` // Defaults to the template's name
+}
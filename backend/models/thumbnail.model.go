@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// BoardThumbnail describes a stored board preview. The PNG itself lives in
+// GridFS; this is its files document.
+type BoardThumbnail struct {
+	ID         primitive.ObjectID `bson:"_id"`
+	Length     int64              `bson:"length"`
+	UploadDate time.Time          `bson:"uploadDate"`
+	Metadata   ThumbnailMetadata  `bson:"metadata"`
+}
+
+// ThumbnailMetadata ties a thumbnail to the board version it shows
+type ThumbnailMetadata struct {
+	BoardID primitive.ObjectID `bson:"boardId"`
+	Version int64              `bson:"version"`
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TwoFactor is a user's TOTP second factor. PendingSecret is the secret
+// handed out by setup until a code from it turns two-factor on, moving it
+// to Secret. Recovery codes are stored hashed.
+type TwoFactor struct {
+	UserID        primitive.ObjectID `json:"-" bson:"_id"`
+	Secret        string             `json:"-" bson:"secret,omitempty"` // Base32
+	PendingSecret string             `json:"-" bson:"pendingSecret,omitempty"`
+	EnabledAt     *time.Time         `json:"enabledAt,omitempty" bson:"enabledAt,omitempty"`
+	LastStep      int64              `json:"-" bson:"lastStep"` // Time step of the last code accepted, which can't be used again
+	RecoveryCodes []RecoveryCode     `json:"-" bson:"recoveryCodes,omitempty"`
+}
+
+// RecoveryCode is a single-use code that stands in for a TOTP code, such as
+// when the authenticator is lost
+type RecoveryCode struct {
+	Hash   string     `bson:"hash"`
+	UsedAt *time.Time `bson:"usedAt,omitempty"`
+}
+
+// RecoveryCodesLeft counts the recovery codes not used yet
+func (t *TwoFactor) RecoveryCodesLeft() int {
+	left := 0
+	for _, code := range t.RecoveryCodes {
+		if code.UsedAt == nil {
+			left++
+		}
+	}
+	return left
+}
+
+// TwoFactorChallenge is a sign-in waiting for its TOTP code. Only a hash of
+// its token is stored; Details are those of the sign-in, for its audit
+// event.
+type TwoFactorChallenge struct {
+	ID        primitive.ObjectID     `bson:"_id,omitempty"`
+	UserID    primitive.ObjectID     `bson:"userId"`
+	TokenHash string                 `bson:"tokenHash"`
+	Details   map[string]interface{} `bson:"details,omitempty"`
+	Attempts  int                    `bson:"attempts"`
+	CreatedAt time.Time              `bson:"createdAt"`
+	ExpiresAt time.Time              `bson:"expiresAt"`
+}
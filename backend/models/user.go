@@ -6,10 +6,51 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// RoleAdmin marks a user allowed to use the /api/admin endpoints.
+const RoleAdmin = "admin"
+
 type User struct {
-	ID        primitive.ObjectID `json:"_id" bson:"_id,omitempty"`
-	Email     string             `json:"email" bson:"email"`
-	Password  string             `json:"password" bson:"password"`
-	CreatedAt time.Time          `json:"createdAt" bson:"created_at"`
-	UpdatedAt time.Time          `json:"updatedAt" bson:"updated_at"`
+	ID            primitive.ObjectID `json:"_id" bson:"_id,omitempty"`
+	Email         string             `json:"email" bson:"email"`
+	Password      string             `json:"password" bson:"password"`
+	Name          string             `json:"name" bson:"name,omitempty"`                // Full name
+	DisplayName   string             `json:"displayName" bson:"display_name,omitempty"` // What others see; falls back to the name
+	AvatarURL     string             `json:"avatarUrl" bson:"avatar_url,omitempty"`     // Uploaded (see Avatar) or an https URL
+	Locale        string             `json:"locale" bson:"locale,omitempty"`
+	Role          string             `json:"role" bson:"role,omitempty"`
+	Passwordless  bool               `json:"passwordless" bson:"passwordless,omitempty"`              // Password login is refused
+	TokenVersion  int64              `json:"-" bson:"token_version,omitempty"`                        // Bumped to invalidate every token issued before
+	LastActiveAt  *time.Time         `json:"lastActiveAt,omitempty" bson:"last_active_at,omitempty"`  // Last sign-in or token refresh
+	DeactivatedAt *time.Time         `json:"deactivatedAt,omitempty" bson:"deactivated_at,omitempty"` // Set by an admin; the account can't sign in
+	CreatedAt     time.Time          `json:"createdAt" bson:"created_at"`
+	UpdatedAt     time.Time          `json:"updatedAt" bson:"updated_at"`
+}
+
+// Profile is what others sharing a board see of a user
+type Profile struct {
+	Name        string `json:"name,omitempty"`
+	DisplayName string `json:"displayName,omitempty"`
+	AvatarURL   string `json:"avatarUrl,omitempty"`
+}
+
+// ProfileRequest represents the request structure for PATCH /me. Fields
+// left out are unchanged; "" clears one.
+type ProfileRequest struct {
+	Name        *string `json:"name" binding:"omitempty,max=100"`
+	DisplayName *string `json:"displayName" binding:"omitempty,max=50"`
+	AvatarURL   *string `json:"avatarUrl" binding:"omitempty,max=2000"`
+}
+
+// Avatar is a profile picture uploaded by a user. The bytes live in asset
+// storage under Key, like board assets; each upload gets a new ID, so its
+// URL can be cached for good.
+type Avatar struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id"`
+	UserID      primitive.ObjectID `json:"userId" bson:"userId"`
+	ContentType string             `json:"contentType" bson:"contentType"`
+	Size        int64              `json:"size" bson:"size"`
+	SHA256      string             `json:"sha256" bson:"sha256"`
+	Storage     string             `json:"-" bson:"storage"`
+	Key         string             `json:"-" bson:"key"`
+	CreatedAt   time.Time          `json:"createdAt" bson:"createdAt"`
 }
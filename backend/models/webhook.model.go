@@ -0,0 +1,69 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Board events webhooks can subscribe to, the same as plugin events
+const (
+	WebhookBoardCreated  = "board.created"
+	WebhookBoardUpdated  = "board.updated"
+	WebhookBoardDeleted  = "board.deleted"
+	WebhookBoardShared   = "board.shared"
+	WebhookBoardUnshared = "board.unshared"
+)
+
+// WebhookEvents are the events a webhook can choose from
+var WebhookEvents = []string{WebhookBoardCreated, WebhookBoardUpdated, WebhookBoardDeleted, WebhookBoardShared, WebhookBoardUnshared}
+
+// Delivery statuses
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliveryDelivered = "delivered"
+	WebhookDeliveryFailed    = "failed" // Out of retries
+)
+
+// Webhook posts events of the boards a user owns to a URL, signed with its
+// secret
+type Webhook struct {
+	ID        primitive.ObjectID   `json:"id" bson:"_id,omitempty"`
+	UserID    primitive.ObjectID   `json:"-" bson:"userId"`
+	URL       string               `json:"url" bson:"url"`
+	Secret    string               `json:"secret,omitempty" bson:"secret"` // Only shown when created or rotated
+	Events    []string             `json:"events" bson:"events"`           // Empty for every event
+	BoardIDs  []primitive.ObjectID `json:"boardIds" bson:"boardIds"`       // Empty for every board the user owns
+	Active    bool                 `json:"active" bson:"active"`
+	CreatedAt time.Time            `json:"createdAt" bson:"createdAt"`
+	UpdatedAt time.Time            `json:"updatedAt" bson:"updatedAt"`
+}
+
+// WebhookPayload is the JSON body of a delivery. Like plugin events it
+// carries IDs only; receivers load the board through the API if they need
+// its contents.
+type WebhookPayload struct {
+	ID        string             `json:"id" bson:"id"` // The delivery's ID, the same on every retry
+	Type      string             `json:"type" bson:"type"`
+	BoardID   primitive.ObjectID `json:"boardId" bson:"boardId"`
+	BoardName string             `json:"boardName,omitempty" bson:"boardName,omitempty"`
+	UserID    primitive.ObjectID `json:"userId,omitempty" bson:"userId,omitempty"` // Zero for changes merged from a realtime session
+	Version   int64              `json:"version,omitempty" bson:"version,omitempty"`
+	Time      time.Time          `json:"time" bson:"time"`
+}
+
+// WebhookDelivery is one event queued for a webhook, and how sending it
+// has gone so far
+type WebhookDelivery struct {
+	ID            primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	WebhookID     primitive.ObjectID `json:"webhookId" bson:"webhookId"`
+	Payload       WebhookPayload     `json:"payload" bson:"payload"`
+	Status        string             `json:"status" bson:"status"`
+	Attempts      int                `json:"attempts" bson:"attempts"`
+	NextAttemptAt *time.Time         `json:"nextAttemptAt,omitempty" bson:"nextAttemptAt,omitempty"` // Pending deliveries only
+	LastStatus    int                `json:"lastStatus,omitempty" bson:"lastStatus,omitempty"`       // HTTP status of the last attempt
+	LastError     string             `json:"lastError,omitempty" bson:"lastError,omitempty"`
+	CreatedAt     time.Time          `json:"createdAt" bson:"createdAt"`
+	DeliveredAt   *time.Time         `json:"deliveredAt,omitempty" bson:"deliveredAt,omitempty"`
+	ExpiresAt     time.Time          `json:"-" bson:"expiresAt"`
+}
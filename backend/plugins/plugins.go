@@ -0,0 +1,238 @@
+// Package plugins is the registry for server extensions compiled into
+// boardsar. A plugin can subscribe to board events, add custom shape types
+// with server-side validation and serve its own endpoints under
+// /api/ext/<name>. Board owners switch plugins on and off per board.
+package plugins
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/database"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// eventTimeout bounds how long a plugin may take to handle one event
+const eventTimeout = 10 * time.Second
+
+// Board events delivered to plugins
+const (
+	EventBoardCreated  = "board.created"
+	EventBoardUpdated  = "board.updated"
+	EventBoardDeleted  = "board.deleted"
+	EventBoardShared   = "board.shared"
+	EventBoardUnshared = "board.unshared"
+)
+
+// validName keeps plugin names usable as URL segments and Mongo keys
+var validName = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,39}$`)
+
+// Info describes a plugin
+type Info struct {
+	Name             string // Namespace for its endpoints and per-board switch
+	Description      string
+	EnabledByDefault bool // Whether boards that never switched it get it
+}
+
+// Plugin is a server extension. It adds behaviour by also implementing any
+// of EventHandler, ShapeTypeProvider and RouteProvider.
+type Plugin interface {
+	Info() Info
+}
+
+// EventHandler receives events of boards the plugin is enabled on. Events
+// are delivered asynchronously and at most once.
+type EventHandler interface {
+	HandleEvent(ctx context.Context, event Event)
+}
+
+// ShapeTypeProvider adds custom shape types. They are validated on every
+// board, since shapes outlive a plugin being switched off.
+type ShapeTypeProvider interface {
+	ShapeTypes() []libs.ShapeType
+}
+
+// RouteProvider serves endpoints under /api/ext/<name>. The group requires a
+// signed-in user; handlers working on a board should load it with
+// LoadBoard, which also checks the plugin is enabled on it.
+type RouteProvider interface {
+	RegisterRoutes(group *gin.RouterGroup)
+}
+
+// Event is something that happened to a board. It carries IDs only; a
+// handler that needs the contents loads the board.
+type Event struct {
+	Type    string             `json:"type"`
+	BoardID primitive.ObjectID `json:"boardId"`
+	UserID  primitive.ObjectID `json:"userId,omitempty"` // Zero for changes merged from a realtime session
+	Version int64              `json:"version,omitempty"`
+	Time    time.Time          `json:"time"`
+}
+
+var registry = struct {
+	sync.RWMutex
+	byName map[string]Plugin
+}{byName: map[string]Plugin{}}
+
+// Register adds a plugin and its shape types. Call it before building the
+// router, so the plugin's endpoints are mounted.
+func Register(plugin Plugin) error {
+	info := plugin.Info()
+	if !validName.MatchString(info.Name) {
+		return fmt.Errorf("invalid plugin name %q", info.Name)
+	}
+
+	registry.Lock()
+	defer registry.Unlock()
+	if _, ok := registry.byName[info.Name]; ok {
+		return fmt.Errorf("plugin %q is already registered", info.Name)
+	}
+
+	if provider, ok := plugin.(ShapeTypeProvider); ok {
+		for _, shapeType := range provider.ShapeTypes() {
+			shapeType.Source = info.Name
+			if err := libs.RegisterShapeType(shapeType); err != nil {
+				return fmt.Errorf("plugin %q: %w", info.Name, err)
+			}
+		}
+	}
+
+	registry.byName[info.Name] = plugin
+	slog.Info("Plugin registered", "plugin", info.Name)
+	return nil
+}
+
+// All returns the registered plugins by name
+func All() []Plugin {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	all := make([]Plugin, 0, len(registry.byName))
+	for _, plugin := range registry.byName {
+		all = append(all, plugin)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Info().Name < all[j].Info().Name })
+	return all
+}
+
+// Lookup returns the plugin with the given name
+func Lookup(name string) (Plugin, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	plugin, ok := registry.byName[name]
+	return plugin, ok
+}
+
+// EnabledOn reports whether a plugin is switched on for a board
+func EnabledOn(board *models.Board, plugin Plugin) bool {
+	info := plugin.Info()
+	if enabled, ok := board.Plugins[info.Name]; ok {
+		return enabled
+	}
+	return info.EnabledByDefault
+}
+
+// Emit delivers an event about the board to the plugins enabled on it,
+// queues it for the owner's webhooks and updates the board's summary. It
+// returns once the summary is written; each handler runs in its own
+// goroutine with a timeout, and a handler that panics is logged and
+// skipped.
+func Emit(ctx context.Context, board *models.Board, eventType string, userID primitive.ObjectID) {
+	event := Event{
+		Type:    eventType,
+		BoardID: board.ID,
+		UserID:  userID,
+		Version: board.Version,
+		Time:    time.Now().UTC(),
+	}
+
+	for _, plugin := range All() {
+		handler, ok := plugin.(EventHandler)
+		if !ok || !EnabledOn(board, plugin) {
+			continue
+		}
+		go deliver(ctx, plugin.Info().Name, handler, event)
+	}
+	libs.QueueWebhookEvent(board, event.Type, userID, event.Time)
+
+	// Board lists read board_summaries, kept in step here before the
+	// write's response goes out
+	if eventType == EventBoardDeleted {
+		libs.RemoveBoardSummary(ctx, board.ID)
+	} else {
+		libs.RefreshBoardSummary(ctx, board.ID, board.BoardData)
+	}
+}
+
+func deliver(ctx context.Context, name string, handler EventHandler, event Event) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			slog.Warn("Plugin panicked", "plugin", name, "event", event.Type, "error", recovered)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), eventTimeout)
+	defer cancel()
+	handler.HandleEvent(ctx, event)
+}
+
+// MountRoutes mounts every plugin's endpoints under its name in group
+func MountRoutes(group *gin.RouterGroup) {
+	for _, plugin := range All() {
+		if provider, ok := plugin.(RouteProvider); ok {
+			provider.RegisterRoutes(group.Group("/" + plugin.Info().Name))
+		}
+	}
+}
+
+// LoadBoard loads the board named by the :boardId route parameter for a
+// plugin endpoint. It answers 404 unless the user can see the board and the
+// plugin is enabled on it, in which case handlers just return.
+func LoadBoard(c *gin.Context, plugin Plugin) (*models.Board, bool) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return nil, false
+	}
+	boardID, err := primitive.ObjectIDFromHex(c.Param("boardId"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Board not found or access denied"})
+		return nil, false
+	}
+
+	ctx, cancel := libs.DBContext(c)
+	defer cancel()
+
+	if err := libs.RehydrateBoards(ctx, bson.M{"_id": boardID}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve board: " + err.Error()})
+		return nil, false
+	}
+
+	var board models.Board
+	err = database.GetCollection("boards").FindOne(ctx, bson.M{"_id": boardID}).Decode(&board)
+	if err == mongo.ErrNoDocuments || (err == nil && libs.BoardRole(&board, userID) == "") {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Board not found or access denied"})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve board: " + err.Error()})
+		return nil, false
+	}
+
+	if !EnabledOn(&board, plugin) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Plugin " + plugin.Info().Name + " is not enabled on this board"})
+		return nil, false
+	}
+	return &board, true
+}
@@ -0,0 +1,130 @@
+package realtime
+
+import (
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Message types exchanged over a board socket
+const (
+	MessageSync     = "sync"     // server → client: full board state
+	MessageOp       = "op"       // both ways: one board operation
+	MessageCursor   = "cursor"   // both ways: pointer position
+	MessagePresence = "presence" // server → client: who is connected
+	MessageError    = "error"    // server → client: rejected message
+)
+
+const (
+	writeWait      = 10 * time.Second
+	pongWait       = 60 * time.Second
+	pingPeriod     = (pongWait * 9) / 10
+	maxMessageSize = 1 << 20
+	sendBuffer     = 64
+)
+
+// Message is the envelope for everything sent over a board socket
+type Message struct {
+	Type         string                    `json:"type"`
+	Op           *models.BoardOperation    `json:"op,omitempty"`
+	Cursor       map[string]float64        `json:"cursor,omitempty"`
+	UserID       string                    `json:"userId,omitempty"`
+	Board        map[string]interface{}    `json:"board,omitempty"`
+	Facilitation *models.Facilitation      `json:"facilitation,omitempty"`
+	Sections     []models.Section          `json:"sections,omitempty"`
+	Freeze       *models.BoardFreezeStatus `json:"freeze,omitempty"`
+	Users        []string                  `json:"users,omitempty"`
+	Error        string                    `json:"error,omitempty"`
+}
+
+// Client is one WebSocket connection to a board room
+type Client struct {
+	conn   *websocket.Conn
+	send   chan []byte
+	userID primitive.ObjectID
+	role   string
+	// readOnly clients, such as OAuth apps without boards:write, stay
+	// viewers whatever their role on the board
+	readOnly bool
+	room     *room
+}
+
+type clientMessage struct {
+	client  *Client
+	message Message
+}
+
+// queue sends a message to the client without blocking the room. A client
+// that can't keep up is disconnected.
+func (c *Client) queue(message Message) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		slog.Warn("Failed to encode realtime message", "error", err)
+		return
+	}
+
+	select {
+	case c.send <- data:
+	default:
+		c.conn.Close()
+	}
+}
+
+// readPump forwards messages from the socket to the room until the
+// connection closes
+func (c *Client) readPump() {
+	defer func() {
+		c.room.leave <- c
+		c.conn.Close()
+	}()
+
+	c.conn.SetReadLimit(maxMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		var message Message
+		if err := c.conn.ReadJSON(&message); err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				slog.Warn("Realtime connection error", "error", err)
+			}
+			return
+		}
+		c.room.incoming <- clientMessage{client: c, message: message}
+	}
+}
+
+// writePump writes queued messages to the socket and keeps it alive with
+// pings
+func (c *Client) writePump() {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+
+	for {
+		select {
+		case data, ok := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package realtime
+
+import (
+	"sync"
+
+	"github.com/gorilla/websocket"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"github.com/sarwanazhar/boardsar/backend/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Hub tracks the live rooms on this instance, one per board with at least
+// one connected client
+type Hub struct {
+	mu    sync.Mutex
+	rooms map[primitive.ObjectID]*room
+	refs  map[*room]int
+}
+
+// DefaultHub is the hub used by the WebSocket endpoint
+var DefaultHub = NewHub()
+
+// NewHub creates an empty hub
+func NewHub() *Hub {
+	return &Hub{
+		rooms: map[primitive.ObjectID]*room{},
+		refs:  map[*room]int{},
+	}
+}
+
+// Join attaches a connection to the board's room, starting the room from
+// board, saved to boards, if nobody else is connected. readOnly clients
+// join as viewers. The call returns once the client's pumps are running.
+func (h *Hub) Join(boards repository.BoardRepository, board *models.Board, conn *websocket.Conn, userID primitive.ObjectID, role string, readOnly bool) {
+	h.mu.Lock()
+	r, ok := h.rooms[board.ID]
+	if !ok {
+		r = newRoom(h, boards, board)
+		h.rooms[board.ID] = r
+		go r.run()
+	}
+	h.refs[r]++
+	h.mu.Unlock()
+
+	client := &Client{
+		conn:     conn,
+		send:     make(chan []byte, sendBuffer),
+		userID:   userID,
+		role:     role,
+		readOnly: readOnly,
+		room:     r,
+	}
+	if readOnly {
+		client.role = models.CollaboratorRoleViewer
+	}
+	r.join <- client
+
+	go client.writePump()
+	go client.readPump()
+}
+
+// Reload tells the board's room, if any, that the stored board changed
+// outside the realtime session
+func (h *Hub) Reload(boardID primitive.ObjectID) {
+	h.mu.Lock()
+	r, ok := h.rooms[boardID]
+	h.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	select {
+	case r.reload <- struct{}{}:
+	default:
+		// A reload is already pending
+	}
+}
+
+// Flush persists every room's pending changes and waits for the writes
+func (h *Hub) Flush() {
+	h.mu.Lock()
+	rooms := make([]*room, 0, len(h.rooms))
+	for _, r := range h.rooms {
+		rooms = append(rooms, r)
+	}
+	h.mu.Unlock()
+
+	for _, r := range rooms {
+		r.flushAndWait()
+	}
+}
+
+// Open reports whether anyone has the board open in a realtime session
+func (h *Hub) Open(boardID primitive.ObjectID) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, ok := h.rooms[boardID]
+	return ok
+}
+
+// FlushBoard persists the board's pending realtime changes, if it has a
+// room, and reports whether it did
+func (h *Hub) FlushBoard(boardID primitive.ObjectID) bool {
+	h.mu.Lock()
+	r, ok := h.rooms[boardID]
+	h.mu.Unlock()
+	if !ok {
+		return false
+	}
+
+	r.flushAndWait()
+	return true
+}
+
+// release drops a client reference and reports whether the room is now
+// empty and removed from the hub
+func (h *Hub) release(r *room) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.refs[r]--
+	if h.refs[r] > 0 {
+		return false
+	}
+	delete(h.refs, r)
+	delete(h.rooms, r.boardID)
+	return true
+}
@@ -0,0 +1,342 @@
+package realtime
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"github.com/sarwanazhar/boardsar/backend/plugins"
+	"github.com/sarwanazhar/boardsar/backend/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// flushInterval is how often a room saves its merged state
+const flushInterval = 2 * time.Second
+
+// versionInterval is how often a live session's saves are added to the
+// board's version history; the state when the session ends is always added
+const versionInterval = time.Minute
+
+// room holds the live state of one board and the clients editing it. All
+// state is owned by the run goroutine.
+type room struct {
+	hub     *Hub
+	boards  repository.BoardRepository // Where the board is saved
+	boardID primitive.ObjectID
+	board   models.Board
+	clients map[*Client]bool
+	dirty   bool
+	size    int64 // Stored size of the board contents
+
+	unversioned bool      // Saved changes not yet in the version history
+	versionedAt time.Time // When the history last got a version
+
+	join     chan *Client
+	leave    chan *Client
+	incoming chan clientMessage
+	reload   chan struct{}
+	flushNow chan chan struct{}
+	done     chan struct{}
+}
+
+func newRoom(hub *Hub, boards repository.BoardRepository, board *models.Board) *room {
+	return &room{
+		hub:      hub,
+		boards:   boards,
+		boardID:  board.ID,
+		board:    *board,
+		size:     libs.BoardDataSize(board.BoardData),
+		clients:  map[*Client]bool{},
+		join:     make(chan *Client),
+		leave:    make(chan *Client),
+		incoming: make(chan clientMessage, 256),
+		reload:   make(chan struct{}, 1),
+		flushNow: make(chan chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+func (r *room) run() {
+	ticker := time.NewTicker(flushInterval)
+	defer func() {
+		ticker.Stop()
+		close(r.done)
+	}()
+
+	for {
+		select {
+		case client := <-r.join:
+			r.clients[client] = true
+			r.sendSync(client)
+			r.broadcastPresence()
+
+		case client := <-r.leave:
+			if r.clients[client] {
+				delete(r.clients, client)
+				close(client.send)
+				r.broadcastPresence()
+			}
+			if r.hub.release(r) {
+				r.flush()
+				r.recordVersion(true)
+				return
+			}
+
+		case cm := <-r.incoming:
+			if r.clients[cm.client] {
+				r.handle(cm.client, cm.message)
+			}
+
+		case <-r.reload:
+			// Save pending edits first; if the board itself was rewritten
+			// the flush is rejected and reloads on its own
+			if !r.flush() {
+				r.reloadFromDatabase()
+			}
+
+		case done := <-r.flushNow:
+			// A REST write is about to replace the state; keep it in history
+			r.flush()
+			r.recordVersion(true)
+			close(done)
+
+		case <-ticker.C:
+			r.flush()
+			r.recordVersion(false)
+		}
+	}
+}
+
+// flushAndWait asks the room to persist its pending changes and waits for
+// the write
+func (r *room) flushAndWait() {
+	flushed := make(chan struct{})
+	select {
+	case r.flushNow <- flushed:
+		<-flushed
+	case <-r.done:
+		// The room emptied and flushed on its own
+	}
+}
+
+func (r *room) handle(client *Client, message Message) {
+	switch message.Type {
+	case MessageOp:
+		r.handleOp(client, message)
+	case MessageCursor:
+		r.handleCursor(client, message)
+	default:
+		client.queue(Message{Type: MessageError, Error: "Unknown message type"})
+	}
+}
+
+func (r *room) handleOp(client *Client, message Message) {
+	if message.Op == nil {
+		client.queue(Message{Type: MessageError, Error: "Missing operation"})
+		return
+	}
+	if client.role != models.BoardRoleOwner && client.role != models.CollaboratorRoleEditor {
+		client.queue(Message{Type: MessageError, Error: "You have view-only access to this board"})
+		return
+	}
+	if enabled, _ := libs.GetReadOnlyMode(); enabled {
+		client.queue(Message{Type: MessageError, Error: "Server is in read-only mode; changes cannot be saved right now"})
+		return
+	}
+
+	op := *message.Op
+	if violation := libs.PrepareOperation(&r.board, &op, client.userID); violation != "" {
+		client.queue(Message{Type: MessageError, Error: violation})
+		return
+	}
+
+	// Remember the shape before a delete, to know who may hear about it
+	var affected map[string]interface{}
+	if op.Op == models.OpDeleteShape {
+		affected = libs.FindShape(r.board.BoardData, op.ID)
+	}
+
+	// Apply to a copy, so an op that makes the board too big leaves the
+	// room's state as it was
+	next := libs.CopyBoardData(r.board.BoardData)
+	if next == nil {
+		next = map[string]interface{}{}
+	}
+	if err := libs.ApplyBoardOperation(next, op); err != nil {
+		client.queue(Message{Type: MessageError, Error: err.Error()})
+		return
+	}
+	size := libs.BoardDataSize(next)
+	if violation := r.checkSize(size); violation != "" {
+		client.queue(Message{Type: MessageError, Error: violation})
+		return
+	}
+	r.board.BoardData = next
+	r.size = size
+	r.dirty = true
+
+	switch op.Op {
+	case models.OpAddShape:
+		affected = op.Shape
+	case models.OpUpdateShape:
+		affected = libs.FindShape(r.board.BoardData, op.ID)
+	}
+
+	out := Message{Type: MessageOp, Op: &op, UserID: client.userID.Hex()}
+	for other := range r.clients {
+		if other == client {
+			continue
+		}
+		if affected != nil && libs.IsHiddenFrom(affected, other.userID) {
+			continue
+		}
+		other.queue(out)
+	}
+}
+
+// checkSize checks the board contents against BOARD_MAX_SIZE and, when
+// they grow, the owner's storage quota, like a REST save. It returns why
+// they don't fit, or "".
+func (r *room) checkSize(size int64) string {
+	if err := libs.CheckBoardSize(size); err != nil {
+		return err.Error()
+	}
+	if size <= r.size || libs.GetQuotaLimits().StorageBytes == 0 {
+		return ""
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), libs.Settings().DBTimeout)
+	defer cancel()
+
+	usage, err := libs.GetQuotaUsage(ctx, r.board.OwnerID, r.boardID)
+	if err != nil {
+		slog.Warn("Failed to check quota for realtime board", "board_id", r.boardID.Hex(), "error", err)
+		return "Failed to check quota"
+	}
+	if _, quotaErr := libs.ApplyQuota(libs.JobHeaders{}, usage, 0, size); quotaErr != "" {
+		return quotaErr
+	}
+	return ""
+}
+
+func (r *room) handleCursor(client *Client, message Message) {
+	out := Message{Type: MessageCursor, Cursor: message.Cursor, UserID: client.userID.Hex()}
+	hideCursors := r.board.Facilitation != nil && r.board.Facilitation.HideCursors
+
+	for other := range r.clients {
+		if other == client {
+			continue
+		}
+		// During silent brainstorming participants only see the facilitator
+		if hideCursors && client.role != models.BoardRoleOwner && other.role != models.BoardRoleOwner {
+			continue
+		}
+		other.queue(out)
+	}
+}
+
+func (r *room) sendSync(client *Client) {
+	client.queue(Message{
+		Type:         MessageSync,
+		Board:        libs.VisibleBoardData(r.board.BoardData, client.userID),
+		Facilitation: r.board.Facilitation,
+		Sections:     r.board.Sections,
+		Freeze:       libs.FreezeStatus(r.board.Freeze, time.Now()),
+	})
+}
+
+func (r *room) broadcastPresence() {
+	seen := map[primitive.ObjectID]bool{}
+	users := []string{}
+	for client := range r.clients {
+		if !seen[client.userID] {
+			seen[client.userID] = true
+			users = append(users, client.userID.Hex())
+		}
+	}
+
+	for client := range r.clients {
+		client.queue(Message{Type: MessagePresence, Users: users})
+	}
+}
+
+// flush persists the merged state if it changed. The write only applies if
+// nobody else saved the board since it was loaded; otherwise the room adopts
+// the stored state and flush reports that it reloaded.
+func (r *room) flush() bool {
+	if !r.dirty {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), libs.Settings().DBTimeout)
+	defer cancel()
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	err := r.boards.SaveContents(ctx, r.boardID, r.board.Version, 1, r.board.BoardData, map[string]interface{}{"updatedAt": now})
+	if errors.Is(err, repository.ErrVersionConflict) {
+		slog.Warn("Board changed outside the realtime session; reloading", "board_id", r.boardID.Hex())
+		r.reloadFromDatabase()
+		return true
+	}
+	if err != nil {
+		slog.Warn("Failed to persist realtime board", "board_id", r.boardID.Hex(), "error", err)
+		return false
+	}
+
+	r.dirty = false
+	libs.InvalidateBoard(ctx, r.boardID)
+	r.board.UpdatedAt = now
+	r.board.Version++
+	r.unversioned = true
+	plugins.Emit(ctx, &r.board, plugins.EventBoardUpdated, primitive.NilObjectID)
+	return false
+}
+
+// recordVersion adds the saved state to the board's version history, at
+// most once per versionInterval unless forced
+func (r *room) recordVersion(force bool) {
+	if !r.unversioned || (!force && time.Since(r.versionedAt) < versionInterval) {
+		return
+	}
+	libs.RecordBoardVersion(context.Background(), &r.board, primitive.NilObjectID)
+	r.unversioned = false
+	r.versionedAt = time.Now()
+}
+
+// reloadFromDatabase replaces the room state with the stored board,
+// disconnects clients who lost access and resyncs everyone else
+func (r *room) reloadFromDatabase() {
+	ctx, cancel := context.WithTimeout(context.Background(), libs.Settings().DBTimeout)
+	defer cancel()
+
+	board, err := r.boards.FindByID(ctx, r.boardID)
+	if err != nil {
+		// Deleted (or unreachable): drop everyone, they'll leave the room
+		for client := range r.clients {
+			client.queue(Message{Type: MessageError, Error: "Board is no longer available"})
+			client.conn.Close()
+		}
+		return
+	}
+
+	r.board = *board
+	r.size = libs.BoardDataSize(board.BoardData)
+	r.dirty = false
+	r.unversioned = false
+
+	for client := range r.clients {
+		client.role = libs.BoardRole(&r.board, client.userID)
+		if client.role == "" {
+			client.queue(Message{Type: MessageError, Error: "Your access to this board was removed"})
+			client.conn.Close()
+			continue
+		}
+		if client.readOnly {
+			client.role = models.CollaboratorRoleViewer
+		}
+		r.sendSync(client)
+	}
+}
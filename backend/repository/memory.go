@@ -0,0 +1,512 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Documents are kept as BSON, as MongoDB would keep them, so callers can't
+// change a stored board or user through what they were given
+
+// memoryBoards keeps boards in a map, for tests
+type memoryBoards struct {
+	*boardMap
+	withoutContents bool
+}
+
+// boardMap is the boards a memoryBoards and its WithoutContents share
+type boardMap struct {
+	mu     sync.RWMutex
+	boards map[primitive.ObjectID][]byte
+}
+
+// NewMemoryBoards returns an empty board repository that lives in memory
+func NewMemoryBoards() BoardRepository {
+	return &memoryBoards{boardMap: &boardMap{boards: map[primitive.ObjectID][]byte{}}}
+}
+
+func (r *memoryBoards) WithoutContents() BoardRepository {
+	return &memoryBoards{boardMap: r.boardMap, withoutContents: true}
+}
+
+func (r *memoryBoards) Create(ctx context.Context, board *models.Board) error {
+	raw, err := bson.Marshal(board)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.boards[board.ID] = raw
+	return nil
+}
+
+func (r *memoryBoards) CreateMany(ctx context.Context, boards []models.Board) error {
+	for i := range boards {
+		if err := r.Create(ctx, &boards[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *memoryBoards) FindByID(ctx context.Context, id primitive.ObjectID) (*models.Board, error) {
+	return r.find(func(board *models.Board) bool { return board.ID == id })
+}
+
+func (r *memoryBoards) FindByRef(ctx context.Context, ref string) (*models.Board, error) {
+	return r.find(func(board *models.Board) bool { return matchesRef(board, ref) })
+}
+
+func (r *memoryBoards) FindForUser(ctx context.Context, ref string, userID primitive.ObjectID, roles ...string) (*models.Board, error) {
+	return r.find(func(board *models.Board) bool {
+		return matchesRef(board, ref) && canAccess(board, userID, roles...)
+	})
+}
+
+func (r *memoryBoards) FindOwned(ctx context.Context, ref string, ownerID primitive.ObjectID) (*models.Board, error) {
+	return r.find(func(board *models.Board) bool {
+		return matchesRef(board, ref) && board.OwnerID == ownerID
+	})
+}
+
+func (r *memoryBoards) ListByIDs(ctx context.Context, ids []primitive.ObjectID) ([]models.Board, error) {
+	return r.list(func(board *models.Board) bool { return slices.Contains(ids, board.ID) })
+}
+
+func (r *memoryBoards) ListForUser(ctx context.Context, refs []string, userID primitive.ObjectID) ([]models.Board, error) {
+	return r.list(func(board *models.Board) bool {
+		return canAccess(board, userID) && slices.ContainsFunc(refs, func(ref string) bool { return matchesRef(board, ref) })
+	})
+}
+
+func (r *memoryBoards) ListOwned(ctx context.Context, ownerID primitive.ObjectID) ([]models.Board, error) {
+	return r.list(func(board *models.Board) bool { return board.OwnerID == ownerID })
+}
+
+func (r *memoryBoards) ListBreakouts(ctx context.Context, parentID primitive.ObjectID, userID primitive.ObjectID) ([]models.Board, error) {
+	return r.list(func(board *models.Board) bool {
+		return board.ParentID != nil && *board.ParentID == parentID && canAccess(board, userID)
+	})
+}
+
+func (r *memoryBoards) ListToReencode(ctx context.Context, decompress bool, threshold int64) ([]primitive.ObjectID, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	ids := []primitive.ObjectID{}
+	for id, raw := range r.boards {
+		if storedEncoding(raw, decompress, threshold) {
+			ids = append(ids, id)
+		}
+	}
+	slices.SortFunc(ids, func(a, b primitive.ObjectID) int { return bytes.Compare(a[:], b[:]) })
+	return ids, nil
+}
+
+// storedEncoding reports whether the stored board is compressed, with
+// decompress, or else kept as a document of at least threshold bytes
+func storedEncoding(raw bson.Raw, decompress bool, threshold int64) bool {
+	if decompress {
+		encoding, _ := raw.Lookup("boardEncoding").StringValueOK()
+		return encoding == models.BoardEncodingZstd
+	}
+	contents, ok := raw.Lookup("board").DocumentOK()
+	return ok && int64(len(contents)) >= threshold
+}
+
+func (r *memoryBoards) find(match func(*models.Board) bool) (*models.Board, error) {
+	found, err := r.list(match)
+	if err != nil {
+		return nil, err
+	}
+	if len(found) == 0 {
+		return nil, ErrNotFound
+	}
+	return &found[0], nil
+}
+
+// list returns the boards match accepts, oldest first
+func (r *memoryBoards) list(match func(*models.Board) bool) ([]models.Board, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	found := []models.Board{}
+	for _, raw := range r.boards {
+		var board models.Board
+		if err := bson.Unmarshal(raw, &board); err != nil {
+			return nil, err
+		}
+		if match(&board) {
+			if r.withoutContents {
+				board.BoardData = nil
+			}
+			found = append(found, board)
+		}
+	}
+	slices.SortFunc(found, func(a, b models.Board) int { return bytes.Compare(a.ID[:], b.ID[:]) })
+	return found, nil
+}
+
+func (r *memoryBoards) Update(ctx context.Context, id primitive.ObjectID, fields map[string]interface{}) error {
+	return r.update(id, AnyVersion, 0, nil, fields)
+}
+
+func (r *memoryBoards) UpdateVersion(ctx context.Context, id primitive.ObjectID, version int64, fields map[string]interface{}) error {
+	return r.update(id, version, 0, nil, fields)
+}
+
+func (r *memoryBoards) SaveContents(ctx context.Context, id primitive.ObjectID, version int64, steps int64, data map[string]interface{}, fields map[string]interface{}) error {
+	contents := map[string]interface{}{"board": data}
+	for key, value := range fields {
+		contents[key] = value
+	}
+	return r.update(id, version, steps, nil, contents)
+}
+
+func (r *memoryBoards) SetCollaborator(ctx context.Context, id primitive.ObjectID, collaborator models.Collaborator) (bool, error) {
+	added := false
+	err := r.update(id, AnyVersion, 0, func(board *models.Board) error {
+		for i := range board.SharedWith {
+			if board.SharedWith[i].UserID == collaborator.UserID {
+				board.SharedWith[i].Role = collaborator.Role
+				if collaborator.Capabilities != nil {
+					board.SharedWith[i].Capabilities = collaborator.Capabilities
+				}
+				return nil
+			}
+		}
+		board.SharedWith = append(board.SharedWith, collaborator)
+		added = true
+		return nil
+	}, nil)
+	return added, err
+}
+
+func (r *memoryBoards) RemoveCollaborator(ctx context.Context, id primitive.ObjectID, userID primitive.ObjectID) error {
+	return r.update(id, AnyVersion, 0, func(board *models.Board) error {
+		for i, collaborator := range board.SharedWith {
+			if collaborator.UserID == userID {
+				board.SharedWith = slices.Delete(board.SharedWith, i, i+1)
+				return nil
+			}
+		}
+		return ErrNotFound
+	}, nil)
+}
+
+func (r *memoryBoards) RemoveFromAll(ctx context.Context, userID primitive.ObjectID) ([]primitive.ObjectID, error) {
+	shared, err := r.list(func(board *models.Board) bool {
+		return slices.ContainsFunc(board.SharedWith, func(collaborator models.Collaborator) bool {
+			return collaborator.UserID == userID
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	removed := []primitive.ObjectID{}
+	for _, board := range shared {
+		if err := r.RemoveCollaborator(ctx, board.ID, userID); err == nil {
+			removed = append(removed, board.ID)
+		} else if err != ErrNotFound {
+			return nil, err
+		}
+	}
+	return removed, nil
+}
+
+func (r *memoryBoards) Reencode(ctx context.Context, board *models.Board, decompress bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	raw, ok := r.boards[board.ID]
+	if !ok {
+		return ErrVersionConflict
+	}
+	var stored models.Board
+	if err := bson.Unmarshal(raw, &stored); err != nil {
+		return err
+	}
+	encoding, _ := bson.Raw(raw).Lookup("boardEncoding").StringValueOK()
+	compressed := encoding == models.BoardEncodingZstd
+	if stored.Version != board.Version || !stored.UpdatedAt.Equal(board.UpdatedAt) || compressed != decompress {
+		return ErrVersionConflict
+	}
+
+	if !decompress {
+		encoded, err := bson.Marshal(board)
+		if err != nil {
+			return err
+		}
+		r.boards[board.ID] = encoded
+		return nil
+	}
+	var doc bson.M
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return err
+	}
+	delete(doc, "boardZstd")
+	delete(doc, "boardEncoding")
+	delete(doc, "boardSize")
+	doc["board"] = board.BoardData
+	encoded, err := bson.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	r.boards[board.ID] = encoded
+	return nil
+}
+
+func (r *memoryBoards) BulkWrite(ctx context.Context, writes []BoardWrite) ([]error, error) {
+	errs := make([]error, len(writes))
+	for i, write := range writes {
+		var err error
+		if write.Delete {
+			err = r.Delete(ctx, write.ID)
+		} else {
+			err = r.Update(ctx, write.ID, write.Fields)
+		}
+		// As in MongoDB, a write to a board that's gone does nothing
+		if err != ErrNotFound {
+			errs[i] = err
+		}
+	}
+	return errs, nil
+}
+
+// update changes the stored board with change, then sets fields by their
+// BSON names, if it is still at version. The version moves on by steps.
+func (r *memoryBoards) update(id primitive.ObjectID, version int64, steps int64, change func(*models.Board) error, fields map[string]interface{}) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	raw, ok := r.boards[id]
+	if !ok {
+		return ErrNotFound
+	}
+	var board models.Board
+	if err := bson.Unmarshal(raw, &board); err != nil {
+		return err
+	}
+	if version != AnyVersion && board.Version != version {
+		return ErrVersionConflict
+	}
+	if change != nil {
+		if err := change(&board); err != nil {
+			return err
+		}
+	}
+	board.Version += steps
+	if len(fields) > 0 {
+		if err := setBoardFields(&board, fields); err != nil {
+			return err
+		}
+	}
+
+	raw, err := bson.Marshal(&board)
+	if err != nil {
+		return err
+	}
+	r.boards[id] = raw
+	return nil
+}
+
+// setBoardFields sets fields of the board by their BSON names, removing
+// those set to nil
+func setBoardFields(board *models.Board, fields map[string]interface{}) error {
+	raw, err := bson.Marshal(board)
+	if err != nil {
+		return err
+	}
+	var doc bson.M
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return err
+	}
+	// New contents replace the compressed ones
+	if _, ok := fields["board"]; ok {
+		delete(doc, "boardZstd")
+		delete(doc, "boardEncoding")
+		delete(doc, "boardSize")
+	}
+	for key, value := range fields {
+		if value == nil {
+			delete(doc, key)
+		} else {
+			doc[key] = value
+		}
+	}
+
+	if raw, err = bson.Marshal(doc); err != nil {
+		return err
+	}
+	*board = models.Board{}
+	return bson.Unmarshal(raw, board)
+}
+
+func (r *memoryBoards) Delete(ctx context.Context, id primitive.ObjectID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.boards[id]; !ok {
+		return ErrNotFound
+	}
+	delete(r.boards, id)
+	return nil
+}
+
+func (r *memoryBoards) DeleteOwned(ctx context.Context, ownerID primitive.ObjectID) error {
+	owned, err := r.list(func(board *models.Board) bool { return board.OwnerID == ownerID })
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, board := range owned {
+		delete(r.boards, board.ID)
+	}
+	return nil
+}
+
+// canAccess reports whether the user owns the board or has been shared it.
+// When roles are given, collaborators must hold one of them.
+func canAccess(board *models.Board, userID primitive.ObjectID, roles ...string) bool {
+	if board.OwnerID == userID {
+		return true
+	}
+	for _, collaborator := range board.SharedWith {
+		if collaborator.UserID == userID && (len(roles) == 0 || slices.Contains(roles, collaborator.Role)) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesRef reports whether ref names the board
+func matchesRef(board *models.Board, ref string) bool {
+	if id, ok := refID(ref); ok {
+		return board.ID == id
+	}
+	return board.BoardID == ref
+}
+
+// memoryUsers keeps users in a map, for tests
+type memoryUsers struct {
+	mu    sync.RWMutex
+	users map[primitive.ObjectID]bson.M
+}
+
+// NewMemoryUsers returns an empty user repository that lives in memory
+func NewMemoryUsers() UserRepository {
+	return &memoryUsers{users: map[primitive.ObjectID]bson.M{}}
+}
+
+func (r *memoryUsers) Create(ctx context.Context, user *models.User) error {
+	raw, err := bson.Marshal(user)
+	if err != nil {
+		return err
+	}
+	var doc bson.M
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.users[user.ID] = doc
+	return nil
+}
+
+func (r *memoryUsers) FindByID(ctx context.Context, id primitive.ObjectID) (*models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	doc, ok := r.users[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return decodeUser(doc)
+}
+
+func (r *memoryUsers) FindByEmail(ctx context.Context, email string) (*models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, doc := range r.users {
+		if doc["email"] == email {
+			return decodeUser(doc)
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memoryUsers) FindByIDs(ctx context.Context, ids []primitive.ObjectID) ([]models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	found := []models.User{}
+	for _, id := range ids {
+		if doc, ok := r.users[id]; ok {
+			user, err := decodeUser(doc)
+			if err != nil {
+				return nil, err
+			}
+			found = append(found, *user)
+		}
+	}
+	return found, nil
+}
+
+func (r *memoryUsers) FindDeparted(ctx context.Context, inactiveBefore time.Time) ([]models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	found := []models.User{}
+	for _, doc := range r.users {
+		user, err := decodeUser(doc)
+		if err != nil {
+			return nil, err
+		}
+		inactive := !inactiveBefore.IsZero() && user.LastActiveAt != nil && user.LastActiveAt.Before(inactiveBefore)
+		if user.DeactivatedAt != nil || inactive {
+			found = append(found, *user)
+		}
+	}
+	return found, nil
+}
+
+func (r *memoryUsers) Update(ctx context.Context, id primitive.ObjectID, fields map[string]interface{}) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	doc, ok := r.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	updated := bson.M{}
+	for key, value := range doc {
+		updated[key] = value
+	}
+	updated["updated_at"] = primitive.NewDateTimeFromTime(time.Now())
+	for key, value := range fields {
+		updated[key] = value
+	}
+	r.users[id] = updated
+	return nil
+}
+
+func (r *memoryUsers) Delete(ctx context.Context, id primitive.ObjectID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.users[id]; !ok {
+		return ErrNotFound
+	}
+	delete(r.users, id)
+	return nil
+}
+
+func decodeUser(doc bson.M) (*models.User, error) {
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	var user models.User
+	if err := bson.Unmarshal(raw, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
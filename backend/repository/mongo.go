@@ -0,0 +1,480 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/sarwanazhar/boardsar/backend/database"
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// mongoBoards keeps boards in the boards collection
+type mongoBoards struct {
+	withoutContents bool
+}
+
+// NewMongoBoards returns the board repository backed by the connected
+// MongoDB database
+func NewMongoBoards() BoardRepository {
+	return mongoBoards{}
+}
+
+func (mongoBoards) collection() *mongo.Collection {
+	return database.GetCollection("boards")
+}
+
+// contentsProjection leaves a board's contents out, in either encoding
+var contentsProjection = bson.M{"board": 0, "boardZstd": 0}
+
+func (r mongoBoards) WithoutContents() BoardRepository {
+	return mongoBoards{withoutContents: true}
+}
+
+// BoardIDFilter matches a board by its ref
+func BoardIDFilter(ref string) bson.M {
+	if id, ok := refID(ref); ok {
+		return bson.M{"_id": id}
+	}
+	return bson.M{"boardId": ref}
+}
+
+// BoardAccessFilter matches boards the user owns or has been shared. When
+// roles are given, collaborators must hold one of them.
+func BoardAccessFilter(userID primitive.ObjectID, roles ...string) bson.M {
+	collaborator := bson.M{"userId": userID}
+	if len(roles) > 0 {
+		collaborator["role"] = bson.M{"$in": roles}
+	}
+
+	return bson.M{
+		"$or": bson.A{
+			bson.M{"ownerId": userID},
+			bson.M{"sharedWith": bson.M{"$elemMatch": collaborator}},
+		},
+	}
+}
+
+func (r mongoBoards) Create(ctx context.Context, board *models.Board) error {
+	_, err := r.collection().InsertOne(ctx, board)
+	return err
+}
+
+func (r mongoBoards) CreateMany(ctx context.Context, boards []models.Board) error {
+	docs := make([]interface{}, len(boards))
+	for i := range boards {
+		docs[i] = boards[i]
+	}
+	_, err := r.collection().InsertMany(ctx, docs)
+	return err
+}
+
+func (r mongoBoards) FindByID(ctx context.Context, id primitive.ObjectID) (*models.Board, error) {
+	return r.findOne(ctx, bson.M{"_id": id})
+}
+
+func (r mongoBoards) FindByRef(ctx context.Context, ref string) (*models.Board, error) {
+	return r.findOne(ctx, BoardIDFilter(ref))
+}
+
+func (r mongoBoards) FindForUser(ctx context.Context, ref string, userID primitive.ObjectID, roles ...string) (*models.Board, error) {
+	filter := BoardAccessFilter(userID, roles...)
+	for key, value := range BoardIDFilter(ref) {
+		filter[key] = value
+	}
+	return r.findOne(ctx, filter)
+}
+
+func (r mongoBoards) FindOwned(ctx context.Context, ref string, ownerID primitive.ObjectID) (*models.Board, error) {
+	filter := BoardIDFilter(ref)
+	filter["ownerId"] = ownerID
+	return r.findOne(ctx, filter)
+}
+
+func (r mongoBoards) ListByIDs(ctx context.Context, ids []primitive.ObjectID) ([]models.Board, error) {
+	return r.find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+}
+
+func (r mongoBoards) ListForUser(ctx context.Context, refs []string, userID primitive.ObjectID) ([]models.Board, error) {
+	if len(refs) == 0 {
+		return []models.Board{}, nil
+	}
+	named := bson.A{}
+	for _, ref := range refs {
+		named = append(named, BoardIDFilter(ref))
+	}
+	return r.find(ctx, bson.M{"$and": bson.A{BoardAccessFilter(userID), bson.M{"$or": named}}})
+}
+
+func (r mongoBoards) ListOwned(ctx context.Context, ownerID primitive.ObjectID) ([]models.Board, error) {
+	return r.find(ctx, bson.M{"ownerId": ownerID})
+}
+
+func (r mongoBoards) ListBreakouts(ctx context.Context, parentID primitive.ObjectID, userID primitive.ObjectID) ([]models.Board, error) {
+	filter := BoardAccessFilter(userID)
+	filter["parentBoardId"] = parentID
+	return r.find(ctx, filter)
+}
+
+func (r mongoBoards) ListToReencode(ctx context.Context, decompress bool, threshold int64) ([]primitive.ObjectID, error) {
+	filter := bson.M{"boardEncoding": models.BoardEncodingZstd}
+	if !decompress {
+		filter = bson.M{
+			"board": bson.M{"$type": "object"},
+			"$expr": bson.M{"$gte": bson.A{bson.M{"$bsonSize": "$board"}, threshold}},
+		}
+	}
+	cursor, err := r.collection().Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}).SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var found []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &found); err != nil {
+		return nil, err
+	}
+	ids := make([]primitive.ObjectID, len(found))
+	for i := range found {
+		ids[i] = found[i].ID
+	}
+	return ids, nil
+}
+
+func (r mongoBoards) findOne(ctx context.Context, filter bson.M) (*models.Board, error) {
+	opts := options.FindOne()
+	if r.withoutContents {
+		opts.SetProjection(contentsProjection)
+	}
+	var board models.Board
+	if err := r.collection().FindOne(ctx, filter, opts).Decode(&board); err != nil {
+		return nil, notFound(err)
+	}
+	return &board, nil
+}
+
+// find returns the boards matching filter, oldest first
+func (r mongoBoards) find(ctx context.Context, filter bson.M) ([]models.Board, error) {
+	opts := options.Find().SetSort(bson.M{"_id": 1})
+	if r.withoutContents {
+		opts.SetProjection(contentsProjection)
+	}
+	cursor, err := r.collection().Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	found := []models.Board{}
+	if err := cursor.All(ctx, &found); err != nil {
+		return nil, err
+	}
+	return found, nil
+}
+
+func (r mongoBoards) Update(ctx context.Context, id primitive.ObjectID, fields map[string]interface{}) error {
+	return r.update(ctx, bson.M{"_id": id}, fieldsUpdate(fields), ErrNotFound)
+}
+
+func (r mongoBoards) UpdateVersion(ctx context.Context, id primitive.ObjectID, version int64, fields map[string]interface{}) error {
+	return r.update(ctx, bson.M{"_id": id, "version": versionFilter(version)}, fieldsUpdate(fields), ErrVersionConflict)
+}
+
+func (r mongoBoards) SaveContents(ctx context.Context, id primitive.ObjectID, version int64, steps int64, data map[string]interface{}, fields map[string]interface{}) error {
+	update, err := BoardContentsUpdate(data, fields)
+	if err != nil {
+		return err
+	}
+	update["$inc"] = bson.M{"version": steps}
+
+	filter, unmatched := bson.M{"_id": id}, ErrNotFound
+	if version != AnyVersion {
+		filter["version"], unmatched = versionFilter(version), ErrVersionConflict
+	}
+	return r.update(ctx, filter, update, unmatched)
+}
+
+func (r mongoBoards) SetCollaborator(ctx context.Context, id primitive.ObjectID, collaborator models.Collaborator) (bool, error) {
+	set := bson.M{"sharedWith.$.role": collaborator.Role}
+	if collaborator.Capabilities != nil {
+		set["sharedWith.$.capabilities"] = collaborator.Capabilities
+	}
+	result, err := r.collection().UpdateOne(ctx,
+		bson.M{"_id": id, "sharedWith.userId": collaborator.UserID},
+		bson.M{"$set": set},
+	)
+	if err != nil || result.MatchedCount > 0 {
+		return false, err
+	}
+
+	result, err = r.collection().UpdateOne(ctx,
+		bson.M{"_id": id, "sharedWith.userId": bson.M{"$ne": collaborator.UserID}},
+		bson.M{"$push": bson.M{"sharedWith": collaborator}},
+	)
+	if err != nil {
+		return false, err
+	}
+	if result.MatchedCount == 0 {
+		// Gone, or someone shared it with them meanwhile
+		if _, err := r.FindByID(ctx, id); err != nil {
+			return false, err
+		}
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+func (r mongoBoards) RemoveCollaborator(ctx context.Context, id primitive.ObjectID, userID primitive.ObjectID) error {
+	return r.update(ctx, bson.M{"_id": id, "sharedWith.userId": userID},
+		bson.M{"$pull": bson.M{"sharedWith": bson.M{"userId": userID}}}, ErrNotFound)
+}
+
+func (r mongoBoards) RemoveFromAll(ctx context.Context, userID primitive.ObjectID) ([]primitive.ObjectID, error) {
+	filter := bson.M{"sharedWith.userId": userID}
+	ids, err := r.collection().Distinct(ctx, "_id", filter)
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+	if _, err := r.collection().UpdateMany(ctx, filter,
+		bson.M{"$pull": bson.M{"sharedWith": bson.M{"userId": userID}}}); err != nil {
+		return nil, err
+	}
+	removed := make([]primitive.ObjectID, 0, len(ids))
+	for _, id := range ids {
+		if id, ok := id.(primitive.ObjectID); ok {
+			removed = append(removed, id)
+		}
+	}
+	return removed, nil
+}
+
+func (r mongoBoards) Reencode(ctx context.Context, board *models.Board, decompress bool) error {
+	match := bson.M{"_id": board.ID, "version": versionFilter(board.Version), "updatedAt": board.UpdatedAt}
+	var update bson.M
+	if decompress {
+		match["boardEncoding"] = models.BoardEncodingZstd
+		update = bson.M{
+			"$set":   bson.M{"board": board.BoardData},
+			"$unset": bson.M{"boardZstd": "", "boardEncoding": "", "boardSize": ""},
+		}
+	} else {
+		match["boardEncoding"] = bson.M{"$exists": false}
+		var err error
+		if update, err = BoardContentsUpdate(board.BoardData, nil); err != nil {
+			return err
+		}
+	}
+	return r.update(ctx, match, update, ErrVersionConflict)
+}
+
+func (r mongoBoards) BulkWrite(ctx context.Context, writes []BoardWrite) ([]error, error) {
+	errs := make([]error, len(writes))
+	if len(writes) == 0 {
+		return errs, nil
+	}
+	batch := make([]mongo.WriteModel, len(writes))
+	for i, write := range writes {
+		filter := bson.M{"_id": write.ID}
+		if write.Delete {
+			batch[i] = mongo.NewDeleteOneModel().SetFilter(filter)
+		} else {
+			batch[i] = mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(fieldsUpdate(write.Fields))
+		}
+	}
+
+	_, err := r.collection().BulkWrite(ctx, batch, options.BulkWrite().SetOrdered(false))
+	var bulkErr mongo.BulkWriteException
+	if errors.As(err, &bulkErr) && len(bulkErr.WriteErrors) > 0 {
+		for _, writeErr := range bulkErr.WriteErrors {
+			errs[writeErr.Index] = writeErr
+		}
+		return errs, nil
+	}
+	return errs, err
+}
+
+// update applies update to the board matching filter, returning unmatched
+// if there is none
+func (r mongoBoards) update(ctx context.Context, filter, update bson.M, unmatched error) error {
+	result, err := r.collection().UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return unmatched
+	}
+	return nil
+}
+
+// BoardContentsUpdate is an update writing data as a board's contents,
+// compressed if it is large enough, along with the fields in set
+func BoardContentsUpdate(data map[string]interface{}, set map[string]interface{}) (bson.M, error) {
+	packed, size, err := models.EncodeBoardData(data)
+	if err != nil {
+		return nil, err
+	}
+
+	update := fieldsUpdate(set)
+	contents, _ := update["$set"].(bson.M)
+	if contents == nil {
+		contents = bson.M{}
+		update["$set"] = contents
+	}
+	unset, _ := update["$unset"].(bson.M)
+	if unset == nil {
+		unset = bson.M{}
+		update["$unset"] = unset
+	}
+	if packed == nil {
+		contents["board"] = data
+		unset["boardZstd"], unset["boardEncoding"], unset["boardSize"] = "", "", ""
+		return update, nil
+	}
+	contents["boardZstd"] = packed
+	contents["boardEncoding"] = models.BoardEncodingZstd
+	contents["boardSize"] = size
+	unset["board"] = ""
+	return update, nil
+}
+
+// fieldsUpdate sets fields, removing those set to nil
+func fieldsUpdate(fields map[string]interface{}) bson.M {
+	set, unset := bson.M{}, bson.M{}
+	for key, value := range fields {
+		if value == nil {
+			unset[key] = ""
+		} else {
+			set[key] = value
+		}
+	}
+	update := bson.M{}
+	if len(set) > 0 {
+		update["$set"] = set
+	}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+	return update
+}
+
+// versionFilter matches boards at version. Boards saved before versioning
+// have none, and count as version 0.
+func versionFilter(version int64) interface{} {
+	if version == 0 {
+		return bson.M{"$in": bson.A{0, nil}}
+	}
+	return version
+}
+
+func (r mongoBoards) Delete(ctx context.Context, id primitive.ObjectID) error {
+	result, err := r.collection().DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r mongoBoards) DeleteOwned(ctx context.Context, ownerID primitive.ObjectID) error {
+	_, err := r.collection().DeleteMany(ctx, bson.M{"ownerId": ownerID})
+	return err
+}
+
+// mongoUsers keeps users in the users collection
+type mongoUsers struct{}
+
+// NewMongoUsers returns the user repository backed by the connected
+// MongoDB database
+func NewMongoUsers() UserRepository {
+	return mongoUsers{}
+}
+
+func (mongoUsers) collection() *mongo.Collection {
+	return database.GetCollection("users")
+}
+
+func (r mongoUsers) Create(ctx context.Context, user *models.User) error {
+	_, err := r.collection().InsertOne(ctx, user)
+	return err
+}
+
+func (r mongoUsers) FindByID(ctx context.Context, id primitive.ObjectID) (*models.User, error) {
+	return r.findOne(ctx, bson.M{"_id": id})
+}
+
+func (r mongoUsers) FindByEmail(ctx context.Context, email string) (*models.User, error) {
+	return r.findOne(ctx, bson.M{"email": email})
+}
+
+func (r mongoUsers) FindByIDs(ctx context.Context, ids []primitive.ObjectID) ([]models.User, error) {
+	cursor, err := r.collection().Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+	found := []models.User{}
+	if err := cursor.All(ctx, &found); err != nil {
+		return nil, err
+	}
+	return found, nil
+}
+
+func (r mongoUsers) FindDeparted(ctx context.Context, inactiveBefore time.Time) ([]models.User, error) {
+	departed := bson.A{bson.M{"deactivated_at": bson.M{"$ne": nil}}}
+	if !inactiveBefore.IsZero() {
+		departed = append(departed, bson.M{"last_active_at": bson.M{"$lt": inactiveBefore}})
+	}
+	cursor, err := r.collection().Find(ctx, bson.M{"$or": departed})
+	if err != nil {
+		return nil, err
+	}
+	found := []models.User{}
+	if err := cursor.All(ctx, &found); err != nil {
+		return nil, err
+	}
+	return found, nil
+}
+
+func (r mongoUsers) findOne(ctx context.Context, filter bson.M) (*models.User, error) {
+	var user models.User
+	if err := r.collection().FindOne(ctx, filter).Decode(&user); err != nil {
+		return nil, notFound(err)
+	}
+	return &user, nil
+}
+
+func (r mongoUsers) Update(ctx context.Context, id primitive.ObjectID, fields map[string]interface{}) error {
+	set := bson.M{"updated_at": time.Now()}
+	for key, value := range fields {
+		set[key] = value
+	}
+	result, err := r.collection().UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": set})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r mongoUsers) Delete(ctx context.Context, id primitive.ObjectID) error {
+	result, err := r.collection().DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// notFound turns the driver's no-documents error into ErrNotFound
+func notFound(err error) error {
+	if err == mongo.ErrNoDocuments {
+		return ErrNotFound
+	}
+	return err
+}
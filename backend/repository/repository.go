@@ -0,0 +1,125 @@
+// Package repository is where boards and users are kept. Handlers go
+// through its interfaces rather than MongoDB collections, so the Mongo
+// implementation can be swapped for the in-memory one in tests.
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/sarwanazhar/boardsar/backend/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	// ErrNotFound is returned when no board or user matches
+	ErrNotFound = errors.New("not found")
+	// ErrVersionConflict is returned by version-checked writes when the
+	// board was saved since that version was read
+	ErrVersionConflict = errors.New("board changed since it was read")
+)
+
+// AnyVersion makes a version-checked write apply whatever the board's
+// version is
+const AnyVersion int64 = -1
+
+// BoardRepository stores boards. A board ref is its ObjectID in hex, or
+// its boardId when it isn't one. Lists come back oldest first.
+type BoardRepository interface {
+	// WithoutContents is the same repository, but its finds and lists
+	// leave the board contents out, for callers that only need the rest
+	WithoutContents() BoardRepository
+	// Create stores a new board
+	Create(ctx context.Context, board *models.Board) error
+	// CreateMany stores new boards
+	CreateMany(ctx context.Context, boards []models.Board) error
+	// FindByID returns the board with this ObjectID
+	FindByID(ctx context.Context, id primitive.ObjectID) (*models.Board, error)
+	// FindByRef returns the board ref names, whoever can see it
+	FindByRef(ctx context.Context, ref string) (*models.Board, error)
+	// FindForUser returns the board if the user owns it or it's shared
+	// with them. When roles are given, collaborators must hold one of them.
+	FindForUser(ctx context.Context, ref string, userID primitive.ObjectID, roles ...string) (*models.Board, error)
+	// FindOwned returns the board if the user owns it
+	FindOwned(ctx context.Context, ref string, ownerID primitive.ObjectID) (*models.Board, error)
+	// ListByIDs returns the boards that exist of those with these IDs
+	ListByIDs(ctx context.Context, ids []primitive.ObjectID) ([]models.Board, error)
+	// ListForUser returns the boards of those refs name that the user owns
+	// or has been shared
+	ListForUser(ctx context.Context, refs []string, userID primitive.ObjectID) ([]models.Board, error)
+	// ListOwned returns every board the user owns
+	ListOwned(ctx context.Context, ownerID primitive.ObjectID) ([]models.Board, error)
+	// ListBreakouts returns the breakout boards of the parent that the user
+	// owns or has been shared
+	ListBreakouts(ctx context.Context, parentID primitive.ObjectID, userID primitive.ObjectID) ([]models.Board, error)
+	// ListToReencode returns the IDs of the boards stored in the other
+	// encoding than they'd be written in now: compressed ones with
+	// decompress, else uncompressed ones of at least threshold bytes
+	ListToReencode(ctx context.Context, decompress bool, threshold int64) ([]primitive.ObjectID, error)
+	// Update sets the given fields, by their BSON names, leaving the
+	// contents and version as they are. Fields set to nil are removed.
+	Update(ctx context.Context, id primitive.ObjectID, fields map[string]interface{}) error
+	// UpdateVersion is Update, applied only while the board is still at
+	// version
+	UpdateVersion(ctx context.Context, id primitive.ObjectID, version int64, fields map[string]interface{}) error
+	// SaveContents writes data as the board's contents along with the
+	// given fields, and moves its version on by steps. It only applies
+	// while the board is still at version, unless that is AnyVersion.
+	SaveContents(ctx context.Context, id primitive.ObjectID, version int64, steps int64, data map[string]interface{}, fields map[string]interface{}) error
+	// SetCollaborator shares the board with the collaborator, or changes
+	// their role and capabilities if it already is, reporting whether they
+	// were added
+	SetCollaborator(ctx context.Context, id primitive.ObjectID, collaborator models.Collaborator) (bool, error)
+	// RemoveCollaborator stops sharing the board with the user. It returns
+	// ErrNotFound if it wasn't shared with them.
+	RemoveCollaborator(ctx context.Context, id primitive.ObjectID, userID primitive.ObjectID) error
+	// RemoveFromAll stops sharing every board with the user, returning the
+	// boards they were taken off
+	RemoveFromAll(ctx context.Context, userID primitive.ObjectID) ([]primitive.ObjectID, error)
+	// Reencode writes the board's contents compressed if they are large
+	// enough, or with decompress as a document, unless the board was saved
+	// since it was read, which is ErrVersionConflict. Neither the version
+	// nor updatedAt changes.
+	Reencode(ctx context.Context, board *models.Board, decompress bool) error
+	// BulkWrite applies the writes independently of each other, returning
+	// each one's error, nil where it succeeded or the board is gone. The
+	// error is for the whole batch failing.
+	BulkWrite(ctx context.Context, writes []BoardWrite) ([]error, error)
+	// Delete removes the board
+	Delete(ctx context.Context, id primitive.ObjectID) error
+	// DeleteOwned removes every board the user owns
+	DeleteOwned(ctx context.Context, ownerID primitive.ObjectID) error
+}
+
+// BoardWrite is one write of a BulkWrite: the board's removal, or else
+// the fields to set as Update sets them
+type BoardWrite struct {
+	ID     primitive.ObjectID
+	Delete bool
+	Fields map[string]interface{}
+}
+
+// UserRepository stores user accounts
+type UserRepository interface {
+	// Create stores a new user, whose ID is already set
+	Create(ctx context.Context, user *models.User) error
+	FindByID(ctx context.Context, id primitive.ObjectID) (*models.User, error)
+	FindByEmail(ctx context.Context, email string) (*models.User, error)
+	// FindByIDs returns the users that exist of those with these IDs
+	FindByIDs(ctx context.Context, ids []primitive.ObjectID) ([]models.User, error)
+	// FindDeparted returns the deactivated users, and unless inactiveBefore
+	// is zero, those last active before it
+	FindDeparted(ctx context.Context, inactiveBefore time.Time) ([]models.User, error)
+	// Update sets the given fields, by their BSON names, and bumps
+	// updated_at
+	Update(ctx context.Context, id primitive.ObjectID, fields map[string]interface{}) error
+	// Delete removes the user
+	Delete(ctx context.Context, id primitive.ObjectID) error
+}
+
+// refID is the ObjectID a board ref names, if it is one
+func refID(ref string) (primitive.ObjectID, bool) {
+	id, err := primitive.ObjectIDFromHex(ref)
+	return id, err == nil
+}
@@ -0,0 +1,19 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/controllers"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/models"
+)
+
+func InitActivityRoutes(router *gin.Engine) {
+	// Protected activity routes
+	activity := router.Group("/api/activity")
+	activity.Use(libs.JWTMiddleware())
+	{
+		// What the user did across boards; a board's own feed is under
+		// /api/boards/:boardId/activity
+		activity.GET("", libs.RequireScope(models.ScopeBoardsRead), controllers.GetMyActivity)
+	}
+}
@@ -0,0 +1,60 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/controllers"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+)
+
+func InitAdminRoutes(router *gin.Engine) {
+	// Admin-only routes
+	admin := router.Group("/api/admin")
+	admin.Use(libs.JWTMiddleware(), libs.FirstPartyMiddleware(), libs.AdminMiddleware())
+	{
+		// Legal holds
+		admin.GET("/legal-holds", controllers.GetLegalHolds)
+		admin.POST("/legal-holds", controllers.CreateLegalHold)
+		admin.DELETE("/legal-holds/:holdId", controllers.ReleaseLegalHold)
+
+		// Read-only (failover/maintenance) mode
+		admin.GET("/read-only", controllers.GetReadOnlyMode)
+		admin.PUT("/read-only", controllers.SetReadOnlyMode)
+
+		// Audit log export for SIEM ingestion
+		admin.GET("/audit-events", controllers.ExportAuditEvents)
+
+		// Custom shape types validated by JSON Schema
+		admin.PUT("/shape-types/:type", controllers.PutShapeType)
+		admin.DELETE("/shape-types/:type", controllers.DeleteShapeType)
+
+		// Per-tenant CORS origins and rejected-origin metrics
+		admin.GET("/cors", controllers.GetCORSConfig)
+		admin.PUT("/cors/tenants/:tenant", controllers.PutCORSTenant)
+		admin.DELETE("/cors/tenants/:tenant", controllers.DeleteCORSTenant)
+
+		// Savings from archiving idle boards to cold storage
+		admin.GET("/board-archive", controllers.GetBoardArchiveStats)
+
+		// Hits and misses of the Redis cache in front of GetBoard
+		admin.GET("/board-cache", controllers.GetBoardCacheStats)
+
+		// Verbose request logging
+		admin.GET("/request-logging", controllers.GetRequestLogging)
+		admin.PUT("/request-logging", controllers.SetRequestLogging)
+
+		// Load on the worker pools of exports, imports, AI, thumbnails and
+		// maintenance
+		admin.GET("/worker-pools", controllers.GetWorkerPools)
+
+		// Deactivated members, and the policy handing over their boards
+		admin.POST("/users/:userId/deactivate", controllers.DeactivateUser)
+		admin.POST("/users/:userId/reactivate", controllers.ReactivateUser)
+		admin.GET("/succession", controllers.GetSuccessionPolicy)
+		admin.PUT("/succession", controllers.PutSuccessionPolicy)
+		admin.POST("/succession/run", controllers.RunSuccessionPolicy)
+
+		// Storage used per collection, and maintenance run as jobs
+		admin.GET("/storage", controllers.GetStorageReport)
+		admin.POST("/storage/maintenance", controllers.StartStorageMaintenance)
+	}
+}
@@ -0,0 +1,22 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/controllers"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/models"
+)
+
+func InitAssetRoutes(router *gin.Engine) {
+	// Images uploaded for boards; access follows the board's
+	asset := router.Group("/api/assets")
+	asset.Use(libs.JWTMiddleware())
+
+	read := libs.RequireScope(models.ScopeBoardsRead)
+	write := libs.RequireScope(models.ScopeBoardsWrite)
+	{
+		asset.POST("", write, controllers.UploadAsset)
+		asset.GET("/:assetId", read, controllers.GetAsset)
+		asset.DELETE("/:assetId", write, controllers.DeleteAsset)
+	}
+}
@@ -4,26 +4,178 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/sarwanazhar/boardsar/backend/controllers"
 	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/models"
 )
 
 func InitBoardRoutes(router *gin.Engine) {
 	// Protected board routes
 	board := router.Group("/api/boards")
-	board.Use(libs.JWTMiddleware())
+	// Mobile clients can send and receive msgpack instead of JSON, and
+	// gzip either. Requests are rate limited per user, and archived boards
+	// are brought back from cold storage on first access.
+	board.Use(libs.GzipMiddleware(), libs.MsgpackMiddleware(), libs.JWTMiddleware(), libs.BoardRateLimitMiddleware(), libs.RehydrateBoardMiddleware())
+
+	// Scopes OAuth apps need; first-party tokens pass all of them
+	read := libs.RequireScope(models.ScopeBoardsRead)
+	write := libs.RequireScope(models.ScopeBoardsWrite)
+	firstParty := libs.FirstPartyMiddleware()
+
+	// Capabilities collaborators need; owners have them all
+	canExport := libs.RequireBoardCapability(models.CapabilityExport)
+	canShare := libs.RequireBoardCapability(models.CapabilityShare)
+	canSeeHistory := libs.RequireBoardCapability(models.CapabilityHistory)
 	{
 		// List all boards for the authenticated user
-		board.GET("", controllers.GetBoards)
+		board.GET("", read, controllers.GetBoards)
 
 		// Create a new board
-		board.POST("", controllers.CreateBoard)
+		board.POST("", write, controllers.CreateBoard)
+
+		// Delete, archive, move or tag many boards in one request
+		board.POST("/bulk", write, controllers.BulkBoards)
+
+		// Create a board from an Excalidraw or tldraw scene file
+		board.POST("/import", write, controllers.ImportBoard)
 
 		// Get a specific board by ID
-		board.GET("/:boardId", controllers.GetBoard)
+		board.GET("/:boardId", read, controllers.GetBoard)
+
+		// Shapes within a viewport (?bbox=minX,minY,maxX,maxY), for loading
+		// large boards as the user pans
+		board.GET("/:boardId/shapes", read, controllers.GetBoardShapes)
+
+		// Shapes under a point or along an eraser stroke, and a coarse
+		// overview for the minimap
+		board.GET("/:boardId/shapes/hit", read, controllers.HitTestShapes)
+		board.GET("/:boardId/minimap", read, controllers.GetBoardMinimap)
+
+		// Raster tiles of the board at several zoom levels, for the minimap
+		// and zoomed-out views
+		board.GET("/:boardId/tiles/:z/:x/:y", read, controllers.GetBoardTile)
+
+		// Who did what on the board, most recent first
+		board.GET("/:boardId/activity", read, canSeeHistory, controllers.GetBoardActivity)
+
+		// Small PNG preview for the dashboard
+		board.GET("/:boardId/thumbnail", read, controllers.GetBoardThumbnail)
 
 		// Update an existing board
-		board.PUT("/:boardId", controllers.UpdateBoard)
+		board.PUT("/:boardId", write, controllers.UpdateBoard)
+
+		// Apply incremental operations to a board
+		board.PATCH("/:boardId", write, controllers.PatchBoard)
+
+		// Rename a board, change its description or tags, or move it to a folder
+		board.PATCH("/:boardId/meta", write, controllers.PatchBoardMeta)
+
+		// Delete a board, or schedule its deletion when there is a grace
+		// period; see or cancel a scheduled one (owner only)
+		board.DELETE("/:boardId", write, controllers.DeleteBoard)
+		board.GET("/:boardId/deletion", read, controllers.GetBoardDeletion)
+		board.DELETE("/:boardId/deletion", write, controllers.CancelBoardDeletion)
+
+		// Star or unstar a board for yourself
+		board.POST("/:boardId/star", write, controllers.StarBoard)
+		board.DELETE("/:boardId/star", write, controllers.UnstarBoard)
+
+		// Share a board / change a collaborator's role and capabilities
+		// (first-party only, like everything that hands out access)
+		board.POST("/:boardId/share", firstParty, canShare, controllers.ShareBoard)
+
+		// Remove a collaborator (or leave a shared board)
+		board.DELETE("/:boardId/share/:userId", firstParty, controllers.UnshareBoard)
+
+		// Read-only share links and their usage history (owner only)
+		board.POST("/:boardId/share-links", firstParty, controllers.CreateShareLink)
+		board.GET("/:boardId/share-links", firstParty, controllers.GetShareLinks)
+		board.GET("/:boardId/share-links/:linkId", firstParty, controllers.GetShareLink)
+		board.DELETE("/:boardId/share-links/:linkId", firstParty, controllers.RevokeShareLink)
+
+		// Short /s/:code links to the board, a share link or an export,
+		// with their clicks
+		board.POST("/:boardId/short-links", firstParty, controllers.CreateShortLink)
+		board.GET("/:boardId/short-links", firstParty, controllers.GetShortLinks)
+		board.GET("/:boardId/short-links/:linkId", firstParty, controllers.GetShortLink)
+		board.DELETE("/:boardId/short-links/:linkId", firstParty, controllers.DeleteShortLink)
+
+		// Embed tokens; apps with boards:write can issue them for the
+		// sites they embed boards on
+		board.POST("/:boardId/embed-tokens", write, controllers.CreateEmbedToken)
+		board.GET("/:boardId/embed-tokens", write, controllers.GetEmbedTokens)
+		board.DELETE("/:boardId/embed-tokens/:tokenId", write, controllers.RevokeEmbedToken)
+
+		// Plugins enabled on the board; switching them is owner only
+		board.GET("/:boardId/plugins", read, controllers.GetBoardPlugins)
+		board.PUT("/:boardId/plugins/:plugin", write, controllers.SetBoardPlugin)
+
+		// Start/change or end a facilitated session (owner only)
+		board.PUT("/:boardId/facilitation", write, controllers.StartFacilitation)
+		board.DELETE("/:boardId/facilitation", write, controllers.EndFacilitation)
+
+		// Reveal all private notes at once (owner only)
+		board.POST("/:boardId/facilitation/reveal", write, controllers.RevealNotes)
+
+		// Schedule or lift a freeze, after which only the owner can change
+		// the board (owner only)
+		board.PUT("/:boardId/freeze", write, controllers.ScheduleBoardFreeze)
+		board.DELETE("/:boardId/freeze", write, controllers.LiftBoardFreeze)
+
+		// Accessible outline of the board (JSON or ?format=html)
+		board.GET("/:boardId/outline", read, controllers.GetBoardOutline)
+
+		// Size and complexity against the limits a board runs into
+		board.GET("/:boardId/health", read, controllers.GetBoardHealth)
+
+		// Version history; labelling a version makes it a milestone, which
+		// is never pruned
+		board.GET("/:boardId/versions", read, canSeeHistory, controllers.GetBoardVersions)
+		board.POST("/:boardId/versions", write, canSeeHistory, controllers.CreateBoardVersion)
+		board.GET("/:boardId/versions/:versionId", read, canSeeHistory, controllers.GetBoardVersion)
+		board.POST("/:boardId/versions/:versionId/label", write, canSeeHistory, controllers.LabelBoardVersion)
+		board.POST("/:boardId/versions/:versionId/restore", write, canSeeHistory, controllers.RestoreBoardVersion)
+		board.DELETE("/:boardId/versions/:versionId/label", write, canSeeHistory, controllers.UnlabelBoardVersion)
+		board.GET("/:boardId/milestones", read, canSeeHistory, controllers.GetBoardMilestones)
+		board.GET("/:boardId/diff", read, canSeeHistory, controllers.DiffBoardVersions)
+
+		// Save the board as a template (audited as an export)
+		board.POST("/:boardId/save-as-template", write, canExport, controllers.SaveBoardAsTemplate)
+
+		// Export the board (audited); who may export is set by the owner,
+		// per board and per collaborator
+		board.GET("/:boardId/export", read, canExport, controllers.ExportBoard)
+		board.GET("/:boardId/exports", read, controllers.GetBoardExports)
+		board.PUT("/:boardId/export-settings", firstParty, controllers.SetExportSettings)
+
+		// Suggest groups of similar sticky notes (read-only)
+		board.POST("/:boardId/cluster", read, controllers.ClusterNotes)
+
+		// Spellcheck and terminology lint (read-only)
+		board.POST("/:boardId/lint", read, controllers.LintBoard)
+
+		// Breakout boards: spawn, list, and merge back into the parent
+		board.POST("/:boardId/breakouts", write, controllers.CreateBreakouts)
+		board.GET("/:boardId/breakouts", read, controllers.GetBreakouts)
+		board.POST("/:boardId/breakouts/merge", write, controllers.MergeBreakouts)
+
+		// Lay out a Mermaid or PlantUML diagram and add it to the board
+		board.POST("/:boardId/import-diagram", write, controllers.ImportDiagram)
+
+		// Add a CSV's rows as sticky notes, or preview where they'd go
+		board.POST("/:boardId/import-csv", write, controllers.ImportCSV)
+		board.POST("/:boardId/import-csv/preview", read, controllers.PreviewCSVImport)
+
+		// Lay out shapes and connectors; answers with the operations to apply
+		board.POST("/:boardId/layout", write, controllers.LayoutShapes)
+
+		// Align, distribute or tidy many shapes as one change
+		board.POST("/:boardId/arrange", write, controllers.ArrangeShapes)
 
-		// Delete a board
-		board.DELETE("/:boardId", controllers.DeleteBoard)
+		// Named sections; collapsing one is per user, so viewers can too
+		board.GET("/:boardId/sections", read, controllers.GetBoardSections)
+		board.POST("/:boardId/sections", write, controllers.CreateSection)
+		board.PATCH("/:boardId/sections/:sectionId", write, controllers.UpdateSection)
+		board.DELETE("/:boardId/sections/:sectionId", write, controllers.DeleteSection)
+		board.POST("/:boardId/sections/:sectionId/move", write, controllers.MoveSection)
+		board.PUT("/:boardId/sections/:sectionId/collapse", read, controllers.SetSectionCollapsed)
 	}
 }
@@ -0,0 +1,38 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/controllers"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/models"
+)
+
+func InitClassroomRoutes(router *gin.Engine) {
+	// Protected classroom routes, for the teacher who made the classroom
+	// and, where noted, its students
+	classroom := router.Group("/api/classrooms")
+	classroom.Use(libs.JWTMiddleware())
+
+	read := libs.RequireScope(models.ScopeBoardsRead)
+	write := libs.RequireScope(models.ScopeBoardsWrite)
+	{
+		// A board per student from a template and a roster of emails
+		classroom.GET("", read, controllers.GetClassrooms)
+		classroom.POST("", write, controllers.CreateClassroom)
+		classroom.POST("/:classroomId/students", write, controllers.AddClassroomStudents)
+
+		// Each student's board and activity on it
+		classroom.GET("/:classroomId/dashboard", read, controllers.GetClassroomDashboard)
+
+		// Reviewing and grading the students' boards
+		classroom.PUT("/:classroomId/students/:userId/review", write, controllers.ReviewStudentBoard)
+		classroom.POST("/:classroomId/students/:userId/comments", write, controllers.AddGradingComment)
+		classroom.DELETE("/:classroomId/students/:userId/comments/:commentId", write, controllers.DeleteGradingComment)
+		classroom.GET("/:classroomId/grades", read, controllers.ExportGrades)
+
+		// For students: their boards, handed in for review
+		classroom.GET("/assignments", read, controllers.GetAssignments)
+		classroom.POST("/:classroomId/submission", write, controllers.SubmitAssignment)
+		classroom.DELETE("/:classroomId/submission", write, controllers.WithdrawSubmission)
+	}
+}
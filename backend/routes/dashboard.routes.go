@@ -0,0 +1,18 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/controllers"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/models"
+)
+
+func InitDashboardRoutes(router *gin.Engine) {
+	// Protected dashboard route
+	dashboard := router.Group("/api/dashboard")
+	dashboard.Use(libs.JWTMiddleware(), libs.RequireScope(models.ScopeBoardsRead))
+	{
+		// All dashboard sections in one response
+		dashboard.GET("", controllers.GetDashboard)
+	}
+}
@@ -0,0 +1,28 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/controllers"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+)
+
+func InitDebugRoutes(router *gin.Engine) {
+	// Profiling, admin only
+	profiling := router.Group("/debug/pprof")
+	profiling.Use(libs.JWTMiddleware(), libs.FirstPartyMiddleware(), libs.AdminMiddleware())
+	{
+		profiling.GET("/*name", controllers.Pprof)
+		profiling.POST("/*name", controllers.Pprof)
+	}
+
+	// Fault injection is dev-only; the routes don't exist otherwise
+	if !libs.ChaosEnabled() {
+		return
+	}
+
+	router.Use(libs.ChaosMiddleware())
+
+	router.GET("/debug/chaos", controllers.GetChaosRules)
+	router.PUT("/debug/chaos", controllers.SetChaosRule)
+	router.DELETE("/debug/chaos", controllers.ClearChaosRules)
+}
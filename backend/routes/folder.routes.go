@@ -0,0 +1,24 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/controllers"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/models"
+)
+
+func InitFolderRoutes(router *gin.Engine) {
+	// Protected folder routes
+	folder := router.Group("/api/folders")
+	folder.Use(libs.JWTMiddleware())
+
+	read := libs.RequireScope(models.ScopeBoardsRead)
+	write := libs.RequireScope(models.ScopeBoardsWrite)
+	{
+		// The user's folders; boards are moved with PATCH /api/boards/:boardId/meta
+		folder.GET("", read, controllers.GetFolders)
+		folder.POST("", write, controllers.CreateFolder)
+		folder.PUT("/:folderId", write, controllers.UpdateFolder)
+		folder.DELETE("/:folderId", write, controllers.DeleteFolder)
+	}
+}
@@ -0,0 +1,21 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/controllers"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+)
+
+func InitJobRoutes(router *gin.Engine) {
+	// Progress events; the stream authenticates itself since EventSource
+	// can't send an Authorization header
+	router.GET("/api/jobs/:jobId/events", controllers.StreamJobEvents)
+
+	// Requests that outran their synchronous budget, for their requester
+	jobs := router.Group("/api/jobs")
+	jobs.Use(libs.JWTMiddleware())
+	{
+		jobs.GET("/:jobId", controllers.GetJob)
+		jobs.GET("/:jobId/result", controllers.GetJobResult)
+	}
+}
@@ -4,32 +4,96 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/sarwanazhar/boardsar/backend/controllers"
 	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/models"
 )
 
 func InitRoutes(router *gin.Engine) {
+	// Debug routes go first so the dev-only chaos middleware wraps every route
+	InitDebugRoutes(router)
+
 	router.GET("/", func(ctx *gin.Context) {
 		ctx.JSON(200, gin.H{
 			"working": "working",
 		})
 	})
 
-	router.GET("/health", func(c *gin.Context) {
-		c.JSON(200, gin.H{
-			"status": "ok",
-		})
-	})
+	// Liveness and readiness probes; /health is kept for existing monitors
+	router.GET("/health", controllers.Liveness)
+	router.GET("/health/live", controllers.Liveness)
+	router.GET("/health/ready", controllers.Readiness)
 
-	// Public auth routes
-	router.POST("/auth/register", controllers.RegisterUser)
-	router.POST("/auth/login", controllers.LoginUser)
+	// Public auth routes, rate limited per IP
+	authLimit := libs.AuthRateLimitMiddleware()
+	router.POST("/auth/register", authLimit, controllers.RegisterUser)
+	router.POST("/auth/login", authLimit, controllers.LoginUser)
+	router.POST("/auth/refresh", authLimit, controllers.RefreshToken)
+	router.POST("/auth/logout", controllers.LogoutUser)
+	router.POST("/auth/forgot-password", authLimit, controllers.ForgotPassword)
+	router.POST("/auth/reset-password", authLimit, controllers.ResetPassword)
+	router.POST("/auth/magic-link", authLimit, controllers.RequestMagicLink)
+	router.GET("/auth/magic-link/verify", authLimit, controllers.VerifyMagicLinkFromEmail)
+	router.POST("/auth/magic-link/verify", authLimit, controllers.VerifyMagicLink)
+	router.POST("/auth/2fa/verify", authLimit, controllers.VerifyTwoFactor)
+	router.POST("/auth/change-email/confirm", authLimit, controllers.ConfirmEmailChange)
+	router.POST("/deletions/confirm", authLimit, controllers.ConfirmDeletion)
+	router.POST("/deletions/cancel", authLimit, controllers.CancelDeletionByLink)
+
+	// Uploaded avatars, shown to anyone sharing a board with their owner
+	router.GET("/avatars/:avatarId", controllers.GetAvatar)
 
 	// Protected routes
 	auth := router.Group("/")
 	auth.Use(libs.JWTMiddleware())
+	profile := libs.RequireScope(models.ScopeProfile)
 	{
-		auth.GET("/me", controllers.GetProfile)
+		auth.GET("/me", profile, controllers.GetProfile)
+		auth.PATCH("/me", profile, controllers.UpdateProfile)
+		auth.POST("/me/avatar", profile, controllers.UploadAvatar)
+		auth.DELETE("/me/avatar", profile, controllers.DeleteAvatar)
+		auth.PUT("/me/locale", profile, controllers.UpdateLocale)
+		auth.GET("/me/lint-dictionary", profile, controllers.GetLintDictionary)
+		auth.PUT("/me/lint-dictionary", profile, controllers.UpdateLintDictionary)
+		auth.POST("/me/import-from-instance", libs.FirstPartyMiddleware(), controllers.ImportFromInstance)
+	}
+
+	// Managing your account, from the first-party app only
+	account := router.Group("/auth")
+	account.Use(libs.JWTMiddleware(), libs.FirstPartyMiddleware())
+	{
+		account.POST("/change-password", authLimit, controllers.ChangePassword)
+		account.POST("/change-email", authLimit, controllers.ChangeEmail)
+		account.DELETE("/account", controllers.DeleteAccount)
+		account.GET("/account/deletion", controllers.GetAccountDeletion)
+		account.DELETE("/account/deletion", controllers.CancelAccountDeletion)
+		account.GET("/export", controllers.ExportAccount)
+		account.GET("/sessions", controllers.ListSessions)
+		account.DELETE("/sessions/:sessionId", controllers.RevokeSession)
+		account.GET("/2fa", controllers.GetTwoFactor)
+		account.POST("/2fa/setup", controllers.SetUpTwoFactor)
+		account.POST("/2fa/enable", authLimit, controllers.EnableTwoFactor)
+		account.POST("/2fa/disable", authLimit, controllers.DisableTwoFactor)
+		account.POST("/2fa/recovery-codes", authLimit, controllers.RegenerateRecoveryCodes)
 	}
 
 	// Initialize board routes
 	InitBoardRoutes(router)
+	InitAssetRoutes(router)
+	InitTemplateRoutes(router)
+	InitFolderRoutes(router)
+	InitClassroomRoutes(router)
+	InitActivityRoutes(router)
+	InitRealtimeRoutes(router)
+	InitShareLinkRoutes(router)
+	InitOAuthRoutes(router)
+	InitPasskeyRoutes(router)
+	InitPushRoutes(router)
+	InitWebhookRoutes(router)
+	InitPluginRoutes(router)
+	InitJobRoutes(router)
+
+	// Initialize dashboard routes
+	InitDashboardRoutes(router)
+
+	// Initialize admin routes
+	InitAdminRoutes(router)
 }
@@ -0,0 +1,47 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/controllers"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+)
+
+func InitOAuthRoutes(router *gin.Engine) {
+	// Public: OAuth2 token endpoint; apps authenticate themselves. Rate
+	// limited per IP, like sign-in.
+	router.POST("/oauth/token", libs.AuthRateLimitMiddleware(), controllers.OAuthToken)
+
+	// Public: sign in with Apple or GitHub. Apple posts its callback
+	// (response_mode form_post), GitHub redirects with a GET.
+	router.GET("/auth/oauth/:provider", controllers.StartProviderSignIn)
+	router.GET("/auth/oauth/:provider/callback", controllers.ProviderCallback)
+	router.POST("/auth/oauth/:provider/callback", controllers.ProviderCallback)
+
+	// App registration and consent, for signed-in users of the first-party
+	// app only; an app can't grant itself more access
+	oauth := router.Group("/api/oauth")
+	oauth.Use(libs.JWTMiddleware(), libs.FirstPartyMiddleware())
+	{
+		// Apps you registered
+		oauth.POST("/clients", controllers.CreateOAuthClient)
+		oauth.GET("/clients", controllers.GetOAuthClients)
+		oauth.DELETE("/clients/:clientId", controllers.DeleteOAuthClient)
+
+		// Consent screen: describe the request, then approve it
+		oauth.GET("/authorize", controllers.GetOAuthAuthorization)
+		oauth.POST("/authorize", controllers.ApproveOAuthAuthorization)
+
+		// Apps connected to your account
+		oauth.GET("/grants", controllers.GetOAuthGrants)
+		oauth.DELETE("/grants/:clientId", controllers.RevokeOAuthGrant)
+	}
+
+	// Sign-in providers linked to your account
+	identities := router.Group("/me/identities")
+	identities.Use(libs.JWTMiddleware(), libs.FirstPartyMiddleware())
+	{
+		identities.GET("", controllers.GetIdentities)
+		identities.POST("/:provider", controllers.LinkIdentity)
+		identities.DELETE("/:provider", controllers.UnlinkIdentity)
+	}
+}
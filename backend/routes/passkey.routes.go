@@ -0,0 +1,32 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/controllers"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+)
+
+func InitPasskeyRoutes(router *gin.Engine) {
+	// Public: sign in with a passkey, rate limited per IP
+	authLimit := libs.AuthRateLimitMiddleware()
+	router.POST("/auth/webauthn/login/begin", authLimit, controllers.BeginPasskeyLogin)
+	router.POST("/auth/webauthn/login/finish", authLimit, controllers.FinishPasskeyLogin)
+
+	// Adding a passkey, for signed-in users of the first-party app only
+	register := router.Group("/auth/webauthn/register")
+	register.Use(libs.JWTMiddleware(), libs.FirstPartyMiddleware())
+	{
+		register.POST("/begin", controllers.BeginPasskeyRegistration)
+		register.POST("/finish", controllers.FinishPasskeyRegistration)
+	}
+
+	// Your passkeys and passwordless sign-in
+	me := router.Group("/me")
+	me.Use(libs.JWTMiddleware(), libs.FirstPartyMiddleware())
+	{
+		me.GET("/passkeys", controllers.GetPasskeys)
+		me.PATCH("/passkeys/:passkeyId", controllers.RenamePasskey)
+		me.DELETE("/passkeys/:passkeyId", controllers.DeletePasskey)
+		me.PUT("/passwordless", controllers.SetPasswordless)
+	}
+}
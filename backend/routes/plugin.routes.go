@@ -0,0 +1,22 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/controllers"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/plugins"
+)
+
+func InitPluginRoutes(router *gin.Engine) {
+	// Installed plugins
+	router.GET("/api/plugins", libs.JWTMiddleware(), controllers.GetPlugins)
+
+	// Custom shape types from plugins and admin-registered schemas
+	router.GET("/api/shape-types", libs.JWTMiddleware(), controllers.GetShapeTypes)
+
+	// Plugin endpoints, namespaced as /api/ext/<plugin>. Plugins don't know
+	// about OAuth scopes, so apps can't call them.
+	ext := router.Group("/api/ext")
+	ext.Use(libs.JWTMiddleware(), libs.FirstPartyMiddleware())
+	plugins.MountRoutes(ext)
+}
@@ -0,0 +1,23 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/controllers"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+)
+
+func InitPushRoutes(router *gin.Engine) {
+	// Public: the key browsers subscribe with
+	router.GET("/api/push/public-key", controllers.GetPushPublicKey)
+
+	// Your devices' web push subscriptions, for the first-party app only
+	me := router.Group("/me/push-subscriptions")
+	me.Use(libs.JWTMiddleware(), libs.FirstPartyMiddleware())
+	{
+		me.GET("", controllers.GetPushSubscriptions)
+		me.POST("", controllers.CreatePushSubscription)
+		me.PATCH("/:subscriptionId", controllers.UpdatePushSubscription)
+		me.DELETE("/:subscriptionId", controllers.DeletePushSubscription)
+		me.POST("/:subscriptionId/test", controllers.TestPushSubscription)
+	}
+}
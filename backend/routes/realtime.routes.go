@@ -0,0 +1,12 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/controllers"
+)
+
+func InitRealtimeRoutes(router *gin.Engine) {
+	// Realtime collaboration; the socket authenticates itself since
+	// browsers can't send an Authorization header on upgrade
+	router.GET("/ws/boards/:boardId", controllers.BoardSocket)
+}
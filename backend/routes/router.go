@@ -0,0 +1,64 @@
+package routes
+
+import (
+	"log/slog"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/config"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/repository"
+)
+
+// NewRouter builds the Gin engine with global middleware and all routes
+// registered, keeping boards in boards. It is shared by main and the
+// integration tests.
+func NewRouter(cfg *config.Config, boards repository.BoardRepository) *gin.Engine {
+	r := gin.New()
+
+	// A span per request, continuing the caller's trace
+	r.Use(libs.TracingMiddleware())
+
+	// Per-request IDs and structured access logs, in place of gin's
+	// logger. Panics are recovered inside it, so they are logged as 500s.
+	r.Use(libs.RequestLoggingMiddleware())
+	r.Use(gin.Recovery())
+
+	// Client IPs, which auth rate limits go by, are taken from
+	// X-Forwarded-For only when sent by TRUSTED_PROXIES. Gin trusts every
+	// proxy by default, so without any the header is ignored.
+	if err := r.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		slog.Warn("Invalid TRUSTED_PROXIES", "error", err)
+	}
+
+	// Configure CORS: origins from the environment plus per-tenant origins
+	// stored in MongoDB, with rejected origins counted for debugging
+	libs.LoadEnvCORSOrigins()
+	r.Use(cors.New(cors.Config{
+		AllowOriginWithContextFunc: func(c *gin.Context, origin string) bool {
+			return libs.AllowOrigin(c.Request, origin)
+		},
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "Accept", "Content-Encoding", "If-Match", "If-None-Match", libs.RequestIDHeader, "traceparent", "tracestate"},
+		ExposeHeaders:    []string{"Content-Length", "ETag", "X-Quota-Remaining-Boards", "X-Quota-Remaining-Storage", "X-Quota-Remaining-Collaborators", "Retry-After", "X-RateLimit-Limit", "X-RateLimit-Remaining", libs.RequestIDHeader},
+		AllowCredentials: true,
+		MaxAge:           libs.CORSMaxAge(),
+	}))
+
+	// Request bodies are capped at MAX_REQUEST_BODY; boards can balloon
+	r.Use(libs.BodyLimitMiddleware())
+
+	// Verbose, redacted request logging for routes switched on at runtime
+	r.Use(libs.RequestLogMiddleware())
+
+	// Reject writes while the instance is in read-only mode
+	r.Use(libs.ReadOnlyMiddleware())
+
+	// Handlers find boards in the repository the router was built with
+	r.Use(libs.BoardRepositoryMiddleware(boards))
+
+	// Register routes
+	InitRoutes(r)
+
+	return r
+}
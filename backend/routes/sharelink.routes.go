@@ -0,0 +1,25 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/controllers"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/models"
+)
+
+func InitShareLinkRoutes(router *gin.Engine) {
+	// Public: open a board through a share link (the token is the credential)
+	router.GET("/share/:token", controllers.OpenShareLink)
+
+	// Public: follow a short link (the code is the credential for share
+	// links and exports)
+	router.GET("/s/:code", controllers.OpenShortLink)
+
+	// Public: one-click revoke from a share link alert email
+	router.GET("/share-links/revoke", controllers.RevokeShareLinkFromEmail)
+
+	// Public: the board behind a guest token (from a share link) or an
+	// embed token, each only from the origin it was issued to
+	router.GET("/guest/:boardId", libs.BoardTokenMiddleware(models.BoardTokenGuest), libs.RehydrateBoardMiddleware(), controllers.GetTokenBoard)
+	router.GET("/embed/:boardId", libs.BoardTokenMiddleware(models.BoardTokenEmbed), libs.RehydrateBoardMiddleware(), controllers.GetTokenBoard)
+}
@@ -0,0 +1,26 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/controllers"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+	"github.com/sarwanazhar/boardsar/backend/models"
+)
+
+func InitTemplateRoutes(router *gin.Engine) {
+	// Protected template routes
+	template := router.Group("/api/templates")
+	template.Use(libs.JWTMiddleware())
+
+	read := libs.RequireScope(models.ScopeBoardsRead)
+	write := libs.RequireScope(models.ScopeBoardsWrite)
+	{
+		// The user's own templates and the global ones
+		template.GET("", read, controllers.GetTemplates)
+		template.GET("/:templateId", read, controllers.GetTemplate)
+		template.DELETE("/:templateId", write, controllers.DeleteTemplate)
+
+		// Start a new board from a template
+		template.POST("/:templateId/boards", write, controllers.CreateBoardFromTemplate)
+	}
+}
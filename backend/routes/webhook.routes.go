@@ -0,0 +1,24 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/sarwanazhar/boardsar/backend/controllers"
+	"github.com/sarwanazhar/boardsar/backend/libs"
+)
+
+func InitWebhookRoutes(router *gin.Engine) {
+	// Outgoing webhooks on board events, for the first-party app only as
+	// they hand out signing secrets
+	webhooks := router.Group("/api/webhooks")
+	webhooks.Use(libs.JWTMiddleware(), libs.FirstPartyMiddleware())
+	{
+		webhooks.GET("", controllers.GetWebhooks)
+		webhooks.POST("", controllers.CreateWebhook)
+		webhooks.GET("/:webhookId", controllers.GetWebhook)
+		webhooks.PATCH("/:webhookId", controllers.UpdateWebhook)
+		webhooks.DELETE("/:webhookId", controllers.DeleteWebhook)
+
+		// Recent deliveries and how each went
+		webhooks.GET("/:webhookId/deliveries", controllers.GetWebhookDeliveries)
+	}
+}